@@ -0,0 +1,100 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"github.com/nalej/installer/internal/app/installer-cli"
+	"github.com/nalej/installer/internal/pkg/utils"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var backupKubeConfigPath string
+var backupNamespace string
+var restoreNamespace string
+var backupPath string
+var backupKeyPath string
+
+var backupLongHelp = `
+Backup the management cluster
+
+The ConfigMaps and Secrets of the nalej namespace and the CustomResourceDefinitions
+created by the installer are exported into a portable archive. Secrets are encrypted
+with the key stored in --keyFile, which is generated if it does not exist and must be
+kept to restore the backup.
+`
+
+var backupExample = `
+
+# Export the management cluster
+installer-cli backup --kubeConfigPath mngt.yaml --backupFile nalej-backup.tar.gz --keyFile nalej-backup.key
+
+# Restore it on a new cluster
+installer-cli restore --kubeConfigPath new-mngt.yaml --backupFile nalej-backup.tar.gz --keyFile nalej-backup.key
+`
+
+var backupCmd = &cobra.Command{
+	Use:     "backup",
+	Short:   "Export the configuration and secrets of the management cluster",
+	Long:    backupLongHelp,
+	Example: backupExample,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		checkBackupFlags()
+		_, err := installer_cli.Backup(utils.GetPath(backupKubeConfigPath), backupNamespace, utils.GetPath(backupPath), utils.GetPath(backupKeyPath))
+		if err != nil {
+			log.Fatal().Str("error", err.DebugReport()).Msg("cannot create backup")
+		}
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:     "restore",
+	Short:   "Restore a management cluster backup",
+	Long:    "Create the objects of a backup that do not exist on the target cluster",
+	Example: backupExample,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		checkBackupFlags()
+		_, err := installer_cli.Restore(utils.GetPath(backupKubeConfigPath), utils.GetPath(backupPath), utils.GetPath(backupKeyPath), restoreNamespace)
+		if err != nil {
+			log.Fatal().Str("error", err.DebugReport()).Msg("cannot restore backup")
+		}
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{backupCmd, restoreCmd} {
+		cmd.Flags().StringVar(&backupKubeConfigPath, "kubeConfigPath", "", "KubeConfig path of the cluster")
+		cmd.Flags().StringVar(&backupPath, "backupFile", "nalej-backup.tar.gz", "Path of the backup archive")
+		cmd.Flags().StringVar(&backupKeyPath, "keyFile", "nalej-backup.key", "Path of the key used to encrypt the secrets")
+		rootCmd.AddCommand(cmd)
+	}
+	backupCmd.Flags().StringVar(&backupNamespace, "namespace", k8s.NalejNamespace, "Namespace to be exported")
+	restoreCmd.Flags().StringVar(&restoreNamespace, "namespace", "", "Namespace where the objects are restored, the original one if not set")
+}
+
+// checkBackupFlags validates the flags shared by the backup and restore commands.
+func checkBackupFlags() {
+	if backupKubeConfigPath == "" {
+		log.Fatal().Msg("kubeConfigPath must be set")
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"os"
+
+	"github.com/nalej/installer/internal/app/installer-cli"
+	"github.com/nalej/installer/internal/pkg/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var compatibilityManifestPath string
+
+var compatibilityLongHelp = `
+Print the compatibility matrix
+
+For each installer release, the matrix lists the versions of the platform components,
+the range of Kubernetes versions and the Istio versions that are supported. Installs
+check the versions of the environment against the matrix before they start, and refuse
+unsupported combinations unless --allowUnsupportedVersions is set.
+`
+
+var compatibilityExample = `
+
+# Print the builtin compatibility matrix
+installer-cli compatibility
+
+# Print a custom compatibility manifest as JSON
+installer-cli compatibility --manifest compatibility.json --output json
+`
+
+var compatibilityCmd = &cobra.Command{
+	Use:     "compatibility",
+	Short:   "Print the compatibility matrix",
+	Long:    compatibilityLongHelp,
+	Example: compatibilityExample,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		PrintCompatibility()
+	},
+}
+
+func init() {
+	compatibilityCmd.Flags().StringVar(&compatibilityManifestPath, "manifest", "",
+		"Compatibility manifest to be printed instead of the builtin one")
+	addOutputOptions(compatibilityCmd)
+	rootCmd.AddCommand(compatibilityCmd)
+}
+
+// PrintCompatibility writes the compatibility matrix on the standard output.
+func PrintCompatibility() {
+	format, err := installer_cli.OutputFormatFromString(outputFormat)
+	if err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("invalid output format")
+	}
+	manifestPath := ""
+	if compatibilityManifestPath != "" {
+		manifestPath = utils.GetPath(compatibilityManifestPath)
+	}
+	if err := installer_cli.WriteCompatibility(os.Stdout, format, manifestPath); err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("cannot print compatibility matrix")
+	}
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"fmt"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/app/installer-cli"
+	"github.com/nalej/installer/internal/pkg/entities"
+	"github.com/nalej/installer/internal/pkg/logging"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+var completionLongHelp = `
+Generate the shell completion script
+
+The generated script completes commands, flags, file and directory paths, and the
+values of enumerated flags such as targetPlatform, targetEnvironment or networkingMode.
+`
+
+var completionExample = `
+
+# Load the bash completion in the current shell
+source <(installer-cli completion bash)
+
+# Install the zsh completion
+installer-cli completion zsh > "${fpath[1]}/_installer-cli"
+
+# Install the fish completion
+installer-cli completion fish > ~/.config/fish/completions/installer-cli.fish
+`
+
+var completionCmd = &cobra.Command{
+	Use:       "completion <bash|zsh|fish>",
+	Short:     "Generate the shell completion script",
+	Long:      completionLongHelp,
+	Example:   completionExample,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		if err := GenerateCompletion(args[0], os.Stdout); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// pathFlags contains the flags that expect a file.
+var pathFlags = []string{"kubeConfigPath", "privateKeyPath", "clusterCertIssuerCACertPath", "config", "params", "workflow", "identityKubeConfig", "keyFile", "backupFile", "componentsPublicKey", "registriesPath", "secretStorePath", "privateKey", "publicKey", "managementKubeConfigPath"}
+
+// dirFlags contains the flags that expect a directory.
+var dirFlags = []string{"componentsPath", "binaryPath", "confPath", "tempPath", "istioPath"}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+}
+
+// enumFlags returns the accepted values of the flags that expect an enumeration.
+func enumFlags() map[string][]string {
+	platforms := make([]string, 0, len(grpc_installer_go.Platform_value)+1)
+	for name := range grpc_installer_go.Platform_value {
+		platforms = append(platforms, name)
+	}
+	platforms = append(platforms, entities.OpenShiftPlatform)
+	sort.Strings(platforms)
+	environments := make([]string, 0, len(entities.TargetEnvironmentToString))
+	for _, name := range entities.TargetEnvironmentToString {
+		environments = append(environments, name)
+	}
+	sort.Strings(environments)
+	modes := make([]string, 0, len(entities.NetworkingModeToString))
+	for _, name := range entities.NetworkingModeToString {
+		modes = append(modes, name)
+	}
+	sort.Strings(modes)
+	return map[string][]string{
+		"targetPlatform":    platforms,
+		"targetEnvironment": environments,
+		"networkingMode":    modes,
+		"output":            {string(installer_cli.JSONOutput), string(installer_cli.YAMLOutput)},
+		"logLevel":          {"trace", "debug", "info", "warn", "error"},
+		"logFormat":         {logging.JSONFormat, logging.ConsoleFormat},
+	}
+}
+
+// completionFunctionName returns the name of the bash function that completes the values of a flag.
+func completionFunctionName(flagName string) string {
+	return "__installer-cli_complete_" + flagName
+}
+
+// annotateFlags adds the completion annotations to the flags of a command and its subcommands.
+func annotateFlags(cmd *cobra.Command, enums map[string][]string) {
+	annotate := func(flags *pflag.FlagSet) {
+		flags.VisitAll(func(flag *pflag.Flag) {
+			if _, found := enums[flag.Name]; found {
+				flags.SetAnnotation(flag.Name, cobra.BashCompCustom, []string{completionFunctionName(flag.Name)})
+			}
+			for _, name := range pathFlags {
+				if name == flag.Name {
+					flags.SetAnnotation(flag.Name, cobra.BashCompFilenameExt, []string{})
+				}
+			}
+			for _, name := range dirFlags {
+				if name == flag.Name {
+					flags.SetAnnotation(flag.Name, cobra.BashCompSubdirsInDir, []string{})
+				}
+			}
+		})
+	}
+	annotate(cmd.LocalNonPersistentFlags())
+	annotate(cmd.PersistentFlags())
+	for _, child := range cmd.Commands() {
+		annotateFlags(child, enums)
+	}
+}
+
+// GenerateCompletion writes the completion script of the given shell.
+func GenerateCompletion(shell string, out io.Writer) error {
+	enums := enumFlags()
+	annotateFlags(rootCmd, enums)
+	switch shell {
+	case "bash":
+		names := make([]string, 0, len(enums))
+		for name := range enums {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		functions := new(strings.Builder)
+		for _, name := range names {
+			fmt.Fprintf(functions, "%s()\n{\n    COMPREPLY=( $(compgen -W \"%s\" -- \"$cur\") )\n}\n",
+				completionFunctionName(name), strings.Join(enums[name], " "))
+		}
+		rootCmd.BashCompletionFunction = functions.String()
+		return rootCmd.GenBashCompletion(out)
+	case "zsh":
+		return rootCmd.GenZshCompletion(out)
+	case "fish":
+		return genFishCompletion(rootCmd, enums, out)
+	}
+	return fmt.Errorf("unsupported shell %s", shell)
+}
+
+// genFishCompletion writes the fish completion script of a command and its subcommands.
+func genFishCompletion(root *cobra.Command, enums map[string][]string, out io.Writer) error {
+	name := root.Name()
+	fmt.Fprintf(out, "# fish completion for %s\n", name)
+	fmt.Fprintf(out, "complete -c %s -f\n", name)
+	var visit func(cmd *cobra.Command, path []string)
+	visit = func(cmd *cobra.Command, path []string) {
+		condition := "__fish_use_subcommand"
+		if len(path) > 0 {
+			condition = "__fish_seen_subcommand_from " + path[len(path)-1]
+		}
+		for _, child := range cmd.Commands() {
+			if !child.IsAvailableCommand() {
+				continue
+			}
+			fmt.Fprintf(out, "complete -c %s -n '%s' -a %s -d %q\n", name, condition, child.Name(), child.Short)
+		}
+		cmd.NonInheritedFlags().VisitAll(func(flag *pflag.Flag) {
+			if flag.Hidden {
+				return
+			}
+			line := fmt.Sprintf("complete -c %s -l %s -d %q", name, flag.Name, flag.Usage)
+			if len(path) > 0 {
+				line = fmt.Sprintf("complete -c %s -n '%s' -l %s -d %q", name, condition, flag.Name, flag.Usage)
+			}
+			if values, found := enums[flag.Name]; found {
+				line += fmt.Sprintf(" -x -a %q", strings.Join(values, " "))
+			} else if _, isFile := flag.Annotations[cobra.BashCompFilenameExt]; isFile {
+				line += " -r -F"
+			} else if _, isDir := flag.Annotations[cobra.BashCompSubdirsInDir]; isDir {
+				line += " -x -a '(__fish_complete_directories)'"
+			} else if flag.Value.Type() != "bool" {
+				line += " -r"
+			}
+			fmt.Fprintln(out, line)
+		})
+		for _, child := range cmd.Commands() {
+			if child.IsAvailableCommand() {
+				visit(child, append(path, child.Name()))
+			}
+		}
+	}
+	visit(root, []string{})
+	return nil
+}
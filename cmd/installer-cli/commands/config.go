@@ -0,0 +1,94 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the CLI configuration",
+	Long:  `Manage the configuration of the CLI defined with the config file, environment variables and flags`,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		cmd.Help()
+	},
+}
+
+var configViewLongHelp = `
+Show the effective configuration
+
+Prints the value of every flag supported by the CLI together with its source. Values
+are resolved with the following precedence: command line flags, NALEJ_INSTALLER_*
+environment variables, the configuration file, and the flag defaults. Passwords,
+secrets and tokens are masked.
+`
+
+var configViewExample = `
+
+# Show the configuration resolved from the default configuration file
+installer-cli config view
+
+# Show the configuration resolved from a given file and the environment
+NALEJ_INSTALLER_TARGET_PLATFORM=AZURE installer-cli config view --config nalej/installer-cli.yaml
+`
+
+var configViewCmd = &cobra.Command{
+	Use:     "view",
+	Short:   "Show the effective configuration",
+	Long:    configViewLongHelp,
+	Example: configViewExample,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		ViewConfig()
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configViewCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// allFlags returns the flags of a command and its subcommands.
+func allFlags(cmd *cobra.Command, flags *pflag.FlagSet) {
+	flags.AddFlagSet(cmd.Flags())
+	flags.AddFlagSet(cmd.PersistentFlags())
+	for _, child := range cmd.Commands() {
+		allFlags(child, flags)
+	}
+}
+
+// ViewConfig prints the effective configuration of all the flags of the CLI.
+func ViewConfig() {
+	flags := pflag.NewFlagSet("installer-cli", pflag.ContinueOnError)
+	allFlags(rootCmd, flags)
+	if err := effectiveConfig.Apply(flags); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if effectiveConfig.Path != "" {
+		fmt.Printf("# configuration file: %s\n", effectiveConfig.Path)
+	}
+	for _, entry := range effectiveConfig.Entries(flags) {
+		fmt.Println(entry.String())
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"os"
+
+	"github.com/nalej/installer/internal/app/installer-cli"
+	"github.com/nalej/installer/internal/pkg/utils"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var diffKubeConfigPath string
+var diffComponentsPath string
+var diffTargetPlatform string
+var diffTargetEnvironment string
+var diffComponentsPublicKey string
+var diffRegistriesPath string
+var diffStorageClassesPath string
+var diffInstallID string
+var diffPrune bool
+var diffNoColor bool
+var diffExitCode bool
+
+var diffLongHelp = `
+Show the changes an install or upgrade would perform
+
+The components are rendered as they would be by the install and compared with the
+objects of the cluster. Each object is reported as created, updated with the fields that
+change, or unchanged. If --installID and --prune are set, the objects of a previous install
+that are no longer part of the components are reported as pruned. The cluster is not modified.
+`
+
+var diffExample = `
+
+# Show the changes on a management cluster
+installer-cli diff --kubeConfigPath mngt.yaml --componentsPath ./assets/mngt/
+
+# Write the changes as JSON, including the objects to be pruned
+installer-cli diff --kubeConfigPath mngt.yaml --componentsPath ./assets/mngt/ \
+  --installID cluster-id --prune --output json
+`
+
+var diffCmd = &cobra.Command{
+	Use:     "diff",
+	Short:   "Show the changes an install would perform",
+	Long:    diffLongHelp,
+	Example: diffExample,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		PrintDiff()
+	},
+}
+
+func init() {
+	diffCmd.Flags().StringVar(&diffKubeConfigPath, "kubeConfigPath", "", "KubeConfig path of the cluster")
+	diffCmd.Flags().StringVar(&diffComponentsPath, "componentsPath", "./assets/", "Directory with the components to be compared")
+	diffCmd.Flags().StringVar(&diffTargetPlatform, "targetPlatform", "MINIKUBE", "Target platform: MINIKUBE, AZURE, BAREMETAL or OPENSHIFT")
+	diffCmd.Flags().StringVar(&diffTargetEnvironment, "targetEnvironment", "PRODUCTION", "Target environment: PRODUCTION, STAGING, or DEVELOPMENT")
+	diffCmd.Flags().StringVar(&diffComponentsPublicKey, "componentsPublicKey", "",
+		"Public key used to verify the signed index of the components")
+	diffCmd.Flags().StringVar(&diffRegistriesPath, "registriesPath", "",
+		"File with the registries used to pull the images of the components and the pull secret of each image prefix")
+	diffCmd.Flags().StringVar(&diffStorageClassesPath, "storageClassesPath", "",
+		"File with the storage classes of the persistent volumes and claims by platform and by name")
+	diffCmd.Flags().StringVar(&diffInstallID, "installID", "", "Identifier of the install the objects are labeled with")
+	diffCmd.Flags().BoolVar(&diffPrune, "prune", false, "Report the objects of the install that are no longer part of the components")
+	diffCmd.Flags().BoolVar(&diffNoColor, "noColor", false, "Disable the colors of the text output")
+	diffCmd.Flags().BoolVar(&diffExitCode, "exitCode", false, "Exit with status 2 if there are changes")
+	addOutputOptions(diffCmd)
+	rootCmd.AddCommand(diffCmd)
+}
+
+// PrintDiff writes the changes an install would perform on the standard output.
+func PrintDiff() {
+	if diffKubeConfigPath == "" {
+		log.Fatal().Msg("kubeConfigPath must be set")
+	}
+	format, err := installer_cli.OutputFormatFromString(outputFormat)
+	if err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("invalid output format")
+	}
+	launch := k8s.NewLaunchComponents(utils.GetPath(diffKubeConfigPath), []string{k8s.NalejNamespace, "ingress-nginx"},
+		utils.GetPath(diffComponentsPath), diffTargetPlatform)
+	launch.Environment = diffTargetEnvironment
+	launch.InstallID = diffInstallID
+	launch.Prune = diffPrune
+	if diffComponentsPublicKey != "" {
+		launch.SignaturePublicKeyPath = utils.GetPath(diffComponentsPublicKey)
+	}
+	if diffRegistriesPath != "" {
+		launch.RegistriesPath = utils.GetPath(diffRegistriesPath)
+	}
+	if diffStorageClassesPath != "" {
+		launch.StorageClassesPath = utils.GetPath(diffStorageClassesPath)
+	}
+	report, err := launch.Diff()
+	if err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("cannot compute diff")
+	}
+	if err := installer_cli.WriteDiff(os.Stdout, format, report, !diffNoColor); err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("cannot print diff")
+	}
+	if diffExitCode && report.HasChanges() {
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/app/installer-cli"
+	"github.com/nalej/installer/internal/pkg/templates"
+	"github.com/nalej/installer/internal/pkg/utils"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var identityParamsPath string
+var identityWorkflowPath string
+var identityName string
+var identityNamespace string
+var identityCreate bool
+var identityKubeConfigPath string
+var identityOutputPath string
+
+var installIdentityLongHelp = `
+Generate the identity used by the installer
+
+The commands of the workflow are inspected to determine the Kubernetes objects they
+access, including the kinds found in the components directory, and the minimal
+ClusterRole able to execute it is generated along with a ServiceAccount and the
+ClusterRoleBinding between them. The objects are printed as YAML unless --create is
+set, in which case they are created using --kubeConfigPath and the kubeconfig of the
+new identity is written to --identityKubeConfig.
+`
+
+var installIdentityExample = `
+
+# Print the identity required by the builtin install workflow
+installer-cli install-identity --params params.json
+
+# Create the identity and write its kubeconfig
+installer-cli install-identity --params params.json --create \
+  --kubeConfigPath admin.yaml --identityKubeConfig installer.yaml
+`
+
+var installIdentityCmd = &cobra.Command{
+	Use:     "install-identity",
+	Short:   "Generate the least privileged identity used by the installer",
+	Long:    installIdentityLongHelp,
+	Example: installIdentityExample,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		InstallIdentity()
+	},
+}
+
+func init() {
+	installIdentityCmd.Flags().StringVar(&identityParamsPath, "params", "",
+		"Path of a JSON file with the parameters used to render the workflow template")
+	installIdentityCmd.Flags().StringVar(&identityWorkflowPath, "workflow", "",
+		"Path of the workflow template, the builtin install workflow is used if not set")
+	installIdentityCmd.Flags().StringVar(&identityName, "name", k8s.DefaultIdentityName,
+		"Name of the service account, cluster role and binding")
+	installIdentityCmd.Flags().StringVar(&identityNamespace, "namespace", k8s.DefaultIdentityNamespace,
+		"Namespace of the service account")
+	installIdentityCmd.Flags().BoolVar(&identityCreate, "create", false,
+		"Create the identity on the cluster instead of printing it")
+	installIdentityCmd.Flags().StringVar(&identityKubeConfigPath, "kubeConfigPath", "",
+		"KubeConfig path used to create the identity")
+	installIdentityCmd.Flags().StringVar(&identityOutputPath, "identityKubeConfig", "installer-kubeconfig.yaml",
+		"Path where the kubeconfig of the created identity is written")
+	rootCmd.AddCommand(installIdentityCmd)
+}
+
+// InstallIdentity generates the identity required to execute a workflow.
+func InstallIdentity() {
+	template := templates.InstallManagementCluster
+	if identityWorkflowPath != "" {
+		content, err := ioutil.ReadFile(identityWorkflowPath)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", identityWorkflowPath).Msg("cannot read workflow")
+		}
+		template = string(content)
+	}
+	params := &workflow.Parameters{
+		InstallRequest: &grpc_installer_go.InstallRequest{
+			StaticIpAddresses: &grpc_installer_go.StaticIPAddresses{},
+		},
+	}
+	if identityParamsPath != "" {
+		loaded, err := workflow.NewParametersFromFile(identityParamsPath)
+		if err != nil {
+			log.Fatal().Str("error", err.DebugReport()).Msg("cannot load parameters")
+		}
+		params = loaded
+	}
+
+	identity, err := installer_cli.NewInstallIdentity(template, *params, identityName, identityNamespace)
+	if err != nil {
+		log.Fatal().Str("error", err.DebugReport()).Msg("cannot generate install identity")
+	}
+	if !identityCreate {
+		if err := installer_cli.WriteInstallIdentity(os.Stdout, identity); err != nil {
+			log.Fatal().Str("error", err.DebugReport()).Msg("cannot write install identity")
+		}
+		return
+	}
+	if identityKubeConfigPath == "" {
+		log.Fatal().Msg("kubeConfigPath must be set to create the install identity")
+	}
+	if err := installer_cli.CreateInstallIdentity(utils.GetPath(identityKubeConfigPath), identity, utils.GetPath(identityOutputPath)); err != nil {
+		log.Fatal().Str("error", err.DebugReport()).Msg("cannot create install identity")
+	}
+}
@@ -22,13 +22,18 @@ import (
 	"os"
 
 	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/bundle"
 	"github.com/nalej/installer/internal/pkg/utils"
 	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/logstack"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
 var explainPlan bool
+var renderOnly string
+var outputFormat string
 
 var installKubernetes bool
 var kubeConfigPath string
@@ -49,6 +54,14 @@ var dnsClusterHost string
 var dnsClusterPort int
 
 var componentsPath string
+var componentsPublicKeyPath string
+var registriesPath string
+var secretStorePath string
+var namespaceGovernancePath string
+var crdsPath string
+var storageClassesPath string
+var componentsUsername string
+var componentsPassword string
 var binaryPath string
 var confPath string
 var tempPath string
@@ -58,13 +71,54 @@ var clusterCertIssuerCACertPath string
 var networkingMode string
 
 var istioPath string
+var istioctlImage string
+var istioRevision string
+var istioTrustDomain string
+var istioNamespace string
+var istioIngressGateway string
+var istioCASecret string
+var istioGatewayIP string
+var ingressController string
+var clusterDomain string
+var certificateIssuer string
+var internalCACertPath string
+var internalCAKeyPath string
+
+var hardenNetwork bool
+var withObservability bool
+var loggingStack string
+var storageProvisioner string
+var nfsShare string
+var logRetention string
+var logStorageSize string
+var pruneComponents bool
+var adoptExisting bool
+var migrateVolumes bool
+var featureFlags map[string]string
+var authSecretLength int
+var authSecretEncoding string
+var allowUnsupportedVersions bool
+
+var templateName string
+var templateVersion string
 
 var environment entities.Environment
 
+var installExample = `
+
+# Install a management cluster in Azure
+installer-cli install management --targetPlatform=AZURE --kubeConfigPath=nalej/mngtCluster.yaml \
+  --managementClusterPublicHost=nalej.example.com --dnsClusterPublicHost=dns.nalej.example.com
+
+# Install a management cluster prompting for the required values
+installer-cli install wizard
+`
+
 var cliCmd = &cobra.Command{
-	Use:   "install",
-	Short: "Install the Nalej platform",
-	Long:  `Install the components of the Nalej platform into an existing cluster`,
+	Use:     "install",
+	Short:   "Install the Nalej platform",
+	Long:    `Install the components of the Nalej platform into an existing cluster`,
+	Example: installExample,
 	Run: func(cmd *cobra.Command, args []string) {
 		SetupLogging()
 		cmd.Help()
@@ -74,6 +128,8 @@ var cliCmd = &cobra.Command{
 func init() {
 	cliCmd.PersistentFlags().BoolVar(&explainPlan, "explainPlan", false,
 		"Show install plan instead of performing the install")
+	cliCmd.PersistentFlags().StringVar(&renderOnly, "renderOnly", "",
+		"Write the manifests of the components to this directory instead of performing the install")
 	cliCmd.PersistentFlags().BoolVar(&installKubernetes, "installK8s", false,
 		"Whether kubernetes should be installed")
 	cliCmd.PersistentFlags().StringVar(&kubeConfigPath, "kubeConfigPath", "~/.kube/config",
@@ -84,10 +140,9 @@ func init() {
 		"Specify the private key path to connect to the remote machine (Only if installK8s is selected)")
 	cliCmd.PersistentFlags().StringVar(&nodes, "nodes", "",
 		"List of IPs of the nodes to be installed separated by comma (Only if installK8s is selected)")
-	cliCmd.PersistentFlags().StringVar(&targetPlatform, "targetPlatform", "MINIKUBE", "Target platform: MINIKUBE, AZURE or BAREMETAL")
+	cliCmd.PersistentFlags().StringVar(&targetPlatform, "targetPlatform", "MINIKUBE", "Target platform: MINIKUBE, AZURE, BAREMETAL or OPENSHIFT")
 	cliCmd.PersistentFlags().StringVar(&managementPublicHost, "managementClusterPublicHost", "",
 		"Public FQDN where the management cluster is reachable by the application clusters")
-	cliCmd.MarkPersistentFlagRequired("managementClusterPublicHost")
 
 	cliCmd.PersistentFlags().BoolVar(&useStaticIPAddresses, "useStaticIPAddresses", false,
 		"Use statically assigned IP Addresses for the public facing services")
@@ -102,12 +157,27 @@ func init() {
 
 	cliCmd.PersistentFlags().StringVar(&dnsClusterHost, "dnsClusterPublicHost", "",
 		"Public FQDN where the management cluster is reachable for DNS requests by the application clusters")
-	cliCmd.MarkPersistentFlagRequired("dnsClusterPublicHost")
 	cliCmd.PersistentFlags().IntVar(&dnsClusterPort, "dnsClusterPublicPort", 53,
 		"Public port where the management cluster is reachable for DNS request by the application clusters")
 
 	cliCmd.PersistentFlags().StringVar(&componentsPath, "componentsPath", "./assets/",
-		"Directory with the components to be installed")
+		"Directory with the components to be installed, an https URL or an oci:// reference of a components bundle")
+	cliCmd.PersistentFlags().StringVar(&componentsUsername, "componentsUsername", "",
+		"Username to download the components bundle, if required")
+	cliCmd.PersistentFlags().StringVar(&componentsPassword, "componentsPassword", "",
+		"Password to download the components bundle, if required")
+	cliCmd.PersistentFlags().StringVar(&componentsPublicKeyPath, "componentsPublicKey", "",
+		"Public key used to verify the signed index of the components, see sign-components")
+	cliCmd.PersistentFlags().StringVar(&registriesPath, "registriesPath", "",
+		"File with the registries used to pull the images of the components and the pull secret of each image prefix")
+	cliCmd.PersistentFlags().StringVar(&secretStorePath, "secretStorePath", "",
+		"File with the external secret store whose values back the secrets created by the installer")
+	cliCmd.PersistentFlags().StringVar(&namespaceGovernancePath, "namespaceGovernancePath", "",
+		"File with the labels, limits and quotas of the platform namespaces by target environment")
+	cliCmd.PersistentFlags().StringVar(&crdsPath, "crdsPath", "",
+		"Directory with the custom resource definitions created and established before launching the components")
+	cliCmd.PersistentFlags().StringVar(&storageClassesPath, "storageClassesPath", "",
+		"File with the storage classes of the persistent volumes and claims by platform and by name")
 	cliCmd.PersistentFlags().StringVar(&binaryPath, "binaryPath", "./bin/",
 		"Directory with the binary executables")
 	cliCmd.PersistentFlags().StringVar(&confPath, "confPath", "./conf/",
@@ -120,13 +190,76 @@ func init() {
 		"Networking mode to be used [zt, istio]")
 	cliCmd.PersistentFlags().StringVar(&istioPath, "istioPath", "/istio/bin",
 		"Path to the folder containing the istioctl executable file")
-
-
+	cliCmd.PersistentFlags().StringVar(&istioctlImage, "istioctlImage", "",
+		"Image running istioctl with docker if the istioPath has no istioctl for the host platform")
+	cliCmd.PersistentFlags().StringVar(&istioRevision, "istioRevision", "",
+		"Revision of the Istio control plane whose sidecar injector is used, the default injector is used if not set")
+	cliCmd.PersistentFlags().StringVar(&istioTrustDomain, "istioTrustDomain", "",
+		"SPIFFE trust domain of the Istio mesh, cluster.local if not set")
+	cliCmd.PersistentFlags().StringVar(&istioNamespace, "istioNamespace", "",
+		"Namespace where Istio is installed, such as istio-system-rev1, istio-system if not set")
+	cliCmd.PersistentFlags().StringVar(&istioIngressGateway, "istioIngressGateway", "",
+		"Name of the service of the Istio ingress gateway, istio-ingressgateway if not set")
+	cliCmd.PersistentFlags().StringVar(&istioCASecret, "istioCASecret", "",
+		"Name of the secret with the CAs of Istio, cacerts if not set")
+	cliCmd.PersistentFlags().StringVar(&istioGatewayIP, "istioGatewayIP", "",
+		"IP of the Istio ingress gateway of the management cluster joined by application clusters, looked up in the management cluster if not set")
+	cliCmd.PersistentFlags().StringVar(&ingressController, "ingressController", "",
+		"Ingress controller [nginx, traefik, istio], the Istio gateway is used with the istio networking mode and NGINX otherwise if not set")
+	cliCmd.PersistentFlags().StringVar(&clusterDomain, "clusterDomain", "",
+		"DNS domain of the services of the management cluster stored in the management config, cluster.local if not set")
+	cliCmd.PersistentFlags().StringVar(&certificateIssuer, "certificateIssuer", k8s.LetsEncryptMode,
+		"Issuer of the ingress certificates [letsencrypt, internal], internal uses a CA for clusters that cannot reach Let's Encrypt")
+	cliCmd.PersistentFlags().StringVar(&internalCACertPath, "internalCACertPath", "",
+		"Certificate of the CA of the internal certificate issuer, the CA of a previous install is kept or a new one is generated if not set")
+	cliCmd.PersistentFlags().StringVar(&internalCAKeyPath, "internalCAKeyPath", "",
+		"Private key of the CA of the internal certificate issuer")
+	cliCmd.PersistentFlags().StringVar(&templateName, "template", "",
+		"Name of the workflow template found in confPath to be used instead of the builtin one")
+	cliCmd.PersistentFlags().StringVar(&templateVersion, "templateVersion", "",
+		"Version of the workflow template, the latest one is used if not set")
+	cliCmd.PersistentFlags().BoolVar(&hardenNetwork, "hardenNetwork", false,
+		"Install network policies restricting the traffic into the platform namespaces")
+	cliCmd.PersistentFlags().BoolVar(&withObservability, "withObservability", false,
+		"Install Prometheus, Grafana and Jaeger, and Kiali with the istio networking mode")
+	cliCmd.PersistentFlags().StringVar(&loggingStack, "loggingStack", "",
+		"Install a stack collecting the logs of the platform namespaces [loki, efk]")
+	cliCmd.PersistentFlags().StringVar(&logRetention, "logRetention", logstack.DefaultRetention,
+		"Duration the logs are kept by the logging stack, rounded up to whole days")
+	cliCmd.PersistentFlags().StringVar(&logStorageSize, "logStorageSize", logstack.DefaultStorageSize,
+		"Size of the volume storing the logs of the logging stack")
+	cliCmd.PersistentFlags().StringVar(&storageProvisioner, "storageProvisioner", "",
+		"Install a default provisioner of persistent volumes on baremetal and minikube clusters without one [local-path, nfs]")
+	cliCmd.PersistentFlags().StringVar(&nfsShare, "nfsShare", "",
+		"Share of the volumes of the nfs storage provisioner as server:/path")
+	cliCmd.PersistentFlags().BoolVar(&pruneComponents, "prune", false,
+		"Remove the components of previous installs that are no longer part of the components path")
+	cliCmd.PersistentFlags().BoolVar(&adoptExisting, "adoptExisting", false,
+		"Take over the existing components that were not created by the installer instead of failing")
+	cliCmd.PersistentFlags().BoolVar(&migrateVolumes, "migrateVolumes", false,
+		"Copy the data of the claims whose size is increased to new claims if their volumes cannot be expanded")
+	cliCmd.PersistentFlags().StringToStringVar(&featureFlags, "featureFlag", nil,
+		"Feature flag exposed to the components as name=value, can be repeated")
+	cliCmd.PersistentFlags().IntVar(&authSecretLength, "authSecretLength", 0,
+		"Number of random bytes of the generated authx secret, 32 if not set")
+	cliCmd.PersistentFlags().StringVar(&authSecretEncoding, "authSecretEncoding", "",
+		"Encoding of the generated authx secret [base64, hex], base64 if not set")
+	cliCmd.PersistentFlags().BoolVar(&allowUnsupportedVersions, "allowUnsupportedVersions", false,
+		"Continue the install if the versions are not part of the compatibility matrix")
+
+
+	addOutputOptions(cliCmd)
 	addRegistryOptions(cliCmd)
 
 	rootCmd.AddCommand(cliCmd)
 }
 
+// Add parameters related to the format of the result.
+func addOutputOptions(cliCmd *cobra.Command) {
+	cliCmd.PersistentFlags().StringVar(&outputFormat, "output", "",
+		"Write the result of the operation in a machine readable format: json or yaml")
+}
+
 // Add parameters related to the usage of registries.
 func addRegistryOptions(cliCmd *cobra.Command) {
 	cliCmd.PersistentFlags().StringVar(&environment.TargetEnvironment, "targetEnvironment", "PRODUCTION", "Target environment to be installed: PRODUCTION, STAGING, or DEVELOPMENT")
@@ -139,14 +272,9 @@ func CheckExists(path string) bool {
 
 func GetPaths() (*workflow.Paths, derrors.Error) {
 
-	components := utils.ExtendComponentsPath(utils.GetPath(componentsPath), false)
 	binary := utils.GetPath(binaryPath)
 	temp := utils.GetPath(tempPath)
 
-	if !CheckExists(components) {
-		return nil, derrors.NewNotFoundError("components directory does not exist").WithParams(components)
-	}
-
 	if !CheckExists(binary) {
 		return nil, derrors.NewNotFoundError("binary directory does not exists").WithParams(binary)
 	}
@@ -158,19 +286,110 @@ func GetPaths() (*workflow.Paths, derrors.Error) {
 		}
 	}
 
+	root := utils.GetPath(componentsPath)
+	if bundle.IsRemote(componentsPath) {
+		fetcher := bundle.NewFetcher(bundle.Credentials{Username: componentsUsername, Password: componentsPassword})
+		fetched, err := fetcher.Fetch(componentsPath, temp)
+		if err != nil {
+			return nil, err
+		}
+		root = fetched
+	}
+	components := utils.ExtendComponentsPath(root, false)
+	if !CheckExists(components) {
+		return nil, derrors.NewNotFoundError("components directory does not exist").WithParams(components)
+	}
+
 	log.Info().Str("path", components).Msg("Components")
 	log.Info().Str("path", binary).Msg("Binaries")
 	log.Info().Str("path", temp).Msg("Temporal files")
 
+	publicKey := ""
+	if componentsPublicKeyPath != "" {
+		publicKey = utils.GetPath(componentsPublicKeyPath)
+		log.Info().Str("path", publicKey).Msg("Components public key")
+	}
+
+	registries := ""
+	if registriesPath != "" {
+		registries = utils.GetPath(registriesPath)
+		if !CheckExists(registries) {
+			return nil, derrors.NewNotFoundError("registries file does not exist").WithParams(registries)
+		}
+		log.Info().Str("path", registries).Msg("Registries")
+	}
+
+	secretStore := ""
+	if secretStorePath != "" {
+		secretStore = utils.GetPath(secretStorePath)
+		if !CheckExists(secretStore) {
+			return nil, derrors.NewNotFoundError("secret store file does not exist").WithParams(secretStore)
+		}
+		log.Info().Str("path", secretStore).Msg("Secret store")
+	}
+
+	governance := ""
+	if namespaceGovernancePath != "" {
+		governance = utils.GetPath(namespaceGovernancePath)
+		if !CheckExists(governance) {
+			return nil, derrors.NewNotFoundError("namespace governance file does not exist").WithParams(governance)
+		}
+		log.Info().Str("path", governance).Msg("Namespace governance")
+	}
+
+	crds := ""
+	if crdsPath != "" {
+		crds = utils.GetPath(crdsPath)
+		if !CheckExists(crds) {
+			return nil, derrors.NewNotFoundError("custom resource definitions directory does not exist").WithParams(crds)
+		}
+		log.Info().Str("path", crds).Msg("Custom resource definitions")
+	}
+
+	storageClasses := ""
+	if storageClassesPath != "" {
+		storageClasses = utils.GetPath(storageClassesPath)
+		if !CheckExists(storageClasses) {
+			return nil, derrors.NewNotFoundError("storage classes file does not exist").WithParams(storageClasses)
+		}
+		log.Info().Str("path", storageClasses).Msg("Storage classes")
+	}
+
+	internalCACert, internalCAKey := "", ""
+	if internalCACertPath != "" {
+		internalCACert, internalCAKey = utils.GetPath(internalCACertPath), utils.GetPath(internalCAKeyPath)
+		if !CheckExists(internalCACert) || !CheckExists(internalCAKey) {
+			return nil, derrors.NewNotFoundError("internal CA files do not exist").WithParams(internalCACert, internalCAKey)
+		}
+		log.Info().Str("path", internalCACert).Msg("Internal CA")
+	}
+
 	return &workflow.Paths{
-		ComponentsPath: components,
-		BinaryPath:     binary,
-		TempPath:       temp,
+		ComponentsPath:          components,
+		BinaryPath:              binary,
+		TempPath:                temp,
+		ComponentsPublicKeyPath: publicKey,
+		RegistriesPath:          registries,
+		SecretStorePath:         secretStore,
+		NamespaceGovernancePath: governance,
+		CRDsPath:                crds,
+		StorageClassesPath:      storageClasses,
+		InternalCACertPath:      internalCACert,
+		InternalCAKeyPath:       internalCAKey,
 	}, nil
 }
 
 func ValidateInstallParameters() derrors.Error {
 
+	// The hosts are checked here instead of marking the flags as required so they can be set by the
+	// configuration file or the install wizard.
+	if managementPublicHost == "" {
+		return derrors.NewInvalidArgumentError("managementClusterPublicHost must be set")
+	}
+	if dnsClusterHost == "" {
+		return derrors.NewInvalidArgumentError("dnsClusterPublicHost must be set")
+	}
+
 	netMode, found := entities.NetworkingModeFromString[networkingMode]
 	if !found {
 		return derrors.NewInvalidArgumentError("networking mode not valid, only zt or istio are valid")
@@ -180,6 +399,13 @@ func ValidateInstallParameters() derrors.Error {
 		return derrors.NewInvalidArgumentError("the Istio path must be set if Istio networking mode is selected")
 	}
 
+	if err := k8s.ValidateCertificateIssuer(certificateIssuer); err != nil {
+		return err
+	}
+	if err := k8s.ValidateInternalCAPaths(certificateIssuer, internalCACertPath, internalCAKeyPath); err != nil {
+		return err
+	}
+
 
 	if installKubernetes {
 		if username == "" || clusterCertIssuerCACertPath == "" {
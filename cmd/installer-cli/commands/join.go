@@ -0,0 +1,122 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"fmt"
+	"github.com/nalej/installer/internal/app/installer-cli"
+	"github.com/nalej/installer/internal/pkg/utils"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// JoinTokenEnvVar is the environment variable read if the join token is not passed as a flag.
+const JoinTokenEnvVar = "NALEJ_JOIN_TOKEN"
+
+var joinOptions installer_cli.JoinOptions
+
+var joinManagementKubeConfigPath string
+
+var joinLongHelp = `
+Install the application cluster where the installer is running
+
+The installer retrieves the install plan from the installer of the management cluster
+exchanging a one-time join token, and uses the service account of its pod to install
+the cluster. The kubeconfig of the application cluster is never sent to the management
+cluster.
+`
+
+var joinExample = `
+
+# Install the application cluster using a join token
+installer-cli install join --managementAddress=installer.nalej.example.com:5500 --joinToken=<token>
+
+# Read the join token from the environment
+NALEJ_JOIN_TOKEN=<token> installer-cli install join --managementAddress=installer.nalej.example.com:5500
+`
+
+var joinCmd = &cobra.Command{
+	Use:     "join",
+	Short:   "Install an application cluster from inside the cluster using a join token",
+	Long:    joinLongHelp,
+	Example: joinExample,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		LaunchJoin()
+	},
+}
+
+func init() {
+	joinCmd.Flags().StringVar(&joinOptions.ManagementAddress, "managementAddress", "",
+		"Address (host:port) of the installer service of the management cluster")
+	joinCmd.Flags().StringVar(&joinOptions.Token, "joinToken", "",
+		fmt.Sprintf("One-time join token, read from %s if not set", JoinTokenEnvVar))
+	joinCmd.Flags().BoolVar(&joinOptions.UseTLS, "joinTLS", true,
+		"Use transport security to contact the installer of the management cluster")
+	joinCmd.Flags().StringVar(&joinOptions.CACertPath, "joinCACertPath", "",
+		"CA certificate used to validate the installer of the management cluster, system roots are used if not set")
+	joinCmd.Flags().StringVar(&joinManagementKubeConfigPath, "managementKubeConfigPath", "",
+		"Kubeconfig of the management cluster where the Istio gateway is looked up if the install plan does not contain its IP")
+	cliCmd.AddCommand(joinCmd)
+}
+
+// LaunchJoin retrieves the install plan from the management cluster and installs the application cluster.
+func LaunchJoin() {
+	log.Info().Msg("Installing application cluster using a join token")
+	if joinOptions.Token == "" {
+		joinOptions.Token = os.Getenv(JoinTokenEnvVar)
+	}
+	if joinOptions.CACertPath != "" {
+		joinOptions.CACertPath = utils.GetPath(joinOptions.CACertPath)
+	}
+	paths, err := GetPaths()
+	if err != nil {
+		log.Panic().Str("error", err.DebugReport()).Msg("cannot obtain paths")
+	}
+	if joinManagementKubeConfigPath != "" {
+		paths.ManagementKubeConfigPath = utils.GetPath(joinManagementKubeConfigPath)
+	}
+	plan, err := installer_cli.FetchInstallPlan(joinOptions)
+	if err != nil {
+		log.Panic().Str("error", err.DebugReport()).Msg("cannot retrieve install plan")
+	}
+	if istioGatewayIP != "" {
+		plan.IstioGatewayIP = istioGatewayIP
+	}
+	log.Info().Str("requestID", plan.RequestID).Str("template", plan.TemplateName).Str("version", plan.TemplateVersion).Msg("install plan received")
+
+	inst, err := installer_cli.NewJoinCLI(plan, *paths)
+	if err != nil {
+		log.Panic().Str("error", err.DebugReport()).Msg("cannot create CLI installer")
+	}
+	err = inst.SetOutput(outputFormat)
+	if err != nil {
+		log.Panic().Str("error", err.DebugReport()).Msg("invalid output format")
+	}
+
+	if explainPlan {
+		inst.LoadCredentials()
+		fmt.Println(inst.Workflow.PrettyPrint())
+	} else if renderOnly != "" {
+		inst.Render(utils.GetPath(renderOnly))
+	} else {
+		inst.Execute()
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"fmt"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var lintParamsPath string
+
+var lintWorkflowLongHelp = `
+Validate a workflow definition
+
+The workflow template is rendered with the given parameters and validated against
+the schema of the supported commands. Unknown commands, unknown fields, type
+mismatches and missing required fields are reported with the line where they
+are found. The command exits with a non zero code if any issue is found.
+`
+
+var lintWorkflowExample = `
+
+# Validate a workflow rendered with empty parameters
+installer-cli lint-workflow workflows/install.json
+
+# Validate a workflow rendered with the parameters of an installation
+installer-cli lint-workflow workflows/install.json --params params.json
+`
+
+var lintWorkflowCmd = &cobra.Command{
+	Use:     "lint-workflow <workflowPath>",
+	Short:   "Validate a workflow definition",
+	Long:    lintWorkflowLongHelp,
+	Example: lintWorkflowExample,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		LintWorkflow(args[0], lintParamsPath)
+	},
+}
+
+func init() {
+	lintWorkflowCmd.Flags().StringVar(&lintParamsPath, "params", "",
+		"Path of a JSON file with the parameters used to render the workflow template")
+	rootCmd.AddCommand(lintWorkflowCmd)
+}
+
+// LintWorkflow validates a workflow definition printing the issues found.
+func LintWorkflow(workflowPath string, paramsPath string) {
+	content, err := ioutil.ReadFile(workflowPath)
+	if err != nil {
+		log.Fatal().Err(err).Str("path", workflowPath).Msg("cannot read workflow")
+	}
+	params := &workflow.Parameters{
+		InstallRequest:   &grpc_installer_go.InstallRequest{},
+		UninstallRequest: &grpc_installer_go.UninstallClusterRequest{},
+	}
+	if paramsPath != "" {
+		loaded, lErr := workflow.NewParametersFromFile(paramsPath)
+		if lErr != nil {
+			log.Fatal().Str("error", lErr.DebugReport()).Msg("cannot load parameters")
+		}
+		params = loaded
+	}
+	issues, lErr := workflow.NewParser().LintWorkflow(string(content), filepath.Base(workflowPath), *params)
+	if lErr != nil {
+		log.Fatal().Str("error", lErr.DebugReport()).Msg("cannot render workflow")
+	}
+	if len(issues) == 0 {
+		fmt.Println("workflow is valid")
+		return
+	}
+	for _, issue := range issues {
+		fmt.Printf("%s: %s\n", workflowPath, issue.String())
+	}
+	os.Exit(1)
+}
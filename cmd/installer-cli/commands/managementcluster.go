@@ -20,6 +20,7 @@ package commands
 import (
 	"fmt"
 	"github.com/nalej/installer/internal/app/installer-cli"
+	"github.com/nalej/installer/internal/pkg/utils"
 	"strconv"
 	"strings"
 
@@ -27,10 +28,24 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var managementExample = `
+
+# Install a management cluster
+installer-cli install management --kubeConfigPath=nalej/mngtCluster.yaml \
+  --managementClusterPublicHost=nalej.example.com --dnsClusterPublicHost=dns.nalej.example.com
+
+# Show the install plan using the values of a configuration file
+installer-cli install management --config nalej/installer-cli.yaml --explainPlan
+
+# Write the manifests that would be applied for review
+installer-cli install management --config nalej/installer-cli.yaml --renderOnly ./rendered
+`
+
 var managementClusterCmd = &cobra.Command{
-	Use:   "management",
-	Short: "Install the Nalej management cluster",
-	Long:  `Install the Nalej management cluster`,
+	Use:     "management",
+	Short:   "Install the Nalej management cluster",
+	Long:    `Install the Nalej management cluster`,
+	Example: managementExample,
 	Run: func(cmd *cobra.Command, args []string) {
 		SetupLogging()
 		LaunchManagementInstall()
@@ -62,6 +77,14 @@ func LaunchManagementInstall() {
 	if err != nil {
 		log.Panic().Str("error", err.DebugReport()).Msg("cannot create CLI installer")
 	}
+	err = inst.SelectTemplate(utils.GetPath(confPath), templateName, templateVersion)
+	if err != nil {
+		log.Panic().Str("error", err.DebugReport()).Msg("cannot select workflow template")
+	}
+	err = inst.SetOutput(outputFormat)
+	if err != nil {
+		log.Panic().Str("error", err.DebugReport()).Msg("invalid output format")
+	}
 
 	// Prepare the parameters.
 	inst.PrepareInstallCommand(
@@ -84,10 +107,35 @@ func LaunchManagementInstall() {
 		environment,
 		networkingMode,
 		istioPath)
+	inst.Params.NetworkConfig.IstioctlImage = istioctlImage
+	inst.Params.NetworkConfig.IstioRevision = istioRevision
+	inst.Params.NetworkConfig.IstioTrustDomain = istioTrustDomain
+	inst.Params.NetworkConfig.IstioNamespace = istioNamespace
+	inst.Params.NetworkConfig.IstioIngressGateway = istioIngressGateway
+	inst.Params.NetworkConfig.IstioCASecret = istioCASecret
+	inst.Params.NetworkConfig.IngressController = ingressController
+	inst.Params.NetworkConfig.ClusterDomain = clusterDomain
+	inst.Params.CertificateIssuer = certificateIssuer
+	inst.Params.HardenNetwork = hardenNetwork
+	inst.Params.WithObservability = withObservability
+	inst.Params.LoggingStack = loggingStack
+	inst.Params.LogRetention = logRetention
+	inst.Params.LogStorageSize = logStorageSize
+	inst.Params.StorageProvisioner = storageProvisioner
+	inst.Params.NFSShare = nfsShare
+	inst.Params.Prune = pruneComponents
+	inst.Params.AdoptExisting = adoptExisting
+	inst.Params.MigrateVolumes = migrateVolumes
+	inst.Params.FeatureFlags = featureFlags
+	inst.Params.AuthSecretLength = authSecretLength
+	inst.Params.AuthSecretEncoding = authSecretEncoding
+	inst.Params.AllowUnsupportedVersions = allowUnsupportedVersions
 
 	if explainPlan {
 		inst.LoadCredentials()
 		fmt.Println(inst.Workflow.PrettyPrint())
+	} else if renderOnly != "" {
+		inst.Render(utils.GetPath(renderOnly))
 	} else {
 		inst.Execute()
 	}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"os"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/app/installer-cli"
+	"github.com/nalej/installer/internal/pkg/utils"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var purgeNamespaces []string
+var purgeSelector string
+var purgeDryRun bool
+var purgeRemoveFinalizers bool
+
+var purgeLongHelp = `
+Remove every object of a set of namespaces or matching a label selector
+
+With --namespace, every object of the namespaces is removed, including the instances of
+custom resources, and then the namespaces. With --selector, the objects matching the
+selector are removed from every namespace, or only from the given ones, along with the
+cluster scoped objects, the custom resource definitions and the namespaces matching it.
+The custom resources are removed before their definitions. Objects that remain after being
+deleted because their controller is gone are released with --removeFinalizers. The system
+namespaces are never purged.
+`
+
+var purgeExample = `
+
+# List the objects that would be removed from the nalej namespace
+installer-cli purge nalej/mngtCluster.yaml --namespace nalej --dryRun
+
+# Remove every object created by the installer, releasing the stuck custom resources
+installer-cli purge nalej/mngtCluster.yaml --selector app.kubernetes.io/managed-by=nalej-installer --removeFinalizers
+`
+
+var purgeCmd = &cobra.Command{
+	Use:     "purge <kubeConfigPath>",
+	Short:   "Remove every object of a set of namespaces or matching a label selector",
+	Long:    purgeLongHelp,
+	Example: purgeExample,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		LaunchPurge(args[0])
+	},
+}
+
+func init() {
+	purgeCmd.Flags().StringSliceVar(&purgeNamespaces, "namespace", nil,
+		"Namespace to be purged, can be repeated")
+	purgeCmd.Flags().StringVar(&purgeSelector, "selector", "",
+		"Label selector of the objects to be purged, such as app.kubernetes.io/managed-by=nalej-installer")
+	purgeCmd.Flags().BoolVar(&purgeDryRun, "dryRun", false,
+		"List the objects that would be removed without removing them")
+	purgeCmd.Flags().BoolVar(&purgeRemoveFinalizers, "removeFinalizers", false,
+		"Remove the finalizers of the objects that remain after being deleted")
+	addOutputOptions(purgeCmd)
+	rootCmd.AddCommand(purgeCmd)
+}
+
+// LaunchPurge removes the objects of the namespaces or matching the selector of a given cluster.
+func LaunchPurge(kubeConfig string) {
+	if len(purgeNamespaces) == 0 && purgeSelector == "" {
+		log.Fatal().Msg("namespace or selector must be set")
+	}
+	format, err := installer_cli.OutputFormatFromString(outputFormat)
+	if err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("invalid output format")
+	}
+	var report *k8s.PurgeReport
+	var pErr derrors.Error
+	if purgeSelector != "" {
+		purge := k8s.NewPurgeByLabel(utils.GetPath(kubeConfig), purgeSelector)
+		purge.Namespaces = purgeNamespaces
+		purge.DryRun = purgeDryRun
+		purge.RemoveFinalizers = purgeRemoveFinalizers
+		report, pErr = purge.Report()
+	} else {
+		purge := k8s.NewPurgeNamespace(utils.GetPath(kubeConfig), purgeNamespaces...)
+		purge.DryRun = purgeDryRun
+		purge.RemoveFinalizers = purgeRemoveFinalizers
+		report, pErr = purge.Report()
+	}
+	if report != nil {
+		if err := installer_cli.WritePurge(os.Stdout, format, report); err != nil {
+			log.Fatal().Str("trace", err.DebugReport()).Msg("cannot print purge report")
+		}
+	}
+	if pErr != nil {
+		log.Fatal().Str("trace", pErr.DebugReport()).Msg("cannot purge")
+	}
+}
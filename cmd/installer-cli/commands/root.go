@@ -18,8 +18,13 @@
 package commands
 
 import (
+	"github.com/nalej/installer/internal/app/installer-cli"
+	"github.com/nalej/installer/internal/pkg/cryptopolicy"
+	"github.com/nalej/installer/internal/pkg/logging"
+	"github.com/nalej/installer/internal/pkg/utils"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/plugin"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
 	"github.com/nalej/installer/version"
-	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
@@ -29,6 +34,18 @@ import (
 
 var debugLevel bool
 var consoleLogging bool
+var logConfig logging.Config
+var configFile string
+var kubeQPS float32
+var kubeBurst int
+var pluginsPath string
+var restrictedCrypto bool
+
+// DefaultConfigFile is the configuration file used if none is specified.
+const DefaultConfigFile = "~/.nalej/installer-cli.yaml"
+
+// effectiveConfig contains the layered configuration applied to the command being executed.
+var effectiveConfig *installer_cli.LayeredConfig
 
 var rootCmd = &cobra.Command{
 	Use:     "installer-cli",
@@ -42,8 +59,51 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
+	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().BoolVar(&debugLevel, "debug", false, "Set debug level")
 	rootCmd.PersistentFlags().BoolVar(&consoleLogging, "consoleLogging", false, "Pretty print logging")
+	rootCmd.PersistentFlags().StringVar(&logConfig.Level, "logLevel", "info", "Log level: trace, debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logConfig.Format, "logFormat", logging.JSONFormat, "Log format: json or console")
+	rootCmd.PersistentFlags().BoolVar(&logConfig.Redact, "redactSecrets", true, "Remove passwords, private keys and kubeconfig contents from the logs")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", DefaultConfigFile,
+		"YAML file with flag values, overridden by "+installer_cli.EnvPrefix+"* environment variables and command line flags")
+	rootCmd.PersistentFlags().Float32Var(&kubeQPS, "kubeQPS", k8s.DefaultQPS,
+		"Queries per second sent to the Kubernetes API by each client")
+	rootCmd.PersistentFlags().IntVar(&kubeBurst, "kubeBurst", k8s.DefaultBurst,
+		"Queries sent at once to the Kubernetes API by each client")
+	rootCmd.PersistentFlags().StringVar(&pluginsPath, "pluginsPath", "",
+		"Directory with executables registered as additional workflow commands")
+	rootCmd.PersistentFlags().BoolVar(&restrictedCrypto, "restrictedCrypto", false,
+		"Only allow RSA keys of at least 3072 bits, ECDSA P-256 or P-384 keys and TLS 1.2 AES-GCM cipher suites")
+}
+
+// initConfig applies the configuration file and the environment variables to the flags of the command being
+// executed that have not been set in the command line.
+func initConfig() {
+	cmd, _, err := rootCmd.Find(os.Args[1:])
+	if err != nil || cmd == nil {
+		cmd = rootCmd
+	}
+	required := cmd.Flags().Changed("config")
+	if value, found := os.LookupEnv(installer_cli.EnvName("config")); found && !required {
+		configFile = value
+		required = true
+	}
+	config, lErr := installer_cli.NewLayeredConfig(utils.GetPath(configFile), required)
+	if lErr != nil {
+		log.Fatal().Str("trace", lErr.DebugReport()).Msg("cannot load configuration")
+	}
+	if aErr := config.Apply(cmd.Flags()); aErr != nil {
+		log.Fatal().Str("trace", aErr.DebugReport()).Msg("cannot apply configuration")
+	}
+	effectiveConfig = config
+	k8s.SetClientDefaults(kubeQPS, kubeBurst)
+	cryptopolicy.SetRestricted(restrictedCrypto)
+	if pluginsPath != "" {
+		if _, pErr := plugin.Load(utils.GetPath(pluginsPath)); pErr != nil {
+			log.Fatal().Str("trace", pErr.DebugReport()).Msg("cannot load command plugins")
+		}
+	}
 }
 
 func Execute() {
@@ -54,14 +114,18 @@ func Execute() {
 	}
 }
 
-// SetupLogging sets the debug level and console logging if required.
+// SetupLogging sets the log level, format and redaction. The debug and consoleLogging flags take precedence over
+// the logLevel and logFormat ones.
 func SetupLogging() {
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	config := logConfig
 	if debugLevel {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		config.Level = "debug"
 	}
-
 	if consoleLogging {
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+		config.Format = logging.ConsoleFormat
+	}
+	if err := logging.Setup(config); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"fmt"
+
+	installer_cli "github.com/nalej/installer/internal/app/installer-cli"
+	"github.com/nalej/installer/internal/pkg/utils"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var rotateAuthSecret string
+var rotateIngressCertificate string
+var managementKubeConfigPath string
+var forceRotate bool
+
+var rotateSecretsLongHelp = `
+Rotate the secrets of a Nalej cluster
+
+This command replaces the authx secret of the management cluster with the given value, or
+a random one if not set, and the registry credentials with the values of the registries file.
+An existing authx secret is only replaced with --forceRotate.
+On application clusters, the wildcard certificate of the management cluster is copied again
+when the secret holding it is set, so renewed certificates reach the ingresses.
+The deployments reading the rotated secrets are restarted one at a time waiting for them to
+become ready again.
+`
+
+var rotateSecretsExample = `
+
+# Rotate the authx secret of a management cluster
+installer-cli rotate-secrets nalej/mngtCluster.yaml --forceRotate
+
+# Rotate the registry credentials of an application cluster
+installer-cli rotate-secrets nalej/appCluster.yaml --appCluster --registriesPath registries.yaml
+
+# Copy the renewed wildcard certificate of the management cluster to an application cluster
+installer-cli rotate-secrets nalej/appCluster.yaml --appCluster --ingressCertificate istio-system/ingress-cert --managementKubeConfigPath nalej/mngtCluster.yaml
+
+# Show the rotation plan
+installer-cli rotate-secrets nalej/mngtCluster.yaml --explainPlan
+`
+
+var rotateSecretsCmd = &cobra.Command{
+	Use:     "rotate-secrets <kubeConfigPath>",
+	Short:   "Rotate the secrets of a Nalej cluster",
+	Long:    rotateSecretsLongHelp,
+	Example: rotateSecretsExample,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		LaunchRotateSecrets(args[0])
+	},
+}
+
+func init() {
+	rotateSecretsCmd.Flags().BoolVar(&explainPlan, "explainPlan", false,
+		"Show the rotation plan instead of rotating the secrets")
+	rotateSecretsCmd.Flags().BoolVar(&appCluster, "appCluster", false,
+		"Set to true if the target cluster is an application cluster.")
+	rotateSecretsCmd.Flags().StringVar(&rotateAuthSecret, "authSecret", "",
+		"New authorization secret, a random one is generated if not set")
+	rotateSecretsCmd.Flags().IntVar(&authSecretLength, "authSecretLength", 0,
+		"Number of random bytes of the generated authorization secret, 32 if not set")
+	rotateSecretsCmd.Flags().StringVar(&authSecretEncoding, "authSecretEncoding", "",
+		"Encoding of the generated authorization secret [base64, hex], base64 if not set")
+	rotateSecretsCmd.Flags().BoolVar(&forceRotate, "forceRotate", false,
+		"Replace the existing authorization secret")
+	rotateSecretsCmd.Flags().StringVar(&registriesPath, "registriesPath", "",
+		"File with the new credentials of the registries")
+	rotateSecretsCmd.Flags().StringVar(&secretStorePath, "secretStorePath", "",
+		"File with the external secret store backing the secrets, whose values are rotated in the store")
+	rotateSecretsCmd.Flags().StringVar(&rotateIngressCertificate, "ingressCertificate", "",
+		"Secret (namespace/name) of the management cluster with the wildcard certificate copied to application clusters")
+	rotateSecretsCmd.Flags().StringVar(&managementKubeConfigPath, "managementKubeConfigPath", "",
+		"KubeConfig of the management cluster holding the ingress certificate")
+	addOutputOptions(rotateSecretsCmd)
+	rootCmd.AddCommand(rotateSecretsCmd)
+}
+
+// LaunchRotateSecrets triggers the rotation of the secrets of a given cluster.
+func LaunchRotateSecrets(kubeConfig string) {
+	inst, err := installer_cli.NewCLI(kubeConfig)
+	if err != nil {
+		log.Panic().Str("error", err.DebugReport()).Msg("cannot create CLI installer")
+	}
+	err = inst.SetOutput(outputFormat)
+	if err != nil {
+		log.Panic().Str("error", err.DebugReport()).Msg("invalid output format")
+	}
+	paths := workflow.Paths{}
+	if registriesPath != "" {
+		paths.RegistriesPath = utils.GetPath(registriesPath)
+		if !CheckExists(paths.RegistriesPath) {
+			log.Fatal().Str("path", paths.RegistriesPath).Msg("registries file does not exist")
+		}
+	}
+	if secretStorePath != "" {
+		paths.SecretStorePath = utils.GetPath(secretStorePath)
+		if !CheckExists(paths.SecretStorePath) {
+			log.Fatal().Str("path", paths.SecretStorePath).Msg("secret store file does not exist")
+		}
+	}
+	if rotateIngressCertificate != "" {
+		if managementKubeConfigPath == "" {
+			log.Fatal().Msg("managementKubeConfigPath must be set to copy the ingress certificate")
+		}
+		paths.ManagementKubeConfigPath = utils.GetPath(managementKubeConfigPath)
+		if !CheckExists(paths.ManagementKubeConfigPath) {
+			log.Fatal().Str("path", paths.ManagementKubeConfigPath).Msg("management kubeconfig file does not exist")
+		}
+	}
+	inst.PrepareRotateSecretsCommand("cli-rotate-secrets", paths, rotateAuthSecret, appCluster)
+	inst.Params.IngressCertificate = rotateIngressCertificate
+	inst.Params.AuthSecretLength = authSecretLength
+	inst.Params.AuthSecretEncoding = authSecretEncoding
+	inst.Params.ForceRotate = forceRotate
+
+	if explainPlan {
+		inst.LoadCredentials()
+		fmt.Println(inst.Workflow.PrettyPrint())
+	} else {
+		inst.Execute()
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"github.com/nalej/installer/internal/app/installer-cli"
+	"github.com/nalej/installer/internal/pkg/utils"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var signComponentsPath string
+var signPrivateKeyPath string
+var signPublicKeyPath string
+var signGenerateKeys bool
+
+var signComponentsLongHelp = `
+Sign the components of a release bundle
+
+Each directory with components under --componentsPath receives a components.sha256
+file with the SHA-256 of its files and a components.sha256.sig file with the Ed25519
+signature of the former. Installs launched with --componentsPublicKey refuse to
+apply components whose digest does not match the signed index.
+`
+
+var signComponentsExample = `
+
+# Generate the signing keys
+installer-cli sign-components --generateKeys --privateKey signing.key --publicKey signing.pub
+
+# Sign the bundle
+installer-cli sign-components --componentsPath ./assets/ --privateKey signing.key
+`
+
+var signComponentsCmd = &cobra.Command{
+	Use:     "sign-components",
+	Short:   "Sign the components of a release bundle",
+	Long:    signComponentsLongHelp,
+	Example: signComponentsExample,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		SignComponents()
+	},
+}
+
+func init() {
+	signComponentsCmd.Flags().StringVar(&signComponentsPath, "componentsPath", "./assets/",
+		"Directory with the components to be signed")
+	signComponentsCmd.Flags().StringVar(&signPrivateKeyPath, "privateKey", "",
+		"Private key used to sign the components")
+	signComponentsCmd.Flags().StringVar(&signPublicKeyPath, "publicKey", "",
+		"Path where the public key is written when generating the keys")
+	signComponentsCmd.Flags().BoolVar(&signGenerateKeys, "generateKeys", false,
+		"Generate a new key pair instead of signing the components")
+	rootCmd.AddCommand(signComponentsCmd)
+}
+
+// SignComponents signs the components or generates the signing keys.
+func SignComponents() {
+	if signPrivateKeyPath == "" {
+		log.Fatal().Msg("privateKey must be set")
+	}
+	if signGenerateKeys {
+		if signPublicKeyPath == "" {
+			log.Fatal().Msg("publicKey must be set to generate the keys")
+		}
+		if err := k8s.GenerateSigningKeys(utils.GetPath(signPublicKeyPath), utils.GetPath(signPrivateKeyPath)); err != nil {
+			log.Fatal().Str("error", err.DebugReport()).Msg("cannot generate signing keys")
+		}
+		log.Info().Str("publicKey", signPublicKeyPath).Msg("signing keys generated")
+		return
+	}
+	if _, err := installer_cli.SignComponents(utils.GetPath(signComponentsPath), utils.GetPath(signPrivateKeyPath)); err != nil {
+		log.Fatal().Str("error", err.DebugReport()).Msg("cannot sign components")
+	}
+}
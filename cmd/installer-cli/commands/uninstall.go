@@ -44,6 +44,9 @@ installer-cli uninstall nalej/mngtCluster.yaml
 # Uninstall an application cluster
 installer-cli uninstall nalej/appCluster.yaml --appCluster
 
+# Uninstall a management cluster reporting the result as JSON
+installer-cli uninstall nalej/mngtCluster.yaml --output json
+
 # Show the uninstall plan
 installer-cli uninstall nalej/mngtCluster.yaml --explainPlan
 `
@@ -65,6 +68,7 @@ func init() {
 		"Show install plan instead of performing the uninstall")
 	uninstallClusterCmd.Flags().BoolVar(&appCluster, "appCluster", false,
 		"Set to true if the target cluster is an application cluster.")
+	addOutputOptions(uninstallClusterCmd)
 	rootCmd.AddCommand(uninstallClusterCmd)
 }
 
@@ -74,6 +78,10 @@ func LaunchUninstall(kubeConfig string) {
 	if err != nil {
 		log.Panic().Str("error", err.DebugReport()).Msg("cannot create CLI installer")
 	}
+	err = inst.SetOutput(outputFormat)
+	if err != nil {
+		log.Panic().Str("error", err.DebugReport()).Msg("invalid output format")
+	}
 	inst.PrepareUninstallCommand(
 		"cli-uninstall",
 		"nalej",
@@ -0,0 +1,262 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/app/installer-cli"
+	"github.com/nalej/installer/internal/pkg/utils"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var wizardLongHelp = `
+Install the management cluster interactively
+
+The wizard prompts for the values required by the install, validating them as they
+are entered, and writes them to a configuration file that can be reused by later
+executions of the CLI with the --config flag. The credentials of the private
+registries are checked against each registry and written to a registries file next
+to the configuration file. Once the files are written, the install of the management
+cluster can be launched.
+`
+
+var wizardExample = `
+
+# Prompt for the install values and store them in the default configuration file
+installer-cli install wizard
+
+# Use the values of an existing configuration file as defaults
+installer-cli install wizard --config nalej/installer-cli.yaml
+`
+
+var wizardCmd = &cobra.Command{
+	Use:     "wizard",
+	Short:   "Install the Nalej management cluster interactively",
+	Long:    wizardLongHelp,
+	Example: wizardExample,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupLogging()
+		LaunchWizard(cmd)
+	},
+}
+
+func init() {
+	cliCmd.AddCommand(wizardCmd)
+}
+
+// RegistriesFileName is the name of the registries file written by the wizard next to the configuration file.
+const RegistriesFileName = "registries.yaml"
+
+// wizardAnswers structure with the values entered by the user in order.
+type wizardAnswers struct {
+	names  []string
+	values map[string]string
+	// registries with the private registries entered by the user, nil if none.
+	registries *k8s.RegistriesConfig
+}
+
+// set stores the value of a flag.
+func (wa *wizardAnswers) set(name string, value string) {
+	if _, exists := wa.values[name]; !exists {
+		wa.names = append(wa.names, name)
+	}
+	wa.values[name] = value
+}
+
+// LaunchWizard prompts for the install values, writes the configuration file and launches the install.
+func LaunchWizard(cmd *cobra.Command) {
+	prompter := installer_cli.NewPrompter(os.Stdin, os.Stdout)
+	answers, err := askInstallValues(prompter)
+	if err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("cannot complete the install wizard")
+	}
+
+	path, err := prompter.Ask("Configuration file to write", configFile, installer_cli.ValidNotEmpty)
+	if err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("cannot complete the install wizard")
+	}
+	if answers.registries != nil {
+		registries := filepath.Join(filepath.Dir(path), RegistriesFileName)
+		err = installer_cli.WriteRegistriesFile(utils.GetPath(registries), answers.registries)
+		if err != nil {
+			log.Fatal().Str("trace", err.DebugReport()).Msg("cannot write registries file")
+		}
+		fmt.Printf("Registries written to %s\n", registries)
+		answers.set("registriesPath", registries)
+	}
+	err = installer_cli.WriteConfigFile(utils.GetPath(path), answers.values)
+	if err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("cannot write configuration file")
+	}
+	fmt.Printf("Configuration written to %s, use --config %s to reuse it\n", path, path)
+
+	launch, err := prompter.Confirm("Launch the install now?", true)
+	if err != nil {
+		log.Fatal().Str("trace", err.DebugReport()).Msg("cannot complete the install wizard")
+	}
+	if !launch {
+		return
+	}
+	for _, name := range answers.names {
+		if sErr := cmd.Flags().Set(name, answers.values[name]); sErr != nil {
+			log.Fatal().Err(sErr).Str("flag", name).Msg("cannot apply wizard value")
+		}
+	}
+	LaunchManagementInstall()
+}
+
+// askInstallValues prompts for the values required to install a management cluster.
+func askInstallValues(prompter *installer_cli.Prompter) (*wizardAnswers, derrors.Error) {
+	answers := &wizardAnswers{names: make([]string, 0), values: make(map[string]string, 0)}
+
+	platform, err := prompter.Choose("Target platform", []string{"MINIKUBE", "AZURE", "BAREMETAL", "OPENSHIFT"}, targetPlatform)
+	if err != nil {
+		return nil, err
+	}
+	answers.set("targetPlatform", platform)
+	env, err := prompter.Choose("Target environment", []string{"PRODUCTION", "STAGING", "DEVELOPMENT"},
+		environment.TargetEnvironment)
+	if err != nil {
+		return nil, err
+	}
+	answers.set("targetEnvironment", env)
+
+	mngtHost, err := prompter.Ask("Public host of the management cluster", managementPublicHost, installer_cli.ValidHost)
+	if err != nil {
+		return nil, err
+	}
+	answers.set("managementClusterPublicHost", mngtHost)
+	defaultDNSHost := dnsClusterHost
+	if defaultDNSHost == "" {
+		defaultDNSHost = "dns." + mngtHost
+	}
+	dnsHost, err := prompter.Ask("Public host of the DNS service", defaultDNSHost, installer_cli.ValidHost)
+	if err != nil {
+		return nil, err
+	}
+	answers.set("dnsClusterPublicHost", dnsHost)
+	dnsPort, err := prompter.Ask("Public port of the DNS service", strconv.Itoa(dnsClusterPort), func(value string) derrors.Error {
+		if port, err := strconv.Atoi(value); err != nil || port <= 0 || port > 65535 {
+			return derrors.NewInvalidArgumentError("expecting a port number")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	answers.set("dnsClusterPublicPort", dnsPort)
+
+	installK8s, err := prompter.Confirm("Install Kubernetes on the nodes?", installKubernetes)
+	if err != nil {
+		return nil, err
+	}
+	answers.set("installK8s", strconv.FormatBool(installK8s))
+	if installK8s {
+		questions := []struct {
+			flag         string
+			question     string
+			defaultValue string
+			validator    installer_cli.Validator
+		}{
+			{"nodes", "IP addresses of the nodes separated by comma", nodes, installer_cli.ValidIPList},
+			{"username", "Username to connect to the nodes", username, installer_cli.ValidNotEmpty},
+			{"privateKeyPath", "Private key to connect to the nodes", privateKeyPath, installer_cli.ValidPath},
+			{"clusterCertIssuerCACertPath", "CA certificate of the cluster certificate issuer", clusterCertIssuerCACertPath, installer_cli.ValidPath},
+		}
+		for _, q := range questions {
+			value, err := prompter.Ask(q.question, q.defaultValue, q.validator)
+			if err != nil {
+				return nil, err
+			}
+			answers.set(q.flag, value)
+		}
+	} else {
+		kubeConfig, err := prompter.Ask("Kubeconfig of the target cluster", kubeConfigPath, installer_cli.ValidKubeConfig)
+		if err != nil {
+			return nil, err
+		}
+		answers.set("kubeConfigPath", kubeConfig)
+	}
+
+	mode, err := prompter.Choose("Networking mode", []string{"zt", "istio"}, networkingMode)
+	if err != nil {
+		return nil, err
+	}
+	answers.set("networkingMode", mode)
+	if mode == "istio" {
+		path, err := prompter.Ask("Path of the istioctl binary directory", istioPath, installer_cli.ValidPath)
+		if err != nil {
+			return nil, err
+		}
+		answers.set("istioPath", path)
+	}
+
+	staticIPs, err := prompter.Confirm("Use static IP addresses for the public services?", useStaticIPAddresses)
+	if err != nil {
+		return nil, err
+	}
+	answers.set("useStaticIPAddresses", strconv.FormatBool(staticIPs))
+	if staticIPs {
+		questions := []struct {
+			flag         string
+			question     string
+			defaultValue string
+		}{
+			{"ipAddressIngress", "IP address of the ingress service", ipAddressIngress},
+			{"ipAddressDNS", "IP address of the DNS service", ipAddressDNS},
+			{"ipAddressCoreDNS", "IP address of the external CoreDNS service", ipAddressCoreDNS},
+			{"ipAddressVPNServer", "IP address of the VPN server service", ipAddressVPNServer},
+		}
+		for _, q := range questions {
+			value, err := prompter.Ask(q.question, q.defaultValue, installer_cli.ValidIP)
+			if err != nil {
+				return nil, err
+			}
+			answers.set(q.flag, value)
+		}
+	}
+
+	components, err := prompter.Ask("Directory, https URL or oci:// reference with the components", componentsPath, installer_cli.ValidComponentsPath)
+	if err != nil {
+		return nil, err
+	}
+	answers.set("componentsPath", components)
+	binaries, err := prompter.Ask("Directory with the binaries", binaryPath, installer_cli.ValidPath)
+	if err != nil {
+		return nil, err
+	}
+	answers.set("binaryPath", binaries)
+
+	registries, err := prompter.AskRegistries(installer_cli.ValidRegistryLogin)
+	if err != nil {
+		return nil, err
+	}
+	if registries != nil {
+		answers.registries = registries
+	} else if registriesPath != "" {
+		answers.set("registriesPath", registriesPath)
+	}
+	return answers, nil
+}
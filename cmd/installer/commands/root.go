@@ -18,9 +18,8 @@
 package commands
 
 import (
+	"github.com/nalej/installer/internal/pkg/logging"
 	"github.com/nalej/installer/version"
-	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
 	"fmt"
@@ -29,6 +28,7 @@ import (
 
 var debugLevel bool
 var consoleLogging bool
+var logConfig logging.Config
 
 var rootCmd = &cobra.Command{
 	Use:     "installer",
@@ -45,6 +45,9 @@ var rootCmd = &cobra.Command{
 func init() {
 	rootCmd.PersistentFlags().BoolVar(&debugLevel, "debug", false, "Set debug level")
 	rootCmd.PersistentFlags().BoolVar(&consoleLogging, "consoleLogging", false, "Pretty print logging")
+	rootCmd.PersistentFlags().StringVar(&logConfig.Level, "logLevel", "info", "Log level: trace, debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logConfig.Format, "logFormat", logging.JSONFormat, "Log format: json or console")
+	rootCmd.PersistentFlags().BoolVar(&logConfig.Redact, "redactSecrets", true, "Remove passwords, private keys and kubeconfig contents from the logs")
 }
 
 func Execute() {
@@ -55,14 +58,18 @@ func Execute() {
 	}
 }
 
-// SetupLogging sets the debug level and console logging if required.
+// SetupLogging sets the log level, format and redaction. The debug and consoleLogging flags take precedence over
+// the logLevel and logFormat ones.
 func SetupLogging() {
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	config := logConfig
 	if debugLevel {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		config.Level = "debug"
 	}
-
 	if consoleLogging {
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+		config.Format = logging.ConsoleFormat
+	}
+	if err := logging.Setup(config); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
 	}
 }
@@ -23,6 +23,9 @@ import (
 	"github.com/nalej/installer/internal/pkg/entities"
 	"github.com/nalej/installer/internal/pkg/server"
 	cfg "github.com/nalej/installer/internal/pkg/server/config"
+	"github.com/nalej/installer/internal/pkg/server/notifications"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/logstack"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -46,6 +49,49 @@ func addRegistryOptions(cliCmd *cobra.Command) {
 	cliCmd.Flags().StringVar(&config.Environment.TargetEnvironment, "targetEnvironment", "PRODUCTION", "Target environment to be installed: PRODUCTION, STAGING, or DEVELOPMENT")
 }
 
+// Add parameters related to the notifications of the operations.
+func addNotificationOptions(cliCmd *cobra.Command) {
+	cliCmd.PersistentFlags().StringArrayVar(&config.Notifications.Webhooks, "notifyWebhook", nil,
+		"URL receiving the install and uninstall events as JSON, can be repeated")
+	cliCmd.PersistentFlags().StringArrayVar(&config.Notifications.SlackWebhooks, "notifySlackWebhook", nil,
+		"Incoming webhook of a Slack channel receiving the install and uninstall events, can be repeated")
+	cliCmd.PersistentFlags().StringVar(&config.Notifications.SMTPServer, "notifySMTPServer", "",
+		"SMTP server as host:port sending the install and uninstall events by email")
+	cliCmd.PersistentFlags().StringVar(&config.Notifications.SMTPUsername, "notifySMTPUsername", "",
+		"Username of the SMTP server, if required")
+	cliCmd.PersistentFlags().StringVar(&config.Notifications.SMTPPassword, "notifySMTPPassword", "",
+		"Password of the SMTP server, if required")
+	cliCmd.PersistentFlags().StringVar(&config.Notifications.EmailFrom, "notifyEmailFrom", "",
+		"Sender of the notification emails")
+	cliCmd.PersistentFlags().StringSliceVar(&config.Notifications.EmailTo, "notifyEmailTo", nil,
+		"Comma separated recipients of the notification emails")
+	cliCmd.PersistentFlags().StringSliceVar(&config.Notifications.Events, "notifyEvents", nil,
+		"Comma separated events that are notified [started, succeeded, failed], all of them if not set")
+	cliCmd.PersistentFlags().DurationVar(&config.Notifications.Timeout, "notifyTimeout", notifications.DefaultTimeout,
+		"Time to deliver a notification to a destination")
+}
+
+// Add parameters related to transport security and authentication.
+func addSecurityOptions(cliCmd *cobra.Command) {
+	cliCmd.PersistentFlags().BoolVar(&config.TLSEnabled, "tls", false,
+		"Enable TLS on the gRPC server")
+	cliCmd.PersistentFlags().StringVar(&config.TLSCertPath, "tlsCertPath", "",
+		"Path of the server certificate, a self-signed one is generated if not set")
+	cliCmd.PersistentFlags().StringVar(&config.TLSKeyPath, "tlsKeyPath", "",
+		"Path of the server private key")
+	cliCmd.PersistentFlags().StringVar(&config.TLSClientCAPath, "tlsClientCAPath", "",
+		"Path of the CA certificate used to validate clients, enables mutual TLS")
+	cliCmd.PersistentFlags().BoolVar(&config.AuthEnabled, "authEnabled", false,
+		"Require a valid token on incoming requests")
+	cliCmd.PersistentFlags().StringVar(&config.APIKeysPath, "apiKeysPath", "",
+		"Path of the JSON file with the API keys and their roles")
+	cliCmd.PersistentFlags().StringVar(&config.JWTSecret, "jwtSecret", "",
+		"Secret used to validate JWT tokens")
+	cliCmd.PersistentFlags().IntVar(&config.OperationsPerMinute, "operationsPerMinute", 0,
+		"Install/uninstall requests accepted per organization and minute, 0 to disable rate limiting")
+	cliCmd.PersistentFlags().IntVar(&config.OperationsBurst, "operationsBurst", 1,
+		"Install/uninstall requests accepted at once per organization")
+}
 
 func init() {
 
@@ -64,11 +110,75 @@ func init() {
 	runCmd.MarkPersistentFlagRequired("dnsClusterPublicPort")
 
 	runCmd.PersistentFlags().StringVar(&config.ComponentsPath, "componentsPath", "./assets/",
-		"Directory with the components to be installed")
+		"Directory with the components to be installed, an https URL or an oci:// reference of a components bundle")
+	runCmd.PersistentFlags().StringVar(&config.ComponentsUsername, "componentsUsername", "",
+		"Username to download the components bundle, if required")
+	runCmd.PersistentFlags().StringVar(&config.ComponentsPassword, "componentsPassword", "",
+		"Password to download the components bundle, if required")
+	runCmd.PersistentFlags().StringVar(&config.ComponentsPublicKeyPath, "componentsPublicKey", "",
+		"Public key used to verify the signed index of the components")
+	runCmd.PersistentFlags().StringVar(&config.RegistriesPath, "registriesPath", "",
+		"File with the registries used to pull the images of the components and the pull secret of each image prefix")
+	runCmd.PersistentFlags().StringVar(&config.SecretStorePath, "secretStorePath", "",
+		"File with the external secret store whose values back the secrets created by the installer")
+	runCmd.PersistentFlags().StringVar(&config.NamespaceGovernancePath, "namespaceGovernancePath", "",
+		"File with the labels, limits and quotas of the platform namespaces by target environment")
+	runCmd.PersistentFlags().StringVar(&config.CRDsPath, "crdsPath", "",
+		"Directory with the custom resource definitions created and established before launching the components")
+	runCmd.PersistentFlags().StringVar(&config.StorageClassesPath, "storageClassesPath", "",
+		"File with the storage classes of the persistent volumes and claims by platform and by name")
 	runCmd.PersistentFlags().StringVar(&config.BinaryPath, "binaryPath", "./bin/",
 		"Directory with the binary executables")
 	runCmd.PersistentFlags().StringVar(&config.TempPath, "tempPath", "./temp/",
 		"Directory to store temporal files")
+	runCmd.PersistentFlags().StringVar(&config.ConfPath, "confPath", "./conf/",
+		"Directory with the configuration files such as additional workflow templates")
+	runCmd.PersistentFlags().StringVar(&config.LogsPath, "logsPath", "",
+		"Directory to store the logs of each workflow, logs are only kept in memory if not set")
+	runCmd.PersistentFlags().IntVar(&config.MaxLogEntries, "maxLogEntries", cfg.DefaultMaxLogEntries,
+		"Number of log entries kept in memory per workflow")
+	runCmd.PersistentFlags().StringVar(&config.HistoryPath, "historyPath", "",
+		"File to store the records of the finished installs, records are only kept in memory if not set")
+	runCmd.PersistentFlags().DurationVar(&config.HistoryRetention, "historyRetention", cfg.DefaultHistoryRetention,
+		"Time the records of the finished installs are kept, 0 to keep them until maxHistoryRecords is reached")
+	runCmd.PersistentFlags().IntVar(&config.MaxHistoryRecords, "maxHistoryRecords", cfg.DefaultMaxHistoryRecords,
+		"Number of records of finished installs kept, 0 for no limit")
+	runCmd.PersistentFlags().IntVar(&config.BatchConcurrency, "batchConcurrency", cfg.DefaultBatchConcurrency,
+		"Maximum number of installs of a batch running at the same time")
+	runCmd.PersistentFlags().IntVar(&config.MaxInstallsPerOrganization, "maxInstallsPerOrganization", 0,
+		"Maximum number of installs and uninstalls of an organization running at the same time, 0 for no limit")
+	runCmd.PersistentFlags().Float32Var(&config.KubeQPS, "kubeQPS", k8s.DefaultQPS,
+		"Queries per second sent to the Kubernetes API by each client")
+	runCmd.PersistentFlags().IntVar(&config.KubeBurst, "kubeBurst", k8s.DefaultBurst,
+		"Queries sent at once to the Kubernetes API by each client")
+	runCmd.PersistentFlags().BoolVar(&config.HardenNetwork, "hardenNetwork", false,
+		"Install network policies restricting the traffic into the platform namespaces")
+	runCmd.PersistentFlags().BoolVar(&config.WithObservability, "withObservability", false,
+		"Install Prometheus, Grafana and Jaeger, and Kiali with the istio networking mode")
+	runCmd.PersistentFlags().StringVar(&config.LoggingStack, "loggingStack", "",
+		"Install a stack collecting the logs of the platform namespaces [loki, efk]")
+	runCmd.PersistentFlags().StringVar(&config.LogRetention, "logRetention", logstack.DefaultRetention,
+		"Duration the logs are kept by the logging stack, rounded up to whole days")
+	runCmd.PersistentFlags().StringVar(&config.LogStorageSize, "logStorageSize", logstack.DefaultStorageSize,
+		"Size of the volume storing the logs of the logging stack")
+	runCmd.PersistentFlags().StringVar(&config.StorageProvisioner, "storageProvisioner", "",
+		"Install a default provisioner of persistent volumes on baremetal and minikube clusters without one [local-path, nfs]")
+	runCmd.PersistentFlags().StringVar(&config.NFSShare, "nfsShare", "",
+		"Share of the volumes of the nfs storage provisioner as server:/path")
+	runCmd.PersistentFlags().BoolVar(&config.Prune, "prune", false,
+		"Remove the components of previous installs that are no longer part of the components path")
+	runCmd.PersistentFlags().BoolVar(&config.AdoptExisting, "adoptExisting", false,
+		"Take over the existing components that were not created by the installer instead of failing")
+	runCmd.PersistentFlags().BoolVar(&config.MigrateVolumes, "migrateVolumes", false,
+		"Copy the data of the claims whose size is increased to new claims if their volumes cannot be expanded")
+	runCmd.PersistentFlags().StringToStringVar(&config.FeatureFlags, "featureFlag", nil,
+		"Feature flag exposed to the components of the installs as name=value, can be repeated")
+	runCmd.PersistentFlags().BoolVar(&config.AllowUnsupportedVersions, "allowUnsupportedVersions", false,
+		"Continue the installs whose versions are not part of the compatibility matrix")
+	runCmd.PersistentFlags().StringVar(&config.PluginsPath, "pluginsPath", "",
+		"Directory with executables registered as additional workflow commands")
+	runCmd.PersistentFlags().BoolVar(&config.RestrictedCrypto, "restrictedCrypto", false,
+		"Only allow RSA keys of at least 3072 bits, ECDSA P-256 or P-384 keys and TLS 1.2 AES-GCM cipher suites")
 
 	addRegistryOptions(runCmd)
 
@@ -86,6 +196,41 @@ func init() {
 	config.NetworkingMode = entry
 
 	runCmd.PersistentFlags().StringVar(&config.IstioPath, "istioPath", "/istio/bin", "Path where the Istio project can be found")
+	runCmd.PersistentFlags().StringVar(&config.IstioRevision, "istioRevision", "",
+		"Revision of the Istio control plane whose sidecar injector is used, the default injector is used if not set")
+	runCmd.PersistentFlags().StringVar(&config.IstioTrustDomain, "istioTrustDomain", "",
+		"SPIFFE trust domain of the Istio mesh, cluster.local if not set")
+	runCmd.PersistentFlags().StringVar(&config.IstioNamespace, "istioNamespace", "",
+		"Namespace where Istio is installed, such as istio-system-rev1, istio-system if not set")
+	runCmd.PersistentFlags().StringVar(&config.IstioIngressGateway, "istioIngressGateway", "",
+		"Name of the service of the Istio ingress gateway, istio-ingressgateway if not set")
+	runCmd.PersistentFlags().StringVar(&config.IstioCASecret, "istioCASecret", "",
+		"Name of the secret with the CAs of Istio, cacerts if not set")
+	runCmd.PersistentFlags().StringVar(&config.IstioGatewayIP, "istioGatewayIP", "",
+		"IP of the Istio ingress gateway used by the application clusters, looked up in the management cluster if not set")
+	runCmd.PersistentFlags().StringVar(&config.IngressCertificate, "ingressCertificate", "",
+		"Secret with the wildcard certificate copied to the application clusters as namespace/name, such as istio-system/ingress-cert")
+	runCmd.PersistentFlags().StringVar(&config.CertificateIssuer, "certificateIssuer", k8s.LetsEncryptMode,
+		"Issuer of the ingress certificates of the management cluster: letsencrypt, or internal if it was installed with an internal CA")
+	runCmd.PersistentFlags().StringVar(&config.IngressController, "ingressController", "",
+		"Ingress controller of the clusters: nginx, traefik or istio. The Istio gateway is used with the istio networking mode and NGINX otherwise if not set")
+	runCmd.PersistentFlags().StringVar(&config.ClusterDomain, "clusterDomain", "",
+		"DNS domain of the services of the management cluster stored in the management config, cluster.local if not set")
+	runCmd.PersistentFlags().DurationVar(&config.CertificateCheckInterval, "certificateCheckInterval", 0,
+		"Time between the checks of the certificates created by the installer, 0 to disable the checks")
+	runCmd.PersistentFlags().StringVar(&config.CertificateRenewBefore, "certificateRenewBefore", k8s.DefaultRenewBefore,
+		"Time before the expiration when certificates are renewed or reported")
+	runCmd.PersistentFlags().BoolVar(&config.RenewCertificates, "renewCertificates", false,
+		"Renew the self-signed certificates about to expire instead of only reporting them")
+	runCmd.PersistentFlags().BoolVar(&config.LeaderElection, "leaderElection", false,
+		"Elect a leader among the replicas of the installer, the only one executing workflows")
+	runCmd.PersistentFlags().StringVar(&config.LeaderElectionNamespace, "leaderElectionNamespace", cfg.DefaultLeaderElectionNamespace,
+		"Namespace of the leader lease and of the state shared among the replicas")
+	runCmd.PersistentFlags().DurationVar(&config.LeaderElectionLease, "leaderElectionLease", cfg.DefaultLeaderElectionLease,
+		"Duration of the lease of the leader")
+
+	addSecurityOptions(runCmd)
+	addNotificationOptions(runCmd)
 
 
 	rootCmd.AddCommand(runCmd)
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"os"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/backup"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/rs/zerolog/log"
+)
+
+// Backup exports the objects of the management cluster into an archive.
+//   params:
+//     kubeConfigPath The kubeconfig of the management cluster.
+//     namespace The namespace to be exported.
+//     outputPath The path of the archive.
+//     keyPath The path of the key used to encrypt the secrets, generated if it does not exist.
+//   returns:
+//     The exported archive.
+//     An error if the objects cannot be exported.
+func Backup(kubeConfigPath string, namespace string, outputPath string, keyPath string) (*backup.Archive, derrors.Error) {
+	key, err := backup.LoadKey(keyPath, true)
+	if err != nil {
+		return nil, err
+	}
+	client := &k8s.Kubernetes{KubeConfigPath: kubeConfigPath}
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+	archive, err := backup.Export(client, namespace)
+	if err != nil {
+		return nil, err
+	}
+	out, oErr := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if oErr != nil {
+		return nil, derrors.NewInternalError("cannot create backup file", oErr).WithParams(outputPath)
+	}
+	defer out.Close()
+	if err := archive.Write(out, key); err != nil {
+		return nil, err
+	}
+	log.Info().Str("path", outputPath).Str("content", archive.String()).Msg("backup created")
+	return archive, nil
+}
+
+// Restore creates the objects of a backup on a cluster.
+//   params:
+//     kubeConfigPath The kubeconfig of the target cluster.
+//     inputPath The path of the archive.
+//     keyPath The path of the key used to encrypt the secrets.
+//     namespace The target namespace, the one of the backup if empty.
+//   returns:
+//     The objects created and skipped.
+//     An error if the backup cannot be restored.
+func Restore(kubeConfigPath string, inputPath string, keyPath string, namespace string) (*backup.RestoreResult, derrors.Error) {
+	key, err := backup.LoadKey(keyPath, false)
+	if err != nil {
+		return nil, err
+	}
+	in, oErr := os.Open(inputPath)
+	if oErr != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot open backup file", oErr).WithParams(inputPath)
+	}
+	defer in.Close()
+	archive, err := backup.ReadArchive(in, key)
+	if err != nil {
+		return nil, err
+	}
+	client := &k8s.Kubernetes{KubeConfigPath: kubeConfigPath}
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+	result, err := backup.Restore(client, archive, namespace)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Int("created", len(result.Created)).Int("skipped", len(result.Skipped)).Msg("backup restored")
+	return result, nil
+}
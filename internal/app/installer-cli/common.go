@@ -23,10 +23,14 @@ import (
 	"github.com/nalej/grpc-infrastructure-go"
 	"github.com/nalej/grpc-installer-go"
 	"github.com/nalej/installer/internal/pkg/entities"
+	"github.com/nalej/installer/internal/pkg/errors"
 	"github.com/nalej/installer/internal/pkg/templates"
 	"github.com/nalej/installer/internal/pkg/utils"
 	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/nalej/installer/internal/pkg/workflow/commands"
 	"github.com/rs/zerolog/log"
+	"io"
+	"os"
 	"time"
 )
 
@@ -38,6 +42,17 @@ type CLI struct {
 	Workflow *workflow.Workflow
 	// kubeConfigContent with the raw contents of the kubeConfig file to be used.
 	kubeConfigContent string
+	// templates with the registry of available workflow templates.
+	templates *templates.Registry
+	// templateName with the name of the selected install template.
+	templateName string
+	// templateVersion with the version of the selected install template.
+	templateVersion string
+	// templateContent with the install template received from the management cluster, it takes precedence over
+	// the selected template.
+	templateContent string
+	// output with the format used to report the result of the operation.
+	output OutputFormat
 }
 
 // NewCLI builds a new CLI command wrapper to interact with the underlying installer logic.
@@ -46,9 +61,52 @@ func NewCLI(kubeConfigPath string) (*CLI, derrors.Error) {
 	if err != nil {
 		return nil, err
 	}
-	return &CLI{kubeConfigContent: kubeConfigContent}, nil
+	return &CLI{kubeConfigContent: kubeConfigContent, templates: templates.NewRegistry()}, nil
 }
 
+// SelectTemplate loads the workflow templates of the configuration path and selects the install template to use.
+func (c *CLI) SelectTemplate(confPath string, name string, version string) derrors.Error {
+	if err := c.templates.LoadFromPath(confPath); err != nil {
+		return err
+	}
+	if name != "" {
+		if _, err := c.templates.Get(name, version); err != nil {
+			return err
+		}
+	}
+	c.templateName = name
+	c.templateVersion = version
+	return nil
+}
+
+// SetOutput sets the format used to report the result of the operation. Progress messages are written to
+// stderr when a machine readable format is selected.
+func (c *CLI) SetOutput(format string) derrors.Error {
+	output, err := OutputFormatFromString(format)
+	if err != nil {
+		return err
+	}
+	c.output = output
+	return nil
+}
+
+// requestPlatform returns the platform of the requests for a target platform. OpenShift clusters are requested as
+// BAREMETAL with the platform set apart on the parameters.
+func requestPlatform(targetPlatform string) grpc_installer_go.Platform {
+	if targetPlatform == entities.OpenShiftPlatform {
+		return grpc_installer_go.Platform_BAREMETAL
+	}
+	return grpc_installer_go.Platform(grpc_installer_go.Platform_value[targetPlatform])
+}
+
+// apartPlatform returns the platform set apart on the parameters for a target platform, if it is not one of the
+// platforms of the requests.
+func apartPlatform(targetPlatform string) string {
+	if _, found := grpc_installer_go.Platform_value[targetPlatform]; found {
+		return ""
+	}
+	return targetPlatform
+}
 
 // PrepareInstallCommand prepares the CLI to execute an install command.
 func (c *CLI) PrepareInstallCommand(
@@ -84,6 +142,7 @@ func (c *CLI) PrepareInstallCommand(
 		CorednsExt:  ipAddressCoreDNS,
 		VpnServer:   ipAddressVPNServer,
 	}
+	c.exitOnError(entities.ValidStaticIPAddresses(&staticIPAddresses))
 	// Prepare the gRPC request as would have been send to the service.
 	request := &grpc_installer_go.InstallRequest{
 		RequestId:         requestID,
@@ -96,7 +155,7 @@ func (c *CLI) PrepareInstallCommand(
 		Username:          username,
 		PrivateKey:        privateKeyContent,
 		Nodes:             nodes,
-		TargetPlatform:    grpc_installer_go.Platform(grpc_installer_go.Platform_value[targetPlatform]),
+		TargetPlatform:    requestPlatform(targetPlatform),
 		StaticIpAddresses: &staticIPAddresses,
 	}
 	params := workflow.NewInstallParameters(request, workflow.Assets{},
@@ -104,8 +163,9 @@ func (c *CLI) PrepareInstallCommand(
 		dnsClusterHost, dnsClusterPort,
 		environment.Target,
 		appClusterInstall,
-		workflow.NetworkConfig{NetworkingMode: networkingMode, IstioPath: istioPath, ZTPlanetSecretPath:""},
+		workflow.NetworkConfig{NetworkingMode: networkingMode, IstioPath: istioPath, ZTPlanetSecretPath: ""},
 		"", "")
+	params.Platform = apartPlatform(targetPlatform)
 
 	c.Params = *params
 
@@ -126,31 +186,62 @@ func (c *CLI) PrepareUninstallCommand(
 		ClusterId:      clusterID,
 		ClusterType:    grpc_infrastructure_go.ClusterType_KUBERNETES,
 		KubeConfigRaw:  c.kubeConfigContent,
-		TargetPlatform: grpc_installer_go.Platform(grpc_installer_go.Platform_value[targetPlatform]),
+		TargetPlatform: requestPlatform(targetPlatform),
 	}
 	params := workflow.NewUninstallParameters(request, appCluster)
+	params.Platform = apartPlatform(targetPlatform)
 	c.Params = *params
 }
 
+// PrepareRotateSecretsCommand prepares the CLI to execute a secret rotation.
+func (c *CLI) PrepareRotateSecretsCommand(requestID string, paths workflow.Paths, authxSecret string, appCluster bool) {
+	request := &workflow.RotateSecretsRequest{
+		RequestId:     requestID,
+		KubeConfigRaw: c.kubeConfigContent,
+	}
+	c.Params = *workflow.NewRotateSecretsParameters(request, paths, authxSecret, appCluster)
+}
+
 // Load all the credentials and associated workflow into the installer.
 func (c *CLI) LoadCredentials() {
 	c.exitOnError(c.Params.LoadCredentials())
 	c.exitOnError(c.Params.Validate())
-	p := workflow.NewParser()
+	p := workflow.NewParser().WithTemplates(c.templates)
 	workflowTemplate := ""
 	workflowName := ""
 	if c.Params.InstallRequest != nil {
 		workflowName = "installCluster"
 		workflowTemplate = templates.InstallManagementCluster
+		if c.templateName != "" {
+			template, err := c.templates.Get(c.templateName, c.templateVersion)
+			c.exitOnError(err)
+			workflowTemplate = template.Content
+		}
+		if c.templateContent != "" {
+			workflowTemplate = c.templateContent
+		}
 	} else if c.Params.UninstallRequest != nil {
 		workflowName = "uninstallCluster"
 		workflowTemplate = templates.UninstallCluster
+	} else if c.Params.RotateSecretsRequest != nil {
+		workflowName = "rotateSecrets"
+		workflowTemplate = templates.RotateSecrets
 	}
 	workflow, err := p.ParseWorkflow("cli-install", workflowTemplate, workflowName, c.Params)
 	c.exitOnError(err)
 	c.Workflow = workflow
 }
 
+// Render writes the manifests of the components the install would launch to a directory instead of executing it.
+func (c *CLI) Render(outputDir string) {
+	c.LoadCredentials()
+	written, err := commands.RenderComponents(outputDir, c.Workflow.Commands...)
+	c.exitOnError(err)
+	for _, path := range written {
+		fmt.Println(path)
+	}
+}
+
 // exitOnError produces a panic if an error is passed as parameter to finish the execution.
 func (c *CLI) exitOnError(err derrors.Error) {
 	if err != nil {
@@ -188,18 +279,51 @@ func (c *CLI) Execute() {
 		} else {
 			operation = "Uninstalling management cluster"
 		}
+	} else if c.Params.RotateSecretsRequest != nil {
+		operation = "Rotating secrets"
+	}
+	// Progress messages must not be mixed with machine readable output.
+	progress := io.Writer(os.Stdout)
+	if c.output != TextOutput {
+		progress = os.Stderr
 	}
 	for !wr.Called {
 		time.Sleep(time.Second * 15)
 		if checks%4 == 0 {
-			fmt.Println(operation, string(exec.State), "-", time.Since(start).String())
+			fmt.Fprintln(progress, operation, string(exec.State), "-", time.Since(start).String())
 		}
 		checks++
 	}
 	elapsed := time.Since(start)
+	if c.output != TextOutput {
+		result := OperationResult{
+			WorkflowID: c.Workflow.WorkflowID,
+			Operation:  operation,
+			State:      string(wr.State),
+			Success:    wr.Error == nil,
+			Duration:   elapsed.String(),
+			Commands:   exec.CommandResults,
+			Objects:    AppliedObjects(exec.CommandResults),
+		}
+		if wr.Error != nil {
+			result.Error = wr.Error.Error()
+			if code, found := errors.ErrorCode(wr.Error); found {
+				result.Code = string(code)
+				result.Hint = errors.Catalogue[code].Hint
+			}
+		}
+		c.exitOnError(WriteResult(os.Stdout, c.output, result))
+		if wr.Error != nil {
+			os.Exit(1)
+		}
+		return
+	}
 	fmt.Println("Operation took ", elapsed)
 	if wr.Error != nil {
 		fmt.Println("Operation failed due to ", wr.Error.Error())
+		if code, found := errors.ErrorCode(wr.Error); found {
+			fmt.Println("Hint:", errors.Catalogue[code].Hint)
+		}
 		log.Fatal().Str("error", wr.Error.DebugReport()).Msg(fmt.Sprintf("%s failed", operation))
 	}
 }
@@ -0,0 +1,47 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/compatibility"
+)
+
+// WriteCompatibility writes the compatibility matrix as a table or using a machine readable format.
+//   params:
+//     out The writer receiving the matrix.
+//     format The output format.
+//     manifestPath The path of the compatibility manifest, empty to use the builtin one.
+//   returns:
+//     An error if the manifest cannot be loaded or written.
+func WriteCompatibility(out io.Writer, format OutputFormat, manifestPath string) derrors.Error {
+	manifest, err := compatibility.LoadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	if format != TextOutput {
+		return writeDocument(out, format, manifest)
+	}
+	if _, wErr := fmt.Fprint(out, manifest.Table()); wErr != nil {
+		return derrors.NewInternalError("cannot write compatibility matrix", wErr)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Layered configuration
+// The values of the CLI flags are resolved with the following precedence: flags set in the command line, environment
+// variables with the NALEJ_INSTALLER_ prefix, the YAML configuration file, and finally the flag defaults. The
+// configuration file is a flat map using the flag names as keys:
+//
+// kubeConfigPath: ~/.kube/config
+// targetPlatform: AZURE
+// nodes:
+//   - 10.0.0.1
+//   - 10.0.0.2
+
+package installer_cli
+
+import (
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix is the prefix of the environment variables that define flag values.
+const EnvPrefix = "NALEJ_INSTALLER_"
+
+// MaskedValue is the value shown instead of secrets.
+const MaskedValue = "********"
+
+// ConfigSource defines where the value of a flag comes from.
+type ConfigSource string
+
+const (
+	// DefaultSource for flags that keep their default value.
+	DefaultSource ConfigSource = "default"
+	// FileSource for flags whose value is defined in the configuration file.
+	FileSource ConfigSource = "file"
+	// EnvSource for flags whose value is defined with an environment variable.
+	EnvSource ConfigSource = "env"
+	// FlagSource for flags set in the command line.
+	FlagSource ConfigSource = "flag"
+)
+
+// secretMarkers contains the fragments of the flag names whose values must not be displayed.
+var secretMarkers = []string{"password", "secret", "token"}
+
+// ConfigEntry structure with the effective value of a flag.
+type ConfigEntry struct {
+	// Name of the flag.
+	Name string
+	// Value of the flag, masked if it is a secret.
+	Value string
+	// Source from where the value was obtained.
+	Source ConfigSource
+}
+
+// String returns the string representation of the entry.
+func (ce ConfigEntry) String() string {
+	return fmt.Sprintf("%s: %s (%s)", ce.Name, ce.Value, ce.Source)
+}
+
+// LayeredConfig structure with the values of the configuration file and the sources of the applied values.
+type LayeredConfig struct {
+	// Path of the configuration file, empty if no file is used.
+	Path string
+	// fileValues with the values read from the configuration file indexed by flag name.
+	fileValues map[string]string
+	// sources with the source of the values applied to the flags.
+	sources map[string]ConfigSource
+}
+
+// NewLayeredConfig creates a LayeredConfig reading the given configuration file.
+//   params:
+//     path The path of the YAML configuration file, empty to only use environment variables.
+//     required Whether the file must exist.
+//   returns:
+//     A LayeredConfig.
+//     An error if the file cannot be read.
+func NewLayeredConfig(path string, required bool) (*LayeredConfig, derrors.Error) {
+	result := &LayeredConfig{
+		fileValues: make(map[string]string, 0),
+		sources:    make(map[string]ConfigSource, 0),
+	}
+	if path == "" {
+		return result, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return result, nil
+		}
+		return nil, derrors.NewInvalidArgumentError("cannot read configuration file", err).WithParams(path)
+	}
+	values := make(map[string]interface{}, 0)
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return nil, derrors.NewInvalidArgumentError("invalid configuration file", err).WithParams(path)
+	}
+	for key, value := range values {
+		result.fileValues[key] = toFlagValue(value)
+	}
+	result.Path = path
+	return result, nil
+}
+
+// toFlagValue transforms a value of the configuration file into the string representation expected by flags.
+func toFlagValue(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		elements := make([]string, 0, len(list))
+		for _, element := range list {
+			elements = append(elements, fmt.Sprintf("%v", element))
+		}
+		return strings.Join(elements, ",")
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// EnvName returns the name of the environment variable associated with a flag. For example, the value of
+// kubeConfigPath can be set with NALEJ_INSTALLER_KUBE_CONFIG_PATH.
+func EnvName(flagName string) string {
+	var result strings.Builder
+	result.WriteString(EnvPrefix)
+	runes := []rune(flagName)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) ||
+			(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+			result.WriteRune('_')
+		}
+		if r == '-' || r == '.' {
+			result.WriteRune('_')
+			continue
+		}
+		result.WriteRune(unicode.ToUpper(r))
+	}
+	return result.String()
+}
+
+// IsSecret checks if the value of a flag must be masked.
+func IsSecret(flagName string) bool {
+	lower := strings.ToLower(flagName)
+	for _, marker := range secretMarkers {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply sets the flags that have not been set in the command line with the values found in the environment
+// or in the configuration file.
+//   params:
+//     flags The set of flags of the command being executed.
+//   returns:
+//     An error if a value cannot be applied.
+func (lc *LayeredConfig) Apply(flags *pflag.FlagSet) derrors.Error {
+	var result derrors.Error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if result != nil {
+			return
+		}
+		if flag.Changed {
+			if _, applied := lc.sources[flag.Name]; !applied {
+				lc.sources[flag.Name] = FlagSource
+			}
+			return
+		}
+		source := DefaultSource
+		value, found := os.LookupEnv(EnvName(flag.Name))
+		if found {
+			source = EnvSource
+		} else {
+			value, found = lc.fileValues[flag.Name]
+			if found {
+				source = FileSource
+			}
+		}
+		lc.sources[flag.Name] = source
+		if !found {
+			return
+		}
+		if err := flags.Set(flag.Name, value); err != nil {
+			result = derrors.NewInvalidArgumentError("invalid configuration value", err).WithParams(flag.Name, source)
+		}
+	})
+	return result
+}
+
+// Entries returns the effective configuration of a set of flags sorted by name.
+//   params:
+//     flags The set of flags previously passed to Apply.
+//   returns:
+//     The list of entries with secrets masked.
+func (lc *LayeredConfig) Entries(flags *pflag.FlagSet) []ConfigEntry {
+	result := make([]ConfigEntry, 0)
+	flags.VisitAll(func(flag *pflag.Flag) {
+		source, found := lc.sources[flag.Name]
+		if !found {
+			source = DefaultSource
+		}
+		value := flag.Value.String()
+		if IsSecret(flag.Name) && value != "" {
+			value = MaskedValue
+		}
+		result = append(result, ConfigEntry{Name: flag.Name, Value: value, Source: source})
+	})
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
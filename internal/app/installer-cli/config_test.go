@@ -0,0 +1,113 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/spf13/pflag"
+	"io/ioutil"
+	"os"
+)
+
+const testConfigFile = `
+kubeConfigPath: /from/file
+targetPlatform: AZURE
+nodes:
+  - 10.0.0.1
+  - 10.0.0.2
+`
+
+var _ = ginkgo.Describe("Layered configuration", func() {
+
+	var configPath string
+	var flags *pflag.FlagSet
+
+	ginkgo.BeforeEach(func() {
+		file, err := ioutil.TempFile("", "installer-cli-config")
+		gomega.Expect(err).To(gomega.Succeed())
+		_, err = file.WriteString(testConfigFile)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(file.Close()).To(gomega.Succeed())
+		configPath = file.Name()
+
+		flags = pflag.NewFlagSet("test", pflag.ContinueOnError)
+		flags.String("kubeConfigPath", "~/.kube/config", "")
+		flags.String("targetPlatform", "MINIKUBE", "")
+		flags.String("nodes", "", "")
+		flags.String("authSecret", "", "")
+		flags.Int("dnsClusterPublicPort", 53, "")
+	})
+
+	ginkgo.AfterEach(func() {
+		os.Remove(configPath)
+		os.Unsetenv(EnvName("targetPlatform"))
+		os.Unsetenv(EnvName("authSecret"))
+	})
+
+	ginkgo.It("should derive the environment variable names", func() {
+		gomega.Expect(EnvName("kubeConfigPath")).To(gomega.Equal("NALEJ_INSTALLER_KUBE_CONFIG_PATH"))
+		gomega.Expect(EnvName("useStaticIPAddresses")).To(gomega.Equal("NALEJ_INSTALLER_USE_STATIC_IP_ADDRESSES"))
+		gomega.Expect(EnvName("ipAddressDNS")).To(gomega.Equal("NALEJ_INSTALLER_IP_ADDRESS_DNS"))
+	})
+
+	ginkgo.It("should apply flags, environment and file in order", func() {
+		gomega.Expect(flags.Parse([]string{"--kubeConfigPath", "/from/flag"})).To(gomega.Succeed())
+		os.Setenv(EnvName("targetPlatform"), "BAREMETAL")
+		config, err := NewLayeredConfig(configPath, true)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(config.Apply(flags)).To(gomega.BeNil())
+
+		kubeConfigPath, _ := flags.GetString("kubeConfigPath")
+		gomega.Expect(kubeConfigPath).To(gomega.Equal("/from/flag"))
+		targetPlatform, _ := flags.GetString("targetPlatform")
+		gomega.Expect(targetPlatform).To(gomega.Equal("BAREMETAL"))
+		nodes, _ := flags.GetString("nodes")
+		gomega.Expect(nodes).To(gomega.Equal("10.0.0.1,10.0.0.2"))
+		port, _ := flags.GetInt("dnsClusterPublicPort")
+		gomega.Expect(port).To(gomega.Equal(53))
+
+		sources := make(map[string]ConfigSource, 0)
+		for _, entry := range config.Entries(flags) {
+			sources[entry.Name] = entry.Source
+		}
+		gomega.Expect(sources["kubeConfigPath"]).To(gomega.Equal(FlagSource))
+		gomega.Expect(sources["targetPlatform"]).To(gomega.Equal(EnvSource))
+		gomega.Expect(sources["nodes"]).To(gomega.Equal(FileSource))
+		gomega.Expect(sources["dnsClusterPublicPort"]).To(gomega.Equal(DefaultSource))
+	})
+
+	ginkgo.It("should mask secrets", func() {
+		os.Setenv(EnvName("authSecret"), "mySecret")
+		config, err := NewLayeredConfig("", false)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(config.Apply(flags)).To(gomega.BeNil())
+		for _, entry := range config.Entries(flags) {
+			if entry.Name == "authSecret" {
+				gomega.Expect(entry.Value).To(gomega.Equal(MaskedValue))
+			}
+		}
+	})
+
+	ginkgo.It("should fail if a required file does not exist", func() {
+		_, err := NewLayeredConfig("/does/not/exist.yaml", true)
+		gomega.Expect(err).ToNot(gomega.BeNil())
+		_, err = NewLayeredConfig("/does/not/exist.yaml", false)
+		gomega.Expect(err).To(gomega.BeNil())
+	})
+})
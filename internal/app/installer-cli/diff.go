@@ -0,0 +1,104 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// diffSymbols with the prefix of each action on the text output.
+var diffSymbols = map[k8s.DiffAction]string{
+	k8s.DiffCreate: "+",
+	k8s.DiffUpdate: "~",
+	k8s.DiffPrune:  "-",
+}
+
+// diffColors with the color of each action on the text output.
+var diffColors = map[k8s.DiffAction]string{
+	k8s.DiffCreate: colorGreen,
+	k8s.DiffUpdate: colorYellow,
+	k8s.DiffPrune:  colorRed,
+}
+
+// WriteDiff writes the changes an install would perform as text or using a machine readable format.
+//   params:
+//     out The writer receiving the changes.
+//     format The output format.
+//     report The changes computed on the cluster.
+//     color Whether the text output is colorized.
+//   returns:
+//     An error if the changes cannot be written.
+func WriteDiff(out io.Writer, format OutputFormat, report *k8s.DiffReport, color bool) derrors.Error {
+	if format != TextOutput {
+		return writeDocument(out, format, report)
+	}
+	paint := func(code string, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + colorReset
+	}
+	var b strings.Builder
+	for _, obj := range report.Objects {
+		if obj.Action == k8s.DiffUnchanged {
+			continue
+		}
+		header := fmt.Sprintf("%s %s %s", diffSymbols[obj.Action], obj.Action, obj.String())
+		if obj.Component != "" {
+			header = fmt.Sprintf("%s (%s)", header, obj.Component)
+		}
+		b.WriteString(paint(diffColors[obj.Action], header) + "\n")
+		for _, change := range obj.Changes {
+			b.WriteString(fmt.Sprintf("    %s\n", change.Path))
+			if change.Old != nil {
+				b.WriteString(paint(colorRed, "      - "+diffValue(change.Old)) + "\n")
+			}
+			if change.New != nil {
+				b.WriteString(paint(colorGreen, "      + "+diffValue(change.New)) + "\n")
+			}
+		}
+	}
+	b.WriteString(fmt.Sprintf("%d to create, %d to update, %d to prune, %d unchanged\n",
+		report.Count(k8s.DiffCreate), report.Count(k8s.DiffUpdate), report.Count(k8s.DiffPrune), report.Count(k8s.DiffUnchanged)))
+	if _, err := io.WriteString(out, b.String()); err != nil {
+		return derrors.NewInternalError("cannot write diff", err)
+	}
+	return nil
+}
+
+// diffValue formats a field value on a single line.
+func diffValue(value interface{}) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(content)
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/nalej/installer/internal/pkg/workflow/commands"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/rs/zerolog/log"
+	"sigs.k8s.io/yaml"
+)
+
+// NewInstallIdentity renders a workflow and creates the least privileged identity able to execute it.
+//   params:
+//     template The workflow template.
+//     params The parameters used to render the template.
+//     name The name of the identity.
+//     namespace The namespace of its service account.
+//   returns:
+//     The install identity.
+//     An error if the workflow cannot be parsed or its accesses cannot be determined.
+func NewInstallIdentity(template string, params workflow.Parameters, name string, namespace string) (*k8s.InstallIdentity, derrors.Error) {
+	wf, err := workflow.NewParser().ParseWorkflow("install-identity", template, "installIdentity", params)
+	if err != nil {
+		return nil, err
+	}
+	accesses, err := commands.RequiredAccess(wf.Commands...)
+	if err != nil {
+		return nil, err
+	}
+	return k8s.NewInstallIdentity(name, namespace, accesses), nil
+}
+
+// WriteInstallIdentity writes the objects of an install identity as a multi document YAML.
+func WriteInstallIdentity(out io.Writer, identity *k8s.InstallIdentity) derrors.Error {
+	for _, obj := range identity.Objects() {
+		content, err := yaml.Marshal(obj)
+		if err != nil {
+			return derrors.NewInternalError("cannot marshal install identity", err)
+		}
+		if _, err := out.Write(append([]byte("---\n"), content...)); err != nil {
+			return derrors.NewInternalError("cannot write install identity", err)
+		}
+	}
+	return nil
+}
+
+// CreateInstallIdentity creates an install identity on the cluster and writes the kubeconfig file required to use it.
+//   params:
+//     kubeConfigPath The kubeconfig used to create the identity.
+//     identity The install identity.
+//     outputPath The path of the resulting kubeconfig file.
+//   returns:
+//     An error if the identity cannot be created.
+func CreateInstallIdentity(kubeConfigPath string, identity *k8s.InstallIdentity, outputPath string) derrors.Error {
+	client := &k8s.Kubernetes{KubeConfigPath: kubeConfigPath}
+	if err := client.Connect(); err != nil {
+		return err
+	}
+	if err := client.CreateInstallIdentity(identity); err != nil {
+		return err
+	}
+	content, err := client.InstallIdentityKubeConfig(identity, k8s.DefaultIdentityTokenTimeout)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(outputPath, content, 0600); err != nil {
+		return derrors.NewInternalError("cannot write kubeconfig file", err).WithParams(outputPath)
+	}
+	log.Info().Str("path", outputPath).Str("serviceAccount", identity.ServiceAccount.Name).Msg("install identity created")
+	return nil
+}
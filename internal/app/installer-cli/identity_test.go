@@ -0,0 +1,108 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"bytes"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/templates"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"io/ioutil"
+	rbacV1 "k8s.io/api/rbac/v1"
+	"os"
+	"path/filepath"
+)
+
+const identityDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: system-model
+  namespace: nalej
+`
+
+const identityMonitor = `
+apiVersion: monitoring.coreos.com/v1
+kind: ServiceMonitor
+metadata:
+  name: system-model
+  namespace: nalej
+`
+
+// findRule returns the rule granting access to a resource.
+func findRule(rules []rbacV1.PolicyRule, group string, resource string) *rbacV1.PolicyRule {
+	for _, rule := range rules {
+		for _, r := range rule.Resources {
+			if rule.APIGroups[0] == group && r == resource {
+				found := rule
+				return &found
+			}
+		}
+	}
+	return nil
+}
+
+var _ = ginkgo.Describe("Install identity", func() {
+
+	var componentsDir string
+
+	ginkgo.BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "identity")
+		gomega.Expect(err).To(gomega.Succeed())
+		componentsDir = dir
+		gomega.Expect(ioutil.WriteFile(filepath.Join(dir, "1-system-model.yaml"), []byte(identityDeployment), 0644)).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(filepath.Join(dir, "2-monitor.yaml"), []byte(identityMonitor), 0644)).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		gomega.Expect(os.RemoveAll(componentsDir)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should derive the rules from the install workflow", func() {
+		params := workflow.GetTestInstallParameters(1, false)
+		params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+		params.Paths.ComponentsPath = componentsDir
+		identity, err := NewInstallIdentity(templates.InstallManagementCluster, *params, "installer", "kube-system")
+		gomega.Expect(err).To(gomega.BeNil())
+
+		rules := identity.ClusterRole.Rules
+		deployments := findRule(rules, "apps", "deployments")
+		gomega.Expect(deployments).ToNot(gomega.BeNil())
+		gomega.Expect(deployments.Verbs).To(gomega.ContainElement("create"))
+		gomega.Expect(findRule(rules, "monitoring.coreos.com", "servicemonitors")).ToNot(gomega.BeNil())
+		gomega.Expect(findRule(rules, "", "nodes")).To(gomega.BeNil())
+		gomega.Expect(identity.ClusterRoleBinding.Subjects[0].Name).To(gomega.Equal("installer"))
+		gomega.Expect(identity.ClusterRoleBinding.Subjects[0].Namespace).To(gomega.Equal("kube-system"))
+	})
+
+	ginkgo.It("should write the objects as YAML", func() {
+		params := workflow.GetTestInstallParameters(1, false)
+		params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+		params.Paths.ComponentsPath = componentsDir
+		identity, err := NewInstallIdentity(templates.InstallManagementCluster, *params, "installer", "kube-system")
+		gomega.Expect(err).To(gomega.BeNil())
+		out := new(bytes.Buffer)
+		gomega.Expect(WriteInstallIdentity(out, identity)).To(gomega.BeNil())
+		gomega.Expect(out.String()).To(gomega.ContainSubstring("kind: ServiceAccount"))
+		gomega.Expect(out.String()).To(gomega.ContainSubstring("kind: ClusterRole\n"))
+		gomega.Expect(out.String()).To(gomega.ContainSubstring("kind: ClusterRoleBinding"))
+		gomega.Expect(out.String()).To(gomega.ContainSubstring("kubernetes.io/service-account-token"))
+	})
+})
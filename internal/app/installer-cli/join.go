@@ -0,0 +1,183 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/cryptopolicy"
+	"github.com/nalej/installer/internal/pkg/entities"
+	"github.com/nalej/installer/internal/pkg/server/extensions"
+	"github.com/nalej/installer/internal/pkg/templates"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// JoinTimeout is the maximum time to retrieve the install plan from the management cluster.
+const JoinTimeout = time.Minute
+
+// JoinOptions with the parameters required to contact the installer of the management cluster.
+type JoinOptions struct {
+	// ManagementAddress with the host:port of the installer service of the management cluster.
+	ManagementAddress string
+	// Token with the one-time join token.
+	Token string
+	// UseTLS indicates if the connection must use transport security.
+	UseTLS bool
+	// CACertPath with the CA used to validate the server certificate, empty to use the system roots.
+	CACertPath string
+}
+
+// FetchInstallPlan exchanges a join token for the install plan of the application cluster.
+func FetchInstallPlan(options JoinOptions) (*extensions.InstallPlan, derrors.Error) {
+	if options.ManagementAddress == "" || options.Token == "" {
+		return nil, derrors.NewInvalidArgumentError("management address and join token must be set")
+	}
+	dialOptions := []grpc.DialOption{grpc.WithBlock()}
+	if options.UseTLS {
+		tlsConfig := &tls.Config{}
+		if options.CACertPath != "" {
+			content, err := ioutil.ReadFile(options.CACertPath)
+			if err != nil {
+				return nil, derrors.AsError(err, "cannot read CA certificate")
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(content) {
+				return nil, derrors.NewInvalidArgumentError("cannot parse CA certificate").WithParams(options.CACertPath)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		dialOptions = append(dialOptions, grpc.WithTransportCredentials(credentials.NewTLS(cryptopolicy.RestrictTLS(tlsConfig))))
+	} else {
+		dialOptions = append(dialOptions, grpc.WithInsecure())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), JoinTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, options.ManagementAddress, dialOptions...)
+	if err != nil {
+		return nil, derrors.NewUnavailableError("cannot connect to the management cluster installer", err).WithParams(options.ManagementAddress)
+	}
+	defer conn.Close()
+	plan, err := extensions.NewExtensionsClient(conn).GetInstallPlan(ctx, &extensions.GetInstallPlanRequest{Token: options.Token})
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot retrieve install plan")
+	}
+	return plan, nil
+}
+
+// NewJoinCLI builds a CLI that installs the application cluster where the installer is running following the plan
+// received from the management cluster. The service account of the installer pod is used to access the cluster.
+func NewJoinCLI(plan *extensions.InstallPlan, paths workflow.Paths) (*CLI, derrors.Error) {
+	kubeConfig, err := k8s.InClusterKubeConfig()
+	if err != nil {
+		return nil, err
+	}
+	return newJoinCLI(plan, paths, string(kubeConfig))
+}
+
+// writePlanFile writes a file received in the install plan to the temporal directory.
+//   returns:
+//     The path of the file, empty if there is no content.
+//     An error if the file cannot be written.
+func writePlanFile(tempPath string, prefix string, content string) (string, derrors.Error) {
+	if content == "" {
+		return "", nil
+	}
+	f, err := ioutil.TempFile(tempPath, prefix)
+	if err != nil {
+		return "", derrors.AsError(err, "cannot create file").WithParams(prefix)
+	}
+	_, err = f.WriteString(content)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return "", derrors.AsError(err, "cannot write file").WithParams(prefix)
+	}
+	return f.Name(), nil
+}
+
+// newJoinCLI builds the join CLI with a given kubeconfig.
+func newJoinCLI(plan *extensions.InstallPlan, paths workflow.Paths, kubeConfigContent string) (*CLI, derrors.Error) {
+	target, found := entities.TargetEnvironmentFromString[strings.ToLower(plan.TargetEnvironment)]
+	if !found {
+		return nil, derrors.NewInvalidArgumentError("invalid target environment in install plan").WithParams(plan.TargetEnvironment)
+	}
+	if plan.Template == "" {
+		return nil, derrors.NewInvalidArgumentError("install plan does not contain a workflow template")
+	}
+	caCertPath, err := writePlanFile(paths.TempPath, "ca", plan.CACert)
+	if err != nil {
+		return nil, err
+	}
+	// The ingress certificate of the management cluster is copied from the plan as the application cluster
+	// cannot read it.
+	if plan.IngressCert != "" {
+		paths.IngressCertPath, err = writePlanFile(paths.TempPath, "ingress-cert", plan.IngressCert)
+		if err != nil {
+			return nil, err
+		}
+		paths.IngressKeyPath, err = writePlanFile(paths.TempPath, "ingress-key", plan.IngressKey)
+		if err != nil {
+			return nil, err
+		}
+		paths.IngressCAPath, err = writePlanFile(paths.TempPath, "ingress-ca", plan.IngressCA)
+		if err != nil {
+			return nil, err
+		}
+	}
+	request := plan.InstallRequest
+	request.KubeConfigRaw = kubeConfigContent
+	params := workflow.NewInstallParameters(&request, workflow.Assets{}, paths,
+		plan.ManagementClusterHost, plan.ManagementClusterPort,
+		plan.DNSClusterHost, plan.DNSClusterPort,
+		target,
+		true,
+		workflow.NetworkConfig{NetworkingMode: plan.NetworkingMode, IstioPath: plan.IstioPath, IstioRevision: plan.IstioRevision,
+			IstioTrustDomain: plan.IstioTrustDomain, IstioNamespace: plan.IstioNamespace,
+			IstioIngressGateway: plan.IstioIngressGateway, IstioCASecret: plan.IstioCASecret, IstioGatewayIP: plan.IstioGatewayIP,
+			IngressController: plan.IngressController},
+		plan.AuthSecret, caCertPath)
+	params.HardenNetwork = plan.HardenNetwork
+	params.WithObservability = plan.WithObservability
+	params.LoggingStack = plan.LoggingStack
+	params.LogRetention = plan.LogRetention
+	params.LogStorageSize = plan.LogStorageSize
+	params.StorageProvisioner = plan.StorageProvisioner
+	params.CertificateIssuer = plan.CertificateIssuer
+	params.NFSShare = plan.NFSShare
+	params.Prune = plan.Prune
+	params.AdoptExisting = plan.AdoptExisting
+	params.MigrateVolumes = plan.MigrateVolumes
+	params.FeatureFlags = plan.FeatureFlags
+	params.AllowUnsupportedVersions = plan.AllowUnsupported
+	params.Platform = plan.Platform
+	return &CLI{
+		Params:            *params,
+		kubeConfigContent: kubeConfigContent,
+		templates:         templates.NewRegistry(),
+		templateContent:   plan.Template,
+	}, nil
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/server/extensions"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Join", func() {
+
+	var tempDir string
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "join")
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		gomega.Expect(os.RemoveAll(tempDir)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should build the install parameters from the plan", func() {
+		plan := &extensions.InstallPlan{
+			RequestID: "request",
+			InstallRequest: grpc_installer_go.InstallRequest{
+				RequestId:      "request",
+				OrganizationId: "org",
+				ClusterId:      "cluster",
+				Hostname:       "app.nalej.example.com",
+			},
+			Template:              "{\"name\": \"join\", \"description\": \"join\", \"commands\": []}",
+			ManagementClusterHost: "nalej.example.com",
+			ManagementClusterPort: "443",
+			TargetEnvironment:     "PRODUCTION",
+			NetworkingMode:        "istio",
+			IstioGatewayIP:        "10.0.0.1",
+			AuthSecret:            "secret",
+			CACert:                "certificate",
+			IngressCert:           "ingress certificate",
+			IngressKey:            "ingress key",
+			Prune:                 true,
+		}
+		cli, err := newJoinCLI(plan, workflow.Paths{TempPath: tempDir}, "kubeconfig")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(cli.Params.AppCluster).Should(gomega.BeTrue())
+		gomega.Expect(cli.Params.Prune).Should(gomega.BeTrue())
+		gomega.Expect(cli.Params.InstallRequest.KubeConfigRaw).Should(gomega.Equal("kubeconfig"))
+		gomega.Expect(cli.Params.ManagementClusterHost).Should(gomega.Equal("nalej.example.com"))
+		gomega.Expect(cli.Params.NetworkConfig.NetworkingMode).Should(gomega.Equal("istio"))
+		gomega.Expect(cli.Params.NetworkConfig.IstioGatewayIP).Should(gomega.Equal("10.0.0.1"))
+		gomega.Expect(cli.templateContent).Should(gomega.Equal(plan.Template))
+		caCert, rErr := ioutil.ReadFile(cli.Params.CACertPath)
+		gomega.Expect(rErr).To(gomega.Succeed())
+		gomega.Expect(string(caCert)).Should(gomega.Equal("certificate"))
+		ingressKey, rErr := ioutil.ReadFile(cli.Params.Paths.IngressKeyPath)
+		gomega.Expect(rErr).To(gomega.Succeed())
+		gomega.Expect(string(ingressKey)).Should(gomega.Equal("ingress key"))
+		gomega.Expect(cli.Params.Paths.IngressCertPath).ShouldNot(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should reject plans without template or with an unknown environment", func() {
+		plan := &extensions.InstallPlan{TargetEnvironment: "PRODUCTION"}
+		_, err := newJoinCLI(plan, workflow.Paths{TempPath: tempDir}, "kubeconfig")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		plan = &extensions.InstallPlan{TargetEnvironment: "unknown", Template: "{}"}
+		_, err = newJoinCLI(plan, workflow.Paths{TempPath: tempDir}, "kubeconfig")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should require the address and the token", func() {
+		_, err := FetchInstallPlan(JoinOptions{ManagementAddress: "localhost:5500"})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+})
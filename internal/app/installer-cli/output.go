@@ -0,0 +1,113 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"encoding/json"
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"gopkg.in/yaml.v2"
+	"io"
+	"strings"
+)
+
+// OutputFormat defines how the result of an operation is reported.
+type OutputFormat string
+
+const (
+	// TextOutput reports the progress and the result of the operation for humans.
+	TextOutput OutputFormat = ""
+	// JSONOutput writes the result of the operation as a JSON document.
+	JSONOutput OutputFormat = "json"
+	// YAMLOutput writes the result of the operation as a YAML document.
+	YAMLOutput OutputFormat = "yaml"
+)
+
+// OutputFormatFromString converts a flag value into an OutputFormat.
+func OutputFormatFromString(value string) (OutputFormat, derrors.Error) {
+	switch OutputFormat(strings.ToLower(value)) {
+	case TextOutput, "text":
+		return TextOutput, nil
+	case JSONOutput:
+		return JSONOutput, nil
+	case YAMLOutput:
+		return YAMLOutput, nil
+	}
+	return TextOutput, derrors.NewInvalidArgumentError("unsupported output format, expecting json or yaml").WithParams(value)
+}
+
+// OperationResult structure with the machine readable result of an install or uninstall.
+type OperationResult struct {
+	// WorkflowID with the identifier of the executed workflow.
+	WorkflowID string `json:"workflow_id" yaml:"workflow_id"`
+	// Operation being performed.
+	Operation string `json:"operation" yaml:"operation"`
+	// State of the workflow once finished.
+	State string `json:"state" yaml:"state"`
+	// Success indicates if the operation succeeded.
+	Success bool `json:"success" yaml:"success"`
+	// Error with the reason of the failure, if any.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Code with the error code of the failure, if known.
+	Code string `json:"code,omitempty" yaml:"code,omitempty"`
+	// Hint with the suggested remediation for the error code.
+	Hint string `json:"hint,omitempty" yaml:"hint,omitempty"`
+	// Duration of the operation.
+	Duration string `json:"duration" yaml:"duration"`
+	// Commands with the status of each executed command.
+	Commands []workflow.CommandStatus `json:"commands" yaml:"commands"`
+	// Objects with the references of the Kubernetes objects created or updated by the commands.
+	Objects []entities.AppliedObject `json:"objects" yaml:"objects"`
+}
+
+// AppliedObjects collects the objects applied by a set of commands in order of execution.
+func AppliedObjects(commands []workflow.CommandStatus) []entities.AppliedObject {
+	objects := make([]entities.AppliedObject, 0)
+	for _, status := range commands {
+		objects = append(objects, status.Objects...)
+	}
+	return objects
+}
+
+// WriteResult writes the result of an operation using the given format.
+func WriteResult(out io.Writer, format OutputFormat, result OperationResult) derrors.Error {
+	return writeDocument(out, format, result)
+}
+
+// writeDocument marshals a value using the given machine readable format.
+func writeDocument(out io.Writer, format OutputFormat, value interface{}) derrors.Error {
+	var content []byte
+	var err error
+	switch format {
+	case JSONOutput:
+		content, err = json.MarshalIndent(value, "", "  ")
+		content = append(content, '\n')
+	case YAMLOutput:
+		content, err = yaml.Marshal(value)
+	default:
+		return derrors.NewInvalidArgumentError("unsupported output format").WithParams(format)
+	}
+	if err != nil {
+		return derrors.NewInternalError("cannot marshal document", err)
+	}
+	if _, err := out.Write(content); err != nil {
+		return derrors.NewInternalError("cannot write document", err)
+	}
+	return nil
+}
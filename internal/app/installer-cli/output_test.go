@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/nalej/installer/internal/pkg/compatibility"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+)
+
+var _ = ginkgo.Describe("Operation result output", func() {
+
+	deployment := entities.AppliedObject{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "nalej", Name: "web"}
+	crd := entities.AppliedObject{APIVersion: "apiextensions.k8s.io/v1", Kind: "CustomResourceDefinition", Name: "certificates.cert-manager.io"}
+	commands := []workflow.CommandStatus{
+		{Index: 0, CommandID: "exec-1", Name: "exec", Success: true, Duration: "1s"},
+		{Index: 1, CommandID: "crds-1", Name: "createCRDs", Success: true, Duration: "1s",
+			Objects: []entities.AppliedObject{crd}},
+		{Index: 2, CommandID: "launch-1", Name: "launchComponents", Success: true, Duration: "1s",
+			Objects: []entities.AppliedObject{deployment}},
+	}
+	result := OperationResult{
+		WorkflowID: "cli-install",
+		Operation:  "Installing management cluster",
+		State:      string(workflow.FinishedState),
+		Success:    true,
+		Duration:   "1m0s",
+		Commands:   commands,
+		Objects:    AppliedObjects(commands),
+	}
+
+	ginkgo.It("should collect the objects applied by the commands", func() {
+		gomega.Expect(result.Objects).To(gomega.Equal([]entities.AppliedObject{crd, deployment}))
+		gomega.Expect(AppliedObjects(nil)).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should parse the output formats", func() {
+		format, err := OutputFormatFromString("JSON")
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(format).To(gomega.Equal(JSONOutput))
+		_, err = OutputFormatFromString("xml")
+		gomega.Expect(err).ToNot(gomega.BeNil())
+	})
+
+	ginkgo.It("should write the result as JSON", func() {
+		out := new(bytes.Buffer)
+		gomega.Expect(WriteResult(out, JSONOutput, result)).To(gomega.BeNil())
+		var retrieved OperationResult
+		gomega.Expect(json.Unmarshal(out.Bytes(), &retrieved)).To(gomega.Succeed())
+		gomega.Expect(retrieved).To(gomega.Equal(result))
+		gomega.Expect(out.String()).To(gomega.ContainSubstring(`"namespace": "nalej"`))
+	})
+
+	ginkgo.It("should write the result as YAML", func() {
+		out := new(bytes.Buffer)
+		gomega.Expect(WriteResult(out, YAMLOutput, result)).To(gomega.BeNil())
+		var retrieved OperationResult
+		gomega.Expect(yaml.Unmarshal(out.Bytes(), &retrieved)).To(gomega.Succeed())
+		gomega.Expect(retrieved).To(gomega.Equal(result))
+	})
+
+	ginkgo.It("should write the compatibility matrix", func() {
+		out := new(bytes.Buffer)
+		gomega.Expect(WriteCompatibility(out, TextOutput, "")).To(gomega.BeNil())
+		gomega.Expect(out.String()).To(gomega.HavePrefix("INSTALLER"))
+
+		out.Reset()
+		gomega.Expect(WriteCompatibility(out, JSONOutput, "")).To(gomega.BeNil())
+		var manifest compatibility.Manifest
+		gomega.Expect(json.Unmarshal(out.Bytes(), &manifest)).To(gomega.Succeed())
+		gomega.Expect(manifest.Releases).NotTo(gomega.BeEmpty())
+	})
+	ginkgo.It("should write the changes of a diff", func() {
+		report := &k8s.DiffReport{Objects: []k8s.ObjectDiff{
+			{ObjectReference: k8s.ObjectReference{Kind: "ConfigMap", Namespace: "nalej", Name: "config"},
+				Component: "1.configmap.yaml", Action: k8s.DiffUpdate,
+				Changes: []k8s.FieldChange{{Path: "data.key", Old: "a", New: "b"}}},
+			{ObjectReference: k8s.ObjectReference{Kind: "Service", Namespace: "nalej", Name: "web"},
+				Component: "2.service.yaml", Action: k8s.DiffUnchanged},
+		}}
+		out := new(bytes.Buffer)
+		gomega.Expect(WriteDiff(out, TextOutput, report, false)).To(gomega.BeNil())
+		gomega.Expect(out.String()).To(gomega.Equal("~ update configmap nalej/config (1.configmap.yaml)\n" +
+			"    data.key\n      - \"a\"\n      + \"b\"\n" +
+			"0 to create, 1 to update, 0 to prune, 1 unchanged\n"))
+
+		out.Reset()
+		gomega.Expect(WriteDiff(out, JSONOutput, report, true)).To(gomega.BeNil())
+		var retrieved k8s.DiffReport
+		gomega.Expect(json.Unmarshal(out.Bytes(), &retrieved)).To(gomega.Succeed())
+		gomega.Expect(retrieved.Objects).To(gomega.HaveLen(2))
+	})
+})
@@ -0,0 +1,42 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"io"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+)
+
+// WritePurge writes the objects removed by a purge as text or using a machine readable format.
+//   params:
+//     out The writer receiving the objects.
+//     format The output format.
+//     report The objects removed, or to be removed in a dry run.
+//   returns:
+//     An error if the objects cannot be written.
+func WritePurge(out io.Writer, format OutputFormat, report *k8s.PurgeReport) derrors.Error {
+	if format != TextOutput {
+		return writeDocument(out, format, report)
+	}
+	if _, err := io.WriteString(out, report.String()+"\n"); err != nil {
+		return derrors.NewInternalError("cannot write purge report", err)
+	}
+	return nil
+}
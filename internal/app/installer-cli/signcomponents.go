@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/rs/zerolog/log"
+)
+
+// componentDirs returns the directories under a path that contain component files.
+func componentDirs(root string) ([]string, derrors.Error) {
+	result := make([]string, 0)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		index, iErr := k8s.BuildComponentsIndex(path)
+		if iErr != nil {
+			return iErr
+		}
+		if len(index.Digests) > 0 {
+			result = append(result, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read components directory")
+	}
+	return result, nil
+}
+
+// SignComponents writes the signed index of each directory with components under a path, such as the management
+// and application cluster ones of a release bundle.
+//   params:
+//     componentsPath The root directory of the components.
+//     privateKeyPath The path of the private key.
+//   returns:
+//     The signed directories.
+//     An error if the components cannot be signed.
+func SignComponents(componentsPath string, privateKeyPath string) ([]string, derrors.Error) {
+	privateKey, err := k8s.LoadSigningPrivateKey(privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := componentDirs(componentsPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(dirs) == 0 {
+		return nil, derrors.NewNotFoundError("no components found").WithParams(componentsPath)
+	}
+	for _, dir := range dirs {
+		index, err := k8s.SignComponents(dir, privateKey)
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Str("dir", dir).Int("components", len(index.Digests)).Msg("components signed")
+	}
+	return dirs, nil
+}
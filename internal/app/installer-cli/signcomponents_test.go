@@ -0,0 +1,57 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Sign components", func() {
+
+	ginkgo.It("should sign each directory with components", func() {
+		root, err := ioutil.TempDir("", "bundle")
+		gomega.Expect(err).To(gomega.Succeed())
+		defer os.RemoveAll(root)
+		for _, dir := range []string{"mngt", "appcluster", "docs"} {
+			gomega.Expect(os.MkdirAll(filepath.Join(root, dir), 0755)).To(gomega.Succeed())
+		}
+		gomega.Expect(ioutil.WriteFile(filepath.Join(root, "mngt", "0.yaml"), []byte("kind: ConfigMap"), 0644)).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(filepath.Join(root, "appcluster", "0.yaml.azure"), []byte("kind: Secret"), 0644)).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(filepath.Join(root, "docs", "README.md"), []byte("docs"), 0644)).To(gomega.Succeed())
+		keyPath := filepath.Join(root, "signing.key")
+		publicKeyPath := filepath.Join(root, "signing.pub")
+		gomega.Expect(k8s.GenerateSigningKeys(publicKeyPath, keyPath)).To(gomega.Succeed())
+
+		dirs, sErr := SignComponents(root, keyPath)
+		gomega.Expect(sErr).To(gomega.Succeed())
+		gomega.Expect(dirs).Should(gomega.ConsistOf(filepath.Join(root, "mngt"), filepath.Join(root, "appcluster")))
+
+		publicKey, kErr := k8s.LoadSigningPublicKey(publicKeyPath)
+		gomega.Expect(kErr).To(gomega.Succeed())
+		for _, dir := range dirs {
+			_, lErr := k8s.LoadComponentsIndex(dir, publicKey)
+			gomega.Expect(lErr).To(gomega.Succeed())
+		}
+	})
+})
@@ -0,0 +1,347 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/bundle"
+	"github.com/nalej/installer/internal/pkg/utils"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	k8sYaml "sigs.k8s.io/yaml"
+)
+
+// KubeConfigCheckTimeout is the maximum time to wait for the Kubernetes API when validating a kubeconfig file.
+const KubeConfigCheckTimeout = 10 * time.Second
+
+// hostnameRegex matches valid DNS names.
+var hostnameRegex = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// secretNameRegex matches the characters that cannot be part of the name of a secret.
+var secretNameRegex = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Validator checks a value entered by the user.
+type Validator func(value string) derrors.Error
+
+// RegistryLogin checks the credentials of a registry entered by the user.
+type RegistryLogin func(credentials k8s.RegistryCredentials) derrors.Error
+
+// Prompter structure to interactively ask the user for values.
+type Prompter struct {
+	reader *bufio.Reader
+	out    io.Writer
+}
+
+// NewPrompter creates a Prompter reading the answers from in and writing the questions to out.
+func NewPrompter(in io.Reader, out io.Writer) *Prompter {
+	return &Prompter{reader: bufio.NewReader(in), out: out}
+}
+
+// Ask prompts for a value until a valid one is entered.
+//   params:
+//     question The question to be shown.
+//     defaultValue The value used if the user enters an empty line.
+//     validator The validator of the value, nil to accept any value.
+//   returns:
+//     The value entered by the user.
+//     An error if the input is closed.
+func (p *Prompter) Ask(question string, defaultValue string, validator Validator) (string, derrors.Error) {
+	for {
+		if defaultValue != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, defaultValue)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+		line, err := p.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", derrors.NewUnavailableError("cannot read answer", err)
+		}
+		value := strings.TrimSpace(line)
+		if value == "" {
+			value = defaultValue
+		}
+		if validator == nil {
+			return value, nil
+		}
+		if vErr := validator(value); vErr != nil {
+			fmt.Fprintf(p.out, "invalid value: %s\n", vErr.Error())
+			continue
+		}
+		return value, nil
+	}
+}
+
+// Confirm asks a yes/no question.
+func (p *Prompter) Confirm(question string, defaultValue bool) (bool, derrors.Error) {
+	def := "no"
+	if defaultValue {
+		def = "yes"
+	}
+	value, err := p.Ask(question+" (yes/no)", def, func(value string) derrors.Error {
+		switch strings.ToLower(value) {
+		case "y", "yes", "n", "no":
+			return nil
+		}
+		return derrors.NewInvalidArgumentError("expecting yes or no")
+	})
+	if err != nil {
+		return false, err
+	}
+	return strings.HasPrefix(strings.ToLower(value), "y"), nil
+}
+
+// Choose asks the user to select one of the given options. The comparison is case insensitive.
+func (p *Prompter) Choose(question string, options []string, defaultValue string) (string, derrors.Error) {
+	value, err := p.Ask(fmt.Sprintf("%s (%s)", question, strings.Join(options, ", ")), defaultValue,
+		func(value string) derrors.Error {
+			for _, option := range options {
+				if strings.EqualFold(option, value) {
+					return nil
+				}
+			}
+			return derrors.NewInvalidArgumentError("unsupported option").WithParams(value)
+		})
+	if err != nil {
+		return "", err
+	}
+	for _, option := range options {
+		if strings.EqualFold(option, value) {
+			return option, nil
+		}
+	}
+	return value, nil
+}
+
+// ValidNotEmpty checks that a value has been entered.
+func ValidNotEmpty(value string) derrors.Error {
+	if value == "" {
+		return derrors.NewInvalidArgumentError("value cannot be empty")
+	}
+	return nil
+}
+
+// ValidHost checks that a value is a valid hostname or IP address.
+func ValidHost(value string) derrors.Error {
+	if net.ParseIP(value) != nil || (len(value) <= 253 && hostnameRegex.MatchString(value)) {
+		return nil
+	}
+	return derrors.NewInvalidArgumentError("expecting a hostname or an IP address").WithParams(value)
+}
+
+// ValidIP checks that a value is a valid IP address.
+func ValidIP(value string) derrors.Error {
+	if net.ParseIP(value) == nil {
+		return derrors.NewInvalidArgumentError("expecting an IP address").WithParams(value)
+	}
+	return nil
+}
+
+// ValidIPList checks that a value is a list of IP addresses separated by comma.
+func ValidIPList(value string) derrors.Error {
+	if err := ValidNotEmpty(value); err != nil {
+		return err
+	}
+	for _, ip := range strings.Split(value, ",") {
+		if err := ValidIP(strings.TrimSpace(ip)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidRegistryURL checks that a value is the host of a registry, with an optional port and path, such as
+// registry.example.com:5000/nalej.
+func ValidRegistryURL(value string) derrors.Error {
+	if err := ValidNotEmpty(value); err != nil {
+		return err
+	}
+	if strings.Contains(value, "://") {
+		return derrors.NewInvalidArgumentError("the registry must be set without scheme").WithParams(value)
+	}
+	host := registryHost(value)
+	if name, port, err := net.SplitHostPort(host); err == nil {
+		if number, err := strconv.Atoi(port); err != nil || number <= 0 || number > 65535 {
+			return derrors.NewInvalidArgumentError("expecting a port number").WithParams(value)
+		}
+		host = name
+	}
+	return ValidHost(host)
+}
+
+// registryHost returns the host of a registry URL, removing its path.
+func registryHost(value string) string {
+	return strings.SplitN(value, "/", 2)[0]
+}
+
+// ValidRegistryLogin checks that the credentials are accepted by the registry.
+func ValidRegistryLogin(credentials k8s.RegistryCredentials) derrors.Error {
+	fetcher := bundle.NewFetcher(bundle.Credentials{Username: credentials.Username, Password: credentials.Password})
+	return fetcher.Login(registryHost(credentials.URL))
+}
+
+// RegistrySecretName returns the name of the pull secret of a registry, derived from its URL.
+func RegistrySecretName(url string) string {
+	return strings.Trim(secretNameRegex.ReplaceAllString(strings.ToLower(url), "-"), "-")
+}
+
+// AskRegistries prompts for the private registries used to pull the images of the components until an empty URL
+// is entered. The credentials of each registry are checked as they are entered, and asked again if rejected.
+//   params:
+//     login The check of the credentials of a registry.
+//   returns:
+//     The registries entered by the user, nil if none.
+//     An error if the input is closed.
+func (p *Prompter) AskRegistries(login RegistryLogin) (*k8s.RegistriesConfig, derrors.Error) {
+	result := &k8s.RegistriesConfig{Registries: make([]k8s.RegistryCredentials, 0)}
+	for {
+		url, err := p.Ask("Private registry to pull the images from, empty to finish", "", func(value string) derrors.Error {
+			if value == "" {
+				return nil
+			}
+			return ValidRegistryURL(value)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if url == "" {
+			break
+		}
+		credentials := k8s.RegistryCredentials{SecretName: RegistrySecretName(url), URL: url}
+		for {
+			if credentials.Username, err = p.Ask("Username of "+url, credentials.Username, ValidNotEmpty); err != nil {
+				return nil, err
+			}
+			if credentials.Password, err = p.Ask("Password of "+url, "", ValidNotEmpty); err != nil {
+				return nil, err
+			}
+			lErr := login(credentials)
+			if lErr == nil {
+				break
+			}
+			fmt.Fprintf(p.out, "invalid credentials: %s\n", lErr.Error())
+		}
+		result.Registries = append(result.Registries, credentials)
+		if vErr := result.Validate(); vErr != nil {
+			fmt.Fprintf(p.out, "invalid registry: %s\n", vErr.Error())
+			result.Registries = result.Registries[:len(result.Registries)-1]
+		}
+	}
+	if len(result.Registries) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// ValidPath checks that a file or directory exists.
+func ValidPath(value string) derrors.Error {
+	if _, err := os.Stat(utils.GetPath(value)); err != nil {
+		return derrors.NewNotFoundError("path does not exist", err).WithParams(value)
+	}
+	return nil
+}
+
+// ValidComponentsPath checks that the components path exists or refers to a remote components bundle.
+func ValidComponentsPath(value string) derrors.Error {
+	if bundle.IsRemote(value) {
+		if strings.HasPrefix(value, bundle.OCIScheme) {
+			_, err := bundle.ParseReference(value)
+			return err
+		}
+		if !strings.HasPrefix(value, bundle.HTTPSScheme) {
+			return derrors.NewInvalidArgumentError("component bundles must be downloaded through https").WithParams(value)
+		}
+		return nil
+	}
+	return ValidPath(value)
+}
+
+// ValidKubeConfig checks that a kubeconfig file can be used to connect to the Kubernetes API.
+func ValidKubeConfig(value string) derrors.Error {
+	if err := ValidPath(value); err != nil {
+		return err
+	}
+	config, err := clientcmd.BuildConfigFromFlags("", utils.GetPath(value))
+	if err != nil {
+		return derrors.NewInvalidArgumentError("invalid kubeconfig file", err).WithParams(value)
+	}
+	config.Timeout = KubeConfigCheckTimeout
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return derrors.NewInvalidArgumentError("cannot create Kubernetes client", err).WithParams(value)
+	}
+	if _, err := client.Discovery().ServerVersion(); err != nil {
+		return derrors.NewUnavailableError("cannot connect to the Kubernetes API", err).WithParams(config.Host)
+	}
+	return nil
+}
+
+// WriteRegistriesFile writes the registries entered in the wizard to a file that can be used with --registriesPath.
+//   params:
+//     path The path of the registries file.
+//     registries The registries with their credentials.
+//   returns:
+//     An error if the file cannot be written.
+func WriteRegistriesFile(path string, registries *k8s.RegistriesConfig) derrors.Error {
+	content, err := k8sYaml.Marshal(registries)
+	if err != nil {
+		return derrors.NewInternalError("cannot marshal registries", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return derrors.NewInternalError("cannot create registries directory", err).WithParams(path)
+	}
+	// The file contains the credentials of the registries.
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		return derrors.NewInternalError("cannot write registries file", err).WithParams(path)
+	}
+	return nil
+}
+
+// WriteConfigFile writes a configuration file that can be loaded with NewLayeredConfig.
+//   params:
+//     path The path of the configuration file.
+//     values The flag values indexed by flag name.
+//   returns:
+//     An error if the file cannot be written.
+func WriteConfigFile(path string, values map[string]string) derrors.Error {
+	content, err := yaml.Marshal(values)
+	if err != nil {
+		return derrors.NewInternalError("cannot marshal configuration", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return derrors.NewInternalError("cannot create configuration directory", err).WithParams(path)
+	}
+	// The configuration may contain credentials.
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		return derrors.NewInternalError("cannot write configuration file", err).WithParams(path)
+	}
+	return nil
+}
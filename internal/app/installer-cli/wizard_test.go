@@ -0,0 +1,138 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer_cli
+
+import (
+	"bytes"
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var _ = ginkgo.Describe("Install wizard", func() {
+
+	ginkgo.It("should ask until a valid value is entered", func() {
+		out := new(bytes.Buffer)
+		prompter := NewPrompter(strings.NewReader("not an ip\n10.0.0.1\n"), out)
+		value, err := prompter.Ask("IP", "", ValidIP)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(value).To(gomega.Equal("10.0.0.1"))
+		gomega.Expect(out.String()).To(gomega.ContainSubstring("invalid value"))
+	})
+
+	ginkgo.It("should use the default values", func() {
+		prompter := NewPrompter(strings.NewReader("\n\nazure\n"), new(bytes.Buffer))
+		value, err := prompter.Ask("Host", "nalej.com", ValidHost)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(value).To(gomega.Equal("nalej.com"))
+		confirmed, err := prompter.Confirm("Continue?", true)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(confirmed).To(gomega.BeTrue())
+		option, err := prompter.Choose("Platform", []string{"MINIKUBE", "AZURE"}, "MINIKUBE")
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(option).To(gomega.Equal("AZURE"))
+	})
+
+	ginkgo.It("should fail when the input is closed", func() {
+		prompter := NewPrompter(strings.NewReader(""), new(bytes.Buffer))
+		_, err := prompter.Ask("Host", "", ValidHost)
+		gomega.Expect(err).ToNot(gomega.BeNil())
+	})
+
+	ginkgo.It("should validate hosts and IP lists", func() {
+		gomega.Expect(ValidHost("mngt.nalej.com")).To(gomega.BeNil())
+		gomega.Expect(ValidHost("https://nalej.com")).ToNot(gomega.BeNil())
+		gomega.Expect(ValidIPList("10.0.0.1, 10.0.0.2")).To(gomega.BeNil())
+		gomega.Expect(ValidIPList("10.0.0.1,node")).ToNot(gomega.BeNil())
+	})
+
+	ginkgo.It("should accept remote components bundles", func() {
+		gomega.Expect(ValidComponentsPath("oci://registry.nalej.com/nalej/components:v1")).To(gomega.BeNil())
+		gomega.Expect(ValidComponentsPath("https://nalej.com/components.tgz")).To(gomega.BeNil())
+		gomega.Expect(ValidComponentsPath("http://nalej.com/components.tgz")).ToNot(gomega.BeNil())
+		gomega.Expect(ValidComponentsPath("oci://components")).ToNot(gomega.BeNil())
+	})
+
+	ginkgo.It("should validate registry URLs", func() {
+		gomega.Expect(ValidRegistryURL("registry.nalej.com")).To(gomega.BeNil())
+		gomega.Expect(ValidRegistryURL("registry.nalej.com:5000/nalej")).To(gomega.BeNil())
+		gomega.Expect(ValidRegistryURL("https://registry.nalej.com")).ToNot(gomega.BeNil())
+		gomega.Expect(ValidRegistryURL("registry.nalej.com:port")).ToNot(gomega.BeNil())
+		gomega.Expect(ValidRegistryURL("")).ToNot(gomega.BeNil())
+		gomega.Expect(RegistrySecretName("registry.nalej.com:5000/nalej")).To(gomega.Equal("registry-nalej-com-5000-nalej"))
+	})
+
+	ginkgo.It("should ask the registry credentials until the registry accepts them", func() {
+		out := new(bytes.Buffer)
+		input := "https://registry.nalej.com\nregistry.nalej.com:5000/nalej\nnalej\nwrong\n\nsecret\n\n"
+		prompter := NewPrompter(strings.NewReader(input), out)
+		logins := 0
+		registries, err := prompter.AskRegistries(func(credentials k8s.RegistryCredentials) derrors.Error {
+			logins++
+			if credentials.Username != "nalej" || credentials.Password != "secret" {
+				return derrors.NewUnauthenticatedError("registry rejected the credentials")
+			}
+			return nil
+		})
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(logins).To(gomega.Equal(2))
+		gomega.Expect(out.String()).To(gomega.ContainSubstring("invalid value"))
+		gomega.Expect(out.String()).To(gomega.ContainSubstring("invalid credentials"))
+		gomega.Expect(registries.Registries).To(gomega.Equal([]k8s.RegistryCredentials{{
+			SecretName: "registry-nalej-com-5000-nalej", URL: "registry.nalej.com:5000/nalej", Username: "nalej", Password: "secret"}}))
+
+		dir, tErr := ioutil.TempDir("", "installer-cli-wizard")
+		gomega.Expect(tErr).To(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		registriesPath := filepath.Join(dir, "registries.yaml")
+		gomega.Expect(WriteRegistriesFile(registriesPath, registries)).To(gomega.BeNil())
+		path := filepath.Join(dir, "installer-cli.yaml")
+		gomega.Expect(WriteConfigFile(path, map[string]string{"registriesPath": registriesPath})).To(gomega.BeNil())
+		config, lErr := NewLayeredConfig(path, true)
+		gomega.Expect(lErr).To(gomega.BeNil())
+		loaded, lErr := k8s.LoadRegistriesConfig(config.fileValues["registriesPath"])
+		gomega.Expect(lErr).To(gomega.BeNil())
+		gomega.Expect(loaded.Registries).To(gomega.Equal(registries.Registries))
+		info, sErr := os.Stat(registriesPath)
+		gomega.Expect(sErr).To(gomega.Succeed())
+		gomega.Expect(info.Mode().Perm()).To(gomega.Equal(os.FileMode(0600)))
+	})
+
+	ginkgo.It("should not return registries if none is entered", func() {
+		prompter := NewPrompter(strings.NewReader("\n"), new(bytes.Buffer))
+		registries, err := prompter.AskRegistries(func(k8s.RegistryCredentials) derrors.Error { return nil })
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(registries).To(gomega.BeNil())
+	})
+
+	ginkgo.It("should write a configuration file that can be loaded", func() {
+		dir, err := ioutil.TempDir("", "installer-cli-wizard")
+		gomega.Expect(err).To(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "conf", "installer-cli.yaml")
+		gomega.Expect(WriteConfigFile(path, map[string]string{"targetPlatform": "AZURE"})).To(gomega.BeNil())
+		config, lErr := NewLayeredConfig(path, true)
+		gomega.Expect(lErr).To(gomega.BeNil())
+		gomega.Expect(config.fileValues["targetPlatform"]).To(gomega.Equal("AZURE"))
+	})
+})
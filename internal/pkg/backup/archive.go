@@ -0,0 +1,268 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Management cluster backups
+// A backup is a gzipped tar archive with a manifest and one JSON document per exported object. Secrets are
+// encrypted with AES-GCM so the archive can be moved between environments without exposing credentials.
+
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/nalej/derrors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// FormatVersion is the version of the archive layout.
+const FormatVersion = 1
+
+// ManifestFile is the name of the manifest inside the archive.
+const ManifestFile = "manifest.json"
+
+// Directories of the archive containing each type of object.
+const (
+	ConfigMapsDir = "configmaps"
+	SecretsDir    = "secrets"
+	CRDsDir       = "crds"
+)
+
+// encryptedSuffix is appended to the name of the encrypted entries.
+const encryptedSuffix = ".enc"
+
+// Manifest structure describing the content of a backup.
+type Manifest struct {
+	// Version of the archive layout.
+	Version int `json:"version"`
+	// Created with the creation timestamp.
+	Created int64 `json:"created"`
+	// Namespace whose objects were exported.
+	Namespace string `json:"namespace"`
+	// ConfigMaps with the names of the exported config maps.
+	ConfigMaps []string `json:"config_maps"`
+	// Secrets with the names of the exported secrets.
+	Secrets []string `json:"secrets"`
+	// CRDs with the names of the exported custom resource definitions.
+	CRDs []string `json:"crds"`
+}
+
+// Archive structure with the objects of a backup.
+type Archive struct {
+	Manifest   Manifest
+	ConfigMaps []unstructured.Unstructured
+	Secrets    []unstructured.Unstructured
+	CRDs       []unstructured.Unstructured
+}
+
+// NewArchive creates an archive with the objects exported from a namespace.
+func NewArchive(namespace string, configMaps []unstructured.Unstructured, secrets []unstructured.Unstructured, crds []unstructured.Unstructured) *Archive {
+	return &Archive{
+		Manifest: Manifest{
+			Version:    FormatVersion,
+			Created:    time.Now().Unix(),
+			Namespace:  namespace,
+			ConfigMaps: names(configMaps),
+			Secrets:    names(secrets),
+			CRDs:       names(crds),
+		},
+		ConfigMaps: configMaps,
+		Secrets:    secrets,
+		CRDs:       crds,
+	}
+}
+
+// names returns the names of a list of objects.
+func names(objects []unstructured.Unstructured) []string {
+	result := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		result = append(result, obj.GetName())
+	}
+	return result
+}
+
+// entryName returns the name of the archive entry of an object.
+func entryName(dir string, name string, encrypted bool) string {
+	entry := path.Join(dir, name+".json")
+	if encrypted {
+		entry = entry + encryptedSuffix
+	}
+	return entry
+}
+
+// Write writes the archive encrypting the secrets with the given key.
+//   params:
+//     out The writer receiving the gzipped tar archive.
+//     key The key used to encrypt the secrets.
+//   returns:
+//     An error if the archive cannot be written.
+func (a *Archive) Write(out io.Writer, key []byte) derrors.Error {
+	gzipWriter := gzip.NewWriter(out)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	manifest, err := json.MarshalIndent(a.Manifest, "", "  ")
+	if err != nil {
+		return derrors.NewInternalError("cannot marshal backup manifest", err)
+	}
+	if err := writeEntry(tarWriter, ManifestFile, manifest); err != nil {
+		return err
+	}
+	groups := []struct {
+		dir       string
+		objects   []unstructured.Unstructured
+		encrypted bool
+	}{
+		{CRDsDir, a.CRDs, false},
+		{ConfigMapsDir, a.ConfigMaps, false},
+		{SecretsDir, a.Secrets, true},
+	}
+	for _, group := range groups {
+		for _, obj := range group.objects {
+			content, err := obj.MarshalJSON()
+			if err != nil {
+				return derrors.NewInternalError("cannot marshal object", err).WithParams(obj.GetKind(), obj.GetName())
+			}
+			if group.encrypted {
+				sealed, sErr := Encrypt(key, content)
+				if sErr != nil {
+					return sErr
+				}
+				content = sealed
+			}
+			if err := writeEntry(tarWriter, entryName(group.dir, obj.GetName(), group.encrypted), content); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return derrors.NewInternalError("cannot close backup archive", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return derrors.NewInternalError("cannot compress backup archive", err)
+	}
+	return nil
+}
+
+// writeEntry writes a file into the archive.
+func writeEntry(tarWriter *tar.Writer, name string, content []byte) derrors.Error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return derrors.NewInternalError("cannot write backup entry", err).WithParams(name)
+	}
+	if _, err := tarWriter.Write(content); err != nil {
+		return derrors.NewInternalError("cannot write backup entry", err).WithParams(name)
+	}
+	return nil
+}
+
+// ReadArchive reads an archive decrypting its secrets with the given key.
+//   params:
+//     in The reader with the gzipped tar archive.
+//     key The key used to encrypt the secrets.
+//   returns:
+//     The archive.
+//     An error if the archive is not valid or the secrets cannot be decrypted.
+func ReadArchive(in io.Reader, key []byte) (*Archive, derrors.Error) {
+	gzipReader, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("backup archive is not compressed", err)
+	}
+	entries := make(map[string][]byte)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, derrors.NewInvalidArgumentError("cannot read backup archive", err)
+		}
+		content, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			return nil, derrors.NewInvalidArgumentError("cannot read backup entry", err).WithParams(header.Name)
+		}
+		entries[header.Name] = content
+	}
+
+	rawManifest, found := entries[ManifestFile]
+	if !found {
+		return nil, derrors.NewInvalidArgumentError("backup manifest not found")
+	}
+	result := &Archive{}
+	if err := json.Unmarshal(rawManifest, &result.Manifest); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse backup manifest", err)
+	}
+	if result.Manifest.Version != FormatVersion {
+		return nil, derrors.NewInvalidArgumentError("unsupported backup version").WithParams(result.Manifest.Version)
+	}
+
+	var rErr derrors.Error
+	if result.CRDs, rErr = readObjects(entries, CRDsDir, result.Manifest.CRDs, false, key); rErr != nil {
+		return nil, rErr
+	}
+	if result.ConfigMaps, rErr = readObjects(entries, ConfigMapsDir, result.Manifest.ConfigMaps, false, key); rErr != nil {
+		return nil, rErr
+	}
+	if result.Secrets, rErr = readObjects(entries, SecretsDir, result.Manifest.Secrets, true, key); rErr != nil {
+		return nil, rErr
+	}
+	return result, nil
+}
+
+// readObjects parses the objects listed on the manifest, decrypting them if required.
+func readObjects(entries map[string][]byte, dir string, objectNames []string, encrypted bool, key []byte) ([]unstructured.Unstructured, derrors.Error) {
+	result := make([]unstructured.Unstructured, 0, len(objectNames))
+	for _, name := range objectNames {
+		entry := entryName(dir, name, encrypted)
+		content, found := entries[entry]
+		if !found {
+			return nil, derrors.NewInvalidArgumentError("backup entry not found").WithParams(entry)
+		}
+		if encrypted {
+			opened, err := Decrypt(key, content)
+			if err != nil {
+				return nil, err
+			}
+			content = opened
+		}
+		obj := unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(bytes.TrimSpace(content)); err != nil {
+			return nil, derrors.NewInvalidArgumentError("cannot parse backup entry", err).WithParams(entry)
+		}
+		result = append(result, obj)
+	}
+	return result, nil
+}
+
+// String returns a summary of the archive content.
+func (a *Archive) String() string {
+	return fmt.Sprintf("namespace %s: %d config maps, %d secrets, %d CRDs", a.Manifest.Namespace,
+		len(a.ConfigMaps), len(a.Secrets), len(a.CRDs))
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package backup
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newObject(apiVersion string, kind string, name string, namespace string) unstructured.Unstructured {
+	obj := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":            name,
+			"uid":             "a5d2c8e0",
+			"resourceVersion": "1234",
+		},
+	}}
+	if namespace != "" {
+		obj.SetNamespace(namespace)
+	}
+	return obj
+}
+
+var _ = ginkgo.Describe("Backup", func() {
+
+	var key []byte
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		key, err = NewKey()
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should remove the fields set by the server", func() {
+		obj := newObject("v1", "ConfigMap", "cluster-config", "nalej")
+		obj.Object["status"] = map[string]interface{}{"phase": "Active"}
+		Clean(&obj)
+		gomega.Expect(obj.GetUID()).Should(gomega.BeEmpty())
+		gomega.Expect(obj.GetResourceVersion()).Should(gomega.BeEmpty())
+		gomega.Expect(obj.Object).ShouldNot(gomega.HaveKey("status"))
+		gomega.Expect(obj.GetName()).Should(gomega.Equal("cluster-config"))
+	})
+
+	ginkgo.It("should write and read an archive encrypting the secrets", func() {
+		configMap := newObject("v1", "ConfigMap", "cluster-config", "nalej")
+		gomega.Expect(unstructured.SetNestedField(configMap.Object, "mngt.nalej.com", "data", "public_host")).To(gomega.Succeed())
+		secret := newObject("v1", "Secret", "authx-secret", "nalej")
+		gomega.Expect(unstructured.SetNestedField(secret.Object, "c2VjcmV0LXZhbHVl", "data", "secret")).To(gomega.Succeed())
+		crd := newObject("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "servicemonitors.monitoring.coreos.com", "")
+		archive := NewArchive("nalej", []unstructured.Unstructured{configMap}, []unstructured.Unstructured{secret}, []unstructured.Unstructured{crd})
+
+		buffer := &bytes.Buffer{}
+		gomega.Expect(archive.Write(buffer, key)).To(gomega.Succeed())
+		gomega.Expect(buffer.String()).ShouldNot(gomega.ContainSubstring("c2VjcmV0LXZhbHVl"))
+
+		read, err := ReadArchive(bytes.NewReader(buffer.Bytes()), key)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(read.Manifest.Namespace).Should(gomega.Equal("nalej"))
+		gomega.Expect(read.ConfigMaps).Should(gomega.HaveLen(1))
+		gomega.Expect(read.CRDs[0].GetName()).Should(gomega.Equal("servicemonitors.monitoring.coreos.com"))
+		value, _, _ := unstructured.NestedString(read.Secrets[0].Object, "data", "secret")
+		gomega.Expect(value).Should(gomega.Equal("c2VjcmV0LXZhbHVl"))
+	})
+
+	ginkgo.It("should fail to read the secrets with a different key", func() {
+		secret := newObject("v1", "Secret", "authx-secret", "nalej")
+		archive := NewArchive("nalej", nil, []unstructured.Unstructured{secret}, nil)
+		buffer := &bytes.Buffer{}
+		gomega.Expect(archive.Write(buffer, key)).To(gomega.Succeed())
+
+		other, err := NewKey()
+		gomega.Expect(err).To(gomega.Succeed())
+		_, err = ReadArchive(bytes.NewReader(buffer.Bytes()), other)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should generate the key file only if requested", func() {
+		dir, err := ioutil.TempDir("", "backup")
+		gomega.Expect(err).To(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "backup.key")
+
+		_, kErr := LoadKey(path, false)
+		gomega.Expect(kErr).ShouldNot(gomega.Succeed())
+
+		created, kErr := LoadKey(path, true)
+		gomega.Expect(kErr).To(gomega.Succeed())
+		gomega.Expect(created).Should(gomega.HaveLen(KeySize))
+		loaded, kErr := LoadKey(path, false)
+		gomega.Expect(kErr).To(gomega.Succeed())
+		gomega.Expect(loaded).Should(gomega.Equal(created))
+	})
+})
@@ -0,0 +1,187 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package backup
+
+import (
+	"fmt"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// CRDGroup is the API group of the custom resource definitions.
+const CRDGroup = "apiextensions.k8s.io"
+
+// ExcludedSecretTypes contains the types of secrets that are not exported as the cluster issues them.
+var ExcludedSecretTypes = []string{"kubernetes.io/service-account-token"}
+
+// serverFields contains the metadata fields set by the server that cannot be restored on another cluster.
+var serverFields = []string{"uid", "resourceVersion", "selfLink", "creationTimestamp", "generation", "managedFields", "ownerReferences"}
+
+// RestoreResult structure with the objects processed by a restore.
+type RestoreResult struct {
+	// Created with the objects created on the cluster.
+	Created []string
+	// Skipped with the objects that already existed on the cluster.
+	Skipped []string
+}
+
+// Clean removes the fields set by the server so the object can be created on another cluster.
+func Clean(obj *unstructured.Unstructured) {
+	for _, field := range serverFields {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(obj.Object, "status")
+}
+
+// crdVersion returns the version used to read and write custom resource definitions on a cluster.
+func crdVersion(k *k8s.Kubernetes) (string, derrors.Error) {
+	capabilities, err := k.Capabilities()
+	if err != nil {
+		return "", err
+	}
+	if capabilities.Supports(CRDGroup + "/v1") {
+		return "v1", nil
+	}
+	return "v1beta1", nil
+}
+
+// listObjects lists the objects of a resource removing the ones rejected by the filter.
+func listObjects(k *k8s.Kubernetes, namespace string, group string, version string, resource string, include func(obj unstructured.Unstructured) bool) ([]unstructured.Unstructured, derrors.Error) {
+	list, err := k.ListEntities(namespace, group, version, resource)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]unstructured.Unstructured, 0, len(list.Items))
+	for _, item := range list.Items {
+		if !include(item) {
+			log.Debug().Str("resource", resource).Str("name", item.GetName()).Msg("object excluded from backup")
+			continue
+		}
+		Clean(&item)
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// Export creates a backup with the config maps and secrets of a namespace and the custom resource definitions
+// created by the installer, that is, the ones removed on uninstall.
+//   params:
+//     k The connected Kubernetes client.
+//     namespace The namespace to be exported.
+//   returns:
+//     The backup archive.
+//     An error if the objects cannot be retrieved.
+func Export(k *k8s.Kubernetes, namespace string) (*Archive, derrors.Error) {
+	all := func(obj unstructured.Unstructured) bool { return true }
+	configMaps, err := listObjects(k, namespace, "", "v1", "configmaps", all)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := listObjects(k, namespace, "", "v1", "secrets", func(obj unstructured.Unstructured) bool {
+		secretType, _, _ := unstructured.NestedString(obj.Object, "type")
+		return !contains(ExcludedSecretTypes, secretType)
+	})
+	if err != nil {
+		return nil, err
+	}
+	version, err := crdVersion(k)
+	if err != nil {
+		return nil, err
+	}
+	crds, err := listObjects(k, "", CRDGroup, version, "customresourcedefinitions", func(obj unstructured.Unstructured) bool {
+		return !contains(k8s.ExcludedCRDs, obj.GetName())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewArchive(namespace, configMaps, secrets, crds), nil
+}
+
+// Restore creates the objects of a backup on a cluster. Existing objects are not modified.
+//   params:
+//     k The connected Kubernetes client.
+//     archive The backup archive.
+//     namespace The namespace where the objects are restored, the original one if empty.
+//   returns:
+//     The objects created and skipped.
+//     An error if the objects cannot be created.
+func Restore(k *k8s.Kubernetes, archive *Archive, namespace string) (*RestoreResult, derrors.Error) {
+	if namespace == "" {
+		namespace = archive.Manifest.Namespace
+	}
+	if err := k.EnsureNamespace(namespace, k8s.NamespaceOptions{}); err != nil {
+		return nil, err
+	}
+	result := &RestoreResult{Created: make([]string, 0), Skipped: make([]string, 0)}
+
+	version, err := crdVersion(k)
+	if err != nil {
+		return nil, err
+	}
+	for _, crd := range archive.CRDs {
+		if err := restoreObject(k, crd, "", CRDGroup, version, "customresourcedefinitions", result); err != nil {
+			return nil, err
+		}
+	}
+	for _, configMap := range archive.ConfigMaps {
+		if err := restoreObject(k, configMap, namespace, "", "v1", "configmaps", result); err != nil {
+			return nil, err
+		}
+	}
+	for _, secret := range archive.Secrets {
+		if err := restoreObject(k, secret, namespace, "", "v1", "secrets", result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// restoreObject creates an object unless it already exists.
+func restoreObject(k *k8s.Kubernetes, obj unstructured.Unstructured, namespace string, group string, version string, resource string, result *RestoreResult) derrors.Error {
+	restored := obj.DeepCopy()
+	restored.SetNamespace(namespace)
+	Clean(restored)
+	id := fmt.Sprintf("%s/%s", resource, restored.GetName())
+	exists, err := k.ExistsEntity(namespace, group, version, resource, restored.GetName())
+	if err != nil {
+		return err
+	}
+	if exists {
+		log.Info().Str("object", id).Msg("object already exists, skipping")
+		result.Skipped = append(result.Skipped, id)
+		return nil
+	}
+	if err := k.Create(restored); err != nil {
+		return err
+	}
+	result.Created = append(result.Created, id)
+	return nil
+}
+
+// contains checks if a list contains an element.
+func contains(list []string, element string) bool {
+	for _, item := range list {
+		if item == element {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/nalej/derrors"
+)
+
+// KeySize is the size in bytes of the keys used to encrypt the secrets of a backup.
+const KeySize = 32
+
+// NewKey generates a random encryption key.
+func NewKey() ([]byte, derrors.Error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, derrors.NewInternalError("cannot generate backup key", err)
+	}
+	return key, nil
+}
+
+// LoadKey reads a base64 encoded encryption key.
+//   params:
+//     path The path of the key file.
+//     create Whether a new key is generated and written to path if the file does not exist.
+//   returns:
+//     The encryption key.
+//     An error if the key cannot be read or is not valid.
+func LoadKey(path string, create bool) ([]byte, derrors.Error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) || !create {
+			return nil, derrors.NewInvalidArgumentError("cannot read backup key", err).WithParams(path)
+		}
+		key, kErr := NewKey()
+		if kErr != nil {
+			return nil, kErr
+		}
+		encoded := base64.StdEncoding.EncodeToString(key) + "\n"
+		if err := ioutil.WriteFile(path, []byte(encoded), 0600); err != nil {
+			return nil, derrors.NewInternalError("cannot write backup key", err).WithParams(path)
+		}
+		return key, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(key) != KeySize {
+		return nil, derrors.NewInvalidArgumentError("invalid backup key, expecting a base64 encoded 256 bit key").WithParams(path)
+	}
+	return key, nil
+}
+
+// Encrypt seals a content with AES-GCM prefixing the random nonce.
+func Encrypt(key []byte, content []byte) ([]byte, derrors.Error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, derrors.NewInternalError("cannot generate nonce", err)
+	}
+	return aead.Seal(nonce, nonce, content, nil), nil
+}
+
+// Decrypt opens a content sealed by Encrypt.
+func Decrypt(key []byte, content []byte) ([]byte, derrors.Error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) < aead.NonceSize() {
+		return nil, derrors.NewInvalidArgumentError("encrypted content is too short")
+	}
+	nonce, sealed := content[:aead.NonceSize()], content[aead.NonceSize():]
+	result, oErr := aead.Open(nil, nonce, sealed, nil)
+	if oErr != nil {
+		return nil, derrors.NewPermissionDeniedError("cannot decrypt backup secret, check the backup key", oErr)
+	}
+	return result, nil
+}
+
+// newAEAD creates the AES-GCM cipher for a key.
+func newAEAD(key []byte) (cipher.AEAD, derrors.Error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("invalid backup key", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, derrors.NewInternalError("cannot create cipher", err)
+	}
+	return aead, nil
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+// Remote component bundles
+// The components can be published as a gzipped tarball reachable through an https URL or as an OCI artifact
+// pushed to a container registry. The bundle is downloaded, its digest verified and unpacked into the temporal
+// path so it can be used as a regular components directory.
+
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+)
+
+// HTTPSScheme is the prefix of the bundles downloaded from a web server.
+const HTTPSScheme = "https://"
+
+// OCIScheme is the prefix of the bundles stored as OCI artifacts.
+const OCIScheme = "oci://"
+
+// httpScheme is detected to refuse bundles downloaded without TLS.
+const httpScheme = "http://"
+
+// DigestFragment is the URL fragment with the expected digest of an https bundle, as in
+// https://example.com/components.tgz#sha256=<hex>.
+const DigestFragment = "sha256="
+
+// DefaultTimeout of the requests made to download a bundle.
+const DefaultTimeout = 5 * time.Minute
+
+// MaxBundleSize is the maximum size in bytes of a downloaded bundle.
+const MaxBundleSize = 512 * 1024 * 1024
+
+// bundlesDir is the directory inside the temporal path where the bundles are unpacked.
+const bundlesDir = "components"
+
+// IsRemote checks if a components path refers to a bundle that must be downloaded.
+func IsRemote(path string) bool {
+	return strings.HasPrefix(path, HTTPSScheme) || strings.HasPrefix(path, OCIScheme) || strings.HasPrefix(path, httpScheme)
+}
+
+// Credentials to access a bundle.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Fetcher downloads and unpacks component bundles.
+type Fetcher struct {
+	// Client used for the requests.
+	Client *http.Client
+	// Credentials used against the web server or the registry, if any.
+	Credentials Credentials
+}
+
+// NewFetcher creates a fetcher with the default client.
+func NewFetcher(credentials Credentials) *Fetcher {
+	return &Fetcher{
+		Client:      &http.Client{Timeout: DefaultTimeout},
+		Credentials: credentials,
+	}
+}
+
+// Fetch downloads a bundle and unpacks it into the temporal path.
+//   params:
+//     source The https URL or the oci:// reference of the bundle.
+//     tempPath The temporal path where the bundle is unpacked.
+//   returns:
+//     The directory with the components of the bundle.
+//     An error if the bundle cannot be downloaded, verified or unpacked.
+func (f *Fetcher) Fetch(source string, tempPath string) (string, derrors.Error) {
+	if err := os.MkdirAll(tempPath, os.ModePerm); err != nil {
+		return "", derrors.AsError(err, "cannot create temp directory")
+	}
+	archive, err := ioutil.TempFile(tempPath, "bundle-*.tgz")
+	if err != nil {
+		return "", derrors.AsError(err, "cannot create bundle file")
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	var digest string
+	var fErr derrors.Error
+	switch {
+	case strings.HasPrefix(source, HTTPSScheme):
+		digest, fErr = f.fetchURL(source, archive)
+	case strings.HasPrefix(source, OCIScheme):
+		digest, fErr = f.fetchArtifact(source, archive)
+	default:
+		fErr = derrors.NewInvalidArgumentError("component bundles must be downloaded through https or from an OCI registry").WithParams(source)
+	}
+	if fErr != nil {
+		return "", fErr
+	}
+	log.Info().Str("source", source).Str("digest", digest).Msg("component bundle downloaded")
+
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return "", derrors.AsError(err, "cannot read bundle file")
+	}
+	target := filepath.Join(tempPath, bundlesDir, strings.TrimPrefix(digest, "sha256:"))
+	if err := os.RemoveAll(target); err != nil {
+		return "", derrors.AsError(err, "cannot clean bundle directory")
+	}
+	if err := Unpack(archive, target); err != nil {
+		return "", err
+	}
+	return componentsRoot(target), nil
+}
+
+// fetchURL downloads a bundle from a web server, checking the digest set in the URL fragment.
+func (f *Fetcher) fetchURL(source string, out io.Writer) (string, derrors.Error) {
+	url := source
+	expected := ""
+	if index := strings.Index(source, "#"); index != -1 {
+		url = source[:index]
+		fragment := source[index+1:]
+		if !strings.HasPrefix(fragment, DigestFragment) {
+			return "", derrors.NewInvalidArgumentError("unsupported bundle URL fragment, expecting sha256=<digest>").WithParams(fragment)
+		}
+		expected = "sha256:" + strings.ToLower(strings.TrimPrefix(fragment, DigestFragment))
+	}
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", derrors.NewInvalidArgumentError("invalid bundle URL", err).WithParams(url)
+	}
+	if f.Credentials.Username != "" {
+		request.SetBasicAuth(f.Credentials.Username, f.Credentials.Password)
+	}
+	digest, dErr := f.download(request, out)
+	if dErr != nil {
+		return "", dErr
+	}
+	if expected == "" {
+		log.Warn().Str("url", url).Msg("bundle URL does not include the expected digest, content is not verified")
+	} else if digest != expected {
+		return "", derrors.NewPermissionDeniedError("bundle digest does not match").WithParams(url, expected, digest)
+	}
+	return digest, nil
+}
+
+// download writes the body of a request into the output returning its sha256 digest.
+func (f *Fetcher) download(request *http.Request, out io.Writer) (string, derrors.Error) {
+	response, err := f.Client.Do(request)
+	if err != nil {
+		return "", derrors.NewUnavailableError("cannot download bundle", err).WithParams(request.URL.String())
+	}
+	return readBundle(response, out)
+}
+
+// readBundle copies the body of a response into the output returning its sha256 digest.
+func readBundle(response *http.Response, out io.Writer) (string, derrors.Error) {
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", statusError(response, "cannot download bundle")
+	}
+	source := response.Request.URL.String()
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(out, hash), io.LimitReader(response.Body, MaxBundleSize+1))
+	if err != nil {
+		return "", derrors.NewUnavailableError("cannot download bundle", err).WithParams(source)
+	}
+	if written > MaxBundleSize {
+		return "", derrors.NewInvalidArgumentError("bundle exceeds the maximum size").WithParams(source, MaxBundleSize)
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// statusError transforms an unexpected response into an error.
+func statusError(response *http.Response, msg string) derrors.Error {
+	status := fmt.Sprintf("%s %s", response.Request.URL.String(), response.Status)
+	switch response.StatusCode {
+	case http.StatusNotFound:
+		return derrors.NewNotFoundError(msg).WithParams(status)
+	case http.StatusUnauthorized:
+		return derrors.NewUnauthenticatedError(msg).WithParams(status)
+	case http.StatusForbidden:
+		return derrors.NewPermissionDeniedError(msg).WithParams(status)
+	}
+	return derrors.NewUnavailableError(msg).WithParams(status)
+}
+
+// componentsRoot returns the directory of the bundle containing the components. Bundles created from a
+// directory have a single top level entry that is skipped.
+func componentsRoot(dir string) string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return dir
+	}
+	for _, known := range []string{"mngtcluster", "appcluster"} {
+		if entries[0].Name() == known {
+			return dir
+		}
+	}
+	return filepath.Join(dir, entries[0].Name())
+}
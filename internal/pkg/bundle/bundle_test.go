@@ -0,0 +1,240 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// createBundle creates a gzipped tarball with the given entries.
+func createBundle(entries map[string]string) []byte {
+	buffer := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range entries {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		gomega.Expect(tarWriter.WriteHeader(header)).To(gomega.Succeed())
+		_, err := tarWriter.Write([]byte(content))
+		gomega.Expect(err).To(gomega.Succeed())
+	}
+	gomega.Expect(tarWriter.Close()).To(gomega.Succeed())
+	gomega.Expect(gzipWriter.Close()).To(gomega.Succeed())
+	return buffer.Bytes()
+}
+
+func sha256Digest(content []byte) string {
+	hash := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+var _ = ginkgo.Describe("Component bundles", func() {
+
+	var tempPath string
+	bundle := createBundle(map[string]string{
+		"assets/mngtcluster/component.yaml": "kind: ConfigMap",
+		"assets/appcluster/component.yaml":  "kind: Secret",
+	})
+
+	ginkgo.BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "bundle")
+		gomega.Expect(err).To(gomega.Succeed())
+		tempPath = dir
+	})
+
+	ginkgo.AfterEach(func() {
+		os.RemoveAll(tempPath)
+	})
+
+	expectComponents := func(dir string) {
+		content, err := ioutil.ReadFile(filepath.Join(dir, "mngtcluster", "component.yaml"))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(string(content)).To(gomega.Equal("kind: ConfigMap"))
+	}
+
+	ginkgo.It("should detect remote components paths", func() {
+		gomega.Expect(IsRemote("https://example.com/components.tgz")).To(gomega.BeTrue())
+		gomega.Expect(IsRemote("oci://registry.example.com/nalej/components:v1")).To(gomega.BeTrue())
+		gomega.Expect(IsRemote("./assets/")).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should parse OCI references", func() {
+		ref, err := ParseReference("oci://registry.example.com:5000/nalej/components:v1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(ref.Registry).To(gomega.Equal("registry.example.com:5000"))
+		gomega.Expect(ref.Repository).To(gomega.Equal("nalej/components"))
+		gomega.Expect(ref.Reference).To(gomega.Equal("v1"))
+
+		ref, err = ParseReference("oci://registry.example.com/components@" + sha256Digest(bundle))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(ref.IsDigest()).To(gomega.BeTrue())
+
+		ref, err = ParseReference("oci://registry.example.com/components")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(ref.Reference).To(gomega.Equal(DefaultTag))
+
+		_, err = ParseReference("oci://components")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should refuse entries outside the target directory", func() {
+		malicious := createBundle(map[string]string{"../escaped.yaml": "kind: Secret"})
+		err := Unpack(bytes.NewReader(malicious), filepath.Join(tempPath, "target"))
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, sErr := os.Stat(filepath.Join(tempPath, "escaped.yaml"))
+		gomega.Expect(os.IsNotExist(sErr)).To(gomega.BeTrue())
+	})
+
+	ginkgo.Context("downloading from a web server", func() {
+		var server *httptest.Server
+
+		ginkgo.BeforeEach(func() {
+			server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/components.tgz" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write(bundle)
+			}))
+		})
+
+		ginkgo.AfterEach(func() {
+			server.Close()
+		})
+
+		ginkgo.It("should unpack a verified bundle", func() {
+			fetcher := &Fetcher{Client: server.Client()}
+			source := fmt.Sprintf("%s/components.tgz#sha256=%s", server.URL, strings.TrimPrefix(sha256Digest(bundle), "sha256:"))
+			dir, err := fetcher.Fetch(source, tempPath)
+			gomega.Expect(err).To(gomega.Succeed())
+			expectComponents(dir)
+		})
+
+		ginkgo.It("should refuse a bundle with a different digest", func() {
+			fetcher := &Fetcher{Client: server.Client()}
+			source := fmt.Sprintf("%s/components.tgz#sha256=%s", server.URL, strings.Repeat("0", 64))
+			_, err := fetcher.Fetch(source, tempPath)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should fail on missing bundles", func() {
+			fetcher := &Fetcher{Client: server.Client()}
+			_, err := fetcher.Fetch(server.URL+"/missing.tgz", tempPath)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should refuse plain http", func() {
+			fetcher := &Fetcher{Client: server.Client()}
+			_, err := fetcher.Fetch(strings.Replace(server.URL, "https://", "http://", 1)+"/components.tgz", tempPath)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("downloading from a registry", func() {
+		var server *httptest.Server
+		var layerDigest string
+		const token = "registry-token"
+
+		ginkgo.BeforeEach(func() {
+			layerDigest = sha256Digest(bundle)
+			server = httptest.NewTLSServer(nil)
+			manifest, err := json.Marshal(Manifest{
+				SchemaVersion: 2,
+				MediaType:     OCIManifestMediaType,
+				Layers: []Descriptor{
+					{MediaType: BundleLayerMediaType, Digest: layerDigest, Size: int64(len(bundle))},
+				},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/token" {
+					if username, password, found := r.BasicAuth(); found && (username != "nalej" || password != "secret") {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					json.NewEncoder(w).Encode(tokenResponse{Token: token})
+					return
+				}
+				if r.Header.Get("Authorization") != "Bearer "+token {
+					w.Header().Set("WWW-Authenticate",
+						fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:nalej/components:pull"`, server.URL))
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				switch r.URL.Path {
+				case "/v2/":
+					w.WriteHeader(http.StatusOK)
+				case "/v2/nalej/components/manifests/v1", "/v2/nalej/components/manifests/" + sha256Digest(manifest):
+					w.Header().Set("Content-Type", OCIManifestMediaType)
+					w.Write(manifest)
+				case "/v2/nalej/components/blobs/" + layerDigest:
+					w.Write(bundle)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			})
+		})
+
+		ginkgo.AfterEach(func() {
+			server.Close()
+		})
+
+		ginkgo.It("should unpack the bundle layer of an artifact", func() {
+			fetcher := &Fetcher{Client: server.Client()}
+			source := fmt.Sprintf("%s%s/nalej/components:v1", OCIScheme, strings.TrimPrefix(server.URL, HTTPSScheme))
+			dir, err := fetcher.Fetch(source, tempPath)
+			gomega.Expect(err).To(gomega.Succeed())
+			expectComponents(dir)
+		})
+
+		ginkgo.It("should refuse a manifest with a different digest", func() {
+			fetcher := &Fetcher{Client: server.Client()}
+			source := fmt.Sprintf("%s%s/nalej/components@sha256:%s", OCIScheme, strings.TrimPrefix(server.URL, HTTPSScheme), strings.Repeat("0", 64))
+			_, err := fetcher.Fetch(source, tempPath)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should check the credentials of the registry", func() {
+			registry := strings.TrimPrefix(server.URL, HTTPSScheme)
+			fetcher := &Fetcher{Client: server.Client(), Credentials: Credentials{Username: "nalej", Password: "secret"}}
+			gomega.Expect(fetcher.Login(registry)).To(gomega.Succeed())
+			fetcher.Credentials.Password = "wrong"
+			gomega.Expect(fetcher.Login(registry)).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should fail on missing artifacts", func() {
+			fetcher := &Fetcher{Client: server.Client()}
+			source := fmt.Sprintf("%s%s/nalej/missing:v1", OCIScheme, strings.TrimPrefix(server.URL, HTTPSScheme))
+			_, err := fetcher.Fetch(source, tempPath)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+})
@@ -0,0 +1,308 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nalej/derrors"
+)
+
+// Media types accepted for the manifest of a bundle.
+const (
+	OCIManifestMediaType    = "application/vnd.oci.image.manifest.v1+json"
+	DockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// BundleLayerMediaType is the recommended media type of the layer containing the components.
+const BundleLayerMediaType = "application/vnd.nalej.components.v1.tar+gzip"
+
+// DefaultTag used when the reference does not include a tag or a digest.
+const DefaultTag = "latest"
+
+// maxManifestSize is the maximum size in bytes of a manifest.
+const maxManifestSize = 4 * 1024 * 1024
+
+// Reference to an artifact stored in a registry.
+type Reference struct {
+	// Registry with the host and optionally the port of the registry.
+	Registry string
+	// Repository inside the registry.
+	Repository string
+	// Tag or digest of the artifact.
+	Reference string
+}
+
+// ParseReference parses a reference with the oci://registry/repository[:tag|@digest] format.
+func ParseReference(source string) (*Reference, derrors.Error) {
+	ref := strings.TrimPrefix(source, OCIScheme)
+	slash := strings.Index(ref, "/")
+	if slash <= 0 || slash == len(ref)-1 {
+		return nil, derrors.NewInvalidArgumentError("invalid OCI reference, expecting oci://registry/repository:tag").WithParams(source)
+	}
+	result := &Reference{Registry: ref[:slash], Reference: DefaultTag}
+	repository := ref[slash+1:]
+	if at := strings.Index(repository, "@"); at != -1 {
+		result.Reference = repository[at+1:]
+		repository = repository[:at]
+		if !strings.HasPrefix(result.Reference, "sha256:") {
+			return nil, derrors.NewInvalidArgumentError("only sha256 digests are supported").WithParams(source)
+		}
+	} else if colon := strings.LastIndex(repository, ":"); colon != -1 {
+		result.Reference = repository[colon+1:]
+		repository = repository[:colon]
+	}
+	if repository == "" || result.Reference == "" {
+		return nil, derrors.NewInvalidArgumentError("invalid OCI reference, expecting oci://registry/repository:tag").WithParams(source)
+	}
+	result.Repository = repository
+	return result, nil
+}
+
+// IsDigest checks if the reference points to an immutable digest.
+func (r *Reference) IsDigest() bool {
+	return strings.HasPrefix(r.Reference, "sha256:")
+}
+
+// String returns the reference without the scheme.
+func (r *Reference) String() string {
+	if r.IsDigest() {
+		return fmt.Sprintf("%s/%s@%s", r.Registry, r.Repository, r.Reference)
+	}
+	return fmt.Sprintf("%s/%s:%s", r.Registry, r.Repository, r.Reference)
+}
+
+// endpoint returns the URL of a resource of the repository.
+func (r *Reference) endpoint(resource string, name string) string {
+	return fmt.Sprintf("https://%s/v2/%s/%s/%s", r.Registry, r.Repository, resource, name)
+}
+
+// Descriptor of the content referenced by a manifest.
+type Descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// Manifest of an artifact.
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// BundleLayer returns the layer containing the components. It is either the layer with the bundle media
+// type or the only gzipped tarball of the manifest.
+func (m *Manifest) BundleLayer() (*Descriptor, derrors.Error) {
+	var candidates []Descriptor
+	for _, layer := range m.Layers {
+		if layer.MediaType == BundleLayerMediaType {
+			return &layer, nil
+		}
+		if strings.HasSuffix(layer.MediaType, "tar+gzip") || strings.HasSuffix(layer.MediaType, "tar.gzip") {
+			candidates = append(candidates, layer)
+		}
+	}
+	if len(candidates) != 1 {
+		return nil, derrors.NewInvalidArgumentError("cannot determine the layer with the components").WithParams(len(m.Layers))
+	}
+	return &candidates[0], nil
+}
+
+// fetchArtifact downloads the layer with the components of an OCI artifact verifying its digest.
+func (f *Fetcher) fetchArtifact(source string, out io.Writer) (string, derrors.Error) {
+	ref, err := ParseReference(source)
+	if err != nil {
+		return "", err
+	}
+	manifest, err := f.fetchManifest(ref)
+	if err != nil {
+		return "", err
+	}
+	layer, err := manifest.BundleLayer()
+	if err != nil {
+		return "", err.WithParams(ref.String())
+	}
+	if layer.Size > MaxBundleSize {
+		return "", derrors.NewInvalidArgumentError("bundle exceeds the maximum size").WithParams(ref.String(), layer.Size)
+	}
+	request, rErr := http.NewRequest(http.MethodGet, ref.endpoint("blobs", layer.Digest), nil)
+	if rErr != nil {
+		return "", derrors.NewInvalidArgumentError("invalid OCI reference", rErr).WithParams(ref.String())
+	}
+	response, err := f.authorizedRequest(request)
+	if err != nil {
+		return "", err
+	}
+	digest, err := readBundle(response, out)
+	if err != nil {
+		return "", err
+	}
+	if digest != layer.Digest {
+		return "", derrors.NewPermissionDeniedError("bundle digest does not match").WithParams(ref.String(), layer.Digest, digest)
+	}
+	return digest, nil
+}
+
+// fetchManifest retrieves the manifest of an artifact. Manifests requested by digest are verified.
+func (f *Fetcher) fetchManifest(ref *Reference) (*Manifest, derrors.Error) {
+	request, err := http.NewRequest(http.MethodGet, ref.endpoint("manifests", ref.Reference), nil)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("invalid OCI reference", err).WithParams(ref.String())
+	}
+	request.Header.Set("Accept", strings.Join([]string{OCIManifestMediaType, DockerManifestMediaType}, ", "))
+	response, dErr := f.authorizedRequest(request)
+	if dErr != nil {
+		return nil, dErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, statusError(response, "cannot retrieve bundle manifest")
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(response.Body, maxManifestSize))
+	if err != nil {
+		return nil, derrors.NewUnavailableError("cannot retrieve bundle manifest", err).WithParams(ref.String())
+	}
+	if ref.IsDigest() {
+		hash := sha256.Sum256(content)
+		if digest := "sha256:" + hex.EncodeToString(hash[:]); digest != ref.Reference {
+			return nil, derrors.NewPermissionDeniedError("manifest digest does not match").WithParams(ref.String(), digest)
+		}
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse bundle manifest", err).WithParams(ref.String())
+	}
+	return manifest, nil
+}
+
+// Login checks that the credentials of the fetcher are accepted by a registry.
+//   params:
+//     registry The host of the registry, with its port if it is not the default one.
+//   returns:
+//     An error if the registry cannot be contacted or rejects the credentials.
+func (f *Fetcher) Login(registry string) derrors.Error {
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/v2/", registry), nil)
+	if err != nil {
+		return derrors.NewInvalidArgumentError("invalid registry", err).WithParams(registry)
+	}
+	response, rErr := f.authorizedRequest(request)
+	if rErr != nil {
+		return rErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return statusError(response, "registry rejected the credentials")
+	}
+	return nil
+}
+
+// authorizedRequest sends a request to the registry. If the registry answers with a bearer challenge, a token
+// is requested to the authorization service and set on the request before sending it again.
+func (f *Fetcher) authorizedRequest(request *http.Request) (*http.Response, derrors.Error) {
+	if f.Credentials.Username != "" && request.Header.Get("Authorization") == "" {
+		request.SetBasicAuth(f.Credentials.Username, f.Credentials.Password)
+	}
+	response, err := f.Client.Do(request)
+	if err != nil {
+		return nil, derrors.NewUnavailableError("cannot contact registry", err).WithParams(request.URL.Host)
+	}
+	if response.StatusCode != http.StatusUnauthorized {
+		return response, nil
+	}
+	challenge := response.Header.Get("WWW-Authenticate")
+	response.Body.Close()
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, derrors.NewUnauthenticatedError("registry requires authentication").WithParams(request.URL.Host)
+	}
+	token, tErr := f.requestToken(parseChallenge(challenge[len("bearer "):]))
+	if tErr != nil {
+		return nil, tErr
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err = f.Client.Do(request)
+	if err != nil {
+		return nil, derrors.NewUnavailableError("cannot contact registry", err).WithParams(request.URL.Host)
+	}
+	return response, nil
+}
+
+// parseChallenge parses the parameters of a WWW-Authenticate header.
+func parseChallenge(challenge string) map[string]string {
+	result := make(map[string]string)
+	for _, param := range strings.Split(challenge, ",") {
+		parts := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(parts) == 2 {
+			result[strings.ToLower(parts[0])] = strings.Trim(parts[1], "\"")
+		}
+	}
+	return result
+}
+
+// tokenResponse is the answer of the registry authorization service.
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+// requestToken obtains a bearer token for the challenge of the registry.
+func (f *Fetcher) requestToken(challenge map[string]string) (string, derrors.Error) {
+	realm, found := challenge["realm"]
+	if !found || !strings.HasPrefix(realm, HTTPSScheme) {
+		return "", derrors.NewUnauthenticatedError("registry authentication realm must use https").WithParams(realm)
+	}
+	query := url.Values{}
+	for _, key := range []string{"service", "scope"} {
+		if value, found := challenge[key]; found {
+			query.Set(key, value)
+		}
+	}
+	request, err := http.NewRequest(http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", derrors.NewInvalidArgumentError("invalid registry authentication realm", err).WithParams(realm)
+	}
+	if f.Credentials.Username != "" {
+		request.SetBasicAuth(f.Credentials.Username, f.Credentials.Password)
+	}
+	response, err := f.Client.Do(request)
+	if err != nil {
+		return "", derrors.NewUnavailableError("cannot contact registry authentication service", err).WithParams(realm)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", statusError(response, "cannot obtain registry token")
+	}
+	token := tokenResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", derrors.NewInvalidArgumentError("cannot parse registry token", err).WithParams(realm)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	if token.AccessToken != "" {
+		return token.AccessToken, nil
+	}
+	return "", derrors.NewUnauthenticatedError("registry did not return a token").WithParams(realm)
+}
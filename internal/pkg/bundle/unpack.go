@@ -0,0 +1,100 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+)
+
+// Unpack extracts a gzipped tarball into a directory. Only directories and regular files are extracted,
+// entries pointing outside the target directory are refused.
+//   params:
+//     in The reader with the gzipped tarball.
+//     target The directory where the content is extracted.
+//   returns:
+//     An error if the tarball is not valid or cannot be extracted.
+func Unpack(in io.Reader, target string) derrors.Error {
+	target = filepath.Clean(target)
+	gzipReader, err := gzip.NewReader(in)
+	if err != nil {
+		return derrors.NewInvalidArgumentError("bundle is not a gzipped tarball", err)
+	}
+	defer gzipReader.Close()
+	if err := os.MkdirAll(target, os.ModePerm); err != nil {
+		return derrors.AsError(err, "cannot create bundle directory")
+	}
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return derrors.NewInvalidArgumentError("cannot read bundle", err)
+		}
+		destination, dErr := entryPath(target, header.Name)
+		if dErr != nil {
+			return dErr
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(destination, os.ModePerm); err != nil {
+				return derrors.AsError(err, "cannot create bundle directory")
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := writeFile(destination, tarReader); err != nil {
+				return err
+			}
+		default:
+			log.Warn().Str("entry", header.Name).Msg("skipping bundle entry that is not a file or a directory")
+		}
+	}
+}
+
+// entryPath returns the path where an entry is extracted checking that it remains inside the target.
+func entryPath(target string, name string) (string, derrors.Error) {
+	destination := filepath.Join(target, filepath.FromSlash(name))
+	if destination != target && !strings.HasPrefix(destination, target+string(os.PathSeparator)) {
+		return "", derrors.NewPermissionDeniedError("bundle entry outside the target directory").WithParams(name)
+	}
+	return destination, nil
+}
+
+// writeFile writes the content of an entry.
+func writeFile(destination string, content io.Reader) derrors.Error {
+	if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+		return derrors.AsError(err, "cannot create bundle directory")
+	}
+	file, err := os.OpenFile(destination, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return derrors.AsError(err, "cannot create bundle file")
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, content); err != nil {
+		return derrors.AsError(err, "cannot write bundle file")
+	}
+	return nil
+}
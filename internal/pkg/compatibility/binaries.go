@@ -0,0 +1,169 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the manifest of the binaries staged in the binary path, such as rke or istioctl, with the
+// versions and checksums expected by the install.
+
+package compatibility
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/utils"
+)
+
+// BinariesManifestFile is the file of the binary path that declares the expected binaries.
+const BinariesManifestFile = "binaries.json"
+
+// binaryVersionTimeout is the maximum time for a binary to report its version.
+const binaryVersionTimeout = 30 * time.Second
+
+// hostPlatform is the platform whose checksums are verified, as os-arch.
+var hostPlatform = runtime.GOOS + "-" + runtime.GOARCH
+
+// Binary with the expected version and checksums of a binary.
+type Binary struct {
+	// Name of the binary, looked up with the naming of the host platform.
+	Name string `json:"name" yaml:"name"`
+	// Version expected in the output of the binary when run with VersionArgs.
+	Version string `json:"version" yaml:"version"`
+	// VersionArgs with the arguments printing the version, such as --version. The version is not run if empty.
+	VersionArgs []string `json:"version_args" yaml:"version_args"`
+	// SHA256 with the checksums of the binary by platform, such as linux-amd64.
+	SHA256 map[string]string `json:"sha256" yaml:"sha256"`
+}
+
+// BinariesManifest with the binaries expected by the install.
+type BinariesManifest struct {
+	Binaries []Binary `json:"binaries" yaml:"binaries"`
+}
+
+// ParseBinariesManifest parses the content of a binaries manifest.
+func ParseBinariesManifest(content []byte) (*BinariesManifest, derrors.Error) {
+	manifest := &BinariesManifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse binaries manifest", err)
+	}
+	for _, binary := range manifest.Binaries {
+		if binary.Name == "" {
+			return nil, derrors.NewInvalidArgumentError("binaries in the manifest must have a name")
+		}
+	}
+	return manifest, nil
+}
+
+// LoadBinariesManifest reads a binaries manifest.
+//   params:
+//     path The path of the manifest.
+//   returns:
+//     The manifest, nil if the file does not exist.
+//     An error if the manifest cannot be read or parsed.
+func LoadBinariesManifest(path string) (*BinariesManifest, derrors.Error) {
+	if !fileExists(path) {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read binaries manifest")
+	}
+	return ParseBinariesManifest(content)
+}
+
+// Verify checks the binaries of the manifest found in a set of directories.
+//   params:
+//     dirs The directories where the binaries are looked up, in order.
+//   returns:
+//     The description of each binary that is missing or does not match the manifest, empty if all of them match.
+func (m *BinariesManifest) Verify(dirs ...string) []string {
+	issues := make([]string, 0)
+	for _, binary := range m.Binaries {
+		if issue := binary.verify(dirs); issue != "" {
+			issues = append(issues, fmt.Sprintf("%s %s", binary.Name, issue))
+		}
+	}
+	return issues
+}
+
+// verify checks a binary, returning the description of the mismatch or an empty string if it matches.
+func (b *Binary) verify(dirs []string) string {
+	path, found := b.find(dirs)
+	if !found {
+		return fmt.Sprintf("not found in %s", strings.Join(dirs, ", "))
+	}
+	expected, exists := b.SHA256[hostPlatform]
+	if !exists {
+		return fmt.Sprintf("has no checksum for %s in the manifest", hostPlatform)
+	}
+	checksum, err := fileChecksum(path)
+	if err != nil {
+		return fmt.Sprintf("cannot be read: %s", err.Error())
+	}
+	if !strings.EqualFold(checksum, expected) {
+		return fmt.Sprintf("at %s does not match version %s, expecting sha256 %s, found %s", path, b.Version, expected, checksum)
+	}
+	if len(b.VersionArgs) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), binaryVersionTimeout)
+		defer cancel()
+		output, err := exec.CommandContext(ctx, path, b.VersionArgs...).CombinedOutput()
+		if err != nil {
+			return fmt.Sprintf("at %s cannot report its version: %s", path, err.Error())
+		}
+		if !strings.Contains(string(output), b.Version) {
+			return fmt.Sprintf("at %s is not version %s: %s", path, b.Version, strings.TrimSpace(string(output)))
+		}
+	}
+	return ""
+}
+
+// find looks for the binary of the host platform in the directories.
+func (b *Binary) find(dirs []string) (string, bool) {
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if path, found := utils.PlatformBinary(dir, b.Name); found {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// fileChecksum calculates the SHA256 checksum of a file.
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package compatibility
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("The binaries manifest", func() {
+
+	var binDir string
+	var checksum string
+
+	manifest := func(sha string) *BinariesManifest {
+		content := fmt.Sprintf(`{"binaries": [{"name": "rke", "version": "v1.0.4", "sha256": {%q: %q}}]}`, hostPlatform, sha)
+		result, err := ParseBinariesManifest([]byte(content))
+		gomega.Expect(err).To(gomega.Succeed())
+		return result
+	}
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		binDir, err = ioutil.TempDir("", "binaries")
+		gomega.Expect(err).To(gomega.Succeed())
+		content := []byte("rke v1.0.4")
+		gomega.Expect(ioutil.WriteFile(filepath.Join(binDir, "rke"), content, 0755)).To(gomega.Succeed())
+		sum := sha256.Sum256(content)
+		checksum = hex.EncodeToString(sum[:])
+	})
+
+	ginkgo.AfterEach(func() {
+		gomega.Expect(os.RemoveAll(binDir)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should accept the binaries matching their checksum", func() {
+		gomega.Expect(manifest(checksum).Verify(binDir)).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should report the binaries of another version", func() {
+		issues := manifest("0000").Verify(binDir)
+		gomega.Expect(issues).To(gomega.HaveLen(1))
+		gomega.Expect(issues[0]).To(gomega.ContainSubstring("does not match version v1.0.4"))
+	})
+
+	ginkgo.It("should report the missing binaries", func() {
+		issues := manifest(checksum).Verify(filepath.Join(binDir, "missing"))
+		gomega.Expect(issues).To(gomega.HaveLen(1))
+		gomega.Expect(issues[0]).To(gomega.ContainSubstring("not found"))
+	})
+
+	ginkgo.It("should skip the check if there is no manifest", func() {
+		result, err := LoadBinariesManifest(filepath.Join(binDir, BinariesManifestFile))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result).To(gomega.BeNil())
+		_, err = ParseBinariesManifest([]byte(`{"binaries": [{"version": "v1.0.4"}]}`))
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+})
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package compatibility
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/utils"
+)
+
+// PlatformVersionFile is the file at the root of the components path that contains the version of the platform.
+const PlatformVersionFile = "VERSION"
+
+// istioVersionTimeout is the maximum time to obtain the version of istioctl.
+const istioVersionTimeout = 30 * time.Second
+
+// istioVersionRegex matches the version reported by istioctl.
+var istioVersionRegex = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+
+// Level of an issue found by the check.
+type Level string
+
+const (
+	// WarningLevel issues do not prevent the install from starting.
+	WarningLevel Level = "warning"
+	// ErrorLevel issues refer to unsupported combinations and prevent the install from starting.
+	ErrorLevel Level = "error"
+)
+
+// Versions found in the environment of an install.
+type Versions struct {
+	// Installer with the version of the running installer.
+	Installer string
+	// Platform with the version of the platform components being installed.
+	Platform string
+	// Kubernetes with the version of the target cluster.
+	Kubernetes string
+	// Istio with the version of Istio, empty if Istio is not used.
+	Istio string
+}
+
+// Issue found while checking the versions.
+type Issue struct {
+	Level     Level
+	Component string
+	Message   string
+}
+
+// String returns the issue in a human readable format.
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s %s", i.Level, i.Component, i.Message)
+}
+
+// Report with the result of a compatibility check.
+type Report struct {
+	Issues []Issue
+}
+
+// Supported checks if no unsupported combination has been found.
+func (r Report) Supported() bool {
+	for _, issue := range r.Issues {
+		if issue.Level == ErrorLevel {
+			return false
+		}
+	}
+	return true
+}
+
+// Messages returns the issues of a given level.
+func (r Report) Messages(level Level) []string {
+	result := make([]string, 0)
+	for _, issue := range r.Issues {
+		if issue.Level == level {
+			result = append(result, fmt.Sprintf("%s %s", issue.Component, issue.Message))
+		}
+	}
+	return result
+}
+
+func (r *Report) add(level Level, component string, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{Level: level, Component: component, Message: fmt.Sprintf(format, args...)})
+}
+
+// Check verifies the versions against the release of the installer. Unknown installer versions, such as the ones of
+// development builds, and versions that cannot be detected produce warnings, while unsupported versions produce errors.
+func (m *Manifest) Check(versions Versions) Report {
+	report := Report{}
+	release, found := m.Release(versions.Installer)
+	if !found {
+		report.add(WarningLevel, "installer", "version %q is not part of the compatibility manifest", versions.Installer)
+		return report
+	}
+	if versions.Platform == "" {
+		report.add(WarningLevel, "platform", "version cannot be detected")
+	} else if !inSeries(versions.Platform, release.Platform) {
+		report.add(ErrorLevel, "platform", "version %s is not supported, expecting %s", versions.Platform, strings.Join(release.Platform, ", "))
+	}
+	if versions.Kubernetes == "" {
+		report.add(WarningLevel, "kubernetes", "version cannot be detected")
+	} else if !release.Kubernetes.Contains(versions.Kubernetes) {
+		report.add(ErrorLevel, "kubernetes", "version %s is not supported, expecting %s", versions.Kubernetes, release.Kubernetes.String())
+	}
+	if versions.Istio != "" && !inSeries(versions.Istio, release.Istio) {
+		report.add(ErrorLevel, "istio", "version %s is not supported, expecting %s", versions.Istio, strings.Join(release.Istio, ", "))
+	}
+	return report
+}
+
+// DetectPlatformVersion reads the version of the platform from the components path. An empty version is returned if
+// the components do not contain the version file.
+func DetectPlatformVersion(componentsPath string) (string, derrors.Error) {
+	path := filepath.Join(componentsPath, PlatformVersionFile)
+	if !fileExists(path) {
+		return "", nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", derrors.AsError(err, "cannot read platform version")
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// DetectIstioVersion obtains the version of the istioctl binary of the host platform found in the given directory. An
+// empty version is returned if there is no binary for the host platform, as istioctl is then run in a container.
+func DetectIstioVersion(istioPath string) (string, derrors.Error) {
+	istioctl, found := utils.PlatformBinary(istioPath, "istioctl")
+	if !found {
+		return "", nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), istioVersionTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, istioctl, "version", "--remote=false").Output()
+	if err != nil {
+		return "", derrors.NewInternalError("cannot obtain istioctl version", err).WithParams(istioPath)
+	}
+	version := istioVersionRegex.FindString(string(output))
+	if version == "" {
+		return "", derrors.NewInternalError("cannot parse istioctl version").WithParams(string(output))
+	}
+	return version, nil
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package compatibility
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Compatibility", func() {
+
+	var manifest *Manifest
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		manifest, err = LoadManifest("")
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should compare major.minor versions", func() {
+		gomega.Expect(CompareSeries("v1.15.3", "1.15")).To(gomega.Equal(0))
+		gomega.Expect(CompareSeries("1.16.0-beta.1", "1.15")).To(gomega.Equal(1))
+		gomega.Expect(CompareSeries("1.9", "1.11")).To(gomega.Equal(-1))
+		gomega.Expect(SameSeries("dev", "0.4")).To(gomega.BeFalse())
+		gomega.Expect(VersionRange{Min: "1.13", Max: "1.16"}.Contains("v1.16.2")).To(gomega.BeTrue())
+		gomega.Expect(VersionRange{Min: "1.13", Max: "1.16"}.Contains("1.17.0")).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should accept supported combinations", func() {
+		report := manifest.Check(Versions{Installer: "v0.4.2", Platform: "0.4.1", Kubernetes: "v1.15.3", Istio: "1.4.3"})
+		gomega.Expect(report.Issues).To(gomega.BeEmpty())
+		gomega.Expect(report.Supported()).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should refuse unsupported combinations", func() {
+		report := manifest.Check(Versions{Installer: "v0.4.2", Platform: "0.3.0", Kubernetes: "v1.17.0", Istio: "1.6.0"})
+		gomega.Expect(report.Supported()).To(gomega.BeFalse())
+		gomega.Expect(len(report.Messages(ErrorLevel))).To(gomega.Equal(3))
+	})
+
+	ginkgo.It("should only warn on unknown versions", func() {
+		report := manifest.Check(Versions{Installer: "", Kubernetes: "v1.20.0"})
+		gomega.Expect(report.Supported()).To(gomega.BeTrue())
+		gomega.Expect(len(report.Messages(WarningLevel))).To(gomega.Equal(1))
+
+		report = manifest.Check(Versions{Installer: "0.4.0", Kubernetes: "v1.15.0"})
+		gomega.Expect(report.Supported()).To(gomega.BeTrue())
+		gomega.Expect(report.Messages(WarningLevel)).To(gomega.Equal([]string{"platform version cannot be detected"}))
+	})
+
+	ginkgo.It("should print the matrix", func() {
+		lines := strings.Split(strings.TrimSpace(manifest.Table()), "\n")
+		gomega.Expect(len(lines)).To(gomega.Equal(len(manifest.Releases) + 1))
+		gomega.Expect(lines[1]).To(gomega.ContainSubstring("1.13 - 1.16"))
+	})
+
+	ginkgo.It("should read the platform version of the components", func() {
+		dir, err := ioutil.TempDir("", "components")
+		gomega.Expect(err).To(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		version, dErr := DetectPlatformVersion(dir)
+		gomega.Expect(dErr).To(gomega.Succeed())
+		gomega.Expect(version).To(gomega.BeEmpty())
+		gomega.Expect(ioutil.WriteFile(filepath.Join(dir, PlatformVersionFile), []byte("0.4.1\n"), 0644)).To(gomega.Succeed())
+		version, dErr = DetectPlatformVersion(dir)
+		gomega.Expect(dErr).To(gomega.Succeed())
+		gomega.Expect(version).To(gomega.Equal("0.4.1"))
+	})
+
+	ginkgo.It("should reject invalid manifests", func() {
+		_, err := ParseManifest([]byte(`{"releases": [{"installer": "latest"}]}`))
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+})
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package compatibility contains the matrix of the platform component, Kubernetes and Istio versions supported by
+// each installer release, and the checks performed before an install or upgrade starts.
+
+package compatibility
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nalej/derrors"
+)
+
+// DefaultManifest is the compatibility manifest compiled into the installer.
+const DefaultManifest = `
+{
+	"releases": [
+		{"installer": "0.4", "platform": ["0.4"], "kubernetes": {"min": "1.13", "max": "1.16"}, "istio": ["1.4", "1.5"]},
+		{"installer": "0.3", "platform": ["0.3"], "kubernetes": {"min": "1.11", "max": "1.15"}, "istio": ["1.3", "1.4"]}
+	]
+}
+`
+
+// VersionRange with the minimum and maximum major.minor versions, both included.
+type VersionRange struct {
+	Min string `json:"min" yaml:"min"`
+	Max string `json:"max" yaml:"max"`
+}
+
+// String returns the range in a human readable format.
+func (r VersionRange) String() string {
+	return fmt.Sprintf("%s - %s", r.Min, r.Max)
+}
+
+// Contains checks if a version is inside the range. Unbounded ends are left empty.
+func (r VersionRange) Contains(version string) bool {
+	if r.Min != "" && CompareSeries(version, r.Min) < 0 {
+		return false
+	}
+	if r.Max != "" && CompareSeries(version, r.Max) > 0 {
+		return false
+	}
+	return true
+}
+
+// Release with the versions supported by an installer release.
+type Release struct {
+	// Installer with the major.minor version of the installer.
+	Installer string `json:"installer" yaml:"installer"`
+	// Platform with the major.minor versions of the platform components that can be installed.
+	Platform []string `json:"platform" yaml:"platform"`
+	// Kubernetes with the range of supported Kubernetes versions.
+	Kubernetes VersionRange `json:"kubernetes" yaml:"kubernetes"`
+	// Istio with the major.minor versions of Istio that can be used.
+	Istio []string `json:"istio" yaml:"istio"`
+}
+
+// Manifest with the compatibility matrix.
+type Manifest struct {
+	Releases []Release `json:"releases" yaml:"releases"`
+}
+
+// ParseManifest parses the content of a compatibility manifest.
+func ParseManifest(content []byte) (*Manifest, derrors.Error) {
+	manifest := &Manifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse compatibility manifest", err)
+	}
+	for _, release := range manifest.Releases {
+		if _, err := ParseSeries(release.Installer); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// LoadManifest reads a compatibility manifest.
+//   params:
+//     path The path of the manifest, empty to use DefaultManifest.
+//   returns:
+//     The manifest.
+//     An error if the manifest cannot be read or parsed.
+func LoadManifest(path string) (*Manifest, derrors.Error) {
+	if path == "" {
+		return ParseManifest([]byte(DefaultManifest))
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read compatibility manifest")
+	}
+	return ParseManifest(content)
+}
+
+// Release retrieves the release matching the major.minor version of the installer.
+func (m *Manifest) Release(installerVersion string) (*Release, bool) {
+	for i := range m.Releases {
+		if SameSeries(installerVersion, m.Releases[i].Installer) {
+			return &m.Releases[i], true
+		}
+	}
+	return nil, false
+}
+
+// Table returns the matrix as a human readable table.
+func (m *Manifest) Table() string {
+	buffer := &bytes.Buffer{}
+	w := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INSTALLER\tPLATFORM\tKUBERNETES\tISTIO")
+	for _, release := range m.Releases {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", release.Installer, strings.Join(release.Platform, ", "),
+			release.Kubernetes.String(), strings.Join(release.Istio, ", "))
+	}
+	w.Flush()
+	return buffer.String()
+}
+
+// ParseSeries extracts the major and minor numbers of a version such as v1.15.3 or 1.16.0-beta.1.
+func ParseSeries(version string) ([2]int, derrors.Error) {
+	result := [2]int{}
+	trimmed := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if index := strings.IndexAny(trimmed, "-+"); index >= 0 {
+		trimmed = trimmed[:index]
+	}
+	parts := strings.Split(trimmed, ".")
+	if len(parts) < 2 {
+		return result, derrors.NewInvalidArgumentError("expecting major.minor version").WithParams(version)
+	}
+	for i := 0; i < 2; i++ {
+		value, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return result, derrors.NewInvalidArgumentError("expecting major.minor version", err).WithParams(version)
+		}
+		result[i] = value
+	}
+	return result, nil
+}
+
+// CompareSeries compares the major.minor part of two versions returning -1, 0 or 1. Versions that cannot be parsed
+// are considered lower than any other.
+func CompareSeries(a string, b string) int {
+	sa, errA := ParseSeries(a)
+	sb, errB := ParseSeries(b)
+	if errA != nil || errB != nil {
+		switch {
+		case errA != nil && errB != nil:
+			return 0
+		case errA != nil:
+			return -1
+		}
+		return 1
+	}
+	for i := 0; i < 2; i++ {
+		if sa[i] != sb[i] {
+			if sa[i] < sb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// SameSeries checks if two versions share the major.minor numbers.
+func SameSeries(a string, b string) bool {
+	if _, err := ParseSeries(a); err != nil {
+		return false
+	}
+	return CompareSeries(a, b) == 0
+}
+
+// inSeries checks if a version belongs to any of the given series.
+func inSeries(version string, series []string) bool {
+	for _, s := range series {
+		if SameSeries(version, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileExists checks if a regular file exists.
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
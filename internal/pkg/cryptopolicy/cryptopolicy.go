@@ -0,0 +1,172 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package cryptopolicy contains the restricted cryptography mode required by some regulated deployments. Once
+// enabled, generated RSA keys have at least 3072 bits, only RSA and ECDSA P-256 or P-384 keys are accepted, other
+// algorithms such as Ed25519 are rejected, and TLS connections are limited to TLS 1.2 with AES-GCM cipher suites.
+
+package cryptopolicy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"sync"
+
+	"github.com/nalej/derrors"
+)
+
+// DefaultRSABits is the size of the RSA keys generated in the default mode.
+const DefaultRSABits = 2048
+
+// RestrictedRSABits is the minimum size of the RSA keys in the restricted mode.
+const RestrictedRSABits = 3072
+
+// Ed25519 identifies the Ed25519 signature algorithm used to sign the components.
+const Ed25519 = "ed25519"
+
+// approvedCipherSuites contains the cipher suites allowed in the restricted mode.
+var approvedCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+}
+
+// approvedCurves contains the elliptic curves allowed in the restricted mode.
+var approvedCurves = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+
+// forbiddenAlgorithms contains the algorithms rejected in the restricted mode.
+var forbiddenAlgorithms = map[string]bool{Ed25519: true}
+
+var policy = struct {
+	sync.RWMutex
+	restricted bool
+}{}
+
+// SetRestricted enables or disables the restricted mode.
+func SetRestricted(restricted bool) {
+	policy.Lock()
+	defer policy.Unlock()
+	policy.restricted = restricted
+}
+
+// Restricted determines if the restricted mode is enabled.
+func Restricted() bool {
+	policy.RLock()
+	defer policy.RUnlock()
+	return policy.restricted
+}
+
+// RSABits returns the size of the RSA keys to be generated.
+func RSABits() int {
+	if Restricted() {
+		return RestrictedRSABits
+	}
+	return DefaultRSABits
+}
+
+// GenerateRSAKey creates an RSA key of the size required by the current mode.
+//   returns:
+//     The private key.
+//     An error if the key cannot be generated.
+func GenerateRSAKey() (*rsa.PrivateKey, derrors.Error) {
+	key, err := rsa.GenerateKey(rand.Reader, RSABits())
+	if err != nil {
+		return nil, derrors.NewInternalError("cannot generate RSA key", err)
+	}
+	return key, nil
+}
+
+// CheckAlgorithm checks if an algorithm can be used in the current mode.
+//   params:
+//     algorithm The name of the algorithm, such as Ed25519.
+//   returns:
+//     A PermissionDenied error if the algorithm is forbidden.
+func CheckAlgorithm(algorithm string) derrors.Error {
+	if Restricted() && forbiddenAlgorithms[algorithm] {
+		return derrors.NewPermissionDeniedError("algorithm not allowed in restricted crypto mode").WithParams(algorithm)
+	}
+	return nil
+}
+
+// CheckPublicKey checks if a key can be used in the current mode.
+//   params:
+//     key The public key.
+//   returns:
+//     A PermissionDenied error if the type or the size of the key is not allowed.
+func CheckPublicKey(key crypto.PublicKey) derrors.Error {
+	if !Restricted() {
+		return nil
+	}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < RestrictedRSABits {
+			return derrors.NewPermissionDeniedError("RSA key too small for restricted crypto mode").WithParams(k.N.BitLen())
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() && k.Curve != elliptic.P384() {
+			return derrors.NewPermissionDeniedError("ECDSA curve not allowed in restricted crypto mode").WithParams(k.Curve.Params().Name)
+		}
+		return nil
+	}
+	return derrors.NewPermissionDeniedError("key type not allowed in restricted crypto mode")
+}
+
+// CheckCertificate checks if the key of a certificate can be used in the current mode.
+//   params:
+//     cert The certificate.
+//   returns:
+//     An InvalidArgument error if the certificate cannot be parsed, or a PermissionDenied one if its key is not
+//     allowed.
+func CheckCertificate(cert tls.Certificate) derrors.Error {
+	if !Restricted() {
+		return nil
+	}
+	if len(cert.Certificate) == 0 {
+		return derrors.NewInvalidArgumentError("empty certificate")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return derrors.NewInvalidArgumentError("cannot parse certificate", err)
+	}
+	return CheckPublicKey(leaf.PublicKey)
+}
+
+// RestrictTLS limits a TLS configuration to the approved versions, cipher suites and curves if the restricted mode
+// is enabled.
+//   params:
+//     config The TLS configuration, which is modified.
+//   returns:
+//     The same configuration.
+func RestrictTLS(config *tls.Config) *tls.Config {
+	if config == nil || !Restricted() {
+		return config
+	}
+	config.MinVersion = tls.VersionTLS12
+	// TLS 1.3 suites are not configurable and include ChaCha20-Poly1305.
+	config.MaxVersion = tls.VersionTLS12
+	config.CipherSuites = approvedCipherSuites
+	config.CurvePreferences = approvedCurves
+	config.PreferServerCipherSuites = true
+	return config
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cryptopolicy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("The crypto policy", func() {
+
+	ginkgo.AfterEach(func() {
+		SetRestricted(false)
+	})
+
+	ginkgo.It("should not restrict anything by default", func() {
+		gomega.Expect(RSABits()).To(gomega.Equal(DefaultRSABits))
+		gomega.Expect(CheckAlgorithm(Ed25519)).To(gomega.Succeed())
+		small, err := rsa.GenerateKey(rand.Reader, 1024)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(CheckPublicKey(&small.PublicKey)).To(gomega.Succeed())
+		config := RestrictTLS(&tls.Config{})
+		gomega.Expect(config.CipherSuites).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should generate larger keys in restricted mode", func() {
+		SetRestricted(true)
+		gomega.Expect(RSABits()).To(gomega.Equal(RestrictedRSABits))
+		key, err := GenerateRSAKey()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(key.N.BitLen()).To(gomega.Equal(RestrictedRSABits))
+		gomega.Expect(CheckPublicKey(&key.PublicKey)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject forbidden algorithms and keys in restricted mode", func() {
+		SetRestricted(true)
+		gomega.Expect(CheckAlgorithm(Ed25519)).NotTo(gomega.Succeed())
+
+		small, err := rsa.GenerateKey(rand.Reader, 2048)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(CheckPublicKey(&small.PublicKey)).NotTo(gomega.Succeed())
+
+		p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(CheckPublicKey(&p256.PublicKey)).To(gomega.Succeed())
+		p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(CheckPublicKey(&p224.PublicKey)).NotTo(gomega.Succeed())
+
+		gomega.Expect(CheckPublicKey("key")).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should restrict the TLS configurations in restricted mode", func() {
+		SetRestricted(true)
+		config := RestrictTLS(&tls.Config{MinVersion: tls.VersionTLS10})
+		gomega.Expect(config.MinVersion).To(gomega.Equal(uint16(tls.VersionTLS12)))
+		gomega.Expect(config.MaxVersion).To(gomega.Equal(uint16(tls.VersionTLS12)))
+		gomega.Expect(config.CipherSuites).To(gomega.Equal(approvedCipherSuites))
+		gomega.Expect(config.CurvePreferences).To(gomega.Equal(approvedCurves))
+	})
+})
@@ -74,6 +74,18 @@ var NetworkingModeToString = map[NetworkingMode] string {
 }
 
 
+// OpenShiftPlatform is the platform of the OpenShift clusters. As it is not one of the platforms of the install
+// requests, the clusters are requested as BAREMETAL with the platform set apart.
+const OpenShiftPlatform = "OPENSHIFT"
+
+// ValidPlatform checks that a platform set apart from the install request is supported.
+func ValidPlatform(platform string) derrors.Error {
+	if platform != "" && platform != OpenShiftPlatform {
+		return derrors.NewInvalidArgumentError("unsupported platform").WithParams(platform)
+	}
+	return nil
+}
+
 type Environment struct {
 	Target            TargetEnvironment
 	TargetEnvironment string `json:"target_environment"`
@@ -18,9 +18,16 @@
 package entities
 
 import (
+	"net"
+	"strings"
+
 	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-infrastructure-go"
 	"github.com/nalej/grpc-installer-go"
+	"github.com/satori/go.uuid"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 // ValidInstallRequest validates that an install request contains the required fields.
@@ -67,6 +74,30 @@ func ValidInstallRequest(installRequest *grpc_installer_go.InstallRequest) derro
 	return nil
 }
 
+// ValidJoinInstallRequest validates an install request to be performed by the installer running inside the
+// application cluster. Credentials must not be included as the installer uses its own service account.
+func ValidJoinInstallRequest(installRequest *grpc_installer_go.InstallRequest) derrors.Error {
+	if installRequest.RequestId == "" {
+		return derrors.NewInvalidArgumentError("expecting request_id")
+	}
+	if installRequest.OrganizationId == "" {
+		return derrors.NewInvalidArgumentError("expecting organization_id")
+	}
+	if installRequest.ClusterId == "" {
+		return derrors.NewInvalidArgumentError("expecting cluster_id")
+	}
+	if installRequest.Hostname == "" {
+		return derrors.NewInvalidArgumentError("hostname must be set with the ingress hostname")
+	}
+	if installRequest.KubeConfigRaw != "" || installRequest.Username != "" || installRequest.PrivateKey != "" {
+		return derrors.NewInvalidArgumentError("expecting a join request without credentials")
+	}
+	if len(installRequest.Nodes) > 0 || installRequest.InstallBaseSystem {
+		return derrors.NewInvalidArgumentError("expecting a join request on an existing cluster")
+	}
+	return nil
+}
+
 // ValidRequestID checks that the request contains the required fields.
 func ValidRequestID(requestID *grpc_common_go.RequestId) derrors.Error {
 	if requestID.RequestId == "" {
@@ -91,3 +122,110 @@ func ValidUninstallClusterRequest(request *grpc_installer_go.UninstallClusterReq
 	}
 	return nil
 }
+
+// validUUID checks that a given identifier follows the UUID format.
+func validUUID(fieldName string, value string) derrors.Error {
+	if _, err := uuid.FromString(value); err != nil {
+		return derrors.NewInvalidArgumentError("expecting UUID format").WithParams(fieldName, value)
+	}
+	return nil
+}
+
+// validClusterType checks that the cluster type can be managed by the installer.
+func validClusterType(clusterType grpc_infrastructure_go.ClusterType) derrors.Error {
+	if clusterType != grpc_infrastructure_go.ClusterType_KUBERNETES {
+		return derrors.NewInvalidArgumentError("unsupported cluster type").WithParams(clusterType.String())
+	}
+	return nil
+}
+
+// validKubeConfig checks that the raw content of a kubeconfig file can be parsed and contains a cluster.
+func validKubeConfig(kubeConfigRaw string) derrors.Error {
+	config, err := clientcmd.Load([]byte(kubeConfigRaw))
+	if err != nil {
+		return derrors.NewInvalidArgumentError("cannot parse kube_config_raw", err)
+	}
+	if len(config.Clusters) == 0 {
+		return derrors.NewInvalidArgumentError("kube_config_raw does not define any cluster")
+	}
+	return nil
+}
+
+// validNodeAddress checks that the address of a node is an IPv4 or IPv6 address or a host name.
+func validNodeAddress(address string) derrors.Error {
+	if net.ParseIP(address) != nil {
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(strings.ToLower(address)); len(errs) > 0 {
+		return derrors.NewInvalidArgumentError("expecting an IP address or a host name").WithParams("nodes", address)
+	}
+	return nil
+}
+
+// ValidStaticIPAddresses checks that the static IP addresses of the services are IPv4 or IPv6 addresses. Each
+// address can use either family, so the services of a dual-stack cluster can be exposed on both of them.
+func ValidStaticIPAddresses(addresses *grpc_installer_go.StaticIPAddresses) derrors.Error {
+	if addresses == nil {
+		return nil
+	}
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"ingress", addresses.Ingress},
+		{"dns", addresses.Dns},
+		{"coredns_ext", addresses.CorednsExt},
+		{"vpn_server", addresses.VpnServer},
+	}
+	for _, field := range fields {
+		if field.value != "" && net.ParseIP(field.value) == nil {
+			return derrors.NewInvalidArgumentError("expecting an IPv4 or IPv6 address").WithParams(field.name, field.value)
+		}
+	}
+	return nil
+}
+
+// ValidInstallRequestFormat checks the format of the fields of an install request.
+func ValidInstallRequestFormat(installRequest *grpc_installer_go.InstallRequest) derrors.Error {
+	if err := validUUID("request_id", installRequest.RequestId); err != nil {
+		return err
+	}
+	if err := validUUID("organization_id", installRequest.OrganizationId); err != nil {
+		return err
+	}
+	if err := validUUID("cluster_id", installRequest.ClusterId); err != nil {
+		return err
+	}
+	if err := validClusterType(installRequest.ClusterType); err != nil {
+		return err
+	}
+	for _, node := range installRequest.Nodes {
+		if err := validNodeAddress(node); err != nil {
+			return err
+		}
+	}
+	if err := ValidStaticIPAddresses(installRequest.StaticIpAddresses); err != nil {
+		return err
+	}
+	if installRequest.KubeConfigRaw != "" {
+		return validKubeConfig(installRequest.KubeConfigRaw)
+	}
+	return nil
+}
+
+// ValidUninstallClusterRequestFormat checks the format of the fields of an uninstall request.
+func ValidUninstallClusterRequestFormat(request *grpc_installer_go.UninstallClusterRequest) derrors.Error {
+	if err := validUUID("request_id", request.RequestId); err != nil {
+		return err
+	}
+	if err := validUUID("organization_id", request.OrganizationId); err != nil {
+		return err
+	}
+	if err := validUUID("cluster_id", request.ClusterId); err != nil {
+		return err
+	}
+	if err := validClusterType(request.ClusterType); err != nil {
+		return err
+	}
+	return validKubeConfig(request.KubeConfigRaw)
+}
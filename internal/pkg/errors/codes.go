@@ -0,0 +1,224 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package errors
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/nalej/derrors"
+)
+
+// Code identifies a known cause of failure of the installer. Codes are kept as a prefix of the error messages so
+// they reach the operation progress, the logs and the CLI output, together with the causes of the error.
+type Code string
+
+const (
+	// PrecheckFailed indicates that the target cluster does not satisfy the requirements of the install.
+	PrecheckFailed Code = "PRECHECK_FAILED"
+	// K8sUnreachable indicates that the Kubernetes API of the target cluster cannot be reached.
+	K8sUnreachable Code = "K8S_UNREACHABLE"
+	// K8sDNSFailed indicates that the host of the Kubernetes API of the target cluster cannot be resolved.
+	K8sDNSFailed Code = "K8S_DNS_FAILED"
+	// K8sTLSFailed indicates that the certificate of the Kubernetes API of the target cluster is not trusted.
+	K8sTLSFailed Code = "K8S_TLS_FAILED"
+	// K8sForbidden indicates that the credentials are rejected or lack the permissions required by the install.
+	K8sForbidden Code = "K8S_FORBIDDEN"
+	// K8sHighLatency indicates that the Kubernetes API of the target cluster answers too slowly.
+	K8sHighLatency Code = "K8S_HIGH_LATENCY"
+	// UnsupportedVersion indicates that the versions are not part of the compatibility matrix.
+	UnsupportedVersion Code = "UNSUPPORTED_VERSION"
+	// CertTimeout indicates that a certificate was not issued in time.
+	CertTimeout Code = "CERT_TIMEOUT"
+	// CertInvalid indicates that a certificate is expired, about to expire or does not match the expected hosts.
+	CertInvalid Code = "CERT_INVALID"
+	// IstioctlFailed indicates that the execution of istioctl failed.
+	IstioctlFailed Code = "ISTIOCTL_FAILED"
+	// WaitTimeout indicates that a resource did not become ready in time.
+	WaitTimeout Code = "WAIT_TIMEOUT"
+	// ComponentLaunchFailed indicates that the components could not be created in the target cluster.
+	ComponentLaunchFailed Code = "COMPONENT_LAUNCH_FAILED"
+	// InvalidSignature indicates that the signature of the components cannot be verified.
+	InvalidSignature Code = "INVALID_SIGNATURE"
+	// IstioUnhealthy indicates that the Istio control plane is not working once installed.
+	IstioUnhealthy Code = "ISTIO_UNHEALTHY"
+	// ObjectNotManaged indicates that an object of the components already exists and was not created by the installer.
+	ObjectNotManaged Code = "OBJECT_NOT_MANAGED"
+	// VolumeNotExpandable indicates that the size of an existing claim is increased and its volume cannot be expanded.
+	VolumeNotExpandable Code = "VOLUME_NOT_EXPANDABLE"
+	// VolumeMigrationInterrupted indicates that the migration of a claim failed once the original claim was deleted.
+	VolumeMigrationInterrupted Code = "VOLUME_MIGRATION_INTERRUPTED"
+)
+
+// CodeInfo structure with the description of an error code.
+type CodeInfo struct {
+	Code Code `json:"code" yaml:"code"`
+	// Description of the failure.
+	Description string `json:"description" yaml:"description"`
+	// Hint with the actions that usually fix the failure.
+	Hint string `json:"hint" yaml:"hint"`
+}
+
+// Catalogue contains the description and remediation hint of each error code.
+var Catalogue = map[Code]CodeInfo{
+	PrecheckFailed: {
+		Code:        PrecheckFailed,
+		Description: "the target cluster does not satisfy the requirements of the install",
+		Hint:        "Check that the Kubernetes version of the cluster is supported and that the nodes are ready, then retry the install.",
+	},
+	K8sUnreachable: {
+		Code:        K8sUnreachable,
+		Description: "the Kubernetes API of the target cluster cannot be reached",
+		Hint:        "Check that the server and credentials of the kubeconfig are valid and that the API server is reachable from the installer, for example with kubectl get nodes.",
+	},
+	K8sDNSFailed: {
+		Code:        K8sDNSFailed,
+		Description: "the host of the Kubernetes API of the target cluster cannot be resolved",
+		Hint:        "Check the server of the kubeconfig and that its host resolves from the installer, for example with nslookup, or use the IP address of the API server.",
+	},
+	K8sTLSFailed: {
+		Code:        K8sTLSFailed,
+		Description: "the certificate of the Kubernetes API of the target cluster is not trusted",
+		Hint:        "Check that the certificate-authority-data of the kubeconfig matches the cluster and that the server address is one of the names of the API server certificate.",
+	},
+	K8sForbidden: {
+		Code:        K8sForbidden,
+		Description: "the credentials are rejected or lack the permissions required by the install",
+		Hint:        "Check that the credentials of the kubeconfig are not expired and are bound to a role granting the install permissions, see installer-cli install-identity.",
+	},
+	K8sHighLatency: {
+		Code:        K8sHighLatency,
+		Description: "the Kubernetes API of the target cluster answers too slowly",
+		Hint:        "Run the installer closer to the cluster or check the load of the API server, or raise the max_latency of the probeCluster command.",
+	},
+	UnsupportedVersion: {
+		Code:        UnsupportedVersion,
+		Description: "the versions of the installer, platform, Kubernetes or Istio are not part of the compatibility matrix",
+		Hint:        "Run installer-cli compatibility to list the supported combinations, or set --allowUnsupportedVersions to continue at your own risk.",
+	},
+	CertTimeout: {
+		Code:        CertTimeout,
+		Description: "a certificate was not issued in time",
+		Hint:        "Check the status and events of the certificate and of its issuer, and that the DNS records used by the ACME challenges resolve to the cluster.",
+	},
+	CertInvalid: {
+		Code:        CertInvalid,
+		Description: "a certificate is expired, about to expire or does not match the expected hosts",
+		Hint:        "Renew the certificate, or enable --renewCertificates for the self-signed ones, and check that it covers the DNS names of the cluster.",
+	},
+	IstioctlFailed: {
+		Code:        IstioctlFailed,
+		Description: "the execution of istioctl failed",
+		Hint:        "Check that istioctl in --istioPath matches the Istio version and run istioctl analyze against the cluster to find the invalid configuration.",
+	},
+	WaitTimeout: {
+		Code:        WaitTimeout,
+		Description: "a resource did not become ready in time",
+		Hint:        "Inspect the pods and events of the namespace, for example with kubectl describe, to find image pull, scheduling or crash loop errors.",
+	},
+	ComponentLaunchFailed: {
+		Code:        ComponentLaunchFailed,
+		Description: "the components could not be created in the target cluster",
+		Hint:        "Check the component files of --componentsPath and that the credentials of the install allow creating them, then retry the install.",
+	},
+	InvalidSignature: {
+		Code:        InvalidSignature,
+		Description: "the signature of the components cannot be verified",
+		Hint:        "Check that the components were signed with installer-cli sign-components using the key matching --componentsPublicKeyPath.",
+	},
+	IstioUnhealthy: {
+		Code:        IstioUnhealthy,
+		Description: "the Istio control plane is not working once installed",
+		Hint:        "Check the diagnostics of the error and the pods of the Istio namespace, for example with istioctl verify-install, then retry the install.",
+	},
+	ObjectNotManaged: {
+		Code:        ObjectNotManaged,
+		Description: "an object of the components already exists and was not created by the installer",
+		Hint:        "Remove the objects left by previous manual installs, or set --adoptExisting to label them as managed by the installer and update them.",
+	},
+	VolumeNotExpandable: {
+		Code:        VolumeNotExpandable,
+		Description: "the size of an existing persistent volume claim is increased and its volume cannot be expanded",
+		Hint:        "Set allowVolumeExpansion on the storage class of the claim, or set --migrateVolumes to copy its data to a new claim during the install.",
+	},
+	VolumeMigrationInterrupted: {
+		Code:        VolumeMigrationInterrupted,
+		Description: "the migration of a persistent volume claim failed after the claim was recreated, and its data is only kept in the temporary claim",
+		Hint:        "Do not delete the <claim>-migration claim. Fix the cause of the failure and retry the install with --migrateVolumes to copy the data back and restore the workloads.",
+	},
+}
+
+// codeRegex matches the code prefix of a message.
+var codeRegex = regexp.MustCompile(`\b([A-Z][A-Z0-9_]+): `)
+
+// Coded prefixes a message with an error code.
+//   params:
+//     code The error code.
+//     message The message of the error.
+//   returns:
+//     The message with the code.
+func Coded(code Code, message string) string {
+	return fmt.Sprintf("%s: %s", code, message)
+}
+
+// CodeOf finds the first error code of the catalogue in a text, such as the message of an error or the output of
+// a command.
+//   params:
+//     text The text to be inspected.
+//   returns:
+//     The error code.
+//     Whether a code was found.
+func CodeOf(text string) (Code, bool) {
+	for _, match := range codeRegex.FindAllStringSubmatch(text, -1) {
+		if _, found := Catalogue[Code(match[1])]; found {
+			return Code(match[1]), true
+		}
+	}
+	return "", false
+}
+
+// ErrorCode finds the error code of an error or of any of its causes.
+//   params:
+//     err The error to be inspected.
+//   returns:
+//     The error code.
+//     Whether a code was found.
+func ErrorCode(err derrors.Error) (Code, bool) {
+	if err == nil {
+		return "", false
+	}
+	if code, found := CodeOf(err.Error()); found {
+		return code, true
+	}
+	return CodeOf(err.DebugReport())
+}
+
+// Describe returns the description of the error code found in a text.
+//   params:
+//     text The text to be inspected, such as the message of an error.
+//   returns:
+//     The information of the code.
+//     Whether a code was found.
+func Describe(text string) (*CodeInfo, bool) {
+	code, found := CodeOf(text)
+	if !found {
+		return nil, false
+	}
+	info := Catalogue[code]
+	return &info, true
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package errors
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Error codes", func() {
+
+	ginkgo.It("should describe every code of the catalogue", func() {
+		for code, info := range Catalogue {
+			gomega.Expect(info.Code).Should(gomega.Equal(code))
+			gomega.Expect(info.Description).ShouldNot(gomega.BeEmpty())
+			gomega.Expect(info.Hint).ShouldNot(gomega.BeEmpty())
+		}
+	})
+
+	ginkgo.It("should find the code of a message", func() {
+		code, found := CodeOf(Coded(CertTimeout, "timeout waiting for condition"))
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(code).Should(gomega.Equal(CertTimeout))
+	})
+
+	ginkgo.It("should ignore unknown codes", func() {
+		_, found := CodeOf("UNKNOWN_CODE: something failed")
+		gomega.Expect(found).To(gomega.BeFalse())
+		_, found = CodeOf("2 certificates about to expire")
+		gomega.Expect(found).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should find the code of the cause of an error", func() {
+		cause := derrors.NewUnavailableError(Coded(K8sUnreachable, "cannot obtain the server version"))
+		err := derrors.NewInternalError("cannot connect to K8s").CausedBy(cause)
+		code, found := ErrorCode(err)
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(code).Should(gomega.Equal(K8sUnreachable))
+		_, found = ErrorCode(nil)
+		gomega.Expect(found).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should return the hint of a coded message", func() {
+		info, found := Describe(Coded(IstioctlFailed, WorkflowExecutionFailed))
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(info.Hint).Should(gomega.Equal(Catalogue[IstioctlFailed].Hint))
+	})
+})
@@ -48,14 +48,44 @@ const CannotParseTemplate = "cannot parse workflow template file"
 
 const CannotParseRKETemplate = "cannot parse RKE cluster template file"
 
+// InvalidRKEClusterFile error to indicate that the rendered RKE cluster file does not contain the fields required by RKE.
+const InvalidRKEClusterFile = "invalid RKE cluster file"
+
 // CannotApplyTemplate error to indicate that the template cannot be applied with the given parameters.
 const CannotApplyTemplate = "cannot apply template parameters"
 
+// IncludeWithoutTemplates error to indicate that the parser cannot resolve include commands.
+const IncludeWithoutTemplates = "include commands require a template provider"
+
+// MaxIncludeDepthReached error to indicate that the workflow includes too many nested templates.
+const MaxIncludeDepthReached = "maximum include depth reached, check for include cycles"
+
+// UnresolvedInclude error to indicate that an include command reached the command parser.
+const UnresolvedInclude = "include commands must be resolved by the workflow parser"
+
+// InvalidCondition error to indicate that the condition of a command cannot be evaluated.
+const InvalidCondition = "invalid command condition"
+
+// InvalidWorkflowSchema error to indicate that the workflow does not match the schema of its commands.
+const InvalidWorkflowSchema = "workflow does not match the command schema"
+
 //Parameters
 
 // CannotParseParameters error to indicate that the parameters input file cannot be read.
 const CannotParseParameters = "cannot parse parameters file"
 
+// UnsupportedParametersVersion error to indicate that the parameters follow a newer version of the schema.
+const UnsupportedParametersVersion = "unsupported version of the parameters schema"
+
+// InvalidParameterFormat error to indicate that a parameter does not follow the format of the schema.
+const InvalidParameterFormat = "invalid parameter format"
+
+// UnknownTemplateParameter error to indicate that a template references a parameter not defined by the schema.
+const UnknownTemplateParameter = "the template references an unknown parameter"
+
+// MissingTemplateParameter error to indicate that a parameter required by a template is not set.
+const MissingTemplateParameter = "the template references a missing parameter"
+
 // Workflows
 
 // CannotWriteWorkflowFile to indicate that the output workflow cannot be generated.
@@ -87,6 +117,18 @@ const UnsupportedCommandType = "unsupported command type"
 // UnsupportedCommand error to indicate that the selected command is not supported.
 const UnsupportedCommand = "unsupported command"
 
+// CommandAlreadyRegistered error to indicate that a command with the same type and name is already registered.
+const CommandAlreadyRegistered = "command already registered"
+
+// OutputNotFound error to indicate that a command references an output that has not been set by a previous command.
+const OutputNotFound = "output not found"
+
+// OutputReferenceNotSupported error to indicate that a command cannot reference the outputs of previous commands.
+const OutputReferenceNotSupported = "output references are only supported by sync commands"
+
+// InvalidCommandPlugin error to indicate that an external command plugin cannot be loaded or executed.
+const InvalidCommandPlugin = "invalid command plugin"
+
 // CannotExecuteSyncCommand to indicate that the synchronous command execution failed.
 const CannotExecuteSyncCommand = "cannot execute synchronous command"
 
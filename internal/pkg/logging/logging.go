@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package logging configures the global logger shared by the installer components.
+package logging
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"strings"
+)
+
+// JSONFormat writes one JSON document per log event.
+const JSONFormat = "json"
+
+// ConsoleFormat writes human readable log events.
+const ConsoleFormat = "console"
+
+// Config structure with the logging options.
+type Config struct {
+	// Level with the minimum level of the events to be written: trace, debug, info, warn or error.
+	Level string
+	// Format of the events, JSONFormat or ConsoleFormat.
+	Format string
+	// Redact indicates that secrets must be removed from the events.
+	Redact bool
+}
+
+// Validate checks the logging options.
+func (c Config) Validate() derrors.Error {
+	if _, err := zerolog.ParseLevel(strings.ToLower(c.Level)); err != nil || c.Level == "" {
+		return derrors.NewInvalidArgumentError("invalid log level, expecting trace, debug, info, warn or error").WithParams(c.Level)
+	}
+	if c.Format != JSONFormat && c.Format != ConsoleFormat {
+		return derrors.NewInvalidArgumentError("invalid log format, expecting json or console").WithParams(c.Format)
+	}
+	return nil
+}
+
+// Writer returns the writer of the log events for the given configuration.
+func (c Config) Writer(out io.Writer) io.Writer {
+	if c.Format == ConsoleFormat {
+		out = zerolog.ConsoleWriter{Out: out}
+	}
+	if c.Redact {
+		// Redaction is applied on the JSON event before it is formatted.
+		out = NewRedactingWriter(out)
+	}
+	return out
+}
+
+// Setup configures the global logger.
+//   params:
+//     config The logging options.
+//   returns:
+//     An error if the options are not valid.
+func Setup(config Config) derrors.Error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	level, _ := zerolog.ParseLevel(strings.ToLower(config.Level))
+	zerolog.SetGlobalLevel(level)
+	log.Logger = log.Output(config.Writer(os.Stderr))
+	return nil
+}
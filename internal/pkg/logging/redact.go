@@ -0,0 +1,74 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"io"
+	"regexp"
+)
+
+// Redacted is the value written instead of a secret.
+const Redacted = "REDACTED"
+
+// secretFieldRegex matches JSON fields whose value is a secret, including the fields of the gRPC requests,
+// the workflow commands and the Kubernetes objects.
+var secretFieldRegex = regexp.MustCompile(`"((?i:password|passwd|secret|secret_value|token|authSecret|auth_secret|jwtSecret|` +
+	`privateKey|private_key|PrivateKey|kubeConfigRaw|KubeConfigRaw|kube_config_raw|\.dockerconfigjson|` +
+	`client-key-data|tls\.key))"\s*:\s*"(?:[^"\\]|\\.)*"`)
+
+// privateKeyRegex matches PEM private keys embedded in any value.
+var privateKeyRegex = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`)
+
+// embeddedSecretRegex matches secrets found in YAML contents such as kubeconfig files.
+var embeddedSecretRegex = regexp.MustCompile(`((?:client-key-data|token|password):\s*)[^\s"\\]+`)
+
+// secretObjectRegex detects Kubernetes secrets, whose data must be removed.
+var secretObjectRegex = regexp.MustCompile(`"type"\s*:\s*"(?:Opaque|kubernetes\.io/[a-z-]+)"`)
+
+// secretDataRegex matches the data of a Kubernetes secret.
+var secretDataRegex = regexp.MustCompile(`"(data|stringData)"\s*:\s*\{[^{}]*\}`)
+
+// Redact removes the secrets found in a log event or any other JSON content.
+func Redact(content string) string {
+	result := secretFieldRegex.ReplaceAllString(content, `"$1":"`+Redacted+`"`)
+	result = privateKeyRegex.ReplaceAllString(result, Redacted)
+	result = embeddedSecretRegex.ReplaceAllString(result, "${1}"+Redacted)
+	if secretObjectRegex.MatchString(result) {
+		result = secretDataRegex.ReplaceAllString(result, `"$1":{"`+Redacted+`":""}`)
+	}
+	return result
+}
+
+// RedactingWriter structure that removes secrets from the log events before writing them.
+type RedactingWriter struct {
+	out io.Writer
+}
+
+// NewRedactingWriter creates a RedactingWriter on top of a writer.
+func NewRedactingWriter(out io.Writer) *RedactingWriter {
+	return &RedactingWriter{out: out}
+}
+
+// Write redacts the event and writes it to the underlying writer.
+func (rw *RedactingWriter) Write(p []byte) (int, error) {
+	if _, err := rw.out.Write([]byte(Redact(string(p)))); err != nil {
+		return 0, err
+	}
+	// The caller expects the length of the original event.
+	return len(p), nil
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package pki contains the helpers generating the keys and certificates created by the installer, such as the CAs of
+// Istio and the management cluster or the identity of the VPN server. Keys are generated following the crypto policy
+// and the certificates use random serial numbers.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/cryptopolicy"
+)
+
+// KeyAlgorithm identifies the algorithm of the generated keys.
+type KeyAlgorithm string
+
+// Supported key algorithms.
+const (
+	// RSA keys with the size required by the crypto policy.
+	RSA KeyAlgorithm = "rsa"
+	// ECDSAP256 keys on the P-256 curve.
+	ECDSAP256 KeyAlgorithm = "ecdsa-p256"
+	// ECDSAP384 keys on the P-384 curve.
+	ECDSAP384 KeyAlgorithm = "ecdsa-p384"
+)
+
+// serialNumberBits is the size of the random serial numbers.
+const serialNumberBits = 128
+
+// DefaultValidity is the validity of the certificates that do not set it.
+const DefaultValidity = time.Hour * 24 * 365
+
+// Request structure with the attributes of a certificate to be generated.
+type Request struct {
+	// Subject of the certificate.
+	Subject pkix.Name
+	// DNSNames with the DNS subject alternative names.
+	DNSNames []string
+	// IPAddresses with the IP subject alternative names.
+	IPAddresses []net.IP
+	// URIs with the URI subject alternative names, such as SPIFFE identities.
+	URIs []*url.URL
+	// Validity of the certificate from the moment it is generated, DefaultValidity if not set.
+	Validity time.Duration
+	// Algorithm of the key of the certificate, RSA if not set.
+	Algorithm KeyAlgorithm
+	// IsCA indicates that the certificate can sign other certificates.
+	IsCA bool
+	// MaxPathLen with the number of intermediate CAs allowed below a CA. Zero means no limit unless
+	// MaxPathLenZero is set.
+	MaxPathLen int
+	// MaxPathLenZero indicates that a CA cannot sign other CAs.
+	MaxPathLenZero bool
+	// KeyUsage of the certificate. CAs default to signing certificates and CRLs, and leaf certificates to digital
+	// signatures, plus key encipherment with RSA keys.
+	KeyUsage x509.KeyUsage
+	// ExtKeyUsage of the certificate. Leaf certificates default to server authentication, CAs are not restricted.
+	ExtKeyUsage []x509.ExtKeyUsage
+}
+
+// Certificate structure with a generated certificate and its private key.
+type Certificate struct {
+	// Certificate with the parsed certificate.
+	Certificate *x509.Certificate
+	// Key with the private key.
+	Key crypto.Signer
+	// CertPEM with the PEM encoded certificate.
+	CertPEM []byte
+	// KeyPEM with the PEM encoded private key.
+	KeyPEM []byte
+}
+
+// GenerateKey creates a private key.
+//   params:
+//     algorithm The algorithm of the key, RSA if empty.
+//   returns:
+//     The private key.
+//     An error if the algorithm is not supported or not allowed by the crypto policy.
+func GenerateKey(algorithm KeyAlgorithm) (crypto.Signer, derrors.Error) {
+	var curve elliptic.Curve
+	switch algorithm {
+	case "", RSA:
+		key, err := cryptopolicy.GenerateRSAKey()
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	case ECDSAP256:
+		curve = elliptic.P256()
+	case ECDSAP384:
+		curve = elliptic.P384()
+	default:
+		return nil, derrors.NewInvalidArgumentError("unsupported key algorithm").WithParams(algorithm)
+	}
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, derrors.NewInternalError("cannot generate ECDSA key", err)
+	}
+	if err := cryptopolicy.CheckPublicKey(&key.PublicKey); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// EncodeKey transforms a private key to PEM, PKCS#1 for RSA keys and SEC 1 for ECDSA ones.
+func EncodeKey(key crypto.Signer) ([]byte, derrors.Error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}), nil
+	case *ecdsa.PrivateKey:
+		raw, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, derrors.NewInternalError("cannot marshal private key", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: raw}), nil
+	}
+	return nil, derrors.NewInvalidArgumentError("unsupported private key type")
+}
+
+// NewSerialNumber creates a random serial number so certificates regenerated for the same subject can be told apart.
+func NewSerialNumber() (*big.Int, derrors.Error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialNumberBits))
+	if err != nil {
+		return nil, derrors.NewInternalError("cannot generate serial number", err)
+	}
+	return serial, nil
+}
+
+// Template builds the x509 template of the request.
+//   params:
+//     key The private key of the certificate, used to choose the default key usages.
+//   returns:
+//     The certificate template.
+//     An error if the serial number cannot be generated.
+func (r Request) Template(key crypto.Signer) (*x509.Certificate, derrors.Error) {
+	serial, err := NewSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	validity := r.Validity
+	if validity == 0 {
+		validity = DefaultValidity
+	}
+	keyUsage := r.KeyUsage
+	if keyUsage == 0 {
+		if r.IsCA {
+			keyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+		} else {
+			keyUsage = x509.KeyUsageDigitalSignature
+			if _, isRSA := key.(*rsa.PrivateKey); isRSA {
+				keyUsage |= x509.KeyUsageKeyEncipherment
+			}
+		}
+	}
+	extKeyUsage := r.ExtKeyUsage
+	if extKeyUsage == nil && !r.IsCA {
+		extKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               r.Subject,
+		DNSNames:              r.DNSNames,
+		IPAddresses:           r.IPAddresses,
+		URIs:                  r.URIs,
+		NotBefore:             now,
+		NotAfter:              now.Add(validity),
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           extKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  r.IsCA,
+		MaxPathLen:            r.MaxPathLen,
+		MaxPathLenZero:        r.MaxPathLenZero,
+	}, nil
+}
+
+// SelfSigned generates a new key and a certificate signed by itself.
+func SelfSigned(request Request) (*Certificate, derrors.Error) {
+	return Issue(request, nil)
+}
+
+// Issue generates a new key and a certificate signed by an issuer.
+//   params:
+//     request The attributes of the certificate.
+//     issuer The CA signing the certificate, nil for a self-signed certificate.
+//   returns:
+//     The certificate with its key.
+//     An error if the issuer is not a CA or the certificate cannot be generated.
+func Issue(request Request, issuer *Certificate) (*Certificate, derrors.Error) {
+	if issuer != nil && !issuer.Certificate.IsCA {
+		return nil, derrors.NewInvalidArgumentError("issuer is not a CA").WithParams(issuer.Certificate.Subject.String())
+	}
+	key, err := GenerateKey(request.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	template, err := request.Template(key)
+	if err != nil {
+		return nil, err
+	}
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.Certificate, issuer.Key
+	}
+	raw, cErr := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if cErr != nil {
+		return nil, derrors.NewInternalError("cannot create certificate", cErr)
+	}
+	certificate, cErr := x509.ParseCertificate(raw)
+	if cErr != nil {
+		return nil, derrors.NewInternalError("cannot parse certificate", cErr)
+	}
+	keyPEM, err := EncodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Certificate{
+		Certificate: certificate,
+		Key:         key,
+		CertPEM:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: raw}),
+		KeyPEM:      keyPEM,
+	}, nil
+}
+
+// TLSCertificate returns the certificate and its key to be used by a TLS server or client.
+func (c *Certificate) TLSCertificate() (tls.Certificate, derrors.Error) {
+	cert, err := tls.X509KeyPair(c.CertPEM, c.KeyPEM)
+	if err != nil {
+		return tls.Certificate{}, derrors.NewInternalError("cannot load generated certificate", err)
+	}
+	return cert, nil
+}
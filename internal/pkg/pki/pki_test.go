@@ -0,0 +1,168 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/nalej/installer/internal/pkg/cryptopolicy"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("The PKI helpers", func() {
+
+	ginkgo.AfterEach(func() {
+		cryptopolicy.SetRestricted(false)
+	})
+
+	ginkgo.Context("generating keys", func() {
+		ginkgo.It("should generate RSA keys by default", func() {
+			key, err := GenerateKey("")
+			gomega.Expect(err).To(gomega.Succeed())
+			rsaKey, isRSA := key.(*rsa.PrivateKey)
+			gomega.Expect(isRSA).To(gomega.BeTrue())
+			gomega.Expect(rsaKey.N.BitLen()).To(gomega.Equal(cryptopolicy.DefaultRSABits))
+		})
+
+		ginkgo.It("should generate ECDSA keys on the requested curve", func() {
+			key, err := GenerateKey(ECDSAP384)
+			gomega.Expect(err).To(gomega.Succeed())
+			ecKey, isEC := key.(*ecdsa.PrivateKey)
+			gomega.Expect(isEC).To(gomega.BeTrue())
+			gomega.Expect(ecKey.Curve).To(gomega.Equal(elliptic.P384()))
+		})
+
+		ginkgo.It("should follow the crypto policy", func() {
+			cryptopolicy.SetRestricted(true)
+			key, err := GenerateKey(RSA)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(key.(*rsa.PrivateKey).N.BitLen()).To(gomega.Equal(cryptopolicy.RestrictedRSABits))
+		})
+
+		ginkgo.It("should reject unsupported algorithms", func() {
+			_, err := GenerateKey("dsa")
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should encode the keys in their PEM format", func() {
+			for algorithm, blockType := range map[KeyAlgorithm]string{RSA: "RSA PRIVATE KEY", ECDSAP256: "EC PRIVATE KEY"} {
+				key, err := GenerateKey(algorithm)
+				gomega.Expect(err).To(gomega.Succeed())
+				encoded, err := EncodeKey(key)
+				gomega.Expect(err).To(gomega.Succeed())
+				block, _ := pem.Decode(encoded)
+				gomega.Expect(block).NotTo(gomega.BeNil())
+				gomega.Expect(block.Type).To(gomega.Equal(blockType))
+			}
+		})
+	})
+
+	ginkgo.Context("generating certificates", func() {
+		ginkgo.It("should use random serial numbers", func() {
+			first, err := SelfSigned(Request{Subject: pkix.Name{CommonName: "test"}, Algorithm: ECDSAP256})
+			gomega.Expect(err).To(gomega.Succeed())
+			second, err := SelfSigned(Request{Subject: pkix.Name{CommonName: "test"}, Algorithm: ECDSAP256})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(first.Certificate.SerialNumber.Cmp(second.Certificate.SerialNumber)).NotTo(gomega.BeZero())
+			gomega.Expect(first.Certificate.SerialNumber.Sign()).To(gomega.Equal(1))
+		})
+
+		ginkgo.It("should include the subject alternative names", func() {
+			spiffe, pErr := url.Parse("spiffe://cluster.local/ns/istio-system/sa/citadel")
+			gomega.Expect(pErr).To(gomega.Succeed())
+			certificate, err := SelfSigned(Request{
+				Subject:     pkix.Name{CommonName: "vpn-server.nalej.tech"},
+				DNSNames:    []string{"vpn-server.nalej.tech"},
+				IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+				URIs:        []*url.URL{spiffe},
+				Validity:    time.Hour,
+				Algorithm:   ECDSAP256,
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			leaf := certificate.Certificate
+			gomega.Expect(leaf.DNSNames).To(gomega.Equal([]string{"vpn-server.nalej.tech"}))
+			gomega.Expect(leaf.IPAddresses[0].Equal(net.ParseIP("10.0.0.1"))).To(gomega.BeTrue())
+			gomega.Expect(leaf.URIs[0].String()).To(gomega.Equal(spiffe.String()))
+			gomega.Expect(leaf.VerifyHostname("vpn-server.nalej.tech")).To(gomega.Succeed())
+			gomega.Expect(leaf.NotAfter.Sub(leaf.NotBefore)).To(gomega.Equal(time.Hour))
+		})
+
+		ginkgo.It("should set the default usages of leaf certificates", func() {
+			rsaLeaf, err := SelfSigned(Request{Subject: pkix.Name{CommonName: "rsa"}})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(rsaLeaf.Certificate.KeyUsage).To(gomega.Equal(x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment))
+			gomega.Expect(rsaLeaf.Certificate.ExtKeyUsage).To(gomega.Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}))
+			gomega.Expect(rsaLeaf.Certificate.IsCA).To(gomega.BeFalse())
+
+			ecLeaf, err := SelfSigned(Request{
+				Subject:     pkix.Name{CommonName: "ecdsa"},
+				Algorithm:   ECDSAP256,
+				ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(ecLeaf.Certificate.KeyUsage).To(gomega.Equal(x509.KeyUsageDigitalSignature))
+			gomega.Expect(ecLeaf.Certificate.ExtKeyUsage).To(gomega.Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}))
+		})
+
+		ginkgo.It("should build a chain of CAs", func() {
+			root, err := SelfSigned(Request{Subject: pkix.Name{CommonName: "Root CA"}, IsCA: true, MaxPathLen: 1, Algorithm: ECDSAP256})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(root.Certificate.KeyUsage & x509.KeyUsageCertSign).NotTo(gomega.BeZero())
+			intermediate, err := Issue(Request{Subject: pkix.Name{CommonName: "Cluster CA"}, IsCA: true, MaxPathLenZero: true}, root)
+			gomega.Expect(err).To(gomega.Succeed())
+			leaf, err := Issue(Request{Subject: pkix.Name{CommonName: "server"}, DNSNames: []string{"server.nalej"}}, intermediate)
+			gomega.Expect(err).To(gomega.Succeed())
+
+			roots := x509.NewCertPool()
+			roots.AddCert(root.Certificate)
+			intermediates := x509.NewCertPool()
+			intermediates.AddCert(intermediate.Certificate)
+			_, vErr := leaf.Certificate.Verify(x509.VerifyOptions{
+				DNSName:       "server.nalej",
+				Roots:         roots,
+				Intermediates: intermediates,
+			})
+			gomega.Expect(vErr).To(gomega.Succeed())
+			gomega.Expect(intermediate.Certificate.MaxPathLenZero).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("should not issue certificates from a leaf", func() {
+			leaf, err := SelfSigned(Request{Subject: pkix.Name{CommonName: "leaf"}, Algorithm: ECDSAP256})
+			gomega.Expect(err).To(gomega.Succeed())
+			_, err = Issue(Request{Subject: pkix.Name{CommonName: "other"}, Algorithm: ECDSAP256}, leaf)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should load the generated certificate for TLS", func() {
+			certificate, err := SelfSigned(Request{Subject: pkix.Name{CommonName: "installer"}, Algorithm: ECDSAP256})
+			gomega.Expect(err).To(gomega.Succeed())
+			tlsCertificate, err := certificate.TLSCertificate()
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(tlsCertificate.Certificate).To(gomega.HaveLen(1))
+		})
+	})
+})
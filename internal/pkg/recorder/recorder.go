@@ -0,0 +1,297 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+// Package recorder provides an HTTP round tripper that records the interactions with an API server into a cassette
+// file, and replays them later without the server. It is used to run the integration tests of the Kubernetes and
+// Istio clients without a live cluster.
+
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+)
+
+// ModeEnv is the environment variable with the mode of the integration tests: record or replay.
+const ModeEnv = "IT_RECORDER_MODE"
+
+// CassetteEnv is the environment variable with the path of the cassette file.
+const CassetteEnv = "IT_RECORDER_CASSETTE"
+
+// Mode of a recorder.
+type Mode string
+
+const (
+	// Disabled recorders pass the requests through.
+	Disabled Mode = ""
+	// Record mode sends the requests to the server storing the interactions.
+	Record Mode = "record"
+	// Replay mode answers the requests with the stored interactions.
+	Replay Mode = "replay"
+)
+
+// ModeFromEnv returns the mode set in the ModeEnv environment variable.
+func ModeFromEnv() Mode {
+	return Mode(os.Getenv(ModeEnv))
+}
+
+// Interaction with the request and response of an API call.
+type Interaction struct {
+	// Method of the request.
+	Method string `json:"method"`
+	// URI with the path and the query of the request.
+	URI string `json:"uri"`
+	// RequestBody sent to the server.
+	RequestBody []byte `json:"request_body,omitempty"`
+	// StatusCode of the response.
+	StatusCode int `json:"status_code"`
+	// ContentType of the response.
+	ContentType string `json:"content_type,omitempty"`
+	// ResponseBody returned by the server.
+	ResponseBody []byte `json:"response_body,omitempty"`
+}
+
+// Cassette with the recorded interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Recorder records or replays the interactions of the wrapped round trippers.
+type Recorder struct {
+	mode Mode
+	path string
+	sync.Mutex
+	cassette *Cassette
+	// replayed indicates the interactions that were already replayed.
+	replayed []bool
+}
+
+// NewRecorder creates a recorder. In replay mode the interactions are loaded from the cassette file.
+//   params:
+//     mode The mode of the recorder.
+//     path The path of the cassette file.
+//   returns:
+//     The recorder.
+//     An error if the cassette cannot be loaded.
+func NewRecorder(mode Mode, path string) (*Recorder, derrors.Error) {
+	recorder := &Recorder{mode: mode, path: path, cassette: &Cassette{Interactions: make([]Interaction, 0)}}
+	switch mode {
+	case Disabled, Record:
+	case Replay:
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, derrors.NewNotFoundError("cannot read cassette", err).WithParams(path)
+		}
+		if err := json.Unmarshal(content, recorder.cassette); err != nil {
+			return nil, derrors.NewInvalidArgumentError("cannot parse cassette", err).WithParams(path)
+		}
+		recorder.replayed = make([]bool, len(recorder.cassette.Interactions))
+	default:
+		return nil, derrors.NewInvalidArgumentError("invalid recorder mode, expecting record or replay").WithParams(mode)
+	}
+	return recorder, nil
+}
+
+// Mode returns the mode of the recorder.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Wrap returns a round tripper that records or replays the requests sent through another one.
+func (r *Recorder) Wrap(rt http.RoundTripper) http.RoundTripper {
+	if r.mode == Disabled {
+		return rt
+	}
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &roundTripper{recorder: r, next: rt}
+}
+
+// Save writes the recorded interactions into the cassette file.
+func (r *Recorder) Save() derrors.Error {
+	if r.mode != Record {
+		return nil
+	}
+	r.Lock()
+	defer r.Unlock()
+	content, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return derrors.NewInternalError("cannot marshal cassette", err)
+	}
+	if err := ioutil.WriteFile(r.path, content, 0644); err != nil {
+		return derrors.NewInternalError("cannot write cassette", err).WithParams(r.path)
+	}
+	log.Info().Str("path", r.path).Int("interactions", len(r.cassette.Interactions)).Msg("cassette saved")
+	return nil
+}
+
+// record stores an interaction.
+func (r *Recorder) record(interaction Interaction) {
+	r.Lock()
+	defer r.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+}
+
+// next returns the first interaction not replayed yet with the method and URI of a request. Requests are matched
+// in order so the same call returns the responses in the order they were recorded, such as when polling the status
+// of a deployment.
+func (r *Recorder) next(method string, uri string) (*Interaction, bool) {
+	r.Lock()
+	defer r.Unlock()
+	for index, interaction := range r.cassette.Interactions {
+		if !r.replayed[index] && interaction.Method == method && interaction.URI == uri {
+			r.replayed[index] = true
+			return &r.cassette.Interactions[index], true
+		}
+	}
+	return nil, false
+}
+
+// Pending returns the number of recorded interactions that were not replayed.
+func (r *Recorder) Pending() int {
+	r.Lock()
+	defer r.Unlock()
+	pending := 0
+	for _, replayed := range r.replayed {
+		if !replayed {
+			pending++
+		}
+	}
+	return pending
+}
+
+// roundTripper records or replays the requests.
+type roundTripper struct {
+	recorder *Recorder
+	next     http.RoundTripper
+}
+
+// RoundTrip records or replays a request. Watch requests stream their responses, so they are not recorded and
+// their replay returns an empty stream.
+func (rt *roundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	watch := request.URL.Query().Get("watch") == "true"
+	if rt.recorder.mode == Replay {
+		if watch {
+			return newResponse(request, http.StatusOK, "application/json", nil), nil
+		}
+		return rt.replay(request)
+	}
+	if watch {
+		return rt.next.RoundTrip(request)
+	}
+	return rt.record(request)
+}
+
+// record sends a request storing its interaction.
+func (rt *roundTripper) record(request *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if request.Body != nil {
+		content, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			return nil, err
+		}
+		request.Body.Close()
+		requestBody = content
+		request.Body = ioutil.NopCloser(bytes.NewReader(content))
+	}
+	response, err := rt.next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+	rt.recorder.record(Interaction{
+		Method:       request.Method,
+		URI:          request.URL.RequestURI(),
+		RequestBody:  requestBody,
+		StatusCode:   response.StatusCode,
+		ContentType:  response.Header.Get("Content-Type"),
+		ResponseBody: responseBody,
+	})
+	return response, nil
+}
+
+// replay answers a request with its recorded interaction.
+func (rt *roundTripper) replay(request *http.Request) (*http.Response, error) {
+	uri := request.URL.RequestURI()
+	interaction, found := rt.recorder.next(request.Method, uri)
+	if !found {
+		log.Warn().Str("method", request.Method).Str("uri", uri).Msg("request not found in cassette")
+		return nil, fmt.Errorf("no recorded interaction for %s %s", request.Method, uri)
+	}
+	return newResponse(request, interaction.StatusCode, interaction.ContentType, interaction.ResponseBody), nil
+}
+
+// newResponse creates the response of a request.
+func newResponse(request *http.Request, statusCode int, contentType string, body []byte) *http.Response {
+	header := make(http.Header, 0)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+}
+
+// replayKubeConfig is a kubeconfig pointing to a server that does not exist, used to create the clients in replay
+// mode.
+const replayKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: replay
+  cluster:
+    server: https://replay.invalid:6443
+    insecure-skip-tls-verify: true
+contexts:
+- name: replay
+  context:
+    cluster: replay
+    user: replay
+current-context: replay
+users:
+- name: replay
+  user:
+    token: replay
+`
+
+// WriteReplayKubeConfig writes a kubeconfig to create the clients whose requests are replayed.
+func WriteReplayKubeConfig(path string) derrors.Error {
+	if err := ioutil.WriteFile(path, []byte(replayKubeConfig), 0600); err != nil {
+		return derrors.NewInternalError("cannot write replay kubeconfig", err).WithParams(path)
+	}
+	return nil
+}
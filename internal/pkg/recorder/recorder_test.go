@@ -0,0 +1,113 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package recorder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("A recorder", func() {
+
+	var server *httptest.Server
+	var calls int
+	var cassettePath string
+
+	ginkgo.BeforeEach(func() {
+		calls = 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Path == "/missing" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+			fmt.Fprintf(w, `{"path":"%s","call":%d,"body":"%s"}`, r.URL.Path, calls, string(body))
+		}))
+		dir, err := ioutil.TempDir("", "recorder")
+		gomega.Expect(err).To(gomega.Succeed())
+		cassettePath = filepath.Join(dir, "cassette.json")
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Close()
+		os.RemoveAll(filepath.Dir(cassettePath))
+	})
+
+	request := func(client *http.Client, method string, path string, body string) (int, string) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		gomega.Expect(err).To(gomega.Succeed())
+		response, err := client.Do(req)
+		gomega.Expect(err).To(gomega.Succeed())
+		defer response.Body.Close()
+		content, err := ioutil.ReadAll(response.Body)
+		gomega.Expect(err).To(gomega.Succeed())
+		return response.StatusCode, string(content)
+	}
+
+	ginkgo.It("should replay the recorded interactions in order", func() {
+		rec, err := NewRecorder(Record, cassettePath)
+		gomega.Expect(err).To(gomega.Succeed())
+		client := &http.Client{Transport: rec.Wrap(nil)}
+		_, first := request(client, http.MethodGet, "/status", "")
+		_, second := request(client, http.MethodGet, "/status", "")
+		_, created := request(client, http.MethodPost, "/objects", "object")
+		status, _ := request(client, http.MethodGet, "/missing", "")
+		gomega.Expect(status).To(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(rec.Save()).To(gomega.Succeed())
+		gomega.Expect(calls).To(gomega.Equal(4))
+
+		replay, err := NewRecorder(Replay, cassettePath)
+		gomega.Expect(err).To(gomega.Succeed())
+		client = &http.Client{Transport: replay.Wrap(nil)}
+		_, replayed := request(client, http.MethodPost, "/objects", "object")
+		gomega.Expect(replayed).To(gomega.Equal(created))
+		_, replayed = request(client, http.MethodGet, "/status", "")
+		gomega.Expect(replayed).To(gomega.Equal(first))
+		_, replayed = request(client, http.MethodGet, "/status", "")
+		gomega.Expect(replayed).To(gomega.Equal(second))
+		gomega.Expect(replay.Pending()).To(gomega.Equal(1))
+		status, _ = request(client, http.MethodGet, "/missing", "")
+		gomega.Expect(status).To(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(calls).To(gomega.Equal(4))
+	})
+
+	ginkgo.It("should fail on requests that were not recorded", func() {
+		rec, err := NewRecorder(Record, cassettePath)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(rec.Save()).To(gomega.Succeed())
+		replay, err := NewRecorder(Replay, cassettePath)
+		gomega.Expect(err).To(gomega.Succeed())
+		client := &http.Client{Transport: replay.Wrap(nil)}
+		_, rErr := client.Get(server.URL + "/status")
+		gomega.Expect(rErr).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should pass the requests through when disabled", func() {
+		rec, err := NewRecorder(Disabled, cassettePath)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(rec.Wrap(http.DefaultTransport)).To(gomega.Equal(http.DefaultTransport))
+	})
+})
@@ -0,0 +1,252 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// AuthorizationHeader is the metadata key that contains the request token.
+const AuthorizationHeader = "authorization"
+
+// BearerPrefix is the prefix expected before the token in the authorization header.
+const BearerPrefix = "bearer "
+
+// Role defines the level of access granted to a token.
+type Role string
+
+// ReadOnlyRole allows to query the state of the operations.
+const ReadOnlyRole Role = "read-only"
+
+// InstallRole allows to launch install and uninstall operations, and includes ReadOnlyRole.
+const InstallRole Role = "install"
+
+// RoleFromString maps the role names found in API key files and JWT claims.
+var RoleFromString = map[string]Role{
+	"read-only": ReadOnlyRole,
+	"readonly":  ReadOnlyRole,
+	"install":   InstallRole,
+}
+
+// MethodRoles contains the role required to invoke each method of the installer service. Methods that are not
+// listed require InstallRole.
+var MethodRoles = map[string]Role{
+	"InstallCluster":      InstallRole,
+	"UninstallCluster":    InstallRole,
+	"RemoveInstall":       InstallRole,
+	"CheckProgress":       ReadOnlyRole,
+	"ListTemplates":       ReadOnlyRole,
+	"GetInstallLogs":      ReadOnlyRole,
+	"CreateJoinToken":     InstallRole,
+	"InstallClusterBatch": InstallRole,
+	"GetBatchProgress":    ReadOnlyRole,
+	"ListInstalls":        ReadOnlyRole,
+	"GetCommandProgress":  ReadOnlyRole,
+}
+
+// PublicMethods contains the methods that do not require a token as the request carries its own credential.
+var PublicMethods = map[string]bool{
+	"GetInstallPlan": true,
+}
+
+// PublicServices contains the services that do not require a token, such as the health checks used by the probes.
+var PublicServices = map[string]bool{
+	"grpc.health.v1.Health": true,
+}
+
+// AnonymousSubject is the subject of the identity attached to the requests of public methods.
+const AnonymousSubject = "anonymous"
+
+// Allows checks if the current role grants access to methods requiring the target role.
+func (r Role) Allows(target Role) bool {
+	if r == InstallRole {
+		return true
+	}
+	return r == target
+}
+
+// Identity contains the information extracted from a validated token.
+type Identity struct {
+	// Subject identifying the caller.
+	Subject string
+	// Role granted to the caller.
+	Role Role
+	// OrganizationID restricts the caller to the operations of an organization, empty to access all of them.
+	OrganizationID string
+}
+
+// CanAccess checks if the caller is allowed to access the operations of an organization.
+func (i *Identity) CanAccess(organizationID string) bool {
+	return i.OrganizationID == "" || i.OrganizationID == organizationID
+}
+
+type identityKey struct{}
+
+// IdentityFromContext retrieves the identity attached by the interceptor.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok
+}
+
+// APIKey structure with the information of a static API key.
+type APIKey struct {
+	// Key with the token value.
+	Key string `json:"key"`
+	// Role associated with the key.
+	Role string `json:"role"`
+	// Description of the key owner.
+	Description string `json:"description"`
+	// OrganizationID restricts the key to the operations of an organization, empty to access all of them.
+	OrganizationID string `json:"organization_id,omitempty"`
+}
+
+// APIKeysFile structure of the JSON file with the API keys.
+type APIKeysFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// Interceptor validating the tokens of the incoming requests.
+type Interceptor struct {
+	apiKeys map[string]Identity
+	jwt     *JWTValidator
+}
+
+// NewInterceptor creates an authentication interceptor.
+//   params:
+//     apiKeysPath The path of the file with the API keys, empty to disable API keys.
+//     jwtSecret The secret to validate JWT tokens, empty to disable JWT validation.
+//   returns:
+//     An Interceptor.
+//     An error if the API keys cannot be loaded.
+func NewInterceptor(apiKeysPath string, jwtSecret string) (*Interceptor, derrors.Error) {
+	result := &Interceptor{apiKeys: make(map[string]Identity, 0)}
+	if apiKeysPath != "" {
+		keys, err := LoadAPIKeys(apiKeysPath)
+		if err != nil {
+			return nil, err
+		}
+		result.apiKeys = keys
+	}
+	if jwtSecret != "" {
+		result.jwt = NewJWTValidator(jwtSecret)
+	}
+	return result, nil
+}
+
+// LoadAPIKeys reads the API keys file.
+func LoadAPIKeys(apiKeysPath string) (map[string]Identity, derrors.Error) {
+	content, err := ioutil.ReadFile(apiKeysPath)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot read API keys file")
+	}
+	var file APIKeysFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot unmarshal API keys file", err)
+	}
+	result := make(map[string]Identity, len(file.Keys))
+	for _, key := range file.Keys {
+		role, found := RoleFromString[strings.ToLower(key.Role)]
+		if !found {
+			return nil, derrors.NewInvalidArgumentError("invalid role in API keys file").WithParams(key.Description, key.Role)
+		}
+		if key.Key == "" {
+			return nil, derrors.NewInvalidArgumentError("empty API key").WithParams(key.Description)
+		}
+		result[key.Key] = Identity{Subject: key.Description, Role: role, OrganizationID: key.OrganizationID}
+	}
+	return result, nil
+}
+
+// Unary returns the gRPC unary interceptor.
+func (i *Interceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		identity, err := i.Authorize(ctx, info.FullMethod)
+		if err != nil {
+			log.Warn().Str("method", info.FullMethod).Msg(err.Error())
+			return nil, conversions.ToGRPCError(err)
+		}
+		return handler(context.WithValue(ctx, identityKey{}, identity), req)
+	}
+}
+
+// Authorize checks that the token in the context grants access to the given method.
+func (i *Interceptor) Authorize(ctx context.Context, fullMethod string) (*Identity, derrors.Error) {
+	if PublicMethods[path.Base(fullMethod)] || PublicServices[strings.TrimPrefix(path.Dir(fullMethod), "/")] {
+		return &Identity{Subject: AnonymousSubject}, nil
+	}
+	token, err := extractToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := i.validate(token)
+	if err != nil {
+		return nil, err
+	}
+	required, found := MethodRoles[path.Base(fullMethod)]
+	if !found {
+		required = InstallRole
+	}
+	if !identity.Role.Allows(required) {
+		return nil, derrors.NewPermissionDeniedError("role does not allow access to method").WithParams(identity.Role, fullMethod)
+	}
+	return identity, nil
+}
+
+func (i *Interceptor) validate(token string) (*Identity, derrors.Error) {
+	if identity, found := i.apiKeys[token]; found {
+		return &identity, nil
+	}
+	if i.jwt != nil && strings.Count(token, ".") == 2 {
+		claims, err := i.jwt.Validate(token)
+		if err != nil {
+			return nil, err
+		}
+		role, found := RoleFromString[strings.ToLower(claims.Role)]
+		if !found {
+			return nil, derrors.NewPermissionDeniedError("invalid role in token").WithParams(claims.Role)
+		}
+		return &Identity{Subject: claims.Subject, Role: role, OrganizationID: claims.OrganizationID}, nil
+	}
+	return nil, derrors.NewUnauthenticatedError("invalid token")
+}
+
+// extractToken retrieves the bearer token from the request metadata.
+func extractToken(ctx context.Context) (string, derrors.Error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", derrors.NewUnauthenticatedError("request does not contain metadata")
+	}
+	values := md.Get(AuthorizationHeader)
+	if len(values) == 0 || values[0] == "" {
+		return "", derrors.NewUnauthenticatedError("authorization token not found")
+	}
+	token := values[0]
+	if strings.HasPrefix(strings.ToLower(token), BearerPrefix) {
+		token = token[len(BearerPrefix):]
+	}
+	return strings.TrimSpace(token), nil
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package auth
+
+import (
+	"context"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc/metadata"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const testAPIKeys = `{"keys":[
+{"key":"install-key","role":"install","description":"admin"},
+{"key":"read-key","role":"read-only","description":"monitor"},
+{"key":"org-key","role":"install","description":"tenant","organization_id":"org1"}
+]}`
+
+const installMethod = "/installer.Installer/InstallCluster"
+const progressMethod = "/installer.Installer/CheckProgress"
+
+func withToken(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(AuthorizationHeader, "Bearer "+token))
+}
+
+var _ = ginkgo.Describe("Authentication interceptor", func() {
+
+	var keysFile string
+	var interceptor *Interceptor
+
+	ginkgo.BeforeEach(func() {
+		f, err := ioutil.TempFile("", "apikeys")
+		gomega.Expect(err).To(gomega.Succeed())
+		_, err = f.WriteString(testAPIKeys)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(f.Close()).To(gomega.Succeed())
+		keysFile = f.Name()
+		i, iErr := NewInterceptor(keysFile, "secret")
+		gomega.Expect(iErr).To(gomega.Succeed())
+		interceptor = i
+	})
+
+	ginkgo.AfterEach(func() {
+		os.Remove(keysFile)
+	})
+
+	ginkgo.It("should reject requests without token", func() {
+		_, err := interceptor.Authorize(context.Background(), installMethod)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should accept API keys with the required role", func() {
+		identity, err := interceptor.Authorize(withToken("install-key"), installMethod)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(identity.Role).Should(gomega.Equal(InstallRole))
+		_, err = interceptor.Authorize(withToken("read-key"), progressMethod)
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should deny read-only keys on install methods", func() {
+		_, err := interceptor.Authorize(withToken("read-key"), installMethod)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should not require a token on public methods", func() {
+		identity, err := interceptor.Authorize(context.Background(), "/installer.InstallerExtensions/GetInstallPlan")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(identity.Subject).Should(gomega.Equal(AnonymousSubject))
+		_, err = interceptor.Authorize(withToken("read-key"), "/installer.InstallerExtensions/CreateJoinToken")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should not require a token on the health checks", func() {
+		identity, err := interceptor.Authorize(context.Background(), "/grpc.health.v1.Health/Check")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(identity.Subject).Should(gomega.Equal(AnonymousSubject))
+		_, err = interceptor.Authorize(context.Background(), "/installer.Installer/Check")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should validate JWT tokens", func() {
+		validator := NewJWTValidator("secret")
+		token, err := validator.Sign(Claims{Subject: "user", Role: "install", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		gomega.Expect(err).To(gomega.Succeed())
+		identity, err := interceptor.Authorize(withToken(token), installMethod)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(identity.Subject).Should(gomega.Equal("user"))
+	})
+
+	ginkgo.It("should restrict the callers to their organization", func() {
+		identity, err := interceptor.Authorize(withToken("org-key"), installMethod)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(identity.CanAccess("org1")).To(gomega.BeTrue())
+		gomega.Expect(identity.CanAccess("org2")).To(gomega.BeFalse())
+		identity, err = interceptor.Authorize(withToken("install-key"), installMethod)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(identity.CanAccess("org2")).To(gomega.BeTrue())
+
+		token, sErr := NewJWTValidator("secret").Sign(Claims{Subject: "user", Role: "read-only", OrganizationID: "org2",
+			ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		gomega.Expect(sErr).To(gomega.Succeed())
+		identity, err = interceptor.Authorize(withToken(token), progressMethod)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(identity.OrganizationID).To(gomega.Equal("org2"))
+	})
+
+	ginkgo.It("should reject expired or tampered JWT tokens", func() {
+		validator := NewJWTValidator("other")
+		token, err := validator.Sign(Claims{Subject: "user", Role: "install"})
+		gomega.Expect(err).To(gomega.Succeed())
+		_, err = interceptor.Authorize(withToken(token), installMethod)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+
+		validator = NewJWTValidator("secret")
+		token, err = validator.Sign(Claims{Subject: "user", Role: "install", ExpiresAt: time.Now().Add(-time.Hour).Unix()})
+		gomega.Expect(err).To(gomega.Succeed())
+		_, err = interceptor.Authorize(withToken(token), installMethod)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+})
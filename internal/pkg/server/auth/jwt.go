@@ -0,0 +1,119 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/nalej/derrors"
+	"strings"
+	"time"
+)
+
+// HS256 is the only signing algorithm accepted by the validator.
+const HS256 = "HS256"
+
+// Claims contained in the installer JWT tokens.
+type Claims struct {
+	// Subject identifying the caller.
+	Subject string `json:"sub"`
+	// Role granted to the caller.
+	Role string `json:"role"`
+	// OrganizationID restricts the caller to the operations of an organization, empty to access all of them.
+	OrganizationID string `json:"organization_id,omitempty"`
+	// ExpiresAt with the expiration unix timestamp.
+	ExpiresAt int64 `json:"exp"`
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+}
+
+// JWTValidator checks the signature and expiration of HMAC signed tokens.
+type JWTValidator struct {
+	secret []byte
+}
+
+// NewJWTValidator creates a validator with the given shared secret.
+func NewJWTValidator(secret string) *JWTValidator {
+	return &JWTValidator{[]byte(secret)}
+}
+
+// Validate checks a token and returns its claims.
+func (v *JWTValidator) Validate(token string) (*Claims, derrors.Error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, derrors.NewUnauthenticatedError("malformed token")
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Algorithm != HS256 {
+		return nil, derrors.NewUnauthenticatedError("unsupported token algorithm").WithParams(header.Algorithm)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, derrors.NewUnauthenticatedError("malformed token signature", err)
+	}
+	if !hmac.Equal(signature, v.sign(parts[0]+"."+parts[1])) {
+		return nil, derrors.NewUnauthenticatedError("invalid token signature")
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims.ExpiresAt != 0 && time.Now().Unix() > claims.ExpiresAt {
+		return nil, derrors.NewUnauthenticatedError("token has expired")
+	}
+	return &claims, nil
+}
+
+// Sign creates a token with the given claims. It is intended for tooling and tests.
+func (v *JWTValidator) Sign(claims Claims) (string, derrors.Error) {
+	header, err := json.Marshal(jwtHeader{Algorithm: HS256, Type: "JWT"})
+	if err != nil {
+		return "", derrors.NewInternalError("cannot marshal token header", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", derrors.NewInternalError("cannot marshal token claims", err)
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(v.sign(unsigned)), nil
+}
+
+func (v *JWTValidator) sign(content string) []byte {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(content))
+	return mac.Sum(nil)
+}
+
+func decodeSegment(segment string, target interface{}) derrors.Error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return derrors.NewUnauthenticatedError("malformed token segment", err)
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		return derrors.NewUnauthenticatedError("malformed token segment", err)
+	}
+	return nil
+}
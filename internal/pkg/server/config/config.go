@@ -20,17 +20,63 @@ package config
 import (
 	"github.com/nalej/derrors"
 	"github.com/nalej/installer/internal/pkg/entities"
+	"github.com/nalej/installer/internal/pkg/server/notifications"
 	"github.com/nalej/installer/internal/pkg/utils"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/istio"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/logstack"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/provisioner"
 	"github.com/nalej/installer/version"
 	"github.com/rs/zerolog/log"
+	"net"
 	"os"
 	"strings"
+	"time"
 )
 
+// DefaultMaxLogEntries is the default number of log entries kept in memory per workflow.
+const DefaultMaxLogEntries = 10000
+
+// DefaultHistoryRetention is the default time the records of the finished installs are kept.
+const DefaultHistoryRetention = 30 * 24 * time.Hour
+
+// DefaultMaxHistoryRecords is the default number of records of finished installs kept.
+const DefaultMaxHistoryRecords = 1000
+
+// DefaultBatchConcurrency is the default number of installs of a batch running at the same time.
+const DefaultBatchConcurrency = 4
+
+// DefaultLeaderElectionNamespace is the namespace of the lease used to elect the leader of the installer replicas.
+const DefaultLeaderElectionNamespace = "nalej"
+
+// DefaultLeaderElectionLease is the default duration of the lease of the leader.
+const DefaultLeaderElectionLease = 15 * time.Second
+
+// MinLeaderElectionLease is the minimum duration of the lease of the leader.
+const MinLeaderElectionLease = 3 * time.Second
+
 type Config struct {
 	// Address where the API service will listen requests.
-	Port                  int
-	ComponentsPath        string
+	Port           int
+	ComponentsPath string
+	// ComponentsPublicKeyPath contains the key used to verify the signature of the components.
+	ComponentsPublicKeyPath string
+	// RegistriesPath contains the registries used to pull the images of the components.
+	RegistriesPath string
+	// SecretStorePath contains the external secret store backing the secrets created by the installer.
+	SecretStorePath string
+	// NamespaceGovernancePath contains the labels, limits and quotas of the platform namespaces by environment.
+	NamespaceGovernancePath string
+	// CRDsPath contains the custom resource definitions created before launching the components.
+	CRDsPath string
+	// StorageClassesPath contains the storage classes of the persistent volumes and claims of the components.
+	StorageClassesPath string
+	// ComponentsUsername contains the user to download a remote components bundle.
+	ComponentsUsername string
+	// ComponentsPassword contains the password to download a remote components bundle.
+	ComponentsPassword string
+	// ConfPath contains the configuration files such as additional workflow templates.
+	ConfPath              string
 	BinaryPath            string
 	TempPath              string
 	ManagementClusterHost string
@@ -44,6 +90,121 @@ type Config struct {
 	ClusterCertIssuerCACertPath string
 	NetworkingMode        entities.NetworkingMode
 	IstioPath             string
+	// IstioRevision contains the revision of the control plane whose sidecar injector is used.
+	IstioRevision string
+	// IstioTrustDomain contains the SPIFFE trust domain of the mesh, cluster.local if empty.
+	IstioTrustDomain string
+	// IstioNamespace contains the namespace where Istio is installed, istio-system if empty.
+	IstioNamespace string
+	// IstioIngressGateway contains the name of the service of the Istio ingress gateway, istio-ingressgateway if empty.
+	IstioIngressGateway string
+	// IstioCASecret contains the name of the secret with the CAs of Istio, cacerts if empty.
+	IstioCASecret string
+	// IstioGatewayIP contains the IP of the Istio ingress gateway used by the application clusters, looked up in the
+	// cluster where the installer runs if empty.
+	IstioGatewayIP string
+	// IngressController contains the ingress controller of the clusters, chosen from the networking mode if empty.
+	IngressController string
+	// ClusterDomain contains the DNS domain of the services of the management cluster, cluster.local if empty.
+	ClusterDomain string
+	// IngressCertificate contains the namespace/name of the secret with the wildcard certificate copied to the
+	// application clusters.
+	IngressCertificate string
+	// CertificateIssuer contains the mode issuing the ingress certificates of the management cluster, letsencrypt or
+	// internal, sent to the application clusters.
+	CertificateIssuer string
+	// CertificateCheckInterval contains the time between the checks of the certificates created by the installer.
+	// Zero disables the checks.
+	CertificateCheckInterval time.Duration
+	// CertificateRenewBefore contains the time before the expiration when certificates are renewed or reported.
+	CertificateRenewBefore string
+	// RenewCertificates indicates if the self-signed certificates about to expire must be renewed.
+	RenewCertificates bool
+	// LeaderElection indicates if the replicas of the installer elect a leader, which is the only one executing
+	// workflows.
+	LeaderElection bool
+	// LeaderElectionNamespace contains the namespace of the lease and of the state shared among the replicas.
+	LeaderElectionNamespace string
+	// LeaderElectionLease contains the duration of the lease of the leader.
+	LeaderElectionLease time.Duration
+	// TLSEnabled indicates that the gRPC server must use transport security.
+	TLSEnabled bool
+	// TLSCertPath contains the path of the server certificate. A self-signed one is generated if empty.
+	TLSCertPath string
+	// TLSKeyPath contains the path of the server private key.
+	TLSKeyPath string
+	// TLSClientCAPath contains the CA used to validate client certificates. Setting it enables mutual TLS.
+	TLSClientCAPath string
+	// AuthEnabled indicates that incoming requests must contain a valid token.
+	AuthEnabled bool
+	// APIKeysPath contains the path of a JSON file with the API keys and their associated roles.
+	APIKeysPath string
+	// JWTSecret contains the secret used to validate JWT tokens.
+	JWTSecret string
+	// OperationsPerMinute contains the number of install/uninstall requests accepted per organization. Zero disables
+	// rate limiting.
+	OperationsPerMinute int
+	// OperationsBurst contains the number of requests an organization may send at once.
+	OperationsBurst int
+	// LogsPath contains the directory where the logs of each workflow are stored. Logs are only kept in memory
+	// if empty.
+	LogsPath string
+	// MaxLogEntries contains the number of log entries kept in memory per workflow.
+	MaxLogEntries int
+	// HistoryPath contains the file where the records of the finished installs are kept. Records are only kept in
+	// memory if empty.
+	HistoryPath string
+	// HistoryRetention contains the time the records of the finished installs are kept, zero to keep them until
+	// MaxHistoryRecords is reached.
+	HistoryRetention time.Duration
+	// MaxHistoryRecords contains the number of records of finished installs kept, zero for no limit.
+	MaxHistoryRecords int
+	// BatchConcurrency contains the maximum number of installs of a batch running at the same time.
+	BatchConcurrency int
+	// MaxInstallsPerOrganization contains the maximum number of installs and uninstalls of an organization running at
+	// the same time, zero for no limit.
+	MaxInstallsPerOrganization int
+	// KubeQPS contains the number of queries per second sent to the Kubernetes API by the commands that do not
+	// define it.
+	KubeQPS float32
+	// KubeBurst contains the number of queries sent at once to the Kubernetes API by the commands that do not
+	// define it.
+	KubeBurst int
+	// HardenNetwork indicates if the installed clusters must restrict the traffic into the platform namespaces
+	// through network policies.
+	HardenNetwork bool
+	// WithObservability indicates if the monitoring and tracing stack must be installed on the clusters.
+	WithObservability bool
+	// LoggingStack contains the name of the stack collecting the logs of the platform namespaces, none if empty.
+	LoggingStack string
+	// StorageProvisioner contains the name of the provisioner of persistent volumes installed on the platforms
+	// without one, none if empty.
+	StorageProvisioner string
+	// NFSShare contains the share used by the NFS provisioner with the server:/path format.
+	NFSShare string
+	// LogRetention contains the duration the logs are kept by the logging stack.
+	LogRetention string
+	// LogStorageSize contains the size of the volume storing the logs.
+	LogStorageSize string
+	// Prune indicates if the components of previous installs that are no longer part of the components directory
+	// must be removed.
+	Prune bool
+	// AdoptExisting indicates if the existing components not created by the installer are taken over by the installs.
+	AdoptExisting bool
+	// MigrateVolumes indicates if the claims whose size is increased and whose volumes cannot be expanded are
+	// migrated to new claims by the installs.
+	MigrateVolumes bool
+	// FeatureFlags contains the feature flags of the installs exposed to the components that request them.
+	FeatureFlags map[string]string
+	// AllowUnsupportedVersions indicates if the installs continue when the versions are not part of the
+	// compatibility matrix.
+	AllowUnsupportedVersions bool
+	// PluginsPath contains the directory with the executables registered as additional workflow commands.
+	PluginsPath string
+	// RestrictedCrypto indicates if only the approved key sizes, algorithms and TLS cipher suites can be used.
+	RestrictedCrypto bool
+	// Notifications contains the destinations notified when the installs and uninstalls start, succeed or fail.
+	Notifications notifications.Config
 }
 
 func NewConfiguration(
@@ -98,6 +259,42 @@ func (conf *Config) Validate() derrors.Error {
 	if err := conf.CheckPath(conf.ComponentsPath); err != nil {
 		return derrors.NewInvalidArgumentError("componentsPath").CausedBy(err)
 	}
+	if conf.ComponentsPublicKeyPath != "" {
+		conf.ComponentsPublicKeyPath = utils.GetPath(conf.ComponentsPublicKeyPath)
+		if err := conf.CheckPath(conf.ComponentsPublicKeyPath); err != nil {
+			return derrors.NewInvalidArgumentError("componentsPublicKey").CausedBy(err)
+		}
+	}
+	if conf.RegistriesPath != "" {
+		conf.RegistriesPath = utils.GetPath(conf.RegistriesPath)
+		if err := conf.CheckPath(conf.RegistriesPath); err != nil {
+			return derrors.NewInvalidArgumentError("registriesPath").CausedBy(err)
+		}
+	}
+	if conf.NamespaceGovernancePath != "" {
+		conf.NamespaceGovernancePath = utils.GetPath(conf.NamespaceGovernancePath)
+		if err := conf.CheckPath(conf.NamespaceGovernancePath); err != nil {
+			return derrors.NewInvalidArgumentError("namespaceGovernancePath").CausedBy(err)
+		}
+	}
+	if conf.CRDsPath != "" {
+		conf.CRDsPath = utils.GetPath(conf.CRDsPath)
+		if err := conf.CheckPath(conf.CRDsPath); err != nil {
+			return derrors.NewInvalidArgumentError("crdsPath").CausedBy(err)
+		}
+	}
+	if conf.StorageClassesPath != "" {
+		conf.StorageClassesPath = utils.GetPath(conf.StorageClassesPath)
+		if err := conf.CheckPath(conf.StorageClassesPath); err != nil {
+			return derrors.NewInvalidArgumentError("storageClassesPath").CausedBy(err)
+		}
+	}
+	if conf.SecretStorePath != "" {
+		conf.SecretStorePath = utils.GetPath(conf.SecretStorePath)
+		if err := conf.CheckPath(conf.SecretStorePath); err != nil {
+			return derrors.NewInvalidArgumentError("secretStorePath").CausedBy(err)
+		}
+	}
 	if err := conf.CheckPath(conf.BinaryPath); err != nil {
 		return derrors.NewInvalidArgumentError("binaryPath").CausedBy(err)
 	}
@@ -105,6 +302,10 @@ func (conf *Config) Validate() derrors.Error {
 		return derrors.NewInvalidArgumentError("tempPath").CausedBy(err)
 	}
 
+	if conf.ConfPath != "" {
+		conf.ConfPath = utils.GetPath(conf.ConfPath)
+	}
+
 	if err := conf.Environment.Validate(); err != nil {
 		return err
 	}
@@ -133,7 +334,159 @@ func (conf *Config) Validate() derrors.Error {
 	if conf.NetworkingMode == entities.NetworkingModeIstio && conf.IstioPath == "" {
 		return derrors.NewInvalidArgumentError("IstioPath must be set if Istio networking mode is chosen")
 	}
+	if err := conf.validateSecurity(); err != nil {
+		return err
+	}
+	if conf.OperationsPerMinute < 0 || conf.OperationsBurst < 0 {
+		return derrors.NewInvalidArgumentError("rate limiting options cannot be negative")
+	}
+	if conf.MaxLogEntries <= 0 {
+		return derrors.NewInvalidArgumentError("maxLogEntries must be positive")
+	}
+	if conf.HistoryRetention < 0 || conf.MaxHistoryRecords < 0 {
+		return derrors.NewInvalidArgumentError("history retention options cannot be negative")
+	}
+	if conf.HistoryPath != "" {
+		conf.HistoryPath = utils.GetPath(conf.HistoryPath)
+	}
+	if conf.BatchConcurrency <= 0 {
+		return derrors.NewInvalidArgumentError("batchConcurrency must be positive")
+	}
+	if conf.MaxInstallsPerOrganization < 0 {
+		return derrors.NewInvalidArgumentError("maxInstallsPerOrganization cannot be negative")
+	}
+	if conf.LogsPath != "" {
+		conf.LogsPath = utils.GetPath(conf.LogsPath)
+	}
+	if conf.KubeQPS <= 0 || conf.KubeBurst <= 0 {
+		return derrors.NewInvalidArgumentError("kubeQPS and kubeBurst must be positive")
+	}
+	if conf.PluginsPath != "" {
+		conf.PluginsPath = utils.GetPath(conf.PluginsPath)
+		if err := conf.CheckPath(conf.PluginsPath); err != nil {
+			return derrors.NewInvalidArgumentError("pluginsPath").CausedBy(err)
+		}
+	}
+	if conf.LoggingStack != "" {
+		if conf.LoggingStack != logstack.LokiStack && conf.LoggingStack != logstack.EFKStack {
+			return derrors.NewInvalidArgumentError("unsupported loggingStack").WithParams(conf.LoggingStack)
+		}
+		if _, err := logstack.RetentionDays(conf.LogRetention); err != nil {
+			return derrors.NewInvalidArgumentError("logRetention").CausedBy(err)
+		}
+	}
+	if conf.StorageProvisioner != "" {
+		if conf.StorageProvisioner != provisioner.LocalPathProvisioner && conf.StorageProvisioner != provisioner.NFSProvisioner {
+			return derrors.NewInvalidArgumentError("unsupported storageProvisioner").WithParams(conf.StorageProvisioner)
+		}
+		if conf.StorageProvisioner == provisioner.NFSProvisioner {
+			if _, _, err := provisioner.ParseNFSShare(conf.NFSShare); err != nil {
+				return derrors.NewInvalidArgumentError("nfsShare").CausedBy(err)
+			}
+		}
+	}
+	if conf.IstioTrustDomain != "" {
+		if err := istio.ValidateTrustDomain(conf.IstioTrustDomain); err != nil {
+			return derrors.NewInvalidArgumentError("istioTrustDomain").CausedBy(err)
+		}
+	}
+	istioNames := map[string]string{
+		"istioNamespace":      conf.IstioNamespace,
+		"istioIngressGateway": conf.IstioIngressGateway,
+		"istioCASecret":       conf.IstioCASecret,
+	}
+	if conf.IstioGatewayIP != "" && net.ParseIP(conf.IstioGatewayIP) == nil {
+		return derrors.NewInvalidArgumentError("istioGatewayIP must be an IP address").WithParams(conf.IstioGatewayIP)
+	}
+	for flag, name := range istioNames {
+		if name != "" {
+			if err := istio.ValidateResourceName(name); err != nil {
+				return derrors.NewInvalidArgumentError(flag).CausedBy(err)
+			}
+		}
+	}
+	if conf.IngressController != "" {
+		if err := k8s.ValidateIngressController(conf.IngressController); err != nil {
+			return derrors.NewInvalidArgumentError("ingressController").CausedBy(err)
+		}
+	}
+	if err := k8s.ValidateFeatureFlags(conf.FeatureFlags); err != nil {
+		return derrors.NewInvalidArgumentError("featureFlag").CausedBy(err)
+	}
+	if conf.ClusterDomain != "" {
+		if err := k8s.ValidateClusterDomain(conf.ClusterDomain); err != nil {
+			return derrors.NewInvalidArgumentError("clusterDomain").CausedBy(err)
+		}
+	}
+	if conf.IngressCertificate != "" {
+		if _, _, err := k8s.SplitSecretReference(conf.IngressCertificate); err != nil {
+			return derrors.NewInvalidArgumentError("ingressCertificate").CausedBy(err)
+		}
+	}
+	if err := k8s.ValidateCertificateIssuer(conf.CertificateIssuer); err != nil {
+		return derrors.NewInvalidArgumentError("certificateIssuer").CausedBy(err)
+	}
+	if conf.CertificateCheckInterval < 0 {
+		return derrors.NewInvalidArgumentError("certificateCheckInterval cannot be negative")
+	}
+	if conf.CertificateCheckInterval > 0 {
+		if _, err := k8s.ParseRenewBefore(conf.CertificateRenewBefore); err != nil {
+			return derrors.NewInvalidArgumentError("certificateRenewBefore").CausedBy(err)
+		}
+	}
+	if conf.LeaderElection {
+		if conf.LeaderElectionNamespace == "" {
+			return derrors.NewInvalidArgumentError("leaderElectionNamespace must be set if leader election is enabled")
+		}
+		if conf.LeaderElectionLease < MinLeaderElectionLease {
+			return derrors.NewInvalidArgumentError("leaderElectionLease is too short").WithParams(MinLeaderElectionLease.String())
+		}
+	}
+	if conf.RestrictedCrypto && conf.ComponentsPublicKeyPath != "" {
+		return derrors.NewInvalidArgumentError("signed components use Ed25519, which is not allowed in restricted crypto mode")
+	}
+	if err := conf.Notifications.Validate(); err != nil {
+		return derrors.NewInvalidArgumentError("notifications").CausedBy(err)
+	}
+
+	return nil
+}
 
+// validateSecurity checks the transport security and authentication options.
+func (conf *Config) validateSecurity() derrors.Error {
+	if (conf.TLSCertPath == "") != (conf.TLSKeyPath == "") {
+		return derrors.NewInvalidArgumentError("tlsCertPath and tlsKeyPath must be set together")
+	}
+	if !conf.TLSEnabled && (conf.TLSCertPath != "" || conf.TLSClientCAPath != "") {
+		return derrors.NewInvalidArgumentError("TLS options require tls to be enabled")
+	}
+	if conf.TLSCertPath != "" {
+		conf.TLSCertPath = utils.GetPath(conf.TLSCertPath)
+		conf.TLSKeyPath = utils.GetPath(conf.TLSKeyPath)
+		if err := conf.CheckPath(conf.TLSCertPath); err != nil {
+			return derrors.NewInvalidArgumentError("tlsCertPath").CausedBy(err)
+		}
+		if err := conf.CheckPath(conf.TLSKeyPath); err != nil {
+			return derrors.NewInvalidArgumentError("tlsKeyPath").CausedBy(err)
+		}
+	}
+	if conf.TLSClientCAPath != "" {
+		conf.TLSClientCAPath = utils.GetPath(conf.TLSClientCAPath)
+		if err := conf.CheckPath(conf.TLSClientCAPath); err != nil {
+			return derrors.NewInvalidArgumentError("tlsClientCAPath").CausedBy(err)
+		}
+	}
+	if conf.AuthEnabled {
+		if conf.APIKeysPath == "" && conf.JWTSecret == "" {
+			return derrors.NewInvalidArgumentError("apiKeysPath or jwtSecret must be set if authentication is enabled")
+		}
+		if conf.APIKeysPath != "" {
+			conf.APIKeysPath = utils.GetPath(conf.APIKeysPath)
+			if err := conf.CheckPath(conf.APIKeysPath); err != nil {
+				return derrors.NewInvalidArgumentError("apiKeysPath").CausedBy(err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -141,7 +494,18 @@ func (conf *Config) Print() {
 	log.Info().Str("app", version.AppVersion).Str("commit", version.Commit).Msg("Version")
 	log.Info().Int("port", conf.Port).Msg("gRPC Service")
 	log.Info().Str("path", conf.ComponentsPath).Msg("Components")
+	log.Info().Str("path", conf.ComponentsPublicKeyPath).Msg("Components public key")
+	log.Info().Str("path", conf.RegistriesPath).Msg("Registries")
+	log.Info().Str("path", conf.SecretStorePath).Msg("Secret store")
+	log.Info().Str("path", conf.NamespaceGovernancePath).Msg("Namespace governance")
+	log.Info().Str("path", conf.CRDsPath).Msg("Custom resource definitions")
+	log.Info().Str("path", conf.StorageClassesPath).Msg("Storage classes")
+	if conf.ComponentsUsername != "" {
+		log.Info().Str("username", conf.ComponentsUsername).
+			Str("password", strings.Repeat("*", len(conf.ComponentsPassword))).Msg("Components bundle credentials")
+	}
 	log.Info().Str("path", conf.BinaryPath).Msg("Binaries")
+	log.Info().Str("path", conf.ConfPath).Msg("Configuration")
 	log.Info().Str("path", conf.TempPath).Msg("Temporal files")
 	log.Info().Str("host", conf.ManagementClusterHost).
 		Str("port", conf.ManagementClusterPort).Msg("Management cluster")
@@ -151,6 +515,44 @@ func (conf *Config) Print() {
 	log.Info().Str("path", conf.ClusterCertIssuerCACertPath).Msg("cluster cert issuer ca cert path")
 	log.Info().Interface("networkingMode", conf.NetworkingMode).Msg("networking mode")
 	log.Info().Str("path", conf.IstioPath).Msg("istio path")
+	log.Info().Str("revision", conf.IstioRevision).Msg("istio revision")
+	log.Info().Str("trustDomain", conf.IstioTrustDomain).Msg("istio trust domain")
+	log.Info().Str("namespace", conf.IstioNamespace).Str("ingressGateway", conf.IstioIngressGateway).
+		Str("caSecret", conf.IstioCASecret).Str("gatewayIP", conf.IstioGatewayIP).Msg("istio resources")
+	log.Info().Str("controller", conf.IngressController).Msg("ingress controller")
+	log.Info().Str("domain", conf.ClusterDomain).Msg("cluster domain")
+	log.Info().Str("secret", conf.IngressCertificate).Msg("ingress certificate")
+	log.Info().Str("issuer", conf.CertificateIssuer).Msg("certificate issuer")
+	log.Info().Str("interval", conf.CertificateCheckInterval.String()).Str("renewBefore", conf.CertificateRenewBefore).
+		Bool("renew", conf.RenewCertificates).Msg("Certificate check")
+	log.Info().Bool("enabled", conf.LeaderElection).Str("namespace", conf.LeaderElectionNamespace).
+		Str("lease", conf.LeaderElectionLease.String()).Msg("Leader election")
+	log.Info().Bool("enabled", conf.TLSEnabled).Str("cert", conf.TLSCertPath).
+		Str("clientCA", conf.TLSClientCAPath).Msg("TLS")
+	log.Info().Bool("enabled", conf.AuthEnabled).Str("apiKeys", conf.APIKeysPath).
+		Str("jwtSecret", strings.Repeat("*", len(conf.JWTSecret))).Msg("Authentication")
+	log.Info().Int("perMinute", conf.OperationsPerMinute).Int("burst", conf.OperationsBurst).Msg("Rate limiting")
+	log.Info().Str("path", conf.LogsPath).Int("maxEntries", conf.MaxLogEntries).Msg("Workflow logs")
+	log.Info().Str("path", conf.HistoryPath).Str("retention", conf.HistoryRetention.String()).
+		Int("maxRecords", conf.MaxHistoryRecords).Msg("Install history")
+	log.Info().Int("concurrency", conf.BatchConcurrency).Msg("Batch installs")
+	log.Info().Int("maxInstalls", conf.MaxInstallsPerOrganization).Msg("Organization quotas")
+	log.Info().Float32("qps", conf.KubeQPS).Int("burst", conf.KubeBurst).Msg("Kubernetes clients")
+	log.Info().Bool("enabled", conf.HardenNetwork).Msg("Network policies")
+	log.Info().Bool("enabled", conf.WithObservability).Msg("Observability stack")
+	log.Info().Str("provisioner", conf.StorageProvisioner).Str("nfsShare", conf.NFSShare).Msg("Storage provisioner")
+	log.Info().Str("stack", conf.LoggingStack).Str("retention", conf.LogRetention).
+		Str("storageSize", conf.LogStorageSize).Msg("Logging stack")
+	log.Info().Bool("enabled", conf.Prune).Msg("Prune components")
+	log.Info().Bool("enabled", conf.AdoptExisting).Msg("Adopt existing components")
+	log.Info().Bool("enabled", conf.MigrateVolumes).Msg("Migrate volumes")
+	log.Info().Interface("flags", conf.FeatureFlags).Msg("Feature flags")
+	log.Info().Bool("allowUnsupported", conf.AllowUnsupportedVersions).Msg("Compatibility check")
+	log.Info().Str("path", conf.PluginsPath).Msg("Command plugins")
+	log.Info().Bool("enabled", conf.RestrictedCrypto).Msg("Restricted crypto")
+	log.Info().Int("webhooks", len(conf.Notifications.Webhooks)).Int("slack", len(conf.Notifications.SlackWebhooks)).
+		Str("smtp", conf.Notifications.SMTPServer).Strs("emailTo", conf.Notifications.EmailTo).
+		Strs("events", conf.Notifications.Events).Msg("Notifications")
 
 	conf.Environment.Print()
 
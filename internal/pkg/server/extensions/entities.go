@@ -0,0 +1,280 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package extensions
+
+import (
+	"github.com/nalej/grpc-installer-go"
+	"time"
+)
+
+// ListTemplatesRequest to retrieve the available workflow templates.
+type ListTemplatesRequest struct {
+	// Name to filter the results, empty to return all templates.
+	Name string `json:"name"`
+	// OrganizationID to include the templates overridden by the organization, empty to use the one of the caller.
+	OrganizationID string `json:"organization_id"`
+}
+
+// TemplateInfo with the description of a workflow template.
+type TemplateInfo struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	Checksum    string `json:"sha256"`
+}
+
+// TemplateList with the available workflow templates.
+type TemplateList struct {
+	Templates []TemplateInfo `json:"templates"`
+}
+
+// GetInstallLogsRequest to retrieve a page of the logs of an install or uninstall.
+type GetInstallLogsRequest struct {
+	// RequestID with the identifier of the operation.
+	RequestID string `json:"request_id"`
+	// Offset with the index of the first entry to be returned.
+	Offset int `json:"offset"`
+	// Limit with the maximum number of entries to be returned.
+	Limit int `json:"limit"`
+	// Last with the number of latest entries to be returned, ignoring the offset and the limit if set.
+	Last int `json:"last"`
+}
+
+// LogEntry with a log line produced during an operation.
+type LogEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+}
+
+// InstallLogs with a page of the logs of an operation.
+type InstallLogs struct {
+	RequestID string     `json:"request_id"`
+	Entries   []LogEntry `json:"entries"`
+	// Total number of entries available.
+	Total int `json:"total"`
+	// NextOffset with the offset of the next page, equal to Total if there are no more entries.
+	NextOffset int `json:"next_offset"`
+}
+
+// CreateJoinTokenRequest to create a one-time token that an application cluster uses to retrieve its install plan.
+type CreateJoinTokenRequest struct {
+	// InstallRequest with the details of the install. The kubeconfig is not required as the installer runs
+	// inside the application cluster.
+	InstallRequest grpc_installer_go.InstallRequest `json:"install_request"`
+	// TemplateName with the workflow template to be used, empty to use the default one.
+	TemplateName string `json:"template_name"`
+	// TemplateVersion with the version of the template, empty to use the latest one.
+	TemplateVersion string `json:"template_version"`
+	// TTLSeconds with the validity of the token, zero to use the default one.
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+// JoinToken with a token that can be exchanged once for an install plan.
+type JoinToken struct {
+	Token     string    `json:"token"`
+	RequestID string    `json:"request_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// GetInstallPlanRequest to exchange a join token for the install plan of an application cluster.
+type GetInstallPlanRequest struct {
+	Token string `json:"token"`
+}
+
+// InstallPlan with the information required by an application cluster to install itself.
+type InstallPlan struct {
+	RequestID      string                           `json:"request_id"`
+	InstallRequest grpc_installer_go.InstallRequest `json:"install_request"`
+	// TemplateName with the name of the workflow template.
+	TemplateName string `json:"template_name"`
+	// TemplateVersion with the version of the workflow template.
+	TemplateVersion string `json:"template_version"`
+	// Template with the content of the workflow template.
+	Template              string `json:"template"`
+	ManagementClusterHost string `json:"management_cluster_host"`
+	ManagementClusterPort string `json:"management_cluster_port"`
+	DNSClusterHost        string `json:"dns_cluster_host"`
+	DNSClusterPort        string `json:"dns_cluster_port"`
+	TargetEnvironment     string `json:"target_environment"`
+	NetworkingMode        string `json:"networking_mode"`
+	IstioPath             string `json:"istio_path"`
+	IstioRevision         string `json:"istio_revision"`
+	IstioTrustDomain      string `json:"istio_trust_domain"`
+	IstioNamespace        string `json:"istio_namespace"`
+	IstioIngressGateway   string `json:"istio_ingress_gateway"`
+	IstioCASecret         string `json:"istio_ca_secret"`
+	IstioGatewayIP        string `json:"istio_gateway_ip"`
+	IngressController     string `json:"ingress_controller"`
+	AuthSecret            string `json:"auth_secret"`
+	// Platform of the cluster when it is not the target platform of the install request, such as OPENSHIFT.
+	Platform string `json:"platform"`
+	// CACert with the content of the certificate of the cluster certificate issuer.
+	CACert string `json:"ca_cert"`
+	// IngressCert and IngressKey with the wildcard certificate of the management cluster served by the ingresses
+	// of the application cluster.
+	IngressCert string `json:"ingress_cert"`
+	IngressKey  string `json:"ingress_key"`
+	// IngressCA with the CA that issued the ingress certificate, if it is not publicly trusted.
+	IngressCA string `json:"ingress_ca"`
+	// CertificateIssuer with the mode issuing the ingress certificates of the management cluster.
+	CertificateIssuer string `json:"certificate_issuer"`
+	HardenNetwork     bool   `json:"harden_network"`
+	Prune             bool   `json:"prune"`
+	// AdoptExisting indicates if the existing components not created by the installer are taken over.
+	AdoptExisting bool `json:"adopt_existing"`
+	// MigrateVolumes indicates if the claims whose volumes cannot be expanded are migrated to new claims.
+	MigrateVolumes bool `json:"migrate_volumes"`
+	// FeatureFlags contains the feature flags exposed to the components that request them.
+	FeatureFlags map[string]string `json:"feature_flags,omitempty"`
+	// WithObservability indicates if the monitoring and tracing stack is installed.
+	WithObservability bool `json:"with_observability"`
+	// LoggingStack with the stack collecting the logs of the platform namespaces, and its retention and storage.
+	LoggingStack   string `json:"logging_stack"`
+	LogRetention   string `json:"log_retention"`
+	LogStorageSize string `json:"log_storage_size"`
+	// StorageProvisioner with the provisioner of persistent volumes installed on the platforms without one, and the
+	// share of the NFS provisioner.
+	StorageProvisioner string `json:"storage_provisioner"`
+	NFSShare           string `json:"nfs_share"`
+	// AllowUnsupported indicates if the install continues when the versions are not part of the compatibility
+	// matrix.
+	AllowUnsupported bool `json:"allow_unsupported"`
+}
+
+// InstallClusterBatchRequest to install several application clusters of an organization.
+type InstallClusterBatchRequest struct {
+	OrganizationID string `json:"organization_id"`
+	// Requests with the install of each cluster. All of them must belong to the organization of the batch.
+	Requests []grpc_installer_go.InstallRequest `json:"requests"`
+	// TemplateName with the workflow template to be used, empty to use the default one.
+	TemplateName string `json:"template_name"`
+	// TemplateVersion with the version of the template, empty to use the latest one.
+	TemplateVersion string `json:"template_version"`
+	// Concurrency with the number of installs running at the same time, zero to use the limit of the installer.
+	Concurrency int `json:"concurrency"`
+}
+
+// GetBatchProgressRequest to retrieve the state of a batch of installs.
+type GetBatchProgressRequest struct {
+	BatchID string `json:"batch_id"`
+}
+
+// ClusterProgress with the state of the install of a cluster of a batch.
+type ClusterProgress struct {
+	RequestID string `json:"request_id"`
+	ClusterID string `json:"cluster_id"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BatchProgress with the aggregated state of a batch of installs.
+type BatchProgress struct {
+	BatchID        string `json:"batch_id"`
+	OrganizationID string `json:"organization_id"`
+	// Status with the state of the batch: INPROGRESS while any install is pending, SUCCESS if all of them
+	// succeeded, and FAILED otherwise.
+	Status      string            `json:"status"`
+	Concurrency int               `json:"concurrency"`
+	Pending     int               `json:"pending"`
+	Succeeded   int               `json:"succeeded"`
+	Failed      int               `json:"failed"`
+	Clusters    []ClusterProgress `json:"clusters"`
+	// ElapsedTime with the seconds since the batch was created.
+	ElapsedTime int64 `json:"elapsed_time"`
+}
+
+// ListInstallsRequest to retrieve a page of the finished installs and uninstalls.
+type ListInstallsRequest struct {
+	// OrganizationID to filter the results, empty to return all organizations.
+	OrganizationID string `json:"organization_id"`
+	// ClusterID to filter the results, empty to return all clusters.
+	ClusterID string `json:"cluster_id"`
+	// Status to filter the results, such as FAILED, empty to return all of them.
+	Status string `json:"status"`
+	// Offset with the index of the first record to be returned.
+	Offset int `json:"offset"`
+	// Limit with the maximum number of records to be returned.
+	Limit int `json:"limit"`
+}
+
+// InstallRecord with the outcome of a finished install or uninstall.
+type InstallRecord struct {
+	RequestID       string    `json:"request_id"`
+	OrganizationID  string    `json:"organization_id"`
+	ClusterID       string    `json:"cluster_id"`
+	OperationName   string    `json:"operation_name"`
+	TemplateName    string    `json:"template_name,omitempty"`
+	TemplateVersion string    `json:"template_version,omitempty"`
+	Status          string    `json:"status"`
+	Error           string    `json:"error,omitempty"`
+	Initiator       string    `json:"initiator,omitempty"`
+	Started         time.Time `json:"started"`
+	Finished        time.Time `json:"finished"`
+	DurationSeconds int64     `json:"duration_seconds"`
+}
+
+// InstallHistory with a page of the finished installs and uninstalls, from the newest to the oldest.
+type InstallHistory struct {
+	Installs []InstallRecord `json:"installs"`
+	// Total number of records satisfying the filter.
+	Total int `json:"total"`
+	// NextOffset with the offset of the next page, equal to Total if there are no more records.
+	NextOffset int `json:"next_offset"`
+}
+
+// GetCommandProgressRequest to retrieve a page of the commands executed by the workflow of an install or uninstall.
+type GetCommandProgressRequest struct {
+	// RequestID with the identifier of the operation.
+	RequestID string `json:"request_id"`
+	// FailedOnly to return only the commands that failed.
+	FailedOnly bool `json:"failed_only"`
+	// IncludeOutput to return the output of the commands, which is omitted otherwise to keep the responses small.
+	IncludeOutput bool `json:"include_output"`
+	// Offset with the index of the first command to be returned.
+	Offset int `json:"offset"`
+	// Limit with the maximum number of commands to be returned.
+	Limit int `json:"limit"`
+}
+
+// CommandProgress with the result of a command of a workflow.
+type CommandProgress struct {
+	// Index of the command in the workflow.
+	Index       int    `json:"index"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Success     bool   `json:"success"`
+	Output      string `json:"output,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Duration    string `json:"duration"`
+}
+
+// CommandPage with a page of the commands executed by the workflow of an operation.
+type CommandPage struct {
+	RequestID string `json:"request_id"`
+	// Status with the state of the operation.
+	Status string `json:"status"`
+	// WorkflowCommands with the number of commands of the workflow.
+	WorkflowCommands int `json:"workflow_commands"`
+	// Executed with the number of commands that have finished their execution.
+	Executed int               `json:"executed"`
+	Commands []CommandProgress `json:"commands"`
+	// Total number of executed commands satisfying the filter.
+	Total int `json:"total"`
+	// NextOffset with the offset of the next page, equal to Total if there are no more commands.
+	NextOffset int `json:"next_offset"`
+}
@@ -0,0 +1,323 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package extensions
+
+import (
+	"context"
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the full name of the extensions gRPC service.
+const ServiceName = "installer.InstallerExtensions"
+
+// ExtensionsServer is the server API of the extensions service.
+type ExtensionsServer interface {
+	// ListTemplates retrieves the workflow templates available in the installer.
+	ListTemplates(ctx context.Context, request *ListTemplatesRequest) (*TemplateList, error)
+	// GetInstallLogs retrieves a page of the logs captured for an install or uninstall.
+	GetInstallLogs(ctx context.Context, request *GetInstallLogsRequest) (*InstallLogs, error)
+	// CreateJoinToken creates a one-time token to be used by an application cluster to retrieve its install plan.
+	CreateJoinToken(ctx context.Context, request *CreateJoinTokenRequest) (*JoinToken, error)
+	// GetInstallPlan exchanges a join token for the install plan of an application cluster.
+	GetInstallPlan(ctx context.Context, request *GetInstallPlanRequest) (*InstallPlan, error)
+	// InstallClusterBatch triggers the installation of several application clusters of an organization.
+	InstallClusterBatch(ctx context.Context, request *InstallClusterBatchRequest) (*BatchProgress, error)
+	// GetBatchProgress gets the aggregated state of a batch of installs.
+	GetBatchProgress(ctx context.Context, request *GetBatchProgressRequest) (*BatchProgress, error)
+	// ListInstalls retrieves the finished installs and uninstalls, from the newest to the oldest.
+	ListInstalls(ctx context.Context, request *ListInstallsRequest) (*InstallHistory, error)
+	// GetCommandProgress retrieves a page of the commands executed by the workflow of an install or uninstall.
+	GetCommandProgress(ctx context.Context, request *GetCommandProgressRequest) (*CommandPage, error)
+}
+
+// RegisterExtensionsServer registers the extensions service in a gRPC server.
+func RegisterExtensionsServer(s *grpc.Server, srv ExtensionsServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+func listTemplatesHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTemplatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExtensionsServer).ListTemplates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/ListTemplates",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExtensionsServer).ListTemplates(ctx, req.(*ListTemplatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func getInstallLogsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInstallLogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExtensionsServer).GetInstallLogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/GetInstallLogs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExtensionsServer).GetInstallLogs(ctx, req.(*GetInstallLogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func createJoinTokenHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateJoinTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExtensionsServer).CreateJoinToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/CreateJoinToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExtensionsServer).CreateJoinToken(ctx, req.(*CreateJoinTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func getInstallPlanHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInstallPlanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExtensionsServer).GetInstallPlan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/GetInstallPlan",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExtensionsServer).GetInstallPlan(ctx, req.(*GetInstallPlanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func installClusterBatchHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InstallClusterBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExtensionsServer).InstallClusterBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/InstallClusterBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExtensionsServer).InstallClusterBatch(ctx, req.(*InstallClusterBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func getBatchProgressHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBatchProgressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExtensionsServer).GetBatchProgress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/GetBatchProgress",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExtensionsServer).GetBatchProgress(ctx, req.(*GetBatchProgressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func listInstallsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListInstallsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExtensionsServer).ListInstalls(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/ListInstalls",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExtensionsServer).ListInstalls(ctx, req.(*ListInstallsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func getCommandProgressHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCommandProgressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExtensionsServer).GetCommandProgress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/GetCommandProgress",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExtensionsServer).GetCommandProgress(ctx, req.(*GetCommandProgressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*ExtensionsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListTemplates",
+			Handler:    listTemplatesHandler,
+		},
+		{
+			MethodName: "GetInstallLogs",
+			Handler:    getInstallLogsHandler,
+		},
+		{
+			MethodName: "CreateJoinToken",
+			Handler:    createJoinTokenHandler,
+		},
+		{
+			MethodName: "GetInstallPlan",
+			Handler:    getInstallPlanHandler,
+		},
+		{
+			MethodName: "InstallClusterBatch",
+			Handler:    installClusterBatchHandler,
+		},
+		{
+			MethodName: "GetBatchProgress",
+			Handler:    getBatchProgressHandler,
+		},
+		{
+			MethodName: "ListInstalls",
+			Handler:    listInstallsHandler,
+		},
+		{
+			MethodName: "GetCommandProgress",
+			Handler:    getCommandProgressHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "extensions",
+}
+
+// ExtensionsClient is the client API of the extensions service.
+type ExtensionsClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewExtensionsClient creates a client of the extensions service.
+func NewExtensionsClient(cc *grpc.ClientConn) *ExtensionsClient {
+	return &ExtensionsClient{cc}
+}
+
+func (c *ExtensionsClient) invoke(ctx context.Context, method string, in interface{}, out interface{}, opts ...grpc.CallOption) error {
+	opts = append(opts, grpc.CallContentSubtype(CodecName))
+	return c.cc.Invoke(ctx, "/"+ServiceName+"/"+method, in, out, opts...)
+}
+
+// ListTemplates retrieves the workflow templates available in the installer.
+func (c *ExtensionsClient) ListTemplates(ctx context.Context, in *ListTemplatesRequest, opts ...grpc.CallOption) (*TemplateList, error) {
+	out := new(TemplateList)
+	if err := c.invoke(ctx, "ListTemplates", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetInstallLogs retrieves a page of the logs captured for an install or uninstall.
+func (c *ExtensionsClient) GetInstallLogs(ctx context.Context, in *GetInstallLogsRequest, opts ...grpc.CallOption) (*InstallLogs, error) {
+	out := new(InstallLogs)
+	if err := c.invoke(ctx, "GetInstallLogs", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateJoinToken creates a one-time token to be used by an application cluster to retrieve its install plan.
+func (c *ExtensionsClient) CreateJoinToken(ctx context.Context, in *CreateJoinTokenRequest, opts ...grpc.CallOption) (*JoinToken, error) {
+	out := new(JoinToken)
+	if err := c.invoke(ctx, "CreateJoinToken", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetInstallPlan exchanges a join token for the install plan of an application cluster.
+func (c *ExtensionsClient) GetInstallPlan(ctx context.Context, in *GetInstallPlanRequest, opts ...grpc.CallOption) (*InstallPlan, error) {
+	out := new(InstallPlan)
+	if err := c.invoke(ctx, "GetInstallPlan", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// InstallClusterBatch triggers the installation of several application clusters of an organization.
+func (c *ExtensionsClient) InstallClusterBatch(ctx context.Context, in *InstallClusterBatchRequest, opts ...grpc.CallOption) (*BatchProgress, error) {
+	out := new(BatchProgress)
+	if err := c.invoke(ctx, "InstallClusterBatch", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetBatchProgress gets the aggregated state of a batch of installs.
+func (c *ExtensionsClient) GetBatchProgress(ctx context.Context, in *GetBatchProgressRequest, opts ...grpc.CallOption) (*BatchProgress, error) {
+	out := new(BatchProgress)
+	if err := c.invoke(ctx, "GetBatchProgress", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListInstalls retrieves the finished installs and uninstalls, from the newest to the oldest.
+func (c *ExtensionsClient) ListInstalls(ctx context.Context, in *ListInstallsRequest, opts ...grpc.CallOption) (*InstallHistory, error) {
+	out := new(InstallHistory)
+	if err := c.invoke(ctx, "ListInstalls", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetCommandProgress retrieves a page of the commands executed by the workflow of an install or uninstall.
+func (c *ExtensionsClient) GetCommandProgress(ctx context.Context, in *GetCommandProgressRequest, opts ...grpc.CallOption) (*CommandPage, error) {
+	out := new(CommandPage)
+	if err := c.invoke(ctx, "GetCommandProgress", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
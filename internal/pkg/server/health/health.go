@@ -0,0 +1,134 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package health reports the status of the subsystems of the installer service through the standard gRPC health
+// service, so it can be checked by the probes of Kubernetes and by tools such as grpcurl.
+
+package health
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// OverallService is the service name of the status of the whole server, serving once all the subsystems are ready.
+const OverallService = ""
+
+// ManagerSubsystem is the service name of the status of the install manager and its workflow templates.
+const ManagerSubsystem = "installer.manager"
+
+// StateSubsystem is the service name of the status of the store of the state shared among the replicas.
+const StateSubsystem = "installer.state"
+
+// DefaultCheckInterval is the default time between the checks of the watched subsystems.
+const DefaultCheckInterval = 30 * time.Second
+
+// Reporter keeps the status of the subsystems in the gRPC health service.
+type Reporter struct {
+	sync.Mutex
+	server *grpchealth.Server
+	ready  map[string]bool
+}
+
+// NewReporter creates a reporter with the given subsystems, all of them not serving until they are ready.
+//   params:
+//     subsystems The service names of the subsystems.
+//   returns:
+//     A Reporter.
+func NewReporter(subsystems ...string) *Reporter {
+	reporter := &Reporter{server: grpchealth.NewServer(), ready: make(map[string]bool, len(subsystems))}
+	for _, subsystem := range subsystems {
+		reporter.ready[subsystem] = false
+		reporter.server.SetServingStatus(subsystem, grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	}
+	reporter.server.SetServingStatus(OverallService, grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	return reporter
+}
+
+// Register adds the health service to a gRPC server.
+func (r *Reporter) Register(server *grpc.Server) {
+	grpc_health_v1.RegisterHealthServer(server, r.server)
+}
+
+// servingStatus converts the readiness of a subsystem into its gRPC health status.
+func servingStatus(ready bool) grpc_health_v1.HealthCheckResponse_ServingStatus {
+	if ready {
+		return grpc_health_v1.HealthCheckResponse_SERVING
+	}
+	return grpc_health_v1.HealthCheckResponse_NOT_SERVING
+}
+
+// SetReady updates the status of a subsystem and the overall status of the server.
+//   params:
+//     subsystem The service name of the subsystem.
+//     ready Whether the subsystem is ready.
+func (r *Reporter) SetReady(subsystem string, ready bool) {
+	r.Lock()
+	defer r.Unlock()
+	if previous, found := r.ready[subsystem]; found && previous != ready {
+		log.Info().Str("subsystem", subsystem).Bool("ready", ready).Msg("health status changed")
+	}
+	r.ready[subsystem] = ready
+	r.server.SetServingStatus(subsystem, servingStatus(ready))
+	r.server.SetServingStatus(OverallService, servingStatus(r.unsafeReady()))
+}
+
+// unsafeReady checks if all the subsystems are ready.
+func (r *Reporter) unsafeReady() bool {
+	for _, ready := range r.ready {
+		if !ready {
+			return false
+		}
+	}
+	return true
+}
+
+// Ready checks if all the subsystems are ready.
+func (r *Reporter) Ready() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.unsafeReady()
+}
+
+// Watch checks a subsystem periodically, updating its status with the result, until the stop channel is closed.
+//   params:
+//     subsystem The service name of the subsystem.
+//     check The function checking the subsystem, returning an error if it is not ready.
+//     interval The time between the checks.
+//     stop The channel closed to stop watching.
+func (r *Reporter) Watch(subsystem string, check func() derrors.Error, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := check()
+		if err != nil {
+			log.Warn().Str("subsystem", subsystem).Str("trace", err.DebugReport()).Msg("subsystem is not ready")
+		}
+		r.SetReady(subsystem, err == nil)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
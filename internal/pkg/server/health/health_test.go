@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package health
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var _ = ginkgo.Describe("Health reporter", func() {
+
+	status := func(reporter *Reporter, service string) grpc_health_v1.HealthCheckResponse_ServingStatus {
+		response, err := reporter.server.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: service})
+		gomega.Expect(err).To(gomega.Succeed())
+		return response.Status
+	}
+
+	ginkgo.It("should serve once all the subsystems are ready", func() {
+		reporter := NewReporter(ManagerSubsystem, StateSubsystem)
+		gomega.Expect(status(reporter, OverallService)).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING))
+		gomega.Expect(status(reporter, ManagerSubsystem)).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING))
+
+		reporter.SetReady(ManagerSubsystem, true)
+		gomega.Expect(status(reporter, ManagerSubsystem)).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_SERVING))
+		gomega.Expect(status(reporter, OverallService)).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING))
+		gomega.Expect(reporter.Ready()).To(gomega.BeFalse())
+
+		reporter.SetReady(StateSubsystem, true)
+		gomega.Expect(status(reporter, OverallService)).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_SERVING))
+		gomega.Expect(reporter.Ready()).To(gomega.BeTrue())
+
+		reporter.SetReady(StateSubsystem, false)
+		gomega.Expect(status(reporter, StateSubsystem)).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING))
+		gomega.Expect(status(reporter, OverallService)).To(gomega.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING))
+	})
+
+	ginkgo.It("should report the result of the checks of a watched subsystem", func() {
+		reporter := NewReporter(StateSubsystem)
+		var available int32
+		check := func() derrors.Error {
+			if atomic.LoadInt32(&available) == 0 {
+				return derrors.NewUnavailableError("cannot retrieve shared state")
+			}
+			return nil
+		}
+		stop := make(chan struct{})
+		defer close(stop)
+		go reporter.Watch(StateSubsystem, check, 5*time.Millisecond, stop)
+
+		gomega.Consistently(func() bool { return reporter.Ready() }, 30*time.Millisecond).Should(gomega.BeFalse())
+		atomic.StoreInt32(&available, 1)
+		gomega.Eventually(func() bool { return reporter.Ready() }).Should(gomega.BeTrue())
+		atomic.StoreInt32(&available, 0)
+		gomega.Eventually(func() bool { return reporter.Ready() }).Should(gomega.BeFalse())
+	})
+})
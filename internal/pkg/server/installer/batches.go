@@ -0,0 +1,241 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/server/extensions"
+	"github.com/rs/zerolog/log"
+	"github.com/satori/go.uuid"
+	"sync"
+	"time"
+)
+
+// batchPollInterval is the time between checks of the state of the installs of a batch.
+var batchPollInterval = 5 * time.Second
+
+// Batch structure with a set of installs of an organization launched together.
+type Batch struct {
+	BatchID        string `json:"batch_id"`
+	OrganizationID string `json:"organization_id"`
+	// RequestIDs with the install requests of the batch in launch order.
+	RequestIDs []string `json:"request_ids"`
+	// Concurrency with the number of installs running at the same time.
+	Concurrency int   `json:"concurrency"`
+	Created     int64 `json:"created"`
+}
+
+// InstallClusterBatch registers the installs of a batch and launches them in the background, running at most
+// the concurrency of the batch at the same time.
+//   params:
+//     organizationID The organization of all the installs.
+//     requests The install request of each cluster.
+//     selection The workflow template to be used.
+//     concurrency The number of installs running at the same time, zero to use the limit of the installer.
+//     initiator The subject of the caller, recorded in the install history.
+//   returns:
+//     The registered batch.
+//     An error if the batch is not valid.
+func (m *Manager) InstallClusterBatch(organizationID string, requests []grpc_installer_go.InstallRequest, selection TemplateSelection, concurrency int, initiator string) (*Batch, derrors.Error) {
+	batch, err := m.registerBatch(organizationID, requests, selection, concurrency, initiator)
+	if err != nil {
+		return nil, err
+	}
+	go m.runBatch(batch, m.launchInstall)
+	return batch, nil
+}
+
+// registerBatch validates the batch and registers the operation of each install.
+func (m *Manager) registerBatch(organizationID string, requests []grpc_installer_go.InstallRequest, selection TemplateSelection, concurrency int, initiator string) (*Batch, derrors.Error) {
+	if err := m.requireLeader(); err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, derrors.NewInvalidArgumentError("batch must contain at least one install request")
+	}
+	if concurrency < 0 {
+		return nil, derrors.NewInvalidArgumentError("concurrency cannot be negative")
+	}
+	limit := m.Config.BatchConcurrency
+	if limit <= 0 {
+		limit = 1
+	}
+	if concurrency == 0 || concurrency > limit {
+		concurrency = limit
+	}
+	selection = selection.withDefault()
+	if err := m.checkSelection(organizationID, selection); err != nil {
+		return nil, err
+	}
+	batch := &Batch{
+		BatchID:        uuid.NewV4().String(),
+		OrganizationID: organizationID,
+		RequestIDs:     make([]string, 0, len(requests)),
+		Concurrency:    concurrency,
+		Created:        time.Now().Unix(),
+	}
+	seen := make(map[string]bool, len(requests))
+	for _, request := range requests {
+		if request.OrganizationId != organizationID {
+			return nil, derrors.NewInvalidArgumentError("install request belongs to another organization").WithParams(request.RequestId, request.OrganizationId)
+		}
+		if seen[request.RequestId] {
+			return nil, derrors.NewInvalidArgumentError("duplicated requestID in batch").WithParams(request.RequestId)
+		}
+		seen[request.RequestId] = true
+		batch.RequestIDs = append(batch.RequestIDs, request.RequestId)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	for _, request := range requests {
+		if m.unsafeExist(request.RequestId) {
+			return nil, derrors.NewAlreadyExistsError("requestID").WithParams(request.RequestId)
+		}
+	}
+	for _, request := range requests {
+		m.unsafeInstallRegister(request, selection, initiator)
+		m.Operations[request.RequestId].queued = true
+	}
+	m.Batches[batch.BatchID] = batch
+	log.Info().Str("organizationID", organizationID).Str("batchID", batch.BatchID).Int("installs", len(requests)).
+		Int("concurrency", concurrency).Msg("batch registered")
+	return batch, nil
+}
+
+// runBatch launches the installs of a batch, waiting for an install to finish before launching a new one once
+// the concurrency of the batch is reached.
+func (m *Manager) runBatch(batch *Batch, launch func(requestID string)) {
+	slots := make(chan struct{}, batch.Concurrency)
+	var wg sync.WaitGroup
+	for _, requestID := range batch.RequestIDs {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(requestID string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			m.waitQuota(batch.OrganizationID, requestID)
+			launch(requestID)
+			m.waitOperation(requestID)
+		}(requestID)
+	}
+	wg.Wait()
+	log.Info().Str("organizationID", batch.OrganizationID).Str("batchID", batch.BatchID).Msg("batch finished")
+}
+
+// waitOperation blocks until an operation succeeds, fails or is removed.
+func (m *Manager) waitOperation(requestID string) {
+	for {
+		m.Lock()
+		operation, exists := m.Operations[requestID]
+		m.Unlock()
+		if !exists {
+			return
+		}
+		state := *operation.GetState()
+		if state == grpc_common_go.OpStatus_SUCCESS || state == grpc_common_go.OpStatus_FAILED {
+			return
+		}
+		time.Sleep(batchPollInterval)
+	}
+}
+
+// GetBatchProgress aggregates the state of the installs of a batch. Replicas that are not the leader use the state
+// published by the leader.
+//   params:
+//     batchID The identifier of the batch.
+//   returns:
+//     The progress of the batch and of each of its installs.
+//     An error if the batch does not exist.
+func (m *Manager) GetBatchProgress(batchID string) (*extensions.BatchProgress, derrors.Error) {
+	if !m.Leadership.IsLeader() {
+		state, err := m.State.Load()
+		if err != nil {
+			return nil, err
+		}
+		batch, exists := state.batch(batchID)
+		if !exists {
+			return nil, derrors.NewNotFoundError("batchID").WithParams(batchID)
+		}
+		return aggregateBatch(batch, func(requestID string) *Operation {
+			if published, found := state.operation(requestID); found {
+				return published.toOperation()
+			}
+			return nil
+		}), nil
+	}
+	m.Lock()
+	defer m.Unlock()
+	batch, exists := m.Batches[batchID]
+	if !exists {
+		return nil, derrors.NewNotFoundError("batchID").WithParams(batchID)
+	}
+	return aggregateBatch(batch, func(requestID string) *Operation {
+		return m.Operations[requestID]
+	}), nil
+}
+
+// aggregateBatch builds the progress of a batch from the operations of its installs.
+//   params:
+//     batch The batch.
+//     operation The function returning the operation of an install, nil if it has been removed.
+//   returns:
+//     The progress of the batch.
+func aggregateBatch(batch *Batch, operation func(requestID string) *Operation) *extensions.BatchProgress {
+	result := &extensions.BatchProgress{
+		BatchID:        batch.BatchID,
+		OrganizationID: batch.OrganizationID,
+		Concurrency:    batch.Concurrency,
+		Clusters:       make([]extensions.ClusterProgress, 0, len(batch.RequestIDs)),
+		ElapsedTime:    time.Now().Unix() - batch.Created,
+	}
+	for _, requestID := range batch.RequestIDs {
+		cluster := extensions.ClusterProgress{RequestID: requestID}
+		if op := operation(requestID); op == nil {
+			cluster.Status = grpc_common_go.OpStatus_FAILED.String()
+			cluster.Error = "install removed"
+		} else {
+			response := op.ToGRPCOpResponse()
+			cluster.ClusterID = op.ClusterID
+			cluster.Status = response.Status.String()
+			cluster.Error = response.Error
+		}
+		switch cluster.Status {
+		case grpc_common_go.OpStatus_SUCCESS.String():
+			result.Succeeded++
+		case grpc_common_go.OpStatus_FAILED.String():
+			result.Failed++
+		default:
+			result.Pending++
+		}
+		result.Clusters = append(result.Clusters, cluster)
+	}
+	switch {
+	case result.Pending > 0:
+		result.Status = grpc_common_go.OpStatus_INPROGRESS.String()
+	case result.Failed > 0:
+		result.Status = grpc_common_go.OpStatus_FAILED.String()
+	default:
+		result.Status = grpc_common_go.OpStatus_SUCCESS.String()
+	}
+	return result
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/server/config"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Batch installs", func() {
+
+	var manager Manager
+	requests := []grpc_installer_go.InstallRequest{
+		{RequestId: "r1", OrganizationId: "org", ClusterId: "c1"},
+		{RequestId: "r2", OrganizationId: "org", ClusterId: "c2"},
+		{RequestId: "r3", OrganizationId: "org", ClusterId: "c3"},
+		{RequestId: "r4", OrganizationId: "org", ClusterId: "c4"},
+		{RequestId: "r5", OrganizationId: "org", ClusterId: "c5"},
+	}
+
+	ginkgo.BeforeEach(func() {
+		batchPollInterval = 5 * time.Millisecond
+		manager = NewManager(config.Config{MaxLogEntries: 10, BatchConcurrency: 2})
+	})
+
+	ginkgo.It("should reject invalid batches", func() {
+		_, err := manager.registerBatch("org", nil, TemplateSelection{}, 0, "")
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		other := []grpc_installer_go.InstallRequest{{RequestId: "r1", OrganizationId: "other"}}
+		_, err = manager.registerBatch("org", other, TemplateSelection{}, 0, "")
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		duplicated := []grpc_installer_go.InstallRequest{requests[0], requests[0]}
+		_, err = manager.registerBatch("org", duplicated, TemplateSelection{}, 0, "")
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		gomega.Expect(manager.Operations).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should limit the concurrency to the installer maximum", func() {
+		batch, err := manager.registerBatch("org", requests, TemplateSelection{}, 10, "")
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(batch.Concurrency).To(gomega.Equal(2))
+		gomega.Expect(batch.RequestIDs).To(gomega.Equal([]string{"r1", "r2", "r3", "r4", "r5"}))
+
+		progress, err := manager.GetBatchProgress(batch.BatchID)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(progress.Status).To(gomega.Equal(grpc_common_go.OpStatus_INPROGRESS.String()))
+		gomega.Expect(progress.Pending).To(gomega.Equal(5))
+		gomega.Expect(progress.Clusters[2].ClusterID).To(gomega.Equal("c3"))
+	})
+
+	ginkgo.It("should fan out the installs and aggregate their states", func() {
+		batch, err := manager.registerBatch("org", requests, TemplateSelection{}, 0, "")
+		gomega.Expect(err).To(gomega.BeNil())
+
+		var lock sync.Mutex
+		running, maxRunning := 0, 0
+		launch := func(requestID string) {
+			lock.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			lock.Unlock()
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				lock.Lock()
+				running--
+				lock.Unlock()
+				state := workflow.FinishedState
+				if requestID == "r3" {
+					state = workflow.ErrorState
+				}
+				manager.WorkflowCallback(requestID, nil, state)
+			}()
+		}
+		manager.runBatch(batch, launch)
+		gomega.Expect(maxRunning).To(gomega.Equal(2))
+
+		progress, err := manager.GetBatchProgress(batch.BatchID)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(progress.Status).To(gomega.Equal(grpc_common_go.OpStatus_FAILED.String()))
+		gomega.Expect(progress.Succeeded).To(gomega.Equal(4))
+		gomega.Expect(progress.Failed).To(gomega.Equal(1))
+		gomega.Expect(progress.Pending).To(gomega.BeZero())
+
+		records, total, err := manager.ListInstalls(HistoryFilter{ClusterID: "c3"}, 0, 0)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(total).To(gomega.Equal(1))
+		gomega.Expect(records[0].Status).To(gomega.Equal(grpc_common_go.OpStatus_FAILED.String()))
+		gomega.Expect(records[0].OperationName).To(gomega.Equal(InstallOperation))
+	})
+
+	ginkgo.It("should fail on unknown batches", func() {
+		_, err := manager.GetBatchProgress("unknown")
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	})
+})
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/rs/zerolog/log"
+)
+
+// CertificateCheckOperation is the name of the operation checking the certificates of the cluster.
+const CertificateCheckOperation = "Check certificates"
+
+// CertificateCheckRequestID is the request identifier of the last certificate check, whose state and logs are
+// available through CheckProgress and GetInstallLogs.
+const CertificateCheckRequestID = "certificate-check"
+
+// CheckCertificates checks the certificates of the cluster where the installer runs, renewing them if configured.
+// The result replaces the previous CertificateCheckRequestID operation, which is marked as failed if any certificate
+// is about to expire.
+func (m *Manager) CheckCertificates() *Operation {
+	operation := NewOperation("", CertificateCheckRequestID, CertificateCheckOperation)
+	operation.OperationName = CertificateCheckOperation
+	operation.UpdateStatus(grpc_common_go.OpStatus_INPROGRESS)
+	m.Lock()
+	m.Operations[CertificateCheckRequestID] = operation
+	m.Unlock()
+
+	cmd := k8s.NewCheckCertificates("", m.Config.CertificateRenewBefore, m.Config.RenewCertificates)
+	result, err := cmd.Run(CertificateCheckRequestID)
+	if err == nil && !result.Success {
+		err = result.Error
+		if err == nil {
+			err = derrors.NewInternalError(result.Output)
+		}
+	}
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Msg("certificate check failed")
+		m.markOperationAsFailed(CertificateCheckRequestID, err)
+		return operation.Clone()
+	}
+	log.Info().Str("result", result.Output).Msg("certificates checked")
+	m.Logs.Append(CertificateCheckRequestID, result.Output)
+	operation.UpdateStatus(grpc_common_go.OpStatus_SUCCESS)
+	return operation.Clone()
+}
+
+// WatchCertificates checks the certificates periodically until the stop channel is closed. With leader election,
+// only the leader checks them.
+//   params:
+//     interval The time between checks.
+//     stop The channel closed to finish the checks.
+func (m *Manager) WatchCertificates(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if m.Leadership.IsLeader() {
+			m.CheckCertificates()
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/installer/internal/pkg/server/config"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newExpiringCASecret creates the secret of a management CA expiring in a day.
+func newExpiringCASecret() *v1.Secret {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	gomega.Expect(err).To(gomega.Succeed())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"Nalej"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	gomega.Expect(err).To(gomega.Succeed())
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	gomega.Expect(err).To(gomega.Succeed())
+	return &v1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{Name: "mngt-ca-cert", Namespace: "nalej"},
+		Type:       v1.SecretTypeTLS,
+		Data: map[string][]byte{
+			v1.TLSCertKey:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			v1.TLSPrivateKeyKey: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		},
+	}
+}
+
+var _ = ginkgo.Describe("Certificate check", func() {
+
+	ginkgo.BeforeEach(func() {
+		// The check runs against the cluster where the installer runs.
+		cluster := k8stest.NewFakeCluster(newExpiringCASecret())
+		k8s.RegisterClients("", cluster.Client, cluster.Discovery, cluster.Dynamic)
+	})
+
+	ginkgo.AfterEach(func() {
+		k8s.UnregisterClients("")
+	})
+
+	ginkgo.It("should report the certificates about to expire through the operation", func() {
+		manager := NewManager(config.Config{MaxLogEntries: 10})
+		operation := manager.CheckCertificates()
+		gomega.Expect(*operation.GetState()).To(gomega.Equal(grpc_common_go.OpStatus_FAILED))
+
+		progress, err := manager.GetProgress(CertificateCheckRequestID)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(progress.ToGRPCOpResponse().Error).To(gomega.ContainSubstring("nalej/mngt-ca-cert:tls.crt"))
+		logs, err := manager.GetLogs(CertificateCheckRequestID, 0, 10)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(logs.Entries).NotTo(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should renew the certificates if enabled", func() {
+		manager := NewManager(config.Config{MaxLogEntries: 10, RenewCertificates: true})
+		operation := manager.CheckCertificates()
+		gomega.Expect(*operation.GetState()).To(gomega.Equal(grpc_common_go.OpStatus_SUCCESS))
+
+		operation = manager.CheckCertificates()
+		gomega.Expect(*operation.GetState()).To(gomega.Equal(grpc_common_go.OpStatus_SUCCESS))
+		logs, err := manager.GetLogs(CertificateCheckRequestID, 0, 10)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(logs.Entries[len(logs.Entries)-1].Message).To(gomega.Equal("1 certificates checked, 0 renewed"))
+	})
+})
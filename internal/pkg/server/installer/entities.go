@@ -20,6 +20,9 @@ package installer
 import (
 	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/server/notifications"
+	"github.com/nalej/installer/internal/pkg/templates"
 	"github.com/nalej/installer/internal/pkg/workflow"
 	"github.com/rs/zerolog/log"
 	"sync"
@@ -29,18 +32,63 @@ import (
 const InstallOperation = "Install cluster"
 const UninstallOperation = "Uninstall cluster"
 
+// TemplateNameMetadata is the request metadata key used to select the install workflow template.
+const TemplateNameMetadata = "x-workflow-template"
+
+// TemplateVersionMetadata is the request metadata key used to select the install workflow template version.
+const TemplateVersionMetadata = "x-workflow-template-version"
+
+// PlatformMetadata is the request metadata key used to select a platform that is not one of the platforms of the
+// install requests, such as OPENSHIFT.
+const PlatformMetadata = "x-target-platform"
+
+// TemplateSelection identifies the workflow template to be used by an operation.
+type TemplateSelection struct {
+	// Name of the template.
+	Name string
+	// Version of the template, empty to use the latest one.
+	Version string
+	// Platform of the cluster the template is rendered for, empty to use the target platform of the request.
+	Platform string
+}
+
+// withDefault returns the selection with the default template if none is selected.
+func (ts TemplateSelection) withDefault() TemplateSelection {
+	if ts.Name != "" {
+		return ts
+	}
+	result := DefaultInstallTemplate
+	result.Platform = ts.Platform
+	return result
+}
+
+// DefaultInstallTemplate is the template used if the request does not select one.
+var DefaultInstallTemplate = TemplateSelection{Name: templates.InstallTemplate, Version: templates.BuiltinVersion}
+
 // Operation structure representing an managed operation with its workflow and associated status.
 type Operation struct {
 	sync.Mutex
 	OrganizationID string
 	RequestID      string
-	OperationName  string
-	status         grpc_common_go.OpStatus
-	Created        int64
-	Params         *workflow.Parameters
-	Workflow       *workflow.Workflow
-	error          derrors.Error
-	workflowState  workflow.WorkflowState
+	// ClusterID with the cluster targeted by the operation, if any.
+	ClusterID     string
+	OperationName string
+	// TemplateName with the name of the workflow template to be used.
+	TemplateName string
+	// TemplateVersion with the version of the workflow template to be used.
+	TemplateVersion string
+	// Platform of the cluster when it is not the target platform of the request.
+	Platform string
+	// Initiator with the subject of the caller that requested the operation.
+	Initiator     string
+	status        grpc_common_go.OpStatus
+	Created       int64
+	Params        *workflow.Parameters
+	Workflow      *workflow.Workflow
+	error         derrors.Error
+	workflowState workflow.WorkflowState
+	// queued indicates that the install waits in a batch to be launched.
+	queued bool
 }
 
 // NewOperation creates a new Operation
@@ -49,6 +97,7 @@ func NewOperation(organizationID string, requestID string, operationName string)
 	return &Operation{
 		OrganizationID: organizationID,
 		RequestID:      requestID,
+		OperationName:  operationName,
 		status:         grpc_common_go.OpStatus_INIT,
 		Created:        time.Now().Unix(),
 		workflowState:  workflow.InitState,
@@ -57,16 +106,62 @@ func NewOperation(organizationID string, requestID string, operationName string)
 
 func (is *Operation) Clone() *Operation {
 	return &Operation{
-		OrganizationID: is.OrganizationID,
-		RequestID:      is.RequestID,
-		OperationName:  is.OperationName,
-		status:         is.status,
-		Created:        is.Created,
-		Params:         is.Params,
-		Workflow:       is.Workflow,
-		error:          is.error,
-		workflowState:  is.workflowState,
+		OrganizationID:  is.OrganizationID,
+		RequestID:       is.RequestID,
+		ClusterID:       is.ClusterID,
+		OperationName:   is.OperationName,
+		TemplateName:    is.TemplateName,
+		TemplateVersion: is.TemplateVersion,
+		Platform:        is.Platform,
+		Initiator:       is.Initiator,
+		status:          is.status,
+		Created:         is.Created,
+		Params:          is.Params,
+		Workflow:        is.Workflow,
+		error:           is.error,
+		workflowState:   is.workflowState,
+	}
+}
+
+// toHistoryRecord builds the record of the operation once it has finished.
+func (is *Operation) toHistoryRecord(finished time.Time) HistoryRecord {
+	response := is.ToGRPCOpResponse()
+	return HistoryRecord{
+		RequestID:       is.RequestID,
+		OrganizationID:  is.OrganizationID,
+		ClusterID:       is.ClusterID,
+		OperationName:   is.OperationName,
+		TemplateName:    is.TemplateName,
+		TemplateVersion: is.TemplateVersion,
+		Status:          response.Status.String(),
+		Error:           response.Error,
+		Initiator:       is.Initiator,
+		Started:         time.Unix(is.Created, 0).UTC(),
+		Finished:        finished.UTC(),
+	}
+}
+
+// toNotification builds the notification of an event of the operation.
+func (is *Operation) toNotification(event notifications.Event, err derrors.Error, timestamp time.Time) notifications.Notification {
+	response := is.ToGRPCOpResponse()
+	notification := notifications.Notification{
+		Event:           event,
+		Operation:       is.OperationName,
+		RequestID:       is.RequestID,
+		OrganizationID:  is.OrganizationID,
+		ClusterID:       is.ClusterID,
+		TemplateName:    is.TemplateName,
+		TemplateVersion: is.TemplateVersion,
+		Initiator:       is.Initiator,
+		Status:          response.Status.String(),
+		Error:           response.Error,
+		Started:         time.Unix(is.Created, 0).UTC(),
+		Timestamp:       timestamp.UTC(),
+	}
+	if notification.Error == "" && err != nil {
+		notification.Error = err.Error()
 	}
+	return notification
 }
 
 func (is *Operation) UpdateStatus(newStatus grpc_common_go.OpStatus) {
@@ -100,8 +195,13 @@ func (is *Operation) ToGRPCOpResponse() *grpc_common_go.OpResponse {
 	rStatus := is.status
 	elapsed := time.Now().Unix() - is.Created
 	var e string
+	var info string
 	if is.error != nil {
 		e = is.error.Error()
+		// Failures with a known error code carry the remediation hint.
+		if code, found := errors.ErrorCode(is.error); found {
+			info = errors.Catalogue[code].Hint
+		}
 	}
 	is.Unlock()
 
@@ -112,7 +212,7 @@ func (is *Operation) ToGRPCOpResponse() *grpc_common_go.OpResponse {
 		ElapsedTime:    elapsed,
 		Timestamp:      time.Now().Unix(),
 		Status:         rStatus,
-		Info:           "",
+		Info:           info,
 		Error:          e,
 	}
 }
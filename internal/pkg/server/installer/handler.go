@@ -19,11 +19,16 @@ package installer
 
 import (
 	"context"
+	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-common-go"
 	"github.com/nalej/grpc-installer-go"
 	"github.com/nalej/grpc-utils/pkg/conversions"
 	"github.com/nalej/installer/internal/pkg/entities"
+	"github.com/nalej/installer/internal/pkg/server/auth"
+	"github.com/nalej/installer/internal/pkg/server/extensions"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/metadata"
+	"time"
 )
 
 type Handler struct {
@@ -42,7 +47,10 @@ func (h *Handler) InstallCluster(ctx context.Context, installRequest *grpc_insta
 		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
 		return nil, conversions.ToGRPCError(err)
 	}
-	status, err := h.Manager.InstallCluster(*installRequest)
+	if err := authorizeOrganization(ctx, installRequest.OrganizationId); err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	status, err := h.Manager.InstallCluster(*installRequest, templateSelection(ctx), initiator(ctx))
 	if err != nil {
 		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
 		return nil, conversions.ToGRPCError(err)
@@ -59,7 +67,10 @@ func (h *Handler) UninstallCluster(ctx context.Context, request *grpc_installer_
 		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
 		return nil, conversions.ToGRPCError(err)
 	}
-	response, err := h.Manager.UninstallCluster(*request)
+	if err := authorizeOrganization(ctx, request.OrganizationId); err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	response, err := h.Manager.UninstallCluster(*request, initiator(ctx))
 	if err != nil {
 		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
 		return nil, conversions.ToGRPCError(err)
@@ -74,6 +85,9 @@ func (h *Handler) CheckProgress(ctx context.Context, requestID *grpc_common_go.R
 	if err != nil {
 		return nil, conversions.ToGRPCError(err)
 	}
+	if err := h.authorizeRequest(ctx, requestID.RequestId); err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
 	status, err := h.Manager.GetProgress(requestID.RequestId)
 	if err != nil {
 		return nil, conversions.ToGRPCError(err)
@@ -87,9 +101,283 @@ func (h *Handler) RemoveInstall(ctx context.Context, requestID *grpc_common_go.R
 	if err != nil {
 		return nil, conversions.ToGRPCError(err)
 	}
+	if err := h.authorizeRequest(ctx, requestID.RequestId); err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
 	err = h.Manager.RemoveInstall(requestID.RequestId)
 	if err != nil {
 		return nil, conversions.ToGRPCError(err)
 	}
 	return &grpc_common_go.Success{}, nil
 }
+
+// GetInstallLogs retrieves a page of the logs captured for an install or uninstall.
+func (h *Handler) GetInstallLogs(ctx context.Context, request *extensions.GetInstallLogsRequest) (*extensions.InstallLogs, error) {
+	if request.RequestID == "" {
+		return nil, conversions.ToGRPCError(derrors.NewInvalidArgumentError("request_id must be set"))
+	}
+	if request.Last < 0 {
+		return nil, conversions.ToGRPCError(derrors.NewInvalidArgumentError("last cannot be negative"))
+	}
+	if err := h.authorizeRequest(ctx, request.RequestID); err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	var page *LogPage
+	var err derrors.Error
+	if request.Last > 0 {
+		page, err = h.Manager.TailLogs(request.RequestID, request.Last)
+	} else {
+		page, err = h.Manager.GetLogs(request.RequestID, request.Offset, request.Limit)
+	}
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	result := &extensions.InstallLogs{
+		RequestID:  request.RequestID,
+		Entries:    make([]extensions.LogEntry, 0, len(page.Entries)),
+		Total:      page.Total,
+		NextOffset: page.Offset + len(page.Entries),
+	}
+	for _, entry := range page.Entries {
+		result.Entries = append(result.Entries, extensions.LogEntry{Timestamp: entry.Timestamp, Message: entry.Message})
+	}
+	return result, nil
+}
+
+// CreateJoinToken creates a one-time token to be used by an application cluster to retrieve its install plan.
+func (h *Handler) CreateJoinToken(ctx context.Context, request *extensions.CreateJoinTokenRequest) (*extensions.JoinToken, error) {
+	log.Debug().Str("organizationID", request.InstallRequest.OrganizationId).Str("requestID", request.InstallRequest.RequestId).Msg("create join token")
+	err := entities.ValidJoinInstallRequest(&request.InstallRequest)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
+		return nil, conversions.ToGRPCError(err)
+	}
+	if request.TTLSeconds < 0 {
+		return nil, conversions.ToGRPCError(derrors.NewInvalidArgumentError("ttl_seconds cannot be negative"))
+	}
+	if err := authorizeOrganization(ctx, request.InstallRequest.OrganizationId); err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	selection := TemplateSelection{Name: request.TemplateName, Version: request.TemplateVersion, Platform: templateSelection(ctx).Platform}
+	token, pending, err := h.Manager.CreateJoinToken(request.InstallRequest, selection, time.Duration(request.TTLSeconds)*time.Second)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
+		return nil, conversions.ToGRPCError(err)
+	}
+	return &extensions.JoinToken{Token: token, RequestID: pending.InstallRequest.RequestId, ExpiresAt: pending.ExpiresAt}, nil
+}
+
+// GetInstallPlan exchanges a join token for the install plan of an application cluster.
+func (h *Handler) GetInstallPlan(ctx context.Context, request *extensions.GetInstallPlanRequest) (*extensions.InstallPlan, error) {
+	if request.Token == "" {
+		return nil, conversions.ToGRPCError(derrors.NewInvalidArgumentError("token must be set"))
+	}
+	plan, err := h.Manager.GetInstallPlan(request.Token)
+	if err != nil {
+		log.Warn().Msg(err.Error())
+		return nil, conversions.ToGRPCError(err)
+	}
+	return plan, nil
+}
+
+// InstallClusterBatch triggers the installation of several application clusters of an organization.
+func (h *Handler) InstallClusterBatch(ctx context.Context, request *extensions.InstallClusterBatchRequest) (*extensions.BatchProgress, error) {
+	log.Debug().Str("organizationID", request.OrganizationID).Int("installs", len(request.Requests)).Msg("install cluster batch")
+	if request.OrganizationID == "" {
+		return nil, conversions.ToGRPCError(derrors.NewInvalidArgumentError("organization_id must be set"))
+	}
+	if err := authorizeOrganization(ctx, request.OrganizationID); err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	for index := range request.Requests {
+		if err := entities.ValidInstallRequest(&request.Requests[index]); err != nil {
+			log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
+			return nil, conversions.ToGRPCError(err)
+		}
+	}
+	selection := TemplateSelection{Name: request.TemplateName, Version: request.TemplateVersion, Platform: templateSelection(ctx).Platform}
+	batch, err := h.Manager.InstallClusterBatch(request.OrganizationID, request.Requests, selection, request.Concurrency, initiator(ctx))
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Msg(err.Error())
+		return nil, conversions.ToGRPCError(err)
+	}
+	progress, err := h.Manager.GetBatchProgress(batch.BatchID)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	log.Debug().Str("organizationID", request.OrganizationID).Str("batchID", batch.BatchID).Msg("batch launched")
+	return progress, nil
+}
+
+// GetBatchProgress gets the aggregated state of a batch of installs.
+func (h *Handler) GetBatchProgress(ctx context.Context, request *extensions.GetBatchProgressRequest) (*extensions.BatchProgress, error) {
+	if request.BatchID == "" {
+		return nil, conversions.ToGRPCError(derrors.NewInvalidArgumentError("batch_id must be set"))
+	}
+	progress, err := h.Manager.GetBatchProgress(request.BatchID)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	if identity, ok := auth.IdentityFromContext(ctx); ok && !identity.CanAccess(progress.OrganizationID) {
+		return nil, conversions.ToGRPCError(derrors.NewNotFoundError("batchID").WithParams(request.BatchID))
+	}
+	return progress, nil
+}
+
+// ListInstalls retrieves the finished installs and uninstalls, from the newest to the oldest.
+func (h *Handler) ListInstalls(ctx context.Context, request *extensions.ListInstallsRequest) (*extensions.InstallHistory, error) {
+	filter := HistoryFilter{OrganizationID: request.OrganizationID, ClusterID: request.ClusterID, Status: request.Status}
+	if identity, ok := auth.IdentityFromContext(ctx); ok && identity.OrganizationID != "" {
+		if request.OrganizationID != "" {
+			if err := authorizeOrganization(ctx, request.OrganizationID); err != nil {
+				return nil, conversions.ToGRPCError(err)
+			}
+		}
+		filter.OrganizationID = identity.OrganizationID
+	}
+	records, total, err := h.Manager.ListInstalls(filter, request.Offset, request.Limit)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	result := &extensions.InstallHistory{
+		Installs:   make([]extensions.InstallRecord, 0, len(records)),
+		Total:      total,
+		NextOffset: request.Offset + len(records),
+	}
+	for _, record := range records {
+		result.Installs = append(result.Installs, extensions.InstallRecord{
+			RequestID:       record.RequestID,
+			OrganizationID:  record.OrganizationID,
+			ClusterID:       record.ClusterID,
+			OperationName:   record.OperationName,
+			TemplateName:    record.TemplateName,
+			TemplateVersion: record.TemplateVersion,
+			Status:          record.Status,
+			Error:           record.Error,
+			Initiator:       record.Initiator,
+			Started:         record.Started,
+			Finished:        record.Finished,
+			DurationSeconds: int64(record.Duration().Seconds()),
+		})
+	}
+	return result, nil
+}
+
+// GetCommandProgress retrieves a page of the commands executed by the workflow of an install or uninstall.
+func (h *Handler) GetCommandProgress(ctx context.Context, request *extensions.GetCommandProgressRequest) (*extensions.CommandPage, error) {
+	if request.RequestID == "" {
+		return nil, conversions.ToGRPCError(derrors.NewInvalidArgumentError("request_id must be set"))
+	}
+	if err := h.authorizeRequest(ctx, request.RequestID); err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	page, err := h.Manager.GetCommandProgress(request.RequestID, CommandFilter{FailedOnly: request.FailedOnly}, request.Offset, request.Limit)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	operation, err := h.Manager.GetProgress(request.RequestID)
+	if err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	result := &extensions.CommandPage{
+		RequestID:        request.RequestID,
+		Status:           operation.GetState().String(),
+		WorkflowCommands: page.WorkflowCommands,
+		Executed:         page.Executed,
+		Commands:         make([]extensions.CommandProgress, 0, len(page.Commands)),
+		Total:            page.Total,
+		NextOffset:       page.Offset + len(page.Commands),
+	}
+	for _, command := range page.Commands {
+		progress := extensions.CommandProgress{
+			Index:       command.Index,
+			Name:        command.Name,
+			Description: command.Description,
+			Success:     command.Success,
+			Error:       command.Error,
+			Duration:    command.Duration,
+		}
+		if request.IncludeOutput {
+			progress.Output = command.Output
+		}
+		result.Commands = append(result.Commands, progress)
+	}
+	return result, nil
+}
+
+// initiator extracts the subject of the caller authenticated by the auth interceptor, empty without authentication.
+func initiator(ctx context.Context) string {
+	if identity, ok := auth.IdentityFromContext(ctx); ok {
+		return identity.Subject
+	}
+	return ""
+}
+
+// authorizeOrganization checks that the caller can operate on the clusters of an organization.
+func authorizeOrganization(ctx context.Context, organizationID string) derrors.Error {
+	if identity, ok := auth.IdentityFromContext(ctx); ok && !identity.CanAccess(organizationID) {
+		return derrors.NewPermissionDeniedError("caller cannot access the operations of the organization").
+			WithParams(identity.Subject, organizationID)
+	}
+	return nil
+}
+
+// authorizeRequest checks that the caller can access an operation. The operations of other organizations are
+// reported as not found so their existence is not disclosed.
+func (h *Handler) authorizeRequest(ctx context.Context, requestID string) derrors.Error {
+	identity, ok := auth.IdentityFromContext(ctx)
+	if !ok || identity.OrganizationID == "" {
+		return nil
+	}
+	operation, err := h.Manager.GetProgress(requestID)
+	if err != nil {
+		return err
+	}
+	if !identity.CanAccess(operation.OrganizationID) {
+		return derrors.NewNotFoundError("requestID").WithParams(requestID)
+	}
+	return nil
+}
+
+// templateSelection extracts the workflow template and the platform selected in the request metadata.
+func templateSelection(ctx context.Context) TemplateSelection {
+	result := TemplateSelection{}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return result
+	}
+	if values := md.Get(TemplateNameMetadata); len(values) > 0 {
+		result.Name = values[0]
+	}
+	if values := md.Get(TemplateVersionMetadata); len(values) > 0 {
+		result.Version = values[0]
+	}
+	if values := md.Get(PlatformMetadata); len(values) > 0 {
+		result.Platform = values[0]
+	}
+	return result
+}
+
+// ListTemplates retrieves the workflow templates available in the installer for an organization.
+func (h *Handler) ListTemplates(ctx context.Context, request *extensions.ListTemplatesRequest) (*extensions.TemplateList, error) {
+	organizationID := request.OrganizationID
+	if identity, ok := auth.IdentityFromContext(ctx); ok && organizationID == "" {
+		organizationID = identity.OrganizationID
+	}
+	if err := authorizeOrganization(ctx, organizationID); err != nil {
+		return nil, conversions.ToGRPCError(err)
+	}
+	result := make([]extensions.TemplateInfo, 0)
+	for _, template := range h.Manager.ListTemplates(organizationID) {
+		if request.Name != "" && request.Name != template.Name {
+			continue
+		}
+		result = append(result, extensions.TemplateInfo{
+			Name:        template.Name,
+			Version:     template.Version,
+			Description: template.Description,
+			Checksum:    template.Checksum,
+		})
+	}
+	return &extensions.TemplateList{Templates: result}, nil
+}
@@ -19,10 +19,15 @@
 // Prerequirements
 // 1.- Launch minikube
 
+// The interactions with the cluster can be recorded setting IT_RECORDER_MODE=record and replayed later without the
+// cluster with IT_RECORDER_MODE=replay. Replayed tests do not require the rest of the variables.
+
 /*
 RUN_INTEGRATION_TEST=true
 IT_K8S_KUBECONFIG=/Users/daniel/.kube/config
 IT_RKE_BINARY=/Users/daniel/development/rke/rke
+IT_RECORDER_MODE=record
+IT_RECORDER_CASSETTE=/tmp/handler_it.json
 */
 
 package installer
@@ -34,6 +39,7 @@ import (
 	"github.com/nalej/grpc-infrastructure-go"
 	"github.com/nalej/grpc-installer-go"
 	"github.com/nalej/grpc-utils/pkg/test"
+	"github.com/nalej/installer/internal/pkg/recorder"
 	cfg "github.com/nalej/installer/internal/pkg/server/config"
 	"github.com/nalej/installer/internal/pkg/utils"
 	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
@@ -90,18 +96,24 @@ var _ = ginkgo.Describe("Installer", func() {
 	const numDeployments = 2
 	const targetNamespace = "test-it-install"
 
-	if !utils.RunIntegrationTests() {
+	recorderMode := recorder.ModeFromEnv()
+	if !utils.RunIntegrationTests() && recorderMode != recorder.Replay {
 		log.Warn().Msg("Integration tests are skipped")
 		return
 	}
 	var (
 		kubeConfigFile = os.Getenv("IT_K8S_KUBECONFIG")
 		rkeBinary      = os.Getenv("IT_RKE_BINARY")
+		cassettePath   = os.Getenv(recorder.CassetteEnv)
 	)
 
-	if kubeConfigFile == "" || rkeBinary == "" {
+	if recorderMode != recorder.Disabled && cassettePath == "" {
+		ginkgo.Fail("missing cassette path")
+	}
+	if recorderMode != recorder.Replay && (kubeConfigFile == "" || rkeBinary == "") {
 		ginkgo.Fail("missing environment variables")
 	}
+	var apiRecorder *recorder.Recorder
 
 	var componentsDir string
 	var binaryDir string
@@ -117,6 +129,18 @@ var _ = ginkgo.Describe("Installer", func() {
 
 	ginkgo.BeforeSuite(func() {
 
+		rec, rErr := recorder.NewRecorder(recorderMode, cassettePath)
+		gomega.Expect(rErr).To(gomega.Succeed())
+		apiRecorder = rec
+		k8s.SetTransportWrapper(apiRecorder.Wrap)
+		if recorderMode == recorder.Replay {
+			replayDir, err := ioutil.TempDir("", "installITReplay")
+			gomega.Expect(err).To(gomega.Succeed())
+			kubeConfigFile = filepath.Join(replayDir, "kubeconfig.yaml")
+			gomega.Expect(recorder.WriteReplayKubeConfig(kubeConfigFile)).To(gomega.Succeed())
+			rkeBinary = filepath.Join(replayDir, "rke")
+		}
+
 		// Load data and ENV variables.
 		kubeConfigContent, lErr := utils.GetKubeConfigContent(kubeConfigFile)
 		gomega.Expect(lErr).To(gomega.Succeed())
@@ -169,6 +193,8 @@ var _ = ginkgo.Describe("Installer", func() {
 		os.RemoveAll(componentsDir)
 		tc := k8s.NewTestCleaner(kubeConfigFile, targetNamespace)
 		gomega.Expect(tc.DeleteAll()).To(gomega.Succeed())
+		gomega.Expect(apiRecorder.Save()).To(gomega.Succeed())
+		k8s.SetTransportWrapper(nil)
 	})
 
 	ginkgo.PContext("On a base system", func() {
@@ -0,0 +1,228 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+)
+
+// DefaultHistoryPageSize is the number of records returned when the request does not specify a limit.
+const DefaultHistoryPageSize = 100
+
+// HistoryRecord structure with the outcome of a finished install or uninstall.
+type HistoryRecord struct {
+	RequestID      string `json:"request_id"`
+	OrganizationID string `json:"organization_id"`
+	ClusterID      string `json:"cluster_id"`
+	OperationName  string `json:"operation_name"`
+	// TemplateName and TemplateVersion with the workflow template of the install.
+	TemplateName    string `json:"template_name,omitempty"`
+	TemplateVersion string `json:"template_version,omitempty"`
+	Status          string `json:"status"`
+	Error           string `json:"error,omitempty"`
+	// Initiator with the subject of the caller that requested the operation, empty without authentication.
+	Initiator string    `json:"initiator,omitempty"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+}
+
+// Duration returns the time the operation took.
+func (hr *HistoryRecord) Duration() time.Duration {
+	return hr.Finished.Sub(hr.Started)
+}
+
+// HistoryFilter structure with the conditions of the records to be listed.
+type HistoryFilter struct {
+	// OrganizationID of the records, empty to list all organizations.
+	OrganizationID string
+	// ClusterID of the records, empty to list all clusters.
+	ClusterID string
+	// Status of the records, such as FAILED, empty to list all of them.
+	Status string
+}
+
+// matches checks if a record satisfies the filter.
+func (hf HistoryFilter) matches(record HistoryRecord) bool {
+	return (hf.OrganizationID == "" || hf.OrganizationID == record.OrganizationID) &&
+		(hf.ClusterID == "" || hf.ClusterID == record.ClusterID) &&
+		(hf.Status == "" || hf.Status == record.Status)
+}
+
+// HistoryStore structure keeping the records of the finished operations. Records are kept in memory, and if a
+// path is set, in a file so they survive restarts and can be read by other replicas sharing the volume.
+type HistoryStore struct {
+	sync.Mutex
+	// path of the file with the records, empty to keep them in memory only.
+	path string
+	// retention with the time the records are kept, zero to keep them until maxRecords is reached.
+	retention time.Duration
+	// maxRecords with the number of records kept, zero for no limit.
+	maxRecords int
+	records    []HistoryRecord
+	// now returns the current time.
+	now func() time.Time
+}
+
+// NewHistoryStore creates a HistoryStore.
+//   params:
+//     path The file where the records are written, empty to keep them in memory only.
+//     retention The time the records are kept, zero to keep them until maxRecords is reached.
+//     maxRecords The number of records kept, zero for no limit.
+//   returns:
+//     A HistoryStore.
+func NewHistoryStore(path string, retention time.Duration, maxRecords int) *HistoryStore {
+	return &HistoryStore{
+		path:       path,
+		retention:  retention,
+		maxRecords: maxRecords,
+		records:    make([]HistoryRecord, 0),
+		now:        time.Now,
+	}
+}
+
+// load reads the records from the file, if any.
+func (hs *HistoryStore) load() derrors.Error {
+	if hs.path == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(hs.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return derrors.NewInternalError("cannot read install history", err).WithParams(hs.path)
+	}
+	records := make([]HistoryRecord, 0)
+	if err := json.Unmarshal(content, &records); err != nil {
+		return derrors.NewInternalError("cannot parse install history", err).WithParams(hs.path)
+	}
+	hs.records = records
+	return nil
+}
+
+// save writes the records to the file, if any. The content is replaced atomically so readers never see a partial
+// file.
+func (hs *HistoryStore) save() derrors.Error {
+	if hs.path == "" {
+		return nil
+	}
+	content, err := json.Marshal(hs.records)
+	if err != nil {
+		return derrors.NewInternalError("cannot marshal install history", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(hs.path), 0700); err != nil {
+		return derrors.NewInternalError("cannot create install history directory", err).WithParams(hs.path)
+	}
+	temp := hs.path + ".tmp"
+	if err := ioutil.WriteFile(temp, content, 0600); err != nil {
+		return derrors.NewInternalError("cannot write install history", err).WithParams(hs.path)
+	}
+	if err := os.Rename(temp, hs.path); err != nil {
+		return derrors.NewInternalError("cannot write install history", err).WithParams(hs.path)
+	}
+	return nil
+}
+
+// prune removes the records older than the retention and the oldest ones above the maximum. Records are kept
+// sorted from the newest to the oldest.
+func (hs *HistoryStore) prune() {
+	sort.SliceStable(hs.records, func(i, j int) bool {
+		return hs.records[i].Finished.After(hs.records[j].Finished)
+	})
+	if hs.retention > 0 {
+		limit := hs.now().Add(-hs.retention)
+		kept := hs.records[:0]
+		for _, record := range hs.records {
+			if record.Finished.After(limit) {
+				kept = append(kept, record)
+			}
+		}
+		hs.records = kept
+	}
+	if hs.maxRecords > 0 && len(hs.records) > hs.maxRecords {
+		hs.records = hs.records[:hs.maxRecords]
+	}
+}
+
+// Record adds the outcome of an operation, replacing a previous record of the same request.
+//   params:
+//     record The record of the operation.
+//   returns:
+//     An error if the history cannot be written.
+func (hs *HistoryStore) Record(record HistoryRecord) derrors.Error {
+	hs.Lock()
+	defer hs.Unlock()
+	if err := hs.load(); err != nil {
+		return err
+	}
+	kept := hs.records[:0]
+	for _, previous := range hs.records {
+		if previous.RequestID != record.RequestID {
+			kept = append(kept, previous)
+		}
+	}
+	hs.records = append(kept, record)
+	hs.prune()
+	return hs.save()
+}
+
+// List retrieves a page of the records, from the newest to the oldest.
+//   params:
+//     filter The conditions of the records.
+//     offset The index of the first record to be returned.
+//     limit The maximum number of records to be returned.
+//   returns:
+//     The records of the page.
+//     The total number of records satisfying the filter.
+//     An error if the history cannot be read.
+func (hs *HistoryStore) List(filter HistoryFilter, offset int, limit int) ([]HistoryRecord, int, derrors.Error) {
+	if offset < 0 {
+		return nil, 0, derrors.NewInvalidArgumentError("offset cannot be negative").WithParams(offset)
+	}
+	if limit <= 0 {
+		limit = DefaultHistoryPageSize
+	}
+	hs.Lock()
+	defer hs.Unlock()
+	if err := hs.load(); err != nil {
+		return nil, 0, err
+	}
+	hs.prune()
+	matching := make([]HistoryRecord, 0)
+	for _, record := range hs.records {
+		if filter.matches(record) {
+			matching = append(matching, record)
+		}
+	}
+	if offset > len(matching) {
+		offset = len(matching)
+	}
+	end := offset + limit
+	if end > len(matching) {
+		end = len(matching)
+	}
+	return matching[offset:end], len(matching), nil
+}
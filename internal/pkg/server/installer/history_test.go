@@ -0,0 +1,120 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Install history", func() {
+
+	var now time.Time
+
+	newRecord := func(requestID string, clusterID string, age time.Duration) HistoryRecord {
+		return HistoryRecord{
+			RequestID:      requestID,
+			OrganizationID: "org",
+			ClusterID:      clusterID,
+			OperationName:  InstallOperation,
+			Status:         "SUCCESS",
+			Started:        now.Add(-age - time.Minute),
+			Finished:       now.Add(-age),
+		}
+	}
+
+	ginkgo.BeforeEach(func() {
+		now = time.Now()
+	})
+
+	ginkgo.It("should list the records from the newest with filters and pages", func() {
+		store := NewHistoryStore("", 0, 0)
+		gomega.Expect(store.Record(newRecord("r1", "c1", 3*time.Hour))).To(gomega.Succeed())
+		gomega.Expect(store.Record(newRecord("r2", "c2", 2*time.Hour))).To(gomega.Succeed())
+		gomega.Expect(store.Record(newRecord("r3", "c1", time.Hour))).To(gomega.Succeed())
+
+		records, total, err := store.List(HistoryFilter{}, 0, 2)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(total).To(gomega.Equal(3))
+		gomega.Expect(records).To(gomega.HaveLen(2))
+		gomega.Expect(records[0].RequestID).To(gomega.Equal("r3"))
+		gomega.Expect(records[0].Duration()).To(gomega.Equal(time.Minute))
+
+		records, total, err = store.List(HistoryFilter{ClusterID: "c1"}, 1, 0)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(total).To(gomega.Equal(2))
+		gomega.Expect(records).To(gomega.HaveLen(1))
+		gomega.Expect(records[0].RequestID).To(gomega.Equal("r1"))
+	})
+
+	ginkgo.It("should filter the records by status", func() {
+		store := NewHistoryStore("", 0, 0)
+		failed := newRecord("r1", "c1", 2*time.Hour)
+		failed.Status = "FAILED"
+		gomega.Expect(store.Record(failed)).To(gomega.Succeed())
+		gomega.Expect(store.Record(newRecord("r2", "c1", time.Hour))).To(gomega.Succeed())
+
+		records, total, err := store.List(HistoryFilter{Status: "FAILED"}, 0, 0)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(total).To(gomega.Equal(1))
+		gomega.Expect(records[0].RequestID).To(gomega.Equal("r1"))
+	})
+
+	ginkgo.It("should replace the record of the same request", func() {
+		store := NewHistoryStore("", 0, 0)
+		gomega.Expect(store.Record(newRecord("r1", "c1", time.Hour))).To(gomega.Succeed())
+		failed := newRecord("r1", "c1", 0)
+		failed.Status = "FAILED"
+		gomega.Expect(store.Record(failed)).To(gomega.Succeed())
+		records, total, err := store.List(HistoryFilter{}, 0, 0)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(total).To(gomega.Equal(1))
+		gomega.Expect(records[0].Status).To(gomega.Equal("FAILED"))
+	})
+
+	ginkgo.It("should prune the records beyond the retention", func() {
+		store := NewHistoryStore("", 24*time.Hour, 2)
+		store.now = func() time.Time { return now }
+		gomega.Expect(store.Record(newRecord("old", "c1", 48*time.Hour))).To(gomega.Succeed())
+		gomega.Expect(store.Record(newRecord("r1", "c1", 3*time.Hour))).To(gomega.Succeed())
+		gomega.Expect(store.Record(newRecord("r2", "c1", 2*time.Hour))).To(gomega.Succeed())
+		gomega.Expect(store.Record(newRecord("r3", "c1", time.Hour))).To(gomega.Succeed())
+		records, total, err := store.List(HistoryFilter{}, 0, 0)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(total).To(gomega.Equal(2))
+		gomega.Expect(records[1].RequestID).To(gomega.Equal("r2"))
+	})
+
+	ginkgo.It("should persist the records in the history file", func() {
+		dir, err := ioutil.TempDir("", "history")
+		gomega.Expect(err).To(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "history.json")
+		gomega.Expect(NewHistoryStore(path, 0, 0).Record(newRecord("r1", "c1", time.Hour))).To(gomega.Succeed())
+
+		records, total, lErr := NewHistoryStore(path, 0, 0).List(HistoryFilter{OrganizationID: "org"}, 0, 0)
+		gomega.Expect(lErr).To(gomega.BeNil())
+		gomega.Expect(total).To(gomega.Equal(1))
+		gomega.Expect(records[0].ClusterID).To(gomega.Equal("c1"))
+	})
+})
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-installer-go"
+	"sync"
+	"time"
+)
+
+// DefaultJoinTokenTTL is the validity of a join token if the request does not specify one.
+const DefaultJoinTokenTTL = time.Hour
+
+// MaxJoinTokenTTL is the maximum validity of a join token.
+const MaxJoinTokenTTL = 24 * time.Hour
+
+// joinTokenBytes is the number of random bytes of a join token.
+const joinTokenBytes = 32
+
+// PendingJoin structure with the install waiting for an application cluster to claim it.
+type PendingJoin struct {
+	// InstallRequest with the details of the install.
+	InstallRequest grpc_installer_go.InstallRequest
+	// Selection with the workflow template to be used.
+	Selection TemplateSelection
+	// ExpiresAt with the time after which the token is no longer valid.
+	ExpiresAt time.Time
+}
+
+// JoinTokenStore structure keeping the one-time tokens used by application clusters to retrieve their install plan.
+type JoinTokenStore struct {
+	sync.Mutex
+	pending map[string]PendingJoin
+	// now returns the current time.
+	now func() time.Time
+}
+
+// NewJoinTokenStore creates an empty token store.
+func NewJoinTokenStore() *JoinTokenStore {
+	return &JoinTokenStore{pending: make(map[string]PendingJoin, 0), now: time.Now}
+}
+
+// Create generates a new token for an install.
+//   params:
+//     request The install request. Its kubeconfig is discarded as the installer runs inside the target cluster.
+//     selection The workflow template to be used.
+//     ttl The validity of the token, zero to use DefaultJoinTokenTTL.
+//   returns:
+//     The token.
+//     The pending join associated with the token.
+//     An error if the token cannot be created.
+func (s *JoinTokenStore) Create(request grpc_installer_go.InstallRequest, selection TemplateSelection, ttl time.Duration) (string, *PendingJoin, derrors.Error) {
+	if ttl <= 0 {
+		ttl = DefaultJoinTokenTTL
+	}
+	if ttl > MaxJoinTokenTTL {
+		return "", nil, derrors.NewInvalidArgumentError("join token validity exceeds the maximum").WithParams(ttl.String(), MaxJoinTokenTTL.String())
+	}
+	raw := make([]byte, joinTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, derrors.NewInternalError("cannot generate join token", err)
+	}
+	token := hex.EncodeToString(raw)
+	request.KubeConfigRaw = ""
+	pending := PendingJoin{InstallRequest: request, Selection: selection}
+
+	s.Lock()
+	defer s.Unlock()
+	s.unsafeExpire()
+	for _, other := range s.pending {
+		if other.InstallRequest.RequestId == request.RequestId {
+			return "", nil, derrors.NewAlreadyExistsError("a join token already exists for the request").WithParams(request.RequestId)
+		}
+	}
+	pending.ExpiresAt = s.now().Add(ttl)
+	s.pending[token] = pending
+	return token, &pending, nil
+}
+
+// Claim retrieves the install associated with a token. The token is removed so it cannot be used again.
+func (s *JoinTokenStore) Claim(token string) (*PendingJoin, derrors.Error) {
+	s.Lock()
+	defer s.Unlock()
+	s.unsafeExpire()
+	pending, found := s.pending[token]
+	if !found {
+		return nil, derrors.NewNotFoundError("join token is not valid or has expired")
+	}
+	delete(s.pending, token)
+	return &pending, nil
+}
+
+// unsafeExpire removes the expired tokens. The caller must hold the lock.
+func (s *JoinTokenStore) unsafeExpire() {
+	now := s.now()
+	for token, pending := range s.pending {
+		if !now.Before(pending.ExpiresAt) {
+			delete(s.pending, token)
+		}
+	}
+}
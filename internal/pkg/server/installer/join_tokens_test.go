@@ -0,0 +1,73 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"github.com/nalej/grpc-installer-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"time"
+)
+
+var _ = ginkgo.Describe("Join token store", func() {
+
+	var store *JoinTokenStore
+	var now time.Time
+
+	ginkgo.BeforeEach(func() {
+		now = time.Now()
+		store = NewJoinTokenStore()
+		store.now = func() time.Time { return now }
+	})
+
+	request := grpc_installer_go.InstallRequest{RequestId: "request", OrganizationId: "org", KubeConfigRaw: "kubeconfig"}
+
+	ginkgo.It("should allow to claim a token only once", func() {
+		token, pending, err := store.Create(request, DefaultInstallTemplate, 0)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(len(token)).To(gomega.Equal(2 * joinTokenBytes))
+		gomega.Expect(pending.ExpiresAt).To(gomega.Equal(now.Add(DefaultJoinTokenTTL)))
+
+		claimed, err := store.Claim(token)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(claimed.InstallRequest.RequestId).To(gomega.Equal("request"))
+		gomega.Expect(claimed.InstallRequest.KubeConfigRaw).To(gomega.BeEmpty())
+		gomega.Expect(claimed.Selection).To(gomega.Equal(DefaultInstallTemplate))
+
+		_, err = store.Claim(token)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("should reject expired tokens", func() {
+		token, _, err := store.Create(request, DefaultInstallTemplate, time.Minute)
+		gomega.Expect(err).To(gomega.BeNil())
+		now = now.Add(time.Minute)
+		_, err = store.Claim(token)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("should reject duplicated requests and long validities", func() {
+		_, _, err := store.Create(request, DefaultInstallTemplate, 0)
+		gomega.Expect(err).To(gomega.BeNil())
+		_, _, err = store.Create(request, DefaultInstallTemplate, 0)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		other := grpc_installer_go.InstallRequest{RequestId: "other"}
+		_, _, err = store.Create(other, DefaultInstallTemplate, MaxJoinTokenTTL+time.Second)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	})
+})
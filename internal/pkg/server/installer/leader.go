@@ -0,0 +1,306 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-common-go"
+	"github.com/rs/zerolog/log"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaderLeaseName is the name of the lease held by the leader of the installer replicas.
+const LeaderLeaseName = "installer-leader"
+
+// PodNameEnv is the environment variable with the name of the pod, used as the identity of the replica.
+const PodNameEnv = "POD_NAME"
+
+// statePublishInterval is the time between the publications of the shared state by the leader.
+var statePublishInterval = 2 * time.Second
+
+// Leadership structure with the state of the leader election of a replica. If the election is disabled, the
+// replica is always the leader.
+type Leadership struct {
+	sync.Mutex
+	// Identity of the replica.
+	Identity string
+	enabled  bool
+	leading  bool
+	// leader with the identity of the current leader.
+	leader string
+}
+
+// NewLeadership creates a Leadership.
+//   params:
+//     identity The identity of the replica.
+//     enabled Whether the replica takes part in a leader election.
+//   returns:
+//     A Leadership that does not lead until the election is won.
+func NewLeadership(identity string, enabled bool) *Leadership {
+	return &Leadership{Identity: identity, enabled: enabled}
+}
+
+// IsLeader checks if the replica executes the workflows.
+func (l *Leadership) IsLeader() bool {
+	l.Lock()
+	defer l.Unlock()
+	return !l.enabled || l.leading
+}
+
+// Leader returns the identity of the current leader, empty if it is unknown.
+func (l *Leadership) Leader() string {
+	l.Lock()
+	defer l.Unlock()
+	if !l.enabled {
+		return l.Identity
+	}
+	return l.leader
+}
+
+// setLeading updates whether the replica leads and returns whether it was leading before.
+func (l *Leadership) setLeading(leading bool) bool {
+	l.Lock()
+	defer l.Unlock()
+	previous := l.leading
+	l.leading = leading
+	if leading {
+		l.leader = l.Identity
+	}
+	return previous
+}
+
+func (l *Leadership) setLeader(identity string) {
+	l.Lock()
+	l.leader = identity
+	l.Unlock()
+}
+
+// LeaderIdentity returns the identity of the replica, which is the name of the pod if available or the host name
+// otherwise.
+func LeaderIdentity() string {
+	if podName := os.Getenv(PodNameEnv); podName != "" {
+		return podName
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Warn().Err(err).Msg("cannot retrieve host name for the leader election identity")
+		return "installer"
+	}
+	return hostname
+}
+
+// requireLeader rejects the operations that can only be executed by the leader.
+func (m *Manager) requireLeader() derrors.Error {
+	if m.Leadership.IsLeader() {
+		return nil
+	}
+	return derrors.NewUnavailableError("installer replica is not the leader, retry on the leader").WithParams(m.Leadership.Leader())
+}
+
+// RunLeaderElection takes part in the election of the leader of the installer replicas until the stop channel is
+// closed. When the leadership is lost, the replica stops accepting new operations, stops the workflows it was
+// executing and campaigns again.
+//   params:
+//     client The client of the cluster where the installer runs.
+//     stop The channel closed to leave the election.
+//   returns:
+//     An error if the election cannot be configured.
+func (m *Manager) RunLeaderElection(client kubernetes.Interface, stop <-chan struct{}) derrors.Error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	lease := m.Config.LeaderElectionLease
+	for {
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock: &resourcelock.LeaseLock{
+				LeaseMeta:  metaV1.ObjectMeta{Name: LeaderLeaseName, Namespace: m.Config.LeaderElectionNamespace},
+				Client:     client.CoordinationV1(),
+				LockConfig: resourcelock.ResourceLockConfig{Identity: m.Leadership.Identity},
+			},
+			LeaseDuration:   lease,
+			RenewDeadline:   lease * 2 / 3,
+			RetryPeriod:     lease / 5,
+			ReleaseOnCancel: true,
+			Name:            LeaderLeaseName,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: m.lead,
+				OnStoppedLeading: m.stepDown,
+				OnNewLeader: func(identity string) {
+					m.Leadership.setLeader(identity)
+					log.Info().Str("leader", identity).Msg("new installer leader")
+				},
+			},
+		})
+		if err != nil {
+			return derrors.NewInvalidArgumentError("invalid leader election configuration", err)
+		}
+		elector.Run(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+	}
+}
+
+// lead adopts the state published by the previous leader and publishes the state of the operations until the
+// leadership is lost.
+func (m *Manager) lead(ctx context.Context) {
+	m.Leadership.setLeading(true)
+	log.Info().Str("identity", m.Leadership.Identity).Msg("leading installer replicas")
+	if err := m.adoptState(); err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Msg("cannot adopt the state of the previous leader")
+	}
+	ticker := time.NewTicker(statePublishInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.PublishState(); err != nil {
+			log.Warn().Str("trace", err.DebugReport()).Msg("cannot publish shared state")
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stepDown stops the workflows executed by the replica once the leadership is lost, so that they do not run
+// concurrently with the ones launched by the new leader. The lease cannot be acquired by another replica before the
+// renew deadline of the previous leader expires, so the workflows are stopped before the new leader adopts the state.
+func (m *Manager) stepDown() {
+	if !m.Leadership.setLeading(false) {
+		return
+	}
+	log.Warn().Str("identity", m.Leadership.Identity).Msg("leadership lost")
+	m.Lock()
+	running := make([]string, 0)
+	for requestID, operation := range m.Operations {
+		status := *operation.GetState()
+		if status != grpc_common_go.OpStatus_SUCCESS && status != grpc_common_go.OpStatus_FAILED {
+			running = append(running, requestID)
+		}
+	}
+	m.Unlock()
+	for _, requestID := range running {
+		if err := m.ExecHandler.Stop(requestID); err != nil {
+			log.Debug().Str("requestID", requestID).Msg("operation without a running workflow")
+		}
+		m.markOperationAsFailed(requestID, derrors.NewUnavailableError("operation interrupted by a loss of leadership").WithParams(m.Leadership.Identity))
+	}
+}
+
+// adoptState restores the operations and batches published by the previous leader that are unknown to this
+// replica. The previous leader stops its workflows when its lease cannot be renewed, before this replica acquires
+// it, and they cannot be resumed, so the operations that were still running are marked as failed.
+func (m *Manager) adoptState() derrors.Error {
+	state, err := m.State.Load()
+	if err != nil {
+		return err
+	}
+	m.Lock()
+	defer m.Unlock()
+	for _, published := range state.Operations {
+		if m.unsafeExist(published.RequestID) {
+			continue
+		}
+		operation := published.toOperation()
+		status := *operation.GetState()
+		if status != grpc_common_go.OpStatus_SUCCESS && status != grpc_common_go.OpStatus_FAILED {
+			operation.UpdateStatus(grpc_common_go.OpStatus_FAILED)
+			operation.UpdateError(derrors.NewUnavailableError("operation interrupted by a change of leader").WithParams(state.Leader))
+			m.unsafeRecordHistory(operation)
+		}
+		m.Operations[published.RequestID] = operation
+	}
+	for index := range state.Batches {
+		batch := state.Batches[index]
+		if _, exists := m.Batches[batch.BatchID]; !exists {
+			m.Batches[batch.BatchID] = &batch
+		}
+	}
+	return nil
+}
+
+// snapshot returns the shared state with the operations and batches of the replica.
+func (m *Manager) snapshot() *SharedState {
+	m.Lock()
+	defer m.Unlock()
+	result := &SharedState{
+		Leader:     m.Leadership.Identity,
+		Updated:    time.Now().UTC(),
+		Operations: make([]OperationState, 0, len(m.Operations)),
+		Batches:    make([]Batch, 0, len(m.Batches)),
+	}
+	for _, operation := range m.Operations {
+		response := operation.ToGRPCOpResponse()
+		result.Operations = append(result.Operations, OperationState{
+			RequestID:      operation.RequestID,
+			OrganizationID: operation.OrganizationID,
+			ClusterID:      operation.ClusterID,
+			OperationName:  operation.OperationName,
+			Status:         response.Status.String(),
+			Error:          response.Error,
+			Initiator:      operation.Initiator,
+			Created:        operation.Created,
+		})
+	}
+	sort.Slice(result.Operations, func(i, j int) bool {
+		return result.Operations[i].RequestID < result.Operations[j].RequestID
+	})
+	for _, batch := range m.Batches {
+		result.Batches = append(result.Batches, *batch)
+	}
+	sort.Slice(result.Batches, func(i, j int) bool {
+		return result.Batches[i].BatchID < result.Batches[j].BatchID
+	})
+	return result
+}
+
+// PublishState writes the operations and batches of the leader to the state shared among the replicas.
+func (m *Manager) PublishState() derrors.Error {
+	return m.State.Save(m.snapshot())
+}
+
+// getSharedProgress retrieves an operation from the state published by the leader.
+func (m *Manager) getSharedProgress(requestID string) (*Operation, derrors.Error) {
+	state, err := m.State.Load()
+	if err != nil {
+		return nil, err
+	}
+	published, found := state.operation(requestID)
+	if !found {
+		return nil, derrors.NewNotFoundError("requestID").WithParams(requestID)
+	}
+	return published.toOperation(), nil
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/server/config"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Leader election", func() {
+
+	var leader Manager
+	var follower Manager
+
+	newReplica := func(identity string, store *StateStore) Manager {
+		manager := NewManager(config.Config{MaxLogEntries: 10, BatchConcurrency: 2})
+		manager.Leadership = NewLeadership(identity, true)
+		manager.State = store
+		return manager
+	}
+
+	ginkgo.BeforeEach(func() {
+		cluster := k8stest.NewFakeCluster()
+		store := NewStateStore(cluster.Client, config.DefaultLeaderElectionNamespace, StateConfigMapName)
+		leader = newReplica("installer-0", store)
+		leader.Leadership.setLeading(true)
+		follower = newReplica("installer-1", store)
+		follower.Leadership.setLeader("installer-0")
+
+		leader.Lock()
+		leader.unsafeInstallRegister(grpc_installer_go.InstallRequest{RequestId: "r1", OrganizationId: "org", ClusterId: "c1"}, DefaultInstallTemplate, "")
+		leader.unsafeInstallRegister(grpc_installer_go.InstallRequest{RequestId: "r2", OrganizationId: "org", ClusterId: "c2"}, DefaultInstallTemplate, "")
+		leader.Batches["b1"] = &Batch{BatchID: "b1", OrganizationID: "org", RequestIDs: []string{"r1", "r2"}, Concurrency: 1}
+		leader.Unlock()
+		leader.WorkflowCallback("r1", nil, workflow.FinishedState)
+		leader.WorkflowCallback("r2", nil, workflow.InProgressState)
+	})
+
+	ginkgo.It("should always lead if the election is disabled", func() {
+		manager := NewManager(config.Config{MaxLogEntries: 10})
+		gomega.Expect(manager.Leadership.IsLeader()).To(gomega.BeTrue())
+		gomega.Expect(manager.requireLeader()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject operations on followers", func() {
+		_, err := follower.InstallCluster(grpc_installer_go.InstallRequest{RequestId: "r3", OrganizationId: "org"}, TemplateSelection{}, "")
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring("not the leader"))
+		gomega.Expect(follower.RemoveInstall("r1")).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should serve the progress published by the leader on followers", func() {
+		_, err := follower.GetProgress("r1")
+		gomega.Expect(err).NotTo(gomega.BeNil())
+
+		gomega.Expect(leader.PublishState()).To(gomega.Succeed())
+		operation, err := follower.GetProgress("r1")
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(*operation.GetState()).To(gomega.Equal(grpc_common_go.OpStatus_SUCCESS))
+
+		progress, err := follower.GetBatchProgress("b1")
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(progress.Status).To(gomega.Equal(grpc_common_go.OpStatus_INPROGRESS.String()))
+		gomega.Expect(progress.Succeeded).To(gomega.Equal(1))
+		gomega.Expect(progress.Clusters[1].ClusterID).To(gomega.Equal("c2"))
+	})
+
+	ginkgo.It("should fail the running operations of the previous leader when taking over", func() {
+		gomega.Expect(leader.PublishState()).To(gomega.Succeed())
+		follower.Leadership.setLeading(true)
+		gomega.Expect(follower.adoptState()).To(gomega.Succeed())
+
+		operation, err := follower.GetProgress("r1")
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(*operation.GetState()).To(gomega.Equal(grpc_common_go.OpStatus_SUCCESS))
+		operation, err = follower.GetProgress("r2")
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(*operation.GetState()).To(gomega.Equal(grpc_common_go.OpStatus_FAILED))
+		gomega.Expect(operation.ToGRPCOpResponse().Error).To(gomega.ContainSubstring("change of leader"))
+
+		progress, err := follower.GetBatchProgress("b1")
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(progress.Status).To(gomega.Equal(grpc_common_go.OpStatus_FAILED.String()))
+	})
+
+	ginkgo.It("should stop the running workflows when the leadership is lost", func() {
+		leader.ExecHandler = workflow.NewExecutorHandler()
+		_, err := leader.ExecHandler.Add(workflow.NewWorkflow("r2", "install", "", make([]entities.Command, 1)), leader.WorkflowCallback)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		follower.stepDown()
+		gomega.Expect(follower.Operations).To(gomega.BeEmpty())
+
+		leader.stepDown()
+		gomega.Expect(leader.Leadership.IsLeader()).To(gomega.BeFalse())
+		_, err = leader.ExecHandler.Get("r2")
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		gomega.Expect(*leader.Operations["r1"].GetState()).To(gomega.Equal(grpc_common_go.OpStatus_SUCCESS))
+		gomega.Expect(*leader.Operations["r2"].GetState()).To(gomega.Equal(grpc_common_go.OpStatus_FAILED))
+		gomega.Expect(leader.Operations["r2"].ToGRPCOpResponse().Error).To(gomega.ContainSubstring("loss of leadership"))
+
+		// The command running when the workflow was stopped does not change the status once it finishes.
+		leader.WorkflowCallback("r2", nil, workflow.FinishedState)
+		gomega.Expect(*leader.Operations["r2"].GetState()).To(gomega.Equal(grpc_common_go.OpStatus_FAILED))
+	})
+
+	ginkgo.It("should ignore the operations removed while the leadership is lost", func() {
+		leader.Lock()
+		delete(leader.Operations, "r2")
+		leader.Unlock()
+		gomega.Expect(func() {
+			leader.markOperationAsFailed("r2", derrors.NewUnavailableError("operation interrupted by a loss of leadership"))
+			leader.WorkflowCallback("r2", nil, workflow.FinishedState)
+		}).NotTo(gomega.Panic())
+		gomega.Expect(leader.Operations).NotTo(gomega.HaveKey("r2"))
+	})
+})
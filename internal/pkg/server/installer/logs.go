@@ -0,0 +1,256 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/server/config"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLogPageSize is the number of entries returned when the request does not specify a limit.
+const DefaultLogPageSize = 100
+
+// MaxLogPageSize is the maximum number of entries returned in a single page.
+const MaxLogPageSize = 1000
+
+// LogEntry structure with a log line produced by a workflow.
+type LogEntry struct {
+	// Timestamp with the time the entry was produced.
+	Timestamp time.Time `json:"timestamp"`
+	// Message of the entry.
+	Message string `json:"message"`
+}
+
+// LogPage structure with a page of the log of a workflow.
+type LogPage struct {
+	// Entries of the page.
+	Entries []LogEntry
+	// Offset with the index of the first entry of the page. It may be greater than the requested one if the
+	// older entries are no longer available.
+	Offset int
+	// Total number of entries produced by the workflow.
+	Total int
+}
+
+// LogStore structure that captures the log entries of each workflow. The latest entries are kept in memory, and
+// if a path is set, every entry is also appended to a file per workflow so complete logs can be retrieved. The
+// entries are the ones reported by the executor of the workflow: the commands being executed, the log and output
+// they report, and their failures. The events the commands write with zerolog cannot be attributed to a workflow,
+// as several workflows run at the same time, so they are only written to the output of the service.
+type LogStore struct {
+	sync.Mutex
+	// path of the directory with the log files, empty to keep the logs in memory only.
+	path string
+	// maxEntries with the number of entries kept in memory per workflow.
+	maxEntries int
+	// entries by workflow identifier.
+	entries map[string][]LogEntry
+	// dropped contains the number of entries discarded from memory by workflow identifier.
+	dropped map[string]int
+}
+
+// NewLogStore creates a LogStore.
+//   params:
+//     path The directory where the log files are written, empty to keep the logs in memory only.
+//     maxEntries The number of entries kept in memory per workflow.
+//   returns:
+//     A LogStore.
+func NewLogStore(path string, maxEntries int) *LogStore {
+	if maxEntries <= 0 {
+		maxEntries = config.DefaultMaxLogEntries
+	}
+	if path != "" {
+		if err := os.MkdirAll(path, 0700); err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("cannot create logs directory, keeping logs in memory")
+			path = ""
+		}
+	}
+	return &LogStore{
+		path:       path,
+		maxEntries: maxEntries,
+		entries:    make(map[string][]LogEntry, 0),
+		dropped:    make(map[string]int, 0),
+	}
+}
+
+// logFile returns the path of the log file of a workflow.
+func (ls *LogStore) logFile(workflowID string) string {
+	return filepath.Join(ls.path, filepath.Base(workflowID)+".log")
+}
+
+// Append adds an entry to the log of a workflow.
+func (ls *LogStore) Append(workflowID string, msg string) {
+	entry := LogEntry{Timestamp: time.Now().UTC(), Message: msg}
+	ls.Lock()
+	defer ls.Unlock()
+	current := append(ls.entries[workflowID], entry)
+	if len(current) > ls.maxEntries {
+		ls.dropped[workflowID] += len(current) - ls.maxEntries
+		current = current[len(current)-ls.maxEntries:]
+	}
+	ls.entries[workflowID] = current
+	if ls.path == "" {
+		return
+	}
+	file, err := os.OpenFile(ls.logFile(workflowID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Warn().Err(err).Str("workflowID", workflowID).Msg("cannot open workflow log file")
+		return
+	}
+	defer file.Close()
+	// Multiline messages are escaped so each entry takes a single line of the file.
+	message := strings.Replace(msg, "\n", "\\n", -1)
+	if _, err := fmt.Fprintf(file, "%s %s\n", entry.Timestamp.Format(time.RFC3339Nano), message); err != nil {
+		log.Warn().Err(err).Str("workflowID", workflowID).Msg("cannot write workflow log file")
+	}
+}
+
+// Get retrieves a page of the log of a workflow.
+//   params:
+//     workflowID The workflow identifier.
+//     offset The index of the first entry to be returned.
+//     limit The maximum number of entries to be returned.
+//   returns:
+//     The requested page.
+//     An error if the workflow log is not found.
+func (ls *LogStore) Get(workflowID string, offset int, limit int) (*LogPage, derrors.Error) {
+	if offset < 0 {
+		return nil, derrors.NewInvalidArgumentError("offset cannot be negative").WithParams(offset)
+	}
+	if limit <= 0 {
+		limit = DefaultLogPageSize
+	}
+	if limit > MaxLogPageSize {
+		limit = MaxLogPageSize
+	}
+	ls.Lock()
+	inMemory, found := ls.entries[workflowID]
+	dropped := ls.dropped[workflowID]
+	ls.Unlock()
+
+	var all []LogEntry
+	first := 0
+	if ls.path != "" && (!found || (dropped > 0 && offset < dropped)) {
+		// The file contains the complete log.
+		fromFile, err := ls.readFile(workflowID)
+		if err != nil {
+			return nil, err
+		}
+		all = fromFile
+	} else if found {
+		all = inMemory
+		first = dropped
+	} else {
+		return nil, derrors.NewNotFoundError("workflow logs not found").WithParams(workflowID)
+	}
+
+	total := first + len(all)
+	start := offset - first
+	if start < 0 {
+		start = 0
+	}
+	if start > len(all) {
+		start = len(all)
+	}
+	end := start + limit
+	if end > len(all) {
+		end = len(all)
+	}
+	entries := make([]LogEntry, end-start)
+	copy(entries, all[start:end])
+	return &LogPage{Entries: entries, Offset: first + start, Total: total}, nil
+}
+
+// Tail retrieves the latest log entries of a workflow.
+//   params:
+//     workflowID The workflow identifier.
+//     last The number of entries to be returned, at most MaxLogPageSize.
+//   returns:
+//     The page with the latest entries.
+//     An error if the workflow log is not found.
+func (ls *LogStore) Tail(workflowID string, last int) (*LogPage, derrors.Error) {
+	if last <= 0 {
+		return nil, derrors.NewInvalidArgumentError("the number of entries must be positive").WithParams(last)
+	}
+	if last > MaxLogPageSize {
+		last = MaxLogPageSize
+	}
+	ls.Lock()
+	inMemory, found := ls.entries[workflowID]
+	total := ls.dropped[workflowID] + len(inMemory)
+	ls.Unlock()
+	if !found {
+		// Only the file of the workflow is available.
+		page, err := ls.Get(workflowID, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		total = page.Total
+	}
+	offset := total - last
+	if offset < 0 {
+		offset = 0
+	}
+	return ls.Get(workflowID, offset, last)
+}
+
+// readFile reads the log file of a workflow.
+func (ls *LogStore) readFile(workflowID string) ([]LogEntry, derrors.Error) {
+	file, err := os.Open(ls.logFile(workflowID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, derrors.NewNotFoundError("workflow logs not found").WithParams(workflowID)
+		}
+		return nil, derrors.NewInternalError("cannot read workflow logs", err).WithParams(workflowID)
+	}
+	defer file.Close()
+	result := make([]LogEntry, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		entry := LogEntry{}
+		if timestamp, err := time.Parse(time.RFC3339Nano, parts[0]); err == nil {
+			entry.Timestamp = timestamp
+		}
+		if len(parts) > 1 {
+			entry.Message = strings.Replace(parts[1], "\\n", "\n", -1)
+		}
+		result = append(result, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, derrors.NewInternalError("cannot read workflow logs", err).WithParams(workflowID)
+	}
+	return result, nil
+}
+
+// Remove discards the in memory log of a workflow. Log files are kept.
+func (ls *LogStore) Remove(workflowID string) {
+	ls.Lock()
+	delete(ls.entries, workflowID)
+	delete(ls.dropped, workflowID)
+	ls.Unlock()
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"fmt"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+)
+
+var _ = ginkgo.Describe("Log store", func() {
+
+	ginkgo.It("should page the entries kept in memory", func() {
+		store := NewLogStore("", 10)
+		for i := 0; i < 5; i++ {
+			store.Append("request", fmt.Sprintf("msg%d", i))
+		}
+		page, err := store.Get("request", 1, 2)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(page.Total).To(gomega.Equal(5))
+		gomega.Expect(page.Offset).To(gomega.Equal(1))
+		gomega.Expect(len(page.Entries)).To(gomega.Equal(2))
+		gomega.Expect(page.Entries[0].Message).To(gomega.Equal("msg1"))
+
+		page, err = store.Get("request", 10, 2)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(page.Entries).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should discard the oldest entries in memory", func() {
+		store := NewLogStore("", 3)
+		for i := 0; i < 5; i++ {
+			store.Append("request", fmt.Sprintf("msg%d", i))
+		}
+		page, err := store.Get("request", 0, 10)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(page.Total).To(gomega.Equal(5))
+		gomega.Expect(page.Offset).To(gomega.Equal(2))
+		gomega.Expect(page.Entries[0].Message).To(gomega.Equal("msg2"))
+	})
+
+	ginkgo.It("should retrieve the complete log from the files", func() {
+		dir, err := ioutil.TempDir("", "installer-logs")
+		gomega.Expect(err).To(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		store := NewLogStore(dir, 2)
+		for i := 0; i < 5; i++ {
+			store.Append("request", fmt.Sprintf("line1\nmsg%d", i))
+		}
+		page, dErr := store.Get("request", 0, 10)
+		gomega.Expect(dErr).To(gomega.BeNil())
+		gomega.Expect(page.Total).To(gomega.Equal(5))
+		gomega.Expect(page.Entries[0].Message).To(gomega.Equal("line1\nmsg0"))
+
+		// Logs are available after removing the operation.
+		store.Remove("request")
+		page, dErr = store.Get("request", 4, 10)
+		gomega.Expect(dErr).To(gomega.BeNil())
+		gomega.Expect(len(page.Entries)).To(gomega.Equal(1))
+	})
+
+	ginkgo.It("should retrieve the latest entries", func() {
+		store := NewLogStore("", 3)
+		for i := 0; i < 5; i++ {
+			store.Append("request", fmt.Sprintf("msg%d", i))
+		}
+		page, err := store.Tail("request", 2)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(page.Total).To(gomega.Equal(5))
+		gomega.Expect(page.Offset).To(gomega.Equal(3))
+		gomega.Expect(page.Entries[0].Message).To(gomega.Equal("msg3"))
+		gomega.Expect(page.Entries[1].Message).To(gomega.Equal("msg4"))
+
+		page, err = store.Tail("request", 10)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(page.Entries).To(gomega.HaveLen(3))
+		_, err = store.Tail("request", 0)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("should retrieve the latest page when more entries than a page are requested", func() {
+		store := NewLogStore("", 2*MaxLogPageSize)
+		for i := 0; i < 2*MaxLogPageSize; i++ {
+			store.Append("request", fmt.Sprintf("msg%d", i))
+		}
+		page, err := store.Tail("request", MaxLogPageSize+MaxLogPageSize/2)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(page.Total).To(gomega.Equal(2 * MaxLogPageSize))
+		gomega.Expect(page.Offset).To(gomega.Equal(MaxLogPageSize))
+		gomega.Expect(page.Entries).To(gomega.HaveLen(MaxLogPageSize))
+		gomega.Expect(page.Entries[MaxLogPageSize-1].Message).To(gomega.Equal(fmt.Sprintf("msg%d", 2*MaxLogPageSize-1)))
+	})
+
+	ginkgo.It("should fail for unknown workflows", func() {
+		store := NewLogStore("", 10)
+		_, err := store.Get("unknown", 0, 10)
+		gomega.Expect(err).ToNot(gomega.BeNil())
+	})
+})
@@ -20,13 +20,19 @@ package installer
 import (
 	"github.com/nalej/grpc-common-go"
 	"github.com/nalej/installer/internal/pkg/entities"
+	"github.com/nalej/installer/internal/pkg/server/extensions"
+	"io/ioutil"
 	"sync"
+	"time"
 
 	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-installer-go"
 	"github.com/nalej/installer/internal/pkg/server/config"
+	"github.com/nalej/installer/internal/pkg/server/notifications"
 	"github.com/nalej/installer/internal/pkg/templates"
 	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/istio"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
 	"github.com/rs/zerolog/log"
 )
 
@@ -42,24 +48,58 @@ type Manager struct {
 	ExecHandler workflow.ExecutorHandler
 	// Parser to parametrize templates for execution.
 	Parser *workflow.Parser
+	// Templates with the registry of available workflow templates.
+	Templates *templates.Registry
+	// OrganizationTemplates with the registry of the templates overridden by each organization.
+	OrganizationTemplates map[string]*templates.Registry
 	// InstallRequest by request identifier
 	InstallRequests map[string]grpc_installer_go.InstallRequest
 	// UninstallRequest by request identifier
 	UninstallRequests map[string]grpc_installer_go.UninstallClusterRequest
 	// Operations with the list of ongoing operations.
 	Operations map[string]*Operation
+	// Logs with the log entries captured for each operation.
+	Logs *LogStore
+	// JoinTokens with the installs waiting to be claimed by application clusters.
+	JoinTokens *JoinTokenStore
+	// Batches with the batches of installs by batch identifier.
+	Batches map[string]*Batch
+	// History with the records of the finished installs and uninstalls.
+	History *HistoryStore
+	// Leadership with the state of the leader election among the replicas of the installer.
+	Leadership *Leadership
+	// State with the store of the state shared among the replicas, nil if leader election is disabled.
+	State *StateStore
+	// Notifications with the dispatcher of the notifications of the installs and uninstalls.
+	Notifications *notifications.Dispatcher
 }
 
 // NewManager creates a new installer manager.
 func NewManager(config config.Config) Manager {
+	registry := templates.NewRegistry()
+	paths := workflow.NewPaths(config.ComponentsPath, config.BinaryPath, config.TempPath)
+	paths.ComponentsPublicKeyPath = config.ComponentsPublicKeyPath
+	paths.RegistriesPath = config.RegistriesPath
+	paths.SecretStorePath = config.SecretStorePath
+	paths.NamespaceGovernancePath = config.NamespaceGovernancePath
+	paths.CRDsPath = config.CRDsPath
+	paths.StorageClassesPath = config.StorageClassesPath
 	return Manager{
-		Config:            config,
-		Paths:             *workflow.NewPaths(config.ComponentsPath, config.BinaryPath, config.TempPath),
-		ExecHandler:       workflow.GetExecutorHandler(),
-		Parser:            workflow.NewParser(),
-		InstallRequests:   make(map[string]grpc_installer_go.InstallRequest, 0),
-		UninstallRequests: make(map[string]grpc_installer_go.UninstallClusterRequest, 0),
-		Operations:        make(map[string]*Operation, 0),
+		Config:                config,
+		Paths:                 *paths,
+		ExecHandler:           workflow.GetExecutorHandler(),
+		Parser:                workflow.NewParser().WithTemplates(registry),
+		Templates:             registry,
+		OrganizationTemplates: make(map[string]*templates.Registry, 0),
+		InstallRequests:       make(map[string]grpc_installer_go.InstallRequest, 0),
+		UninstallRequests:     make(map[string]grpc_installer_go.UninstallClusterRequest, 0),
+		Operations:            make(map[string]*Operation, 0),
+		Logs:                  NewLogStore(config.LogsPath, config.MaxLogEntries),
+		JoinTokens:            NewJoinTokenStore(),
+		Batches:               make(map[string]*Batch, 0),
+		History:               NewHistoryStore(config.HistoryPath, config.HistoryRetention, config.MaxHistoryRecords),
+		Leadership:            NewLeadership("", false),
+		Notifications:         notifications.NewDispatcher(config.Notifications),
 	}
 }
 
@@ -68,24 +108,63 @@ func (m *Manager) unsafeExist(requestID string) bool {
 	return exists
 }
 
-func (m *Manager) unsafeInstallRegister(installRequest grpc_installer_go.InstallRequest) {
+// LoadTemplates registers the workflow templates found in the configuration path.
+func (m *Manager) LoadTemplates() derrors.Error {
+	if m.Config.ConfPath == "" {
+		return nil
+	}
+	if err := m.Templates.LoadFromPath(m.Config.ConfPath); err != nil {
+		return err
+	}
+	return m.loadOrganizationTemplates()
+}
+
+func (m *Manager) unsafeInstallRegister(installRequest grpc_installer_go.InstallRequest, selection TemplateSelection, initiator string) {
 	m.InstallRequests[installRequest.RequestId] = installRequest
-	m.Operations[installRequest.RequestId] = NewOperation(installRequest.OrganizationId, installRequest.RequestId, InstallOperation)
+	operation := NewOperation(installRequest.OrganizationId, installRequest.RequestId, InstallOperation)
+	operation.ClusterID = installRequest.ClusterId
+	operation.Initiator = initiator
+	operation.TemplateName = selection.Name
+	operation.TemplateVersion = selection.Version
+	operation.Platform = selection.Platform
+	m.Operations[installRequest.RequestId] = operation
 }
 
-func (m *Manager) unsafeUninstallRegister(request grpc_installer_go.UninstallClusterRequest) {
+func (m *Manager) unsafeUninstallRegister(request grpc_installer_go.UninstallClusterRequest, initiator string) {
 	m.UninstallRequests[request.RequestId] = request
-	m.Operations[request.RequestId] = NewOperation(request.OrganizationId, request.RequestId, UninstallOperation)
+	operation := NewOperation(request.OrganizationId, request.RequestId, UninstallOperation)
+	operation.ClusterID = request.ClusterId
+	operation.Initiator = initiator
+	m.Operations[request.RequestId] = operation
 }
 
-func (m *Manager) InstallCluster(installRequest grpc_installer_go.InstallRequest) (*Operation, derrors.Error) {
+// InstallCluster registers an install and launches it in the background.
+//   params:
+//     installRequest The install request.
+//     selection The workflow template to be used.
+//     initiator The subject of the caller, recorded in the install history.
+//   returns:
+//     The registered operation.
+//     An error if the install cannot be launched.
+func (m *Manager) InstallCluster(installRequest grpc_installer_go.InstallRequest, selection TemplateSelection, initiator string) (*Operation, derrors.Error) {
 	var result *Operation
+	if err := m.requireLeader(); err != nil {
+		return nil, err
+	}
+	selection = selection.withDefault()
+	if err := m.checkSelection(installRequest.OrganizationId, selection); err != nil {
+		return nil, err
+	}
 	m.Lock()
 	if m.unsafeExist(installRequest.RequestId) {
 		m.Unlock()
 		return nil, derrors.NewAlreadyExistsError("requestID").WithParams(installRequest.RequestId)
 	}
-	m.unsafeInstallRegister(installRequest)
+	if err := m.unsafeCheckQuota(installRequest.OrganizationId); err != nil {
+		m.Unlock()
+		return nil, err
+	}
+	m.unsafeInstallRegister(installRequest, selection, initiator)
 	status, _ := m.Operations[installRequest.RequestId]
 	result = status.Clone()
 	m.Unlock()
@@ -93,12 +172,202 @@ func (m *Manager) InstallCluster(installRequest grpc_installer_go.InstallRequest
 	return result, nil
 }
 
+// checkSelection checks that the selected template exists for an organization and the platform is supported.
+func (m *Manager) checkSelection(organizationID string, selection TemplateSelection) derrors.Error {
+	if err := entities.ValidPlatform(selection.Platform); err != nil {
+		return err
+	}
+	_, err := m.getTemplate(organizationID, selection.Name, selection.Version)
+	return err
+}
+
+// CreateJoinToken registers an install to be performed by the installer running inside the application cluster.
+//   params:
+//     installRequest The install request.
+//     selection The workflow template to be used.
+//     ttl The validity of the token, zero to use the default one.
+//   returns:
+//     The token.
+//     The pending join associated with the token.
+//     An error if the template does not exist or the token cannot be created.
+func (m *Manager) CreateJoinToken(installRequest grpc_installer_go.InstallRequest, selection TemplateSelection, ttl time.Duration) (string, *PendingJoin, derrors.Error) {
+	if err := m.requireLeader(); err != nil {
+		return "", nil, err
+	}
+	selection = selection.withDefault()
+	if err := m.checkSelection(installRequest.OrganizationId, selection); err != nil {
+		return "", nil, err
+	}
+	m.Lock()
+	exists := m.unsafeExist(installRequest.RequestId)
+	m.Unlock()
+	if exists {
+		return "", nil, derrors.NewAlreadyExistsError("requestID").WithParams(installRequest.RequestId)
+	}
+	return m.JoinTokens.Create(installRequest, selection, ttl)
+}
+
+// GetInstallPlan exchanges a join token for the install plan of the application cluster. The plan contains the
+// same parameters that the installer service uses when it performs the install itself.
+func (m *Manager) GetInstallPlan(token string) (*extensions.InstallPlan, derrors.Error) {
+	if err := m.requireLeader(); err != nil {
+		return nil, err
+	}
+	pending, err := m.JoinTokens.Claim(token)
+	if err != nil {
+		return nil, err
+	}
+	template, err := m.getTemplate(pending.InstallRequest.OrganizationId, pending.Selection.Name, pending.Selection.Version)
+	if err != nil {
+		return nil, err
+	}
+	caCert := ""
+	if m.Config.ClusterCertIssuerCACertPath != "" {
+		content, rErr := ioutil.ReadFile(m.Config.ClusterCertIssuerCACertPath)
+		if rErr != nil {
+			return nil, derrors.AsError(rErr, "cannot read cluster cert issuer CA certificate")
+		}
+		caCert = string(content)
+	}
+	ingressCert := &k8s.Certificate{}
+	if m.Config.IngressCertificate != "" {
+		ingressCert, err = m.loadIngressCertificate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Info().Str("organizationID", pending.InstallRequest.OrganizationId).Str("requestID", pending.InstallRequest.RequestId).Msg("join token claimed")
+	return &extensions.InstallPlan{
+		RequestID:             pending.InstallRequest.RequestId,
+		InstallRequest:        pending.InstallRequest,
+		TemplateName:          template.Name,
+		TemplateVersion:       template.Version,
+		Template:              template.Content,
+		ManagementClusterHost: m.Config.ManagementClusterHost,
+		ManagementClusterPort: m.Config.ManagementClusterPort,
+		DNSClusterHost:        m.Config.DNSClusterHost,
+		DNSClusterPort:        m.Config.DNSClusterPort,
+		TargetEnvironment:     entities.TargetEnvironmentToString[m.Config.Environment.Target],
+		NetworkingMode:        entities.NetworkingModeToString[m.Config.NetworkingMode],
+		IstioPath:             m.Config.IstioPath,
+		IstioRevision:         m.Config.IstioRevision,
+		IstioTrustDomain:      m.Config.IstioTrustDomain,
+		IstioNamespace:        m.Config.IstioNamespace,
+		IstioIngressGateway:   m.Config.IstioIngressGateway,
+		IstioCASecret:         m.Config.IstioCASecret,
+		IstioGatewayIP:        m.istioGatewayIP(),
+		IngressController:     m.Config.IngressController,
+		AuthSecret:            m.Config.AuthSecret,
+		CACert:                caCert,
+		IngressCert:           string(ingressCert.Cert),
+		IngressKey:            string(ingressCert.Key),
+		IngressCA:             string(ingressCert.CA),
+		CertificateIssuer:     m.Config.CertificateIssuer,
+		HardenNetwork:         m.Config.HardenNetwork,
+		WithObservability:     m.Config.WithObservability,
+		LoggingStack:          m.Config.LoggingStack,
+		LogRetention:          m.Config.LogRetention,
+		LogStorageSize:        m.Config.LogStorageSize,
+		StorageProvisioner:    m.Config.StorageProvisioner,
+		NFSShare:              m.Config.NFSShare,
+		Prune:                 m.Config.Prune,
+		AdoptExisting:         m.Config.AdoptExisting,
+		MigrateVolumes:        m.Config.MigrateVolumes,
+		FeatureFlags:          m.Config.FeatureFlags,
+		AllowUnsupported:      m.Config.AllowUnsupportedVersions,
+		Platform:              pending.Selection.Platform,
+	}, nil
+}
+
+// istioGatewayIP returns the IP of the Istio ingress gateway sent to the application clusters joining with a plan, as
+// they cannot look it up in the management cluster. If it is not configured, the gateway is looked up in the cluster
+// where the installer runs, and the joining cluster looks it up itself if that fails.
+func (m *Manager) istioGatewayIP() string {
+	if m.Config.IstioGatewayIP != "" || m.Config.NetworkingMode != entities.NetworkingModeIstio {
+		return m.Config.IstioGatewayIP
+	}
+	management := &k8s.Kubernetes{}
+	if err := management.Connect(); err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Msg("cannot connect to look up the istio gateway")
+		return ""
+	}
+	namespace, gateway := m.Config.IstioNamespace, m.Config.IstioIngressGateway
+	if namespace == "" {
+		namespace = istio.IstioNamespace
+	}
+	if gateway == "" {
+		gateway = istio.IstioIngressGateway
+	}
+	ip, err := istio.GatewayIP(management, namespace, gateway)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Msg("cannot look up the istio gateway")
+		return ""
+	}
+	return ip
+}
+
+// loadIngressCertificate reads the wildcard certificate copied to the application clusters from the cluster where the
+// installer runs.
+func (m *Manager) loadIngressCertificate() (*k8s.Certificate, derrors.Error) {
+	namespace, name, err := k8s.SplitSecretReference(m.Config.IngressCertificate)
+	if err != nil {
+		return nil, err
+	}
+	source := &k8s.Kubernetes{}
+	if err := source.Connect(); err != nil {
+		return nil, err
+	}
+	return source.LoadCertificateSecret(namespace, name)
+}
+
 func (m *Manager) markOperationAsFailed(requestID string, error derrors.Error) {
 	m.Lock()
-	status, _ := m.Operations[requestID]
+	defer m.Unlock()
+	status, exist := m.Operations[requestID]
+	if !exist {
+		// The operation may be removed while its workflow is stopped.
+		log.Warn().Str("requestID", requestID).Str("error", error.Error()).Msg("cannot mark a removed operation as failed")
+		return
+	}
+	m.Logs.Append(requestID, error.Error())
+	alreadyFailed := *status.GetState() == grpc_common_go.OpStatus_FAILED
 	status.UpdateError(error)
 	status.UpdateStatus(grpc_common_go.OpStatus_FAILED)
-	m.Unlock()
+	m.unsafeRecordHistory(status)
+	if !alreadyFailed {
+		m.unsafeNotify(status, notifications.Failed, error)
+	}
+}
+
+// unsafeNotify sends the notifications of an event of an install or uninstall.
+func (m *Manager) unsafeNotify(operation *Operation, event notifications.Event, err derrors.Error) {
+	if operation.OperationName != InstallOperation && operation.OperationName != UninstallOperation {
+		return
+	}
+	m.Notifications.Send(operation.toNotification(event, err, time.Now()))
+}
+
+// unsafeRecordHistory adds a finished install or uninstall to the history.
+func (m *Manager) unsafeRecordHistory(operation *Operation) {
+	if operation.OperationName != InstallOperation && operation.OperationName != UninstallOperation {
+		return
+	}
+	if err := m.History.Record(operation.toHistoryRecord(time.Now())); err != nil {
+		log.Warn().Str("requestID", operation.RequestID).Str("trace", err.DebugReport()).Msg("cannot record install history")
+	}
+}
+
+// ListInstalls retrieves a page of the finished installs and uninstalls, from the newest to the oldest.
+//   params:
+//     filter The conditions of the records.
+//     offset The index of the first record to be returned.
+//     limit The maximum number of records to be returned.
+//   returns:
+//     The records of the page.
+//     The total number of records satisfying the filter.
+//     An error if the history cannot be read.
+func (m *Manager) ListInstalls(filter HistoryFilter, offset int, limit int) ([]HistoryRecord, int, derrors.Error) {
+	return m.History.List(filter, offset, limit)
 }
 
 func (m *Manager) launchInstall(requestID string) {
@@ -114,37 +383,77 @@ func (m *Manager) launchInstall(requestID string) {
 
 	// The network configuration is taken from the running parameters of the installer service
 	networkingConfig := workflow.NetworkConfig{
-		NetworkingMode: entities.NetworkingModeToString[m.Config.NetworkingMode],
-		IstioPath: m.Config.IstioPath,
-		ZTPlanetSecretPath: "",
+		NetworkingMode:      entities.NetworkingModeToString[m.Config.NetworkingMode],
+		IstioPath:           m.Config.IstioPath,
+		IstioRevision:       m.Config.IstioRevision,
+		IstioTrustDomain:    m.Config.IstioTrustDomain,
+		IstioNamespace:      m.Config.IstioNamespace,
+		IstioIngressGateway: m.Config.IstioIngressGateway,
+		IstioCASecret:       m.Config.IstioCASecret,
+		IstioGatewayIP:      m.Config.IstioGatewayIP,
+		IngressController:   m.Config.IngressController,
+		ClusterDomain:       m.Config.ClusterDomain,
+		ZTPlanetSecretPath:  "",
+	}
+
+	paths, err := m.organizationPaths(request.OrganizationId)
+	if err != nil {
+		log.Error().Str("err", err.DebugReport()).Msg("cannot prepare organization paths")
+		m.markOperationAsFailed(requestID, err)
+		return
 	}
 
 	// Create Parameters
 	params := workflow.NewInstallParameters(
-		&request, workflow.Assets{}, m.Paths,
+		&request, workflow.Assets{}, paths,
 		m.Config.ManagementClusterHost, m.Config.ManagementClusterPort,
 		m.Config.DNSClusterHost, m.Config.DNSClusterPort,
 		m.Config.Environment.Target,
 		true,
 		networkingConfig, m.Config.AuthSecret, m.Config.ClusterCertIssuerCACertPath)
+	params.HardenNetwork = m.Config.HardenNetwork
+	params.WithObservability = m.Config.WithObservability
+	params.LoggingStack = m.Config.LoggingStack
+	params.LogRetention = m.Config.LogRetention
+	params.LogStorageSize = m.Config.LogStorageSize
+	params.StorageProvisioner = m.Config.StorageProvisioner
+	params.NFSShare = m.Config.NFSShare
+	params.IngressCertificate = m.Config.IngressCertificate
+	params.CertificateIssuer = m.Config.CertificateIssuer
+	params.Prune = m.Config.Prune
+	params.AdoptExisting = m.Config.AdoptExisting
+	params.MigrateVolumes = m.Config.MigrateVolumes
+	params.FeatureFlags = m.Config.FeatureFlags
+	params.AllowUnsupportedVersions = m.Config.AllowUnsupportedVersions
+	params.Platform = status.Platform
+	params.StrictIdentifiers = true
 
 	status.Params = params
-	err := status.Params.LoadCredentials()
+	err = status.Params.LoadCredentials()
 	if err != nil {
 		log.Error().Str("err", err.DebugReport()).Msg("cannot load credentials")
 		m.markOperationAsFailed(requestID, err)
+		return
 	}
 	err = status.Params.Validate()
 	if err != nil {
 		log.Error().Str("err", err.DebugReport()).Msg("invalid parameters")
 		m.markOperationAsFailed(requestID, err)
+		return
 	}
 
 	// Create Workflow
-	workflow, err := m.Parser.ParseWorkflow(requestID, templates.InstallManagementCluster, requestID, *status.Params)
+	template, err := m.getTemplate(status.OrganizationID, status.TemplateName, status.TemplateVersion)
+	if err != nil {
+		log.Error().Str("err", err.DebugReport()).Msg("cannot retrieve workflow template")
+		m.markOperationAsFailed(requestID, err)
+		return
+	}
+	workflow, err := m.Parser.ParseWorkflow(requestID, template.Content, requestID, *status.Params)
 	if err != nil {
 		log.Error().Str("err", err.DebugReport()).Msg("cannot parse workflow")
 		m.markOperationAsFailed(requestID, err)
+		return
 	}
 	status.Workflow = workflow
 
@@ -153,12 +462,21 @@ func (m *Manager) launchInstall(requestID string) {
 	if err != nil {
 		log.Error().Str("err", err.DebugReport()).Msg("cannot parse workflow")
 		m.markOperationAsFailed(requestID, err)
+		return
+	}
+	exec.SetLogListener(m.workflowLogListener(requestID))
+	m.Lock()
+	if *status.GetState() != grpc_common_go.OpStatus_FAILED {
+		m.unsafeNotify(status, notifications.Started, nil)
 	}
-	exec.SetLogListener(m.logListener)
+	m.Unlock()
 	exec.Exec()
 }
 
 func (m *Manager) GetProgress(requestID string) (*Operation, derrors.Error) {
+	if !m.Leadership.IsLeader() {
+		return m.getSharedProgress(requestID)
+	}
 	m.Lock()
 	defer m.Unlock()
 	if !m.unsafeExist(requestID) {
@@ -180,6 +498,12 @@ func (m *Manager) WorkflowCallback(
 	status, exist := m.Operations[workflowID]
 	if !exist {
 		log.Warn().Str("workflowID", workflowID).Msg("received callback for unregistered workflow")
+		return
+	}
+	if *status.GetState() == grpc_common_go.OpStatus_FAILED {
+		// The operation was failed by the manager, e.g. when its workflow was stopped by a loss of leadership, and
+		// the command that was running when it was stopped does not change its status.
+		return
 	}
 	if error != nil {
 		status.UpdateStatus(grpc_common_go.OpStatus_FAILED)
@@ -197,20 +521,41 @@ func (m *Manager) WorkflowCallback(
 		return
 	case workflow.FinishedState:
 		status.UpdateStatus(grpc_common_go.OpStatus_SUCCESS)
+		m.unsafeRecordHistory(status)
+		m.unsafeNotify(status, notifications.Succeeded, nil)
 		return
 	case workflow.ErrorState:
 		status.UpdateStatus(grpc_common_go.OpStatus_FAILED)
+		m.unsafeRecordHistory(status)
+		m.unsafeNotify(status, notifications.Failed, error)
 	default:
 		log.Warn().Interface("state", state).Msg("State not recognized")
 	}
 }
 
-func (m *Manager) logListener(msg string) {
-	// TODO store the information on the install status
-	log.Info().Msg(msg)
+// workflowLogListener returns a listener that captures the log entries reported by the executor of a workflow,
+// writing them also to the output of the service with the request identifier.
+func (m *Manager) workflowLogListener(requestID string) func(msg string) {
+	return func(msg string) {
+		log.Info().Str("requestID", requestID).Msg(msg)
+		m.Logs.Append(requestID, msg)
+	}
+}
+
+// GetLogs retrieves a page of the log entries captured for an operation.
+func (m *Manager) GetLogs(requestID string, offset int, limit int) (*LogPage, derrors.Error) {
+	return m.Logs.Get(requestID, offset, limit)
+}
+
+// TailLogs retrieves the latest log entries captured for an operation.
+func (m *Manager) TailLogs(requestID string, last int) (*LogPage, derrors.Error) {
+	return m.Logs.Tail(requestID, last)
 }
 
 func (m *Manager) RemoveInstall(requestID string) derrors.Error {
+	if err := m.requireLeader(); err != nil {
+		return err
+	}
 	m.Lock()
 	// Determine the type of operation
 	op, existsOp := m.Operations[requestID]
@@ -241,19 +586,34 @@ func (m *Manager) RemoveInstall(requestID string) derrors.Error {
 		m.Lock()
 		delete(m.Operations, requestID)
 		m.Unlock()
+		m.Logs.Remove(requestID)
 	}
 
 	return nil
 }
 
-func (m *Manager) UninstallCluster(request grpc_installer_go.UninstallClusterRequest) (*Operation, derrors.Error) {
+// UninstallCluster registers an uninstall and launches it in the background.
+//   params:
+//     request The uninstall request.
+//     initiator The subject of the caller, recorded in the install history.
+//   returns:
+//     The registered operation.
+//     An error if the uninstall cannot be launched.
+func (m *Manager) UninstallCluster(request grpc_installer_go.UninstallClusterRequest, initiator string) (*Operation, derrors.Error) {
 	var result *Operation
+	if err := m.requireLeader(); err != nil {
+		return nil, err
+	}
 	m.Lock()
 	if m.unsafeExist(request.RequestId) {
 		m.Unlock()
 		return nil, derrors.NewAlreadyExistsError("requestID").WithParams(request.RequestId)
 	}
-	m.unsafeUninstallRegister(request)
+	if err := m.unsafeCheckQuota(request.OrganizationId); err != nil {
+		m.Unlock()
+		return nil, err
+	}
+	m.unsafeUninstallRegister(request, initiator)
 	status, _ := m.Operations[request.RequestId]
 	result = status.Clone()
 	m.Unlock()
@@ -272,18 +632,28 @@ func (m *Manager) launchUninstall(requestID string) {
 		return
 	}
 
+	paths, err := m.organizationPaths(request.OrganizationId)
+	if err != nil {
+		log.Error().Str("err", err.DebugReport()).Msg("cannot prepare organization paths")
+		m.markOperationAsFailed(requestID, err)
+		return
+	}
 	params := workflow.NewUninstallParameters(&request, true)
+	params.Paths.TempPath = paths.TempPath
+	params.StrictIdentifiers = true
 
 	status.Params = params
-	err := status.Params.LoadCredentials()
+	err = status.Params.LoadCredentials()
 	if err != nil {
 		log.Error().Str("err", err.DebugReport()).Msg("cannot load credentials")
 		m.markOperationAsFailed(requestID, err)
+		return
 	}
 	err = status.Params.Validate()
 	if err != nil {
 		log.Error().Str("err", err.DebugReport()).Msg("invalid parameters")
 		m.markOperationAsFailed(requestID, err)
+		return
 	}
 
 	// Create Workflow
@@ -291,6 +661,7 @@ func (m *Manager) launchUninstall(requestID string) {
 	if err != nil {
 		log.Error().Str("err", err.DebugReport()).Msg("cannot parse workflow")
 		m.markOperationAsFailed(requestID, err)
+		return
 	}
 	status.Workflow = workflow
 
@@ -299,7 +670,13 @@ func (m *Manager) launchUninstall(requestID string) {
 	if err != nil {
 		log.Error().Str("err", err.DebugReport()).Msg("cannot parse workflow")
 		m.markOperationAsFailed(requestID, err)
+		return
 	}
-	exec.SetLogListener(m.logListener)
+	exec.SetLogListener(m.workflowLogListener(requestID))
+	m.Lock()
+	if *status.GetState() != grpc_common_go.OpStatus_FAILED {
+		m.unsafeNotify(status, notifications.Started, nil)
+	}
+	m.Unlock()
 	exec.Exec()
 }
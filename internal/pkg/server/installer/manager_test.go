@@ -0,0 +1,89 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/server/config"
+	"github.com/nalej/installer/internal/pkg/templates"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"strings"
+)
+
+const requiresComponentsTemplate = `// requires: Paths.ComponentsPath
+{"description": "requires", "commands": [{"type":"sync", "name": "logger", "msg": "{{$.Paths.ComponentsPath}}"}]}`
+
+const loggedWorkflow = `{"description": "logged", "commands": [
+  {"type":"sync", "name": "logger", "msg": "message of the workflow"},
+  {"type":"sync", "name": "sleep", "time": "0"}]}`
+
+var _ = ginkgo.Describe("Install launch", func() {
+
+	ginkgo.It("should fail the install without running a workflow that cannot be parsed", func() {
+		manager := NewManager(config.Config{MaxLogEntries: 10})
+		gomega.Expect(manager.Templates.Register(templates.WorkflowTemplate{Name: templates.InstallTemplate,
+			Version: "requires", Content: requiresComponentsTemplate})).To(gomega.Succeed())
+		request := grpc_installer_go.InstallRequest{
+			RequestId:      "5b36e4c4-8b4a-4c8e-9f43-4b4a8f0c9d01",
+			OrganizationId: "5b36e4c4-8b4a-4c8e-9f43-4b4a8f0c9d02",
+			ClusterId:      "5b36e4c4-8b4a-4c8e-9f43-4b4a8f0c9d03",
+			KubeConfigRaw:  "apiVersion: v1",
+			Hostname:       "cluster.nalej.com",
+		}
+		manager.Lock()
+		manager.unsafeInstallRegister(request, TemplateSelection{Name: templates.InstallTemplate, Version: "requires"}, "")
+		manager.Unlock()
+
+		gomega.Expect(func() { manager.launchInstall(request.RequestId) }).NotTo(gomega.Panic())
+		operation, err := manager.GetProgress(request.RequestId)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(*operation.GetState()).To(gomega.Equal(grpc_common_go.OpStatus_FAILED))
+		gomega.Expect(operation.Workflow).To(gomega.BeNil())
+	})
+
+	ginkgo.It("should capture the entries reported by the executor in the logs of the operation", func() {
+		manager := NewManager(config.Config{MaxLogEntries: 10})
+		manager.ExecHandler = workflow.NewExecutorHandler()
+		manager.Lock()
+		manager.unsafeInstallRegister(grpc_installer_go.InstallRequest{RequestId: "r1", OrganizationId: "org", ClusterId: "c1"}, DefaultInstallTemplate, "")
+		manager.Unlock()
+		flow, err := workflow.NewParser().ParseWorkflow("r1", loggedWorkflow, "logged", workflow.EmptyParameters)
+		gomega.Expect(err).To(gomega.Succeed())
+		exec, err := manager.ExecHandler.Add(flow, manager.WorkflowCallback)
+		gomega.Expect(err).To(gomega.Succeed())
+		exec.SetLogListener(manager.workflowLogListener("r1"))
+		exec.Exec()
+
+		gomega.Eventually(func() grpc_common_go.OpStatus {
+			operation, _ := manager.GetProgress("r1")
+			return *operation.GetState()
+		}).Should(gomega.Equal(grpc_common_go.OpStatus_SUCCESS))
+		page, err := manager.GetLogs("r1", 0, 0)
+		gomega.Expect(err).To(gomega.Succeed())
+		messages := make([]string, 0, len(page.Entries))
+		for _, entry := range page.Entries {
+			messages = append(messages, entry.Message)
+		}
+		gomega.Expect(messages).To(gomega.ContainElement("message of the workflow"))
+		gomega.Expect(strings.Join(messages, "\n")).To(gomega.ContainSubstring("Executing: "))
+		gomega.Expect(messages).To(gomega.ContainElement("All commands have been executed"))
+	})
+})
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/server/config"
+	"github.com/nalej/installer/internal/pkg/server/notifications"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Install notifications", func() {
+
+	var server *httptest.Server
+	var lock sync.Mutex
+	var received []notifications.Notification
+	var manager Manager
+
+	ginkgo.BeforeEach(func() {
+		received = make([]notifications.Notification, 0)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			notification := notifications.Notification{}
+			gomega.Expect(json.NewDecoder(r.Body).Decode(&notification)).To(gomega.Succeed())
+			lock.Lock()
+			received = append(received, notification)
+			lock.Unlock()
+		}))
+		conf := config.Config{MaxLogEntries: 10, Notifications: notifications.Config{Webhooks: []string{server.URL}}}
+		manager = NewManager(conf)
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Close()
+	})
+
+	register := func(requestID string) {
+		request := grpc_installer_go.InstallRequest{RequestId: requestID, OrganizationId: "org", ClusterId: "c-" + requestID}
+		manager.unsafeInstallRegister(request, TemplateSelection{Name: "default", Version: "1.0"}, "alice")
+	}
+
+	ginkgo.It("should notify the failures once", func() {
+		register("r1")
+		manager.markOperationAsFailed("r1", derrors.NewInvalidArgumentError("cannot parse workflow"))
+		manager.markOperationAsFailed("r1", derrors.NewInternalError("cannot add workflow"))
+		manager.Notifications.Wait()
+		gomega.Expect(received).To(gomega.HaveLen(1))
+		gomega.Expect(received[0].Event).To(gomega.Equal(notifications.Failed))
+		gomega.Expect(received[0].ClusterID).To(gomega.Equal("c-r1"))
+		gomega.Expect(received[0].TemplateName).To(gomega.Equal("default"))
+		gomega.Expect(received[0].Initiator).To(gomega.Equal("alice"))
+		gomega.Expect(received[0].Error).To(gomega.ContainSubstring("cannot parse workflow"))
+	})
+
+	ginkgo.It("should notify the end of the workflows", func() {
+		register("r1")
+		register("r2")
+		manager.WorkflowCallback("r1", nil, workflow.InProgressState)
+		manager.WorkflowCallback("r1", nil, workflow.FinishedState)
+		manager.WorkflowCallback("r2", derrors.NewInternalError("command failed"), workflow.ErrorState)
+		manager.Notifications.Wait()
+		gomega.Expect(received).To(gomega.HaveLen(2))
+		events := map[string]notifications.Notification{}
+		for _, notification := range received {
+			events[notification.RequestID] = notification
+		}
+		gomega.Expect(events["r1"].Event).To(gomega.Equal(notifications.Succeeded))
+		gomega.Expect(events["r1"].Status).To(gomega.Equal("SUCCESS"))
+		gomega.Expect(events["r2"].Event).To(gomega.Equal(notifications.Failed))
+		gomega.Expect(events["r2"].Error).To(gomega.ContainSubstring("command failed"))
+	})
+})
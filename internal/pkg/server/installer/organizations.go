@@ -0,0 +1,181 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/installer/internal/pkg/templates"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/rs/zerolog/log"
+)
+
+// OrganizationsDir is the directory of the configuration and temporal paths with a subdirectory per organization,
+// named after its identifier, that contains the workflow templates it overrides and its temporal files.
+const OrganizationsDir = "organizations"
+
+// loadOrganizationTemplates registers the workflow templates overridden by each organization.
+//   returns:
+//     An error if the templates of an organization cannot be loaded.
+func (m *Manager) loadOrganizationTemplates() derrors.Error {
+	root := filepath.Join(m.Config.ConfPath, OrganizationsDir)
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return derrors.AsError(err, "cannot read organization templates")
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		registry := templates.NewEmptyRegistry()
+		if err := registry.LoadFromPath(filepath.Join(root, entry.Name())); err != nil {
+			return derrors.NewInvalidArgumentError("cannot load organization templates", err).WithParams(entry.Name())
+		}
+		m.OrganizationTemplates[entry.Name()] = registry
+		log.Debug().Str("organizationID", entry.Name()).Int("templates", len(registry.List())).Msg("organization templates loaded")
+	}
+	return nil
+}
+
+// getTemplate retrieves a workflow template for an organization. If the organization overrides the template, only
+// its versions are used.
+//   params:
+//     organizationID The organization identifier.
+//     name The name of the template.
+//     version The version of the template, empty for the latest one.
+//   returns:
+//     The template.
+//     An error if the template does not exist.
+func (m *Manager) getTemplate(organizationID string, name string, version string) (*templates.WorkflowTemplate, derrors.Error) {
+	if registry, found := m.OrganizationTemplates[organizationID]; found {
+		if _, err := registry.Get(name, ""); err == nil {
+			return registry.Get(name, version)
+		}
+	}
+	return m.Templates.Get(name, version)
+}
+
+// ListTemplates returns the workflow templates available to an organization, where the templates overridden by the
+// organization replace the common ones with the same name.
+//   params:
+//     organizationID The organization identifier, empty to list the common templates.
+//   returns:
+//     The templates sorted by name.
+func (m *Manager) ListTemplates(organizationID string) []templates.WorkflowTemplate {
+	registry, found := m.OrganizationTemplates[organizationID]
+	if !found {
+		return m.Templates.List()
+	}
+	overridden := registry.List()
+	names := make(map[string]bool, len(overridden))
+	for _, template := range overridden {
+		names[template.Name] = true
+	}
+	result := make([]templates.WorkflowTemplate, 0)
+	for _, template := range m.Templates.List() {
+		if !names[template.Name] {
+			result = append(result, template)
+		}
+	}
+	result = append(result, overridden...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// organizationPaths returns the paths of the operations of an organization, which keep their temporal files in a
+// directory of the organization.
+//   params:
+//     organizationID The organization identifier.
+//   returns:
+//     The paths.
+//     An error if the temporal directory cannot be created.
+func (m *Manager) organizationPaths(organizationID string) (workflow.Paths, derrors.Error) {
+	paths := m.Paths
+	if organizationID == "" || paths.TempPath == "" {
+		return paths, nil
+	}
+	name := filepath.Base(filepath.Clean(organizationID))
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return paths, derrors.NewInvalidArgumentError("invalid organization identifier").WithParams(organizationID)
+	}
+	paths.TempPath = filepath.Join(m.Paths.TempPath, OrganizationsDir, name)
+	if err := os.MkdirAll(paths.TempPath, 0700); err != nil {
+		return paths, derrors.NewInternalError("cannot create organization temporal directory", err).WithParams(paths.TempPath)
+	}
+	return paths, nil
+}
+
+// unsafeActiveOperations counts the installs and uninstalls of an organization that have been launched and have not
+// finished.
+func (m *Manager) unsafeActiveOperations(organizationID string) int {
+	active := 0
+	for _, operation := range m.Operations {
+		if operation.OrganizationID != organizationID || operation.queued {
+			continue
+		}
+		if operation.OperationName != InstallOperation && operation.OperationName != UninstallOperation {
+			continue
+		}
+		state := *operation.GetState()
+		if state != grpc_common_go.OpStatus_SUCCESS && state != grpc_common_go.OpStatus_FAILED {
+			active++
+		}
+	}
+	return active
+}
+
+// unsafeCheckQuota rejects a new operation of an organization that has reached its limit of running operations.
+func (m *Manager) unsafeCheckQuota(organizationID string) derrors.Error {
+	limit := m.Config.MaxInstallsPerOrganization
+	if limit > 0 && m.unsafeActiveOperations(organizationID) >= limit {
+		return derrors.NewUnavailableError("organization reached its limit of running installs, retry later").
+			WithParams(organizationID, limit)
+	}
+	return nil
+}
+
+// waitQuota blocks until a queued install of a batch can be launched within the limit of its organization.
+//   params:
+//     organizationID The organization identifier.
+//     requestID The request identifier of the install.
+func (m *Manager) waitQuota(organizationID string, requestID string) {
+	for {
+		m.Lock()
+		operation, exists := m.Operations[requestID]
+		if !exists || m.unsafeCheckQuota(organizationID) == nil {
+			if exists {
+				operation.queued = false
+			}
+			m.Unlock()
+			return
+		}
+		m.Unlock()
+		time.Sleep(batchPollInterval)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/server/config"
+	"github.com/nalej/installer/internal/pkg/templates"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const organizationTemplate = `{"description": "org", "commands": [{"type":"sync", "name": "logger", "msg": "org"}]}`
+
+// writeOrganizationTemplate overrides the install template for an organization.
+func writeOrganizationTemplate(confPath string, organizationID string) {
+	workflowsPath := filepath.Join(confPath, OrganizationsDir, organizationID, templates.WorkflowsDir)
+	gomega.Expect(os.MkdirAll(workflowsPath, os.ModePerm)).To(gomega.Succeed())
+	gomega.Expect(ioutil.WriteFile(filepath.Join(workflowsPath, "install-org.json"), []byte(organizationTemplate), 0644)).To(gomega.Succeed())
+	sum := sha256.Sum256([]byte(organizationTemplate))
+	index := fmt.Sprintf(`{"templates":[{"name":"install","version":"org","file":"install-org.json","sha256":"%s"}]}`, hex.EncodeToString(sum[:]))
+	gomega.Expect(ioutil.WriteFile(filepath.Join(workflowsPath, templates.IndexFile), []byte(index), 0644)).To(gomega.Succeed())
+}
+
+var _ = ginkgo.Describe("Organizations", func() {
+
+	var basePath string
+
+	ginkgo.BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "organizations")
+		gomega.Expect(err).To(gomega.Succeed())
+		basePath = dir
+		batchPollInterval = 5 * time.Millisecond
+	})
+
+	ginkgo.AfterEach(func() {
+		os.RemoveAll(basePath)
+	})
+
+	ginkgo.It("should use the templates overridden by the organization", func() {
+		writeOrganizationTemplate(basePath, "org1")
+		manager := NewManager(config.Config{ConfPath: basePath})
+		gomega.Expect(manager.LoadTemplates()).To(gomega.Succeed())
+
+		template, err := manager.getTemplate("org1", templates.InstallTemplate, "")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(template.Version).To(gomega.Equal("org"))
+		_, err = manager.getTemplate("org1", templates.InstallTemplate, templates.BuiltinVersion)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		template, err = manager.getTemplate("org1", templates.UninstallTemplate, "")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(template.Version).To(gomega.Equal(templates.BuiltinVersion))
+		template, err = manager.getTemplate("org2", templates.InstallTemplate, "")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(template.Version).To(gomega.Equal(templates.BuiltinVersion))
+
+		listed := manager.ListTemplates("org1")
+		gomega.Expect(len(listed)).To(gomega.Equal(len(manager.Templates.List())))
+		for _, template := range listed {
+			if template.Name == templates.InstallTemplate {
+				gomega.Expect(template.Version).To(gomega.Equal("org"))
+			}
+		}
+	})
+
+	ginkgo.It("should keep the temporal files of each organization apart", func() {
+		manager := NewManager(config.Config{TempPath: basePath})
+		paths, err := manager.organizationPaths("org1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(paths.TempPath).To(gomega.Equal(filepath.Join(basePath, OrganizationsDir, "org1")))
+		gomega.Expect(paths.TempPath).To(gomega.BeADirectory())
+		gomega.Expect(manager.Paths.TempPath).To(gomega.Equal(basePath))
+
+		_, err = manager.organizationPaths("..")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should limit the running installs of an organization", func() {
+		manager := NewManager(config.Config{MaxInstallsPerOrganization: 1})
+		manager.Lock()
+		manager.unsafeInstallRegister(grpc_installer_go.InstallRequest{RequestId: "r1", OrganizationId: "org1"}, DefaultInstallTemplate, "")
+		gomega.Expect(manager.unsafeCheckQuota("org1")).NotTo(gomega.Succeed())
+		gomega.Expect(manager.unsafeCheckQuota("org2")).To(gomega.Succeed())
+		manager.Unlock()
+
+		manager.Lock()
+		manager.unsafeInstallRegister(grpc_installer_go.InstallRequest{RequestId: "r2", OrganizationId: "org1"}, DefaultInstallTemplate, "")
+		manager.Operations["r2"].queued = true
+		manager.Unlock()
+		launched := make(chan struct{})
+		go func() {
+			manager.waitQuota("org1", "r2")
+			close(launched)
+		}()
+		gomega.Consistently(launched, 30*time.Millisecond).ShouldNot(gomega.BeClosed())
+
+		manager.Lock()
+		manager.Operations["r1"].UpdateStatus(grpc_common_go.OpStatus_SUCCESS)
+		manager.Unlock()
+		gomega.Eventually(launched).Should(gomega.BeClosed())
+		manager.Lock()
+		defer manager.Unlock()
+		gomega.Expect(manager.Operations["r2"].queued).To(gomega.BeFalse())
+		gomega.Expect(manager.unsafeCheckQuota("org1")).NotTo(gomega.Succeed())
+	})
+})
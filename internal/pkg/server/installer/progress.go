@@ -0,0 +1,119 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow"
+)
+
+// DefaultCommandPageSize is the number of commands returned when the request does not specify a limit.
+const DefaultCommandPageSize = 100
+
+// MaxCommandPageSize is the maximum number of commands returned in a single page.
+const MaxCommandPageSize = 1000
+
+// CommandFilter structure with the conditions of the commands of a workflow to be retrieved.
+type CommandFilter struct {
+	// FailedOnly to retrieve only the commands that failed.
+	FailedOnly bool
+}
+
+// matches checks if the result of a command satisfies the filter.
+func (cf CommandFilter) matches(status workflow.CommandStatus) bool {
+	return !cf.FailedOnly || !status.Success
+}
+
+// CommandPage structure with a page of the commands executed by the workflow of an operation.
+type CommandPage struct {
+	// Commands of the page, in order of execution.
+	Commands []workflow.CommandStatus
+	// Offset with the index of the first command of the page among the ones satisfying the filter.
+	Offset int
+	// Total number of executed commands satisfying the filter.
+	Total int
+	// Executed with the number of commands that have finished their execution.
+	Executed int
+	// WorkflowCommands with the number of commands of the workflow.
+	WorkflowCommands int
+}
+
+// GetCommandProgress retrieves a page of the commands executed by the workflow of an operation.
+//   params:
+//     requestID The request identifier.
+//     filter The conditions of the commands.
+//     offset The index of the first command to be returned.
+//     limit The maximum number of commands to be returned.
+//   returns:
+//     The requested page, empty if the workflow has not been launched.
+//     An error if the operation is not found or this replica is not the leader.
+func (m *Manager) GetCommandProgress(requestID string, filter CommandFilter, offset int, limit int) (*CommandPage, derrors.Error) {
+	if offset < 0 {
+		return nil, derrors.NewInvalidArgumentError("offset cannot be negative").WithParams(offset)
+	}
+	if limit <= 0 {
+		limit = DefaultCommandPageSize
+	}
+	if limit > MaxCommandPageSize {
+		limit = MaxCommandPageSize
+	}
+	// The commands are only known by the replica executing the workflow.
+	if err := m.requireLeader(); err != nil {
+		return nil, err
+	}
+	m.Lock()
+	operation, exists := m.Operations[requestID]
+	var flow *workflow.Workflow
+	if exists {
+		flow = operation.Workflow
+	}
+	m.Unlock()
+	if !exists {
+		return nil, derrors.NewNotFoundError("requestID").WithParams(requestID)
+	}
+
+	page := &CommandPage{Commands: make([]workflow.CommandStatus, 0), Offset: offset}
+	if flow == nil {
+		return page, nil
+	}
+	page.WorkflowCommands = len(flow.Commands)
+	exec, err := m.ExecHandler.Get(requestID)
+	if err != nil {
+		// The workflow has not been launched or has been removed.
+		return page, nil
+	}
+	results := exec.Results()
+	page.Executed = len(results)
+	matching := make([]workflow.CommandStatus, 0, len(results))
+	for _, status := range results {
+		if filter.matches(status) {
+			matching = append(matching, status)
+		}
+	}
+	page.Total = len(matching)
+	if offset > len(matching) {
+		offset = len(matching)
+	}
+	end := offset + limit
+	if end > len(matching) {
+		end = len(matching)
+	}
+	page.Commands = append(page.Commands, matching[offset:end]...)
+	page.Offset = offset
+	return page, nil
+}
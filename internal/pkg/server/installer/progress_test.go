@@ -0,0 +1,75 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"fmt"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/server/config"
+	"github.com/nalej/installer/internal/pkg/workflow"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Command progress", func() {
+
+	var manager Manager
+
+	ginkgo.BeforeEach(func() {
+		manager = NewManager(config.Config{MaxLogEntries: 10})
+		manager.ExecHandler = workflow.NewExecutorHandler()
+		request := grpc_installer_go.InstallRequest{RequestId: "r1", OrganizationId: "org", ClusterId: "c1"}
+		manager.unsafeInstallRegister(request, TemplateSelection{}, "")
+	})
+
+	ginkgo.It("should return an empty page before the workflow is launched", func() {
+		page, err := manager.GetCommandProgress("r1", CommandFilter{}, 0, 0)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(page.Commands).To(gomega.BeEmpty())
+		_, err = manager.GetCommandProgress("unknown", CommandFilter{}, 0, 0)
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("should page and filter the executed commands", func() {
+		flow := workflow.NewWorkflow("r1", "install", "", make([]entities.Command, 10))
+		manager.Operations["r1"].Workflow = flow
+		exec, err := manager.ExecHandler.Add(flow, func(string, derrors.Error, workflow.WorkflowState) {})
+		gomega.Expect(err).To(gomega.BeNil())
+		for i := 0; i < 6; i++ {
+			exec.CommandResults = append(exec.CommandResults,
+				workflow.CommandStatus{Index: i, Name: fmt.Sprintf("cmd%d", i), Success: i%3 != 2})
+		}
+
+		page, err := manager.GetCommandProgress("r1", CommandFilter{}, 4, 10)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(page.WorkflowCommands).To(gomega.Equal(10))
+		gomega.Expect(page.Executed).To(gomega.Equal(6))
+		gomega.Expect(page.Total).To(gomega.Equal(6))
+		gomega.Expect(page.Commands).To(gomega.HaveLen(2))
+		gomega.Expect(page.Commands[0].Name).To(gomega.Equal("cmd4"))
+
+		page, err = manager.GetCommandProgress("r1", CommandFilter{FailedOnly: true}, 0, 1)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(page.Total).To(gomega.Equal(2))
+		gomega.Expect(page.Commands).To(gomega.HaveLen(1))
+		gomega.Expect(page.Commands[0].Name).To(gomega.Equal("cmd2"))
+	})
+})
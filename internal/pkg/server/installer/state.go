@@ -0,0 +1,166 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package installer
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-common-go"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// StateConfigMapName is the name of the config map where the leader publishes the state of the operations.
+const StateConfigMapName = "installer-state"
+
+// stateKey is the key of the config map containing the shared state.
+const stateKey = "state.json"
+
+// OperationState structure with the summary of an operation shared among the replicas.
+type OperationState struct {
+	RequestID      string `json:"request_id"`
+	OrganizationID string `json:"organization_id"`
+	ClusterID      string `json:"cluster_id,omitempty"`
+	OperationName  string `json:"operation_name"`
+	Status         string `json:"status"`
+	Error          string `json:"error,omitempty"`
+	Initiator      string `json:"initiator,omitempty"`
+	Created        int64  `json:"created"`
+}
+
+// SharedState structure with the operations and batches published by the leader.
+type SharedState struct {
+	// Leader with the identity of the replica that published the state.
+	Leader     string           `json:"leader"`
+	Updated    time.Time        `json:"updated"`
+	Operations []OperationState `json:"operations"`
+	Batches    []Batch          `json:"batches"`
+}
+
+// operation returns the state of an operation.
+func (ss *SharedState) operation(requestID string) (*OperationState, bool) {
+	for index := range ss.Operations {
+		if ss.Operations[index].RequestID == requestID {
+			return &ss.Operations[index], true
+		}
+	}
+	return nil, false
+}
+
+// batch returns a batch of installs.
+func (ss *SharedState) batch(batchID string) (*Batch, bool) {
+	for index := range ss.Batches {
+		if ss.Batches[index].BatchID == batchID {
+			return &ss.Batches[index], true
+		}
+	}
+	return nil, false
+}
+
+// toOperation restores an operation from its shared state.
+func (st *OperationState) toOperation() *Operation {
+	operation := NewOperation(st.OrganizationID, st.RequestID, st.OperationName)
+	operation.OperationName = st.OperationName
+	operation.Created = st.Created
+	operation.Initiator = st.Initiator
+	operation.status = grpc_common_go.OpStatus(grpc_common_go.OpStatus_value[st.Status])
+	if st.Error != "" {
+		operation.error = derrors.NewGenericError(st.Error)
+	}
+	return operation
+}
+
+// StateStore structure that keeps the shared state in a config map of the cluster where the installer runs.
+type StateStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewStateStore creates a StateStore.
+//   params:
+//     client The client of the cluster where the installer runs.
+//     namespace The namespace of the config map.
+//     name The name of the config map.
+//   returns:
+//     A StateStore.
+func NewStateStore(client kubernetes.Interface, namespace string, name string) *StateStore {
+	return &StateStore{client: client, namespace: namespace, name: name}
+}
+
+// Load retrieves the shared state.
+//   returns:
+//     The shared state, empty if it has not been published yet.
+//     An error if the state cannot be read.
+func (ss *StateStore) Load() (*SharedState, derrors.Error) {
+	result := &SharedState{Operations: make([]OperationState, 0), Batches: make([]Batch, 0)}
+	cm, err := ss.client.CoreV1().ConfigMaps(ss.namespace).Get(ss.name, metaV1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return result, nil
+		}
+		return nil, derrors.NewUnavailableError("cannot retrieve shared state", err)
+	}
+	content, found := cm.Data[stateKey]
+	if !found {
+		return result, nil
+	}
+	if err := json.Unmarshal([]byte(content), result); err != nil {
+		return nil, derrors.NewInternalError("cannot parse shared state", err)
+	}
+	return result, nil
+}
+
+// Save publishes the shared state.
+//   params:
+//     state The state to be published.
+//   returns:
+//     An error if the state cannot be written.
+func (ss *StateStore) Save(state *SharedState) derrors.Error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return derrors.NewInternalError("cannot marshal shared state", err)
+	}
+	client := ss.client.CoreV1().ConfigMaps(ss.namespace)
+	cm, err := client.Get(ss.name, metaV1.GetOptions{})
+	if err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			return derrors.NewUnavailableError("cannot retrieve shared state", err)
+		}
+		cm = &v1.ConfigMap{
+			ObjectMeta: metaV1.ObjectMeta{Name: ss.name, Namespace: ss.namespace},
+			Data:       map[string]string{stateKey: string(content)},
+		}
+		if _, err := client.Create(cm); err != nil {
+			return derrors.NewUnavailableError("cannot create shared state", err)
+		}
+		return nil
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string, 0)
+	}
+	cm.Data[stateKey] = string(content)
+	if _, err := client.Update(cm); err != nil {
+		return derrors.NewUnavailableError("cannot update shared state", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package interceptors
+
+import (
+	"github.com/nalej/grpc-infrastructure-go"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/server/extensions"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+)
+
+const testKubeConfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://127.0.0.1:6443
+  name: test
+contexts:
+- context:
+    cluster: test
+    user: test
+  name: test
+current-context: test
+users:
+- name: test
+  user:
+    token: test
+`
+
+func getValidInstallRequest() *grpc_installer_go.InstallRequest {
+	return &grpc_installer_go.InstallRequest{
+		RequestId:      uuid.NewV4().String(),
+		OrganizationId: uuid.NewV4().String(),
+		ClusterId:      uuid.NewV4().String(),
+		ClusterType:    grpc_infrastructure_go.ClusterType_KUBERNETES,
+		KubeConfigRaw:  testKubeConfig,
+		Hostname:       "cluster.nalej.com",
+	}
+}
+
+var _ = ginkgo.Describe("Interceptors", func() {
+
+	ginkgo.Context("request validation", func() {
+		ginkgo.It("should accept a valid install request", func() {
+			gomega.Expect(ValidateRequest(getValidInstallRequest())).To(gomega.Succeed())
+		})
+		ginkgo.It("should reject identifiers without UUID format", func() {
+			request := getValidInstallRequest()
+			request.OrganizationId = "org"
+			gomega.Expect(ValidateRequest(request)).ShouldNot(gomega.Succeed())
+		})
+		ginkgo.It("should reject invalid kubeconfig contents", func() {
+			request := getValidInstallRequest()
+			request.KubeConfigRaw = "not: [a kubeconfig"
+			gomega.Expect(ValidateRequest(request)).ShouldNot(gomega.Succeed())
+		})
+		ginkgo.It("should accept static IP addresses of either family", func() {
+			request := getValidInstallRequest()
+			request.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{
+				UseStaticIp: true,
+				Ingress:     "10.0.0.10",
+				Dns:         "fd00::53",
+			}
+			gomega.Expect(ValidateRequest(request)).To(gomega.Succeed())
+			request.StaticIpAddresses.VpnServer = "10.0.0"
+			gomega.Expect(ValidateRequest(request)).ShouldNot(gomega.Succeed())
+		})
+		ginkgo.It("should accept IPv6 node addresses", func() {
+			request := getValidInstallRequest()
+			request.KubeConfigRaw = ""
+			request.Username = "nalej"
+			request.PrivateKey = "key"
+			request.Nodes = []string{"fd00::1", "node-2.nalej.com", "10.0.0.3"}
+			gomega.Expect(ValidateRequest(request)).To(gomega.Succeed())
+			request.Nodes = append(request.Nodes, "[fd00::4]")
+			gomega.Expect(ValidateRequest(request)).ShouldNot(gomega.Succeed())
+		})
+		ginkgo.It("should validate each request of a batch", func() {
+			invalid := getValidInstallRequest()
+			invalid.RequestId = "request"
+			batch := &extensions.InstallClusterBatchRequest{
+				Requests: []grpc_installer_go.InstallRequest{*getValidInstallRequest(), *invalid},
+			}
+			gomega.Expect(ValidateRequest(batch)).ShouldNot(gomega.Succeed())
+			batch.Requests = batch.Requests[:1]
+			gomega.Expect(ValidateRequest(batch)).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("rate limiting", func() {
+		ginkgo.It("should limit each organization independently", func() {
+			limiter := NewOrganizationLimiter(1, 2)
+			gomega.Expect(limiter.Allow("org1")).To(gomega.BeTrue())
+			gomega.Expect(limiter.Allow("org1")).To(gomega.BeTrue())
+			gomega.Expect(limiter.Allow("org1")).To(gomega.BeFalse())
+			gomega.Expect(limiter.Allow("org2")).To(gomega.BeTrue())
+		})
+	})
+})
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package interceptors
+
+import (
+	"context"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/nalej/installer/internal/pkg/server/extensions"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"sync"
+	"time"
+)
+
+// OrganizationLimiter limits the number of operations each organization can request.
+type OrganizationLimiter struct {
+	sync.Mutex
+	limit    rate.Limit
+	burst    int
+	limiters map[string]*rate.Limiter
+}
+
+// NewOrganizationLimiter creates a limiter allowing operationsPerMinute requests per organization with
+// the given burst.
+func NewOrganizationLimiter(operationsPerMinute int, burst int) *OrganizationLimiter {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &OrganizationLimiter{
+		limit:    rate.Every(time.Minute / time.Duration(operationsPerMinute)),
+		burst:    burst,
+		limiters: make(map[string]*rate.Limiter, 0),
+	}
+}
+
+// Allow checks if a new operation can be launched by the organization.
+func (ol *OrganizationLimiter) Allow(organizationID string) bool {
+	ol.Lock()
+	limiter, exists := ol.limiters[organizationID]
+	if !exists {
+		limiter = rate.NewLimiter(ol.limit, ol.burst)
+		ol.limiters[organizationID] = limiter
+	}
+	ol.Unlock()
+	return limiter.Allow()
+}
+
+// organizationID extracts the organization of the requests subject to rate limiting.
+func organizationID(req interface{}) (string, bool) {
+	switch request := req.(type) {
+	case *grpc_installer_go.InstallRequest:
+		return request.OrganizationId, true
+	case *grpc_installer_go.UninstallClusterRequest:
+		return request.OrganizationId, true
+	case *extensions.InstallClusterBatchRequest:
+		return request.OrganizationID, true
+	}
+	return "", false
+}
+
+// RateLimit returns an interceptor rejecting install and uninstall requests exceeding the organization limit.
+func RateLimit(limiter *OrganizationLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		orgID, limited := organizationID(req)
+		if limited && !limiter.Allow(orgID) {
+			log.Warn().Str("organizationID", orgID).Str("method", info.FullMethod).Msg("rate limit exceeded")
+			return nil, conversions.ToGRPCError(
+				derrors.NewUnavailableError("rate limit exceeded, retry later").WithParams(orgID))
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package interceptors
+
+import (
+	"context"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-common-go"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/nalej/installer/internal/pkg/entities"
+	"github.com/nalej/installer/internal/pkg/server/extensions"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+)
+
+// ValidateRequest checks an incoming request before it reaches the handler.
+func ValidateRequest(req interface{}) derrors.Error {
+	switch request := req.(type) {
+	case *grpc_installer_go.InstallRequest:
+		if err := entities.ValidInstallRequest(request); err != nil {
+			return err
+		}
+		return entities.ValidInstallRequestFormat(request)
+	case *grpc_installer_go.UninstallClusterRequest:
+		if err := entities.ValidUninstallClusterRequest(request); err != nil {
+			return err
+		}
+		return entities.ValidUninstallClusterRequestFormat(request)
+	case *grpc_common_go.RequestId:
+		return entities.ValidRequestID(request)
+	case *extensions.InstallClusterBatchRequest:
+		for index := range request.Requests {
+			if err := ValidateRequest(&request.Requests[index]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Validation returns an interceptor rejecting malformed requests.
+func Validation() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := ValidateRequest(req); err != nil {
+			log.Warn().Str("method", info.FullMethod).Str("trace", err.DebugReport()).Msg("invalid request")
+			return nil, conversions.ToGRPCError(err)
+		}
+		return handler(ctx, req)
+	}
+}
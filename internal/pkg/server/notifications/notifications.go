@@ -0,0 +1,274 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package notifications sends the events of the installs and uninstalls run by the installer service to webhooks,
+// Slack channels and email recipients, so operators do not need to poll the progress of the operations.
+
+package notifications
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultTimeout is the default time to deliver a notification to a destination.
+const DefaultTimeout = 10 * time.Second
+
+// DefaultAttempts is the number of times the delivery of a notification is attempted.
+const DefaultAttempts = 3
+
+// retryDelay is the time between the delivery attempts of a notification.
+var retryDelay = 2 * time.Second
+
+// Event of an operation that fires the notifications.
+type Event string
+
+const (
+	// Started is fired when the workflow of the operation is launched.
+	Started Event = "started"
+	// Succeeded is fired when all the commands of the workflow have been executed.
+	Succeeded Event = "succeeded"
+	// Failed is fired when the operation cannot be launched or a command of the workflow fails.
+	Failed Event = "failed"
+)
+
+// Events contains the supported events.
+var Events = []Event{Started, Succeeded, Failed}
+
+// Notification with the summary of an operation sent on an event.
+type Notification struct {
+	// Event that fired the notification.
+	Event Event `json:"event"`
+	// Operation with the name of the operation, such as Install cluster.
+	Operation       string `json:"operation"`
+	RequestID       string `json:"request_id"`
+	OrganizationID  string `json:"organization_id"`
+	ClusterID       string `json:"cluster_id,omitempty"`
+	TemplateName    string `json:"template_name,omitempty"`
+	TemplateVersion string `json:"template_version,omitempty"`
+	// Initiator with the subject of the caller that requested the operation.
+	Initiator string `json:"initiator,omitempty"`
+	// Status of the operation when the event was fired.
+	Status string `json:"status"`
+	// Error with the reason of the failure of the operation, if any.
+	Error string `json:"error,omitempty"`
+	// Started with the time the operation was requested.
+	Started time.Time `json:"started"`
+	// Timestamp with the time the event was fired.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Elapsed returns the time since the operation was requested, rounded to seconds.
+func (n Notification) Elapsed() time.Duration {
+	return n.Timestamp.Sub(n.Started).Round(time.Second)
+}
+
+// Title returns a short description of the notification, used as the subject of the emails.
+func (n Notification) Title() string {
+	target := n.ClusterID
+	if target == "" {
+		target = n.RequestID
+	}
+	return fmt.Sprintf("%s %s %s", n.Operation, target, n.Event)
+}
+
+// Summary returns a one line description of the notification for chat messages.
+func (n Notification) Summary() string {
+	summary := fmt.Sprintf("%s (request %s, organization %s)", n.Title(), n.RequestID, n.OrganizationID)
+	if n.Event != Started {
+		summary = fmt.Sprintf("%s after %s", summary, n.Elapsed())
+	}
+	if n.Error != "" {
+		summary = fmt.Sprintf("%s: %s", summary, n.Error)
+	}
+	return summary
+}
+
+// Notifier delivers the notifications to a destination.
+type Notifier interface {
+	// Notify delivers a notification.
+	Notify(notification Notification) derrors.Error
+	// String returns a description of the destination without credentials.
+	String() string
+}
+
+// Config with the destinations of the notifications.
+type Config struct {
+	// Webhooks with the URLs receiving the notifications as JSON.
+	Webhooks []string
+	// SlackWebhooks with the incoming webhooks of the Slack channels receiving the summary of the notifications.
+	SlackWebhooks []string
+	// SMTPServer with the host:port of the server sending the emails, emails are not sent if empty.
+	SMTPServer string
+	// SMTPUsername and SMTPPassword with the credentials of the SMTP server, if required.
+	SMTPUsername string
+	SMTPPassword string
+	// EmailFrom with the sender of the emails.
+	EmailFrom string
+	// EmailTo with the recipients of the emails.
+	EmailTo []string
+	// Events with the events that fire the notifications, all of them if empty.
+	Events []string
+	// Timeout with the time to deliver a notification to a destination, DefaultTimeout if not set.
+	Timeout time.Duration
+}
+
+// ValidateEvents checks the names of the events that fire the notifications.
+func ValidateEvents(events []string) derrors.Error {
+	for _, event := range events {
+		found := false
+		for _, supported := range Events {
+			if Event(event) == supported {
+				found = true
+			}
+		}
+		if !found {
+			return derrors.NewInvalidArgumentError("unsupported notification event").WithParams(event, Events)
+		}
+	}
+	return nil
+}
+
+// validateURL checks the URL of a webhook. The URL is not included in the errors as the webhooks of chat services
+// contain their token.
+func validateURL(raw string) derrors.Error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return derrors.NewInvalidArgumentError("invalid webhook URL")
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return derrors.NewInvalidArgumentError("webhook URL must be an http or https URL").WithParams(parsed.Host)
+	}
+	return nil
+}
+
+// Validate checks the destinations of the notifications.
+func (c Config) Validate() derrors.Error {
+	for _, webhook := range append(append([]string{}, c.Webhooks...), c.SlackWebhooks...) {
+		if err := validateURL(webhook); err != nil {
+			return err
+		}
+	}
+	if c.SMTPServer != "" {
+		if _, _, err := net.SplitHostPort(c.SMTPServer); err != nil {
+			return derrors.NewInvalidArgumentError("SMTP server must be host:port", err).WithParams(c.SMTPServer)
+		}
+		if c.EmailFrom == "" || len(c.EmailTo) == 0 {
+			return derrors.NewInvalidArgumentError("the sender and the recipients of the emails must be set")
+		}
+	}
+	if c.Timeout < 0 {
+		return derrors.NewInvalidArgumentError("notification timeout cannot be negative")
+	}
+	return ValidateEvents(c.Events)
+}
+
+// timeout returns the time to deliver a notification to a destination.
+func (c Config) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
+// Dispatcher sends the notifications of the selected events to the notifiers without blocking the operations.
+type Dispatcher struct {
+	notifiers []Notifier
+	events    map[Event]bool
+	pending   sync.WaitGroup
+}
+
+// NewDispatcher creates the dispatcher of the destinations of a configuration.
+func NewDispatcher(config Config) *Dispatcher {
+	notifiers := make([]Notifier, 0)
+	for _, webhook := range config.Webhooks {
+		notifiers = append(notifiers, NewWebhookNotifier(webhook, config.timeout()))
+	}
+	for _, webhook := range config.SlackWebhooks {
+		notifiers = append(notifiers, NewSlackNotifier(webhook, config.timeout()))
+	}
+	if config.SMTPServer != "" {
+		notifiers = append(notifiers, NewEmailNotifier(config.SMTPServer, config.SMTPUsername, config.SMTPPassword,
+			config.EmailFrom, config.EmailTo))
+	}
+	return newDispatcher(notifiers, config.Events)
+}
+
+// newDispatcher creates a dispatcher sending the given events, all of them if empty, to a set of notifiers.
+func newDispatcher(notifiers []Notifier, events []string) *Dispatcher {
+	selected := make(map[Event]bool, len(Events))
+	for _, event := range Events {
+		selected[event] = len(events) == 0
+	}
+	for _, event := range events {
+		selected[Event(event)] = true
+	}
+	return &Dispatcher{notifiers: notifiers, events: selected}
+}
+
+// Enabled indicates if the dispatcher has any destination.
+func (d *Dispatcher) Enabled() bool {
+	return d != nil && len(d.notifiers) > 0
+}
+
+// Send delivers a notification to every notifier in the background if its event is selected. Failed deliveries are
+// retried and then logged, as notifications must not affect the operations.
+func (d *Dispatcher) Send(notification Notification) {
+	if !d.Enabled() || !d.events[notification.Event] {
+		return
+	}
+	for _, notifier := range d.notifiers {
+		d.pending.Add(1)
+		go func(notifier Notifier) {
+			defer d.pending.Done()
+			var err derrors.Error
+			for attempt := 1; attempt <= DefaultAttempts; attempt++ {
+				if err = notifier.Notify(notification); err == nil {
+					return
+				}
+				if attempt < DefaultAttempts {
+					time.Sleep(retryDelay)
+				}
+			}
+			log.Warn().Str("destination", notifier.String()).Str("requestID", notification.RequestID).
+				Str("event", string(notification.Event)).Str("trace", err.DebugReport()).Msg("cannot send notification")
+		}(notifier)
+	}
+}
+
+// Wait blocks until the notifications being sent are delivered or discarded.
+func (d *Dispatcher) Wait() {
+	if d != nil {
+		d.pending.Wait()
+	}
+}
+
+// String returns the destinations of the dispatcher.
+func (d *Dispatcher) String() string {
+	destinations := make([]string, 0, len(d.notifiers))
+	for _, notifier := range d.notifiers {
+		destinations = append(destinations, notifier.String())
+	}
+	return strings.Join(destinations, ",")
+}
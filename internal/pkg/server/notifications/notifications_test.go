@@ -0,0 +1,208 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"sync"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// stubNotifier records the notifications and fails the first attempts.
+type stubNotifier struct {
+	sync.Mutex
+	failures int
+	attempts int
+	received []Notification
+}
+
+func (sn *stubNotifier) Notify(notification Notification) derrors.Error {
+	sn.Lock()
+	defer sn.Unlock()
+	sn.attempts++
+	if sn.attempts <= sn.failures {
+		return derrors.NewUnavailableError("destination down")
+	}
+	sn.received = append(sn.received, notification)
+	return nil
+}
+
+func (sn *stubNotifier) String() string {
+	return "stub"
+}
+
+func testNotification(event Event) Notification {
+	started := time.Date(2019, 10, 1, 10, 0, 0, 0, time.UTC)
+	return Notification{
+		Event:          event,
+		Operation:      "Install cluster",
+		RequestID:      "r1",
+		OrganizationID: "o1",
+		ClusterID:      "c1",
+		Status:         "FAILED",
+		Error:          "workflow execution failed",
+		Started:        started,
+		Timestamp:      started.Add(90 * time.Second),
+	}
+}
+
+var _ = ginkgo.Describe("Notifications", func() {
+
+	ginkgo.It("should validate the destinations", func() {
+		gomega.Expect(Config{}.Validate()).To(gomega.Succeed())
+		gomega.Expect(Config{Webhooks: []string{"https://hooks.example.com/installer"}, Events: []string{"failed"}}.Validate()).
+			To(gomega.Succeed())
+		gomega.Expect(Config{Webhooks: []string{"ftp://hooks.example.com"}}.Validate()).NotTo(gomega.Succeed())
+		gomega.Expect(Config{SlackWebhooks: []string{"hooks.slack.com/services/T/B/X"}}.Validate()).NotTo(gomega.Succeed())
+		gomega.Expect(Config{SMTPServer: "smtp.example.com"}.Validate()).NotTo(gomega.Succeed())
+		gomega.Expect(Config{SMTPServer: "smtp.example.com:587"}.Validate()).NotTo(gomega.Succeed())
+		gomega.Expect(Config{SMTPServer: "smtp.example.com:587", EmailFrom: "installer@example.com",
+			EmailTo: []string{"sre@example.com"}}.Validate()).To(gomega.Succeed())
+		gomega.Expect(Config{Events: []string{"progress"}}.Validate()).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should summarize the notifications", func() {
+		notification := testNotification(Failed)
+		gomega.Expect(notification.Summary()).To(gomega.Equal(
+			"Install cluster c1 failed (request r1, organization o1) after 1m30s: workflow execution failed"))
+		started := testNotification(Started)
+		started.Error = ""
+		gomega.Expect(started.Summary()).To(gomega.Equal("Install cluster c1 started (request r1, organization o1)"))
+	})
+
+	ginkgo.Context("posting to webhooks", func() {
+
+		var server *httptest.Server
+		var bodies []string
+		var events []string
+		var status int
+
+		ginkgo.BeforeEach(func() {
+			bodies = make([]string, 0)
+			events = make([]string, 0)
+			status = http.StatusOK
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				bodies = append(bodies, string(body))
+				events = append(events, r.Header.Get(EventHeader))
+				w.WriteHeader(status)
+			}))
+		})
+
+		ginkgo.AfterEach(func() {
+			server.Close()
+		})
+
+		ginkgo.It("should post the notification as JSON", func() {
+			gomega.Expect(NewWebhookNotifier(server.URL, time.Second).Notify(testNotification(Failed))).To(gomega.Succeed())
+			gomega.Expect(bodies).To(gomega.HaveLen(1))
+			gomega.Expect(events).To(gomega.Equal([]string{"failed"}))
+			received := Notification{}
+			gomega.Expect(json.Unmarshal([]byte(bodies[0]), &received)).To(gomega.Succeed())
+			gomega.Expect(received).To(gomega.Equal(testNotification(Failed)))
+		})
+
+		ginkgo.It("should post the summary to Slack", func() {
+			gomega.Expect(NewSlackNotifier(server.URL, time.Second).Notify(testNotification(Failed))).To(gomega.Succeed())
+			message := slackMessage{}
+			gomega.Expect(json.Unmarshal([]byte(bodies[0]), &message)).To(gomega.Succeed())
+			gomega.Expect(message.Text).To(gomega.Equal(testNotification(Failed).Summary()))
+		})
+
+		ginkgo.It("should fail if the webhook rejects the notification", func() {
+			status = http.StatusForbidden
+			err := NewWebhookNotifier(server.URL+"/T123/secret", time.Second).Notify(testNotification(Failed))
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			gomega.Expect(err.DebugReport()).NotTo(gomega.ContainSubstring("secret"))
+		})
+	})
+
+	ginkgo.It("should send the notification by email", func() {
+		notifier := NewEmailNotifier("smtp.example.com:587", "installer", "pass", "installer@example.com",
+			[]string{"sre@example.com", "ops@example.com"})
+		var sent []byte
+		var recipients []string
+		notifier.send = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+			gomega.Expect(addr).To(gomega.Equal("smtp.example.com:587"))
+			gomega.Expect(auth).NotTo(gomega.BeNil())
+			recipients = to
+			sent = msg
+			return nil
+		}
+		notification := testNotification(Failed)
+		notification.ClusterID = "c1\r\nBcc: attacker@example.com"
+		gomega.Expect(notifier.Notify(notification)).To(gomega.Succeed())
+		gomega.Expect(recipients).To(gomega.Equal([]string{"sre@example.com", "ops@example.com"}))
+		gomega.Expect(string(sent)).To(gomega.ContainSubstring("Subject: [installer] Install cluster c1  Bcc: attacker@example.com failed\r\n"))
+		gomega.Expect(string(sent)).To(gomega.ContainSubstring("Error: workflow execution failed\r\n"))
+
+		notifier.send = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+			return fmt.Errorf("connection refused")
+		}
+		gomega.Expect(notifier.Notify(notification)).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.Context("dispatching", func() {
+
+		ginkgo.BeforeEach(func() {
+			retryDelay = 0
+		})
+
+		ginkgo.It("should only send the selected events", func() {
+			notifier := &stubNotifier{}
+			dispatcher := newDispatcher([]Notifier{notifier}, []string{"failed"})
+			gomega.Expect(dispatcher.Enabled()).To(gomega.BeTrue())
+			dispatcher.Send(testNotification(Started))
+			dispatcher.Send(testNotification(Failed))
+			dispatcher.Wait()
+			gomega.Expect(notifier.received).To(gomega.HaveLen(1))
+			gomega.Expect(notifier.received[0].Event).To(gomega.Equal(Failed))
+		})
+
+		ginkgo.It("should retry the failed deliveries", func() {
+			notifier := &stubNotifier{failures: DefaultAttempts - 1}
+			dispatcher := newDispatcher([]Notifier{notifier}, nil)
+			dispatcher.Send(testNotification(Succeeded))
+			dispatcher.Wait()
+			gomega.Expect(notifier.attempts).To(gomega.Equal(DefaultAttempts))
+			gomega.Expect(notifier.received).To(gomega.HaveLen(1))
+
+			notifier = &stubNotifier{failures: DefaultAttempts}
+			dispatcher = newDispatcher([]Notifier{notifier}, nil)
+			dispatcher.Send(testNotification(Succeeded))
+			dispatcher.Wait()
+			gomega.Expect(notifier.received).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should not send anything without destinations", func() {
+			dispatcher := NewDispatcher(Config{})
+			gomega.Expect(dispatcher.Enabled()).To(gomega.BeFalse())
+			dispatcher.Send(testNotification(Failed))
+			dispatcher.Wait()
+		})
+	})
+})
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+)
+
+// EventHeader is the HTTP header with the event of the notifications sent to the webhooks.
+const EventHeader = "X-Installer-Event"
+
+// destination returns the scheme and host of a webhook, used to log it without its token.
+func destination(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "invalid URL"
+	}
+	return fmt.Sprintf("%s://%s", parsed.Scheme, parsed.Host)
+}
+
+// post sends a JSON body to a webhook.
+func post(client *http.Client, webhook string, event Event, body interface{}) derrors.Error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return derrors.NewInternalError("cannot marshal notification", err)
+	}
+	request, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(content))
+	if err != nil {
+		return derrors.NewInvalidArgumentError("cannot create notification request").WithParams(destination(webhook))
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, string(event))
+	response, err := client.Do(request)
+	if err != nil {
+		return derrors.NewUnavailableError("cannot reach webhook").WithParams(destination(webhook))
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return derrors.NewUnavailableError("webhook rejected the notification").
+			WithParams(destination(webhook), response.StatusCode)
+	}
+	return nil
+}
+
+// WebhookNotifier posts the notifications as JSON to a URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier posting to a URL.
+func NewWebhookNotifier(webhook string, timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{URL: webhook, Client: &http.Client{Timeout: timeout}}
+}
+
+// Notify posts the notification.
+func (wn *WebhookNotifier) Notify(notification Notification) derrors.Error {
+	return post(wn.Client, wn.URL, notification.Event, notification)
+}
+
+func (wn *WebhookNotifier) String() string {
+	return "webhook " + destination(wn.URL)
+}
+
+// SlackNotifier posts the summary of the notifications to the incoming webhook of a Slack channel.
+type SlackNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// slackMessage is the payload of the incoming webhooks of Slack.
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// NewSlackNotifier creates a notifier posting to the incoming webhook of a Slack channel.
+func NewSlackNotifier(webhook string, timeout time.Duration) *SlackNotifier {
+	return &SlackNotifier{URL: webhook, Client: &http.Client{Timeout: timeout}}
+}
+
+// Notify posts the summary of the notification.
+func (sn *SlackNotifier) Notify(notification Notification) derrors.Error {
+	return post(sn.Client, sn.URL, notification.Event, slackMessage{Text: notification.Summary()})
+}
+
+func (sn *SlackNotifier) String() string {
+	return "slack " + destination(sn.URL)
+}
+
+// sendMailFunc sends an email, smtp.SendMail or a stub in the tests.
+type sendMailFunc func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+
+// EmailNotifier sends the notifications by email through an SMTP server. The connection is upgraded with STARTTLS
+// if the server supports it, which is required to send the credentials to servers other than localhost.
+type EmailNotifier struct {
+	Server   string
+	Username string
+	Password string
+	From     string
+	To       []string
+	send     sendMailFunc
+}
+
+// NewEmailNotifier creates a notifier sending emails through an SMTP server.
+func NewEmailNotifier(server string, username string, password string, from string, to []string) *EmailNotifier {
+	return &EmailNotifier{Server: server, Username: username, Password: password, From: from, To: to, send: smtp.SendMail}
+}
+
+// headerReplacer removes the line breaks of the values written on the headers of the emails.
+var headerReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+// message builds the email of a notification.
+func (en *EmailNotifier) message(notification Notification) []byte {
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", en.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(en.To, ", "))
+	// The subject contains values of the request, so line breaks are removed to avoid injecting headers.
+	fmt.Fprintf(&body, "Subject: [installer] %s\r\n", headerReplacer.Replace(notification.Title()))
+	fmt.Fprintf(&body, "Date: %s\r\n", notification.Timestamp.Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&body, "%s\r\n\r\n", notification.Summary())
+	fields := [][2]string{
+		{"Operation", notification.Operation},
+		{"Request", notification.RequestID},
+		{"Organization", notification.OrganizationID},
+		{"Cluster", notification.ClusterID},
+		{"Template", strings.TrimSpace(notification.TemplateName + " " + notification.TemplateVersion)},
+		{"Initiator", notification.Initiator},
+		{"Status", notification.Status},
+		{"Started", notification.Started.UTC().Format(time.RFC3339)},
+		{"Elapsed", notification.Elapsed().String()},
+		{"Error", notification.Error},
+	}
+	for _, field := range fields {
+		if field[1] != "" {
+			fmt.Fprintf(&body, "%s: %s\r\n", field[0], field[1])
+		}
+	}
+	return []byte(body.String())
+}
+
+// Notify sends the notification by email.
+func (en *EmailNotifier) Notify(notification Notification) derrors.Error {
+	var auth smtp.Auth
+	if en.Username != "" {
+		host, _, _ := net.SplitHostPort(en.Server)
+		auth = smtp.PlainAuth("", en.Username, en.Password, host)
+	}
+	if err := en.send(en.Server, auth, en.From, en.To, en.message(notification)); err != nil {
+		return derrors.NewUnavailableError("cannot send notification email", err).WithParams(en.Server)
+	}
+	return nil
+}
+
+func (en *EmailNotifier) String() string {
+	return "email " + en.Server
+}
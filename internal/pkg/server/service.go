@@ -19,13 +19,23 @@ package server
 
 import (
 	"fmt"
+	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/bundle"
+	"github.com/nalej/installer/internal/pkg/cryptopolicy"
+	"github.com/nalej/installer/internal/pkg/server/auth"
 	"github.com/nalej/installer/internal/pkg/server/config"
+	"github.com/nalej/installer/internal/pkg/server/extensions"
+	"github.com/nalej/installer/internal/pkg/server/health"
 	"github.com/nalej/installer/internal/pkg/server/installer"
+	"github.com/nalej/installer/internal/pkg/server/interceptors"
 	"github.com/nalej/installer/internal/pkg/utils"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/plugin"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
+	"k8s.io/client-go/kubernetes"
 	"net"
 )
 
@@ -40,8 +50,47 @@ func NewService(conf config.Config) *Service {
 	}
 }
 
+// getServerOptions builds the transport security and interceptor options of the gRPC server.
+func (s *Service) getServerOptions() ([]grpc.ServerOption, derrors.Error) {
+	options := make([]grpc.ServerOption, 0)
+	if s.Configuration.TLSEnabled {
+		creds, err := loadTLSCredentials(s.Configuration)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, grpc.Creds(creds))
+	}
+	unary := make([]grpc.UnaryServerInterceptor, 0)
+	if s.Configuration.AuthEnabled {
+		interceptor, err := auth.NewInterceptor(s.Configuration.APIKeysPath, s.Configuration.JWTSecret)
+		if err != nil {
+			return nil, err
+		}
+		unary = append(unary, interceptor.Unary())
+	}
+	unary = append(unary, interceptors.Validation())
+	if s.Configuration.OperationsPerMinute > 0 {
+		limiter := interceptors.NewOrganizationLimiter(s.Configuration.OperationsPerMinute, s.Configuration.OperationsBurst)
+		unary = append(unary, interceptors.RateLimit(limiter))
+	}
+	options = append(options, grpc.UnaryInterceptor(interceptors.ChainUnary(unary...)))
+	return options, nil
+}
+
 // Run the service, launch the REST service handler.
 func (s *Service) Run() error {
+	if bundle.IsRemote(s.Configuration.ComponentsPath) {
+		fetcher := bundle.NewFetcher(bundle.Credentials{
+			Username: s.Configuration.ComponentsUsername,
+			Password: s.Configuration.ComponentsPassword,
+		})
+		components, err := fetcher.Fetch(s.Configuration.ComponentsPath, utils.GetPath(s.Configuration.TempPath))
+		if err != nil {
+			log.Error().Str("error", err.DebugReport()).Msg("cannot fetch components bundle")
+			return err
+		}
+		s.Configuration.ComponentsPath = components
+	}
 	s.Configuration.ComponentsPath = utils.ExtendComponentsPath(s.Configuration.ComponentsPath, true)
 	vErr := s.Configuration.Validate()
 	if vErr != nil {
@@ -49,20 +98,72 @@ func (s *Service) Run() error {
 		return vErr
 	}
 	s.Configuration.Print()
+	k8s.SetClientDefaults(s.Configuration.KubeQPS, s.Configuration.KubeBurst)
+	cryptopolicy.SetRestricted(s.Configuration.RestrictedCrypto)
+	if s.Configuration.PluginsPath != "" {
+		if _, err := plugin.Load(s.Configuration.PluginsPath); err != nil {
+			log.Error().Str("error", err.DebugReport()).Msg("cannot load command plugins")
+			return err
+		}
+	}
 
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Configuration.Port))
 	if err != nil {
 		log.Fatal().Errs("failed to listen: %v", []error{err})
 	}
 
+	reporter := health.NewReporter(health.ManagerSubsystem, health.StateSubsystem)
 	installerManager := installer.NewManager(s.Configuration)
+	if err := installerManager.LoadTemplates(); err != nil {
+		log.Error().Str("error", err.DebugReport()).Msg("cannot load workflow templates")
+		return err
+	}
+	var leaderClient kubernetes.Interface
+	if s.Configuration.LeaderElection {
+		// The lease and the shared state are kept in the cluster where the installer runs.
+		source := &k8s.Kubernetes{}
+		if err := source.Connect(); err != nil {
+			log.Error().Str("error", err.DebugReport()).Msg("cannot connect to the cluster for the leader election")
+			return err
+		}
+		leaderClient = source.Client
+		installerManager.Leadership = installer.NewLeadership(installer.LeaderIdentity(), true)
+		installerManager.State = installer.NewStateStore(leaderClient, s.Configuration.LeaderElectionNamespace, installer.StateConfigMapName)
+		go reporter.Watch(health.StateSubsystem, func() derrors.Error {
+			_, err := installerManager.State.Load()
+			return err
+		}, health.DefaultCheckInterval, make(chan struct{}))
+	} else {
+		// Without leader election the state is only kept in memory.
+		reporter.SetReady(health.StateSubsystem, true)
+	}
 	installerHandler := installer.NewHandler(installerManager)
+	if leaderClient != nil {
+		go func() {
+			if err := installerHandler.Manager.RunLeaderElection(leaderClient, make(chan struct{})); err != nil {
+				log.Fatal().Str("error", err.DebugReport()).Msg("cannot run the leader election")
+			}
+		}()
+	}
+	if s.Configuration.CertificateCheckInterval > 0 {
+		// The handler keeps its own copy of the manager, which is the one reporting the operations.
+		go installerHandler.Manager.WatchCertificates(s.Configuration.CertificateCheckInterval, make(chan struct{}))
+	}
+
+	options, oErr := s.getServerOptions()
+	if oErr != nil {
+		log.Error().Str("error", oErr.DebugReport()).Msg("cannot configure gRPC server")
+		return oErr
+	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(options...)
 	grpc_installer_go.RegisterInstallerServer(grpcServer, installerHandler)
+	extensions.RegisterExtensionsServer(grpcServer, installerHandler)
 
-	// Register reflection service on gRPC server.
+	// Register the health and reflection services so standard tooling can query the server.
+	reporter.Register(grpcServer)
 	reflection.Register(grpcServer)
+	reporter.SetReady(health.ManagerSubsystem, true)
 	log.Info().Int("port", s.Configuration.Port).Msg("Launching gRPC server")
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatal().Errs("failed to serve: %v", []error{err})
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/cryptopolicy"
+	"github.com/nalej/installer/internal/pkg/pki"
+	"github.com/nalej/installer/internal/pkg/server/config"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/credentials"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// SelfSignedValidity contains the validity of the auto-generated server certificates.
+const SelfSignedValidity = time.Hour * 24 * 365
+
+// loadTLSCredentials builds the transport credentials of the gRPC server.
+func loadTLSCredentials(conf config.Config) (credentials.TransportCredentials, derrors.Error) {
+	var certificate tls.Certificate
+	if conf.TLSCertPath != "" {
+		cert, err := tls.LoadX509KeyPair(conf.TLSCertPath, conf.TLSKeyPath)
+		if err != nil {
+			return nil, derrors.AsError(err, "cannot load server certificate")
+		}
+		certificate = cert
+		if err := cryptopolicy.CheckCertificate(certificate); err != nil {
+			return nil, err
+		}
+	} else {
+		log.Warn().Msg("no server certificate provided, generating a self-signed one")
+		cert, err := generateSelfSignedCertificate()
+		if err != nil {
+			return nil, err
+		}
+		certificate = *cert
+	}
+
+	tlsConfig := cryptopolicy.RestrictTLS(&tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	})
+
+	if conf.TLSClientCAPath != "" {
+		caContent, err := ioutil.ReadFile(conf.TLSClientCAPath)
+		if err != nil {
+			return nil, derrors.AsError(err, "cannot read client CA certificate")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caContent) {
+			return nil, derrors.NewInvalidArgumentError("cannot parse client CA certificate").WithParams(conf.TLSClientCAPath)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// generateSelfSignedCertificate creates an in-memory certificate for the installer service.
+func generateSelfSignedCertificate() (*tls.Certificate, derrors.Error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	generated, gErr := pki.SelfSigned(pki.Request{
+		Subject: pkix.Name{
+			Organization: []string{"Nalej"},
+			CommonName:   "installer",
+		},
+		DNSNames: []string{hostname, "localhost"},
+		Validity: SelfSignedValidity,
+	})
+	if gErr != nil {
+		return nil, gErr
+	}
+	cert, gErr := generated.TLSCertificate()
+	if gErr != nil {
+		return nil, gErr
+	}
+	return &cert, nil
+}
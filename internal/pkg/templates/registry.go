@@ -0,0 +1,259 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package templates
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// InstallTemplate is the name of the template used to install clusters.
+const InstallTemplate = "install"
+
+// UninstallTemplate is the name of the template used to uninstall clusters.
+const UninstallTemplate = "uninstall"
+
+// NetworkOverlayTemplate is the name of the template used to install the network overlay servers.
+const NetworkOverlayTemplate = "network-overlay"
+
+// RotateSecretsTemplate is the name of the template used to rotate the secrets of clusters.
+const RotateSecretsTemplate = "rotate-secrets"
+
+// BuiltinVersion is the version of the templates compiled into the installer.
+const BuiltinVersion = "builtin"
+
+// WorkflowsDir is the directory inside the configuration path that contains the workflow templates.
+const WorkflowsDir = "workflows"
+
+// IndexFile is the name of the file describing the available workflow templates.
+const IndexFile = "index.json"
+
+// WorkflowTemplate structure with a named and versioned workflow definition.
+type WorkflowTemplate struct {
+	// Name of the template.
+	Name string `json:"name"`
+	// Version of the template.
+	Version string `json:"version"`
+	// Description of the template.
+	Description string `json:"description"`
+	// File with the template content relative to the workflows directory.
+	File string `json:"file,omitempty"`
+	// Checksum with the SHA256 of the file content.
+	Checksum string `json:"sha256,omitempty"`
+	// Content of the template.
+	Content string `json:"-"`
+}
+
+// templateIndex structure of the index file.
+type templateIndex struct {
+	Templates []WorkflowTemplate `json:"templates"`
+}
+
+// Registry of the workflow templates available in the installer.
+type Registry struct {
+	sync.RWMutex
+	templates map[string]map[string]*WorkflowTemplate
+}
+
+// NewRegistry creates a registry that contains the builtin templates.
+func NewRegistry() *Registry {
+	r := &Registry{templates: make(map[string]map[string]*WorkflowTemplate, 0)}
+	r.Register(WorkflowTemplate{
+		Name:        InstallTemplate,
+		Version:     BuiltinVersion,
+		Description: "Install management or application cluster",
+		Content:     InstallManagementCluster,
+	})
+	r.Register(WorkflowTemplate{
+		Name:        UninstallTemplate,
+		Version:     BuiltinVersion,
+		Description: "Uninstall management or application cluster",
+		Content:     UninstallCluster,
+	})
+	r.Register(WorkflowTemplate{
+		Name:        NetworkOverlayTemplate,
+		Version:     BuiltinVersion,
+		Description: "Install the VPN server and ZeroTier planet",
+		Content:     InstallNetworkOverlay,
+	})
+	r.Register(WorkflowTemplate{
+		Name:        RotateSecretsTemplate,
+		Version:     BuiltinVersion,
+		Description: "Rotate the authx and registry secrets of a cluster",
+		Content:     RotateSecrets,
+	})
+	return r
+}
+
+// NewEmptyRegistry creates a registry without the builtin templates, used for the templates overridden by an
+// organization.
+func NewEmptyRegistry() *Registry {
+	return &Registry{templates: make(map[string]map[string]*WorkflowTemplate, 0)}
+}
+
+// Register adds a new template to the registry.
+func (r *Registry) Register(template WorkflowTemplate) derrors.Error {
+	if template.Name == "" || template.Version == "" {
+		return derrors.NewInvalidArgumentError("template name and version must be set")
+	}
+	r.Lock()
+	defer r.Unlock()
+	versions, exists := r.templates[template.Name]
+	if !exists {
+		versions = make(map[string]*WorkflowTemplate, 0)
+		r.templates[template.Name] = versions
+	}
+	if _, exists := versions[template.Version]; exists {
+		return derrors.NewAlreadyExistsError("template already registered").WithParams(template.Name, template.Version)
+	}
+	versions[template.Version] = &template
+	return nil
+}
+
+// LoadFromPath registers the templates described in the index file of the configuration path. The content of
+// each template is validated against the checksum found in the index.
+func (r *Registry) LoadFromPath(confPath string) derrors.Error {
+	workflowsPath := filepath.Join(confPath, WorkflowsDir)
+	indexPath := filepath.Join(workflowsPath, IndexFile)
+	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+		log.Debug().Str("path", indexPath).Msg("no workflow templates index found")
+		return nil
+	}
+	content, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return derrors.AsError(err, "cannot read workflow templates index")
+	}
+	var index templateIndex
+	if err := json.Unmarshal(content, &index); err != nil {
+		return derrors.NewInvalidArgumentError("cannot unmarshal workflow templates index", err)
+	}
+	for _, template := range index.Templates {
+		raw, err := ioutil.ReadFile(filepath.Join(workflowsPath, template.File))
+		if err != nil {
+			return derrors.NewInternalError("cannot read workflow template", err).WithParams(template.Name, template.Version)
+		}
+		if !ValidChecksum(raw, template.Checksum) {
+			return derrors.NewInvalidArgumentError("workflow template checksum mismatch").WithParams(template.Name, template.Version)
+		}
+		template.Content = string(raw)
+		if rErr := r.Register(template); rErr != nil {
+			return rErr
+		}
+		log.Debug().Str("name", template.Name).Str("version", template.Version).Msg("workflow template loaded")
+	}
+	return nil
+}
+
+// ValidChecksum checks that the SHA256 of the content matches the expected one.
+func ValidChecksum(content []byte, expected string) bool {
+	sum := sha256.Sum256(content)
+	return expected != "" && strings.EqualFold(hex.EncodeToString(sum[:]), expected)
+}
+
+// Get retrieves a template. If the version is empty, the latest one is returned.
+func (r *Registry) Get(name string, version string) (*WorkflowTemplate, derrors.Error) {
+	r.RLock()
+	defer r.RUnlock()
+	versions, exists := r.templates[name]
+	if !exists {
+		return nil, derrors.NewNotFoundError("workflow template not found").WithParams(name)
+	}
+	if version == "" {
+		version = latestVersion(versions)
+	}
+	template, exists := versions[version]
+	if !exists {
+		return nil, derrors.NewNotFoundError("workflow template version not found").WithParams(name, version)
+	}
+	return template, nil
+}
+
+// GetContent returns the content of a template. If the version is empty, the latest one is returned.
+func (r *Registry) GetContent(name string, version string) (string, derrors.Error) {
+	template, err := r.Get(name, version)
+	if err != nil {
+		return "", err
+	}
+	return template.Content, nil
+}
+
+// List returns the available templates sorted by name and version.
+func (r *Registry) List() []WorkflowTemplate {
+	r.RLock()
+	defer r.RUnlock()
+	result := make([]WorkflowTemplate, 0)
+	for _, versions := range r.templates {
+		for _, template := range versions {
+			result = append(result, *template)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return compareVersions(result[i].Version, result[j].Version) < 0
+	})
+	return result
+}
+
+func latestVersion(versions map[string]*WorkflowTemplate) string {
+	latest := ""
+	for version := range versions {
+		if latest == "" || compareVersions(version, latest) > 0 {
+			latest = version
+		}
+	}
+	return latest
+}
+
+// compareVersions compares dot separated versions numerically. Non numeric versions such as the builtin one
+// are considered older than any numeric version.
+func compareVersions(a string, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aValue, bValue := -1, -1
+		if i < len(aParts) {
+			if v, err := strconv.Atoi(aParts[i]); err == nil {
+				aValue = v
+			}
+		}
+		if i < len(bParts) {
+			if v, err := strconv.Atoi(bParts[i]); err == nil {
+				bValue = v
+			}
+		}
+		if aValue != bValue {
+			if aValue < bValue {
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package templates
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const testTemplate = `{"description": "test", "commands": [{"type":"sync", "name": "logger", "msg": "test"}]}`
+
+func writeTestIndex(confPath string, checksum string) {
+	workflowsPath := filepath.Join(confPath, WorkflowsDir)
+	gomega.Expect(os.MkdirAll(workflowsPath, os.ModePerm)).To(gomega.Succeed())
+	gomega.Expect(ioutil.WriteFile(filepath.Join(workflowsPath, "install-1.1.0.json"), []byte(testTemplate), 0644)).To(gomega.Succeed())
+	index := fmt.Sprintf(`{"templates":[{"name":"install","version":"1.1.0","file":"install-1.1.0.json","sha256":"%s"}]}`, checksum)
+	gomega.Expect(ioutil.WriteFile(filepath.Join(workflowsPath, IndexFile), []byte(index), 0644)).To(gomega.Succeed())
+}
+
+var _ = ginkgo.Describe("Template registry", func() {
+
+	var confPath string
+
+	ginkgo.BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "registry")
+		gomega.Expect(err).To(gomega.Succeed())
+		confPath = dir
+	})
+
+	ginkgo.AfterEach(func() {
+		os.RemoveAll(confPath)
+	})
+
+	ginkgo.It("should contain the builtin templates", func() {
+		registry := NewRegistry()
+		template, err := registry.Get(InstallTemplate, BuiltinVersion)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(template.Content).Should(gomega.Equal(InstallManagementCluster))
+		gomega.Expect(len(registry.List())).Should(gomega.Equal(4))
+	})
+
+	ginkgo.It("should load versioned templates with valid checksums", func() {
+		sum := sha256.Sum256([]byte(testTemplate))
+		writeTestIndex(confPath, hex.EncodeToString(sum[:]))
+		registry := NewRegistry()
+		gomega.Expect(registry.LoadFromPath(confPath)).To(gomega.Succeed())
+		template, err := registry.Get(InstallTemplate, "")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(template.Version).Should(gomega.Equal("1.1.0"))
+		gomega.Expect(template.Content).Should(gomega.Equal(testTemplate))
+	})
+
+	ginkgo.It("should reject templates with invalid checksums", func() {
+		writeTestIndex(confPath, "0000")
+		registry := NewRegistry()
+		gomega.Expect(registry.LoadFromPath(confPath)).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should fail on unknown templates", func() {
+		registry := NewRegistry()
+		_, err := registry.Get("unknown", "")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		_, err = registry.Get(InstallTemplate, "9.9.9")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+})
@@ -20,29 +20,74 @@ package templates
 const InstallManagementCluster = `
 {
 	"description": "Install management cluster",
+	// requires: InstallRequest.ClusterId, InstallRequest.Hostname, InstallRequest.StaticIpAddresses, Paths.ComponentsPath
 	"commands": [
 		// Prerequirements
 		{"type":"sync", "name":"checkAsset", "path":"{{$.Paths.BinaryPath}}/rke"},
+		{"type":"sync", "name":"checkBinaries", "binary_path":"{{$.Paths.BinaryPath}}"{{if eq $.NetworkConfig.NetworkingMode "istio" }}, "istio_path":"{{$.NetworkConfig.IstioPath}}"{{end}}},
 		// Install K8s
 		{{if $.InstallRequest.InstallBaseSystem }}
 			{"type":"sync", "name": "logger", "msg": "Installing base system"},
 		{{end}}
 
 		{"type":"sync", "name": "logger", "msg": "Checking requirements"},
+		{"type":"sync", "name": "probeCluster",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}"
+		},
 		{"type":"sync", "name": "checkRequirements",
 			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
 			"minVersion":"1.11"
 		},
+		{"type":"sync", "name": "checkCompatibility",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"components_path":"{{$.Paths.ComponentsPath}}",
+			{{if eq $.NetworkConfig.NetworkingMode "istio" }}"istio_path":"{{$.NetworkConfig.IstioPath}}",{{end}}
+			"allow_unsupported":{{$.AllowUnsupportedVersions}}
+		},
 		{"type":"sync", "name": "logger", "msg": "Installing components"},
+		{"type":"sync", "name": "configureNamespaces",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"namespaces":["nalej"],
+			"environment":"{{$.TargetEnvironment}}",
+			"install_id":"{{$.InstallRequest.ClusterId}}",
+			"governance_path":"{{$.Paths.NamespaceGovernancePath}}"
+		},
+		{{if and (not $.AppCluster) (eq $.CertificateIssuer "internal") }}
+		{"type":"sync", "name":"createInternalCA",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"domain":"{{$.DNSClusterHost}}",
+			"ca_cert_path":"{{$.Paths.InternalCACertPath}}",
+			"ca_key_path":"{{$.Paths.InternalCAKeyPath}}",
+			"publish_namespaces":["nalej"]
+		},
+		{{end}}
         {{if eq $.NetworkConfig.NetworkingMode "istio" }}
             {"type":"sync", "name":"installIstio",
                 "kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
                 "istio_path":"{{$.NetworkConfig.IstioPath}}",
+                "istioctl_image":"{{$.NetworkConfig.IstioctlImage}}",
                 "cluster_id":"{{$.InstallRequest.ClusterId}}",
                 "is_appCluster":{{$.AppCluster}},
                 "static_ip_address":"{{$.InstallRequest.StaticIpAddresses.Ingress}}",
                 "temp_path":"{{$.Paths.TempPath}}",
-                "dns_public_host":"{{$.DNSClusterHost}}"
+                "dns_public_host":"{{$.DNSClusterHost}}",
+                "trust_domain":"{{$.NetworkConfig.IstioTrustDomain}}",
+                "namespace":"{{$.NetworkConfig.IstioNamespace}}",
+                "ingress_gateway":"{{$.NetworkConfig.IstioIngressGateway}}",
+                "ca_secret_name":"{{$.NetworkConfig.IstioCASecret}}",
+                "management_gateway_ip":"{{$.NetworkConfig.IstioGatewayIP}}",
+                "management_kube_config_path":"{{$.Paths.ManagementKubeConfigPath}}",
+                "certificate_issuer":"{{$.CertificateIssuer}}"
+            },
+            {"type":"sync", "name":"verifyIstio",
+                "kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+                "namespace":"{{$.NetworkConfig.IstioNamespace}}",
+                "ingress_gateway":"{{$.NetworkConfig.IstioIngressGateway}}"
+            },
+            {"type":"sync", "name":"configureSidecarInjection",
+                "kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+                "cluster_role":"{{if $.AppCluster}}appcluster{{else}}management{{end}}",
+                "revision":"{{$.NetworkConfig.IstioRevision}}"
             },
         {{end}}
 		{{if $.AppCluster }}
@@ -55,7 +100,7 @@ const InstallManagementCluster = `
 				"cluster_public_hostname":"{{$.InstallRequest.Hostname}}",
 				"dns_public_host":"{{$.DNSClusterHost}}",
 				"dns_public_port":"{{$.DNSClusterPort}}",
-				"platform_type":"{{$.InstallRequest.TargetPlatform}}"
+				"platform_type":"{{$.PlatformType}}"
 			},
 			{"type":"sync", "name":"addClusterUser",
 				"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
@@ -84,15 +129,36 @@ const InstallManagementCluster = `
 				"public_port":"{{$.ManagementClusterPort}}",
 				"dns_host":"{{$.DNSClusterHost}}",
 				"dns_port":"{{$.DNSClusterPort}}",
-				"platform_type":"{{$.InstallRequest.TargetPlatform}}",
-				"environment":"{{$.TargetEnvironment}}"
+				"platform_type":"{{$.PlatformType}}",
+				"environment":"{{$.TargetEnvironment}}",
+				"auth_secret_length":{{$.AuthSecretLength}},
+				"auth_secret_encoding":"{{$.AuthSecretEncoding}}",
+				"cluster_domain":"{{$.NetworkConfig.ClusterDomain}}",
+				"networking_mode":"{{$.NetworkConfig.NetworkingMode}}",
+				"secret_store_path":"{{$.Paths.SecretStorePath}}"
 			},
+			{{if eq (index $.Bindings "platform_dns") "coredns" }}
 			{"type":"sync", "name":"installMngtDNS",
 				"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
-				"platform_type":"{{$.InstallRequest.TargetPlatform}}",
+				"platform_type":"{{$.PlatformType}}",
+				"service_type":"ClusterIP"
+			},
+			{"type":"sync", "name":"installPlatformDNS",
+				"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+				"platform_type":"{{$.PlatformType}}",
+				"domain":"{{$.InstallRequest.Hostname}}",
+				"public_host":"{{$.DNSClusterHost}}",
 				"use_static_ip":{{$.InstallRequest.StaticIpAddresses.UseStaticIp}},
 				"static_ip_address":"{{$.InstallRequest.StaticIpAddresses.Dns}}"
 			},
+			{{else}}
+			{"type":"sync", "name":"installMngtDNS",
+				"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+				"platform_type":"{{$.PlatformType}}",
+				"use_static_ip":{{$.InstallRequest.StaticIpAddresses.UseStaticIp}},
+				"static_ip_address":"{{$.InstallRequest.StaticIpAddresses.Dns}}"
+			},
+			{{end}}
 			{"type":"sync", "name":"createCACert",
 				"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
 				"public_host":"{{$.ManagementClusterHost}}"
@@ -100,34 +166,136 @@ const InstallManagementCluster = `
 		{{end}}
 		{"type":"sync", "name":"installIngress",
 				"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
-				"platform_type":"{{$.InstallRequest.TargetPlatform}}",
+				"platform_type":"{{$.PlatformType}}",
 				"management_public_host":"{{$.InstallRequest.Hostname}}",
 				"on_management_cluster":{{ not $.AppCluster}},
 				"use_static_ip":{{$.InstallRequest.StaticIpAddresses.UseStaticIp}},
 				"static_ip_address":"{{$.InstallRequest.StaticIpAddresses.Ingress}}",
-                "network_mode":"{{$.NetworkConfig.NetworkingMode}}"
+                "network_mode":"{{$.NetworkConfig.NetworkingMode}}",
+				"ingress_controller":"{{$.NetworkConfig.IngressController}}"
 		},
 		{{if not $.AppCluster }}
 			{"type":"sync", "name":"installExtDNS",
 				"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
-				"platform_type":"{{$.InstallRequest.TargetPlatform}}",
+				"platform_type":"{{$.PlatformType}}",
 				"use_static_ip":{{$.InstallRequest.StaticIpAddresses.UseStaticIp}},
 				"static_ip_address":"{{$.InstallRequest.StaticIpAddresses.CorednsExt}}"
 			},
 			{"type":"sync", "name":"installVpnServerLB",
 				"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
-				"platform_type":"{{$.InstallRequest.TargetPlatform}}",
+				"platform_type":"{{$.PlatformType}}",
 				"use_static_ip":{{$.InstallRequest.StaticIpAddresses.UseStaticIp}},
 				"static_ip_address":"{{$.InstallRequest.StaticIpAddresses.VpnServer}}"
 			},
 		{{end}}
+		{{if and $.AppCluster (or $.IngressCertificate $.Paths.IngressCertPath) }}
+		{"type":"sync", "name": "syncCertificate",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"source_kube_config_path":"{{$.Paths.ManagementKubeConfigPath}}",
+			"source":"{{$.IngressCertificate}}",
+			"cert_path":"{{$.Paths.IngressCertPath}}",
+			"private_key_path":"{{$.Paths.IngressKeyPath}}",
+			"ca_path":"{{$.Paths.IngressCAPath}}",
+			"secret_name":"ingress-cert",
+			"namespaces":["nalej"]
+		},
+		{{end}}
+		{{if $.Paths.RegistriesPath }}
+		{"type":"sync", "name": "createRegistrySecrets",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"registries_path":"{{$.Paths.RegistriesPath}}",
+			"secret_store_path":"{{$.Paths.SecretStorePath}}",
+			"platform_type":"{{$.PlatformType}}",
+			"namespaces":["nalej", "ingress-nginx"]
+		},
+		{{end}}
+		{{if $.StorageProvisioner }}
+		{"type":"sync", "name": "installStorageProvisioner",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"provisioner":"{{$.StorageProvisioner}}",
+			"nfs_share":"{{$.NFSShare}}",
+			"platform_type":"{{$.PlatformType}}"
+		},
+		{{end}}
+		{{if $.Paths.CRDsPath }}
+		{"type":"sync", "name": "createCRDs",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"crds_dir":"{{$.Paths.CRDsPath}}"
+		},
+		{{end}}
 		{"type":"sync", "name": "launchComponents",
 			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
 			"namespaces":["nalej", "ingress-nginx"],
 			"componentsDir":"{{$.Paths.ComponentsPath}}",
-			"platform_type":"{{$.InstallRequest.TargetPlatform}}",
-			"environment":"{{$.TargetEnvironment}}"
+			"signature_public_key_path":"{{$.Paths.ComponentsPublicKeyPath}}",
+			"registries_path":"{{$.Paths.RegistriesPath}}",
+			"storage_classes_path":"{{$.Paths.StorageClassesPath}}",
+			"install_id":"{{$.InstallRequest.ClusterId}}",
+			"prune":{{$.Prune}},
+			"adopt_existing":{{$.AdoptExisting}},
+			"migrate_volumes":{{$.MigrateVolumes}},
+			"platform_type":"{{$.PlatformType}}",
+			"environment":"{{$.TargetEnvironment}}",
+			"ingress_controller":"{{$.NetworkConfig.IngressController}}",
+			"feature_flags":{{toJSON $.FeatureFlags}}
+		}
+		{{if $.HardenNetwork }}
+		,{"type":"sync", "name": "logger", "msg": "Installing network policies"},
+		{"type":"sync", "name": "installNetworkPolicies",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"platform_namespaces":["nalej"]
+		}
+		{{end}}
+		{{if and (not $.AppCluster) (index $.Bindings "external_dns_provider") }}
+		,{"type":"sync", "name": "installExternalDNS",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"provider":"{{index $.Bindings "external_dns_provider"}}",
+			"domain":"{{$.InstallRequest.Hostname}}",
+			"owner_id":"{{$.InstallRequest.ClusterId}}",
+			"provider_config_path":"{{index $.Bindings "external_dns_config_path"}}"
+		}
+		{{end}}
+		{{if $.WithObservability }}
+		,{"type":"sync", "name": "logger", "msg": "Installing observability stack"},
+		{"type":"sync", "name": "installObservability",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"domain":"{{$.InstallRequest.Hostname}}",
+			"network_mode":"{{$.NetworkConfig.NetworkingMode}}",
+			"cluster_issuer":"{{if eq $.CertificateIssuer "internal"}}internal-ca{{else}}letsencrypt{{end}}",
+			"platform_namespaces":["nalej"]
+		}
+		{{end}}
+		{{if $.LoggingStack }}
+		,{"type":"sync", "name": "logger", "msg": "Installing logging stack"},
+		{"type":"sync", "name": "installLoggingStack",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"stack":"{{$.LoggingStack}}",
+			"retention":"{{$.LogRetention}}",
+			"storage_size":"{{$.LogStorageSize}}",
+			"platform_type":"{{$.PlatformType}}",
+			"platform_namespaces":["nalej"]
+		}
+		{{end}}
+		,{"type":"sync", "name": "runSmokeTests",
+			"componentsDir":"{{$.Paths.ComponentsPath}}",
+			"variables":{
+				"management_host":"{{$.InstallRequest.Hostname}}",
+				"cluster_id":"{{$.InstallRequest.ClusterId}}"
+			}
+		}
+		{{if $.AppCluster }}
+		,{"type":"sync", "name": "logger", "msg": "Registering cluster"},
+		{"type":"sync", "name": "registerAppCluster",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"organization_id":"{{$.InstallRequest.OrganizationId}}",
+			"cluster_id":"{{$.InstallRequest.ClusterId}}",
+			"cluster_name":"{{$.InstallRequest.ClusterId}}",
+			"hostname":"{{$.InstallRequest.Hostname}}",
+			"labels":{"nalej.com/platform":"{{$.PlatformType}}"},
+			"clusters_address":"system-model.nalej:8800",
+			"join_token":"{{index $.Bindings "join_token"}}"
 		}
+		{{end}}
 	]
 }
 `
@@ -283,6 +451,122 @@ const UninstallCluster = `
 			"policy_name":"node-exporter",
 			"fail_if_not_exists":false
 		}
+		{{if not $.AppCluster }}
+		,{"type":"sync", "name": "logger", "msg": "Purging the remaining objects of the installer"},
+		{"type":"sync", "name":"purgeByLabel",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"selector":"app.kubernetes.io/managed-by=nalej-installer"
+		}
+		{{end}}
+	]
+}
+`
+
+// InstallNetworkOverlay template with the commands required to deploy the servers of the network overlay. The
+// images can be set through the vpn_server_image and zt_planet_image bindings of the include command.
+const InstallNetworkOverlay = `
+{
+	"description": "Install network overlay servers",
+	"commands": [
+		{"type":"sync", "name": "logger", "msg": "Installing VPN server"},
+		{"type":"sync", "name": "createVpnServerConfig",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"management_public_host":"{{$.ManagementClusterHost}}"
+		},
+		{"type":"sync", "name": "installVpnServer",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"image":"{{or (index $.Bindings "vpn_server_image") "nalej/vpn-server:latest"}}",
+			"platform_type":"{{$.PlatformType}}"
+		},
+		{"type":"sync", "name": "waitDeploymentReady",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"namespace":"nalej",
+			"deployment_name":"vpn-server"
+		}
+		{{if eq $.NetworkConfig.NetworkingMode "zt" }}
+		,{"type":"sync", "name": "logger", "msg": "Installing ZeroTier planet"},
+		{"type":"sync", "name": "createZtPlanetFiles",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"ztIdToolBinaryPath":"{{$.Paths.BinaryPath}}/zerotier-idtool",
+			"management_public_host":"{{$.ManagementClusterHost}}",
+			"identitySecretPath":"{{$.Paths.TempPath}}/identity.secret",
+			"identityPublicPath":"{{$.Paths.TempPath}}/identity.public",
+			"planetJsonPath":"{{$.Paths.TempPath}}/planet.json",
+			"planetPath":"{{$.Paths.TempPath}}/planet"
+		},
+		{"type":"sync", "name": "installZtPlanet",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"image":"{{or (index $.Bindings "zt_planet_image") "nalej/zt-planet:latest"}}",
+			"platform_type":"{{$.PlatformType}}"
+		},
+		{"type":"sync", "name": "installZtPlanetLB",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"platform_type":"{{$.PlatformType}}",
+			"standalone":true
+		},
+		{"type":"sync", "name": "waitDeploymentReady",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"namespace":"nalej",
+			"deployment_name":"zt-planet"
+		}
+		{{end}}
+	]
+}
+`
+
+// RotateSecrets template with the commands required to rotate the secrets of a cluster. The authx secret of the
+// management cluster is replaced by the given value or a random one, unless an external secret store keeps it, the
+// registry credentials are replaced with the values of the registries file, if set, the wildcard certificate of the
+// management cluster is copied again to application clusters, and the deployments reading the rotated secrets are
+// restarted one at a time.
+const RotateSecrets = `
+{
+	"description": "Rotate secrets",
+	"commands": [
+		{{if and (not $.AppCluster) (not $.Paths.SecretStorePath) }}
+		{"type":"sync", "name": "logger", "msg": "Rotating authx secret"},
+		{"type":"sync", "name":"rotateSecret",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"namespace":"nalej",
+			"secret_name":"authx-secret",
+			"secret_key":"secret",
+			"secret_value":"{{$.AuthSecret}}",
+			"length":{{$.AuthSecretLength}},
+			"encoding":"{{$.AuthSecretEncoding}}",
+			"force_rotate":{{$.ForceRotate}}
+		},
+		{{end}}
+		{{if $.Paths.RegistriesPath }}
+		{"type":"sync", "name": "logger", "msg": "Replacing registry credentials"},
+		{"type":"sync", "name": "createRegistrySecrets",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"registries_path":"{{$.Paths.RegistriesPath}}",
+			"secret_store_path":"{{$.Paths.SecretStorePath}}",
+			"platform_type":"{{$.PlatformType}}",
+			"namespaces":["nalej", "ingress-nginx"],
+			"replace":true
+		},
+		{{end}}
+		{{if and $.AppCluster (or $.IngressCertificate $.Paths.IngressCertPath) }}
+		{"type":"sync", "name": "logger", "msg": "Syncing ingress certificate"},
+		{"type":"sync", "name": "syncCertificate",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"source_kube_config_path":"{{$.Paths.ManagementKubeConfigPath}}",
+			"source":"{{$.IngressCertificate}}",
+			"cert_path":"{{$.Paths.IngressCertPath}}",
+			"private_key_path":"{{$.Paths.IngressKeyPath}}",
+			"ca_path":"{{$.Paths.IngressCAPath}}",
+			"secret_name":"ingress-cert",
+			"namespaces":["nalej"]
+		},
+		{{end}}
+		{"type":"sync", "name": "logger", "msg": "Restarting dependent deployments"},
+		{"type":"sync", "name":"restartDeployments",
+			"kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+			"namespaces":["nalej"],
+			"secret_names":["authx-secret"],
+			"order":["authx"]
+		}
 	]
 }
 `
@@ -22,6 +22,7 @@ import (
 	"github.com/nalej/installer/internal/pkg/workflow"
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
+	"strings"
 )
 
 var _ = ginkgo.Describe("Templates", func() {
@@ -65,23 +66,299 @@ var _ = ginkgo.Describe("Templates", func() {
 				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallAppCluster", *params)
 				gomega.Expect(err).To(gomega.Succeed())
 				gomega.Expect(workflow).ShouldNot(gomega.BeNil())
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("RegisterAppCluster"))
+			})
+		})
+
+		ginkgo.Context("distributing the ingress certificate", func() {
+			ginkgo.It("should only sync the certificate to application clusters", func() {
+				params := workflow.GetTestInstallParameters(numNodes, false)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				params.IngressCertificate = "istio-system/ingress-cert"
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("SyncCertificate"))
+
+				params.AppCluster = true
+				workflow, err = parser.ParseWorkflow("test", InstallManagementCluster, "InstallAppCluster", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("SyncCertificate istio-system/ingress-cert to nalej"))
+			})
+		})
+
+		ginkgo.Context("using istio networking", func() {
+			ginkgo.It("should configure the sidecar injection of the cluster role", func() {
+				params := workflow.GetTestInstallParameters(numNodes, true)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				params.NetworkConfig.IstioRevision = "1-5-0"
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallAppCluster", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("ConfigureSidecarInjection for appcluster with revision 1-5-0"))
+			})
+		})
+
+		ginkgo.Context("hardening the network", func() {
+			ginkgo.It("should include the network policies", func() {
+				params := workflow.GetTestInstallParameters(numNodes, false)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				params.HardenNetwork = true
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow).ShouldNot(gomega.BeNil())
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("InstallNetworkPolicies"))
+			})
+		})
+
+		ginkgo.Context("configuring the trust domain", func() {
+			ginkgo.It("should install Istio on the requested trust domain", func() {
+				params := workflow.GetTestInstallParameters(numNodes, false)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				params.NetworkConfig.NetworkingMode = "istio"
+				params.NetworkConfig.IstioTrustDomain = "mesh.nalej.tech"
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("InstallIstio trust domain mesh.nalej.tech"))
+			})
+
+			ginkgo.It("should install Istio on the requested namespace", func() {
+				params := workflow.GetTestInstallParameters(numNodes, false)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				params.NetworkConfig.NetworkingMode = "istio"
+				params.NetworkConfig.IstioNamespace = "istio-system-rev1"
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("namespace istio-system-rev1"))
+			})
+		})
+
+		ginkgo.Context("checking the compatibility", func() {
+			ginkgo.It("should check the Istio version only on istio networking", func() {
+				params := workflow.GetTestInstallParameters(numNodes, false)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				params.NetworkConfig.NetworkingMode = "zt"
+				params.AllowUnsupportedVersions = true
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("CheckCompatibility"))
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("istio:  allowUnsupported: true"))
+			})
+		})
+
+		ginkgo.Context("using additional registries", func() {
+			ginkgo.It("should only create the registry secrets if a registries file is set", func() {
+				params := workflow.GetTestInstallParameters(numNodes, false)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("CreateRegistrySecrets"))
+
+				params.Paths.RegistriesPath = "/etc/nalej/registries.yaml"
+				workflow, err = parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("CreateRegistrySecrets from /etc/nalej/registries.yaml"))
+			})
+		})
+
+		ginkgo.Context("creating custom resource definitions", func() {
+			ginkgo.It("should establish the definitions before launching the components if a directory is set", func() {
+				params := workflow.GetTestInstallParameters(numNodes, false)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("CreateCRDs"))
+
+				params.Paths.CRDsPath = "/etc/nalej/crds"
+				workflow, err = parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				printed := workflow.PrettyPrint()
+				gomega.Expect(printed).Should(gomega.ContainSubstring("CreateCRDs from /etc/nalej/crds"))
+				gomega.Expect(strings.Index(printed, "CreateCRDs")).Should(gomega.BeNumerically("<", strings.Index(printed, "LaunchComponents")))
+			})
+		})
+
+		ginkgo.Context("installing a storage provisioner", func() {
+			ginkgo.It("should install the provisioner before launching the components if one is set", func() {
+				params := workflow.GetTestInstallParameters(numNodes, false)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("InstallStorageProvisioner"))
+
+				params.StorageProvisioner = "local-path"
+				workflow, err = parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				printed := workflow.PrettyPrint()
+				gomega.Expect(printed).Should(gomega.ContainSubstring("InstallStorageProvisioner local-path"))
+				gomega.Expect(strings.Index(printed, "InstallStorageProvisioner")).Should(gomega.BeNumerically("<", strings.Index(printed, "LaunchComponents")))
+			})
+		})
+
+		ginkgo.Context("publishing records with external-dns", func() {
+			ginkgo.It("should only install external-dns if a provider is set", func() {
+				params := workflow.GetTestInstallParameters(numNodes, false)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("InstallExternalDNS"))
+
+				params.Bindings = map[string]string{
+					"external_dns_provider":    "azure",
+					"external_dns_config_path": "/tmp/azure-dns.yaml",
+				}
+				workflow, err = parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("InstallExternalDNS"))
+			})
+		})
+
+		ginkgo.Context("serving the platform DNS", func() {
+			ginkgo.It("should install CoreDNS in front of consul if requested", func() {
+				params := workflow.GetTestInstallParameters(numNodes, false)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("InstallPlatformDNS"))
+
+				params.Bindings = map[string]string{"platform_dns": "coredns"}
+				workflow, err = parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				printed := workflow.PrettyPrint()
+				gomega.Expect(printed).Should(gomega.ContainSubstring("InstallPlatformDNS " + params.InstallRequest.Hostname))
+				gomega.Expect(printed).Should(gomega.ContainSubstring("InstallMngtDNS"))
+			})
+		})
+
+		ginkgo.Context("issuing the ingress certificates", func() {
+			ginkgo.It("should create the internal CA if requested", func() {
+				params := workflow.GetTestInstallParameters(numNodes, false)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("CreateInternalCA"))
+
+				params.CertificateIssuer = "internal"
+				workflow, err = parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("CreateInternalCA " + params.DNSClusterHost))
+			})
+		})
+
+		ginkgo.Context("choosing the ingress controller", func() {
+			ginkgo.It("should install the requested controller", func() {
+				params := workflow.GetTestInstallParameters(numNodes, false)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("InstallIngress on Management: true with istio"))
+
+				params.NetworkConfig.IngressController = "traefik"
+				workflow, err = parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("InstallIngress on Management: true with traefik"))
+			})
+		})
+
+		ginkgo.Context("installing the observability stack", func() {
+			ginkgo.It("should only install the stack if requested", func() {
+				params := workflow.GetTestInstallParameters(numNodes, false)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("InstallObservability"))
+
+				params.WithObservability = true
+				workflow, err = parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring(
+					"InstallObservability on " + params.InstallRequest.Hostname))
+			})
+		})
+
+		ginkgo.Context("installing the logging stack", func() {
+			ginkgo.It("should install the selected stack with its retention", func() {
+				params := workflow.GetTestInstallParameters(numNodes, false)
+				params.InstallRequest.StaticIpAddresses = &grpc_installer_go.StaticIPAddresses{}
+				workflow, err := parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("InstallLoggingStack"))
+
+				params.LoggingStack = "loki"
+				params.LogRetention = "72h"
+				workflow, err = parser.ParseWorkflow("test", InstallManagementCluster, "InstallManagement", *params)
+				gomega.Expect(err).To(gomega.Succeed())
+				gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("InstallLoggingStack loki with retention 72h"))
 			})
 		})
 
 	})
 
+	ginkgo.Context("Network overlay template", func() {
+		ginkgo.It("should install the VPN server", func() {
+			params := workflow.GetTestInstallParameters(numNodes, false)
+			workflow, err := parser.ParseWorkflow("test", InstallNetworkOverlay, "InstallNetworkOverlay", *params)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("nalej/vpn-server:latest"))
+			gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("InstallZTPlanet"))
+		})
+		ginkgo.It("should install the ZeroTier planet on zt networking", func() {
+			params := workflow.GetTestInstallParameters(numNodes, false)
+			params.NetworkConfig.NetworkingMode = "zt"
+			params.Bindings = map[string]string{"zt_planet_image": "registry/zt-planet:v1"}
+			workflow, err := parser.ParseWorkflow("test", InstallNetworkOverlay, "InstallNetworkOverlay", *params)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("registry/zt-planet:v1"))
+		})
+	})
+
 	ginkgo.Context("Uninstall template", func() {
 		ginkgo.It("should uninstall a management cluster", func() {
 			params := workflow.GetTestUninstallParameters(false)
 			workflow, err := parser.ParseWorkflow("test", UninstallCluster, "UninstallManagement", *params)
 			gomega.Expect(err).To(gomega.Succeed())
 			gomega.Expect(workflow).ShouldNot(gomega.BeNil())
+			gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("PurgeByLabel app.kubernetes.io/managed-by=nalej-installer"))
 		})
 		ginkgo.It("should uninstall an application cluster", func() {
 			params := workflow.GetTestUninstallParameters(true)
 			workflow, err := parser.ParseWorkflow("test", UninstallCluster, "UninstallManagement", *params)
 			gomega.Expect(err).To(gomega.Succeed())
 			gomega.Expect(workflow).ShouldNot(gomega.BeNil())
+			gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("PurgeByLabel"))
+		})
+	})
+	ginkgo.Context("Rotate secrets template", func() {
+		request := &workflow.RotateSecretsRequest{RequestId: "requestID", KubeConfigRaw: "kubeConfigContent"}
+		ginkgo.It("should rotate the authx secret of a management cluster", func() {
+			params := workflow.NewRotateSecretsParameters(request, workflow.Paths{}, "", false)
+			workflow, err := parser.ParseWorkflow("test", RotateSecrets, "RotateSecrets", *params)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("RotateSecret nalej/authx-secret"))
+			gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("CreateRegistrySecrets"))
+			gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("RestartDeployments"))
+		})
+		ginkgo.It("should not rotate the authx secret kept in a secret store", func() {
+			params := workflow.NewRotateSecretsParameters(request, workflow.Paths{SecretStorePath: "/etc/nalej/store.yaml"}, "", false)
+			workflow, err := parser.ParseWorkflow("test", RotateSecrets, "RotateSecrets", *params)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("RotateSecret nalej/authx-secret"))
+		})
+		ginkgo.It("should only replace the registry credentials of an application cluster", func() {
+			params := workflow.NewRotateSecretsParameters(request, workflow.Paths{RegistriesPath: "/etc/nalej/registries.yaml"}, "", true)
+			workflow, err := parser.ParseWorkflow("test", RotateSecrets, "RotateSecrets", *params)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("RotateSecret nalej/authx-secret"))
+			gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("CreateRegistrySecrets"))
+		})
+		ginkgo.It("should sync the renewed ingress certificate to an application cluster", func() {
+			params := workflow.NewRotateSecretsParameters(request, workflow.Paths{}, "", true)
+			workflow, err := parser.ParseWorkflow("test", RotateSecrets, "RotateSecrets", *params)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(workflow.PrettyPrint()).ShouldNot(gomega.ContainSubstring("SyncCertificate"))
+
+			params.IngressCertificate = "istio-system/ingress-cert"
+			workflow, err = parser.ParseWorkflow("test", RotateSecrets, "RotateSecrets", *params)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(workflow.PrettyPrint()).Should(gomega.ContainSubstring("SyncCertificate istio-system/ingress-cert to nalej"))
 		})
 	})
 })
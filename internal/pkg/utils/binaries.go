@@ -0,0 +1,113 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the selection of the binary matching the host platform in the directories of the asset bundles,
+// which may ship the binaries of several platforms.
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// platformAliases contains the alternative names of the operating systems used by the release bundles.
+var platformAliases = map[string]string{
+	"darwin":  "osx",
+	"windows": "win",
+}
+
+// architectureAliases contains the alternative names of the architectures, as reported by uname or used by the
+// release bundles, such as aarch64 for arm64.
+var architectureAliases = map[string]string{
+	"amd64": "x86_64",
+	"arm64": "aarch64",
+}
+
+// NormalizeArchitecture converts the name of an architecture, such as the machine reported by uname -m or the
+// architecture of a Kubernetes node, into its Go name.
+//   params:
+//     machine The name of the architecture, such as x86_64 or aarch64.
+//   returns:
+//     The Go name of the architecture, such as amd64 or arm64.
+//     Whether the architecture is known.
+func NormalizeArchitecture(machine string) (string, bool) {
+	machine = strings.ToLower(strings.TrimSpace(machine))
+	for goarch, alias := range architectureAliases {
+		if machine == goarch || machine == alias {
+			return goarch, true
+		}
+	}
+	return machine, false
+}
+
+// PlatformBinary looks for the binary of the host platform in a directory. The binaries named after the operating
+// system and architecture, such as istioctl-linux-amd64, rke_linux-arm64, istioctl-osx or darwin-amd64/istioctl, are
+// preferred over the one without platform. The architectures can also be named as reported by uname, such as
+// linux-aarch64.
+//   params:
+//     dir The directory of the binaries.
+//     name The name of the binary, without extension.
+//   returns:
+//     The path of the binary.
+//     Whether a binary has been found.
+func PlatformBinary(dir string, name string) (string, bool) {
+	return platformBinary(dir, name, runtime.GOOS, runtime.GOARCH)
+}
+
+// platformBinary looks for the binary of a given platform in a directory.
+func platformBinary(dir string, name string, goos string, goarch string) (string, bool) {
+	for _, candidate := range platformCandidates(name, goos, goarch) {
+		path := filepath.Join(dir, candidate)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// platformCandidates returns the names the binary of a platform may have, in order of preference.
+func platformCandidates(name string, goos string, goarch string) []string {
+	ext := ""
+	if goos == "windows" {
+		ext = ".exe"
+	}
+	systems := []string{goos}
+	if alias, exists := platformAliases[goos]; exists {
+		systems = append(systems, alias)
+	}
+	archs := []string{goarch}
+	if alias, exists := architectureAliases[goarch]; exists {
+		archs = append(archs, alias)
+	}
+	candidates := make([]string, 0)
+	for _, system := range systems {
+		for _, arch := range archs {
+			candidates = append(candidates,
+				fmt.Sprintf("%s-%s-%s%s", name, system, arch, ext),
+				fmt.Sprintf("%s_%s-%s%s", name, system, arch, ext),
+				filepath.Join(fmt.Sprintf("%s-%s", system, arch), name+ext))
+		}
+	}
+	for _, system := range systems {
+		candidates = append(candidates, fmt.Sprintf("%s-%s%s", name, system, ext))
+	}
+	return append(candidates, name+ext)
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("The platform binary selection", func() {
+
+	var binDir string
+
+	create := func(names ...string) {
+		for _, name := range names {
+			path := filepath.Join(binDir, name)
+			gomega.Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(gomega.Succeed())
+			gomega.Expect(ioutil.WriteFile(path, []byte("binary"), 0755)).To(gomega.Succeed())
+		}
+	}
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		binDir, err = ioutil.TempDir("", "binaries")
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		gomega.Expect(os.RemoveAll(binDir)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should prefer the binary of the host platform", func() {
+		create("istioctl", "istioctl-linux-amd64", "istioctl-osx", "istioctl-win.exe")
+		path, found := platformBinary(binDir, "istioctl", "linux", "amd64")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(path).To(gomega.Equal(filepath.Join(binDir, "istioctl-linux-amd64")))
+		path, found = platformBinary(binDir, "istioctl", "darwin", "amd64")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(path).To(gomega.Equal(filepath.Join(binDir, "istioctl-osx")))
+		path, found = platformBinary(binDir, "istioctl", "windows", "amd64")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(path).To(gomega.Equal(filepath.Join(binDir, "istioctl-win.exe")))
+	})
+
+	ginkgo.It("should look for the binary in the directory of the platform", func() {
+		create("darwin-arm64/istioctl")
+		path, found := platformBinary(binDir, "istioctl", "darwin", "arm64")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(path).To(gomega.Equal(filepath.Join(binDir, "darwin-arm64", "istioctl")))
+	})
+
+	ginkgo.It("should select the arm64 builds named after the release bundles", func() {
+		create("rke_linux-amd64", "rke_linux-arm64", "istioctl-linux-amd64", "istioctl-linux-aarch64")
+		path, found := platformBinary(binDir, "rke", "linux", "arm64")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(path).To(gomega.Equal(filepath.Join(binDir, "rke_linux-arm64")))
+		path, found = platformBinary(binDir, "istioctl", "linux", "arm64")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(path).To(gomega.Equal(filepath.Join(binDir, "istioctl-linux-aarch64")))
+		path, found = platformBinary(binDir, "rke", "linux", "amd64")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(path).To(gomega.Equal(filepath.Join(binDir, "rke_linux-amd64")))
+	})
+
+	ginkgo.It("should normalize the names of the architectures", func() {
+		arch, known := NormalizeArchitecture("x86_64\n")
+		gomega.Expect(known).To(gomega.BeTrue())
+		gomega.Expect(arch).To(gomega.Equal("amd64"))
+		arch, known = NormalizeArchitecture("aarch64")
+		gomega.Expect(known).To(gomega.BeTrue())
+		gomega.Expect(arch).To(gomega.Equal("arm64"))
+		_, known = NormalizeArchitecture("armv7l")
+		gomega.Expect(known).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should fall back to the binary without platform", func() {
+		create("istioctl", "istioctl-linux-amd64")
+		path, found := platformBinary(binDir, "istioctl", "darwin", "amd64")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(path).To(gomega.Equal(filepath.Join(binDir, "istioctl")))
+	})
+
+	ginkgo.It("should not find binaries of other platforms", func() {
+		create("istioctl-linux-amd64")
+		_, found := platformBinary(binDir, "istioctl", "windows", "amd64")
+		gomega.Expect(found).To(gomega.BeFalse())
+	})
+})
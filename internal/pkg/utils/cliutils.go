@@ -20,23 +20,9 @@ package utils
 import (
 	"github.com/nalej/derrors"
 	"io/ioutil"
-	"os/user"
 	"path/filepath"
-	"strings"
 )
 
-func GetPath(path string) string {
-	if strings.HasPrefix(path, "~") {
-		usr, _ := user.Current()
-		return strings.Replace(path, "~", usr.HomeDir, 1)
-	}
-	if strings.HasPrefix(path, ".") {
-		abs, _ := filepath.Abs("./")
-		return strings.Replace(path, ".", abs, 1)
-	}
-	return path
-}
-
 func ExtendComponentsPath(path string, appClusterInstall bool) string {
 	if appClusterInstall {
 		return filepath.Join(path, "appcluster")
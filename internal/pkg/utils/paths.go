@@ -0,0 +1,187 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the expansion of the paths received from the user, so the same flags and configuration files
+// work on Linux, macOS, Windows and WSL.
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// windowsEnvRegex matches the %VAR% references of the Windows shells.
+var windowsEnvRegex = regexp.MustCompile(`%([A-Za-z_][A-Za-z0-9_]*)%`)
+
+// windowsDriveRegex matches the absolute paths of Windows, such as C:\Users.
+var windowsDriveRegex = regexp.MustCompile(`^([A-Za-z]):[\\/]`)
+
+// pathResolver contains the environment used to expand the paths.
+type pathResolver struct {
+	// homeDir returns the home directory of the current user.
+	homeDir func() string
+	// lookupEnv returns the value of an environment variable.
+	lookupEnv func(string) (string, bool)
+	// workingDir returns the current directory.
+	workingDir func() string
+	// executableDir returns the directory of the running binary.
+	executableDir func() string
+	// wsl determines if running on the Windows Subsystem for Linux.
+	wsl bool
+}
+
+var defaultResolver = &pathResolver{
+	homeDir:       homeDir,
+	lookupEnv:     os.LookupEnv,
+	workingDir:    workingDir,
+	executableDir: executableDir,
+	wsl:           isWSL(),
+}
+
+// GetPath expands a path received from the user. Environment variables, both $VAR and %VAR%, are replaced; a leading
+// ~ is replaced by the home directory; and relative paths are resolved against the current directory, or against the
+// directory of the binary if they only exist there. On WSL, Windows paths such as C:\Users are translated into their
+// /mnt/c/Users mount. URLs are returned as they are.
+//   params:
+//     path The path to be expanded.
+//   returns:
+//     The expanded path, with a trailing separator if the original one has it.
+func GetPath(path string) string {
+	return defaultResolver.resolve(path)
+}
+
+func (pr *pathResolver) resolve(path string) string {
+	if path == "" || strings.Contains(path, "://") {
+		return path
+	}
+	trailing := strings.HasSuffix(path, "/") || strings.HasSuffix(path, "\\")
+	path = pr.expandEnv(path)
+	if pr.wsl {
+		path = fromWindowsDrive(path)
+	}
+	path = pr.expandHome(path)
+	path = filepath.FromSlash(path)
+	if !filepath.IsAbs(path) {
+		path = pr.absolute(path)
+	}
+	path = filepath.Clean(path)
+	if trailing && !strings.HasSuffix(path, string(filepath.Separator)) {
+		path = path + string(filepath.Separator)
+	}
+	return path
+}
+
+// expandEnv replaces the references to environment variables, keeping the ones that are not defined.
+func (pr *pathResolver) expandEnv(path string) string {
+	path = os.Expand(path, func(name string) string {
+		if value, found := pr.lookupEnv(name); found {
+			return value
+		}
+		return "${" + name + "}"
+	})
+	return windowsEnvRegex.ReplaceAllStringFunc(path, func(ref string) string {
+		if value, found := pr.lookupEnv(strings.Trim(ref, "%")); found {
+			return value
+		}
+		return ref
+	})
+}
+
+// expandHome replaces a leading ~ by the home directory of the current user.
+func (pr *pathResolver) expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, "~\\") {
+		return path
+	}
+	home := pr.homeDir()
+	if home == "" {
+		return path
+	}
+	return home + path[1:]
+}
+
+// absolute resolves a relative path against the current directory, or the directory of the binary if the path only
+// exists there.
+func (pr *pathResolver) absolute(path string) string {
+	fromWorkingDir := filepath.Join(pr.workingDir(), path)
+	if _, err := os.Stat(fromWorkingDir); err == nil {
+		return fromWorkingDir
+	}
+	if binDir := pr.executableDir(); binDir != "" {
+		fromBinary := filepath.Join(binDir, path)
+		if _, err := os.Stat(fromBinary); err == nil {
+			return fromBinary
+		}
+	}
+	return fromWorkingDir
+}
+
+// fromWindowsDrive translates a Windows path into the path of the drive mounted by WSL.
+func fromWindowsDrive(path string) string {
+	match := windowsDriveRegex.FindStringSubmatch(path)
+	if match == nil {
+		return path
+	}
+	rest := strings.Replace(path[len(match[0]):], "\\", "/", -1)
+	return "/mnt/" + strings.ToLower(match[1]) + "/" + rest
+}
+
+func homeDir() string {
+	if usr, err := user.Current(); err == nil && usr.HomeDir != "" {
+		return usr.HomeDir
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return home
+	}
+	return os.Getenv("USERPROFILE")
+}
+
+func workingDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "."
+	}
+	return dir
+}
+
+func executableDir() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return filepath.Dir(exe)
+}
+
+// isWSL determines if the binary is running on the Windows Subsystem for Linux.
+func isWSL() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	version, err := ioutil.ReadFile("/proc/version")
+	if err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(version)), "microsoft")
+}
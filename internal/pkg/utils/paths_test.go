@@ -0,0 +1,94 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("The path expansion", func() {
+
+	var workDir string
+	var binDir string
+	var resolver *pathResolver
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		workDir, err = ioutil.TempDir("", "workdir")
+		gomega.Expect(err).To(gomega.Succeed())
+		binDir, err = ioutil.TempDir("", "bindir")
+		gomega.Expect(err).To(gomega.Succeed())
+		env := map[string]string{"NALEJ_HOME": "/opt/nalej"}
+		resolver = &pathResolver{
+			homeDir: func() string { return "/home/nalej" },
+			lookupEnv: func(name string) (string, bool) {
+				value, found := env[name]
+				return value, found
+			},
+			workingDir:    func() string { return workDir },
+			executableDir: func() string { return binDir },
+		}
+	})
+
+	ginkgo.AfterEach(func() {
+		os.RemoveAll(workDir)
+		os.RemoveAll(binDir)
+	})
+
+	ginkgo.It("should keep empty paths and URLs", func() {
+		gomega.Expect(resolver.resolve("")).To(gomega.Equal(""))
+		gomega.Expect(resolver.resolve("https://nalej.com/components.tgz")).To(gomega.Equal("https://nalej.com/components.tgz"))
+		gomega.Expect(resolver.resolve("oci://registry/components:v1")).To(gomega.Equal("oci://registry/components:v1"))
+	})
+
+	ginkgo.It("should expand the home directory", func() {
+		gomega.Expect(resolver.resolve("~")).To(gomega.Equal(filepath.FromSlash("/home/nalej")))
+		gomega.Expect(resolver.resolve("~/.kube/config")).To(gomega.Equal(filepath.FromSlash("/home/nalej/.kube/config")))
+	})
+
+	ginkgo.It("should expand the environment variables", func() {
+		gomega.Expect(resolver.resolve("$NALEJ_HOME/assets/")).To(gomega.Equal(filepath.FromSlash("/opt/nalej/assets/")))
+		gomega.Expect(resolver.resolve("${NALEJ_HOME}/bin")).To(gomega.Equal(filepath.FromSlash("/opt/nalej/bin")))
+		gomega.Expect(resolver.resolve("%NALEJ_HOME%/conf")).To(gomega.Equal(filepath.FromSlash("/opt/nalej/conf")))
+		gomega.Expect(resolver.resolve("/tmp/%MISSING%")).To(gomega.Equal(filepath.FromSlash("/tmp/%MISSING%")))
+	})
+
+	ginkgo.It("should resolve relative paths against the current directory", func() {
+		gomega.Expect(resolver.resolve("./temp/")).To(gomega.Equal(filepath.Join(workDir, "temp") + string(filepath.Separator)))
+		gomega.Expect(resolver.resolve("assets")).To(gomega.Equal(filepath.Join(workDir, "assets")))
+	})
+
+	ginkgo.It("should resolve relative paths against the binary if they only exist there", func() {
+		gomega.Expect(os.Mkdir(filepath.Join(binDir, "assets"), 0700)).To(gomega.Succeed())
+		gomega.Expect(resolver.resolve("./assets")).To(gomega.Equal(filepath.Join(binDir, "assets")))
+
+		gomega.Expect(os.Mkdir(filepath.Join(workDir, "assets"), 0700)).To(gomega.Succeed())
+		gomega.Expect(resolver.resolve("./assets")).To(gomega.Equal(filepath.Join(workDir, "assets")))
+	})
+
+	ginkgo.It("should translate Windows paths on WSL", func() {
+		gomega.Expect(fromWindowsDrive(`C:\Users\nalej\kubeconfig`)).To(gomega.Equal("/mnt/c/Users/nalej/kubeconfig"))
+		gomega.Expect(fromWindowsDrive("D:/assets")).To(gomega.Equal("/mnt/d/assets"))
+		gomega.Expect(fromWindowsDrive("/home/nalej")).To(gomega.Equal("/home/nalej"))
+	})
+})
@@ -0,0 +1,308 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+)
+
+// Shortcuts to define the accesses of the commands.
+var (
+	read   = k8s.ReadVerbs
+	create = k8s.CreateVerbs
+	update = k8s.UpdateVerbs
+	remove = k8s.DeleteVerbs
+	patch  = k8s.PatchVerbs
+)
+
+// ingressAccess contains the accesses of the commands exposing services outside the cluster.
+var ingressAccess = []k8s.ObjectAccess{
+	k8s.Access("", "namespaces", create),
+	k8s.Access("", "services", create),
+}
+
+// secretAccess contains the accesses of the commands creating secrets on the nalej namespace.
+var secretAccess = []k8s.ObjectAccess{
+	k8s.Access("", "namespaces", create),
+	k8s.Access("", "secrets", create),
+}
+
+// istioAccess contains the accesses of the commands installing the Istio control plane with istioctl.
+var istioAccess = []k8s.ObjectAccess{
+	k8s.Access("", "namespaces", create),
+	k8s.Access("", "secrets", create),
+	k8s.Access("", "services", create),
+	k8s.Access("", "serviceaccounts", create),
+	k8s.Access("", "configmaps", create, update),
+	k8s.Access("", "endpoints", create),
+	k8s.Access("apps", "deployments", create, update),
+	k8s.Access("autoscaling", "horizontalpodautoscalers", create),
+	k8s.Access("policy", "poddisruptionbudgets", create),
+	k8s.Access("apiextensions.k8s.io", "customresourcedefinitions", create, update),
+	k8s.Access("admissionregistration.k8s.io", "mutatingwebhookconfigurations", create, update),
+	k8s.Access("admissionregistration.k8s.io", "validatingwebhookconfigurations", create, update),
+	k8s.Access("rbac.authorization.k8s.io", "clusterroles", create),
+	k8s.Access("rbac.authorization.k8s.io", "clusterrolebindings", create),
+	k8s.Access("rbac.authorization.k8s.io", "roles", create),
+	k8s.Access("rbac.authorization.k8s.io", "rolebindings", create),
+	k8s.Access("networking.istio.io", "*", create, update, []string{"patch"}),
+	k8s.Access("security.istio.io", "*", create),
+	k8s.Access("install.istio.io", "*", create),
+}
+
+// SyncAccess contains the accesses to the Kubernetes API performed by the synchronous commands. Commands that are
+// not included do not access the Kubernetes API through the installer credentials, and commands whose accesses
+// depend on their parameters are resolved by RequiredAccess.
+var SyncAccess = map[string][]k8s.ObjectAccess{
+	entities.CreateClusterConfig: {
+		k8s.Access("", "namespaces", create),
+		k8s.Access("", "configmaps", create),
+	},
+	entities.CreateManagementConfig: {
+		k8s.Access("", "namespaces", create),
+		k8s.Access("", "configmaps", create),
+		k8s.Access("", "secrets", create),
+	},
+	entities.UpdateCoreDNS: {k8s.Access("", "configmaps", update)},
+	entities.UpdateKubeDNS: {k8s.Access("", "configmaps", update)},
+	entities.CreateRegistrySecrets: {
+		k8s.Access("", "namespaces", create),
+		k8s.Access("", "secrets", create, update),
+		k8s.Access("", "serviceaccounts", create, update),
+	},
+	entities.AddClusterUser: secretAccess,
+	entities.RegisterAppCluster: {
+		k8s.Access("", "namespaces", create),
+		k8s.Access("", "services", read),
+		k8s.Access("", "secrets", create, update),
+	},
+	entities.CreateOpaqueSecret: secretAccess,
+	entities.RotateSecret:       {k8s.Access("", "secrets", create, update)},
+	entities.SyncCertificate: {
+		k8s.Access("", "namespaces", create),
+		k8s.Access("", "secrets", read, create, update),
+	},
+	entities.CheckCertificates:  {k8s.Access("", "secrets", read, update)},
+	entities.RestartDeployments: {k8s.Access("apps", "deployments", read, update)},
+	entities.CreateCACert:       secretAccess,
+	entities.CreateTLSSecret:    secretAccess,
+	entities.CreateInternalCA: {
+		k8s.Access("", "namespaces", create),
+		k8s.Access("", "secrets", read, create, update),
+		k8s.Access("", "configmaps", create, update),
+		k8s.Access("certmanager.k8s.io", "clusterissuers", create, update),
+	},
+	entities.InstallIngress: {
+		k8s.Access("", "namespaces", create),
+		k8s.Access("", "serviceaccounts", create),
+		k8s.Access("", "configmaps", create),
+		k8s.Access("", "services", create),
+		k8s.Access("apps", "deployments", create),
+		k8s.Access("extensions", "ingresses", create),
+		k8s.Access("networking.k8s.io", "ingresses", create),
+		k8s.Access("rbac.authorization.k8s.io", "clusterroles", create),
+		k8s.Access("rbac.authorization.k8s.io", "clusterrolebindings", create),
+		k8s.Access("rbac.authorization.k8s.io", "roles", create),
+		k8s.Access("rbac.authorization.k8s.io", "rolebindings", create),
+		// Traefik is installed with its custom resources.
+		k8s.Access("apiextensions.k8s.io", "customresourcedefinitions", create),
+		k8s.Access(k8s.TraefikGroup, "middlewares", create),
+		k8s.Access(k8s.TraefikGroup, "tlsoptions", create),
+	},
+	entities.InstallMngtDNS:     ingressAccess,
+	entities.InstallZtPlanetLB:  ingressAccess,
+	entities.InstallVpnServerLB: ingressAccess,
+	entities.InstallExtDNS:      ingressAccess,
+	entities.DeleteNamespace:    {k8s.Access("", "namespaces", remove)},
+	entities.DeleteNalejNamespace: {
+		k8s.Access("", "namespaces", read),
+		k8s.Access("", "services", remove),
+		k8s.Access("", "configmaps", remove),
+		k8s.Access("", "serviceaccounts", remove),
+		k8s.Access("", "secrets", remove),
+		k8s.Access("", "persistentvolumeclaims", remove),
+		k8s.Access("", "events", remove),
+		k8s.Access("apps", "deployments", remove),
+		k8s.Access("apps", "daemonsets", remove),
+		k8s.Access("apps", "statefulsets", remove),
+		k8s.Access("extensions", "ingresses", remove),
+		k8s.Access("rbac.authorization.k8s.io", "roles", remove),
+		k8s.Access("rbac.authorization.k8s.io", "rolebindings", remove),
+		k8s.Access("apiextensions.k8s.io", "customresourcedefinitions", remove),
+		k8s.Access("monitoring.coreos.com", "servicemonitors", remove),
+		k8s.Access("monitoring.coreos.com", "alertmanagers", remove),
+		k8s.Access("monitoring.coreos.com", "podmonitors", remove),
+		k8s.Access("monitoring.coreos.com", "prometheuses", remove),
+		k8s.Access("monitoring.coreos.com", "prometheusrules", remove),
+	},
+	entities.DeleteServiceAccount:     {k8s.Access("", "serviceaccounts", remove)},
+	entities.DeleteClusterRoleBinding: {k8s.Access("rbac.authorization.k8s.io", "clusterrolebindings", remove)},
+	entities.DeleteClusterRole:        {k8s.Access("rbac.authorization.k8s.io", "clusterroles", remove)},
+	entities.DeleteRole:               {k8s.Access("rbac.authorization.k8s.io", "roles", remove)},
+	entities.DeleteRoleBinding:        {k8s.Access("rbac.authorization.k8s.io", "rolebindings", remove)},
+	entities.DeleteConfigMap:          {k8s.Access("", "configmaps", remove)},
+	entities.DeleteService:            {k8s.Access("", "services", remove)},
+	entities.DeleteDeployment:         {k8s.Access("apps", "deployments", remove)},
+	entities.DeletePodSecurityPolicy: {
+		k8s.Access("policy", "podsecuritypolicies", remove),
+		k8s.Access("extensions", "podsecuritypolicies", remove),
+	},
+	entities.InstallNetworkPolicies: {
+		k8s.Access("", "namespaces", create, update),
+		k8s.Access("", "services", read),
+		k8s.Access("networking.k8s.io", "networkpolicies", create),
+	},
+	entities.WaitDeploymentReady:   {k8s.Access("apps", "deployments", read)},
+	entities.CreateVPNServerConfig: secretAccess,
+	entities.InstallVPNServer: {
+		k8s.Access("", "persistentvolumeclaims", create),
+		k8s.Access("apps", "deployments", create),
+	},
+	entities.InstallZTPlanet: {
+		k8s.Access("", "secrets", read),
+		k8s.Access("", "persistentvolumeclaims", create),
+		k8s.Access("apps", "deployments", create),
+	},
+	entities.CreateZTPlanetFiles: {k8s.Access("", "secrets", create)},
+	entities.ExposeService:       {k8s.Access("", "services", create)},
+	entities.InstallExternalDNS: {
+		k8s.Access("", "namespaces", create),
+		k8s.Access("", "serviceaccounts", create),
+		k8s.Access("", "secrets", create, remove),
+		k8s.Access("apps", "deployments", create, remove),
+		k8s.Access("rbac.authorization.k8s.io", "clusterroles", create),
+		k8s.Access("rbac.authorization.k8s.io", "clusterrolebindings", create),
+	},
+	// The objects of the stack are applied, so they are patched on later installs.
+	entities.InstallObservability: {
+		k8s.Access("", "namespaces", create),
+		k8s.Access("", "secrets", create),
+		k8s.Access("", "serviceaccounts", create, patch),
+		k8s.Access("", "configmaps", create, patch),
+		k8s.Access("", "services", create, patch),
+		k8s.Access("apps", "deployments", create, patch),
+		k8s.Access("extensions", "ingresses", create, patch),
+		k8s.Access("rbac.authorization.k8s.io", "clusterroles", create, patch),
+		k8s.Access("rbac.authorization.k8s.io", "clusterrolebindings", create, patch),
+	},
+	entities.InstallLoggingStack: {
+		k8s.Access("", "namespaces", create),
+		k8s.Access("", "serviceaccounts", create, patch),
+		k8s.Access("", "configmaps", create, patch),
+		k8s.Access("", "services", create, patch),
+		k8s.Access("", "persistentvolumeclaims", create, patch),
+		k8s.Access("apps", "deployments", create, patch),
+		k8s.Access("apps", "daemonsets", create, patch),
+		k8s.Access("batch", "jobs", create, patch),
+		k8s.Access("rbac.authorization.k8s.io", "clusterroles", create, patch),
+		k8s.Access("rbac.authorization.k8s.io", "clusterrolebindings", create, patch),
+	},
+	// istioctl installs the control plane with its own CRDs, webhooks and roles.
+	entities.InstallIstio: istioAccess,
+	// The previous control plane is removed once the namespaces are migrated to the new revision.
+	entities.UpgradeIstio: append([]k8s.ObjectAccess{
+		k8s.Access("", "namespaces", read, update),
+		k8s.Access("apps", "deployments", read, update, remove),
+		k8s.Access("", "services", remove),
+		k8s.Access("", "serviceaccounts", remove),
+		k8s.Access("", "configmaps", remove),
+		k8s.Access("autoscaling", "horizontalpodautoscalers", remove),
+		k8s.Access("policy", "poddisruptionbudgets", remove),
+		k8s.Access("admissionregistration.k8s.io", "mutatingwebhookconfigurations", remove),
+		k8s.Access("admissionregistration.k8s.io", "validatingwebhookconfigurations", remove),
+		k8s.Access("rbac.authorization.k8s.io", "clusterroles", remove),
+		k8s.Access("rbac.authorization.k8s.io", "clusterrolebindings", remove),
+		k8s.Access("rbac.authorization.k8s.io", "roles", remove),
+		k8s.Access("rbac.authorization.k8s.io", "rolebindings", remove),
+	}, istioAccess...),
+	entities.ConfigureSidecarInjection: {k8s.Access("", "namespaces", create, update)},
+	entities.VerifyIstio: {
+		k8s.Access("admissionregistration.k8s.io", "mutatingwebhookconfigurations", read),
+		k8s.Access("admissionregistration.k8s.io", "validatingwebhookconfigurations", read),
+		k8s.Access("apps", "deployments", read),
+		k8s.Access("", "services", read),
+		k8s.Access("authentication.istio.io", "meshpolicies", read),
+		k8s.Access("security.istio.io", "peerauthentications", read),
+	},
+}
+
+// RequiredAccess returns the accesses to the Kubernetes API performed by a list of commands, including the ones
+// contained in groups, parallel and try commands.
+//
+//	params:
+//	  commands The list of commands.
+//	returns:
+//	  The list of accesses.
+//	  An error if the accesses of a command cannot be determined.
+func RequiredAccess(commands ...entities.Command) ([]k8s.ObjectAccess, derrors.Error) {
+	result := make([]k8s.ObjectAccess, 0)
+	for _, cmd := range commands {
+		if cmd == nil {
+			continue
+		}
+		var accesses []k8s.ObjectAccess
+		var err derrors.Error
+		switch c := cmd.(type) {
+		case *Group:
+			accesses, err = RequiredAccess(c.Commands...)
+		case *Parallel:
+			accesses, err = RequiredAccess(c.Commands...)
+		case *Try:
+			accesses, err = RequiredAccess(c.TryCommand, c.OnFailCommand)
+		case *k8s.LaunchComponents:
+			accesses, err = c.RequiredAccess()
+		case *k8s.WaitFor:
+			accesses, err = c.RequiredAccess()
+		case *k8s.CreateManagementConfig:
+			accesses, err = secretStoreAccess(SyncAccess[entities.CreateManagementConfig], c.SecretStorePath)
+		case *k8s.CreateRegistrySecrets:
+			accesses, err = secretStoreAccess(SyncAccess[entities.CreateRegistrySecrets], c.SecretStorePath)
+		case *deferredSyncCommand:
+			accesses, err = RequiredAccess(c.Command)
+		case *faultySyncCommand:
+			accesses, err = RequiredAccess(c.Command)
+		case *faultyAsyncCommand:
+			accesses, err = RequiredAccess(c.Command)
+		default:
+			if cmd.Type() == entities.SyncCommandType {
+				accesses = SyncAccess[cmd.Name()]
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, accesses...)
+	}
+	return result, nil
+}
+
+// secretStoreAccess adds the access to the references of the external secret store to the accesses of a command
+// creating secrets, if the store is set.
+func secretStoreAccess(accesses []k8s.ObjectAccess, secretStorePath string) ([]k8s.ObjectAccess, derrors.Error) {
+	if secretStorePath == "" {
+		return accesses, nil
+	}
+	config, err := k8s.LoadSecretStoreConfig(secretStorePath)
+	if err != nil {
+		return nil, err
+	}
+	result := append([]k8s.ObjectAccess{}, accesses...)
+	return append(result, config.ReferenceAccess()), nil
+}
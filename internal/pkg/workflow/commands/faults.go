@@ -0,0 +1,204 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+// This file contains the fault injection facilities used to exercise the failure handling of the workflows, such as
+// the Try command, without a real cluster. Faults are only injected once a FaultInjector is set, which is expected
+// to be done by tests only.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+)
+
+// FaultRule defines the failures injected into the commands with a given name.
+type FaultRule struct {
+	// CommandName of the commands that fail.
+	CommandName string `json:"command"`
+	// Failures is the number of executions of each command that fail before it is executed normally. If zero, the
+	// command always fails.
+	Failures int `json:"failures"`
+}
+
+// ParseFaultRules parses a comma separated list of rules with the name of a command and optionally the number of
+// failures separated by a colon, such as "createRegistrySecrets:1,launchComponents".
+//   params:
+//     spec The rules.
+//   returns:
+//     The parsed rules.
+//     An error if the number of failures of a rule is not valid.
+func ParseFaultRules(spec string) ([]FaultRule, derrors.Error) {
+	rules := make([]FaultRule, 0)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		rule := FaultRule{CommandName: entry}
+		if index := strings.Index(entry, ":"); index >= 0 {
+			failures, err := strconv.Atoi(entry[index+1:])
+			if err != nil || failures < 0 {
+				return nil, derrors.NewInvalidArgumentError("invalid number of failures in fault rule", err).WithParams(entry)
+			}
+			rule = FaultRule{CommandName: entry[:index], Failures: failures}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// FaultInjector wraps the commands matching its rules so their executions fail.
+type FaultInjector struct {
+	rules map[string]FaultRule
+	sync.Mutex
+	// injected contains the number of failures injected per command identifier.
+	injected map[string]int
+	// injectedByName contains the number of failures injected per command name.
+	injectedByName map[string]int
+}
+
+// NewFaultInjector creates a FaultInjector with a set of rules.
+func NewFaultInjector(rules ...FaultRule) *FaultInjector {
+	byName := make(map[string]FaultRule, len(rules))
+	for _, rule := range rules {
+		byName[rule.CommandName] = rule
+	}
+	return &FaultInjector{rules: byName, injected: make(map[string]int, 0), injectedByName: make(map[string]int, 0)}
+}
+
+// Wrap returns a command that fails as defined by the rules, or the command itself if no rule matches its name.
+func (fi *FaultInjector) Wrap(cmd entities.Command) entities.Command {
+	if _, found := fi.rules[cmd.Name()]; !found {
+		return cmd
+	}
+	if cmd.Type() == entities.SyncCommandType {
+		if syncCmd, ok := cmd.(entities.SyncCommand); ok {
+			return &faultySyncCommand{cmd, syncCmd, fi}
+		}
+	} else if asyncCmd, ok := cmd.(entities.AsyncCommand); ok {
+		return &faultyAsyncCommand{cmd, asyncCmd, fi}
+	}
+	return cmd
+}
+
+// Injected returns the number of failures injected into the commands with a given name.
+func (fi *FaultInjector) Injected(commandName string) int {
+	fi.Lock()
+	defer fi.Unlock()
+	return fi.injectedByName[commandName]
+}
+
+// shouldFail determines if the next execution of a command fails, registering the injected failure.
+func (fi *FaultInjector) shouldFail(cmd entities.Command) bool {
+	rule, found := fi.rules[cmd.Name()]
+	if !found {
+		return false
+	}
+	fi.Lock()
+	defer fi.Unlock()
+	if rule.Failures > 0 && fi.injected[cmd.ID()] >= rule.Failures {
+		return false
+	}
+	fi.injected[cmd.ID()]++
+	fi.injectedByName[cmd.Name()]++
+	log.Warn().Str("cmdID", cmd.ID()).Int("failure", fi.injected[cmd.ID()]).Msg("injecting command failure")
+	return true
+}
+
+// injectedError returns the error of a failed execution.
+func injectedError(cmd entities.Command) derrors.Error {
+	return derrors.NewGenericError("injected failure").WithParams(cmd.Name(), cmd.ID())
+}
+
+// faultySyncCommand wraps a sync command injecting failures.
+type faultySyncCommand struct {
+	entities.Command
+	wrapped  entities.SyncCommand
+	injector *FaultInjector
+}
+
+// Run fails if a failure is injected, or runs the wrapped command otherwise.
+func (fsc *faultySyncCommand) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	if fsc.injector.shouldFail(fsc.Command) {
+		return entities.NewErrCommand(fmt.Sprintf("injected failure on %s", fsc.Name()), injectedError(fsc.Command)), nil
+	}
+	return fsc.wrapped.Run(workflowID)
+}
+
+// SetParameters provides the workflow parameters to the wrapped command.
+func (fsc *faultySyncCommand) SetParameters(params map[string]string) {
+	setParameters(fsc.Command, params)
+}
+
+// MarshalJSON marshals the wrapped command.
+func (fsc *faultySyncCommand) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fsc.Command)
+}
+
+// faultyAsyncCommand wraps an async command injecting failures.
+type faultyAsyncCommand struct {
+	entities.Command
+	wrapped  entities.AsyncCommand
+	injector *FaultInjector
+}
+
+// Actions returns the actions of the wrapped command.
+func (fac *faultyAsyncCommand) Actions() []entities.Action {
+	return fac.wrapped.Actions()
+}
+
+// Run fails if a failure is injected, or launches the wrapped command otherwise.
+func (fac *faultyAsyncCommand) Run(workflowID string) derrors.Error {
+	if fac.injector.shouldFail(fac.Command) {
+		return injectedError(fac.Command)
+	}
+	return fac.wrapped.Run(workflowID)
+}
+
+// MarshalJSON marshals the wrapped command.
+func (fac *faultyAsyncCommand) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fac.Command)
+}
+
+var faultInjector *FaultInjector
+var faultInjectorLock sync.RWMutex
+
+// SetFaultInjector sets the injector wrapping the commands parsed from now on, including those nested in groups,
+// parallel and try commands. Setting nil disables the injection.
+func SetFaultInjector(injector *FaultInjector) {
+	faultInjectorLock.Lock()
+	defer faultInjectorLock.Unlock()
+	faultInjector = injector
+}
+
+// injectFaults wraps a parsed command with the current fault injector, if any.
+func injectFaults(cmd *entities.Command) *entities.Command {
+	faultInjectorLock.RLock()
+	defer faultInjectorLock.RUnlock()
+	if faultInjector == nil {
+		return cmd
+	}
+	wrapped := faultInjector.Wrap(*cmd)
+	return &wrapped
+}
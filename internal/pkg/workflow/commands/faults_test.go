@@ -0,0 +1,109 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package commands
+
+import (
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Fault injection", func() {
+
+	ginkgo.AfterEach(func() {
+		SetFaultInjector(nil)
+	})
+
+	ginkgo.Context("parsing rules", func() {
+		ginkgo.It("must support rules with and without failures", func() {
+			rules, err := ParseFaultRules("createRegistrySecrets:1, launchComponents")
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rules).To(gomega.Equal([]FaultRule{
+				{CommandName: "createRegistrySecrets", Failures: 1},
+				{CommandName: "launchComponents", Failures: 0},
+			}))
+		})
+		ginkgo.It("must reject invalid failures", func() {
+			_, err := ParseFaultRules("launchComponents:once")
+			gomega.Expect(err).NotTo(gomega.BeNil())
+		})
+	})
+
+	ginkgo.Context("with SYNC commands", func() {
+		ginkgo.It("must fail each command the given number of times", func() {
+			injector := NewFaultInjector(FaultRule{CommandName: entities.Sleep, Failures: 1})
+			SetFaultInjector(injector)
+			fromJSON := `
+{"type":"sync", "name": "try", "description":"Try",
+"cmd": {"type":"sync", "name": "sleep", "time": "0"},
+"onFail": {"type":"sync", "name": "logger", "msg": "recovered"}}
+`
+			received, err := NewCmdParser().ParseCommand([]byte(fromJSON))
+			gomega.Expect(err).To(gomega.BeNil())
+			try := (*received).(*Try)
+
+			result, err := try.Run("testWorkflow")
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			gomega.Expect(result.Output).To(gomega.Equal("recovered"))
+			gomega.Expect(injector.Injected(entities.Sleep)).To(gomega.Equal(1))
+
+			result, err = try.Run("testWorkflow")
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			gomega.Expect(result.Output).NotTo(gomega.Equal("recovered"))
+			gomega.Expect(injector.Injected(entities.Sleep)).To(gomega.Equal(1))
+		})
+		ginkgo.It("must always fail without a number of failures", func() {
+			injector := NewFaultInjector(FaultRule{CommandName: entities.Logger})
+			SetFaultInjector(injector)
+			received, err := NewCmdParser().ParseCommand([]byte(`{"type":"sync", "name": "logger", "msg": "msg"}`))
+			gomega.Expect(err).To(gomega.BeNil())
+			for i := 0; i < 3; i++ {
+				result, err := (*received).(entities.SyncCommand).Run("testWorkflow")
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(result.Success).To(gomega.BeFalse())
+			}
+			gomega.Expect(injector.Injected(entities.Logger)).To(gomega.Equal(3))
+		})
+	})
+
+	ginkgo.Context("with ASYNC commands", func() {
+		ginkgo.It("must fail the launch of the command", func() {
+			SetFaultInjector(NewFaultInjector(FaultRule{CommandName: entities.Sleep, Failures: 1}))
+			fromJSON := `
+{"type":"sync", "name": "try", "description":"Try",
+"cmd": {"type":"async", "name": "sleep", "time": "0"},
+"onFail": {"type":"sync", "name": "logger", "msg": "recovered"}}
+`
+			received, err := NewCmdParser().ParseCommand([]byte(fromJSON))
+			gomega.Expect(err).To(gomega.BeNil())
+			result, err := (*received).(*Try).Run("testWorkflow")
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			gomega.Expect(result.Output).To(gomega.Equal("recovered"))
+		})
+	})
+
+	ginkgo.It("must not wrap commands without rules", func() {
+		SetFaultInjector(NewFaultInjector(FaultRule{CommandName: entities.Sleep}))
+		received, err := NewCmdParser().ParseCommand([]byte(`{"type":"sync", "name": "logger", "msg": "msg"}`))
+		gomega.Expect(err).To(gomega.BeNil())
+		_, isFaulty := (*received).(*faultySyncCommand)
+		gomega.Expect(isFaulty).To(gomega.BeFalse())
+	})
+})
@@ -46,6 +46,8 @@ type Group struct {
 	executionErrors    map[string]derrors.Error
 	asyncFinishChannel chan string
 	asyncCmdID         string
+	// parameters contains the workflow parameters available to the commands of the group.
+	parameters map[string]string
 }
 
 // GroupFromJSON structure with helper RawMessage to parse
@@ -78,7 +80,12 @@ func NewGroup(description string, cmds []entities.Command) *Group {
 		handler.GetCommandHandler(),
 		make(map[string]entities.CommandResult),
 		make(map[string]derrors.Error),
-		make(chan string), ""}
+		make(chan string), "", make(map[string]string, 0)}
+}
+
+// SetParameters provides the workflow parameters available when the group is launched.
+func (g *Group) SetParameters(params map[string]string) {
+	g.parameters = params
 }
 
 // NewGroupFromJSON creates a new command from a raw json payload.
@@ -108,7 +115,10 @@ func (g *Group) Run(workflowID string) (*entities.CommandResult, derrors.Error)
 	g.commandHandler.AddLogEntry(g.CommandID, fmt.Sprintf("Starting sequential group execution of %d commands", len(g.Commands)))
 	log.Info().Str("groupCmdId", g.CommandID).Str("description", g.Description).Msg("Executing sequential group")
 	results := make([]entities.CommandResult, 0)
+	parameters := copyParameters(g.parameters)
+	outputs := make(map[string]string, 0)
 	for _, nextCommand := range g.Commands {
+		setParameters(nextCommand, copyParameters(parameters))
 		result, err := g.executeCommand(workflowID, nextCommand)
 		if err != nil {
 			return nil, err
@@ -120,6 +130,9 @@ func (g *Group) Run(workflowID string) (*entities.CommandResult, derrors.Error)
 			if !result.Success {
 				break
 			}
+			// Outputs are available to the following commands of the group and to the ones after the group.
+			mergeOutputs(parameters, result)
+			mergeOutputs(outputs, result)
 		} else {
 			log.Warn().Str("groupCmdId", g.CommandID).Str("cmd", nextCommand.String()).Msg("Empty result returned")
 		}
@@ -141,7 +154,7 @@ func (g *Group) Run(workflowID string) (*entities.CommandResult, derrors.Error)
 	overallOutputString := overallOutput.String()
 	log.Debug().Str("groupCmdId", g.CommandID).Bool("success", overallSuccess).Str("outputString", overallOutputString).Msg("Group result")
 	if overallSuccess {
-		return entities.NewCommandResultNoShow(overallSuccess, overallOutputString, nil), nil
+		return entities.NewCommandResultNoShow(overallSuccess, overallOutputString, nil).WithOutputs(outputs), nil
 	}
 	log.Debug().Str("groupCmdId", g.CommandID).Str("err", overallError.DebugReport()).Msg("Group execution failed")
 	return entities.NewCommandResult(overallSuccess, overallOutputString, overallError), nil
@@ -0,0 +1,109 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the support for the commands referencing the outputs of previous commands. Their definition
+// is parsed again once the references are resolved with the workflow parameters available when they are launched.
+
+package commands
+
+import (
+	"encoding/json"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+)
+
+// deferredSyncCommand wraps a sync command whose definition references the outputs of previous commands.
+type deferredSyncCommand struct {
+	// Command parsed with the unresolved references, used to describe the command until it is launched.
+	entities.Command
+	parser     *CmdParser
+	raw        []byte
+	parameters map[string]string
+}
+
+// deferOutputReferences wraps the sync commands referencing the outputs of previous commands. Groups, parallel
+// and try commands are not wrapped as their nested commands are.
+func (cp *CmdParser) deferOutputReferences(cmd *entities.Command, raw []byte) (*entities.Command, derrors.Error) {
+	if !entities.HasOutputReferences(raw) {
+		return cmd, nil
+	}
+	switch (*cmd).Name() {
+	case entities.GroupCmd, entities.ParallelCmd, entities.TryCmd:
+		return cmd, nil
+	}
+	if (*cmd).Type() != entities.SyncCommandType {
+		return nil, derrors.NewInvalidArgumentError(errors.OutputReferenceNotSupported).WithParams((*cmd).Name())
+	}
+	var deferred entities.Command = &deferredSyncCommand{Command: *cmd, parser: cp, raw: raw}
+	return &deferred, nil
+}
+
+// SetParameters provides the workflow parameters available when the command is launched.
+func (dsc *deferredSyncCommand) SetParameters(params map[string]string) {
+	dsc.parameters = params
+}
+
+// Run resolves the output references and runs the resulting command.
+func (dsc *deferredSyncCommand) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	resolved, err := entities.ResolveOutputs(dsc.raw, dsc.parameters)
+	if err != nil {
+		return nil, err
+	}
+	var generic entities.GenericCommand
+	if err := json.Unmarshal(resolved, &generic); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	cmd, err := dsc.parser.parseCommand(generic, resolved)
+	if err != nil {
+		return nil, err
+	}
+	setParameters(*cmd, dsc.parameters)
+	return (*cmd).(entities.SyncCommand).Run(workflowID)
+}
+
+// MarshalJSON marshals the command with the unresolved references.
+func (dsc *deferredSyncCommand) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dsc.Command)
+}
+
+// setParameters provides the workflow parameters to a command if it reads them.
+func setParameters(cmd entities.Command, params map[string]string) {
+	if reader, ok := cmd.(entities.ParameterReader); ok {
+		reader.SetParameters(params)
+	}
+}
+
+// copyParameters returns a copy of a set of workflow parameters.
+func copyParameters(params map[string]string) map[string]string {
+	result := make(map[string]string, len(params))
+	for key, value := range params {
+		result[key] = value
+	}
+	return result
+}
+
+// mergeOutputs adds the outputs of a command result to a set of workflow parameters.
+func mergeOutputs(params map[string]string, result *entities.CommandResult) {
+	if result == nil {
+		return
+	}
+	for key, value := range result.Outputs {
+		params[key] = value
+	}
+}
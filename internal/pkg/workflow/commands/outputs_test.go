@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// outputLogger is a logger command setting a set of outputs.
+type outputLogger struct {
+	*sync.Logger
+	outputs map[string]string
+}
+
+// Run returns the message and the outputs of the command.
+func (ol *outputLogger) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	result, err := ol.Logger.Run(workflowID)
+	if err != nil {
+		return nil, err
+	}
+	return result.WithOutputs(ol.outputs), nil
+}
+
+var _ = ginkgo.Describe("Output references", func() {
+
+	parser := NewCmdParser()
+
+	ginkgo.It("must defer the commands referencing outputs", func() {
+		cmd, err := parser.ParseCommand([]byte(`{"type":"sync", "name":"logger", "msg":"gateway $(output:istio.gatewayIP)"}`))
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(*cmd).To(gomega.BeAssignableToTypeOf(&deferredSyncCommand{}))
+		gomega.Expect((*cmd).Name()).To(gomega.Equal(entities.Logger))
+
+		setParameters(*cmd, map[string]string{"istio.gatewayIP": "10.0.0.1"})
+		result, err := (*cmd).(entities.SyncCommand).Run("w1")
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(result.Output).To(gomega.Equal("gateway 10.0.0.1"))
+	})
+
+	ginkgo.It("must fail if the output has not been set", func() {
+		cmd, err := parser.ParseCommand([]byte(`{"type":"sync", "name":"logger", "msg":"$(output:missing)"}`))
+		gomega.Expect(err).To(gomega.BeNil())
+		_, err = (*cmd).(entities.SyncCommand).Run("w1")
+		gomega.Expect(err).ToNot(gomega.BeNil())
+	})
+
+	ginkgo.It("must reject references on async commands", func() {
+		_, err := parser.ParseCommand([]byte(`{"type":"async", "name":"sleep", "time":"$(output:duration)"}`))
+		gomega.Expect(err).ToNot(gomega.BeNil())
+	})
+
+	ginkgo.It("must pass the outputs between the commands of a group", func() {
+		producer := &outputLogger{sync.NewLogger("producer"), map[string]string{"istio.gatewayIP": "10.0.0.1"}}
+		consumer, err := parser.ParseCommand([]byte(`{"type":"sync", "name":"logger", "msg":"gateway $(output:istio.gatewayIP)"}`))
+		gomega.Expect(err).To(gomega.BeNil())
+		g := NewGroup("outputs", []entities.Command{producer, *consumer})
+		result, err := g.Run("w1")
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(result.Output).To(gomega.ContainSubstring("gateway 10.0.0.1"))
+		gomega.Expect(result.Outputs).To(gomega.HaveKeyWithValue("istio.gatewayIP", "10.0.0.1"))
+	})
+
+	ginkgo.It("must pass the workflow parameters to the commands of a try", func() {
+		consumer, err := parser.ParseCommand([]byte(`{"type":"sync", "name":"logger", "msg":"zone $(output:zone)"}`))
+		gomega.Expect(err).To(gomega.BeNil())
+		try := NewTry("outputs", *consumer, sync.NewLogger("fallback"))
+		try.SetParameters(map[string]string{"zone": "eu"})
+		result, err := try.Run("w1")
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(result.Output).To(gomega.Equal("zone eu"))
+	})
+})
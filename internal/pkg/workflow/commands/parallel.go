@@ -47,6 +47,8 @@ type Parallel struct {
 	commandResults  map[string]entities.CommandResult
 	executionErrors map[string]derrors.Error
 	finishChannel   chan string
+	// parameters contains the workflow parameters available to the commands.
+	parameters map[string]string
 }
 
 // ParallelFromJSON structure with helper RawMessage to parse
@@ -81,7 +83,14 @@ func NewParallel(description string, maxParallelism int, cmds []entities.Command
 		Commands:           cmds, commandHandler: handler.GetCommandHandler(),
 		commandResults:  make(map[string]entities.CommandResult),
 		executionErrors: make(map[string]derrors.Error),
-		finishChannel:   make(chan string)}
+		finishChannel:   make(chan string),
+		parameters:      make(map[string]string, 0)}
+}
+
+// SetParameters provides the workflow parameters available when the command is launched. The commands executed
+// in parallel do not see the outputs of each other.
+func (p *Parallel) SetParameters(params map[string]string) {
+	p.parameters = params
 }
 
 // NewParallelFromJSON creates a new command from a raw json payload.
@@ -118,6 +127,9 @@ func (p *Parallel) Run(workflowID string) (*entities.CommandResult, derrors.Erro
 	}
 	log.Info().Str("cmd", p.CommandID).Str("description", p.Description).Msg("Executing parallel group")
 	log.Debug().Int("initialLaunch", initialLaunch).Msg("MaxParallelism set")
+	for _, cmd := range p.Commands {
+		setParameters(cmd, copyParameters(p.parameters))
+	}
 	launched := 0
 	for index := 0; index < initialLaunch; index++ {
 		nextCommand := p.Commands[index]
@@ -244,12 +256,14 @@ func (p *Parallel) buildCommandResult() (*entities.CommandResult, derrors.Error)
 	overallSuccess := true
 
 	var overallOutput bytes.Buffer
+	outputs := make(map[string]string, 0)
 	for key, value := range p.commandResults {
 		overallSuccess = overallSuccess && value.Success
 		overallOutput.WriteString("Output of " + key + "\n" + value.Output + "\n")
+		mergeOutputs(outputs, &value)
 	}
 
-	return entities.NewCommandResultNoShow(overallSuccess, overallOutput.String(), nil), nil
+	return entities.NewCommandResultNoShow(overallSuccess, overallOutput.String(), nil).WithOutputs(outputs), nil
 
 }
 
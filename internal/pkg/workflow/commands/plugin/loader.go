@@ -0,0 +1,62 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package plugin
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+)
+
+// Load registers a synchronous command for each executable file of a directory. The name of the command is the
+// name of the file without its extension.
+//   params:
+//     pluginsPath The directory containing the plugins.
+//   returns:
+//     The names of the registered commands.
+//     An error if the directory cannot be read or a plugin clashes with a registered command.
+func Load(pluginsPath string) ([]string, derrors.Error) {
+	files, err := ioutil.ReadDir(pluginsPath)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.InvalidCommandPlugin, err).WithParams(pluginsPath)
+	}
+	loaded := make([]string, 0)
+	for _, file := range files {
+		if file.IsDir() || file.Mode()&0111 == 0 {
+			continue
+		}
+		name := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		path := filepath.Join(pluginsPath, file.Name())
+		rErr := entities.AddCommand(entities.CommandRegistration{
+			Type:    entities.SyncCommandType,
+			Name:    name,
+			Factory: NewPluginFactory(path),
+		})
+		if rErr != nil {
+			return loaded, rErr
+		}
+		log.Info().Str("command", name).Str("path", path).Msg("command plugin loaded")
+		loaded = append(loaded, name)
+	}
+	return loaded, nil
+}
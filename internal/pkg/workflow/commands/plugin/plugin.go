@@ -0,0 +1,167 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Plugin command
+// Executes an external command plugin. Plugins are executables that receive the workflow identifier, the workflow
+// parameters and the command definition as a JSON document on stdin, and write the result on stdout. The outputs
+// of the plugin are added to the workflow parameters available to the following commands.
+//
+// stdin:  {"workflow_id": "...", "parameters": {...}, "command": {"type":"sync", "name": "myPlugin", ...}}
+// stdout: {"success": true, "message": "...", "outputs": {"key": "value"}}
+
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+)
+
+// Request structure sent to the plugins on stdin.
+type Request struct {
+	// WorkflowID with the identifier of the workflow executing the command.
+	WorkflowID string `json:"workflow_id"`
+	// Parameters with the workflow parameters set by the previous commands.
+	Parameters map[string]string `json:"parameters"`
+	// Command with the JSON definition of the command.
+	Command json.RawMessage `json:"command"`
+}
+
+// Response structure expected from the plugins on stdout.
+type Response struct {
+	// Success indicates if the command succeeded.
+	Success bool `json:"success"`
+	// Message describing the result.
+	Message string `json:"message"`
+	// Output of the command, used instead of the message by plugins writing long reports.
+	Output string `json:"output"`
+	// Error describing the failure, if any. The message is used if empty.
+	Error string `json:"error"`
+	// Outputs with the workflow parameters set by the plugin.
+	Outputs map[string]string `json:"outputs"`
+}
+
+// Plugin command structure.
+type Plugin struct {
+	entities.GenericSyncCommand
+	// path of the plugin executable.
+	path string
+	// raw contains the JSON definition of the command.
+	raw json.RawMessage
+	// parameters contains the workflow parameters available when the command is launched.
+	parameters map[string]string
+}
+
+// NewPluginFactory creates the factory of the commands executed by a plugin.
+//   params:
+//     path The path of the plugin executable.
+//   returns:
+//     The command factory.
+func NewPluginFactory(path string) entities.CommandFactory {
+	return func(raw []byte) (*entities.Command, derrors.Error) {
+		plugin := &Plugin{path: path, raw: raw}
+		if err := json.Unmarshal(raw, &plugin.GenericSyncCommand); err != nil {
+			return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+		}
+		plugin.CommandID = entities.GenerateCommandID(plugin.Name())
+		var r entities.Command = plugin
+		return &r, nil
+	}
+}
+
+// SetParameters provides the workflow parameters available when the command is launched.
+func (p *Plugin) SetParameters(params map[string]string) {
+	p.parameters = params
+}
+
+// Run the plugin executable passing the command definition.
+//   params:
+//     workflowID The workflow identifier.
+//   returns:
+//     The CommandResult
+//     An error if the plugin cannot be executed or its response is not valid.
+func (p *Plugin) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	return execute(p.Name(), p.path, nil, Request{WorkflowID: workflowID, Parameters: p.parameters, Command: p.raw})
+}
+
+// String obtains a string representation
+func (p *Plugin) String() string {
+	return "SYNC Plugin " + p.Name() + " " + p.path
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (p *Plugin) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + p.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (p *Plugin) UserString() string {
+	return "Plugin " + p.Name()
+}
+
+// execute runs a plugin executable writing the request on its stdin and parsing the response from its stdout.
+//   params:
+//     name The name of the command being executed.
+//     path The path of the plugin executable.
+//     args The arguments of the executable.
+//     request The request sent to the plugin.
+//   returns:
+//     The CommandResult
+//     An error if the plugin cannot be executed or its response is not valid.
+func execute(name string, path string, args []string, request Request) (*entities.CommandResult, derrors.Error) {
+	if request.Parameters == nil {
+		request.Parameters = make(map[string]string, 0)
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, derrors.NewInternalError(errors.MarshalError, err)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+	if stderr.Len() > 0 {
+		log.Debug().Str("plugin", name).Str("stderr", stderr.String()).Msg("plugin messages")
+	}
+	if runErr != nil {
+		return nil, derrors.NewInternalError(errors.CannotExecuteSyncCommand, runErr).WithParams(path, stderr.String())
+	}
+	var response Response
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return nil, derrors.NewInternalError(errors.InvalidCommandPlugin, err).WithParams(path, stdout.String())
+	}
+	output := response.Output
+	if output == "" {
+		output = response.Message
+	}
+	if !response.Success {
+		reason := response.Error
+		if reason == "" {
+			reason = response.Message
+		}
+		return entities.NewCommandResult(false, output, derrors.NewInternalError(reason).WithParams(name)), nil
+	}
+	return entities.NewCommandResult(true, output, nil).WithOutputs(response.Outputs), nil
+}
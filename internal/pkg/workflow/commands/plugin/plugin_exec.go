@@ -0,0 +1,105 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// PluginExec command
+// Executes an external binary implementing the plugin protocol, passing it the command definition and the workflow
+// parameters on stdin.
+//
+// {"type":"sync", "name": "plugin-exec", "path": "/opt/plugins/register-dns", "args": ["--verbose"],
+//  "config": {"zone": "example.com"}}
+
+package plugin
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+)
+
+// PluginExec command structure with supported parameters.
+type PluginExec struct {
+	entities.GenericSyncCommand
+	// Path of the plugin executable.
+	Path string `json:"path"`
+	// Args with the arguments of the executable.
+	Args []string `json:"args"`
+	// Config with the plugin specific settings.
+	Config map[string]interface{} `json:"config"`
+	// raw contains the JSON definition of the command.
+	raw json.RawMessage
+	// parameters contains the workflow parameters available when the command is launched.
+	parameters map[string]string
+}
+
+// NewPluginExec creates a PluginExec command from a set of parameters.
+func NewPluginExec(path string, args []string, config map[string]interface{}) *PluginExec {
+	cmd := &PluginExec{
+		GenericSyncCommand: *entities.NewSyncCommand(entities.PluginExec),
+		Path:               path,
+		Args:               args,
+		Config:             config,
+	}
+	cmd.raw, _ = json.Marshal(cmd)
+	return cmd
+}
+
+// NewPluginExecFromJSON creates a PluginExec command from a JSON object.
+func NewPluginExecFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	pe := &PluginExec{raw: raw}
+	if err := json.Unmarshal(raw, &pe); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	if pe.Path == "" {
+		return nil, derrors.NewInvalidArgumentError(errors.InvalidCommandParameters).WithParams("path")
+	}
+	pe.CommandID = entities.GenerateCommandID(pe.Name())
+	var r entities.Command = pe
+	return &r, nil
+}
+
+// SetParameters provides the workflow parameters available when the command is launched.
+func (pe *PluginExec) SetParameters(params map[string]string) {
+	pe.parameters = params
+}
+
+// Run the plugin executable.
+//   params:
+//     workflowID The workflow identifier.
+//   returns:
+//     The CommandResult
+//     An error if the plugin cannot be executed or its response is not valid.
+func (pe *PluginExec) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	return execute(pe.Name(), pe.Path, pe.Args, Request{WorkflowID: workflowID, Parameters: pe.parameters, Command: pe.raw})
+}
+
+// String obtains a string representation
+func (pe *PluginExec) String() string {
+	return "SYNC PluginExec " + pe.Path + " " + strings.Join(pe.Args, " ")
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (pe *PluginExec) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + pe.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (pe *PluginExec) UserString() string {
+	return "Plugin " + pe.Path
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// echoPlugin replies depending on the request received on stdin.
+const echoPlugin = `#!/bin/sh
+input=$(cat)
+echo "received $input" >&2
+case "$input" in
+  *'"fail":true'*) echo '{"success":false,"output":"failed","error":"requested failure"}' ;;
+  *'"parameters":{"region":"eu"}'*'"zone":"example.com"'*) echo '{"success":true,"message":"registered","outputs":{"dns_record":"eu.example.com"}}' ;;
+  *) echo '{"success":true,"output":"done"}' ;;
+esac
+`
+
+// brokenPlugin writes an invalid response.
+const brokenPlugin = `#!/bin/sh
+cat > /dev/null
+echo "not json"
+`
+
+var _ = ginkgo.Describe("Command plugins", func() {
+
+	var pluginsPath string
+
+	ginkgo.BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "plugins")
+		gomega.Expect(err).To(gomega.Succeed())
+		pluginsPath = dir
+		gomega.Expect(ioutil.WriteFile(filepath.Join(dir, "pluginEcho.sh"), []byte(echoPlugin), 0755)).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(filepath.Join(dir, "pluginBroken"), []byte(brokenPlugin), 0755)).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0644)).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		entities.RemoveCommand(entities.SyncCommandType, "pluginEcho")
+		entities.RemoveCommand(entities.SyncCommandType, "pluginBroken")
+		os.RemoveAll(pluginsPath)
+	})
+
+	parse := func(raw string) entities.SyncCommand {
+		registration, found := entities.LookupCommand(entities.SyncCommandType, "pluginEcho")
+		gomega.Expect(found).To(gomega.BeTrue())
+		cmd, err := registration.Factory([]byte(raw))
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect((*cmd).Name()).To(gomega.Equal("pluginEcho"))
+		return (*cmd).(entities.SyncCommand)
+	}
+
+	ginkgo.It("must register the executables of the directory", func() {
+		loaded, err := Load(pluginsPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(loaded).To(gomega.ConsistOf("pluginEcho", "pluginBroken"))
+		registration, found := entities.LookupCommand(entities.SyncCommandType, "pluginEcho")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(registration.Prototype).To(gomega.BeNil())
+	})
+
+	ginkgo.It("must reject plugins clashing with registered commands", func() {
+		_, err := Load(pluginsPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		_, err = Load(pluginsPath)
+		gomega.Expect(err).ToNot(gomega.BeNil())
+	})
+
+	ginkgo.It("must run a plugin", func() {
+		_, err := Load(pluginsPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		result, rErr := parse(`{"type":"sync", "name":"pluginEcho"}`).Run("w1")
+		gomega.Expect(rErr).To(gomega.BeNil())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(result.Output).To(gomega.Equal("done"))
+	})
+
+	ginkgo.It("must report plugin failures", func() {
+		_, err := Load(pluginsPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		result, rErr := parse(`{"type":"sync", "name":"pluginEcho", "fail":true}`).Run("w1")
+		gomega.Expect(rErr).To(gomega.BeNil())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+		gomega.Expect(result.Output).To(gomega.Equal("failed"))
+	})
+
+	ginkgo.It("must reject invalid responses", func() {
+		_, err := Load(pluginsPath)
+		gomega.Expect(err).To(gomega.BeNil())
+		registration, _ := entities.LookupCommand(entities.SyncCommandType, "pluginBroken")
+		cmd, pErr := registration.Factory([]byte(`{"type":"sync", "name":"pluginBroken"}`))
+		gomega.Expect(pErr).To(gomega.BeNil())
+		_, rErr := (*cmd).(entities.SyncCommand).Run("w1")
+		gomega.Expect(rErr).ToNot(gomega.BeNil())
+	})
+
+	ginkgo.Context("plugin-exec command", func() {
+
+		ginkgo.It("must require the path of the executable", func() {
+			_, err := NewPluginExecFromJSON([]byte(`{"type":"sync", "name":"plugin-exec"}`))
+			gomega.Expect(err).ToNot(gomega.BeNil())
+		})
+
+		ginkgo.It("must pass the workflow parameters and return the outputs", func() {
+			raw := fmt.Sprintf(`{"type":"sync", "name":"plugin-exec", "path":%q, "config":{"zone":"example.com"}}`,
+				filepath.Join(pluginsPath, "pluginEcho.sh"))
+			cmd, err := NewPluginExecFromJSON([]byte(raw))
+			gomega.Expect(err).To(gomega.BeNil())
+			pe := (*cmd).(*PluginExec)
+			pe.SetParameters(map[string]string{"region": "eu"})
+			result, rErr := pe.Run("w1")
+			gomega.Expect(rErr).To(gomega.BeNil())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			gomega.Expect(result.Output).To(gomega.Equal("registered"))
+			gomega.Expect(result.Outputs).To(gomega.Equal(map[string]string{"dns_record": "eu.example.com"}))
+		})
+
+		ginkgo.It("must fail if the executable cannot be launched", func() {
+			result, err := NewPluginExec(filepath.Join(pluginsPath, "missing"), nil, nil).Run("w1")
+			gomega.Expect(err).ToNot(gomega.BeNil())
+			gomega.Expect(result).To(gomega.BeNil())
+		})
+	})
+})
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+)
+
+// LaunchCommands returns the commands launching components found in a list of commands, including the ones
+// contained in groups, parallel and try commands.
+func LaunchCommands(commands ...entities.Command) []*k8s.LaunchComponents {
+	result := make([]*k8s.LaunchComponents, 0)
+	for _, cmd := range commands {
+		switch c := cmd.(type) {
+		case *Group:
+			result = append(result, LaunchCommands(c.Commands...)...)
+		case *Parallel:
+			result = append(result, LaunchCommands(c.Commands...)...)
+		case *Try:
+			result = append(result, LaunchCommands(c.TryCommand, c.OnFailCommand)...)
+		case *k8s.LaunchComponents:
+			result = append(result, c)
+		case *deferredSyncCommand:
+			result = append(result, LaunchCommands(c.Command)...)
+		case *faultySyncCommand:
+			result = append(result, LaunchCommands(c.Command)...)
+		case *faultyAsyncCommand:
+			result = append(result, LaunchCommands(c.Command)...)
+		}
+	}
+	return result
+}
+
+// RenderComponents writes the manifests of the components launched by a list of commands to a directory instead of
+// applying them. If several commands launch components, the manifests of each one are written to a subdirectory.
+//   params:
+//     outputDir The directory receiving the manifests.
+//     commands The list of commands.
+//   returns:
+//     The paths of the written manifests.
+//     An error if the components cannot be rendered.
+func RenderComponents(outputDir string, commands ...entities.Command) ([]string, derrors.Error) {
+	launches := LaunchCommands(commands...)
+	if len(launches) == 0 {
+		return nil, derrors.NewNotFoundError("the workflow does not launch components")
+	}
+	result := make([]string, 0)
+	for index, launch := range launches {
+		target := outputDir
+		if len(launches) > 1 {
+			target = filepath.Join(outputDir, fmt.Sprintf("%d-%s", index, filepath.Base(launch.ComponentsDir)))
+		}
+		written, err := launch.Render(target)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, written...)
+	}
+	return result, nil
+}
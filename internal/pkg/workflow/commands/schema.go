@@ -0,0 +1,60 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the schema of the supported commands used to validate workflows before their execution. The
+// schemas are taken from the command registry.
+
+package commands
+
+import (
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+)
+
+// CommandSchema structure describing the JSON fields accepted by a command.
+type CommandSchema struct {
+	// Prototype returns an empty instance of the structure the command is unmarshalled into. The instance
+	// is only used for unmarshalling, so no clients or connections are created. It is empty for commands whose
+	// fields are not known in advance, such as external plugins.
+	Prototype func() interface{}
+	// Required contains the fields that must be present in the command definition.
+	Required []string
+}
+
+// IncludeWorkflow structure with the fields of an include command.
+type IncludeWorkflow struct {
+	entities.GenericCommand
+	// Template with the name of the template to be included.
+	Template string `json:"template"`
+	// Version of the template, empty to use the latest one.
+	Version string `json:"version"`
+	// Params with the bindings available to the included template.
+	Params map[string]string `json:"params"`
+}
+
+// GetSchema returns the schema of a command.
+//   params:
+//     commandType The type of the command.
+//     name The name of the command.
+//   returns:
+//     The command schema and whether the command is supported.
+func GetSchema(commandType entities.CommandType, name string) (CommandSchema, bool) {
+	registration, found := entities.LookupCommand(commandType, name)
+	if !found {
+		return CommandSchema{}, false
+	}
+	return CommandSchema{Prototype: registration.Prototype, Required: registration.Required}, true
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Detection of the architecture of the target nodes through SSH, so the clusters can be installed on ARM based
+// nodes such as Graviton instances or Raspberry Pi boards.
+
+package sync
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/utils"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/connection"
+)
+
+// Architectures of the nodes supported by the installer, named as in Go and Kubernetes.
+const (
+	AMD64Architecture = "amd64"
+	ARM64Architecture = "arm64"
+)
+
+// ArchitectureCommand is the command printing the architecture of a node.
+const ArchitectureCommand = "uname -m"
+
+// SupportedArchitectures contains the architectures of the nodes where clusters can be installed.
+var SupportedArchitectures = []string{AMD64Architecture, ARM64Architecture}
+
+// IsSupportedArchitecture checks if clusters can be installed on the nodes of an architecture.
+func IsSupportedArchitecture(arch string) bool {
+	for _, supported := range SupportedArchitectures {
+		if arch == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectArchitecture obtains the architecture of a node.
+//   params:
+//     conn The connection to the node.
+//     node The address of the node.
+//   returns:
+//     The architecture of the node, such as amd64 or arm64.
+//     An error if it cannot be obtained or it is not supported.
+func DetectArchitecture(conn connection.Connection, node string) (string, derrors.Error) {
+	output, err := conn.Execute(ArchitectureCommand)
+	if err != nil {
+		return "", derrors.NewInternalError(errors.SSHConnectionError, err).WithParams(node)
+	}
+	arch, _ := utils.NormalizeArchitecture(string(output))
+	if !IsSupportedArchitecture(arch) {
+		return "", derrors.NewFailedPreconditionError("unsupported node architecture").
+			WithParams(node, strings.TrimSpace(string(output)))
+	}
+	return arch, nil
+}
+
+// SortedArchitectures returns the different architectures of a set of nodes in alphabetical order.
+func SortedArchitectures(archs map[string]string) []string {
+	unique := make(map[string]bool, 0)
+	for _, arch := range archs {
+		unique[arch] = true
+	}
+	result := make([]string, 0, len(unique))
+	for arch := range unique {
+		result = append(result, arch)
+	}
+	sort.Strings(result)
+	return result
+}
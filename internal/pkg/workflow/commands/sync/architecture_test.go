@@ -0,0 +1,59 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package sync
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// machineConnection replies to the commands with the machine reported by uname.
+type machineConnection struct {
+	machine string
+}
+
+func (mc *machineConnection) Execute(command string) ([]byte, error) {
+	return []byte(mc.machine + "\n"), nil
+}
+
+func (mc *machineConnection) Copy(lpath string, rpath string, remoteSource bool) error {
+	return nil
+}
+
+func (mc *machineConnection) IsOnline() (bool, error) {
+	return true, nil
+}
+
+var _ = ginkgo.Describe("The node architecture detection", func() {
+
+	ginkgo.It("should detect the supported architectures", func() {
+		arch, err := DetectArchitecture(&machineConnection{"x86_64"}, "10.0.0.1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(arch).To(gomega.Equal(AMD64Architecture))
+		arch, err = DetectArchitecture(&machineConnection{"aarch64"}, "10.0.0.2")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(arch).To(gomega.Equal(ARM64Architecture))
+		gomega.Expect(SortedArchitectures(map[string]string{"a": "arm64", "b": "amd64", "c": "arm64"})).
+			To(gomega.Equal([]string{AMD64Architecture, ARM64Architecture}))
+	})
+
+	ginkgo.It("should reject unsupported architectures", func() {
+		_, err := DetectArchitecture(&machineConnection{"armv7l"}, "10.0.0.3")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+})
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Check binaries command
+// Verifies that the binaries staged in the binary path, and in the Istio path if set, match the versions and
+// checksums declared in the binaries manifest. The manifest is read from binaries.json in the binary path unless
+// manifest_path is set, and the check passes if it does not exist.
+//
+// {"type":"sync", "name":"checkBinaries", "binary_path":"/nalej/bin", "istio_path":"/istio/bin"}
+
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/compatibility"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+)
+
+// CheckBinaries structure with the command parameters.
+type CheckBinaries struct {
+	entities.GenericSyncCommand
+	// BinaryPath with the directory of the binaries, such as rke.
+	BinaryPath string `json:"binary_path"`
+	// IstioPath with the directory of istioctl, empty if Istio is not used.
+	IstioPath string `json:"istio_path"`
+	// ManifestPath with the binaries manifest, BinariesManifestFile in the binary path if empty.
+	ManifestPath string `json:"manifest_path"`
+}
+
+// NewCheckBinaries creates a new CheckBinaries command.
+func NewCheckBinaries(binaryPath string, istioPath string) *CheckBinaries {
+	return &CheckBinaries{
+		GenericSyncCommand: *entities.NewSyncCommand(entities.CheckBinaries),
+		BinaryPath:         binaryPath,
+		IstioPath:          istioPath,
+	}
+}
+
+// NewCheckBinariesFromJSON creates a new CheckBinaries command using a raw JSON payload.
+func NewCheckBinariesFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	cb := &CheckBinaries{}
+	if err := json.Unmarshal(raw, &cb); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	cb.CommandID = entities.GenerateCommandID(cb.Name())
+	var r entities.Command = cb
+	return &r, nil
+}
+
+// manifestPath returns the path of the binaries manifest.
+func (cb *CheckBinaries) manifestPath() string {
+	if cb.ManifestPath != "" {
+		return cb.ManifestPath
+	}
+	return filepath.Join(cb.BinaryPath, compatibility.BinariesManifestFile)
+}
+
+// Run the current command.
+//   returns:
+//     The CommandResult
+//     An error if the manifest cannot be read
+func (cb *CheckBinaries) Run(_ string) (*entities.CommandResult, derrors.Error) {
+	manifest, err := compatibility.LoadBinariesManifest(cb.manifestPath())
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return entities.NewSuccessCommand([]byte(fmt.Sprintf("no binaries manifest found in %s", cb.manifestPath()))), nil
+	}
+	issues := manifest.Verify(cb.BinaryPath, cb.IstioPath)
+	if len(issues) > 0 {
+		msg := errors.Coded(errors.PrecheckFailed, fmt.Sprintf("staged binaries do not match the manifest: %s", strings.Join(issues, "; ")))
+		return entities.NewCommandResult(false, msg, nil), nil
+	}
+	return entities.NewSuccessCommand([]byte(fmt.Sprintf("%d binaries match the manifest", len(manifest.Binaries)))), nil
+}
+
+// String obtains a string representation
+func (cb *CheckBinaries) String() string {
+	return fmt.Sprintf("SYNC CheckBinaries binaries: %s istio: %s manifest: %s", cb.BinaryPath, cb.IstioPath, cb.manifestPath())
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (cb *CheckBinaries) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + cb.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (cb *CheckBinaries) UserString() string {
+	return "Checking the staged binaries"
+}
@@ -110,7 +110,7 @@ func (conn *SSHConnection) createClient() (*ssh.Client, error) {
 		return nil, err
 	}
 
-	sshAddress := fmt.Sprintf("%s:%s", conn.Address, conn.Port)
+	sshAddress := net.JoinHostPort(conn.Address, conn.Port)
 	client, err := ssh.Dial("tcp", sshAddress, sshConfig)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the execution of the external binaries, such as istioctl or rke, in short-lived containers of
+// pinned images, so they do not need to be distributed with the installer.
+
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nalej/derrors"
+)
+
+// ContainerRuntime is the binary used to run the commands in containers.
+const ContainerRuntime = "docker"
+
+// ValidatePinnedImage checks that an image is pinned to a digest or to a tag other than latest, so the binary it runs
+// does not change between installs.
+func ValidatePinnedImage(image string) derrors.Error {
+	if image == "" {
+		return derrors.NewInvalidArgumentError("image is required")
+	}
+	if strings.Contains(image, "@sha256:") {
+		return nil
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	index := strings.LastIndex(name, ":")
+	if index == -1 || name[index+1:] == "" || name[index+1:] == "latest" {
+		return derrors.NewInvalidArgumentError("image must be pinned to a tag or digest").WithParams(image)
+	}
+	return nil
+}
+
+// ContainerCommand returns the command running a binary in a short-lived container. The directories of the absolute
+// paths found in the arguments, and of the additional files, are mounted in the container with the same path.
+//   params:
+//     image The image of the container.
+//     entrypoint The binary executed in the container.
+//     files The additional files used by the binary that do not appear in the arguments.
+//     args The arguments of the binary.
+//   returns:
+//     The binary to be executed.
+//     The arguments of the binary.
+func ContainerCommand(image string, entrypoint string, files []string, args []string) (string, []string) {
+	containerArgs := []string{"run", "--rm", "--network", "host", "--entrypoint", entrypoint}
+	paths := append(append(make([]string, 0, len(files)+len(args)), files...), args...)
+	for _, dir := range containerMounts(paths) {
+		containerArgs = append(containerArgs, "-v", dir+":"+dir)
+	}
+	containerArgs = append(containerArgs, image)
+	return ContainerRuntime, append(containerArgs, args...)
+}
+
+// containerMounts returns the directories of the existing absolute paths referenced by the arguments, either directly
+// or as the value of a --flag=value argument.
+func containerMounts(args []string) []string {
+	mounts := make([]string, 0)
+	mounted := make(map[string]bool, 0)
+	for _, arg := range args {
+		value := arg
+		if strings.HasPrefix(arg, "-") {
+			index := strings.Index(arg, "=")
+			if index == -1 {
+				continue
+			}
+			value = arg[index+1:]
+		}
+		if !filepath.IsAbs(value) {
+			continue
+		}
+		info, err := os.Stat(value)
+		if err != nil {
+			continue
+		}
+		dir := value
+		if !info.IsDir() {
+			dir = filepath.Dir(value)
+		}
+		if !mounted[dir] {
+			mounted[dir] = true
+			mounts = append(mounts, dir)
+		}
+	}
+	return mounts
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("The container execution", func() {
+
+	ginkgo.It("should only accept pinned images", func() {
+		for _, pinned := range []string{"rancher/rke:v1.0.4", "registry:5000/nalej/rke:1.0", "istio/istioctl@sha256:2f1ad4d6e4c2b7d1"} {
+			gomega.Expect(ValidatePinnedImage(pinned)).To(gomega.Succeed(), pinned)
+		}
+		for _, unpinned := range []string{"", "rancher/rke", "rancher/rke:latest", "registry:5000/nalej/rke"} {
+			gomega.Expect(ValidatePinnedImage(unpinned)).NotTo(gomega.Succeed(), unpinned)
+		}
+	})
+
+	ginkgo.It("should mount the directories of the files used by the command", func() {
+		dir, err := ioutil.TempDir("", "container")
+		gomega.Expect(err).To(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		keyDir, err := ioutil.TempDir("", "keys")
+		gomega.Expect(err).To(gomega.Succeed())
+		defer os.RemoveAll(keyDir)
+		config := filepath.Join(dir, "cluster.yaml")
+		key := filepath.Join(keyDir, "id_rsa")
+		gomega.Expect(ioutil.WriteFile(config, []byte("nodes:"), 0600)).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(key, []byte("key"), 0600)).To(gomega.Succeed())
+
+		cmd, args := ContainerCommand("rancher/rke:v1.0.4", "rke", []string{key},
+			[]string{"up", "--config", config, "--kubeconfig=" + config, "/missing/file"})
+		gomega.Expect(cmd).To(gomega.Equal(ContainerRuntime))
+		gomega.Expect(args).To(gomega.Equal([]string{"run", "--rm", "--network", "host", "--entrypoint", "rke",
+			"-v", keyDir + ":" + keyDir, "-v", dir + ":" + dir, "rancher/rke:v1.0.4",
+			"up", "--config", config, "--kubeconfig=" + config, "/missing/file"}))
+	})
+})
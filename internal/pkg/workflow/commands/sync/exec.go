@@ -16,9 +16,10 @@
  */
 
 // Exec command
-// Executes an arbitrary command.
+// Executes an arbitrary command. If an image is set, the command runs in a short-lived container of that image
+// instead of on the host.
 //
-// {"type":"sync", "name": "exec", "cmd": "ls", "args":["-lash", "/tmp/."]}
+// {"type":"sync", "name": "exec", "cmd": "ls", "args":["-lash", "/tmp/."], "image":"alpine:3.11"}
 
 package sync
 
@@ -37,13 +38,22 @@ type Exec struct {
 	entities.GenericSyncCommand
 	Cmd  string   `json:"cmd"`
 	Args []string `json:"args"`
+	// Image with the pinned image of the container running the command, empty to run it on the host.
+	Image string `json:"image"`
 }
 
 // NewExec creates an Exec command from a set of parameters.
 func NewExec(cmd string, args []string) *Exec {
 	return &Exec{
 		*entities.NewSyncCommand(entities.Exec),
-		cmd, args}
+		cmd, args, ""}
+}
+
+// NewContainerExec creates an Exec command running in a container of the given image.
+func NewContainerExec(image string, cmd string, args []string) *Exec {
+	exec := NewExec(cmd, args)
+	exec.Image = image
+	return exec
 }
 
 // NewExecFromJSON creates an Exec command from a JSON object.
@@ -73,7 +83,14 @@ func (e *Exec) Run(_ string) (*entities.CommandResult, derrors.Error) {
 	// https://groups.google.com/forum/#!topic/golang-nuts/MI4TyIkQqqg
 	// https://groups.google.com/forum/#!msg/golang-nuts/dKbL1oOiCIY/OCfhH2rFp80J
 
-	cmd := exec.Command(e.Cmd, e.Args...)
+	binary, args := e.Cmd, e.Args
+	if e.Image != "" {
+		if err := ValidatePinnedImage(e.Image); err != nil {
+			return nil, err
+		}
+		binary, args = ContainerCommand(e.Image, e.Cmd, nil, e.Args)
+	}
+	cmd := exec.Command(binary, args...)
 	output, err := cmd.CombinedOutput()
 
 	if err != nil {
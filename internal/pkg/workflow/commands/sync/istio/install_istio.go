@@ -21,16 +21,12 @@
 package istio
 
 import (
-    "bytes"
-    "crypto/rand"
-    "crypto/rsa"
-    "crypto/x509"
     "crypto/x509/pkix"
     "encoding/json"
-    "encoding/pem"
     "fmt"
     "github.com/nalej/derrors"
     "github.com/nalej/installer/internal/pkg/errors"
+    "github.com/nalej/installer/internal/pkg/pki"
     "github.com/nalej/installer/internal/pkg/workflow/commands/sync"
     "github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
     "github.com/nalej/installer/internal/pkg/workflow/entities"
@@ -41,23 +37,22 @@ import (
     istioClient "istio.io/client-go/pkg/clientset/versioned"
     "k8s.io/api/core/v1"
     metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime/schema"
     "k8s.io/apimachinery/pkg/types"
-    "k8s.io/client-go/kubernetes"
-    "k8s.io/client-go/rest"
-    "k8s.io/client-go/tools/clientcmd"
-    "math/big"
+    "net"
     "net/url"
     "os"
+    "regexp"
     "strings"
     "time"
 )
 
 const (
-    //IstioNamespace the name of the namespace used by Istio
+    //IstioNamespace the name of the namespace used by Istio if not specified
     IstioNamespace = "istio-system"
-    //IstioIngressGateway the name of the gateway service
+    //IstioIngressGateway the name of the gateway service if not specified
     IstioIngressGateway = "istio-ingressgateway"
-    //IstioSecretName name of the certificates used
+    //IstioSecretName name of the certificates used if not specified
     IstioSecretName = "cacerts"
     // Time between checks
     IstioTimeSleep = time.Second * 5
@@ -65,8 +60,37 @@ const (
     IstioTimeout = time.Second * 300
     // Time validity for the Istio certificate
     IstioCertValidity = time.Hour * 24 * 365 * 2
+    // GatewayIPOutput name of the output with the IP of the ingress gateway
+    GatewayIPOutput = "istio.gatewayIP"
+    // DefaultTrustDomain is the SPIFFE trust domain of the mesh if not specified
+    DefaultTrustDomain = "cluster.local"
 )
 
+// gatewayInterval is the time between the checks of the ingress gateway.
+var gatewayInterval = IstioTimeSleep
+
+// trustDomainRegex matches the valid SPIFFE trust domains, lowercase DNS names without scheme or port.
+var trustDomainRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+
+// resourceNameRegex matches the valid names of the namespaces, services and secrets of Istio.
+var resourceNameRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// ValidateResourceName checks that the name of a namespace, service or secret of Istio is a valid DNS label.
+func ValidateResourceName(name string) derrors.Error {
+    if len(name) > 63 || !resourceNameRegex.MatchString(name) {
+        return derrors.NewInvalidArgumentError("invalid name, expecting a lowercase DNS label").WithParams(name)
+    }
+    return nil
+}
+
+// ValidateTrustDomain checks that a SPIFFE trust domain can be used in the identities of the mesh.
+func ValidateTrustDomain(trustDomain string) derrors.Error {
+    if len(trustDomain) > 255 || !trustDomainRegex.MatchString(trustDomain) {
+        return derrors.NewInvalidArgumentError("invalid trust domain, expecting a lowercase DNS name").WithParams(trustDomain)
+    }
+    return nil
+}
+
 // Configuration for the control plane in a multiple mesh Istion configuration
 const IstioMasterConfig =
 `
@@ -100,7 +124,7 @@ spec:
                 port: 443
 `
 
-// Certificate to be created by lets encrypt to ensure https communication.
+// Certificate to be created by the cluster issuer to ensure https communication.
 const IstioIngressCert =
 `
 apiVersion: certmanager.k8s.io/v1alpha1
@@ -111,13 +135,17 @@ metadata:
 spec:
   secretName: ingress-cert
   issuerRef:
-    name: letsencrypt
+    name: .IssuerName
     kind: ClusterIssuer
   dnsNames:
   - '*..IngressDomain'
   - '*.master..IngressDomain'
   commonName: '*..IngressDomain'
-  acme:
+`
+
+// ACME challenge appended to the certificate when it is requested to lets encrypt.
+const IstioIngressCertACME =
+`  acme:
     config:
     - dns01:
         provider: azuredns
@@ -138,81 +166,177 @@ const IstioIngressPatch = `[
 type InstallIstio struct {
     k8s.Kubernetes
     // Istio client to create specific Istio entities
-    Istio *istioClient.Clientset
+    Istio istioClient.Interface `json:"-"`
     // Path where Istio can be found
     IstioPath       string `json:"istio_path"`
+    // IstioctlImage with the image running istioctl if IstioPath has no binary for the host platform
+    IstioctlImage   string `json:"istioctl_image"`
     ClusterID       string `json:"cluster_id"`
     IsAppCluster    bool   `json:"is_appCluster"`
     StaticIpAddress string `json:"static_ip_address"`
     TempPath        string `json:"temp_path"`
     DNSPublicHost   string `json:"dns_public_host"`
+    // TrustDomain with the SPIFFE trust domain of the mesh, DefaultTrustDomain if not set
+    TrustDomain string `json:"trust_domain"`
+    // Namespace where Istio is installed, IstioNamespace if not set
+    Namespace string `json:"namespace"`
+    // IngressGateway with the name of the service of the ingress gateway, IstioIngressGateway if not set
+    IngressGateway string `json:"ingress_gateway"`
+    // CASecretName with the name of the secret with the CAs of Istio, IstioSecretName if not set
+    CASecretName string `json:"ca_secret_name"`
+    // ManagementGatewayIP with the IP of the ingress gateway of the management cluster used by the application
+    // clusters. If not set, it is looked up in the management cluster.
+    ManagementGatewayIP string `json:"management_gateway_ip"`
+    // ManagementKubeConfigPath with the kubeconfig of the management cluster where the gateway is looked up. If not
+    // set, the cluster where the installer runs is used.
+    ManagementKubeConfigPath string `json:"management_kube_config_path"`
+    // WaitForGateway waits for the ingress gateway of the management cluster to have an IP before finishing.
+    WaitForGateway bool `json:"wait_for_gateway"`
+    // GatewayTimeoutSeconds with the maximum time to wait for the gateway. If not set, IstioTimeout is used.
+    GatewayTimeoutSeconds int `json:"gateway_timeout"`
+    // CertificateIssuer with the mode issuing the ingress certificate, k8s.LetsEncryptMode if not set.
+    CertificateIssuer string `json:"certificate_issuer"`
+    // clientFactory creates the Istio client when the command is run, defaultClientFactory if not set.
+    clientFactory IstioClientFactory
 }
 
-func NewInstallIstio(kubeConfigPath string, istioPath string, clusterID string, isAppCluster bool,
-    staticIpAddress string, tempPath string, dnsPublicHost string) *InstallIstio {
+// IstioClientFactory creates the Istio client used by the command, so it can be parsed, printed and tested without
+// access to the target cluster.
+type IstioClientFactory interface {
+    // NewIstioClient creates an Istio client for the cluster targeted by a command.
+    NewIstioClient(target *k8s.Kubernetes) (istioClient.Interface, derrors.Error)
+}
+
+// restClientFactory creates the Istio clients using the kubeconfig of the command.
+type restClientFactory struct{}
 
-    // use the current context in kubeconfig
-    config, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
+// NewIstioClient creates an Istio client using the kubeconfig of the command.
+func (restClientFactory) NewIstioClient(target *k8s.Kubernetes) (istioClient.Interface, derrors.Error) {
+    // use the selected context in kubeconfig, or the current one
+    config, err := target.RestConfig()
     if err != nil {
-        // --> Error
-        return nil
+        return nil, derrors.NewInternalError("impossible to get kubeconfig path").CausedBy(err)
+    }
+    istCli, iErr := istioClient.NewForConfig(config)
+    if iErr != nil {
+        return nil, derrors.NewInternalError("impossible to instantiate istio client", iErr)
     }
+    return istCli, nil
+}
 
-    istCli, err := istioClient.NewForConfig(config)
-    if err != nil {
-        // --> Error
-        return nil
+// defaultClientFactory is used by the commands that do not set a factory.
+var defaultClientFactory IstioClientFactory = restClientFactory{}
+
+// NewInstallIstio creates an InstallIstio command. The Istio client is created when the command connects to the
+// target cluster.
+//   params:
+//     kubeConfigPath The path of the kubeconfig of the target cluster.
+//     istioPath The directory where istioctl can be found.
+//     clusterID The identifier of the cluster.
+//     isAppCluster Whether the target is an application cluster.
+//     staticIpAddress The static IP address of the ingress gateway.
+//     tempPath The directory used to write temporary files.
+//     dnsPublicHost The public host of the DNS of the management cluster.
+//   returns:
+//     The command.
+//     An error if the istio path is not valid.
+func NewInstallIstio(kubeConfigPath string, istioPath string, clusterID string, isAppCluster bool,
+    staticIpAddress string, tempPath string, dnsPublicHost string) (*InstallIstio, derrors.Error) {
+
+    if err := ValidateIstioPath(istioPath); err != nil {
+        return nil, err
     }
 
     return &InstallIstio{
         Kubernetes: k8s.Kubernetes{
-            GenericSyncCommand: *entities.NewSyncCommand(entities.AddClusterUser),
+            GenericSyncCommand: *entities.NewSyncCommand(entities.InstallIstio),
             KubeConfigPath:     kubeConfigPath,
         },
         IstioPath:       istioPath,
-        Istio:           istCli,
         ClusterID:       clusterID,
         IsAppCluster:    isAppCluster,
         StaticIpAddress: staticIpAddress,
         TempPath:        tempPath,
         DNSPublicHost:   dnsPublicHost,
-    }
+    }, nil
 }
 
-// NewAddClusterUserFromJSON creates an InstallIstio command from a JSON object.
+// NewInstallIstioFromJSON creates an InstallIstio command from a JSON object.
 func NewInstallIstioFromJSON(raw []byte) (*entities.Command, derrors.Error) {
     lc := &InstallIstio{}
     if err := json.Unmarshal(raw, &lc); err != nil {
         return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
     }
+    lc.CommandID = entities.GenerateCommandID(lc.Name())
+    var r entities.Command = lc
+    return &r, nil
+}
 
-    // instantiate the Istio client
-    // use the current context in kubeconfig
-    config, err := clientcmd.BuildConfigFromFlags("", lc.KubeConfigPath)
-    if err != nil {
-        return nil, derrors.NewInternalError("impossible to get kubeconfig path", err)
+// ValidateIstioPath checks that the directory where istioctl can be found exists.
+func ValidateIstioPath(istioPath string) derrors.Error {
+    if istioPath == "" {
+        return derrors.NewInvalidArgumentError("istio path is required")
     }
-
-    istCli, err := istioClient.NewForConfig(config)
+    info, err := os.Stat(istioPath)
     if err != nil {
-        return nil, derrors.NewInternalError("impossible to instantiate istio client")
+        return derrors.NewInvalidArgumentError("cannot access istio path", err).WithParams(istioPath)
+    }
+    if !info.IsDir() {
+        return derrors.NewInvalidArgumentError("istio path is not a directory").WithParams(istioPath)
     }
+    return nil
+}
 
-    lc.Istio = istCli
+// WithClientFactory sets the factory used to create the Istio client.
+func (i *InstallIstio) WithClientFactory(factory IstioClientFactory) *InstallIstio {
+    i.clientFactory = factory
+    return i
+}
 
-    lc.CommandID = entities.GenerateCommandID(lc.Name())
-    var r entities.Command = lc
-    return &r, nil
+// Connect creates the Kubernetes clients and the Istio client of the target cluster.
+func (i *InstallIstio) Connect() derrors.Error {
+    if err := i.Kubernetes.Connect(); err != nil {
+        return err
+    }
+    return i.connectIstio()
+}
+
+// connectIstio creates the Istio client of the target cluster if it has not been created yet.
+func (i *InstallIstio) connectIstio() derrors.Error {
+    if i.Istio != nil {
+        return nil
+    }
+    factory := i.clientFactory
+    if factory == nil {
+        factory = defaultClientFactory
+    }
+    istCli, err := factory.NewIstioClient(&i.Kubernetes)
+    if err != nil {
+        return err
+    }
+    i.Istio = istCli
+    return nil
 }
 
 
 func (i *InstallIstio) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+    if err := ValidateTrustDomain(i.trustDomain()); err != nil {
+        return nil, err
+    }
+    if i.IstioPath != "" || i.IstioctlImage == "" {
+        if err := ValidateIstioPath(i.IstioPath); err != nil {
+            return nil, err
+        }
+    }
+    if err := i.validateNames(); err != nil {
+        return nil, err
+    }
     // Create namespace
     connectErr := i.Connect()
     if connectErr != nil {
         return nil, connectErr
     }
-    err := i.CreateNamespace(IstioNamespace)
+    err := i.EnsureNamespace(i.namespace(), k8s.NamespaceOptions{})
     if err != nil {
         return nil, derrors.NewInternalError("impossible to create namespace for istio", err)
     }
@@ -238,78 +362,66 @@ func (i *InstallIstio) Run(workflowID string) (*entities.CommandResult, derrors.
         return entities.NewCommandResult(false, "impossible to install istio", err), err
     }
 
-    // Wait for the gateway to have a valid ip.
-    // This operation may take quite a while. For the sake of installation speed we skip this check.
-    // i.waitForGatewayIP()
-
-    return entities.NewSuccessCommand([]byte("istio has been installed successfully")), nil
-}
-
-// waitForGatewayIP periodically checks the availability of the Istio gateway. The function terminates
-// if and only if the gateway is available and it has its own IP address.
-func (i *InstallIstio) waitForGatewayIP() derrors.Error {
-
-    log.Info().Msg("wait for Istio ingress gateway service to be available")
-    ticker := time.NewTicker(IstioTimeSleep)
-    timeout := make(chan bool)
-    ip := make(chan string)
-
-    go func() {
-        for {
-            select {
-            case <- ticker.C:
-                svc, err := i.Client.CoreV1().Services(IstioNamespace).Get(IstioIngressGateway, metaV1.GetOptions{})
-                if err == nil {
-                    // check if we have a valid ip
-                    if len(svc.Status.LoadBalancer.Ingress) > 0 {
-                        svcIP := svc.Status.LoadBalancer.Ingress[0].IP
-                        if len(svcIP) != 0 {
-                            ip <- svcIP
-                            log.Info().Msgf("Istio gateway has the associated IP: %s", svcIP)
-                        }
-                    }
-                }
-            case <- ip:
-                return
-            case <- timeout:
-                log.Info().Msg("timeout reached when waiting for gateway service")
-                return
-            }
-        }
-    }()
-
-    // wait until the Istio gateway service has an assigned IP
-    for {
-        select {
-        case <- time.After(IstioTimeout):
-            timeout <- true
-            return derrors.NewDeadlineExceededError("timeout reached when waiting for gateway service")
-        case <- ip:
-            return nil
+    // Waiting for the gateway to have a valid ip may take quite a while, so it is skipped unless requested.
+    if i.WaitForGateway && !i.IsAppCluster {
+        ip, err := i.waitForGatewayIP()
+        if err != nil {
+            return entities.NewCommandResult(false, "istio gateway has no IP", err), err
         }
+        outputs := map[string]string{GatewayIPOutput: ip}
+        return entities.NewSuccessCommand([]byte("istio has been installed successfully")).WithOutputs(outputs), nil
     }
 
-    return nil
+    return entities.NewSuccessCommand([]byte("istio has been installed successfully")).WithOutputs(i.gatewayOutputs()), nil
 }
 
-
-func (i *InstallIstio) genCert(template, parent *x509.Certificate, publicKey *rsa.PublicKey, privateKey *rsa.PrivateKey) (*x509.Certificate, []byte, derrors.Error) {
-    certBytes, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, privateKey)
-    if err != nil {
-        log.Error().Err(err).Msg("failed to create certificate")
-        return nil, nil, derrors.NewInternalError("failed to create certificate", err)
+// gatewayOutputs returns the IP of the ingress gateway as an output if it is already assigned. Unless WaitForGateway
+// is set, the gateway is not awaited, so following commands referencing the output fail if it is not available yet.
+func (i *InstallIstio) gatewayOutputs() map[string]string {
+    outputs := make(map[string]string, 0)
+    if i.IsAppCluster {
+        return outputs
     }
-
-    cert, err := x509.ParseCertificate(certBytes)
+    svc, err := i.Client.CoreV1().Services(i.namespace()).Get(i.ingressGateway(), metaV1.GetOptions{})
     if err != nil {
-        log.Error().Err(err).Msg("failed to parse certificate")
-        return nil, nil, derrors.NewInternalError("failed to parse certificate", err)
+        log.Warn().Err(err).Msg("cannot retrieve the istio ingress gateway")
+        return outputs
+    }
+    if len(svc.Status.LoadBalancer.Ingress) > 0 && svc.Status.LoadBalancer.Ingress[0].IP != "" {
+        outputs[GatewayIPOutput] = svc.Status.LoadBalancer.Ingress[0].IP
     }
+    return outputs
+}
 
-    b := pem.Block{Type: "CERTIFICATE", Bytes: certBytes}
-    certPEM := pem.EncodeToMemory(&b)
+// gatewayTimeout returns the maximum time to wait for the ingress gateway to have an IP.
+func (i *InstallIstio) gatewayTimeout() time.Duration {
+    if i.GatewayTimeoutSeconds <= 0 {
+        return IstioTimeout
+    }
+    return time.Duration(i.GatewayTimeoutSeconds) * time.Second
+}
 
-    return cert, certPEM, nil
+// waitForGatewayIP periodically checks the availability of the Istio gateway until it has its own IP address or the
+// timeout expires.
+//   returns:
+//     The IP of the gateway.
+//     An error if the gateway has no IP once the timeout expires.
+func (i *InstallIstio) waitForGatewayIP() (string, derrors.Error) {
+    log.Info().Msg("wait for Istio ingress gateway service to be available")
+    deadline := time.Now().Add(i.gatewayTimeout())
+    for {
+        svc, err := i.Client.CoreV1().Services(i.namespace()).Get(i.ingressGateway(), metaV1.GetOptions{})
+        if err == nil && len(svc.Status.LoadBalancer.Ingress) > 0 && svc.Status.LoadBalancer.Ingress[0].IP != "" {
+            svcIP := svc.Status.LoadBalancer.Ingress[0].IP
+            log.Info().Str("ip", svcIP).Msg("Istio gateway has the associated IP")
+            return svcIP, nil
+        }
+        if time.Now().After(deadline) {
+            return "", derrors.NewDeadlineExceededError(errors.Coded(errors.WaitTimeout,
+                "timeout reached when waiting for gateway service")).WithParams(i.namespace(), i.ingressGateway())
+        }
+        time.Sleep(gatewayInterval)
+    }
 }
 
 
@@ -318,13 +430,13 @@ func (i *InstallIstio) genCert(template, parent *x509.Certificate, publicKey *rs
 func (i *InstallIstio) createSecrets() derrors.Error {
     log.Debug().Msg("create secrets for Istio installation")
 
-   root_cert, root_cert_pem, root_priv_key, _, err := i.createRootCA()
+   rootCA, err := i.createRootCA()
    if err != nil {
        log.Error().Err(err).Msg("there was a problem generating the cluster CA certificates for Istio")
        return derrors.NewInternalError("there was a problem generating the cluster CA certificates for Istio", err)
    }
 
-    _, ca_cert_pem, _, ca_priv_key_pem, err := i.createClusterCA(root_cert, root_priv_key)
+    clusterCA, err := i.createClusterCA(rootCA)
     if err != nil {
         log.Error().Err(err).Msg("there was a problem generating the cluster root certificates for Istio")
         return derrors.NewInternalError("there was a problem generating the cluster root certificates for Istio", err)
@@ -333,8 +445,8 @@ func (i *InstallIstio) createSecrets() derrors.Error {
 
 
     cert_chain := []byte{}
-    cert_chain = append(cert_chain, ca_cert_pem...)
-    cert_chain = append(cert_chain, root_cert_pem...)
+    cert_chain = append(cert_chain, clusterCA.CertPEM...)
+    cert_chain = append(cert_chain, rootCA.CertPEM...)
 
 
 
@@ -346,15 +458,15 @@ func (i *InstallIstio) createSecrets() derrors.Error {
             APIVersion: "v1",
         },
         ObjectMeta: metaV1.ObjectMeta{
-            Name:         IstioSecretName,
+            Name:         i.caSecretName(),
             GenerateName: "",
-            Namespace:    IstioNamespace,
+            Namespace:    i.namespace(),
         },
         Data: map[string][]byte{
-            "ca-cert.pem":    ca_cert_pem,
-            "ca-key.pem":     ca_priv_key_pem,
+            "ca-cert.pem":    clusterCA.CertPEM,
+            "ca-key.pem":     clusterCA.KeyPEM,
             "cert-chain.pem": cert_chain,
-            "root-cert.pem":  root_cert_pem,
+            "root-cert.pem":  rootCA.CertPEM,
         },
     }
 
@@ -373,110 +485,110 @@ func (i *InstallIstio) createSecrets() derrors.Error {
     return nil
 }
 
-// Create a basic CA with its private key.
-// return:
-//  x509 certificate
-//  PEM representation in raw byte
-//  RSA private key
-//  PEM private key in raw byte
-//  error if any
-func (i *InstallIstio) createRootCA()(*x509.Certificate, []byte, *rsa.PrivateKey, []byte, derrors.Error) {
-
-    caCert := x509.Certificate{
-
-        SerialNumber: big.NewInt(1),
-        Subject: pkix.Name{
-            Organization: []string{"Istio"},
-            CommonName: "Root CA",
-            Country: []string{"ES"},
-        },
-        NotBefore:             time.Now(),
-        NotAfter:              time.Now().Add(IstioCertValidity),
-        KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageEncipherOnly | x509.KeyUsageCertSign | x509.KeyUsageCertSign,
-        ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-        BasicConstraintsValid: true,
-        IsCA:                  true,
-        MaxPathLen:            2,
-        //MaxPathLenZero:        true,
-        URIs: []*url.URL{{Host: "localhost"}},
-        DNSNames: []string{"spiffe://cluster.local/ns/istio-system/sa/citadel",
-            fmt.Sprintf("spiffe://%s/ns/istio-system/sa/citadel", i.ClusterID)},
-    }
-
-    privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-    if err != nil {
-        return nil, nil, nil, nil, derrors.AsError(err, "cannot create private key for Istio CA")
+// trustDomain returns the SPIFFE trust domain of the mesh.
+func (i *InstallIstio) trustDomain() string {
+    if i.TrustDomain == "" {
+        return DefaultTrustDomain
     }
+    return i.TrustDomain
+}
 
-    rootCert, rootPEM, err := i.genCert(&caCert, &caCert, &privateKey.PublicKey, privateKey)
-    if err != nil {
-        return nil, nil, nil, nil, derrors.NewInternalError("cannot generate CA cert", err)
+// namespace returns the namespace where Istio is installed.
+func (i *InstallIstio) namespace() string {
+    if i.Namespace == "" {
+        return IstioNamespace
     }
+    return i.Namespace
+}
 
-    // convert the private key to PEM
-    privPEM := &bytes.Buffer{}
-    err = pem.Encode(privPEM, &pem.Block{
-        Type:  "RSA PRIVATE KEY",
-        Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-    })
-    if err != nil {
-        return nil, nil, nil, nil, derrors.AsError(err, "cannot transform private key to PEM")
+// ingressGateway returns the name of the service of the ingress gateway.
+func (i *InstallIstio) ingressGateway() string {
+    if i.IngressGateway == "" {
+        return IstioIngressGateway
     }
+    return i.IngressGateway
+}
 
-    return rootCert, rootPEM, privateKey, privPEM.Bytes(), nil
+// caSecretName returns the name of the secret with the CAs of Istio.
+func (i *InstallIstio) caSecretName() string {
+    if i.CASecretName == "" {
+        return IstioSecretName
+    }
+    return i.CASecretName
+}
 
+// validateNames checks the names of the Istio resources set in the command.
+func (i *InstallIstio) validateNames() derrors.Error {
+    for _, name := range []string{i.namespace(), i.ingressGateway(), i.caSecretName()} {
+        if err := ValidateResourceName(name); err != nil {
+            return err
+        }
+    }
+    return k8s.ValidateCertificateIssuer(i.CertificateIssuer)
 }
 
-// Create the cluster CA based on the root CA for citadel
-func (i *InstallIstio) createClusterCA(RootCert *x509.Certificate, RootKey *rsa.PrivateKey) (*x509.Certificate, []byte, *rsa.PrivateKey, []byte, derrors.Error) {
+// ingressCertRequest returns the certificate of the ingress gateway, signed by the cluster issuer of the certificate
+// issuer mode. The ACME challenge is only requested to lets encrypt.
+func (i *InstallIstio) ingressCertRequest() string {
+    request := IstioIngressCert
+    if i.CertificateIssuer != k8s.InternalCAMode {
+        request = request + IstioIngressCertACME
+    }
+    request = strings.ReplaceAll(request, ".IssuerName", k8s.CertificateIssuerName(i.CertificateIssuer))
+    return strings.ReplaceAll(request, ".IngressDomain", i.DNSPublicHost)
+}
 
-    DCATemplate := x509.Certificate{
+// citadelIdentities returns the SPIFFE identity of citadel on the trust domain of the mesh, used as URI SAN of the
+// generated CAs.
+func (i *InstallIstio) citadelIdentities() []*url.URL {
+    return []*url.URL{{Scheme: "spiffe", Host: i.trustDomain(), Path: fmt.Sprintf("/ns/%s/sa/citadel", i.namespace())}}
+}
 
-        SerialNumber: big.NewInt(1),
+// Create a basic CA with its private key.
+// return:
+//  The root CA with its private key
+//  error if any
+func (i *InstallIstio) createRootCA() (*pki.Certificate, derrors.Error) {
+    rootCA, err := pki.SelfSigned(pki.Request{
         Subject: pkix.Name{
             Organization: []string{"Istio"},
-            CommonName: "Cluster CA",
-            Country: []string{"ES"},
+            CommonName:   "Root CA",
+            Country:      []string{"ES"},
         },
-        NotBefore:             time.Now(),
-        NotAfter:              time.Now().Add(IstioCertValidity),
-        KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageEncipherOnly | x509.KeyUsageCertSign | x509.KeyUsageCertSign,
-        ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-        BasicConstraintsValid: true,
-        IsCA:                  true,
-        MaxPathLen:            1,
-        //MaxPathLenZero:        true,
-        URIs: []*url.URL{{Host: "localhost"}},
-        DNSNames: []string{"spiffe://cluster.local/ns/istio-system/sa/citadel",
-            fmt.Sprintf("spiffe://%s/ns/istio-system/sa/citadel", i.ClusterID)},
-    }
-
-    priv, err := rsa.GenerateKey(rand.Reader, 2048)
-    if err != nil {
-        return nil, nil, nil, nil, derrors.AsError(err, "cannot create private key for Istio cluster cert")
-    }
-
-    DCACert, DCAPEM, err := i.genCert(&DCATemplate, RootCert, &priv.PublicKey, RootKey)
+        URIs:       i.citadelIdentities(),
+        Validity:   IstioCertValidity,
+        IsCA:       true,
+        MaxPathLen: 2,
+    })
     if err != nil {
-        return nil, nil, nil, nil, derrors.NewInternalError("impossible to generate cluster certificate", err)
+        return nil, derrors.NewInternalError("cannot generate CA cert", err)
     }
+    return rootCA, nil
+}
 
-
-    // Get the private key in pem
-    privPEM := &bytes.Buffer{}
-    err = pem.Encode(privPEM, &pem.Block{
-        Type:  "RSA PRIVATE KEY",
-        Bytes: x509.MarshalPKCS1PrivateKey(priv),
-    })
+// Create the cluster CA based on the root CA for citadel
+func (i *InstallIstio) createClusterCA(rootCA *pki.Certificate) (*pki.Certificate, derrors.Error) {
+    clusterCA, err := pki.Issue(pki.Request{
+        Subject: pkix.Name{
+            Organization: []string{"Istio"},
+            CommonName:   "Cluster CA",
+            Country:      []string{"ES"},
+        },
+        URIs:       i.citadelIdentities(),
+        Validity:   IstioCertValidity,
+        IsCA:       true,
+        MaxPathLen: 1,
+    }, rootCA)
     if err != nil {
-        return nil, nil, nil, nil, derrors.AsError(err, "cannot transform private key to PEM")
+        return nil, derrors.NewInternalError("impossible to generate cluster certificate", err)
     }
-
-
-    return DCACert, DCAPEM, priv, privPEM.Bytes(), nil
+    return clusterCA, nil
 }
 
 
+// certificates is the resource of the cert-manager certificates.
+var certificates = schema.GroupVersionResource{Group: "certmanager.k8s.io", Version: "v1alpha1", Resource: "certificates"}
+
 func (i* InstallIstio) waitCertificate() derrors.Error {
     // wait until the certificate is ready. Otherwise the ingressgateway will not update correctly the ca secret
     log.Info().Msg("wait until the letsencrypt certificate is up and ready...")
@@ -488,17 +600,14 @@ func (i* InstallIstio) waitCertificate() derrors.Error {
         select {
         case <-ticker.C:
             // Check if the certificate is ready
-            issued, err := i.Kubernetes.MatchCRDStatus(
-                IstioNamespace, "certmanager.k8s.io",
-                "v1alpha1",
-                "certificates", "ingress-cert",
-                []string{"status", "conditions", "0", "status"}, "True")
+            issued, err := i.Kubernetes.MatchField(i.namespace(), certificates, "ingress-cert",
+                "{.status.conditions[0].status}", "True")
 
             if err != nil {
-                log.Error().Err(err).Msg("error when retrieving information about the istio certificate")
+                log.Error().Str("trace", err.DebugReport()).Msg("error when retrieving information about the istio certificate")
                 return err
             }
-            if *issued {
+            if issued {
                 log.Info().Msg("the certificate was correctly issued.")
                 ticker.Stop()
                 tickerInfo.Stop()
@@ -508,7 +617,7 @@ func (i* InstallIstio) waitCertificate() derrors.Error {
             log.Info().Msg("...waiting for the certificate to be issued")
         case <- timeout:
             log.Error().Msg("exceeded time waiting for Istio certificate to be up and ready")
-            return derrors.NewInternalError("exceeded time waiting for Istio certificate to be up and ready")
+            return derrors.NewInternalError(errors.Coded(errors.CertTimeout, "exceeded time waiting for Istio certificate to be up and ready"))
         }
     }
     return nil
@@ -520,7 +629,7 @@ func (i *InstallIstio) installInMaster() derrors.Error {
     // install the certificate
     log.Info().Msg("install Istio gateway certificate")
 
-    request := strings.ReplaceAll(IstioIngressCert,".IngressDomain", i.DNSPublicHost)
+    request := i.ingressCertRequest()
 
     log.Debug().Str("cerrequest",request).Msg("generate certificate request")
     err := i.CreateRawObject(request)
@@ -556,16 +665,23 @@ func (i *InstallIstio) installInMaster() derrors.Error {
         "--set", "values.global.k8sIngress.enableHttps=true",
         "--set", "values.global.k8sIngress.gatewayName=ingressgateway",
         "--set", fmt.Sprintf("values.gateways.istio-ingressgateway.loadBalancerIP=%s",i.StaticIpAddress),
+        "--set", "values.global.trustDomain="+i.trustDomain(),
+        "--set", "defaultNamespace="+i.namespace(),
+        "--set", "values.global.istioNamespace="+i.namespace(),
         "-f", file.Name(),
     }
 
     log.Debug().Interface("istioctl",args).Msg("istioctl was called")
 
-    rExec := sync.NewExec(fmt.Sprintf("%s/istioctl", i.IstioPath),args)
+    cmd, cmdArgs, err := IstioctlCommand(i.IstioPath, i.IstioctlImage, args)
+    if err != nil {
+        return err
+    }
+    rExec := sync.NewExec(cmd, cmdArgs)
     _, err = rExec.Run("")
 
     if err != nil {
-        return err
+        return derrors.NewInternalError(errors.Coded(errors.IstioctlFailed, "cannot install istio")).CausedBy(err)
     }
 
 
@@ -573,7 +689,7 @@ func (i *InstallIstio) installInMaster() derrors.Error {
 
     // patch default ingress-gateway to set sds and the certificate
     log.Info().Msg("patch Istio default ingress gateway to accept SDS")
-    _, patchErr := i.Istio.NetworkingV1alpha3().Gateways(IstioNamespace).Patch("istio-autogenerated-k8s-ingress", types.JSONPatchType,
+    _, patchErr := i.Istio.NetworkingV1alpha3().Gateways(i.namespace()).Patch("istio-autogenerated-k8s-ingress", types.JSONPatchType,
        []byte(IstioIngressPatch))
     if patchErr != nil {
 
@@ -585,42 +701,50 @@ func (i *InstallIstio) installInMaster() derrors.Error {
 
 
 
-func (i *InstallIstio) installInSlave() derrors.Error {
-
-    log.Debug().Msg("install Istio slave")
-
-
-    // We create a local kube client to check the istio ingress ip
-    log.Debug().Msg("create cluster config")
-    config, err := rest.InClusterConfig()
-    if err != nil {
-        log.Error().Err(err).Msg("impossible to get master cluster k8s configuration")
-        return derrors.NewInternalError("impossible to get master cluster k8s configuration", err)
+// managementGatewayIP returns the IP of the ingress gateway of the management cluster, as set in the command or looked
+// up in the management cluster.
+func (i *InstallIstio) managementGatewayIP() (string, derrors.Error) {
+    if i.ManagementGatewayIP != "" {
+        if net.ParseIP(i.ManagementGatewayIP) == nil {
+            return "", derrors.NewInvalidArgumentError("invalid management gateway IP").WithParams(i.ManagementGatewayIP)
+        }
+        return i.ManagementGatewayIP, nil
     }
-
-    log.Debug().Msg("create local client")
-    localClient, err := kubernetes.NewForConfig(config)
-    if err != nil {
-        log.Error().Err(err).Msg("impossible to instantiate k8s client for master cluster")
-        return derrors.NewInternalError("impossible to instantiate k8s client for master cluster", err)
+    management := &k8s.Kubernetes{KubeConfigPath: i.ManagementKubeConfigPath}
+    if err := management.Connect(); err != nil {
+        return "", derrors.NewInternalError("impossible to connect to the management cluster").CausedBy(err)
     }
+    return GatewayIP(management, i.namespace(), i.ingressGateway())
+}
 
-    log.Debug().Msg("get istio ingress gateway")
-    svc, err := localClient.CoreV1().Services(IstioNamespace).Get(IstioIngressGateway, metaV1.GetOptions{})
+// GatewayIP retrieves the IP assigned to the load balancer of an ingress gateway.
+//   params:
+//     cluster The cluster where the gateway runs, already connected.
+//     namespace The namespace of the gateway service.
+//     name The name of the gateway service.
+//   returns:
+//     The IP of the gateway.
+//     An error if the service cannot be retrieved or has no IP assigned yet.
+func GatewayIP(cluster *k8s.Kubernetes, namespace string, name string) (string, derrors.Error) {
+    svc, err := cluster.Client.CoreV1().Services(namespace).Get(name, metaV1.GetOptions{})
     if err != nil {
-        log.Error().Err(err).Msg("impossible to find istio gateway service IP")
-        return derrors.NewInternalError("impossible to find istio gateway service IP", err)
+        return "", k8s.AsQueryError(err, "impossible to find istio gateway service", namespace, name)
     }
-    log.Debug().Interface("svc",svc).Msg("istio svc")
-
-    if len(svc.Status.LoadBalancer.Ingress) == 0 {
-        log.Error().Msg("no available Istio ingress IP for master cluster")
-        return derrors.NewInternalError("no available Istio ingress IP for master cluster")
+    if len(svc.Status.LoadBalancer.Ingress) == 0 || svc.Status.LoadBalancer.Ingress[0].IP == "" {
+        return "", derrors.NewUnavailableError("there is no public IP for istio master gateway").WithParams(namespace, name)
     }
+    return svc.Status.LoadBalancer.Ingress[0].IP, nil
+}
 
-    gatewayIP := svc.Status.LoadBalancer.Ingress[0].IP
-    if gatewayIP == "" {
-        return derrors.NewInternalError("there is no public IP for istio master gateway")
+func (i *InstallIstio) installInSlave() derrors.Error {
+
+    log.Debug().Msg("install Istio slave")
+
+
+    gatewayIP, err := i.managementGatewayIP()
+    if err != nil {
+        log.Error().Str("trace", err.DebugReport()).Msg("impossible to find istio gateway service IP")
+        return err
     }
     log.Info().Str("ip",gatewayIP).Msg("found istio ingressgateway ip in management cluster")
 
@@ -639,16 +763,23 @@ func (i *InstallIstio) installInSlave() derrors.Error {
          "--set", "values.global.remoteTelemetryAddress="+gatewayIP,
          "--set", "values.gateways.istio-ingressgateway.env.ISTIO_META_NETWORK="+i.ClusterID,
          "--set", "values.global.network="+i.ClusterID,
+         "--set", "values.global.trustDomain="+i.trustDomain(),
+         "--set", "defaultNamespace="+i.namespace(),
+         "--set", "values.global.istioNamespace="+i.namespace(),
          "--set", "autoInjection.enabled=true",
      }
 
-    log.Debug().Str("istio",fmt.Sprintf("%s/istioctl",i.IstioPath)).Interface("args",args).Msg("istioctl call")
-    rExec := sync.NewExec(fmt.Sprintf("%s/istioctl",i.IstioPath),args)
+    cmd, cmdArgs, cmdErr := IstioctlCommand(i.IstioPath, i.IstioctlImage, args)
+    if cmdErr != nil {
+        return cmdErr
+    }
+    log.Debug().Str("istio",cmd).Interface("args",cmdArgs).Msg("istioctl call")
+    rExec := sync.NewExec(cmd, cmdArgs)
     x, execErr := rExec.Run("")
     log.Debug().Str("istioctl",x.Output).Msg("output from istioctl")
     if execErr != nil {
         log.Error().Err(execErr).Msg("error when executing istioctl")
-        return execErr
+        return derrors.NewInternalError(errors.Coded(errors.IstioctlFailed, "error when executing istioctl")).CausedBy(execErr)
     }
 
     return nil
@@ -659,7 +790,7 @@ func (i *InstallIstio) installGateway() derrors.Error {
     gw := istioNetworking.Gateway{
         ObjectMeta: metaV1.ObjectMeta{
             Name: "cluster-aware-gateway",
-            Namespace: IstioNamespace,
+            Namespace: i.namespace(),
         },
         Spec: v1alpha3.Gateway{
             Selector: map[string]string{
@@ -683,7 +814,7 @@ func (i *InstallIstio) installGateway() derrors.Error {
         },
     }
 
-    _, err := i.Istio.NetworkingV1alpha3().Gateways(IstioNamespace).Create(&gw)
+    _, err := i.Istio.NetworkingV1alpha3().Gateways(i.namespace()).Create(&gw)
     if err != nil {
         return derrors.NewInternalError("error generating error", err)
     }
@@ -694,7 +825,7 @@ func (i *InstallIstio) installGateway() derrors.Error {
 
 
 func (i *InstallIstio) String() string {
-    return fmt.Sprintf("SYNC InstallIstio")
+    return fmt.Sprintf("SYNC InstallIstio trust domain %s namespace %s", i.trustDomain(), i.namespace())
 }
 
 func (i *InstallIstio) PrettyPrint(indentation int) string {
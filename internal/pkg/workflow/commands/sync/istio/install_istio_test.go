@@ -0,0 +1,218 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package istio
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	istioClient "istio.io/client-go/pkg/clientset/versioned"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// stubClientFactory records the commands that requested an Istio client.
+type stubClientFactory struct {
+	calls  []string
+	client istioClient.Interface
+	err    derrors.Error
+}
+
+func (sf *stubClientFactory) NewIstioClient(target *k8s.Kubernetes) (istioClient.Interface, derrors.Error) {
+	sf.calls = append(sf.calls, target.KubeConfigPath)
+	return sf.client, sf.err
+}
+
+// stubIstio is a non nil Istio client whose methods are not expected to be called.
+type stubIstio struct {
+	istioClient.Interface
+}
+
+var _ = ginkgo.Describe("An InstallIstio command", func() {
+
+	ginkgo.It("should validate the trust domain", func() {
+		gomega.Expect(ValidateTrustDomain(DefaultTrustDomain)).To(gomega.Succeed())
+		gomega.Expect(ValidateTrustDomain("mesh.nalej.tech")).To(gomega.Succeed())
+		for _, invalid := range []string{"", "spiffe://cluster.local", "Cluster.Local", "cluster.local:443", "-mesh", "mesh..tech"} {
+			gomega.Expect(ValidateTrustDomain(invalid)).NotTo(gomega.Succeed(), invalid)
+		}
+	})
+
+	ginkgo.It("should generate the CAs with the SPIFFE identity of citadel", func() {
+		command := &InstallIstio{ClusterID: "cluster1"}
+		rootCA, err := command.createRootCA()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(rootCA.Certificate.DNSNames).To(gomega.BeEmpty())
+		gomega.Expect(rootCA.Certificate.URIs).To(gomega.HaveLen(1))
+		gomega.Expect(rootCA.Certificate.URIs[0].String()).To(gomega.Equal("spiffe://cluster.local/ns/istio-system/sa/citadel"))
+
+		command.TrustDomain = "mesh.nalej.tech"
+		clusterCA, err := command.createClusterCA(rootCA)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(clusterCA.Certificate.URIs[0].String()).To(gomega.Equal("spiffe://mesh.nalej.tech/ns/istio-system/sa/citadel"))
+		gomega.Expect(clusterCA.Certificate.SerialNumber.Cmp(rootCA.Certificate.SerialNumber)).NotTo(gomega.BeZero())
+		gomega.Expect(clusterCA.Certificate.CheckSignatureFrom(rootCA.Certificate)).To(gomega.Succeed())
+		gomega.Expect(clusterCA.Certificate.KeyUsage & x509.KeyUsageCertSign).NotTo(gomega.BeZero())
+	})
+	ginkgo.It("should fail to create the command with an invalid istio path", func() {
+		command, err := NewInstallIstio("kubeconfig", "/does/not/exist", "cluster1", false, "", "/tmp", "")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		gomega.Expect(command).To(gomega.BeNil())
+		_, err = NewInstallIstio("kubeconfig", "", "cluster1", false, "", "/tmp", "")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should create the command without connecting to the cluster", func() {
+		istioPath, err := ioutil.TempDir("", "istio")
+		gomega.Expect(err).To(gomega.Succeed())
+		defer os.RemoveAll(istioPath)
+
+		command, cErr := NewInstallIstio("/does/not/exist/kubeconfig", istioPath, "cluster1", true, "", "/tmp", "")
+		gomega.Expect(cErr).To(gomega.Succeed())
+		gomega.Expect(command.Name()).To(gomega.Equal(entities.InstallIstio))
+		gomega.Expect(command.IstioPath).To(gomega.Equal(istioPath))
+		gomega.Expect(command.Istio).To(gomega.BeNil())
+
+		binary := filepath.Join(istioPath, "istioctl")
+		gomega.Expect(ioutil.WriteFile(binary, []byte{}, 0700)).To(gomega.Succeed())
+		gomega.Expect(ValidateIstioPath(binary)).NotTo(gomega.Succeed())
+	})
+	ginkgo.It("should be parsed and printed without creating clients", func() {
+		raw := []byte(`{"kubeConfigPath":"/does/not/exist/kubeconfig", "istio_path":"/does/not/exist", "cluster_id":"cluster1", "trust_domain":"mesh.nalej.tech"}`)
+		cmd, err := NewInstallIstioFromJSON(raw)
+		gomega.Expect(err).To(gomega.Succeed())
+		command := (*cmd).(*InstallIstio)
+		gomega.Expect(command.Istio).To(gomega.BeNil())
+		gomega.Expect(command.PrettyPrint(0)).To(gomega.ContainSubstring("mesh.nalej.tech"))
+	})
+
+	ginkgo.It("should create the Istio client with the configured factory", func() {
+		factory := &stubClientFactory{client: &stubIstio{}}
+		command := (&InstallIstio{}).WithClientFactory(factory)
+		command.KubeConfigPath = "kubeconfig"
+		gomega.Expect(command.connectIstio()).To(gomega.Succeed())
+		gomega.Expect(command.Istio).To(gomega.Equal(factory.client))
+		gomega.Expect(command.connectIstio()).To(gomega.Succeed())
+		gomega.Expect(factory.calls).To(gomega.Equal([]string{"kubeconfig"}))
+	})
+
+	ginkgo.It("should fail if the Istio client cannot be created", func() {
+		factory := &stubClientFactory{err: derrors.NewUnavailableError("cluster not reachable")}
+		command := (&InstallIstio{}).WithClientFactory(factory)
+		gomega.Expect(command.connectIstio()).NotTo(gomega.Succeed())
+		gomega.Expect(command.Istio).To(gomega.BeNil())
+	})
+	ginkgo.It("should use the configured names of the Istio resources", func() {
+		command := &InstallIstio{ClusterID: "cluster1"}
+		gomega.Expect(command.namespace()).To(gomega.Equal(IstioNamespace))
+		gomega.Expect(command.ingressGateway()).To(gomega.Equal(IstioIngressGateway))
+		gomega.Expect(command.caSecretName()).To(gomega.Equal(IstioSecretName))
+		gomega.Expect(command.validateNames()).To(gomega.Succeed())
+
+		command.Namespace = "istio-system-rev1"
+		command.IngressGateway = "ingressgateway-rev1"
+		command.CASecretName = "cacerts-rev1"
+		gomega.Expect(command.validateNames()).To(gomega.Succeed())
+		gomega.Expect(command.citadelIdentities()[0].String()).To(gomega.Equal("spiffe://cluster.local/ns/istio-system-rev1/sa/citadel"))
+		gomega.Expect(command.String()).To(gomega.ContainSubstring("namespace istio-system-rev1"))
+
+		for _, invalid := range []string{"Istio-System", "istio_system", "-istio", "istio.system"} {
+			command.Namespace = invalid
+			gomega.Expect(command.validateNames()).NotTo(gomega.Succeed(), invalid)
+		}
+	})
+	ginkgo.It("should request the ingress certificate to the configured issuer", func() {
+		command := &InstallIstio{ClusterID: "cluster1", DNSPublicHost: "nalej.tech"}
+		request := command.ingressCertRequest()
+		gomega.Expect(request).To(gomega.ContainSubstring("name: " + k8s.LetsEncryptIssuer))
+		gomega.Expect(request).To(gomega.ContainSubstring("acme:"))
+		gomega.Expect(request).To(gomega.ContainSubstring("'*.master.nalej.tech'"))
+
+		command.CertificateIssuer = k8s.InternalCAMode
+		gomega.Expect(command.validateNames()).To(gomega.Succeed())
+		request = command.ingressCertRequest()
+		gomega.Expect(request).To(gomega.ContainSubstring("name: " + k8s.InternalCAIssuer))
+		gomega.Expect(request).NotTo(gomega.ContainSubstring("acme:"))
+		gomega.Expect(request).To(gomega.ContainSubstring("commonName: '*.nalej.tech'"))
+
+		command.CertificateIssuer = "selfsigned"
+		gomega.Expect(command.validateNames()).NotTo(gomega.Succeed())
+	})
+	ginkgo.Context("looking up the gateway of the management cluster", func() {
+
+		var cluster *k8stest.FakeCluster
+
+		ginkgo.BeforeEach(func() {
+			gateway := &v1.Service{ObjectMeta: metaV1.ObjectMeta{Name: IstioIngressGateway, Namespace: IstioNamespace}}
+			gateway.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+			cluster = k8stest.NewFakeCluster(gateway)
+			k8s.RegisterClients(cluster.KubeConfigPath, cluster.Client, cluster.Discovery, cluster.Dynamic)
+		})
+
+		ginkgo.AfterEach(func() {
+			k8s.UnregisterClients(cluster.KubeConfigPath)
+		})
+
+		ginkgo.It("should use the kubeconfig of the management cluster", func() {
+			command := &InstallIstio{ManagementKubeConfigPath: cluster.KubeConfigPath}
+			ip, err := command.managementGatewayIP()
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(ip).To(gomega.Equal("10.0.0.1"))
+
+			command.IngressGateway = "missing"
+			_, err = command.managementGatewayIP()
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should use the gateway IP of the command", func() {
+			command := &InstallIstio{ManagementKubeConfigPath: cluster.KubeConfigPath, ManagementGatewayIP: "10.0.0.2"}
+			ip, err := command.managementGatewayIP()
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(ip).To(gomega.Equal("10.0.0.2"))
+
+			command.ManagementGatewayIP = "gateway"
+			_, err = command.managementGatewayIP()
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should wait for the gateway IP until the timeout", func() {
+			previousInterval := gatewayInterval
+			gatewayInterval = 10 * time.Millisecond
+			defer func() { gatewayInterval = previousInterval }()
+
+			command := &InstallIstio{Kubernetes: k8s.Kubernetes{Client: cluster.Client}, GatewayTimeoutSeconds: 1}
+			ip, err := command.waitForGatewayIP()
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(ip).To(gomega.Equal("10.0.0.1"))
+
+			command.IngressGateway = "missing"
+			_, err = command.waitForGatewayIP()
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+})
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Selection of the istioctl binary of the host platform in the Istio path, so the same asset bundle can be used from
+// Linux, macOS and Windows. If the bundle has no binary for the host, or there is no bundle, istioctl is run in a
+// container of a pinned image.
+
+package istio
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/utils"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync"
+)
+
+// IstioctlBinary is the name of the istioctl binary.
+const IstioctlBinary = "istioctl"
+
+// IstioctlCommand returns the command running istioctl with a set of arguments.
+//   params:
+//     istioPath The directory with the istioctl binaries.
+//     image The pinned image of istioctl used if there is no binary for the host platform, empty to disable the
+//       container.
+//     args The arguments of istioctl.
+//   returns:
+//     The binary to be executed.
+//     The arguments of the binary.
+//     An error if there is no binary for the host platform and no valid image.
+func IstioctlCommand(istioPath string, image string, args []string) (string, []string, derrors.Error) {
+	if istioPath != "" {
+		if binary, found := utils.PlatformBinary(istioPath, IstioctlBinary); found {
+			return binary, args, nil
+		}
+	}
+	if image == "" {
+		return "", nil, derrors.NewNotFoundError(errors.Coded(errors.IstioctlFailed,
+			"cannot find istioctl for the host platform and no istioctl image is set")).WithParams(istioPath)
+	}
+	if err := sync.ValidatePinnedImage(image); err != nil {
+		return "", nil, err
+	}
+	cmd, cmdArgs := sync.ContainerCommand(image, IstioctlBinary, nil, args)
+	return cmd, cmdArgs, nil
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package istio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("The istioctl command", func() {
+
+	var istioPath string
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		istioPath, err = ioutil.TempDir("", "istio")
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		gomega.Expect(os.RemoveAll(istioPath)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should fail without a binary for the host platform or an image", func() {
+		_, _, err := IstioctlCommand(istioPath, "", []string{"version"})
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should run istioctl in a container mounting the referenced files", func() {
+		kubeConfig := filepath.Join(istioPath, "kubeconfig.yaml")
+		gomega.Expect(ioutil.WriteFile(kubeConfig, []byte("config"), 0600)).To(gomega.Succeed())
+		cmd, args, err := IstioctlCommand(istioPath, "istio/istioctl:1.5.0",
+			[]string{"manifest", "apply", "--kubeconfig=" + kubeConfig, "-f", kubeConfig, "--set", "values.global.trustDomain=mesh"})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(cmd).To(gomega.Equal(sync.ContainerRuntime))
+		gomega.Expect(args).To(gomega.Equal([]string{"run", "--rm", "--network", "host", "--entrypoint", IstioctlBinary,
+			"-v", istioPath + ":" + istioPath,
+			"istio/istioctl:1.5.0", "manifest", "apply", "--kubeconfig=" + kubeConfig, "-f", kubeConfig, "--set",
+			"values.global.trustDomain=mesh"}))
+	})
+
+	ginkgo.It("should reject images that are not pinned", func() {
+		_, _, err := IstioctlCommand(istioPath, "istio/istioctl:latest", []string{"version"})
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, _, err = IstioctlCommand("", "istio/istioctl@sha256:2f1ad4d6e4c2b7d1", []string{"version"})
+		gomega.Expect(err).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should prefer the binary of the istio path", func() {
+		binary := filepath.Join(istioPath, IstioctlBinary)
+		gomega.Expect(ioutil.WriteFile(binary, []byte("binary"), 0755)).To(gomega.Succeed())
+		cmd, args, err := IstioctlCommand(istioPath, "istio/istioctl:1.5.0", []string{"version"})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(cmd).To(gomega.Equal(binary))
+		gomega.Expect(args).To(gomega.Equal([]string{"version"}))
+	})
+})
@@ -0,0 +1,220 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Configure sidecar injection command
+// Labels the namespaces of a cluster so the Istio sidecar is injected or not in their pods. Each cluster role has a
+// default policy, extended by the namespaces of the command. If a revision is set, the enabled namespaces select the
+// injector of that revision, as required by canary upgrades of the control plane.
+//
+// {"type":"sync", "name":"configureSidecarInjection", "kubeConfigPath":"/path/kubeconfig.yaml",
+// "cluster_role":"management", "revision":"1-5-0", "enabled_namespaces":["apps"], "disabled_namespaces":[]}
+
+package istio
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// InjectionLabel enables or disables the injection of the default sidecar injector.
+	InjectionLabel = "istio-injection"
+	// RevisionLabel selects the sidecar injector of a revision of the control plane.
+	RevisionLabel = "istio.io/rev"
+	// InjectionEnabled is the value of the InjectionLabel of the namespaces with injection.
+	InjectionEnabled = "enabled"
+	// InjectionDisabled is the value of the InjectionLabel of the namespaces without injection.
+	InjectionDisabled = "disabled"
+)
+
+const (
+	// ManagementClusterRole is the role of the management cluster.
+	ManagementClusterRole = "management"
+	// AppClusterRole is the role of the application clusters.
+	AppClusterRole = "appcluster"
+)
+
+// InjectionPolicy with the namespaces where the sidecar is injected or not.
+type InjectionPolicy struct {
+	Enabled  []string
+	Disabled []string
+}
+
+// DefaultInjectionPolicies contains the policy of each cluster role. The platform components are part of the mesh,
+// while the system namespaces and the ingress controller are kept out of it.
+var DefaultInjectionPolicies = map[string]InjectionPolicy{
+	ManagementClusterRole: {
+		Enabled:  []string{k8s.TargetNamespace},
+		Disabled: []string{"kube-system", "kube-public", IstioNamespace, "ingress-nginx"},
+	},
+	AppClusterRole: {
+		Enabled:  []string{k8s.TargetNamespace},
+		Disabled: []string{"kube-system", "kube-public", IstioNamespace, "ingress-nginx"},
+	},
+}
+
+// ConfigureSidecarInjection structure with the namespaces whose sidecar injection is configured.
+type ConfigureSidecarInjection struct {
+	k8s.Kubernetes
+	// ClusterRole selecting the default policy, see DefaultInjectionPolicies.
+	ClusterRole string `json:"cluster_role"`
+	// Revision of the control plane whose injector is used. The default injector is used if not set.
+	Revision string `json:"revision"`
+	// EnabledNamespaces with the namespaces with injection in addition to the ones of the cluster role.
+	EnabledNamespaces []string `json:"enabled_namespaces"`
+	// DisabledNamespaces with the namespaces without injection in addition to the ones of the cluster role.
+	DisabledNamespaces []string `json:"disabled_namespaces"`
+}
+
+// NewConfigureSidecarInjection creates a new ConfigureSidecarInjection command.
+func NewConfigureSidecarInjection(kubeConfigPath string, clusterRole string, revision string) *ConfigureSidecarInjection {
+	return &ConfigureSidecarInjection{
+		Kubernetes: k8s.Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.ConfigureSidecarInjection),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		ClusterRole: clusterRole,
+		Revision:    revision,
+	}
+}
+
+// NewConfigureSidecarInjectionFromJSON creates a new ConfigureSidecarInjection command from a raw JSON representation.
+func NewConfigureSidecarInjectionFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	csi := &ConfigureSidecarInjection{}
+	if err := json.Unmarshal(raw, &csi); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	csi.CommandID = entities.GenerateCommandID(csi.Name())
+	var r entities.Command = csi
+	return &r, nil
+}
+
+// Policy returns the policy of the cluster role extended with the namespaces of the command. The namespaces of the
+// command take precedence over the ones of the cluster role.
+//   returns:
+//     The sorted namespaces with and without injection.
+//     An error if the cluster role is not known.
+func (csi *ConfigureSidecarInjection) Policy() (*InjectionPolicy, derrors.Error) {
+	defaults, found := DefaultInjectionPolicies[csi.ClusterRole]
+	if !found {
+		return nil, derrors.NewInvalidArgumentError("unknown cluster role").WithParams(csi.ClusterRole)
+	}
+	injected := make(map[string]bool, 0)
+	for _, namespace := range defaults.Enabled {
+		injected[namespace] = true
+	}
+	for _, namespace := range defaults.Disabled {
+		injected[namespace] = false
+	}
+	for _, namespace := range csi.EnabledNamespaces {
+		injected[namespace] = true
+	}
+	for _, namespace := range csi.DisabledNamespaces {
+		injected[namespace] = false
+	}
+	policy := &InjectionPolicy{Enabled: make([]string, 0), Disabled: make([]string, 0)}
+	for namespace, enabled := range injected {
+		if enabled {
+			policy.Enabled = append(policy.Enabled, namespace)
+		} else {
+			policy.Disabled = append(policy.Disabled, namespace)
+		}
+	}
+	sort.Strings(policy.Enabled)
+	sort.Strings(policy.Disabled)
+	return policy, nil
+}
+
+// injectionLabels returns the labels to be set on a namespace and the ones to be removed.
+func (csi *ConfigureSidecarInjection) injectionLabels(enabled bool) (map[string]string, []string) {
+	if !enabled {
+		return map[string]string{InjectionLabel: InjectionDisabled}, []string{RevisionLabel}
+	}
+	// The injection label takes precedence over the revision one, so it must be removed to select a revision.
+	if csi.Revision != "" {
+		return map[string]string{RevisionLabel: csi.Revision}, []string{InjectionLabel}
+	}
+	return map[string]string{InjectionLabel: InjectionEnabled}, []string{RevisionLabel}
+}
+
+// labelNamespace updates the injection labels of a namespace, creating it if needed.
+func (csi *ConfigureSidecarInjection) labelNamespace(name string, enabled bool) derrors.Error {
+	set, removed := csi.injectionLabels(enabled)
+	return csi.EnsureNamespace(name, k8s.NamespaceOptions{Labels: set, RemovedLabels: removed})
+}
+
+// Run the current command.
+//   returns:
+//     The CommandResult
+//     An error if the command execution fails
+func (csi *ConfigureSidecarInjection) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := csi.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	policy, err := csi.Policy()
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot determine injection policy", err), nil
+	}
+	// Namespaces with injection are created so the pods created later get the sidecar.
+	for _, namespace := range policy.Enabled {
+		if err := csi.labelNamespace(namespace, true); err != nil {
+			return entities.NewCommandResult(false, "cannot enable sidecar injection", err), nil
+		}
+	}
+	for _, namespace := range policy.Disabled {
+		if _, gErr := csi.Client.CoreV1().Namespaces().Get(namespace, metaV1.GetOptions{}); k8sErrors.IsNotFound(gErr) {
+			log.Debug().Str("namespace", namespace).Msg("namespace not found, skipping sidecar injection")
+			continue
+		}
+		if err := csi.labelNamespace(namespace, false); err != nil {
+			return entities.NewCommandResult(false, "cannot disable sidecar injection", err), nil
+		}
+	}
+	log.Info().Strs("enabled", policy.Enabled).Strs("disabled", policy.Disabled).Str("revision", csi.Revision).
+		Msg("sidecar injection configured")
+	msg := fmt.Sprintf("sidecar injection enabled on %s", strings.Join(policy.Enabled, ", "))
+	return entities.NewSuccessCommand([]byte(msg)), nil
+}
+
+// String returns a string representation
+func (csi *ConfigureSidecarInjection) String() string {
+	if csi.Revision != "" {
+		return fmt.Sprintf("SYNC ConfigureSidecarInjection for %s with revision %s", csi.ClusterRole, csi.Revision)
+	}
+	return fmt.Sprintf("SYNC ConfigureSidecarInjection for %s", csi.ClusterRole)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (csi *ConfigureSidecarInjection) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + csi.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (csi *ConfigureSidecarInjection) UserString() string {
+	return fmt.Sprintf("Configuring Istio sidecar injection for the %s cluster", csi.ClusterRole)
+}
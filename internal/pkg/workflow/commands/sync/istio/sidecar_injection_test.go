@@ -0,0 +1,90 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package istio
+
+import (
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = ginkgo.Describe("A ConfigureSidecarInjection command", func() {
+
+	var cluster *k8stest.FakeCluster
+
+	namespace := func(name string, labels map[string]string) *v1.Namespace {
+		return &v1.Namespace{ObjectMeta: metaV1.ObjectMeta{Name: name, Labels: labels}}
+	}
+
+	labels := func(name string) map[string]string {
+		ns, err := cluster.Client.CoreV1().Namespaces().Get(name, metaV1.GetOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+		return ns.Labels
+	}
+
+	ginkgo.BeforeEach(func() {
+		cluster = k8stest.NewFakeCluster(namespace("kube-system", nil), namespace("apps", nil))
+		k8s.RegisterClients(cluster.KubeConfigPath, cluster.Client, cluster.Discovery, cluster.Dynamic)
+	})
+
+	ginkgo.AfterEach(func() {
+		k8s.UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	ginkgo.It("should extend the policy of the cluster role", func() {
+		cmd := NewConfigureSidecarInjection(cluster.KubeConfigPath, AppClusterRole, "")
+		cmd.EnabledNamespaces = []string{"apps", "ingress-nginx"}
+		cmd.DisabledNamespaces = []string{"nalej"}
+		policy, err := cmd.Policy()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(policy.Enabled).To(gomega.Equal([]string{"apps", "ingress-nginx"}))
+		gomega.Expect(policy.Disabled).To(gomega.ContainElement("nalej"))
+		gomega.Expect(policy.Disabled).NotTo(gomega.ContainElement("ingress-nginx"))
+
+		cmd.ClusterRole = "unknown"
+		_, err = cmd.Policy()
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should label the namespaces of a management cluster", func() {
+		cmd := NewConfigureSidecarInjection(cluster.KubeConfigPath, ManagementClusterRole, "")
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(labels(k8s.TargetNamespace)).To(gomega.HaveKeyWithValue(InjectionLabel, InjectionEnabled))
+		gomega.Expect(labels("kube-system")).To(gomega.HaveKeyWithValue(InjectionLabel, InjectionDisabled))
+		gomega.Expect(labels("apps")).NotTo(gomega.HaveKey(InjectionLabel))
+		cluster.ExpectNoObject("v1", "Namespace", "", IstioNamespace)
+	})
+
+	ginkgo.It("should select the injector of a revision", func() {
+		cluster.Tracker.Add(namespace(k8s.TargetNamespace, map[string]string{InjectionLabel: InjectionEnabled, "app": "nalej"}))
+		cmd := NewConfigureSidecarInjection(cluster.KubeConfigPath, ManagementClusterRole, "1-5-0")
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		nalej := labels(k8s.TargetNamespace)
+		gomega.Expect(nalej).To(gomega.HaveKeyWithValue(RevisionLabel, "1-5-0"))
+		gomega.Expect(nalej).NotTo(gomega.HaveKey(InjectionLabel))
+		gomega.Expect(nalej).To(gomega.HaveKeyWithValue("app", "nalej"))
+		gomega.Expect(labels("kube-system")).NotTo(gomega.HaveKey(RevisionLabel))
+	})
+})
@@ -0,0 +1,267 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Upgrade Istio command
+// Upgrades the Istio control plane with a canary revision. The new revision is installed alongside the current one,
+// the namespaces using the current injector are moved to the new one in batches restarting their deployments, and
+// the previous revision is removed once all of them are healthy. If a batch does not become ready, its namespaces
+// are moved back to the previous revision, which is kept.
+//
+// {"type":"sync", "name":"upgradeIstio", "kubeConfigPath":"/path/kubeconfig.yaml", "istio_path":"/istio-1.6/bin",
+// "revision":"1-6-0", "previous_revision":"", "batch_size":2, "timeout":300}
+
+package istio
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultRevision is the name of the revision of a control plane installed without revision.
+const DefaultRevision = "default"
+
+// IstiodDeployment is the name of the deployment of the control plane of a revision.
+const IstiodDeployment = "istiod"
+
+// UpgradeIstio structure with the revisions of the control plane and the namespaces to be migrated.
+type UpgradeIstio struct {
+	k8s.Kubernetes
+	// IstioPath where the istioctl binary of the new version can be found.
+	IstioPath string `json:"istio_path"`
+	// IstioctlImage with the image running istioctl if IstioPath has no binary for the host platform.
+	IstioctlImage string `json:"istioctl_image"`
+	// Revision of the new control plane.
+	Revision string `json:"revision"`
+	// PreviousRevision of the current control plane, empty if it was installed without revision.
+	PreviousRevision string `json:"previous_revision"`
+	// ConfigPath with an optional IstioOperator file used to install the new revision.
+	ConfigPath string `json:"config_path"`
+	// Namespaces to be migrated. If not set, the namespaces using the injector of the previous revision are migrated.
+	Namespaces []string `json:"namespaces"`
+	// BatchSize with the number of namespaces migrated at once, 1 if not set.
+	BatchSize int `json:"batch_size"`
+	// TimeoutSeconds with the maximum time to wait for each deployment. If not set, DefaultDeploymentTimeout is used.
+	TimeoutSeconds int `json:"timeout"`
+	// KeepPrevious skips the removal of the previous revision.
+	KeepPrevious bool `json:"keep_previous"`
+	// istioctl runs istioctl with a set of arguments.
+	istioctl func(args ...string) derrors.Error
+}
+
+// NewUpgradeIstio creates a new UpgradeIstio command.
+func NewUpgradeIstio(kubeConfigPath string, istioPath string, revision string, previousRevision string) *UpgradeIstio {
+	return &UpgradeIstio{
+		Kubernetes: k8s.Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.UpgradeIstio),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		IstioPath:        istioPath,
+		Revision:         revision,
+		PreviousRevision: previousRevision,
+	}
+}
+
+// NewUpgradeIstioFromJSON creates a new UpgradeIstio command from a raw JSON representation.
+func NewUpgradeIstioFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	ui := &UpgradeIstio{}
+	if err := json.Unmarshal(raw, &ui); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	ui.CommandID = entities.GenerateCommandID(ui.Name())
+	var r entities.Command = ui
+	return &r, nil
+}
+
+// runIstioctl runs the istioctl binary of the new version.
+func (ui *UpgradeIstio) runIstioctl(args ...string) derrors.Error {
+	if ui.istioctl != nil {
+		return ui.istioctl(args...)
+	}
+	args = append(args, fmt.Sprintf("--kubeconfig=%s", ui.KubeConfigPath))
+	cmd, cmdArgs, err := IstioctlCommand(ui.IstioPath, ui.IstioctlImage, args)
+	if err != nil {
+		return err
+	}
+	log.Debug().Str("cmd", cmd).Interface("args", cmdArgs).Msg("istioctl call")
+	result, err := sync.NewExec(cmd, cmdArgs).Run("")
+	if err != nil {
+		return derrors.NewInternalError(errors.Coded(errors.IstioctlFailed, "error when executing istioctl")).CausedBy(err)
+	}
+	log.Debug().Str("output", result.Output).Msg("output from istioctl")
+	return nil
+}
+
+// previousRevision returns the name of the previous revision as known by istioctl.
+func (ui *UpgradeIstio) previousRevision() string {
+	if ui.PreviousRevision == "" {
+		return DefaultRevision
+	}
+	return ui.PreviousRevision
+}
+
+// installRevision installs the control plane of the new revision and waits for it to be ready.
+func (ui *UpgradeIstio) installRevision(workflowID string) derrors.Error {
+	args := []string{"install", "-y", "--set", fmt.Sprintf("revision=%s", ui.Revision)}
+	if ui.ConfigPath != "" {
+		args = append(args, "-f", ui.ConfigPath)
+	}
+	if err := ui.runIstioctl(args...); err != nil {
+		return derrors.AsError(err, "cannot install istio revision")
+	}
+	istiod := fmt.Sprintf("%s-%s", IstiodDeployment, ui.Revision)
+	return ui.waitReady(workflowID, IstioNamespace, istiod)
+}
+
+// waitReady waits for a deployment to be ready.
+func (ui *UpgradeIstio) waitReady(workflowID string, namespace string, name string) derrors.Error {
+	result, err := k8s.NewWaitDeploymentReady(ui.KubeConfigPath, namespace, name, ui.TimeoutSeconds).Run(workflowID)
+	if err != nil {
+		return err
+	}
+	if !result.Success {
+		return result.Error
+	}
+	return nil
+}
+
+// injectedNamespaces returns the namespaces to be migrated, sorted by name.
+func (ui *UpgradeIstio) injectedNamespaces() ([]string, derrors.Error) {
+	if len(ui.Namespaces) > 0 {
+		return ui.Namespaces, nil
+	}
+	selector := fmt.Sprintf("%s=%s", InjectionLabel, InjectionEnabled)
+	if ui.PreviousRevision != "" {
+		selector = fmt.Sprintf("%s=%s", RevisionLabel, ui.PreviousRevision)
+	}
+	list, err := ui.Client.CoreV1().Namespaces().List(metaV1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, k8s.AsQueryError(err, "cannot list namespaces", selector)
+	}
+	result := make([]string, 0, len(list.Items))
+	for _, namespace := range list.Items {
+		result = append(result, namespace.Name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// moveNamespaces labels a set of namespaces with the injector of a revision and restarts their deployments so the
+// pods get the new sidecar, waiting for them to become ready.
+func (ui *UpgradeIstio) moveNamespaces(workflowID string, namespaces []string, revision string) derrors.Error {
+	injection := &ConfigureSidecarInjection{Kubernetes: ui.Kubernetes, Revision: revision}
+	for _, namespace := range namespaces {
+		if err := injection.labelNamespace(namespace, true); err != nil {
+			return err
+		}
+	}
+	for _, namespace := range namespaces {
+		list, err := ui.Client.AppsV1().Deployments(namespace).List(metaV1.ListOptions{})
+		if err != nil {
+			return k8s.AsQueryError(err, "cannot list deployments", namespace)
+		}
+		for _, deployment := range list.Items {
+			if err := ui.RestartDeployment(deployment); err != nil {
+				return err
+			}
+		}
+		for _, deployment := range list.Items {
+			if err := ui.waitReady(workflowID, namespace, deployment.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// batchSize returns the number of namespaces migrated at once.
+func (ui *UpgradeIstio) batchSize() int {
+	if ui.BatchSize <= 0 {
+		return 1
+	}
+	return ui.BatchSize
+}
+
+// Run the current command.
+//   returns:
+//     The CommandResult
+//     An error if the command execution fails
+func (ui *UpgradeIstio) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := ui.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	if ui.Revision == "" || ui.Revision == ui.previousRevision() {
+		return entities.NewCommandResult(false, "invalid revision",
+			derrors.NewInvalidArgumentError("the new revision must be set and differ from the previous one").WithParams(ui.Revision)), nil
+	}
+	namespaces, err := ui.injectedNamespaces()
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot obtain the namespaces to be migrated", err), nil
+	}
+	log.Info().Str("revision", ui.Revision).Msg("installing istio revision")
+	if err := ui.installRevision(workflowID); err != nil {
+		return entities.NewCommandResult(false, "cannot install istio revision", err), nil
+	}
+	for start := 0; start < len(namespaces); start += ui.batchSize() {
+		end := start + ui.batchSize()
+		if end > len(namespaces) {
+			end = len(namespaces)
+		}
+		batch := namespaces[start:end]
+		log.Info().Strs("namespaces", batch).Str("revision", ui.Revision).Msg("migrating namespaces")
+		if err := ui.moveNamespaces(workflowID, batch, ui.Revision); err != nil {
+			log.Warn().Str("trace", err.DebugReport()).Strs("namespaces", batch).Msg("rolling back namespaces")
+			if rErr := ui.moveNamespaces(workflowID, batch, ui.PreviousRevision); rErr != nil {
+				log.Error().Str("trace", rErr.DebugReport()).Strs("namespaces", batch).Msg("cannot roll back namespaces")
+			}
+			return entities.NewCommandResult(false, "namespaces are not healthy with the new revision", err), nil
+		}
+	}
+	if !ui.KeepPrevious {
+		log.Info().Str("revision", ui.previousRevision()).Msg("removing previous istio revision")
+		if err := ui.runIstioctl("x", "uninstall", "-y", "--revision", ui.previousRevision()); err != nil {
+			return entities.NewCommandResult(false, "cannot remove previous istio revision", err), nil
+		}
+	}
+	msg := fmt.Sprintf("istio upgraded to revision %s, %d namespaces migrated", ui.Revision, len(namespaces))
+	return entities.NewSuccessCommand([]byte(msg)), nil
+}
+
+// String returns a string representation
+func (ui *UpgradeIstio) String() string {
+	return fmt.Sprintf("SYNC UpgradeIstio from %s to %s", ui.previousRevision(), ui.Revision)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (ui *UpgradeIstio) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + ui.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (ui *UpgradeIstio) UserString() string {
+	return fmt.Sprintf("Upgrading Istio to revision %s", ui.Revision)
+}
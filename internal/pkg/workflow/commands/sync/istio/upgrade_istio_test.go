@@ -0,0 +1,130 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package istio
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = ginkgo.Describe("An UpgradeIstio command", func() {
+
+	var cluster *k8stest.FakeCluster
+	var calls [][]string
+
+	namespace := func(name string, labels map[string]string) *v1.Namespace {
+		return &v1.Namespace{ObjectMeta: metaV1.ObjectMeta{Name: name, Labels: labels}}
+	}
+
+	deployment := func(namespace string, name string, ready bool) *appsV1.Deployment {
+		replicas := int32(1)
+		result := &appsV1.Deployment{
+			ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       appsV1.DeploymentSpec{Replicas: &replicas},
+		}
+		if ready {
+			result.Status = appsV1.DeploymentStatus{UpdatedReplicas: 1, ReadyReplicas: 1}
+		}
+		return result
+	}
+
+	labels := func(name string) map[string]string {
+		ns, err := cluster.Client.CoreV1().Namespaces().Get(name, metaV1.GetOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+		return ns.Labels
+	}
+
+	newCommand := func() *UpgradeIstio {
+		cmd := NewUpgradeIstio(cluster.KubeConfigPath, "/istio/bin", "1-6-0", "")
+		cmd.TimeoutSeconds = 1
+		cmd.istioctl = func(args ...string) derrors.Error {
+			calls = append(calls, args)
+			return nil
+		}
+		return cmd
+	}
+
+	ginkgo.BeforeEach(func() {
+		calls = make([][]string, 0)
+		cluster = k8stest.NewFakeCluster(
+			namespace("nalej", map[string]string{InjectionLabel: InjectionEnabled}),
+			namespace("apps", map[string]string{InjectionLabel: InjectionEnabled}),
+			namespace("kube-system", map[string]string{InjectionLabel: InjectionDisabled}),
+			deployment(IstioNamespace, "istiod-1-6-0", true),
+			deployment("nalej", "authx", true),
+			deployment("kube-system", "coredns", true),
+		)
+		k8s.RegisterClients(cluster.KubeConfigPath, cluster.Client, cluster.Discovery, cluster.Dynamic)
+	})
+
+	ginkgo.AfterEach(func() {
+		k8s.UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	ginkgo.It("should migrate the injected namespaces and remove the previous revision", func() {
+		cmd := newCommand()
+		cmd.BatchSize = 2
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		for _, name := range []string{"nalej", "apps"} {
+			gomega.Expect(labels(name)).To(gomega.HaveKeyWithValue(RevisionLabel, "1-6-0"))
+			gomega.Expect(labels(name)).NotTo(gomega.HaveKey(InjectionLabel))
+		}
+		gomega.Expect(labels("kube-system")).To(gomega.HaveKeyWithValue(InjectionLabel, InjectionDisabled))
+
+		authx, gErr := cluster.Client.AppsV1().Deployments("nalej").Get("authx", metaV1.GetOptions{})
+		gomega.Expect(gErr).To(gomega.Succeed())
+		gomega.Expect(authx.Spec.Template.Annotations).To(gomega.HaveKey(k8s.RestartedAtAnnotation))
+		coredns, gErr := cluster.Client.AppsV1().Deployments("kube-system").Get("coredns", metaV1.GetOptions{})
+		gomega.Expect(gErr).To(gomega.Succeed())
+		gomega.Expect(coredns.Spec.Template.Annotations).NotTo(gomega.HaveKey(k8s.RestartedAtAnnotation))
+
+		gomega.Expect(calls).To(gomega.HaveLen(2))
+		gomega.Expect(calls[0]).To(gomega.ContainElement("revision=1-6-0"))
+		gomega.Expect(calls[1]).To(gomega.Equal([]string{"x", "uninstall", "-y", "--revision", DefaultRevision}))
+	})
+
+	ginkgo.It("should roll back the batch that is not healthy and keep the previous revision", func() {
+		cluster.Tracker.Add(deployment("apps", "web", false))
+		cmd := newCommand()
+		cmd.PreviousRevision = "1-5-0"
+		cmd.Namespaces = []string{"nalej", "apps"}
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+		gomega.Expect(labels("nalej")).To(gomega.HaveKeyWithValue(RevisionLabel, "1-6-0"))
+		gomega.Expect(labels("apps")).To(gomega.HaveKeyWithValue(RevisionLabel, "1-5-0"))
+		gomega.Expect(calls).To(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("should reject upgrades to the same revision", func() {
+		cmd := newCommand()
+		cmd.PreviousRevision = "1-6-0"
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+		gomega.Expect(calls).To(gomega.BeEmpty())
+	})
+})
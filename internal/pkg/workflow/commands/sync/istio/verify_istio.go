@@ -0,0 +1,320 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Verify Istio command
+// Verifies that the Istio control plane works once installed, as istioctl verify-install does. The sidecar injector
+// and validation webhooks must be registered with a CA bundle, the istiod deployment and the ingress gateway must be
+// ready, and a mesh wide mTLS policy must enable mTLS. The checks are repeated until they pass or the timeout
+// expires, failing with the diagnostics of the last check.
+//
+// {"type":"sync", "name":"verifyIstio", "kubeConfigPath":"/path/kubeconfig.yaml", "namespace":"istio-system",
+// "ingress_gateway":"istio-ingressgateway", "revision":"", "timeout":300}
+
+package istio
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	"k8s.io/api/admissionregistration/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// verifyInterval is the time between the checks of the control plane.
+var verifyInterval = IstioTimeSleep
+
+// meshPolicies is the resource of the mesh wide authentication policies of Istio 1.4.
+var meshPolicies = schema.GroupVersionResource{Group: "authentication.istio.io", Version: "v1alpha1", Resource: "meshpolicies"}
+
+// peerAuthentications is the resource of the authentication policies of Istio 1.5 onwards.
+var peerAuthentications = schema.GroupVersionResource{Group: "security.istio.io", Version: "v1beta1", Resource: "peerauthentications"}
+
+// MeshPolicyName is the name of the mesh wide authentication policy.
+const MeshPolicyName = "default"
+
+// VerifyIstio structure with the control plane to be verified.
+type VerifyIstio struct {
+	k8s.Kubernetes
+	// Namespace where Istio is installed, IstioNamespace if not set.
+	Namespace string `json:"namespace"`
+	// IngressGateway with the name of the ingress gateway, IstioIngressGateway if not set.
+	IngressGateway string `json:"ingress_gateway"`
+	// Revision of the control plane, the default one if not set.
+	Revision string `json:"revision"`
+	// TimeoutSeconds with the maximum time to wait for the checks to pass. If not set, IstioTimeout is used.
+	TimeoutSeconds int `json:"timeout"`
+}
+
+// NewVerifyIstio creates a new VerifyIstio command.
+func NewVerifyIstio(kubeConfigPath string, namespace string, ingressGateway string, revision string) *VerifyIstio {
+	return &VerifyIstio{
+		Kubernetes: k8s.Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.VerifyIstio),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Namespace:      namespace,
+		IngressGateway: ingressGateway,
+		Revision:       revision,
+	}
+}
+
+// NewVerifyIstioFromJSON creates a new VerifyIstio command from a raw JSON representation.
+func NewVerifyIstioFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	vi := &VerifyIstio{}
+	if err := json.Unmarshal(raw, &vi); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	vi.CommandID = entities.GenerateCommandID(vi.Name())
+	var r entities.Command = vi
+	return &r, nil
+}
+
+// namespace returns the namespace where Istio is installed.
+func (vi *VerifyIstio) namespace() string {
+	if vi.Namespace == "" {
+		return IstioNamespace
+	}
+	return vi.Namespace
+}
+
+// ingressGateway returns the name of the ingress gateway.
+func (vi *VerifyIstio) ingressGateway() string {
+	if vi.IngressGateway == "" {
+		return IstioIngressGateway
+	}
+	return vi.IngressGateway
+}
+
+// istiod returns the name of the deployment of the control plane.
+func (vi *VerifyIstio) istiod() string {
+	if vi.Revision == "" || vi.Revision == DefaultRevision {
+		return IstiodDeployment
+	}
+	return fmt.Sprintf("%s-%s", IstiodDeployment, vi.Revision)
+}
+
+// timeout returns the maximum time to wait for the checks to pass.
+func (vi *VerifyIstio) timeout() time.Duration {
+	if vi.TimeoutSeconds <= 0 {
+		return IstioTimeout
+	}
+	return time.Duration(vi.TimeoutSeconds) * time.Second
+}
+
+// Run the current command returning the result or an error.
+func (vi *VerifyIstio) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := vi.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	deadline := time.Now().Add(vi.timeout())
+	for {
+		diagnostics, err := vi.Diagnose()
+		if err != nil {
+			return entities.NewCommandResult(false, "cannot verify istio", err), nil
+		}
+		if len(diagnostics) == 0 {
+			return entities.NewSuccessCommand([]byte(fmt.Sprintf("istio is healthy in namespace %s", vi.namespace()))), nil
+		}
+		if time.Now().After(deadline) {
+			msg := errors.Coded(errors.IstioUnhealthy, fmt.Sprintf("istio verification failed: %s", strings.Join(diagnostics, "; ")))
+			return entities.NewCommandResult(false, msg, derrors.NewFailedPreconditionError(msg)), nil
+		}
+		log.Debug().Strs("diagnostics", diagnostics).Msg("waiting for istio to be healthy")
+		time.Sleep(verifyInterval)
+	}
+}
+
+// Diagnose checks the control plane once.
+//   returns:
+//     The description of each failed check, empty if the control plane is healthy.
+//     An error if the checks cannot be performed.
+func (vi *VerifyIstio) Diagnose() ([]string, derrors.Error) {
+	diagnostics := make([]string, 0)
+	checks := []func() (string, derrors.Error){
+		vi.checkMutatingWebhooks, vi.checkValidatingWebhooks, vi.checkIstiod, vi.checkIngressGateway, vi.checkMTLS,
+	}
+	for _, check := range checks {
+		diagnostic, err := check()
+		if err != nil {
+			return nil, err
+		}
+		if diagnostic != "" {
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	return diagnostics, nil
+}
+
+// checkWebhooks checks that a webhook served from the Istio namespace is registered with a CA bundle.
+//   params:
+//     kind The kind of the webhooks, used in the diagnostic.
+//     clientConfigs The client configuration of each webhook indexed by name.
+//   returns:
+//     The diagnostic, empty if the check passes.
+func (vi *VerifyIstio) checkWebhooks(kind string, clientConfigs map[string]v1beta1.WebhookClientConfig) string {
+	found := false
+	for name, clientConfig := range clientConfigs {
+		if clientConfig.Service == nil || clientConfig.Service.Namespace != vi.namespace() {
+			continue
+		}
+		if len(clientConfig.CABundle) == 0 {
+			return fmt.Sprintf("%s webhook %s has no CA bundle", kind, name)
+		}
+		found = true
+	}
+	if !found {
+		return fmt.Sprintf("no %s webhook served from namespace %s", kind, vi.namespace())
+	}
+	return ""
+}
+
+// checkMutatingWebhooks checks the webhook of the sidecar injector.
+func (vi *VerifyIstio) checkMutatingWebhooks() (string, derrors.Error) {
+	list, err := vi.Client.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().List(metaV1.ListOptions{})
+	if err != nil {
+		return "", k8s.AsQueryError(err, "cannot list mutating webhooks")
+	}
+	clientConfigs := make(map[string]v1beta1.WebhookClientConfig, 0)
+	for _, config := range list.Items {
+		for _, webhook := range config.Webhooks {
+			clientConfigs[webhook.Name] = webhook.ClientConfig
+		}
+	}
+	return vi.checkWebhooks("mutating", clientConfigs), nil
+}
+
+// checkValidatingWebhooks checks the webhook validating the Istio configuration.
+func (vi *VerifyIstio) checkValidatingWebhooks() (string, derrors.Error) {
+	list, err := vi.Client.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().List(metaV1.ListOptions{})
+	if err != nil {
+		return "", k8s.AsQueryError(err, "cannot list validating webhooks")
+	}
+	clientConfigs := make(map[string]v1beta1.WebhookClientConfig, 0)
+	for _, config := range list.Items {
+		for _, webhook := range config.Webhooks {
+			clientConfigs[webhook.Name] = webhook.ClientConfig
+		}
+	}
+	return vi.checkWebhooks("validating", clientConfigs), nil
+}
+
+// checkDeployment checks that a deployment of the Istio namespace is ready.
+func (vi *VerifyIstio) checkDeployment(name string) (string, derrors.Error) {
+	deployment, err := vi.Client.AppsV1().Deployments(vi.namespace()).Get(name, metaV1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return fmt.Sprintf("deployment %s/%s not found", vi.namespace(), name), nil
+		}
+		return "", k8s.AsQueryError(err, "cannot retrieve deployment", vi.namespace(), name)
+	}
+	if !k8s.DeploymentReady(deployment) {
+		replicas := int32(1)
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+		return fmt.Sprintf("deployment %s/%s is not ready, %d of %d replicas ready", vi.namespace(), name,
+			deployment.Status.ReadyReplicas, replicas), nil
+	}
+	return "", nil
+}
+
+// checkIstiod checks the deployment of the control plane.
+func (vi *VerifyIstio) checkIstiod() (string, derrors.Error) {
+	return vi.checkDeployment(vi.istiod())
+}
+
+// checkIngressGateway checks the service and the deployment of the ingress gateway.
+func (vi *VerifyIstio) checkIngressGateway() (string, derrors.Error) {
+	_, err := vi.Client.CoreV1().Services(vi.namespace()).Get(vi.ingressGateway(), metaV1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return fmt.Sprintf("service %s/%s not found", vi.namespace(), vi.ingressGateway()), nil
+		}
+		return "", k8s.AsQueryError(err, "cannot retrieve service", vi.namespace(), vi.ingressGateway())
+	}
+	return vi.checkDeployment(vi.ingressGateway())
+}
+
+// checkMTLS checks that the mesh wide policy enables mTLS, using the PeerAuthentication of the Istio namespace or
+// the MeshPolicy of previous versions.
+func (vi *VerifyIstio) checkMTLS() (string, derrors.Error) {
+	policy, found, err := vi.findPolicy(vi.namespace(), peerAuthentications)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		mode, _, _ := unstructured.NestedString(policy.Object, "spec", "mtls", "mode")
+		if mode == "DISABLE" {
+			return fmt.Sprintf("peer authentication %s/%s disables mTLS", vi.namespace(), MeshPolicyName), nil
+		}
+		return "", nil
+	}
+	policy, found, err = vi.findPolicy("", meshPolicies)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		peers, _, _ := unstructured.NestedSlice(policy.Object, "spec", "peers")
+		for _, peer := range peers {
+			if method, ok := peer.(map[string]interface{}); ok {
+				if _, mtls := method["mtls"]; mtls {
+					return "", nil
+				}
+			}
+		}
+		return fmt.Sprintf("mesh policy %s does not enable mTLS", MeshPolicyName), nil
+	}
+	return "no mesh wide mTLS policy found", nil
+}
+
+// findPolicy retrieves the mesh wide policy of a resource, which may not be served by the cluster.
+func (vi *VerifyIstio) findPolicy(namespace string, gvr schema.GroupVersionResource) (*unstructured.Unstructured, bool, derrors.Error) {
+	policy, err := vi.DynamicResource(namespace, gvr).Get(MeshPolicyName, metaV1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, k8s.AsQueryError(err, "cannot retrieve mTLS policy", gvr.String(), namespace, MeshPolicyName)
+	}
+	return policy, true, nil
+}
+
+// String returns a string representation.
+func (vi *VerifyIstio) String() string {
+	return fmt.Sprintf("SYNC VerifyIstio namespace %s", vi.namespace())
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (vi *VerifyIstio) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + vi.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (vi *VerifyIstio) UserString() string {
+	return fmt.Sprintf("Verifying Istio in namespace %s", vi.namespace())
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package istio
+
+import (
+	"time"
+
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/admissionregistration/v1beta1"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = ginkgo.Describe("A VerifyIstio command", func() {
+
+	var cluster *k8stest.FakeCluster
+	var previousInterval time.Duration
+
+	deployment := func(name string, ready bool) *appsV1.Deployment {
+		replicas := int32(1)
+		result := &appsV1.Deployment{
+			ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: IstioNamespace},
+			Spec:       appsV1.DeploymentSpec{Replicas: &replicas},
+		}
+		if ready {
+			result.Status = appsV1.DeploymentStatus{UpdatedReplicas: 1, ReadyReplicas: 1, Replicas: 1}
+		}
+		return result
+	}
+
+	clientConfig := func(caBundle []byte) v1beta1.WebhookClientConfig {
+		return v1beta1.WebhookClientConfig{
+			Service:  &v1beta1.ServiceReference{Namespace: IstioNamespace, Name: IstiodDeployment},
+			CABundle: caBundle,
+		}
+	}
+
+	mutating := func(caBundle []byte) *v1beta1.MutatingWebhookConfiguration {
+		return &v1beta1.MutatingWebhookConfiguration{
+			ObjectMeta: metaV1.ObjectMeta{Name: "istio-sidecar-injector"},
+			Webhooks:   []v1beta1.MutatingWebhook{{Name: "sidecar-injector.istio.io", ClientConfig: clientConfig(caBundle)}},
+		}
+	}
+
+	validating := func(caBundle []byte) *v1beta1.ValidatingWebhookConfiguration {
+		return &v1beta1.ValidatingWebhookConfiguration{
+			ObjectMeta: metaV1.ObjectMeta{Name: "istiod-istio-system"},
+			Webhooks:   []v1beta1.ValidatingWebhook{{Name: "validation.istio.io", ClientConfig: clientConfig(caBundle)}},
+		}
+	}
+
+	peerAuthentication := func(mode string) {
+		policy := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "security.istio.io/v1beta1",
+			"kind":       "PeerAuthentication",
+			"metadata":   map[string]interface{}{"name": MeshPolicyName, "namespace": IstioNamespace},
+			"spec":       map[string]interface{}{"mtls": map[string]interface{}{"mode": mode}},
+		}}
+		_, err := cluster.Dynamic.Resource(peerAuthentications).Namespace(IstioNamespace).Create(policy, metaV1.CreateOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+	}
+
+	meshPolicy := func(peers []interface{}) {
+		policy := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "authentication.istio.io/v1alpha1",
+			"kind":       "MeshPolicy",
+			"metadata":   map[string]interface{}{"name": MeshPolicyName},
+			"spec":       map[string]interface{}{"peers": peers},
+		}}
+		_, err := cluster.Dynamic.Resource(meshPolicies).Create(policy, metaV1.CreateOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+	}
+
+	ginkgo.BeforeEach(func() {
+		previousInterval = verifyInterval
+		verifyInterval = 10 * time.Millisecond
+		cluster = k8stest.NewFakeCluster(
+			mutating([]byte("ca")),
+			validating([]byte("ca")),
+			deployment(IstiodDeployment, true),
+			deployment(IstioIngressGateway, true),
+			&v1.Service{ObjectMeta: metaV1.ObjectMeta{Name: IstioIngressGateway, Namespace: IstioNamespace}},
+		)
+		cluster.AddResource(k8stest.Resource{GroupVersion: "security.istio.io/v1beta1", Name: "peerauthentications",
+			Kind: "PeerAuthentication", Namespaced: true})
+		cluster.AddResource(k8stest.Resource{GroupVersion: "authentication.istio.io/v1alpha1", Name: "meshpolicies",
+			Kind: "MeshPolicy", Namespaced: false})
+		k8s.RegisterClients(cluster.KubeConfigPath, cluster.Client, cluster.Discovery, cluster.Dynamic)
+	})
+
+	ginkgo.AfterEach(func() {
+		k8s.UnregisterClients(cluster.KubeConfigPath)
+		verifyInterval = previousInterval
+	})
+
+	ginkgo.It("should pass on a healthy control plane", func() {
+		peerAuthentication("STRICT")
+		cmd := NewVerifyIstio(cluster.KubeConfigPath, "", "", "")
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should accept the mesh policy of previous versions", func() {
+		cmd := NewVerifyIstio(cluster.KubeConfigPath, "", "", "")
+		gomega.Expect(cmd.Connect()).To(gomega.Succeed())
+		meshPolicy([]interface{}{map[string]interface{}{"mtls": map[string]interface{}{}}})
+		diagnostics, err := cmd.Diagnose()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(diagnostics).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should report every failed check", func() {
+		cluster.Client.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().Update(mutating(nil))
+		cluster.Client.AppsV1().Deployments(IstioNamespace).Update(deployment(IstiodDeployment, false))
+		cluster.Client.CoreV1().Services(IstioNamespace).Delete(IstioIngressGateway, &metaV1.DeleteOptions{})
+		peerAuthentication("DISABLE")
+
+		cmd := NewVerifyIstio(cluster.KubeConfigPath, "", "", "")
+		gomega.Expect(cmd.Connect()).To(gomega.Succeed())
+		diagnostics, err := cmd.Diagnose()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(diagnostics).To(gomega.Equal([]string{
+			"mutating webhook sidecar-injector.istio.io has no CA bundle",
+			"deployment istio-system/istiod is not ready, 0 of 1 replicas ready",
+			"service istio-system/istio-ingressgateway not found",
+			"peer authentication istio-system/default disables mTLS",
+		}))
+	})
+
+	ginkgo.It("should fail with the diagnostics once the timeout expires", func() {
+		cmd := NewVerifyIstio(cluster.KubeConfigPath, "", "", "1-6-0")
+		cmd.TimeoutSeconds = 1
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+		gomega.Expect(result.Output).To(gomega.ContainSubstring("deployment istio-system/istiod-1-6-0 not found"))
+		gomega.Expect(result.Output).To(gomega.ContainSubstring("no mesh wide mTLS policy found"))
+		code, found := errors.ErrorCode(result.Error)
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(code).To(gomega.Equal(errors.IstioUnhealthy))
+	})
+})
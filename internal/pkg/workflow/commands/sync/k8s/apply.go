@@ -0,0 +1,410 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package k8s
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// AppliedHashAnnotation contains the hash of the manifest used to create or update an object.
+const AppliedHashAnnotation = "installer.nalej.com/applied-hash"
+
+// LastAppliedAnnotation contains the last manifest applied to an object on clusters without server-side apply. It
+// is used to remove the fields that are no longer part of the manifest.
+const LastAppliedAnnotation = "installer.nalej.com/last-applied"
+
+// FieldManager is the name of the manager owning the fields applied by the installer.
+const FieldManager = "nalej-installer"
+
+// ApplyOutcome represents what happened to an object when applied.
+type ApplyOutcome int
+
+const (
+	// ObjectCreated as the object did not exist.
+	ObjectCreated ApplyOutcome = iota + 1
+	// ObjectSkipped as the object was already applied with the same manifest.
+	ObjectSkipped
+	// ObjectUpdated as the object was applied with a different manifest.
+	ObjectUpdated
+	// ObjectAdopted as the object existed without being managed by the installer, and it was labeled and updated.
+	ObjectAdopted
+)
+
+// ApplyOptions with the settings of the objects being applied.
+type ApplyOptions struct {
+	// ForceConflicts takes over the fields owned by other managers.
+	ForceConflicts bool
+	// Labels added to each object.
+	Labels map[string]string
+	// Adopt takes ownership of the existing objects that were not created by the installer, such as those of a
+	// previous manual install, instead of failing.
+	Adopt bool
+}
+
+// ApplySummary counts the outcome of a set of objects being applied and keeps the references of those objects. It
+// can be shared by concurrent launches.
+type ApplySummary struct {
+	sync.Mutex
+	Created int
+	Skipped int
+	Updated int
+	Pruned  int
+	Adopted int
+	// Objects with the references of the applied objects.
+	Objects []ObjectReference
+}
+
+// Add records the outcome of an object.
+func (as *ApplySummary) Add(ref ObjectReference, outcome ApplyOutcome) {
+	as.Lock()
+	defer as.Unlock()
+	as.Objects = append(as.Objects, ref)
+	switch outcome {
+	case ObjectCreated:
+		as.Created++
+	case ObjectSkipped:
+		as.Skipped++
+	case ObjectUpdated:
+		as.Updated++
+	case ObjectAdopted:
+		as.Adopted++
+	}
+}
+
+// String returns the counters of the summary.
+func (as *ApplySummary) String() string {
+	as.Lock()
+	defer as.Unlock()
+	result := fmt.Sprintf("%d applied, %d skipped, %d updated", as.Created, as.Skipped, as.Updated)
+	if as.Adopted > 0 {
+		result = fmt.Sprintf("%s, %d adopted", result, as.Adopted)
+	}
+	if as.Pruned > 0 {
+		result = fmt.Sprintf("%s, %d pruned", result, as.Pruned)
+	}
+	return result
+}
+
+// Applied returns the references of the applied objects to be reported in the result of a command.
+func (as *ApplySummary) Applied() []entities.AppliedObject {
+	as.Lock()
+	defer as.Unlock()
+	applied := make([]entities.AppliedObject, 0, len(as.Objects))
+	for _, ref := range as.Objects {
+		applied = append(applied, entities.AppliedObject{
+			APIVersion: ref.APIVersion,
+			Kind:       ref.Kind,
+			Namespace:  ref.Namespace,
+			Name:       ref.Name,
+		})
+	}
+	return applied
+}
+
+// ManifestHash returns the hash of the manifest of an object ignoring the annotations set by Apply.
+func ManifestHash(obj *unstructured.Unstructured) (string, derrors.Error) {
+	toHash := obj.DeepCopy()
+	removeApplyAnnotations(toHash)
+	// Maps are marshalled with sorted keys so the result is stable.
+	content, err := json.Marshal(toHash.Object)
+	if err != nil {
+		return "", derrors.NewInternalError("cannot marshal object", err).WithParams(obj.GetKind(), obj.GetName())
+	}
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// removeApplyAnnotations removes the annotations set by Apply from an object.
+func removeApplyAnnotations(obj *unstructured.Unstructured) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		return
+	}
+	delete(annotations, AppliedHashAnnotation)
+	delete(annotations, LastAppliedAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// IsManaged checks if an object was created by the installer, as it carries the annotation of the applied manifest,
+// the label of an install, or the ManagedByLabel.
+func IsManaged(obj metaV1.Object) bool {
+	if _, applied := obj.GetAnnotations()[AppliedHashAnnotation]; applied {
+		return true
+	}
+	labels := obj.GetLabels()
+	if _, installed := labels[InstallIDLabel]; installed {
+		return true
+	}
+	return labels[ManagedByLabel] == ManagedByInstaller
+}
+
+// setAnnotation sets an annotation of an object.
+func setAnnotation(obj *unstructured.Unstructured, key string, value string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string, 0)
+	}
+	annotations[key] = value
+	obj.SetAnnotations(annotations)
+}
+
+// ThreeWayMergePatch computes the patch that moves an object to a new manifest. Fields of the manifest that differ
+// from the current object are set, and fields of the previous manifest that are no longer part of the new one are
+// removed. The rest of the fields of the current object, such as those set by controllers, are kept. Lists are
+// sent complete; the API server merges those with a merge key, such as the ports of a service, when the patch is
+// sent as a strategic merge patch.
+//   params:
+//     original The previous manifest, or nil if unknown.
+//     modified The new manifest.
+//     current The current object.
+//   returns:
+//     The patch, empty if there are no changes.
+func ThreeWayMergePatch(original map[string]interface{}, modified map[string]interface{}, current map[string]interface{}) map[string]interface{} {
+	patch := make(map[string]interface{}, 0)
+	for key, modifiedValue := range modified {
+		if modifiedValue == nil {
+			// Null fields of the manifest, such as the creation timestamp, are not set.
+			continue
+		}
+		currentValue, inCurrent := current[key]
+		modifiedMap, modifiedIsMap := modifiedValue.(map[string]interface{})
+		currentMap, currentIsMap := currentValue.(map[string]interface{})
+		if modifiedIsMap && currentIsMap {
+			originalMap, _ := original[key].(map[string]interface{})
+			if changes := ThreeWayMergePatch(originalMap, modifiedMap, currentMap); len(changes) > 0 {
+				patch[key] = changes
+			}
+			continue
+		}
+		if !inCurrent || !reflect.DeepEqual(modifiedValue, currentValue) {
+			patch[key] = modifiedValue
+		}
+	}
+	for key := range original {
+		if _, desired := modified[key]; desired {
+			continue
+		}
+		if _, inCurrent := current[key]; inCurrent {
+			patch[key] = nil
+		}
+	}
+	return patch
+}
+
+// Apply creates an object or updates it if its manifest changed since the last time it was applied. Objects whose
+// manifest did not change are skipped. The hash of the manifest is stored in the AppliedHashAnnotation of the object,
+// and the object is labeled with the ManagedByLabel. Existing objects not created by the installer are only updated
+// if the options adopt them, taking over all their fields. Objects are applied server side by the FieldManager on
+// clusters that support it, so fields owned by other managers are only taken over if the options force it. Older
+// clusters receive a three way merge patch instead.
+//   params:
+//     obj The object to be applied.
+//     options The options of the apply, such as taking over the fields owned by other managers.
+//     summary The summary where the outcome of the object is recorded.
+//   returns:
+//     An error if the object cannot be created or updated.
+func (k *Kubernetes) Apply(obj runtime.Object, options ApplyOptions, summary *ApplySummary) derrors.Error {
+	unstructuredMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return derrors.NewInvalidArgumentError("cannot convert object to unstructured", err).WithParams(obj)
+	}
+	unstructuredObj := &unstructured.Unstructured{
+		Object: unstructuredMap,
+	}
+
+	gvk, derr := getKind(obj)
+	if derr != nil {
+		return derr
+	}
+
+	// Items in list resources are applied one by one
+	if unstructuredObj.IsList() {
+		list, err := unstructuredObj.ToList()
+		if err != nil {
+			return derrors.NewInternalError("cannot create unstructured list", err)
+		}
+		err = list.EachListItem(func(item runtime.Object) error {
+			if err := k.Apply(item, options, summary); err != nil {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			derr, ok := err.(derrors.Error)
+			if ok {
+				return derr
+			}
+			return derrors.NewInternalError("failed to apply list item resource", err)
+		}
+		return nil
+	}
+
+	client, derr := k.resourceClient(gvk, unstructuredObj)
+	if derr != nil {
+		return derr
+	}
+	capabilities, derr := k.Capabilities()
+	if derr != nil {
+		return derr
+	}
+	serverSide := capabilities.SupportsServerSideApply()
+
+	labels := unstructuredObj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string, 0)
+	}
+	for key, value := range options.Labels {
+		labels[key] = value
+	}
+	labels[ManagedByLabel] = ManagedByInstaller
+	unstructuredObj.SetLabels(labels)
+	ref := NewObjectReference(unstructuredObj)
+	hash, derr := ManifestHash(unstructuredObj)
+	if derr != nil {
+		return derr
+	}
+	setAnnotation(unstructuredObj, AppliedHashAnnotation, hash)
+	if !serverSide {
+		lastApplied, err := json.Marshal(unstructuredObj.Object)
+		if err != nil {
+			return derrors.NewInternalError("cannot marshal object", err).WithParams(gvk.String(), unstructuredObj.GetName())
+		}
+		setAnnotation(unstructuredObj, LastAppliedAnnotation, string(lastApplied))
+	}
+
+	name := unstructuredObj.GetName()
+	existing, err := client.Get(name, metaV1.GetOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return derrors.NewInternalError("cannot retrieve object", err).WithParams(gvk.String(), name)
+	}
+	if err == nil && existing.GetAnnotations()[AppliedHashAnnotation] == hash {
+		log.Debug().Str("resource", gvk.String()).Str("name", name).Msg("unchanged, skipping")
+		summary.Add(ref, ObjectSkipped)
+		return nil
+	}
+
+	outcome := ObjectUpdated
+	force := options.ForceConflicts
+	if err != nil {
+		outcome = ObjectCreated
+	} else if !IsManaged(existing) {
+		if !options.Adopt {
+			return derrors.NewAlreadyExistsError(errors.Coded(errors.ObjectNotManaged,
+				"object exists and is not managed by the installer")).WithParams(gvk.String(), existing.GetNamespace(), name)
+		}
+		log.Info().Str("resource", gvk.String()).Str("namespace", existing.GetNamespace()).Str("name", name).
+			Msg("adopting existing object")
+		outcome = ObjectAdopted
+		force = true
+	}
+	switch {
+	case serverSide:
+		derr = serverSideApply(client, unstructuredObj, force)
+	case outcome == ObjectCreated:
+		if _, err := client.Create(unstructuredObj, metaV1.CreateOptions{}); err != nil {
+			derr = derrors.NewInternalError("unable to create object", err).WithParams(gvk.String(), name)
+		}
+	default:
+		derr = mergePatch(client, unstructuredObj, lastAppliedManifest(existing), existing)
+	}
+	if derr != nil {
+		return derr
+	}
+	log.Debug().Str("resource", gvk.String()).Str("name", name).Bool("serverSide", serverSide).
+		Bool("created", outcome == ObjectCreated).Msg("applied")
+	summary.Add(ref, outcome)
+	return nil
+}
+
+// SupportsServerSideApply checks if the cluster enables server-side apply by default, since Kubernetes 1.16.
+func (c *Capabilities) SupportsServerSideApply() bool {
+	return c.AtLeast(1, 16)
+}
+
+// lastAppliedManifest returns the manifest stored in the LastAppliedAnnotation of an object, or nil if the object
+// was not applied before or the annotation cannot be parsed.
+func lastAppliedManifest(obj *unstructured.Unstructured) map[string]interface{} {
+	lastApplied, found := obj.GetAnnotations()[LastAppliedAnnotation]
+	if !found {
+		return nil
+	}
+	result := make(map[string]interface{}, 0)
+	if err := json.Unmarshal([]byte(lastApplied), &result); err != nil {
+		log.Warn().Str("kind", obj.GetKind()).Str("name", obj.GetName()).
+			Msg("cannot parse the last applied manifest, removed fields will be kept")
+		return nil
+	}
+	return result
+}
+
+// serverSideApply sends the object as an apply patch owned by the FieldManager.
+func serverSideApply(client dynamic.ResourceInterface, obj *unstructured.Unstructured, force bool) derrors.Error {
+	content, err := json.Marshal(obj.Object)
+	if err != nil {
+		return derrors.NewInternalError("cannot marshal object", err).WithParams(obj.GetKind(), obj.GetName())
+	}
+	options := metaV1.PatchOptions{FieldManager: FieldManager}
+	if force {
+		options.Force = &force
+	}
+	if _, err := client.Patch(obj.GetName(), types.ApplyPatchType, content, options); err != nil {
+		if k8sErrors.IsConflict(err) {
+			return derrors.NewPermissionDeniedError("fields of the object are owned by other managers, set force_conflicts to take them over", err).
+				WithParams(obj.GetKind(), obj.GetName())
+		}
+		return derrors.NewInternalError("unable to apply object", err).WithParams(obj.GetKind(), obj.GetName())
+	}
+	return nil
+}
+
+// mergePatch sends the three way merge patch from the current object to the manifest. Kinds known by the client are
+// sent as a strategic merge patch so the API server merges their lists by key.
+func mergePatch(client dynamic.ResourceInterface, obj *unstructured.Unstructured, original map[string]interface{}, current *unstructured.Unstructured) derrors.Error {
+	patch := ThreeWayMergePatch(original, obj.Object, current.Object)
+	content, err := json.Marshal(patch)
+	if err != nil {
+		return derrors.NewInternalError("cannot marshal patch", err).WithParams(obj.GetKind(), obj.GetName())
+	}
+	patchType := types.MergePatchType
+	if scheme.Scheme.Recognizes(obj.GroupVersionKind()) {
+		patchType = types.StrategicMergePatchType
+	}
+	if _, err := client.Patch(obj.GetName(), patchType, content, metaV1.PatchOptions{}); err != nil {
+		return derrors.NewInternalError("unable to patch object", err).WithParams(obj.GetKind(), obj.GetName())
+	}
+	return nil
+}
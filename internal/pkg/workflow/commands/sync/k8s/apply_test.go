@@ -0,0 +1,112 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package k8s
+
+import (
+	"sync"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestService(port int64) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{
+			"name":      "component",
+			"namespace": "nalej",
+		},
+		"spec": map[string]interface{}{
+			"ports": []interface{}{map[string]interface{}{"port": port}},
+		},
+	}}
+}
+
+var _ = ginkgo.Describe("Apply components", func() {
+
+	ginkgo.It("should compute a stable hash ignoring the annotations set on apply", func() {
+		first, err := ManifestHash(newTestService(80))
+		gomega.Expect(err).To(gomega.Succeed())
+		annotated := newTestService(80)
+		setAnnotation(annotated, AppliedHashAnnotation, first)
+		setAnnotation(annotated, LastAppliedAnnotation, "{}")
+		again, err := ManifestHash(annotated)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(again).To(gomega.Equal(first))
+	})
+
+	ginkgo.It("should change the hash when the manifest changes", func() {
+		first, err := ManifestHash(newTestService(80))
+		gomega.Expect(err).To(gomega.Succeed())
+		second, err := ManifestHash(newTestService(8080))
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(second).ToNot(gomega.Equal(first))
+	})
+
+	ginkgo.Context("three way merge patch", func() {
+		ginkgo.It("should keep the fields set by controllers", func() {
+			current := newTestService(80)
+			current.SetResourceVersion("42")
+			gomega.Expect(unstructured.SetNestedField(current.Object, "10.0.0.10", "spec", "clusterIP")).To(gomega.Succeed())
+			patch := ThreeWayMergePatch(newTestService(80).Object, newTestService(8080).Object, current.Object)
+			gomega.Expect(patch).To(gomega.Equal(map[string]interface{}{
+				"spec": map[string]interface{}{
+					"ports": []interface{}{map[string]interface{}{"port": int64(8080)}},
+				},
+			}))
+		})
+
+		ginkgo.It("should remove the fields that are no longer part of the manifest", func() {
+			original := newTestService(80)
+			original.SetLabels(map[string]string{"cluster": "management", "removed": "true"})
+			modified := newTestService(80)
+			modified.SetLabels(map[string]string{"cluster": "management"})
+			current := original.DeepCopy()
+			setAnnotation(current, "controller", "value")
+			patch := ThreeWayMergePatch(original.Object, modified.Object, current.Object)
+			gomega.Expect(patch).To(gomega.Equal(map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{"removed": nil},
+				},
+			}))
+		})
+
+		ginkgo.It("should return an empty patch if nothing changed", func() {
+			current := newTestService(80)
+			current.SetUID("uid")
+			patch := ThreeWayMergePatch(nil, newTestService(80).Object, current.Object)
+			gomega.Expect(patch).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.It("should count the outcome of concurrent launches", func() {
+		summary := &ApplySummary{}
+		var wg sync.WaitGroup
+		for _, outcome := range []ApplyOutcome{ObjectCreated, ObjectCreated, ObjectSkipped, ObjectUpdated} {
+			wg.Add(1)
+			go func(outcome ApplyOutcome) {
+				defer wg.Done()
+				summary.Add(NewObjectReference(newTestService(80)), outcome)
+			}(outcome)
+		}
+		wg.Wait()
+		gomega.Expect(summary.String()).To(gomega.Equal("2 applied, 1 skipped, 1 updated"))
+		gomega.Expect(summary.Objects).To(gomega.HaveLen(4))
+	})
+})
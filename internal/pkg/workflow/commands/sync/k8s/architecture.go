@@ -0,0 +1,269 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Node architectures
+// Clusters with arm64 nodes, such as Graviton instances or Raspberry Pi boards, run the workloads of the components
+// on the nodes of the architectures supported by their images. The workloads declare them with the
+// ArchitecturesAnnotation, and are otherwise considered amd64 only. Workloads that cannot run on any node of the
+// cluster use the arm64 variants of their images if they are configured.
+
+package k8s
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/utils"
+	syncCmd "github.com/nalej/installer/internal/pkg/workflow/commands/sync"
+	"github.com/rs/zerolog/log"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ArchitectureLabel is the label of the nodes with their architecture.
+const ArchitectureLabel = "kubernetes.io/arch"
+
+// ArchitecturesAnnotation lists the architectures supported by the images of a workload, separated by commas, such as
+// amd64,arm64 for multi-architecture images.
+const ArchitecturesAnnotation = "installer.nalej.com/architectures"
+
+// DefaultWorkloadArchitectures contains the architectures of the workloads without the ArchitecturesAnnotation.
+var DefaultWorkloadArchitectures = []string{syncCmd.AMD64Architecture}
+
+// NodeArchitectures returns the architectures of the nodes of the cluster.
+//   returns:
+//     The different architectures in alphabetical order.
+//     An error if the nodes cannot be retrieved or any of them has an unsupported architecture.
+func (k *Kubernetes) NodeArchitectures() ([]string, derrors.Error) {
+	nodes, err := k.Client.CoreV1().Nodes().List(metaV1.ListOptions{})
+	if err != nil {
+		return nil, AsQueryError(err, "cannot list nodes", "", "")
+	}
+	archs := make(map[string]string, len(nodes.Items))
+	for _, node := range nodes.Items {
+		reported := node.Status.NodeInfo.Architecture
+		if reported == "" {
+			reported = node.Labels[ArchitectureLabel]
+		}
+		arch, _ := utils.NormalizeArchitecture(reported)
+		if !syncCmd.IsSupportedArchitecture(arch) {
+			return nil, derrors.NewFailedPreconditionError("unsupported node architecture").WithParams(node.Name, reported)
+		}
+		archs[node.Name] = arch
+	}
+	return syncCmd.SortedArchitectures(archs), nil
+}
+
+// ArchitectureAdapter adapts the workloads of the components to the architectures of the nodes of a cluster.
+type ArchitectureAdapter struct {
+	// Architectures of the nodes of the cluster.
+	Architectures []string
+	// ARM64Images with the arm64 variants of the images, by image or by repository, in which case the tag is kept.
+	ARM64Images map[string]string
+}
+
+// Adapt restricts the workloads of an object to the nodes of the architectures supported by their images, replacing
+// the images by their arm64 variants if the workloads cannot run otherwise. Objects are not modified on clusters
+// with amd64 nodes only. The items of list resources are also adapted.
+//   params:
+//     obj The object to be modified.
+//   returns:
+//     Whether the object has been modified.
+//     An error if the workloads of the object cannot run on the nodes of the cluster.
+func (aa *ArchitectureAdapter) Adapt(obj *unstructured.Unstructured) (bool, derrors.Error) {
+	if len(aa.Architectures) == 0 || (len(aa.Architectures) == 1 && aa.Architectures[0] == syncCmd.AMD64Architecture) {
+		return false, nil
+	}
+	if obj.IsList() {
+		items, found, _ := unstructured.NestedSlice(obj.Object, "items")
+		if !found {
+			return false, nil
+		}
+		modified := false
+		for index, item := range items {
+			content, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			itemModified, err := aa.Adapt(&unstructured.Unstructured{Object: content})
+			if err != nil {
+				return false, err
+			}
+			items[index] = content
+			modified = modified || itemModified
+		}
+		if err := unstructured.SetNestedSlice(obj.Object, items, "items"); err != nil {
+			return false, derrors.NewInternalError("cannot set list items", err)
+		}
+		return modified, nil
+	}
+	path, supported := podSpecPaths[obj.GetKind()]
+	if !supported {
+		return false, nil
+	}
+	podSpec, found, err := unstructured.NestedMap(obj.Object, path...)
+	if err != nil {
+		return false, derrors.NewInvalidArgumentError("cannot read pod spec", err).WithParams(obj.GetKind(), obj.GetName())
+	}
+	if !found {
+		return false, nil
+	}
+
+	available := aa.available(workloadArchitectures(obj))
+	if len(available) == 0 {
+		if !aa.hasNode(syncCmd.ARM64Architecture) || !aa.replaceImages(podSpec) {
+			return false, derrors.NewFailedPreconditionError("the images of the workload cannot run on the nodes of the cluster").
+				WithParams(obj.GetKind(), obj.GetNamespace(), obj.GetName(), aa.Architectures)
+		}
+		log.Debug().Str("kind", obj.GetKind()).Str("name", obj.GetName()).Msg("arm64 images set")
+		available = []string{syncCmd.ARM64Architecture}
+	} else if len(available) == len(aa.Architectures) {
+		// The workload can run on any node.
+		return false, nil
+	}
+	if len(available) < len(aa.Architectures) {
+		requireArchitectures(podSpec, available)
+	}
+	if err := unstructured.SetNestedMap(obj.Object, podSpec, path...); err != nil {
+		return false, derrors.NewInternalError("cannot set pod spec", err).WithParams(obj.GetKind(), obj.GetName())
+	}
+	return true, nil
+}
+
+// workloadArchitectures returns the architectures supported by the images of a workload.
+func workloadArchitectures(obj *unstructured.Unstructured) []string {
+	value, found := obj.GetAnnotations()[ArchitecturesAnnotation]
+	if !found {
+		return DefaultWorkloadArchitectures
+	}
+	result := make([]string, 0)
+	for _, arch := range strings.Split(value, ",") {
+		if normalized, _ := utils.NormalizeArchitecture(arch); normalized != "" {
+			result = append(result, normalized)
+		}
+	}
+	return result
+}
+
+// hasNode checks if the cluster has nodes of an architecture.
+func (aa *ArchitectureAdapter) hasNode(arch string) bool {
+	for _, candidate := range aa.Architectures {
+		if candidate == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// available returns the architectures of the nodes of the cluster supported by a workload, in alphabetical order.
+func (aa *ArchitectureAdapter) available(supported []string) []string {
+	result := make([]string, 0)
+	for _, arch := range supported {
+		if aa.hasNode(arch) {
+			result = append(result, arch)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// arm64Image returns the arm64 variant of an image, looked up by image and then by repository.
+func (aa *ArchitectureAdapter) arm64Image(image string) (string, bool) {
+	if variant, found := aa.ARM64Images[image]; found {
+		return variant, true
+	}
+	if strings.Contains(image, "@") {
+		// The digest of the image does not match its variant.
+		return "", false
+	}
+	repository, tag := image, ""
+	if index := strings.LastIndex(image, ":"); index > strings.LastIndex(image, "/") {
+		repository, tag = image[:index], image[index:]
+	}
+	if variant, found := aa.ARM64Images[repository]; found {
+		return variant + tag, true
+	}
+	return "", false
+}
+
+// replaceImages sets the arm64 variants of the images of a pod spec if all of them have one.
+//   returns:
+//     Whether the images have been replaced.
+func (aa *ArchitectureAdapter) replaceImages(podSpec map[string]interface{}) bool {
+	fields := []string{"initContainers", "containers"}
+	replaced := make(map[string][]interface{}, len(fields))
+	for _, field := range fields {
+		containers, found, _ := unstructured.NestedSlice(podSpec, field)
+		if !found {
+			continue
+		}
+		for _, container := range containers {
+			content, ok := container.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			image, _ := content["image"].(string)
+			variant, found := aa.arm64Image(image)
+			if !found {
+				return false
+			}
+			content["image"] = variant
+		}
+		replaced[field] = containers
+	}
+	if len(replaced) == 0 {
+		return false
+	}
+	for field, containers := range replaced {
+		podSpec[field] = containers
+	}
+	return true
+}
+
+// requireArchitectures restricts a pod spec to the nodes of a set of architectures, adding the requirement to each of
+// the terms of its node affinity.
+func requireArchitectures(podSpec map[string]interface{}, archs []string) {
+	values := make([]interface{}, 0, len(archs))
+	for _, arch := range archs {
+		values = append(values, arch)
+	}
+	requirement := map[string]interface{}{"key": ArchitectureLabel, "operator": "In", "values": values}
+	path := []string{"affinity", "nodeAffinity", "requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms"}
+	terms, _, _ := unstructured.NestedSlice(podSpec, path...)
+	if len(terms) == 0 {
+		terms = []interface{}{map[string]interface{}{}}
+	}
+	for index, term := range terms {
+		content, ok := term.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		expressions, _, _ := unstructured.NestedSlice(content, "matchExpressions")
+		constrained := false
+		for _, expression := range expressions {
+			if e, ok := expression.(map[string]interface{}); ok && e["key"] == ArchitectureLabel {
+				constrained = true
+			}
+		}
+		if !constrained {
+			content["matchExpressions"] = append(expressions, requirement)
+		}
+		terms[index] = content
+	}
+	_ = unstructured.SetNestedSlice(podSpec, terms, path...)
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = ginkgo.Describe("Node architectures", func() {
+
+	deployment := func(annotations map[string]interface{}, images ...string) *unstructured.Unstructured {
+		containers := make([]interface{}, 0, len(images))
+		for _, image := range images {
+			containers = append(containers, map[string]interface{}{"name": "c", "image": image})
+		}
+		metadata := map[string]interface{}{"name": "app", "namespace": "nalej"}
+		if annotations != nil {
+			metadata["annotations"] = annotations
+		}
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   metadata,
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": containers,
+			}}},
+		}}
+	}
+
+	requiredArchitectures := func(obj *unstructured.Unstructured) []interface{} {
+		terms, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "affinity", "nodeAffinity",
+			"requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms")
+		gomega.Expect(terms).To(gomega.HaveLen(1))
+		expressions, _, _ := unstructured.NestedSlice(terms[0].(map[string]interface{}), "matchExpressions")
+		gomega.Expect(expressions).To(gomega.HaveLen(1))
+		values, _, _ := unstructured.NestedSlice(expressions[0].(map[string]interface{}), "values")
+		return values
+	}
+
+	image := func(obj *unstructured.Unstructured) string {
+		containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+		return containers[0].(map[string]interface{})["image"].(string)
+	}
+
+	ginkgo.It("should not modify the workloads of amd64 clusters", func() {
+		adapter := &ArchitectureAdapter{Architectures: []string{"amd64"}}
+		obj := deployment(nil, "nalej/app:v1")
+		adapted, err := adapter.Adapt(obj)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(adapted).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should keep the workloads on the nodes supported by their images", func() {
+		adapter := &ArchitectureAdapter{Architectures: []string{"amd64", "arm64"}}
+		obj := deployment(nil, "nalej/app:v1")
+		adapted, err := adapter.Adapt(obj)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(adapted).To(gomega.BeTrue())
+		gomega.Expect(requiredArchitectures(obj)).To(gomega.Equal([]interface{}{"amd64"}))
+
+		multi := deployment(map[string]interface{}{ArchitecturesAnnotation: "amd64,aarch64"}, "nalej/app:v1")
+		adapted, err = adapter.Adapt(multi)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(adapted).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should use the arm64 variants of the images on arm64 clusters", func() {
+		adapter := &ArchitectureAdapter{Architectures: []string{"arm64"},
+			ARM64Images: map[string]string{"nalej/app": "nalej/app-arm64", "registry:5000/db:1.0": "registry:5000/db-arm64:1.0.1"}}
+		obj := deployment(nil, "nalej/app:v1")
+		adapted, err := adapter.Adapt(obj)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(adapted).To(gomega.BeTrue())
+		gomega.Expect(image(obj)).To(gomega.Equal("nalej/app-arm64:v1"))
+
+		db := deployment(nil, "registry:5000/db:1.0")
+		_, err = adapter.Adapt(db)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(image(db)).To(gomega.Equal("registry:5000/db-arm64:1.0.1"))
+
+		partial := deployment(nil, "nalej/app:v1", "nalej/sidecar:v1")
+		_, err = adapter.Adapt(partial)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		gomega.Expect(image(partial)).To(gomega.Equal("nalej/app:v1"))
+	})
+
+	ginkgo.It("should detect the architectures of the nodes", func() {
+		node := func(name string, arch string) *v1.Node {
+			return &v1.Node{ObjectMeta: metaV1.ObjectMeta{Name: name},
+				Status: v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{Architecture: arch}}}
+		}
+		cluster := newFakeCluster(node("n1", "arm64"), node("n2", "amd64"), node("n3", "arm64"))
+		defer UnregisterClients(cluster.KubeConfigPath)
+		k := &Kubernetes{KubeConfigPath: cluster.KubeConfigPath}
+		gomega.Expect(k.Connect()).To(gomega.Succeed())
+		archs, err := k.NodeArchitectures()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(archs).To(gomega.Equal([]string{"amd64", "arm64"}))
+	})
+})
@@ -0,0 +1,269 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// IngressV1 is the first group version of the Ingress whose specification differs from the beta ones.
+const IngressV1 = "networking.k8s.io/v1"
+
+// compatibleVersions contains, for each kind, the group versions that share the same specification or that can be
+// converted, ordered from the newest to the oldest one.
+var compatibleVersions = map[string][]string{
+	"Deployment":          {"apps/v1", "apps/v1beta2", "extensions/v1beta1"},
+	"DaemonSet":           {"apps/v1", "apps/v1beta2", "extensions/v1beta1"},
+	"ReplicaSet":          {"apps/v1", "apps/v1beta2", "extensions/v1beta1"},
+	"StatefulSet":         {"apps/v1", "apps/v1beta2", "apps/v1beta1"},
+	"Ingress":             {IngressV1, "networking.k8s.io/v1beta1", "extensions/v1beta1"},
+	"NetworkPolicy":       {"networking.k8s.io/v1", "extensions/v1beta1"},
+	"PodSecurityPolicy":   {"policy/v1beta1", "extensions/v1beta1"},
+	"PodDisruptionBudget": {"policy/v1", "policy/v1beta1"},
+	"CronJob":             {"batch/v1", "batch/v1beta1"},
+	"PriorityClass":       {"scheduling.k8s.io/v1", "scheduling.k8s.io/v1beta1"},
+	"Role":                {"rbac.authorization.k8s.io/v1", "rbac.authorization.k8s.io/v1beta1"},
+	"RoleBinding":         {"rbac.authorization.k8s.io/v1", "rbac.authorization.k8s.io/v1beta1"},
+	"ClusterRole":         {"rbac.authorization.k8s.io/v1", "rbac.authorization.k8s.io/v1beta1"},
+	"ClusterRoleBinding":  {"rbac.authorization.k8s.io/v1", "rbac.authorization.k8s.io/v1beta1"},
+}
+
+// Capabilities structure with the version and the API groups of a Kubernetes cluster.
+type Capabilities struct {
+	// Major version of the server.
+	Major int
+	// Minor version of the server.
+	Minor int
+	// GitVersion with the complete version of the server.
+	GitVersion string
+	// GroupVersions served by the cluster.
+	GroupVersions map[string]bool
+}
+
+// NewCapabilities creates the capabilities of a cluster from the version reported by the server.
+//   params:
+//     major The major version, that may contain non numeric suffixes such as 1 or 1+.
+//     minor The minor version, that may contain non numeric suffixes such as 14 or 14+.
+//     gitVersion The complete version.
+//     groupVersions The group versions served by the cluster.
+//   returns:
+//     The capabilities of the cluster.
+func NewCapabilities(major string, minor string, gitVersion string, groupVersions []string) *Capabilities {
+	served := make(map[string]bool, len(groupVersions))
+	for _, gv := range groupVersions {
+		served[gv] = true
+	}
+	return &Capabilities{
+		Major:         versionNumber(major),
+		Minor:         versionNumber(minor),
+		GitVersion:    gitVersion,
+		GroupVersions: served,
+	}
+}
+
+// versionNumber parses the leading digits of a version number.
+func versionNumber(value string) int {
+	end := strings.IndexFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+	if end >= 0 {
+		value = value[:end]
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// AtLeast checks if the server version is equal or greater than the given one.
+func (c *Capabilities) AtLeast(major int, minor int) bool {
+	return c.Major > major || (c.Major == major && c.Minor >= minor)
+}
+
+// Supports checks if the cluster serves a group version such as apps/v1.
+func (c *Capabilities) Supports(groupVersion string) bool {
+	return c.GroupVersions[groupVersion]
+}
+
+// PreferredGroupVersion returns the group version to be used to create an object of the given kind. The requested
+// group version is kept if it is served by the cluster; otherwise the newest compatible one is selected.
+//   params:
+//     kind The kind of the object.
+//     requested The group version of the object.
+//   returns:
+//     The group version to be used.
+//     An error if the cluster does not serve any compatible group version.
+func (c *Capabilities) PreferredGroupVersion(kind string, requested string) (string, derrors.Error) {
+	if c.Supports(requested) {
+		return requested, nil
+	}
+	candidates, known := compatibleVersions[kind]
+	if !known || !contains(candidates, requested) {
+		// Let the API server report the error for unknown kinds.
+		return requested, nil
+	}
+	for _, candidate := range candidates {
+		if c.Supports(candidate) && canConvert(kind, requested, candidate) {
+			return candidate, nil
+		}
+	}
+	return "", derrors.NewUnavailableError("no compatible group version is served by the cluster").WithParams(kind, requested, c.GitVersion)
+}
+
+// String returns the server version and the number of group versions.
+func (c *Capabilities) String() string {
+	return fmt.Sprintf("%s (%d.%d) serving %d group versions", c.GitVersion, c.Major, c.Minor, len(c.GroupVersions))
+}
+
+// SortedGroupVersions returns the group versions served by the cluster in alphabetical order.
+func (c *Capabilities) SortedGroupVersions() []string {
+	result := make([]string, 0, len(c.GroupVersions))
+	for gv := range c.GroupVersions {
+		result = append(result, gv)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// contains checks if an element belongs to a list.
+func contains(list []string, element string) bool {
+	for _, candidate := range list {
+		if candidate == element {
+			return true
+		}
+	}
+	return false
+}
+
+// canConvert checks if an object can be moved from a group version to another one. Ingresses can be upgraded to
+// networking.k8s.io/v1 but not downgraded from it; the rest of the compatible versions only differ in the name.
+func canConvert(kind string, from string, to string) bool {
+	if kind == "Ingress" && from == IngressV1 {
+		return to == IngressV1
+	}
+	return true
+}
+
+// AdaptObject changes the group version of an object to one served by the cluster, converting its specification
+// if required.
+//   params:
+//     capabilities The capabilities of the target cluster.
+//     gvk The group version kind of the object.
+//     obj The object to be created.
+//   returns:
+//     The group version kind of the adapted object.
+//     An error if the cluster does not serve any compatible group version.
+func AdaptObject(capabilities *Capabilities, gvk schema.GroupVersionKind, obj *unstructured.Unstructured) (schema.GroupVersionKind, derrors.Error) {
+	requested := gvk.GroupVersion().String()
+	target, err := capabilities.PreferredGroupVersion(gvk.Kind, requested)
+	if err != nil {
+		return gvk, err
+	}
+	if target == requested {
+		return gvk, nil
+	}
+	if gvk.Kind == "Ingress" && target == IngressV1 {
+		if err := convertIngressToV1(obj.Object); err != nil {
+			return gvk, err
+		}
+	}
+	adapted := schema.FromAPIVersionAndKind(target, gvk.Kind)
+	obj.SetGroupVersionKind(adapted)
+	log.Debug().Str("kind", gvk.Kind).Str("requested", requested).Str("adapted", target).Msg("group version adapted")
+	return adapted, nil
+}
+
+// convertIngressToV1 transforms the specification of a beta Ingress into a networking.k8s.io/v1 one.
+func convertIngressToV1(obj map[string]interface{}) derrors.Error {
+	spec, found := obj["spec"].(map[string]interface{})
+	if !found {
+		return nil
+	}
+	if backend, exists := spec["backend"]; exists {
+		converted, err := convertIngressBackend(backend)
+		if err != nil {
+			return err
+		}
+		spec["defaultBackend"] = converted
+		delete(spec, "backend")
+	}
+	rules, _ := spec["rules"].([]interface{})
+	for _, rule := range rules {
+		ruleMap, _ := rule.(map[string]interface{})
+		http, _ := ruleMap["http"].(map[string]interface{})
+		paths, _ := http["paths"].([]interface{})
+		for _, p := range paths {
+			pathMap, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if _, exists := pathMap["pathType"]; !exists {
+				pathMap["pathType"] = "ImplementationSpecific"
+			}
+			if backend, exists := pathMap["backend"]; exists {
+				converted, err := convertIngressBackend(backend)
+				if err != nil {
+					return err
+				}
+				pathMap["backend"] = converted
+			}
+		}
+	}
+	return nil
+}
+
+// convertIngressBackend transforms a beta Ingress backend into a networking.k8s.io/v1 one.
+func convertIngressBackend(backend interface{}) (map[string]interface{}, derrors.Error) {
+	backendMap, ok := backend.(map[string]interface{})
+	if !ok {
+		return nil, derrors.NewInvalidArgumentError("invalid ingress backend").WithParams(backend)
+	}
+	serviceName, hasService := backendMap["serviceName"]
+	if !hasService {
+		// Resource backends share the same format.
+		return backendMap, nil
+	}
+	port := make(map[string]interface{}, 0)
+	switch value := backendMap["servicePort"].(type) {
+	case string:
+		if number, err := strconv.Atoi(value); err == nil {
+			port["number"] = int64(number)
+		} else {
+			port["name"] = value
+		}
+	case int64:
+		port["number"] = value
+	case float64:
+		port["number"] = int64(value)
+	default:
+		return nil, derrors.NewInvalidArgumentError("invalid ingress service port").WithParams(backendMap["servicePort"])
+	}
+	return map[string]interface{}{
+		"service": map[string]interface{}{
+			"name": serviceName,
+			"port": port,
+		},
+	}, nil
+}
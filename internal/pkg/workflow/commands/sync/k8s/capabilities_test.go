@@ -0,0 +1,102 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = ginkgo.Describe("Cluster capabilities", func() {
+
+	oldCluster := NewCapabilities("1", "14+", "v1.14.10-gke.1", []string{"v1", "apps/v1", "extensions/v1beta1", "policy/v1beta1"})
+	newCluster := NewCapabilities("1", "22", "v1.22.2", []string{"v1", "apps/v1", "networking.k8s.io/v1", "policy/v1"})
+
+	ginkgo.It("should parse versions with suffixes", func() {
+		gomega.Expect(oldCluster.Minor).To(gomega.Equal(14))
+		gomega.Expect(oldCluster.AtLeast(1, 14)).To(gomega.BeTrue())
+		gomega.Expect(oldCluster.AtLeast(1, 15)).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should keep the requested group version if it is served", func() {
+		gv, err := oldCluster.PreferredGroupVersion("Ingress", "extensions/v1beta1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(gv).To(gomega.Equal("extensions/v1beta1"))
+	})
+
+	ginkgo.It("should select a compatible group version", func() {
+		gv, err := newCluster.PreferredGroupVersion("PodDisruptionBudget", "policy/v1beta1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(gv).To(gomega.Equal("policy/v1"))
+		gv, err = oldCluster.PreferredGroupVersion("Deployment", "apps/v1beta2")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(gv).To(gomega.Equal("apps/v1"))
+	})
+
+	ginkgo.It("should fail if no compatible group version is served", func() {
+		_, err := oldCluster.PreferredGroupVersion("Ingress", IngressV1)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should keep the group version of unknown kinds", func() {
+		gv, err := newCluster.PreferredGroupVersion("Certificate", "cert-manager.io/v1alpha2")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(gv).To(gomega.Equal("cert-manager.io/v1alpha2"))
+	})
+
+	ginkgo.It("should convert beta ingresses", func() {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "extensions/v1beta1",
+			"kind":       "Ingress",
+			"spec": map[string]interface{}{
+				"backend": map[string]interface{}{"serviceName": "default", "servicePort": "http"},
+				"rules": []interface{}{
+					map[string]interface{}{
+						"host": "web.nalej.com",
+						"http": map[string]interface{}{
+							"paths": []interface{}{
+								map[string]interface{}{
+									"path":    "/*",
+									"backend": map[string]interface{}{"serviceName": "web", "servicePort": int64(80)},
+								},
+							},
+						},
+					},
+				},
+			},
+		}}
+		gvk, err := AdaptObject(newCluster, schema.FromAPIVersionAndKind("extensions/v1beta1", "Ingress"), obj)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(gvk.GroupVersion().String()).To(gomega.Equal(IngressV1))
+		gomega.Expect(obj.GetAPIVersion()).To(gomega.Equal(IngressV1))
+
+		name, _, _ := unstructured.NestedString(obj.Object, "spec", "defaultBackend", "service", "name")
+		gomega.Expect(name).To(gomega.Equal("default"))
+		portName, _, _ := unstructured.NestedString(obj.Object, "spec", "defaultBackend", "service", "port", "name")
+		gomega.Expect(portName).To(gomega.Equal("http"))
+
+		rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+		paths, _, _ := unstructured.NestedSlice(rules[0].(map[string]interface{}), "http", "paths")
+		path := paths[0].(map[string]interface{})
+		gomega.Expect(path["pathType"]).To(gomega.Equal("ImplementationSpecific"))
+		port, _, _ := unstructured.NestedInt64(path, "backend", "service", "port", "number")
+		gomega.Expect(port).To(gomega.Equal(int64(80)))
+	})
+})
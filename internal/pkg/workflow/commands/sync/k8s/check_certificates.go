@@ -0,0 +1,288 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Check certificates command
+// Scans the secrets with the certificates created by the installer looking for the ones about to expire. Self-signed
+// certificates whose private key is kept on the secret, such as the management CA or the identity of the VPN server,
+// can be renewed by signing them again with the same key and validity, so the clients trusting them keep working.
+// The rest are reported as a failed result so they can be replaced by their issuer. Missing secrets are ignored as
+// not every cluster contains all of them.
+//
+// {"type":"sync", "name":"checkCertificates", "kubeConfigPath":"/path/to/kubeconfig",
+// "renew_before":"720h", "renew":true}
+
+package k8s
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/pki"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultRenewBefore is the time before the expiration when the certificates are renewed or reported.
+const DefaultRenewBefore = "720h"
+
+// CertificateSecret identifies a secret holding a certificate created by the installer.
+type CertificateSecret struct {
+	// Namespace of the secret.
+	Namespace string `json:"namespace"`
+	// Name of the secret.
+	Name string `json:"name"`
+	// CertKey with the data key of the PEM certificate.
+	CertKey string `json:"cert_key"`
+	// PrivateKeyKey with the data key of the private key of a self-signed certificate that can be renewed. Empty if
+	// the installer cannot renew the certificate.
+	PrivateKeyKey string `json:"private_key_key"`
+}
+
+// String returns the namespace/name:key reference of the certificate.
+func (cs CertificateSecret) String() string {
+	return fmt.Sprintf("%s/%s:%s", cs.Namespace, cs.Name, cs.CertKey)
+}
+
+// DefaultCertificateSecrets contains the certificates created or copied by the installer. The Istio certificates
+// are signed by a root CA whose key is not kept, and the ingress certificates are issued by cert-manager on the
+// management cluster and copied to the application clusters, so they can only be reported. The internal CA is only
+// reported as a new CA must be trusted again by the clients.
+var DefaultCertificateSecrets = []CertificateSecret{
+	{Namespace: TargetNamespace, Name: "mngt-ca-cert", CertKey: v1.TLSCertKey, PrivateKeyKey: v1.TLSPrivateKeyKey},
+	{Namespace: TargetNamespace, Name: "vpn-server-identity", CertKey: v1.TLSCertKey, PrivateKeyKey: v1.TLSPrivateKeyKey},
+	{Namespace: "istio-system", Name: "cacerts", CertKey: "ca-cert.pem"},
+	{Namespace: "istio-system", Name: "cacerts", CertKey: "root-cert.pem"},
+	{Namespace: "istio-system", Name: "ingress-cert", CertKey: v1.TLSCertKey},
+	{Namespace: TargetNamespace, Name: "ingress-cert", CertKey: v1.TLSCertKey},
+	{Namespace: CertManagerNamespace, Name: InternalCAName, CertKey: v1.TLSCertKey},
+}
+
+// CertificateStatus contains the result of checking a certificate.
+type CertificateStatus struct {
+	CertificateSecret
+	// NotAfter with the expiration date of the certificate.
+	NotAfter time.Time
+	// Expiring indicates that the certificate expires within the renewal window.
+	Expiring bool
+	// Renewed indicates that the certificate has been renewed by the command.
+	Renewed bool
+}
+
+// CheckCertificates structure with the parameters of the certificate check.
+type CheckCertificates struct {
+	Kubernetes
+	// Secrets with the certificates to be checked, DefaultCertificateSecrets if empty.
+	Secrets []CertificateSecret `json:"secrets"`
+	// RenewBefore with the time before the expiration when certificates are renewed or reported, DefaultRenewBefore
+	// if empty.
+	RenewBefore string `json:"renew_before"`
+	// Renew indicates if the renewable certificates about to expire must be renewed.
+	Renew bool `json:"renew"`
+}
+
+// NewCheckCertificates creates a new CheckCertificates command.
+func NewCheckCertificates(kubeConfigPath string, renewBefore string, renew bool) *CheckCertificates {
+	return &CheckCertificates{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.CheckCertificates),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		RenewBefore: renewBefore,
+		Renew:       renew,
+	}
+}
+
+// NewCheckCertificatesFromJSON creates a new CheckCertificates command from a raw JSON representation.
+func NewCheckCertificatesFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	cc := &CheckCertificates{}
+	if err := json.Unmarshal(raw, &cc); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	cc.CommandID = entities.GenerateCommandID(cc.Name())
+	var r entities.Command = cc
+	return &r, nil
+}
+
+// ParseRenewBefore parses the renewal window of the certificates, DefaultRenewBefore if empty.
+func ParseRenewBefore(renewBefore string) (time.Duration, derrors.Error) {
+	if renewBefore == "" {
+		renewBefore = DefaultRenewBefore
+	}
+	window, err := time.ParseDuration(renewBefore)
+	if err != nil || window <= 0 {
+		return 0, derrors.NewInvalidArgumentError("renew_before must be a positive duration").WithParams(renewBefore)
+	}
+	return window, nil
+}
+
+// secrets returns the certificates to be checked.
+func (cc *CheckCertificates) secrets() []CertificateSecret {
+	if len(cc.Secrets) == 0 {
+		return DefaultCertificateSecrets
+	}
+	return cc.Secrets
+}
+
+// CheckSecrets checks the certificates of the cluster.
+//   params:
+//     window The time before the expiration when certificates are renewed or reported.
+//   returns:
+//     The status of the certificates found on the cluster.
+//     An error if the secrets cannot be read or a certificate cannot be renewed.
+func (cc *CheckCertificates) CheckSecrets(window time.Duration) ([]CertificateStatus, derrors.Error) {
+	result := make([]CertificateStatus, 0)
+	deadline := time.Now().Add(window)
+	for _, reference := range cc.secrets() {
+		secret, err := cc.Client.CoreV1().Secrets(reference.Namespace).Get(reference.Name, metaV1.GetOptions{})
+		if err != nil {
+			if k8sErrors.IsNotFound(err) {
+				continue
+			}
+			return nil, AsQueryError(err, "cannot retrieve secret", reference.Namespace, reference.Name)
+		}
+		certificate, pErr := parseCertificate(secret.Data[reference.CertKey])
+		if pErr != nil {
+			return nil, pErr.WithParams(reference.String())
+		}
+		status := CertificateStatus{
+			CertificateSecret: reference,
+			NotAfter:          certificate.NotAfter,
+			Expiring:          certificate.NotAfter.Before(deadline),
+		}
+		if status.Expiring && cc.Renew && reference.PrivateKeyKey != "" {
+			if rErr := cc.renew(secret, reference, certificate); rErr != nil {
+				return nil, rErr
+			}
+			status.Renewed = true
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// parseCertificate decodes the first certificate of a PEM block.
+func parseCertificate(raw []byte) (*x509.Certificate, derrors.Error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, derrors.NewInvalidArgumentError("secret does not contain a PEM certificate")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse certificate", err)
+	}
+	return certificate, nil
+}
+
+// renew signs a self-signed certificate again with its private key, keeping its subject and validity period.
+func (cc *CheckCertificates) renew(secret *v1.Secret, reference CertificateSecret, certificate *x509.Certificate) derrors.Error {
+	selfSigned := bytes.Equal(certificate.RawIssuer, certificate.RawSubject) && certificate.CheckSignature(
+		certificate.SignatureAlgorithm, certificate.RawTBSCertificate, certificate.Signature) == nil
+	if !selfSigned {
+		return derrors.NewFailedPreconditionError("only self-signed certificates can be renewed").
+			WithParams(reference.String())
+	}
+	pair, err := tls.X509KeyPair(secret.Data[reference.CertKey], secret.Data[reference.PrivateKeyKey])
+	if err != nil {
+		return derrors.NewInvalidArgumentError("certificate does not match its private key", err).
+			WithParams(reference.String())
+	}
+	serial, sErr := pki.NewSerialNumber()
+	if sErr != nil {
+		return sErr
+	}
+	template := *certificate
+	template.SerialNumber = serial
+	template.NotBefore = time.Now()
+	template.NotAfter = template.NotBefore.Add(certificate.NotAfter.Sub(certificate.NotBefore))
+	renewed, err := x509.CreateCertificate(rand.Reader, &template, &template, certificate.PublicKey, pair.PrivateKey)
+	if err != nil {
+		return derrors.NewInternalError("cannot renew certificate", err).WithParams(reference.String())
+	}
+	secret.Data[reference.CertKey] = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: renewed})
+	_, err = cc.Client.CoreV1().Secrets(secret.Namespace).Update(secret)
+	if err != nil {
+		return AsQueryError(err, "cannot update secret", secret.Namespace, secret.Name)
+	}
+	log.Info().Str("certificate", reference.String()).Time("expiration", template.NotAfter).Msg("certificate renewed")
+	return nil
+}
+
+// Run the current command.
+//   returns:
+//     The CommandResult
+//     An error if the command execution fails
+func (cc *CheckCertificates) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	window, err := ParseRenewBefore(cc.RenewBefore)
+	if err != nil {
+		return nil, err
+	}
+	connectErr := cc.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	statuses, err := cc.CheckSecrets(window)
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot check certificates", err), nil
+	}
+	renewed := 0
+	expiring := make([]string, 0)
+	for _, status := range statuses {
+		if status.Renewed {
+			renewed++
+		} else if status.Expiring {
+			log.Warn().Str("certificate", status.String()).Time("expiration", status.NotAfter).Msg("certificate about to expire")
+			expiring = append(expiring, fmt.Sprintf("%s expires %s", status.String(), status.NotAfter.UTC().Format(time.RFC3339)))
+		}
+	}
+	if len(expiring) > 0 {
+		msg := errors.Coded(errors.CertInvalid, fmt.Sprintf("%d certificates about to expire: %s", len(expiring), strings.Join(expiring, ", ")))
+		return entities.NewCommandResult(false, msg, derrors.NewFailedPreconditionError(msg)), nil
+	}
+	msg := fmt.Sprintf("%d certificates checked, %d renewed", len(statuses), renewed)
+	return entities.NewSuccessCommand([]byte(msg)), nil
+}
+
+// String returns a string representation
+func (cc *CheckCertificates) String() string {
+	renewBefore := cc.RenewBefore
+	if renewBefore == "" {
+		renewBefore = DefaultRenewBefore
+	}
+	return fmt.Sprintf("SYNC CheckCertificates renew before %s, renew: %t", renewBefore, cc.Renew)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (cc *CheckCertificates) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + cc.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (cc *CheckCertificates) UserString() string {
+	return "Checking the expiration of the certificates"
+}
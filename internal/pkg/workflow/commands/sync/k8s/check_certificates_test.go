@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"time"
+
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newCASecret creates the secret of the management CA with a certificate expiring at a given time.
+func newCASecret(certificate *Certificate) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{Name: "mngt-ca-cert", Namespace: TargetNamespace},
+		Type:       v1.SecretTypeTLS,
+		Data:       map[string][]byte{v1.TLSCertKey: certificate.Cert, v1.TLSPrivateKeyKey: certificate.Key},
+	}
+}
+
+var _ = ginkgo.Describe("A CheckCertificates command", func() {
+
+	var cluster *k8stest.FakeCluster
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	ginkgo.It("should succeed if no certificate is about to expire", func() {
+		cluster = newFakeCluster(newCASecret(newTestCertificate(time.Now().Add(365*24*time.Hour), "*.nalej.tech")))
+		result, err := NewCheckCertificates(cluster.KubeConfigPath, "", false).Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(result.Output).To(gomega.Equal("1 certificates checked, 0 renewed"))
+	})
+
+	ginkgo.It("should report the certificates about to expire", func() {
+		cluster = newFakeCluster(
+			newCASecret(newTestCertificate(time.Now().Add(24*time.Hour), "*.nalej.tech")),
+			newCertificateSecret(newTestCertificate(time.Now().Add(48*time.Hour), "*.nalej.tech")))
+		result, err := NewCheckCertificates(cluster.KubeConfigPath, "", false).Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+		gomega.Expect(result.Output).To(gomega.ContainSubstring("2 certificates about to expire"))
+		gomega.Expect(result.Output).To(gomega.ContainSubstring("nalej/mngt-ca-cert:tls.crt"))
+		gomega.Expect(result.Output).To(gomega.ContainSubstring("istio-system/ingress-cert:tls.crt"))
+	})
+
+	ginkgo.It("should renew the self-signed certificates keeping their key", func() {
+		original := newTestCertificate(time.Now().Add(24*time.Hour), "*.nalej.tech")
+		cluster = newFakeCluster(newCASecret(original))
+		result, err := NewCheckCertificates(cluster.KubeConfigPath, "", true).Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(result.Output).To(gomega.Equal("1 certificates checked, 1 renewed"))
+
+		secret, gErr := cluster.Client.CoreV1().Secrets(TargetNamespace).Get("mngt-ca-cert", metaV1.GetOptions{})
+		gomega.Expect(gErr).To(gomega.Succeed())
+		renewed := &Certificate{Cert: secret.Data[v1.TLSCertKey], Key: secret.Data[v1.TLSPrivateKeyKey]}
+		gomega.Expect(renewed.Key).To(gomega.Equal(original.Key))
+		leaf, vErr := renewed.Validate([]string{"ca.nalej.tech"})
+		gomega.Expect(vErr).To(gomega.Succeed())
+		gomega.Expect(leaf.NotAfter).To(gomega.BeTemporally(">", time.Now().Add(24*time.Hour)))
+	})
+
+	ginkgo.It("should only report the certificates that cannot be renewed", func() {
+		cluster = newFakeCluster(newCertificateSecret(newTestCertificate(time.Now().Add(24*time.Hour), "*.nalej.tech")))
+		result, err := NewCheckCertificates(cluster.KubeConfigPath, "", true).Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+		gomega.Expect(result.Output).To(gomega.ContainSubstring("1 certificates about to expire"))
+	})
+
+	ginkgo.It("should reject invalid renewal windows", func() {
+		_, err := ParseRenewBefore("-1h")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		window, err := ParseRenewBefore("")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(window).To(gomega.Equal(30 * 24 * time.Hour))
+	})
+})
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/compatibility"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/nalej/installer/version"
+	"github.com/rs/zerolog/log"
+)
+
+// CheckCompatibility command checking the versions involved in an install against the compatibility matrix.
+type CheckCompatibility struct {
+	Kubernetes
+	// ManifestPath with the compatibility manifest, the builtin one is used if empty.
+	ManifestPath string `json:"manifest_path"`
+	// ComponentsPath with the platform components to be installed.
+	ComponentsPath string `json:"components_path"`
+	// IstioPath with the directory of istioctl, empty if Istio is not used.
+	IstioPath string `json:"istio_path"`
+	// AllowUnsupported reports the unsupported combinations as warnings instead of failing.
+	AllowUnsupported bool `json:"allow_unsupported"`
+	// installerVersion overrides the version of the running installer.
+	installerVersion string
+}
+
+// NewCheckCompatibility creates a new CheckCompatibility command.
+func NewCheckCompatibility(kubeConfigPath string, componentsPath string, istioPath string) *CheckCompatibility {
+	return &CheckCompatibility{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.CheckCompatibility),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		ComponentsPath: componentsPath,
+		IstioPath:      istioPath,
+	}
+}
+
+// NewCheckCompatibilityFromJSON creates a CheckCompatibility command from a JSON object.
+func NewCheckCompatibilityFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	cc := &CheckCompatibility{}
+	if err := json.Unmarshal(raw, &cc); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	cc.CommandID = entities.GenerateCommandID(cc.Name())
+	var r entities.Command = cc
+	return &r, nil
+}
+
+// versions collects the versions found in the environment of the install.
+func (cc *CheckCompatibility) versions() (*compatibility.Versions, derrors.Error) {
+	result := &compatibility.Versions{Installer: version.AppVersion}
+	if cc.installerVersion != "" {
+		result.Installer = cc.installerVersion
+	}
+	capabilities, err := cc.Capabilities()
+	if err != nil {
+		return nil, err
+	}
+	result.Kubernetes = capabilities.GitVersion
+	if cc.ComponentsPath != "" {
+		platform, err := compatibility.DetectPlatformVersion(cc.ComponentsPath)
+		if err != nil {
+			return nil, err
+		}
+		result.Platform = platform
+	}
+	if cc.IstioPath != "" {
+		istio, err := compatibility.DetectIstioVersion(cc.IstioPath)
+		if err != nil {
+			return nil, err
+		}
+		result.Istio = istio
+	}
+	return result, nil
+}
+
+func (cc *CheckCompatibility) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	manifest, err := compatibility.LoadManifest(cc.ManifestPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := cc.Connect(); err != nil {
+		return nil, err
+	}
+	versions, err := cc.versions()
+	if err != nil {
+		return nil, err
+	}
+	report := manifest.Check(*versions)
+	for _, issue := range report.Issues {
+		log.Warn().Str("component", issue.Component).Str("level", string(issue.Level)).Msg(issue.Message)
+	}
+	summary := fmt.Sprintf("installer %s, platform %s, kubernetes %s, istio %s", versions.Installer,
+		versions.Platform, versions.Kubernetes, versions.Istio)
+	if !report.Supported() {
+		msg := fmt.Sprintf("unsupported combination (%s): %s", summary, strings.Join(report.Messages(compatibility.ErrorLevel), "; "))
+		if !cc.AllowUnsupported {
+			return entities.NewCommandResult(false, errors.Coded(errors.UnsupportedVersion, msg), nil), nil
+		}
+		return entities.NewSuccessCommand([]byte(msg)), nil
+	}
+	return entities.NewSuccessCommand([]byte("Compatible versions: " + summary)), nil
+}
+
+func (cc *CheckCompatibility) String() string {
+	return fmt.Sprintf("SYNC CheckCompatibility components: %s istio: %s allowUnsupported: %t", cc.ComponentsPath, cc.IstioPath, cc.AllowUnsupported)
+}
+
+func (cc *CheckCompatibility) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + cc.String()
+}
+
+func (cc *CheckCompatibility) UserString() string {
+	return "Checking version compatibility"
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/installer/internal/pkg/compatibility"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("A CheckCompatibility command", func() {
+
+	var cluster *k8stest.FakeCluster
+	var componentsDir string
+
+	ginkgo.BeforeEach(func() {
+		cluster = newFakeCluster()
+		var err error
+		componentsDir, err = ioutil.TempDir("", "components")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(filepath.Join(componentsDir, compatibility.PlatformVersionFile), []byte("0.4.0"), 0644)).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+		gomega.Expect(os.RemoveAll(componentsDir)).To(gomega.Succeed())
+	})
+
+	newCommand := func() *CheckCompatibility {
+		cmd := NewCheckCompatibility(cluster.KubeConfigPath, componentsDir, "")
+		cmd.installerVersion = "v0.4.1"
+		return cmd
+	}
+
+	ginkgo.It("should succeed on supported versions", func() {
+		cluster.SetVersion("1.15")
+		result, err := newCommand().Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should refuse unsupported Kubernetes versions unless allowed", func() {
+		cluster.SetVersion("1.18")
+		result, err := newCommand().Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+
+		cmd := newCommand()
+		cmd.AllowUnsupported = true
+		result, err = cmd.Run("w2")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should only warn for unknown installer versions", func() {
+		cluster.SetVersion("1.18")
+		cmd := newCommand()
+		cmd.installerVersion = "dev"
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+	})
+})
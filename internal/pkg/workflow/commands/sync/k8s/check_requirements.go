@@ -85,19 +85,25 @@ func (cr *CheckRequirements) Run(workflowID string) (*entities.CommandResult, de
 	if connectErr != nil {
 		return nil, connectErr
 	}
-	// Check the server version.
-	sv, err := cr.Client.Discovery().ServerVersion()
-
+	// Check the server version and detect the API groups used to adapt the objects created by the next commands.
+	capabilities, err := cr.Capabilities()
 	if err != nil {
-		return nil, derrors.NewInternalError("cannot connect to K8s", err)
+		code, found := errors.ErrorCode(err)
+		if !found {
+			code = errors.K8sUnreachable
+		}
+		return nil, derrors.NewInternalError(errors.Coded(code, "cannot connect to K8s")).CausedBy(err)
 	}
 
-	log.Debug().Str("version", sv.String()).Msg("Server")
-	if !cr.CheckVersion(sv.Major, sv.Minor) {
-		msg := fmt.Sprintf("expecting %s, found %s.%s", cr.MinVersion, sv.Major, sv.Minor)
+	log.Debug().Str("version", capabilities.GitVersion).
+		Strs("groupVersions", capabilities.SortedGroupVersions()).Msg("Server")
+	major := strconv.Itoa(capabilities.Major)
+	minor := strconv.Itoa(capabilities.Minor)
+	if !cr.CheckVersion(major, minor) {
+		msg := errors.Coded(errors.PrecheckFailed, fmt.Sprintf("expecting %s, found %s.%s", cr.MinVersion, major, minor))
 		return entities.NewCommandResult(false, msg, nil), nil
 	}
-	msg := fmt.Sprintf("Version OK, found %s.%s", sv.Major, sv.Minor)
+	msg := fmt.Sprintf("Version OK, found %s.%s", major, minor)
 	return entities.NewSuccessCommand([]byte(msg)), nil
 }
 
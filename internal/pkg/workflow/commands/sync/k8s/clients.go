@@ -0,0 +1,337 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/cryptopolicy"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// DefaultQPS is the number of queries per second sent to the Kubernetes API if none is specified. The client-go
+// default of 5 throttles the installs on busy clusters.
+const DefaultQPS float32 = 20
+
+// DefaultBurst is the number of queries sent at once to the Kubernetes API if none is specified.
+const DefaultBurst = 40
+
+// maxCachedClients is the number of client sets kept by the cache.
+const maxCachedClients = 32
+
+// clientDefaults contains the QPS and burst used by the commands that do not define them.
+var clientDefaults = struct {
+	sync.Mutex
+	qps   float32
+	burst int
+}{qps: DefaultQPS, burst: DefaultBurst}
+
+// SetClientDefaults sets the QPS and burst of the Kubernetes clients of the commands that do not define them.
+//   params:
+//     qps The number of queries per second.
+//     burst The number of queries sent at once.
+func SetClientDefaults(qps float32, burst int) {
+	clientDefaults.Lock()
+	defer clientDefaults.Unlock()
+	if qps > 0 {
+		clientDefaults.qps = qps
+	}
+	if burst > 0 {
+		clientDefaults.burst = burst
+	}
+}
+
+// getClientDefaults returns the QPS and burst of the commands that do not define them.
+func getClientDefaults() (float32, int) {
+	clientDefaults.Lock()
+	defer clientDefaults.Unlock()
+	return clientDefaults.qps, clientDefaults.burst
+}
+
+// clientSet structure with the clients used to interact with a Kubernetes cluster.
+type clientSet struct {
+	client          kubernetes.Interface
+	discoveryClient discovery.DiscoveryInterface
+	dynClient       dynamic.Interface
+	// lock protects the cached discovery information.
+	lock sync.Mutex
+	// groupResources contains the API groups and resources supported by the cluster.
+	groupResources []*restmapper.APIGroupResources
+	// capabilities with the version and the group versions of the cluster.
+	capabilities *Capabilities
+}
+
+// getCapabilities detects the version and the group versions served by the cluster the first time it is called.
+func (cs *clientSet) getCapabilities() (*Capabilities, derrors.Error) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if cs.capabilities != nil {
+		return cs.capabilities, nil
+	}
+	version, err := cs.discoveryClient.ServerVersion()
+	if err != nil {
+		return nil, derrors.NewUnavailableError(errors.Coded(ConnectionErrorCode(err), "cannot obtain the server version"), err)
+	}
+	groups, err := cs.discoveryClient.ServerGroups()
+	if err != nil {
+		return nil, derrors.NewUnavailableError(errors.Coded(ConnectionErrorCode(err), "cannot obtain the server groups"), err)
+	}
+	groupVersions := make([]string, 0)
+	for _, group := range groups.Groups {
+		for _, gv := range group.Versions {
+			groupVersions = append(groupVersions, gv.GroupVersion)
+		}
+	}
+	cs.capabilities = NewCapabilities(version.Major, version.Minor, version.GitVersion, groupVersions)
+	log.Debug().Str("capabilities", cs.capabilities.String()).Msg("cluster capabilities detected")
+	return cs.capabilities, nil
+}
+
+// restMapping obtains the REST endpoint of a kind using the cached discovery information. The information is
+// refreshed once if the kind is not found, as a custom resource definition may have been created after it was
+// retrieved.
+//   params:
+//     gvk The group, version and kind of the object.
+//   returns:
+//     The REST mapping.
+//     An error if the kind is not supported by the cluster.
+func (cs *clientSet) restMapping(gvk schema.GroupVersionKind) (*meta.RESTMapping, derrors.Error) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	for refreshed := false; ; refreshed = true {
+		if cs.groupResources == nil || refreshed {
+			resources, err := restmapper.GetAPIGroupResources(cs.discoveryClient)
+			if err != nil {
+				return nil, derrors.NewInternalError("failed to get api group resources", err)
+			}
+			cs.groupResources = resources
+		}
+		mapping, err := restmapper.NewDiscoveryRESTMapper(cs.groupResources).RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err == nil {
+			return mapping, nil
+		}
+		if refreshed {
+			return nil, derrors.NewInternalError("unable to get REST mapping for object", err).WithParams(gvk.String())
+		}
+	}
+}
+
+// clientCache structure that shares the client sets among the commands that use the same kubeconfig.
+type clientCache struct {
+	sync.Mutex
+	clients map[string]*clientSet
+	// order contains the keys of the clients in order of creation.
+	order []string
+	// registered contains the clients set with RegisterClients indexed by kubeconfig path.
+	registered map[string]*clientSet
+}
+
+// sharedClients is the cache used by all Kubernetes commands.
+var sharedClients = newClientCache()
+
+// newClientCache creates an empty cache.
+func newClientCache() *clientCache {
+	return &clientCache{clients: make(map[string]*clientSet, 0), order: make([]string, 0),
+		registered: make(map[string]*clientSet, 0)}
+}
+
+// RegisterClients makes the commands using a kubeconfig path use the given clients instead of connecting to a
+// cluster, so the commands can be tested against the fake clients of k8stest.
+//   params:
+//     kubeConfigPath The kubeconfig path of the commands.
+//     client The client of the typed API.
+//     discoveryClient The discovery client.
+//     dynClient The dynamic client.
+func RegisterClients(kubeConfigPath string, client kubernetes.Interface, discoveryClient discovery.DiscoveryInterface, dynClient dynamic.Interface) {
+	sharedClients.Lock()
+	defer sharedClients.Unlock()
+	sharedClients.registered[kubeConfigPath] = &clientSet{client: client, discoveryClient: discoveryClient, dynClient: dynClient}
+}
+
+// UnregisterClients removes the clients registered for a kubeconfig path.
+func UnregisterClients(kubeConfigPath string) {
+	sharedClients.Lock()
+	defer sharedClients.Unlock()
+	delete(sharedClients.registered, kubeConfigPath)
+}
+
+// clientKey returns the cache key of a kubeconfig and context. The content is used instead of the path as the same
+// temporal path may be reused by different clusters.
+func clientKey(kubeConfigPath string, kubeContext string, qps float32, burst int) (string, derrors.Error) {
+	content := []byte("in-cluster")
+	if kubeConfigPath != "" {
+		raw, err := ioutil.ReadFile(kubeConfigPath)
+		if err != nil {
+			return "", derrors.NewInvalidArgumentError("cannot read kubeconfig", err).WithParams(kubeConfigPath)
+		}
+		content = raw
+	}
+	hash := sha256.Sum256(content)
+	return fmt.Sprintf("%s-%s-%f-%d", hex.EncodeToString(hash[:]), kubeContext, qps, burst), nil
+}
+
+// transportWrapper wraps the transport of the clients created from then on.
+var transportWrapper = struct {
+	sync.Mutex
+	wrap func(rt http.RoundTripper) http.RoundTripper
+}{}
+
+// SetTransportWrapper sets a function wrapping the transport of the Kubernetes clients, such as the one of a
+// recorder.Recorder used by the integration tests. The cached clients are discarded so the new ones use it.
+func SetTransportWrapper(wrap func(rt http.RoundTripper) http.RoundTripper) {
+	transportWrapper.Lock()
+	transportWrapper.wrap = wrap
+	transportWrapper.Unlock()
+	sharedClients.Lock()
+	defer sharedClients.Unlock()
+	sharedClients.clients = make(map[string]*clientSet, 0)
+	sharedClients.order = make([]string, 0)
+}
+
+// buildConfig creates the REST configuration of a kubeconfig, using its current context if none is specified.
+func buildConfig(kubeConfigPath string, kubeContext string) (*rest.Config, error) {
+	var config *rest.Config
+	var err error
+	if kubeContext == "" {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeConfigPath)
+	} else {
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfigPath},
+			&clientcmd.ConfigOverrides{CurrentContext: kubeContext}).ClientConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := RestrictTransport(config); err != nil {
+		return nil, err
+	}
+	transportWrapper.Lock()
+	defer transportWrapper.Unlock()
+	if transportWrapper.wrap != nil {
+		config.WrapTransport = transportWrapper.wrap
+	}
+	return config, nil
+}
+
+// RestrictTransport limits the TLS connections of a REST configuration to the approved versions and cipher suites
+// if the restricted crypto mode is enabled. As the REST configuration does not expose them, the TLS options are moved
+// into a custom transport.
+//   params:
+//     config The REST configuration, which is modified.
+//   returns:
+//     An error if the TLS options of the configuration are not valid.
+func RestrictTransport(config *rest.Config) error {
+	if !cryptopolicy.Restricted() || config.Transport != nil {
+		return nil
+	}
+	tlsConfig, err := rest.TLSConfigFor(config)
+	if err != nil {
+		return err
+	}
+	if tlsConfig == nil {
+		return nil
+	}
+	config.Transport = utilnet.SetTransportDefaults(&http.Transport{TLSClientConfig: cryptopolicy.RestrictTLS(tlsConfig)})
+	config.TLSClientConfig = rest.TLSClientConfig{}
+	return nil
+}
+
+// get returns the client set of a kubeconfig, creating it if it is not in the cache.
+//   params:
+//     kubeConfigPath The path of the kubeconfig file, or empty to use the in-cluster configuration.
+//     kubeContext The kubeconfig context to use, or empty to use the current one.
+//     qps The number of queries per second.
+//     burst The number of queries sent at once.
+//   returns:
+//     The client set.
+//     An error if the clients cannot be created.
+func (cc *clientCache) get(kubeConfigPath string, kubeContext string, qps float32, burst int) (*clientSet, derrors.Error) {
+	cc.Lock()
+	registered, isRegistered := cc.registered[kubeConfigPath]
+	cc.Unlock()
+	if isRegistered {
+		return registered, nil
+	}
+	key, kErr := clientKey(kubeConfigPath, kubeContext, qps, burst)
+	if kErr != nil {
+		return nil, kErr
+	}
+	cc.Lock()
+	defer cc.Unlock()
+	if cached, exists := cc.clients[key]; exists {
+		return cached, nil
+	}
+
+	config, err := buildConfig(kubeConfigPath, kubeContext)
+	if err != nil {
+		log.Error().Err(err).Msg("error building configuration from kubeconfig")
+		return nil, derrors.AsError(err, "error building configuration from kubeconfig")
+	}
+	config.QPS = qps
+	config.Burst = burst
+
+	// create the clientset
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Error().Err(err).Msg("error using configuration to build k8s clientset")
+		return nil, derrors.AsError(err, "error using configuration to build k8s clientset")
+	}
+	// Create the discovery client
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, derrors.NewInternalError("failed to create discovery client", err)
+	}
+	// Create the dynamic client that can be used to create any object
+	// by specifying what resource we're dealing with by using the REST mapper
+	dynClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, derrors.NewInternalError("failed to create dynamic client", err)
+	}
+
+	created := &clientSet{client: clientset, discoveryClient: discoveryClient, dynClient: dynClient}
+	cc.add(key, created)
+	log.Debug().Str("kubeConfigPath", kubeConfigPath).Str("context", kubeContext).Float32("qps", qps).Int("burst", burst).Msg("kubernetes clients created")
+	return created, nil
+}
+
+// add stores a client set, removing the oldest one if the cache is full.
+func (cc *clientCache) add(key string, clients *clientSet) {
+	if len(cc.order) >= maxCachedClients {
+		delete(cc.clients, cc.order[0])
+		cc.order = cc.order[1:]
+	}
+	cc.clients[key] = clients
+	cc.order = append(cc.order, key)
+}
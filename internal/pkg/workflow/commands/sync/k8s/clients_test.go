@@ -0,0 +1,106 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/nalej/installer/internal/pkg/cryptopolicy"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"io/ioutil"
+	"k8s.io/client-go/rest"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+var _ = ginkgo.Describe("Kubernetes clients", func() {
+
+	var tempDir string
+
+	ginkgo.BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "clients")
+		gomega.Expect(err).To(gomega.Succeed())
+		tempDir = dir
+	})
+
+	ginkgo.AfterEach(func() {
+		gomega.Expect(os.RemoveAll(tempDir)).To(gomega.Succeed())
+		SetClientDefaults(DefaultQPS, DefaultBurst)
+	})
+
+	ginkgo.It("should share the key of kubeconfigs with the same content, context and limits", func() {
+		first := filepath.Join(tempDir, "first")
+		second := filepath.Join(tempDir, "second")
+		gomega.Expect(ioutil.WriteFile(first, []byte("content"), 0600)).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(second, []byte("content"), 0600)).To(gomega.Succeed())
+		firstKey, err := clientKey(first, "", DefaultQPS, DefaultBurst)
+		gomega.Expect(err).To(gomega.Succeed())
+		secondKey, err := clientKey(second, "", DefaultQPS, DefaultBurst)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(firstKey).To(gomega.Equal(secondKey))
+		otherKey, err := clientKey(first, "", DefaultQPS*2, DefaultBurst)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(otherKey).NotTo(gomega.Equal(firstKey))
+		contextKey, err := clientKey(first, "other", DefaultQPS, DefaultBurst)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(contextKey).NotTo(gomega.Equal(firstKey))
+	})
+
+	ginkgo.It("should fail if the kubeconfig cannot be read", func() {
+		_, err := clientKey(filepath.Join(tempDir, "missing"), "", DefaultQPS, DefaultBurst)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should remove the oldest clients when the cache is full", func() {
+		cache := newClientCache()
+		for i := 0; i <= maxCachedClients; i++ {
+			cache.add(fmt.Sprintf("key-%d", i), &clientSet{})
+		}
+		gomega.Expect(len(cache.clients)).To(gomega.Equal(maxCachedClients))
+		gomega.Expect(cache.clients).NotTo(gomega.HaveKey("key-0"))
+		gomega.Expect(cache.clients).To(gomega.HaveKey(fmt.Sprintf("key-%d", maxCachedClients)))
+	})
+
+	ginkgo.It("should use the command limits over the defaults", func() {
+		SetClientDefaults(50, 0)
+		k := &Kubernetes{}
+		qps, burst := k.RateLimits()
+		gomega.Expect(qps).To(gomega.Equal(float32(50)))
+		gomega.Expect(burst).To(gomega.Equal(DefaultBurst))
+		k.Burst = 5
+		_, burst = k.RateLimits()
+		gomega.Expect(burst).To(gomega.Equal(5))
+	})
+
+	ginkgo.It("should restrict the TLS options of the clients in restricted crypto mode", func() {
+		config := &rest.Config{Host: "https://localhost:6443", TLSClientConfig: rest.TLSClientConfig{Insecure: true}}
+		gomega.Expect(RestrictTransport(config)).To(gomega.Succeed())
+		gomega.Expect(config.Transport).To(gomega.BeNil())
+
+		cryptopolicy.SetRestricted(true)
+		defer cryptopolicy.SetRestricted(false)
+		gomega.Expect(RestrictTransport(config)).To(gomega.Succeed())
+		transport, ok := config.Transport.(*http.Transport)
+		gomega.Expect(ok).To(gomega.BeTrue())
+		gomega.Expect(transport.TLSClientConfig.MaxVersion).To(gomega.Equal(uint16(tls.VersionTLS12)))
+		gomega.Expect(transport.TLSClientConfig.InsecureSkipVerify).To(gomega.BeTrue())
+		gomega.Expect(config.TLSClientConfig.Insecure).To(gomega.BeFalse())
+	})
+})
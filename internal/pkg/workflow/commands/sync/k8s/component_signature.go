@@ -0,0 +1,227 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/cryptopolicy"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/ed25519"
+)
+
+// ComponentsIndexFile is the name of the file with the digests of the components, using the sha256sum format.
+const ComponentsIndexFile = "components.sha256"
+
+// ComponentsSignatureFile is the name of the file with the signature of the index.
+const ComponentsSignatureFile = "components.sha256.sig"
+
+// ComponentsIndex structure with the digests of the files of a components directory.
+type ComponentsIndex struct {
+	// Digests with the hex encoded SHA-256 of each file indexed by file name.
+	Digests map[string]string
+}
+
+// isComponentFile checks if a file is a component, including the platform specific ones.
+func isComponentFile(name string) bool {
+	return strings.HasSuffix(name, ".yaml") || strings.Contains(name, ".yaml.")
+}
+
+// digest returns the hex encoded SHA-256 of a content.
+func digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// BuildComponentsIndex computes the digests of the components of a directory.
+func BuildComponentsIndex(dir string) (*ComponentsIndex, derrors.Error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot read components directory", err).WithParams(dir)
+	}
+	index := &ComponentsIndex{Digests: make(map[string]string)}
+	for _, file := range files {
+		if file.IsDir() || !isComponentFile(file.Name()) {
+			continue
+		}
+		content, err := ioutil.ReadFile(path.Join(dir, file.Name()))
+		if err != nil {
+			return nil, derrors.NewInternalError("cannot read component file", err).WithParams(file.Name())
+		}
+		index.Digests[file.Name()] = digest(content)
+	}
+	return index, nil
+}
+
+// ParseComponentsIndex reads an index in the sha256sum format.
+func ParseComponentsIndex(content []byte) (*ComponentsIndex, derrors.Error) {
+	index := &ComponentsIndex{Digests: make(map[string]string)}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, derrors.NewInvalidArgumentError("invalid components index entry").WithParams(line)
+		}
+		// sha256sum marks binary mode files with an asterisk.
+		index.Digests[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return index, nil
+}
+
+// Marshal returns the index in the sha256sum format sorted by file name.
+func (ci *ComponentsIndex) Marshal() []byte {
+	names := make([]string, 0, len(ci.Digests))
+	for name := range ci.Digests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buffer bytes.Buffer
+	for _, name := range names {
+		buffer.WriteString(fmt.Sprintf("%s  %s\n", ci.Digests[name], name))
+	}
+	return buffer.Bytes()
+}
+
+// Verify checks that the content of a component matches its digest on the index.
+func (ci *ComponentsIndex) Verify(fileName string, content []byte) derrors.Error {
+	expected, found := ci.Digests[fileName]
+	if !found {
+		return derrors.NewPermissionDeniedError("component not included in the signed index").WithParams(fileName)
+	}
+	if digest(content) != expected {
+		return derrors.NewPermissionDeniedError("component digest does not match the signed index").WithParams(fileName)
+	}
+	return nil
+}
+
+// LoadComponentsIndex reads the index of a components directory. If a public key is given the index must exist
+// and be signed by the matching private key. Without a public key the index is optional and only its digests are
+// checked.
+//   params:
+//     dir The components directory.
+//     publicKey The key used to verify the signature, nil to skip the verification.
+//   returns:
+//     The index or nil if the directory has no index and no key was given.
+//     An error if the index or its signature are not valid.
+func LoadComponentsIndex(dir string, publicKey ed25519.PublicKey) (*ComponentsIndex, derrors.Error) {
+	content, err := ioutil.ReadFile(path.Join(dir, ComponentsIndexFile))
+	if err != nil {
+		if os.IsNotExist(err) && publicKey == nil {
+			return nil, nil
+		}
+		return nil, derrors.NewPermissionDeniedError("cannot read components index", err).WithParams(dir)
+	}
+	if publicKey != nil {
+		rawSignature, err := ioutil.ReadFile(path.Join(dir, ComponentsSignatureFile))
+		if err != nil {
+			return nil, derrors.NewPermissionDeniedError("cannot read components signature", err).WithParams(dir)
+		}
+		signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(rawSignature)))
+		if err != nil || !ed25519.Verify(publicKey, content, signature) {
+			return nil, derrors.NewPermissionDeniedError("invalid components signature").WithParams(dir)
+		}
+	} else {
+		log.Warn().Str("dir", dir).Msg("components index found but no public key set, the signature is not verified")
+	}
+	return ParseComponentsIndex(content)
+}
+
+// SignComponents writes the index and its signature on a components directory.
+func SignComponents(dir string, privateKey ed25519.PrivateKey) (*ComponentsIndex, derrors.Error) {
+	index, err := BuildComponentsIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	content := index.Marshal()
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, content)) + "\n"
+	if err := ioutil.WriteFile(path.Join(dir, ComponentsIndexFile), content, 0644); err != nil {
+		return nil, derrors.NewInternalError("cannot write components index", err).WithParams(dir)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, ComponentsSignatureFile), []byte(signature), 0644); err != nil {
+		return nil, derrors.NewInternalError("cannot write components signature", err).WithParams(dir)
+	}
+	return index, nil
+}
+
+// GenerateSigningKeys creates a key pair to sign the components, writing the base64 encoded keys.
+func GenerateSigningKeys(publicKeyPath string, privateKeyPath string) derrors.Error {
+	if err := cryptopolicy.CheckAlgorithm(cryptopolicy.Ed25519); err != nil {
+		return err
+	}
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return derrors.NewInternalError("cannot generate signing keys", err)
+	}
+	if err := ioutil.WriteFile(privateKeyPath, []byte(base64.StdEncoding.EncodeToString(privateKey)+"\n"), 0600); err != nil {
+		return derrors.NewInternalError("cannot write private key", err).WithParams(privateKeyPath)
+	}
+	if err := ioutil.WriteFile(publicKeyPath, []byte(base64.StdEncoding.EncodeToString(publicKey)+"\n"), 0644); err != nil {
+		return derrors.NewInternalError("cannot write public key", err).WithParams(publicKeyPath)
+	}
+	return nil
+}
+
+// readKey reads a base64 encoded key of the expected size.
+func readKey(keyPath string, size int) ([]byte, derrors.Error) {
+	if err := cryptopolicy.CheckAlgorithm(cryptopolicy.Ed25519); err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot read key", err).WithParams(keyPath)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(key) != size {
+		return nil, derrors.NewInvalidArgumentError("invalid key").WithParams(keyPath)
+	}
+	return key, nil
+}
+
+// LoadSigningPublicKey reads the public key used to verify the components.
+func LoadSigningPublicKey(keyPath string) (ed25519.PublicKey, derrors.Error) {
+	key, err := readKey(keyPath, ed25519.PublicKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// LoadSigningPrivateKey reads the private key used to sign the components.
+func LoadSigningPrivateKey(keyPath string) (ed25519.PrivateKey, derrors.Error) {
+	key, err := readKey(keyPath, ed25519.PrivateKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.PrivateKey(key), nil
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/cryptopolicy"
+	"github.com/nalej/installer/internal/pkg/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Component signatures", func() {
+
+	var componentsDir string
+	var keysDir string
+
+	ginkgo.BeforeEach(func() {
+		componentsDir = CreateTempYAML(3, 1, grpc_installer_go.Platform_AZURE.String())
+		var err error
+		keysDir, err = ioutil.TempDir("", "keys")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(GenerateSigningKeys(filepath.Join(keysDir, "signing.pub"), filepath.Join(keysDir, "signing.key"))).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		gomega.Expect(os.RemoveAll(componentsDir)).To(gomega.Succeed())
+		gomega.Expect(os.RemoveAll(keysDir)).To(gomega.Succeed())
+	})
+
+	sign := func() {
+		privateKey, err := LoadSigningPrivateKey(filepath.Join(keysDir, "signing.key"))
+		gomega.Expect(err).To(gomega.Succeed())
+		index, err := SignComponents(componentsDir, privateKey)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(index.Digests).Should(gomega.HaveLen(4))
+	}
+
+	load := func() (*ComponentsIndex, error) {
+		publicKey, err := LoadSigningPublicKey(filepath.Join(keysDir, "signing.pub"))
+		gomega.Expect(err).To(gomega.Succeed())
+		index, lErr := LoadComponentsIndex(componentsDir, publicKey)
+		if lErr != nil {
+			return nil, lErr
+		}
+		return index, nil
+	}
+
+	ginkgo.It("should parse the index it writes", func() {
+		index, err := BuildComponentsIndex(componentsDir)
+		gomega.Expect(err).To(gomega.Succeed())
+		parsed, err := ParseComponentsIndex(index.Marshal())
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(parsed.Digests).Should(gomega.Equal(index.Digests))
+	})
+
+	ginkgo.It("should verify a signed directory", func() {
+		sign()
+		index, err := load()
+		gomega.Expect(err).To(gomega.Succeed())
+		content, rErr := ioutil.ReadFile(filepath.Join(componentsDir, "0.yaml"))
+		gomega.Expect(rErr).To(gomega.Succeed())
+		gomega.Expect(index.Verify("0.yaml", content)).To(gomega.Succeed())
+		gomega.Expect(index.Verify("0.yaml", append(content, '\n'))).ShouldNot(gomega.Succeed())
+		gomega.Expect(index.Verify("unknown.yaml", content)).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject a modified index", func() {
+		sign()
+		indexPath := filepath.Join(componentsDir, ComponentsIndexFile)
+		content, err := ioutil.ReadFile(indexPath)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(indexPath, append(content, []byte("0000000000000000000000000000000000000000000000000000000000000000  extra.yaml\n")...), 0644)).To(gomega.Succeed())
+		_, lErr := load()
+		gomega.Expect(lErr).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should require the index only if a public key is set", func() {
+		index, err := LoadComponentsIndex(componentsDir, nil)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(index).Should(gomega.BeNil())
+		_, lErr := load()
+		gomega.Expect(lErr).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should refuse to load tampered components", func() {
+		component := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n  namespace: nalej\n"
+		gomega.Expect(ioutil.WriteFile(filepath.Join(componentsDir, "0.yaml"), []byte(component), 0644)).To(gomega.Succeed())
+		sign()
+		launchCmd := NewLaunchComponents("kubeConfigPath", []string{}, componentsDir, grpc_installer_go.Platform_AZURE.String())
+		launchCmd.SignaturePublicKeyPath = filepath.Join(keysDir, "signing.pub")
+		index, err := launchCmd.loadComponentsIndex()
+		gomega.Expect(err).To(gomega.Succeed())
+		_, _, err = launchCmd.loadComponent("0.yaml", entities.Production, index)
+		gomega.Expect(err).To(gomega.Succeed())
+
+		tampered := component + "data:\n  injected: value\n"
+		gomega.Expect(ioutil.WriteFile(filepath.Join(componentsDir, "0.yaml"), []byte(tampered), 0644)).To(gomega.Succeed())
+		_, _, err = launchCmd.loadComponent("0.yaml", entities.Production, index)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject the signing keys in restricted crypto mode", func() {
+		cryptopolicy.SetRestricted(true)
+		defer cryptopolicy.SetRestricted(false)
+		_, err := LoadSigningPublicKey(filepath.Join(keysDir, "signing.pub"))
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(GenerateSigningKeys(filepath.Join(keysDir, "other.pub"), filepath.Join(keysDir, "other.key"))).ShouldNot(gomega.Succeed())
+	})
+})
@@ -0,0 +1,363 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the setup of the platform namespaces with their standard metadata, and the LimitRange and
+// ResourceQuota governing the resources of the components, configurable per target environment.
+
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/nalej/derrors"
+	entities2 "github.com/nalej/installer/internal/pkg/entities"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// PartOfLabel identifies the namespaces of the platform.
+const PartOfLabel = "app.kubernetes.io/part-of"
+
+// PartOfPlatform is the value of the PartOfLabel of the platform namespaces.
+const PartOfPlatform = "nalej"
+
+// EnvironmentLabel contains the target environment of the install on the platform namespaces.
+const EnvironmentLabel = "installer.nalej.com/environment"
+
+// InstallIDAnnotation contains the identifier of the install that configured the namespace.
+const InstallIDAnnotation = "installer.nalej.com/install-id"
+
+// Names of the governance objects created on each platform namespace.
+const (
+	GovernanceLimitRange    = "nalej-limits"
+	GovernanceResourceQuota = "nalej-quota"
+)
+
+// NamespaceGovernance with the metadata and resource constraints of the platform namespaces.
+type NamespaceGovernance struct {
+	// Labels added to the standard labels of the namespaces.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations set on the namespaces.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// DefaultRequests with the requests of the containers that do not declare them.
+	DefaultRequests v1.ResourceList `json:"default_requests,omitempty"`
+	// DefaultLimits with the limits of the containers that do not declare them.
+	DefaultLimits v1.ResourceList `json:"default_limits,omitempty"`
+	// MaxLimits with the maximum limits of a container.
+	MaxLimits v1.ResourceList `json:"max_limits,omitempty"`
+	// Quota with the hard limits of the namespace, such as requests.cpu or pods. No quota is created if empty.
+	Quota v1.ResourceList `json:"quota,omitempty"`
+}
+
+// NamespaceGovernanceConfig with the governance of each target environment, read from a YAML or JSON file. The
+// values of an environment replace the defaults field by field.
+type NamespaceGovernanceConfig struct {
+	Environments map[string]NamespaceGovernance `json:"environments"`
+}
+
+// resources builds a resource list from its quantities, panicking on invalid values as they are constants.
+func resources(values map[v1.ResourceName]string) v1.ResourceList {
+	result := make(v1.ResourceList, len(values))
+	for name, value := range values {
+		result[name] = resource.MustParse(value)
+	}
+	return result
+}
+
+// DefaultNamespaceGovernance contains the governance of the platform namespaces by target environment.
+var DefaultNamespaceGovernance = map[entities2.TargetEnvironment]NamespaceGovernance{
+	entities2.Production: {
+		DefaultRequests: resources(map[v1.ResourceName]string{v1.ResourceCPU: "100m", v1.ResourceMemory: "128Mi"}),
+		DefaultLimits:   resources(map[v1.ResourceName]string{v1.ResourceCPU: "1", v1.ResourceMemory: "1Gi"}),
+		MaxLimits:       resources(map[v1.ResourceName]string{v1.ResourceCPU: "4", v1.ResourceMemory: "8Gi"}),
+		Quota: resources(map[v1.ResourceName]string{
+			v1.ResourceRequestsCPU: "32", v1.ResourceRequestsMemory: "64Gi",
+			v1.ResourceLimitsCPU: "64", v1.ResourceLimitsMemory: "128Gi", v1.ResourcePods: "300",
+		}),
+	},
+	entities2.Staging: {
+		DefaultRequests: resources(map[v1.ResourceName]string{v1.ResourceCPU: "50m", v1.ResourceMemory: "128Mi"}),
+		DefaultLimits:   resources(map[v1.ResourceName]string{v1.ResourceCPU: "1", v1.ResourceMemory: "1Gi"}),
+		MaxLimits:       resources(map[v1.ResourceName]string{v1.ResourceCPU: "2", v1.ResourceMemory: "4Gi"}),
+		Quota: resources(map[v1.ResourceName]string{
+			v1.ResourceRequestsCPU: "16", v1.ResourceRequestsMemory: "32Gi",
+			v1.ResourceLimitsCPU: "32", v1.ResourceLimitsMemory: "64Gi", v1.ResourcePods: "200",
+		}),
+	},
+	entities2.Development: {
+		DefaultRequests: resources(map[v1.ResourceName]string{v1.ResourceCPU: "25m", v1.ResourceMemory: "64Mi"}),
+		DefaultLimits:   resources(map[v1.ResourceName]string{v1.ResourceCPU: "500m", v1.ResourceMemory: "512Mi"}),
+		MaxLimits:       resources(map[v1.ResourceName]string{v1.ResourceCPU: "2", v1.ResourceMemory: "4Gi"}),
+		Quota: resources(map[v1.ResourceName]string{
+			v1.ResourceRequestsCPU: "8", v1.ResourceRequestsMemory: "16Gi",
+			v1.ResourceLimitsCPU: "16", v1.ResourceLimitsMemory: "32Gi", v1.ResourcePods: "150",
+		}),
+	},
+}
+
+// LoadNamespaceGovernanceConfig reads the governance of the environments from a YAML or JSON file.
+//   params:
+//     path The path of the file.
+//   returns:
+//     The configuration.
+//     An error if the file cannot be read, or it refers to an unknown environment.
+func LoadNamespaceGovernanceConfig(path string) (*NamespaceGovernanceConfig, derrors.Error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.NewNotFoundError("cannot read namespace governance file", err).WithParams(path)
+	}
+	config := &NamespaceGovernanceConfig{}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse namespace governance file", err).WithParams(path)
+	}
+	for environment := range config.Environments {
+		if _, found := entities2.TargetEnvironmentFromString[environment]; !found {
+			return nil, derrors.NewInvalidArgumentError("unknown environment in namespace governance file").WithParams(environment)
+		}
+	}
+	return config, nil
+}
+
+// Governance returns the governance of an environment, replacing the defaults with the fields set in the file.
+func (c *NamespaceGovernanceConfig) Governance(environment entities2.TargetEnvironment) NamespaceGovernance {
+	result := DefaultNamespaceGovernance[environment]
+	if c == nil {
+		return result
+	}
+	for name, override := range c.Environments {
+		if entities2.TargetEnvironmentFromString[name] != environment {
+			continue
+		}
+		if override.Labels != nil {
+			result.Labels = override.Labels
+		}
+		if override.Annotations != nil {
+			result.Annotations = override.Annotations
+		}
+		if override.DefaultRequests != nil {
+			result.DefaultRequests = override.DefaultRequests
+		}
+		if override.DefaultLimits != nil {
+			result.DefaultLimits = override.DefaultLimits
+		}
+		if override.MaxLimits != nil {
+			result.MaxLimits = override.MaxLimits
+		}
+		if override.Quota != nil {
+			result.Quota = override.Quota
+		}
+	}
+	return result
+}
+
+// ConfigureNamespaces structure with the attributes required to create the platform namespaces with their standard
+// labels and annotations, and the LimitRange and ResourceQuota of the target environment.
+type ConfigureNamespaces struct {
+	// Kubernetes embedded object
+	Kubernetes
+	// Namespaces with the platform namespaces to be configured.
+	Namespaces []string `json:"namespaces"`
+	// Environment with the target environment selecting the governance: PRODUCTION, STAGING, or DEVELOPMENT.
+	Environment string `json:"environment"`
+	// InstallID with the identifier of the install, annotated on the namespaces if set.
+	InstallID string `json:"install_id"`
+	// GovernancePath with the file overriding the governance of the environments. If empty, the defaults are used.
+	GovernancePath string `json:"governance_path"`
+}
+
+// NewConfigureNamespaces creates a new ConfigureNamespaces command.
+func NewConfigureNamespaces(kubeConfigPath string, namespaces []string, environment string) *ConfigureNamespaces {
+	return &ConfigureNamespaces{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.ConfigureNamespaces),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Namespaces:  namespaces,
+		Environment: environment,
+	}
+}
+
+// NewConfigureNamespacesFromJSON creates a new ConfigureNamespaces command from a raw JSON representation.
+func NewConfigureNamespacesFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	cn := &ConfigureNamespaces{}
+	if err := json.Unmarshal(raw, &cn); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	cn.CommandID = entities.GenerateCommandID(cn.Name())
+	var r entities.Command = cn
+	return &r, nil
+}
+
+// Run the current command returning the result or an error.
+func (cn *ConfigureNamespaces) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	targetEnvironment, found := entities2.TargetEnvironmentFromString[cn.Environment]
+	if !found {
+		return nil, derrors.NewInvalidArgumentError("cannot determine target environment").WithParams(cn.Environment)
+	}
+	var config *NamespaceGovernanceConfig
+	if cn.GovernancePath != "" {
+		loaded, err := LoadNamespaceGovernanceConfig(cn.GovernancePath)
+		if err != nil {
+			return nil, err
+		}
+		config = loaded
+	}
+	governance := config.Governance(targetEnvironment)
+
+	connectErr := cn.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+
+	for _, namespace := range cn.Namespaces {
+		if err := cn.EnsureNamespace(namespace, cn.namespaceOptions(targetEnvironment, governance)); err != nil {
+			return entities.NewCommandResult(false, "cannot configure platform namespace", err), nil
+		}
+		if err := cn.ensureLimitRange(namespace, governance); err != nil {
+			return entities.NewCommandResult(false, "cannot configure namespace limit range", err), nil
+		}
+		if err := cn.ensureResourceQuota(namespace, governance); err != nil {
+			return entities.NewCommandResult(false, "cannot configure namespace resource quota", err), nil
+		}
+	}
+	msg := fmt.Sprintf("%d namespaces have been configured for %s", len(cn.Namespaces),
+		entities2.TargetEnvironmentToString[targetEnvironment])
+	return entities.NewSuccessCommand([]byte(msg)), nil
+}
+
+// namespaceOptions returns the standard metadata of the platform namespaces together with the one of the governance.
+func (cn *ConfigureNamespaces) namespaceOptions(environment entities2.TargetEnvironment, governance NamespaceGovernance) NamespaceOptions {
+	labels := map[string]string{
+		PartOfLabel:      PartOfPlatform,
+		EnvironmentLabel: strings.ToLower(entities2.TargetEnvironmentToString[environment]),
+	}
+	for key, value := range governance.Labels {
+		labels[key] = value
+	}
+	annotations := make(map[string]string, len(governance.Annotations)+1)
+	for key, value := range governance.Annotations {
+		annotations[key] = value
+	}
+	if cn.InstallID != "" {
+		annotations[InstallIDAnnotation] = cn.InstallID
+	}
+	return NamespaceOptions{Labels: labels, Annotations: annotations}
+}
+
+// ensureLimitRange creates or updates the LimitRange of a namespace. No LimitRange is created if the governance does
+// not constrain the containers.
+func (cn *ConfigureNamespaces) ensureLimitRange(namespace string, governance NamespaceGovernance) derrors.Error {
+	if len(governance.DefaultRequests) == 0 && len(governance.DefaultLimits) == 0 && len(governance.MaxLimits) == 0 {
+		return nil
+	}
+	spec := v1.LimitRangeSpec{Limits: []v1.LimitRangeItem{{
+		Type:           v1.LimitTypeContainer,
+		DefaultRequest: governance.DefaultRequests,
+		Default:        governance.DefaultLimits,
+		Max:            governance.MaxLimits,
+	}}}
+	client := cn.Client.CoreV1().LimitRanges(namespace)
+	current, err := client.Get(GovernanceLimitRange, metaV1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		toCreate := &v1.LimitRange{ObjectMeta: governanceMeta(namespace, GovernanceLimitRange), Spec: spec}
+		if _, err := client.Create(toCreate); err != nil {
+			return AsQueryError(err, "cannot create limit range", namespace)
+		}
+		log.Debug().Str("namespace", namespace).Msg("limit range created")
+		return nil
+	}
+	if err != nil {
+		return AsQueryError(err, "cannot retrieve limit range", namespace)
+	}
+	if equality.Semantic.DeepEqual(current.Spec, spec) {
+		return nil
+	}
+	current.Spec = spec
+	if _, err := client.Update(current); err != nil {
+		return AsQueryError(err, "cannot update limit range", namespace)
+	}
+	log.Debug().Str("namespace", namespace).Msg("limit range updated")
+	return nil
+}
+
+// ensureResourceQuota creates or updates the ResourceQuota of a namespace. No ResourceQuota is created if the
+// governance has no quota.
+func (cn *ConfigureNamespaces) ensureResourceQuota(namespace string, governance NamespaceGovernance) derrors.Error {
+	if len(governance.Quota) == 0 {
+		return nil
+	}
+	spec := v1.ResourceQuotaSpec{Hard: governance.Quota}
+	client := cn.Client.CoreV1().ResourceQuotas(namespace)
+	current, err := client.Get(GovernanceResourceQuota, metaV1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		toCreate := &v1.ResourceQuota{ObjectMeta: governanceMeta(namespace, GovernanceResourceQuota), Spec: spec}
+		if _, err := client.Create(toCreate); err != nil {
+			return AsQueryError(err, "cannot create resource quota", namespace)
+		}
+		log.Debug().Str("namespace", namespace).Msg("resource quota created")
+		return nil
+	}
+	if err != nil {
+		return AsQueryError(err, "cannot retrieve resource quota", namespace)
+	}
+	if equality.Semantic.DeepEqual(current.Spec, spec) {
+		return nil
+	}
+	current.Spec = spec
+	if _, err := client.Update(current); err != nil {
+		return AsQueryError(err, "cannot update resource quota", namespace)
+	}
+	log.Debug().Str("namespace", namespace).Msg("resource quota updated")
+	return nil
+}
+
+// governanceMeta returns the metadata of the governance objects of a namespace.
+func governanceMeta(namespace string, name string) metaV1.ObjectMeta {
+	return metaV1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels: map[string]string{
+			ManagedByLabel: ManagedByInstaller,
+			"component":    "namespace-governance",
+		},
+	}
+}
+
+// String returns a string representation
+func (cn *ConfigureNamespaces) String() string {
+	return fmt.Sprintf("SYNC ConfigureNamespaces %s on %s", cn.Environment, strings.Join(cn.Namespaces, ","))
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (cn *ConfigureNamespaces) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + cn.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (cn *ConfigureNamespaces) UserString() string {
+	return fmt.Sprintf("Configuring namespaces %s", strings.Join(cn.Namespaces, ", "))
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+
+	entities2 "github.com/nalej/installer/internal/pkg/entities"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testGovernance = `
+environments:
+  development:
+    labels:
+      team: platform
+    quota:
+      pods: "20"
+`
+
+var _ = ginkgo.Describe("The namespace configuration", func() {
+
+	var cluster *k8stest.FakeCluster
+
+	ginkgo.BeforeEach(func() {
+		existing := &v1.ResourceQuota{
+			ObjectMeta: metaV1.ObjectMeta{Name: GovernanceResourceQuota, Namespace: "nalej-staging"},
+			Spec:       v1.ResourceQuotaSpec{Hard: v1.ResourceList{v1.ResourcePods: resource.MustParse("1")}},
+		}
+		cluster = newFakeCluster(existing)
+	})
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	ginkgo.It("should create the namespaces with the governance of the environment", func() {
+		cmd := NewConfigureNamespaces(cluster.KubeConfigPath, []string{TargetNamespace}, "PRODUCTION")
+		cmd.InstallID = "install-1"
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+
+		namespace, qErr := cluster.Client.CoreV1().Namespaces().Get(TargetNamespace, metaV1.GetOptions{})
+		gomega.Expect(qErr).To(gomega.Succeed())
+		gomega.Expect(namespace.Labels).To(gomega.HaveKeyWithValue(PartOfLabel, PartOfPlatform))
+		gomega.Expect(namespace.Labels).To(gomega.HaveKeyWithValue(EnvironmentLabel, "production"))
+		gomega.Expect(namespace.Annotations).To(gomega.HaveKeyWithValue(InstallIDAnnotation, "install-1"))
+
+		limits, qErr := cluster.Client.CoreV1().LimitRanges(TargetNamespace).Get(GovernanceLimitRange, metaV1.GetOptions{})
+		gomega.Expect(qErr).To(gomega.Succeed())
+		gomega.Expect(limits.Spec.Limits).To(gomega.HaveLen(1))
+		memory := limits.Spec.Limits[0].Default[v1.ResourceMemory]
+		gomega.Expect(memory.String()).To(gomega.Equal("1Gi"))
+
+		quota, qErr := cluster.Client.CoreV1().ResourceQuotas(TargetNamespace).Get(GovernanceResourceQuota, metaV1.GetOptions{})
+		gomega.Expect(qErr).To(gomega.Succeed())
+		pods := quota.Spec.Hard[v1.ResourcePods]
+		gomega.Expect(pods.String()).To(gomega.Equal("300"))
+	})
+
+	ginkgo.It("should update the quota of an existing namespace", func() {
+		cmd := NewConfigureNamespaces(cluster.KubeConfigPath, []string{"nalej-staging"}, "STAGING")
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		quota, qErr := cluster.Client.CoreV1().ResourceQuotas("nalej-staging").Get(GovernanceResourceQuota, metaV1.GetOptions{})
+		gomega.Expect(qErr).To(gomega.Succeed())
+		pods := quota.Spec.Hard[v1.ResourcePods]
+		gomega.Expect(pods.String()).To(gomega.Equal("200"))
+	})
+
+	ginkgo.It("should override the defaults with the governance file", func() {
+		file, fErr := ioutil.TempFile("", "governance")
+		gomega.Expect(fErr).To(gomega.Succeed())
+		defer os.Remove(file.Name())
+		_, fErr = file.WriteString(testGovernance)
+		gomega.Expect(fErr).To(gomega.Succeed())
+		gomega.Expect(file.Close()).To(gomega.Succeed())
+
+		config, err := LoadNamespaceGovernanceConfig(file.Name())
+		gomega.Expect(err).To(gomega.Succeed())
+		governance := config.Governance(entities2.Development)
+		gomega.Expect(governance.Labels).To(gomega.HaveKeyWithValue("team", "platform"))
+		gomega.Expect(governance.Quota).To(gomega.HaveLen(1))
+		gomega.Expect(governance.DefaultLimits).To(gomega.Equal(DefaultNamespaceGovernance[entities2.Development].DefaultLimits))
+	})
+
+	ginkgo.It("should reject unknown environments", func() {
+		cmd := NewConfigureNamespaces(cluster.KubeConfigPath, []string{TargetNamespace}, "QA")
+		_, err := cmd.Run("w1")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+})
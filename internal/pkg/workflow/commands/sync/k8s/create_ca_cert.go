@@ -18,21 +18,17 @@
 package k8s
 
 import (
-	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/json"
-	"encoding/pem"
 	"fmt"
 	"github.com/nalej/derrors"
 	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/pki"
 	"github.com/nalej/installer/internal/pkg/workflow/entities"
 	"github.com/rs/zerolog/log"
 	"k8s.io/api/core/v1"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"math/big"
 	"strings"
 	"time"
 )
@@ -71,55 +67,23 @@ func NewCreateCACertFromJSON(raw []byte) (*entities.Command, derrors.Error) {
 }
 
 func (cc *CreateCACert) createCACertificate() derrors.Error {
-
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return derrors.AsError(err, "cannot create private key for CA cert")
-	}
-
-	caCert := x509.Certificate{
-
-		SerialNumber: big.NewInt(1),
-		Issuer: pkix.Name{
-			Organization: []string{"Nalej"},
-		},
+	ca, err := pki.SelfSigned(pki.Request{
 		Subject: pkix.Name{
 			Organization: []string{"Nalej"},
 		},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().Add(CertValidity),
-		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		BasicConstraintsValid: true,
-		IsCA:                  true,
-		MaxPathLen:            0,
-		MaxPathLenZero:        true,
-		DNSNames:              []string{fmt.Sprintf("*.%s", cc.PublicHost)},
-	}
-	publicKey := &privateKey.PublicKey
-	result, err := x509.CreateCertificate(rand.Reader, &caCert, &caCert, publicKey, privateKey)
-	if err != nil {
-		return derrors.AsError(err, "cannot create CA certificate")
-	}
-	cc.certificate = result
-
-	// Export the content to PEM
-	CAOut := &bytes.Buffer{}
-	err = pem.Encode(CAOut, &pem.Block{Type: "CERTIFICATE", Bytes: cc.certificate})
-	if err != nil {
-		return derrors.AsError(err, "cannot transform certificate to PEM")
-	}
-	cc.certificatePEM = CAOut.String()
-
-	PKOut := &bytes.Buffer{}
-	err = pem.Encode(PKOut, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+		DNSNames:       []string{fmt.Sprintf("*.%s", cc.PublicHost)},
+		Validity:       CertValidity,
+		IsCA:           true,
+		MaxPathLenZero: true,
+		KeyUsage:       x509.KeyUsageCertSign | x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 	})
 	if err != nil {
-		return derrors.AsError(err, "cannot transform private key to PEM")
+		return err
 	}
-	cc.privateKeyPEM = PKOut.String()
+	cc.certificate = ca.Certificate.Raw
+	cc.certificatePEM = string(ca.CertPEM)
+	cc.privateKeyPEM = string(ca.KeyPEM)
 	return nil
 }
 
@@ -155,7 +119,7 @@ func (cc *CreateCACert) Run(workflowID string) (*entities.CommandResult, derrors
 		return nil, connectErr
 	}
 
-	cErr := cc.CreateNamespaceIfNotExists(TargetNamespace)
+	cErr := cc.EnsureNamespace(TargetNamespace, NamespaceOptions{})
 	if cErr != nil {
 		return entities.NewCommandResult(false, "cannot create namespace", cErr), nil
 	}
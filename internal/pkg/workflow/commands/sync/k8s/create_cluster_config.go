@@ -95,7 +95,7 @@ func (ccc *CreateClusterConfig) Run(workflowID string) (*entities.CommandResult,
 		return nil, rErr
 	}
 
-	cErr := ccc.CreateNamespaceIfNotExists("nalej")
+	cErr := ccc.EnsureNamespace("nalej", NamespaceOptions{})
 	if cErr != nil {
 		log.Error().Str("namespace creation error", cErr.DebugReport()).Str("namespace creation error", cErr.DebugReport())
 		return entities.NewCommandResult(false, "cannot create namespace", cErr), nil
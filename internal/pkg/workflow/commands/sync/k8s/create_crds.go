@@ -0,0 +1,306 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Create the custom resource definitions required by the components, such as those of cert-manager or Istio, and
+// wait for them to be served before the components using them are launched.
+//
+// {"type":"sync", "name": "createCRDs",
+//   "kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+//   "crds_dir":"{{$.Paths.CRDsPath}}",
+//   "wait_webhooks":true
+// }
+
+package k8s
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// CRDGroup is the API group of the custom resource definitions.
+const CRDGroup = "apiextensions.k8s.io"
+
+// CreateCRDs applies the custom resource definitions of a directory and waits for them to be established and,
+// optionally, for their conversion webhooks to be ready.
+type CreateCRDs struct {
+	Kubernetes
+	// CRDsDir with the YAML or JSON files of the custom resource definitions. A file may contain several
+	// definitions separated by ---.
+	CRDsDir string `json:"crds_dir"`
+	// WaitWebhooks waits for the services of the conversion webhooks of the definitions to have ready endpoints.
+	WaitWebhooks bool `json:"wait_webhooks"`
+	// TimeoutSeconds with the maximum time to wait. If not set, DefaultWaitTimeout is used.
+	TimeoutSeconds int `json:"timeout"`
+	// IntervalSeconds with the time between checks. If not set, DefaultWaitInterval is used.
+	IntervalSeconds int `json:"interval"`
+}
+
+// NewCreateCRDs creates a new CreateCRDs command.
+func NewCreateCRDs(kubeConfigPath string, crdsDir string, waitWebhooks bool) *CreateCRDs {
+	return &CreateCRDs{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.CreateCRDs),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		CRDsDir:      crdsDir,
+		WaitWebhooks: waitWebhooks,
+	}
+}
+
+// NewCreateCRDsFromJSON creates a new CreateCRDs command from a raw JSON representation.
+func NewCreateCRDsFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	cc := &CreateCRDs{}
+	if err := json.Unmarshal(raw, &cc); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	cc.CommandID = entities.GenerateCommandID(cc.Name())
+	var r entities.Command = cc
+	return &r, nil
+}
+
+// RequiredAccess returns the accesses to the Kubernetes API performed by the command.
+func (cc *CreateCRDs) RequiredAccess() ([]ObjectAccess, derrors.Error) {
+	result := []ObjectAccess{Access(CRDGroup, "customresourcedefinitions", CreateVerbs, PatchVerbs)}
+	if cc.WaitWebhooks {
+		result = append(result, Access("", "endpoints", ReadVerbs))
+	}
+	return result, nil
+}
+
+// timeout returns the maximum time to wait for the definitions.
+func (cc *CreateCRDs) timeout() time.Duration {
+	if cc.TimeoutSeconds <= 0 {
+		return DefaultWaitTimeout
+	}
+	return time.Duration(cc.TimeoutSeconds) * time.Second
+}
+
+// interval returns the time between checks of the definitions.
+func (cc *CreateCRDs) interval() time.Duration {
+	if cc.IntervalSeconds <= 0 {
+		return DefaultWaitInterval
+	}
+	return time.Duration(cc.IntervalSeconds) * time.Second
+}
+
+// LoadCRDs reads the custom resource definitions of the directory, sorted by file name.
+func (cc *CreateCRDs) LoadCRDs() ([]*unstructured.Unstructured, derrors.Error) {
+	fileInfo, err := ioutil.ReadDir(cc.CRDsDir)
+	if err != nil {
+		return nil, derrors.NewInternalError("cannot read custom resource definitions directory", err).WithParams(cc.CRDsDir)
+	}
+	fileNames := make([]string, 0, len(fileInfo))
+	for _, file := range fileInfo {
+		name := file.Name()
+		if !file.IsDir() && (strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml") || strings.HasSuffix(name, ".json")) {
+			fileNames = append(fileNames, name)
+		}
+	}
+	sort.Strings(fileNames)
+	result := make([]*unstructured.Unstructured, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		content, err := ioutil.ReadFile(path.Join(cc.CRDsDir, fileName))
+		if err != nil {
+			return nil, derrors.NewPermissionDeniedError("cannot read custom resource definitions file", err).WithParams(fileName)
+		}
+		decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(content), 1024)
+		for {
+			obj := &unstructured.Unstructured{}
+			if err := decoder.Decode(&obj.Object); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, derrors.NewInvalidArgumentError("cannot parse custom resource definitions file", err).WithParams(fileName)
+			}
+			// Empty documents, such as a trailing ---, are ignored.
+			if len(obj.Object) == 0 {
+				continue
+			}
+			gvk := obj.GroupVersionKind()
+			if gvk.Group != CRDGroup || gvk.Kind != "CustomResourceDefinition" {
+				return nil, derrors.NewInvalidArgumentError("only custom resource definitions can be created").
+					WithParams(fileName, gvk.String(), obj.GetName())
+			}
+			result = append(result, obj)
+		}
+	}
+	return result, nil
+}
+
+// crdStatus returns whether a definition is established. An error is returned if its names are rejected, as it
+// will never be established.
+func crdStatus(crd *unstructured.Unstructured) (bool, derrors.Error) {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	established := false
+	for _, raw := range conditions {
+		condition, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch {
+		case condition["type"] == "Established" && condition["status"] == "True":
+			established = true
+		case condition["type"] == "NamesAccepted" && condition["status"] == "False":
+			return false, derrors.NewFailedPreconditionError("custom resource definition names not accepted").
+				WithParams(crd.GetName(), condition["reason"], condition["message"])
+		}
+	}
+	return established, nil
+}
+
+// ConversionWebhookService returns the namespace and name of the service of the conversion webhook of a definition,
+// for both the v1 and v1beta1 versions of the API.
+//   returns:
+//     The namespace of the service.
+//     The name of the service.
+//     Whether the definition has a conversion webhook backed by a service.
+func ConversionWebhookService(crd *unstructured.Unstructured) (string, string, bool) {
+	paths := [][]string{
+		{"spec", "conversion", "webhook", "clientConfig", "service"},
+		{"spec", "conversion", "webhookClientConfig", "service"},
+	}
+	for _, fields := range paths {
+		service, found, _ := unstructured.NestedStringMap(crd.Object, fields...)
+		if found && service["name"] != "" {
+			return service["namespace"], service["name"], true
+		}
+	}
+	return "", "", false
+}
+
+// waitEstablished waits for a definition to be established.
+func (cc *CreateCRDs) waitEstablished(crd *unstructured.Unstructured, deadline time.Time) derrors.Error {
+	gvr := schema.GroupVersionResource{Group: CRDGroup, Version: crd.GroupVersionKind().Version, Resource: "customresourcedefinitions"}
+	client := cc.dynClient.Resource(gvr)
+	for {
+		current, err := client.Get(crd.GetName(), metaV1.GetOptions{})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return AsQueryError(err, "cannot retrieve custom resource definition", crd.GetName())
+		}
+		if err == nil {
+			established, sErr := crdStatus(current)
+			if sErr != nil {
+				return sErr
+			}
+			if established {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return derrors.NewUnavailableError(errors.Coded(errors.WaitTimeout,
+				"timeout waiting for custom resource definition to be established")).WithParams(crd.GetName())
+		}
+		log.Debug().Str("name", crd.GetName()).Msg("waiting for custom resource definition to be established")
+		time.Sleep(cc.interval())
+	}
+}
+
+// waitWebhook waits for the service of a webhook to have ready endpoints, so the webhook can respond.
+func (cc *CreateCRDs) waitWebhook(namespace string, name string, deadline time.Time) derrors.Error {
+	for {
+		endpoints, err := cc.Client.CoreV1().Endpoints(namespace).Get(name, metaV1.GetOptions{})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return AsQueryError(err, "cannot retrieve webhook endpoints", namespace, name)
+		}
+		if err == nil {
+			for _, subset := range endpoints.Subsets {
+				if len(subset.Addresses) > 0 {
+					return nil
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			return derrors.NewUnavailableError(errors.Coded(errors.WaitTimeout,
+				"timeout waiting for webhook to be ready")).WithParams(namespace, name)
+		}
+		log.Debug().Str("namespace", namespace).Str("name", name).Msg("waiting for webhook to be ready")
+		time.Sleep(cc.interval())
+	}
+}
+
+// Run the current command returning the result or an error.
+func (cc *CreateCRDs) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := cc.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	crds, err := cc.LoadCRDs()
+	if err != nil {
+		return nil, err
+	}
+	summary := &ApplySummary{}
+	for _, crd := range crds {
+		if err := cc.Apply(crd, ApplyOptions{}, summary); err != nil {
+			return entities.NewCommandResult(false, "cannot create custom resource definition", err), nil
+		}
+	}
+	deadline := time.Now().Add(cc.timeout())
+	for _, crd := range crds {
+		if err := cc.waitEstablished(crd, deadline); err != nil {
+			return entities.NewCommandResult(false, "custom resource definition not established", err), nil
+		}
+	}
+	webhooks := 0
+	if cc.WaitWebhooks {
+		waited := make(map[string]bool, 0)
+		for _, crd := range crds {
+			namespace, name, found := ConversionWebhookService(crd)
+			if !found || waited[namespace+"/"+name] {
+				continue
+			}
+			waited[namespace+"/"+name] = true
+			if err := cc.waitWebhook(namespace, name, deadline); err != nil {
+				return entities.NewCommandResult(false, "conversion webhook not ready", err), nil
+			}
+			webhooks++
+		}
+	}
+	msg := fmt.Sprintf("%d custom resource definitions established, %d webhooks ready: %s", len(crds), webhooks, summary.String())
+	return entities.NewSuccessCommand([]byte(msg)).WithObjects(summary.Applied()), nil
+}
+
+// String returns a string representation
+func (cc *CreateCRDs) String() string {
+	return fmt.Sprintf("SYNC CreateCRDs from %s", cc.CRDsDir)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (cc *CreateCRDs) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + cc.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (cc *CreateCRDs) UserString() string {
+	return fmt.Sprintf("Creating custom resource definitions from %s", cc.CRDsDir)
+}
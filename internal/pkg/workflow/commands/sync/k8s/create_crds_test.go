@@ -0,0 +1,149 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testCRDs = `
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: certificates.cert-manager.io
+spec:
+  group: cert-manager.io
+  names:
+    kind: Certificate
+    plural: certificates
+  scope: Namespaced
+  conversion:
+    strategy: Webhook
+    webhookClientConfig:
+      service:
+        namespace: cert-manager
+        name: cert-manager-webhook
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: issuers.cert-manager.io
+spec:
+  group: cert-manager.io
+  names:
+    kind: Issuer
+    plural: issuers
+  scope: Namespaced
+---
+`
+
+var _ = ginkgo.Describe("A CreateCRDs command", func() {
+
+	var cluster *k8stest.FakeCluster
+	var crdsDir string
+
+	// establish marks the definitions as established when they are created.
+	establish := func() {
+		cluster.Dynamic.PrependReactor("create", "customresourcedefinitions", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			obj := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+			conditions := []interface{}{map[string]interface{}{"type": "Established", "status": "True"}}
+			gomega.Expect(unstructured.SetNestedSlice(obj.Object, conditions, "status", "conditions")).To(gomega.Succeed())
+			return false, nil, nil
+		})
+	}
+
+	ginkgo.BeforeEach(func() {
+		cluster = newFakeCluster()
+		dir, err := ioutil.TempDir("", "crds")
+		gomega.Expect(err).To(gomega.Succeed())
+		crdsDir = dir
+		gomega.Expect(ioutil.WriteFile(filepath.Join(crdsDir, "cert-manager.yaml"), []byte(testCRDs), 0644)).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+		gomega.Expect(os.RemoveAll(crdsDir)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should load every definition of a file", func() {
+		crds, err := NewCreateCRDs(cluster.KubeConfigPath, crdsDir, false).LoadCRDs()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(crds).To(gomega.HaveLen(2))
+		namespace, name, found := ConversionWebhookService(crds[0])
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(namespace).To(gomega.Equal("cert-manager"))
+		gomega.Expect(name).To(gomega.Equal("cert-manager-webhook"))
+		_, _, found = ConversionWebhookService(crds[1])
+		gomega.Expect(found).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should reject objects that are not definitions", func() {
+		configMap := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n"
+		gomega.Expect(ioutil.WriteFile(filepath.Join(crdsDir, "other.yaml"), []byte(configMap), 0644)).To(gomega.Succeed())
+		_, err := NewCreateCRDs(cluster.KubeConfigPath, crdsDir, false).LoadCRDs()
+		gomega.Expect(err).To(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should create the definitions and wait for them to be established", func() {
+		establish()
+		result, err := NewCreateCRDs(cluster.KubeConfigPath, crdsDir, false).Run("test")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		cluster.ExpectObject("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "", "certificates.cert-manager.io")
+		cluster.ExpectObject("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "", "issuers.cert-manager.io")
+	})
+
+	ginkgo.It("should fail if the definitions are not established in time", func() {
+		cmd := NewCreateCRDs(cluster.KubeConfigPath, crdsDir, false)
+		cmd.TimeoutSeconds = 1
+		cmd.IntervalSeconds = 1
+		result, err := cmd.Run("test")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should wait for the conversion webhooks to be ready", func() {
+		establish()
+		cmd := NewCreateCRDs(cluster.KubeConfigPath, crdsDir, true)
+		cmd.TimeoutSeconds = 1
+		cmd.IntervalSeconds = 1
+		result, err := cmd.Run("test")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+
+		endpoints := &v1.Endpoints{
+			ObjectMeta: metaV1.ObjectMeta{Name: "cert-manager-webhook", Namespace: "cert-manager"},
+			Subsets:    []v1.EndpointSubset{{Addresses: []v1.EndpointAddress{{IP: "10.0.0.1"}}}},
+		}
+		gomega.Expect(cluster.Tracker.Add(endpoints)).To(gomega.Succeed())
+		result, err = cmd.Run("test")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+	})
+})
@@ -25,6 +25,7 @@ import (
 	"github.com/nalej/installer/internal/pkg/errors"
 	"github.com/nalej/installer/internal/pkg/workflow/entities"
 	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"strings"
 )
@@ -36,6 +37,10 @@ type CreateDockerSecret struct {
 	Username   string `json:"username"`
 	Password   string `json:"password"`
 	URL        string `json:"url"`
+	// Namespace where the secret is created, TargetNamespace if not set.
+	Namespace string `json:"namespace"`
+	// Replace the credentials of the secret if it already exists.
+	Replace bool `json:"replace"`
 }
 
 func NewCreateDockerSecret(
@@ -75,12 +80,20 @@ func (cmd *CreateDockerSecret) getDockerConfigJSON() string {
 	return toEncode
 }
 
+// namespace returns the namespace where the secret is created.
+func (cmd *CreateDockerSecret) namespace() string {
+	if cmd.Namespace == "" {
+		return TargetNamespace
+	}
+	return cmd.Namespace
+}
+
 func (cmd *CreateDockerSecret) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
 	connectErr := cmd.Connect()
 	if connectErr != nil {
 		return nil, connectErr
 	}
-	cErr := cmd.CreateNamespaceIfNotExists("nalej")
+	cErr := cmd.EnsureNamespace(cmd.namespace(), NamespaceOptions{})
 	if cErr != nil {
 		return entities.NewCommandResult(false, "cannot create namespace", cErr), nil
 	}
@@ -93,7 +106,7 @@ func (cmd *CreateDockerSecret) Run(workflowID string) (*entities.CommandResult,
 		ObjectMeta: v12.ObjectMeta{
 			Name:         cmd.SecretName,
 			GenerateName: "",
-			Namespace:    "nalej",
+			Namespace:    cmd.namespace(),
 		},
 		Data: map[string][]byte{
 			".dockerconfigjson": []byte(cmd.getDockerConfigJSON()),
@@ -101,6 +114,18 @@ func (cmd *CreateDockerSecret) Run(workflowID string) (*entities.CommandResult,
 		Type: v1.SecretTypeDockerConfigJson,
 	}
 
+	if cmd.Replace {
+		secrets := cmd.Client.CoreV1().Secrets(cmd.namespace())
+		_, err := secrets.Create(secret)
+		if k8sErrors.IsAlreadyExists(err) {
+			_, err = secrets.Update(secret)
+		}
+		if err != nil {
+			return entities.NewCommandResult(
+				false, "cannot replace docker registry credentials", AsQueryError(err, "cannot replace registry credentials", cmd.SecretName)), nil
+		}
+		return entities.NewSuccessCommand([]byte("docker registry credentials have been replaced")), nil
+	}
 	derr := cmd.Create(secret)
 	if derr != nil {
 		return entities.NewCommandResult(
@@ -0,0 +1,282 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Create a Job, such as the migration of a database, and optionally wait for it to complete. The logs of its pods
+// are captured in the result if it fails.
+//
+// {"type":"sync", "name": "createJob",
+//   "kubeConfigPath":"{{$.Credentials.KubeConfigPath}}",
+//   "job_path":"/assets/jobs/migrate-db.yaml",
+//   "namespace":"nalej",
+//   "wait":true,
+//   "timeout":600
+// }
+
+package k8s
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	batchV1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// DefaultJobTTLSeconds is the time a finished Job is kept before being removed if neither the command nor the
+// manifest set one.
+const DefaultJobTTLSeconds = int32(3600)
+
+// DefaultJobLogLines is the number of lines captured from each container of the pods of a failed Job.
+const DefaultJobLogLines = int64(50)
+
+// JobNameLabel is the label set by Kubernetes on the pods of a Job with its name.
+const JobNameLabel = "job-name"
+
+// CreateJob creates a Job from a manifest and, if requested, waits for it to complete.
+type CreateJob struct {
+	Kubernetes
+	// JobPath with the YAML or JSON manifest of the Job.
+	JobPath string `json:"job_path"`
+	// Namespace of the Job. If not set, the one of the manifest is used, or TargetNamespace if it has none.
+	Namespace string `json:"namespace"`
+	// Wait for the Job to complete. Otherwise the command finishes once the Job is created.
+	Wait bool `json:"wait"`
+	// TimeoutSeconds with the maximum time to wait. If not set, DefaultWaitTimeout is used.
+	TimeoutSeconds int `json:"timeout"`
+	// IntervalSeconds with the time between checks. If not set, DefaultWaitInterval is used.
+	IntervalSeconds int `json:"interval"`
+	// TTLSecondsAfterFinished with the time the finished Job is kept. If not set, the value of the manifest is used,
+	// or DefaultJobTTLSeconds if it has none.
+	TTLSecondsAfterFinished *int32 `json:"ttl_seconds_after_finished"`
+	// LogLines with the number of lines captured from each container if the Job fails. If not set,
+	// DefaultJobLogLines is used.
+	LogLines int64 `json:"log_lines"`
+}
+
+// NewCreateJob creates a new CreateJob command.
+func NewCreateJob(kubeConfigPath string, jobPath string, namespace string, wait bool) *CreateJob {
+	return &CreateJob{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.CreateJob),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		JobPath:   jobPath,
+		Namespace: namespace,
+		Wait:      wait,
+	}
+}
+
+// NewCreateJobFromJSON creates a new CreateJob command from a raw JSON representation.
+func NewCreateJobFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	cj := &CreateJob{}
+	if err := json.Unmarshal(raw, &cj); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	cj.CommandID = entities.GenerateCommandID(cj.Name())
+	var r entities.Command = cj
+	return &r, nil
+}
+
+// RequiredAccess returns the accesses to the Kubernetes API performed by the command.
+func (cj *CreateJob) RequiredAccess() ([]ObjectAccess, derrors.Error) {
+	result := []ObjectAccess{Access("batch", "jobs", CreateVerbs, PatchVerbs)}
+	if cj.Wait {
+		result = append(result, Access("", "pods", ReadVerbs), Access("", "pods/log", ReadVerbs))
+	}
+	return result, nil
+}
+
+// timeout returns the maximum time to wait for the Job.
+func (cj *CreateJob) timeout() time.Duration {
+	if cj.TimeoutSeconds <= 0 {
+		return DefaultWaitTimeout
+	}
+	return time.Duration(cj.TimeoutSeconds) * time.Second
+}
+
+// interval returns the time between checks of the Job.
+func (cj *CreateJob) interval() time.Duration {
+	if cj.IntervalSeconds <= 0 {
+		return DefaultWaitInterval
+	}
+	return time.Duration(cj.IntervalSeconds) * time.Second
+}
+
+// LoadJob reads the Job of the manifest, setting its namespace and the time it is kept once finished.
+func (cj *CreateJob) LoadJob() (*batchV1.Job, derrors.Error) {
+	content, err := ioutil.ReadFile(cj.JobPath)
+	if err != nil {
+		return nil, derrors.NewPermissionDeniedError("cannot read job file", err).WithParams(cj.JobPath)
+	}
+	job := &batchV1.Job{}
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(content), 1024).Decode(job); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse job file", err).WithParams(cj.JobPath)
+	}
+	if job.Kind != "Job" || job.Name == "" {
+		return nil, derrors.NewInvalidArgumentError("file does not contain a named job").WithParams(cj.JobPath, job.Kind)
+	}
+	job.APIVersion = "batch/v1"
+	if cj.Namespace != "" {
+		job.Namespace = cj.Namespace
+	}
+	if job.Namespace == "" {
+		job.Namespace = TargetNamespace
+	}
+	if cj.TTLSecondsAfterFinished != nil {
+		ttl := *cj.TTLSecondsAfterFinished
+		job.Spec.TTLSecondsAfterFinished = &ttl
+	} else if job.Spec.TTLSecondsAfterFinished == nil {
+		ttl := DefaultJobTTLSeconds
+		job.Spec.TTLSecondsAfterFinished = &ttl
+	}
+	return job, nil
+}
+
+// JobFinished checks whether a Job has completed or failed.
+//   returns:
+//     Whether the Job has finished.
+//     Whether the Job has failed.
+//     The reason of the failure, if any.
+func JobFinished(job *batchV1.Job) (bool, bool, string) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchV1.JobComplete:
+			return true, false, ""
+		case batchV1.JobFailed:
+			return true, true, fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+		}
+	}
+	return false, false, ""
+}
+
+// JobLogs returns the last lines of the logs of the containers of the pods of a Job. Logs that cannot be retrieved
+// are reported in place of their content, so the failure of the Job is still returned.
+func (k *Kubernetes) JobLogs(job *batchV1.Job, lines int64) string {
+	if lines <= 0 {
+		lines = DefaultJobLogLines
+	}
+	pods, err := k.Client.CoreV1().Pods(job.Namespace).List(metaV1.ListOptions{LabelSelector: JobNameLabel + "=" + job.Name})
+	if err != nil {
+		return fmt.Sprintf("cannot list the pods of job %s/%s: %s", job.Namespace, job.Name, err.Error())
+	}
+	if len(pods.Items) == 0 {
+		return fmt.Sprintf("job %s/%s has no pods", job.Namespace, job.Name)
+	}
+	sections := make([]string, 0)
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			request := k.Client.CoreV1().Pods(job.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{Container: container.Name, TailLines: &lines})
+			content, err := request.DoRaw()
+			if err != nil {
+				content = []byte(fmt.Sprintf("cannot retrieve logs: %s", err.Error()))
+			}
+			sections = append(sections, fmt.Sprintf("--- %s/%s (%s)\n%s", pod.Name, container.Name, pod.Status.Phase,
+				strings.TrimRight(string(content), "\n")))
+		}
+	}
+	return strings.Join(sections, "\n")
+}
+
+// WaitJob waits for a Job to finish.
+//   params:
+//     job The Job to wait for.
+//     timeout The maximum time to wait.
+//     interval The time between checks.
+//     logLines The number of lines captured from each container if the Job fails.
+//   returns:
+//     The logs of the pods of the Job if it fails or does not finish in time.
+//     An error if the Job fails, does not finish in time or cannot be retrieved.
+func (k *Kubernetes) WaitJob(job *batchV1.Job, timeout time.Duration, interval time.Duration, logLines int64) (string, derrors.Error) {
+	client := k.Client.BatchV1().Jobs(job.Namespace)
+	deadline := time.Now().Add(timeout)
+	for {
+		current, err := client.Get(job.Name, metaV1.GetOptions{})
+		if err != nil {
+			if k8sErrors.IsNotFound(err) {
+				return "", derrors.NewNotFoundError("job removed before it was seen finished").WithParams(job.Namespace, job.Name)
+			}
+			return "", AsQueryError(err, "cannot retrieve job", job.Namespace, job.Name)
+		}
+		finished, failed, reason := JobFinished(current)
+		if failed {
+			return k.JobLogs(current, logLines), derrors.NewInternalError("job failed").WithParams(job.Namespace, job.Name, reason)
+		}
+		if finished {
+			return "", nil
+		}
+		if time.Now().After(deadline) {
+			return k.JobLogs(current, logLines), derrors.NewUnavailableError(errors.Coded(errors.WaitTimeout,
+				"timeout waiting for job")).WithParams(job.Namespace, job.Name)
+		}
+		log.Debug().Str("namespace", job.Namespace).Str("job", job.Name).Int32("active", current.Status.Active).
+			Int32("failed", current.Status.Failed).Msg("waiting for job")
+		time.Sleep(interval)
+	}
+}
+
+// Run the current command returning the result or an error.
+func (cj *CreateJob) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := cj.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	job, err := cj.LoadJob()
+	if err != nil {
+		return nil, err
+	}
+	summary := &ApplySummary{}
+	if err := cj.Apply(job, ApplyOptions{}, summary); err != nil {
+		return entities.NewCommandResult(false, "cannot create job", err), nil
+	}
+	if !cj.Wait {
+		return entities.NewSuccessCommand([]byte(fmt.Sprintf("job %s/%s created", job.Namespace, job.Name))).WithObjects(summary.Applied()), nil
+	}
+	logs, err := cj.WaitJob(job, cj.timeout(), cj.interval(), cj.LogLines)
+	if err != nil {
+		return entities.NewCommandResult(false, logs, err), nil
+	}
+	return entities.NewSuccessCommand([]byte(fmt.Sprintf("job %s/%s completed", job.Namespace, job.Name))).WithObjects(summary.Applied()), nil
+}
+
+// String returns a string representation
+func (cj *CreateJob) String() string {
+	return fmt.Sprintf("SYNC CreateJob %s wait: %t", cj.JobPath, cj.Wait)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (cj *CreateJob) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + cj.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (cj *CreateJob) UserString() string {
+	return fmt.Sprintf("Running job %s", cj.JobPath)
+}
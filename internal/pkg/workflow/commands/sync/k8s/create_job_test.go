@@ -0,0 +1,123 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testJob = `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate-db
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: migrate
+        image: nalej/migrate:v1
+`
+
+var _ = ginkgo.Describe("A CreateJob command", func() {
+
+	var cluster *k8stest.FakeCluster
+	var jobDir string
+	var jobPath string
+
+	// finish sets the condition of the Jobs when they are created.
+	finish := func(conditionType string) {
+		cluster.Dynamic.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			obj := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+			conditions := []interface{}{map[string]interface{}{"type": conditionType, "status": "True", "reason": "Test"}}
+			gomega.Expect(unstructured.SetNestedSlice(obj.Object, conditions, "status", "conditions")).To(gomega.Succeed())
+			return false, nil, nil
+		})
+	}
+
+	ginkgo.BeforeEach(func() {
+		cluster = newFakeCluster()
+		dir, err := ioutil.TempDir("", "jobs")
+		gomega.Expect(err).To(gomega.Succeed())
+		jobDir = dir
+		jobPath = filepath.Join(jobDir, "migrate-db.yaml")
+		gomega.Expect(ioutil.WriteFile(jobPath, []byte(testJob), 0644)).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+		gomega.Expect(os.RemoveAll(jobDir)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should set the namespace and the default time to keep the finished job", func() {
+		job, err := NewCreateJob(cluster.KubeConfigPath, jobPath, "", false).LoadJob()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(job.Namespace).To(gomega.Equal(TargetNamespace))
+		gomega.Expect(*job.Spec.TTLSecondsAfterFinished).To(gomega.Equal(DefaultJobTTLSeconds))
+
+		cmd := NewCreateJob(cluster.KubeConfigPath, jobPath, "migrations", false)
+		ttl := int32(0)
+		cmd.TTLSecondsAfterFinished = &ttl
+		job, err = cmd.LoadJob()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(job.Namespace).To(gomega.Equal("migrations"))
+		gomega.Expect(*job.Spec.TTLSecondsAfterFinished).To(gomega.Equal(int32(0)))
+	})
+
+	ginkgo.It("should create the job without waiting for it", func() {
+		result, err := NewCreateJob(cluster.KubeConfigPath, jobPath, "", false).Run("test")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		cluster.ExpectObject("batch/v1", "Job", TargetNamespace, "migrate-db")
+	})
+
+	ginkgo.It("should wait for the job to complete", func() {
+		finish("Complete")
+		result, err := NewCreateJob(cluster.KubeConfigPath, jobPath, "", true).Run("test")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(result.Output).To(gomega.ContainSubstring("completed"))
+	})
+
+	ginkgo.It("should report the failure of the job", func() {
+		finish("Failed")
+		result, err := NewCreateJob(cluster.KubeConfigPath, jobPath, "", true).Run("test")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+		gomega.Expect(result.Output).To(gomega.ContainSubstring("has no pods"))
+	})
+
+	ginkgo.It("should fail if the job does not finish in time", func() {
+		cmd := NewCreateJob(cluster.KubeConfigPath, jobPath, "", true)
+		cmd.TimeoutSeconds = 1
+		cmd.IntervalSeconds = 1
+		result, err := cmd.Run("test")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+	})
+})
@@ -24,10 +24,10 @@ import (
 	"github.com/nalej/installer/internal/pkg/errors"
 	"github.com/nalej/installer/internal/pkg/workflow/entities"
 	"github.com/rs/zerolog/log"
-	"github.com/satori/go.uuid"
 	"k8s.io/api/core/v1"
 	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"strings"
+	"time"
 )
 
 const TargetNamespace = "nalej"
@@ -40,6 +40,17 @@ type CreateManagementConfig struct {
 	DNSPort      string `json:"dns_port"`
 	PlatformType string `json:"platform_type"`
 	Environment  string `json:"environment"`
+	// ClusterDomain with the DNS domain of the services of the cluster, DefaultClusterDomain if empty.
+	ClusterDomain string `json:"cluster_domain"`
+	// NetworkingMode with the networking mode of the platform, the mesh is enabled with istio.
+	NetworkingMode string `json:"networking_mode"`
+	// AuthSecretLength with the number of random bytes of the authx secret, GeneratedSecretLength if not set.
+	AuthSecretLength int `json:"auth_secret_length"`
+	// AuthSecretEncoding with the encoding of the authx secret, SecretEncodingBase64 if not set.
+	AuthSecretEncoding string `json:"auth_secret_encoding"`
+	// SecretStorePath contains the configuration of the external secret store, see SecretStoreConfig. If set, the
+	// authx secret references the value of the store instead of being generated.
+	SecretStorePath string `json:"secret_store_path"`
 }
 
 func NewCreateManagementConfig(
@@ -68,25 +79,40 @@ func NewCreateManagementConfigFromJSON(raw []byte) (*entities.Command, derrors.E
 	return &r, nil
 }
 
+// ManagementConfig returns the typed content of the management config of the command.
+func (cmc *CreateManagementConfig) ManagementConfig() *ManagementConfig {
+	clusterDomain := cmc.ClusterDomain
+	if clusterDomain == "" {
+		clusterDomain = DefaultClusterDomain
+	}
+	return &ManagementConfig{
+		PublicHost:    cmc.PublicHost,
+		PublicPort:    cmc.PublicPort,
+		DNSHost:       cmc.DNSHost,
+		DNSPort:       cmc.DNSPort,
+		PlatformType:  cmc.PlatformType,
+		Environment:   cmc.Environment,
+		ClusterDomain: clusterDomain,
+		MeshEnabled:   cmc.NetworkingMode == "istio",
+	}
+}
+
 func (cmc *CreateManagementConfig) createConfigMap() derrors.Error {
+	data, err := cmc.ManagementConfig().Data()
+	if err != nil {
+		return err
+	}
 	config := &v1.ConfigMap{
 		TypeMeta: v12.TypeMeta{
 			Kind:       "ConfigMap",
 			APIVersion: "v1",
 		},
 		ObjectMeta: v12.ObjectMeta{
-			Name:      "management-config",
+			Name:      ManagementConfigName,
 			Namespace: TargetNamespace,
 			Labels:    map[string]string{"cluster": "management"},
 		},
-		Data: map[string]string{
-			"public_host":   cmc.PublicHost,
-			"public_port":   cmc.PublicPort,
-			"dns_host":      cmc.DNSHost,
-			"dns_port":      cmc.DNSPort,
-			"platform_type": cmc.PlatformType,
-			"environment":   cmc.Environment,
-		},
+		Data: data,
 	}
 
 	log.Debug().Interface("configMap", config).Msg("creating management config")
@@ -98,6 +124,22 @@ func (cmc *CreateManagementConfig) createConfigMap() derrors.Error {
 }
 
 func (cmc *CreateManagementConfig) createAuthSecret() derrors.Error {
+	labels := map[string]string{"cluster": "management", "component": "authx"}
+	if cmc.SecretStorePath != "" {
+		config, err := LoadSecretStoreConfig(cmc.SecretStorePath)
+		if err != nil {
+			return err
+		}
+		return cmc.CreateSecretReference(config, TargetNamespace, "authx-secret", v1.SecretTypeOpaque, []string{"secret"}, labels)
+	}
+	value, err := GenerateSecret(cmc.AuthSecretLength, cmc.AuthSecretEncoding)
+	if err != nil {
+		return err
+	}
+	existing, qErr := cmc.Client.CoreV1().Secrets(TargetNamespace).Get("authx-secret", v12.GetOptions{})
+	if qErr == nil && len(existing.Data["secret"]) > 0 {
+		return derrors.NewAlreadyExistsError("authx secret already exists, use rotate-secrets --forceRotate to replace it")
+	}
 	docker := &v1.Secret{
 		TypeMeta: v12.TypeMeta{
 			Kind:       "Secret",
@@ -106,13 +148,14 @@ func (cmc *CreateManagementConfig) createAuthSecret() derrors.Error {
 		ObjectMeta: v12.ObjectMeta{
 			Name:      "authx-secret",
 			Namespace: TargetNamespace,
-			Labels:    map[string]string{"cluster": "management", "component": "authx"},
+			Labels:    labels,
 		},
 		Data: map[string][]byte{
-			"secret": []byte(uuid.NewV4().String()),
+			"secret": []byte(value),
 		},
 		Type: v1.SecretTypeOpaque,
 	}
+	stampSecret(docker, time.Now())
 	derr := cmc.Create(docker)
 	if derr != nil {
 		return derrors.AsError(derr, "cannot create authx secret")
@@ -121,12 +164,18 @@ func (cmc *CreateManagementConfig) createAuthSecret() derrors.Error {
 }
 
 func (cmc *CreateManagementConfig) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	if cmc.ClusterDomain != "" {
+		if err := ValidateClusterDomain(cmc.ClusterDomain); err != nil {
+			return entities.NewCommandResult(false, "invalid management config", err), nil
+		}
+	}
+
 	connectErr := cmc.Connect()
 	if connectErr != nil {
 		return nil, connectErr
 	}
 
-	cErr := cmc.CreateNamespaceIfNotExists(TargetNamespace)
+	cErr := cmc.EnsureNamespace(TargetNamespace, NamespaceOptions{})
 	if cErr != nil {
 		return entities.NewCommandResult(false, "cannot create namespace", cErr), nil
 	}
@@ -153,12 +202,14 @@ func (cmc *CreateManagementConfig) String() string {
 func (cmc *CreateManagementConfig) PrettyPrint(indentation int) string {
 	simpleIden := strings.Repeat(" ", indentation) + "  "
 	entrySep := simpleIden + "  "
-	msg := fmt.Sprintf("\n%sConfig:\n%sPublicHost: %s:%s\n%sDNSHost: %s:%s\n%sPlatform Type:%s\n%sEnvironment:%s",
+	msg := fmt.Sprintf("\n%sConfig:\n%sPublicHost: %s:%s\n%sDNSHost: %s:%s\n%sPlatform Type:%s\n%sEnvironment:%s\n%sCluster Domain:%s\n%sNetworking Mode:%s",
 		simpleIden,
 		entrySep, cmc.PublicHost, cmc.PublicPort,
 		entrySep, cmc.DNSHost, cmc.DNSPort,
 		entrySep, cmc.PlatformType,
 		entrySep, cmc.Environment,
+		entrySep, cmc.ClusterDomain,
+		entrySep, cmc.NetworkingMode,
 	)
 	return strings.Repeat(" ", indentation) + cmc.String() + msg
 }
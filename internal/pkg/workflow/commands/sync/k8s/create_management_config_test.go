@@ -0,0 +1,130 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package k8s
+
+import (
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = ginkgo.Describe("A CreateManagementConfig command", func() {
+
+	var cluster *k8stest.FakeCluster
+
+	ginkgo.BeforeEach(func() {
+		cluster = newFakeCluster()
+	})
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	ginkgo.It("should create the namespace, the management config and the authx secret", func() {
+		cmd := NewCreateManagementConfig(cluster.KubeConfigPath, "nalej.example.com", "443", "AZURE", "PRODUCTION")
+		cmd.DNSHost = "dns.nalej.example.com"
+		cmd.DNSPort = "53"
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+
+		cluster.ExpectObject("v1", "Namespace", "", TargetNamespace)
+		config, cErr := cluster.Client.CoreV1().ConfigMaps(TargetNamespace).Get("management-config", metaV1.GetOptions{})
+		gomega.Expect(cErr).To(gomega.Succeed())
+		gomega.Expect(config.Data).To(gomega.HaveKeyWithValue("public_host", "nalej.example.com"))
+		gomega.Expect(config.Data).To(gomega.HaveKeyWithValue("dns_host", "dns.nalej.example.com"))
+		gomega.Expect(config.Data).To(gomega.HaveKeyWithValue("platform_type", "AZURE"))
+		gomega.Expect(config.Data).To(gomega.HaveKeyWithValue("cluster_domain", DefaultClusterDomain))
+		gomega.Expect(config.Data).To(gomega.HaveKeyWithValue("mesh_enabled", "false"))
+		gomega.Expect(config.Data).To(gomega.HaveKeyWithValue(ManagementConfigSchemaKey, "2"))
+
+		secret := cluster.ExpectObject("v1", "Secret", TargetNamespace, "authx-secret")
+		gomega.Expect(secret.GetLabels()).To(gomega.HaveKeyWithValue("component", "authx"))
+		gomega.Expect(secret.GetAnnotations()).To(gomega.HaveKey(SecretCreatedAtAnnotation))
+		gomega.Expect(secret.GetAnnotations()).To(gomega.HaveKey(SecretRotatedAtAnnotation))
+	})
+
+	ginkgo.It("should reuse an existing namespace", func() {
+		UnregisterClients(cluster.KubeConfigPath)
+		cluster = newFakeCluster(&v1.Namespace{ObjectMeta: metaV1.ObjectMeta{Name: TargetNamespace}})
+		cmd := NewCreateManagementConfig(cluster.KubeConfigPath, "nalej.example.com", "443", "AZURE", "PRODUCTION")
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(cluster.Created()).NotTo(gomega.ContainElement(k8stest.ObjectKey{Kind: "Namespace", Name: TargetNamespace}))
+	})
+
+	ginkgo.It("should store the cluster domain and the mesh of the install", func() {
+		cmd := NewCreateManagementConfig(cluster.KubeConfigPath, "nalej.example.com", "443", "AZURE", "PRODUCTION")
+		cmd.ClusterDomain = "nalej.internal"
+		cmd.NetworkingMode = "istio"
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+
+		config, cErr := cluster.Client.CoreV1().ConfigMaps(TargetNamespace).Get(ManagementConfigName, metaV1.GetOptions{})
+		gomega.Expect(cErr).To(gomega.Succeed())
+		read, rErr := ManagementConfigFromData(config.Data)
+		gomega.Expect(rErr).To(gomega.Succeed())
+		gomega.Expect(read).To(gomega.Equal(cmd.ManagementConfig()))
+		gomega.Expect(read.ClusterDomain).To(gomega.Equal("nalej.internal"))
+		gomega.Expect(read.MeshEnabled).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should reject an invalid cluster domain", func() {
+		cmd := NewCreateManagementConfig(cluster.KubeConfigPath, "nalej.example.com", "443", "AZURE", "PRODUCTION")
+		cmd.ClusterDomain = "Not_A_Domain"
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should read the management config of previous schema versions", func() {
+		read, err := ManagementConfigFromData(map[string]string{"public_host": "nalej.example.com", "environment": "STAGING"})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(read.PublicHost).To(gomega.Equal("nalej.example.com"))
+		gomega.Expect(read.ClusterDomain).To(gomega.BeEmpty())
+		_, err = ManagementConfigFromData(map[string]string{ManagementConfigSchemaKey: "3"})
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should not overwrite an existing authx secret", func() {
+		UnregisterClients(cluster.KubeConfigPath)
+		cluster = newFakeCluster(&v1.Secret{
+			ObjectMeta: metaV1.ObjectMeta{Name: "authx-secret", Namespace: TargetNamespace},
+			Data:       map[string][]byte{"secret": []byte("old")},
+		})
+		cmd := NewCreateManagementConfig(cluster.KubeConfigPath, "nalej.example.com", "443", "AZURE", "PRODUCTION")
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+		secret, qErr := cluster.Client.CoreV1().Secrets(TargetNamespace).Get("authx-secret", metaV1.GetOptions{})
+		gomega.Expect(qErr).To(gomega.Succeed())
+		gomega.Expect(string(secret.Data["secret"])).To(gomega.Equal("old"))
+	})
+
+	ginkgo.It("should fail if the management config already exists", func() {
+		UnregisterClients(cluster.KubeConfigPath)
+		cluster = newFakeCluster(&v1.ConfigMap{ObjectMeta: metaV1.ObjectMeta{Name: "management-config", Namespace: TargetNamespace}})
+		cmd := NewCreateManagementConfig(cluster.KubeConfigPath, "nalej.example.com", "443", "AZURE", "PRODUCTION")
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+	})
+})
@@ -32,7 +32,8 @@ import (
 // CreateRegistrySecrets creates the secrets related to the docker registries available for internal components. Two
 // types of secrets may be created. First, the docker credentials are created so that nalej images can be downloaded.
 // Additionally, a secret is generated on the management cluster with the values required to create secrets on the
-// application cluster.
+// application cluster. If a registries file is set, a docker secret is also created for each registry it contains on
+// each target namespace, and the service accounts listed in the file get the pull secrets.
 type CreateRegistrySecrets struct {
 	Kubernetes
 	OnManagementCluster bool   `json:"on_management_cluster"`
@@ -40,6 +41,20 @@ type CreateRegistrySecrets struct {
 	Username            string `json:"username"`
 	Password            string `json:"password"`
 	URL                 string `json:"url"`
+	// RegistriesPath contains the configuration of additional registries, see RegistriesConfig.
+	RegistriesPath string `json:"registries_path"`
+	// Namespaces where the secrets of the registries file are created, TargetNamespace if not set.
+	Namespaces []string `json:"namespaces"`
+	// Replace the credentials of the secrets of the registries file that already exist, used to rotate them.
+	Replace bool `json:"replace"`
+	// SecretStorePath contains the configuration of the external secret store, see SecretStoreConfig. If set,
+	// references to the values of the store are created instead of the secrets.
+	SecretStorePath string `json:"secret_store_path"`
+	// PlatformType of the cluster. On OpenShift, no secrets are created for the internal registry, and the service
+	// accounts of the target namespaces are allowed to pull the images of the project in the URL of the registry.
+	PlatformType string `json:"platform_type"`
+	// secretStore with the loaded configuration of the secret store.
+	secretStore *SecretStoreConfig
 }
 
 func NewCreateRegistrySecrets(
@@ -72,6 +87,10 @@ func NewCreateRegistrySecretsFromJSON(raw []byte) (*entities.Command, derrors.Er
 // createEnvironmentSecret creates the secret that will be mounted by the installer to be able to trigger
 // the install of application clusters.
 func (cmd *CreateRegistrySecrets) createEnvironmentSecret() derrors.Error {
+	if cmd.secretStore != nil {
+		return cmd.CreateSecretReference(cmd.secretStore, TargetNamespace, fmt.Sprintf("credentials-%s", cmd.CredentialsName),
+			v1.SecretTypeOpaque, []string{"credentials_name", "username", "password", "url"}, map[string]string{"cluster": "management"})
+	}
 	envSecret := &v1.Secret{
 		TypeMeta: v12.TypeMeta{
 			Kind:       "Secret",
@@ -98,6 +117,9 @@ func (cmd *CreateRegistrySecrets) createEnvironmentSecret() derrors.Error {
 }
 
 func (cmd *CreateRegistrySecrets) createDockerSecrets(workflowID string) derrors.Error {
+	if cmd.secretStore != nil {
+		return cmd.createDockerSecretReference(TargetNamespace, cmd.CredentialsName)
+	}
 	// Reuse the existing create docker secret commands
 
 	// Create the production secret
@@ -114,26 +136,125 @@ func (cmd *CreateRegistrySecrets) createDockerSecrets(workflowID string) derrors
 	return nil
 }
 
+// createDockerSecretReference creates the reference to the docker credentials of a registry kept in the secret store.
+func (cmd *CreateRegistrySecrets) createDockerSecretReference(namespace string, secretName string) derrors.Error {
+	if err := cmd.EnsureNamespace(namespace, NamespaceOptions{}); err != nil {
+		return err
+	}
+	return cmd.CreateSecretReference(cmd.secretStore, namespace, secretName, v1.SecretTypeDockerConfigJson,
+		[]string{v1.DockerConfigJsonKey}, nil)
+}
+
+// createRegistriesSecrets creates a docker secret for each registry of the registries file on the target namespaces,
+// and adds them to the pull secrets of the service accounts listed in the file.
+func (cmd *CreateRegistrySecrets) createRegistriesSecrets(workflowID string) derrors.Error {
+	config, err := LoadRegistriesConfig(cmd.RegistriesPath)
+	if err != nil {
+		return err
+	}
+	namespaces := cmd.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{TargetNamespace}
+	}
+	if IsOpenShift(cmd.PlatformType) {
+		if err := cmd.allowInternalRegistry(config, namespaces); err != nil {
+			return err
+		}
+		config = config.ExternalRegistries()
+	}
+	for _, namespace := range namespaces {
+		for _, registry := range config.Registries {
+			if cmd.secretStore != nil {
+				if err := cmd.createDockerSecretReference(namespace, registry.SecretName); err != nil {
+					return err
+				}
+				continue
+			}
+			secret := NewCreateDockerSecret(cmd.KubeConfigPath, registry.SecretName,
+				registry.Username, registry.Password, registry.URL)
+			secret.Namespace = namespace
+			secret.Replace = cmd.Replace
+			result, err := secret.Run(workflowID)
+			if err != nil {
+				return err
+			}
+			if !result.Success {
+				return result.Error
+			}
+			log.Debug().Str("namespace", namespace).Str("secret", registry.SecretName).Str("url", registry.URL).
+				Msg("registry secret has been created")
+		}
+		for _, account := range config.ServiceAccounts {
+			if err := cmd.AddServiceAccountPullSecrets(namespace, account, config.SecretNames()); err != nil {
+				return err
+			}
+			log.Debug().Str("namespace", namespace).Str("serviceAccount", account).Msg("pull secrets attached")
+		}
+	}
+	return nil
+}
+
+// allowInternalRegistry allows the service accounts of the target namespaces to pull the images of the projects of
+// the internal registry of OpenShift.
+func (cmd *CreateRegistrySecrets) allowInternalRegistry(config *RegistriesConfig, namespaces []string) derrors.Error {
+	options := ApplyOptions{}
+	for _, registry := range config.Registries {
+		if !IsOpenShiftInternalRegistry(registry.URL) {
+			continue
+		}
+		project := internalRegistryProject(registry.URL)
+		if project == "" {
+			log.Debug().Str("url", registry.URL).Msg("internal registry without project, images pulled from the same namespace")
+			continue
+		}
+		for _, namespace := range namespaces {
+			if namespace == project {
+				continue
+			}
+			if err := cmd.Apply(ImagePullerBinding(project, namespace), options, &ApplySummary{}); err != nil {
+				return err
+			}
+			log.Debug().Str("project", project).Str("namespace", namespace).Msg("image puller role bound")
+		}
+	}
+	return nil
+}
+
 func (cmd *CreateRegistrySecrets) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
 	connectErr := cmd.Connect()
 	if connectErr != nil {
 		return nil, connectErr
 	}
 
-	cErr := cmd.CreateNamespaceIfNotExists("nalej")
+	cErr := cmd.EnsureNamespace("nalej", NamespaceOptions{})
 	if cErr != nil {
 		return entities.NewCommandResult(false, "cannot create namespace", cErr), nil
 	}
-	// For the public registry we must create the opaque secret on the application clusters.
-	if cmd.OnManagementCluster || cmd.CredentialsName == "nalej-public-registry" {
-		sErr := cmd.createEnvironmentSecret()
+	if cmd.SecretStorePath != "" {
+		config, err := LoadSecretStoreConfig(cmd.SecretStorePath)
+		if err != nil {
+			return entities.NewCommandResult(false, "cannot load secret store", err), nil
+		}
+		cmd.secretStore = config
+	}
+	if cmd.CredentialsName != "" {
+		// For the public registry we must create the opaque secret on the application clusters.
+		if cmd.OnManagementCluster || cmd.CredentialsName == "nalej-public-registry" {
+			sErr := cmd.createEnvironmentSecret()
+			if sErr != nil {
+				return entities.NewCommandResult(false, "cannot create environment secret", sErr), nil
+			}
+		}
+		sErr := cmd.createDockerSecrets(workflowID)
 		if sErr != nil {
-			return entities.NewCommandResult(false, "cannot create environment secret", sErr), nil
+			return entities.NewCommandResult(false, "cannot create docker registry secret", sErr), nil
 		}
 	}
-	sErr := cmd.createDockerSecrets(workflowID)
-	if sErr != nil {
-		return entities.NewCommandResult(false, "cannot create docker registry secret", sErr), nil
+	if cmd.RegistriesPath != "" {
+		sErr := cmd.createRegistriesSecrets(workflowID)
+		if sErr != nil {
+			return entities.NewCommandResult(false, "cannot create docker registry secret", sErr), nil
+		}
 	}
 	// Create Docker secrets
 	log.Debug().Msg("management registry secret has been created")
@@ -141,6 +262,9 @@ func (cmd *CreateRegistrySecrets) Run(workflowID string) (*entities.CommandResul
 }
 
 func (cmd *CreateRegistrySecrets) String() string {
+	if cmd.CredentialsName == "" {
+		return fmt.Sprintf("SYNC CreateRegistrySecrets from %s", cmd.RegistriesPath)
+	}
 	return fmt.Sprintf("SYNC CreateRegistrySecrets for a %s environment", cmd.CredentialsName)
 }
 
@@ -149,5 +273,8 @@ func (cmd *CreateRegistrySecrets) PrettyPrint(indentation int) string {
 }
 
 func (cmd *CreateRegistrySecrets) UserString() string {
+	if cmd.CredentialsName == "" {
+		return fmt.Sprintf("Creating registry secrets from %s", cmd.RegistriesPath)
+	}
 	return fmt.Sprintf("Creating managment registry secrets for a %s environment", cmd.CredentialsName)
 }
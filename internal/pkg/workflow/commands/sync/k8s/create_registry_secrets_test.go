@@ -0,0 +1,107 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = ginkgo.Describe("A CreateRegistrySecrets command", func() {
+
+	var cluster *k8stest.FakeCluster
+
+	ginkgo.BeforeEach(func() {
+		cluster = newFakeCluster()
+	})
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	ginkgo.It("should create the docker and environment secrets on the management cluster", func() {
+		cmd := NewCreateRegistrySecrets(cluster.KubeConfigPath, true, "nalej-registry", "user", "password", "registry.example.com")
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+
+		docker, dErr := cluster.Client.CoreV1().Secrets("nalej").Get("nalej-registry", metaV1.GetOptions{})
+		gomega.Expect(dErr).To(gomega.Succeed())
+		gomega.Expect(docker.Type).To(gomega.Equal(v1.SecretTypeDockerConfigJson))
+
+		env, eErr := cluster.Client.CoreV1().Secrets("nalej").Get("credentials-nalej-registry", metaV1.GetOptions{})
+		gomega.Expect(eErr).To(gomega.Succeed())
+		gomega.Expect(string(env.Data["username"])).To(gomega.Equal("user"))
+		gomega.Expect(string(env.Data["url"])).To(gomega.Equal("registry.example.com"))
+	})
+
+	ginkgo.It("should only create the docker secret on application clusters", func() {
+		cmd := NewCreateRegistrySecrets(cluster.KubeConfigPath, false, "nalej-registry", "user", "password", "registry.example.com")
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		cluster.ExpectObject("v1", "Secret", "nalej", "nalej-registry")
+		cluster.ExpectNoObject("v1", "Secret", "nalej", "credentials-nalej-registry")
+	})
+	ginkgo.It("should create a docker secret for each registry of the registries file", func() {
+		file, fErr := ioutil.TempFile("", "registries")
+		gomega.Expect(fErr).To(gomega.Succeed())
+		defer os.Remove(file.Name())
+		_, fErr = file.WriteString(testRegistries + "service_accounts: [default]\n")
+		gomega.Expect(fErr).To(gomega.Succeed())
+		file.Close()
+
+		cmd := NewCreateRegistrySecrets(cluster.KubeConfigPath, false, "", "", "", "")
+		cmd.RegistriesPath = file.Name()
+		cmd.Namespaces = []string{"nalej", "ingress-nginx"}
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		for _, namespace := range cmd.Namespaces {
+			cluster.ExpectObject("v1", "Secret", namespace, "private-registry")
+			cluster.ExpectObject("v1", "Secret", namespace, "mirror-registry")
+			account, aErr := cluster.Client.CoreV1().ServiceAccounts(namespace).Get("default", metaV1.GetOptions{})
+			gomega.Expect(aErr).To(gomega.Succeed())
+			gomega.Expect(account.ImagePullSecrets).To(gomega.Equal([]v1.LocalObjectReference{
+				{Name: "private-registry"}, {Name: "mirror-registry"},
+			}))
+		}
+	})
+
+	ginkgo.It("should keep the existing pull secrets of the service accounts", func() {
+		account := &v1.ServiceAccount{
+			ObjectMeta:       metaV1.ObjectMeta{Name: "default", Namespace: "nalej"},
+			ImagePullSecrets: []v1.LocalObjectReference{{Name: "existing"}, {Name: "private-registry"}},
+		}
+		_, cErr := cluster.Client.CoreV1().ServiceAccounts("nalej").Create(account)
+		gomega.Expect(cErr).To(gomega.Succeed())
+		cmd := NewCreateRegistrySecrets(cluster.KubeConfigPath, false, "", "", "", "")
+		gomega.Expect(cmd.Connect()).To(gomega.Succeed())
+		gomega.Expect(cmd.AddServiceAccountPullSecrets("nalej", "default", []string{"private-registry", "mirror-registry"})).To(gomega.Succeed())
+		updated, gErr := cluster.Client.CoreV1().ServiceAccounts("nalej").Get("default", metaV1.GetOptions{})
+		gomega.Expect(gErr).To(gomega.Succeed())
+		gomega.Expect(updated.ImagePullSecrets).To(gomega.Equal([]v1.LocalObjectReference{
+			{Name: "existing"}, {Name: "private-registry"}, {Name: "mirror-registry"},
+		}))
+	})
+})
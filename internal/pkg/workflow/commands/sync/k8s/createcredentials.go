@@ -78,7 +78,7 @@ func (cc *CreateCredentials) Run(workflowID string) (*entities.CommandResult, de
 	if connectErr != nil {
 		return nil, connectErr
 	}
-	cErr := cc.CreateNamespaceIfNotExists("nalej")
+	cErr := cc.EnsureNamespace("nalej", NamespaceOptions{})
 	if cErr != nil {
 		return entities.NewCommandResult(false, "cannot create namespace", cErr), nil
 	}
@@ -60,6 +60,10 @@ func NewDeleteNamespaceFromJSON(raw []byte) (*entities.Command, derrors.Error) {
 
 // Run the current command returning the result or an error.
 func (dn *DeleteNamespace) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	if IsRancherNamespace(dn.Namespace) {
+		toReturn := derrors.NewInvalidArgumentError("namespaces managed by Rancher cannot be deleted").WithParams(dn.Namespace)
+		return entities.NewCommandResult(false, "target namespace is managed by Rancher", toReturn), nil
+	}
 	connectErr := dn.Connect()
 	if connectErr != nil {
 		return nil, connectErr
@@ -24,6 +24,7 @@ import (
 	"github.com/nalej/installer/internal/pkg/errors"
 	"github.com/nalej/installer/internal/pkg/workflow/entities"
 	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"strings"
 )
 
@@ -66,14 +67,28 @@ func (dpsp *DeletePodSecurityPolicy) Run(workflowID string) (*entities.CommandRe
 		return nil, connectErr
 	}
 
-	exists, err := dpsp.ExistsEntity("", "policy", "v1", "podsecuritypolicies", dpsp.PolicyName)
+	capabilities, err := dpsp.Capabilities()
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot determine the cluster capabilities", err), nil
+	}
+	if !capabilities.SupportsPodSecurityPolicy() {
+		log.Debug().Str("version", capabilities.GitVersion).Msg("pod security policies are not served")
+		return entities.NewSuccessCommand([]byte("Pod security policies are not supported by the cluster")), nil
+	}
+	groupVersion, err := capabilities.PreferredGroupVersion("PodSecurityPolicy", "policy/v1beta1")
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot determine the pod security policy version", err), nil
+	}
+	gv := schema.FromAPIVersionAndKind(groupVersion, "PodSecurityPolicy")
+
+	exists, err := dpsp.ExistsEntity("", gv.Group, gv.Version, "podsecuritypolicies", dpsp.PolicyName)
 	if err != nil {
 		return entities.NewCommandResult(false, "cannot determine if the pod security policy exists", err), nil
 	}
 	log.Debug().Str("policyName", dpsp.PolicyName).Bool("exists", exists).Msg("pod security policy check")
 
 	if exists {
-		err := dpsp.DeleteEntity("", "policy", "v1", "podsecuritypolicies", dpsp.PolicyName)
+		err := dpsp.DeleteEntity("", gv.Group, gv.Version, "podsecuritypolicies", dpsp.PolicyName)
 		if err != nil {
 			return entities.NewErrCommand("cannot delete pod security policy", err), nil
 		}
@@ -0,0 +1,308 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/nalej/derrors"
+	entities2 "github.com/nalej/installer/internal/pkg/entities"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DiffAction describes what an install would do with an object.
+type DiffAction string
+
+const (
+	// DiffCreate objects do not exist in the cluster.
+	DiffCreate DiffAction = "create"
+	// DiffUpdate objects exist and their manifest changed.
+	DiffUpdate DiffAction = "update"
+	// DiffUnchanged objects were applied with the same manifest.
+	DiffUnchanged DiffAction = "unchanged"
+	// DiffPrune objects of previous installs are no longer part of the components.
+	DiffPrune DiffAction = "prune"
+)
+
+// FieldChange with the change of a field of an object. A nil New value means the field is removed.
+type FieldChange struct {
+	Path string      `json:"path" yaml:"path"`
+	Old  interface{} `json:"old,omitempty" yaml:"old,omitempty"`
+	New  interface{} `json:"new,omitempty" yaml:"new,omitempty"`
+}
+
+// ObjectDiff with the changes an install would perform on an object.
+type ObjectDiff struct {
+	ObjectReference `json:",inline" yaml:",inline"`
+	// Component with the file that contains the object, empty for pruned objects.
+	Component string        `json:"component,omitempty" yaml:"component,omitempty"`
+	Action    DiffAction    `json:"action" yaml:"action"`
+	Changes   []FieldChange `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+// DiffReport with the differences between the components and the cluster.
+type DiffReport struct {
+	Objects []ObjectDiff `json:"objects" yaml:"objects"`
+}
+
+// Count returns the number of objects with a given action.
+func (dr *DiffReport) Count(action DiffAction) int {
+	result := 0
+	for _, obj := range dr.Objects {
+		if obj.Action == action {
+			result++
+		}
+	}
+	return result
+}
+
+// HasChanges checks if applying the components would modify the cluster.
+func (dr *DiffReport) HasChanges() bool {
+	return dr.Count(DiffUnchanged) != len(dr.Objects)
+}
+
+// Diff compares the components with the objects of the cluster without modifying it. Objects are prepared as Apply
+// does, so an object is reported as unchanged when Apply would skip it, and the changes of updated objects are the
+// ones of the patch Apply would send on clusters without server-side apply.
+//   returns:
+//     The report with an entry per object.
+//     An error if the components cannot be loaded or the cluster cannot be queried.
+func (lc *LaunchComponents) Diff() (*DiffReport, derrors.Error) {
+	if err := lc.Connect(); err != nil {
+		return nil, err
+	}
+	components, objects, err := lc.loadObjects()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := lc.translatePodSecurityPolicies(objects); err != nil {
+		return nil, err
+	}
+
+	labels := lc.installLabels()
+	report := &DiffReport{Objects: make([]ObjectDiff, 0)}
+	applied := make([]ObjectReference, 0)
+	for _, fileName := range components {
+		obj, exists := objects[fileName]
+		if !exists {
+			continue
+		}
+		items, err := unstructuredItems(obj)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			diff, err := lc.diffObject(item, labels)
+			if err != nil {
+				return nil, err
+			}
+			diff.Component = fileName
+			report.Objects = append(report.Objects, *diff)
+			applied = append(applied, diff.ObjectReference)
+		}
+	}
+	if lc.InstallID != "" && lc.Prune {
+		previous, err := lc.LoadInventory(lc.InstallID)
+		if err != nil {
+			return nil, err
+		}
+		protected := lc.ProtectedKinds
+		if len(protected) == 0 {
+			protected = DefaultProtectedKinds
+		}
+		prunable, err := lc.ListPrunable(lc.InstallID, InventoryKinds(previous, applied), applied, protected)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range prunable {
+			report.Objects = append(report.Objects, ObjectDiff{ObjectReference: ref, Action: DiffPrune})
+		}
+	}
+	return report, nil
+}
+
+// loadObjects reads the components to be launched, verifying them against the index of the components directory.
+//   returns:
+//     The names of the component files, sorted.
+//     The objects of each component file after applying the platform modifications.
+//     An error if a component cannot be loaded.
+func (lc *LaunchComponents) loadObjects() ([]string, map[string]runtime.Object, derrors.Error) {
+	targetEnvironment, found := entities2.TargetEnvironmentFromString[lc.Environment]
+	if !found {
+		return nil, nil, derrors.NewInvalidArgumentError("cannot determine target environment").WithParams(lc.Environment)
+	}
+	components, err := lc.ListComponents()
+	if err != nil {
+		return nil, nil, err
+	}
+	index, err := lc.loadComponentsIndex()
+	if err != nil {
+		return nil, nil, err
+	}
+	objects := make(map[string]runtime.Object, len(components))
+	for _, fileName := range components {
+		obj, _, err := lc.loadComponent(fileName, targetEnvironment, index)
+		if err != nil {
+			return nil, nil, err
+		}
+		objects[fileName] = obj
+	}
+	return components, objects, nil
+}
+
+// installLabels returns the labels added to the launched objects.
+func (lc *LaunchComponents) installLabels() map[string]string {
+	labels := map[string]string{ManagedByLabel: ManagedByInstaller}
+	if lc.InstallID != "" {
+		labels[InstallIDLabel] = InstallIDLabelValue(lc.InstallID)
+	}
+	return labels
+}
+
+// addLabels sets a group of labels on an object, keeping the existing ones.
+func addLabels(obj *unstructured.Unstructured, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	objLabels := obj.GetLabels()
+	if objLabels == nil {
+		objLabels = make(map[string]string, 0)
+	}
+	for key, value := range labels {
+		objLabels[key] = value
+	}
+	obj.SetLabels(objLabels)
+}
+
+// unstructuredItems converts a component into the unstructured objects to be applied, expanding list resources.
+func unstructuredItems(obj runtime.Object) ([]*unstructured.Unstructured, derrors.Error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot convert object to unstructured", err)
+	}
+	converted := &unstructured.Unstructured{Object: content}
+	if !converted.IsList() {
+		if converted.GetKind() == "" {
+			gvk, derr := getKind(obj)
+			if derr != nil {
+				return nil, derr
+			}
+			converted.SetGroupVersionKind(gvk)
+		}
+		return []*unstructured.Unstructured{converted}, nil
+	}
+	list, err := converted.ToList()
+	if err != nil {
+		return nil, derrors.NewInternalError("cannot create unstructured list", err)
+	}
+	result := make([]*unstructured.Unstructured, 0, len(list.Items))
+	for i := range list.Items {
+		result = append(result, &list.Items[i])
+	}
+	return result, nil
+}
+
+// diffObject compares an object with its live version.
+func (k *Kubernetes) diffObject(obj *unstructured.Unstructured, labels map[string]string) (*ObjectDiff, derrors.Error) {
+	addLabels(obj, labels)
+	client, err := k.resourceClient(obj.GroupVersionKind(), obj)
+	if err != nil {
+		return nil, err
+	}
+	result := &ObjectDiff{ObjectReference: NewObjectReference(obj)}
+	hash, err := ManifestHash(obj)
+	if err != nil {
+		return nil, err
+	}
+	existing, gErr := client.Get(obj.GetName(), metaV1.GetOptions{})
+	if gErr != nil {
+		if k8sErrors.IsNotFound(gErr) {
+			result.Action = DiffCreate
+			return result, nil
+		}
+		return nil, derrors.NewInternalError("cannot retrieve object", gErr).WithParams(obj.GetKind(), obj.GetName())
+	}
+	if existing.GetAnnotations()[AppliedHashAnnotation] == hash {
+		result.Action = DiffUnchanged
+		return result, nil
+	}
+	// The apply annotations are not part of the changes shown to the user.
+	live := existing.DeepCopy()
+	removeApplyAnnotations(live)
+	original := lastAppliedManifest(existing)
+	if original != nil {
+		originalObj := &unstructured.Unstructured{Object: original}
+		removeApplyAnnotations(originalObj)
+		original = originalObj.Object
+	}
+	patch := ThreeWayMergePatch(original, obj.Object, live.Object)
+	result.Changes = FieldChanges(patch, live.Object)
+	result.Action = DiffUpdate
+	if len(result.Changes) == 0 {
+		result.Action = DiffUnchanged
+	}
+	return result, nil
+}
+
+// FieldChanges flattens a merge patch into the list of changed fields, sorted by path.
+//   params:
+//     patch The merge patch.
+//     current The object the patch applies to.
+//   returns:
+//     The changes with the dot separated path of each field.
+func FieldChanges(patch map[string]interface{}, current map[string]interface{}) []FieldChange {
+	result := make([]FieldChange, 0)
+	collectChanges("", patch, current, &result)
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result
+}
+
+func collectChanges(prefix string, patch map[string]interface{}, current map[string]interface{}, result *[]FieldChange) {
+	for key, value := range patch {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		currentValue := current[key]
+		patchMap, patchIsMap := value.(map[string]interface{})
+		currentMap, currentIsMap := currentValue.(map[string]interface{})
+		if patchIsMap && currentIsMap {
+			collectChanges(path, patchMap, currentMap, result)
+			continue
+		}
+		if reflect.DeepEqual(value, currentValue) {
+			continue
+		}
+		*result = append(*result, FieldChange{Path: path, Old: currentValue, New: value})
+	}
+}
+
+// String returns the reference of the object in a human readable format.
+func (od ObjectDiff) String() string {
+	name := od.Name
+	if od.Namespace != "" {
+		name = od.Namespace + "/" + od.Name
+	}
+	return fmt.Sprintf("%s %s", strings.ToLower(od.Kind), name)
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const diffConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: platform-config
+  namespace: nalej
+data:
+  key: %s
+`
+
+var _ = ginkgo.Describe("Diff of components", func() {
+
+	ginkgo.It("should flatten the changes of a patch", func() {
+		current := map[string]interface{}{
+			"spec": map[string]interface{}{"replicas": int64(1), "paused": true},
+		}
+		patch := map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "web"}},
+			"spec":     map[string]interface{}{"replicas": int64(3), "paused": nil},
+		}
+		gomega.Expect(FieldChanges(patch, current)).To(gomega.Equal([]FieldChange{
+			{Path: "metadata", New: map[string]interface{}{"labels": map[string]interface{}{"app": "web"}}},
+			{Path: "spec.paused", Old: true},
+			{Path: "spec.replicas", Old: int64(1), New: int64(3)},
+		}))
+	})
+
+	ginkgo.Context("on a fake cluster", func() {
+		var cluster *k8stest.FakeCluster
+		var componentsDir string
+
+		writeConfigMap := func(value string) {
+			content := []byte(fmt.Sprintf(diffConfigMap, value))
+			gomega.Expect(ioutil.WriteFile(filepath.Join(componentsDir, "1.configmap.yaml"), content, 0644)).To(gomega.Succeed())
+		}
+
+		newCommand := func() *LaunchComponents {
+			cmd := NewLaunchComponents(cluster.KubeConfigPath, []string{"nalej"}, componentsDir, grpc_installer_go.Platform_AZURE.String())
+			cmd.Environment = "PRODUCTION"
+			return cmd
+		}
+
+		ginkgo.BeforeEach(func() {
+			cluster = newFakeCluster()
+			dir, err := ioutil.TempDir("", "diff")
+			gomega.Expect(err).To(gomega.Succeed())
+			componentsDir = dir
+			writeConfigMap("value")
+		})
+
+		ginkgo.AfterEach(func() {
+			UnregisterClients(cluster.KubeConfigPath)
+			os.RemoveAll(componentsDir)
+		})
+
+		ginkgo.It("should report the objects to be created, updated or left unchanged", func() {
+			report, err := newCommand().Diff()
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(report.Objects).To(gomega.HaveLen(1))
+			gomega.Expect(report.Objects[0].Action).To(gomega.Equal(DiffCreate))
+			gomega.Expect(report.Objects[0].Component).To(gomega.Equal("1.configmap.yaml"))
+
+			result, err := newCommand().Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+
+			report, err = newCommand().Diff()
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(report.HasChanges()).To(gomega.BeFalse())
+
+			writeConfigMap("other")
+			report, err = newCommand().Diff()
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(report.Objects[0].Action).To(gomega.Equal(DiffUpdate))
+			gomega.Expect(report.Objects[0].Changes).To(gomega.Equal([]FieldChange{{Path: "data.key", Old: "value", New: "other"}}))
+			// The cluster is not modified.
+			config := cluster.ExpectObject("v1", "ConfigMap", "nalej", "platform-config")
+			gomega.Expect(config.Object["data"]).To(gomega.Equal(map[string]interface{}{"key": "value"}))
+		})
+	})
+})
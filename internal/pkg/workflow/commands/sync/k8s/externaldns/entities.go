@@ -0,0 +1,369 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// External DNS integration
+// external-dns watches the services and ingresses of the cluster and publishes their records under the management
+// domain on the DNS provider of the platform. The provider credentials are stored on a secret that is mounted or
+// exposed as environment variables depending on the provider.
+
+package externaldns
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nalej/derrors"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	rbacV1 "k8s.io/api/rbac/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Namespace where external-dns is installed.
+const Namespace = "nalej"
+
+// Name of the external-dns objects.
+const Name = "external-dns"
+
+// CredentialsSecret is the name of the secret with the provider credentials.
+const CredentialsSecret = "external-dns-credentials"
+
+// DefaultImage is the external-dns image used if not specified.
+const DefaultImage = "registry.opensource.zalan.do/teapot/external-dns:v0.5.17"
+
+// DefaultInterval between synchronizations with the provider.
+const DefaultInterval = "1m"
+
+// Supported DNS providers.
+const (
+	AzureProvider   = "azure"
+	AWSProvider     = "aws"
+	GoogleProvider  = "google"
+	CoreDNSProvider = "coredns"
+)
+
+// Supported synchronization policies.
+const (
+	// UpsertOnlyPolicy never deletes records, so records created by hand are kept.
+	UpsertOnlyPolicy = "upsert-only"
+	// SyncPolicy deletes the records owned by the cluster whose services have been removed.
+	SyncPolicy = "sync"
+)
+
+// DefaultSources are the kinds of objects whose records are published if not specified.
+var DefaultSources = []string{"service", "ingress"}
+
+// Keys of the provider configuration.
+const (
+	AzureTenantIDKey       = "tenant_id"
+	AzureSubscriptionIDKey = "subscription_id"
+	AzureResourceGroupKey  = "resource_group"
+	AzureClientIDKey       = "client_id"
+	AzureClientSecretKey   = "client_secret"
+	AWSAccessKeyIDKey      = "access_key_id"
+	AWSSecretAccessKeyKey  = "secret_access_key"
+	AWSZoneTypeKey         = "zone_type"
+	GoogleProjectKey       = "project"
+	GoogleCredentialsKey   = "credentials"
+	CoreDNSEtcdURLsKey     = "etcd_urls"
+)
+
+// requiredKeys contains the configuration keys required by each provider.
+var requiredKeys = map[string][]string{
+	AzureProvider:   {AzureTenantIDKey, AzureSubscriptionIDKey, AzureResourceGroupKey, AzureClientIDKey, AzureClientSecretKey},
+	AWSProvider:     {AWSAccessKeyIDKey, AWSSecretAccessKeyKey},
+	GoogleProvider:  {GoogleProjectKey, GoogleCredentialsKey},
+	CoreDNSProvider: {CoreDNSEtcdURLsKey},
+}
+
+// ProviderSettings structure with the arguments, environment and credentials required by a provider.
+type ProviderSettings struct {
+	// Args with the provider specific arguments.
+	Args []string
+	// Env with the provider specific environment variables.
+	Env []v1.EnvVar
+	// SecretData with the content of the credentials secret.
+	SecretData map[string]string
+	// MountPath where the credentials secret is mounted, empty if it is not mounted.
+	MountPath string
+}
+
+// Labels returns the labels of the external-dns objects.
+func Labels() map[string]string {
+	return map[string]string{
+		"cluster":   "management",
+		"component": Name,
+	}
+}
+
+// secretEnv creates an environment variable read from the credentials secret.
+func secretEnv(name string, key string) v1.EnvVar {
+	return v1.EnvVar{
+		Name: name,
+		ValueFrom: &v1.EnvVarSource{
+			SecretKeyRef: &v1.SecretKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: CredentialsSecret},
+				Key:                  key,
+			},
+		},
+	}
+}
+
+// NewProviderSettings builds the settings of a provider from its configuration.
+//   params:
+//     provider The name of the provider.
+//     config The provider configuration.
+//   returns:
+//     The provider settings.
+//     An error if the provider is not supported or the configuration is incomplete.
+func NewProviderSettings(provider string, config map[string]string) (*ProviderSettings, derrors.Error) {
+	required, supported := requiredKeys[provider]
+	if !supported {
+		return nil, derrors.NewInvalidArgumentError("unsupported DNS provider").WithParams(provider)
+	}
+	missing := make([]string, 0)
+	for _, key := range required {
+		if config[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, derrors.NewInvalidArgumentError("missing DNS provider configuration").WithParams(provider, missing)
+	}
+
+	switch provider {
+	case AzureProvider:
+		azureConfig, err := json.Marshal(map[string]string{
+			"tenantId":        config[AzureTenantIDKey],
+			"subscriptionId":  config[AzureSubscriptionIDKey],
+			"resourceGroup":   config[AzureResourceGroupKey],
+			"aadClientId":     config[AzureClientIDKey],
+			"aadClientSecret": config[AzureClientSecretKey],
+		})
+		if err != nil {
+			return nil, derrors.NewInternalError("cannot build azure configuration", err)
+		}
+		return &ProviderSettings{
+			Args:       []string{fmt.Sprintf("--azure-resource-group=%s", config[AzureResourceGroupKey])},
+			SecretData: map[string]string{"azure.json": string(azureConfig)},
+			// Default location of the azure configuration file.
+			MountPath: "/etc/kubernetes",
+		}, nil
+	case AWSProvider:
+		settings := &ProviderSettings{
+			Env: []v1.EnvVar{
+				secretEnv("AWS_ACCESS_KEY_ID", AWSAccessKeyIDKey),
+				secretEnv("AWS_SECRET_ACCESS_KEY", AWSSecretAccessKeyKey),
+			},
+			SecretData: map[string]string{
+				AWSAccessKeyIDKey:     config[AWSAccessKeyIDKey],
+				AWSSecretAccessKeyKey: config[AWSSecretAccessKeyKey],
+			},
+		}
+		if config[AWSZoneTypeKey] != "" {
+			settings.Args = []string{fmt.Sprintf("--aws-zone-type=%s", config[AWSZoneTypeKey])}
+		}
+		return settings, nil
+	case GoogleProvider:
+		mountPath := "/etc/external-dns/google"
+		return &ProviderSettings{
+			Args: []string{fmt.Sprintf("--google-project=%s", config[GoogleProjectKey])},
+			Env: []v1.EnvVar{{
+				Name:  "GOOGLE_APPLICATION_CREDENTIALS",
+				Value: mountPath + "/credentials.json",
+			}},
+			SecretData: map[string]string{"credentials.json": config[GoogleCredentialsKey]},
+			MountPath:  mountPath,
+		}, nil
+	}
+	// CoreDNS reads the records from the etcd cluster used by the platform DNS.
+	return &ProviderSettings{
+		Env:        []v1.EnvVar{secretEnv("ETCD_URLS", CoreDNSEtcdURLsKey)},
+		SecretData: map[string]string{CoreDNSEtcdURLsKey: config[CoreDNSEtcdURLsKey]},
+	}, nil
+}
+
+// SupportedProviders returns the names of the supported providers.
+func SupportedProviders() []string {
+	result := make([]string, 0, len(requiredKeys))
+	for provider := range requiredKeys {
+		result = append(result, provider)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Args returns the arguments of external-dns.
+//   params:
+//     provider The name of the provider.
+//     domain The domain whose records are managed.
+//     ownerID The identifier of the cluster owning the records.
+//     policy The synchronization policy.
+//     interval The interval between synchronizations.
+//     sources The kinds of objects whose records are published.
+//     settings The provider settings.
+//   returns:
+//     The list of arguments.
+func Args(provider string, domain string, ownerID string, policy string, interval string, sources []string, settings *ProviderSettings) []string {
+	args := make([]string, 0)
+	for _, source := range sources {
+		args = append(args, fmt.Sprintf("--source=%s", source))
+	}
+	args = append(args,
+		fmt.Sprintf("--domain-filter=%s", strings.TrimSuffix(domain, ".")),
+		fmt.Sprintf("--provider=%s", provider),
+		fmt.Sprintf("--policy=%s", policy),
+		fmt.Sprintf("--interval=%s", interval),
+		"--registry=txt",
+		fmt.Sprintf("--txt-owner-id=%s", ownerID))
+	return append(args, settings.Args...)
+}
+
+// NewCredentialsSecret creates the secret with the provider credentials.
+func NewCredentialsSecret(settings *ProviderSettings) *v1.Secret {
+	return &v1.Secret{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      CredentialsSecret,
+			Namespace: Namespace,
+			Labels:    Labels(),
+		},
+		Type:       v1.SecretTypeOpaque,
+		StringData: settings.SecretData,
+	}
+}
+
+// NewServiceAccount creates the service account used by external-dns.
+func NewServiceAccount() *v1.ServiceAccount {
+	return &v1.ServiceAccount{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ServiceAccount",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      Name,
+			Namespace: Namespace,
+			Labels:    Labels(),
+		},
+	}
+}
+
+// NewClusterRole creates the role with the permissions required to watch the published objects.
+func NewClusterRole() *rbacV1.ClusterRole {
+	return &rbacV1.ClusterRole{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ClusterRole",
+			APIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:   Name,
+			Labels: Labels(),
+		},
+		Rules: []rbacV1.PolicyRule{
+			{
+				APIGroups: []string{""},
+				Resources: []string{"services", "endpoints", "pods"},
+				Verbs:     []string{"get", "watch", "list"},
+			},
+			{
+				APIGroups: []string{"extensions", "networking.k8s.io"},
+				Resources: []string{"ingresses"},
+				Verbs:     []string{"get", "watch", "list"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"nodes"},
+				Verbs:     []string{"watch", "list"},
+			},
+		},
+	}
+}
+
+// NewClusterRoleBinding creates the binding of the external-dns role to its service account.
+func NewClusterRoleBinding() *rbacV1.ClusterRoleBinding {
+	return &rbacV1.ClusterRoleBinding{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ClusterRoleBinding",
+			APIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:   Name,
+			Labels: Labels(),
+		},
+		RoleRef: rbacV1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     Name,
+		},
+		Subjects: []rbacV1.Subject{{
+			Kind:      "ServiceAccount",
+			Name:      Name,
+			Namespace: Namespace,
+		}},
+	}
+}
+
+// NewDeployment creates the external-dns deployment. A single replica is launched as external-dns does not
+// support leader election.
+func NewDeployment(image string, args []string, settings *ProviderSettings) *appsV1.Deployment {
+	replicas := int32(1)
+	labels := Labels()
+	container := v1.Container{
+		Name:            Name,
+		Image:           image,
+		ImagePullPolicy: v1.PullIfNotPresent,
+		Args:            args,
+		Env:             settings.Env,
+	}
+	volumes := make([]v1.Volume, 0)
+	if settings.MountPath != "" {
+		volumes = append(volumes, v1.Volume{
+			Name:         "credentials",
+			VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: CredentialsSecret}},
+		})
+		container.VolumeMounts = []v1.VolumeMount{{Name: "credentials", MountPath: settings.MountPath, ReadOnly: true}}
+	}
+	return &appsV1.Deployment{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      Name,
+			Namespace: Namespace,
+			Labels:    labels,
+		},
+		Spec: appsV1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metaV1.LabelSelector{MatchLabels: labels},
+			Strategy: appsV1.DeploymentStrategy{Type: appsV1.RecreateDeploymentStrategyType},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metaV1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					ServiceAccountName: Name,
+					Containers:         []v1.Container{container},
+					Volumes:            volumes,
+				},
+			},
+		},
+	}
+}
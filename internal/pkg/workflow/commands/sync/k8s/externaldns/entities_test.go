@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package externaldns
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+)
+
+var _ = ginkgo.Describe("External DNS", func() {
+
+	azureConfig := map[string]string{
+		AzureTenantIDKey:       "tenant",
+		AzureSubscriptionIDKey: "subscription",
+		AzureResourceGroupKey:  "dns-group",
+		AzureClientIDKey:       "client",
+		AzureClientSecretKey:   "secret",
+	}
+
+	ginkgo.Context("provider settings", func() {
+		ginkgo.It("should reject unsupported providers", func() {
+			_, err := NewProviderSettings("unknown", azureConfig)
+			gomega.Expect(err).ShouldNot(gomega.Succeed())
+		})
+
+		ginkgo.It("should reject incomplete configurations", func() {
+			for _, provider := range SupportedProviders() {
+				_, err := NewProviderSettings(provider, map[string]string{})
+				gomega.Expect(err).ShouldNot(gomega.Succeed())
+			}
+		})
+
+		ginkgo.It("should mount the azure configuration", func() {
+			settings, err := NewProviderSettings(AzureProvider, azureConfig)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(settings.Args).Should(gomega.ContainElement("--azure-resource-group=dns-group"))
+			gomega.Expect(settings.MountPath).Should(gomega.Equal("/etc/kubernetes"))
+			content := make(map[string]string)
+			gomega.Expect(json.Unmarshal([]byte(settings.SecretData["azure.json"]), &content)).To(gomega.Succeed())
+			gomega.Expect(content).Should(gomega.HaveKeyWithValue("aadClientSecret", "secret"))
+		})
+
+		ginkgo.It("should read the aws credentials from the environment", func() {
+			settings, err := NewProviderSettings(AWSProvider, map[string]string{
+				AWSAccessKeyIDKey:     "key",
+				AWSSecretAccessKeyKey: "secret",
+				AWSZoneTypeKey:        "public",
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(settings.Env).Should(gomega.HaveLen(2))
+			gomega.Expect(settings.Env[0].ValueFrom.SecretKeyRef.Name).Should(gomega.Equal(CredentialsSecret))
+			gomega.Expect(settings.Args).Should(gomega.ContainElement("--aws-zone-type=public"))
+			gomega.Expect(settings.MountPath).Should(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("install command", func() {
+		ginkgo.It("should apply the default values when read from JSON", func() {
+			raw := []byte(`{"type":"sync", "name":"installExternalDNS", "kubeConfigPath":"/tmp/kc",
+				"provider":"coredns", "domain":"nalej.example.com.", "owner_id":"cluster",
+				"provider_config":{"etcd_urls":"http://etcd:2379"}}`)
+			cmd, err := NewInstallExternalDNSFromJSON(raw)
+			gomega.Expect(err).To(gomega.Succeed())
+			ied := (*cmd).(*InstallExternalDNS)
+			gomega.Expect(ied.Image).Should(gomega.Equal(DefaultImage))
+			gomega.Expect(ied.Policy).Should(gomega.Equal(UpsertOnlyPolicy))
+
+			settings, err := ied.Validate()
+			gomega.Expect(err).To(gomega.Succeed())
+			objects := ied.Objects(settings)
+			gomega.Expect(objects).Should(gomega.HaveLen(5))
+			deployment, ok := objects[4].(*appsV1.Deployment)
+			gomega.Expect(ok).Should(gomega.BeTrue())
+			container := deployment.Spec.Template.Spec.Containers[0]
+			gomega.Expect(container.Args).Should(gomega.ContainElement("--domain-filter=nalej.example.com"))
+			gomega.Expect(container.Args).Should(gomega.ContainElement("--txt-owner-id=cluster"))
+			gomega.Expect(container.Args).Should(gomega.ContainElement("--source=ingress"))
+			gomega.Expect(deployment.Spec.Template.Spec.ServiceAccountName).Should(gomega.Equal(Name))
+			gomega.Expect(deployment.Spec.Template.Spec.Volumes).Should(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should merge the provider configuration file", func() {
+			file, fErr := ioutil.TempFile("", "external-dns")
+			gomega.Expect(fErr).To(gomega.Succeed())
+			defer os.Remove(file.Name())
+			_, fErr = file.WriteString("tenant_id: tenant\nsubscription_id: subscription\nresource_group: file-group\nclient_id: client\nclient_secret: secret\n")
+			gomega.Expect(fErr).To(gomega.Succeed())
+			gomega.Expect(file.Close()).To(gomega.Succeed())
+
+			ied := NewInstallExternalDNS("/tmp/kc", AzureProvider, "nalej.example.com", "cluster",
+				map[string]string{AzureResourceGroupKey: "inline-group"})
+			ied.ProviderConfigPath = file.Name()
+			settings, err := ied.Validate()
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(settings.Args).Should(gomega.ContainElement("--azure-resource-group=inline-group"))
+
+			deployment := ied.Objects(settings)[4].(*appsV1.Deployment)
+			volumes := deployment.Spec.Template.Spec.Volumes
+			gomega.Expect(volumes).Should(gomega.HaveLen(1))
+			gomega.Expect(volumes[0].VolumeSource.Secret).Should(gomega.Equal(&v1.SecretVolumeSource{SecretName: CredentialsSecret}))
+		})
+
+		ginkgo.It("should reject unsupported policies", func() {
+			ied := NewInstallExternalDNS("/tmp/kc", AzureProvider, "nalej.example.com", "cluster", azureConfig)
+			ied.Policy = "delete-all"
+			_, err := ied.Validate()
+			gomega.Expect(err).ShouldNot(gomega.Succeed())
+		})
+	})
+})
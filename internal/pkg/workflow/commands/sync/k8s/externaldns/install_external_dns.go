@@ -0,0 +1,225 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package externaldns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// InstallExternalDNS structure with the attributes required to install external-dns so the services and ingresses
+// of the platform publish their records under the management domain.
+type InstallExternalDNS struct {
+	k8s.Kubernetes
+	// Image of external-dns, DefaultImage if not set.
+	Image string `json:"image"`
+	// Provider with the name of the DNS provider: azure, aws, google or coredns.
+	Provider string `json:"provider"`
+	// Domain with the management domain whose records are managed.
+	Domain string `json:"domain"`
+	// OwnerID identifying the records created by this cluster, usually the cluster identifier.
+	OwnerID string `json:"owner_id"`
+	// Policy with the synchronization policy, UpsertOnlyPolicy if not set.
+	Policy string `json:"policy"`
+	// Interval between synchronizations, DefaultInterval if not set.
+	Interval string `json:"interval"`
+	// Sources with the kinds of objects whose records are published, DefaultSources if not set.
+	Sources []string `json:"sources"`
+	// ProviderConfig with the provider configuration and credentials.
+	ProviderConfig map[string]string `json:"provider_config"`
+	// ProviderConfigPath with a JSON or YAML file with the provider configuration. Its values are overridden by
+	// the ones in ProviderConfig.
+	ProviderConfigPath string `json:"provider_config_path"`
+}
+
+// NewInstallExternalDNS creates a new InstallExternalDNS command.
+func NewInstallExternalDNS(kubeConfigPath string, provider string, domain string, ownerID string, providerConfig map[string]string) *InstallExternalDNS {
+	return &InstallExternalDNS{
+		Kubernetes: k8s.Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.InstallExternalDNS),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Image:          DefaultImage,
+		Provider:       provider,
+		Domain:         domain,
+		OwnerID:        ownerID,
+		Policy:         UpsertOnlyPolicy,
+		Interval:       DefaultInterval,
+		Sources:        DefaultSources,
+		ProviderConfig: providerConfig,
+	}
+}
+
+// NewInstallExternalDNSFromJSON creates a new InstallExternalDNS command from a raw JSON representation.
+func NewInstallExternalDNSFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	ied := &InstallExternalDNS{}
+	if err := json.Unmarshal(raw, &ied); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	if ied.Image == "" {
+		ied.Image = DefaultImage
+	}
+	if ied.Policy == "" {
+		ied.Policy = UpsertOnlyPolicy
+	}
+	if ied.Interval == "" {
+		ied.Interval = DefaultInterval
+	}
+	if len(ied.Sources) == 0 {
+		ied.Sources = DefaultSources
+	}
+	ied.CommandID = entities.GenerateCommandID(ied.Name())
+	var r entities.Command = ied
+	return &r, nil
+}
+
+// LoadProviderConfig returns the provider configuration merging the configuration file and the inline values.
+func (ied *InstallExternalDNS) LoadProviderConfig() (map[string]string, derrors.Error) {
+	result := make(map[string]string)
+	if ied.ProviderConfigPath != "" {
+		content, err := ioutil.ReadFile(ied.ProviderConfigPath)
+		if err != nil {
+			return nil, derrors.NewInvalidArgumentError("cannot read DNS provider configuration", err).WithParams(ied.ProviderConfigPath)
+		}
+		if err := yaml.Unmarshal(content, &result); err != nil {
+			return nil, derrors.NewInvalidArgumentError("cannot parse DNS provider configuration", err).WithParams(ied.ProviderConfigPath)
+		}
+	}
+	for k, v := range ied.ProviderConfig {
+		result[k] = v
+	}
+	return result, nil
+}
+
+// Validate checks the attributes of the command and builds the provider settings.
+func (ied *InstallExternalDNS) Validate() (*ProviderSettings, derrors.Error) {
+	if ied.Domain == "" || ied.OwnerID == "" {
+		return nil, derrors.NewInvalidArgumentError("domain and owner_id must be set")
+	}
+	if ied.Policy != UpsertOnlyPolicy && ied.Policy != SyncPolicy {
+		return nil, derrors.NewInvalidArgumentError("unsupported DNS synchronization policy").WithParams(ied.Policy)
+	}
+	config, err := ied.LoadProviderConfig()
+	if err != nil {
+		return nil, err
+	}
+	return NewProviderSettings(ied.Provider, config)
+}
+
+// Objects returns the objects required to run external-dns.
+func (ied *InstallExternalDNS) Objects(settings *ProviderSettings) []runtime.Object {
+	args := Args(ied.Provider, ied.Domain, ied.OwnerID, ied.Policy, ied.Interval, ied.Sources, settings)
+	return []runtime.Object{
+		NewServiceAccount(),
+		NewClusterRole(),
+		NewClusterRoleBinding(),
+		NewCredentialsSecret(settings),
+		NewDeployment(ied.Image, args, settings),
+	}
+}
+
+// Run the current command returning the result or an error.
+func (ied *InstallExternalDNS) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	settings, err := ied.Validate()
+	if err != nil {
+		return entities.NewCommandResult(false, "invalid external DNS configuration", err), nil
+	}
+	connectErr := ied.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	if err := ied.EnsureNamespace(Namespace, k8s.NamespaceOptions{}); err != nil {
+		return entities.NewCommandResult(false, "cannot create namespace", err), nil
+	}
+	objects := ied.Objects(settings)
+	// The role objects are kept, while the credentials and the deployment are replaced so a new provider
+	// configuration is applied on later installs.
+	for _, obj := range objects[:3] {
+		if err := ied.createIfNotExists(obj); err != nil {
+			return entities.NewCommandResult(false, "cannot create external DNS role", err), nil
+		}
+	}
+	if err := ied.replace(objects[3], "", "v1", "secrets", CredentialsSecret); err != nil {
+		return entities.NewCommandResult(false, "cannot create external DNS credentials", err), nil
+	}
+	if err := ied.replace(objects[4], "apps", "v1", "deployments", Name); err != nil {
+		return entities.NewCommandResult(false, "cannot create external DNS deployment", err), nil
+	}
+	msg := fmt.Sprintf("external DNS publishing records of %s on %s", ied.Domain, ied.Provider)
+	return entities.NewSuccessCommand([]byte(msg)), nil
+}
+
+// createIfNotExists creates one of the role objects unless it already exists.
+func (ied *InstallExternalDNS) createIfNotExists(obj runtime.Object) derrors.Error {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	objMeta, mErr := meta.Accessor(obj)
+	if mErr != nil {
+		return derrors.NewInternalError("cannot access object metadata", mErr)
+	}
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	exists, err := ied.ExistsEntity(objMeta.GetNamespace(), gvk.Group, gvk.Version, plural.Resource, objMeta.GetName())
+	if err != nil {
+		return err
+	}
+	if exists {
+		log.Info().Str("kind", gvk.Kind).Str("name", objMeta.GetName()).Msg("external DNS object already exists, skipping")
+		return nil
+	}
+	return ied.Create(obj)
+}
+
+// replace creates an object removing the previous one if it exists.
+func (ied *InstallExternalDNS) replace(obj runtime.Object, group string, version string, resource string, name string) derrors.Error {
+	exists, err := ied.ExistsEntity(Namespace, group, version, resource, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		log.Debug().Str("resource", resource).Str("name", name).Msg("replacing external DNS object")
+		if err := ied.DeleteEntity(Namespace, group, version, resource, name); err != nil {
+			return err
+		}
+	}
+	return ied.Create(obj)
+}
+
+// String returns a string representation
+func (ied *InstallExternalDNS) String() string {
+	return fmt.Sprintf("SYNC InstallExternalDNS %s on %s", ied.Domain, ied.Provider)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (ied *InstallExternalDNS) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + ied.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (ied *InstallExternalDNS) UserString() string {
+	return fmt.Sprintf("Installing external DNS for %s", ied.Domain)
+}
@@ -0,0 +1,30 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package k8s
+
+import (
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// newFakeCluster creates a fake cluster and registers its clients so the commands using its KubeConfigPath run
+// against it. UnregisterClients must be called once the test finishes.
+func newFakeCluster(objects ...runtime.Object) *k8stest.FakeCluster {
+	cluster := k8stest.NewFakeCluster(objects...)
+	RegisterClients(cluster.KubeConfigPath, cluster.Client, cluster.Discovery, cluster.Dynamic)
+	return cluster
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the feature flags set at install time. The flags are stored on a ConfigMap of each platform
+// namespace and exposed as environment variables to the containers of the Deployments that request them.
+
+package k8s
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// FeatureFlagsConfigMap is the name of the ConfigMap with the feature flags of the install.
+const FeatureFlagsConfigMap = "feature-flags"
+
+// FeatureFlagsAnnotation is the annotation of a Deployment with a comma separated list of the feature flags exposed
+// to its containers, or * for all the flags of the install.
+const FeatureFlagsAnnotation = "installer.nalej.com/feature-flags"
+
+// FeatureFlagsHashAnnotation is the annotation of the pod template of a Deployment with the hash of the flags exposed
+// to it, so changing their values rolls out the pods.
+const FeatureFlagsHashAnnotation = "installer.nalej.com/feature-flags-hash"
+
+// FeatureFlagEnvPrefix is the prefix of the environment variables with the feature flags.
+const FeatureFlagEnvPrefix = "FEATURE_"
+
+// envNameRegex matches the characters not allowed in the name of an environment variable.
+var envNameRegex = regexp.MustCompile("[^A-Z0-9_]")
+
+// FeatureFlagEnvName returns the name of the environment variable of a feature flag, such as FEATURE_NEW_UI for
+// new-ui.
+func FeatureFlagEnvName(flag string) string {
+	return FeatureFlagEnvPrefix + envNameRegex.ReplaceAllString(strings.ToUpper(flag), "_")
+}
+
+// ValidateFeatureFlags checks that the names of the feature flags can be stored on a ConfigMap.
+func ValidateFeatureFlags(flags map[string]string) derrors.Error {
+	for name := range flags {
+		if errs := validation.IsConfigMapKey(name); len(errs) > 0 {
+			return derrors.NewInvalidArgumentError("invalid feature flag name").WithParams(name, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// featureFlagsConfigMap returns the ConfigMap with the feature flags of a namespace.
+func featureFlagsConfigMap(namespace string, flags map[string]string) *v1.ConfigMap {
+	data := make(map[string]string, len(flags))
+	for name, value := range flags {
+		data[name] = value
+	}
+	return &v1.ConfigMap{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      FeatureFlagsConfigMap,
+			Namespace: namespace,
+		},
+		Data: data,
+	}
+}
+
+// requestedFeatureFlags returns the sorted names of the feature flags requested by a Deployment.
+func requestedFeatureFlags(annotation string, flags map[string]string) []string {
+	requested := make([]string, 0)
+	for _, name := range strings.Split(annotation, ",") {
+		name = strings.TrimSpace(name)
+		if name == "*" {
+			for flag := range flags {
+				requested = append(requested, flag)
+			}
+		} else if name != "" {
+			requested = append(requested, name)
+		}
+	}
+	sort.Strings(requested)
+	result := make([]string, 0, len(requested))
+	for i, name := range requested {
+		if i == 0 || requested[i-1] != name {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// InjectFeatureFlags adds the feature flags requested by a Deployment through FeatureFlagsAnnotation as environment
+// variables of its containers. The variables reference the feature flags ConfigMap, so flags not set in the install
+// are left undefined.
+//   params:
+//     obj The Deployment, of any of the supported API versions.
+//     flags The feature flags of the install.
+//   returns:
+//     Whether the Deployment has been modified.
+//     An error if its containers cannot be read.
+func InjectFeatureFlags(obj *unstructured.Unstructured, flags map[string]string) (bool, derrors.Error) {
+	if obj.GetKind() != "Deployment" {
+		return false, nil
+	}
+	annotation, requests := obj.GetAnnotations()[FeatureFlagsAnnotation]
+	if !requests {
+		return false, nil
+	}
+	requested := requestedFeatureFlags(annotation, flags)
+	if len(requested) == 0 {
+		return false, nil
+	}
+	containers, found, err := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+	if err != nil || !found {
+		return false, derrors.NewInvalidArgumentError("cannot read the containers of the deployment", err).WithParams(obj.GetName())
+	}
+	hash := sha256.New()
+	for _, name := range requested {
+		hash.Write([]byte(name + "=" + flags[name] + "\n"))
+	}
+	for i, raw := range containers {
+		container, ok := raw.(map[string]interface{})
+		if !ok {
+			return false, derrors.NewInvalidArgumentError("invalid container of the deployment").WithParams(obj.GetName())
+		}
+		env, _, _ := unstructured.NestedSlice(container, "env")
+		for _, name := range requested {
+			env = setEnvVar(env, map[string]interface{}{
+				"name": FeatureFlagEnvName(name),
+				"valueFrom": map[string]interface{}{
+					"configMapKeyRef": map[string]interface{}{
+						"name":     FeatureFlagsConfigMap,
+						"key":      name,
+						"optional": true,
+					},
+				},
+			})
+		}
+		container["env"] = env
+		containers[i] = container
+	}
+	if err := unstructured.SetNestedSlice(obj.Object, containers, "spec", "template", "spec", "containers"); err != nil {
+		return false, derrors.NewInternalError("cannot set the containers of the deployment", err)
+	}
+	podAnnotations, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "template", "metadata", "annotations")
+	if podAnnotations == nil {
+		podAnnotations = make(map[string]string, 0)
+	}
+	podAnnotations[FeatureFlagsHashAnnotation] = hex.EncodeToString(hash.Sum(nil))
+	if err := unstructured.SetNestedStringMap(obj.Object, podAnnotations, "spec", "template", "metadata", "annotations"); err != nil {
+		return false, derrors.NewInternalError("cannot set the pod annotations of the deployment", err)
+	}
+	return true, nil
+}
+
+// setEnvVar replaces the variable of the same name in a list of environment variables, or appends it.
+func setEnvVar(env []interface{}, variable map[string]interface{}) []interface{} {
+	for i, raw := range env {
+		if existing, ok := raw.(map[string]interface{}); ok && existing["name"] == variable["name"] {
+			env[i] = variable
+			return env
+		}
+	}
+	return append(env, variable)
+}
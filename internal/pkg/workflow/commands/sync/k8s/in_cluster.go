@@ -0,0 +1,66 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/nalej/derrors"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// inClusterName is the name of the cluster, user and context of the in-cluster kubeconfig.
+const inClusterName = "in-cluster"
+
+// InClusterKubeConfig builds a kubeconfig that uses the service account of the pod where the installer is running.
+// The token file is referenced instead of copied so that rotated tokens are picked up.
+//   returns:
+//     The content of the kubeconfig.
+//     An error if the installer is not running inside a cluster.
+func InClusterKubeConfig() ([]byte, derrors.Error) {
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, derrors.NewFailedPreconditionError("installer is not running inside a cluster", err)
+	}
+	return buildInClusterKubeConfig(restConfig)
+}
+
+// buildInClusterKubeConfig transforms an in-cluster rest configuration into a kubeconfig.
+func buildInClusterKubeConfig(restConfig *rest.Config) ([]byte, derrors.Error) {
+	config := clientcmdapi.NewConfig()
+	config.Clusters[inClusterName] = &clientcmdapi.Cluster{
+		Server:               restConfig.Host,
+		CertificateAuthority: restConfig.TLSClientConfig.CAFile,
+	}
+	config.AuthInfos[inClusterName] = &clientcmdapi.AuthInfo{
+		TokenFile: restConfig.BearerTokenFile,
+	}
+	if restConfig.BearerTokenFile == "" {
+		config.AuthInfos[inClusterName].Token = restConfig.BearerToken
+	}
+	config.Contexts[inClusterName] = &clientcmdapi.Context{
+		Cluster:  inClusterName,
+		AuthInfo: inClusterName,
+	}
+	config.CurrentContext = inClusterName
+	content, err := clientcmd.Write(*config)
+	if err != nil {
+		return nil, derrors.NewInternalError("cannot write kubeconfig", err)
+	}
+	return content, nil
+}
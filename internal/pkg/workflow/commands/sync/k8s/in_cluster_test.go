@@ -0,0 +1,44 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var _ = ginkgo.Describe("In-cluster kubeconfig", func() {
+
+	ginkgo.It("should reference the service account files", func() {
+		restConfig := &rest.Config{
+			Host:            "https://10.0.0.1:443",
+			BearerTokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token",
+			TLSClientConfig: rest.TLSClientConfig{CAFile: "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"},
+		}
+		content, err := buildInClusterKubeConfig(restConfig)
+		gomega.Expect(err).To(gomega.Succeed())
+		config, lErr := clientcmd.Load(content)
+		gomega.Expect(lErr).To(gomega.Succeed())
+		gomega.Expect(config.CurrentContext).Should(gomega.Equal(inClusterName))
+		gomega.Expect(config.Clusters[inClusterName].Server).Should(gomega.Equal(restConfig.Host))
+		gomega.Expect(config.Clusters[inClusterName].CertificateAuthority).Should(gomega.Equal(restConfig.TLSClientConfig.CAFile))
+		gomega.Expect(config.AuthInfos[inClusterName].TokenFile).Should(gomega.Equal(restConfig.BearerTokenFile))
+	})
+})
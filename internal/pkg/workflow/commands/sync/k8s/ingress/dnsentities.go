@@ -18,149 +18,97 @@
 package ingress
 
 import (
+	"github.com/nalej/grpc-installer-go"
 	"k8s.io/api/core/v1"
-	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
-var AzureDNSPort = v1.ServicePort{
-	Name:     "dns-udp",
-	Protocol: v1.ProtocolUDP,
-	Port:     53,
-	TargetPort: intstr.IntOrString{
-		Type:   intstr.String,
-		StrVal: "dns-udp",
-	},
+// DNSUDPPort is the port used to resolve DNS queries.
+var DNSUDPPort = v1.ServicePort{
+	Name:       "dns-udp",
+	Protocol:   v1.ProtocolUDP,
+	Port:       53,
+	TargetPort: intstr.FromString("dns-udp"),
 }
 
-var MinikubeDNSUDPPort = v1.ServicePort{
-	Name:     "dns-udp",
-	Protocol: v1.ProtocolUDP,
-	Port:     53,
-	TargetPort: intstr.IntOrString{
-		Type:   intstr.String,
-		StrVal: "dns-udp",
-	},
-	NodePort: 53,
+// DNSTCPPort is the port used to resolve DNS queries over TCP.
+var DNSTCPPort = v1.ServicePort{
+	Name:       "dns-tcp",
+	Protocol:   v1.ProtocolTCP,
+	Port:       53,
+	TargetPort: intstr.FromString("dns-tcp"),
 }
 
-var MinikubeDNSTCPPort = v1.ServicePort{
-	Name:     "dns-tcp",
-	Protocol: v1.ProtocolTCP,
-	Port:     53,
-	TargetPort: intstr.IntOrString{
-		StrVal: "dns-tcp",
-		Type:   intstr.String,
-	},
-	NodePort: 53,
+// ConsulUIPort is the port of the consul web interface.
+var ConsulUIPort = v1.ServicePort{
+	Name:       "consul-gui",
+	Protocol:   v1.ProtocolTCP,
+	Port:       8500,
+	TargetPort: intstr.FromString("consul-gui"),
 }
 
-var MinikubeDNSUIPort = v1.ServicePort{
-	Name:     "consul-gui",
-	Protocol: v1.ProtocolTCP,
-	Port:     8500,
-	TargetPort: intstr.IntOrString{
-		Type:   intstr.String,
-		StrVal: "consul-gui",
-	},
-	NodePort: 30500,
+// minikubeConsulUINodePort is the node port where the consul web interface is exposed on Minikube.
+const minikubeConsulUINodePort = 30500
+
+// dnsPorts returns the ports exposed by the DNS services. Minikube deployments also expose the TCP port and the
+// consul web interface to ease debugging.
+func dnsPorts(platformType string) []v1.ServicePort {
+	if platformType != grpc_installer_go.Platform_MINIKUBE.String() {
+		return []v1.ServicePort{DNSUDPPort}
+	}
+	ui := ConsulUIPort
+	ui.NodePort = minikubeConsulUINodePort
+	return []v1.ServicePort{withNodePort(DNSUDPPort), withNodePort(DNSTCPPort), ui}
 }
 
-var AzureConsulService = v1.Service{
-	TypeMeta: metaV1.TypeMeta{
-		Kind:       "Service",
-		APIVersion: "v1",
-	},
-	ObjectMeta: metaV1.ObjectMeta{
-		Name:      "dns-server-consul-dns",
-		Namespace: "nalej",
-		Labels: map[string]string{
-			"cluster":   "management",
-			"component": "dns-server",
-			"release":   "dns-server",
-			"app":       "consul",
-		},
-	},
-	Spec: v1.ServiceSpec{
-		Ports: []v1.ServicePort{AzureDNSPort},
-		Selector: map[string]string{
-			"app":     "consul",
-			"hasDNS":  "true",
-			"release": "dns-server",
-		},
-		Type: v1.ServiceTypeLoadBalancer,
-	},
+// withNodePort returns a copy of the port exposed on the same port of the nodes.
+func withNodePort(port v1.ServicePort) v1.ServicePort {
+	port.NodePort = port.Port
+	return port
 }
 
-var MinikubeConsulService = v1.Service{
-	TypeMeta: metaV1.TypeMeta{
-		Kind:       "Service",
-		APIVersion: "v1",
-	},
-	ObjectMeta: metaV1.ObjectMeta{
-		Name:      "dns-server-consul-dns",
-		Namespace: "nalej",
+// MngtDNSExposure returns the configuration of the management DNS service.
+func MngtDNSExposure(platformType string) ServiceExposure {
+	return ServiceExposure{
+		ServiceName: "dns-server-consul-dns",
+		Namespace:   "nalej",
 		Labels: map[string]string{
 			"cluster":   "management",
 			"component": "dns-server",
 			"release":   "dns-server",
 			"app":       "consul",
 		},
-	},
-	Spec: v1.ServiceSpec{
-		Ports: []v1.ServicePort{MinikubeDNSUDPPort, MinikubeDNSTCPPort, MinikubeDNSUIPort},
 		Selector: map[string]string{
 			"app":     "consul",
 			"hasDNS":  "true",
 			"release": "dns-server",
 		},
-		Type: v1.ServiceTypeNodePort,
-	},
+		Ports: dnsPorts(platformType),
+	}
 }
 
-var AzureExtDnsService = v1.Service{
-	TypeMeta: metaV1.TypeMeta{
-		Kind:       "Service",
-		APIVersion: "v1",
-	},
-	ObjectMeta: metaV1.ObjectMeta{
-		Name:      "coredns",
-		Namespace: "nalej",
+// ExtDNSExposure returns the configuration of the external DNS service.
+func ExtDNSExposure(platformType string) ServiceExposure {
+	exposure := ServiceExposure{
+		ServiceName: "coredns",
+		Namespace:   "nalej",
 		Labels: map[string]string{
 			"cluster":   "management",
 			"component": "external-dns",
 		},
-	},
-	Spec: v1.ServiceSpec{
-		Ports: []v1.ServicePort{AzureDNSPort},
 		Selector: map[string]string{
 			"cluster":   "management",
 			"component": "external-dns",
 		},
-		Type: v1.ServiceTypeLoadBalancer,
-	},
-}
-
-var MinikubeExtDnsService = v1.Service{
-	TypeMeta: metaV1.TypeMeta{
-		Kind:       "Service",
-		APIVersion: "v1",
-	},
-	ObjectMeta: metaV1.ObjectMeta{
-		Name:      "coredns",
-		Namespace: "nalej",
-		Labels: map[string]string{
-			"cluster":   "management",
-			"component": "external-dns",
-		},
-	},
-	Spec: v1.ServiceSpec{
-		Ports: []v1.ServicePort{MinikubeDNSUDPPort, MinikubeDNSTCPPort, MinikubeDNSUIPort},
-		Selector: map[string]string{
+		Ports: dnsPorts(platformType),
+	}
+	if platformType == grpc_installer_go.Platform_MINIKUBE.String() {
+		// Minikube deployments resolve external entries through consul.
+		exposure.Selector = map[string]string{
 			"app":     "consul",
 			"hasDNS":  "true",
 			"release": "dns-server",
-		},
-		Type: v1.ServiceTypeNodePort,
-	},
+		}
+	}
+	return exposure
 }
@@ -0,0 +1,314 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingress
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+)
+
+// Well known annotations that may be set on exposed services.
+const (
+	// AzureInternalLoadBalancerAnnotation requests a load balancer only reachable from the virtual network.
+	AzureInternalLoadBalancerAnnotation = "service.beta.kubernetes.io/azure-load-balancer-internal"
+	// AzureDNSLabelAnnotation sets the DNS label of the public IP of the load balancer.
+	AzureDNSLabelAnnotation = "service.beta.kubernetes.io/azure-dns-label-name"
+	// AzureLoadBalancerResourceGroupAnnotation sets the resource group where the static IP lives.
+	AzureLoadBalancerResourceGroupAnnotation = "service.beta.kubernetes.io/azure-load-balancer-resource-group"
+	// AWSLoadBalancerTypeAnnotation selects the type of load balancer, "nlb" for a network load balancer.
+	AWSLoadBalancerTypeAnnotation = "service.beta.kubernetes.io/aws-load-balancer-type"
+	// AWSInternalLoadBalancerAnnotation requests an internal load balancer.
+	AWSInternalLoadBalancerAnnotation = "service.beta.kubernetes.io/aws-load-balancer-internal"
+)
+
+// ServiceExposure contains the configuration describing how a service is exposed.
+type ServiceExposure struct {
+	// ServiceName with the name of the service.
+	ServiceName string `json:"service_name"`
+	// Namespace where the service is created.
+	Namespace string `json:"namespace"`
+	// Labels of the service.
+	Labels map[string]string `json:"labels"`
+	// Selector of the pods backing the service.
+	Selector map[string]string `json:"selector"`
+	// Ports exposed by the service.
+	Ports []v1.ServicePort `json:"ports"`
+	// ServiceType with the type of service: LoadBalancer, NodePort or ClusterIP. If empty, the default type
+	// of the platform is used.
+	ServiceType string `json:"service_type"`
+	// Annotations of the service such as the ones requesting internal or network load balancers.
+	Annotations map[string]string `json:"annotations"`
+	// UseStaticIp determines if the load balancer must use StaticIpAddress.
+	UseStaticIp bool `json:"use_static_ip"`
+	// StaticIpAddress with the IP address of the load balancer.
+	StaticIpAddress string `json:"static_ip_address"`
+	// ExternalTrafficPolicy of the service: Local or Cluster.
+	ExternalTrafficPolicy string `json:"external_traffic_policy"`
+	// IPFamilies of the service, IPv4 and/or IPv6 with the primary one first. If empty, the family of the static
+	// IP address is used, and the default of the cluster otherwise.
+	IPFamilies []string `json:"ip_families"`
+	// IPFamilyPolicy of the service: SingleStack, PreferDualStack or RequireDualStack.
+	IPFamilyPolicy string `json:"ip_family_policy"`
+}
+
+// ServiceOverrides contains the configurable aspects of the services created by the platform specific commands.
+type ServiceOverrides struct {
+	// ServiceType replacing the default type of the platform.
+	ServiceType string `json:"service_type"`
+	// Annotations added to the service.
+	Annotations map[string]string `json:"annotations"`
+	// IPFamilies of the service replacing the ones of the static IP address.
+	IPFamilies []string `json:"ip_families"`
+	// IPFamilyPolicy of the service.
+	IPFamilyPolicy string `json:"ip_family_policy"`
+}
+
+// apply updates an exposure with the configured overrides.
+func (so *ServiceOverrides) apply(exposure *ServiceExposure) {
+	if so.ServiceType != "" {
+		exposure.ServiceType = so.ServiceType
+	}
+	if len(so.Annotations) > 0 {
+		exposure.Annotations = so.Annotations
+	}
+	if len(so.IPFamilies) > 0 {
+		exposure.IPFamilies = so.IPFamilies
+	}
+	if so.IPFamilyPolicy != "" {
+		exposure.IPFamilyPolicy = so.IPFamilyPolicy
+	}
+}
+
+// DefaultServiceType returns the type of service used to expose services on a given platform.
+//   params:
+//     platformType The target platform.
+//   returns:
+//     The service type.
+//     An error if the platform is not supported.
+func DefaultServiceType(platformType string) (v1.ServiceType, derrors.Error) {
+	switch platformType {
+	case grpc_installer_go.Platform_AZURE.String():
+		return v1.ServiceTypeLoadBalancer, nil
+	case grpc_installer_go.Platform_BAREMETAL.String():
+		// The baremetal type relies on MetalLB so it supports loadbalancers as in Azure.
+		return v1.ServiceTypeLoadBalancer, nil
+	case grpc_installer_go.Platform_MINIKUBE.String():
+		return v1.ServiceTypeNodePort, nil
+	}
+	if k8s.IsOpenShift(platformType) {
+		// OpenShift provides load balancers on the cloud providers and with MetalLB on bare metal.
+		return v1.ServiceTypeLoadBalancer, nil
+	}
+	return "", derrors.NewInvalidArgumentError("unsupported platform type").WithParams(platformType)
+}
+
+// Service builds the service described by the exposure.
+//   params:
+//     platformType The target platform used to determine the service type if not set.
+//   returns:
+//     The service.
+//     An error if the configuration is not valid.
+func (se *ServiceExposure) Service(platformType string) (*v1.Service, derrors.Error) {
+	if se.ServiceName == "" || se.Namespace == "" {
+		return nil, derrors.NewInvalidArgumentError("service_name and namespace must be set")
+	}
+	if len(se.Ports) == 0 {
+		return nil, derrors.NewInvalidArgumentError("at least one port must be exposed").WithParams(se.ServiceName)
+	}
+	serviceType := v1.ServiceType(se.ServiceType)
+	if serviceType == "" {
+		defaultType, err := DefaultServiceType(platformType)
+		if err != nil {
+			return nil, err
+		}
+		serviceType = defaultType
+	}
+	if serviceType != v1.ServiceTypeLoadBalancer && serviceType != v1.ServiceTypeNodePort && serviceType != v1.ServiceTypeClusterIP {
+		return nil, derrors.NewInvalidArgumentError("unsupported service type").WithParams(se.ServiceName, se.ServiceType)
+	}
+
+	ports := make([]v1.ServicePort, 0, len(se.Ports))
+	for _, port := range se.Ports {
+		if serviceType == v1.ServiceTypeClusterIP {
+			// Node ports are not allowed on internal services.
+			port.NodePort = 0
+		}
+		ports = append(ports, port)
+	}
+
+	service := &v1.Service{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        se.ServiceName,
+			Namespace:   se.Namespace,
+			Labels:      copyMap(se.Labels),
+			Annotations: copyMap(se.Annotations),
+		},
+		Spec: v1.ServiceSpec{
+			Ports:    ports,
+			Selector: copyMap(se.Selector),
+			Type:     serviceType,
+		},
+	}
+
+	if se.ExternalTrafficPolicy != "" {
+		policy := v1.ServiceExternalTrafficPolicyType(se.ExternalTrafficPolicy)
+		if policy != v1.ServiceExternalTrafficPolicyTypeLocal && policy != v1.ServiceExternalTrafficPolicyTypeCluster {
+			return nil, derrors.NewInvalidArgumentError("unsupported external traffic policy").WithParams(se.ServiceName, se.ExternalTrafficPolicy)
+		}
+		if serviceType != v1.ServiceTypeClusterIP {
+			service.Spec.ExternalTrafficPolicy = policy
+		}
+	}
+
+	if _, _, err := se.Families(); err != nil {
+		return nil, err
+	}
+
+	if se.UseStaticIp {
+		if se.StaticIpAddress == "" {
+			return nil, derrors.NewInvalidArgumentError("static_ip_address must be set to use a static IP").WithParams(se.ServiceName)
+		}
+		if serviceType == v1.ServiceTypeLoadBalancer {
+			service.Spec.LoadBalancerIP = se.StaticIpAddress
+		} else {
+			log.Warn().Str("service", se.ServiceName).Str("type", string(serviceType)).
+				Msg("static IP ignored as the service is not a load balancer")
+		}
+	}
+	return service, nil
+}
+
+// Families returns the IP families and the policy of the service, derived from the static IP address if they are not
+// set.
+//   returns:
+//     The IP families and policy, empty to use the default of the cluster.
+//     An error if the families or the static IP address are not valid.
+func (se *ServiceExposure) Families() ([]string, string, derrors.Error) {
+	address := ""
+	if se.UseStaticIp {
+		address = se.StaticIpAddress
+	}
+	families, policy, err := k8s.ServiceIPFamilies(se.IPFamilies, se.IPFamilyPolicy, address)
+	if err != nil {
+		return nil, "", err.WithParams(se.ServiceName)
+	}
+	return families, policy, nil
+}
+
+// copyMap returns a copy of a map so that built services do not share state with the configuration.
+func copyMap(source map[string]string) map[string]string {
+	if source == nil {
+		return nil
+	}
+	result := make(map[string]string, len(source))
+	for k, v := range source {
+		result[k] = v
+	}
+	return result
+}
+
+// exposeService creates the service described by an exposure.
+//   params:
+//     k The connected kubernetes command.
+//     exposure The service configuration.
+//     platformType The target platform.
+//   returns:
+//     The command result.
+func exposeService(k *k8s.Kubernetes, exposure ServiceExposure, platformType string) *entities.CommandResult {
+	service, err := exposure.Service(platformType)
+	if err != nil {
+		log.Warn().Str("trace", err.DebugReport()).Msg("invalid service configuration")
+		return entities.NewCommandResult(false, "invalid service configuration", err)
+	}
+	families, policy, err := exposure.Families()
+	if err != nil {
+		return entities.NewCommandResult(false, "invalid service configuration", err)
+	}
+	obj, err := k.ServiceWithIPFamilies(service, families, policy)
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot install service", err)
+	}
+	err = k.Create(obj)
+	if err != nil {
+		log.Error().Str("trace", err.DebugReport()).Str("service", exposure.ServiceName).Msg("error creating service")
+		return entities.NewCommandResult(false, "cannot install service", err)
+	}
+	msg := fmt.Sprintf("service %s exposed as %s on %s", service.Name, service.Spec.Type, platformType)
+	return entities.NewSuccessCommand([]byte(msg))
+}
+
+// ExposeService command creates a service whose type, annotations and address come from the configuration.
+type ExposeService struct {
+	k8s.Kubernetes
+	ServiceExposure
+	PlatformType string `json:"platform_type"`
+}
+
+func NewExposeService(kubeConfigPath string, platformType string, exposure ServiceExposure) *ExposeService {
+	return &ExposeService{
+		Kubernetes: k8s.Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.ExposeService),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		ServiceExposure: exposure,
+		PlatformType:    platformType,
+	}
+}
+
+func NewExposeServiceFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	es := &ExposeService{}
+	if err := json.Unmarshal(raw, &es); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	es.CommandID = entities.GenerateCommandID(es.Name())
+	var r entities.Command = es
+	return &r, nil
+}
+
+func (es *ExposeService) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := es.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	return exposeService(&es.Kubernetes, es.ServiceExposure, es.PlatformType), nil
+}
+
+func (es *ExposeService) String() string {
+	return fmt.Sprintf("SYNC ExposeService %s/%s type: %s on %s", es.Namespace, es.ServiceName, es.ServiceType, es.PlatformType)
+}
+
+func (es *ExposeService) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + es.String()
+}
+
+func (es *ExposeService) UserString() string {
+	return fmt.Sprintf("Exposing service %s", es.ServiceName)
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingress
+
+import (
+	"encoding/json"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+)
+
+var _ = ginkgo.Describe("Service exposure", func() {
+
+	azure := grpc_installer_go.Platform_AZURE.String()
+	minikube := grpc_installer_go.Platform_MINIKUBE.String()
+
+	ginkgo.It("should use the default type of the platform", func() {
+		exposure := VPNServerExposure(azure)
+		service, err := exposure.Service(azure)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(service.Spec.Type).Should(gomega.Equal(v1.ServiceTypeLoadBalancer))
+		gomega.Expect(service.Spec.ExternalTrafficPolicy).Should(gomega.Equal(v1.ServiceExternalTrafficPolicyTypeLocal))
+		gomega.Expect(service.Spec.Ports[0].NodePort).Should(gomega.BeZero())
+
+		exposure = VPNServerExposure(minikube)
+		service, err = exposure.Service(minikube)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(service.Spec.Type).Should(gomega.Equal(v1.ServiceTypeNodePort))
+		gomega.Expect(service.Spec.Ports[0].NodePort).Should(gomega.Equal(int32(5555)))
+	})
+
+	ginkgo.It("should fail on unsupported platforms unless the type is set", func() {
+		exposure := MngtDNSExposure("UNKNOWN")
+		_, err := exposure.Service("UNKNOWN")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+
+		exposure.ServiceType = string(v1.ServiceTypeClusterIP)
+		service, err := exposure.Service("UNKNOWN")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(service.Spec.Type).Should(gomega.Equal(v1.ServiceTypeClusterIP))
+	})
+
+	ginkgo.It("should apply annotations, type and static IP overrides", func() {
+		exposure := ExtDNSExposure(azure)
+		exposure.UseStaticIp = true
+		exposure.StaticIpAddress = "10.0.0.10"
+		overrides := ServiceOverrides{
+			ServiceType: string(v1.ServiceTypeLoadBalancer),
+			Annotations: map[string]string{AzureInternalLoadBalancerAnnotation: "true"},
+		}
+		overrides.apply(&exposure)
+		service, err := exposure.Service(azure)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(service.Spec.LoadBalancerIP).Should(gomega.Equal("10.0.0.10"))
+		gomega.Expect(service.Annotations).Should(gomega.HaveKeyWithValue(AzureInternalLoadBalancerAnnotation, "true"))
+
+		// Modifying the service must not change the configuration.
+		service.Annotations["other"] = "value"
+		gomega.Expect(exposure.Annotations).ShouldNot(gomega.HaveKey("other"))
+	})
+
+	ginkgo.It("should use the family of an IPv6 static IP unless the families are overridden", func() {
+		exposure := MngtDNSExposure(azure)
+		exposure.UseStaticIp = true
+		exposure.StaticIpAddress = "fd00::53"
+		service, err := exposure.Service(azure)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(service.Spec.LoadBalancerIP).Should(gomega.Equal("fd00::53"))
+		families, policy, err := exposure.Families()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(families).Should(gomega.Equal([]string{k8s.IPv6Family}))
+		gomega.Expect(policy).Should(gomega.Equal(k8s.SingleStackPolicy))
+
+		overrides := ServiceOverrides{IPFamilies: []string{k8s.IPv6Family, k8s.IPv4Family}, IPFamilyPolicy: k8s.PreferDualStackPolicy}
+		overrides.apply(&exposure)
+		families, policy, err = exposure.Families()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(families).Should(gomega.Equal([]string{k8s.IPv6Family, k8s.IPv4Family}))
+		gomega.Expect(policy).Should(gomega.Equal(k8s.PreferDualStackPolicy))
+	})
+
+	ginkgo.It("should ignore the static IP on non load balancer services", func() {
+		exposure := ZTPlanetExposure(minikube, true)
+		exposure.UseStaticIp = true
+		exposure.StaticIpAddress = "10.0.0.10"
+		service, err := exposure.Service(minikube)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(service.Spec.LoadBalancerIP).Should(gomega.BeEmpty())
+		gomega.Expect(service.Spec.Selector).Should(gomega.HaveKeyWithValue("component", StandaloneZTPlanetComponent))
+	})
+
+	ginkgo.It("should remove node ports from internal services", func() {
+		exposure := MngtDNSExposure(minikube)
+		gomega.Expect(exposure.Ports).Should(gomega.HaveLen(3))
+		exposure.ServiceType = string(v1.ServiceTypeClusterIP)
+		service, err := exposure.Service(minikube)
+		gomega.Expect(err).To(gomega.Succeed())
+		for _, port := range service.Spec.Ports {
+			gomega.Expect(port.NodePort).Should(gomega.BeZero())
+		}
+		gomega.Expect(exposure.Ports[0].NodePort).Should(gomega.Equal(int32(53)))
+	})
+
+	ginkgo.It("should reject invalid configurations", func() {
+		invalid := []ServiceExposure{
+			{Namespace: "nalej", Ports: []v1.ServicePort{VPNServerPort}},
+			{ServiceName: "svc", Namespace: "nalej"},
+			{ServiceName: "svc", Namespace: "nalej", Ports: []v1.ServicePort{VPNServerPort}, ServiceType: "ExternalName"},
+			{ServiceName: "svc", Namespace: "nalej", Ports: []v1.ServicePort{VPNServerPort}, ExternalTrafficPolicy: "Remote"},
+			{ServiceName: "svc", Namespace: "nalej", Ports: []v1.ServicePort{VPNServerPort}, UseStaticIp: true},
+			{ServiceName: "svc", Namespace: "nalej", Ports: []v1.ServicePort{VPNServerPort}, UseStaticIp: true, StaticIpAddress: "10.0.0"},
+			{ServiceName: "svc", Namespace: "nalej", Ports: []v1.ServicePort{VPNServerPort}, IPFamilies: []string{"IPv5"}},
+		}
+		for _, exposure := range invalid {
+			_, err := exposure.Service(azure)
+			gomega.Expect(err).ShouldNot(gomega.Succeed())
+		}
+	})
+
+	ginkgo.It("should read the command from JSON", func() {
+		raw := []byte(`{"type":"sync", "name":"exposeService", "kubeConfigPath":"/tmp/kc", "platform_type":"AZURE",
+			"service_name":"api", "namespace":"nalej", "service_type":"LoadBalancer",
+			"annotations":{"service.beta.kubernetes.io/aws-load-balancer-type":"nlb"},
+			"selector":{"component":"api"},
+			"ports":[{"name":"https", "protocol":"TCP", "port":443, "targetPort":"https"}]}`)
+		cmd, err := NewExposeServiceFromJSON(raw)
+		gomega.Expect(err).To(gomega.Succeed())
+		es, ok := (*cmd).(*ExposeService)
+		gomega.Expect(ok).Should(gomega.BeTrue())
+		gomega.Expect(es.KubeConfigPath).Should(gomega.Equal("/tmp/kc"))
+		service, err := es.Service(es.PlatformType)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(service.Annotations).Should(gomega.HaveKeyWithValue(AWSLoadBalancerTypeAnnotation, "nlb"))
+		gomega.Expect(service.Spec.Ports[0].TargetPort.StrVal).Should(gomega.Equal("https"))
+
+		marshalled, mErr := json.Marshal(es)
+		gomega.Expect(mErr).To(gomega.Succeed())
+		gomega.Expect(string(marshalled)).Should(gomega.ContainSubstring(`"service_type":"LoadBalancer"`))
+	})
+})
@@ -23,15 +23,14 @@ import (
 	"strings"
 
 	"github.com/nalej/derrors"
-	"github.com/nalej/grpc-installer-go"
 	"github.com/nalej/installer/internal/pkg/errors"
 	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
 	"github.com/nalej/installer/internal/pkg/workflow/entities"
-	"github.com/rs/zerolog/log"
 )
 
 type InstallExtDNS struct {
 	k8s.Kubernetes
+	ServiceOverrides
 	PlatformType    string `json:"platform_type"`
 	UseStaticIp     bool   `json:"use_static_ip"`
 	StaticIpAddress string `json:"static_ip_address"`
@@ -64,44 +63,11 @@ func (imd *InstallExtDNS) Run(workflowID string) (*entities.CommandResult, derro
 	if connectErr != nil {
 		return nil, connectErr
 	}
-
-	switch imd.PlatformType {
-	case grpc_installer_go.Platform_AZURE.String():
-		return imd.InstallAzure(workflowID)
-	case grpc_installer_go.Platform_BAREMETAL.String():
-		// The baremetal type relies on MetalLB so it supports loadbalancers as in Azure.
-		return imd.InstallAzure(workflowID)
-	case grpc_installer_go.Platform_MINIKUBE.String():
-		return imd.InstallMinikube(workflowID)
-	}
-	log.Warn().Str("platformType", imd.PlatformType).Msg("unsupported platform type")
-	return entities.NewCommandResult(
-		false, "unsupported platform type", nil), nil
-}
-
-func (imd *InstallExtDNS) InstallAzure(workflowID string) (*entities.CommandResult, derrors.Error) {
-	azureService := AzureExtDnsService
-	if imd.UseStaticIp {
-		azureService.Spec.LoadBalancerIP = imd.StaticIpAddress
-	}
-	err := imd.Create(&azureService)
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating External DNS service")
-		return entities.NewCommandResult(
-			false, "cannot install service", err), nil
-	}
-	msg := fmt.Sprintf("External DNS loadbalancer installed on %s", imd.PlatformType)
-	return entities.NewSuccessCommand([]byte(msg)), nil
-}
-
-func (imd *InstallExtDNS) InstallMinikube(workflowID string) (*entities.CommandResult, derrors.Error) {
-	err := imd.Create(&MinikubeExtDnsService)
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating External DNS service")
-		return entities.NewCommandResult(
-			false, "cannot install service", err), nil
-	}
-	return entities.NewSuccessCommand([]byte("External DNS loadbalancer installed on Minikube")), nil
+	exposure := ExtDNSExposure(imd.PlatformType)
+	exposure.UseStaticIp = imd.UseStaticIp
+	exposure.StaticIpAddress = imd.StaticIpAddress
+	imd.apply(&exposure)
+	return exposeService(&imd.Kubernetes, exposure, imd.PlatformType), nil
 }
 
 func (imd *InstallExtDNS) String() string {
@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"github.com/nalej/grpc-installer-go"
 	"strings"
+	"time"
 
 	"github.com/nalej/derrors"
 	"github.com/nalej/installer/internal/pkg/errors"
@@ -34,6 +35,9 @@ import (
 	"k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 
 )
 
@@ -46,6 +50,9 @@ type InstallIngress struct {
 	UseStaticIP          bool   `json:"use_static_ip"`
 	StaticIPAddress      string `json:"static_ip_address"`
 	NetworkMode          string `json:"network_mode"`
+	// Controller serving the ingresses: nginx, traefik or istio. If not set, the Istio gateway is used on the
+	// management clusters with the istio networking mode, and NGINX otherwise.
+	Controller string `json:"ingress_controller"`
 }
 
 func NewInstallIngress(kubeConfigPath string, platformType string, managementPublicHost string, useStaticIP bool,
@@ -124,19 +131,40 @@ func (ii *InstallIngress) getIngressRules() []*v1beta1.Ingress {
 		&ingress, &login, &signup, &api, &cluster, &device, &deviceLogin, &eicApi, &monitoringApi,
 	}
 
-	// Adapt ingresses to istio requirements.
-	if ii.NetworkMode == "istio" {
-		for index, _ := range toReturn {
-			// the ingress class must be Istio
-			toReturn[index].ObjectMeta.Annotations["kubernetes.io/ingress.class"]="istio"
-			// Tls definition must be empty
-			toReturn[index].Spec.TLS = []v1beta1.IngressTLS{}
-		}
-	}
+	return toReturn
 
+}
 
-	return toReturn
+// controller returns the controller serving the ingresses. The application clusters use NGINX unless other
+// controller is requested.
+func (ii *InstallIngress) controller() string {
+	if k8s.IsOpenShift(ii.PlatformType) {
+		return k8s.OpenShiftRouter
+	}
+	if !ii.OnManagementCluster && ii.Controller == "" {
+		return k8s.NginxController
+	}
+	return k8s.IngressControllerFor(ii.Controller, ii.NetworkMode)
+}
 
+// adaptIngresses returns a copy of the ingresses with the class and annotations of the controller.
+func (ii *InstallIngress) adaptIngresses(ingresses []*v1beta1.Ingress) ([]*v1beta1.Ingress, derrors.Error) {
+	controller := ii.controller()
+	result := make([]*v1beta1.Ingress, 0, len(ingresses))
+	for _, ingress := range ingresses {
+		adapted := ingress.DeepCopy()
+		annotations, err := k8s.IngressAnnotations(controller, ingress.Annotations)
+		if err != nil {
+			return nil, derrors.AsError(err, "cannot adapt ingress").WithParams(ingress.Name)
+		}
+		adapted.Annotations = annotations
+		if !k8s.IngressKeepsTLS(controller) {
+			// The TLS termination is done by the Istio gateway.
+			adapted.Spec.TLS = []v1beta1.IngressTLS{}
+		}
+		result = append(result, adapted)
+	}
+	return result, nil
 }
 
 func (ii *InstallIngress) getService(installType grpc_installer_go.Platform) (*v1.Service, *v1.Service) {
@@ -152,13 +180,35 @@ func (ii *InstallIngress) getService(installType grpc_installer_go.Platform) (*v
 	return &genericService, &CloudGenericServiceDefaultBackend
 }
 
-// GetExistingIngressOnNamespace checks if an ingress exists on a given namespace.
-func (ii *InstallIngress) GetExistingIngressOnNamespace(namespace string) (*v1beta1.Ingress, derrors.Error) {
-	client := ii.Client.ExtensionsV1beta1().Ingresses(namespace)
-	opts := metaV1.ListOptions{}
-	ingresses, err := client.List(opts)
+// withIPFamilies sets the IP family of the static IP address on the load balancer services, so IPv6 addresses can be
+// used on dual-stack clusters.
+func (ii *InstallIngress) withIPFamilies(obj runtime.Object) (runtime.Object, derrors.Error) {
+	service, ok := obj.(*v1.Service)
+	if !ok || service.Spec.LoadBalancerIP == "" {
+		return obj, nil
+	}
+	families, policy, err := k8s.ServiceIPFamilies(nil, "", service.Spec.LoadBalancerIP)
+	if err != nil {
+		return nil, err
+	}
+	return ii.ServiceWithIPFamilies(service, families, policy)
+}
+
+// GetExistingIngressOnNamespace checks if an ingress exists on a given namespace. The ingresses are retrieved using
+// the group version served by the cluster.
+func (ii *InstallIngress) GetExistingIngressOnNamespace(namespace string) (*unstructured.Unstructured, derrors.Error) {
+	capabilities, err := ii.Capabilities()
 	if err != nil {
-		return nil, derrors.NewInternalError("cannot retrieve ingresses", err)
+		return nil, err
+	}
+	groupVersion, err := capabilities.PreferredGroupVersion("Ingress", IngressRules.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	gv := schema.FromAPIVersionAndKind(groupVersion, "Ingress")
+	ingresses, err := ii.ListEntities(namespace, gv.Group, gv.Version, "ingresses")
+	if err != nil {
+		return nil, derrors.NewInternalError("cannot retrieve ingresses").CausedBy(err)
 	}
 	if len(ingresses.Items) > 0 {
 		return &ingresses.Items[0], nil
@@ -167,7 +217,7 @@ func (ii *InstallIngress) GetExistingIngressOnNamespace(namespace string) (*v1be
 }
 
 // GetExistingIngress retrieves an ingress if it exists on the system.
-func (ii *InstallIngress) GetExistingIngress() (*v1beta1.Ingress, derrors.Error) {
+func (ii *InstallIngress) GetExistingIngress() (*unstructured.Unstructured, derrors.Error) {
 	opts := metaV1.ListOptions{}
 	namespaces, err := ii.Client.CoreV1().Namespaces().List(opts)
 	if err != nil {
@@ -193,153 +243,175 @@ func (ii *InstallIngress) triggerInstall(installType grpc_installer_go.Platform)
 }
 
 // Trigger the installation of the ingress infrastructure for the application clusters.
-// TODO NP-946 Refactor the trigger method to extract common entities.
 func (ii *InstallIngress) triggerAppClusterInstall(installType grpc_installer_go.Platform) derrors.Error {
-	err := ii.CreateNamespaceIfNotExists("nalej")
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating nalej namespace")
-		return err
-	}
-
-	log.Debug().Msg("Installing ingress service account")
-	err = ii.Create(&IngressServiceAccount)
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating ingress service account")
-		return err
-	}
-
-	log.Debug().Msg("Installing ingress cluster role")
-	err = ii.Create(&IngressClusterRole)
+	err := ii.installControllerSupport(installType)
 	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating ingress cluster role")
+		log.Error().Str("trace", err.DebugReport()).Msg("error installing ingress controller")
 		return err
 	}
+	return ii.createIngressRules(ii.getAppClusterIngressRules())
+}
 
-	log.Debug().Msg("Installing ingress role")
-	err = ii.Create(&IngressRole)
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating ingress role")
-		return err
-	}
+// Trigger the installation of the ingress infrastructure for the management cluster.
+func (ii *InstallIngress) triggerManagementInstall(installType grpc_installer_go.Platform) derrors.Error {
 
-	log.Debug().Msg("Installing ingress role binding")
-	err = ii.Create(&IngressRoleBinding)
+	err := ii.installControllerSupport(installType)
 	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating ingress role binding")
+		log.Error().Str("trace", err.DebugReport()).Msg("error installing ingress controller")
 		return err
 	}
+	return ii.createIngressRules(ii.getIngressRules())
+}
 
-	log.Debug().Msg("Installing ingress cluster role binding")
-	err = ii.Create(&IngressClusterRoleBinding)
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating ingress cluster role binding")
-		return err
+// installControllerSupport installs the entities of the chosen controller. Istio has its own supporting entities
+// installed with the control plane.
+func (ii *InstallIngress) installControllerSupport(installType grpc_installer_go.Platform) derrors.Error {
+	switch ii.controller() {
+	case k8s.NginxController:
+		return ii.installNginxSupport(installType)
+	case k8s.TraefikController:
+		return ii.installTraefikSupport(installType)
 	}
+	return nil
+}
 
-	log.Debug().Msg("Installing ingress load balancer configmap")
-	err = ii.Create(&IngressLoadBalancerConfigMap)
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating ingress load balancer configmap")
-		return err
-	}
+// CustomResourceTimeout is the time to wait for the custom resource definitions of the controller to be served.
+const CustomResourceTimeout = time.Minute
 
-	log.Debug().Msg("Installing ingress TCP configmap")
-	err = ii.Create(&IngressTCPServiceConfigMap)
+// createIngressRules creates the ingresses of the platform adapted to the chosen controller.
+func (ii *InstallIngress) createIngressRules(ingresses []*v1beta1.Ingress) derrors.Error {
+	adapted, err := ii.adaptIngresses(ingresses)
 	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating ingress TCP configmap")
 		return err
 	}
-
-	log.Debug().Msg("Installing ingress UDP configmap")
-	err = ii.Create(&IngressUDPServiceConfigMap)
+	support, err := ii.ingressSupport(ingresses)
 	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating ingress UDP configmap")
 		return err
 	}
-
-	log.Debug().Msg("Installing ingress service")
-	ingressBackend, defaultBackend := ii.getService(installType)
-
-	err = ii.Create(ingressBackend)
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating ingress service")
-		return err
-	}
-	err = ii.Create(defaultBackend)
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating ingress default service")
-		return err
+	for _, obj := range support {
+		err = ii.createCustomResource(obj)
+		if err != nil {
+			log.Error().Str("trace", err.DebugReport()).Str("name", obj.GetName()).
+				Msg("error creating ingress supporting entity")
+			return err
+		}
 	}
-
-	log.Debug().Msg("Installing app cluster ingress rules")
-	for _, ingressToInstall := range ii.getAppClusterIngressRules() {
+	log.Debug().Str("controller", ii.controller()).Msg("Installing ingress rules")
+	for _, ingressToInstall := range adapted {
 		err = ii.Create(ingressToInstall)
 		if err != nil {
-			log.Error().Str("trace", err.DebugReport()).Str("name", ingressToInstall.Name).Msg("error creating ingress rules")
+			log.Error().Str("trace", err.DebugReport()).Str("name", ingressToInstall.Name).
+				Msg("error creating ingress rules")
 			return err
 		}
 	}
+	return nil
+}
 
-	var ingressDeployment = IngressDeployment
-
-	if installType == grpc_installer_go.Platform_MINIKUBE {
-		log.Debug().Msg("Adding extra arguments and ports for Minikube dev install")
-		// args - --report-node-internal-ip-address
-		args := ingressDeployment.Spec.Template.Spec.Containers[0].Args
-		args = append(args, "--report-node-internal-ip-address")
-		ingressDeployment.Spec.Template.Spec.Containers[0].Args = args
-		statusPort := v1.ContainerPort{
-			Name:          "stats", // on /nginx-status
-			HostPort:      18080,
-			ContainerPort: 18080,
+// createRoutes creates the Routes of OpenShift serving the ingresses of the platform. If any of them verifies the
+// client certificates, the router must be configured to verify them.
+func (ii *InstallIngress) createRoutes() derrors.Error {
+	ingresses := ii.getAppClusterIngressRules()
+	if ii.OnManagementCluster {
+		ingresses = ii.getIngressRules()
+	}
+	routerChecked := false
+	for _, ingress := range ingresses {
+		verifies, err := k8s.IngressVerifiesClients(ingress.Annotations)
+		if err != nil {
+			return derrors.AsError(err, "cannot adapt ingress").WithParams(ingress.Name)
+		}
+		if verifies && !routerChecked {
+			if err := ii.CheckRouterClientTLS(); err != nil {
+				return err
+			}
+			routerChecked = true
+		}
+		content, cErr := runtime.DefaultUnstructuredConverter.ToUnstructured(ingress)
+		if cErr != nil {
+			return derrors.NewInternalError("cannot convert ingress to unstructured", cErr).WithParams(ingress.Name)
+		}
+		routes, err := k8s.IngressRoutes(&unstructured.Unstructured{Object: content}, ii.LookupService)
+		if err != nil {
+			return err
+		}
+		for _, route := range routes {
+			if err := ii.Create(route); err != nil {
+				log.Error().Str("trace", err.DebugReport()).Str("name", route.GetName()).Msg("error creating route")
+				return err
+			}
 		}
-		ports := ingressDeployment.Spec.Template.Spec.Containers[0].Ports
-		ports = append(ports, statusPort)
-		ingressDeployment.Spec.Template.Spec.Containers[0].Ports = ports
 	}
+	return nil
+}
 
-	log.Debug().Msg("installing ingress deployment")
-	err = ii.Create(&ingressDeployment)
+// installTraefikSupport installs the entities required to run Traefik as the ingress controller.
+func (ii *InstallIngress) installTraefikSupport(installType grpc_installer_go.Platform) derrors.Error {
+	log.Debug().Msg("Installing Traefik required entities")
+	err := ii.EnsureNamespace("nalej", k8s.NamespaceOptions{})
 	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating ingress deployment")
+		log.Error().Str("trace", err.DebugReport()).Msg("error creating nalej namespace")
 		return err
 	}
-	log.Debug().Msg("installing default ingress backend")
-	err = ii.Create(&IngressDefaultBackend)
+	objects := append(TraefikCustomResourceDefinitions(), TraefikObjects(installType, ii.UseStaticIP, ii.StaticIPAddress)...)
+	for _, obj := range objects {
+		obj, err = ii.withIPFamilies(obj)
+		if err != nil {
+			log.Error().Str("trace", err.DebugReport()).Msg("invalid ingress static IP address")
+			return err
+		}
+		err = ii.Create(obj)
+		if err != nil {
+			log.Error().Str("trace", err.DebugReport()).Str("kind", obj.GetObjectKind().GroupVersionKind().Kind).
+				Msg("error creating Traefik entity")
+			return err
+		}
+	}
+	err = ii.createCustomResource(k8s.NewTraefikPassCertMiddleware())
 	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating ingress backend")
+		log.Error().Str("trace", err.DebugReport()).Msg("error creating Traefik middleware")
 		return err
 	}
-
 	return nil
 }
 
-// Trigger the installation of the ingress infrastructure for the management cluster.
-func (ii *InstallIngress) triggerManagementInstall(installType grpc_installer_go.Platform) derrors.Error {
-
-	var err derrors.Error
-
-	// Istio has its own supporting entities. When run, Nginx has to be installed.
-	if ii.NetworkMode != "istio" {
-		err = ii.installNginxSupport(installType)
+// ingressSupport returns the entities required by the ingresses on the chosen controller, such as the TLS options
+// verifying the client certificates on Traefik.
+func (ii *InstallIngress) ingressSupport(ingresses []*v1beta1.Ingress) ([]*unstructured.Unstructured, derrors.Error) {
+	controller := ii.controller()
+	result := make([]*unstructured.Unstructured, 0)
+	added := make(map[string]bool, 0)
+	for _, ingress := range ingresses {
+		required, err := k8s.IngressSupport(controller, ingress.Annotations)
 		if err != nil {
-			log.Error().Str("trace", err.DebugReport()).Msg("error installing supporting Nginx entities")
-			return err
+			return nil, derrors.AsError(err, "cannot adapt ingress").WithParams(ingress.Name)
+		}
+		for _, obj := range required {
+			key := obj.GetKind() + "/" + obj.GetNamespace() + "/" + obj.GetName()
+			if !added[key] {
+				added[key] = true
+				result = append(result, obj)
+			}
 		}
 	}
+	return result, nil
+}
 
-
-	log.Debug().Msg("Installing ingress rules")
-	for _, ingressToInstall := range ii.getIngressRules() {
-		err = ii.Create(ingressToInstall)
-		if err != nil {
-			log.Error().Str("trace", err.DebugReport()).Str("name", ingressToInstall.Name).
-				Msg("error creating ingress rules")
+// createCustomResource creates an object of a custom resource of the controller. The definitions are created in the
+// same install, so the creation is retried until they are served.
+func (ii *InstallIngress) createCustomResource(obj *unstructured.Unstructured) derrors.Error {
+	deadline := time.Now().Add(CustomResourceTimeout)
+	for {
+		err := ii.Create(obj)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
 			return err
 		}
+		log.Debug().Str("kind", obj.GetKind()).Str("name", obj.GetName()).Msg("waiting for custom resource to be served")
+		time.Sleep(k8s.DefaultWaitInterval)
 	}
-
-	return nil
 }
 
 // This is a private function to install all the elements required to support an Nginx server as the chosen
@@ -347,7 +419,7 @@ func (ii *InstallIngress) triggerManagementInstall(installType grpc_installer_go
 func (ii *InstallIngress) installNginxSupport(installType grpc_installer_go.Platform) derrors.Error {
 	log.Debug().Msg("Installing Nginx required entities")
 
-	err := ii.CreateNamespaceIfNotExists("nalej")
+	err := ii.EnsureNamespace("nalej", k8s.NamespaceOptions{})
 	if err != nil {
 		log.Error().Str("trace", err.DebugReport()).Msg("error creating nalej namespace")
 		return err
@@ -412,7 +484,12 @@ func (ii *InstallIngress) installNginxSupport(installType grpc_installer_go.Plat
 	log.Debug().Msg("Installing ingress service")
 	ingressBackend, defaultBackend := ii.getService(installType)
 
-	err = ii.Create(ingressBackend)
+	ingressService, err := ii.withIPFamilies(ingressBackend)
+	if err != nil {
+		log.Error().Str("trace", err.DebugReport()).Msg("invalid ingress static IP address")
+		return err
+	}
+	err = ii.Create(ingressService)
 	if err != nil {
 		log.Error().Str("trace", err.DebugReport()).Msg("error creating ingress service")
 		return err
@@ -458,6 +535,9 @@ func (ii *InstallIngress) installNginxSupport(installType grpc_installer_go.Plat
 }
 
 func (ii *InstallIngress) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	if err := k8s.ValidateIngressController(ii.controller()); err != nil {
+		return entities.NewCommandResult(false, "invalid ingress controller", err), nil
+	}
 	connectErr := ii.Connect()
 	if connectErr != nil {
 		return nil, connectErr
@@ -468,10 +548,15 @@ func (ii *InstallIngress) Run(workflowID string) (*entities.CommandResult, derro
 		return nil, err
 	}
 	if existingIngress != nil {
-		log.Warn().Interface("ingress", existingIngress).Msg("An ingress has been found")
+		log.Warn().Str("name", existingIngress.GetName()).Str("namespace", existingIngress.GetNamespace()).
+			Str("apiVersion", existingIngress.GetAPIVersion()).Msg("An ingress has been found")
 		return entities.NewSuccessCommand([]byte("[WARN] Ingress has not been installed as it already exists")), nil
 	}
 
+	if k8s.IsOpenShift(ii.PlatformType) {
+		// The routers of OpenShift serve the ingresses, so only their Routes are created.
+		err = ii.createRoutes()
+	}
 	switch ii.PlatformType {
 	case grpc_installer_go.Platform_AZURE.String():
 		err = ii.triggerInstall(grpc_installer_go.Platform_AZURE)
@@ -495,7 +580,7 @@ func (ii *InstallIngress) Run(workflowID string) (*entities.CommandResult, derro
 
 
 func (ii *InstallIngress) String() string {
-	return fmt.Sprintf("SYNC InstallIngress on Management: %t", ii.OnManagementCluster)
+	return fmt.Sprintf("SYNC InstallIngress on Management: %t with %s", ii.OnManagementCluster, ii.controller())
 }
 
 func (ii *InstallIngress) PrettyPrint(indentation int) string {
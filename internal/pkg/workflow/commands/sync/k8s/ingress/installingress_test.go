@@ -0,0 +1,119 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingress
+
+import (
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = ginkgo.Describe("An ingress install", func() {
+
+	var cluster *k8stest.FakeCluster
+	azure := grpc_installer_go.Platform_AZURE.String()
+
+	ginkgo.BeforeEach(func() {
+		cluster = k8stest.NewFakeCluster()
+		k8s.RegisterClients(cluster.KubeConfigPath, cluster.Client, cluster.Discovery, cluster.Dynamic)
+	})
+
+	ginkgo.AfterEach(func() {
+		k8s.UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	ingressClass := func(name string) string {
+		ingress := cluster.ExpectObject("extensions/v1beta1", "Ingress", "nalej", name)
+		return ingress.GetAnnotations()[k8s.IngressClassAnnotation]
+	}
+
+	ginkgo.It("should select the controller of the cluster", func() {
+		management := NewInstallIngress(cluster.KubeConfigPath, azure, "nalej.tech", false, "", "istio")
+		management.OnManagementCluster = true
+		gomega.Expect(management.controller()).Should(gomega.Equal(k8s.IstioController))
+		appCluster := NewInstallIngress(cluster.KubeConfigPath, azure, "nalej.tech", false, "", "istio")
+		gomega.Expect(appCluster.controller()).Should(gomega.Equal(k8s.NginxController))
+		appCluster.Controller = k8s.TraefikController
+		gomega.Expect(appCluster.controller()).Should(gomega.Equal(k8s.TraefikController))
+	})
+
+	ginkgo.It("should leave the TLS termination to the Istio gateway", func() {
+		cmd := NewInstallIngress(cluster.KubeConfigPath, azure, "nalej.tech", false, "", "istio")
+		cmd.OnManagementCluster = true
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(ingressClass("ingress-nginx")).Should(gomega.Equal(k8s.IstioController))
+		ingress := cluster.ExpectObject("extensions/v1beta1", "Ingress", "nalej", "ingress-nginx")
+		tls, _, _ := unstructured.NestedSlice(ingress.Object, "spec", "tls")
+		gomega.Expect(tls).Should(gomega.BeEmpty())
+		cluster.ExpectNoObject("apps/v1", "Deployment", "kube-system", "nginx-ingress-controller")
+		// The templates of the ingresses are not modified.
+		gomega.Expect(IngressRules.Annotations).Should(gomega.HaveKeyWithValue(k8s.IngressClassAnnotation, k8s.NginxController))
+	})
+
+	ginkgo.Context("with Traefik", func() {
+
+		ginkgo.BeforeEach(func() {
+			cluster.AddResource(k8stest.Resource{GroupVersion: "traefik.containo.us/v1alpha1", Name: "middlewares", Kind: "Middleware", Namespaced: true})
+			cluster.AddResource(k8stest.Resource{GroupVersion: "traefik.containo.us/v1alpha1", Name: "tlsoptions", Kind: "TLSOption", Namespaced: true})
+		})
+
+		ginkgo.It("should install Traefik on application clusters", func() {
+			cmd := NewInstallIngress(cluster.KubeConfigPath, azure, "nalej.tech", true, "10.0.0.1", "zt")
+			cmd.Controller = k8s.TraefikController
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			cluster.ExpectObject("apps/v1", "Deployment", "kube-system", TraefikName)
+			cluster.ExpectObject("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "", "tlsoptions.traefik.containo.us")
+			service := cluster.ExpectObject("v1", "Service", "kube-system", TraefikName)
+			gomega.Expect(service.Object["spec"]).Should(gomega.HaveKeyWithValue("loadBalancerIP", "10.0.0.1"))
+			cluster.ExpectNoObject("apps/v1", "Deployment", "kube-system", "nginx-ingress-controller")
+			gomega.Expect(ingressClass(AppClusterAPIIngressRules.Name)).Should(gomega.Equal(k8s.TraefikController))
+		})
+
+		ginkgo.It("should verify the client certificates with TLS options", func() {
+			cmd := NewInstallIngress(cluster.KubeConfigPath, azure, "nalej.tech", false, "", "zt")
+			cmd.OnManagementCluster = true
+			cmd.Controller = k8s.TraefikController
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			option := cluster.ExpectObject("traefik.containo.us/v1alpha1", "TLSOption", "nalej", "ca-certificate")
+			authType, _, _ := unstructured.NestedString(option.Object, "spec", "clientAuth", "clientAuthType")
+			gomega.Expect(authType).Should(gomega.Equal("RequireAndVerifyClientCert"))
+			cluster.ExpectObject("traefik.containo.us/v1alpha1", "Middleware", "kube-system", k8s.TraefikPassCertMiddleware)
+			ingress := cluster.ExpectObject("extensions/v1beta1", "Ingress", "nalej", ClusterAPIIngressRules.Name)
+			gomega.Expect(ingress.GetAnnotations()).Should(gomega.HaveKeyWithValue(
+				"traefik.ingress.kubernetes.io/router.tls.options", "nalej-ca-certificate@kubernetescrd"))
+			gomega.Expect(ingress.GetAnnotations()).Should(gomega.HaveKeyWithValue(k8s.BackendSchemeAnnotation, "h2c"))
+		})
+	})
+
+	ginkgo.It("should reject unsupported controllers", func() {
+		cmd := NewInstallIngress(cluster.KubeConfigPath, azure, "nalej.tech", false, "", "zt")
+		cmd.Controller = "haproxy"
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+	})
+})
@@ -23,15 +23,14 @@ import (
 	"strings"
 
 	"github.com/nalej/derrors"
-	"github.com/nalej/grpc-installer-go"
 	"github.com/nalej/installer/internal/pkg/errors"
 	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
 	"github.com/nalej/installer/internal/pkg/workflow/entities"
-	"github.com/rs/zerolog/log"
 )
 
 type InstallMngtDNS struct {
 	k8s.Kubernetes
+	ServiceOverrides
 	PlatformType    string `json:"platform_type"`
 	UseStaticIp     bool   `json:"use_static_ip"`
 	StaticIpAddress string `json:"static_ip_address"`
@@ -64,44 +63,11 @@ func (imd *InstallMngtDNS) Run(workflowID string) (*entities.CommandResult, derr
 	if connectErr != nil {
 		return nil, connectErr
 	}
-
-	switch imd.PlatformType {
-	case grpc_installer_go.Platform_AZURE.String():
-		return imd.InstallLoadBalancer(workflowID)
-	case grpc_installer_go.Platform_BAREMETAL.String():
-		// The baremetal type relies on MetalLB so it supports loadbalancers as in Azure.
-		return imd.InstallLoadBalancer(workflowID)
-	case grpc_installer_go.Platform_MINIKUBE.String():
-		return imd.InstallMinikube(workflowID)
-	}
-	log.Warn().Str("platformType", imd.PlatformType).Msg("unsupported platform type")
-	return entities.NewCommandResult(
-		false, "unsupported platform type", nil), nil
-}
-
-func (imd *InstallMngtDNS) InstallLoadBalancer(workflowID string) (*entities.CommandResult, derrors.Error) {
-	azureService := AzureConsulService
-	if imd.UseStaticIp {
-		azureService.Spec.LoadBalancerIP = imd.StaticIpAddress
-	}
-	err := imd.Create(&azureService)
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating DNS service")
-		return entities.NewCommandResult(
-			false, "cannot install service", err), nil
-	}
-	msg := fmt.Sprintf("DNS loadbalancer installed on %s", imd.PlatformType)
-	return entities.NewSuccessCommand([]byte(msg)), nil
-}
-
-func (imd *InstallMngtDNS) InstallMinikube(workflowID string) (*entities.CommandResult, derrors.Error) {
-	err := imd.Create(&MinikubeConsulService)
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating DNS service")
-		return entities.NewCommandResult(
-			false, "cannot install service", err), nil
-	}
-	return entities.NewSuccessCommand([]byte("DNS loadbalancer installed on Minikube")), nil
+	exposure := MngtDNSExposure(imd.PlatformType)
+	exposure.UseStaticIp = imd.UseStaticIp
+	exposure.StaticIpAddress = imd.StaticIpAddress
+	imd.apply(&exposure)
+	return exposeService(&imd.Kubernetes, exposure, imd.PlatformType), nil
 }
 
 func (imd *InstallMngtDNS) String() string {
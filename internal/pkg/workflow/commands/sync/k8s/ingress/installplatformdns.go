@@ -0,0 +1,176 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingress
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// InstallPlatformDNS command installs the DNS service answering the queries of the application clusters, serving
+// the zone of the management domain and exposed with the static DNS address.
+type InstallPlatformDNS struct {
+	k8s.Kubernetes
+	ServiceOverrides
+	PlatformType    string `json:"platform_type"`
+	UseStaticIp     bool   `json:"use_static_ip"`
+	StaticIpAddress string `json:"static_ip_address"`
+	// Domain with the management domain served by the zone.
+	Domain string `json:"domain"`
+	// PublicHost where the DNS service is published, used as the name server of the zone.
+	PublicHost string `json:"public_host"`
+	// Records with the IP address of the additional records of the zone indexed by their name relative to the
+	// domain.
+	Records map[string]string `json:"records"`
+	// Upstream with the address receiving the queries outside of the zone. If not set, the consul DNS of the
+	// platform is used when it exists, and the resolvers of the cluster otherwise.
+	Upstream string `json:"upstream"`
+	// Image of CoreDNS, DefaultPlatformDNSImage if not set.
+	Image string `json:"image"`
+}
+
+// NewInstallPlatformDNS creates a new InstallPlatformDNS command.
+func NewInstallPlatformDNS(kubeConfigPath string, platformType string, domain string, publicHost string, useStaticIp bool, staticIpAddress string) *InstallPlatformDNS {
+	return &InstallPlatformDNS{
+		Kubernetes: k8s.Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.InstallPlatformDNS),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		PlatformType:    platformType,
+		UseStaticIp:     useStaticIp,
+		StaticIpAddress: staticIpAddress,
+		Domain:          domain,
+		PublicHost:      publicHost,
+		Image:           DefaultPlatformDNSImage,
+	}
+}
+
+// NewInstallPlatformDNSFromJSON creates a new InstallPlatformDNS command from a raw JSON representation.
+func NewInstallPlatformDNSFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	ipd := &InstallPlatformDNS{}
+	if err := json.Unmarshal(raw, &ipd); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	if ipd.Image == "" {
+		ipd.Image = DefaultPlatformDNSImage
+	}
+	ipd.CommandID = entities.GenerateCommandID(ipd.Name())
+	var r entities.Command = ipd
+	return &r, nil
+}
+
+// upstream returns the address receiving the queries outside of the zone.
+func (ipd *InstallPlatformDNS) upstream() (string, derrors.Error) {
+	if ipd.Upstream != "" {
+		return ipd.Upstream, nil
+	}
+	service, err := ipd.Client.CoreV1().Services("nalej").Get(ConsulDNSService, metaV1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return "/etc/resolv.conf", nil
+		}
+		return "", k8s.AsQueryError(err, "cannot retrieve consul DNS service", ConsulDNSService)
+	}
+	if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == "None" {
+		return "/etc/resolv.conf", nil
+	}
+	return service.Spec.ClusterIP, nil
+}
+
+// Objects returns the objects of the platform DNS.
+//   params:
+//     upstream The address receiving the queries outside of the zone.
+//   returns:
+//     The objects to be applied.
+//     An error if the zone or the service are not valid.
+func (ipd *InstallPlatformDNS) Objects(upstream string) ([]runtime.Object, derrors.Error) {
+	if err := ValidateZone(ipd.Domain, ipd.Records); err != nil {
+		return nil, err
+	}
+	exposure := PlatformDNSExposure(ipd.PlatformType)
+	exposure.UseStaticIp = ipd.UseStaticIp
+	exposure.StaticIpAddress = ipd.StaticIpAddress
+	ipd.apply(&exposure)
+	service, err := exposure.Service(ipd.PlatformType)
+	if err != nil {
+		return nil, err
+	}
+	families, policy, err := exposure.Families()
+	if err != nil {
+		return nil, err
+	}
+	serviceObj, err := ipd.ServiceWithIPFamilies(service, families, policy)
+	if err != nil {
+		return nil, err
+	}
+	address := ""
+	if ipd.UseStaticIp {
+		address = ipd.StaticIpAddress
+	}
+	zone := ZoneFile(ipd.Domain, ipd.PublicHost, address, ipd.Records)
+	return []runtime.Object{
+		NewPlatformDNSConfigMap(ipd.Domain, Corefile(ipd.Domain, upstream), zone),
+		NewPlatformDNSDeployment(ipd.Image),
+		serviceObj,
+	}, nil
+}
+
+// Run the current command returning the result or an error.
+func (ipd *InstallPlatformDNS) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := ipd.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	upstream, err := ipd.upstream()
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot determine the upstream DNS", err), nil
+	}
+	objects, err := ipd.Objects(upstream)
+	if err != nil {
+		return entities.NewCommandResult(false, "invalid platform DNS configuration", err), nil
+	}
+	summary := &k8s.ApplySummary{}
+	for _, obj := range objects {
+		if err := ipd.Apply(obj, k8s.ApplyOptions{}, summary); err != nil {
+			return entities.NewCommandResult(false, "cannot apply platform DNS object", err), nil
+		}
+	}
+	msg := fmt.Sprintf("platform DNS serving %s and forwarding to %s", ipd.Domain, upstream)
+	return entities.NewSuccessCommand([]byte(msg)).WithObjects(summary.Applied()), nil
+}
+
+func (ipd *InstallPlatformDNS) String() string {
+	return fmt.Sprintf("SYNC InstallPlatformDNS %s on %s", ipd.Domain, ipd.PlatformType)
+}
+
+func (ipd *InstallPlatformDNS) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + ipd.String()
+}
+
+func (ipd *InstallPlatformDNS) UserString() string {
+	return fmt.Sprintf("Installing platform DNS for %s", ipd.Domain)
+}
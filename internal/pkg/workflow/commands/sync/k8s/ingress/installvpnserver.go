@@ -21,16 +21,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/nalej/derrors"
-	"github.com/nalej/grpc-installer-go"
 	"github.com/nalej/installer/internal/pkg/errors"
 	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
 	"github.com/nalej/installer/internal/pkg/workflow/entities"
-	"github.com/rs/zerolog/log"
 	"strings"
 )
 
 type InstallVpnServerLB struct {
 	k8s.Kubernetes
+	ServiceOverrides
 	PlatformType    string `json:"platform_type"`
 	UseStaticIp     bool   `json:"use_static_ip"`
 	StaticIpAddress string `json:"static_ip_address"`
@@ -61,44 +60,11 @@ func (imd *InstallVpnServerLB) Run(workflowID string) (*entities.CommandResult,
 	if connectErr != nil {
 		return nil, connectErr
 	}
-
-	switch imd.PlatformType {
-	case grpc_installer_go.Platform_AZURE.String():
-		return imd.InstallLoadBalancer(workflowID)
-	case grpc_installer_go.Platform_BAREMETAL.String():
-		// Baremetal relies on Loadbalancers.
-		return imd.InstallLoadBalancer(workflowID)
-	case grpc_installer_go.Platform_MINIKUBE.String():
-		return imd.InstallMinikube(workflowID)
-	}
-	log.Warn().Str("platformType", imd.PlatformType).Msg("unsupported platform type")
-	return entities.NewCommandResult(
-		false, "unsupported platform type", nil), nil
-}
-
-func (imd *InstallVpnServerLB) InstallLoadBalancer(workflowID string) (*entities.CommandResult, derrors.Error) {
-	azureService := AzureVPNServerService
-	if imd.UseStaticIp {
-		azureService.Spec.LoadBalancerIP = imd.StaticIpAddress
-	}
-	err := imd.Create(&azureService)
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating VPN Server LB service")
-		return entities.NewCommandResult(
-			false, "cannot install service", err), nil
-	}
-	msg := fmt.Sprintf("VPN Server installed on %s", imd.PlatformType)
-	return entities.NewSuccessCommand([]byte(msg)), nil
-}
-
-func (imd *InstallVpnServerLB) InstallMinikube(workflowID string) (*entities.CommandResult, derrors.Error) {
-	err := imd.Create(&MinikubeVPNServerService)
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating  VPN Server LB service")
-		return entities.NewCommandResult(
-			false, "cannot install service", err), nil
-	}
-	return entities.NewSuccessCommand([]byte("VPN Server installed on Minikube")), nil
+	exposure := VPNServerExposure(imd.PlatformType)
+	exposure.UseStaticIp = imd.UseStaticIp
+	exposure.StaticIpAddress = imd.StaticIpAddress
+	imd.apply(&exposure)
+	return exposeService(&imd.Kubernetes, exposure, imd.PlatformType), nil
 }
 
 func (imd *InstallVpnServerLB) String() string {
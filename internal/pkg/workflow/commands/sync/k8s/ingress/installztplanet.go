@@ -21,18 +21,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/nalej/derrors"
-	"github.com/nalej/grpc-installer-go"
 	"github.com/nalej/installer/internal/pkg/errors"
 	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
 	"github.com/nalej/installer/internal/pkg/workflow/entities"
-	"github.com/rs/zerolog/log"
 	"strings"
 )
 
 // Deprecated: InstallZtPlanetLB should not be used as the platform will remove ZT support.
 type InstallZtPlanetLB struct {
 	k8s.Kubernetes
+	ServiceOverrides
 	PlatformType string `json:"platform_type"`
+	// Standalone indicates that the planet is served by the deployment created by the installZtPlanet command
+	// instead of the network manager.
+	Standalone bool `json:"standalone"`
 }
 
 // Deprecated: NewInstallZtPlanetLB should not be used as the platform will remove ZT support.
@@ -61,41 +63,9 @@ func (imd *InstallZtPlanetLB) Run(workflowID string) (*entities.CommandResult, d
 	if connectErr != nil {
 		return nil, connectErr
 	}
-
-	switch imd.PlatformType {
-	case grpc_installer_go.Platform_AZURE.String():
-		return imd.InstallLoadBalancer(workflowID)
-	case grpc_installer_go.Platform_BAREMETAL.String():
-		// Baremetal relies on Loadbalancers.
-		return imd.InstallLoadBalancer(workflowID)
-	case grpc_installer_go.Platform_MINIKUBE.String():
-		return imd.InstallMinikube(workflowID)
-	}
-	log.Warn().Str("platformType", imd.PlatformType).Msg("unsupported platform type")
-	return entities.NewCommandResult(
-		false, "unsupported platform type", nil), nil
-}
-
-func (imd *InstallZtPlanetLB) InstallLoadBalancer(workflowID string) (*entities.CommandResult, derrors.Error) {
-	azureService := AzureZTPlanetService
-	err := imd.Create(&azureService)
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating ZT Planet LB service")
-		return entities.NewCommandResult(
-			false, "cannot install service", err), nil
-	}
-	msg := fmt.Sprintf("ZT planet installed on %s", imd.PlatformType)
-	return entities.NewSuccessCommand([]byte(msg)), nil
-}
-
-func (imd *InstallZtPlanetLB) InstallMinikube(workflowID string) (*entities.CommandResult, derrors.Error) {
-	err := imd.Create(&MinikubeZTPlanetService)
-	if err != nil {
-		log.Error().Str("trace", err.DebugReport()).Msg("error creating  ZT Planet LB service")
-		return entities.NewCommandResult(
-			false, "cannot install service", err), nil
-	}
-	return entities.NewSuccessCommand([]byte("ZT planet installed on Minikube")), nil
+	exposure := ZTPlanetExposure(imd.PlatformType, imd.Standalone)
+	imd.apply(&exposure)
+	return exposeService(&imd.Kubernetes, exposure, imd.PlatformType), nil
 }
 
 func (imd *InstallZtPlanetLB) String() string {
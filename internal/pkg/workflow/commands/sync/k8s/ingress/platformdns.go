@@ -0,0 +1,227 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Platform DNS
+// The DNS service of the management cluster answers the queries of the application clusters on the public DNS host.
+// CoreDNS serves the zone of the management domain from a zone file, and forwards the rest of the queries to the
+// consul DNS of the platform so the services registered on it are still resolved.
+
+package ingress
+
+import (
+	"fmt"
+	"hash/crc32"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/nalej/derrors"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// PlatformDNSName is the name of the objects of the platform DNS.
+const PlatformDNSName = "platform-dns"
+
+// DefaultPlatformDNSImage is the CoreDNS image used if not specified.
+const DefaultPlatformDNSImage = "coredns/coredns:1.6.7"
+
+// DefaultPlatformDNSTTL is the time to live of the records of the zone.
+const DefaultPlatformDNSTTL = 300
+
+// ConsulDNSService is the service of the consul DNS receiving the queries outside of the zone.
+const ConsulDNSService = "dns-server-consul-dns"
+
+// PlatformDNSLabels returns the labels of the platform DNS objects.
+func PlatformDNSLabels() map[string]string {
+	return map[string]string{
+		"cluster":   "management",
+		"component": PlatformDNSName,
+	}
+}
+
+// PlatformDNSExposure returns the configuration of the service of the platform DNS.
+func PlatformDNSExposure(platformType string) ServiceExposure {
+	return ServiceExposure{
+		ServiceName: PlatformDNSName,
+		Namespace:   "nalej",
+		Labels:      PlatformDNSLabels(),
+		Selector:    PlatformDNSLabels(),
+		Ports:       dnsPorts(platformType),
+	}
+}
+
+// ValidateZone checks the domain of the zone and its records.
+//   params:
+//     domain The domain of the zone.
+//     records The IP address of each record indexed by its name relative to the domain.
+//   returns:
+//     An error if the domain, a name or an address are not valid.
+func ValidateZone(domain string, records map[string]string) derrors.Error {
+	domain = strings.TrimSuffix(domain, ".")
+	if errs := validation.IsDNS1123Subdomain(domain); len(errs) > 0 {
+		return derrors.NewInvalidArgumentError("invalid DNS domain").WithParams(domain, strings.Join(errs, ", "))
+	}
+	for name, address := range records {
+		if name != "@" && name != "*" {
+			if errs := validation.IsDNS1123Subdomain(strings.TrimPrefix(name, "*.")); len(errs) > 0 {
+				return derrors.NewInvalidArgumentError("invalid DNS record name").WithParams(name, strings.Join(errs, ", "))
+			}
+		}
+		if net.ParseIP(address) == nil {
+			return derrors.NewInvalidArgumentError("invalid DNS record address").WithParams(name, address)
+		}
+	}
+	return nil
+}
+
+// recordType returns the type of the record of an address.
+func recordType(address string) string {
+	if net.ParseIP(address).To4() == nil {
+		return "AAAA"
+	}
+	return "A"
+}
+
+// ZoneFile returns the zone file of the management domain. The name server of the zone is the public DNS host, and
+// it gets a record with the address of the service if it belongs to the domain. The serial is derived from the
+// records so the zone is only reloaded when they change.
+//   params:
+//     domain The domain of the zone.
+//     publicHost The host where the DNS service is published.
+//     address The address of the DNS service, if known.
+//     records The IP address of each record indexed by its name relative to the domain.
+//   returns:
+//     The content of the zone file.
+func ZoneFile(domain string, publicHost string, address string, records map[string]string) string {
+	origin := strings.TrimSuffix(domain, ".") + "."
+	nameServer := strings.TrimSuffix(publicHost, ".") + "."
+	if publicHost == "" {
+		nameServer = "ns." + origin
+	}
+	all := make(map[string]string, len(records)+1)
+	if address != "" && strings.HasSuffix(nameServer, "."+origin) {
+		all[strings.TrimSuffix(nameServer, "."+origin)] = address
+	}
+	for name, ip := range records {
+		all[name] = ip
+	}
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s IN %s %s", name, recordType(all[name]), all[name]))
+	}
+	body := strings.Join(lines, "\n")
+	serial := crc32.ChecksumIEEE([]byte(nameServer + "\n" + body))
+	return fmt.Sprintf(`$ORIGIN %s
+$TTL %d
+@ IN SOA %s hostmaster.%s %d 7200 3600 1209600 %d
+@ IN NS %s
+%s
+`, origin, DefaultPlatformDNSTTL, nameServer, origin, serial, DefaultPlatformDNSTTL, nameServer, body)
+}
+
+// Corefile returns the configuration of CoreDNS serving the zone and forwarding the rest of the queries.
+//   params:
+//     domain The domain of the zone.
+//     upstream The address receiving the queries outside of the zone, or a resolv.conf file.
+//   returns:
+//     The content of the Corefile.
+func Corefile(domain string, upstream string) string {
+	domain = strings.TrimSuffix(domain, ".")
+	return fmt.Sprintf(`%s:53 {
+    errors
+    file /etc/coredns/db.%s
+    reload
+}
+.:53 {
+    errors
+    health
+    forward . %s
+    cache 30
+}
+`, domain, domain, upstream)
+}
+
+// NewPlatformDNSConfigMap creates the config map with the Corefile and the zone file.
+func NewPlatformDNSConfigMap(domain string, corefile string, zone string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      PlatformDNSName,
+			Namespace: "nalej",
+			Labels:    PlatformDNSLabels(),
+		},
+		Data: map[string]string{
+			"Corefile":                              corefile,
+			"db." + strings.TrimSuffix(domain, "."): zone,
+		},
+	}
+}
+
+// NewPlatformDNSDeployment creates the CoreDNS deployment. Two replicas are launched so the zone is served during
+// updates.
+func NewPlatformDNSDeployment(image string) *appsV1.Deployment {
+	replicas := int32(2)
+	labels := PlatformDNSLabels()
+	return &appsV1.Deployment{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      PlatformDNSName,
+			Namespace: "nalej",
+			Labels:    labels,
+		},
+		Spec: appsV1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metaV1.LabelSelector{MatchLabels: labels},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metaV1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{
+						Name:            PlatformDNSName,
+						Image:           image,
+						ImagePullPolicy: v1.PullIfNotPresent,
+						Args:            []string{"-conf", "/etc/coredns/Corefile"},
+						Ports: []v1.ContainerPort{
+							{Name: DNSUDPPort.TargetPort.StrVal, ContainerPort: 53, Protocol: v1.ProtocolUDP},
+							{Name: DNSTCPPort.TargetPort.StrVal, ContainerPort: 53, Protocol: v1.ProtocolTCP},
+						},
+						VolumeMounts: []v1.VolumeMount{{Name: "config", MountPath: "/etc/coredns", ReadOnly: true}},
+					}},
+					Volumes: []v1.Volume{{
+						Name: "config",
+						VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+							LocalObjectReference: v1.LocalObjectReference{Name: PlatformDNSName},
+						}},
+					}},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingress
+
+import (
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = ginkgo.Describe("The platform DNS", func() {
+
+	azure := grpc_installer_go.Platform_AZURE.String()
+
+	ginkgo.It("should build the zone of the management domain", func() {
+		zone := ZoneFile("nalej.tech", "dns.nalej.tech", "10.0.0.53", map[string]string{"*.apps": "10.0.0.80"})
+		gomega.Expect(zone).Should(gomega.ContainSubstring("$ORIGIN nalej.tech.\n"))
+		gomega.Expect(zone).Should(gomega.ContainSubstring("@ IN NS dns.nalej.tech.\n"))
+		gomega.Expect(zone).Should(gomega.ContainSubstring("dns IN A 10.0.0.53\n"))
+		gomega.Expect(zone).Should(gomega.ContainSubstring("*.apps IN A 10.0.0.80\n"))
+		gomega.Expect(ZoneFile("nalej.tech", "dns.nalej.tech", "10.0.0.53", nil)).ShouldNot(gomega.Equal(zone))
+
+		external := ZoneFile("nalej.tech", "dns.example.com", "10.0.0.53", nil)
+		gomega.Expect(external).ShouldNot(gomega.ContainSubstring("10.0.0.53"))
+	})
+
+	ginkgo.It("should reject invalid domains and records", func() {
+		gomega.Expect(ValidateZone("nalej.tech.", map[string]string{"@": "10.0.0.1", "*": "fd00::1"})).To(gomega.Succeed())
+		gomega.Expect(ValidateZone("Not_Valid", nil)).ShouldNot(gomega.Succeed())
+		gomega.Expect(ValidateZone("nalej.tech", map[string]string{"api": "not-an-ip"})).ShouldNot(gomega.Succeed())
+		gomega.Expect(ValidateZone("nalej.tech", map[string]string{"bad_name": "10.0.0.1"})).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.Context("install command", func() {
+		var cluster *k8stest.FakeCluster
+
+		ginkgo.BeforeEach(func() {
+			cluster = k8stest.NewFakeCluster()
+			k8s.RegisterClients(cluster.KubeConfigPath, cluster.Client, cluster.Discovery, cluster.Dynamic)
+		})
+
+		ginkgo.AfterEach(func() {
+			k8s.UnregisterClients(cluster.KubeConfigPath)
+		})
+
+		ginkgo.It("should serve the zone and forward the rest of the queries to consul", func() {
+			consul := &v1.Service{
+				ObjectMeta: metaV1.ObjectMeta{Name: ConsulDNSService, Namespace: "nalej"},
+				Spec:       v1.ServiceSpec{ClusterIP: "10.96.0.53"},
+			}
+			gomega.Expect(cluster.Tracker.Add(consul)).To(gomega.Succeed())
+			cmd := NewInstallPlatformDNS(cluster.KubeConfigPath, azure, "nalej.tech", "dns.nalej.tech", true, "20.0.0.53")
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+
+			config := cluster.ExpectObject("v1", "ConfigMap", "nalej", PlatformDNSName)
+			corefile, _, _ := unstructured.NestedString(config.Object, "data", "Corefile")
+			gomega.Expect(corefile).Should(gomega.ContainSubstring("forward . 10.96.0.53"))
+			zone, _, _ := unstructured.NestedString(config.Object, "data", "db.nalej.tech")
+			gomega.Expect(zone).Should(gomega.ContainSubstring("dns IN A 20.0.0.53"))
+			cluster.ExpectObject("apps/v1", "Deployment", "nalej", PlatformDNSName)
+			service := cluster.ExpectObject("v1", "Service", "nalej", PlatformDNSName)
+			address, _, _ := unstructured.NestedString(service.Object, "spec", "loadBalancerIP")
+			gomega.Expect(address).Should(gomega.Equal("20.0.0.53"))
+		})
+
+		ginkgo.It("should use the resolvers of the cluster without consul", func() {
+			cmd := NewInstallPlatformDNS(cluster.KubeConfigPath, azure, "nalej.tech", "dns.nalej.tech", false, "")
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			gomega.Expect(result.Output).Should(gomega.ContainSubstring("/etc/resolv.conf"))
+		})
+
+		ginkgo.It("should reject an invalid domain", func() {
+			cmd := NewInstallPlatformDNS(cluster.KubeConfigPath, azure, "", "dns.nalej.tech", false, "")
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeFalse())
+			cluster.ExpectNoObject("apps/v1", "Deployment", "nalej", PlatformDNSName)
+		})
+	})
+})
@@ -0,0 +1,39 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file registers the commands of the package.
+
+package ingress
+
+import "github.com/nalej/installer/internal/pkg/workflow/entities"
+
+func init() {
+	entities.RegisterSyncCommand(entities.InstallIngress, NewInstallIngressFromJSON,
+		func() interface{} { return &InstallIngress{} }, "kubeConfigPath")
+	entities.RegisterSyncCommand(entities.InstallMngtDNS, NewInstallMngtDNSFromJSON,
+		func() interface{} { return &InstallMngtDNS{} }, "kubeConfigPath")
+	entities.RegisterSyncCommand(entities.InstallPlatformDNS, NewInstallPlatformDNSFromJSON,
+		func() interface{} { return &InstallPlatformDNS{} }, "kubeConfigPath", "domain")
+	entities.RegisterSyncCommand(entities.InstallZtPlanetLB, NewInstallZtPlanetLBFromJSON,
+		func() interface{} { return &InstallZtPlanetLB{} }, "kubeConfigPath")
+	entities.RegisterSyncCommand(entities.InstallVpnServerLB, NewInstallVpnServerLBFromJSON,
+		func() interface{} { return &InstallVpnServerLB{} }, "kubeConfigPath")
+	entities.RegisterSyncCommand(entities.InstallExtDNS, NewInstallExtDNSFromJSON,
+		func() interface{} { return &InstallExtDNS{} }, "kubeConfigPath")
+	entities.RegisterSyncCommand(entities.ExposeService, NewExposeServiceFromJSON,
+		func() interface{} { return &ExposeService{} }, "kubeConfigPath", "service_name", "namespace", "ports")
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Traefik ingress controller
+// Traefik is deployed on kube-system like the NGINX controller and serves the ingresses with the traefik class. The
+// TLS certificates are read from the secrets referenced by the ingresses, and HTTP requests are redirected to HTTPS
+// by the web entry point. The client certificates are verified with TLSOption custom resources, so the custom
+// resource definitions of Traefik are installed with the controller.
+
+package ingress
+
+import (
+	"strings"
+
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// TraefikName is the name of the Traefik objects.
+const TraefikName = "traefik-ingress-controller"
+
+// TraefikImage is the Traefik image, the 2.2 series reads the router options from the ingress annotations.
+const TraefikImage = "traefik:v2.2.11"
+
+// TraefikArgs serves the ingresses of the traefik class and the custom resources of Traefik, redirecting HTTP
+// requests to HTTPS.
+var TraefikArgs = []string{
+	"--entrypoints.web.address=:80",
+	"--entrypoints." + k8s.TraefikSecureEntryPoint + ".address=:443",
+	"--entrypoints.web.http.redirections.entrypoint.to=" + k8s.TraefikSecureEntryPoint,
+	"--entrypoints.web.http.redirections.entrypoint.scheme=https",
+	"--providers.kubernetesingress",
+	"--providers.kubernetesingress.ingressclass=" + k8s.TraefikController,
+	"--providers.kubernetescrd",
+	"--ping",
+}
+
+// TraefikCustomResources are the kinds of the custom resources watched by Traefik.
+var TraefikCustomResources = []string{
+	"IngressRoute", "IngressRouteTCP", "IngressRouteUDP", "Middleware", "TLSOption", "TLSStore", "TraefikService",
+}
+
+// traefikLabels returns the labels of the Traefik objects.
+func traefikLabels() map[string]string {
+	return map[string]string{
+		"cluster":                   "management",
+		"app.kubernetes.io/name":    TraefikName,
+		"app.kubernetes.io/part-of": "kube-system",
+	}
+}
+
+// traefikPlurals returns the resources of the custom resources of Traefik.
+func traefikPlurals() []string {
+	result := make([]string, 0, len(TraefikCustomResources))
+	for _, kind := range TraefikCustomResources {
+		result = append(result, strings.ToLower(kind)+"s")
+	}
+	return result
+}
+
+// TraefikCustomResourceDefinitions returns the definitions of the custom resources of Traefik.
+func TraefikCustomResourceDefinitions() []runtime.Object {
+	result := make([]runtime.Object, 0, len(TraefikCustomResources))
+	for _, kind := range TraefikCustomResources {
+		plural := strings.ToLower(kind) + "s"
+		result = append(result, &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apiextensions.k8s.io/v1beta1",
+			"kind":       "CustomResourceDefinition",
+			"metadata": map[string]interface{}{
+				"name":   plural + "." + k8s.TraefikGroup,
+				"labels": stringsToInterfaces(traefikLabels()),
+			},
+			"spec": map[string]interface{}{
+				"group":   k8s.TraefikGroup,
+				"version": k8s.TraefikVersion,
+				"scope":   "Namespaced",
+				"names": map[string]interface{}{
+					"kind":     kind,
+					"plural":   plural,
+					"singular": strings.ToLower(kind),
+				},
+			},
+		}})
+	}
+	return result
+}
+
+// stringsToInterfaces converts a map of strings to be set on an unstructured object.
+func stringsToInterfaces(values map[string]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		result[key] = value
+	}
+	return result
+}
+
+// TraefikObjects returns the objects required to run Traefik.
+//   params:
+//     installType The platform of the cluster. Minikube clusters expose Traefik through a NodePort service.
+//     useStaticIP Whether the load balancer uses a static IP address.
+//     staticIPAddress The static IP address of the load balancer.
+//   returns:
+//     The objects to be created.
+func TraefikObjects(installType grpc_installer_go.Platform, useStaticIP bool, staticIPAddress string) []runtime.Object {
+	labels := traefikLabels()
+	replicas := IngressNumReplicas
+	service := v1.Service{
+		TypeMeta: metaV1.TypeMeta{Kind: "Service", APIVersion: "v1"},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      TraefikName,
+			Namespace: "kube-system",
+			Labels:    labels,
+		},
+		Spec: v1.ServiceSpec{
+			Ports:                 []v1.ServicePort{CloudGenericHttpPort, CloudGenericHttpsPort},
+			Selector:              map[string]string{"app.kubernetes.io/name": TraefikName},
+			Type:                  v1.ServiceTypeLoadBalancer,
+			ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeCluster,
+		},
+	}
+	if installType == grpc_installer_go.Platform_MINIKUBE {
+		service.Spec.Type = v1.ServiceTypeNodePort
+		service.Spec.Ports = []v1.ServicePort{MinikubeHttpPort, MinikubeHttpsPort}
+	} else if useStaticIP {
+		service.Spec.LoadBalancerIP = staticIPAddress
+	}
+	return []runtime.Object{
+		&v1.ServiceAccount{
+			TypeMeta:   metaV1.TypeMeta{Kind: "ServiceAccount", APIVersion: "v1"},
+			ObjectMeta: metaV1.ObjectMeta{Name: TraefikName, Namespace: "kube-system", Labels: labels},
+		},
+		&rbacv1.ClusterRole{
+			TypeMeta:   metaV1.TypeMeta{Kind: "ClusterRole", APIVersion: "rbac.authorization.k8s.io/v1"},
+			ObjectMeta: metaV1.ObjectMeta{Name: TraefikName, Labels: labels},
+			Rules: []rbacv1.PolicyRule{
+				{
+					APIGroups: []string{""},
+					Resources: []string{"services", "endpoints", "secrets"},
+					Verbs:     []string{"get", "list", "watch"},
+				},
+				{
+					APIGroups: []string{"extensions", "networking.k8s.io"},
+					Resources: []string{"ingresses"},
+					Verbs:     []string{"get", "list", "watch"},
+				},
+				{
+					APIGroups: []string{"extensions", "networking.k8s.io"},
+					Resources: []string{"ingresses/status"},
+					Verbs:     []string{"update"},
+				},
+				{
+					APIGroups: []string{k8s.TraefikGroup},
+					Resources: traefikPlurals(),
+					Verbs:     []string{"get", "list", "watch"},
+				},
+			},
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metaV1.TypeMeta{Kind: "ClusterRoleBinding", APIVersion: "rbac.authorization.k8s.io/v1"},
+			ObjectMeta: metaV1.ObjectMeta{Name: TraefikName, Labels: labels},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: "rbac.authorization.k8s.io",
+				Kind:     "ClusterRole",
+				Name:     TraefikName,
+			},
+			Subjects: []rbacv1.Subject{{Kind: "ServiceAccount", Name: TraefikName, Namespace: "kube-system"}},
+		},
+		&appsv1.Deployment{
+			TypeMeta:   metaV1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+			ObjectMeta: metaV1.ObjectMeta{Name: TraefikName, Namespace: "kube-system", Labels: labels},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metaV1.LabelSelector{MatchLabels: labels},
+				Template: v1.PodTemplateSpec{
+					ObjectMeta: metaV1.ObjectMeta{Labels: labels},
+					Spec: v1.PodSpec{
+						ServiceAccountName: TraefikName,
+						Containers: []v1.Container{{
+							Name:            TraefikName,
+							Image:           TraefikImage,
+							ImagePullPolicy: v1.PullIfNotPresent,
+							Args:            TraefikArgs,
+							Ports: []v1.ContainerPort{
+								{Name: "http", ContainerPort: 80},
+								{Name: "https", ContainerPort: 443},
+							},
+						}},
+					},
+				},
+			},
+		},
+		&service,
+	}
+}
@@ -18,75 +18,39 @@
 package ingress
 
 import (
+	"github.com/nalej/grpc-installer-go"
 	"k8s.io/api/core/v1"
-	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
-var AzureVPNServerPort = v1.ServicePort{
-	Name:     "vpn-port",
-	Protocol: v1.ProtocolTCP,
-	Port:     5555,
-	TargetPort: intstr.IntOrString{
-		Type:   intstr.Int,
-		IntVal: 5555,
-	},
+// VPNServerPort is the port used by the VPN server.
+var VPNServerPort = v1.ServicePort{
+	Name:       "vpn-port",
+	Protocol:   v1.ProtocolTCP,
+	Port:       5555,
+	TargetPort: intstr.FromInt(5555),
 }
 
-var MinikubeVPNServerPort = v1.ServicePort{
-	Name:     "vpn-port",
-	Protocol: v1.ProtocolTCP,
-	Port:     5555,
-	TargetPort: intstr.IntOrString{
-		Type:   intstr.Int,
-		IntVal: 5555,
-	},
-	NodePort: 5555,
-}
-
-var AzureVPNServerService = v1.Service{
-	TypeMeta: metaV1.TypeMeta{
-		Kind:       "Service",
-		APIVersion: "v1",
-	},
-	ObjectMeta: metaV1.ObjectMeta{
-		Name:      "vpn-server",
-		Namespace: "nalej",
-		Labels: map[string]string{
-			"cluster":   "management",
-			"component": "vpn-server",
-		},
-	},
-	Spec: v1.ServiceSpec{
-		Ports: []v1.ServicePort{AzureVPNServerPort},
-		Selector: map[string]string{
-			"cluster":   "management",
-			"component": "vpn-server",
-		},
-		Type:                  v1.ServiceTypeLoadBalancer,
-		ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeLocal,
-	},
-}
-
-var MinikubeVPNServerService = v1.Service{
-	TypeMeta: metaV1.TypeMeta{
-		Kind:       "Service",
-		APIVersion: "v1",
-	},
-	ObjectMeta: metaV1.ObjectMeta{
-		Name:      "vpn-server",
-		Namespace: "nalej",
+// VPNServerExposure returns the configuration of the VPN server service.
+func VPNServerExposure(platformType string) ServiceExposure {
+	exposure := ServiceExposure{
+		ServiceName: "vpn-server",
+		Namespace:   "nalej",
 		Labels: map[string]string{
 			"cluster":   "management",
 			"component": "vpn-server",
 		},
-	},
-	Spec: v1.ServiceSpec{
-		Ports: []v1.ServicePort{MinikubeVPNServerPort},
 		Selector: map[string]string{
 			"cluster":   "management",
 			"component": "vpn-server",
 		},
-		Type: v1.ServiceTypeNodePort,
-	},
+		Ports: []v1.ServicePort{VPNServerPort},
+		// Preserve the address of the clients connecting to the server.
+		ExternalTrafficPolicy: string(v1.ServiceExternalTrafficPolicyTypeLocal),
+	}
+	if platformType == grpc_installer_go.Platform_MINIKUBE.String() {
+		exposure.Ports = []v1.ServicePort{withNodePort(VPNServerPort)}
+		exposure.ExternalTrafficPolicy = ""
+	}
+	return exposure
 }
@@ -18,74 +18,48 @@
 package ingress
 
 import (
+	"github.com/nalej/grpc-installer-go"
 	"k8s.io/api/core/v1"
-	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
-var AzureZTPort = v1.ServicePort{
-	Name:     "zt-udp",
-	Protocol: v1.ProtocolUDP,
-	Port:     9993,
-	TargetPort: intstr.IntOrString{
-		Type:   intstr.Int,
-		IntVal: 9993,
-	},
+// ZTPort is the port used by the ZeroTier planet.
+var ZTPort = v1.ServicePort{
+	Name:       "zt-udp",
+	Protocol:   v1.ProtocolUDP,
+	Port:       9993,
+	TargetPort: intstr.FromInt(9993),
 }
 
-var MinikubeZTPort = v1.ServicePort{
-	Name:     "zt-udp",
-	Protocol: v1.ProtocolUDP,
-	Port:     9993,
-	TargetPort: intstr.IntOrString{
-		Type:   intstr.Int,
-		IntVal: 9993,
-	},
-	NodePort: 9993,
-}
-
-var AzureZTPlanetService = v1.Service{
-	TypeMeta: metaV1.TypeMeta{
-		Kind:       "Service",
-		APIVersion: "v1",
-	},
-	ObjectMeta: metaV1.ObjectMeta{
-		Name:      "zt-planet",
-		Namespace: "nalej",
-		Labels: map[string]string{
-			"cluster":   "management",
-			"component": "network-manager",
-		},
-	},
-	Spec: v1.ServiceSpec{
-		Ports: []v1.ServicePort{AzureZTPort},
-		Selector: map[string]string{
-			"cluster":   "management",
-			"component": "network-manager",
-		},
-		Type: v1.ServiceTypeLoadBalancer,
-	},
-}
+// StandaloneZTPlanetComponent is the component label of the standalone ZeroTier planet.
+const StandaloneZTPlanetComponent = "zt-planet"
 
-var MinikubeZTPlanetService = v1.Service{
-	TypeMeta: metaV1.TypeMeta{
-		Kind:       "Service",
-		APIVersion: "v1",
-	},
-	ObjectMeta: metaV1.ObjectMeta{
-		Name:      "zt-planet",
-		Namespace: "nalej",
+// ZTPlanetExposure returns the configuration of the ZeroTier planet service.
+//   params:
+//     platformType The target platform.
+//     standalone Whether the planet is served by the standalone deployment instead of the network manager.
+//   returns:
+//     The service configuration.
+func ZTPlanetExposure(platformType string, standalone bool) ServiceExposure {
+	port := ZTPort
+	if platformType == grpc_installer_go.Platform_MINIKUBE.String() {
+		port = withNodePort(port)
+	}
+	component := "network-manager"
+	if standalone {
+		component = StandaloneZTPlanetComponent
+	}
+	return ServiceExposure{
+		ServiceName: "zt-planet",
+		Namespace:   "nalej",
 		Labels: map[string]string{
 			"cluster":   "management",
 			"component": "network-manager",
 		},
-	},
-	Spec: v1.ServiceSpec{
-		Ports: []v1.ServicePort{MinikubeZTPort},
 		Selector: map[string]string{
 			"cluster":   "management",
-			"component": "network-manager",
+			"component": component,
 		},
-		Type: v1.ServiceTypeNodePort,
-	},
+		Ports: []v1.ServicePort{port},
+	}
 }
@@ -0,0 +1,305 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Ingress controllers
+// The ingresses of the platform are served by the controller chosen for each cluster. The ingresses are written for
+// NGINX, so their class and annotations are translated to the chosen controller. With Istio the TLS termination is
+// done by the ingress gateway, so the TLS section of the ingresses is removed. Traefik terminates TLS with the secrets
+// of the ingresses, and the client certificates are verified with TLSOption objects referencing the CA secrets, as
+// Traefik has no equivalent to the per ingress annotations of NGINX.
+
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Supported ingress controllers.
+const (
+	NginxController   = "nginx"
+	TraefikController = "traefik"
+	IstioController   = "istio"
+)
+
+// IngressClassAnnotation selects the controller serving an ingress.
+const IngressClassAnnotation = "kubernetes.io/ingress.class"
+
+// BackendSchemeAnnotation records the scheme of the backends of an ingress served by Traefik, as Traefik reads it
+// from the annotations of the backend services.
+const BackendSchemeAnnotation = "installer.nalej.com/backend-scheme"
+
+// TraefikServiceSchemeAnnotation sets the scheme used by Traefik to reach a service.
+const TraefikServiceSchemeAnnotation = "traefik.ingress.kubernetes.io/service.serversscheme"
+
+// Traefik custom resources.
+const (
+	TraefikGroup   = "traefik.containo.us"
+	TraefikVersion = "v1alpha1"
+	// TraefikNamespace where Traefik and its shared middlewares are deployed.
+	TraefikNamespace = "kube-system"
+	// TraefikSecureEntryPoint is the entry point serving HTTPS.
+	TraefikSecureEntryPoint = "websecure"
+	// TraefikPassCertMiddleware forwards the client certificate to the backends.
+	TraefikPassCertMiddleware = "pass-client-cert"
+)
+
+// TraefikTLSOptionsResource is the resource of the TLS options of Traefik.
+var TraefikTLSOptionsResource = schema.GroupVersionResource{Group: TraefikGroup, Version: TraefikVersion, Resource: "tlsoptions"}
+
+// TraefikMiddlewaresResource is the resource of the middlewares of Traefik.
+var TraefikMiddlewaresResource = schema.GroupVersionResource{Group: TraefikGroup, Version: TraefikVersion, Resource: "middlewares"}
+
+// Prefixes of the annotations specific to each controller.
+const (
+	nginxAnnotationPrefix   = "nginx.ingress.kubernetes.io/"
+	traefikAnnotationPrefix = "traefik.ingress.kubernetes.io/router."
+)
+
+// SupportedIngressControllers returns the names of the supported ingress controllers.
+func SupportedIngressControllers() []string {
+	return []string{NginxController, TraefikController, IstioController}
+}
+
+// IngressControllerFor returns the controller used on a cluster.
+//   params:
+//     requested The controller requested for the cluster, if any.
+//     networkMode The networking mode of the cluster.
+//   returns:
+//     The requested controller, or the Istio gateway on Istio clusters and NGINX otherwise.
+func IngressControllerFor(requested string, networkMode string) string {
+	if requested != "" {
+		return requested
+	}
+	if networkMode == IstioController {
+		return IstioController
+	}
+	return NginxController
+}
+
+// ValidateIngressController checks that a controller is supported.
+func ValidateIngressController(controller string) derrors.Error {
+	for _, supported := range SupportedIngressControllers() {
+		if controller == supported {
+			return nil
+		}
+	}
+	return derrors.NewInvalidArgumentError("unsupported ingress controller").
+		WithParams(controller, SupportedIngressControllers())
+}
+
+// IngressKeepsTLS returns whether the ingresses served by a controller terminate TLS with the secrets of their TLS
+// section.
+func IngressKeepsTLS(controller string) bool {
+	return controller != IstioController
+}
+
+// clientAuthSecret returns the secret with the CA verifying the client certificates of an ingress written for NGINX.
+//   returns:
+//     The namespace and name of the secret, empty if the client certificates are not verified.
+//     An error if the verification mode is not supported or the secret is not set.
+func clientAuthSecret(annotations map[string]string) (string, string, derrors.Error) {
+	verify := annotations[nginxAnnotationPrefix+"auth-tls-verify-client"]
+	if verify == "" || verify == "off" {
+		return "", "", nil
+	}
+	if verify != "on" {
+		return "", "", derrors.NewFailedPreconditionError("unsupported client certificate verification").WithParams(verify)
+	}
+	secret := strings.SplitN(annotations[nginxAnnotationPrefix+"auth-tls-secret"], "/", 2)
+	if len(secret) != 2 || secret[0] == "" || secret[1] == "" {
+		return "", "", derrors.NewFailedPreconditionError("client certificate verification requires a namespaced CA secret").
+			WithParams(annotations[nginxAnnotationPrefix+"auth-tls-secret"])
+	}
+	return secret[0], secret[1], nil
+}
+
+// traefikReference returns the reference to a Traefik custom resource from an ingress.
+func traefikReference(namespace string, name string) string {
+	return fmt.Sprintf("%s-%s@kubernetescrd", namespace, name)
+}
+
+// traefikScheme returns the scheme used by Traefik to reach the backends of an NGINX backend protocol.
+func traefikScheme(protocol string) string {
+	switch strings.ToUpper(protocol) {
+	case "GRPC":
+		return "h2c"
+	case "HTTPS", "GRPCS":
+		return "https"
+	}
+	return ""
+}
+
+// IngressAnnotations translates the annotations of an ingress written for NGINX to a controller.
+//   params:
+//     controller The controller serving the ingress.
+//     annotations The annotations of the ingress.
+//   returns:
+//     A new set of annotations with the class of the controller.
+//     An error if the ingress requires a feature the controller does not provide.
+func IngressAnnotations(controller string, annotations map[string]string) (map[string]string, derrors.Error) {
+	if err := ValidateIngressController(controller); err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(annotations)+1)
+	for key, value := range annotations {
+		if controller == NginxController || !strings.HasPrefix(key, nginxAnnotationPrefix) {
+			result[key] = value
+		}
+	}
+	result[IngressClassAnnotation] = controller
+	if controller != TraefikController {
+		return result, nil
+	}
+	// HTTP requests are redirected to HTTPS by the entry points of Traefik.
+	result[traefikAnnotationPrefix+"entrypoints"] = TraefikSecureEntryPoint
+	result[traefikAnnotationPrefix+"tls"] = "true"
+	if scheme := traefikScheme(annotations[nginxAnnotationPrefix+"backend-protocol"]); scheme != "" {
+		result[BackendSchemeAnnotation] = scheme
+	}
+	namespace, secret, err := clientAuthSecret(annotations)
+	if err != nil {
+		return nil, err
+	}
+	if secret != "" {
+		result[traefikAnnotationPrefix+"tls.options"] = traefikReference(namespace, secret)
+	}
+	if annotations[nginxAnnotationPrefix+"auth-tls-pass-certificate-to-upstream"] == "true" {
+		result[traefikAnnotationPrefix+"middlewares"] = traefikReference(TraefikNamespace, TraefikPassCertMiddleware)
+	}
+	return result, nil
+}
+
+// IngressSupport returns the objects required by an ingress written for NGINX on a controller.
+//   params:
+//     controller The controller serving the ingress.
+//     annotations The annotations of the ingress.
+//   returns:
+//     The objects to be created with the ingress.
+//     An error if the ingress requires a feature the controller does not provide.
+func IngressSupport(controller string, annotations map[string]string) ([]*unstructured.Unstructured, derrors.Error) {
+	if controller != TraefikController {
+		return nil, nil
+	}
+	namespace, secret, err := clientAuthSecret(annotations)
+	if err != nil || secret == "" {
+		return nil, err
+	}
+	return []*unstructured.Unstructured{NewTraefikTLSOption(namespace, secret)}, nil
+}
+
+// NewTraefikTLSOption creates the TLS options requiring the client certificates signed by the CA of a secret. The
+// options are named after the secret.
+func NewTraefikTLSOption(namespace string, secret string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": TraefikGroup + "/" + TraefikVersion,
+		"kind":       "TLSOption",
+		"metadata": map[string]interface{}{
+			"name":      secret,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"minVersion": "VersionTLS12",
+			"clientAuth": map[string]interface{}{
+				"secretNames":    []interface{}{secret},
+				"clientAuthType": "RequireAndVerifyClientCert",
+			},
+		},
+	}}
+}
+
+// NewTraefikPassCertMiddleware creates the middleware forwarding the client certificates to the backends on the
+// X-Forwarded-Tls-Client-Cert header.
+func NewTraefikPassCertMiddleware() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": TraefikGroup + "/" + TraefikVersion,
+		"kind":       "Middleware",
+		"metadata": map[string]interface{}{
+			"name":      TraefikPassCertMiddleware,
+			"namespace": TraefikNamespace,
+		},
+		"spec": map[string]interface{}{
+			"passTLSClientCert": map[string]interface{}{"pem": true},
+		},
+	}}
+}
+
+// AdaptIngress translates an ingress of the components written for NGINX to a controller.
+//   params:
+//     ingress The ingress to be modified.
+//     controller The controller serving the ingress.
+//   returns:
+//     The objects required by the ingress on the controller.
+//     An error if the ingress requires a feature the controller does not provide.
+func AdaptIngress(ingress *unstructured.Unstructured, controller string) ([]*unstructured.Unstructured, derrors.Error) {
+	support, err := IngressSupport(controller, ingress.GetAnnotations())
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot adapt ingress").WithParams(ingress.GetNamespace(), ingress.GetName())
+	}
+	annotations, err := IngressAnnotations(controller, ingress.GetAnnotations())
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot adapt ingress").WithParams(ingress.GetNamespace(), ingress.GetName())
+	}
+	ingress.SetAnnotations(annotations)
+	if !IngressKeepsTLS(controller) {
+		unstructured.RemoveNestedField(ingress.Object, "spec", "tls")
+	}
+	return support, nil
+}
+
+// BackendSchemes returns the schemes of the services used as backends of ingresses adapted to Traefik.
+//   params:
+//     ingresses The ingresses to be inspected.
+//   returns:
+//     The scheme of each service indexed by namespace/name.
+func BackendSchemes(ingresses []unstructured.Unstructured) map[string]string {
+	result := make(map[string]string, 0)
+	for _, ingress := range ingresses {
+		scheme := ingress.GetAnnotations()[BackendSchemeAnnotation]
+		if scheme == "" {
+			continue
+		}
+		rules, _, _ := unstructured.NestedSlice(ingress.Object, "spec", "rules")
+		for _, rule := range rules {
+			ruleMap, ok := rule.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			paths, _, _ := unstructured.NestedSlice(ruleMap, "http", "paths")
+			for _, path := range paths {
+				pathMap, ok := path.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				backend, _, _ := unstructured.NestedMap(pathMap, "backend")
+				// The service is named on serviceName up to networking.k8s.io/v1.
+				name, _, _ := unstructured.NestedString(backend, "serviceName")
+				if name == "" {
+					name, _, _ = unstructured.NestedString(backend, "service", "name")
+				}
+				if name != "" {
+					result[ingress.GetNamespace()+"/"+name] = scheme
+				}
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = ginkgo.Describe("Ingress controllers", func() {
+
+	grpcAnnotations := map[string]string{
+		IngressClassAnnotation:                         NginxController,
+		"nginx.ingress.kubernetes.io/ssl-redirect":     "true",
+		"nginx.ingress.kubernetes.io/backend-protocol": "GRPC",
+		"cert-manager.io/cluster-issuer":               "letsencrypt",
+	}
+
+	newIngress := func(annotations map[string]string) *unstructured.Unstructured {
+		ingress := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "extensions/v1beta1",
+			"kind":       "Ingress",
+			"metadata":   map[string]interface{}{"name": "api", "namespace": "nalej"},
+			"spec": map[string]interface{}{
+				"tls": []interface{}{map[string]interface{}{"hosts": []interface{}{"api.nalej.tech"}, "secretName": "tls"}},
+			},
+		}}
+		ingress.SetAnnotations(annotations)
+		return ingress
+	}
+
+	ginkgo.It("should select the controller of the networking mode by default", func() {
+		gomega.Expect(IngressControllerFor("", "zt")).Should(gomega.Equal(NginxController))
+		gomega.Expect(IngressControllerFor("", "istio")).Should(gomega.Equal(IstioController))
+		gomega.Expect(IngressControllerFor(TraefikController, "istio")).Should(gomega.Equal(TraefikController))
+		gomega.Expect(ValidateIngressController("haproxy")).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should keep the annotations of NGINX", func() {
+		annotations, err := IngressAnnotations(NginxController, grpcAnnotations)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(annotations).Should(gomega.Equal(grpcAnnotations))
+	})
+
+	ginkgo.It("should translate the annotations to Traefik", func() {
+		annotations, err := IngressAnnotations(TraefikController, grpcAnnotations)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(annotations).Should(gomega.Equal(map[string]string{
+			IngressClassAnnotation:                             "traefik",
+			"traefik.ingress.kubernetes.io/router.entrypoints": "websecure",
+			"traefik.ingress.kubernetes.io/router.tls":         "true",
+			BackendSchemeAnnotation:                            "h2c",
+			"cert-manager.io/cluster-issuer":                   "letsencrypt",
+		}))
+		gomega.Expect(grpcAnnotations).Should(gomega.HaveKeyWithValue(IngressClassAnnotation, NginxController))
+	})
+
+	ginkgo.It("should verify the client certificates with the TLS options of Traefik", func() {
+		clientAuth := map[string]string{
+			"nginx.ingress.kubernetes.io/auth-tls-verify-client":                "on",
+			"nginx.ingress.kubernetes.io/auth-tls-secret":                       "nalej/ca-certificate",
+			"nginx.ingress.kubernetes.io/auth-tls-pass-certificate-to-upstream": "true",
+		}
+		annotations, err := IngressAnnotations(TraefikController, clientAuth)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(annotations).Should(gomega.HaveKeyWithValue(
+			"traefik.ingress.kubernetes.io/router.tls.options", "nalej-ca-certificate@kubernetescrd"))
+		gomega.Expect(annotations).Should(gomega.HaveKeyWithValue(
+			"traefik.ingress.kubernetes.io/router.middlewares", "kube-system-pass-client-cert@kubernetescrd"))
+		support, err := IngressSupport(TraefikController, clientAuth)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(support).Should(gomega.HaveLen(1))
+		gomega.Expect(support[0].GetNamespace()).Should(gomega.Equal("nalej"))
+		gomega.Expect(support[0].GetName()).Should(gomega.Equal("ca-certificate"))
+
+		support, err = IngressSupport(NginxController, clientAuth)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(support).Should(gomega.BeEmpty())
+		delete(clientAuth, "nginx.ingress.kubernetes.io/auth-tls-secret")
+		_, err = IngressAnnotations(TraefikController, clientAuth)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should obtain the schemes of the backends", func() {
+		ingress := newIngress(map[string]string{BackendSchemeAnnotation: "h2c"})
+		ingress.Object["spec"] = map[string]interface{}{"rules": []interface{}{
+			map[string]interface{}{"http": map[string]interface{}{"paths": []interface{}{
+				map[string]interface{}{"backend": map[string]interface{}{"serviceName": "public-api", "servicePort": 8080}},
+				map[string]interface{}{"backend": map[string]interface{}{"service": map[string]interface{}{"name": "login-api"}}},
+			}}},
+		}}
+		plain := newIngress(nil)
+		gomega.Expect(BackendSchemes([]unstructured.Unstructured{*ingress, *plain})).Should(gomega.Equal(map[string]string{
+			"nalej/public-api": "h2c",
+			"nalej/login-api":  "h2c",
+		}))
+	})
+
+	ginkgo.It("should leave the TLS termination to the Istio gateway", func() {
+		ingress := newIngress(grpcAnnotations)
+		_, err := AdaptIngress(ingress, IstioController)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(ingress.GetAnnotations()).Should(gomega.Equal(map[string]string{
+			IngressClassAnnotation:           IstioController,
+			"cert-manager.io/cluster-issuer": "letsencrypt",
+		}))
+		_, found, _ := unstructured.NestedSlice(ingress.Object, "spec", "tls")
+		gomega.Expect(found).Should(gomega.BeFalse())
+
+		ingress = newIngress(grpcAnnotations)
+		_, err = AdaptIngress(ingress, TraefikController)
+		gomega.Expect(err).To(gomega.Succeed())
+		_, found, _ = unstructured.NestedSlice(ingress.Object, "spec", "tls")
+		gomega.Expect(found).Should(gomega.BeTrue())
+	})
+})
@@ -0,0 +1,312 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Install identity
+// The installer does not require cluster-admin credentials. The objects accessed by the commands of a workflow are
+// collected and translated into the minimal set of RBAC rules required to execute it, so a dedicated service account
+// can be created for the installer.
+
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"k8s.io/api/core/v1"
+	rbacV1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// DefaultIdentityName is the name of the service account, role and binding used by the installer.
+const DefaultIdentityName = "nalej-installer"
+
+// DefaultIdentityNamespace is the namespace where the service account of the installer is created.
+const DefaultIdentityNamespace = "kube-system"
+
+// DefaultIdentityTokenTimeout is the time to wait for the token of the service account to be issued.
+const DefaultIdentityTokenTimeout = 30 * time.Second
+
+// rbacGroup is the API group of the RBAC objects.
+const rbacGroup = "rbac.authorization.k8s.io"
+
+// Verbs required by each type of access.
+var (
+	ReadVerbs   = []string{"get", "list"}
+	CreateVerbs = []string{"get", "list", "create"}
+	UpdateVerbs = []string{"get", "update"}
+	PatchVerbs  = []string{"get", "patch"}
+	DeleteVerbs = []string{"get", "list", "delete"}
+)
+
+// ObjectAccess structure with a type of Kubernetes object accessed by a command.
+type ObjectAccess struct {
+	// Group of the object, empty for the core group.
+	Group string
+	// Resource with the plural name of the object.
+	Resource string
+	// Verbs with the operations performed on the object.
+	Verbs []string
+}
+
+// Access creates an ObjectAccess.
+func Access(group string, resource string, verbs ...[]string) ObjectAccess {
+	all := make([]string, 0)
+	for _, v := range verbs {
+		all = append(all, v...)
+	}
+	return ObjectAccess{Group: group, Resource: resource, Verbs: all}
+}
+
+// KindAccess creates an ObjectAccess from the kind of an object.
+func KindAccess(gvk schema.GroupVersionKind, verbs ...[]string) ObjectAccess {
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	return Access(gvk.Group, plural.Resource, verbs...)
+}
+
+// PolicyRules translates a set of accesses into the minimal list of RBAC rules. Accesses to the same resource are
+// merged, and the rules are sorted so the result is stable. Creating roles or bindings requires the installer to
+// hold the permissions being granted, so the bind and escalate verbs are added in that case.
+//   params:
+//     accesses The accesses performed by the commands.
+//   returns:
+//     The list of rules.
+func PolicyRules(accesses []ObjectAccess) []rbacV1.PolicyRule {
+	verbs := make(map[schema.GroupResource]map[string]bool, 0)
+	add := func(group string, resource string, toAdd ...string) {
+		key := schema.GroupResource{Group: group, Resource: resource}
+		if _, exists := verbs[key]; !exists {
+			verbs[key] = make(map[string]bool, 0)
+		}
+		for _, verb := range toAdd {
+			verbs[key][verb] = true
+		}
+	}
+	grantsRoles := false
+	for _, access := range accesses {
+		add(access.Group, access.Resource, access.Verbs...)
+		if access.Group == rbacGroup && containsVerb(access.Verbs, "create") {
+			grantsRoles = true
+		}
+	}
+	if grantsRoles {
+		add(rbacGroup, "clusterroles", "bind", "escalate")
+		add(rbacGroup, "roles", "bind", "escalate")
+	}
+
+	resources := make([]schema.GroupResource, 0, len(verbs))
+	for key := range verbs {
+		resources = append(resources, key)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Group != resources[j].Group {
+			return resources[i].Group < resources[j].Group
+		}
+		return resources[i].Resource < resources[j].Resource
+	})
+
+	// Resources with the same verbs in the same group share a rule.
+	result := make([]rbacV1.PolicyRule, 0)
+	index := make(map[string]int, 0)
+	for _, resource := range resources {
+		sorted := make([]string, 0, len(verbs[resource]))
+		for verb := range verbs[resource] {
+			sorted = append(sorted, verb)
+		}
+		sort.Strings(sorted)
+		key := fmt.Sprintf("%s/%s", resource.Group, strings.Join(sorted, ","))
+		if pos, exists := index[key]; exists {
+			result[pos].Resources = append(result[pos].Resources, resource.Resource)
+			continue
+		}
+		index[key] = len(result)
+		result = append(result, rbacV1.PolicyRule{
+			APIGroups: []string{resource.Group},
+			Resources: []string{resource.Resource},
+			Verbs:     sorted,
+		})
+	}
+	return result
+}
+
+// containsVerb checks if a verb is contained in a list.
+func containsVerb(verbs []string, verb string) bool {
+	for _, v := range verbs {
+		if v == verb || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// InstallIdentity structure with the objects defining the identity used by the installer.
+type InstallIdentity struct {
+	ServiceAccount     *v1.ServiceAccount
+	ClusterRole        *rbacV1.ClusterRole
+	ClusterRoleBinding *rbacV1.ClusterRoleBinding
+	// TokenSecret requests a long lived token for the service account, as it is not automatically created
+	// on newer clusters.
+	TokenSecret *v1.Secret
+}
+
+// NewInstallIdentity creates the objects of an install identity.
+//   params:
+//     name The name of the service account, role and binding.
+//     namespace The namespace of the service account.
+//     accesses The accesses performed by the commands of the workflow.
+//   returns:
+//     The install identity.
+func NewInstallIdentity(name string, namespace string, accesses []ObjectAccess) *InstallIdentity {
+	labels := map[string]string{"component": "installer-identity"}
+	return &InstallIdentity{
+		ServiceAccount: &v1.ServiceAccount{
+			TypeMeta:   metaV1.TypeMeta{Kind: "ServiceAccount", APIVersion: "v1"},
+			ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		},
+		ClusterRole: &rbacV1.ClusterRole{
+			TypeMeta:   metaV1.TypeMeta{Kind: "ClusterRole", APIVersion: "rbac.authorization.k8s.io/v1"},
+			ObjectMeta: metaV1.ObjectMeta{Name: name, Labels: labels},
+			Rules:      PolicyRules(accesses),
+		},
+		ClusterRoleBinding: &rbacV1.ClusterRoleBinding{
+			TypeMeta:   metaV1.TypeMeta{Kind: "ClusterRoleBinding", APIVersion: "rbac.authorization.k8s.io/v1"},
+			ObjectMeta: metaV1.ObjectMeta{Name: name, Labels: labels},
+			Subjects: []rbacV1.Subject{{
+				Kind:      "ServiceAccount",
+				Name:      name,
+				Namespace: namespace,
+			}},
+			RoleRef: rbacV1.RoleRef{
+				APIGroup: rbacGroup,
+				Kind:     "ClusterRole",
+				Name:     name,
+			},
+		},
+		TokenSecret: &v1.Secret{
+			TypeMeta: metaV1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:        fmt.Sprintf("%s-token", name),
+				Namespace:   namespace,
+				Labels:      labels,
+				Annotations: map[string]string{v1.ServiceAccountNameKey: name},
+			},
+			Type: v1.SecretTypeServiceAccountToken,
+		},
+	}
+}
+
+// Objects returns the objects of the identity in creation order.
+func (ii *InstallIdentity) Objects() []runtime.Object {
+	return []runtime.Object{ii.ServiceAccount, ii.ClusterRole, ii.ClusterRoleBinding, ii.TokenSecret}
+}
+
+// CreateInstallIdentity creates the objects of an install identity, skipping the ones that already exist. The
+// credentials used must be allowed to grant the permissions of the identity.
+func (k *Kubernetes) CreateInstallIdentity(identity *InstallIdentity) derrors.Error {
+	exists, err := k.ExistsNamespace(identity.ServiceAccount.Namespace)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return derrors.NewNotFoundError("namespace of the install identity not found").WithParams(identity.ServiceAccount.Namespace)
+	}
+	for _, obj := range identity.Objects() {
+		gvk, err := getKind(obj)
+		if err != nil {
+			return err
+		}
+		objMeta, mErr := meta.Accessor(obj)
+		if mErr != nil {
+			return derrors.NewInternalError("cannot access object metadata", mErr)
+		}
+		plural, _ := meta.UnsafeGuessKindToResource(gvk)
+		exists, err := k.ExistsEntity(objMeta.GetNamespace(), gvk.Group, gvk.Version, plural.Resource, objMeta.GetName())
+		if err != nil {
+			return err
+		}
+		if exists {
+			log.Info().Str("kind", gvk.Kind).Str("name", objMeta.GetName()).Msg("install identity object already exists")
+			continue
+		}
+		if err := k.Create(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InstallIdentityKubeConfig builds a kubeconfig file for an install identity. The token of the service account is
+// waited for as it is issued asynchronously by the cluster.
+//   params:
+//     identity The install identity previously created.
+//     timeout The maximum time to wait for the token.
+//   returns:
+//     The content of the kubeconfig file.
+//     An error if the token is not issued.
+func (k *Kubernetes) InstallIdentityKubeConfig(identity *InstallIdentity, timeout time.Duration) ([]byte, derrors.Error) {
+	restConfig, err := k.RestConfig()
+	if err != nil {
+		return nil, err
+	}
+	client := k.Client.CoreV1().Secrets(identity.TokenSecret.Namespace)
+	deadline := time.Now().Add(timeout)
+	var secret *v1.Secret
+	for {
+		found, gErr := client.Get(identity.TokenSecret.Name, metaV1.GetOptions{})
+		if gErr != nil {
+			return nil, derrors.AsError(gErr, "cannot retrieve token secret")
+		}
+		if len(found.Data[v1.ServiceAccountTokenKey]) > 0 {
+			secret = found
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, derrors.NewUnavailableError("service account token has not been issued").WithParams(identity.TokenSecret.Name)
+		}
+		log.Debug().Str("secret", identity.TokenSecret.Name).Msg("waiting for service account token")
+		time.Sleep(time.Second)
+	}
+
+	name := identity.ServiceAccount.Name
+	config := clientcmdapi.NewConfig()
+	config.Clusters[name] = &clientcmdapi.Cluster{
+		Server:                   restConfig.Host,
+		CertificateAuthorityData: secret.Data[v1.ServiceAccountRootCAKey],
+	}
+	config.AuthInfos[name] = &clientcmdapi.AuthInfo{
+		Token: string(secret.Data[v1.ServiceAccountTokenKey]),
+	}
+	config.Contexts[name] = &clientcmdapi.Context{
+		Cluster:   name,
+		AuthInfo:  name,
+		Namespace: identity.ServiceAccount.Namespace,
+	}
+	config.CurrentContext = name
+	content, wErr := clientcmd.Write(*config)
+	if wErr != nil {
+		return nil, derrors.NewInternalError("cannot write kubeconfig", wErr)
+	}
+	return content, nil
+}
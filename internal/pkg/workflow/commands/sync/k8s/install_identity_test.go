@@ -0,0 +1,64 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	rbacV1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = ginkgo.Describe("Install identity", func() {
+
+	ginkgo.It("should merge the accesses to the same resource", func() {
+		rules := PolicyRules([]ObjectAccess{
+			Access("", "secrets", CreateVerbs),
+			Access("", "secrets", DeleteVerbs),
+			Access("", "configmaps", CreateVerbs, DeleteVerbs),
+		})
+		gomega.Expect(rules).To(gomega.Equal([]rbacV1.PolicyRule{{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps", "secrets"},
+			Verbs:     []string{"create", "delete", "get", "list"},
+		}}))
+	})
+
+	ginkgo.It("should derive the resource from the kind", func() {
+		access := KindAccess(schema.GroupVersionKind{Group: "policy", Version: "v1beta1", Kind: "PodSecurityPolicy"}, CreateVerbs)
+		gomega.Expect(access.Group).To(gomega.Equal("policy"))
+		gomega.Expect(access.Resource).To(gomega.Equal("podsecuritypolicies"))
+	})
+
+	ginkgo.It("should allow granting the created roles", func() {
+		rules := PolicyRules([]ObjectAccess{Access(rbacGroup, "clusterrolebindings", CreateVerbs)})
+		gomega.Expect(rules).To(gomega.HaveLen(2))
+		gomega.Expect(rules[0].Resources).To(gomega.Equal([]string{"clusterrolebindings"}))
+		gomega.Expect(rules[1].Resources).To(gomega.Equal([]string{"clusterroles", "roles"}))
+		gomega.Expect(rules[1].Verbs).To(gomega.Equal([]string{"bind", "escalate"}))
+	})
+
+	ginkgo.It("should bind the role to the service account", func() {
+		identity := NewInstallIdentity("installer", "kube-system", []ObjectAccess{Access("", "secrets", CreateVerbs)})
+		gomega.Expect(identity.ClusterRole.Rules).To(gomega.HaveLen(1))
+		gomega.Expect(identity.ClusterRoleBinding.RoleRef.Name).To(gomega.Equal(identity.ClusterRole.Name))
+		gomega.Expect(identity.ClusterRoleBinding.Subjects[0].Name).To(gomega.Equal(identity.ServiceAccount.Name))
+		gomega.Expect(identity.TokenSecret.Annotations).To(gomega.HaveKeyWithValue("kubernetes.io/service-account.name", "installer"))
+		gomega.Expect(identity.Objects()).To(gomega.HaveLen(4))
+	})
+})
@@ -0,0 +1,234 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	"k8s.io/api/core/v1"
+	networkingV1 "k8s.io/api/networking/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+)
+
+// NetworkZoneLabel is the namespace label used by the network policies to identify the origin of the traffic.
+const NetworkZoneLabel = "installer.nalej.com/network-zone"
+
+// PlatformZone is the network zone of the namespaces of the platform.
+const PlatformZone = "platform"
+
+// ControlPlaneZone is the network zone of the namespaces whose traffic is allowed into the platform, such as the
+// ones of Istio or the ingress controller.
+const ControlPlaneZone = "control-plane"
+
+// Names of the network policies installed on each platform namespace.
+const (
+	DenyAllPolicy          = "nalej-default-deny"
+	AllowPlatformPolicy    = "nalej-allow-platform"
+	AllowExposedPolicyName = "nalej-allow-exposed-%s"
+)
+
+// DefaultControlPlaneNamespaces contains the namespaces allowed to reach the platform if none are specified.
+var DefaultControlPlaneNamespaces = []string{"kube-system", "istio-system", "ingress-nginx"}
+
+// InstallNetworkPolicies structure with the attributes required to restrict the traffic between the platform
+// namespaces and the rest of namespaces of the cluster, including the ones of the applications.
+type InstallNetworkPolicies struct {
+	// Kubernetes embedded object
+	Kubernetes
+	// PlatformNamespaces with the namespaces to be protected.
+	PlatformNamespaces []string `json:"platform_namespaces"`
+	// ControlPlaneNamespaces with the namespaces whose traffic is allowed into the platform namespaces.
+	ControlPlaneNamespaces []string `json:"control_plane_namespaces"`
+}
+
+// NewInstallNetworkPolicies creates a new InstallNetworkPolicies command.
+func NewInstallNetworkPolicies(kubeConfigPath string, platformNamespaces []string, controlPlaneNamespaces []string) *InstallNetworkPolicies {
+	return &InstallNetworkPolicies{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.InstallNetworkPolicies),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		PlatformNamespaces:     platformNamespaces,
+		ControlPlaneNamespaces: controlPlaneNamespaces,
+	}
+}
+
+// NewInstallNetworkPoliciesFromJSON creates a new InstallNetworkPolicies command from a raw JSON representation.
+func NewInstallNetworkPoliciesFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	inp := &InstallNetworkPolicies{}
+	if err := json.Unmarshal(raw, &inp); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	if inp.ControlPlaneNamespaces == nil {
+		inp.ControlPlaneNamespaces = DefaultControlPlaneNamespaces
+	}
+	inp.CommandID = entities.GenerateCommandID(inp.Name())
+	var r entities.Command = inp
+	return &r, nil
+}
+
+// Run the current command returning the result or an error.
+func (inp *InstallNetworkPolicies) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := inp.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+
+	// Label the namespaces so the policies can select the origin of the traffic.
+	for _, namespace := range inp.ControlPlaneNamespaces {
+		exists, err := inp.ExistsNamespace(namespace)
+		if err != nil {
+			return entities.NewCommandResult(false, "cannot determine if the namespace exists", err), nil
+		}
+		if !exists {
+			log.Debug().Str("namespace", namespace).Msg("control plane namespace not found, skipping")
+			continue
+		}
+		if err := inp.EnsureNamespace(namespace, NamespaceOptions{Labels: map[string]string{NetworkZoneLabel: ControlPlaneZone}}); err != nil {
+			return entities.NewCommandResult(false, "cannot label control plane namespace", err), nil
+		}
+	}
+
+	numPolicies := 0
+	for _, namespace := range inp.PlatformNamespaces {
+		if err := inp.EnsureNamespace(namespace, NamespaceOptions{Labels: map[string]string{NetworkZoneLabel: PlatformZone}}); err != nil {
+			return entities.NewCommandResult(false, "cannot create platform namespace", err), nil
+		}
+		policies, err := inp.getPolicies(namespace)
+		if err != nil {
+			return entities.NewCommandResult(false, "cannot build network policies", err), nil
+		}
+		for _, policy := range policies {
+			created, err := inp.createPolicyIfNotExists(policy)
+			if err != nil {
+				return entities.NewCommandResult(false, "cannot create network policy", err), nil
+			}
+			if created {
+				numPolicies++
+			}
+		}
+	}
+	msg := fmt.Sprintf("%d network policies have been installed", numPolicies)
+	return entities.NewSuccessCommand([]byte(msg)), nil
+}
+
+// getPolicies retrieves the services of a platform namespace and builds its network policies.
+func (inp *InstallNetworkPolicies) getPolicies(namespace string) ([]*networkingV1.NetworkPolicy, derrors.Error) {
+	services, err := inp.Client.CoreV1().Services(namespace).List(metaV1.ListOptions{})
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot list services")
+	}
+	return NetworkPolicies(namespace, services.Items), nil
+}
+
+// NetworkPolicies builds the network policies of a platform namespace. All incoming traffic is denied except the
+// one coming from the platform and control plane namespaces, and the one targeting the pods exposed outside the
+// cluster through LoadBalancer or NodePort services.
+//   params:
+//     namespace The platform namespace.
+//     services The services of the namespace.
+//   returns:
+//     The list of network policies.
+func NetworkPolicies(namespace string, services []v1.Service) []*networkingV1.NetworkPolicy {
+	result := []*networkingV1.NetworkPolicy{
+		newNetworkPolicy(namespace, DenyAllPolicy, metaV1.LabelSelector{}, nil),
+		newNetworkPolicy(namespace, AllowPlatformPolicy, metaV1.LabelSelector{}, []networkingV1.NetworkPolicyIngressRule{{
+			From: []networkingV1.NetworkPolicyPeer{{
+				NamespaceSelector: &metaV1.LabelSelector{
+					MatchExpressions: []metaV1.LabelSelectorRequirement{{
+						Key:      NetworkZoneLabel,
+						Operator: metaV1.LabelSelectorOpIn,
+						Values:   []string{PlatformZone, ControlPlaneZone},
+					}},
+				},
+			}},
+		}}),
+	}
+	for _, service := range services {
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer && service.Spec.Type != v1.ServiceTypeNodePort {
+			continue
+		}
+		if len(service.Spec.Selector) == 0 {
+			continue
+		}
+		selector := metaV1.LabelSelector{MatchLabels: service.Spec.Selector}
+		name := fmt.Sprintf(AllowExposedPolicyName, service.Name)
+		// An empty rule allows the traffic from any origin, including the external one.
+		result = append(result, newNetworkPolicy(namespace, name, selector, []networkingV1.NetworkPolicyIngressRule{{}}))
+	}
+	return result
+}
+
+// newNetworkPolicy creates an ingress network policy.
+func newNetworkPolicy(namespace string, name string, podSelector metaV1.LabelSelector, rules []networkingV1.NetworkPolicyIngressRule) *networkingV1.NetworkPolicy {
+	return &networkingV1.NetworkPolicy{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "NetworkPolicy",
+			APIVersion: "networking.k8s.io/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"cluster":   "management",
+				"component": "network-policies",
+			},
+		},
+		Spec: networkingV1.NetworkPolicySpec{
+			PodSelector: podSelector,
+			Ingress:     rules,
+			PolicyTypes: []networkingV1.PolicyType{networkingV1.PolicyTypeIngress},
+		},
+	}
+}
+
+// createPolicyIfNotExists creates a network policy unless it has already been installed.
+func (inp *InstallNetworkPolicies) createPolicyIfNotExists(policy *networkingV1.NetworkPolicy) (bool, derrors.Error) {
+	exists, err := inp.ExistsEntity(policy.Namespace, "networking.k8s.io", "v1", "networkpolicies", policy.Name)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		log.Debug().Str("namespace", policy.Namespace).Str("name", policy.Name).Msg("network policy already exists")
+		return false, nil
+	}
+	if err := inp.Create(policy); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// String returns a string representation
+func (inp *InstallNetworkPolicies) String() string {
+	return fmt.Sprintf("SYNC InstallNetworkPolicies on %s", strings.Join(inp.PlatformNamespaces, ","))
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (inp *InstallNetworkPolicies) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + inp.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (inp *InstallNetworkPolicies) UserString() string {
+	return fmt.Sprintf("Installing network policies on %s", strings.Join(inp.PlatformNamespaces, ", "))
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newService creates a service of a given type selecting the pods of an application.
+func newService(name string, serviceType v1.ServiceType) v1.Service {
+	return v1.Service{
+		ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: "nalej"},
+		Spec: v1.ServiceSpec{
+			Type:     serviceType,
+			Selector: map[string]string{"app": name},
+		},
+	}
+}
+
+var _ = ginkgo.Describe("Network policies", func() {
+
+	ginkgo.It("should deny the traffic not coming from the platform", func() {
+		policies := NetworkPolicies("nalej", nil)
+		gomega.Expect(policies).To(gomega.HaveLen(2))
+
+		deny := policies[0]
+		gomega.Expect(deny.Name).To(gomega.Equal(DenyAllPolicy))
+		gomega.Expect(deny.Namespace).To(gomega.Equal("nalej"))
+		gomega.Expect(deny.Spec.PodSelector.MatchLabels).To(gomega.BeEmpty())
+		gomega.Expect(deny.Spec.Ingress).To(gomega.BeEmpty())
+
+		allow := policies[1]
+		gomega.Expect(allow.Name).To(gomega.Equal(AllowPlatformPolicy))
+		gomega.Expect(allow.Spec.Ingress).To(gomega.HaveLen(1))
+		selector := allow.Spec.Ingress[0].From[0].NamespaceSelector
+		gomega.Expect(selector.MatchExpressions[0].Key).To(gomega.Equal(NetworkZoneLabel))
+		gomega.Expect(selector.MatchExpressions[0].Values).To(gomega.ConsistOf(PlatformZone, ControlPlaneZone))
+	})
+
+	ginkgo.It("should allow the traffic into the exposed services", func() {
+		services := []v1.Service{
+			newService("ingress", v1.ServiceTypeLoadBalancer),
+			newService("vpn", v1.ServiceTypeNodePort),
+			newService("internal", v1.ServiceTypeClusterIP),
+		}
+		policies := NetworkPolicies("nalej", services)
+		gomega.Expect(policies).To(gomega.HaveLen(4))
+		gomega.Expect(policies[2].Name).To(gomega.Equal("nalej-allow-exposed-ingress"))
+		gomega.Expect(policies[2].Spec.PodSelector.MatchLabels).To(gomega.Equal(map[string]string{"app": "ingress"}))
+		gomega.Expect(policies[2].Spec.Ingress).To(gomega.HaveLen(1))
+		gomega.Expect(policies[2].Spec.Ingress[0].From).To(gomega.BeEmpty())
+		gomega.Expect(policies[3].Name).To(gomega.Equal("nalej-allow-exposed-vpn"))
+	})
+})
@@ -0,0 +1,344 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Internal CA
+// Air-gapped installs cannot reach Let's Encrypt, so the ingress certificates are issued by a cert-manager CA issuer
+// instead. The CA is provided by the operator or generated on the first install and kept on later ones, and its
+// certificate is published on a ConfigMap so it can be distributed to the application clusters and to the clients
+// that must trust it.
+//
+// {"type":"sync", "name":"createInternalCA", "kubeConfigPath":"/path/to/kubeconfig", "domain":"nalej.tech"}
+
+package k8s
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/pki"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Modes selecting the issuer of the ingress certificates.
+const (
+	// LetsEncryptMode issues the certificates with ACME from Let's Encrypt.
+	LetsEncryptMode = "letsencrypt"
+	// InternalCAMode issues the certificates from the internal CA.
+	InternalCAMode = "internal"
+)
+
+// LetsEncryptIssuer is the cert-manager cluster issuer requesting the certificates to Let's Encrypt.
+const LetsEncryptIssuer = "letsencrypt"
+
+// InternalCAIssuer is the cert-manager cluster issuer signing the certificates with the internal CA.
+const InternalCAIssuer = "internal-ca"
+
+// InternalCAName is the name of the secret with the internal CA and of the ConfigMap publishing its certificate.
+const InternalCAName = "internal-ca"
+
+// CertManagerNamespace is the namespace where cert-manager reads the secrets of the cluster issuers.
+const CertManagerNamespace = "cert-manager"
+
+// InternalCAValidity is the validity of the generated CAs.
+const InternalCAValidity = time.Hour * 24 * 365 * 10
+
+// CertificateIssuerModes returns the supported certificate issuer modes.
+func CertificateIssuerModes() []string {
+	return []string{LetsEncryptMode, InternalCAMode}
+}
+
+// ValidateCertificateIssuer checks that a certificate issuer mode is supported, an empty one being Let's Encrypt.
+func ValidateCertificateIssuer(mode string) derrors.Error {
+	switch mode {
+	case "", LetsEncryptMode, InternalCAMode:
+		return nil
+	}
+	return derrors.NewInvalidArgumentError("unsupported certificate issuer").WithParams(mode, CertificateIssuerModes())
+}
+
+// ValidateInternalCAPaths checks the files of a CA provided by the operator, which must be set together and only
+// when the certificates are issued by the internal CA.
+//   params:
+//     mode The certificate issuer mode.
+//     certPath The path of the certificate of the CA.
+//     keyPath The path of the private key of the CA.
+//   returns:
+//     An error if the paths are not consistent with the mode.
+func ValidateInternalCAPaths(mode string, certPath string, keyPath string) derrors.Error {
+	if (certPath == "") != (keyPath == "") {
+		return derrors.NewInvalidArgumentError("the certificate and the private key of the internal CA must be set together")
+	}
+	if certPath != "" && mode != InternalCAMode {
+		return derrors.NewInvalidArgumentError("the internal CA can only be set with the internal certificate issuer").WithParams(mode)
+	}
+	return nil
+}
+
+// CertificateIssuerName returns the cert-manager cluster issuer of a certificate issuer mode.
+func CertificateIssuerName(mode string) string {
+	if mode == InternalCAMode {
+		return InternalCAIssuer
+	}
+	return LetsEncryptIssuer
+}
+
+// ParseCA checks that a certificate and its private key can be used to sign other certificates.
+//   params:
+//     certPEM The PEM encoded certificate.
+//     keyPEM The PEM encoded private key.
+//   returns:
+//     The parsed certificate.
+//     An error if the certificate does not match the key, is not a CA, or has expired.
+func ParseCA(certPEM []byte, keyPEM []byte) (*x509.Certificate, derrors.Error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("CA certificate does not match its private key", err)
+	}
+	ca, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse CA certificate", err)
+	}
+	if !ca.IsCA || ca.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, derrors.NewInvalidArgumentError("certificate cannot sign other certificates").WithParams(ca.Subject.String())
+	}
+	if time.Now().After(ca.NotAfter) {
+		return nil, derrors.NewFailedPreconditionError("CA certificate has expired").WithParams(ca.NotAfter.String())
+	}
+	return ca, nil
+}
+
+// CAFingerprint returns the SHA-256 fingerprint of a certificate, as shown by the operators to check the CA they trust.
+func CAFingerprint(ca *x509.Certificate) string {
+	hash := sha256.Sum256(ca.Raw)
+	return hex.EncodeToString(hash[:])
+}
+
+// NewInternalCAIssuer creates the cert-manager cluster issuer signing with the CA of a secret.
+func NewInternalCAIssuer(secretName string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "certmanager.k8s.io/v1alpha1",
+		"kind":       "ClusterIssuer",
+		"metadata": map[string]interface{}{
+			"name": InternalCAIssuer,
+		},
+		"spec": map[string]interface{}{
+			"ca": map[string]interface{}{
+				"secretName": secretName,
+			},
+		},
+	}}
+}
+
+// NewInternalCAConfigMap creates the ConfigMap publishing the certificate of the internal CA.
+func NewInternalCAConfigMap(namespace string, certPEM []byte, fingerprint string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        InternalCAName,
+			Namespace:   namespace,
+			Annotations: map[string]string{CertificateFingerprintAnnotation: fingerprint},
+		},
+		Data: map[string]string{CACertificateKey: string(certPEM)},
+	}
+}
+
+// CreateInternalCA command creates the CA issuing the ingress certificates when Let's Encrypt cannot be reached.
+type CreateInternalCA struct {
+	Kubernetes
+	// Domain with the management domain, used in the subject of the generated CA.
+	Domain string `json:"domain"`
+	// CACertPath and CAKeyPath with a CA provided by the operator. If not set, the CA of a previous install is kept,
+	// or a new one is generated.
+	CACertPath string `json:"ca_cert_path"`
+	CAKeyPath  string `json:"ca_key_path"`
+	// Namespace where cert-manager reads the secret of the issuer, CertManagerNamespace if not set.
+	Namespace string `json:"namespace"`
+	// PublishNamespaces where the ConfigMap with the certificate of the CA is created.
+	PublishNamespaces []string `json:"publish_namespaces"`
+	// CAOutputPath with a file where the certificate of the CA is written for the operator, if set.
+	CAOutputPath string `json:"ca_output_path"`
+}
+
+// NewCreateInternalCA creates a new CreateInternalCA command generating the CA if it does not exist.
+func NewCreateInternalCA(kubeConfigPath string, domain string) *CreateInternalCA {
+	return &CreateInternalCA{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.CreateInternalCA),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Domain:            domain,
+		Namespace:         CertManagerNamespace,
+		PublishNamespaces: []string{TargetNamespace},
+	}
+}
+
+// NewCreateInternalCAFromJSON creates a new CreateInternalCA command from a raw JSON representation.
+func NewCreateInternalCAFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	cic := &CreateInternalCA{}
+	if err := json.Unmarshal(raw, &cic); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	if cic.Namespace == "" {
+		cic.Namespace = CertManagerNamespace
+	}
+	if len(cic.PublishNamespaces) == 0 {
+		cic.PublishNamespaces = []string{TargetNamespace}
+	}
+	cic.CommandID = entities.GenerateCommandID(cic.Name())
+	var r entities.Command = cic
+	return &r, nil
+}
+
+// loadCA returns the certificate and the key of the CA, read from the provided files, from the secret of a previous
+// install, or generated.
+//   returns:
+//     The CA with its key.
+//     Whether the secret must be written.
+//     An error if the CA cannot be loaded or is not valid.
+func (cic *CreateInternalCA) loadCA() (*Certificate, bool, derrors.Error) {
+	if cic.CACertPath != "" {
+		ca, err := LoadCertificateFiles(cic.CACertPath, cic.CAKeyPath)
+		if err != nil {
+			return nil, false, err
+		}
+		return ca, true, nil
+	}
+	secret, getErr := cic.Client.CoreV1().Secrets(cic.Namespace).Get(InternalCAName, metaV1.GetOptions{})
+	if getErr == nil {
+		return &Certificate{Cert: secret.Data[v1.TLSCertKey], Key: secret.Data[v1.TLSPrivateKeyKey]}, false, nil
+	}
+	if !k8sErrors.IsNotFound(getErr) {
+		return nil, false, AsQueryError(getErr, "cannot retrieve internal CA", cic.Namespace, InternalCAName)
+	}
+	generated, err := pki.SelfSigned(pki.Request{
+		Subject: pkix.Name{
+			Organization: []string{"Nalej"},
+			CommonName:   fmt.Sprintf("Nalej internal CA %s", cic.Domain),
+		},
+		Validity:       InternalCAValidity,
+		IsCA:           true,
+		MaxPathLenZero: true,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	log.Info().Str("domain", cic.Domain).Msg("internal CA generated")
+	return &Certificate{Cert: generated.CertPEM, Key: generated.KeyPEM}, true, nil
+}
+
+// writeSecret stores the CA on the secret read by the cluster issuer.
+func (cic *CreateInternalCA) writeSecret(ca *Certificate) derrors.Error {
+	secret := &v1.Secret{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      InternalCAName,
+			Namespace: cic.Namespace,
+		},
+		Data: map[string][]byte{
+			v1.TLSCertKey:       ca.Cert,
+			v1.TLSPrivateKeyKey: ca.Key,
+		},
+		Type: v1.SecretTypeTLS,
+	}
+	return cic.Apply(secret, ApplyOptions{}, &ApplySummary{})
+}
+
+// Run the current command.
+//   returns:
+//     The CommandResult
+//     An error if the command execution fails
+func (cic *CreateInternalCA) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := cic.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	if err := cic.EnsureNamespace(cic.Namespace, NamespaceOptions{}); err != nil {
+		return entities.NewCommandResult(false, "cannot create namespace", err), nil
+	}
+	ca, write, err := cic.loadCA()
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot load internal CA", err), nil
+	}
+	parsed, err := ParseCA(ca.Cert, ca.Key)
+	if err != nil {
+		return entities.NewCommandResult(false, errors.Coded(errors.CertInvalid, "invalid internal CA"), err), nil
+	}
+	fingerprint := CAFingerprint(parsed)
+	if write {
+		if err := cic.writeSecret(ca); err != nil {
+			return entities.NewCommandResult(false, "cannot store internal CA", err), nil
+		}
+	}
+	summary := &ApplySummary{}
+	if err := cic.Apply(NewInternalCAIssuer(InternalCAName), ApplyOptions{}, summary); err != nil {
+		return entities.NewCommandResult(false, "cannot create internal CA issuer", err), nil
+	}
+	for _, namespace := range cic.PublishNamespaces {
+		if err := cic.EnsureNamespace(namespace, NamespaceOptions{}); err != nil {
+			return entities.NewCommandResult(false, "cannot create namespace", err), nil
+		}
+		if err := cic.Apply(NewInternalCAConfigMap(namespace, ca.Cert, fingerprint), ApplyOptions{}, summary); err != nil {
+			return entities.NewCommandResult(false, "cannot publish internal CA", err), nil
+		}
+	}
+	if cic.CAOutputPath != "" {
+		if wErr := ioutil.WriteFile(cic.CAOutputPath, ca.Cert, 0644); wErr != nil {
+			return entities.NewCommandResult(false, "cannot write internal CA", derrors.AsError(wErr, errors.IOError)), nil
+		}
+	}
+	log.Info().Str("fingerprint", fingerprint).Time("expiration", parsed.NotAfter).Strs("namespaces", cic.PublishNamespaces).
+		Msg("internal CA ready, clients must trust it to reach the ingresses")
+	msg := fmt.Sprintf("internal CA %s issuing as %s, certificate published on ConfigMap %s of %s",
+		fingerprint, InternalCAIssuer, InternalCAName, strings.Join(cic.PublishNamespaces, ","))
+	return entities.NewSuccessCommand([]byte(msg)).WithObjects(summary.Applied()), nil
+}
+
+// String returns a string representation
+func (cic *CreateInternalCA) String() string {
+	return fmt.Sprintf("SYNC CreateInternalCA %s", cic.Domain)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (cic *CreateInternalCA) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + cic.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (cic *CreateInternalCA) UserString() string {
+	return fmt.Sprintf("Creating internal CA for %s", cic.Domain)
+}
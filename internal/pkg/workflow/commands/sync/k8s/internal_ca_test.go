@@ -0,0 +1,112 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = ginkgo.Describe("A CreateInternalCA command", func() {
+
+	var cluster *k8stest.FakeCluster
+
+	ginkgo.BeforeEach(func() {
+		cluster = newFakeCluster()
+		cluster.AddResource(k8stest.Resource{GroupVersion: "certmanager.k8s.io/v1alpha1", Name: "clusterissuers",
+			Kind: "ClusterIssuer"})
+	})
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	publishedCA := func() *v1.ConfigMap {
+		configMap, err := cluster.Client.CoreV1().ConfigMaps(TargetNamespace).Get(InternalCAName, metaV1.GetOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+		return configMap
+	}
+
+	ginkgo.It("should validate the certificate issuer modes", func() {
+		gomega.Expect(ValidateCertificateIssuer("")).To(gomega.Succeed())
+		gomega.Expect(ValidateCertificateIssuer(InternalCAMode)).To(gomega.Succeed())
+		gomega.Expect(ValidateCertificateIssuer("selfsigned")).NotTo(gomega.Succeed())
+		gomega.Expect(CertificateIssuerName("")).To(gomega.Equal(LetsEncryptIssuer))
+		gomega.Expect(CertificateIssuerName(InternalCAMode)).To(gomega.Equal(InternalCAIssuer))
+		gomega.Expect(ValidateInternalCAPaths(InternalCAMode, "ca.crt", "")).NotTo(gomega.Succeed())
+		gomega.Expect(ValidateInternalCAPaths(LetsEncryptMode, "ca.crt", "ca.key")).NotTo(gomega.Succeed())
+		gomega.Expect(ValidateInternalCAPaths(InternalCAMode, "ca.crt", "ca.key")).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should generate the CA and create its issuer", func() {
+		result, err := NewCreateInternalCA(cluster.KubeConfigPath, "nalej.tech").Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+
+		issuer := cluster.ExpectObject("certmanager.k8s.io/v1alpha1", "ClusterIssuer", "", InternalCAIssuer)
+		secretName, _, _ := unstructured.NestedString(issuer.Object, "spec", "ca", "secretName")
+		gomega.Expect(secretName).To(gomega.Equal(InternalCAName))
+		secret, gErr := cluster.Client.CoreV1().Secrets(CertManagerNamespace).Get(InternalCAName, metaV1.GetOptions{})
+		gomega.Expect(gErr).To(gomega.Succeed())
+		ca, err := ParseCA(secret.Data[v1.TLSCertKey], secret.Data[v1.TLSPrivateKeyKey])
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(ca.Subject.CommonName).To(gomega.ContainSubstring("nalej.tech"))
+
+		published := publishedCA()
+		gomega.Expect(published.Data[CACertificateKey]).To(gomega.Equal(string(secret.Data[v1.TLSCertKey])))
+		gomega.Expect(published.Annotations).To(gomega.HaveKeyWithValue(CertificateFingerprintAnnotation, CAFingerprint(ca)))
+		gomega.Expect(result.Output).To(gomega.ContainSubstring(CAFingerprint(ca)))
+	})
+
+	ginkgo.It("should keep the CA of a previous install", func() {
+		_, err := NewCreateInternalCA(cluster.KubeConfigPath, "nalej.tech").Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		fingerprint := publishedCA().Annotations[CertificateFingerprintAnnotation]
+
+		result, err := NewCreateInternalCA(cluster.KubeConfigPath, "nalej.tech").Run("w2")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(publishedCA().Annotations).To(gomega.HaveKeyWithValue(CertificateFingerprintAnnotation, fingerprint))
+	})
+
+	ginkgo.It("should reject a provided certificate that is not a CA", func() {
+		dir, tErr := ioutil.TempDir("", "internalca")
+		gomega.Expect(tErr).To(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		leaf := newTestCertificate(time.Now().Add(24*time.Hour), "*.nalej.tech")
+		gomega.Expect(ioutil.WriteFile(filepath.Join(dir, "ca.crt"), leaf.Cert, 0600)).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(filepath.Join(dir, "ca.key"), leaf.Key, 0600)).To(gomega.Succeed())
+
+		cmd := NewCreateInternalCA(cluster.KubeConfigPath, "nalej.tech")
+		cmd.CACertPath = filepath.Join(dir, "ca.crt")
+		cmd.CAKeyPath = filepath.Join(dir, "ca.key")
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+		cluster.ExpectNoObject("v1", "Secret", CertManagerNamespace, InternalCAName)
+	})
+})
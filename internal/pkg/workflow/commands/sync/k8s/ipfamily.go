@@ -0,0 +1,174 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// IP families
+// Services are created with the IP families of the addresses they expose so the installer works on IPv6 only and
+// dual-stack clusters. The ipFamilies and ipFamilyPolicy fields of the services are only served from Kubernetes 1.20,
+// and the typed services of the client do not contain them, so they are set on the unstructured representation.
+
+package k8s
+
+import (
+	"net"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// IP families of the addresses of a service.
+const (
+	IPv4Family = "IPv4"
+	IPv6Family = "IPv6"
+)
+
+// Policies selecting the number of IP families of a service.
+const (
+	// SingleStackPolicy assigns a single IP family.
+	SingleStackPolicy = "SingleStack"
+	// PreferDualStackPolicy assigns both families on dual-stack clusters and a single one otherwise.
+	PreferDualStackPolicy = "PreferDualStack"
+	// RequireDualStackPolicy assigns both families, failing on single stack clusters.
+	RequireDualStackPolicy = "RequireDualStack"
+)
+
+// IPFamilyOf returns the IP family of an address.
+//   params:
+//     address The IPv4 or IPv6 address.
+//   returns:
+//     The IP family.
+//     An error if the address is not valid.
+func IPFamilyOf(address string) (string, derrors.Error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", derrors.NewInvalidArgumentError("invalid IP address").WithParams(address)
+	}
+	if ip.To4() != nil {
+		return IPv4Family, nil
+	}
+	return IPv6Family, nil
+}
+
+// ValidateIPFamilies checks the IP families and the policy of a service.
+//   params:
+//     families The IP families, with the primary one first.
+//     policy The IP family policy, empty to use the default of the cluster.
+//   returns:
+//     An error if the families or the policy are not valid.
+func ValidateIPFamilies(families []string, policy string) derrors.Error {
+	if len(families) > 2 {
+		return derrors.NewInvalidArgumentError("at most two IP families can be set").WithParams(families)
+	}
+	for index, family := range families {
+		if family != IPv4Family && family != IPv6Family {
+			return derrors.NewInvalidArgumentError("unsupported IP family").WithParams(family)
+		}
+		if index > 0 && families[0] == family {
+			return derrors.NewInvalidArgumentError("duplicated IP family").WithParams(families)
+		}
+	}
+	switch policy {
+	case "", PreferDualStackPolicy, RequireDualStackPolicy:
+	case SingleStackPolicy:
+		if len(families) > 1 {
+			return derrors.NewInvalidArgumentError("a single stack service cannot have two IP families").WithParams(families)
+		}
+	default:
+		return derrors.NewInvalidArgumentError("unsupported IP family policy").WithParams(policy)
+	}
+	return nil
+}
+
+// ServiceIPFamilies returns the IP families of a service exposing an address. The configured families are kept,
+// and the family of the address is used otherwise.
+//   params:
+//     families The configured IP families.
+//     policy The configured IP family policy.
+//     address The address exposed by the service, if any.
+//   returns:
+//     The IP families and policy of the service.
+//     An error if the families do not include the one of the address.
+func ServiceIPFamilies(families []string, policy string, address string) ([]string, string, derrors.Error) {
+	if err := ValidateIPFamilies(families, policy); err != nil {
+		return nil, "", err
+	}
+	if address == "" {
+		return families, policy, nil
+	}
+	family, err := IPFamilyOf(address)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(families) == 0 {
+		if policy == "" {
+			policy = SingleStackPolicy
+		}
+		return []string{family}, policy, nil
+	}
+	for _, candidate := range families {
+		if candidate == family {
+			return families, policy, nil
+		}
+	}
+	return nil, "", derrors.NewInvalidArgumentError("the IP families do not include the one of the address").WithParams(families, address)
+}
+
+// ServiceWithIPFamilies returns a service with the given IP families and policy. The service is returned unchanged
+// if no family is set, or if the cluster does not support them, in which case the family of the cluster is used.
+//   params:
+//     service The service to be created.
+//     families The IP families, with the primary one first.
+//     policy The IP family policy.
+//   returns:
+//     The service to be created.
+//     An error if the service cannot be converted.
+func (k *Kubernetes) ServiceWithIPFamilies(service *v1.Service, families []string, policy string) (runtime.Object, derrors.Error) {
+	if len(families) == 0 && policy == "" {
+		return service, nil
+	}
+	capabilities, err := k.Capabilities()
+	if err != nil {
+		return nil, err
+	}
+	if !capabilities.AtLeast(1, 20) {
+		log.Warn().Str("service", service.Name).Strs("families", families).Str("version", capabilities.GitVersion).
+			Msg("IP families ignored as the cluster does not support them")
+		return service, nil
+	}
+	content, convertErr := runtime.DefaultUnstructuredConverter.ToUnstructured(service)
+	if convertErr != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot convert object to unstructured", convertErr).WithParams(service.Name)
+	}
+	obj := &unstructured.Unstructured{Object: content}
+	if len(families) > 0 {
+		values := make([]interface{}, 0, len(families))
+		for _, family := range families {
+			values = append(values, family)
+		}
+		if setErr := unstructured.SetNestedSlice(obj.Object, values, "spec", "ipFamilies"); setErr != nil {
+			return nil, derrors.NewInternalError("cannot set the IP families", setErr).WithParams(service.Name)
+		}
+	}
+	if policy != "" {
+		if setErr := unstructured.SetNestedField(obj.Object, policy, "spec", "ipFamilyPolicy"); setErr != nil {
+			return nil, derrors.NewInternalError("cannot set the IP family policy", setErr).WithParams(service.Name)
+		}
+	}
+	return obj, nil
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = ginkgo.Describe("IP families", func() {
+
+	ginkgo.It("should derive the family from the static address", func() {
+		families, policy, err := ServiceIPFamilies(nil, "", "fd00::10")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(families).Should(gomega.Equal([]string{IPv6Family}))
+		gomega.Expect(policy).Should(gomega.Equal(SingleStackPolicy))
+
+		families, policy, err = ServiceIPFamilies([]string{IPv4Family, IPv6Family}, PreferDualStackPolicy, "fd00::10")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(families).Should(gomega.Equal([]string{IPv4Family, IPv6Family}))
+		gomega.Expect(policy).Should(gomega.Equal(PreferDualStackPolicy))
+
+		families, policy, err = ServiceIPFamilies(nil, "", "")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(families).Should(gomega.BeEmpty())
+		gomega.Expect(policy).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should reject invalid families", func() {
+		_, _, err := ServiceIPFamilies([]string{IPv4Family}, "", "fd00::10")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		_, _, err = ServiceIPFamilies(nil, "", "10.0.0")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(ValidateIPFamilies([]string{IPv4Family, IPv4Family}, "")).ShouldNot(gomega.Succeed())
+		gomega.Expect(ValidateIPFamilies([]string{IPv4Family, IPv6Family}, SingleStackPolicy)).ShouldNot(gomega.Succeed())
+		gomega.Expect(ValidateIPFamilies([]string{"IPv5"}, "")).ShouldNot(gomega.Succeed())
+		gomega.Expect(ValidateIPFamilies(nil, "DualStack")).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.Context("services", func() {
+		service := &v1.Service{
+			TypeMeta:   metaV1.TypeMeta{Kind: "Service", APIVersion: "v1"},
+			ObjectMeta: metaV1.ObjectMeta{Name: "ingress", Namespace: "nalej"},
+			Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer, LoadBalancerIP: "fd00::10"},
+		}
+
+		ginkgo.It("should set the families on clusters supporting them", func() {
+			cluster := newFakeCluster()
+			defer UnregisterClients(cluster.KubeConfigPath)
+			cluster.SetVersion("1.20")
+			k := &Kubernetes{KubeConfigPath: cluster.KubeConfigPath}
+			gomega.Expect(k.Connect()).To(gomega.Succeed())
+			obj, err := k.ServiceWithIPFamilies(service, []string{IPv6Family, IPv4Family}, RequireDualStackPolicy)
+			gomega.Expect(err).To(gomega.Succeed())
+			content := obj.(*unstructured.Unstructured).Object
+			families, _, _ := unstructured.NestedStringSlice(content, "spec", "ipFamilies")
+			gomega.Expect(families).Should(gomega.Equal([]string{IPv6Family, IPv4Family}))
+			policy, _, _ := unstructured.NestedString(content, "spec", "ipFamilyPolicy")
+			gomega.Expect(policy).Should(gomega.Equal(RequireDualStackPolicy))
+		})
+
+		ginkgo.It("should keep the service on older clusters", func() {
+			cluster := newFakeCluster()
+			defer UnregisterClients(cluster.KubeConfigPath)
+			k := &Kubernetes{KubeConfigPath: cluster.KubeConfigPath}
+			gomega.Expect(k.Connect()).To(gomega.Succeed())
+			obj, err := k.ServiceWithIPFamilies(service, []string{IPv6Family}, SingleStackPolicy)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(obj).Should(gomega.BeIdenticalTo(service))
+		})
+	})
+})
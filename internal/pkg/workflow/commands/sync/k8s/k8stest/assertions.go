@@ -0,0 +1,149 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package k8stest
+
+import (
+	"fmt"
+
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// ObjectKey identifies an object of the cluster.
+type ObjectKey struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// String returns the kind, namespace and name of the object separated by slashes.
+func (ok ObjectKey) String() string {
+	return fmt.Sprintf("%s/%s/%s", ok.Kind, ok.Namespace, ok.Name)
+}
+
+// resource returns the resource of a kind served by the cluster.
+func (fc *FakeCluster) resource(apiVersion string, kind string) (schema.GroupVersionResource, error) {
+	gvk := schema.FromAPIVersionAndKind(apiVersion, kind)
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	for gvr, resource := range fc.resources {
+		if gvr.GroupVersion() == gvk.GroupVersion() && resource.Kind == kind {
+			return gvr, nil
+		}
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("kind %s not served by the cluster", gvk.String())
+}
+
+// Object returns an object of the cluster.
+//   params:
+//     apiVersion The API version of the object, such as apps/v1.
+//     kind The kind of the object.
+//     namespace The namespace of the object, empty for objects without namespace.
+//     name The name of the object.
+//   returns:
+//     The object.
+//     An error if the object does not exist.
+func (fc *FakeCluster) Object(apiVersion string, kind string, namespace string, name string) (*unstructured.Unstructured, error) {
+	gvr, err := fc.resource(apiVersion, kind)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := fc.Tracker.Get(gvr, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return fc.toUnstructured(obj, gvr.GroupVersion().WithKind(kind))
+}
+
+// Objects returns the objects of a kind in a namespace, or in all of them if the namespace is empty.
+func (fc *FakeCluster) Objects(apiVersion string, kind string, namespace string) ([]*unstructured.Unstructured, error) {
+	gvr, err := fc.resource(apiVersion, kind)
+	if err != nil {
+		return nil, err
+	}
+	gvk := gvr.GroupVersion().WithKind(kind)
+	list, err := fc.Tracker.List(gvr, gvk, namespace)
+	if err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*unstructured.Unstructured, 0, len(items))
+	for _, item := range items {
+		converted, err := fc.toUnstructured(item, gvk)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, converted)
+	}
+	return result, nil
+}
+
+// toUnstructured converts an object of the tracker to an unstructured one of a given kind.
+func (fc *FakeCluster) toUnstructured(obj runtime.Object, gvk schema.GroupVersionKind) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.DeepCopy(), nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	result := &unstructured.Unstructured{Object: content}
+	result.SetGroupVersionKind(gvk)
+	return result, nil
+}
+
+// Created returns the objects created through the typed and dynamic clients, in order of creation for each client.
+func (fc *FakeCluster) Created() []ObjectKey {
+	result := make([]ObjectKey, 0)
+	actions := append(fc.Client.Actions(), fc.Dynamic.Actions()...)
+	for _, action := range actions {
+		create, ok := action.(k8stesting.CreateAction)
+		if !ok || action.GetSubresource() != "" {
+			continue
+		}
+		accessor, err := meta.Accessor(create.GetObject())
+		if err != nil {
+			continue
+		}
+		key := ObjectKey{Namespace: action.GetNamespace(), Name: accessor.GetName()}
+		if gvk, found := fc.kind(action.GetResource()); found {
+			key.Kind = gvk.Kind
+		}
+		result = append(result, key)
+	}
+	return result
+}
+
+// ExpectObject asserts that an object exists in the cluster and returns it.
+func (fc *FakeCluster) ExpectObject(apiVersion string, kind string, namespace string, name string) *unstructured.Unstructured {
+	obj, err := fc.Object(apiVersion, kind, namespace, name)
+	gomega.ExpectWithOffset(1, err).To(gomega.Succeed(), "%s %s/%s must exist", kind, namespace, name)
+	return obj
+}
+
+// ExpectNoObject asserts that an object does not exist in the cluster.
+func (fc *FakeCluster) ExpectNoObject(apiVersion string, kind string, namespace string, name string) {
+	_, err := fc.Object(apiVersion, kind, namespace, name)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.Succeed(), "%s %s/%s must not exist", kind, namespace, name)
+}
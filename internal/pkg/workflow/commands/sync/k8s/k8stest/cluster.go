@@ -0,0 +1,312 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+// Package k8stest provides a fake Kubernetes cluster to run the Kubernetes commands in unit tests. The typed,
+// dynamic and discovery clients of the cluster share the same objects, so the objects created by a command through
+// the dynamic client can be retrieved with the typed one and the other way around.
+
+package k8stest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/satori/go.uuid"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// KubeConfigPrefix is the prefix of the kubeconfig paths of the fake clusters.
+const KubeConfigPrefix = "fake://"
+
+// DefaultVersion is the Kubernetes version reported by the fake clusters.
+const DefaultVersion = "1.15"
+
+// Resource served by a fake cluster.
+type Resource struct {
+	// GroupVersion of the resource, such as apps/v1.
+	GroupVersion string
+	// Name of the resource, such as deployments.
+	Name string
+	// Kind of the resource, such as Deployment.
+	Kind string
+	// Namespaced indicates if the objects of the resource belong to a namespace.
+	Namespaced bool
+}
+
+// DefaultResources are the resources served by the fake clusters.
+var DefaultResources = []Resource{
+	{"v1", "namespaces", "Namespace", false},
+	{"v1", "configmaps", "ConfigMap", true},
+	{"v1", "secrets", "Secret", true},
+	{"v1", "services", "Service", true},
+	{"v1", "serviceaccounts", "ServiceAccount", true},
+	{"v1", "pods", "Pod", true},
+	{"v1", "persistentvolumes", "PersistentVolume", false},
+	{"v1", "persistentvolumeclaims", "PersistentVolumeClaim", true},
+	{"apps/v1", "deployments", "Deployment", true},
+	{"apps/v1", "daemonsets", "DaemonSet", true},
+	{"apps/v1", "statefulsets", "StatefulSet", true},
+	{"batch/v1", "jobs", "Job", true},
+	{"rbac.authorization.k8s.io/v1", "roles", "Role", true},
+	{"rbac.authorization.k8s.io/v1", "rolebindings", "RoleBinding", true},
+	{"rbac.authorization.k8s.io/v1", "clusterroles", "ClusterRole", false},
+	{"rbac.authorization.k8s.io/v1", "clusterrolebindings", "ClusterRoleBinding", false},
+	{"networking.k8s.io/v1", "networkpolicies", "NetworkPolicy", true},
+	{"extensions/v1beta1", "ingresses", "Ingress", true},
+	{"policy/v1beta1", "podsecuritypolicies", "PodSecurityPolicy", false},
+	{"apiextensions.k8s.io/v1beta1", "customresourcedefinitions", "CustomResourceDefinition", false},
+}
+
+// FakeCluster with the clients of a fake Kubernetes cluster.
+type FakeCluster struct {
+	// KubeConfigPath identifying the cluster, to be registered with the clients of the cluster.
+	KubeConfigPath string
+	// Client of the typed API.
+	Client *fake.Clientset
+	// Dynamic client.
+	Dynamic *dynamicfake.FakeDynamicClient
+	// Discovery client.
+	Discovery discovery.DiscoveryInterface
+	// Tracker with the objects of the cluster.
+	Tracker k8stesting.ObjectTracker
+	// Version reported by the discovery client.
+	Version *version.Info
+
+	scheme *runtime.Scheme
+	lock   sync.Mutex
+	// resources served by the cluster indexed by group version and name.
+	resources map[schema.GroupVersionResource]Resource
+}
+
+// NewFakeCluster creates a fake cluster with the DefaultResources containing a set of objects.
+func NewFakeCluster(objects ...runtime.Object) *FakeCluster {
+	fakeScheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(fakeScheme); err != nil {
+		panic(err)
+	}
+	tracker := k8stesting.NewObjectTracker(fakeScheme, serializer.NewCodecFactory(fakeScheme).UniversalDecoder())
+	cluster := &FakeCluster{
+		KubeConfigPath: KubeConfigPrefix + uuid.NewV4().String(),
+		Client:         fake.NewSimpleClientset(),
+		Dynamic:        dynamicfake.NewSimpleDynamicClient(fakeScheme),
+		Tracker:        tracker,
+		scheme:         fakeScheme,
+		resources:      make(map[schema.GroupVersionResource]Resource, 0),
+	}
+	cluster.SetVersion(DefaultVersion)
+	cluster.Discovery = &fakeDiscovery{
+		FakeDiscovery: &fakediscovery.FakeDiscovery{Fake: &cluster.Client.Fake},
+		cluster:       cluster,
+	}
+
+	// The reactors of the clients are replaced so both use the same tracker.
+	cluster.Client.PrependReactor("*", "*", k8stesting.ObjectReaction(tracker))
+	cluster.Client.PrependWatchReactor("*", cluster.watchReaction)
+	cluster.Dynamic.PrependReactor("*", "*", cluster.dynamicReaction)
+	cluster.Dynamic.PrependWatchReactor("*", cluster.watchReaction)
+
+	for _, resource := range DefaultResources {
+		cluster.AddResource(resource)
+	}
+	for _, obj := range objects {
+		if err := tracker.Add(obj); err != nil {
+			panic(err)
+		}
+	}
+	return cluster
+}
+
+// SetVersion sets the version reported by the cluster with the major.minor format.
+func (fc *FakeCluster) SetVersion(majorMinor string) {
+	parts := strings.SplitN(majorMinor, ".", 2)
+	minor := ""
+	if len(parts) > 1 {
+		minor = parts[1]
+	}
+	fc.Version = &version.Info{Major: parts[0], Minor: minor, GitVersion: fmt.Sprintf("v%s.0", majorMinor)}
+}
+
+// AddResource adds a resource to the ones served by the cluster, such as the one of a custom resource.
+func (fc *FakeCluster) AddResource(resource Resource) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	gv := schema.FromAPIVersionAndKind(resource.GroupVersion, resource.Kind).GroupVersion()
+	fc.resources[gv.WithResource(resource.Name)] = resource
+	// The tracker creates the lists of the kinds unknown by the scheme as unstructured lists.
+	listKind := gv.WithKind(resource.Kind + "List")
+	if !fc.scheme.Recognizes(listKind) {
+		fc.scheme.AddKnownTypeWithName(listKind, &unstructured.UnstructuredList{})
+	}
+}
+
+// kind returns the kind of a resource served by the cluster.
+func (fc *FakeCluster) kind(gvr schema.GroupVersionResource) (schema.GroupVersionKind, bool) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	resource, found := fc.resources[gvr]
+	if !found {
+		return schema.GroupVersionKind{}, false
+	}
+	return gvr.GroupVersion().WithKind(resource.Kind), true
+}
+
+// resourceLists returns the resources served by the cluster grouped by group version.
+func (fc *FakeCluster) resourceLists() []*metaV1.APIResourceList {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	byGroupVersion := make(map[string]*metaV1.APIResourceList, 0)
+	for gvr, resource := range fc.resources {
+		list, found := byGroupVersion[resource.GroupVersion]
+		if !found {
+			list = &metaV1.APIResourceList{GroupVersion: resource.GroupVersion}
+			byGroupVersion[resource.GroupVersion] = list
+		}
+		list.APIResources = append(list.APIResources, metaV1.APIResource{
+			Name:       gvr.Resource,
+			Kind:       resource.Kind,
+			Namespaced: resource.Namespaced,
+			Verbs:      metaV1.Verbs{"create", "delete", "get", "list", "patch", "update", "watch"},
+		})
+	}
+	result := make([]*metaV1.APIResourceList, 0, len(byGroupVersion))
+	for _, list := range byGroupVersion {
+		sort.Slice(list.APIResources, func(i, j int) bool { return list.APIResources[i].Name < list.APIResources[j].Name })
+		result = append(result, list)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GroupVersion < result[j].GroupVersion })
+	return result
+}
+
+// dynamicReaction stores the objects received by the dynamic client with their typed representation, so they can
+// be retrieved by the typed client. The dynamic client converts the returned objects back to unstructured ones.
+func (fc *FakeCluster) dynamicReaction(action k8stesting.Action) (bool, runtime.Object, error) {
+	switch a := action.(type) {
+	case k8stesting.CreateActionImpl:
+		a.Object = fc.typed(a.Object)
+		action = a
+	case k8stesting.UpdateActionImpl:
+		a.Object = fc.typed(a.Object)
+		action = a
+	case k8stesting.ListActionImpl:
+		// The dynamic client does not set the kind of the listed objects.
+		if gvk, found := fc.kind(a.GetResource()); found {
+			a.Kind = gvk
+		}
+		action = a
+	}
+	return k8stesting.ObjectReaction(fc.Tracker)(action)
+}
+
+// watchReaction watches the objects of the tracker.
+func (fc *FakeCluster) watchReaction(action k8stesting.Action) (bool, watch.Interface, error) {
+	w, err := fc.Tracker.Watch(action.GetResource(), action.GetNamespace())
+	return true, w, err
+}
+
+// typed converts an unstructured object to its typed representation if its kind is known by the scheme.
+func (fc *FakeCluster) typed(obj runtime.Object) runtime.Object {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return obj
+	}
+	typed, err := fc.scheme.New(u.GroupVersionKind())
+	if err != nil {
+		return obj
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, typed); err != nil {
+		return obj
+	}
+	return typed
+}
+
+// fakeDiscovery is a discovery client reporting the version and the resources of a fake cluster.
+type fakeDiscovery struct {
+	*fakediscovery.FakeDiscovery
+	cluster *FakeCluster
+}
+
+// ServerVersion returns the version of the cluster.
+func (fd *fakeDiscovery) ServerVersion() (*version.Info, error) {
+	return fd.cluster.Version, nil
+}
+
+// ServerGroups returns the groups served by the cluster.
+func (fd *fakeDiscovery) ServerGroups() (*metaV1.APIGroupList, error) {
+	groups := make([]metaV1.APIGroup, 0)
+	indexes := make(map[string]int, 0)
+	for _, list := range fd.cluster.resourceLists() {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		discovered := metaV1.GroupVersionForDiscovery{GroupVersion: list.GroupVersion, Version: gv.Version}
+		index, found := indexes[gv.Group]
+		if !found {
+			index = len(groups)
+			indexes[gv.Group] = index
+			groups = append(groups, metaV1.APIGroup{Name: gv.Group, PreferredVersion: discovered})
+		}
+		groups[index].Versions = append(groups[index].Versions, discovered)
+	}
+	return &metaV1.APIGroupList{Groups: groups}, nil
+}
+
+// ServerResourcesForGroupVersion returns the resources of a group version served by the cluster.
+func (fd *fakeDiscovery) ServerResourcesForGroupVersion(groupVersion string) (*metaV1.APIResourceList, error) {
+	for _, list := range fd.cluster.resourceLists() {
+		if list.GroupVersion == groupVersion {
+			return list, nil
+		}
+	}
+	return nil, fmt.Errorf("group version %s not found", groupVersion)
+}
+
+// ServerResources returns the resources served by the cluster.
+func (fd *fakeDiscovery) ServerResources() ([]*metaV1.APIResourceList, error) {
+	return fd.cluster.resourceLists(), nil
+}
+
+// ServerGroupsAndResources returns the groups and the resources served by the cluster.
+func (fd *fakeDiscovery) ServerGroupsAndResources() ([]*metaV1.APIGroup, []*metaV1.APIResourceList, error) {
+	groups, err := fd.ServerGroups()
+	if err != nil {
+		return nil, nil, err
+	}
+	result := make([]*metaV1.APIGroup, 0, len(groups.Groups))
+	for i := range groups.Groups {
+		result = append(result, &groups.Groups[i])
+	}
+	return result, fd.cluster.resourceLists(), nil
+}
+
+// ServerPreferredResources returns the resources of the preferred version of each group.
+func (fd *fakeDiscovery) ServerPreferredResources() ([]*metaV1.APIResourceList, error) {
+	return fd.cluster.resourceLists(), nil
+}
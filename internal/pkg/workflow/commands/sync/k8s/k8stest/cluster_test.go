@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package k8stest
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = ginkgo.Describe("A fake cluster", func() {
+
+	secrets := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+	ginkgo.It("should share the objects among the typed and dynamic clients", func() {
+		cluster := NewFakeCluster()
+		secret := &unstructured.Unstructured{}
+		secret.SetAPIVersion("v1")
+		secret.SetKind("Secret")
+		secret.SetName("credentials")
+		secret.SetNamespace("nalej")
+		gomega.Expect(unstructured.SetNestedField(secret.Object, "dmFsdWU=", "data", "key")).To(gomega.Succeed())
+		_, err := cluster.Dynamic.Resource(secrets).Namespace("nalej").Create(secret, metaV1.CreateOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+
+		typed, err := cluster.Client.CoreV1().Secrets("nalej").Get("credentials", metaV1.GetOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(string(typed.Data["key"])).To(gomega.Equal("value"))
+
+		_, err = cluster.Client.CoreV1().ConfigMaps("nalej").Create(&v1.ConfigMap{
+			ObjectMeta: metaV1.ObjectMeta{Name: "config", Namespace: "nalej"},
+		})
+		gomega.Expect(err).To(gomega.Succeed())
+		configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+		retrieved, err := cluster.Dynamic.Resource(configMaps).Namespace("nalej").Get("config", metaV1.GetOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(retrieved.GetName()).To(gomega.Equal("config"))
+
+		gomega.Expect(cluster.Created()).To(gomega.ConsistOf(
+			ObjectKey{Kind: "ConfigMap", Namespace: "nalej", Name: "config"},
+			ObjectKey{Kind: "Secret", Namespace: "nalej", Name: "credentials"}))
+	})
+
+	ginkgo.It("should list the objects of a kind", func() {
+		cluster := NewFakeCluster(
+			&v1.ConfigMap{ObjectMeta: metaV1.ObjectMeta{Name: "a", Namespace: "nalej"}},
+			&v1.ConfigMap{ObjectMeta: metaV1.ObjectMeta{Name: "b", Namespace: "other"}})
+		objects, err := cluster.Objects("v1", "ConfigMap", "nalej")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(objects).To(gomega.HaveLen(1))
+		gomega.Expect(objects[0].GetKind()).To(gomega.Equal("ConfigMap"))
+		all, err := cluster.Objects("v1", "ConfigMap", "")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(all).To(gomega.HaveLen(2))
+	})
+
+	ginkgo.It("should report the version and the resources", func() {
+		cluster := NewFakeCluster()
+		cluster.SetVersion("1.16")
+		cluster.AddResource(Resource{GroupVersion: "networking.istio.io/v1alpha3", Name: "gateways", Kind: "Gateway", Namespaced: true})
+		info, err := cluster.Discovery.ServerVersion()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(info.Minor).To(gomega.Equal("16"))
+		groups, err := cluster.Discovery.ServerGroups()
+		gomega.Expect(err).To(gomega.Succeed())
+		names := make([]string, 0)
+		for _, group := range groups.Groups {
+			names = append(names, group.Name)
+		}
+		gomega.Expect(names).To(gomega.ContainElement("networking.istio.io"))
+		resources, err := cluster.Discovery.ServerResourcesForGroupVersion("networking.istio.io/v1alpha3")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(resources.APIResources).To(gomega.HaveLen(1))
+	})
+})
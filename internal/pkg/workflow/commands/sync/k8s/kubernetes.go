@@ -21,16 +21,14 @@ import (
 	"github.com/nalej/derrors"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"strings"
-	"time"
 
 	"github.com/nalej/installer/internal/pkg/workflow/entities"
 
 	"github.com/rs/zerolog/log"
 
-	"github.com/tidwall/gjson"
-
 	"k8s.io/api/core/v1"
 
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -40,57 +38,81 @@ import (
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/restmapper"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/rest"
 	"net"
 )
 
 type Kubernetes struct {
 	entities.GenericSyncCommand
-	KubeConfigPath string                `json:"kubeConfigPath"`
-	Client         *kubernetes.Clientset `json:"-"`
+	KubeConfigPath string `json:"kubeConfigPath"`
+	// KubeContext is the kubeconfig context to use. If not set, the current context is used.
+	KubeContext string `json:"kubeContext"`
+	// QPS is the number of queries per second sent to the Kubernetes API. If not set, the value of
+	// SetClientDefaults is used.
+	QPS float32 `json:"qps"`
+	// Burst is the number of queries sent at once to the Kubernetes API. If not set, the value of
+	// SetClientDefaults is used.
+	Burst  int                  `json:"burst"`
+	Client kubernetes.Interface `json:"-"`
 
 	// Discovery client for REST mapper to use, so we can figure out
 	// the right endpoints for reserves
-	discoveryClient *discovery.DiscoveryClient
+	discoveryClient discovery.DiscoveryInterface
 	// Dynamic client used to create all resources
 	dynClient dynamic.Interface
+	// clients with the shared client set that caches the discovery information.
+	clients *clientSet
 }
 
+// Connect obtains the clients of the target cluster. Clients are shared among the commands that use the same
+// kubeconfig, context, QPS and burst.
 func (k *Kubernetes) Connect() derrors.Error {
-	config, err := clientcmd.BuildConfigFromFlags("", k.KubeConfigPath)
+	qps, burst := k.RateLimits()
+	clients, err := sharedClients.get(k.KubeConfigPath, k.KubeContext, qps, burst)
 	if err != nil {
-		log.Error().Err(err).Msg("error building configuration from kubeconfig")
-		return derrors.AsError(err, "error building configuration from kubeconfig")
+		return err
 	}
+	k.clients = clients
+	k.Client = clients.client
+	k.discoveryClient = clients.discoveryClient
+	k.dynClient = clients.dynClient
+	return nil
+}
 
-	// create the clientset
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		log.Error().Err(err).Msg("error using configuration to build k8s clientset")
-		return derrors.AsError(err, "error using configuration to build k8s clientset")
+// RateLimits returns the QPS and burst used by the clients of the command.
+func (k *Kubernetes) RateLimits() (float32, int) {
+	qps, burst := getClientDefaults()
+	if k.QPS > 0 {
+		qps = k.QPS
 	}
+	if k.Burst > 0 {
+		burst = k.Burst
+	}
+	return qps, burst
+}
 
-	k.Client = clientset
-
-	// Create the discovery client
-	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
-	if err != nil {
-		return derrors.NewInternalError("failed to create discovery client", err)
+// Capabilities returns the version and the group versions served by the target cluster. Connect must be called
+// first.
+func (k *Kubernetes) Capabilities() (*Capabilities, derrors.Error) {
+	if k.clients == nil {
+		return nil, derrors.NewInternalError("kubernetes clients are not connected")
 	}
-	k.discoveryClient = discoveryClient
+	return k.clients.getCapabilities()
+}
 
-	// Create the dynamic client that can be used to create any object
-	// by specifying what resource we're dealing with by using the REST mapper
-	dynClient, err := dynamic.NewForConfig(config)
+// RestConfig returns the REST configuration of the command, for the clients that are not shared such as the ones
+// of third party APIs.
+func (k *Kubernetes) RestConfig() (*rest.Config, derrors.Error) {
+	config, err := buildConfig(k.KubeConfigPath, k.KubeContext)
 	if err != nil {
-		return derrors.NewInternalError("failed to create dynamic client", err)
+		return nil, derrors.AsError(err, "error building configuration from kubeconfig")
 	}
-	k.dynClient = dynClient
-
-	return nil
+	config.QPS, config.Burst = k.RateLimits()
+	return config, nil
 }
 
+// ResolveIP returns the IP addresses of a host, with the IPv4 addresses first so they are preferred on dual-stack
+// hosts, followed by the IPv6 ones.
 func (k *Kubernetes) ResolveIP(address string) ([]string, derrors.Error) {
 	result := make([]string, 0)
 	ips, err := net.LookupIP(address)
@@ -98,12 +120,15 @@ func (k *Kubernetes) ResolveIP(address string) ([]string, derrors.Error) {
 		log.Error().Err(err).Str("address", address).Msg("cannot resolve IP address")
 		return nil, derrors.AsError(err, "cannot resolve IP address")
 	}
+	ipv6 := make([]string, 0)
 	for _, ip := range ips {
-		if len(ip) == net.IPv4len {
+		if ip.To4() != nil {
 			result = append(result, ip.String())
+		} else {
+			ipv6 = append(ipv6, ip.String())
 		}
 	}
-	return result, nil
+	return append(result, ipv6...), nil
 }
 
 func (k *Kubernetes) ExistsNamespace(name string) (bool, derrors.Error) {
@@ -123,37 +148,41 @@ func (k *Kubernetes) ExistsNamespace(name string) (bool, derrors.Error) {
 	return found, nil
 }
 
-func (k *Kubernetes) CreateNamespace(name string) derrors.Error {
-	toCreate := v1.Namespace{
-		TypeMeta: metaV1.TypeMeta{
-			Kind:       "Namespace",
-			APIVersion: "v1",
-		},
-		ObjectMeta: metaV1.ObjectMeta{
-			Name: name,
-		},
-	}
-	err := k.Create(&toCreate)
-	if err != nil {
-		return derrors.AsError(err, "cannot create namespace")
-	}
-
-	return nil
-}
-
-func (k *Kubernetes) CreateNamespaceIfNotExists(name string) derrors.Error {
-	found, fErr := k.ExistsNamespace(name)
-	if fErr != nil {
-		return fErr
-	}
-
-	if !found {
-		err := k.CreateNamespace(name)
-		if err != nil {
-			return err
+// AddServiceAccountPullSecrets adds a set of image pull secrets to a service account, keeping the existing ones. The
+// service account is created if it does not exist.
+//   params:
+//     namespace The namespace of the service account.
+//     name The name of the service account.
+//     secrets The names of the pull secrets.
+//   returns:
+//     An error if the service account cannot be updated.
+func (k *Kubernetes) AddServiceAccountPullSecrets(namespace string, name string, secrets []string) derrors.Error {
+	client := k.Client.CoreV1().ServiceAccounts(namespace)
+	account, err := client.Get(name, metaV1.GetOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return derrors.AsError(err, "cannot retrieve service account")
+	}
+	exists := err == nil
+	if !exists {
+		account = &v1.ServiceAccount{ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: namespace}}
+	}
+	current := make(map[string]bool, len(account.ImagePullSecrets))
+	for _, ref := range account.ImagePullSecrets {
+		current[ref.Name] = true
+	}
+	for _, secret := range secrets {
+		if !current[secret] {
+			account.ImagePullSecrets = append(account.ImagePullSecrets, v1.LocalObjectReference{Name: secret})
+			current[secret] = true
 		}
+	}
+	if !exists {
+		_, err = client.Create(account)
 	} else {
-		log.Debug().Str("namespace", name).Msg("namespace already exists")
+		_, err = client.Update(account)
+	}
+	if err != nil {
+		return derrors.AsError(err, "cannot set service account pull secrets")
 	}
 	return nil
 }
@@ -212,28 +241,9 @@ func (k *Kubernetes) Create(obj runtime.Object) derrors.Error {
 		return nil
 	}
 
-	// Create the REST mapper through a discovery client
-	// We do this every time we create a resource, because if we created
-	// a custom resource definition in a previous step, we need to
-	// update the list of supported resources.
-	resources, err := restmapper.GetAPIGroupResources(k.discoveryClient)
-	if err != nil {
-		return derrors.NewInternalError("failed to get api group resources", err)
-	}
-	mapper := restmapper.NewDiscoveryRESTMapper(resources)
-
-	// Get the right REST endpoint through the mapper
-	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
-	if err != nil {
-		return derrors.NewInternalError("unable to get REST mapping for object", err).WithParams(unstructuredObj)
-	}
-
-	var client dynamic.ResourceInterface
-	namespace := unstructuredObj.GetNamespace()
-	if namespace != "" {
-		client = k.dynClient.Resource(mapping.Resource).Namespace(namespace)
-	} else {
-		client = k.dynClient.Resource(mapping.Resource)
+	client, derr := k.resourceClient(gvk, unstructuredObj)
+	if derr != nil {
+		return derr
 	}
 
 	log.Debug().Interface("obj", unstructuredObj).Msg("creating resource")
@@ -249,6 +259,35 @@ func (k *Kubernetes) Create(obj runtime.Object) derrors.Error {
 	return nil
 }
 
+// resourceClient adapts an object to the group versions served by the target cluster and returns the dynamic client
+// of its resource.
+func (k *Kubernetes) resourceClient(gvk schema.GroupVersionKind, unstructuredObj *unstructured.Unstructured) (dynamic.ResourceInterface, derrors.Error) {
+	// Objects may use group versions that are not served by the target cluster, such as extensions/v1beta1
+	// Ingresses on newer clusters, so we adapt them to a compatible one.
+	capabilities, cErr := k.Capabilities()
+	if cErr != nil {
+		return nil, cErr
+	}
+	gvk, derr := AdaptObject(capabilities, gvk, unstructuredObj)
+	if derr != nil {
+		return nil, derr
+	}
+
+	// Get the right REST endpoint through the mapper. The discovery information is shared by the commands using
+	// the same cluster, and refreshed if the kind is not found as we may have created a custom resource
+	// definition in a previous step.
+	mapping, mErr := k.clients.restMapping(gvk)
+	if mErr != nil {
+		return nil, mErr
+	}
+
+	namespace := unstructuredObj.GetNamespace()
+	if namespace != "" {
+		return k.dynClient.Resource(mapping.Resource).Namespace(namespace), nil
+	}
+	return k.dynClient.Resource(mapping.Resource), nil
+}
+
 
 // This function creates a k8s object using the raw string specification.
 // params:
@@ -346,65 +385,49 @@ func checkIncluded(element string, set []string) bool {
 // Use the following command to identify group and resource names:
 // $ kubectl --kubeconfig <kubeConfigPath> -n <namespace> api-resources
 func (k *Kubernetes) ExistsEntity(namespace string, group string, version string, resource string, name string) (bool, derrors.Error) {
-	resourceRequest := schema.GroupVersionResource{
-		Group:    group,
-		Version:  version,
-		Resource: resource,
-	}
-	var client dynamic.ResourceInterface
-	if namespace == "" {
-		client = k.dynClient.Resource(resourceRequest)
-	} else {
-		client = k.dynClient.Resource(resourceRequest).Namespace(namespace)
-	}
+	client := k.DynamicResource(namespace, schema.GroupVersionResource{Group: group, Version: version, Resource: resource})
 	_, err := client.Get(name, metaV1.GetOptions{})
 	if err != nil {
-		return false, nil
+		if k8sErrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, AsQueryError(err, "cannot check entity", namespace, name)
 	}
 	return true, nil
 }
 
+// ListEntities retrieves the entities of a given resource using a dynamic client.
+// Use the following command to identify group and resource names:
+// $ kubectl --kubeconfig <kubeConfigPath> -n <namespace> api-resources
+func (k *Kubernetes) ListEntities(namespace string, group string, version string, resource string) (*unstructured.UnstructuredList, derrors.Error) {
+	client := k.DynamicResource(namespace, schema.GroupVersionResource{Group: group, Version: version, Resource: resource})
+	list, err := client.List(metaV1.ListOptions{})
+	if err != nil {
+		return nil, AsQueryError(err, "cannot list entities", namespace, resource)
+	}
+	return list, nil
+}
+
 // DeleteEntity deletes an entity from Kubernetes using a dynamic client.
 // Use the following command to identify group and resource names:
 // $ kubectl --kubeconfig <kubeConfigPath> -n <namespace> api-resources
 func (k *Kubernetes) DeleteEntity(namespace string, group string, version string, resource string, name string) derrors.Error {
-	resourceRequest := schema.GroupVersionResource{
-		Group:    group,
-		Version:  version,
-		Resource: resource,
-	}
-	var client dynamic.ResourceInterface
-	if namespace == "" {
-		client = k.dynClient.Resource(resourceRequest)
-	} else {
-		client = k.dynClient.Resource(resourceRequest).Namespace(namespace)
-	}
+	client := k.DynamicResource(namespace, schema.GroupVersionResource{Group: group, Version: version, Resource: resource})
 	err := client.Delete(name, &metaV1.DeleteOptions{})
 	if err != nil {
-		return derrors.NewInternalError("cannot delete entity", err).WithParams(namespace, name)
+		return AsQueryError(err, "cannot delete entity", namespace, name)
 	}
 	return nil
 }
 
-// DeleteEntity deletes an entity from Kubernetes using a dynamic client allowing skipping some of them.
+// DeleteAllEntities deletes the entities of a resource using a dynamic client allowing skipping some of them.
 // Use the following command to identify group and resource names:
 // $ kubectl --kubeconfig <kubeConfigPath> -n <namespace> api-resources
 func (k *Kubernetes) DeleteAllEntities(namespace string, group string, version string, resource string, excludedNames ...string) derrors.Error {
-	resourceRequest := schema.GroupVersionResource{
-		Group:    group,
-		Version:  version,
-		Resource: resource,
-	}
-	var client dynamic.ResourceInterface
-	if namespace == "" {
-		client = k.dynClient.Resource(resourceRequest)
-	} else {
-		client = k.dynClient.Resource(resourceRequest).Namespace(namespace)
-	}
-
+	client := k.DynamicResource(namespace, schema.GroupVersionResource{Group: group, Version: version, Resource: resource})
 	list, err := client.List(metaV1.ListOptions{})
 	if err != nil {
-		return derrors.AsError(err, "cannot list entities")
+		return AsQueryError(err, "cannot list entities", namespace, resource)
 	}
 	log.Debug().Str("resource", resource).Int("numberEntities", len(list.Items)).Msg("preparing for deletion")
 	for _, element := range list.Items {
@@ -412,55 +435,9 @@ func (k *Kubernetes) DeleteAllEntities(namespace string, group string, version s
 			log.Debug().Str("name", element.GetName()).Str("resource", resource).Msg("deleting entity")
 			err := client.Delete(element.GetName(), &metaV1.DeleteOptions{})
 			if err != nil {
-				return derrors.NewInternalError("cannot delete entity", err).WithParams(namespace, element.GetName())
+				return AsQueryError(err, "cannot delete entity", namespace, element.GetName())
 			}
 		}
 	}
 	return nil
 }
-
-// MatchCRDStatus retrieves a non-namespaced CRD, and checks if a set of keys matches a given value.
-func (k *Kubernetes) MatchCRDStatus(namespace string, group string, version string, resource string, name string, key []string, expected string) (*bool, derrors.Error) {
-	resourceRequest := schema.GroupVersionResource{
-		Group:    group,
-		Version:  version,
-		Resource: resource,
-	}
-
-	var client dynamic.ResourceInterface
-	if namespace == "" {
-		client = k.dynClient.Resource(resourceRequest)
-	} else {
-		client = k.dynClient.Resource(resourceRequest).Namespace(namespace)
-	}
-	numRetries := 36
-	issued := false
-	for retry := 0; retry < numRetries && !issued; retry++ {
-		unstructure, err := client.Get(name, metaV1.GetOptions{})
-		if err != nil {
-			log.Warn().Err(err).Msg("unable to retrieve resource")
-		} else {
-			log.Debug().Interface("raw", unstructure.Object).Msg("resource retrieved")
-			matches := k.MatchUnstructuredField(unstructure, key, expected)
-			log.Debug().Bool("match", matches).Msg("CRD status")
-			if matches {
-				return &matches, nil
-			}
-		}
-		if !issued {
-			time.Sleep(20 * time.Second)
-		}
-	}
-
-	return &issued, nil
-}
-
-// MatchUnstructureField matches a json path as defined by the gjson package with a given expected value.
-func (k *Kubernetes) MatchUnstructuredField(obj *unstructured.Unstructured, key []string, expected string) bool {
-	json, err := obj.MarshalJSON()
-	if err != nil {
-		return false
-	}
-	result := gjson.Get(string(json), strings.Join(key, "."))
-	return result.String() == expected
-}
@@ -18,16 +18,15 @@
 package k8s
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path"
 	"sort"
 	"strings"
 
 	"github.com/nalej/derrors"
-	"github.com/nalej/grpc-installer-go"
 	entities2 "github.com/nalej/installer/internal/pkg/entities"
 	"github.com/nalej/installer/internal/pkg/errors"
 	"github.com/nalej/installer/internal/pkg/workflow/entities"
@@ -35,11 +34,15 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"k8s.io/api/core/v1"
+	storageV1 "k8s.io/api/storage/v1"
 
 	"k8s.io/client-go/kubernetes/scheme"
 
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/yaml"
 )
 
@@ -53,6 +56,58 @@ type LaunchComponents struct {
 	ComponentsDir string   `json:"componentsDir"`
 	PlatformType  string   `json:"platform_type"`
 	Environment   string   `json:"environment"`
+	// Parallelism is the maximum number of components launched at the same time. If not set,
+	// DefaultLaunchParallelism is used.
+	Parallelism int `json:"parallelism"`
+	// SignaturePublicKeyPath with the key used to verify the signed index of the components directory. If not set,
+	// the digests of the index are checked when the directory contains one, but its signature is not verified.
+	SignaturePublicKeyPath string `json:"signature_public_key_path"`
+	// ForceConflicts takes over the fields of existing components that are owned by other managers when the
+	// components are updated through server-side apply.
+	ForceConflicts bool `json:"force_conflicts"`
+	// AdoptExisting labels the existing components that were not created by the installer, such as those of a
+	// previous manual install, as managed by the installer and updates them instead of failing.
+	AdoptExisting bool `json:"adopt_existing"`
+	// InstallID identifies the install. Components are labeled with it so those removed from the components
+	// directory can be pruned on later installs.
+	InstallID string `json:"install_id"`
+	// Prune removes the components labeled with the InstallID that are no longer part of the components directory.
+	Prune bool `json:"prune"`
+	// ProtectedKinds contains the kinds that are never pruned. If not set, DefaultProtectedKinds is used.
+	ProtectedKinds []string `json:"protected_kinds"`
+	// RegistriesPath contains the configuration of the registries used to set the pull secrets of the images. If
+	// empty, the pull secrets of the components are not modified.
+	RegistriesPath string `json:"registries_path"`
+	// IngressController serving the ingresses of the components. If set, the ingresses are adapted to it, and the
+	// services used as their backends are annotated with the scheme expected by Traefik.
+	IngressController string `json:"ingress_controller"`
+	// FeatureFlags with the feature flags of the install. They are stored on the FeatureFlagsConfigMap of each
+	// namespace and exposed to the Deployments requesting them with FeatureFlagsAnnotation.
+	FeatureFlags map[string]string `json:"feature_flags"`
+	// StorageClassesPath contains the mapping of the storage classes of the persistent volumes and claims, see
+	// StorageClassesConfig. If empty, DefaultStorageClasses is used.
+	StorageClassesPath string `json:"storage_classes_path"`
+	// MigrateVolumes migrates the existing claims whose size is increased and whose storage class does not allow
+	// the expansion of their volumes. The data is copied to a new claim while the workloads using it are stopped.
+	// Otherwise, the launch fails.
+	MigrateVolumes bool `json:"migrate_volumes"`
+	// VolumeMigrationImage with the image of the Jobs copying the data of the migrated claims. If not set,
+	// DefaultVolumeMigrationImage is used.
+	VolumeMigrationImage string `json:"volume_migration_image"`
+	// VolumeMigrationTimeout with the maximum time in seconds to migrate each claim. If not set,
+	// DefaultVolumeMigrationTimeout is used.
+	VolumeMigrationTimeout int `json:"volume_migration_timeout"`
+	// Architectures of the nodes of the cluster, detected from the nodes if not set. The workloads of the components
+	// are adapted to them, see ArchitectureAdapter.
+	Architectures []string `json:"architectures"`
+	// ARM64Images with the arm64 variants of the images of the components, by image or by repository.
+	ARM64Images map[string]string `json:"arm64_images"`
+	// registries with the configuration loaded from RegistriesPath.
+	registries *RegistriesConfig
+	// storageClasses with the configuration loaded from StorageClassesPath.
+	storageClasses *StorageClassesConfig
+	// mappedStorageClasses contains the storage classes set on the loaded volumes and claims.
+	mappedStorageClasses map[string]bool
 }
 
 // NewLaunchComponents creates a new LaunchComponents command.
@@ -91,30 +146,492 @@ func (lc *LaunchComponents) Run(workflowID string) (*entities.CommandResult, der
 	if !found {
 		return nil, derrors.NewInvalidArgumentError("cannot determine target environment").WithParams(lc.Environment)
 	}
+	if lc.Prune && lc.InstallID == "" {
+		return nil, derrors.NewInvalidArgumentError("install_id is required to prune components")
+	}
+	if err := ValidateFeatureFlags(lc.FeatureFlags); err != nil {
+		return nil, err
+	}
+
+	// Get the preprocessed list of components to be installed on the target Kubernetes.
+	components, err := lc.ListComponents()
+	if err != nil {
+		return nil, err
+	}
+	index, err := lc.loadComponentsIndex()
+	if err != nil {
+		return entities.NewCommandResult(false, errors.Coded(errors.InvalidSignature, "cannot verify components"), err), nil
+	}
+
+	objects := make(map[string]runtime.Object, len(components))
+	toLaunch := make([]*component, 0, len(components))
+	for _, fileName := range components {
+		log.Info().Str("fileName", fileName).Msg("processing component")
+		obj, c, err := lc.loadComponent(fileName, targetEnvironment, index)
+		if err != nil {
+			return entities.NewCommandResult(false, errors.Coded(errors.ComponentLaunchFailed, "cannot launch component"), err), nil
+		}
+		// Skipped components are kept in the plan so the order of their dependents is preserved.
+		toLaunch = append(toLaunch, c)
+		if skipOnPlatform(obj, lc.PlatformType) {
+			log.Info().Str("fileName", fileName).Str("platform", lc.PlatformType).Msg("component skipped on the platform")
+			continue
+		}
+		objects[fileName] = obj
+	}
+
+	if err := lc.prepareStorageClasses(objects); err != nil {
+		return entities.NewCommandResult(false, "cannot set the storage classes of the components", err), nil
+	}
+	if err := lc.adaptArchitectures(objects); err != nil {
+		return entities.NewCommandResult(false, "cannot adapt the components to the architectures of the nodes", err), nil
+	}
+
+	podSecurity, err := lc.translatePodSecurityPolicies(objects)
+	if err != nil {
+		return nil, err
+	}
+	ingressSupport, err := lc.adaptIngresses(objects)
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot adapt ingresses", err), nil
+	}
+	if err := lc.respectRancher(objects); err != nil {
+		return entities.NewCommandResult(false, "cannot launch the components on a cluster imported in Rancher", err), nil
+	}
 
 	for _, target := range lc.Namespaces {
-		createErr := lc.CreateNamespaceIfNotExists(target)
+		options := NamespaceOptions{}
+		if podSecurity != "" {
+			options.Labels = PodSecurityLabels(podSecurity)
+		}
+		createErr := lc.EnsureNamespace(target, options)
 		if createErr != nil {
 			return nil, createErr
 		}
 	}
-	// Get the preprocessed list of components to be installed on the target Kubernetes.
+	plan, err := buildLaunchPlan(toLaunch, lc.PlatformType)
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot determine the launch order of the components", err), nil
+	}
+
+	parallelism := lc.Parallelism
+	if parallelism <= 0 {
+		parallelism = DefaultLaunchParallelism
+	}
+	options := ApplyOptions{ForceConflicts: lc.ForceConflicts, Adopt: lc.AdoptExisting}
+	if lc.InstallID != "" {
+		options.Labels = map[string]string{InstallIDLabel: InstallIDLabelValue(lc.InstallID)}
+	}
+	if err := lc.resizeVolumes(objects, options); err != nil {
+		return entities.NewCommandResult(false, "cannot resize the persistent volume claims", err), nil
+	}
+	summary := &ApplySummary{}
+	if len(lc.FeatureFlags) > 0 {
+		for _, target := range lc.Namespaces {
+			if err := lc.Apply(featureFlagsConfigMap(target, lc.FeatureFlags), options, summary); err != nil {
+				return entities.NewCommandResult(false, "cannot create feature flags", err), nil
+			}
+		}
+	}
+	for _, obj := range ingressSupport {
+		if err := lc.Apply(obj, options, summary); err != nil {
+			return entities.NewCommandResult(false, "cannot create ingress supporting objects", err), nil
+		}
+	}
+	numLaunched, err := runLaunchPlan(plan, parallelism, func(fileName string) derrors.Error {
+		obj, exists := objects[fileName]
+		if !exists {
+			log.Info().Str("fileName", fileName).Msg("component replaced or skipped on the cluster")
+			return nil
+		}
+		log.Debug().Str("fileName", fileName).Msg("launching component")
+		return lc.Apply(obj, options, summary)
+	})
+	if err != nil {
+		return entities.NewCommandResult(false, errors.Coded(errors.ComponentLaunchFailed, "cannot launch component"), err), nil
+	}
+	if lc.InstallID != "" {
+		if err := lc.pruneComponents(summary); err != nil {
+			return entities.NewCommandResult(false, "cannot prune components", err), nil
+		}
+	}
+	msg := fmt.Sprintf("%d components have been launched: %s", numLaunched, summary.String())
+	return entities.NewCommandResult(true, msg, nil).WithObjects(summary.Applied()), nil
+}
+
+// pruneComponents records the kinds of the applied components and, if enabled, removes the components of previous
+// installs that are no longer part of the components directory.
+func (lc *LaunchComponents) pruneComponents(summary *ApplySummary) derrors.Error {
+	previous, err := lc.LoadInventory(lc.InstallID)
+	if err != nil {
+		return err
+	}
+	kinds := InventoryKinds(previous, summary.Objects)
+	if lc.Prune {
+		protected := lc.ProtectedKinds
+		if len(protected) == 0 {
+			protected = DefaultProtectedKinds
+		}
+		pruned, err := lc.PruneObjects(lc.InstallID, kinds, summary.Objects, protected)
+		summary.Pruned = pruned
+		if err != nil {
+			return err
+		}
+	}
+	return lc.SaveInventory(lc.InstallID, kinds)
+}
+
+// RequiredAccess returns the accesses to the Kubernetes API performed by the command, derived from the kinds of the
+// components to be launched.
+func (lc *LaunchComponents) RequiredAccess() ([]ObjectAccess, derrors.Error) {
+	targetEnvironment, found := entities2.TargetEnvironmentFromString[lc.Environment]
+	if !found {
+		return nil, derrors.NewInvalidArgumentError("cannot determine target environment").WithParams(lc.Environment)
+	}
 	components, err := lc.ListComponents()
 	if err != nil {
 		return nil, err
 	}
-
-	numLaunched := 0
+	// The target namespaces are created and labeled before launching the components.
+	result := []ObjectAccess{Access("", "namespaces", CreateVerbs, UpdateVerbs)}
+	if lc.InstallID != "" || len(lc.FeatureFlags) > 0 {
+		result = append(result, Access("", "configmaps", CreateVerbs, UpdateVerbs))
+	}
+	if lc.IngressController == TraefikController {
+		// The ingresses are inspected to annotate their backends, and the TLS options verifying the client
+		// certificates are applied.
+		result = append(result, Access("extensions", "ingresses", ReadVerbs),
+			Access("networking.k8s.io", "ingresses", ReadVerbs),
+			Access(TraefikGroup, TraefikTLSOptionsResource.Resource, CreateVerbs, PatchVerbs))
+	}
+	// The agent of Rancher is checked to respect its namespaces on imported clusters.
+	result = append(result, Access("apps", "deployments", ReadVerbs))
+	if IsOpenShift(lc.PlatformType) {
+		// The ingresses are created as Routes whose ports are taken from their services, the router is checked to
+		// verify the client certificates, and the policies are created as constraints.
+		result = append(result, Access(RouteGroup, RoutesResource.Resource, CreateVerbs, PatchVerbs),
+			Access("", "services", ReadVerbs),
+			Access(IngressControllersResource.Group, IngressControllersResource.Resource, ReadVerbs),
+			Access(SecurityGroup, SecurityContextConstraintsResource.Resource, CreateVerbs, PatchVerbs))
+	}
+	hasClaims := false
 	for _, fileName := range components {
-		log.Info().Str("fileName", fileName).Msg("processing component")
-		err := lc.launchComponent(path.Join(lc.ComponentsDir, fileName), targetEnvironment)
+		obj, _, err := lc.loadComponent(fileName, targetEnvironment, nil)
+		if err != nil {
+			return nil, err
+		}
+		if skipOnPlatform(obj, lc.PlatformType) {
+			continue
+		}
+		kinds, err := componentKinds(obj)
+		if err != nil {
+			return nil, err
+		}
+		for _, gvk := range kinds {
+			// Components are patched when their manifest changes.
+			result = append(result, KindAccess(gvk, CreateVerbs, PatchVerbs))
+			hasClaims = hasClaims || (gvk.Group == "" && gvk.Kind == "PersistentVolumeClaim")
+			if lc.Prune {
+				result = append(result, KindAccess(gvk, DeleteVerbs))
+			}
+		}
+	}
+	// The storage classes set on the volumes and claims are checked, and the claims keeping their class are read.
+	// The storage classes of the resized claims are read to check whether their volumes can be expanded.
+	if len(lc.mappedStorageClasses) > 0 || hasClaims {
+		result = append(result, Access("storage.k8s.io", "storageclasses", ReadVerbs))
+	}
+	// The migration of the claims scales down the workloads using them and copies their data with Jobs.
+	if hasClaims && lc.MigrateVolumes {
+		result = append(result, Access("", "persistentvolumeclaims", CreateVerbs, DeleteVerbs),
+			Access("", "pods", ReadVerbs), Access("", "pods/log", ReadVerbs),
+			Access("batch", "jobs", CreateVerbs, PatchVerbs, DeleteVerbs),
+			Access("apps", "deployments", ReadVerbs, PatchVerbs), Access("apps", "statefulsets", ReadVerbs, PatchVerbs))
+	}
+	if lc.storageClasses != nil && len(lc.storageClasses.Overrides) > 0 {
+		result = append(result, Access("", "persistentvolumeclaims", ReadVerbs))
+	}
+	if len(lc.Architectures) == 0 {
+		result = append(result, Access("", "nodes", ReadVerbs))
+	}
+	return result, nil
+}
+
+// adaptArchitectures adapts the workloads of the components to the architectures of the nodes.
+func (lc *LaunchComponents) adaptArchitectures(objects map[string]runtime.Object) derrors.Error {
+	archs := lc.Architectures
+	if len(archs) == 0 {
+		detected, err := lc.NodeArchitectures()
 		if err != nil {
-			return entities.NewCommandResult(false, "cannot launch component", err), nil
+			return err
+		}
+		archs = detected
+	}
+	log.Debug().Strs("architectures", archs).Msg("architectures of the nodes")
+	adapter := &ArchitectureAdapter{Architectures: archs, ARM64Images: lc.ARM64Images}
+	for fileName, obj := range objects {
+		content, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		adapted, err := adapter.Adapt(content)
+		if err != nil {
+			return err.WithParams(fileName)
+		}
+		if adapted {
+			log.Debug().Str("fileName", fileName).Msg("adapted to the architectures of the nodes")
+		}
+	}
+	return nil
+}
+
+// componentKinds returns the kinds of the objects contained in a component, expanding list resources.
+func componentKinds(obj runtime.Object) ([]schema.GroupVersionKind, derrors.Error) {
+	if list, ok := obj.(*unstructured.Unstructured); ok && list.IsList() {
+		items, err := list.ToList()
+		if err != nil {
+			return nil, derrors.NewInternalError("cannot create unstructured list", err)
+		}
+		result := make([]schema.GroupVersionKind, 0, len(items.Items))
+		for _, item := range items.Items {
+			result = append(result, item.GroupVersionKind())
+		}
+		return result, nil
+	}
+	gvk, err := getKind(obj)
+	if err != nil {
+		return nil, err
+	}
+	return []schema.GroupVersionKind{gvk}, nil
+}
+
+// routeIngresses replaces the ingresses of the components by the Routes of OpenShift. The ports of the Routes are
+// taken from the services of the components, or from those of the cluster.
+func (lc *LaunchComponents) routeIngresses(objects map[string]runtime.Object) derrors.Error {
+	services := make(map[string]*unstructured.Unstructured, 0)
+	for _, obj := range objects {
+		if service, ok := obj.(*unstructured.Unstructured); ok && service.GetKind() == "Service" {
+			services[service.GetNamespace()+"/"+service.GetName()] = service
+		}
+	}
+	lookup := func(namespace string, name string) (*unstructured.Unstructured, derrors.Error) {
+		if service, found := services[namespace+"/"+name]; found {
+			return service, nil
+		}
+		return lc.LookupService(namespace, name)
+	}
+	routerChecked := false
+	for fileName, obj := range objects {
+		ingress, ok := obj.(*unstructured.Unstructured)
+		if !ok || ingress.GetKind() != "Ingress" {
+			continue
+		}
+		verifies, err := IngressVerifiesClients(ingress.GetAnnotations())
+		if err != nil {
+			return derrors.AsError(err, "cannot adapt ingress").WithParams(ingress.GetNamespace(), ingress.GetName())
+		}
+		if verifies && !routerChecked {
+			if err := lc.CheckRouterClientTLS(); err != nil {
+				return err
+			}
+			routerChecked = true
+		}
+		routes, err := IngressRoutes(ingress, lookup)
+		if err != nil {
+			return err
+		}
+		items := make([]interface{}, 0, len(routes))
+		for _, route := range routes {
+			items = append(items, route.Object)
+		}
+		objects[fileName] = &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "List",
+			"items":      items,
+		}}
+		log.Debug().Str("fileName", fileName).Int("routes", len(routes)).Msg("ingress replaced by routes")
+	}
+	return nil
+}
+
+// adaptIngresses translates the ingresses of the components to the ingress controller. On Traefik, the services used
+// as backends of the adapted ingresses and of the ingresses already created on the target namespaces are annotated
+// with their scheme.
+//   params:
+//     objects The objects to be created by component file.
+//   returns:
+//     The objects required by the adapted ingresses.
+//     An error if an ingress cannot be adapted or the existing ingresses cannot be retrieved.
+func (lc *LaunchComponents) adaptIngresses(objects map[string]runtime.Object) ([]runtime.Object, derrors.Error) {
+	if IsOpenShift(lc.PlatformType) {
+		return nil, lc.routeIngresses(objects)
+	}
+	if lc.IngressController == "" {
+		return nil, nil
+	}
+	support := make(map[string]runtime.Object, 0)
+	ingresses := make([]unstructured.Unstructured, 0)
+	for fileName, obj := range objects {
+		ingress, ok := obj.(*unstructured.Unstructured)
+		if !ok || ingress.GetKind() != "Ingress" {
+			continue
+		}
+		required, err := AdaptIngress(ingress, lc.IngressController)
+		if err != nil {
+			return nil, err
+		}
+		log.Debug().Str("fileName", fileName).Str("controller", lc.IngressController).Msg("ingress adapted")
+		for _, r := range required {
+			support[r.GetKind()+"/"+r.GetNamespace()+"/"+r.GetName()] = r
+		}
+		ingresses = append(ingresses, *ingress)
+	}
+	result := make([]runtime.Object, 0, len(support))
+	for _, obj := range support {
+		result = append(result, obj)
+	}
+	if lc.IngressController != TraefikController {
+		return result, nil
+	}
+	capabilities, err := lc.Capabilities()
+	if err != nil {
+		return nil, err
+	}
+	served, err := capabilities.PreferredGroupVersion("Ingress", "extensions/v1beta1")
+	if err != nil {
+		return nil, err
+	}
+	gv, pErr := schema.ParseGroupVersion(served)
+	if pErr != nil {
+		return nil, derrors.NewInternalError("cannot parse group version", pErr).WithParams(served)
+	}
+	for _, namespace := range lc.Namespaces {
+		existing, err := lc.ListEntities(namespace, gv.Group, gv.Version, "ingresses")
+		if err != nil {
+			return nil, err
+		}
+		ingresses = append(ingresses, existing.Items...)
+	}
+	schemes := BackendSchemes(ingresses)
+	for _, obj := range objects {
+		service, ok := obj.(*unstructured.Unstructured)
+		if !ok || service.GetKind() != "Service" {
+			continue
+		}
+		if scheme, exists := schemes[service.GetNamespace()+"/"+service.GetName()]; exists {
+			annotations := service.GetAnnotations()
+			if annotations == nil {
+				annotations = make(map[string]string, 0)
+			}
+			annotations[TraefikServiceSchemeAnnotation] = scheme
+			service.SetAnnotations(annotations)
+		}
+	}
+	return result, nil
+}
+
+// translatePodSecurityPolicies replaces the PodSecurityPolicies of the components by Pod Security Admission labels
+// on clusters where they are no longer served. The policies are removed from the objects to be created, and the
+// namespaces defined in the components are labeled with the most permissive equivalent level. On OpenShift, they are
+// replaced by SecurityContextConstraints instead.
+//   params:
+//     objects The objects to be created by component file.
+//   returns:
+//     The level to be set on the target namespaces, or an empty string if no translation is required.
+//     An error if the cluster capabilities cannot be obtained.
+func (lc *LaunchComponents) translatePodSecurityPolicies(objects map[string]runtime.Object) (string, derrors.Error) {
+	if IsOpenShift(lc.PlatformType) {
+		lc.translateToSecurityContextConstraints(objects)
+		return "", nil
+	}
+	capabilities, err := lc.Capabilities()
+	if err != nil {
+		return "", err
+	}
+	if capabilities.SupportsPodSecurityPolicy() {
+		return "", nil
+	}
+	levels := make([]string, 0)
+	for fileName, obj := range objects {
+		policy, ok := obj.(*unstructured.Unstructured)
+		if ok && policy.GetKind() == "PodSecurityPolicy" {
+			level := PodSecurityLevel(policy)
+			log.Info().Str("fileName", fileName).Str("policy", policy.GetName()).Str("level", level).
+				Msg("translating pod security policy")
+			levels = append(levels, level)
+			delete(objects, fileName)
+		}
+	}
+	level := MostPermissiveLevel(levels...)
+	if level == "" {
+		return "", nil
+	}
+	for _, obj := range objects {
+		namespace, ok := obj.(*unstructured.Unstructured)
+		if ok && namespace.GetKind() == "Namespace" {
+			labels := namespace.GetLabels()
+			if labels == nil {
+				labels = make(map[string]string, 0)
+			}
+			for key, value := range PodSecurityLabels(level) {
+				labels[key] = value
+			}
+			namespace.SetLabels(labels)
+		}
+	}
+	return level, nil
+}
+
+// respectRancher checks that the components do not modify the namespaces of Rancher if the cluster is imported in
+// it, and makes the admission webhooks of the components ignore those namespaces.
+//   params:
+//     objects The objects to be created by component file.
+//   returns:
+//     An error if a component or target namespace is a namespace of Rancher, or the agent cannot be retrieved.
+func (lc *LaunchComponents) respectRancher(objects map[string]runtime.Object) derrors.Error {
+	imported, err := lc.RancherImported()
+	if err != nil {
+		return err
+	}
+	if !imported {
+		return nil
+	}
+	for _, target := range lc.Namespaces {
+		if IsRancherNamespace(target) {
+			return derrors.NewFailedPreconditionError("the target namespace is managed by Rancher").WithParams(target)
+		}
+	}
+	for fileName, obj := range objects {
+		if namespace, found := RancherNamespaceObject(obj); found {
+			return derrors.NewFailedPreconditionError("the component modifies a namespace managed by Rancher").
+				WithParams(fileName, namespace)
+		}
+		if content, ok := obj.(*unstructured.Unstructured); ok && ExcludeRancherNamespaces(content) {
+			log.Debug().Str("fileName", fileName).Msg("rancher namespaces excluded from the webhooks")
+		}
+	}
+	return nil
+}
+
+// translateToSecurityContextConstraints replaces the PodSecurityPolicies of the components by the equivalent
+// SecurityContextConstraints of OpenShift, and allows the roles using the policies to use the constraints.
+func (lc *LaunchComponents) translateToSecurityContextConstraints(objects map[string]runtime.Object) {
+	for fileName, obj := range objects {
+		content, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		switch content.GetKind() {
+		case "PodSecurityPolicy":
+			log.Info().Str("fileName", fileName).Str("policy", content.GetName()).
+				Msg("translating pod security policy to security context constraints")
+			objects[fileName] = SecurityContextConstraints(content)
+		case "Role", "ClusterRole":
+			if UseSecurityContextConstraints(content) {
+				log.Debug().Str("fileName", fileName).Str("role", content.GetName()).Msg("role allowed to use the constraints")
+			}
 		}
-		numLaunched++
 	}
-	msg := fmt.Sprintf("%d components have been launched", numLaunched)
-	return entities.NewCommandResult(true, msg, nil), nil
 }
 
 // ListComponents obtains a list of the files that need to be installed. Platform dependent YAML files overwrite the
@@ -158,18 +675,37 @@ func (lc *LaunchComponents) ListComponents() ([]string, derrors.Error) {
 	return result, nil
 }
 
-// launchComponent triggers the creation of a given component from a YAML file
-func (lc *LaunchComponents) launchComponent(componentPath string, targetEnvironment entities2.TargetEnvironment) derrors.Error {
+// loadComponentsIndex reads the index of the components directory, verifying its signature if a public key is set.
+func (lc *LaunchComponents) loadComponentsIndex() (*ComponentsIndex, derrors.Error) {
+	if lc.SignaturePublicKeyPath == "" {
+		return LoadComponentsIndex(lc.ComponentsDir, nil)
+	}
+	publicKey, err := LoadSigningPublicKey(lc.SignaturePublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return LoadComponentsIndex(lc.ComponentsDir, publicKey)
+}
+
+// loadComponent reads a component from a YAML file and applies the platform modifications. The object is returned
+// along with the information required to schedule its creation. If an index is given, files whose digest does not
+// match are rejected.
+func (lc *LaunchComponents) loadComponent(fileName string, targetEnvironment entities2.TargetEnvironment, index *ComponentsIndex) (runtime.Object, *component, derrors.Error) {
+	componentPath := path.Join(lc.ComponentsDir, fileName)
 	log.Debug().
 		Str("path", componentPath).
 		Str("targetEnvironment", entities2.TargetEnvironmentToString[targetEnvironment]).
 		Msg("launch component")
 
-	f, err := os.Open(componentPath)
+	content, err := ioutil.ReadFile(componentPath)
 	if err != nil {
-		return derrors.NewPermissionDeniedError("cannot read component file", err)
+		return nil, nil, derrors.NewPermissionDeniedError("cannot read component file", err)
+	}
+	if index != nil {
+		if err := index.Verify(fileName, content); err != nil {
+			return nil, nil, err
+		}
 	}
-	defer f.Close()
 	log.Debug().Str("path", componentPath).Msg("parsing component")
 
 	// We use a YAML decoder to decode the resource straight into an
@@ -177,13 +713,47 @@ func (lc *LaunchComponents) launchComponent(componentPath string, targetEnvironm
 	// not known to this client - like CustomResourceDefinitions
 	obj := runtime.Object(&unstructured.Unstructured{})
 
-	yamlDecoder := yaml.NewYAMLOrJSONDecoder(f, 1024)
+	yamlDecoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(content), 1024)
 	err = yamlDecoder.Decode(obj)
 	if err != nil {
-		return derrors.NewInvalidArgumentError("cannot parse component file", err)
+		return nil, nil, derrors.NewInvalidArgumentError("cannot parse component file", err)
 	}
 	gvk := obj.GetObjectKind().GroupVersionKind()
 	log.Debug().Str("resource", gvk.String()).Msg("decoded resource")
+	c := newComponent(fileName, gvk.Kind, obj.(*unstructured.Unstructured).GetAnnotations())
+
+	if lc.RegistriesPath != "" {
+		if lc.registries == nil {
+			registries, err := LoadRegistriesConfig(lc.RegistriesPath)
+			if err != nil {
+				return nil, nil, err
+			}
+			if IsOpenShift(lc.PlatformType) {
+				registries = registries.ExternalRegistries()
+			}
+			lc.registries = registries
+		}
+		added, err := lc.registries.AddPullSecrets(obj.(*unstructured.Unstructured))
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Debug().Str("path", componentPath).Int("added", added).Msg("pull secrets set")
+	}
+	injected, fErr := InjectFeatureFlags(obj.(*unstructured.Unstructured), lc.FeatureFlags)
+	if fErr != nil {
+		return nil, nil, fErr
+	}
+	if injected {
+		log.Debug().Str("path", componentPath).Msg("feature flags set")
+	}
+
+	if lc.StorageClassesPath != "" && lc.storageClasses == nil {
+		storageClasses, err := LoadStorageClassesConfig(lc.StorageClassesPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		lc.storageClasses = storageClasses
+	}
 
 	// Now let's see if it's a resource we know and can type, so we can
 	// decide if we need to do some modifications. We ignore the error
@@ -195,7 +765,7 @@ func (lc *LaunchComponents) launchComponent(componentPath string, targetEnvironm
 		// Ah, we can convert this to something specific to deal with!
 		err := clientScheme.Convert(obj, typed, nil)
 		if err != nil {
-			return derrors.NewInternalError("cannot convert resource to specific type", err)
+			return nil, nil, derrors.NewInternalError("cannot convert resource to specific type", err)
 		}
 	}
 
@@ -211,15 +781,26 @@ func (lc *LaunchComponents) launchComponent(componentPath string, targetEnvironm
 		obj = runtime.Object(lc.patchPersistentVolumeClaim(o))
 	}
 
-	return lc.Create(obj)
+	return obj, c, nil
+}
+
+// storageClass returns the storage class mapped to a volume or claim, recording it to be validated.
+func (lc *LaunchComponents) storageClass(name string) (string, bool) {
+	class, replace := lc.storageClasses.StorageClass(lc.PlatformType, name)
+	if replace {
+		if lc.mappedStorageClasses == nil {
+			lc.mappedStorageClasses = make(map[string]bool, 0)
+		}
+		lc.mappedStorageClasses[class] = true
+	}
+	return class, replace
 }
 
 // patchPersistenceVolume modifies the storage class
 func (lc *LaunchComponents) patchPersistentVolume(pv *v1.PersistentVolume) *v1.PersistentVolume {
-	if lc.PlatformType == grpc_installer_go.Platform_AZURE.String() {
-		log.Debug().Msg("Modifying storageClass")
+	if sc, replace := lc.storageClass(pv.Name); replace {
+		log.Debug().Str("name", pv.Name).Str("storageClass", sc).Msg("Modifying storageClass")
 		patched := pv.DeepCopy()
-		sc := AzureStorageClass
 		patched.Spec.StorageClassName = sc
 		pv = patched
 	}
@@ -228,10 +809,9 @@ func (lc *LaunchComponents) patchPersistentVolume(pv *v1.PersistentVolume) *v1.P
 
 // patchPersistenceVolumeClaim modifies the storage class of a pvc
 func (lc *LaunchComponents) patchPersistentVolumeClaim(pvc *v1.PersistentVolumeClaim) *v1.PersistentVolumeClaim {
-	if lc.PlatformType == grpc_installer_go.Platform_AZURE.String() {
-		log.Debug().Msg("Modifying storageClass")
+	if sc, replace := lc.storageClass(pvc.Name); replace {
+		log.Debug().Str("name", pvc.Name).Str("storageClass", sc).Msg("Modifying storageClass")
 		patched := pvc.DeepCopy()
-		sc := AzureStorageClass
 		patched.Spec.StorageClassName = &sc
 		pvc = patched
 	}
@@ -239,6 +819,41 @@ func (lc *LaunchComponents) patchPersistentVolumeClaim(pvc *v1.PersistentVolumeC
 	return pvc
 }
 
+// prepareStorageClasses keeps the storage class of the existing claims whose override is KeepStorageClass, and
+// checks that the classes set by the mapping exist in the cluster, unless they are created by the components.
+func (lc *LaunchComponents) prepareStorageClasses(objects map[string]runtime.Object) derrors.Error {
+	classes := make(map[string]bool, len(lc.mappedStorageClasses))
+	for class := range lc.mappedStorageClasses {
+		classes[class] = true
+	}
+	for _, obj := range objects {
+		switch o := obj.(type) {
+		case *storageV1.StorageClass:
+			delete(classes, o.Name)
+		case *v1.PersistentVolumeClaim:
+			if !lc.storageClasses.Keeps(o.Name) {
+				continue
+			}
+			existing, err := lc.Client.CoreV1().PersistentVolumeClaims(o.Namespace).Get(o.Name, metaV1.GetOptions{})
+			if err != nil {
+				if k8sErrors.IsNotFound(err) {
+					continue
+				}
+				return AsQueryError(err, "cannot retrieve persistent volume claim", o.Namespace, o.Name)
+			}
+			if existing.Spec.StorageClassName != nil {
+				class := *existing.Spec.StorageClassName
+				o.Spec.StorageClassName = &class
+			}
+		}
+	}
+	toValidate := make([]string, 0, len(classes))
+	for class := range classes {
+		toValidate = append(toValidate, class)
+	}
+	return lc.ValidateStorageClasses(toValidate)
+}
+
 func (lc *LaunchComponents) String() string {
 	return fmt.Sprintf("SYNC LaunchComponents from %s", lc.ComponentsDir)
 }
@@ -0,0 +1,294 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DependsOnAnnotation is the annotation of a component object with a comma separated list of the component files
+// that must be launched before it.
+const DependsOnAnnotation = "installer.nalej.com/depends-on"
+
+// SkipPlatformsAnnotation is the annotation of a component object with a comma separated list of the platforms where
+// it is not launched, such as OPENSHIFT for the components replaced by those of the platform.
+const SkipPlatformsAnnotation = "installer.nalej.com/skip-platforms"
+
+// DefaultLaunchParallelism is the number of components launched concurrently if none is specified.
+const DefaultLaunchParallelism = 8
+
+// prerequisiteKinds contains the kinds of the objects that other components of the same stage may require to exist.
+var prerequisiteKinds = map[string]bool{
+	"Namespace":                true,
+	"CustomResourceDefinition": true,
+	"PodSecurityPolicy":        true,
+	"StorageClass":             true,
+	"PriorityClass":            true,
+}
+
+// component structure with the information required to schedule the launch of a component file.
+type component struct {
+	// Name of the component file.
+	Name string
+	// Kind of the object defined in the file.
+	Kind string
+	// DependsOn contains the names of the component files that must be launched before this one.
+	DependsOn []string
+}
+
+// newComponent creates a component from the file name, the kind and the annotations of its object.
+func newComponent(name string, kind string, annotations map[string]string) *component {
+	dependsOn := make([]string, 0)
+	for _, dep := range strings.Split(annotations[DependsOnAnnotation], ",") {
+		if trimmed := strings.TrimSpace(dep); trimmed != "" {
+			dependsOn = append(dependsOn, trimmed)
+		}
+	}
+	return &component{Name: name, Kind: kind, DependsOn: dependsOn}
+}
+
+// skipOnPlatform checks if a component object is not launched on a platform. The skipped items of list resources are
+// removed from the list, which is only skipped if all of them are.
+func skipOnPlatform(obj runtime.Object, platformType string) bool {
+	content, ok := obj.(*unstructured.Unstructured)
+	if !ok || platformType == "" {
+		return false
+	}
+	if !content.IsList() {
+		return skipsPlatform(content.GetAnnotations(), platformType)
+	}
+	items, _, _ := unstructured.NestedSlice(content.Object, "items")
+	kept := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		itemContent, ok := item.(map[string]interface{})
+		if ok && skipsPlatform((&unstructured.Unstructured{Object: itemContent}).GetAnnotations(), platformType) {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	if len(kept) == len(items) {
+		return false
+	}
+	_ = unstructured.SetNestedSlice(content.Object, kept, "items")
+	return len(kept) == 0
+}
+
+// skipsPlatform checks if the SkipPlatformsAnnotation of an object lists a platform.
+func skipsPlatform(annotations map[string]string, platformType string) bool {
+	for _, platform := range strings.Split(annotations[SkipPlatformsAnnotation], ",") {
+		if strings.EqualFold(strings.TrimSpace(platform), platformType) {
+			return true
+		}
+	}
+	return false
+}
+
+// componentStage returns the stage of a component file. Files with a numeric prefix such as 0-crd.yaml are launched
+// in ascending order of their prefix before the rest of the files.
+func componentStage(fileName string) int {
+	sep := strings.Index(fileName, "-")
+	if sep <= 0 {
+		return math.MaxInt32
+	}
+	stage, err := strconv.Atoi(fileName[:sep])
+	if err != nil || stage < 0 {
+		return math.MaxInt32
+	}
+	return stage
+}
+
+// buildLaunchPlan determines the components each component depends on. A component depends on the components of the
+// previous stages, on the prerequisite objects of its own stage, and on the components listed in its
+// DependsOnAnnotation, that may omit the platform suffix.
+//   params:
+//     components The list of components to be launched.
+//     platformType The target platform.
+//   returns:
+//     A map with the names of the components each component depends on.
+//     An error if a dependency is not found or there is a dependency cycle.
+func buildLaunchPlan(components []*component, platformType string) (map[string][]string, derrors.Error) {
+	platformSuffix := "." + strings.ToLower(platformType)
+	byName := make(map[string]*component, len(components))
+	for _, c := range components {
+		byName[c.Name] = c
+		byName[strings.TrimSuffix(c.Name, platformSuffix)] = c
+	}
+
+	plan := make(map[string][]string, len(components))
+	for _, c := range components {
+		deps := make(map[string]bool, 0)
+		stage := componentStage(c.Name)
+		for _, other := range components {
+			otherStage := componentStage(other.Name)
+			if otherStage < stage ||
+				(otherStage == stage && prerequisiteKinds[other.Kind] && !prerequisiteKinds[c.Kind]) {
+				deps[other.Name] = true
+			}
+		}
+		for _, dep := range c.DependsOn {
+			target, found := byName[dep]
+			if !found {
+				return nil, derrors.NewInvalidArgumentError("component dependency not found").WithParams(c.Name, dep)
+			}
+			if target.Name == c.Name {
+				return nil, derrors.NewInvalidArgumentError("component cannot depend on itself").WithParams(c.Name)
+			}
+			deps[target.Name] = true
+		}
+		names := make([]string, 0, len(deps))
+		for name := range deps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		plan[c.Name] = names
+	}
+
+	if err := checkLaunchPlan(plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// checkLaunchPlan verifies that the components of a plan can be ordered.
+func checkLaunchPlan(plan map[string][]string) derrors.Error {
+	remaining, dependents := pendingDependencies(plan)
+	ready := make([]string, 0)
+	for name, pending := range remaining {
+		if pending == 0 {
+			ready = append(ready, name)
+		}
+	}
+	ordered := 0
+	for len(ready) > 0 {
+		name := ready[0]
+		ready = ready[1:]
+		ordered++
+		for _, dependent := range dependents[name] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if ordered < len(plan) {
+		cycle := make([]string, 0)
+		for name, pending := range remaining {
+			if pending > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		sort.Strings(cycle)
+		return derrors.NewInvalidArgumentError("dependency cycle between components").WithParams(cycle)
+	}
+	return nil
+}
+
+// pendingDependencies returns the number of dependencies of each component, and the components that depend on
+// each one.
+func pendingDependencies(plan map[string][]string) (map[string]int, map[string][]string) {
+	remaining := make(map[string]int, len(plan))
+	dependents := make(map[string][]string, len(plan))
+	for name, deps := range plan {
+		remaining[name] = len(deps)
+		for _, dep := range deps {
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+	for _, list := range dependents {
+		sort.Strings(list)
+	}
+	return remaining, dependents
+}
+
+// launchResult structure with the outcome of launching a component.
+type launchResult struct {
+	name string
+	err  derrors.Error
+}
+
+// runLaunchPlan launches the components of a plan using a bounded number of workers. A component is launched once
+// all its dependencies have been launched. No new components are launched after a failure.
+//   params:
+//     plan The components to be launched and their dependencies.
+//     parallelism The maximum number of components launched at the same time.
+//     launch The function that launches a component.
+//   returns:
+//     The number of components that have been launched.
+//     The first error found.
+func runLaunchPlan(plan map[string][]string, parallelism int, launch func(name string) derrors.Error) (int, derrors.Error) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	remaining, dependents := pendingDependencies(plan)
+	ready := make([]string, 0)
+	for name, pending := range remaining {
+		if pending == 0 {
+			ready = append(ready, name)
+		}
+	}
+	sort.Strings(ready)
+
+	results := make(chan launchResult)
+	running := 0
+	launched := 0
+	var firstErr derrors.Error
+	for {
+		for firstErr == nil && running < parallelism && len(ready) > 0 {
+			name := ready[0]
+			ready = ready[1:]
+			running++
+			go func(name string) {
+				results <- launchResult{name: name, err: launch(name)}
+			}(name)
+		}
+		if running == 0 {
+			break
+		}
+		result := <-results
+		running--
+		if result.err != nil {
+			log.Warn().Str("component", result.name).Str("trace", result.err.DebugReport()).Msg("cannot launch component")
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
+		}
+		launched++
+		for _, dependent := range dependents[result.name] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if firstErr != nil {
+		return launched, firstErr
+	}
+	if launched < len(plan) {
+		return launched, derrors.NewInternalError("not all components have been launched").WithParams(launched, len(plan))
+	}
+	return launched, nil
+}
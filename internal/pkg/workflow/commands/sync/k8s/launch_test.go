@@ -18,13 +18,20 @@ package k8s
 
 import (
 	"fmt"
+	"github.com/nalej/derrors"
 	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
 	"io/ioutil"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // CreateTempYAML creates a directory with a set of yaml files.
@@ -90,4 +97,338 @@ var _ = ginkgo.Describe("A Launch command", func() {
 			gomega.Expect(toInstall[i]).Should(gomega.Equal(expectedName))
 		}
 	})
+
+	ginkgo.Context("launch plan", func() {
+		ginkgo.It("should order the components by stage and prerequisite kind", func() {
+			components := []*component{
+				newComponent("0-crd.yaml", "CustomResourceDefinition", nil),
+				newComponent("a.namespace.yaml", "Namespace", nil),
+				newComponent("b.deployment.yaml", "Deployment", nil),
+				newComponent("c.service.yaml", "Service", nil),
+			}
+			plan, err := buildLaunchPlan(components, grpc_installer_go.Platform_AZURE.String())
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(plan["0-crd.yaml"]).To(gomega.BeEmpty())
+			gomega.Expect(plan["a.namespace.yaml"]).To(gomega.Equal([]string{"0-crd.yaml"}))
+			gomega.Expect(plan["b.deployment.yaml"]).To(gomega.Equal([]string{"0-crd.yaml", "a.namespace.yaml"}))
+			gomega.Expect(plan["c.service.yaml"]).To(gomega.Equal([]string{"0-crd.yaml", "a.namespace.yaml"}))
+		})
+		ginkgo.It("should respect the dependency annotations", func() {
+			components := []*component{
+				newComponent("a.configmap.yaml.azure", "ConfigMap", nil),
+				newComponent("b.deployment.yaml", "Deployment", map[string]string{DependsOnAnnotation: "a.configmap.yaml, c.secret.yaml"}),
+				newComponent("c.secret.yaml", "Secret", nil),
+			}
+			plan, err := buildLaunchPlan(components, grpc_installer_go.Platform_AZURE.String())
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(plan["b.deployment.yaml"]).To(gomega.Equal([]string{"a.configmap.yaml.azure", "c.secret.yaml"}))
+		})
+		ginkgo.It("should fail on unknown dependencies and cycles", func() {
+			_, err := buildLaunchPlan([]*component{
+				newComponent("a.yaml", "Service", map[string]string{DependsOnAnnotation: "missing.yaml"}),
+			}, "")
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			_, err = buildLaunchPlan([]*component{
+				newComponent("a.yaml", "Service", map[string]string{DependsOnAnnotation: "b.yaml"}),
+				newComponent("b.yaml", "Service", map[string]string{DependsOnAnnotation: "a.yaml"}),
+			}, "")
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("should launch the dependencies first", func() {
+			plan := map[string][]string{"a": {}, "b": {}, "c": {"a", "b"}, "d": {"c"}}
+			launched := make(map[string]bool, 0)
+			inOrder := true
+			lock := sync.Mutex{}
+			num, err := runLaunchPlan(plan, 2, func(name string) derrors.Error {
+				lock.Lock()
+				defer lock.Unlock()
+				for _, dep := range plan[name] {
+					inOrder = inOrder && launched[dep]
+				}
+				launched[name] = true
+				return nil
+			})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(num).To(gomega.Equal(len(plan)))
+			gomega.Expect(inOrder).To(gomega.BeTrue())
+		})
+		ginkgo.It("should stop launching components after a failure", func() {
+			plan := map[string][]string{"a": {}, "b": {"a"}}
+			num, err := runLaunchPlan(plan, 2, func(name string) derrors.Error {
+				return derrors.NewInternalError("failure")
+			})
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			gomega.Expect(num).To(gomega.Equal(0))
+		})
+	})
+
+	ginkgo.Context("on a fake cluster", func() {
+		var cluster *k8stest.FakeCluster
+		var componentsDir string
+
+		ginkgo.BeforeEach(func() {
+			cluster = newFakeCluster()
+			dir, err := ioutil.TempDir("", "launch")
+			gomega.Expect(err).To(gomega.Succeed())
+			componentsDir = dir
+			components := map[string]string{
+				"1.configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: platform-config
+  namespace: nalej
+data:
+  key: value
+`,
+				"2.service.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: nalej
+spec:
+  selector:
+    app: web
+  ports:
+  - port: 80
+`,
+			}
+			for name, content := range components {
+				err := ioutil.WriteFile(filepath.Join(componentsDir, name), []byte(content), 0644)
+				gomega.Expect(err).To(gomega.Succeed())
+			}
+		})
+
+		ginkgo.AfterEach(func() {
+			UnregisterClients(cluster.KubeConfigPath)
+			os.RemoveAll(componentsDir)
+		})
+
+		ginkgo.It("should create the components and skip them on the next launch", func() {
+			launchCmd := NewLaunchComponents(cluster.KubeConfigPath, []string{"nalej"}, componentsDir, grpc_installer_go.Platform_AZURE.String())
+			launchCmd.Environment = "PRODUCTION"
+			result, err := launchCmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			gomega.Expect(result.Output).To(gomega.ContainSubstring("2 applied, 0 skipped, 0 updated"))
+
+			cluster.ExpectObject("v1", "Namespace", "", "nalej")
+			config := cluster.ExpectObject("v1", "ConfigMap", "nalej", "platform-config")
+			gomega.Expect(config.GetAnnotations()).To(gomega.HaveKey(AppliedHashAnnotation))
+			cluster.ExpectObject("v1", "Service", "nalej", "web")
+
+			result, err = launchCmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			gomega.Expect(result.Output).To(gomega.ContainSubstring("0 applied, 2 skipped, 0 updated"))
+		})
+
+		ginkgo.It("should adopt the existing components only if enabled", func() {
+			existing := &v1.ConfigMap{
+				ObjectMeta: metaV1.ObjectMeta{Name: "platform-config", Namespace: "nalej"},
+				Data:       map[string]string{"key": "manual"},
+			}
+			gomega.Expect(cluster.Tracker.Add(existing)).To(gomega.Succeed())
+			cluster.SetVersion("1.15")
+
+			launchCmd := NewLaunchComponents(cluster.KubeConfigPath, []string{"nalej"}, componentsDir, grpc_installer_go.Platform_AZURE.String())
+			launchCmd.Environment = "PRODUCTION"
+			result, err := launchCmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeFalse())
+			code, found := errors.ErrorCode(result.Error)
+			gomega.Expect(found).To(gomega.BeTrue())
+			gomega.Expect(code).To(gomega.Equal(errors.ObjectNotManaged))
+
+			launchCmd.AdoptExisting = true
+			result, err = launchCmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			gomega.Expect(result.Output).To(gomega.ContainSubstring("1 adopted"))
+			config := cluster.ExpectObject("v1", "ConfigMap", "nalej", "platform-config")
+			gomega.Expect(config.GetLabels()).To(gomega.HaveKeyWithValue(ManagedByLabel, ManagedByInstaller))
+			gomega.Expect(config.Object["data"]).To(gomega.Equal(map[string]interface{}{"key": "value"}))
+		})
+
+		ginkgo.It("should expose the feature flags to the deployments requesting them", func() {
+			deployment := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: nalej
+  annotations:
+    installer.nalej.com/feature-flags: new-ui
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nalej/web:v1
+        env:
+        - name: FEATURE_NEW_UI
+          value: "false"
+`
+			err := ioutil.WriteFile(filepath.Join(componentsDir, "3.deployment.yaml"), []byte(deployment), 0644)
+			gomega.Expect(err).To(gomega.Succeed())
+			launchCmd := NewLaunchComponents(cluster.KubeConfigPath, []string{"nalej"}, componentsDir, grpc_installer_go.Platform_AZURE.String())
+			launchCmd.Environment = "PRODUCTION"
+			launchCmd.FeatureFlags = map[string]string{"new-ui": "true", "beta-api": "false"}
+			result, err := launchCmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+
+			flags := cluster.ExpectObject("v1", "ConfigMap", "nalej", FeatureFlagsConfigMap)
+			gomega.Expect(flags.Object["data"]).To(gomega.Equal(map[string]interface{}{"new-ui": "true", "beta-api": "false"}))
+			created := cluster.ExpectObject("apps/v1", "Deployment", "nalej", "web")
+			containers, _, _ := unstructured.NestedSlice(created.Object, "spec", "template", "spec", "containers")
+			gomega.Expect(containers).To(gomega.HaveLen(1))
+			env, _, _ := unstructured.NestedSlice(containers[0].(map[string]interface{}), "env")
+			gomega.Expect(env).To(gomega.HaveLen(1))
+			ref, _, _ := unstructured.NestedString(env[0].(map[string]interface{}), "valueFrom", "configMapKeyRef", "key")
+			gomega.Expect(ref).To(gomega.Equal("new-ui"))
+			podAnnotations, _, _ := unstructured.NestedStringMap(created.Object, "spec", "template", "metadata", "annotations")
+			gomega.Expect(podAnnotations).To(gomega.HaveKey(FeatureFlagsHashAnnotation))
+		})
+
+		ginkgo.It("should reject invalid feature flag names", func() {
+			launchCmd := NewLaunchComponents(cluster.KubeConfigPath, []string{"nalej"}, componentsDir, grpc_installer_go.Platform_AZURE.String())
+			launchCmd.Environment = "PRODUCTION"
+			launchCmd.FeatureFlags = map[string]string{"new ui": "true"}
+			_, err := launchCmd.Run("w1")
+			gomega.Expect(err).NotTo(gomega.Succeed())
+			gomega.Expect(FeatureFlagEnvName("new-ui.v2")).To(gomega.Equal("FEATURE_NEW_UI_V2"))
+		})
+
+		ginkgo.It("should adapt the ingresses to Traefik", func() {
+			cluster.AddResource(k8stest.Resource{GroupVersion: "traefik.containo.us/v1alpha1", Name: "tlsoptions", Kind: "TLSOption", Namespaced: true})
+			ingress := `apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: web
+  namespace: nalej
+  annotations:
+    kubernetes.io/ingress.class: nginx
+    nginx.ingress.kubernetes.io/backend-protocol: GRPC
+    nginx.ingress.kubernetes.io/auth-tls-verify-client: "on"
+    nginx.ingress.kubernetes.io/auth-tls-secret: nalej/ca-certificate
+spec:
+  rules:
+  - host: web.nalej.tech
+    http:
+      paths:
+      - path: /
+        backend:
+          serviceName: web
+          servicePort: 80
+`
+			err := ioutil.WriteFile(filepath.Join(componentsDir, "3.ingress.yaml"), []byte(ingress), 0644)
+			gomega.Expect(err).To(gomega.Succeed())
+			launchCmd := NewLaunchComponents(cluster.KubeConfigPath, []string{"nalej"}, componentsDir, grpc_installer_go.Platform_AZURE.String())
+			launchCmd.Environment = "PRODUCTION"
+			launchCmd.IngressController = TraefikController
+			result, err := launchCmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+
+			created := cluster.ExpectObject("extensions/v1beta1", "Ingress", "nalej", "web")
+			gomega.Expect(created.GetAnnotations()).Should(gomega.HaveKeyWithValue(IngressClassAnnotation, TraefikController))
+			service := cluster.ExpectObject("v1", "Service", "nalej", "web")
+			gomega.Expect(service.GetAnnotations()).Should(gomega.HaveKeyWithValue(TraefikServiceSchemeAnnotation, "h2c"))
+			cluster.ExpectObject("traefik.containo.us/v1alpha1", "TLSOption", "nalej", "ca-certificate")
+		})
+
+		ginkgo.It("should create routes and security context constraints on OpenShift", func() {
+			cluster.AddResource(k8stest.Resource{GroupVersion: "route.openshift.io/v1", Name: "routes", Kind: "Route", Namespaced: true})
+			cluster.AddResource(k8stest.Resource{GroupVersion: "security.openshift.io/v1", Name: "securitycontextconstraints", Kind: "SecurityContextConstraints"})
+			cluster.AddResource(k8stest.Resource{GroupVersion: "operator.openshift.io/v1", Name: "ingresscontrollers", Kind: "IngressController", Namespaced: true})
+			router := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "operator.openshift.io/v1",
+				"kind":       "IngressController",
+				"metadata":   map[string]interface{}{"name": "default", "namespace": OpenShiftIngressOperatorNamespace},
+				"spec":       map[string]interface{}{"clientTLS": map[string]interface{}{"clientCertificatePolicy": "Required"}},
+			}}
+			gomega.Expect(cluster.Tracker.Add(router)).To(gomega.Succeed())
+			components := map[string]string{
+				"0.psp.yaml": `apiVersion: policy/v1beta1
+kind: PodSecurityPolicy
+metadata:
+  name: nalej-restricted
+spec:
+  privileged: false
+  runAsUser:
+    rule: MustRunAsNonRoot
+  seLinux:
+    rule: RunAsAny
+  volumes:
+  - configMap
+  - secret
+`,
+				"1.clusterrole.yaml": `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: nalej-restricted
+rules:
+- apiGroups: ["policy"]
+  resources: ["podsecuritypolicies"]
+  verbs: ["use"]
+  resourceNames: ["nalej-restricted"]
+`,
+				"3.ingress.yaml": `apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: web
+  namespace: nalej
+  annotations:
+    kubernetes.io/ingress.class: nginx
+    nginx.ingress.kubernetes.io/auth-tls-verify-client: "on"
+    nginx.ingress.kubernetes.io/auth-tls-secret: nalej/ca-certificate
+spec:
+  tls:
+  - hosts:
+    - web.nalej.tech
+  rules:
+  - host: web.nalej.tech
+    http:
+      paths:
+      - path: /
+        backend:
+          serviceName: web
+          servicePort: 80
+`,
+				"4.configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: nginx-config
+  namespace: nalej
+  annotations:
+    installer.nalej.com/skip-platforms: OPENSHIFT
+`,
+			}
+			for name, content := range components {
+				err := ioutil.WriteFile(filepath.Join(componentsDir, name), []byte(content), 0644)
+				gomega.Expect(err).To(gomega.Succeed())
+			}
+			launchCmd := NewLaunchComponents(cluster.KubeConfigPath, []string{"nalej"}, componentsDir, "OPENSHIFT")
+			launchCmd.Environment = "PRODUCTION"
+			result, err := launchCmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+
+			cluster.ExpectNoObject("extensions/v1beta1", "Ingress", "nalej", "web")
+			route := cluster.ExpectObject("route.openshift.io/v1", "Route", "nalej", "web")
+			termination, _, _ := unstructured.NestedString(route.Object, "spec", "tls", "termination")
+			gomega.Expect(termination).To(gomega.Equal("edge"))
+			cluster.ExpectObject("security.openshift.io/v1", "SecurityContextConstraints", "", "nalej-restricted")
+			cluster.ExpectNoObject("policy/v1beta1", "PodSecurityPolicy", "", "nalej-restricted")
+			role := cluster.ExpectObject("rbac.authorization.k8s.io/v1", "ClusterRole", "", "nalej-restricted")
+			rules, _, _ := unstructured.NestedSlice(role.Object, "rules")
+			gomega.Expect(rules[0].(map[string]interface{})["resources"]).To(gomega.Equal([]interface{}{"securitycontextconstraints"}))
+			cluster.ExpectNoObject("v1", "ConfigMap", "nalej", "nginx-config")
+		})
+	})
 })
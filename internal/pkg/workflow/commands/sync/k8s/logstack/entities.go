@@ -0,0 +1,638 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Logging stack
+// The logs of the containers of the platform namespaces are shipped either to Loki by promtail, or to Elasticsearch
+// by fluent-bit with Kibana to query them. The shippers run as a DaemonSet reading the container logs of each node,
+// and the retention is enforced by the Loki table manager or by an Elasticsearch lifecycle policy.
+
+package logstack
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	appsV1 "k8s.io/api/apps/v1"
+	batchV1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	rbacV1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Namespace where the logging stack is installed.
+const Namespace = "logging"
+
+// Supported logging stacks.
+const (
+	// LokiStack ships the logs with promtail to Loki.
+	LokiStack = "loki"
+	// EFKStack ships the logs with fluent-bit to Elasticsearch, queried from Kibana.
+	EFKStack = "efk"
+)
+
+// Names of the components of the stacks.
+const (
+	LokiName          = "loki"
+	PromtailName      = "promtail"
+	ElasticsearchName = "elasticsearch"
+	FluentBitName     = "fluent-bit"
+	KibanaName        = "kibana"
+)
+
+// Ports of the components of the stacks.
+const (
+	LokiPort          = 3100
+	PromtailPort      = 9080
+	ElasticsearchPort = 9200
+	KibanaPort        = 5601
+)
+
+// DefaultImages of the components of the stacks.
+var DefaultImages = map[string]string{
+	LokiName:          "grafana/loki:v1.2.0",
+	PromtailName:      "grafana/promtail:v1.2.0",
+	ElasticsearchName: "docker.elastic.co/elasticsearch/elasticsearch:7.5.1",
+	FluentBitName:     "fluent/fluent-bit:1.3.5",
+	KibanaName:        "docker.elastic.co/kibana/kibana:7.5.1",
+	RetentionJobName:  "curlimages/curl:7.68.0",
+}
+
+// RetentionJobName is the name of the job creating the Elasticsearch lifecycle policy.
+const RetentionJobName = "elasticsearch-retention"
+
+// DefaultPlatformNamespaces whose logs are shipped if not specified.
+var DefaultPlatformNamespaces = []string{"nalej"}
+
+// DefaultRetention of the logs.
+const DefaultRetention = "168h"
+
+// MinRetention of the logs, both Loki and the Elasticsearch indexes rotate daily.
+const MinRetention = 24 * time.Hour
+
+// DefaultStorageSize of the volume storing the logs.
+const DefaultStorageSize = "10Gi"
+
+// IndexPrefix of the Elasticsearch indexes with the logs.
+const IndexPrefix = "nalej-logs"
+
+// SupportedStacks returns the names of the supported logging stacks.
+func SupportedStacks() []string {
+	return []string{LokiStack, EFKStack}
+}
+
+// Labels returns the labels of the objects of a component.
+func Labels(component string) map[string]string {
+	return map[string]string{
+		"cluster":   "management",
+		"component": component,
+		"app":       component,
+	}
+}
+
+// RetentionDays returns the number of days the logs are kept, rounding up the retention to whole days.
+//   params:
+//     retention The retention as a duration such as 168h.
+//   returns:
+//     The number of days.
+//     An error if the retention is not valid or shorter than MinRetention.
+func RetentionDays(retention string) (int, derrors.Error) {
+	duration, err := time.ParseDuration(retention)
+	if err != nil {
+		return 0, derrors.NewInvalidArgumentError("invalid log retention", err).WithParams(retention)
+	}
+	if duration < MinRetention {
+		return 0, derrors.NewInvalidArgumentError("log retention must be at least one day").WithParams(retention)
+	}
+	days := duration / MinRetention
+	if duration%MinRetention != 0 {
+		days++
+	}
+	return int(days), nil
+}
+
+// LokiConfig returns the configuration of a single node Loki storing the chunks on the filesystem.
+//   params:
+//     retentionDays The number of days the logs are kept.
+//   returns:
+//     The content of loki.yaml.
+func LokiConfig(retentionDays int) string {
+	hours := retentionDays * 24
+	return fmt.Sprintf(`auth_enabled: false
+server:
+  http_listen_port: %d
+ingester:
+  lifecycler:
+    ring:
+      kvstore:
+        store: inmemory
+      replication_factor: 1
+  chunk_idle_period: 15m
+schema_config:
+  configs:
+  - from: 2019-01-01
+    store: boltdb
+    object_store: filesystem
+    schema: v11
+    index:
+      prefix: index_
+      period: 24h
+storage_config:
+  boltdb:
+    directory: /data/loki/index
+  filesystem:
+    directory: /data/loki/chunks
+limits_config:
+  enforce_metric_name: false
+  reject_old_samples: true
+  reject_old_samples_max_age: %dh
+chunk_store_config:
+  max_look_back_period: %dh
+table_manager:
+  retention_deletes_enabled: true
+  retention_period: %dh
+`, LokiPort, hours, hours, hours)
+}
+
+// PromtailConfig returns the configuration of promtail shipping the logs of the pods of the platform namespaces.
+//   params:
+//     platformNamespaces The namespaces whose logs are shipped.
+//   returns:
+//     The content of promtail.yaml.
+func PromtailConfig(platformNamespaces []string) string {
+	return fmt.Sprintf(`server:
+  http_listen_port: %d
+positions:
+  filename: /run/promtail/positions.yaml
+clients:
+- url: http://%s.%s:%d/loki/api/v1/push
+scrape_configs:
+- job_name: platform-pods
+  kubernetes_sd_configs:
+  - role: pod
+    namespaces:
+      names: [%s]
+  relabel_configs:
+  - source_labels: [__meta_kubernetes_pod_node_name]
+    target_label: __host__
+  - source_labels: [__meta_kubernetes_namespace]
+    target_label: namespace
+  - source_labels: [__meta_kubernetes_pod_label_component]
+    target_label: component
+  - source_labels: [__meta_kubernetes_pod_name]
+    target_label: pod
+  - source_labels: [__meta_kubernetes_pod_container_name]
+    target_label: container
+  - source_labels: [__meta_kubernetes_pod_uid, __meta_kubernetes_pod_container_name]
+    separator: /
+    replacement: /var/log/pods/*$1/*.log
+    target_label: __path__
+`, PromtailPort, LokiName, Namespace, LokiPort, strings.Join(platformNamespaces, ", "))
+}
+
+// FluentBitConfig returns the configuration of fluent-bit shipping the logs of the containers of the platform
+// namespaces to daily Elasticsearch indexes.
+//   params:
+//     platformNamespaces The namespaces whose logs are shipped.
+//   returns:
+//     The fluent-bit.conf and parsers.conf files.
+func FluentBitConfig(platformNamespaces []string) map[string]string {
+	paths := make([]string, 0, len(platformNamespaces))
+	for _, namespace := range platformNamespaces {
+		paths = append(paths, fmt.Sprintf("/var/log/containers/*_%s_*.log", namespace))
+	}
+	return map[string]string{
+		"fluent-bit.conf": fmt.Sprintf(`[SERVICE]
+    Flush         5
+    Log_Level     info
+    Parsers_File  parsers.conf
+
+[INPUT]
+    Name              tail
+    Tag               kube.*
+    Path              %s
+    Parser            docker
+    DB                /var/log/flb_kube.db
+    Mem_Buf_Limit     5MB
+    Refresh_Interval  10
+
+[FILTER]
+    Name      kubernetes
+    Match     kube.*
+    Merge_Log On
+    Keep_Log  Off
+
+[OUTPUT]
+    Name            es
+    Match           *
+    Host            %s.%s
+    Port            %d
+    Logstash_Format On
+    Logstash_Prefix %s
+    Replace_Dots    On
+    Retry_Limit     False
+`, strings.Join(paths, ","), ElasticsearchName, Namespace, ElasticsearchPort, IndexPrefix),
+		"parsers.conf": `[PARSER]
+    Name        docker
+    Format      json
+    Time_Key    time
+    Time_Format %Y-%m-%dT%H:%M:%S.%L
+    Time_Keep   On
+`,
+	}
+}
+
+// RetentionScript returns the script creating the lifecycle policy that removes the indexes older than the
+// retention, and the index template applying it to the log indexes.
+//   params:
+//     retentionDays The number of days the logs are kept.
+//   returns:
+//     The shell script run by the retention job.
+func RetentionScript(retentionDays int) string {
+	address := fmt.Sprintf("http://%s.%s:%d", ElasticsearchName, Namespace, ElasticsearchPort)
+	return fmt.Sprintf(`set -e
+until curl -sf %[1]s/_cluster/health; do sleep 5; done
+curl -sf -X PUT -H 'Content-Type: application/json' %[1]s/_ilm/policy/%[2]s \
+  -d '{"policy":{"phases":{"delete":{"min_age":"%[3]dd","actions":{"delete":{}}}}}}'
+curl -sf -X PUT -H 'Content-Type: application/json' %[1]s/_template/%[2]s \
+  -d '{"index_patterns":["%[2]s-*"],"settings":{"number_of_replicas":0,"index.lifecycle.name":"%[2]s"}}'
+`, address, IndexPrefix, retentionDays)
+}
+
+// NewConfigMap creates a configmap of a component.
+func NewConfigMap(component string, data map[string]string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      component,
+			Namespace: Namespace,
+			Labels:    Labels(component),
+		},
+		Data: data,
+	}
+}
+
+// NewStorage creates the persistent volume claim storing the logs.
+//   params:
+//     component The component storing the logs.
+//     size The requested size, DefaultStorageSize if empty.
+//     storageClass The storage class, the default one of the cluster if empty.
+//   returns:
+//     The claim.
+//     An error if the size is not valid.
+func NewStorage(component string, size string, storageClass string) (*v1.PersistentVolumeClaim, derrors.Error) {
+	if size == "" {
+		size = DefaultStorageSize
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("invalid storage size", err).WithParams(size)
+	}
+	claim := &v1.PersistentVolumeClaim{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "PersistentVolumeClaim",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      component,
+			Namespace: Namespace,
+			Labels:    Labels(component),
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: quantity},
+			},
+		},
+	}
+	if storageClass != "" {
+		claim.Spec.StorageClassName = &storageClass
+	}
+	return claim, nil
+}
+
+// NewServiceAccount creates the service account of a log shipper.
+func NewServiceAccount(component string) *v1.ServiceAccount {
+	return &v1.ServiceAccount{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ServiceAccount",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      component,
+			Namespace: Namespace,
+			Labels:    Labels(component),
+		},
+	}
+}
+
+// roleName returns the name of the cluster role of a component, prefixed as the roles are not namespaced.
+func roleName(component string) string {
+	return fmt.Sprintf("%s-%s", Namespace, component)
+}
+
+// NewClusterRole creates the role of a log shipper, allowed to read the metadata of the pods.
+func NewClusterRole(component string) *rbacV1.ClusterRole {
+	return &rbacV1.ClusterRole{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ClusterRole",
+			APIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:   roleName(component),
+			Labels: Labels(component),
+		},
+		Rules: []rbacV1.PolicyRule{{
+			APIGroups: []string{""},
+			Resources: []string{"nodes", "namespaces", "pods"},
+			Verbs:     []string{"get", "list", "watch"},
+		}},
+	}
+}
+
+// NewClusterRoleBinding creates the binding of the role of a log shipper to its service account.
+func NewClusterRoleBinding(component string) *rbacV1.ClusterRoleBinding {
+	return &rbacV1.ClusterRoleBinding{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ClusterRoleBinding",
+			APIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:   roleName(component),
+			Labels: Labels(component),
+		},
+		RoleRef: rbacV1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     roleName(component),
+		},
+		Subjects: []rbacV1.Subject{{
+			Kind:      "ServiceAccount",
+			Name:      component,
+			Namespace: Namespace,
+		}},
+	}
+}
+
+// configVolume mounts the configmap of a component on its container.
+func configVolume(component string, mountPath string) (v1.Volume, v1.VolumeMount) {
+	return v1.Volume{
+		Name: "config",
+		VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+			LocalObjectReference: v1.LocalObjectReference{Name: component},
+		}},
+	}, v1.VolumeMount{
+		Name:      "config",
+		MountPath: mountPath,
+		ReadOnly:  true,
+	}
+}
+
+// storageVolume mounts the claim of a component on its container.
+func storageVolume(component string, mountPath string) (v1.Volume, v1.VolumeMount) {
+	return v1.Volume{
+		Name: "storage",
+		VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+			ClaimName: component,
+		}},
+	}, v1.VolumeMount{
+		Name:      "storage",
+		MountPath: mountPath,
+	}
+}
+
+// hostVolumes mounts the directories of the node with the container logs.
+func hostVolumes() ([]v1.Volume, []v1.VolumeMount) {
+	paths := map[string]string{
+		"varlog":     "/var/log",
+		"containers": "/var/lib/docker/containers",
+	}
+	volumes := make([]v1.Volume, 0, len(paths))
+	mounts := make([]v1.VolumeMount, 0, len(paths))
+	for _, name := range []string{"varlog", "containers"} {
+		volumes = append(volumes, v1.Volume{
+			Name:         name,
+			VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: paths[name]}},
+		})
+		// fluent-bit keeps the offsets of the files on /var/log.
+		mounts = append(mounts, v1.VolumeMount{Name: name, MountPath: paths[name], ReadOnly: name != "varlog"})
+	}
+	return volumes, mounts
+}
+
+// podTemplate creates the pod template of a component.
+func podTemplate(component string, serviceAccount string, container v1.Container, volumes []v1.Volume) v1.PodTemplateSpec {
+	container.Name = component
+	container.ImagePullPolicy = v1.PullIfNotPresent
+	return v1.PodTemplateSpec{
+		ObjectMeta: metaV1.ObjectMeta{Labels: Labels(component)},
+		Spec: v1.PodSpec{
+			ServiceAccountName: serviceAccount,
+			Containers:         []v1.Container{container},
+			Volumes:            volumes,
+		},
+	}
+}
+
+// NewDeployment creates the single replica deployment of a component. The previous pod is stopped before launching
+// a new one as the volume cannot be shared.
+func NewDeployment(component string, container v1.Container, volumes []v1.Volume) *appsV1.Deployment {
+	replicas := int32(1)
+	return &appsV1.Deployment{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      component,
+			Namespace: Namespace,
+			Labels:    Labels(component),
+		},
+		Spec: appsV1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metaV1.LabelSelector{MatchLabels: Labels(component)},
+			Strategy: appsV1.DeploymentStrategy{Type: appsV1.RecreateDeploymentStrategyType},
+			Template: podTemplate(component, "", container, volumes),
+		},
+	}
+}
+
+// NewDaemonSet creates the daemonset of a log shipper, running on every node including the masters.
+func NewDaemonSet(component string, container v1.Container, volumes []v1.Volume) *appsV1.DaemonSet {
+	template := podTemplate(component, component, container, volumes)
+	template.Spec.Tolerations = []v1.Toleration{{Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}}
+	return &appsV1.DaemonSet{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "DaemonSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      component,
+			Namespace: Namespace,
+			Labels:    Labels(component),
+		},
+		Spec: appsV1.DaemonSetSpec{
+			Selector: &metaV1.LabelSelector{MatchLabels: Labels(component)},
+			Template: template,
+		},
+	}
+}
+
+// NewService creates the service of a component.
+func NewService(component string, port int32) *v1.Service {
+	return &v1.Service{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      component,
+			Namespace: Namespace,
+			Labels:    Labels(component),
+		},
+		Spec: v1.ServiceSpec{
+			Type:     v1.ServiceTypeClusterIP,
+			Selector: Labels(component),
+			Ports: []v1.ServicePort{{
+				Name:       "http",
+				Protocol:   v1.ProtocolTCP,
+				Port:       port,
+				TargetPort: intstr.FromInt(int(port)),
+			}},
+		},
+	}
+}
+
+// NewRetentionJob creates the job configuring the retention of the Elasticsearch indexes. The name includes the
+// retention so a new job is launched when it changes.
+func NewRetentionJob(image string, retentionDays int) *batchV1.Job {
+	backoffLimit := int32(10)
+	name := fmt.Sprintf("%s-%dd", RetentionJobName, retentionDays)
+	container := v1.Container{
+		Name:            RetentionJobName,
+		Image:           image,
+		ImagePullPolicy: v1.PullIfNotPresent,
+		Command:         []string{"/bin/sh", "-c", RetentionScript(retentionDays)},
+	}
+	return &batchV1.Job{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      name,
+			Namespace: Namespace,
+			Labels:    Labels(RetentionJobName),
+		},
+		Spec: batchV1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metaV1.ObjectMeta{Labels: Labels(RetentionJobName)},
+				Spec: v1.PodSpec{
+					RestartPolicy: v1.RestartPolicyOnFailure,
+					Containers:    []v1.Container{container},
+				},
+			},
+		},
+	}
+}
+
+// LokiObjects returns the objects required to ship the logs to Loki.
+func LokiObjects(images map[string]string, platformNamespaces []string, retentionDays int, storage *v1.PersistentVolumeClaim) []runtime.Object {
+	lokiConfig, lokiConfigMount := configVolume(LokiName, "/etc/loki")
+	lokiStorage, lokiStorageMount := storageVolume(LokiName, "/data")
+	loki := v1.Container{
+		Image:        images[LokiName],
+		Args:         []string{"-config.file=/etc/loki/loki.yaml"},
+		Ports:        []v1.ContainerPort{{Name: "http", ContainerPort: LokiPort}},
+		VolumeMounts: []v1.VolumeMount{lokiConfigMount, lokiStorageMount},
+	}
+	promtailConfig, promtailConfigMount := configVolume(PromtailName, "/etc/promtail")
+	volumes, mounts := hostVolumes()
+	promtail := v1.Container{
+		Image: images[PromtailName],
+		Args:  []string{"-config.file=/etc/promtail/promtail.yaml"},
+		// promtail only reads the logs of the pods of its node.
+		Env: []v1.EnvVar{{Name: "HOSTNAME", ValueFrom: &v1.EnvVarSource{
+			FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+		}}},
+		Ports:        []v1.ContainerPort{{Name: "http", ContainerPort: PromtailPort}},
+		VolumeMounts: append(mounts, promtailConfigMount),
+	}
+	return []runtime.Object{
+		NewConfigMap(LokiName, map[string]string{"loki.yaml": LokiConfig(retentionDays)}),
+		storage,
+		NewDeployment(LokiName, loki, []v1.Volume{lokiConfig, lokiStorage}),
+		NewService(LokiName, LokiPort),
+		NewServiceAccount(PromtailName),
+		NewClusterRole(PromtailName),
+		NewClusterRoleBinding(PromtailName),
+		NewConfigMap(PromtailName, map[string]string{"promtail.yaml": PromtailConfig(platformNamespaces)}),
+		NewDaemonSet(PromtailName, promtail, append(volumes, promtailConfig)),
+	}
+}
+
+// EFKObjects returns the objects required to ship the logs to Elasticsearch.
+func EFKObjects(images map[string]string, platformNamespaces []string, retentionDays int, storage *v1.PersistentVolumeClaim) []runtime.Object {
+	esStorage, esStorageMount := storageVolume(ElasticsearchName, "/usr/share/elasticsearch/data")
+	elasticsearch := v1.Container{
+		Image: images[ElasticsearchName],
+		Env: []v1.EnvVar{
+			{Name: "discovery.type", Value: "single-node"},
+			{Name: "xpack.security.enabled", Value: "false"},
+			{Name: "ES_JAVA_OPTS", Value: "-Xms512m -Xmx512m"},
+		},
+		Ports:        []v1.ContainerPort{{Name: "http", ContainerPort: ElasticsearchPort}},
+		VolumeMounts: []v1.VolumeMount{esStorageMount},
+	}
+	esDeployment := NewDeployment(ElasticsearchName, elasticsearch, []v1.Volume{esStorage})
+	// The data directory must be writable by the elasticsearch user.
+	fsGroup := int64(1000)
+	esDeployment.Spec.Template.Spec.SecurityContext = &v1.PodSecurityContext{FSGroup: &fsGroup}
+	kibana := v1.Container{
+		Image: images[KibanaName],
+		Env: []v1.EnvVar{{Name: "ELASTICSEARCH_HOSTS",
+			Value: fmt.Sprintf("http://%s.%s:%d", ElasticsearchName, Namespace, ElasticsearchPort)}},
+		Ports: []v1.ContainerPort{{Name: "http", ContainerPort: KibanaPort}},
+	}
+	fluentBitConfig, fluentBitConfigMount := configVolume(FluentBitName, "/fluent-bit/etc")
+	volumes, mounts := hostVolumes()
+	fluentBit := v1.Container{
+		Image:        images[FluentBitName],
+		VolumeMounts: append(mounts, fluentBitConfigMount),
+	}
+	return []runtime.Object{
+		storage,
+		esDeployment,
+		NewService(ElasticsearchName, ElasticsearchPort),
+		NewRetentionJob(images[RetentionJobName], retentionDays),
+		NewDeployment(KibanaName, kibana, nil),
+		NewService(KibanaName, KibanaPort),
+		NewServiceAccount(FluentBitName),
+		NewClusterRole(FluentBitName),
+		NewClusterRoleBinding(FluentBitName),
+		NewConfigMap(FluentBitName, FluentBitConfig(platformNamespaces)),
+		NewDaemonSet(FluentBitName, fluentBit, append(volumes, fluentBitConfig)),
+	}
+}
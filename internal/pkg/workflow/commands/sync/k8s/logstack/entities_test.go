@@ -0,0 +1,125 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logstack
+
+import (
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+)
+
+var _ = ginkgo.Describe("Logging stack", func() {
+
+	ginkgo.Context("entities", func() {
+		ginkgo.It("should round up the retention to whole days", func() {
+			days, err := RetentionDays("168h")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(days).Should(gomega.Equal(7))
+			days, err = RetentionDays("36h")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(days).Should(gomega.Equal(2))
+			_, err = RetentionDays("12h")
+			gomega.Expect(err).ShouldNot(gomega.Succeed())
+			_, err = RetentionDays("a week")
+			gomega.Expect(err).ShouldNot(gomega.Succeed())
+		})
+
+		ginkgo.It("should generate valid Loki and promtail configurations", func() {
+			config := make(map[string]interface{})
+			gomega.Expect(yaml.Unmarshal([]byte(LokiConfig(7)), &config)).To(gomega.Succeed())
+			gomega.Expect(config["table_manager"]).Should(gomega.HaveKeyWithValue("retention_period", "168h"))
+			promtail := PromtailConfig([]string{"nalej", "apps"})
+			gomega.Expect(yaml.Unmarshal([]byte(promtail), &config)).To(gomega.Succeed())
+			gomega.Expect(promtail).Should(gomega.ContainSubstring("names: [nalej, apps]"))
+		})
+
+		ginkgo.It("should only read the logs of the platform namespaces with fluent-bit", func() {
+			config := FluentBitConfig([]string{"nalej", "apps"})
+			gomega.Expect(config).Should(gomega.HaveKey("parsers.conf"))
+			gomega.Expect(config["fluent-bit.conf"]).Should(gomega.ContainSubstring(
+				"/var/log/containers/*_nalej_*.log,/var/log/containers/*_apps_*.log"))
+		})
+
+		ginkgo.It("should configure the retention of the Elasticsearch indexes", func() {
+			job := NewRetentionJob(DefaultImages[RetentionJobName], 30)
+			gomega.Expect(job.Name).Should(gomega.Equal("elasticsearch-retention-30d"))
+			gomega.Expect(job.Spec.Template.Spec.Containers[0].Command[2]).Should(gomega.ContainSubstring(`"min_age":"30d"`))
+		})
+	})
+
+	ginkgo.Context("install command", func() {
+		var cluster *k8stest.FakeCluster
+
+		ginkgo.BeforeEach(func() {
+			cluster = k8stest.NewFakeCluster()
+			k8s.RegisterClients(cluster.KubeConfigPath, cluster.Client, cluster.Discovery, cluster.Dynamic)
+		})
+
+		ginkgo.AfterEach(func() {
+			k8s.UnregisterClients(cluster.KubeConfigPath)
+		})
+
+		ginkgo.It("should apply the default values when read from JSON", func() {
+			raw := []byte(`{"type":"sync", "name":"installLoggingStack", "kubeConfigPath":"/tmp/kc", "stack":"loki",
+				"images":{"loki":"registry/loki:v1"}}`)
+			cmd, err := NewInstallLoggingStackFromJSON(raw)
+			gomega.Expect(err).To(gomega.Succeed())
+			ils := (*cmd).(*InstallLoggingStack)
+			gomega.Expect(ils.Retention).Should(gomega.Equal(DefaultRetention))
+			gomega.Expect(ils.StorageSize).Should(gomega.Equal(DefaultStorageSize))
+			gomega.Expect(ils.PlatformNamespaces).Should(gomega.Equal(DefaultPlatformNamespaces))
+			gomega.Expect(ils.images()).Should(gomega.HaveKeyWithValue(LokiName, "registry/loki:v1"))
+			gomega.Expect(ils.images()).Should(gomega.HaveKeyWithValue(PromtailName, DefaultImages[PromtailName]))
+		})
+
+		ginkgo.It("should install Loki and promtail", func() {
+			cmd := NewInstallLoggingStack(cluster.KubeConfigPath, LokiStack, DefaultRetention)
+			cmd.PlatformType = grpc_installer_go.Platform_AZURE.String()
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			claim := cluster.ExpectObject("v1", "PersistentVolumeClaim", Namespace, LokiName)
+			gomega.Expect(claim.Object["spec"]).Should(gomega.HaveKeyWithValue("storageClassName", k8s.AzureStorageClass))
+			cluster.ExpectObject("apps/v1", "Deployment", Namespace, LokiName)
+			cluster.ExpectObject("apps/v1", "DaemonSet", Namespace, PromtailName)
+			cluster.ExpectObject("rbac.authorization.k8s.io/v1", "ClusterRoleBinding", "", "logging-promtail")
+			cluster.ExpectNoObject("apps/v1", "DaemonSet", Namespace, FluentBitName)
+		})
+
+		ginkgo.It("should install Elasticsearch, Kibana and fluent-bit", func() {
+			result, err := NewInstallLoggingStack(cluster.KubeConfigPath, EFKStack, "720h").Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			cluster.ExpectObject("apps/v1", "Deployment", Namespace, ElasticsearchName)
+			cluster.ExpectObject("apps/v1", "Deployment", Namespace, KibanaName)
+			cluster.ExpectObject("apps/v1", "DaemonSet", Namespace, FluentBitName)
+			cluster.ExpectObject("batch/v1", "Job", Namespace, "elasticsearch-retention-30d")
+			cluster.ExpectNoObject("apps/v1", "Deployment", Namespace, LokiName)
+		})
+
+		ginkgo.It("should reject unsupported stacks", func() {
+			result, err := NewInstallLoggingStack(cluster.KubeConfigPath, "splunk", DefaultRetention).Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeFalse())
+			cluster.ExpectNoObject("v1", "Namespace", "", Namespace)
+		})
+	})
+})
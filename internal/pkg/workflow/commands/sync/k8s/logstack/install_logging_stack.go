@@ -0,0 +1,164 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/overlay"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// InstallLoggingStack structure with the attributes required to install a logging stack shipping the logs of the
+// platform namespaces.
+type InstallLoggingStack struct {
+	k8s.Kubernetes
+	// Stack with the name of the logging stack: loki or efk.
+	Stack string `json:"stack"`
+	// PlatformNamespaces whose logs are shipped, DefaultPlatformNamespaces if not set.
+	PlatformNamespaces []string `json:"platform_namespaces"`
+	// Retention of the logs as a duration rounded up to whole days, DefaultRetention if not set.
+	Retention string `json:"retention"`
+	// StorageSize of the volume storing the logs, DefaultStorageSize if not set.
+	StorageSize string `json:"storage_size"`
+	// PlatformType with the platform where the cluster runs, used to select the storage class.
+	PlatformType string `json:"platform_type"`
+	// StorageClass of the volume storing the logs, the one of the platform if not set.
+	StorageClass string `json:"storage_class"`
+	// Images overriding the DefaultImages indexed by component name.
+	Images map[string]string `json:"images"`
+}
+
+// NewInstallLoggingStack creates a new InstallLoggingStack command.
+func NewInstallLoggingStack(kubeConfigPath string, stack string, retention string) *InstallLoggingStack {
+	return &InstallLoggingStack{
+		Kubernetes: k8s.Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.InstallLoggingStack),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Stack:              stack,
+		PlatformNamespaces: DefaultPlatformNamespaces,
+		Retention:          retention,
+		StorageSize:        DefaultStorageSize,
+	}
+}
+
+// NewInstallLoggingStackFromJSON creates a new InstallLoggingStack command from a raw JSON representation.
+func NewInstallLoggingStackFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	ils := &InstallLoggingStack{}
+	if err := json.Unmarshal(raw, &ils); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	if len(ils.PlatformNamespaces) == 0 {
+		ils.PlatformNamespaces = DefaultPlatformNamespaces
+	}
+	if ils.Retention == "" {
+		ils.Retention = DefaultRetention
+	}
+	if ils.StorageSize == "" {
+		ils.StorageSize = DefaultStorageSize
+	}
+	ils.CommandID = entities.GenerateCommandID(ils.Name())
+	var r entities.Command = ils
+	return &r, nil
+}
+
+// images returns the images of the components with the overrides of the command.
+func (ils *InstallLoggingStack) images() map[string]string {
+	result := make(map[string]string, len(DefaultImages))
+	for component, image := range DefaultImages {
+		result[component] = image
+	}
+	for component, image := range ils.Images {
+		if image != "" {
+			result[component] = image
+		}
+	}
+	return result
+}
+
+// Objects returns the objects of the selected stack.
+//   returns:
+//     The objects to be applied.
+//     An error if the stack, the retention or the storage size are not valid.
+func (ils *InstallLoggingStack) Objects() ([]runtime.Object, derrors.Error) {
+	retentionDays, err := RetentionDays(ils.Retention)
+	if err != nil {
+		return nil, err
+	}
+	storageClass := overlay.StorageClass(ils.PlatformType, ils.StorageClass)
+	switch ils.Stack {
+	case LokiStack:
+		storage, err := NewStorage(LokiName, ils.StorageSize, storageClass)
+		if err != nil {
+			return nil, err
+		}
+		return LokiObjects(ils.images(), ils.PlatformNamespaces, retentionDays, storage), nil
+	case EFKStack:
+		storage, err := NewStorage(ElasticsearchName, ils.StorageSize, storageClass)
+		if err != nil {
+			return nil, err
+		}
+		return EFKObjects(ils.images(), ils.PlatformNamespaces, retentionDays, storage), nil
+	}
+	return nil, derrors.NewInvalidArgumentError("unsupported logging stack").WithParams(ils.Stack, SupportedStacks())
+}
+
+// Run the current command returning the result or an error.
+func (ils *InstallLoggingStack) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	objects, err := ils.Objects()
+	if err != nil {
+		return entities.NewCommandResult(false, "invalid logging stack configuration", err), nil
+	}
+	connectErr := ils.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	if err := ils.EnsureNamespace(Namespace, k8s.NamespaceOptions{}); err != nil {
+		return entities.NewCommandResult(false, "cannot create namespace", err), nil
+	}
+	summary := &k8s.ApplySummary{}
+	for _, obj := range objects {
+		if err := ils.Apply(obj, k8s.ApplyOptions{}, summary); err != nil {
+			return entities.NewCommandResult(false, "cannot apply logging stack object", err), nil
+		}
+	}
+	msg := fmt.Sprintf("%s logging stack shipping the logs of %s", ils.Stack, strings.Join(ils.PlatformNamespaces, ", "))
+	return entities.NewSuccessCommand([]byte(msg)).WithObjects(summary.Applied()), nil
+}
+
+// String returns a string representation
+func (ils *InstallLoggingStack) String() string {
+	return fmt.Sprintf("SYNC InstallLoggingStack %s with retention %s", ils.Stack, ils.Retention)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (ils *InstallLoggingStack) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + ils.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (ils *InstallLoggingStack) UserString() string {
+	return fmt.Sprintf("Installing %s logging stack", ils.Stack)
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the content of the management-config ConfigMap read by the platform components, so they do not
+// need their own flags for the settings of the install.
+
+package k8s
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ManagementConfigName is the name of the ConfigMap with the management config.
+const ManagementConfigName = "management-config"
+
+// ManagementConfigSchemaKey is the key of the ConfigMap with the version of its schema.
+const ManagementConfigSchemaKey = "schema_version"
+
+// ManagementConfigSchemaVersion is the version of the schema written by the installer. Version 1, without the
+// schema_version key, only contains the hosts, ports, platform type and environment.
+const ManagementConfigSchemaVersion = 2
+
+// DefaultClusterDomain is the DNS domain of the services of the cluster if none is specified.
+const DefaultClusterDomain = "cluster.local"
+
+// ManagementConfig with the settings of the management cluster shared with the platform components. Each field is
+// stored as a key of the ConfigMap.
+type ManagementConfig struct {
+	// PublicHost and PublicPort with the address of the management cluster.
+	PublicHost string `json:"public_host"`
+	PublicPort string `json:"public_port"`
+	// DNSHost and DNSPort with the address of the DNS of the platform.
+	DNSHost string `json:"dns_host"`
+	DNSPort string `json:"dns_port"`
+	// PlatformType with the platform of the cluster, such as AZURE.
+	PlatformType string `json:"platform_type"`
+	// Environment with the target environment of the install: PRODUCTION, STAGING, or DEVELOPMENT.
+	Environment string `json:"environment"`
+	// ClusterDomain with the DNS domain of the services of the cluster.
+	ClusterDomain string `json:"cluster_domain"`
+	// MeshEnabled indicates if the platform runs on the Istio mesh.
+	MeshEnabled bool `json:"mesh_enabled,string"`
+}
+
+// ValidateClusterDomain checks that a cluster domain is a valid DNS subdomain.
+func ValidateClusterDomain(domain string) derrors.Error {
+	if errs := validation.IsDNS1123Subdomain(domain); len(errs) > 0 {
+		return derrors.NewInvalidArgumentError("invalid cluster domain").WithParams(domain, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Data returns the content of the ConfigMap with the management config, including the version of its schema.
+func (mc *ManagementConfig) Data() (map[string]string, derrors.Error) {
+	content, err := json.Marshal(mc)
+	if err != nil {
+		return nil, derrors.NewInternalError("cannot marshal management config", err)
+	}
+	data := make(map[string]string, 0)
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, derrors.NewInternalError("cannot marshal management config", err)
+	}
+	data[ManagementConfigSchemaKey] = strconv.Itoa(ManagementConfigSchemaVersion)
+	return data, nil
+}
+
+// ManagementConfigFromData reads the management config from the content of its ConfigMap. Configs of previous
+// schema versions are accepted, leaving the fields they do not contain empty.
+//   params:
+//     data The content of the ConfigMap.
+//   returns:
+//     The management config.
+//     An error if the schema version is not supported or the content cannot be parsed.
+func ManagementConfigFromData(data map[string]string) (*ManagementConfig, derrors.Error) {
+	version := 1
+	if raw, exists := data[ManagementConfigSchemaKey]; exists {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, derrors.NewInvalidArgumentError("invalid management config schema version", err).WithParams(raw)
+		}
+		version = parsed
+	}
+	if version < 1 || version > ManagementConfigSchemaVersion {
+		return nil, derrors.NewInvalidArgumentError("unsupported management config schema version").WithParams(version)
+	}
+	fields := make(map[string]string, len(data))
+	for key, value := range data {
+		if key != ManagementConfigSchemaKey {
+			fields[key] = value
+		}
+	}
+	content, err := json.Marshal(fields)
+	if err != nil {
+		return nil, derrors.NewInternalError("cannot marshal management config", err)
+	}
+	result := &ManagementConfig{}
+	if err := json.Unmarshal(content, result); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse management config", err)
+	}
+	return result, nil
+}
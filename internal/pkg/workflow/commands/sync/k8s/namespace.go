@@ -0,0 +1,115 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the creation of the namespaces used by the commands, together with their labels and annotations.
+
+package k8s
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ManagedByLabel identifies the namespaces created by the installer.
+const ManagedByLabel = "app.kubernetes.io/managed-by"
+
+// ManagedByInstaller is the value of the ManagedByLabel of the namespaces created by the installer.
+const ManagedByInstaller = "nalej-installer"
+
+// NamespaceOptions with the metadata of a namespace.
+type NamespaceOptions struct {
+	// Labels set on the namespace, replacing the existing values.
+	Labels map[string]string
+	// RemovedLabels with the keys of the labels removed from the namespace.
+	RemovedLabels []string
+	// Annotations set on the namespace, replacing the existing values.
+	Annotations map[string]string
+}
+
+// apply sets the metadata on a namespace.
+//   returns:
+//     Whether the namespace has been modified.
+func (o NamespaceOptions) apply(namespace *v1.Namespace) bool {
+	changed := false
+	if namespace.Labels == nil {
+		namespace.Labels = make(map[string]string, 0)
+	}
+	if namespace.Annotations == nil {
+		namespace.Annotations = make(map[string]string, 0)
+	}
+	for key, value := range o.Labels {
+		if current, exists := namespace.Labels[key]; !exists || current != value {
+			namespace.Labels[key] = value
+			changed = true
+		}
+	}
+	for _, key := range o.RemovedLabels {
+		if _, exists := namespace.Labels[key]; exists {
+			delete(namespace.Labels, key)
+			changed = true
+		}
+	}
+	for key, value := range o.Annotations {
+		if current, exists := namespace.Annotations[key]; !exists || current != value {
+			namespace.Annotations[key] = value
+			changed = true
+		}
+	}
+	return changed
+}
+
+// EnsureNamespace creates a namespace if it does not exist and sets its labels and annotations. The namespaces created
+// by the installer are labeled with ManagedByLabel, while the existing ones keep their ownership.
+//   params:
+//     name The name of the namespace.
+//     options The metadata of the namespace.
+//   returns:
+//     An error if the namespace cannot be created or updated.
+func (k *Kubernetes) EnsureNamespace(name string, options NamespaceOptions) derrors.Error {
+	client := k.Client.CoreV1().Namespaces()
+	namespace, err := client.Get(name, metaV1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		toCreate := &v1.Namespace{ObjectMeta: metaV1.ObjectMeta{Name: name}}
+		options.apply(toCreate)
+		toCreate.Labels[ManagedByLabel] = ManagedByInstaller
+		_, err = client.Create(toCreate)
+		if k8sErrors.IsAlreadyExists(err) {
+			// Created concurrently, its metadata is updated below.
+			namespace, err = client.Get(name, metaV1.GetOptions{})
+		} else if err != nil {
+			return AsQueryError(err, "cannot create namespace", name)
+		} else {
+			log.Debug().Str("namespace", name).Msg("namespace created")
+			return nil
+		}
+	}
+	if err != nil {
+		return AsQueryError(err, "cannot retrieve namespace", name)
+	}
+	if !options.apply(namespace) {
+		log.Debug().Str("namespace", name).Msg("namespace already exists")
+		return nil
+	}
+	if _, err := client.Update(namespace); err != nil {
+		return AsQueryError(err, "cannot update namespace", name)
+	}
+	log.Debug().Str("namespace", name).Msg("namespace updated")
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = ginkgo.Describe("The namespaces", func() {
+
+	var cluster *k8stest.FakeCluster
+	var k *Kubernetes
+
+	get := func(name string) *v1.Namespace {
+		namespace, err := cluster.Client.CoreV1().Namespaces().Get(name, metaV1.GetOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+		return namespace
+	}
+
+	ginkgo.BeforeEach(func() {
+		existing := &v1.Namespace{ObjectMeta: metaV1.ObjectMeta{Name: "apps",
+			Labels: map[string]string{"istio-injection": "enabled", "team": "apps"}}}
+		cluster = newFakeCluster(existing)
+		k = &Kubernetes{KubeConfigPath: cluster.KubeConfigPath}
+		gomega.Expect(k.Connect()).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	ginkgo.It("should create the namespace with its metadata and ownership", func() {
+		options := NamespaceOptions{
+			Labels:      map[string]string{"istio-injection": "enabled"},
+			Annotations: map[string]string{"nalej.com/description": "platform"},
+		}
+		gomega.Expect(k.EnsureNamespace(TargetNamespace, options)).To(gomega.Succeed())
+		created := get(TargetNamespace)
+		gomega.Expect(created.Labels).To(gomega.Equal(map[string]string{
+			"istio-injection": "enabled", ManagedByLabel: ManagedByInstaller}))
+		gomega.Expect(created.Annotations).To(gomega.HaveKeyWithValue("nalej.com/description", "platform"))
+		gomega.Expect(k.EnsureNamespace(TargetNamespace, options)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should update the metadata of an existing namespace keeping its ownership", func() {
+		options := NamespaceOptions{Labels: map[string]string{"istio.io/rev": "1-5-0"}, RemovedLabels: []string{"istio-injection"}}
+		gomega.Expect(k.EnsureNamespace("apps", options)).To(gomega.Succeed())
+		gomega.Expect(get("apps").Labels).To(gomega.Equal(map[string]string{"istio.io/rev": "1-5-0", "team": "apps"}))
+	})
+
+	ginkgo.It("should not update namespaces that already have the metadata", func() {
+		options := NamespaceOptions{Labels: map[string]string{"team": "apps"}}
+		gomega.Expect(k.EnsureNamespace("apps", options)).To(gomega.Succeed())
+		for _, action := range cluster.Client.Actions() {
+			gomega.Expect(action.GetVerb()).NotTo(gomega.Equal("update"))
+		}
+	})
+})
@@ -0,0 +1,681 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Observability stack
+// Prometheus scrapes the platform components and, on Istio clusters, the control plane and the sidecars. Grafana
+// reads Prometheus and Jaeger and is provisioned with the dashboards of the platform. Jaeger receives the traces of
+// the mesh through the zipkin service expected by Istio, and Kiali shows the mesh topology. Grafana and Kiali are
+// exposed under the platform domain.
+
+package observability
+
+import (
+	"fmt"
+	"strings"
+
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	rbacV1 "k8s.io/api/rbac/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Namespace where the observability stack is installed.
+const Namespace = "observability"
+
+// Names of the components of the stack.
+const (
+	PrometheusName = "prometheus"
+	GrafanaName    = "grafana"
+	JaegerName     = "jaeger"
+	KialiName      = "kiali"
+)
+
+// Ports of the components of the stack.
+const (
+	PrometheusPort      = 9090
+	GrafanaPort         = 3000
+	JaegerQueryPort     = 16686
+	JaegerCollectorPort = 14268
+	ZipkinPort          = 9411
+	KialiPort           = 20001
+)
+
+// DefaultImages of the components of the stack.
+var DefaultImages = map[string]string{
+	PrometheusName: "prom/prometheus:v2.15.2",
+	GrafanaName:    "grafana/grafana:6.5.2",
+	JaegerName:     "jaegertracing/all-in-one:1.16",
+	KialiName:      "quay.io/kiali/kiali:v1.9",
+}
+
+// DefaultPlatformNamespaces whose pods are scraped if not specified.
+var DefaultPlatformNamespaces = []string{"nalej"}
+
+// DefaultClusterIssuer of cert-manager signing the certificate of the ingresses.
+const DefaultClusterIssuer = "letsencrypt"
+
+// TLSSecret with the certificate of the ingresses.
+const TLSSecret = "observability-tls"
+
+// GrafanaCredentials is the secret with the credentials of the Grafana administrator.
+const GrafanaCredentials = "grafana-credentials"
+
+// KialiCredentials is the secret with the credentials of the Kiali login strategy. Its name is fixed by Kiali.
+const KialiCredentials = "kiali"
+
+// AdminUser of Grafana and Kiali.
+const AdminUser = "admin"
+
+// IstioNetworkMode is the networking mode whose clusters get the mesh integration.
+const IstioNetworkMode = "istio"
+
+// IstioNamespace where the zipkin service used by the sidecars to send the traces is published.
+const IstioNamespace = "istio-system"
+
+// Labels returns the labels of the objects of a component.
+func Labels(component string) map[string]string {
+	return map[string]string{
+		"cluster":   "management",
+		"component": component,
+		"app":       component,
+	}
+}
+
+// serviceHost returns the address of a service of the stack inside the cluster.
+func serviceHost(name string, port int) string {
+	return fmt.Sprintf("http://%s.%s:%d", name, Namespace, port)
+}
+
+// platformScrapeConfig scrapes the pods of the platform with the prometheus.io annotations.
+const platformScrapeConfig = `
+- job_name: platform-pods
+  kubernetes_sd_configs:
+  - role: pod
+    namespaces:
+      names: [%s]
+  relabel_configs:
+  - source_labels: [__meta_kubernetes_pod_annotation_prometheus_io_scrape]
+    action: keep
+    regex: true
+  - source_labels: [__meta_kubernetes_pod_annotation_prometheus_io_path]
+    action: replace
+    target_label: __metrics_path__
+    regex: (.+)
+  - source_labels: [__address__, __meta_kubernetes_pod_annotation_prometheus_io_port]
+    action: replace
+    regex: ([^:]+)(?::\d+)?;(\d+)
+    replacement: $1:$2
+    target_label: __address__
+  - source_labels: [__meta_kubernetes_namespace]
+    target_label: namespace
+  - source_labels: [__meta_kubernetes_pod_label_component]
+    target_label: component
+  - source_labels: [__meta_kubernetes_pod_name]
+    target_label: pod
+`
+
+// meshScrapeConfig scrapes the Istio control plane and the Envoy sidecars.
+const meshScrapeConfig = `
+- job_name: istiod
+  kubernetes_sd_configs:
+  - role: endpoints
+    namespaces:
+      names: [istio-system]
+  relabel_configs:
+  - source_labels: [__meta_kubernetes_service_name, __meta_kubernetes_endpoint_port_name]
+    action: keep
+    regex: istiod;http-monitoring
+- job_name: envoy-stats
+  metrics_path: /stats/prometheus
+  kubernetes_sd_configs:
+  - role: pod
+  relabel_configs:
+  - source_labels: [__meta_kubernetes_pod_container_port_name]
+    action: keep
+    regex: '.*-envoy-prom'
+  - source_labels: [__address__]
+    action: replace
+    regex: ([^:]+)(?::\d+)?
+    replacement: $1:15090
+    target_label: __address__
+  - source_labels: [__meta_kubernetes_namespace]
+    target_label: namespace
+  - source_labels: [__meta_kubernetes_pod_name]
+    target_label: pod
+`
+
+// PrometheusConfig returns the configuration of Prometheus.
+//   params:
+//     platformNamespaces The namespaces whose annotated pods are scraped.
+//     mesh Whether the Istio control plane and sidecars are scraped.
+//   returns:
+//     The content of prometheus.yml.
+func PrometheusConfig(platformNamespaces []string, mesh bool) string {
+	config := "global:\n  scrape_interval: 15s\n  evaluation_interval: 15s\nscrape_configs:"
+	config = config + indent(fmt.Sprintf(platformScrapeConfig, strings.Join(platformNamespaces, ", ")))
+	if mesh {
+		config = config + indent(meshScrapeConfig)
+	}
+	return config
+}
+
+// indent the lines of a YAML block so it can be added under a key.
+func indent(block string) string {
+	lines := strings.Split(strings.TrimRight(block, "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "  " + line
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// GrafanaDatasources returns the provisioning file of the Grafana datasources.
+func GrafanaDatasources() string {
+	return fmt.Sprintf(`apiVersion: 1
+datasources:
+- name: Prometheus
+  type: prometheus
+  access: proxy
+  url: %s
+  isDefault: true
+  editable: false
+- name: Jaeger
+  type: jaeger
+  access: proxy
+  url: %s
+  editable: false
+`, serviceHost(PrometheusName, PrometheusPort), serviceHost(JaegerName+"-query", JaegerQueryPort))
+}
+
+// grafanaDashboardProvider loads the dashboards mounted from the dashboards configmap.
+const grafanaDashboardProvider = `apiVersion: 1
+providers:
+- name: nalej
+  folder: Nalej
+  type: file
+  disableDeletion: true
+  options:
+    path: /var/lib/grafana/dashboards
+`
+
+// dashboard returns a Grafana dashboard with a graph panel per query.
+func dashboard(uid string, title string, panels map[string]string, order []string) string {
+	entries := make([]string, 0, len(order))
+	for i, name := range order {
+		entries = append(entries, fmt.Sprintf(
+			`{"id":%d,"type":"graph","title":%q,"datasource":"Prometheus","gridPos":{"x":%d,"y":%d,"w":12,"h":8},"targets":[{"expr":%q,"legendFormat":"{{component}}"}]}`,
+			i+1, name, (i%2)*12, (i/2)*8, panels[name]))
+	}
+	return fmt.Sprintf(`{"uid":%q,"title":%q,"tags":["nalej"],"schemaVersion":21,"time":{"from":"now-1h","to":"now"},"panels":[%s]}`,
+		uid, title, strings.Join(entries, ","))
+}
+
+// GrafanaDashboards returns the dashboards provisioned on Grafana.
+//   params:
+//     mesh Whether the dashboard of the mesh traffic is added.
+//   returns:
+//     The dashboards indexed by file name.
+func GrafanaDashboards(mesh bool) map[string]string {
+	result := map[string]string{
+		"platform.json": dashboard("nalej-platform", "Platform components", map[string]string{
+			"Available components": `sum(up{job="platform-pods"}) by (component)`,
+			"Restarted pods":       `sum(changes(process_start_time_seconds{job="platform-pods"}[1h])) by (component)`,
+			"Memory":               `sum(process_resident_memory_bytes{job="platform-pods"}) by (component)`,
+			"CPU":                  `sum(rate(process_cpu_seconds_total{job="platform-pods"}[5m])) by (component)`,
+		}, []string{"Available components", "Restarted pods", "Memory", "CPU"}),
+	}
+	if mesh {
+		result["mesh.json"] = dashboard("nalej-mesh", "Mesh traffic", map[string]string{
+			"Requests":      `sum(rate(istio_requests_total{reporter="destination"}[5m])) by (destination_workload)`,
+			"Errors":        `sum(rate(istio_requests_total{reporter="destination",response_code=~"5.."}[5m])) by (destination_workload)`,
+			"Latency (p95)": `histogram_quantile(0.95, sum(rate(istio_request_duration_milliseconds_bucket{reporter="destination"}[5m])) by (le, destination_workload))`,
+		}, []string{"Requests", "Errors", "Latency (p95)"})
+	}
+	return result
+}
+
+// KialiConfig returns the configuration of Kiali pointing to the rest of the stack.
+//   params:
+//     domain The platform domain where Grafana is exposed.
+//   returns:
+//     The content of config.yaml.
+func KialiConfig(domain string) string {
+	return fmt.Sprintf(`istio_namespace: %s
+deployment:
+  namespace: %s
+auth:
+  strategy: login
+server:
+  port: %d
+  web_root: /
+external_services:
+  prometheus:
+    url: %s
+  tracing:
+    enabled: true
+    in_cluster_url: %s
+  grafana:
+    enabled: true
+    in_cluster_url: %s
+    url: https://%s
+`, IstioNamespace, Namespace, KialiPort, serviceHost(PrometheusName, PrometheusPort),
+		serviceHost(JaegerName+"-query", JaegerQueryPort), serviceHost(GrafanaName, GrafanaPort), Host(GrafanaName, domain))
+}
+
+// Host returns the host where a component is exposed under the platform domain.
+func Host(component string, domain string) string {
+	return fmt.Sprintf("%s.%s", component, domain)
+}
+
+// NewConfigMap creates a configmap of a component.
+func NewConfigMap(component string, name string, data map[string]string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      name,
+			Namespace: Namespace,
+			Labels:    Labels(component),
+		},
+		Data: data,
+	}
+}
+
+// NewCredentials creates the secret with the credentials of a component.
+func NewCredentials(component string, name string, data map[string]string) *v1.Secret {
+	return &v1.Secret{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      name,
+			Namespace: Namespace,
+			Labels:    Labels(component),
+		},
+		Type:       v1.SecretTypeOpaque,
+		StringData: data,
+	}
+}
+
+// NewServiceAccount creates the service account of a component.
+func NewServiceAccount(component string) *v1.ServiceAccount {
+	return &v1.ServiceAccount{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ServiceAccount",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      component,
+			Namespace: Namespace,
+			Labels:    Labels(component),
+		},
+	}
+}
+
+// roleName returns the name of the cluster role of a component, prefixed as the roles are not namespaced.
+func roleName(component string) string {
+	return fmt.Sprintf("%s-%s", Namespace, component)
+}
+
+// NewClusterRole creates the cluster role of a component.
+func NewClusterRole(component string, rules []rbacV1.PolicyRule) *rbacV1.ClusterRole {
+	return &rbacV1.ClusterRole{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ClusterRole",
+			APIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:   roleName(component),
+			Labels: Labels(component),
+		},
+		Rules: rules,
+	}
+}
+
+// NewClusterRoleBinding creates the binding of the cluster role of a component to its service account.
+func NewClusterRoleBinding(component string) *rbacV1.ClusterRoleBinding {
+	return &rbacV1.ClusterRoleBinding{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ClusterRoleBinding",
+			APIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:   roleName(component),
+			Labels: Labels(component),
+		},
+		RoleRef: rbacV1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     roleName(component),
+		},
+		Subjects: []rbacV1.Subject{{
+			Kind:      "ServiceAccount",
+			Name:      component,
+			Namespace: Namespace,
+		}},
+	}
+}
+
+// PrometheusRules are the permissions required to discover the scraped targets.
+var PrometheusRules = []rbacV1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"nodes", "services", "endpoints", "pods"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		NonResourceURLs: []string{"/metrics"},
+		Verbs:           []string{"get"},
+	},
+}
+
+// KialiRules are the permissions required to read the mesh configuration and the workloads.
+var KialiRules = []rbacV1.PolicyRule{
+	{
+		APIGroups: []string{"", "apps", "batch", "autoscaling"},
+		Resources: []string{"*"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{"networking.istio.io", "security.istio.io", "config.istio.io", "authentication.istio.io", "rbac.istio.io"},
+		Resources: []string{"*"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+}
+
+// configVolume mounts a configmap on a container.
+func configVolume(name string, configMap string, mountPath string) (v1.Volume, v1.VolumeMount) {
+	return v1.Volume{
+		Name: name,
+		VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+			LocalObjectReference: v1.LocalObjectReference{Name: configMap},
+		}},
+	}, v1.VolumeMount{
+		Name:      name,
+		MountPath: mountPath,
+		ReadOnly:  true,
+	}
+}
+
+// secretEnv creates an environment variable read from a credentials secret.
+func secretEnv(name string, secret string, key string) v1.EnvVar {
+	return v1.EnvVar{
+		Name: name,
+		ValueFrom: &v1.EnvVarSource{
+			SecretKeyRef: &v1.SecretKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: secret},
+				Key:                  key,
+			},
+		},
+	}
+}
+
+// NewDeployment creates the single replica deployment of a component.
+//   params:
+//     component The name of the component.
+//     serviceAccount The service account of the pods, empty to use the default one.
+//     container The container of the component.
+//     volumes The volumes mounted by the container.
+//   returns:
+//     The deployment.
+func NewDeployment(component string, serviceAccount string, container v1.Container, volumes []v1.Volume) *appsV1.Deployment {
+	replicas := int32(1)
+	labels := Labels(component)
+	container.Name = component
+	container.ImagePullPolicy = v1.PullIfNotPresent
+	return &appsV1.Deployment{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      component,
+			Namespace: Namespace,
+			Labels:    labels,
+		},
+		Spec: appsV1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metaV1.LabelSelector{MatchLabels: labels},
+			Strategy: appsV1.DeploymentStrategy{Type: appsV1.RecreateDeploymentStrategyType},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metaV1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					ServiceAccountName: serviceAccount,
+					Containers:         []v1.Container{container},
+					Volumes:            volumes,
+				},
+			},
+		},
+	}
+}
+
+// NewService creates a service selecting the pods of a component.
+func NewService(name string, component string, ports ...int32) *v1.Service {
+	servicePorts := make([]v1.ServicePort, 0, len(ports))
+	for _, port := range ports {
+		servicePorts = append(servicePorts, v1.ServicePort{
+			Name:       fmt.Sprintf("http-%d", port),
+			Protocol:   v1.ProtocolTCP,
+			Port:       port,
+			TargetPort: intstr.FromInt(int(port)),
+		})
+	}
+	return &v1.Service{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      name,
+			Namespace: Namespace,
+			Labels:    Labels(component),
+		},
+		Spec: v1.ServiceSpec{
+			Type:     v1.ServiceTypeClusterIP,
+			Selector: Labels(component),
+			Ports:    servicePorts,
+		},
+	}
+}
+
+// NewZipkinService creates the zipkin service of the Istio namespace, the default address where the sidecars send
+// their traces, resolving to the Jaeger collector.
+func NewZipkinService() *v1.Service {
+	return &v1.Service{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      "zipkin",
+			Namespace: IstioNamespace,
+			Labels:    Labels(JaegerName),
+		},
+		Spec: v1.ServiceSpec{
+			Type:         v1.ServiceTypeExternalName,
+			ExternalName: fmt.Sprintf("%s-collector.%s.svc.cluster.local", JaegerName, Namespace),
+			Ports: []v1.ServicePort{{
+				Name:     "http-zipkin",
+				Protocol: v1.ProtocolTCP,
+				Port:     ZipkinPort,
+			}},
+		},
+	}
+}
+
+// NewIngress creates the ingress exposing a component under the platform domain. On Istio clusters the ingress
+// class is istio and the TLS termination is done by the gateway, otherwise the certificate is requested to
+// cert-manager.
+//   params:
+//     component The name of the exposed component.
+//     port The port of the component service.
+//     domain The platform domain.
+//     networkMode The networking mode of the cluster.
+//     clusterIssuer The cert-manager issuer of the certificate.
+//   returns:
+//     The ingress.
+func NewIngress(component string, port int32, domain string, networkMode string, clusterIssuer string) *v1beta1.Ingress {
+	host := Host(component, domain)
+	ingress := &v1beta1.Ingress{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Ingress",
+			APIVersion: "extensions/v1beta1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      component,
+			Namespace: Namespace,
+			Labels:    Labels(component),
+			Annotations: map[string]string{
+				"kubernetes.io/ingress.class":              "nginx",
+				"nginx.ingress.kubernetes.io/ssl-redirect": "true",
+				"cert-manager.io/cluster-issuer":           clusterIssuer,
+			},
+		},
+		Spec: v1beta1.IngressSpec{
+			TLS: []v1beta1.IngressTLS{{
+				Hosts:      []string{host},
+				SecretName: TLSSecret,
+			}},
+			Rules: []v1beta1.IngressRule{{
+				Host: host,
+				IngressRuleValue: v1beta1.IngressRuleValue{
+					HTTP: &v1beta1.HTTPIngressRuleValue{
+						Paths: []v1beta1.HTTPIngressPath{{
+							Path: "/",
+							Backend: v1beta1.IngressBackend{
+								ServiceName: component,
+								ServicePort: intstr.FromInt(int(port)),
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+	if networkMode == IstioNetworkMode {
+		ingress.Annotations = map[string]string{"kubernetes.io/ingress.class": "istio"}
+		ingress.Spec.TLS = []v1beta1.IngressTLS{}
+	}
+	return ingress
+}
+
+// PrometheusObjects returns the objects required to run Prometheus.
+func PrometheusObjects(image string, platformNamespaces []string, mesh bool) []runtime.Object {
+	volume, mount := configVolume("config", PrometheusName, "/etc/prometheus")
+	container := v1.Container{
+		Image: image,
+		Args: []string{
+			"--config.file=/etc/prometheus/prometheus.yml",
+			"--storage.tsdb.path=/prometheus",
+			"--storage.tsdb.retention.time=7d",
+		},
+		Ports:        []v1.ContainerPort{{Name: "http", ContainerPort: PrometheusPort}},
+		VolumeMounts: []v1.VolumeMount{mount},
+	}
+	return []runtime.Object{
+		NewServiceAccount(PrometheusName),
+		NewClusterRole(PrometheusName, PrometheusRules),
+		NewClusterRoleBinding(PrometheusName),
+		NewConfigMap(PrometheusName, PrometheusName, map[string]string{
+			"prometheus.yml": PrometheusConfig(platformNamespaces, mesh),
+		}),
+		NewDeployment(PrometheusName, PrometheusName, container, []v1.Volume{volume}),
+		NewService(PrometheusName, PrometheusName, PrometheusPort),
+	}
+}
+
+// GrafanaObjects returns the objects required to run Grafana, without its credentials.
+func GrafanaObjects(image string, domain string, mesh bool) []runtime.Object {
+	datasources, datasourcesMount := configVolume("datasources", GrafanaName+"-datasources", "/etc/grafana/provisioning/datasources")
+	providers, providersMount := configVolume("providers", GrafanaName+"-providers", "/etc/grafana/provisioning/dashboards")
+	dashboards, dashboardsMount := configVolume("dashboards", GrafanaName+"-dashboards", "/var/lib/grafana/dashboards")
+	container := v1.Container{
+		Image: image,
+		Env: []v1.EnvVar{
+			secretEnv("GF_SECURITY_ADMIN_USER", GrafanaCredentials, "admin-user"),
+			secretEnv("GF_SECURITY_ADMIN_PASSWORD", GrafanaCredentials, "admin-password"),
+			{Name: "GF_SERVER_ROOT_URL", Value: fmt.Sprintf("https://%s", Host(GrafanaName, domain))},
+			{Name: "GF_AUTH_ANONYMOUS_ENABLED", Value: "false"},
+			{Name: "GF_USERS_ALLOW_SIGN_UP", Value: "false"},
+		},
+		Ports:        []v1.ContainerPort{{Name: "http", ContainerPort: GrafanaPort}},
+		VolumeMounts: []v1.VolumeMount{datasourcesMount, providersMount, dashboardsMount},
+	}
+	return []runtime.Object{
+		NewConfigMap(GrafanaName, GrafanaName+"-datasources", map[string]string{"datasources.yaml": GrafanaDatasources()}),
+		NewConfigMap(GrafanaName, GrafanaName+"-providers", map[string]string{"providers.yaml": grafanaDashboardProvider}),
+		NewConfigMap(GrafanaName, GrafanaName+"-dashboards", GrafanaDashboards(mesh)),
+		NewDeployment(GrafanaName, "", container, []v1.Volume{datasources, providers, dashboards}),
+		NewService(GrafanaName, GrafanaName, GrafanaPort),
+	}
+}
+
+// JaegerObjects returns the objects required to run Jaeger with in-memory storage.
+func JaegerObjects(image string, mesh bool) []runtime.Object {
+	container := v1.Container{
+		Image: image,
+		Env: []v1.EnvVar{
+			{Name: "COLLECTOR_ZIPKIN_HTTP_PORT", Value: fmt.Sprintf("%d", ZipkinPort)},
+			{Name: "MEMORY_MAX_TRACES", Value: "50000"},
+		},
+		Ports: []v1.ContainerPort{
+			{Name: "query", ContainerPort: JaegerQueryPort},
+			{Name: "collector", ContainerPort: JaegerCollectorPort},
+			{Name: "zipkin", ContainerPort: ZipkinPort},
+		},
+	}
+	result := []runtime.Object{
+		NewDeployment(JaegerName, "", container, nil),
+		NewService(JaegerName+"-query", JaegerName, JaegerQueryPort),
+		NewService(JaegerName+"-collector", JaegerName, JaegerCollectorPort, ZipkinPort),
+	}
+	if mesh {
+		result = append(result, NewZipkinService())
+	}
+	return result
+}
+
+// KialiObjects returns the objects required to run Kiali, without its credentials.
+func KialiObjects(image string, domain string) []runtime.Object {
+	volume, mount := configVolume("config", KialiName, "/kiali-configuration")
+	container := v1.Container{
+		Image:   image,
+		Command: []string{"/opt/kiali/kiali", "-config", "/kiali-configuration/config.yaml"},
+		Env: []v1.EnvVar{
+			{Name: "ACTIVE_NAMESPACE", ValueFrom: &v1.EnvVarSource{
+				FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+			}},
+		},
+		Ports:        []v1.ContainerPort{{Name: "http", ContainerPort: KialiPort}},
+		VolumeMounts: []v1.VolumeMount{mount},
+	}
+	return []runtime.Object{
+		NewServiceAccount(KialiName),
+		NewClusterRole(KialiName, KialiRules),
+		NewClusterRoleBinding(KialiName),
+		NewConfigMap(KialiName, KialiName, map[string]string{"config.yaml": KialiConfig(domain)}),
+		NewDeployment(KialiName, KialiName, container, []v1.Volume{volume}),
+		NewService(KialiName, KialiName, KialiPort),
+	}
+}
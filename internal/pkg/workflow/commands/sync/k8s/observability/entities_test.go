@@ -0,0 +1,129 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package observability
+
+import (
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+var _ = ginkgo.Describe("Observability stack", func() {
+
+	ginkgo.Context("entities", func() {
+		ginkgo.It("should only scrape the mesh on istio clusters", func() {
+			config := make(map[string]interface{})
+			gomega.Expect(yaml.Unmarshal([]byte(PrometheusConfig([]string{"nalej", "apps"}, false)), &config)).To(gomega.Succeed())
+			gomega.Expect(config["scrape_configs"]).Should(gomega.HaveLen(1))
+			gomega.Expect(PrometheusConfig([]string{"nalej", "apps"}, false)).Should(gomega.ContainSubstring("names: [nalej, apps]"))
+
+			gomega.Expect(yaml.Unmarshal([]byte(PrometheusConfig(DefaultPlatformNamespaces, true)), &config)).To(gomega.Succeed())
+			gomega.Expect(config["scrape_configs"]).Should(gomega.HaveLen(3))
+		})
+
+		ginkgo.It("should provision valid dashboards", func() {
+			dashboards := GrafanaDashboards(true)
+			gomega.Expect(dashboards).Should(gomega.HaveLen(2))
+			for _, content := range dashboards {
+				dashboard := make(map[string]interface{})
+				gomega.Expect(yaml.Unmarshal([]byte(content), &dashboard)).To(gomega.Succeed())
+				gomega.Expect(dashboard["panels"]).ShouldNot(gomega.BeEmpty())
+			}
+			gomega.Expect(GrafanaDashboards(false)).ShouldNot(gomega.HaveKey("mesh.json"))
+		})
+
+		ginkgo.It("should request the certificate of the ingresses to cert-manager", func() {
+			ingress := NewIngress(GrafanaName, GrafanaPort, "nalej.tech", "zt", DefaultClusterIssuer)
+			gomega.Expect(ingress.Spec.Rules[0].Host).Should(gomega.Equal("grafana.nalej.tech"))
+			gomega.Expect(ingress.Annotations).Should(gomega.HaveKeyWithValue("cert-manager.io/cluster-issuer", DefaultClusterIssuer))
+			gomega.Expect(ingress.Spec.TLS).Should(gomega.Equal([]v1beta1.IngressTLS{{Hosts: []string{"grafana.nalej.tech"}, SecretName: TLSSecret}}))
+
+			ingress = NewIngress(GrafanaName, GrafanaPort, "nalej.tech", IstioNetworkMode, DefaultClusterIssuer)
+			gomega.Expect(ingress.Annotations).Should(gomega.HaveKeyWithValue("kubernetes.io/ingress.class", "istio"))
+			gomega.Expect(ingress.Spec.TLS).Should(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("install command", func() {
+		var cluster *k8stest.FakeCluster
+
+		ginkgo.BeforeEach(func() {
+			cluster = k8stest.NewFakeCluster()
+			k8s.RegisterClients(cluster.KubeConfigPath, cluster.Client, cluster.Discovery, cluster.Dynamic)
+		})
+
+		ginkgo.AfterEach(func() {
+			k8s.UnregisterClients(cluster.KubeConfigPath)
+		})
+
+		ginkgo.It("should apply the default values when read from JSON", func() {
+			raw := []byte(`{"type":"sync", "name":"installObservability", "kubeConfigPath":"/tmp/kc", "domain":"nalej.tech"}`)
+			cmd, err := NewInstallObservabilityFromJSON(raw)
+			gomega.Expect(err).To(gomega.Succeed())
+			io := (*cmd).(*InstallObservability)
+			gomega.Expect(io.PlatformNamespaces).Should(gomega.Equal(DefaultPlatformNamespaces))
+			gomega.Expect(io.ClusterIssuer).Should(gomega.Equal(DefaultClusterIssuer))
+			gomega.Expect(io.image(GrafanaName)).Should(gomega.Equal(DefaultImages[GrafanaName]))
+		})
+
+		ginkgo.It("should install the stack without Kiali outside the mesh", func() {
+			cmd := NewInstallObservability(cluster.KubeConfigPath, "nalej.tech", "zt")
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			cluster.ExpectObject("v1", "Namespace", "", Namespace)
+			cluster.ExpectObject("apps/v1", "Deployment", Namespace, PrometheusName)
+			cluster.ExpectObject("apps/v1", "Deployment", Namespace, GrafanaName)
+			cluster.ExpectObject("apps/v1", "Deployment", Namespace, JaegerName)
+			cluster.ExpectObject("extensions/v1beta1", "Ingress", Namespace, GrafanaName)
+			cluster.ExpectObject("v1", "Secret", Namespace, GrafanaCredentials)
+			cluster.ExpectNoObject("apps/v1", "Deployment", Namespace, KialiName)
+			cluster.ExpectNoObject("v1", "Service", IstioNamespace, "zipkin")
+		})
+
+		ginkgo.It("should wire the stack to the mesh keeping the credentials", func() {
+			previous := &v1.Secret{
+				ObjectMeta: metaV1.ObjectMeta{Name: GrafanaCredentials, Namespace: Namespace},
+				Data:       map[string][]byte{"admin-password": []byte("previous")},
+			}
+			gomega.Expect(cluster.Tracker.Add(previous)).To(gomega.Succeed())
+			cmd := NewInstallObservability(cluster.KubeConfigPath, "nalej.tech", IstioNetworkMode)
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			cluster.ExpectObject("apps/v1", "Deployment", Namespace, KialiName)
+			cluster.ExpectObject("v1", "Secret", Namespace, KialiCredentials)
+			cluster.ExpectObject("extensions/v1beta1", "Ingress", Namespace, KialiName)
+			cluster.ExpectObject("v1", "Service", IstioNamespace, "zipkin")
+			secret, gErr := cluster.Client.CoreV1().Secrets(Namespace).Get(GrafanaCredentials, metaV1.GetOptions{})
+			gomega.Expect(gErr).To(gomega.Succeed())
+			gomega.Expect(string(secret.Data["admin-password"])).Should(gomega.Equal("previous"))
+		})
+
+		ginkgo.It("should fail without domain", func() {
+			result, err := NewInstallObservability(cluster.KubeConfigPath, "", "zt").Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeFalse())
+		})
+	})
+})
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package observability
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// InstallObservability structure with the attributes required to install the monitoring and tracing stack of the
+// platform.
+type InstallObservability struct {
+	k8s.Kubernetes
+	// Domain with the platform domain under which Grafana and Kiali are exposed.
+	Domain string `json:"domain"`
+	// NetworkMode with the networking mode of the cluster. The mesh integration and Kiali are only installed with
+	// the istio mode.
+	NetworkMode string `json:"network_mode"`
+	// PlatformNamespaces whose annotated pods are scraped, DefaultPlatformNamespaces if not set.
+	PlatformNamespaces []string `json:"platform_namespaces"`
+	// ClusterIssuer of cert-manager signing the certificate of the ingresses, DefaultClusterIssuer if not set.
+	ClusterIssuer string `json:"cluster_issuer"`
+	// Images overriding the DefaultImages indexed by component name.
+	Images map[string]string `json:"images"`
+}
+
+// NewInstallObservability creates a new InstallObservability command.
+func NewInstallObservability(kubeConfigPath string, domain string, networkMode string) *InstallObservability {
+	return &InstallObservability{
+		Kubernetes: k8s.Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.InstallObservability),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Domain:             domain,
+		NetworkMode:        networkMode,
+		PlatformNamespaces: DefaultPlatformNamespaces,
+		ClusterIssuer:      DefaultClusterIssuer,
+	}
+}
+
+// NewInstallObservabilityFromJSON creates a new InstallObservability command from a raw JSON representation.
+func NewInstallObservabilityFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	io := &InstallObservability{}
+	if err := json.Unmarshal(raw, &io); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	if len(io.PlatformNamespaces) == 0 {
+		io.PlatformNamespaces = DefaultPlatformNamespaces
+	}
+	if io.ClusterIssuer == "" {
+		io.ClusterIssuer = DefaultClusterIssuer
+	}
+	io.CommandID = entities.GenerateCommandID(io.Name())
+	var r entities.Command = io
+	return &r, nil
+}
+
+// mesh returns whether the stack is wired to the Istio mesh.
+func (io *InstallObservability) mesh() bool {
+	return io.NetworkMode == IstioNetworkMode
+}
+
+// image returns the image of a component.
+func (io *InstallObservability) image(component string) string {
+	if image, exists := io.Images[component]; exists && image != "" {
+		return image
+	}
+	return DefaultImages[component]
+}
+
+// Objects returns the objects of the stack, without the credentials of the components.
+func (io *InstallObservability) Objects() []runtime.Object {
+	mesh := io.mesh()
+	result := PrometheusObjects(io.image(PrometheusName), io.PlatformNamespaces, mesh)
+	result = append(result, JaegerObjects(io.image(JaegerName), mesh)...)
+	result = append(result, GrafanaObjects(io.image(GrafanaName), io.Domain, mesh)...)
+	result = append(result, NewIngress(GrafanaName, GrafanaPort, io.Domain, io.NetworkMode, io.ClusterIssuer))
+	if mesh {
+		result = append(result, KialiObjects(io.image(KialiName), io.Domain)...)
+		result = append(result, NewIngress(KialiName, KialiPort, io.Domain, io.NetworkMode, io.ClusterIssuer))
+	}
+	return result
+}
+
+// createCredentials creates the secret with the credentials of a component unless it already exists, so the
+// credentials are kept on later installs.
+func (io *InstallObservability) createCredentials(component string, name string, userKey string, passwordKey string) derrors.Error {
+	exists, err := io.ExistsEntity(Namespace, "", "v1", "secrets", name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		log.Debug().Str("name", name).Msg("credentials already exist, skipping")
+		return nil
+	}
+	password, err := k8s.GenerateSecretValue()
+	if err != nil {
+		return err
+	}
+	return io.Create(NewCredentials(component, name, map[string]string{userKey: AdminUser, passwordKey: password}))
+}
+
+// Run the current command returning the result or an error.
+func (io *InstallObservability) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	if io.Domain == "" {
+		return entities.NewCommandResult(false, "invalid observability configuration",
+			derrors.NewInvalidArgumentError("domain must be set")), nil
+	}
+	connectErr := io.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	if err := io.EnsureNamespace(Namespace, k8s.NamespaceOptions{}); err != nil {
+		return entities.NewCommandResult(false, "cannot create namespace", err), nil
+	}
+	if err := io.createCredentials(GrafanaName, GrafanaCredentials, "admin-user", "admin-password"); err != nil {
+		return entities.NewCommandResult(false, "cannot create Grafana credentials", err), nil
+	}
+	if io.mesh() {
+		if err := io.createCredentials(KialiName, KialiCredentials, "username", "passphrase"); err != nil {
+			return entities.NewCommandResult(false, "cannot create Kiali credentials", err), nil
+		}
+	}
+	summary := &k8s.ApplySummary{}
+	for _, obj := range io.Objects() {
+		if err := io.Apply(obj, k8s.ApplyOptions{}, summary); err != nil {
+			return entities.NewCommandResult(false, "cannot apply observability object", err), nil
+		}
+	}
+	msg := fmt.Sprintf("observability stack exposed on %s", Host(GrafanaName, io.Domain))
+	return entities.NewSuccessCommand([]byte(msg)).WithObjects(summary.Applied()), nil
+}
+
+// String returns a string representation
+func (io *InstallObservability) String() string {
+	return fmt.Sprintf("SYNC InstallObservability on %s", io.Domain)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (io *InstallObservability) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + io.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (io *InstallObservability) UserString() string {
+	return fmt.Sprintf("Installing observability stack for %s", io.Domain)
+}
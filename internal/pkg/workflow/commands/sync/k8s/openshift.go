@@ -0,0 +1,430 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// OpenShift
+// The ingresses of the platform are served by the routers of OpenShift, so they are created as Routes. Routes cannot
+// verify the client certificates, which is done by the router for all of them when its ingress controller is
+// configured to. The pods are admitted by SecurityContextConstraints, so the PodSecurityPolicies of the components are
+// replaced by equivalent constraints of the same name, and the roles allowed to use a policy are allowed to use its
+// constraint. The images of the internal registry are pulled with the credentials OpenShift gives to every service
+// account, so no pull secrets are created for it.
+
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	entities2 "github.com/nalej/installer/internal/pkg/entities"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// OpenShift API groups.
+const (
+	RouteGroup    = "route.openshift.io"
+	SecurityGroup = "security.openshift.io"
+)
+
+// OpenShiftRouter is the name of the routers of OpenShift serving the Routes, used in place of the ingress controller.
+const OpenShiftRouter = "openshift"
+
+// OpenShiftInternalRegistry is the address of the internal registry of OpenShift.
+const OpenShiftInternalRegistry = "image-registry.openshift-image-registry.svc:5000"
+
+// OpenShiftImagePullerRole is the cluster role allowing to pull the images of a project from the internal registry.
+const OpenShiftImagePullerRole = "system:image-puller"
+
+// OpenShiftIngressOperatorNamespace is the namespace of the ingress controllers configuring the routers.
+const OpenShiftIngressOperatorNamespace = "openshift-ingress-operator"
+
+// RoutesResource is the resource of the routes of OpenShift.
+var RoutesResource = schema.GroupVersionResource{Group: RouteGroup, Version: "v1", Resource: "routes"}
+
+// SecurityContextConstraintsResource is the resource of the security context constraints of OpenShift.
+var SecurityContextConstraintsResource = schema.GroupVersionResource{Group: SecurityGroup, Version: "v1", Resource: "securitycontextconstraints"}
+
+// IngressControllersResource is the resource of the ingress controllers of OpenShift.
+var IngressControllersResource = schema.GroupVersionResource{Group: "operator.openshift.io", Version: "v1", Resource: "ingresscontrollers"}
+
+// servicesResource is the resource of the services.
+var servicesResource = schema.GroupVersionResource{Version: "v1", Resource: "services"}
+
+// IsOpenShift checks if the platform of a cluster is OpenShift.
+func IsOpenShift(platformType string) bool {
+	return platformType == entities2.OpenShiftPlatform
+}
+
+// ServiceLookup retrieves the service used as backend by an ingress.
+//   returns:
+//     The service, nil if it does not exist yet.
+//     An error if it cannot be retrieved.
+type ServiceLookup func(namespace string, name string) (*unstructured.Unstructured, derrors.Error)
+
+// LookupService retrieves a service from the cluster, to be used as ServiceLookup.
+func (k *Kubernetes) LookupService(namespace string, name string) (*unstructured.Unstructured, derrors.Error) {
+	service, err := k.GetObject(namespace, servicesResource, name)
+	if err != nil {
+		if err.Type() == derrors.NotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return service, nil
+}
+
+// RouteTargetPort returns the target port of a Route from a port of its service. Routes refer to the ports of the
+// endpoints, named after the ports of the service, so the named ports are referred by name and the others by their
+// target port.
+//   params:
+//     service The service, nil if it does not exist yet, in which case its pods are expected to listen on the same
+//       port.
+//     port The port of the service, a number or a name.
+//   returns:
+//     The target port of the Route.
+func RouteTargetPort(service *unstructured.Unstructured, port interface{}) interface{} {
+	if _, named := port.(string); named || service == nil {
+		return port
+	}
+	ports, _, _ := unstructured.NestedSlice(service.Object, "spec", "ports")
+	for _, entry := range ports {
+		servicePort, ok := entry.(map[string]interface{})
+		if !ok || fmt.Sprintf("%v", servicePort["port"]) != fmt.Sprintf("%v", port) {
+			continue
+		}
+		if name, _, _ := unstructured.NestedString(servicePort, "name"); name != "" {
+			return name
+		}
+		if target, found := servicePort["targetPort"]; found {
+			return target
+		}
+	}
+	return port
+}
+
+// ingressBackend returns the service and port of the backend of an ingress path, written as in extensions/v1beta1
+// or as in networking.k8s.io/v1.
+func ingressBackend(path map[string]interface{}) (string, interface{}) {
+	backend, _, _ := unstructured.NestedMap(path, "backend")
+	if name, _, _ := unstructured.NestedString(backend, "serviceName"); name != "" {
+		return name, backend["servicePort"]
+	}
+	name, _, _ := unstructured.NestedString(backend, "service", "name")
+	port, _, _ := unstructured.NestedMap(backend, "service", "port")
+	if portName, _ := port["name"].(string); portName != "" {
+		return name, portName
+	}
+	return name, port["number"]
+}
+
+// ingressTLSHosts returns the hosts of the TLS section of an ingress, and whether it has one.
+func ingressTLSHosts(ingress *unstructured.Unstructured) (map[string]bool, bool) {
+	tls, _, _ := unstructured.NestedSlice(ingress.Object, "spec", "tls")
+	hosts := make(map[string]bool, 0)
+	for _, entry := range tls {
+		content, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		names, _, _ := unstructured.NestedStringSlice(content, "hosts")
+		for _, host := range names {
+			hosts[host] = true
+		}
+	}
+	return hosts, len(tls) > 0
+}
+
+// IngressRoutes translates an ingress written for NGINX into the Routes serving each of its paths. The Routes of the
+// hosts of the TLS section are terminated by the router, which uses its default certificate, and reencrypted if the
+// backends use HTTPS. The Routes are named after the ingress with the index of the path if it has more than one.
+//   params:
+//     ingress The ingress.
+//     services The lookup of the services of the backends.
+//   returns:
+//     The Routes.
+//     An error if a backend cannot be retrieved.
+func IngressRoutes(ingress *unstructured.Unstructured, services ServiceLookup) ([]*unstructured.Unstructured, derrors.Error) {
+	annotations := ingress.GetAnnotations()
+	termination := "edge"
+	if traefikScheme(annotations[nginxAnnotationPrefix+"backend-protocol"]) == "https" {
+		termination = "reencrypt"
+	}
+	tlsHosts, withTLS := ingressTLSHosts(ingress)
+	rules, _, _ := unstructured.NestedSlice(ingress.Object, "spec", "rules")
+	result := make([]*unstructured.Unstructured, 0)
+	for _, rule := range rules {
+		ruleMap, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		host, _, _ := unstructured.NestedString(ruleMap, "host")
+		paths, _, _ := unstructured.NestedSlice(ruleMap, "http", "paths")
+		for _, path := range paths {
+			pathMap, ok := path.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, port := ingressBackend(pathMap)
+			service, err := services(ingress.GetNamespace(), name)
+			if err != nil {
+				return nil, derrors.AsError(err, "cannot retrieve ingress backend").WithParams(ingress.GetName(), name)
+			}
+			spec := map[string]interface{}{
+				"host":           host,
+				"to":             map[string]interface{}{"kind": "Service", "name": name, "weight": int64(100)},
+				"port":           map[string]interface{}{"targetPort": RouteTargetPort(service, port)},
+				"wildcardPolicy": "None",
+			}
+			if value, _, _ := unstructured.NestedString(pathMap, "path"); value != "" && value != "/" {
+				spec["path"] = value
+			}
+			if withTLS && (len(tlsHosts) == 0 || tlsHosts[host]) {
+				spec["tls"] = map[string]interface{}{"termination": termination, "insecureEdgeTerminationPolicy": "Redirect"}
+			}
+			route := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": RouteGroup + "/v1",
+				"kind":       "Route",
+				"spec":       spec,
+			}}
+			route.SetNamespace(ingress.GetNamespace())
+			route.SetLabels(ingress.GetLabels())
+			result = append(result, route)
+		}
+	}
+	for index, route := range result {
+		if len(result) == 1 {
+			route.SetName(ingress.GetName())
+		} else {
+			route.SetName(fmt.Sprintf("%s-%d", ingress.GetName(), index))
+		}
+	}
+	return result, nil
+}
+
+// IngressVerifiesClients checks if an ingress written for NGINX verifies the client certificates.
+func IngressVerifiesClients(annotations map[string]string) (bool, derrors.Error) {
+	_, secret, err := clientAuthSecret(annotations)
+	if err != nil {
+		return false, err
+	}
+	return secret != "", nil
+}
+
+// CheckRouterClientTLS checks that the default router of OpenShift verifies the client certificates, as required by
+// the Routes of the ingresses verifying them.
+//   returns:
+//     An error if the router does not verify the client certificates or its configuration cannot be retrieved.
+func (k *Kubernetes) CheckRouterClientTLS() derrors.Error {
+	controller, err := k.GetObject(OpenShiftIngressOperatorNamespace, IngressControllersResource, "default")
+	if err != nil {
+		return err
+	}
+	policy, _, _ := unstructured.NestedString(controller.Object, "spec", "clientTLS", "clientCertificatePolicy")
+	switch policy {
+	case "Required":
+		return nil
+	case "Optional":
+		log.Warn().Msg("the router accepts requests without client certificates")
+		return nil
+	}
+	return derrors.NewFailedPreconditionError("the router of OpenShift must verify the client certificates, set the clientTLS of the default ingress controller").
+		WithParams(policy)
+}
+
+// sccStrategies maps the rules of the PodSecurityPolicies to the strategy types of the SecurityContextConstraints.
+var sccStrategies = map[string]string{
+	"MustRunAs":        "MustRunAs",
+	"MustRunAsNonRoot": "MustRunAsNonRoot",
+	"RunAsAny":         "RunAsAny",
+}
+
+// sccStrategy translates a strategy of a PodSecurityPolicy, such as runAsUser, into a SecurityContextConstraints one.
+func sccStrategy(spec map[string]interface{}, field string, typeField string, defaultType string) map[string]interface{} {
+	rule, _, _ := unstructured.NestedString(spec, field, "rule")
+	strategy, found := sccStrategies[rule]
+	if !found {
+		strategy = defaultType
+	}
+	ranges, _, _ := unstructured.NestedSlice(spec, field, "ranges")
+	result := map[string]interface{}{typeField: strategy}
+	if len(ranges) == 0 || strategy != "MustRunAs" {
+		return result
+	}
+	if field == "runAsUser" {
+		// Users are restricted to a single range.
+		first, _ := ranges[0].(map[string]interface{})
+		result[typeField] = "MustRunAsRange"
+		result["uidRangeMin"] = first["min"]
+		result["uidRangeMax"] = first["max"]
+		return result
+	}
+	result["ranges"] = ranges
+	return result
+}
+
+// SecurityContextConstraints translates a PodSecurityPolicy into the SecurityContextConstraints that allow the same
+// pods, named after the policy.
+//   params:
+//     psp The PodSecurityPolicy.
+//   returns:
+//     The SecurityContextConstraints.
+func SecurityContextConstraints(psp *unstructured.Unstructured) *unstructured.Unstructured {
+	spec, _, _ := unstructured.NestedMap(psp.Object, "spec")
+	flag := func(field string) bool {
+		value, _, _ := unstructured.NestedBool(spec, field)
+		return value
+	}
+	list := func(field string) []interface{} {
+		values, _, _ := unstructured.NestedSlice(spec, field)
+		if values == nil {
+			return []interface{}{}
+		}
+		return values
+	}
+	escalation, found, _ := unstructured.NestedBool(spec, "allowPrivilegeEscalation")
+	hostPorts, _, _ := unstructured.NestedSlice(spec, "hostPorts")
+	volumes, _, _ := unstructured.NestedStringSlice(spec, "volumes")
+	scc := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion":               SecurityGroup + "/v1",
+		"kind":                     "SecurityContextConstraints",
+		"allowPrivilegedContainer": flag("privileged"),
+		"allowPrivilegeEscalation": !found || escalation,
+		"allowHostNetwork":         flag("hostNetwork"),
+		"allowHostPID":             flag("hostPID"),
+		"allowHostIPC":             flag("hostIPC"),
+		"allowHostPorts":           len(hostPorts) > 0,
+		"allowHostDirVolumePlugin": contains(volumes, "hostPath") || contains(volumes, "*"),
+		"readOnlyRootFilesystem":   flag("readOnlyRootFilesystem"),
+		"allowedCapabilities":      list("allowedCapabilities"),
+		"defaultAddCapabilities":   list("defaultAddCapabilities"),
+		"requiredDropCapabilities": list("requiredDropCapabilities"),
+		"volumes":                  list("volumes"),
+		"runAsUser":                sccStrategy(spec, "runAsUser", "type", "RunAsAny"),
+		"seLinuxContext":           sccStrategy(spec, "seLinux", "type", "MustRunAs"),
+		"fsGroup":                  sccStrategy(spec, "fsGroup", "type", "RunAsAny"),
+		"supplementalGroups":       sccStrategy(spec, "supplementalGroups", "type", "RunAsAny"),
+		// The pods are granted the constraints through the roles allowed to use them.
+		"users":  []interface{}{},
+		"groups": []interface{}{},
+	}}
+	scc.SetName(psp.GetName())
+	scc.SetLabels(psp.GetLabels())
+	return scc
+}
+
+// UseSecurityContextConstraints modifies the rules of a role allowing to use PodSecurityPolicies, so they allow to
+// use the SecurityContextConstraints of the same name instead.
+//   params:
+//     role The Role or ClusterRole.
+//   returns:
+//     Whether the role has been modified.
+func UseSecurityContextConstraints(role *unstructured.Unstructured) bool {
+	if role.GetKind() != "Role" && role.GetKind() != "ClusterRole" {
+		return false
+	}
+	rules, _, _ := unstructured.NestedSlice(role.Object, "rules")
+	modified := false
+	for index, rule := range rules {
+		content, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		resources, _, _ := unstructured.NestedStringSlice(content, "resources")
+		if !contains(resources, "podsecuritypolicies") {
+			continue
+		}
+		translated := make([]interface{}, 0, len(resources))
+		for _, resource := range resources {
+			if resource == "podsecuritypolicies" {
+				resource = SecurityContextConstraintsResource.Resource
+			}
+			translated = append(translated, resource)
+		}
+		content["resources"] = translated
+		content["apiGroups"] = []interface{}{SecurityGroup}
+		rules[index] = content
+		modified = true
+	}
+	if modified {
+		_ = unstructured.SetNestedSlice(role.Object, rules, "rules")
+	}
+	return modified
+}
+
+// IsOpenShiftInternalRegistry checks if the URL of a registry is the internal registry of OpenShift.
+func IsOpenShiftInternalRegistry(url string) bool {
+	host := strings.SplitN(strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://"), "/", 2)[0]
+	return host == OpenShiftInternalRegistry
+}
+
+// internalRegistryProject returns the project of the images of the internal registry, from the path of its URL.
+func internalRegistryProject(url string) string {
+	parts := strings.SplitN(strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://"), "/", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// ExternalRegistries returns the configuration without the internal registry of OpenShift, whose images are pulled
+// without pull secrets.
+func (rc *RegistriesConfig) ExternalRegistries() *RegistriesConfig {
+	internal := make(map[string]bool, 0)
+	result := &RegistriesConfig{ServiceAccounts: rc.ServiceAccounts, SkipWorkloads: rc.SkipWorkloads}
+	for _, registry := range rc.Registries {
+		if IsOpenShiftInternalRegistry(registry.URL) {
+			internal[registry.SecretName] = true
+			continue
+		}
+		result.Registries = append(result.Registries, registry)
+	}
+	for _, rule := range rc.Rules {
+		if !internal[rule.SecretName] {
+			result.Rules = append(result.Rules, rule)
+		}
+	}
+	return result
+}
+
+// ImagePullerBinding creates the role binding allowing the service accounts of a namespace to pull the images of a
+// project of the internal registry.
+//   params:
+//     project The project of the images.
+//     namespace The namespace of the service accounts.
+//   returns:
+//     The RoleBinding on the project.
+func ImagePullerBinding(project string, namespace string) *unstructured.Unstructured {
+	binding := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       "RoleBinding",
+		"roleRef": map[string]interface{}{
+			"apiGroup": "rbac.authorization.k8s.io",
+			"kind":     "ClusterRole",
+			"name":     OpenShiftImagePullerRole,
+		},
+		"subjects": []interface{}{map[string]interface{}{
+			"apiGroup": "rbac.authorization.k8s.io",
+			"kind":     "Group",
+			"name":     "system:serviceaccounts:" + namespace,
+		}},
+	}}
+	binding.SetName(fmt.Sprintf("image-puller-%s", namespace))
+	binding.SetNamespace(project)
+	return binding
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = ginkgo.Describe("OpenShift", func() {
+
+	ginkgo.It("should translate the ingresses into routes", func() {
+		ingress := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "Ingress",
+			"metadata": map[string]interface{}{
+				"name":        "api",
+				"namespace":   "nalej",
+				"annotations": map[string]interface{}{nginxAnnotationPrefix + "backend-protocol": "HTTPS"},
+			},
+			"spec": map[string]interface{}{
+				"tls": []interface{}{map[string]interface{}{"hosts": []interface{}{"api.nalej.tech"}}},
+				"rules": []interface{}{
+					map[string]interface{}{"host": "api.nalej.tech", "http": map[string]interface{}{"paths": []interface{}{
+						map[string]interface{}{"path": "/", "backend": map[string]interface{}{
+							"service": map[string]interface{}{"name": "public-api", "port": map[string]interface{}{"number": int64(8081)}}}},
+					}}},
+					map[string]interface{}{"host": "web.nalej.tech", "http": map[string]interface{}{"paths": []interface{}{
+						map[string]interface{}{"path": "/v1", "backend": map[string]interface{}{
+							"service": map[string]interface{}{"name": "web", "port": map[string]interface{}{"number": int64(80)}}}},
+					}}},
+				},
+			},
+		}}
+		services := func(namespace string, name string) (*unstructured.Unstructured, derrors.Error) {
+			if name != "public-api" {
+				return nil, nil
+			}
+			return &unstructured.Unstructured{Object: map[string]interface{}{
+				"spec": map[string]interface{}{"ports": []interface{}{
+					map[string]interface{}{"port": int64(8081), "name": "grpc", "targetPort": int64(9000)},
+				}},
+			}}, nil
+		}
+		routes, err := IngressRoutes(ingress, services)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(routes).To(gomega.HaveLen(2))
+
+		gomega.Expect(routes[0].GetName()).To(gomega.Equal("api-0"))
+		gomega.Expect(routes[0].GetNamespace()).To(gomega.Equal("nalej"))
+		gomega.Expect(routes[0].Object["spec"]).To(gomega.Equal(map[string]interface{}{
+			"host":           "api.nalej.tech",
+			"to":             map[string]interface{}{"kind": "Service", "name": "public-api", "weight": int64(100)},
+			"port":           map[string]interface{}{"targetPort": "grpc"},
+			"wildcardPolicy": "None",
+			"tls":            map[string]interface{}{"termination": "reencrypt", "insecureEdgeTerminationPolicy": "Redirect"},
+		}))
+		path, _, _ := unstructured.NestedString(routes[1].Object, "spec", "path")
+		gomega.Expect(path).To(gomega.Equal("/v1"))
+		gomega.Expect(routes[1].Object["spec"]).NotTo(gomega.HaveKey("tls"))
+		port, _, _ := unstructured.NestedFieldNoCopy(routes[1].Object, "spec", "port", "targetPort")
+		gomega.Expect(port).To(gomega.Equal(int64(80)))
+	})
+
+	ginkgo.It("should translate the pod security policies into security context constraints", func() {
+		psp := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "policy/v1beta1",
+			"kind":       "PodSecurityPolicy",
+			"metadata":   map[string]interface{}{"name": "nalej-restricted"},
+			"spec": map[string]interface{}{
+				"allowPrivilegeEscalation": false,
+				"requiredDropCapabilities": []interface{}{"ALL"},
+				"volumes":                  []interface{}{"configMap", "secret"},
+				"runAsUser":                map[string]interface{}{"rule": "MustRunAs", "ranges": []interface{}{map[string]interface{}{"min": int64(1000), "max": int64(2000)}}},
+				"seLinux":                  map[string]interface{}{"rule": "RunAsAny"},
+				"fsGroup":                  map[string]interface{}{"rule": "MustRunAs", "ranges": []interface{}{map[string]interface{}{"min": int64(1), "max": int64(65535)}}},
+			},
+		}}
+		scc := SecurityContextConstraints(psp)
+		gomega.Expect(scc.GetName()).To(gomega.Equal("nalej-restricted"))
+		gomega.Expect(scc.GetKind()).To(gomega.Equal("SecurityContextConstraints"))
+		gomega.Expect(scc.Object["allowPrivilegedContainer"]).To(gomega.BeFalse())
+		gomega.Expect(scc.Object["allowPrivilegeEscalation"]).To(gomega.BeFalse())
+		gomega.Expect(scc.Object["allowHostDirVolumePlugin"]).To(gomega.BeFalse())
+		gomega.Expect(scc.Object["requiredDropCapabilities"]).To(gomega.Equal([]interface{}{"ALL"}))
+		gomega.Expect(scc.Object["runAsUser"]).To(gomega.Equal(map[string]interface{}{
+			"type": "MustRunAsRange", "uidRangeMin": int64(1000), "uidRangeMax": int64(2000)}))
+		gomega.Expect(scc.Object["seLinuxContext"]).To(gomega.Equal(map[string]interface{}{"type": "RunAsAny"}))
+		fsGroup, _, _ := unstructured.NestedString(scc.Object, "fsGroup", "type")
+		gomega.Expect(fsGroup).To(gomega.Equal("MustRunAs"))
+
+		role := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "ClusterRole",
+			"metadata":   map[string]interface{}{"name": "nalej-restricted"},
+			"rules": []interface{}{
+				map[string]interface{}{"apiGroups": []interface{}{"policy"}, "resources": []interface{}{"podsecuritypolicies"},
+					"verbs": []interface{}{"use"}, "resourceNames": []interface{}{"nalej-restricted"}},
+				map[string]interface{}{"apiGroups": []interface{}{""}, "resources": []interface{}{"pods"}, "verbs": []interface{}{"get"}},
+			},
+		}}
+		gomega.Expect(UseSecurityContextConstraints(role)).To(gomega.BeTrue())
+		rules, _, _ := unstructured.NestedSlice(role.Object, "rules")
+		gomega.Expect(rules[0]).To(gomega.Equal(map[string]interface{}{
+			"apiGroups": []interface{}{SecurityGroup}, "resources": []interface{}{"securitycontextconstraints"},
+			"verbs": []interface{}{"use"}, "resourceNames": []interface{}{"nalej-restricted"}}))
+		gomega.Expect(UseSecurityContextConstraints(role)).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should not create pull secrets for the internal registry", func() {
+		config := &RegistriesConfig{
+			Registries: []RegistryCredentials{
+				{SecretName: "internal", URL: OpenShiftInternalRegistry + "/nalej"},
+				{SecretName: "quay", URL: "quay.io"},
+			},
+			Rules: []PullSecretRule{{ImagePrefix: "nalej/", SecretName: "internal"}},
+		}
+		external := config.ExternalRegistries()
+		gomega.Expect(external.SecretNames()).To(gomega.Equal([]string{"quay"}))
+		gomega.Expect(external.Rules).To(gomega.BeEmpty())
+		gomega.Expect(internalRegistryProject(config.Registries[0].URL)).To(gomega.Equal("nalej"))
+		gomega.Expect(internalRegistryProject(OpenShiftInternalRegistry)).To(gomega.BeEmpty())
+
+		binding := ImagePullerBinding("nalej", "ingress-nginx")
+		gomega.Expect(binding.GetNamespace()).To(gomega.Equal("nalej"))
+		subjects, _, _ := unstructured.NestedSlice(binding.Object, "subjects")
+		gomega.Expect(subjects[0].(map[string]interface{})["name"]).To(gomega.Equal("system:serviceaccounts:ingress-nginx"))
+	})
+
+	ginkgo.It("should skip the components of other platforms", func() {
+		skipped := map[string]interface{}{"metadata": map[string]interface{}{
+			"name": "a", "annotations": map[string]interface{}{SkipPlatformsAnnotation: "AZURE, OPENSHIFT"}}}
+		kept := map[string]interface{}{"metadata": map[string]interface{}{"name": "b"}}
+		gomega.Expect(skipOnPlatform(&unstructured.Unstructured{Object: skipped}, "OPENSHIFT")).To(gomega.BeTrue())
+		gomega.Expect(skipOnPlatform(&unstructured.Unstructured{Object: skipped}, "BAREMETAL")).To(gomega.BeFalse())
+
+		list := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1", "kind": "List", "items": []interface{}{skipped, kept}}}
+		gomega.Expect(skipOnPlatform(list, "OPENSHIFT")).To(gomega.BeFalse())
+		items, _, _ := unstructured.NestedSlice(list.Object, "items")
+		gomega.Expect(items).To(gomega.HaveLen(1))
+	})
+})
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package overlay
+
+import (
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/pki"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultVPNHub is the name of the hub of the VPN server if not specified.
+const DefaultVPNHub = "nalej"
+
+// passwordLength is the number of random bytes of the generated passwords.
+const passwordLength = 24
+
+// CreateVPNServerConfig structure with the attributes required to generate the configuration and the identity keys
+// of the VPN server. Existing secrets are kept so the edge controllers do not lose access on a new install.
+type CreateVPNServerConfig struct {
+	k8s.Kubernetes
+	// PublicHost with the public hostname of the management cluster.
+	PublicHost string `json:"management_public_host"`
+	// HubName with the name of the virtual hub, DefaultVPNHub if not set.
+	HubName string `json:"hub_name"`
+	// Port where the server listens, VPNServerPort if not set.
+	Port int `json:"port"`
+}
+
+// NewCreateVPNServerConfig creates a new CreateVPNServerConfig command.
+func NewCreateVPNServerConfig(kubeConfigPath string, publicHost string) *CreateVPNServerConfig {
+	return &CreateVPNServerConfig{
+		Kubernetes: k8s.Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.CreateVPNServerConfig),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		PublicHost: publicHost,
+		HubName:    DefaultVPNHub,
+		Port:       VPNServerPort,
+	}
+}
+
+// NewCreateVPNServerConfigFromJSON creates a new CreateVPNServerConfig command from a raw JSON representation.
+func NewCreateVPNServerConfigFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	cvc := &CreateVPNServerConfig{}
+	if err := json.Unmarshal(raw, &cvc); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	if cvc.HubName == "" {
+		cvc.HubName = DefaultVPNHub
+	}
+	if cvc.Port == 0 {
+		cvc.Port = VPNServerPort
+	}
+	cvc.CommandID = entities.GenerateCommandID(cvc.Name())
+	var r entities.Command = cvc
+	return &r, nil
+}
+
+// Run the current command returning the result or an error.
+func (cvc *CreateVPNServerConfig) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := cvc.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	if err := cvc.EnsureNamespace(Namespace, k8s.NamespaceOptions{}); err != nil {
+		return entities.NewCommandResult(false, "cannot create namespace", err), nil
+	}
+
+	config, err := NewVPNServerConfig(cvc.HubName, cvc.Port)
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot generate VPN server configuration", err), nil
+	}
+	if err := createIfNotExists(&cvc.Kubernetes, config, "", "v1", "secrets", config.Name); err != nil {
+		return entities.NewCommandResult(false, "cannot create VPN server configuration", err), nil
+	}
+
+	identity, err := NewVPNServerIdentity(cvc.PublicHost)
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot generate VPN server identity", err), nil
+	}
+	if err := createIfNotExists(&cvc.Kubernetes, identity, "", "v1", "secrets", identity.Name); err != nil {
+		return entities.NewCommandResult(false, "cannot create VPN server identity", err), nil
+	}
+	return entities.NewSuccessCommand([]byte("VPN server configuration created")), nil
+}
+
+// NewVPNServerConfig creates the configuration secret of the VPN server with a random administrator password.
+func NewVPNServerConfig(hubName string, port int) (*v1.Secret, derrors.Error) {
+	random := make([]byte, passwordLength)
+	if _, err := rand.Read(random); err != nil {
+		return nil, derrors.NewInternalError("cannot generate password", err)
+	}
+	return &v1.Secret{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      VPNServerConfigSecret,
+			Namespace: Namespace,
+			Labels:    ServerLabels(VPNServerName),
+		},
+		StringData: map[string]string{
+			VPNAdminPasswordKey: base64.RawURLEncoding.EncodeToString(random),
+			VPNHubKey:           hubName,
+			VPNPortKey:          strconv.Itoa(port),
+		},
+		Type: v1.SecretTypeOpaque,
+	}, nil
+}
+
+// NewVPNServerIdentity creates the TLS secret with the identity keys of the VPN server.
+func NewVPNServerIdentity(publicHost string) (*v1.Secret, derrors.Error) {
+	host := fmt.Sprintf("%s.%s", VPNServerName, publicHost)
+	identity, err := pki.SelfSigned(pki.Request{
+		Subject: pkix.Name{
+			Organization: []string{"Nalej"},
+			CommonName:   host,
+		},
+		DNSNames:  []string{host},
+		Validity:  k8s.CertValidity,
+		Algorithm: pki.ECDSAP256,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Secret{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      VPNServerIdentitySecret,
+			Namespace: Namespace,
+			Labels:    ServerLabels(VPNServerName),
+		},
+		StringData: map[string]string{
+			v1.TLSCertKey:       string(identity.CertPEM),
+			v1.TLSPrivateKeyKey: string(identity.KeyPEM),
+		},
+		Type: v1.SecretTypeTLS,
+	}, nil
+}
+
+// String returns a string representation
+func (cvc *CreateVPNServerConfig) String() string {
+	return fmt.Sprintf("SYNC CreateVPNServerConfig for %s", cvc.PublicHost)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (cvc *CreateVPNServerConfig) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + cvc.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (cvc *CreateVPNServerConfig) UserString() string {
+	return "Creating VPN server configuration"
+}
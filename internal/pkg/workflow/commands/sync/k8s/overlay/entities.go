@@ -0,0 +1,228 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Network overlay servers
+// The VPN server used by the edge controllers and the ZeroTier planet are deployed as single replica deployments
+// with a persistent volume for their state and the configuration and identity keys mounted from secrets.
+
+package overlay
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/rs/zerolog/log"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Namespace where the overlay servers are installed.
+const Namespace = "nalej"
+
+// DefaultStorageSize is the size of the persistent volume of the servers if not specified.
+const DefaultStorageSize = "1Gi"
+
+// VPN server objects.
+const (
+	VPNServerName           = "vpn-server"
+	VPNServerConfigSecret   = "vpn-server-config"
+	VPNServerIdentitySecret = "vpn-server-identity"
+	VPNServerDataClaim      = "vpn-server-data"
+	VPNServerPort           = 5555
+)
+
+// ZeroTier planet objects. The secrets are created by the createZtPlanetFiles command.
+const (
+	ZTPlanetName           = "zt-planet"
+	ZTPlanetSecret         = "zt-planet"
+	ZTIdentitySecret       = "zt-identity-secret"
+	ZTIdentityPublicSecret = "zt-identity-public"
+	ZTPlanetDataClaim      = "zt-planet-data"
+	ZTPlanetPort           = 9993
+)
+
+// Keys of the VPN server configuration secret.
+const (
+	VPNAdminPasswordKey = "admin-password"
+	VPNHubKey           = "hub"
+	VPNPortKey          = "port"
+)
+
+// ServerLabels returns the labels of the objects of an overlay server.
+func ServerLabels(component string) map[string]string {
+	return map[string]string{
+		"cluster":   "management",
+		"component": component,
+	}
+}
+
+// SecretVolume structure with a secret mounted on a server.
+type SecretVolume struct {
+	// Secret with the name of the secret.
+	Secret string
+	// MountPath where the content of the secret is available.
+	MountPath string
+}
+
+// ServerSpec structure with the attributes of an overlay server deployment.
+type ServerSpec struct {
+	// Name of the server, used for the deployment and its component label.
+	Name string
+	// Image of the server container.
+	Image string
+	// Port exposed by the server.
+	Port v1.ContainerPort
+	// DataClaim with the name of the persistent volume claim of the server.
+	DataClaim string
+	// DataPath where the persistent volume is mounted.
+	DataPath string
+	// Secrets mounted on the server.
+	Secrets []SecretVolume
+	// Env with the environment variables of the server.
+	Env []v1.EnvVar
+	// ReadinessProbe determining when the server is ready.
+	ReadinessProbe *v1.Probe
+}
+
+// NewServerStorage creates the persistent volume claim of an overlay server.
+//   params:
+//     name The name of the claim.
+//     size The requested size, DefaultStorageSize if empty.
+//     storageClass The storage class, the default one of the cluster if empty.
+//     component The component label.
+//   returns:
+//     The claim.
+//     An error if the size is not valid.
+func NewServerStorage(name string, size string, storageClass string, component string) (*v1.PersistentVolumeClaim, derrors.Error) {
+	if size == "" {
+		size = DefaultStorageSize
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("invalid storage size", err).WithParams(size)
+	}
+	claim := &v1.PersistentVolumeClaim{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "PersistentVolumeClaim",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      name,
+			Namespace: Namespace,
+			Labels:    ServerLabels(component),
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: quantity},
+			},
+		},
+	}
+	if storageClass != "" {
+		claim.Spec.StorageClassName = &storageClass
+	}
+	return claim, nil
+}
+
+// StorageClass returns the storage class used on a platform unless one is explicitly requested.
+func StorageClass(platformType string, requested string) string {
+	if requested == "" && platformType == grpc_installer_go.Platform_AZURE.String() {
+		return k8s.AzureStorageClass
+	}
+	return requested
+}
+
+// NewServerDeployment creates the deployment of an overlay server. A single replica is launched and replaced on
+// updates as the persistent volume cannot be shared.
+func NewServerDeployment(spec ServerSpec) *appsV1.Deployment {
+	replicas := int32(1)
+	labels := ServerLabels(spec.Name)
+	volumes := []v1.Volume{{
+		Name: "data",
+		VolumeSource: v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: spec.DataClaim},
+		},
+	}}
+	mounts := []v1.VolumeMount{{Name: "data", MountPath: spec.DataPath}}
+	for _, secret := range spec.Secrets {
+		volumes = append(volumes, v1.Volume{
+			Name:         secret.Secret,
+			VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: secret.Secret}},
+		})
+		mounts = append(mounts, v1.VolumeMount{Name: secret.Secret, MountPath: secret.MountPath, ReadOnly: true})
+	}
+	return &appsV1.Deployment{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      spec.Name,
+			Namespace: Namespace,
+			Labels:    labels,
+		},
+		Spec: appsV1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metaV1.LabelSelector{MatchLabels: labels},
+			Strategy: appsV1.DeploymentStrategy{Type: appsV1.RecreateDeploymentStrategyType},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metaV1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{
+						Name:            spec.Name,
+						Image:           spec.Image,
+						ImagePullPolicy: v1.PullIfNotPresent,
+						Ports:           []v1.ContainerPort{spec.Port},
+						Env:             spec.Env,
+						VolumeMounts:    mounts,
+						ReadinessProbe:  spec.ReadinessProbe,
+					}},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+}
+
+// tcpProbe creates a readiness probe checking that a TCP port accepts connections.
+func tcpProbe(port int) *v1.Probe {
+	return &v1.Probe{
+		Handler: v1.Handler{
+			TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(port)},
+		},
+		InitialDelaySeconds: 5,
+		PeriodSeconds:       10,
+	}
+}
+
+// createIfNotExists creates an object unless it already exists, so the commands can be executed again without
+// replacing the state of the servers.
+func createIfNotExists(k *k8s.Kubernetes, obj runtime.Object, group string, version string, resource string, name string) derrors.Error {
+	exists, err := k.ExistsEntity(Namespace, group, version, resource, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		log.Info().Str("resource", resource).Str("name", name).Msg("overlay object already exists, skipping")
+		return nil
+	}
+	return k.Create(obj)
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package overlay
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+)
+
+var _ = ginkgo.Describe("Network overlay servers", func() {
+
+	ginkgo.It("should generate a different password on each configuration", func() {
+		first, err := NewVPNServerConfig(DefaultVPNHub, VPNServerPort)
+		gomega.Expect(err).To(gomega.BeNil())
+		second, err := NewVPNServerConfig(DefaultVPNHub, VPNServerPort)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(first.StringData[VPNAdminPasswordKey]).ToNot(gomega.BeEmpty())
+		gomega.Expect(first.StringData[VPNAdminPasswordKey]).ToNot(gomega.Equal(second.StringData[VPNAdminPasswordKey]))
+		gomega.Expect(first.StringData[VPNPortKey]).To(gomega.Equal("5555"))
+	})
+
+	ginkgo.It("should generate the identity keys of the VPN server", func() {
+		identity, err := NewVPNServerIdentity("nalej.example.com")
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(identity.Type).To(gomega.Equal(v1.SecretTypeTLS))
+		block, _ := pem.Decode([]byte(identity.StringData[v1.TLSCertKey]))
+		gomega.Expect(block).ToNot(gomega.BeNil())
+		cert, cErr := x509.ParseCertificate(block.Bytes)
+		gomega.Expect(cErr).To(gomega.Succeed())
+		gomega.Expect(cert.DNSNames).To(gomega.ConsistOf("vpn-server.nalej.example.com"))
+		gomega.Expect(identity.StringData[v1.TLSPrivateKeyKey]).To(gomega.ContainSubstring("EC PRIVATE KEY"))
+	})
+
+	ginkgo.It("should select the storage class of the platform", func() {
+		gomega.Expect(StorageClass(grpc_installer_go.Platform_AZURE.String(), "")).To(gomega.Equal(k8s.AzureStorageClass))
+		gomega.Expect(StorageClass(grpc_installer_go.Platform_AZURE.String(), "fast")).To(gomega.Equal("fast"))
+		gomega.Expect(StorageClass(grpc_installer_go.Platform_MINIKUBE.String(), "")).To(gomega.BeEmpty())
+		claim, err := NewServerStorage(VPNServerDataClaim, "", "", VPNServerName)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(claim.Spec.StorageClassName).To(gomega.BeNil())
+		gomega.Expect(claim.Spec.Resources.Requests.Storage().String()).To(gomega.Equal(DefaultStorageSize))
+		_, err = NewServerStorage(VPNServerDataClaim, "lots", "", VPNServerName)
+		gomega.Expect(err).ToNot(gomega.BeNil())
+	})
+
+	ginkgo.It("should mount the storage and secrets of the server", func() {
+		deployment := NewServerDeployment(ZTPlanetSpec("nalej/zt-planet:latest"))
+		gomega.Expect(*deployment.Spec.Replicas).To(gomega.Equal(int32(1)))
+		gomega.Expect(deployment.Spec.Strategy.Type).To(gomega.Equal(appsV1.RecreateDeploymentStrategyType))
+		gomega.Expect(deployment.Spec.Template.Labels).To(gomega.HaveKeyWithValue("component", ZTPlanetName))
+		gomega.Expect(deployment.Spec.Template.Spec.Volumes).To(gomega.HaveLen(4))
+		container := deployment.Spec.Template.Spec.Containers[0]
+		gomega.Expect(container.VolumeMounts[0].MountPath).To(gomega.Equal("/var/lib/zerotier-one"))
+		gomega.Expect(container.Ports[0].Protocol).To(gomega.Equal(v1.ProtocolUDP))
+	})
+})
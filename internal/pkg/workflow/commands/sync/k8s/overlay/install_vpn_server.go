@@ -0,0 +1,133 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package overlay
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"k8s.io/api/core/v1"
+)
+
+// InstallVPNServer structure with the attributes required to deploy the VPN server used by the edge controllers.
+// The configuration and identity secrets are created by the createVpnServerConfig command.
+type InstallVPNServer struct {
+	k8s.Kubernetes
+	// Image of the VPN server.
+	Image string `json:"image"`
+	// PlatformType of the cluster, used to select the storage class.
+	PlatformType string `json:"platform_type"`
+	// StorageSize of the persistent volume, DefaultStorageSize if not set.
+	StorageSize string `json:"storage_size"`
+	// StorageClass of the persistent volume, the one of the platform if not set.
+	StorageClass string `json:"storage_class"`
+}
+
+// NewInstallVPNServer creates a new InstallVPNServer command.
+func NewInstallVPNServer(kubeConfigPath string, image string, platformType string) *InstallVPNServer {
+	return &InstallVPNServer{
+		Kubernetes: k8s.Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.InstallVPNServer),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Image:        image,
+		PlatformType: platformType,
+	}
+}
+
+// NewInstallVPNServerFromJSON creates a new InstallVPNServer command from a raw JSON representation.
+func NewInstallVPNServerFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	ivs := &InstallVPNServer{}
+	if err := json.Unmarshal(raw, &ivs); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	ivs.CommandID = entities.GenerateCommandID(ivs.Name())
+	var r entities.Command = ivs
+	return &r, nil
+}
+
+// VPNServerSpec returns the specification of the VPN server deployment.
+func VPNServerSpec(image string) ServerSpec {
+	secretEnv := func(name string, key string) v1.EnvVar {
+		return v1.EnvVar{
+			Name: name,
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: VPNServerConfigSecret},
+					Key:                  key,
+				},
+			},
+		}
+	}
+	return ServerSpec{
+		Name:      VPNServerName,
+		Image:     image,
+		Port:      v1.ContainerPort{Name: "vpn-port", ContainerPort: VPNServerPort, Protocol: v1.ProtocolTCP},
+		DataClaim: VPNServerDataClaim,
+		DataPath:  "/var/lib/vpn-server",
+		Secrets: []SecretVolume{
+			{Secret: VPNServerIdentitySecret, MountPath: "/etc/vpn-server/tls"},
+		},
+		Env: []v1.EnvVar{
+			secretEnv("VPN_ADMIN_PASSWORD", VPNAdminPasswordKey),
+			secretEnv("VPN_HUB", VPNHubKey),
+			secretEnv("VPN_PORT", VPNPortKey),
+		},
+		ReadinessProbe: tcpProbe(VPNServerPort),
+	}
+}
+
+// Run the current command returning the result or an error.
+func (ivs *InstallVPNServer) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := ivs.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	claim, err := NewServerStorage(VPNServerDataClaim, ivs.StorageSize, StorageClass(ivs.PlatformType, ivs.StorageClass), VPNServerName)
+	if err != nil {
+		return entities.NewCommandResult(false, "invalid VPN server storage", err), nil
+	}
+	if err := createIfNotExists(&ivs.Kubernetes, claim, "", "v1", "persistentvolumeclaims", claim.Name); err != nil {
+		return entities.NewCommandResult(false, "cannot create VPN server storage", err), nil
+	}
+	deployment := NewServerDeployment(VPNServerSpec(ivs.Image))
+	if err := createIfNotExists(&ivs.Kubernetes, deployment, "apps", "v1", "deployments", deployment.Name); err != nil {
+		return entities.NewCommandResult(false, "cannot create VPN server deployment", err), nil
+	}
+	return entities.NewSuccessCommand([]byte("VPN server installed")), nil
+}
+
+// String returns a string representation
+func (ivs *InstallVPNServer) String() string {
+	return fmt.Sprintf("SYNC InstallVPNServer with %s", ivs.Image)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (ivs *InstallVPNServer) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + ivs.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (ivs *InstallVPNServer) UserString() string {
+	return "Installing VPN server"
+}
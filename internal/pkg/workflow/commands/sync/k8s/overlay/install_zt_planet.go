@@ -0,0 +1,138 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package overlay
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"k8s.io/api/core/v1"
+)
+
+// InstallZTPlanet structure with the attributes required to deploy a standalone ZeroTier planet. The planet and
+// identity secrets are created by the createZtPlanetFiles command.
+// Deprecated: InstallZTPlanet should not be used as the platform will remove ZT support.
+type InstallZTPlanet struct {
+	k8s.Kubernetes
+	// Image of the ZeroTier planet.
+	Image string `json:"image"`
+	// PlatformType of the cluster, used to select the storage class.
+	PlatformType string `json:"platform_type"`
+	// StorageSize of the persistent volume, DefaultStorageSize if not set.
+	StorageSize string `json:"storage_size"`
+	// StorageClass of the persistent volume, the one of the platform if not set.
+	StorageClass string `json:"storage_class"`
+}
+
+// NewInstallZTPlanet creates a new InstallZTPlanet command.
+// Deprecated: NewInstallZTPlanet should not be used as the platform will remove ZT support.
+func NewInstallZTPlanet(kubeConfigPath string, image string, platformType string) *InstallZTPlanet {
+	return &InstallZTPlanet{
+		Kubernetes: k8s.Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.InstallZTPlanet),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Image:        image,
+		PlatformType: platformType,
+	}
+}
+
+// NewInstallZTPlanetFromJSON creates a new InstallZTPlanet command from a raw JSON representation.
+func NewInstallZTPlanetFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	izp := &InstallZTPlanet{}
+	if err := json.Unmarshal(raw, &izp); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	izp.CommandID = entities.GenerateCommandID(izp.Name())
+	var r entities.Command = izp
+	return &r, nil
+}
+
+// ZTPlanetSpec returns the specification of the ZeroTier planet deployment. ZeroTier uses UDP so readiness is
+// checked through its local CLI.
+func ZTPlanetSpec(image string) ServerSpec {
+	return ServerSpec{
+		Name:      ZTPlanetName,
+		Image:     image,
+		Port:      v1.ContainerPort{Name: "zt-udp", ContainerPort: ZTPlanetPort, Protocol: v1.ProtocolUDP},
+		DataClaim: ZTPlanetDataClaim,
+		DataPath:  "/var/lib/zerotier-one",
+		Secrets: []SecretVolume{
+			{Secret: ZTPlanetSecret, MountPath: "/etc/zerotier/planet"},
+			{Secret: ZTIdentitySecret, MountPath: "/etc/zerotier/identity-secret"},
+			{Secret: ZTIdentityPublicSecret, MountPath: "/etc/zerotier/identity-public"},
+		},
+		ReadinessProbe: &v1.Probe{
+			Handler: v1.Handler{
+				Exec: &v1.ExecAction{Command: []string{"zerotier-cli", "info"}},
+			},
+			InitialDelaySeconds: 5,
+			PeriodSeconds:       10,
+		},
+	}
+}
+
+// Run the current command returning the result or an error.
+func (izp *InstallZTPlanet) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := izp.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	for _, secret := range []string{ZTPlanetSecret, ZTIdentitySecret, ZTIdentityPublicSecret} {
+		exists, err := izp.ExistsEntity(Namespace, "", "v1", "secrets", secret)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return entities.NewCommandResult(false, "ZeroTier planet files have not been created",
+				derrors.NewNotFoundError("secret not found").WithParams(secret)), nil
+		}
+	}
+	claim, err := NewServerStorage(ZTPlanetDataClaim, izp.StorageSize, StorageClass(izp.PlatformType, izp.StorageClass), ZTPlanetName)
+	if err != nil {
+		return entities.NewCommandResult(false, "invalid ZeroTier planet storage", err), nil
+	}
+	if err := createIfNotExists(&izp.Kubernetes, claim, "", "v1", "persistentvolumeclaims", claim.Name); err != nil {
+		return entities.NewCommandResult(false, "cannot create ZeroTier planet storage", err), nil
+	}
+	deployment := NewServerDeployment(ZTPlanetSpec(izp.Image))
+	if err := createIfNotExists(&izp.Kubernetes, deployment, "apps", "v1", "deployments", deployment.Name); err != nil {
+		return entities.NewCommandResult(false, "cannot create ZeroTier planet deployment", err), nil
+	}
+	return entities.NewSuccessCommand([]byte("ZeroTier planet installed")), nil
+}
+
+// String returns a string representation
+func (izp *InstallZTPlanet) String() string {
+	return fmt.Sprintf("SYNC InstallZTPlanet with %s", izp.Image)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (izp *InstallZTPlanet) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + izp.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (izp *InstallZTPlanet) UserString() string {
+	return "Installing ZeroTier planet"
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Pod Security Admission levels ordered from the most permissive to the most restrictive one.
+const (
+	PodSecurityPrivileged = "privileged"
+	PodSecurityBaseline   = "baseline"
+	PodSecurityRestricted = "restricted"
+)
+
+// Pod Security Admission labels set on the namespaces.
+const (
+	PodSecurityEnforceLabel        = "pod-security.kubernetes.io/enforce"
+	PodSecurityEnforceVersionLabel = "pod-security.kubernetes.io/enforce-version"
+	PodSecurityAuditLabel          = "pod-security.kubernetes.io/audit"
+	PodSecurityWarnLabel           = "pod-security.kubernetes.io/warn"
+)
+
+// podSecurityOrder contains the position of each level, the lower the more permissive.
+var podSecurityOrder = map[string]int{
+	PodSecurityPrivileged: 0,
+	PodSecurityBaseline:   1,
+	PodSecurityRestricted: 2,
+}
+
+// baselineCapabilities contains the capabilities that may be added under the baseline level.
+var baselineCapabilities = map[string]bool{
+	"AUDIT_WRITE": true, "CHOWN": true, "DAC_OVERRIDE": true, "FOWNER": true, "FSETID": true, "KILL": true,
+	"MKNOD": true, "NET_BIND_SERVICE": true, "SETFCAP": true, "SETGID": true, "SETPCAP": true, "SETUID": true,
+	"SYS_CHROOT": true,
+}
+
+// restrictedVolumes contains the volume types allowed under the restricted level.
+var restrictedVolumes = map[string]bool{
+	"configMap": true, "csi": true, "downwardAPI": true, "emptyDir": true, "ephemeral": true,
+	"persistentVolumeClaim": true, "projected": true, "secret": true,
+}
+
+// SupportsPodSecurityPolicy checks if the cluster still serves PodSecurityPolicies, removed in Kubernetes 1.25.
+func (c *Capabilities) SupportsPodSecurityPolicy() bool {
+	return !c.AtLeast(1, 25) && (c.Supports("policy/v1beta1") || c.Supports("extensions/v1beta1"))
+}
+
+// PodSecurityLevel translates a PodSecurityPolicy into the Pod Security Admission level that allows the same pods.
+//   params:
+//     psp The PodSecurityPolicy.
+//   returns:
+//     The equivalent level.
+func PodSecurityLevel(psp *unstructured.Unstructured) string {
+	spec, _, _ := unstructured.NestedMap(psp.Object, "spec")
+	for _, field := range []string{"privileged", "hostNetwork", "hostPID", "hostIPC"} {
+		if enabled, _, _ := unstructured.NestedBool(spec, field); enabled {
+			return PodSecurityPrivileged
+		}
+	}
+	if ports, _, _ := unstructured.NestedSlice(spec, "hostPorts"); len(ports) > 0 {
+		return PodSecurityPrivileged
+	}
+	capabilities, _, _ := unstructured.NestedStringSlice(spec, "allowedCapabilities")
+	for _, capability := range capabilities {
+		if !baselineCapabilities[capability] {
+			return PodSecurityPrivileged
+		}
+	}
+	volumes, _, _ := unstructured.NestedStringSlice(spec, "volumes")
+	restrictedVolumeSet := true
+	for _, volume := range volumes {
+		if volume == "*" || volume == "hostPath" {
+			return PodSecurityPrivileged
+		}
+		restrictedVolumeSet = restrictedVolumeSet && restrictedVolumes[volume]
+	}
+
+	escalation, found, _ := unstructured.NestedBool(spec, "allowPrivilegeEscalation")
+	runAsUser, _, _ := unstructured.NestedString(spec, "runAsUser", "rule")
+	dropped, _, _ := unstructured.NestedStringSlice(spec, "requiredDropCapabilities")
+	if found && !escalation && runAsUser == "MustRunAsNonRoot" && contains(dropped, "ALL") &&
+		len(capabilities) == 0 && restrictedVolumeSet {
+		return PodSecurityRestricted
+	}
+	return PodSecurityBaseline
+}
+
+// MostPermissiveLevel returns the most permissive of a set of levels, or an empty string if none is given.
+func MostPermissiveLevel(levels ...string) string {
+	result := ""
+	for _, level := range levels {
+		if result == "" || podSecurityOrder[level] < podSecurityOrder[result] {
+			result = level
+		}
+	}
+	return result
+}
+
+// PodSecurityLabels returns the labels that enforce a level on a namespace.
+func PodSecurityLabels(level string) map[string]string {
+	return map[string]string{
+		PodSecurityEnforceLabel:        level,
+		PodSecurityEnforceVersionLabel: "latest",
+		PodSecurityAuditLabel:          level,
+		PodSecurityWarnLabel:           level,
+	}
+}
+
+// SetNamespacePodSecurity sets the Pod Security Admission labels of a namespace.
+//   params:
+//     name The name of the namespace.
+//     level The level to be enforced.
+//   returns:
+//     An error if the namespace cannot be updated.
+func (k *Kubernetes) SetNamespacePodSecurity(name string, level string) derrors.Error {
+	if err := k.EnsureNamespace(name, NamespaceOptions{Labels: PodSecurityLabels(level)}); err != nil {
+		return err
+	}
+	log.Debug().Str("namespace", name).Str("level", level).Msg("pod security labels set")
+	return nil
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newPodSecurityPolicy creates a PodSecurityPolicy with a given specification.
+func newPodSecurityPolicy(spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "policy/v1beta1",
+		"kind":       "PodSecurityPolicy",
+		"metadata":   map[string]interface{}{"name": "test"},
+		"spec":       spec,
+	}}
+}
+
+var _ = ginkgo.Describe("Pod security", func() {
+
+	ginkgo.It("should detect clusters without pod security policies", func() {
+		gomega.Expect(NewCapabilities("1", "24", "v1.24.0", []string{"policy/v1beta1"}).SupportsPodSecurityPolicy()).To(gomega.BeTrue())
+		gomega.Expect(NewCapabilities("1", "25", "v1.25.0", []string{"policy/v1"}).SupportsPodSecurityPolicy()).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should translate privileged policies", func() {
+		psp := newPodSecurityPolicy(map[string]interface{}{"privileged": true})
+		gomega.Expect(PodSecurityLevel(psp)).To(gomega.Equal(PodSecurityPrivileged))
+		psp = newPodSecurityPolicy(map[string]interface{}{"volumes": []interface{}{"configMap", "hostPath"}})
+		gomega.Expect(PodSecurityLevel(psp)).To(gomega.Equal(PodSecurityPrivileged))
+		psp = newPodSecurityPolicy(map[string]interface{}{"allowedCapabilities": []interface{}{"NET_ADMIN"}})
+		gomega.Expect(PodSecurityLevel(psp)).To(gomega.Equal(PodSecurityPrivileged))
+	})
+
+	ginkgo.It("should translate restricted policies", func() {
+		psp := newPodSecurityPolicy(map[string]interface{}{
+			"allowPrivilegeEscalation": false,
+			"requiredDropCapabilities": []interface{}{"ALL"},
+			"runAsUser":                map[string]interface{}{"rule": "MustRunAsNonRoot"},
+			"volumes":                  []interface{}{"configMap", "secret", "emptyDir"},
+		})
+		gomega.Expect(PodSecurityLevel(psp)).To(gomega.Equal(PodSecurityRestricted))
+	})
+
+	ginkgo.It("should translate the rest of policies to baseline", func() {
+		psp := newPodSecurityPolicy(map[string]interface{}{
+			"runAsUser": map[string]interface{}{"rule": "RunAsAny"},
+			"volumes":   []interface{}{"configMap", "secret"},
+		})
+		gomega.Expect(PodSecurityLevel(psp)).To(gomega.Equal(PodSecurityBaseline))
+	})
+
+	ginkgo.It("should select the most permissive level", func() {
+		gomega.Expect(MostPermissiveLevel()).To(gomega.BeEmpty())
+		gomega.Expect(MostPermissiveLevel(PodSecurityRestricted, PodSecurityBaseline)).To(gomega.Equal(PodSecurityBaseline))
+		gomega.Expect(MostPermissiveLevel(PodSecurityRestricted, PodSecurityPrivileged, PodSecurityBaseline)).To(gomega.Equal(PodSecurityPrivileged))
+	})
+})
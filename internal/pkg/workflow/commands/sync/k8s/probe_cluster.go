@@ -0,0 +1,239 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the probe of the connection to the API server of the target cluster, classifying the failures
+// so the user knows whether to fix the DNS, the certificates, the permissions or the network.
+
+package k8s
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	authorizationV1 "k8s.io/api/authorization/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// DefaultProbeSamples is the number of requests used to measure the latency of the API server.
+const DefaultProbeSamples = 3
+
+// DefaultProbeMaxLatency is the maximum median latency of the API server accepted by the probe.
+const DefaultProbeMaxLatency = 2 * time.Second
+
+// DefaultProbeAccess contains the accesses checked by the probe if none are specified, the ones required to start
+// an install.
+var DefaultProbeAccess = []ObjectAccess{
+	Access("", "namespaces", CreateVerbs),
+}
+
+// ConnectionErrorCode classifies an error of a request to the API server.
+//   params:
+//     err The error returned by the client.
+//   returns:
+//     The error code: K8sDNSFailed, K8sTLSFailed, K8sForbidden, or K8sUnreachable otherwise.
+func ConnectionErrorCode(err error) errors.Code {
+	if k8sErrors.IsForbidden(err) || k8sErrors.IsUnauthorized(err) {
+		return errors.K8sForbidden
+	}
+	for cause := err; cause != nil; cause = unwrapError(cause) {
+		switch cause.(type) {
+		case *net.DNSError:
+			return errors.K8sDNSFailed
+		case x509.UnknownAuthorityError, *x509.UnknownAuthorityError, x509.HostnameError, *x509.HostnameError,
+			x509.CertificateInvalidError, *x509.CertificateInvalidError, tls.RecordHeaderError:
+			return errors.K8sTLSFailed
+		}
+	}
+	// Some TLS errors are only available as the message of the transport.
+	if strings.Contains(err.Error(), "x509: ") {
+		return errors.K8sTLSFailed
+	}
+	return errors.K8sUnreachable
+}
+
+// unwrapError returns the cause of the errors returned by the transport of the clients, or nil if there is none.
+func unwrapError(err error) error {
+	switch e := err.(type) {
+	case *url.Error:
+		return e.Err
+	case *net.OpError:
+		return e.Err
+	case *os.SyscallError:
+		return e.Err
+	case interface{ Unwrap() error }:
+		return e.Unwrap()
+	}
+	return nil
+}
+
+// ProbeCluster structure with the attributes required to check that the API server of the target cluster is
+// reachable, fast enough, and grants the accesses of the install.
+type ProbeCluster struct {
+	// Kubernetes embedded object
+	Kubernetes
+	// Samples with the number of requests used to measure the latency. If not set, DefaultProbeSamples is used.
+	Samples int `json:"samples"`
+	// MaxLatencyMillis with the maximum median latency in milliseconds. If not set, DefaultProbeMaxLatency is used.
+	MaxLatencyMillis int `json:"max_latency"`
+	// Access with the accesses to be granted to the credentials. If not set, DefaultProbeAccess is used.
+	Access []ObjectAccess `json:"access"`
+}
+
+// NewProbeCluster creates a new ProbeCluster command.
+func NewProbeCluster(kubeConfigPath string) *ProbeCluster {
+	return &ProbeCluster{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.ProbeCluster),
+			KubeConfigPath:     kubeConfigPath,
+		},
+	}
+}
+
+// NewProbeClusterFromJSON creates a new ProbeCluster command from a raw JSON representation.
+func NewProbeClusterFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	pc := &ProbeCluster{}
+	if err := json.Unmarshal(raw, &pc); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	pc.CommandID = entities.GenerateCommandID(pc.Name())
+	var r entities.Command = pc
+	return &r, nil
+}
+
+// Run the current command returning the result or an error.
+func (pc *ProbeCluster) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := pc.Connect()
+	if connectErr != nil {
+		return entities.NewCommandResult(false, errors.Coded(errors.K8sUnreachable, "cannot connect to K8s"), connectErr), nil
+	}
+
+	latencies, version, err := pc.measureLatency()
+	if err != nil {
+		msg := errors.Coded(ConnectionErrorCode(err), "cannot reach the API server")
+		return entities.NewCommandResult(false, msg, derrors.NewUnavailableError(msg, err)), nil
+	}
+	median := latencies[len(latencies)/2]
+	if median > pc.maxLatency() {
+		msg := errors.Coded(errors.K8sHighLatency, fmt.Sprintf("the API server answered in %s, expecting less than %s",
+			median, pc.maxLatency()))
+		return entities.NewCommandResult(false, msg, nil), nil
+	}
+
+	denied, err := pc.deniedAccess()
+	if err != nil {
+		msg := errors.Coded(ConnectionErrorCode(err), "cannot review the access of the credentials")
+		return entities.NewCommandResult(false, msg, derrors.NewUnavailableError(msg, err)), nil
+	}
+	if len(denied) > 0 {
+		msg := errors.Coded(errors.K8sForbidden, fmt.Sprintf("the credentials cannot %s", strings.Join(denied, ", ")))
+		return entities.NewCommandResult(false, msg, nil), nil
+	}
+
+	msg := fmt.Sprintf("API server %s reachable in %s (max %s)", version, median, latencies[len(latencies)-1])
+	return entities.NewSuccessCommand([]byte(msg)), nil
+}
+
+// measureLatency requests the version of the API server, returning the sorted latencies of the requests.
+func (pc *ProbeCluster) measureLatency() ([]time.Duration, string, error) {
+	samples := pc.Samples
+	if samples <= 0 {
+		samples = DefaultProbeSamples
+	}
+	latencies := make([]time.Duration, 0, samples)
+	version := ""
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		info, err := pc.discoveryClient.ServerVersion()
+		if err != nil {
+			return nil, "", err
+		}
+		latencies = append(latencies, time.Since(start))
+		version = info.GitVersion
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	log.Debug().Str("version", version).Interface("latencies", latencies).Msg("API server latency")
+	return latencies, version, nil
+}
+
+// maxLatency returns the maximum median latency accepted by the probe.
+func (pc *ProbeCluster) maxLatency() time.Duration {
+	if pc.MaxLatencyMillis > 0 {
+		return time.Duration(pc.MaxLatencyMillis) * time.Millisecond
+	}
+	return DefaultProbeMaxLatency
+}
+
+// deniedAccess reviews the accesses of the probe with the credentials of the command, returning the denied ones.
+func (pc *ProbeCluster) deniedAccess() ([]string, error) {
+	accesses := pc.Access
+	if accesses == nil {
+		accesses = DefaultProbeAccess
+	}
+	denied := make([]string, 0)
+	for _, access := range accesses {
+		for _, verb := range access.Verbs {
+			review := &authorizationV1.SelfSubjectAccessReview{
+				Spec: authorizationV1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationV1.ResourceAttributes{
+						Group:    access.Group,
+						Resource: access.Resource,
+						Verb:     verb,
+					},
+				},
+			}
+			result, err := pc.Client.AuthorizationV1().SelfSubjectAccessReviews().Create(review)
+			if err != nil {
+				return nil, err
+			}
+			if !result.Status.Allowed {
+				resource := access.Resource
+				if access.Group != "" {
+					resource = fmt.Sprintf("%s.%s", access.Resource, access.Group)
+				}
+				denied = append(denied, fmt.Sprintf("%s %s", verb, resource))
+			}
+		}
+	}
+	return denied, nil
+}
+
+// String returns a string representation
+func (pc *ProbeCluster) String() string {
+	return fmt.Sprintf("SYNC ProbeCluster %s", pc.KubeConfigPath)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (pc *ProbeCluster) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + pc.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (pc *ProbeCluster) UserString() string {
+	return "Probing the connection to the target cluster"
+}
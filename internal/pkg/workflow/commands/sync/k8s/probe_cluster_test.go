@@ -0,0 +1,89 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	authorizationV1 "k8s.io/api/authorization/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = ginkgo.Describe("The cluster probe", func() {
+
+	ginkgo.It("should classify the connection errors", func() {
+		dnsErr := &url.Error{Op: "Get", URL: "https://api.nalej.tech/version", Err: &net.OpError{
+			Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "api.nalej.tech"}}}
+		gomega.Expect(ConnectionErrorCode(dnsErr)).To(gomega.Equal(errors.K8sDNSFailed))
+		tlsErr := &url.Error{Op: "Get", URL: "https://api.nalej.tech/version", Err: x509.UnknownAuthorityError{}}
+		gomega.Expect(ConnectionErrorCode(tlsErr)).To(gomega.Equal(errors.K8sTLSFailed))
+		forbidden := k8sErrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, "nalej", nil)
+		gomega.Expect(ConnectionErrorCode(forbidden)).To(gomega.Equal(errors.K8sForbidden))
+		refused := &url.Error{Op: "Get", URL: "https://10.0.0.1/version", Err: &net.OpError{Op: "dial", Net: "tcp"}}
+		gomega.Expect(ConnectionErrorCode(refused)).To(gomega.Equal(errors.K8sUnreachable))
+	})
+
+	ginkgo.Context("on a fake cluster", func() {
+
+		var cluster *k8stest.FakeCluster
+
+		allow := func(allowed bool) {
+			cluster.Client.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				review := action.(k8stesting.CreateAction).GetObject().(*authorizationV1.SelfSubjectAccessReview)
+				review.Status.Allowed = allowed || review.Spec.ResourceAttributes.Verb != "create"
+				return true, review, nil
+			})
+		}
+
+		ginkgo.BeforeEach(func() {
+			cluster = newFakeCluster()
+		})
+
+		ginkgo.AfterEach(func() {
+			UnregisterClients(cluster.KubeConfigPath)
+		})
+
+		ginkgo.It("should succeed if the API server is reachable and grants the access", func() {
+			allow(true)
+			result, err := NewProbeCluster(cluster.KubeConfigPath).Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			gomega.Expect(result.Output).To(gomega.ContainSubstring("reachable"))
+		})
+
+		ginkgo.It("should report the denied accesses", func() {
+			allow(false)
+			result, err := NewProbeCluster(cluster.KubeConfigPath).Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeFalse())
+			code, found := errors.CodeOf(result.Output)
+			gomega.Expect(found).To(gomega.BeTrue())
+			gomega.Expect(code).To(gomega.Equal(errors.K8sForbidden))
+			gomega.Expect(result.Output).To(gomega.ContainSubstring("create namespaces"))
+		})
+	})
+})
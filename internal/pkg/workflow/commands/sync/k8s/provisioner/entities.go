@@ -0,0 +1,399 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Storage provisioners
+// Baremetal and minikube clusters may lack a dynamic provisioner, so the persistent volume claims of the components
+// stay pending. A local-path provisioner creating the volumes on a directory of the node running the pod, or an NFS
+// provisioner creating them as subdirectories of a share, is installed with a storage class marked as the default
+// one of the cluster.
+
+package provisioner
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-installer-go"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	rbacV1 "k8s.io/api/rbac/v1"
+	storageV1 "k8s.io/api/storage/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Namespace where the provisioners are installed.
+const Namespace = "storage-provisioner"
+
+// Supported provisioners.
+const (
+	// LocalPathProvisioner creates the volumes on a directory of the node running the pod.
+	LocalPathProvisioner = "local-path"
+	// NFSProvisioner creates the volumes as subdirectories of an NFS share.
+	NFSProvisioner = "nfs"
+)
+
+// Names of the storage classes of the provisioners.
+const (
+	LocalPathStorageClass = "local-path"
+	NFSStorageClass       = "nfs-client"
+)
+
+// DefaultClassAnnotation marks the default storage class of a cluster.
+const DefaultClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+
+// BetaDefaultClassAnnotation marks the default storage class of a cluster on older versions.
+const BetaDefaultClassAnnotation = "storageclass.beta.kubernetes.io/is-default-class"
+
+// DefaultNodePath is the directory of the nodes where the local-path volumes are created if not specified.
+const DefaultNodePath = "/opt/local-path-provisioner"
+
+// DefaultImages of the provisioners.
+var DefaultImages = map[string]string{
+	LocalPathProvisioner: "rancher/local-path-provisioner:v0.0.11",
+	NFSProvisioner:       "quay.io/external_storage/nfs-client-provisioner:v3.1.0-k8s1.11",
+}
+
+// provisionerNames contains the name of the provisioner of each storage class.
+var provisionerNames = map[string]string{
+	LocalPathProvisioner: "rancher.io/local-path",
+	NFSProvisioner:       "nalej.com/nfs",
+}
+
+// SupportedProvisioners returns the names of the supported provisioners.
+func SupportedProvisioners() []string {
+	return []string{LocalPathProvisioner, NFSProvisioner}
+}
+
+// SupportedPlatforms returns the platforms on which a provisioner is installed, as the rest provide one.
+func SupportedPlatforms() []string {
+	return []string{grpc_installer_go.Platform_BAREMETAL.String(), grpc_installer_go.Platform_MINIKUBE.String()}
+}
+
+// Required checks if a platform requires a provisioner to be installed.
+func Required(platformType string) bool {
+	for _, platform := range SupportedPlatforms() {
+		if platform == platformType {
+			return true
+		}
+	}
+	return false
+}
+
+// StorageClassName returns the name of the storage class of a provisioner.
+func StorageClassName(provisioner string) string {
+	if provisioner == NFSProvisioner {
+		return NFSStorageClass
+	}
+	return LocalPathStorageClass
+}
+
+// ParseNFSShare splits an NFS share with the server:/path format.
+//   params:
+//     share The NFS share.
+//   returns:
+//     The server and the exported path.
+//     An error if the share does not have the expected format.
+func ParseNFSShare(share string) (string, string, derrors.Error) {
+	parts := strings.SplitN(share, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || !strings.HasPrefix(parts[1], "/") {
+		return "", "", derrors.NewInvalidArgumentError("NFS share must have the server:/path format").WithParams(share)
+	}
+	return parts[0], parts[1], nil
+}
+
+// IsDefaultClass checks if a storage class is marked as the default one of the cluster.
+func IsDefaultClass(class *storageV1.StorageClass) bool {
+	return class.Annotations[DefaultClassAnnotation] == "true" || class.Annotations[BetaDefaultClassAnnotation] == "true"
+}
+
+// Labels returns the labels of the objects of a provisioner.
+func Labels(provisioner string) map[string]string {
+	return map[string]string{
+		"cluster":   "management",
+		"component": provisioner + "-provisioner",
+	}
+}
+
+// name returns the name of the objects of a provisioner.
+func name(provisioner string) string {
+	return provisioner + "-provisioner"
+}
+
+// NewServiceAccount creates the service account used by a provisioner.
+func NewServiceAccount(provisioner string) *v1.ServiceAccount {
+	return &v1.ServiceAccount{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ServiceAccount",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      name(provisioner),
+			Namespace: Namespace,
+			Labels:    Labels(provisioner),
+		},
+	}
+}
+
+// NewClusterRole creates the role with the permissions required to provision the volumes of the claims. The
+// endpoints are used by the leader election of the NFS provisioner.
+func NewClusterRole(provisioner string) *rbacV1.ClusterRole {
+	return &rbacV1.ClusterRole{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ClusterRole",
+			APIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:   name(provisioner),
+			Labels: Labels(provisioner),
+		},
+		Rules: []rbacV1.PolicyRule{
+			{
+				APIGroups: []string{""},
+				Resources: []string{"persistentvolumes"},
+				Verbs:     []string{"get", "list", "watch", "create", "delete"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"persistentvolumeclaims"},
+				Verbs:     []string{"get", "list", "watch", "update"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"nodes"},
+				Verbs:     []string{"get", "list", "watch"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"pods", "endpoints"},
+				Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"events"},
+				Verbs:     []string{"create", "update", "patch"},
+			},
+			{
+				APIGroups: []string{"storage.k8s.io"},
+				Resources: []string{"storageclasses"},
+				Verbs:     []string{"get", "list", "watch"},
+			},
+		},
+	}
+}
+
+// NewClusterRoleBinding creates the binding of the role of a provisioner to its service account.
+func NewClusterRoleBinding(provisioner string) *rbacV1.ClusterRoleBinding {
+	return &rbacV1.ClusterRoleBinding{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ClusterRoleBinding",
+			APIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:   name(provisioner),
+			Labels: Labels(provisioner),
+		},
+		RoleRef: rbacV1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     name(provisioner),
+		},
+		Subjects: []rbacV1.Subject{{
+			Kind:      "ServiceAccount",
+			Name:      name(provisioner),
+			Namespace: Namespace,
+		}},
+	}
+}
+
+// LocalPathConfig returns the configuration of the local-path provisioner creating the volumes on a directory of
+// every node.
+func LocalPathConfig(nodePath string) (string, derrors.Error) {
+	config := map[string]interface{}{
+		"nodePathMap": []interface{}{
+			map[string]interface{}{
+				"node":  "DEFAULT_PATH_FOR_NON_LISTED_NODES",
+				"paths": []string{nodePath},
+			},
+		},
+	}
+	content, err := json.Marshal(config)
+	if err != nil {
+		return "", derrors.NewInternalError("cannot build local-path configuration", err)
+	}
+	return string(content), nil
+}
+
+// NewLocalPathConfigMap creates the config map with the configuration of the local-path provisioner.
+func NewLocalPathConfigMap(config string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      name(LocalPathProvisioner) + "-config",
+			Namespace: Namespace,
+			Labels:    Labels(LocalPathProvisioner),
+		},
+		Data: map[string]string{"config.json": config},
+	}
+}
+
+// newDeployment creates the deployment of a provisioner. A single replica is launched and replaced on updates.
+func newDeployment(provisioner string, container v1.Container, volumes []v1.Volume) *appsV1.Deployment {
+	replicas := int32(1)
+	labels := Labels(provisioner)
+	return &appsV1.Deployment{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      name(provisioner),
+			Namespace: Namespace,
+			Labels:    labels,
+		},
+		Spec: appsV1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metaV1.LabelSelector{MatchLabels: labels},
+			Strategy: appsV1.DeploymentStrategy{Type: appsV1.RecreateDeploymentStrategyType},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metaV1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					ServiceAccountName: name(provisioner),
+					Containers:         []v1.Container{container},
+					Volumes:            volumes,
+				},
+			},
+		},
+	}
+}
+
+// NewLocalPathDeployment creates the deployment of the local-path provisioner.
+func NewLocalPathDeployment(image string) *appsV1.Deployment {
+	container := v1.Container{
+		Name:            name(LocalPathProvisioner),
+		Image:           image,
+		ImagePullPolicy: v1.PullIfNotPresent,
+		Command:         []string{"local-path-provisioner", "start", "--config", "/etc/config/config.json"},
+		Env: []v1.EnvVar{{
+			Name:      "POD_NAMESPACE",
+			ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.namespace"}},
+		}},
+		VolumeMounts: []v1.VolumeMount{{Name: "config", MountPath: "/etc/config"}},
+	}
+	volumes := []v1.Volume{{
+		Name: "config",
+		VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+			LocalObjectReference: v1.LocalObjectReference{Name: name(LocalPathProvisioner) + "-config"},
+		}},
+	}}
+	return newDeployment(LocalPathProvisioner, container, volumes)
+}
+
+// NewNFSDeployment creates the deployment of the NFS provisioner mounting the share.
+func NewNFSDeployment(image string, server string, path string) *appsV1.Deployment {
+	container := v1.Container{
+		Name:            name(NFSProvisioner),
+		Image:           image,
+		ImagePullPolicy: v1.PullIfNotPresent,
+		Env: []v1.EnvVar{
+			{Name: "PROVISIONER_NAME", Value: provisionerNames[NFSProvisioner]},
+			{Name: "NFS_SERVER", Value: server},
+			{Name: "NFS_PATH", Value: path},
+		},
+		VolumeMounts: []v1.VolumeMount{{Name: "nfs-root", MountPath: "/persistentvolumes"}},
+	}
+	volumes := []v1.Volume{{
+		Name:         "nfs-root",
+		VolumeSource: v1.VolumeSource{NFS: &v1.NFSVolumeSource{Server: server, Path: path}},
+	}}
+	return newDeployment(NFSProvisioner, container, volumes)
+}
+
+// NewStorageClass creates the storage class of a provisioner marked as the default one of the cluster. The
+// local-path volumes are bound once the pod is scheduled so they are created on its node.
+func NewStorageClass(provisioner string) *storageV1.StorageClass {
+	reclaimPolicy := v1.PersistentVolumeReclaimDelete
+	bindingMode := storageV1.VolumeBindingImmediate
+	var parameters map[string]string
+	if provisioner == LocalPathProvisioner {
+		bindingMode = storageV1.VolumeBindingWaitForFirstConsumer
+	} else {
+		parameters = map[string]string{"archiveOnDelete": "false"}
+	}
+	return &storageV1.StorageClass{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "StorageClass",
+			APIVersion: "storage.k8s.io/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        StorageClassName(provisioner),
+			Labels:      Labels(provisioner),
+			Annotations: map[string]string{DefaultClassAnnotation: "true"},
+		},
+		Provisioner:       provisionerNames[provisioner],
+		Parameters:        parameters,
+		ReclaimPolicy:     &reclaimPolicy,
+		VolumeBindingMode: &bindingMode,
+	}
+}
+
+// LocalPathObjects returns the objects of the local-path provisioner.
+//   params:
+//     image The image of the provisioner.
+//     nodePath The directory of the nodes where the volumes are created.
+//   returns:
+//     The objects to be applied.
+//     An error if the configuration cannot be built.
+func LocalPathObjects(image string, nodePath string) ([]runtime.Object, derrors.Error) {
+	config, err := LocalPathConfig(nodePath)
+	if err != nil {
+		return nil, err
+	}
+	return []runtime.Object{
+		NewServiceAccount(LocalPathProvisioner),
+		NewClusterRole(LocalPathProvisioner),
+		NewClusterRoleBinding(LocalPathProvisioner),
+		NewLocalPathConfigMap(config),
+		NewLocalPathDeployment(image),
+		NewStorageClass(LocalPathProvisioner),
+	}, nil
+}
+
+// NFSObjects returns the objects of the NFS provisioner.
+//   params:
+//     image The image of the provisioner.
+//     share The NFS share with the server:/path format.
+//   returns:
+//     The objects to be applied.
+//     An error if the share is not valid.
+func NFSObjects(image string, share string) ([]runtime.Object, derrors.Error) {
+	server, path, err := ParseNFSShare(share)
+	if err != nil {
+		return nil, err
+	}
+	return []runtime.Object{
+		NewServiceAccount(NFSProvisioner),
+		NewClusterRole(NFSProvisioner),
+		NewClusterRoleBinding(NFSProvisioner),
+		NewNFSDeployment(image, server, path),
+		NewStorageClass(NFSProvisioner),
+	}, nil
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provisioner
+
+import (
+	"encoding/json"
+
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	appsV1 "k8s.io/api/apps/v1"
+	storageV1 "k8s.io/api/storage/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = ginkgo.Describe("Storage provisioner", func() {
+
+	ginkgo.Context("entities", func() {
+		ginkgo.It("should parse the NFS shares", func() {
+			server, path, err := ParseNFSShare("nfs.example.com:/exports/nalej")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(server).Should(gomega.Equal("nfs.example.com"))
+			gomega.Expect(path).Should(gomega.Equal("/exports/nalej"))
+			for _, share := range []string{"", "nfs.example.com", ":/exports", "nfs.example.com:exports"} {
+				_, _, err = ParseNFSShare(share)
+				gomega.Expect(err).ShouldNot(gomega.Succeed())
+			}
+		})
+
+		ginkgo.It("should create the local-path volumes on the node path", func() {
+			config, err := LocalPathConfig("/data/volumes")
+			gomega.Expect(err).To(gomega.Succeed())
+			content := make(map[string][]map[string]interface{})
+			gomega.Expect(json.Unmarshal([]byte(config), &content)).To(gomega.Succeed())
+			gomega.Expect(content["nodePathMap"][0]["paths"]).Should(gomega.Equal([]interface{}{"/data/volumes"}))
+			class := NewStorageClass(LocalPathProvisioner)
+			gomega.Expect(*class.VolumeBindingMode).Should(gomega.Equal(storageV1.VolumeBindingWaitForFirstConsumer))
+			gomega.Expect(IsDefaultClass(class)).Should(gomega.BeTrue())
+		})
+
+		ginkgo.It("should mount the NFS share on the provisioner", func() {
+			objects, err := NFSObjects(DefaultImages[NFSProvisioner], "nfs.example.com:/exports")
+			gomega.Expect(err).To(gomega.Succeed())
+			deployment := objects[3].(*appsV1.Deployment)
+			nfs := deployment.Spec.Template.Spec.Volumes[0].NFS
+			gomega.Expect(nfs.Server).Should(gomega.Equal("nfs.example.com"))
+			gomega.Expect(nfs.Path).Should(gomega.Equal("/exports"))
+			gomega.Expect(objects[4].(*storageV1.StorageClass).Provisioner).Should(gomega.Equal(provisionerNames[NFSProvisioner]))
+		})
+	})
+
+	ginkgo.Context("install command", func() {
+		var cluster *k8stest.FakeCluster
+
+		ginkgo.BeforeEach(func() {
+			cluster = k8stest.NewFakeCluster()
+			cluster.AddResource(k8stest.Resource{GroupVersion: "storage.k8s.io/v1", Name: "storageclasses", Kind: "StorageClass"})
+			k8s.RegisterClients(cluster.KubeConfigPath, cluster.Client, cluster.Discovery, cluster.Dynamic)
+		})
+
+		ginkgo.AfterEach(func() {
+			k8s.UnregisterClients(cluster.KubeConfigPath)
+		})
+
+		ginkgo.It("should apply the default values when read from JSON", func() {
+			raw := []byte(`{"type":"sync", "name":"installStorageProvisioner", "kubeConfigPath":"/tmp/kc",
+				"provisioner":"local-path", "platform_type":"BAREMETAL"}`)
+			cmd, err := NewInstallStorageProvisionerFromJSON(raw)
+			gomega.Expect(err).To(gomega.Succeed())
+			isp := (*cmd).(*InstallStorageProvisioner)
+			gomega.Expect(isp.NodePath).Should(gomega.Equal(DefaultNodePath))
+			gomega.Expect(isp.image()).Should(gomega.Equal(DefaultImages[LocalPathProvisioner]))
+		})
+
+		ginkgo.It("should install the local-path provisioner as the default class", func() {
+			cmd := NewInstallStorageProvisioner(cluster.KubeConfigPath, LocalPathProvisioner, grpc_installer_go.Platform_BAREMETAL.String())
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			cluster.ExpectObject("apps/v1", "Deployment", Namespace, "local-path-provisioner")
+			cluster.ExpectObject("v1", "ConfigMap", Namespace, "local-path-provisioner-config")
+			class := cluster.ExpectObject("storage.k8s.io/v1", "StorageClass", "", LocalPathStorageClass)
+			gomega.Expect(class.GetAnnotations()).Should(gomega.HaveKeyWithValue(DefaultClassAnnotation, "true"))
+		})
+
+		ginkgo.It("should not install the provisioner if the cluster has a default class", func() {
+			existing := &storageV1.StorageClass{ObjectMeta: metaV1.ObjectMeta{
+				Name:        "standard",
+				Annotations: map[string]string{BetaDefaultClassAnnotation: "true"},
+			}}
+			gomega.Expect(cluster.Tracker.Add(existing)).To(gomega.Succeed())
+			cmd := NewInstallStorageProvisioner(cluster.KubeConfigPath, LocalPathProvisioner, grpc_installer_go.Platform_MINIKUBE.String())
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			gomega.Expect(result.Output).Should(gomega.ContainSubstring("standard"))
+			cluster.ExpectNoObject("apps/v1", "Deployment", Namespace, "local-path-provisioner")
+		})
+
+		ginkgo.It("should not install the provisioner on platforms providing one", func() {
+			cmd := NewInstallStorageProvisioner(cluster.KubeConfigPath, LocalPathProvisioner, grpc_installer_go.Platform_AZURE.String())
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			cluster.ExpectNoObject("v1", "Namespace", "", Namespace)
+		})
+
+		ginkgo.It("should reject an NFS provisioner without a share", func() {
+			cmd := NewInstallStorageProvisioner(cluster.KubeConfigPath, NFSProvisioner, grpc_installer_go.Platform_BAREMETAL.String())
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeFalse())
+		})
+	})
+})
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// InstallStorageProvisioner structure with the attributes required to install a dynamic provisioner of persistent
+// volumes on the platforms that do not provide one.
+type InstallStorageProvisioner struct {
+	k8s.Kubernetes
+	// Provisioner with the name of the provisioner: local-path or nfs.
+	Provisioner string `json:"provisioner"`
+	// PlatformType with the platform where the cluster runs. The provisioner is only installed on the
+	// SupportedPlatforms.
+	PlatformType string `json:"platform_type"`
+	// NodePath with the directory of the nodes where the local-path volumes are created, DefaultNodePath if not set.
+	NodePath string `json:"node_path"`
+	// NFSShare with the share of the NFS volumes with the server:/path format.
+	NFSShare string `json:"nfs_share"`
+	// Image of the provisioner, the one of DefaultImages if not set.
+	Image string `json:"image"`
+}
+
+// NewInstallStorageProvisioner creates a new InstallStorageProvisioner command.
+func NewInstallStorageProvisioner(kubeConfigPath string, provisioner string, platformType string) *InstallStorageProvisioner {
+	return &InstallStorageProvisioner{
+		Kubernetes: k8s.Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.InstallStorageProvisioner),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Provisioner:  provisioner,
+		PlatformType: platformType,
+		NodePath:     DefaultNodePath,
+	}
+}
+
+// NewInstallStorageProvisionerFromJSON creates a new InstallStorageProvisioner command from a raw JSON
+// representation.
+func NewInstallStorageProvisionerFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	isp := &InstallStorageProvisioner{}
+	if err := json.Unmarshal(raw, &isp); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	if isp.NodePath == "" {
+		isp.NodePath = DefaultNodePath
+	}
+	isp.CommandID = entities.GenerateCommandID(isp.Name())
+	var r entities.Command = isp
+	return &r, nil
+}
+
+// image returns the image of the provisioner.
+func (isp *InstallStorageProvisioner) image() string {
+	if isp.Image != "" {
+		return isp.Image
+	}
+	return DefaultImages[isp.Provisioner]
+}
+
+// Objects returns the objects of the selected provisioner.
+//   returns:
+//     The objects to be applied.
+//     An error if the provisioner or its configuration are not valid.
+func (isp *InstallStorageProvisioner) Objects() ([]runtime.Object, derrors.Error) {
+	switch isp.Provisioner {
+	case LocalPathProvisioner:
+		if !strings.HasPrefix(isp.NodePath, "/") {
+			return nil, derrors.NewInvalidArgumentError("node_path must be an absolute path").WithParams(isp.NodePath)
+		}
+		return LocalPathObjects(isp.image(), isp.NodePath)
+	case NFSProvisioner:
+		return NFSObjects(isp.image(), isp.NFSShare)
+	}
+	return nil, derrors.NewInvalidArgumentError("unsupported storage provisioner").WithParams(isp.Provisioner, SupportedProvisioners())
+}
+
+// DefaultStorageClass returns the name of the default storage class of the cluster, empty if there is none.
+func (isp *InstallStorageProvisioner) DefaultStorageClass() (string, derrors.Error) {
+	classes, err := isp.Client.StorageV1().StorageClasses().List(metaV1.ListOptions{})
+	if err != nil {
+		return "", k8s.AsQueryError(err, "cannot list storage classes")
+	}
+	for _, class := range classes.Items {
+		if IsDefaultClass(&class) {
+			return class.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// Run the current command returning the result or an error.
+func (isp *InstallStorageProvisioner) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	if !Required(isp.PlatformType) {
+		msg := fmt.Sprintf("storage provisioner not required on %s", isp.PlatformType)
+		return entities.NewSuccessCommand([]byte(msg)), nil
+	}
+	objects, err := isp.Objects()
+	if err != nil {
+		return entities.NewCommandResult(false, "invalid storage provisioner configuration", err), nil
+	}
+	connectErr := isp.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	// The provisioner is kept up to date on later installs, while clusters with another default class are left
+	// untouched.
+	defaultClass, err := isp.DefaultStorageClass()
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot check the default storage class", err), nil
+	}
+	if defaultClass != "" && defaultClass != StorageClassName(isp.Provisioner) {
+		msg := fmt.Sprintf("storage provisioner not installed as %s is the default storage class", defaultClass)
+		return entities.NewSuccessCommand([]byte(msg)), nil
+	}
+	if err := isp.EnsureNamespace(Namespace, k8s.NamespaceOptions{}); err != nil {
+		return entities.NewCommandResult(false, "cannot create namespace", err), nil
+	}
+	summary := &k8s.ApplySummary{}
+	for _, obj := range objects {
+		if err := isp.Apply(obj, k8s.ApplyOptions{}, summary); err != nil {
+			return entities.NewCommandResult(false, "cannot apply storage provisioner object", err), nil
+		}
+	}
+	msg := fmt.Sprintf("%s provisioner installed with default storage class %s", isp.Provisioner, StorageClassName(isp.Provisioner))
+	return entities.NewSuccessCommand([]byte(msg)).WithObjects(summary.Applied()), nil
+}
+
+// String returns a string representation
+func (isp *InstallStorageProvisioner) String() string {
+	return fmt.Sprintf("SYNC InstallStorageProvisioner %s on %s", isp.Provisioner, isp.PlatformType)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (isp *InstallStorageProvisioner) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + isp.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (isp *InstallStorageProvisioner) UserString() string {
+	return fmt.Sprintf("Installing %s storage provisioner", isp.Provisioner)
+}
@@ -0,0 +1,274 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// InstallIDLabel identifies the install that applied a component.
+const InstallIDLabel = "installer.nalej.com/install-id"
+
+// PruneAnnotation set to false protects an object from being pruned.
+const PruneAnnotation = "installer.nalej.com/prune"
+
+// InventoryConfigMap is the name of the config map with the kinds applied by each install.
+const InventoryConfigMap = "installer-inventory"
+
+// DefaultProtectedKinds contains the kinds that are never pruned as removing them would delete data.
+var DefaultProtectedKinds = []string{"Namespace", "CustomResourceDefinition", "PersistentVolume", "PersistentVolumeClaim"}
+
+// ObjectReference identifies an applied object.
+type ObjectReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name,omitempty"`
+}
+
+// NewObjectReference creates the reference of an object.
+func NewObjectReference(obj *unstructured.Unstructured) ObjectReference {
+	return ObjectReference{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+	}
+}
+
+// Key identifies the object regardless of its group version, as it may be adapted to a different one on each
+// install.
+func (or ObjectReference) Key() string {
+	return fmt.Sprintf("%s/%s/%s", or.Kind, or.Namespace, or.Name)
+}
+
+// TypeKey identifies the group version kind of the object.
+func (or ObjectReference) TypeKey() string {
+	return fmt.Sprintf("%s/%s", or.APIVersion, or.Kind)
+}
+
+// InventoryKinds returns the kinds of a set of references, sorted and without duplicates.
+func InventoryKinds(refs ...[]ObjectReference) []ObjectReference {
+	kinds := make(map[string]ObjectReference, 0)
+	for _, list := range refs {
+		for _, ref := range list {
+			kind := ObjectReference{APIVersion: ref.APIVersion, Kind: ref.Kind}
+			kinds[kind.TypeKey()] = kind
+		}
+	}
+	result := make([]ObjectReference, 0, len(kinds))
+	for _, kind := range kinds {
+		result = append(result, kind)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TypeKey() < result[j].TypeKey()
+	})
+	return result
+}
+
+// sanitize replaces the characters that cannot be part of a label value or a config map key.
+func sanitize(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, value)
+}
+
+// InstallIDLabelValue returns the value of the InstallIDLabel for an install.
+func InstallIDLabelValue(installID string) string {
+	value := sanitize(installID)
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return strings.Trim(value, "-._")
+}
+
+// inventoryKey returns the key of the inventory config map with the kinds applied by an install.
+func inventoryKey(installID string) string {
+	return sanitize(installID)
+}
+
+// LoadInventory returns the kinds applied by previous installs.
+//   params:
+//     installID The identifier of the install.
+//   returns:
+//     The kinds of the objects applied by the install, empty if none was recorded.
+//     An error if the inventory cannot be read.
+func (k *Kubernetes) LoadInventory(installID string) ([]ObjectReference, derrors.Error) {
+	cm, err := k.Client.CoreV1().ConfigMaps(TargetNamespace).Get(InventoryConfigMap, metaV1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, derrors.NewInternalError("cannot retrieve components inventory", err)
+	}
+	content, found := cm.Data[inventoryKey(installID)]
+	if !found {
+		return nil, nil
+	}
+	result := make([]ObjectReference, 0)
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return nil, derrors.NewInternalError("cannot parse components inventory", err).WithParams(installID)
+	}
+	return result, nil
+}
+
+// SaveInventory records the kinds applied by an install.
+//   params:
+//     installID The identifier of the install.
+//     kinds The kinds of the objects applied by the install.
+//   returns:
+//     An error if the inventory cannot be written.
+func (k *Kubernetes) SaveInventory(installID string, kinds []ObjectReference) derrors.Error {
+	content, err := json.Marshal(kinds)
+	if err != nil {
+		return derrors.NewInternalError("cannot marshal components inventory", err)
+	}
+	client := k.Client.CoreV1().ConfigMaps(TargetNamespace)
+	cm, err := client.Get(InventoryConfigMap, metaV1.GetOptions{})
+	if err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			return derrors.NewInternalError("cannot retrieve components inventory", err)
+		}
+		cm = &v1.ConfigMap{
+			ObjectMeta: metaV1.ObjectMeta{Name: InventoryConfigMap, Namespace: TargetNamespace},
+			Data:       map[string]string{inventoryKey(installID): string(content)},
+		}
+		if _, err := client.Create(cm); err != nil {
+			return derrors.NewInternalError("cannot create components inventory", err)
+		}
+		return nil
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string, 0)
+	}
+	cm.Data[inventoryKey(installID)] = string(content)
+	if _, err := client.Update(cm); err != nil {
+		return derrors.NewInternalError("cannot update components inventory", err)
+	}
+	return nil
+}
+
+// Prunable checks if an object labeled with the install that is no longer applied must be removed.
+//   params:
+//     obj The object labeled with the install.
+//     applied The keys of the objects applied by the install.
+//     protected The kinds that must not be pruned.
+//   returns:
+//     Whether the object can be removed.
+func Prunable(obj *unstructured.Unstructured, applied map[string]bool, protected []string) bool {
+	if applied[NewObjectReference(obj).Key()] {
+		return false
+	}
+	if contains(protected, obj.GetKind()) {
+		return false
+	}
+	if strings.EqualFold(obj.GetAnnotations()[PruneAnnotation], "false") {
+		return false
+	}
+	// Objects owned by others are removed along with their owner.
+	return len(obj.GetOwnerReferences()) == 0
+}
+
+// PruneObjects removes the objects labeled with an install that are not part of the applied ones.
+//   params:
+//     installID The identifier of the install.
+//     kinds The kinds of the objects applied by the current and the previous installs.
+//     applied The objects applied by the current install.
+//     protected The kinds that must not be pruned.
+//   returns:
+//     The number of removed objects.
+//     An error if the objects cannot be listed or removed.
+func (k *Kubernetes) PruneObjects(installID string, kinds []ObjectReference, applied []ObjectReference, protected []string) (int, derrors.Error) {
+	propagation := metaV1.DeletePropagationBackground
+	pruned := 0
+	err := k.eachPrunable(installID, kinds, applied, protected, func(client dynamic.NamespaceableResourceInterface, item *unstructured.Unstructured) derrors.Error {
+		var dErr error
+		if item.GetNamespace() != "" {
+			dErr = client.Namespace(item.GetNamespace()).Delete(item.GetName(), &metaV1.DeleteOptions{PropagationPolicy: &propagation})
+		} else {
+			dErr = client.Delete(item.GetName(), &metaV1.DeleteOptions{PropagationPolicy: &propagation})
+		}
+		if dErr != nil && !k8sErrors.IsNotFound(dErr) {
+			return derrors.NewInternalError("cannot prune object", dErr).WithParams(item.GetKind(), item.GetNamespace(), item.GetName())
+		}
+		log.Info().Str("kind", item.GetKind()).Str("namespace", item.GetNamespace()).Str("name", item.GetName()).Msg("pruned")
+		pruned++
+		return nil
+	})
+	return pruned, err
+}
+
+// ListPrunable returns the objects labeled with an install that would be removed by PruneObjects.
+func (k *Kubernetes) ListPrunable(installID string, kinds []ObjectReference, applied []ObjectReference, protected []string) ([]ObjectReference, derrors.Error) {
+	result := make([]ObjectReference, 0)
+	err := k.eachPrunable(installID, kinds, applied, protected, func(_ dynamic.NamespaceableResourceInterface, item *unstructured.Unstructured) derrors.Error {
+		result = append(result, NewObjectReference(item))
+		return nil
+	})
+	return result, err
+}
+
+// eachPrunable calls a function with each object labeled with an install that is not part of the applied ones,
+// along with the client of its kind.
+func (k *Kubernetes) eachPrunable(installID string, kinds []ObjectReference, applied []ObjectReference, protected []string,
+	fn func(client dynamic.NamespaceableResourceInterface, item *unstructured.Unstructured) derrors.Error) derrors.Error {
+	appliedKeys := make(map[string]bool, len(applied))
+	for _, ref := range applied {
+		appliedKeys[ref.Key()] = true
+	}
+	selector := metaV1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", InstallIDLabel, InstallIDLabelValue(installID))}
+	for _, kind := range kinds {
+		if contains(protected, kind.Kind) {
+			continue
+		}
+		gvk := schema.FromAPIVersionAndKind(kind.APIVersion, kind.Kind)
+		mapping, err := k.clients.restMapping(gvk)
+		if err != nil {
+			log.Warn().Str("kind", kind.TypeKey()).Msg("kind no longer served, skipping prune")
+			continue
+		}
+		client := k.dynClient.Resource(mapping.Resource)
+		list, lErr := client.List(selector)
+		if lErr != nil {
+			return derrors.NewInternalError("cannot list objects to prune", lErr).WithParams(kind.TypeKey())
+		}
+		for i := range list.Items {
+			if !Prunable(&list.Items[i], appliedKeys, protected) {
+				continue
+			}
+			if err := fn(client, &list.Items[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package k8s
+
+import (
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestObject(apiVersion string, kind string, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace("nalej")
+	obj.SetName(name)
+	return obj
+}
+
+var _ = ginkgo.Describe("Prune components", func() {
+
+	ginkgo.It("should merge the kinds of the inventory", func() {
+		previous := []ObjectReference{{APIVersion: "v1", Kind: "Service"}, {APIVersion: "apps/v1", Kind: "Deployment"}}
+		applied := []ObjectReference{
+			NewObjectReference(newTestObject("v1", "Service", "a")),
+			NewObjectReference(newTestObject("v1", "ConfigMap", "b")),
+		}
+		kinds := InventoryKinds(previous, applied)
+		gomega.Expect(kinds).To(gomega.Equal([]ObjectReference{
+			{APIVersion: "apps/v1", Kind: "Deployment"},
+			{APIVersion: "v1", Kind: "ConfigMap"},
+			{APIVersion: "v1", Kind: "Service"},
+		}))
+	})
+
+	ginkgo.It("should only prune objects no longer applied", func() {
+		applied := map[string]bool{NewObjectReference(newTestObject("apps/v1", "Deployment", "current")).Key(): true}
+		// The group version of the object may have been adapted on a previous install.
+		gomega.Expect(Prunable(newTestObject("extensions/v1beta1", "Deployment", "current"), applied, DefaultProtectedKinds)).To(gomega.BeFalse())
+		gomega.Expect(Prunable(newTestObject("apps/v1", "Deployment", "renamed"), applied, DefaultProtectedKinds)).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should not prune protected objects", func() {
+		applied := map[string]bool{}
+		gomega.Expect(Prunable(newTestObject("v1", "PersistentVolumeClaim", "data"), applied, DefaultProtectedKinds)).To(gomega.BeFalse())
+		annotated := newTestObject("v1", "ConfigMap", "settings")
+		annotated.SetAnnotations(map[string]string{PruneAnnotation: "false"})
+		gomega.Expect(Prunable(annotated, applied, DefaultProtectedKinds)).To(gomega.BeFalse())
+		owned := newTestObject("apps/v1", "ReplicaSet", "owned")
+		owned.SetOwnerReferences([]metaV1.OwnerReference{{Kind: "Deployment", Name: "removed"}})
+		gomega.Expect(Prunable(owned, applied, DefaultProtectedKinds)).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should build valid install ID label values", func() {
+		gomega.Expect(InstallIDLabelValue("nalej-management-cluster")).To(gomega.Equal("nalej-management-cluster"))
+		gomega.Expect(InstallIDLabelValue("org/cluster id")).To(gomega.Equal("org_cluster_id"))
+		gomega.Expect(len(InstallIDLabelValue(strings.Repeat("a", 100)))).To(gomega.Equal(63))
+	})
+})
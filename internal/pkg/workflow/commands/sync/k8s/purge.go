@@ -0,0 +1,316 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the removal of every object of a set of namespaces or matching a label selector, including the
+// instances of custom resources, used by the uninstall workflows and the purge command of the CLI.
+
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+// SystemNamespaces contains the namespaces that are never purged.
+var SystemNamespaces = []string{"default", "kube-system", "kube-public", "kube-node-lease"}
+
+// removeFinalizersPatch clears the finalizers of an object.
+const removeFinalizersPatch = `{"metadata":{"finalizers":null}}`
+
+// PurgeOptions with the objects to be purged.
+type PurgeOptions struct {
+	// Namespaces whose objects are purged. If a selector is set, only the objects matching it are purged, and the
+	// namespaces are kept unless they match it too. If empty, the objects matching the selector are purged from every
+	// namespace along with the cluster scoped ones.
+	Namespaces []string
+	// Selector with the labels of the objects to be purged.
+	Selector string
+	// DryRun lists the objects that would be purged without removing them.
+	DryRun bool
+	// RemoveFinalizers clears the finalizers of the objects that remain after being deleted, such as the custom
+	// resources whose controller has been removed.
+	RemoveFinalizers bool
+}
+
+// PurgeReport with the objects purged, or to be purged in a dry run.
+type PurgeReport struct {
+	DryRun bool `json:"dry_run"`
+	// Objects deleted in the order they were deleted.
+	Objects []ObjectReference `json:"objects"`
+	// Finalized contains the objects whose finalizers were removed.
+	Finalized []ObjectReference `json:"finalized,omitempty"`
+}
+
+// String returns one line per purged object.
+func (pr *PurgeReport) String() string {
+	action := "deleted"
+	if pr.DryRun {
+		action = "would be deleted"
+	}
+	lines := make([]string, 0, len(pr.Objects)+1)
+	lines = append(lines, fmt.Sprintf("%d objects %s", len(pr.Objects), action))
+	for _, obj := range pr.Objects {
+		lines = append(lines, fmt.Sprintf("%s %s", action, purgeName(obj)))
+	}
+	for _, obj := range pr.Finalized {
+		lines = append(lines, fmt.Sprintf("finalizers removed from %s", purgeName(obj)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// purgeName returns the kind, namespace and name of a purged object.
+func purgeName(obj ObjectReference) string {
+	if obj.Namespace == "" {
+		return fmt.Sprintf("%s %s", obj.Kind, obj.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", obj.Kind, obj.Namespace, obj.Name)
+}
+
+// purgeResource with a resource served by the cluster that can be listed and deleted.
+type purgeResource struct {
+	schema.GroupVersionResource
+	Kind       string
+	Namespaced bool
+}
+
+// purgeableResources returns the resources that can be purged, with the instances of the custom resources first,
+// then the rest of the namespaced resources, the cluster scoped ones, the custom resource definitions and finally
+// the namespaces, so the custom resources are removed while their definitions exist.
+func (k *Kubernetes) purgeableResources() ([]purgeResource, derrors.Error) {
+	lists, err := k.discoveryClient.ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, derrors.NewInternalError("cannot discover the resources of the cluster", err)
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("some groups cannot be discovered, their objects are not purged")
+	}
+	customGroups, cErr := k.customResourceGroups()
+	if cErr != nil {
+		return nil, cErr
+	}
+	resources := make([]purgeResource, 0)
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, resource := range list.APIResources {
+			// Subresources such as pods/log cannot be purged.
+			if strings.Contains(resource.Name, "/") {
+				continue
+			}
+			if !contains(resource.Verbs, "list") || !contains(resource.Verbs, "delete") {
+				continue
+			}
+			resources = append(resources, purgeResource{
+				GroupVersionResource: gv.WithResource(resource.Name),
+				Kind:                 resource.Kind,
+				Namespaced:           resource.Namespaced,
+			})
+		}
+	}
+	order := func(r purgeResource) int {
+		switch {
+		case r.Kind == "Namespace":
+			return 4
+		case r.Kind == "CustomResourceDefinition":
+			return 3
+		case !r.Namespaced:
+			return 2
+		case customGroups[r.Group]:
+			return 0
+		}
+		return 1
+	}
+	sort.SliceStable(resources, func(i, j int) bool {
+		if order(resources[i]) != order(resources[j]) {
+			return order(resources[i]) < order(resources[j])
+		}
+		return resources[i].String() < resources[j].String()
+	})
+	return resources, nil
+}
+
+// customResourceGroups returns the groups of the custom resource definitions of the cluster.
+func (k *Kubernetes) customResourceGroups() (map[string]bool, derrors.Error) {
+	groups := make(map[string]bool, 0)
+	for _, version := range []string{"v1", "v1beta1"} {
+		crds := schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: version, Resource: "customresourcedefinitions"}
+		list, err := k.dynClient.Resource(crds).List(metaV1.ListOptions{})
+		if err != nil {
+			if k8sErrors.IsNotFound(err) {
+				continue
+			}
+			return nil, derrors.NewInternalError("cannot list custom resource definitions", err)
+		}
+		for _, crd := range list.Items {
+			if group, found, _ := unstructured.NestedString(crd.Object, "spec", "group"); found {
+				groups[group] = true
+			}
+		}
+		return groups, nil
+	}
+	return groups, nil
+}
+
+// Purge removes the objects of a set of namespaces or matching a label selector.
+//   params:
+//     options The objects to be purged.
+//   returns:
+//     The report with the purged objects.
+//     An error if the objects cannot be listed or removed.
+func (k *Kubernetes) Purge(options PurgeOptions) (*PurgeReport, derrors.Error) {
+	if len(options.Namespaces) == 0 && options.Selector == "" {
+		return nil, derrors.NewInvalidArgumentError("namespaces or selector must be set to purge")
+	}
+	for _, namespace := range options.Namespaces {
+		if contains(SystemNamespaces, namespace) {
+			return nil, derrors.NewInvalidArgumentError("system namespaces cannot be purged").WithParams(namespace)
+		}
+		if IsRancherNamespace(namespace) {
+			return nil, derrors.NewInvalidArgumentError("namespaces managed by Rancher cannot be purged").WithParams(namespace)
+		}
+	}
+	resources, err := k.purgeableResources()
+	if err != nil {
+		return nil, err
+	}
+	report := &PurgeReport{DryRun: options.DryRun, Objects: make([]ObjectReference, 0)}
+	for _, resource := range resources {
+		client := k.dynClient.Resource(resource.GroupVersionResource)
+		items, err := k.purgeCandidates(client, resource, options)
+		if err != nil {
+			return report, err
+		}
+		for i := range items {
+			item := &items[i]
+			if resource.Kind == "Namespace" && contains(SystemNamespaces, item.GetName()) {
+				continue
+			}
+			if _, found := RancherNamespaceObject(item); found {
+				// The objects of Rancher matching the selector are left to it.
+				continue
+			}
+			ref := NewObjectReference(item)
+			report.Objects = append(report.Objects, ref)
+			if options.DryRun {
+				continue
+			}
+			finalized, err := k.purgeObject(client, item, options.RemoveFinalizers)
+			if err != nil {
+				return report, err
+			}
+			if finalized {
+				report.Finalized = append(report.Finalized, ref)
+			}
+		}
+	}
+	return report, nil
+}
+
+// purgeCandidates returns the objects of a resource to be purged.
+func (k *Kubernetes) purgeCandidates(client dynamic.NamespaceableResourceInterface, resource purgeResource, options PurgeOptions) ([]unstructured.Unstructured, derrors.Error) {
+	listOptions := metaV1.ListOptions{LabelSelector: options.Selector}
+	switch {
+	case resource.Kind == "Namespace":
+		return k.purgeNamespaces(client, options)
+	case resource.Namespaced && len(options.Namespaces) > 0:
+		items := make([]unstructured.Unstructured, 0)
+		for _, namespace := range options.Namespaces {
+			list, err := client.Namespace(namespace).List(listOptions)
+			if err != nil {
+				return nil, derrors.NewInternalError("cannot list objects to purge", err).WithParams(resource.String(), namespace)
+			}
+			items = append(items, list.Items...)
+		}
+		return items, nil
+	case len(options.Namespaces) == 0:
+		list, err := client.List(listOptions)
+		if err != nil {
+			return nil, derrors.NewInternalError("cannot list objects to purge", err).WithParams(resource.String())
+		}
+		return list.Items, nil
+	}
+	// The cluster scoped objects are only purged by selector.
+	return nil, nil
+}
+
+// purgeNamespaces returns the namespaces to be purged: the ones of the options that exist and match the selector,
+// or every namespace matching the selector if none is given.
+func (k *Kubernetes) purgeNamespaces(client dynamic.NamespaceableResourceInterface, options PurgeOptions) ([]unstructured.Unstructured, derrors.Error) {
+	list, err := client.List(metaV1.ListOptions{LabelSelector: options.Selector})
+	if err != nil {
+		return nil, derrors.NewInternalError("cannot list namespaces to purge", err)
+	}
+	if len(options.Namespaces) == 0 {
+		return list.Items, nil
+	}
+	result := make([]unstructured.Unstructured, 0, len(options.Namespaces))
+	for _, item := range list.Items {
+		if contains(options.Namespaces, item.GetName()) {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// purgeObject deletes an object, removing its finalizers if it remains after the deletion and they must be
+// removed. It returns whether the finalizers were removed.
+func (k *Kubernetes) purgeObject(client dynamic.NamespaceableResourceInterface, item *unstructured.Unstructured, removeFinalizers bool) (bool, derrors.Error) {
+	var target dynamic.ResourceInterface = client
+	if item.GetNamespace() != "" {
+		target = client.Namespace(item.GetNamespace())
+	}
+	propagation := metaV1.DeletePropagationBackground
+	if err := target.Delete(item.GetName(), &metaV1.DeleteOptions{PropagationPolicy: &propagation}); err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, derrors.NewInternalError("cannot purge object", err).WithParams(item.GetKind(), item.GetNamespace(), item.GetName())
+	}
+	log.Info().Str("kind", item.GetKind()).Str("namespace", item.GetNamespace()).Str("name", item.GetName()).Msg("purged")
+	if !removeFinalizers {
+		return false, nil
+	}
+	remaining, err := target.Get(item.GetName(), metaV1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, derrors.NewInternalError("cannot check purged object", err).WithParams(item.GetKind(), item.GetNamespace(), item.GetName())
+	}
+	if len(remaining.GetFinalizers()) == 0 {
+		return false, nil
+	}
+	if _, err := target.Patch(item.GetName(), types.MergePatchType, []byte(removeFinalizersPatch), metaV1.PatchOptions{}); err != nil && !k8sErrors.IsNotFound(err) {
+		return false, derrors.NewInternalError("cannot remove finalizers", err).WithParams(item.GetKind(), item.GetNamespace(), item.GetName())
+	}
+	log.Info().Str("kind", item.GetKind()).Str("namespace", item.GetNamespace()).Str("name", item.GetName()).
+		Strs("finalizers", remaining.GetFinalizers()).Msg("finalizers removed")
+	return true, nil
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Purge by label command
+// Removes every object matching a label selector, starting with the custom resources and finishing with their
+// definitions and the namespaces. If namespaces are given, only their objects are removed.
+//
+// {"type":"sync", "name":"purgeByLabel", "kubeConfigPath":"/path/kubeconfig.yaml",
+// "selector":"app.kubernetes.io/managed-by=nalej-installer", "namespaces":[], "dry_run":false,
+// "remove_finalizers":false}
+
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// PurgeByLabel structure with the label selector of the objects to be purged.
+type PurgeByLabel struct {
+	// Kubernetes embedded object
+	Kubernetes
+	// Selector with the labels of the objects to be purged.
+	Selector string `json:"selector"`
+	// Namespaces restricting the purge to their objects. If empty, every namespace and the cluster scoped objects
+	// are purged.
+	Namespaces []string `json:"namespaces"`
+	// DryRun lists the objects that would be removed without removing them.
+	DryRun bool `json:"dry_run"`
+	// RemoveFinalizers clears the finalizers of the objects that remain after being deleted.
+	RemoveFinalizers bool `json:"remove_finalizers"`
+}
+
+// NewPurgeByLabel creates a new PurgeByLabel command.
+func NewPurgeByLabel(kubeConfigPath string, selector string) *PurgeByLabel {
+	return &PurgeByLabel{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.PurgeByLabel),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Selector: selector,
+	}
+}
+
+// NewPurgeByLabelFromJSON creates a new PurgeByLabel command from a raw JSON representation.
+func NewPurgeByLabelFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	pl := &PurgeByLabel{}
+	if err := json.Unmarshal(raw, &pl); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	pl.CommandID = entities.GenerateCommandID(pl.Name())
+	var r entities.Command = pl
+	return &r, nil
+}
+
+// Report purges the objects matching the selector returning the removed ones.
+func (pl *PurgeByLabel) Report() (*PurgeReport, derrors.Error) {
+	selector, err := labels.Parse(pl.Selector)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("invalid label selector", err).WithParams(pl.Selector)
+	}
+	// An empty selector matches every object.
+	if selector.Empty() {
+		return nil, derrors.NewInvalidArgumentError("selector must be set to purge")
+	}
+	if err := pl.Connect(); err != nil {
+		return nil, err
+	}
+	return pl.Purge(PurgeOptions{Namespaces: pl.Namespaces, Selector: pl.Selector, DryRun: pl.DryRun,
+		RemoveFinalizers: pl.RemoveFinalizers})
+}
+
+// Run the current command returning the result or an error.
+func (pl *PurgeByLabel) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	report, err := pl.Report()
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot purge objects", err), nil
+	}
+	return entities.NewSuccessCommand([]byte(report.String())), nil
+}
+
+// String returns a string representation
+func (pl *PurgeByLabel) String() string {
+	return fmt.Sprintf("SYNC PurgeByLabel %s", pl.Selector)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (pl *PurgeByLabel) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + pl.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (pl *PurgeByLabel) UserString() string {
+	return fmt.Sprintf("Purging objects labeled %s", pl.Selector)
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Purge namespace command
+// Removes every object of a set of namespaces, starting with the custom resources, and then the namespaces.
+//
+// {"type":"sync", "name":"purgeNamespace", "kubeConfigPath":"/path/kubeconfig.yaml", "namespaces":["nalej"],
+// "dry_run":false, "remove_finalizers":true}
+
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+)
+
+// PurgeNamespace structure with the namespaces to be purged.
+type PurgeNamespace struct {
+	// Kubernetes embedded object
+	Kubernetes
+	// Namespaces to be purged.
+	Namespaces []string `json:"namespaces"`
+	// DryRun lists the objects that would be removed without removing them.
+	DryRun bool `json:"dry_run"`
+	// RemoveFinalizers clears the finalizers of the objects that remain after being deleted.
+	RemoveFinalizers bool `json:"remove_finalizers"`
+}
+
+// NewPurgeNamespace creates a new PurgeNamespace command.
+func NewPurgeNamespace(kubeConfigPath string, namespaces ...string) *PurgeNamespace {
+	return &PurgeNamespace{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.PurgeNamespace),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Namespaces: namespaces,
+	}
+}
+
+// NewPurgeNamespaceFromJSON creates a new PurgeNamespace command from a raw JSON representation.
+func NewPurgeNamespaceFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	pn := &PurgeNamespace{}
+	if err := json.Unmarshal(raw, &pn); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	pn.CommandID = entities.GenerateCommandID(pn.Name())
+	var r entities.Command = pn
+	return &r, nil
+}
+
+// Report purges the namespaces returning the removed objects.
+func (pn *PurgeNamespace) Report() (*PurgeReport, derrors.Error) {
+	if len(pn.Namespaces) == 0 {
+		return nil, derrors.NewInvalidArgumentError("namespaces must be set to purge")
+	}
+	if err := pn.Connect(); err != nil {
+		return nil, err
+	}
+	return pn.Purge(PurgeOptions{Namespaces: pn.Namespaces, DryRun: pn.DryRun, RemoveFinalizers: pn.RemoveFinalizers})
+}
+
+// Run the current command returning the result or an error.
+func (pn *PurgeNamespace) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	report, err := pn.Report()
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot purge namespaces", err), nil
+	}
+	return entities.NewSuccessCommand([]byte(report.String())), nil
+}
+
+// String returns a string representation
+func (pn *PurgeNamespace) String() string {
+	return fmt.Sprintf("SYNC PurgeNamespace %s", strings.Join(pn.Namespaces, ","))
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (pn *PurgeNamespace) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + pn.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (pn *PurgeNamespace) UserString() string {
+	return fmt.Sprintf("Purging namespaces %s", strings.Join(pn.Namespaces, ", "))
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = ginkgo.Describe("The purge commands", func() {
+
+	var cluster *k8stest.FakeCluster
+	managed := map[string]string{ManagedByLabel: ManagedByInstaller}
+
+	ginkgo.BeforeEach(func() {
+		cluster = newFakeCluster(
+			&v1.Namespace{ObjectMeta: metaV1.ObjectMeta{Name: "nalej", Labels: managed}},
+			&v1.Namespace{ObjectMeta: metaV1.ObjectMeta{Name: "other"}},
+			&v1.ConfigMap{ObjectMeta: metaV1.ObjectMeta{Name: "platform-config", Namespace: "nalej", Labels: managed}},
+			&v1.ConfigMap{ObjectMeta: metaV1.ObjectMeta{Name: "kept", Namespace: "other"}},
+			&v1.Service{ObjectMeta: metaV1.ObjectMeta{Name: "web", Namespace: "nalej"}},
+		)
+		cluster.AddResource(k8stest.Resource{GroupVersion: "example.com/v1", Name: "widgets", Kind: "Widget", Namespaced: true})
+		crd := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apiextensions.k8s.io/v1beta1",
+			"kind":       "CustomResourceDefinition",
+			"metadata":   map[string]interface{}{"name": "widgets.example.com", "labels": map[string]interface{}{ManagedByLabel: ManagedByInstaller}},
+			"spec":       map[string]interface{}{"group": "example.com"},
+		}}
+		widget := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "example.com/v1",
+			"kind":       "Widget",
+			"metadata": map[string]interface{}{"name": "w1", "namespace": "nalej", "finalizers": []interface{}{"example.com/cleanup"},
+				"labels": map[string]interface{}{ManagedByLabel: ManagedByInstaller}},
+		}}
+		gomega.Expect(cluster.Tracker.Add(crd)).To(gomega.Succeed())
+		gomega.Expect(cluster.Tracker.Add(widget)).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	indexOf := func(report *PurgeReport, kind string) int {
+		for i, obj := range report.Objects {
+			if obj.Kind == kind {
+				return i
+			}
+		}
+		return -1
+	}
+
+	ginkgo.It("should list the objects of a namespace on a dry run", func() {
+		cmd := NewPurgeNamespace(cluster.KubeConfigPath, "nalej")
+		cmd.DryRun = true
+		report, err := cmd.Report()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(report.Objects).To(gomega.HaveLen(4))
+		gomega.Expect(indexOf(report, "Widget")).To(gomega.Equal(0))
+		gomega.Expect(indexOf(report, "Namespace")).To(gomega.Equal(3))
+		cluster.ExpectObject("v1", "ConfigMap", "nalej", "platform-config")
+	})
+
+	ginkgo.It("should purge a namespace and keep the rest", func() {
+		result, err := NewPurgeNamespace(cluster.KubeConfigPath, "nalej").Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		cluster.ExpectNoObject("v1", "Namespace", "", "nalej")
+		cluster.ExpectNoObject("v1", "Service", "nalej", "web")
+		cluster.ExpectNoObject("example.com/v1", "Widget", "nalej", "w1")
+		cluster.ExpectObject("v1", "ConfigMap", "other", "kept")
+		cluster.ExpectObject("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "", "widgets.example.com")
+	})
+
+	ginkgo.It("should purge the labeled objects removing the custom resources before their definitions", func() {
+		cmd := NewPurgeByLabel(cluster.KubeConfigPath, ManagedByLabel+"="+ManagedByInstaller)
+		report, err := cmd.Report()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(indexOf(report, "Widget")).To(gomega.BeNumerically("<", indexOf(report, "CustomResourceDefinition")))
+		cluster.ExpectNoObject("v1", "ConfigMap", "nalej", "platform-config")
+		cluster.ExpectNoObject("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "", "widgets.example.com")
+		cluster.ExpectObject("v1", "Service", "nalej", "web")
+		cluster.ExpectObject("v1", "Namespace", "", "other")
+	})
+
+	ginkgo.It("should remove the finalizers of the objects that remain", func() {
+		// The widget is kept on deletion as its controller is not running.
+		cluster.Dynamic.PrependReactor("delete", "widgets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, nil
+		})
+		cmd := NewPurgeByLabel(cluster.KubeConfigPath, ManagedByLabel+"="+ManagedByInstaller)
+		cmd.Namespaces = []string{"nalej"}
+		cmd.RemoveFinalizers = true
+		report, err := cmd.Report()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(report.Finalized).To(gomega.HaveLen(1))
+		widget := cluster.ExpectObject("example.com/v1", "Widget", "nalej", "w1")
+		gomega.Expect(widget.GetFinalizers()).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should refuse to purge the system namespaces or every object", func() {
+		_, err := NewPurgeNamespace(cluster.KubeConfigPath, "kube-system").Report()
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, err = NewPurgeByLabel(cluster.KubeConfigPath, "").Report()
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+})
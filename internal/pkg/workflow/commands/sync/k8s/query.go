@@ -0,0 +1,166 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the queries over any Kubernetes resource through the dynamic client. Errors returned by the
+// API are translated into the matching derrors type so callers can tell missing objects from denied or failed
+// requests.
+
+package k8s
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/nalej/derrors"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// AsQueryError translates an error returned by the Kubernetes API into a derrors.Error of the matching type.
+//   params:
+//     err The error returned by the API.
+//     msg The message describing the failed operation.
+//     params Additional parameters identifying the object.
+//   returns:
+//     The translated error.
+func AsQueryError(err error, msg string, params ...interface{}) derrors.Error {
+	var result derrors.Error
+	switch {
+	case k8sErrors.IsNotFound(err):
+		result = derrors.NewNotFoundError(msg, err)
+	case k8sErrors.IsAlreadyExists(err):
+		result = derrors.NewAlreadyExistsError(msg, err)
+	case k8sErrors.IsForbidden(err), k8sErrors.IsUnauthorized(err):
+		result = derrors.NewPermissionDeniedError(msg, err)
+	case k8sErrors.IsInvalid(err), k8sErrors.IsBadRequest(err):
+		result = derrors.NewInvalidArgumentError(msg, err)
+	case k8sErrors.IsTimeout(err), k8sErrors.IsServerTimeout(err), k8sErrors.IsTooManyRequests(err),
+		k8sErrors.IsServiceUnavailable(err):
+		result = derrors.NewUnavailableError(msg, err)
+	default:
+		result = derrors.NewInternalError(msg, err)
+	}
+	return result.WithParams(params...)
+}
+
+// DynamicResource returns the dynamic client of a resource.
+//   params:
+//     namespace The namespace of the objects, empty for cluster scoped resources.
+//     gvr The group, version and resource.
+//   returns:
+//     The dynamic client.
+func (k *Kubernetes) DynamicResource(namespace string, gvr schema.GroupVersionResource) dynamic.ResourceInterface {
+	if namespace == "" {
+		return k.dynClient.Resource(gvr)
+	}
+	return k.dynClient.Resource(gvr).Namespace(namespace)
+}
+
+// GetObject retrieves an object of any resource.
+//   params:
+//     namespace The namespace of the object, empty for cluster scoped resources.
+//     gvr The group, version and resource.
+//     name The name of the object.
+//   returns:
+//     The object.
+//     A NotFound error if the object does not exist, or an error of the matching type if it cannot be retrieved.
+func (k *Kubernetes) GetObject(namespace string, gvr schema.GroupVersionResource, name string) (*unstructured.Unstructured, derrors.Error) {
+	obj, err := k.DynamicResource(namespace, gvr).Get(name, metaV1.GetOptions{})
+	if err != nil {
+		return nil, AsQueryError(err, "cannot retrieve object", gvr.String(), namespace, name)
+	}
+	return obj, nil
+}
+
+// ListByLabel retrieves the objects of any resource matching a label selector.
+//   params:
+//     namespace The namespace of the objects, empty for all namespaces or cluster scoped resources.
+//     gvr The group, version and resource.
+//     selector The label selector, empty to retrieve all the objects.
+//   returns:
+//     The objects.
+//     An error of the matching type if the objects cannot be retrieved.
+func (k *Kubernetes) ListByLabel(namespace string, gvr schema.GroupVersionResource, selector string) ([]unstructured.Unstructured, derrors.Error) {
+	list, err := k.DynamicResource(namespace, gvr).List(metaV1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, AsQueryError(err, "cannot list objects", gvr.String(), namespace, selector)
+	}
+	return list.Items, nil
+}
+
+// ParseJSONPath parses a JSONPath expression such as {.status.conditions[0].status}. Missing fields are evaluated
+// as empty.
+//   params:
+//     expression The JSONPath expression.
+//   returns:
+//     The parsed expression.
+//     An InvalidArgument error if the expression is not valid.
+func ParseJSONPath(expression string) (*jsonpath.JSONPath, derrors.Error) {
+	parser := jsonpath.New("query").AllowMissingKeys(true)
+	if err := parser.Parse(expression); err != nil {
+		return nil, derrors.NewInvalidArgumentError("invalid jsonpath", err).WithParams(expression)
+	}
+	return parser, nil
+}
+
+// ExtractField evaluates a parsed JSONPath expression over an object.
+//   params:
+//     obj The object.
+//     path The parsed expression.
+//   returns:
+//     The value of the field, empty if it is missing.
+//     An InvalidArgument error if the expression cannot be evaluated over the object.
+func ExtractField(obj *unstructured.Unstructured, path *jsonpath.JSONPath) (string, derrors.Error) {
+	buf := new(bytes.Buffer)
+	if err := path.Execute(buf, obj.UnstructuredContent()); err != nil {
+		return "", derrors.NewInvalidArgumentError("cannot evaluate jsonpath", err).WithParams(obj.GetName())
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// MatchField checks if a field of an object has the expected value.
+//   params:
+//     namespace The namespace of the object, empty for cluster scoped resources.
+//     gvr The group, version and resource.
+//     name The name of the object.
+//     expression The JSONPath expression selecting the field.
+//     expected The expected value.
+//   returns:
+//     Whether the object exists and the field has the expected value.
+//     An error of the matching type if the object cannot be retrieved or the expression is not valid.
+func (k *Kubernetes) MatchField(namespace string, gvr schema.GroupVersionResource, name string, expression string, expected string) (bool, derrors.Error) {
+	path, err := ParseJSONPath(expression)
+	if err != nil {
+		return false, err
+	}
+	obj, gErr := k.DynamicResource(namespace, gvr).Get(name, metaV1.GetOptions{})
+	if gErr != nil {
+		if k8sErrors.IsNotFound(gErr) {
+			return false, nil
+		}
+		return false, AsQueryError(gErr, "cannot retrieve object", gvr.String(), namespace, name)
+	}
+	value, err := ExtractField(obj, path)
+	if err != nil {
+		return false, err
+	}
+	return value == expected, nil
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"errors"
+
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = ginkgo.Describe("The dynamic queries", func() {
+
+	var cluster *k8stest.FakeCluster
+	var k *Kubernetes
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+	configMap := func(name string, labels map[string]string, data map[string]string) *v1.ConfigMap {
+		return &v1.ConfigMap{
+			ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: "nalej", Labels: labels},
+			Data:       data,
+		}
+	}
+
+	ginkgo.BeforeEach(func() {
+		cluster = newFakeCluster(
+			configMap("a", map[string]string{"app": "one"}, map[string]string{"status": "ready"}),
+			configMap("b", map[string]string{"app": "two"}, nil))
+		k = &Kubernetes{KubeConfigPath: cluster.KubeConfigPath}
+		gomega.Expect(k.Connect()).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	ginkgo.It("should retrieve an object", func() {
+		obj, err := k.GetObject("nalej", configMaps, "a")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(obj.GetName()).To(gomega.Equal("a"))
+
+		_, err = k.GetObject("nalej", configMaps, "missing")
+		gomega.Expect(err).NotTo(gomega.BeNil())
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring("cannot retrieve object"))
+	})
+
+	ginkgo.It("should list objects by label", func() {
+		objs, err := k.ListByLabel("nalej", configMaps, "app=two")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(objs).To(gomega.HaveLen(1))
+		gomega.Expect(objs[0].GetName()).To(gomega.Equal("b"))
+
+		objs, err = k.ListByLabel("nalej", configMaps, "")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(objs).To(gomega.HaveLen(2))
+	})
+
+	ginkgo.It("should match a field of an object", func() {
+		match, err := k.MatchField("nalej", configMaps, "a", "{.data.status}", "ready")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(match).To(gomega.BeTrue())
+
+		match, err = k.MatchField("nalej", configMaps, "b", "{.data.status}", "ready")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(match).To(gomega.BeFalse())
+
+		match, err = k.MatchField("nalej", configMaps, "missing", "{.data.status}", "ready")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(match).To(gomega.BeFalse())
+
+		_, err = k.MatchField("nalej", configMaps, "a", "{.data.status", "ready")
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("should extract a field of an object", func() {
+		obj, err := k.GetObject("nalej", configMaps, "a")
+		gomega.Expect(err).To(gomega.Succeed())
+		path, err := ParseJSONPath("{.metadata.labels.app}")
+		gomega.Expect(err).To(gomega.Succeed())
+		value, err := ExtractField(obj, path)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(value).To(gomega.Equal("one"))
+	})
+
+	ginkgo.It("should translate the API errors", func() {
+		resource := schema.GroupResource{Resource: "configmaps"}
+		notFound := AsQueryError(k8sErrors.NewNotFound(resource, "a"), "msg")
+		gomega.Expect(notFound.Error()).To(gomega.ContainSubstring("msg"))
+		forbidden := AsQueryError(k8sErrors.NewForbidden(resource, "a", errors.New("denied")), "msg")
+		internal := AsQueryError(errors.New("failure"), "msg")
+		gomega.Expect(notFound.Error()).NotTo(gomega.Equal(forbidden.Error()))
+		gomega.Expect(forbidden.Error()).NotTo(gomega.Equal(internal.Error()))
+	})
+})
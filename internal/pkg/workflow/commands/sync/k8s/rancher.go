@@ -0,0 +1,167 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Rancher
+// Clusters imported in Rancher run its cluster agent on the cattle-system namespace, and the agents of Fleet and the
+// webhooks of Rancher on the cattle-* and fleet-* ones. The installer leaves those namespaces to Rancher: components
+// cannot be launched on them, they are never deleted or purged, and the admission webhooks of the components ignore
+// them so a webhook that is not ready cannot prevent Rancher from managing the cluster.
+
+package k8s
+
+import (
+	"strings"
+
+	"github.com/nalej/derrors"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// CattleSystemNamespace is the namespace of the agents of Rancher.
+const CattleSystemNamespace = "cattle-system"
+
+// RancherAgentDeployment is the deployment of the agent connecting an imported cluster to Rancher.
+const RancherAgentDeployment = "cattle-cluster-agent"
+
+// NamespaceNameLabel is the label set by Kubernetes on each namespace with its name.
+const NamespaceNameLabel = "kubernetes.io/metadata.name"
+
+// RancherNamespacePrefixes contains the prefixes of the namespaces managed by Rancher and Fleet.
+var RancherNamespacePrefixes = []string{"cattle-", "fleet-"}
+
+// RancherNamespaces contains the namespaces of Rancher excluded from the admission webhooks of the components.
+var RancherNamespaces = []string{CattleSystemNamespace, "cattle-fleet-system", "cattle-impersonation-system",
+	"cattle-fleet-local-system", "fleet-system"}
+
+// IsRancherNamespace checks if a namespace is managed by Rancher.
+func IsRancherNamespace(name string) bool {
+	for _, prefix := range RancherNamespacePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// RancherImported checks if the cluster is imported in Rancher, in which case it runs the cluster agent.
+//   returns:
+//     Whether the cluster is imported in Rancher.
+//     An error if the agent cannot be retrieved.
+func (k *Kubernetes) RancherImported() (bool, derrors.Error) {
+	_, err := k.Client.AppsV1().Deployments(CattleSystemNamespace).Get(RancherAgentDeployment, metaV1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, AsQueryError(err, "cannot retrieve the rancher agent", CattleSystemNamespace, RancherAgentDeployment)
+	}
+	return true, nil
+}
+
+// RancherNamespaceObject returns the namespace of Rancher modified by an object, either because the object is the
+// namespace or because it is created on it. The items of list resources are also checked.
+//   params:
+//     obj The object.
+//   returns:
+//     The namespace.
+//     Whether the object modifies a namespace of Rancher.
+func RancherNamespaceObject(obj runtime.Object) (string, bool) {
+	if content, ok := obj.(*unstructured.Unstructured); ok && content.IsList() {
+		items, _, _ := unstructured.NestedSlice(content.Object, "items")
+		for _, item := range items {
+			if itemContent, ok := item.(map[string]interface{}); ok {
+				if namespace, found := RancherNamespaceObject(&unstructured.Unstructured{Object: itemContent}); found {
+					return namespace, true
+				}
+			}
+		}
+		return "", false
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return "", false
+	}
+	namespace := accessor.GetNamespace()
+	if obj.GetObjectKind().GroupVersionKind().Kind == "Namespace" {
+		namespace = accessor.GetName()
+	}
+	return namespace, IsRancherNamespace(namespace)
+}
+
+// ExcludeRancherNamespaces modifies the admission webhooks of a ValidatingWebhookConfiguration or a
+// MutatingWebhookConfiguration so they ignore the namespaces of Rancher. The items of list resources are also
+// modified.
+//   params:
+//     obj The object to be modified.
+//   returns:
+//     Whether the object has been modified.
+func ExcludeRancherNamespaces(obj *unstructured.Unstructured) bool {
+	if obj.IsList() {
+		items, _, _ := unstructured.NestedSlice(obj.Object, "items")
+		modified := false
+		for index, item := range items {
+			content, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if ExcludeRancherNamespaces(&unstructured.Unstructured{Object: content}) {
+				items[index] = content
+				modified = true
+			}
+		}
+		if modified {
+			_ = unstructured.SetNestedSlice(obj.Object, items, "items")
+		}
+		return modified
+	}
+	if obj.GetKind() != "ValidatingWebhookConfiguration" && obj.GetKind() != "MutatingWebhookConfiguration" {
+		return false
+	}
+	excluded := make([]interface{}, 0, len(RancherNamespaces))
+	for _, namespace := range RancherNamespaces {
+		excluded = append(excluded, namespace)
+	}
+	requirement := map[string]interface{}{"key": NamespaceNameLabel, "operator": "NotIn", "values": excluded}
+	webhooks, _, _ := unstructured.NestedSlice(obj.Object, "webhooks")
+	modified := false
+	for index, webhook := range webhooks {
+		content, ok := webhook.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		expressions, _, _ := unstructured.NestedSlice(content, "namespaceSelector", "matchExpressions")
+		excludes := false
+		for _, expression := range expressions {
+			if e, ok := expression.(map[string]interface{}); ok && e["key"] == NamespaceNameLabel {
+				excludes = true
+			}
+		}
+		if !excludes {
+			_ = unstructured.SetNestedSlice(content, append(expressions, requirement), "namespaceSelector", "matchExpressions")
+			webhooks[index] = content
+			modified = true
+		}
+	}
+	if !modified {
+		return false
+	}
+	_ = unstructured.SetNestedSlice(obj.Object, webhooks, "webhooks")
+	return true
+}
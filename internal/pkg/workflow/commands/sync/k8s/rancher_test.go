@@ -0,0 +1,129 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/grpc-installer-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	appsV1 "k8s.io/api/apps/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = ginkgo.Describe("Rancher", func() {
+
+	ginkgo.It("should detect the objects on the namespaces of Rancher", func() {
+		gomega.Expect(IsRancherNamespace("cattle-system")).To(gomega.BeTrue())
+		gomega.Expect(IsRancherNamespace("fleet-default")).To(gomega.BeTrue())
+		gomega.Expect(IsRancherNamespace("nalej")).To(gomega.BeFalse())
+
+		namespace := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1", "kind": "Namespace", "metadata": map[string]interface{}{"name": "cattle-fleet-system"}}}
+		_, found := RancherNamespaceObject(namespace)
+		gomega.Expect(found).To(gomega.BeTrue())
+		list := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1", "kind": "List", "items": []interface{}{
+				map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap",
+					"metadata": map[string]interface{}{"name": "a", "namespace": "nalej"}},
+				map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap",
+					"metadata": map[string]interface{}{"name": "b", "namespace": "cattle-system"}},
+			}}}
+		ns, found := RancherNamespaceObject(list)
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(ns).To(gomega.Equal("cattle-system"))
+	})
+
+	ginkgo.It("should exclude the namespaces of Rancher from the webhooks", func() {
+		webhooks := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "admissionregistration.k8s.io/v1",
+			"kind":       "ValidatingWebhookConfiguration",
+			"metadata":   map[string]interface{}{"name": "nalej-validation"},
+			"webhooks": []interface{}{
+				map[string]interface{}{"name": "a.nalej.com"},
+				map[string]interface{}{"name": "b.nalej.com", "namespaceSelector": map[string]interface{}{
+					"matchExpressions": []interface{}{map[string]interface{}{
+						"key": "nalej.com/managed", "operator": "Exists"}}}},
+			},
+		}}
+		gomega.Expect(ExcludeRancherNamespaces(webhooks)).To(gomega.BeTrue())
+		items, _, _ := unstructured.NestedSlice(webhooks.Object, "webhooks")
+		for _, item := range items {
+			expressions, _, _ := unstructured.NestedSlice(item.(map[string]interface{}), "namespaceSelector", "matchExpressions")
+			last := expressions[len(expressions)-1].(map[string]interface{})
+			gomega.Expect(last["key"]).To(gomega.Equal(NamespaceNameLabel))
+			gomega.Expect(last["operator"]).To(gomega.Equal("NotIn"))
+			gomega.Expect(last["values"]).To(gomega.ContainElement(CattleSystemNamespace))
+		}
+		gomega.Expect(ExcludeRancherNamespaces(webhooks)).To(gomega.BeFalse())
+	})
+
+	ginkgo.Context("on an imported cluster", func() {
+		agent := &appsV1.Deployment{ObjectMeta: metaV1.ObjectMeta{Name: RancherAgentDeployment, Namespace: CattleSystemNamespace}}
+
+		ginkgo.It("should detect the agent of Rancher", func() {
+			cluster := newFakeCluster(agent)
+			defer UnregisterClients(cluster.KubeConfigPath)
+			k := &Kubernetes{KubeConfigPath: cluster.KubeConfigPath}
+			gomega.Expect(k.Connect()).To(gomega.Succeed())
+			imported, err := k.RancherImported()
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(imported).To(gomega.BeTrue())
+
+			other := newFakeCluster()
+			defer UnregisterClients(other.KubeConfigPath)
+			k = &Kubernetes{KubeConfigPath: other.KubeConfigPath}
+			gomega.Expect(k.Connect()).To(gomega.Succeed())
+			imported, err = k.RancherImported()
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(imported).To(gomega.BeFalse())
+		})
+
+		ginkgo.It("should not launch components on the namespaces of Rancher", func() {
+			cluster := newFakeCluster(agent)
+			defer UnregisterClients(cluster.KubeConfigPath)
+			dir, err := ioutil.TempDir("", "launch")
+			gomega.Expect(err).To(gomega.Succeed())
+			defer os.RemoveAll(dir)
+			component := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: agent-config
+  namespace: cattle-system
+data:
+  key: value
+`
+			gomega.Expect(ioutil.WriteFile(filepath.Join(dir, "1.configmap.yaml"), []byte(component), 0644)).To(gomega.Succeed())
+			launchCmd := NewLaunchComponents(cluster.KubeConfigPath, []string{"nalej"}, dir, grpc_installer_go.Platform_BAREMETAL.String())
+			launchCmd.Environment = "PRODUCTION"
+			result, lErr := launchCmd.Run("w1")
+			gomega.Expect(lErr).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeFalse())
+			cluster.ExpectNoObject("v1", "ConfigMap", "cattle-system", "agent-config")
+
+			deleteCmd := NewDeleteNamespace(cluster.KubeConfigPath, CattleSystemNamespace)
+			result, lErr = deleteCmd.Run("w1")
+			gomega.Expect(lErr).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeFalse())
+		})
+	})
+})
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file registers the commands of the package.
+
+package k8s
+
+import "github.com/nalej/installer/internal/pkg/workflow/entities"
+
+func init() {
+	entities.RegisterSyncCommand(entities.LaunchComponents, NewLaunchComponentsFromJSON,
+		func() interface{} { return &LaunchComponents{} }, "kubeConfigPath", "componentsDir")
+	entities.RegisterSyncCommand(entities.CreateCRDs, NewCreateCRDsFromJSON,
+		func() interface{} { return &CreateCRDs{} }, "kubeConfigPath", "crds_dir")
+	entities.RegisterSyncCommand(entities.CreateJob, NewCreateJobFromJSON,
+		func() interface{} { return &CreateJob{} }, "kubeConfigPath", "job_path")
+	entities.RegisterSyncCommand(entities.CheckRequirements, NewCheckRequirementsFromJSON,
+		func() interface{} { return &CheckRequirements{} }, "kubeConfigPath")
+	entities.RegisterSyncCommand(entities.ProbeCluster, NewProbeClusterFromJSON,
+		func() interface{} { return &ProbeCluster{} }, "kubeConfigPath")
+	entities.RegisterSyncCommand(entities.CheckCompatibility, NewCheckCompatibilityFromJSON,
+		func() interface{} { return &CheckCompatibility{} }, "kubeConfigPath")
+	entities.RegisterSyncCommand(entities.CreateClusterConfig, NewCreateClusterConfigFromJSON,
+		func() interface{} { return &CreateClusterConfig{} }, "kubeConfigPath", "organization_id", "cluster_id")
+	entities.RegisterSyncCommand(entities.CreateManagementConfig, NewCreateManagementConfigFromJSON,
+		func() interface{} { return &CreateManagementConfig{} }, "kubeConfigPath")
+	entities.RegisterSyncCommand(entities.UpdateCoreDNS, NewUpdateCoreDNSFromJSON,
+		func() interface{} { return &UpdateCoreDNS{} }, "kubeConfigPath", "dns_public_host")
+	entities.RegisterSyncCommand(entities.UpdateKubeDNS, NewUpdateKubeDNSFromJSON,
+		func() interface{} { return &UpdateKubeDNS{} }, "kubeConfigPath", "dns_public_host")
+	entities.RegisterSyncCommand(entities.CreateRegistrySecrets, NewCreateRegistrySecretsFromJSON,
+		func() interface{} { return &CreateRegistrySecrets{} }, "kubeConfigPath")
+	entities.RegisterSyncCommand(entities.AddClusterUser, NewAddClusterUserFromJSON,
+		func() interface{} { return &AddClusterUser{} }, "kubeConfigPath", "organization_id", "cluster_id")
+	entities.RegisterSyncCommand(entities.RegisterAppCluster, NewRegisterAppClusterFromJSON,
+		func() interface{} { return &RegisterAppCluster{} }, "kubeConfigPath", "organization_id", "cluster_id",
+		"clusters_address")
+	entities.RegisterSyncCommand(entities.CreateOpaqueSecret, NewCreateOpaqueSecretFromJSON,
+		func() interface{} { return &CreateOpaqueSecret{} }, "kubeConfigPath", "secret_name", "secret_key")
+	entities.RegisterSyncCommand(entities.RotateSecret, NewRotateSecretFromJSON,
+		func() interface{} { return &RotateSecret{} }, "kubeConfigPath", "secret_name", "secret_key")
+	entities.RegisterSyncCommand(entities.RestartDeployments, NewRestartDeploymentsFromJSON,
+		func() interface{} { return &RestartDeployments{} }, "kubeConfigPath", "secret_names")
+	entities.RegisterSyncCommand(entities.CreateCACert, NewCreateCACertFromJSON,
+		func() interface{} { return &CreateCACert{} }, "kubeConfigPath")
+	entities.RegisterSyncCommand(entities.CreateInternalCA, NewCreateInternalCAFromJSON,
+		func() interface{} { return &CreateInternalCA{} }, "kubeConfigPath")
+	entities.RegisterSyncCommand(entities.CreateTLSSecret, NewCreateTLSSecretFromJSON,
+		func() interface{} { return &CreateTLSSecret{} }, "kubeConfigPath", "secret_name")
+	entities.RegisterSyncCommand(entities.DeleteNamespace, NewDeleteNamespaceFromJSON,
+		func() interface{} { return &DeleteNamespace{} }, "kubeConfigPath", "namespace")
+	entities.RegisterSyncCommand(entities.DeleteNalejNamespace, NewDeleteNalejNamespaceFromJSON,
+		func() interface{} { return &DeleteNalejNamespace{} }, "kubeConfigPath")
+	entities.RegisterSyncCommand(entities.PurgeNamespace, NewPurgeNamespaceFromJSON,
+		func() interface{} { return &PurgeNamespace{} }, "kubeConfigPath", "namespaces")
+	entities.RegisterSyncCommand(entities.PurgeByLabel, NewPurgeByLabelFromJSON,
+		func() interface{} { return &PurgeByLabel{} }, "kubeConfigPath", "selector")
+	entities.RegisterSyncCommand(entities.DeleteServiceAccount, NewDeleteServiceAccountFromJSON,
+		func() interface{} { return &DeleteServiceAccount{} }, "kubeConfigPath", "namespace", "service_account")
+	entities.RegisterSyncCommand(entities.DeleteClusterRoleBinding, NewDeleteClusterRoleBindingFromJSON,
+		func() interface{} { return &DeleteClusterRoleBinding{} }, "kubeConfigPath", "role_binding_name")
+	entities.RegisterSyncCommand(entities.DeleteClusterRole, NewDeleteClusterRoleFromJSON,
+		func() interface{} { return &DeleteClusterRole{} }, "kubeConfigPath", "role_name")
+	entities.RegisterSyncCommand(entities.DeleteRole, NewDeleteRoleFromJSON,
+		func() interface{} { return &DeleteRole{} }, "kubeConfigPath", "namespace", "role_name")
+	entities.RegisterSyncCommand(entities.DeleteRoleBinding, NewDeleteRoleBindingFromJSON,
+		func() interface{} { return &DeleteRoleBinding{} }, "kubeConfigPath", "namespace", "role_name")
+	entities.RegisterSyncCommand(entities.DeleteConfigMap, NewDeleteConfigMapFromJSON,
+		func() interface{} { return &DeleteConfigMap{} }, "kubeConfigPath", "namespace", "config_map_name")
+	entities.RegisterSyncCommand(entities.DeleteService, NewDeleteServiceFromJSON,
+		func() interface{} { return &DeleteService{} }, "kubeConfigPath", "namespace", "service_name")
+	entities.RegisterSyncCommand(entities.DeleteDeployment, NewDeleteDeploymentFromJSON,
+		func() interface{} { return &DeleteDeployment{} }, "kubeConfigPath", "namespace", "deployment_name")
+	entities.RegisterSyncCommand(entities.DeletePodSecurityPolicy, NewDeletePodSecurityPolicyFromJSON,
+		func() interface{} { return &DeletePodSecurityPolicy{} }, "kubeConfigPath", "policy_name")
+	entities.RegisterSyncCommand(entities.InstallNetworkPolicies, NewInstallNetworkPoliciesFromJSON,
+		func() interface{} { return &InstallNetworkPolicies{} }, "kubeConfigPath", "platform_namespaces")
+	entities.RegisterSyncCommand(entities.ConfigureNamespaces, NewConfigureNamespacesFromJSON,
+		func() interface{} { return &ConfigureNamespaces{} }, "kubeConfigPath", "namespaces", "environment")
+	entities.RegisterSyncCommand(entities.SyncCertificate, NewSyncCertificateFromJSON,
+		func() interface{} { return &SyncCertificate{} }, "kubeConfigPath", "namespaces")
+	entities.RegisterSyncCommand(entities.CheckCertificates, NewCheckCertificatesFromJSON,
+		func() interface{} { return &CheckCertificates{} }, "kubeConfigPath")
+	entities.RegisterSyncCommand(entities.WaitFor, NewWaitForFromJSON,
+		func() interface{} { return &WaitFor{} }, "kubeConfigPath", "version", "resource", "resource_name")
+	entities.RegisterSyncCommand(entities.WaitDeploymentReady, NewWaitDeploymentReadyFromJSON,
+		func() interface{} { return &WaitDeploymentReady{} }, "kubeConfigPath", "namespace", "deployment_name")
+}
@@ -0,0 +1,246 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Register app cluster command
+// Registers an application cluster in the management cluster once it has been installed. The cluster entry is
+// created through the clusters API of the management cluster with the address of the ingress and the labels of the
+// cluster, and the token used by the cluster to join the management plane is stored as a secret.
+//
+// {"type":"sync", "name":"registerAppCluster", "kubeConfigPath":"/path/to/kubeconfig",
+// "organization_id":"org", "cluster_id":"cluster", "cluster_name":"app cluster", "hostname":"app.nalej.com",
+// "labels":{"region":"eu"}, "clusters_address":"system-model.nalej:8800", "join_token":"token"}
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-infrastructure-go"
+	"github.com/nalej/grpc-utils/pkg/conversions"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	"github.com/satori/go.uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterJoinTokenSecretName is the name of the secret with the token used by the cluster to join the management
+// plane.
+const ClusterJoinTokenSecretName = "cluster-join-token"
+
+// IngressServiceName is the name of the service exposing the ingress controller.
+const IngressServiceName = "nginx-ingress-controller"
+
+// IngressServiceNamespace is the namespace of the service exposing the ingress controller.
+const IngressServiceNamespace = "kube-system"
+
+// RegisteredClusterOutput is the output with the identifier of the registered cluster.
+const RegisteredClusterOutput = "cluster.registeredID"
+
+// registrationTimeout is the time given to the management cluster to register the cluster.
+const registrationTimeout = 30 * time.Second
+
+// clusterRegistry is the part of the clusters API used to register the clusters.
+type clusterRegistry interface {
+	AddCluster(ctx context.Context, in *grpc_infrastructure_go.AddClusterRequest, opts ...grpc.CallOption) (*grpc_infrastructure_go.Cluster, error)
+}
+
+// RegisterAppCluster command structure with supported parameters.
+type RegisterAppCluster struct {
+	Kubernetes
+	OrganizationID string `json:"organization_id"`
+	ClusterID      string `json:"cluster_id"`
+	ClusterName    string `json:"cluster_name"`
+	// Hostname is the public hostname of the cluster.
+	Hostname string `json:"hostname"`
+	// IngressAddress is the IP or hostname of the ingress. If not set, the address of the ingress service is used.
+	IngressAddress string `json:"ingress_address"`
+	// Labels of the cluster.
+	Labels map[string]string `json:"labels"`
+	// ClustersAddress is the address of the clusters API of the management cluster.
+	ClustersAddress string `json:"clusters_address"`
+	// JoinToken is the token used by the cluster to join the management plane. A new one is generated if not set.
+	JoinToken string `json:"join_token"`
+	// registry replaces the clusters API client in the tests.
+	registry clusterRegistry
+}
+
+// NewRegisterAppCluster creates a RegisterAppCluster command with a set of parameters.
+func NewRegisterAppCluster(kubeConfigPath string, organizationID string, clusterID string, clusterName string,
+	hostname string, labels map[string]string, clustersAddress string) *RegisterAppCluster {
+	return &RegisterAppCluster{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.RegisterAppCluster),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		OrganizationID:  organizationID,
+		ClusterID:       clusterID,
+		ClusterName:     clusterName,
+		Hostname:        hostname,
+		Labels:          labels,
+		ClustersAddress: clustersAddress,
+	}
+}
+
+// NewRegisterAppClusterFromJSON creates a RegisterAppCluster command from a JSON object.
+func NewRegisterAppClusterFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	rac := &RegisterAppCluster{}
+	if err := json.Unmarshal(raw, &rac); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	rac.CommandID = entities.GenerateCommandID(rac.Name())
+	var r entities.Command = rac
+	return &r, nil
+}
+
+// getIngressAddress returns the address of the ingress of the cluster.
+func (rac *RegisterAppCluster) getIngressAddress() (string, derrors.Error) {
+	if rac.IngressAddress != "" {
+		return rac.IngressAddress, nil
+	}
+	svc, err := rac.Client.CoreV1().Services(IngressServiceNamespace).Get(IngressServiceName, metaV1.GetOptions{})
+	if err != nil {
+		return "", AsQueryError(err, "cannot retrieve ingress service", IngressServiceNamespace, IngressServiceName)
+	}
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			return ingress.IP, nil
+		}
+		if ingress.Hostname != "" {
+			return ingress.Hostname, nil
+		}
+	}
+	return "", derrors.NewUnavailableError("ingress service has no address").WithParams(IngressServiceNamespace, IngressServiceName)
+}
+
+// register creates the cluster entry in the management cluster.
+func (rac *RegisterAppCluster) register(workflowID string, ingressAddress string) (string, derrors.Error) {
+	registry := rac.registry
+	if registry == nil {
+		conn, err := grpc.Dial(rac.ClustersAddress, grpc.WithInsecure())
+		if err != nil {
+			return "", derrors.AsError(err, "cannot create connection with the management cluster")
+		}
+		defer conn.Close()
+		registry = grpc_infrastructure_go.NewClustersClient(conn)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), registrationTimeout)
+	defer cancel()
+	request := &grpc_infrastructure_go.AddClusterRequest{
+		RequestId:            workflowID,
+		OrganizationId:       rac.OrganizationID,
+		Name:                 rac.ClusterName,
+		ClusterType:          grpc_infrastructure_go.ClusterType_KUBERNETES,
+		Hostname:             rac.Hostname,
+		ControlPlaneHostname: ingressAddress,
+		Labels:               rac.Labels,
+	}
+	added, err := registry.AddCluster(ctx, request)
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			log.Info().Str("clusterID", rac.ClusterID).Msg("cluster already registered")
+			return rac.ClusterID, nil
+		}
+		return "", conversions.ToDerror(err)
+	}
+	return added.ClusterId, nil
+}
+
+// storeJoinToken creates or updates the secret with the join token of the cluster.
+func (rac *RegisterAppCluster) storeJoinToken(registeredID string) derrors.Error {
+	token := rac.JoinToken
+	if token == "" {
+		token = uuid.NewV4().String()
+	}
+	secret := &v1.Secret{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      ClusterJoinTokenSecretName,
+			Namespace: "nalej",
+		},
+		StringData: map[string]string{
+			"organization_id": rac.OrganizationID,
+			"cluster_id":      registeredID,
+			"token":           token,
+		},
+		Type: v1.SecretTypeOpaque,
+	}
+	if err := rac.EnsureNamespace("nalej", NamespaceOptions{}); err != nil {
+		return err
+	}
+	secrets := rac.Client.CoreV1().Secrets("nalej")
+	_, err := secrets.Create(secret)
+	if k8sErrors.IsAlreadyExists(err) {
+		_, err = secrets.Update(secret)
+	}
+	if err != nil {
+		return AsQueryError(err, "cannot store join token", ClusterJoinTokenSecretName)
+	}
+	return nil
+}
+
+// Run the current command.
+//   returns:
+//     The CommandResult
+//     An error if the command execution fails
+func (rac *RegisterAppCluster) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := rac.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	ingressAddress, err := rac.getIngressAddress()
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot determine ingress address", err), nil
+	}
+	registeredID, err := rac.register(workflowID, ingressAddress)
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot register cluster", err), nil
+	}
+	if err := rac.storeJoinToken(registeredID); err != nil {
+		return entities.NewCommandResult(false, "cannot store join token", err), nil
+	}
+	msg := fmt.Sprintf("cluster %s registered with ingress %s", registeredID, ingressAddress)
+	return entities.NewSuccessCommand([]byte(msg)).WithOutputs(map[string]string{RegisteredClusterOutput: registeredID}), nil
+}
+
+// String obtains a string representation
+func (rac *RegisterAppCluster) String() string {
+	return fmt.Sprintf("SYNC RegisterAppCluster %s %s", rac.ClusterID, rac.ClustersAddress)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (rac *RegisterAppCluster) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + rac.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (rac *RegisterAppCluster) UserString() string {
+	return fmt.Sprintf("Registering cluster %s in the management cluster", rac.ClusterID)
+}
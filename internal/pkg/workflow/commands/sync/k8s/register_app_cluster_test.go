@@ -0,0 +1,128 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"context"
+
+	"github.com/nalej/grpc-infrastructure-go"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeClusterRegistry records the clusters added through the clusters API.
+type fakeClusterRegistry struct {
+	requests []*grpc_infrastructure_go.AddClusterRequest
+	err      error
+}
+
+func (fcr *fakeClusterRegistry) AddCluster(ctx context.Context, in *grpc_infrastructure_go.AddClusterRequest, opts ...grpc.CallOption) (*grpc_infrastructure_go.Cluster, error) {
+	fcr.requests = append(fcr.requests, in)
+	if fcr.err != nil {
+		return nil, fcr.err
+	}
+	return &grpc_infrastructure_go.Cluster{OrganizationId: in.OrganizationId, ClusterId: "registered"}, nil
+}
+
+var _ = ginkgo.Describe("A RegisterAppCluster command", func() {
+
+	var cluster *k8stest.FakeCluster
+	var registry *fakeClusterRegistry
+
+	ingressService := &v1.Service{
+		ObjectMeta: metaV1.ObjectMeta{Name: IngressServiceName, Namespace: IngressServiceNamespace},
+		Status: v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{
+			Ingress: []v1.LoadBalancerIngress{{IP: "10.0.0.1"}},
+		}},
+	}
+
+	newCommand := func() *RegisterAppCluster {
+		cmd := NewRegisterAppCluster(cluster.KubeConfigPath, "org", "cluster", "app cluster", "app.nalej.com",
+			map[string]string{"region": "eu"}, "localhost:8800")
+		cmd.registry = registry
+		return cmd
+	}
+
+	ginkgo.BeforeEach(func() {
+		registry = &fakeClusterRegistry{}
+	})
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	ginkgo.It("should register the cluster with the address of the ingress", func() {
+		cluster = newFakeCluster(ingressService)
+		cmd := newCommand()
+		cmd.JoinToken = "token"
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(result.Outputs).To(gomega.HaveKeyWithValue(RegisteredClusterOutput, "registered"))
+		gomega.Expect(registry.requests).To(gomega.HaveLen(1))
+		gomega.Expect(registry.requests[0].ControlPlaneHostname).To(gomega.Equal("10.0.0.1"))
+		gomega.Expect(registry.requests[0].Labels).To(gomega.HaveKeyWithValue("region", "eu"))
+
+		secret, gErr := cluster.Client.CoreV1().Secrets("nalej").Get(ClusterJoinTokenSecretName, metaV1.GetOptions{})
+		gomega.Expect(gErr).To(gomega.Succeed())
+		gomega.Expect(secret.StringData).To(gomega.HaveKeyWithValue("token", "token"))
+		gomega.Expect(secret.StringData).To(gomega.HaveKeyWithValue("cluster_id", "registered"))
+
+		// Running it again updates the secret.
+		cmd.JoinToken = ""
+		result, err = cmd.Run("w2")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		secret, gErr = cluster.Client.CoreV1().Secrets("nalej").Get(ClusterJoinTokenSecretName, metaV1.GetOptions{})
+		gomega.Expect(gErr).To(gomega.Succeed())
+		gomega.Expect(secret.StringData["token"]).NotTo(gomega.Equal("token"))
+	})
+
+	ginkgo.It("should accept clusters that are already registered", func() {
+		cluster = newFakeCluster()
+		registry.err = status.Error(codes.AlreadyExists, "cluster exists")
+		cmd := newCommand()
+		cmd.IngressAddress = "ingress.nalej.com"
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(result.Outputs).To(gomega.HaveKeyWithValue(RegisteredClusterOutput, "cluster"))
+	})
+
+	ginkgo.It("should fail if the ingress has no address", func() {
+		cluster = newFakeCluster()
+		result, err := newCommand().Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+		gomega.Expect(registry.requests).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should fail if the cluster cannot be registered", func() {
+		cluster = newFakeCluster(ingressService)
+		registry.err = status.Error(codes.Unavailable, "unavailable")
+		result, err := newCommand().Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+	})
+})
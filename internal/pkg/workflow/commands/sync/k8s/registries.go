@@ -0,0 +1,255 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// RegistryCredentials with the credentials used to pull images from a docker registry.
+type RegistryCredentials struct {
+	// SecretName with the name of the dockerconfigjson secret created for the registry.
+	SecretName string `json:"secret_name"`
+	// URL of the registry.
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// PullSecretRule maps the images starting with a prefix to the pull secret of a registry.
+type PullSecretRule struct {
+	ImagePrefix string `json:"image_prefix"`
+	SecretName  string `json:"secret_name"`
+}
+
+// RegistriesConfig with the registries available to the components and the rules selecting the pull secret of each
+// image. Images of a registry without rules use its secret if they start with the URL of the registry.
+type RegistriesConfig struct {
+	Registries []RegistryCredentials `json:"registries"`
+	Rules      []PullSecretRule      `json:"rules,omitempty"`
+	// ServiceAccounts with the names of the service accounts that receive the pull secrets of all the registries, so
+	// the pods using them inherit the secrets.
+	ServiceAccounts []string `json:"service_accounts,omitempty"`
+	// SkipWorkloads disables setting the pull secrets on the pods of the components, relying on the service accounts.
+	SkipWorkloads bool `json:"skip_workloads,omitempty"`
+}
+
+// LoadRegistriesConfig reads the configuration of the registries from a YAML or JSON file.
+//   params:
+//     path The path of the file.
+//   returns:
+//     The validated configuration.
+//     An error if the file cannot be read or it is not valid.
+func LoadRegistriesConfig(path string) (*RegistriesConfig, derrors.Error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.NewNotFoundError("cannot read registries file", err).WithParams(path)
+	}
+	config := &RegistriesConfig{}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse registries file", err).WithParams(path)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks that the registries have a unique secret name and an URL, and that the rules refer to them.
+func (rc *RegistriesConfig) Validate() derrors.Error {
+	secrets := make(map[string]bool, len(rc.Registries))
+	for _, registry := range rc.Registries {
+		if registry.SecretName == "" || registry.URL == "" {
+			return derrors.NewInvalidArgumentError("secret_name and url must be set for each registry")
+		}
+		if secrets[registry.SecretName] {
+			return derrors.NewInvalidArgumentError("duplicated registry secret name").WithParams(registry.SecretName)
+		}
+		secrets[registry.SecretName] = true
+	}
+	for _, rule := range rc.Rules {
+		if rule.ImagePrefix == "" {
+			return derrors.NewInvalidArgumentError("image_prefix must be set for each rule")
+		}
+		if !secrets[rule.SecretName] {
+			return derrors.NewInvalidArgumentError("rule refers to an unknown registry").WithParams(rule.SecretName)
+		}
+	}
+	return nil
+}
+
+// SecretNames returns the names of the pull secrets of the registries.
+func (rc *RegistriesConfig) SecretNames() []string {
+	result := make([]string, 0, len(rc.Registries))
+	for _, registry := range rc.Registries {
+		result = append(result, registry.SecretName)
+	}
+	return result
+}
+
+// PullSecret returns the pull secret of an image. The rule with the longest matching prefix is selected.
+//   params:
+//     image The name of the image.
+//   returns:
+//     The name of the secret.
+//     Whether a rule matches the image.
+func (rc *RegistriesConfig) PullSecret(image string) (string, bool) {
+	rules := make([]PullSecretRule, 0, len(rc.Rules)+len(rc.Registries))
+	rules = append(rules, rc.Rules...)
+	for _, registry := range rc.Registries {
+		prefix := strings.TrimSuffix(registry.URL, "/") + "/"
+		rules = append(rules, PullSecretRule{ImagePrefix: prefix, SecretName: registry.SecretName})
+	}
+	selected := PullSecretRule{}
+	for _, rule := range rules {
+		if strings.HasPrefix(image, rule.ImagePrefix) && len(rule.ImagePrefix) > len(selected.ImagePrefix) {
+			selected = rule
+		}
+	}
+	return selected.SecretName, selected.SecretName != ""
+}
+
+// isPullServiceAccount checks if a service account receives the pull secrets of all the registries.
+func (rc *RegistriesConfig) isPullServiceAccount(name string) bool {
+	for _, account := range rc.ServiceAccounts {
+		if account == name {
+			return true
+		}
+	}
+	return false
+}
+
+// podSpecPaths contains the path of the pod template of the kinds that create pods.
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// AddPullSecrets sets the pull secrets of the images used by an object, keeping the existing ones. The service
+// accounts listed in the configuration get the pull secrets of all the registries, so they are kept when the
+// components redefine them. The items of list resources are also modified.
+//   params:
+//     obj The object to be modified.
+//   returns:
+//     The number of pull secrets added.
+//     An error if the pod template of the object cannot be modified.
+func (rc *RegistriesConfig) AddPullSecrets(obj *unstructured.Unstructured) (int, derrors.Error) {
+	if obj.IsList() {
+		items, found, _ := unstructured.NestedSlice(obj.Object, "items")
+		if !found {
+			return 0, nil
+		}
+		added := 0
+		for index, item := range items {
+			content, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			itemAdded, err := rc.AddPullSecrets(&unstructured.Unstructured{Object: content})
+			if err != nil {
+				return 0, err
+			}
+			items[index] = content
+			added += itemAdded
+		}
+		if err := unstructured.SetNestedSlice(obj.Object, items, "items"); err != nil {
+			return 0, derrors.NewInternalError("cannot set list items", err)
+		}
+		return added, nil
+	}
+	if obj.GetKind() == "ServiceAccount" {
+		if !rc.isPullServiceAccount(obj.GetName()) {
+			return 0, nil
+		}
+		pullSecrets, _, _ := unstructured.NestedSlice(obj.Object, "imagePullSecrets")
+		pullSecrets, added := appendPullSecrets(pullSecrets, rc.SecretNames())
+		if added > 0 {
+			obj.Object["imagePullSecrets"] = pullSecrets
+		}
+		return added, nil
+	}
+	path, supported := podSpecPaths[obj.GetKind()]
+	if !supported || rc.SkipWorkloads {
+		return 0, nil
+	}
+	podSpec, found, err := unstructured.NestedMap(obj.Object, path...)
+	if err != nil {
+		return 0, derrors.NewInvalidArgumentError("cannot read pod spec", err).WithParams(obj.GetKind(), obj.GetName())
+	}
+	if !found {
+		return 0, nil
+	}
+	secrets := make([]string, 0)
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _, _ := unstructured.NestedSlice(podSpec, field)
+		for _, container := range containers {
+			content, ok := container.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			image, _ := content["image"].(string)
+			if secret, matches := rc.PullSecret(image); matches {
+				secrets = append(secrets, secret)
+			}
+		}
+	}
+	pullSecrets, _, _ := unstructured.NestedSlice(podSpec, "imagePullSecrets")
+	pullSecrets, added := appendPullSecrets(pullSecrets, secrets)
+	if added == 0 {
+		return 0, nil
+	}
+	podSpec["imagePullSecrets"] = pullSecrets
+	if err := unstructured.SetNestedMap(obj.Object, podSpec, path...); err != nil {
+		return 0, derrors.NewInternalError("cannot set pod spec", err).WithParams(obj.GetKind(), obj.GetName())
+	}
+	return added, nil
+}
+
+// appendPullSecrets adds the references to a set of secrets that are not part of a list of pull secrets.
+//   returns:
+//     The resulting list.
+//     The number of secrets added.
+func appendPullSecrets(pullSecrets []interface{}, secrets []string) ([]interface{}, int) {
+	current := make(map[string]bool, 0)
+	for _, entry := range pullSecrets {
+		if ref, ok := entry.(map[string]interface{}); ok {
+			current[fmt.Sprintf("%v", ref["name"])] = true
+		}
+	}
+	added := 0
+	for _, secret := range secrets {
+		if !current[secret] {
+			pullSecrets = append(pullSecrets, map[string]interface{}{"name": secret})
+			current[secret] = true
+			added++
+		}
+	}
+	return pullSecrets, added
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/grpc-installer-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const testRegistries = `registries:
+- secret_name: private-registry
+  url: registry.example.com
+  username: user
+  password: password
+- secret_name: mirror-registry
+  url: mirror.example.com/
+  username: user
+  password: password
+rules:
+- image_prefix: registry.example.com/mirrored/
+  secret_name: mirror-registry
+`
+
+const registriesDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: nalej
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      imagePullSecrets:
+      - name: existing
+      initContainers:
+      - name: init
+        image: mirror.example.com/busybox:1.31
+      containers:
+      - name: web
+        image: registry.example.com/nalej/web:v1
+      - name: proxy
+        image: docker.io/envoyproxy/envoy:v1.13
+`
+
+var _ = ginkgo.Describe("Registries configuration", func() {
+
+	var config *RegistriesConfig
+
+	ginkgo.BeforeEach(func() {
+		config = &RegistriesConfig{}
+		gomega.Expect(yaml.Unmarshal([]byte(testRegistries), config)).To(gomega.Succeed())
+		gomega.Expect(config.Validate()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should select the pull secret with the longest matching prefix", func() {
+		secret, found := config.PullSecret("registry.example.com/nalej/web:v1")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(secret).To(gomega.Equal("private-registry"))
+		secret, found = config.PullSecret("registry.example.com/mirrored/web:v1")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(secret).To(gomega.Equal("mirror-registry"))
+		_, found = config.PullSecret("registry.example.com.evil/web:v1")
+		gomega.Expect(found).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should reject rules referring to unknown registries", func() {
+		config.Rules = append(config.Rules, PullSecretRule{ImagePrefix: "quay.io/", SecretName: "quay"})
+		gomega.Expect(config.Validate()).NotTo(gomega.Succeed())
+		config.Rules = nil
+		config.Registries = append(config.Registries, config.Registries[0])
+		gomega.Expect(config.Validate()).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should add the pull secrets of the images of a workload", func() {
+		obj := &unstructured.Unstructured{}
+		gomega.Expect(yaml.Unmarshal([]byte(registriesDeployment), &obj.Object)).To(gomega.Succeed())
+		added, err := config.AddPullSecrets(obj)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(added).To(gomega.Equal(2))
+		secrets, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "imagePullSecrets")
+		gomega.Expect(secrets).To(gomega.Equal([]interface{}{
+			map[string]interface{}{"name": "existing"},
+			map[string]interface{}{"name": "mirror-registry"},
+			map[string]interface{}{"name": "private-registry"},
+		}))
+
+		// Adding them again does not duplicate them.
+		added, err = config.AddPullSecrets(obj)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(added).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("should only set the pull secrets of the listed service accounts", func() {
+		config.ServiceAccounts = []string{"default"}
+		config.SkipWorkloads = true
+		account := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1", "kind": "ServiceAccount",
+			"metadata": map[string]interface{}{"name": "default", "namespace": "nalej"},
+		}}
+		added, err := config.AddPullSecrets(account)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(added).To(gomega.Equal(2))
+		gomega.Expect(account.Object["imagePullSecrets"]).To(gomega.Equal([]interface{}{
+			map[string]interface{}{"name": "private-registry"},
+			map[string]interface{}{"name": "mirror-registry"},
+		}))
+
+		account.SetName("other")
+		delete(account.Object, "imagePullSecrets")
+		added, err = config.AddPullSecrets(account)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(added).To(gomega.Equal(0))
+
+		deployment := &unstructured.Unstructured{}
+		gomega.Expect(yaml.Unmarshal([]byte(registriesDeployment), &deployment.Object)).To(gomega.Succeed())
+		added, err = config.AddPullSecrets(deployment)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(added).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("should set the pull secrets while rendering the components", func() {
+		dir, err := ioutil.TempDir("", "registries")
+		gomega.Expect(err).To(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		componentsDir := filepath.Join(dir, "components")
+		gomega.Expect(os.MkdirAll(componentsDir, 0755)).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(filepath.Join(componentsDir, "1.deployment.yaml"), []byte(registriesDeployment), 0644)).To(gomega.Succeed())
+		registriesPath := filepath.Join(dir, "registries.yaml")
+		gomega.Expect(ioutil.WriteFile(registriesPath, []byte(testRegistries), 0644)).To(gomega.Succeed())
+
+		cmd := NewLaunchComponents("", []string{"nalej"}, componentsDir, grpc_installer_go.Platform_MINIKUBE.String())
+		cmd.Environment = "PRODUCTION"
+		cmd.RegistriesPath = registriesPath
+		written, rErr := cmd.Render(filepath.Join(dir, "output"))
+		gomega.Expect(rErr).To(gomega.Succeed())
+		gomega.Expect(written).To(gomega.HaveLen(1))
+		content, err := ioutil.ReadFile(written[0])
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(string(content)).To(gomega.ContainSubstring("name: private-registry"))
+	})
+})
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/rs/zerolog/log"
+	"sigs.k8s.io/yaml"
+)
+
+// RenderedSuffix with the extension of the rendered manifests.
+const RenderedSuffix = ".yaml"
+
+// Render writes the manifests that would be launched to a directory instead of applying them. The platform specific
+// files are selected, the platform modifications are applied and the objects are labeled and annotated as Apply does.
+// Pod security policies are only translated if the command has a kubeconfig, since that depends on the version of
+// the cluster.
+//   params:
+//     outputDir The directory where a manifest is written per component file.
+//   returns:
+//     The paths of the written manifests.
+//     An error if the components cannot be loaded or written.
+func (lc *LaunchComponents) Render(outputDir string) ([]string, derrors.Error) {
+	components, objects, err := lc.loadObjects()
+	if err != nil {
+		return nil, err
+	}
+	if lc.KubeConfigPath != "" {
+		if err := lc.Connect(); err != nil {
+			return nil, err
+		}
+		if _, err := lc.translatePodSecurityPolicies(objects); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, derrors.NewInternalError("cannot create output directory", err).WithParams(outputDir)
+	}
+
+	labels := lc.installLabels()
+	result := make([]string, 0, len(components))
+	for _, fileName := range components {
+		obj, exists := objects[fileName]
+		if !exists {
+			log.Info().Str("fileName", fileName).Msg("pod security policy replaced by pod security admission labels")
+			continue
+		}
+		items, err := unstructuredItems(obj)
+		if err != nil {
+			return nil, err
+		}
+		var content bytes.Buffer
+		for _, item := range items {
+			addLabels(item, labels)
+			hash, err := ManifestHash(item)
+			if err != nil {
+				return nil, err
+			}
+			setAnnotation(item, AppliedHashAnnotation, hash)
+			raw, mErr := yaml.Marshal(item.Object)
+			if mErr != nil {
+				return nil, derrors.NewInternalError("cannot marshal object", mErr).WithParams(item.GetKind(), item.GetName())
+			}
+			content.WriteString("---\n")
+			content.Write(raw)
+		}
+		// Platform specific files are written with the name of the common one.
+		name := fileName
+		if !strings.HasSuffix(name, RenderedSuffix) {
+			name = name[:strings.LastIndex(name, RenderedSuffix)+len(RenderedSuffix)]
+		}
+		target := filepath.Join(outputDir, name)
+		if err := ioutil.WriteFile(target, content.Bytes(), 0644); err != nil {
+			return nil, derrors.NewInternalError("cannot write manifest", err).WithParams(target)
+		}
+		result = append(result, target)
+	}
+	return result, nil
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/grpc-installer-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const renderConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: platform-config
+  namespace: nalej
+data:
+  key: value
+`
+
+const renderClaim = `apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+  namespace: nalej
+spec:
+  accessModes: ["ReadWriteOnce"]
+  resources:
+    requests:
+      storage: 1Gi
+`
+
+var _ = ginkgo.Describe("Rendering components", func() {
+
+	var componentsDir string
+	var outputDir string
+
+	ginkgo.BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "render")
+		gomega.Expect(err).To(gomega.Succeed())
+		componentsDir = filepath.Join(dir, "components")
+		outputDir = filepath.Join(dir, "output")
+		gomega.Expect(os.MkdirAll(componentsDir, 0755)).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(filepath.Join(componentsDir, "1.configmap.yaml"), []byte(renderConfigMap), 0644)).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(filepath.Join(componentsDir, "2.pvc.yaml"), []byte(renderClaim), 0644)).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(filepath.Join(componentsDir, "2.pvc.yaml.azure"), []byte(renderClaim), 0644)).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		os.RemoveAll(filepath.Dir(componentsDir))
+	})
+
+	readManifest := func(name string) *unstructured.Unstructured {
+		content, err := ioutil.ReadFile(filepath.Join(outputDir, name))
+		gomega.Expect(err).To(gomega.Succeed())
+		obj := &unstructured.Unstructured{}
+		gomega.Expect(yaml.Unmarshal(content[len("---\n"):], &obj.Object)).To(gomega.Succeed())
+		return obj
+	}
+
+	ginkgo.It("should write the manifests with the platform modifications", func() {
+		cmd := NewLaunchComponents("", []string{"nalej"}, componentsDir, grpc_installer_go.Platform_AZURE.String())
+		cmd.Environment = "PRODUCTION"
+		cmd.InstallID = "cluster"
+		written, err := cmd.Render(outputDir)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(written).To(gomega.Equal([]string{
+			filepath.Join(outputDir, "1.configmap.yaml"),
+			filepath.Join(outputDir, "2.pvc.yaml"),
+		}))
+
+		config := readManifest("1.configmap.yaml")
+		gomega.Expect(config.GetLabels()).To(gomega.HaveKeyWithValue(InstallIDLabel, InstallIDLabelValue("cluster")))
+		gomega.Expect(config.GetAnnotations()).To(gomega.HaveKey(AppliedHashAnnotation))
+
+		claim := readManifest("2.pvc.yaml")
+		storageClass, _, _ := unstructured.NestedString(claim.Object, "spec", "storageClassName")
+		gomega.Expect(storageClass).To(gomega.Equal(AzureStorageClass))
+	})
+
+	ginkgo.It("should not write anything if a component is invalid", func() {
+		gomega.Expect(ioutil.WriteFile(filepath.Join(componentsDir, "0.invalid.yaml"), []byte("key: ["), 0644)).To(gomega.Succeed())
+		cmd := NewLaunchComponents("", []string{"nalej"}, componentsDir, grpc_installer_go.Platform_MINIKUBE.String())
+		cmd.Environment = "PRODUCTION"
+		_, err := cmd.Render(outputDir)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, statErr := os.Stat(outputDir)
+		gomega.Expect(os.IsNotExist(statErr)).To(gomega.BeTrue())
+	})
+})
@@ -0,0 +1,224 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Restart deployments command
+// Restarts the deployments that read a set of secrets, one at a time, waiting for each one to become ready before
+// restarting the next. Deployments listed in order are restarted first, in the given order, followed by the other
+// dependent deployments sorted by name. Pull secrets are not considered, since they are only read when the images
+// are pulled.
+//
+// {"type":"sync", "name":"restartDeployments", "kubeConfigPath":"/path/kubeconfig.yaml", "namespaces":["nalej"],
+// "secret_names":["authx-secret"], "order":["authx"], "timeout":300}
+
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RestartedAtAnnotation is the annotation of the pod template changed to restart a deployment, as kubectl does.
+const RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// RestartDeployments structure with the secrets whose dependent deployments are restarted.
+type RestartDeployments struct {
+	Kubernetes
+	// Namespaces where the deployments are searched, TargetNamespace if not set.
+	Namespaces  []string `json:"namespaces"`
+	SecretNames []string `json:"secret_names"`
+	// Order with the names of the deployments restarted first.
+	Order []string `json:"order"`
+	// TimeoutSeconds with the maximum time to wait for each deployment. If not set, DefaultDeploymentTimeout is used.
+	TimeoutSeconds int `json:"timeout"`
+}
+
+// NewRestartDeployments creates a new RestartDeployments command.
+func NewRestartDeployments(kubeConfigPath string, namespaces []string, secretNames []string, order []string, timeoutSeconds int) *RestartDeployments {
+	return &RestartDeployments{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.RestartDeployments),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Namespaces:     namespaces,
+		SecretNames:    secretNames,
+		Order:          order,
+		TimeoutSeconds: timeoutSeconds,
+	}
+}
+
+// NewRestartDeploymentsFromJSON creates a new RestartDeployments command from a raw JSON representation.
+func NewRestartDeploymentsFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	rd := &RestartDeployments{}
+	if err := json.Unmarshal(raw, &rd); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	rd.CommandID = entities.GenerateCommandID(rd.Name())
+	var r entities.Command = rd
+	return &r, nil
+}
+
+// namespaces returns the namespaces where the deployments are searched.
+func (rd *RestartDeployments) namespaces() []string {
+	if len(rd.Namespaces) == 0 {
+		return []string{TargetNamespace}
+	}
+	return rd.Namespaces
+}
+
+// PodSpecSecrets returns the names of the secrets read by the containers of a pod, through environment variables or
+// volumes.
+func PodSpecSecrets(spec v1.PodSpec) map[string]bool {
+	result := make(map[string]bool, 0)
+	containers := append(append([]v1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, container := range containers {
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+				result[env.ValueFrom.SecretKeyRef.Name] = true
+			}
+		}
+		for _, source := range container.EnvFrom {
+			if source.SecretRef != nil {
+				result[source.SecretRef.Name] = true
+			}
+		}
+	}
+	for _, volume := range spec.Volumes {
+		if volume.Secret != nil {
+			result[volume.Secret.SecretName] = true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil {
+					result[source.Secret.Name] = true
+				}
+			}
+		}
+	}
+	return result
+}
+
+// dependents returns the deployments of a namespace that read any of the secrets, in restart order.
+func (rd *RestartDeployments) dependents(namespace string) ([]appsV1.Deployment, derrors.Error) {
+	list, err := rd.Client.AppsV1().Deployments(namespace).List(metaV1.ListOptions{})
+	if err != nil {
+		return nil, AsQueryError(err, "cannot list deployments", namespace)
+	}
+	result := make([]appsV1.Deployment, 0)
+	for _, deployment := range list.Items {
+		secrets := PodSpecSecrets(deployment.Spec.Template.Spec)
+		for _, name := range rd.SecretNames {
+			if secrets[name] {
+				result = append(result, deployment)
+				break
+			}
+		}
+	}
+	position := make(map[string]int, len(rd.Order))
+	for index, name := range rd.Order {
+		position[name] = index
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		pi, iOrdered := position[result[i].Name]
+		pj, jOrdered := position[result[j].Name]
+		if iOrdered != jOrdered {
+			return iOrdered
+		}
+		if iOrdered {
+			return pi < pj
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// RestartDeployment changes the pod template of a deployment so its pods are replaced, as kubectl rollout restart
+// does.
+//   params:
+//     deployment The deployment to be restarted.
+//   returns:
+//     An error if the deployment cannot be updated.
+func (k *Kubernetes) RestartDeployment(deployment appsV1.Deployment) derrors.Error {
+	if deployment.Spec.Template.Annotations == nil {
+		deployment.Spec.Template.Annotations = make(map[string]string, 0)
+	}
+	deployment.Spec.Template.Annotations[RestartedAtAnnotation] = time.Now().Format(time.RFC3339)
+	if _, err := k.Client.AppsV1().Deployments(deployment.Namespace).Update(&deployment); err != nil {
+		return AsQueryError(err, "cannot restart deployment", deployment.Namespace, deployment.Name)
+	}
+	return nil
+}
+
+// Run the current command.
+//   returns:
+//     The CommandResult
+//     An error if the command execution fails
+func (rd *RestartDeployments) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := rd.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	restarted := make([]string, 0)
+	for _, namespace := range rd.namespaces() {
+		deployments, err := rd.dependents(namespace)
+		if err != nil {
+			return entities.NewCommandResult(false, "cannot obtain dependent deployments", err), nil
+		}
+		for _, deployment := range deployments {
+			log.Info().Str("namespace", namespace).Str("deployment", deployment.Name).Msg("restarting deployment")
+			if err := rd.RestartDeployment(deployment); err != nil {
+				return entities.NewCommandResult(false, "cannot restart deployment", err), nil
+			}
+			wait := NewWaitDeploymentReady(rd.KubeConfigPath, namespace, deployment.Name, rd.TimeoutSeconds)
+			result, err := wait.Run(workflowID)
+			if err != nil {
+				return nil, err
+			}
+			if !result.Success {
+				return result, nil
+			}
+			restarted = append(restarted, namespace+"/"+deployment.Name)
+		}
+	}
+	msg := fmt.Sprintf("%d deployments restarted: %s", len(restarted), strings.Join(restarted, ", "))
+	return entities.NewSuccessCommand([]byte(msg)), nil
+}
+
+// String returns a string representation
+func (rd *RestartDeployments) String() string {
+	return fmt.Sprintf("SYNC RestartDeployments using %s", strings.Join(rd.SecretNames, ", "))
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (rd *RestartDeployments) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + rd.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (rd *RestartDeployments) UserString() string {
+	return fmt.Sprintf("Restarting the deployments using %s", strings.Join(rd.SecretNames, ", "))
+}
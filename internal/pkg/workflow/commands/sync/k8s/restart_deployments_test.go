@@ -0,0 +1,85 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = ginkgo.Describe("A RestartDeployments command", func() {
+
+	var cluster *k8stest.FakeCluster
+
+	newDeployment := func(name string, spec v1.PodSpec) *appsV1.Deployment {
+		replicas := int32(1)
+		deployment := &appsV1.Deployment{
+			ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: "nalej"},
+			Spec:       appsV1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsV1.DeploymentStatus{UpdatedReplicas: 1, ReadyReplicas: 1},
+		}
+		deployment.Spec.Template.Spec = spec
+		return deployment
+	}
+	envSpec := v1.PodSpec{Containers: []v1.Container{{Name: "c", Env: []v1.EnvVar{{
+		Name:      "SECRET",
+		ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "authx-secret"}}},
+	}}}}}
+	volumeSpec := v1.PodSpec{Volumes: []v1.Volume{{Name: "v", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "authx-secret"}}}}}
+	pullSpec := v1.PodSpec{ImagePullSecrets: []v1.LocalObjectReference{{Name: "authx-secret"}}}
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	ginkgo.It("should find the secrets read by a pod", func() {
+		gomega.Expect(PodSpecSecrets(envSpec)).To(gomega.HaveKey("authx-secret"))
+		gomega.Expect(PodSpecSecrets(volumeSpec)).To(gomega.HaveKey("authx-secret"))
+		gomega.Expect(PodSpecSecrets(pullSpec)).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should restart the dependent deployments in order", func() {
+		cluster = newFakeCluster(newDeployment("web", envSpec), newDeployment("authx", volumeSpec),
+			newDeployment("api", envSpec), newDeployment("other", pullSpec))
+		cmd := NewRestartDeployments(cluster.KubeConfigPath, []string{"nalej"}, []string{"authx-secret"}, []string{"authx"}, 1)
+		gomega.Expect(cmd.Connect()).To(gomega.Succeed())
+		dependents, err := cmd.dependents("nalej")
+		gomega.Expect(err).To(gomega.Succeed())
+		names := make([]string, 0)
+		for _, deployment := range dependents {
+			names = append(names, deployment.Name)
+		}
+		gomega.Expect(names).To(gomega.Equal([]string{"authx", "api", "web"}))
+
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		for _, name := range names {
+			deployment, gErr := cluster.Client.AppsV1().Deployments("nalej").Get(name, metaV1.GetOptions{})
+			gomega.Expect(gErr).To(gomega.Succeed())
+			gomega.Expect(deployment.Spec.Template.Annotations).To(gomega.HaveKey(RestartedAtAnnotation))
+		}
+		other, gErr := cluster.Client.AppsV1().Deployments("nalej").Get("other", metaV1.GetOptions{})
+		gomega.Expect(gErr).To(gomega.Succeed())
+		gomega.Expect(other.Spec.Template.Annotations).NotTo(gomega.HaveKey(RestartedAtAnnotation))
+	})
+})
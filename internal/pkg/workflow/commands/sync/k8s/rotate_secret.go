@@ -0,0 +1,223 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Rotate secret command
+// Replaces the value of a key of an opaque secret, generating a random one if no value is given. The secret is
+// created if it does not exist, and an existing value is only replaced if force_rotate is set.
+//
+// {"type":"sync", "name":"rotateSecret", "kubeConfigPath":"/path/kubeconfig.yaml", "namespace":"nalej",
+// "secret_name":"authx-secret", "secret_key":"secret", "length":32, "encoding":"base64", "force_rotate":true}
+
+package k8s
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GeneratedSecretLength is the number of random bytes of the generated secret values.
+const GeneratedSecretLength = 32
+
+// MinGeneratedSecretLength is the minimum number of random bytes of the generated secret values.
+const MinGeneratedSecretLength = 16
+
+const (
+	// SecretEncodingBase64 encodes the generated secret values as unpadded URL-safe base64.
+	SecretEncodingBase64 = "base64"
+	// SecretEncodingHex encodes the generated secret values as hexadecimal.
+	SecretEncodingHex = "hex"
+)
+
+const (
+	// SecretCreatedAtAnnotation contains the time the value of a secret generated by the installer was first set.
+	SecretCreatedAtAnnotation = "installer.nalej.com/created-at"
+	// SecretRotatedAtAnnotation contains the time the value of a secret generated by the installer was last set.
+	SecretRotatedAtAnnotation = "installer.nalej.com/rotated-at"
+)
+
+// RotateSecret structure with the secret to be rotated.
+type RotateSecret struct {
+	Kubernetes
+	// Namespace of the secret, TargetNamespace if not set.
+	Namespace  string `json:"namespace"`
+	SecretName string `json:"secret_name"`
+	SecretKey  string `json:"secret_key"`
+	// SecretValue with the new value. A random one is generated if not set.
+	SecretValue string `json:"secret_value"`
+	// Length with the number of random bytes of the generated value, GeneratedSecretLength if not set.
+	Length int `json:"length"`
+	// Encoding of the generated value, SecretEncodingBase64 if not set.
+	Encoding string `json:"encoding"`
+	// ForceRotate indicates if an existing value of the key is replaced. If not set, the command fails instead.
+	ForceRotate bool `json:"force_rotate"`
+}
+
+// NewRotateSecret creates a new RotateSecret command.
+func NewRotateSecret(kubeConfigPath string, namespace string, secretName string, secretKey string, secretValue string) *RotateSecret {
+	return &RotateSecret{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.RotateSecret),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Namespace:   namespace,
+		SecretName:  secretName,
+		SecretKey:   secretKey,
+		SecretValue: secretValue,
+	}
+}
+
+// NewRotateSecretFromJSON creates a new RotateSecret command from a raw JSON representation.
+func NewRotateSecretFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	rs := &RotateSecret{}
+	if err := json.Unmarshal(raw, &rs); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	rs.CommandID = entities.GenerateCommandID(rs.Name())
+	var r entities.Command = rs
+	return &r, nil
+}
+
+// namespace returns the namespace of the secret.
+func (rs *RotateSecret) namespace() string {
+	if rs.Namespace == "" {
+		return TargetNamespace
+	}
+	return rs.Namespace
+}
+
+// GenerateSecretValue returns a random value encoded in base64.
+func GenerateSecretValue() (string, derrors.Error) {
+	return GenerateSecret(GeneratedSecretLength, SecretEncodingBase64)
+}
+
+// GenerateSecret returns a value of cryptographically strong random bytes.
+//   params:
+//     length The number of random bytes, GeneratedSecretLength if zero.
+//     encoding The encoding of the value, SecretEncodingBase64 if empty.
+//   returns:
+//     The encoded value.
+//     An error if the length is too short, the encoding is not supported or the random source fails.
+func GenerateSecret(length int, encoding string) (string, derrors.Error) {
+	if length == 0 {
+		length = GeneratedSecretLength
+	}
+	if length < MinGeneratedSecretLength {
+		return "", derrors.NewInvalidArgumentError("secret length is too short").WithParams(length, MinGeneratedSecretLength)
+	}
+	raw := make([]byte, length)
+	if _, err := rand.Read(raw); err != nil {
+		return "", derrors.NewInternalError("cannot generate secret value", err)
+	}
+	switch encoding {
+	case "", SecretEncodingBase64:
+		return base64.RawURLEncoding.EncodeToString(raw), nil
+	case SecretEncodingHex:
+		return hex.EncodeToString(raw), nil
+	}
+	return "", derrors.NewInvalidArgumentError("unsupported secret encoding").WithParams(encoding)
+}
+
+// stampSecret sets the rotation annotations of a secret whose value is set at the given time, keeping the creation
+// time of the existing ones.
+func stampSecret(secret *v1.Secret, now time.Time) {
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string, 0)
+	}
+	timestamp := now.UTC().Format(time.RFC3339)
+	if _, exists := secret.Annotations[SecretCreatedAtAnnotation]; !exists {
+		secret.Annotations[SecretCreatedAtAnnotation] = timestamp
+	}
+	secret.Annotations[SecretRotatedAtAnnotation] = timestamp
+}
+
+// Run the current command.
+//   returns:
+//     The CommandResult
+//     An error if the command execution fails
+func (rs *RotateSecret) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := rs.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	value := rs.SecretValue
+	if value == "" {
+		generated, err := GenerateSecret(rs.Length, rs.Encoding)
+		if err != nil {
+			return entities.NewCommandResult(false, "cannot generate secret value", err), nil
+		}
+		value = generated
+	}
+	secrets := rs.Client.CoreV1().Secrets(rs.namespace())
+	secret, err := secrets.Get(rs.SecretName, metaV1.GetOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return entities.NewCommandResult(false, "cannot retrieve secret", AsQueryError(err, "cannot retrieve secret", rs.SecretName)), nil
+	}
+	exists := err == nil
+	if !exists {
+		secret = &v1.Secret{
+			ObjectMeta: metaV1.ObjectMeta{Name: rs.SecretName, Namespace: rs.namespace()},
+			Type:       v1.SecretTypeOpaque,
+		}
+	}
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte, 0)
+	}
+	if _, set := secret.Data[rs.SecretKey]; set && !rs.ForceRotate {
+		msg := fmt.Sprintf("secret %s already has a value for %s, force the rotation to replace it", rs.SecretName, rs.SecretKey)
+		return entities.NewCommandResult(false, msg, derrors.NewAlreadyExistsError(msg).WithParams(rs.namespace())), nil
+	}
+	secret.Data[rs.SecretKey] = []byte(value)
+	stampSecret(secret, time.Now())
+	if exists {
+		_, err = secrets.Update(secret)
+	} else {
+		_, err = secrets.Create(secret)
+	}
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot rotate secret", AsQueryError(err, "cannot rotate secret", rs.SecretName)), nil
+	}
+	log.Info().Str("namespace", rs.namespace()).Str("secret", rs.SecretName).Str("key", rs.SecretKey).Msg("secret rotated")
+	return entities.NewSuccessCommand([]byte(fmt.Sprintf("secret %s has been rotated", rs.SecretName))), nil
+}
+
+// String returns a string representation
+func (rs *RotateSecret) String() string {
+	return fmt.Sprintf("SYNC RotateSecret %s/%s", rs.namespace(), rs.SecretName)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (rs *RotateSecret) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + rs.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (rs *RotateSecret) UserString() string {
+	return fmt.Sprintf("Rotating secret %s", rs.SecretName)
+}
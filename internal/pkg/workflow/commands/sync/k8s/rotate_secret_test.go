@@ -0,0 +1,105 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = ginkgo.Describe("A RotateSecret command", func() {
+
+	var cluster *k8stest.FakeCluster
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	getValue := func(name string, key string) string {
+		secret, err := cluster.Client.CoreV1().Secrets("nalej").Get(name, metaV1.GetOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+		return string(secret.Data[key])
+	}
+
+	ginkgo.It("should create the secret if it does not exist", func() {
+		cluster = newFakeCluster()
+		result, err := NewRotateSecret(cluster.KubeConfigPath, "nalej", "authx-secret", "secret", "value").Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(getValue("authx-secret", "secret")).To(gomega.Equal("value"))
+	})
+
+	ginkgo.It("should replace the key keeping the rest of the secret", func() {
+		cluster = newFakeCluster(&v1.Secret{
+			ObjectMeta: metaV1.ObjectMeta{Name: "authx-secret", Namespace: "nalej"},
+			Data:       map[string][]byte{"secret": []byte("old"), "other": []byte("kept")},
+		})
+		cmd := NewRotateSecret(cluster.KubeConfigPath, "nalej", "authx-secret", "secret", "")
+		cmd.ForceRotate = true
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		generated := getValue("authx-secret", "secret")
+		gomega.Expect(generated).NotTo(gomega.BeEmpty())
+		gomega.Expect(generated).NotTo(gomega.Equal("old"))
+		gomega.Expect(getValue("authx-secret", "other")).To(gomega.Equal("kept"))
+	})
+
+	ginkgo.It("should refuse to replace an existing value unless forced", func() {
+		cluster = newFakeCluster(&v1.Secret{
+			ObjectMeta: metaV1.ObjectMeta{Name: "authx-secret", Namespace: "nalej",
+				Annotations: map[string]string{SecretCreatedAtAnnotation: "2019-01-01T00:00:00Z"}},
+			Data: map[string][]byte{"secret": []byte("old")},
+		})
+		result, err := NewRotateSecret(cluster.KubeConfigPath, "nalej", "authx-secret", "secret", "").Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+		gomega.Expect(getValue("authx-secret", "secret")).To(gomega.Equal("old"))
+
+		cmd := NewRotateSecret(cluster.KubeConfigPath, "nalej", "authx-secret", "secret", "")
+		cmd.ForceRotate = true
+		result, err = cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		secret, qErr := cluster.Client.CoreV1().Secrets("nalej").Get("authx-secret", metaV1.GetOptions{})
+		gomega.Expect(qErr).To(gomega.Succeed())
+		gomega.Expect(secret.Annotations).To(gomega.HaveKeyWithValue(SecretCreatedAtAnnotation, "2019-01-01T00:00:00Z"))
+		gomega.Expect(secret.Annotations).To(gomega.HaveKey(SecretRotatedAtAnnotation))
+	})
+
+	ginkgo.It("should generate values of the given length and encoding", func() {
+		value, err := GenerateSecret(24, SecretEncodingHex)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(value).To(gomega.MatchRegexp("^[0-9a-f]{48}$"))
+		_, err = GenerateSecret(8, SecretEncodingHex)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, err = GenerateSecret(32, "base32")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should generate different values", func() {
+		first, err := GenerateSecretValue()
+		gomega.Expect(err).To(gomega.Succeed())
+		second, err := GenerateSecretValue()
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(first).NotTo(gomega.Equal(second))
+	})
+})
@@ -0,0 +1,252 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ExternalSecretsStore creates ExternalSecret objects read by the external-secrets operator.
+	ExternalSecretsStore = "external-secrets"
+	// CSISecretStore creates SecretProviderClass objects read by the secrets store CSI driver.
+	CSISecretStore = "csi"
+)
+
+// ExternalSecretAPIVersion is the API version of the ExternalSecret objects.
+const ExternalSecretAPIVersion = "external-secrets.io/v1beta1"
+
+// SecretProviderClassAPIVersion is the API version of the SecretProviderClass objects.
+const SecretProviderClassAPIVersion = "secrets-store.csi.x-k8s.io/v1"
+
+// DefaultSecretStoreKind is the kind of the store referenced by the ExternalSecret objects if none is set.
+const DefaultSecretStoreKind = "ClusterSecretStore"
+
+// DefaultRefreshInterval is the refresh interval of the ExternalSecret objects if none is set.
+const DefaultRefreshInterval = "1h"
+
+// SecretStoreConfig with the external store keeping the values of the secrets created by the installer. Instead of
+// Secret objects, the installer creates references to the values of the store, which must be provisioned beforehand
+// with the names returned by RemoteName.
+type SecretStoreConfig struct {
+	// Type of the references, ExternalSecretsStore or CSISecretStore.
+	Type string `json:"type"`
+	// Provider of the CSI driver, such as azure or aws.
+	Provider string `json:"provider,omitempty"`
+	// StoreName with the name of the store referenced by the ExternalSecret objects.
+	StoreName string `json:"store_name,omitempty"`
+	// StoreKind with the kind of the store, DefaultSecretStoreKind if not set.
+	StoreKind string `json:"store_kind,omitempty"`
+	// RefreshInterval of the ExternalSecret objects, DefaultRefreshInterval if not set.
+	RefreshInterval string `json:"refresh_interval,omitempty"`
+	// KeyPrefix added to the names of the values in the store.
+	KeyPrefix string `json:"key_prefix,omitempty"`
+	// Parameters of the SecretProviderClass objects, such as the keyvaultName and tenantId on Azure or the region
+	// on AWS. The objects parameter is generated by the installer.
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// SyncSecrets makes the CSI driver mirror the mounted values as Secret objects so the components can read them.
+	SyncSecrets bool `json:"sync_secrets,omitempty"`
+}
+
+// LoadSecretStoreConfig reads the configuration of the secret store from a YAML or JSON file.
+//   params:
+//     path The path of the file.
+//   returns:
+//     The validated configuration.
+//     An error if the file cannot be read or it is not valid.
+func LoadSecretStoreConfig(path string) (*SecretStoreConfig, derrors.Error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.NewNotFoundError("cannot read secret store file", err).WithParams(path)
+	}
+	config := &SecretStoreConfig{}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse secret store file", err).WithParams(path)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks that the fields required by the type of the references are set.
+func (ssc *SecretStoreConfig) Validate() derrors.Error {
+	switch ssc.Type {
+	case ExternalSecretsStore:
+		if ssc.StoreName == "" {
+			return derrors.NewInvalidArgumentError("store_name must be set for external-secrets")
+		}
+	case CSISecretStore:
+		if ssc.Provider == "" {
+			return derrors.NewInvalidArgumentError("provider must be set for csi")
+		}
+		if _, found := ssc.Parameters["objects"]; found {
+			return derrors.NewInvalidArgumentError("objects parameter is generated by the installer")
+		}
+	default:
+		return derrors.NewInvalidArgumentError("unsupported secret store type").WithParams(ssc.Type)
+	}
+	return nil
+}
+
+// RemoteName returns the name of the value of a secret key in the store. Secrets with a single key use one value
+// named after the secret, while each key of the other secrets is kept in its own value.
+//   params:
+//     secretName The name of the secret.
+//     key The key of the secret.
+//     keys The number of keys of the secret.
+//   returns:
+//     The name of the value in the store.
+func (ssc *SecretStoreConfig) RemoteName(secretName string, key string, keys int) string {
+	if keys == 1 {
+		return ssc.KeyPrefix + secretName
+	}
+	return fmt.Sprintf("%s%s-%s", ssc.KeyPrefix, secretName, strings.Trim(key, "."))
+}
+
+// Reference returns the object referencing the values of a secret in the store.
+//   params:
+//     namespace The namespace of the secret.
+//     secretName The name of the secret.
+//     secretType The type of the secret the components expect.
+//     keys The keys of the secret.
+//     labels The labels of the object.
+//   returns:
+//     An ExternalSecret or SecretProviderClass object.
+func (ssc *SecretStoreConfig) Reference(namespace string, secretName string, secretType v1.SecretType, keys []string, labels map[string]string) *unstructured.Unstructured {
+	result := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	result.SetNamespace(namespace)
+	result.SetName(secretName)
+	result.SetLabels(labels)
+	if ssc.Type == ExternalSecretsStore {
+		result.SetAPIVersion(ExternalSecretAPIVersion)
+		result.SetKind("ExternalSecret")
+		result.Object["spec"] = ssc.externalSecretSpec(secretName, secretType, keys)
+	} else {
+		result.SetAPIVersion(SecretProviderClassAPIVersion)
+		result.SetKind("SecretProviderClass")
+		result.Object["spec"] = ssc.secretProviderClassSpec(secretName, secretType, keys)
+	}
+	return result
+}
+
+// externalSecretSpec returns the spec of an ExternalSecret creating the secret from the values of the store.
+func (ssc *SecretStoreConfig) externalSecretSpec(secretName string, secretType v1.SecretType, keys []string) map[string]interface{} {
+	kind := ssc.StoreKind
+	if kind == "" {
+		kind = DefaultSecretStoreKind
+	}
+	interval := ssc.RefreshInterval
+	if interval == "" {
+		interval = DefaultRefreshInterval
+	}
+	data := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		data = append(data, map[string]interface{}{
+			"secretKey": key,
+			"remoteRef": map[string]interface{}{"key": ssc.RemoteName(secretName, key, len(keys))},
+		})
+	}
+	return map[string]interface{}{
+		"refreshInterval": interval,
+		"secretStoreRef":  map[string]interface{}{"name": ssc.StoreName, "kind": kind},
+		"target": map[string]interface{}{
+			"name":     secretName,
+			"template": map[string]interface{}{"type": string(secretType)},
+		},
+		"data": data,
+	}
+}
+
+// csiObjects returns the objects parameter of a SecretProviderClass with the format expected by the provider.
+func (ssc *SecretStoreConfig) csiObjects(secretName string, keys []string) string {
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		name := ssc.RemoteName(secretName, key, len(keys))
+		switch ssc.Provider {
+		case "aws":
+			lines = append(lines, fmt.Sprintf("- objectName: %q\n  objectType: \"secretsmanager\"", name))
+		default:
+			lines = append(lines, fmt.Sprintf("  - |\n    objectName: %s\n    objectType: secret", name))
+		}
+	}
+	if ssc.Provider == "aws" {
+		return strings.Join(lines, "\n")
+	}
+	return "array:\n" + strings.Join(lines, "\n")
+}
+
+// secretProviderClassSpec returns the spec of a SecretProviderClass mounting the values of the store, optionally
+// mirrored as a secret.
+func (ssc *SecretStoreConfig) secretProviderClassSpec(secretName string, secretType v1.SecretType, keys []string) map[string]interface{} {
+	parameters := make(map[string]interface{}, len(ssc.Parameters)+1)
+	for name, value := range ssc.Parameters {
+		parameters[name] = value
+	}
+	parameters["objects"] = ssc.csiObjects(secretName, keys)
+	spec := map[string]interface{}{
+		"provider":   ssc.Provider,
+		"parameters": parameters,
+	}
+	if ssc.SyncSecrets {
+		data := make([]interface{}, 0, len(keys))
+		for _, key := range keys {
+			data = append(data, map[string]interface{}{
+				"objectName": ssc.RemoteName(secretName, key, len(keys)),
+				"key":        key,
+			})
+		}
+		spec["secretObjects"] = []interface{}{map[string]interface{}{
+			"secretName": secretName,
+			"type":       string(secretType),
+			"data":       data,
+		}}
+	}
+	return spec
+}
+
+// ReferenceAccess returns the access to the objects referencing the values of the store.
+func (ssc *SecretStoreConfig) ReferenceAccess() ObjectAccess {
+	reference := ssc.Reference("", "", v1.SecretTypeOpaque, nil, nil)
+	return KindAccess(reference.GroupVersionKind(), CreateVerbs, PatchVerbs)
+}
+
+// CreateSecretReference creates or updates the reference to the values of a secret in the store.
+//   params:
+//     config The configuration of the store.
+//     namespace The namespace of the secret.
+//     secretName The name of the secret.
+//     secretType The type of the secret.
+//     keys The keys of the secret.
+//     labels The labels of the reference.
+//   returns:
+//     An error if the reference cannot be applied.
+func (k *Kubernetes) CreateSecretReference(config *SecretStoreConfig, namespace string, secretName string, secretType v1.SecretType, keys []string, labels map[string]string) derrors.Error {
+	reference := config.Reference(namespace, secretName, secretType, keys, labels)
+	if err := k.Apply(reference, ApplyOptions{}, &ApplySummary{}); err != nil {
+		return derrors.AsError(err, "cannot create secret reference")
+	}
+	return nil
+}
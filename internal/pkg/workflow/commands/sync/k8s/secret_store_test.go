@@ -0,0 +1,163 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testExternalSecretStore = `
+type: external-secrets
+store_name: azure-vault
+key_prefix: nalej-
+`
+
+var _ = ginkgo.Describe("Secret store", func() {
+
+	ginkgo.Context("validating the configuration", func() {
+		ginkgo.It("should require the store of external-secrets", func() {
+			config := &SecretStoreConfig{Type: ExternalSecretsStore}
+			gomega.Expect(config.Validate()).NotTo(gomega.Succeed())
+			config.StoreName = "vault"
+			gomega.Expect(config.Validate()).To(gomega.Succeed())
+		})
+		ginkgo.It("should require the provider of csi", func() {
+			config := &SecretStoreConfig{Type: CSISecretStore}
+			gomega.Expect(config.Validate()).NotTo(gomega.Succeed())
+			config.Provider = "azure"
+			gomega.Expect(config.Validate()).To(gomega.Succeed())
+			config.Parameters = map[string]string{"objects": "array:"}
+			gomega.Expect(config.Validate()).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("should reject unknown types", func() {
+			gomega.Expect((&SecretStoreConfig{Type: "vault"}).Validate()).NotTo(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("creating references", func() {
+		ginkgo.It("should name the values of the store after the secret and key", func() {
+			config := &SecretStoreConfig{KeyPrefix: "nalej-"}
+			gomega.Expect(config.RemoteName("authx-secret", "secret", 1)).To(gomega.Equal("nalej-authx-secret"))
+			gomega.Expect(config.RemoteName("credentials", "username", 2)).To(gomega.Equal("nalej-credentials-username"))
+		})
+
+		ginkgo.It("should create an ExternalSecret with the type of the secret", func() {
+			config := &SecretStoreConfig{Type: ExternalSecretsStore, StoreName: "vault"}
+			reference := config.Reference("nalej", "registry", v1.SecretTypeDockerConfigJson, []string{v1.DockerConfigJsonKey}, nil)
+			gomega.Expect(reference.GetKind()).To(gomega.Equal("ExternalSecret"))
+			kind, _, _ := unstructured.NestedString(reference.Object, "spec", "secretStoreRef", "kind")
+			gomega.Expect(kind).To(gomega.Equal(DefaultSecretStoreKind))
+			secretType, _, _ := unstructured.NestedString(reference.Object, "spec", "target", "template", "type")
+			gomega.Expect(secretType).To(gomega.Equal(string(v1.SecretTypeDockerConfigJson)))
+			data, _, _ := unstructured.NestedSlice(reference.Object, "spec", "data")
+			gomega.Expect(data).To(gomega.HaveLen(1))
+		})
+
+		ginkgo.It("should create a SecretProviderClass with the objects of the provider", func() {
+			config := &SecretStoreConfig{Type: CSISecretStore, Provider: "azure",
+				Parameters: map[string]string{"keyvaultName": "vault"}}
+			reference := config.Reference("nalej", "authx-secret", v1.SecretTypeOpaque, []string{"secret"}, nil)
+			gomega.Expect(reference.GetKind()).To(gomega.Equal("SecretProviderClass"))
+			objects, _, _ := unstructured.NestedString(reference.Object, "spec", "parameters", "objects")
+			gomega.Expect(objects).To(gomega.Equal("array:\n  - |\n    objectName: authx-secret\n    objectType: secret"))
+			vault, _, _ := unstructured.NestedString(reference.Object, "spec", "parameters", "keyvaultName")
+			gomega.Expect(vault).To(gomega.Equal("vault"))
+			_, found, _ := unstructured.NestedSlice(reference.Object, "spec", "secretObjects")
+			gomega.Expect(found).To(gomega.BeFalse())
+
+			config.Provider = "aws"
+			config.SyncSecrets = true
+			reference = config.Reference("nalej", "authx-secret", v1.SecretTypeOpaque, []string{"secret"}, nil)
+			objects, _, _ = unstructured.NestedString(reference.Object, "spec", "parameters", "objects")
+			gomega.Expect(objects).To(gomega.Equal("- objectName: \"authx-secret\"\n  objectType: \"secretsmanager\""))
+			_, found, _ = unstructured.NestedSlice(reference.Object, "spec", "secretObjects")
+			gomega.Expect(found).To(gomega.BeTrue())
+		})
+	})
+
+	ginkgo.Context("creating the secrets of a cluster", func() {
+
+		var cluster *k8stest.FakeCluster
+		var storePath string
+
+		ginkgo.BeforeEach(func() {
+			cluster = newFakeCluster()
+			cluster.AddResource(k8stest.Resource{GroupVersion: ExternalSecretAPIVersion, Name: "externalsecrets",
+				Kind: "ExternalSecret", Namespaced: true})
+			file, err := ioutil.TempFile("", "secretstore")
+			gomega.Expect(err).To(gomega.Succeed())
+			_, err = file.WriteString(testExternalSecretStore)
+			gomega.Expect(err).To(gomega.Succeed())
+			file.Close()
+			storePath = file.Name()
+		})
+
+		ginkgo.AfterEach(func() {
+			UnregisterClients(cluster.KubeConfigPath)
+			os.Remove(storePath)
+		})
+
+		ginkgo.It("should reference the authx secret instead of generating it", func() {
+			cmd := NewCreateManagementConfig(cluster.KubeConfigPath, "host", "443", "AZURE", "PRODUCTION")
+			cmd.SecretStorePath = storePath
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			cluster.ExpectNoObject("v1", "Secret", "nalej", "authx-secret")
+			reference := cluster.ExpectObject(ExternalSecretAPIVersion, "ExternalSecret", "nalej", "authx-secret")
+			data, _, _ := unstructured.NestedSlice(reference.Object, "spec", "data")
+			gomega.Expect(data).To(gomega.HaveLen(1))
+			key, _, _ := unstructured.NestedString(data[0].(map[string]interface{}), "remoteRef", "key")
+			gomega.Expect(key).To(gomega.Equal("nalej-authx-secret"))
+		})
+
+		ginkgo.It("should reference the credentials of the registries", func() {
+			file, fErr := ioutil.TempFile("", "registries")
+			gomega.Expect(fErr).To(gomega.Succeed())
+			defer os.Remove(file.Name())
+			_, fErr = file.WriteString(testRegistries)
+			gomega.Expect(fErr).To(gomega.Succeed())
+			file.Close()
+
+			cmd := NewCreateRegistrySecrets(cluster.KubeConfigPath, true, "nalej-registry", "user", "password", "registry.example.com")
+			cmd.RegistriesPath = file.Name()
+			cmd.SecretStorePath = storePath
+			cmd.Namespaces = []string{"nalej", "ingress-nginx"}
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			for _, created := range cluster.Created() {
+				gomega.Expect(created.Kind).NotTo(gomega.Equal("Secret"))
+			}
+			cluster.ExpectObject(ExternalSecretAPIVersion, "ExternalSecret", "nalej", "nalej-registry")
+			cluster.ExpectObject(ExternalSecretAPIVersion, "ExternalSecret", "nalej", "credentials-nalej-registry")
+			for _, namespace := range cmd.Namespaces {
+				cluster.ExpectObject(ExternalSecretAPIVersion, "ExternalSecret", namespace, "private-registry")
+				cluster.ExpectObject(ExternalSecretAPIVersion, "ExternalSecret", namespace, "mirror-registry")
+				cluster.ExpectNoObject("v1", "Secret", namespace, "private-registry")
+			}
+		})
+	})
+})
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the mapping of the storage classes of the persistent volumes and claims of the components,
+// by platform and by volume or claim.
+
+package k8s
+
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/grpc-installer-go"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// KeepStorageClass is the override of a volume or claim that keeps the storage class of its manifest, or the one
+// of the existing claim as it cannot be changed once created.
+const KeepStorageClass = "keep"
+
+// DefaultStorageClasses contains the storage class of the volumes and claims of each platform if no mapping is set.
+var DefaultStorageClasses = map[string]string{
+	grpc_installer_go.Platform_AZURE.String(): AzureStorageClass,
+}
+
+// StorageClassesConfig with the storage classes of the persistent volumes and claims of the components.
+type StorageClassesConfig struct {
+	// Platforms maps a platform, such as AZURE, to the storage class of its volumes and claims. The platforms not
+	// included use DefaultStorageClasses.
+	Platforms map[string]string `json:"platforms"`
+	// Overrides maps the name of a volume or claim to its storage class, or to KeepStorageClass. They take
+	// precedence over the class of the platform.
+	Overrides map[string]string `json:"overrides,omitempty"`
+}
+
+// LoadStorageClassesConfig reads the mapping of the storage classes from a YAML or JSON file.
+//   params:
+//     path The path of the file.
+//   returns:
+//     The validated configuration.
+//     An error if the file cannot be read or it is not valid.
+func LoadStorageClassesConfig(path string) (*StorageClassesConfig, derrors.Error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.NewNotFoundError("cannot read storage classes file", err).WithParams(path)
+	}
+	config := &StorageClassesConfig{}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse storage classes file", err).WithParams(path)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks that the platforms are known and the classes are valid names.
+func (sc *StorageClassesConfig) Validate() derrors.Error {
+	for platform, class := range sc.Platforms {
+		if _, found := grpc_installer_go.Platform_value[platform]; !found {
+			return derrors.NewInvalidArgumentError("unknown platform in storage classes").WithParams(platform)
+		}
+		if errs := validation.IsDNS1123Subdomain(class); len(errs) > 0 {
+			return derrors.NewInvalidArgumentError("invalid storage class").WithParams(platform, class, strings.Join(errs, ", "))
+		}
+	}
+	for name, class := range sc.Overrides {
+		if class == KeepStorageClass {
+			continue
+		}
+		if errs := validation.IsDNS1123Subdomain(class); len(errs) > 0 {
+			return derrors.NewInvalidArgumentError("invalid storage class").WithParams(name, class, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// StorageClass returns the storage class of a volume or claim on a platform. A nil config uses
+// DefaultStorageClasses.
+//   params:
+//     platformType The platform of the cluster.
+//     name The name of the volume or claim.
+//   returns:
+//     The storage class.
+//     Whether the class of the manifest must be replaced, false if there is no mapping or it must be kept.
+func (sc *StorageClassesConfig) StorageClass(platformType string, name string) (string, bool) {
+	if sc != nil {
+		if class, found := sc.Overrides[name]; found {
+			return class, class != KeepStorageClass
+		}
+		if class, found := sc.Platforms[platformType]; found {
+			return class, true
+		}
+	}
+	class, found := DefaultStorageClasses[platformType]
+	return class, found
+}
+
+// Keeps checks if a volume or claim keeps its existing storage class.
+func (sc *StorageClassesConfig) Keeps(name string) bool {
+	return sc != nil && sc.Overrides[name] == KeepStorageClass
+}
+
+// ValidateStorageClasses checks that a set of storage classes exist in the cluster.
+func (k *Kubernetes) ValidateStorageClasses(classes []string) derrors.Error {
+	sort.Strings(classes)
+	for _, class := range classes {
+		_, err := k.Client.StorageV1().StorageClasses().Get(class, metaV1.GetOptions{})
+		if err != nil {
+			if k8sErrors.IsNotFound(err) {
+				return derrors.NewNotFoundError("storage class does not exist in the cluster").WithParams(class)
+			}
+			return AsQueryError(err, "cannot retrieve storage class", class)
+		}
+	}
+	return nil
+}
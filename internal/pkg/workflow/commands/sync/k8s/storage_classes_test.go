@@ -0,0 +1,156 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	storageV1 "k8s.io/api/storage/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testStorageClasses = `
+platforms:
+  AZURE: azure-ssd
+  BAREMETAL: local-path
+overrides:
+  logs: cheap-hdd
+  data: keep
+`
+
+var _ = ginkgo.Describe("The storage classes", func() {
+
+	ginkgo.It("should map the classes by platform and by name", func() {
+		var defaults *StorageClassesConfig
+		class, replace := defaults.StorageClass(grpc_installer_go.Platform_AZURE.String(), "data")
+		gomega.Expect(replace).To(gomega.BeTrue())
+		gomega.Expect(class).To(gomega.Equal(AzureStorageClass))
+		_, replace = defaults.StorageClass(grpc_installer_go.Platform_MINIKUBE.String(), "data")
+		gomega.Expect(replace).To(gomega.BeFalse())
+
+		config := &StorageClassesConfig{
+			Platforms: map[string]string{grpc_installer_go.Platform_BAREMETAL.String(): "local-path"},
+			Overrides: map[string]string{"logs": "cheap-hdd", "data": KeepStorageClass},
+		}
+		class, _ = config.StorageClass(grpc_installer_go.Platform_BAREMETAL.String(), "elastic")
+		gomega.Expect(class).To(gomega.Equal("local-path"))
+		class, _ = config.StorageClass(grpc_installer_go.Platform_AZURE.String(), "elastic")
+		gomega.Expect(class).To(gomega.Equal(AzureStorageClass))
+		class, _ = config.StorageClass(grpc_installer_go.Platform_BAREMETAL.String(), "logs")
+		gomega.Expect(class).To(gomega.Equal("cheap-hdd"))
+		_, replace = config.StorageClass(grpc_installer_go.Platform_AZURE.String(), "data")
+		gomega.Expect(replace).To(gomega.BeFalse())
+		gomega.Expect(config.Keeps("data")).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should reject unknown platforms and invalid classes", func() {
+		config := &StorageClassesConfig{Platforms: map[string]string{"AWS": "gp2"}}
+		gomega.Expect(config.Validate()).NotTo(gomega.Succeed())
+		config = &StorageClassesConfig{Overrides: map[string]string{"data": "Not_Valid"}}
+		gomega.Expect(config.Validate()).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.Context("launching the components", func() {
+
+		var cluster *k8stest.FakeCluster
+		var dir string
+		var componentsDir string
+
+		claim := func(name string) string {
+			return `apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: ` + name + `
+  namespace: nalej
+spec:
+  storageClassName: standard
+  accessModes: ["ReadWriteOnce"]
+  resources:
+    requests:
+      storage: 1Gi
+`
+		}
+
+		ginkgo.BeforeEach(func() {
+			cluster = newFakeCluster()
+			var err error
+			dir, err = ioutil.TempDir("", "storage")
+			gomega.Expect(err).To(gomega.Succeed())
+			componentsDir = filepath.Join(dir, "components")
+			gomega.Expect(os.MkdirAll(componentsDir, 0755)).To(gomega.Succeed())
+			for _, name := range []string{"data", "logs", "elastic"} {
+				gomega.Expect(ioutil.WriteFile(filepath.Join(componentsDir, name+".yaml"), []byte(claim(name)), 0644)).To(gomega.Succeed())
+			}
+			gomega.Expect(ioutil.WriteFile(filepath.Join(dir, "classes.yaml"), []byte(testStorageClasses), 0644)).To(gomega.Succeed())
+		})
+
+		ginkgo.AfterEach(func() {
+			UnregisterClients(cluster.KubeConfigPath)
+			os.RemoveAll(dir)
+		})
+
+		launch := func() *LaunchComponents {
+			cmd := NewLaunchComponents(cluster.KubeConfigPath, []string{"nalej"}, componentsDir, grpc_installer_go.Platform_AZURE.String())
+			cmd.Environment = "PRODUCTION"
+			cmd.StorageClassesPath = filepath.Join(dir, "classes.yaml")
+			return cmd
+		}
+
+		className := func(name string) string {
+			obj := cluster.ExpectObject("v1", "PersistentVolumeClaim", "nalej", name)
+			class, _, _ := unstructured.NestedString(obj.Object, "spec", "storageClassName")
+			return class
+		}
+
+		ginkgo.It("should fail if a mapped class does not exist", func() {
+			gomega.Expect(cluster.Tracker.Add(&storageV1.StorageClass{ObjectMeta: metaV1.ObjectMeta{Name: "azure-ssd"}})).To(gomega.Succeed())
+			result, err := launch().Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeFalse())
+			cluster.ExpectNoObject("v1", "PersistentVolumeClaim", "nalej", "logs")
+		})
+
+		ginkgo.It("should set the mapped classes and keep the class of the existing claims", func() {
+			for _, name := range []string{"azure-ssd", "cheap-hdd"} {
+				gomega.Expect(cluster.Tracker.Add(&storageV1.StorageClass{ObjectMeta: metaV1.ObjectMeta{Name: name}})).To(gomega.Succeed())
+			}
+			existingClass := "legacy"
+			existing := &v1.PersistentVolumeClaim{
+				ObjectMeta: metaV1.ObjectMeta{Name: "data", Namespace: "nalej", Labels: map[string]string{ManagedByLabel: ManagedByInstaller}},
+				Spec:       v1.PersistentVolumeClaimSpec{StorageClassName: &existingClass},
+			}
+			gomega.Expect(cluster.Tracker.Add(existing)).To(gomega.Succeed())
+			cluster.SetVersion("1.15")
+
+			result, err := launch().Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			gomega.Expect(className("elastic")).To(gomega.Equal("azure-ssd"))
+			gomega.Expect(className("logs")).To(gomega.Equal("cheap-hdd"))
+			gomega.Expect(className("data")).To(gomega.Equal("legacy"))
+		})
+	})
+})
@@ -0,0 +1,347 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+// Sync certificate command
+// Copies a TLS certificate, such as the letsencrypt wildcard certificate of the management cluster, to the
+// namespaces of an application cluster so that its ingresses serve valid TLS. The certificate is read from a secret
+// of the source cluster, the cluster where the installer runs if no kubeconfig is set, or from PEM files. The copies
+// are only updated when the certificate changes, so the command is run on every install and secret rotation to
+// distribute the renewed certificates.
+//
+// {"type":"sync", "name":"syncCertificate", "kubeConfigPath":"/path/to/app/kubeconfig",
+// "source":"istio-system/ingress-cert", "namespaces":["nalej"], "hosts":["appcluster.app.nalej.com"]}
+
+package k8s
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Annotations of the synced certificate secrets.
+const (
+	// CertificateFingerprintAnnotation contains the SHA-256 fingerprint of the synced certificate.
+	CertificateFingerprintAnnotation = "installer.nalej.com/certificate-fingerprint"
+	// CertificateSourceAnnotation contains the secret the certificate was copied from.
+	CertificateSourceAnnotation = "installer.nalej.com/certificate-source"
+	// CertificateExpirationAnnotation contains the expiration date of the synced certificate.
+	CertificateExpirationAnnotation = "installer.nalej.com/certificate-expiration"
+)
+
+// CACertificateKey is the key of the CA certificate on the TLS secrets issued by cert-manager.
+const CACertificateKey = "ca.crt"
+
+// Certificate with the PEM contents of a TLS certificate.
+type Certificate struct {
+	// Cert with the certificate chain.
+	Cert []byte
+	// Key with the private key.
+	Key []byte
+	// CA with the certificate of the issuer, if any.
+	CA []byte
+}
+
+// LoadCertificateFiles reads a certificate from PEM files.
+//   params:
+//     certPath The path of the certificate chain.
+//     keyPath The path of the private key.
+//   returns:
+//     The certificate.
+//     An error if the files cannot be read.
+func LoadCertificateFiles(certPath string, keyPath string) (*Certificate, derrors.Error) {
+	cert, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot load cert content")
+	}
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, derrors.AsError(err, "cannot load private key content")
+	}
+	return &Certificate{Cert: cert, Key: key}, nil
+}
+
+// LoadCertificateSecret reads a certificate from a TLS secret. Connect must be called first.
+//   params:
+//     namespace The namespace of the secret.
+//     name The name of the secret.
+//   returns:
+//     The certificate.
+//     An error if the secret cannot be retrieved or does not contain a certificate.
+func (k *Kubernetes) LoadCertificateSecret(namespace string, name string) (*Certificate, derrors.Error) {
+	secret, err := k.Client.CoreV1().Secrets(namespace).Get(name, metaV1.GetOptions{})
+	if err != nil {
+		return nil, AsQueryError(err, "cannot retrieve certificate secret", namespace, name)
+	}
+	if len(secret.Data[v1.TLSCertKey]) == 0 || len(secret.Data[v1.TLSPrivateKeyKey]) == 0 {
+		return nil, derrors.NewFailedPreconditionError("secret does not contain a certificate").WithParams(namespace, name)
+	}
+	return &Certificate{
+		Cert: secret.Data[v1.TLSCertKey],
+		Key:  secret.Data[v1.TLSPrivateKeyKey],
+		CA:   secret.Data[CACertificateKey],
+	}, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the certificate chain.
+func (c *Certificate) Fingerprint() string {
+	hash := sha256.Sum256(c.Cert)
+	return hex.EncodeToString(hash[:])
+}
+
+// Validate checks that the certificate matches its private key, has not expired and is valid for a set of hosts.
+//   params:
+//     hosts The hosts to be served with the certificate.
+//   returns:
+//     The leaf certificate.
+//     An error if the certificate cannot be used.
+func (c *Certificate) Validate(hosts []string) (*x509.Certificate, derrors.Error) {
+	pair, err := tls.X509KeyPair(c.Cert, c.Key)
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("certificate does not match its private key", err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse certificate", err)
+	}
+	if time.Now().After(leaf.NotAfter) {
+		return nil, derrors.NewFailedPreconditionError("certificate has expired").WithParams(leaf.NotAfter.String())
+	}
+	for _, host := range hosts {
+		if err := leaf.VerifyHostname(host); err != nil {
+			return nil, derrors.NewFailedPreconditionError("certificate is not valid for host", err).WithParams(host)
+		}
+	}
+	return leaf, nil
+}
+
+// SyncCertificate structure with the certificate to be copied and its destination.
+type SyncCertificate struct {
+	Kubernetes
+	// SourceKubeConfigPath with the kubeconfig of the cluster with the source secret. If not set, the cluster where
+	// the installer runs is used.
+	SourceKubeConfigPath string `json:"source_kube_config_path"`
+	// Source with the namespace/name of the secret with the certificate.
+	Source string `json:"source"`
+	// CertPath with the certificate chain, used instead of the source secret if set.
+	CertPath string `json:"cert_path"`
+	// PrivateKeyPath with the private key of CertPath.
+	PrivateKeyPath string `json:"private_key_path"`
+	// CAPath with the certificate of the issuer of CertPath, such as the internal CA, copied with the certificate.
+	CAPath string `json:"ca_path"`
+	// Namespaces where the certificate is copied.
+	Namespaces []string `json:"namespaces"`
+	// SecretName of the copies, the name of the source secret if not set.
+	SecretName string `json:"secret_name"`
+	// Hosts that must be covered by the certificate, such as the hosts of the ingresses of the cluster.
+	Hosts []string `json:"hosts"`
+}
+
+// NewSyncCertificate creates a new SyncCertificate command copying a secret of the cluster where the installer runs.
+func NewSyncCertificate(kubeConfigPath string, source string, namespaces []string) *SyncCertificate {
+	return &SyncCertificate{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.SyncCertificate),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Source:     source,
+		Namespaces: namespaces,
+	}
+}
+
+// NewSyncCertificateFromJSON creates a new SyncCertificate command from a raw JSON representation.
+func NewSyncCertificateFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	sc := &SyncCertificate{}
+	if err := json.Unmarshal(raw, &sc); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	sc.CommandID = entities.GenerateCommandID(sc.Name())
+	var r entities.Command = sc
+	return &r, nil
+}
+
+// SplitSecretReference splits a namespace/name reference to a secret.
+func SplitSecretReference(reference string) (string, string, derrors.Error) {
+	parts := strings.SplitN(reference, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", derrors.NewInvalidArgumentError("secret reference must be namespace/name").WithParams(reference)
+	}
+	return parts[0], parts[1], nil
+}
+
+// secretName returns the name of the copies.
+func (sc *SyncCertificate) secretName() string {
+	if sc.SecretName == "" && sc.CertPath == "" {
+		_, name, _ := SplitSecretReference(sc.Source)
+		return name
+	}
+	return sc.SecretName
+}
+
+// source returns a description of the origin of the certificate.
+func (sc *SyncCertificate) source() string {
+	if sc.CertPath != "" {
+		return sc.CertPath
+	}
+	return sc.Source
+}
+
+// loadCertificate reads the certificate from the files or the source secret.
+func (sc *SyncCertificate) loadCertificate() (*Certificate, derrors.Error) {
+	if sc.CertPath != "" {
+		certificate, err := LoadCertificateFiles(sc.CertPath, sc.PrivateKeyPath)
+		if err != nil || sc.CAPath == "" {
+			return certificate, err
+		}
+		ca, rErr := ioutil.ReadFile(sc.CAPath)
+		if rErr != nil {
+			return nil, derrors.AsError(rErr, "cannot load CA content")
+		}
+		certificate.CA = ca
+		return certificate, nil
+	}
+	namespace, name, err := SplitSecretReference(sc.Source)
+	if err != nil {
+		return nil, err
+	}
+	source := &Kubernetes{KubeConfigPath: sc.SourceKubeConfigPath}
+	if err := source.Connect(); err != nil {
+		return nil, err
+	}
+	return source.LoadCertificateSecret(namespace, name)
+}
+
+// syncNamespace copies the certificate to a namespace unless the copy is up to date.
+//   returns:
+//     Whether the copy has been created or updated.
+//     An error if the copy cannot be written.
+func (sc *SyncCertificate) syncNamespace(namespace string, certificate *Certificate, leaf *x509.Certificate) (bool, derrors.Error) {
+	fingerprint := certificate.Fingerprint()
+	secrets := sc.Client.CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(sc.secretName(), metaV1.GetOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return false, AsQueryError(err, "cannot retrieve secret", namespace, sc.secretName())
+	}
+	exists := err == nil
+	if exists && secret.Annotations[CertificateFingerprintAnnotation] == fingerprint {
+		return false, nil
+	}
+	if !exists {
+		secret = &v1.Secret{
+			ObjectMeta: metaV1.ObjectMeta{Name: sc.secretName(), Namespace: namespace},
+			Type:       v1.SecretTypeTLS,
+		}
+	} else if secret.Type != v1.SecretTypeTLS {
+		return false, derrors.NewFailedPreconditionError("secret exists and is not a TLS secret").
+			WithParams(namespace, sc.secretName())
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string, 0)
+	}
+	secret.Annotations[CertificateFingerprintAnnotation] = fingerprint
+	secret.Annotations[CertificateSourceAnnotation] = sc.source()
+	secret.Annotations[CertificateExpirationAnnotation] = leaf.NotAfter.UTC().Format(time.RFC3339)
+	secret.Data = map[string][]byte{
+		v1.TLSCertKey:       certificate.Cert,
+		v1.TLSPrivateKeyKey: certificate.Key,
+	}
+	if len(certificate.CA) > 0 {
+		secret.Data[CACertificateKey] = certificate.CA
+	}
+	if exists {
+		_, err = secrets.Update(secret)
+	} else {
+		_, err = secrets.Create(secret)
+	}
+	if err != nil {
+		return false, AsQueryError(err, "cannot write certificate secret", namespace, sc.secretName())
+	}
+	return true, nil
+}
+
+// Run the current command.
+//   returns:
+//     The CommandResult
+//     An error if the command execution fails
+func (sc *SyncCertificate) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	if sc.CertPath == "" {
+		if _, _, err := SplitSecretReference(sc.Source); err != nil {
+			return nil, err
+		}
+	}
+	if sc.secretName() == "" {
+		return nil, derrors.NewInvalidArgumentError("secret_name must be set when the certificate is read from files")
+	}
+	connectErr := sc.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	certificate, err := sc.loadCertificate()
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot load certificate", err), nil
+	}
+	leaf, err := certificate.Validate(sc.Hosts)
+	if err != nil {
+		return entities.NewCommandResult(false, errors.Coded(errors.CertInvalid, "invalid certificate"), err), nil
+	}
+	updated := 0
+	for _, namespace := range sc.Namespaces {
+		if err := sc.EnsureNamespace(namespace, NamespaceOptions{}); err != nil {
+			return nil, err
+		}
+		changed, err := sc.syncNamespace(namespace, certificate, leaf)
+		if err != nil {
+			return entities.NewCommandResult(false, "cannot sync certificate", err), nil
+		}
+		if changed {
+			updated++
+			log.Info().Str("namespace", namespace).Str("secret", sc.secretName()).Str("source", sc.source()).
+				Time("expiration", leaf.NotAfter).Msg("certificate synced")
+		}
+	}
+	msg := fmt.Sprintf("certificate %s synced to %d namespaces, %d up to date", sc.secretName(), updated,
+		len(sc.Namespaces)-updated)
+	return entities.NewSuccessCommand([]byte(msg)), nil
+}
+
+// String returns a string representation
+func (sc *SyncCertificate) String() string {
+	return fmt.Sprintf("SYNC SyncCertificate %s to %s", sc.source(), strings.Join(sc.Namespaces, ","))
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (sc *SyncCertificate) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + sc.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (sc *SyncCertificate) UserString() string {
+	return fmt.Sprintf("Syncing certificate %s", sc.secretName())
+}
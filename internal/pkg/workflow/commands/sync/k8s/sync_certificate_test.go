@@ -0,0 +1,166 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package k8s
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newTestCertificate creates a self-signed certificate for a set of DNS names.
+func newTestCertificate(notAfter time.Time, dnsNames ...string) *Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	gomega.Expect(err).To(gomega.Succeed())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	gomega.Expect(err).To(gomega.Succeed())
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	gomega.Expect(err).To(gomega.Succeed())
+	return &Certificate{
+		Cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Key:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+// newCertificateSecret creates the secret of a certificate issued by cert-manager.
+func newCertificateSecret(certificate *Certificate) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{Name: "ingress-cert", Namespace: "istio-system"},
+		Type:       v1.SecretTypeTLS,
+		Data:       map[string][]byte{v1.TLSCertKey: certificate.Cert, v1.TLSPrivateKeyKey: certificate.Key},
+	}
+}
+
+var _ = ginkgo.Describe("A SyncCertificate command", func() {
+
+	var management *k8stest.FakeCluster
+	var appCluster *k8stest.FakeCluster
+	var certificate *Certificate
+
+	ginkgo.BeforeEach(func() {
+		certificate = newTestCertificate(time.Now().Add(24*time.Hour), "*.nalej.tech")
+		management = newFakeCluster(newCertificateSecret(certificate))
+		appCluster = newFakeCluster()
+	})
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(management.KubeConfigPath)
+		UnregisterClients(appCluster.KubeConfigPath)
+	})
+
+	newCommand := func() *SyncCertificate {
+		cmd := NewSyncCertificate(appCluster.KubeConfigPath, "istio-system/ingress-cert", []string{"nalej", "apps"})
+		cmd.SourceKubeConfigPath = management.KubeConfigPath
+		cmd.Hosts = []string{"appcluster.nalej.tech"}
+		return cmd
+	}
+
+	getCopy := func(namespace string) *v1.Secret {
+		secret, err := appCluster.Client.CoreV1().Secrets(namespace).Get("ingress-cert", metaV1.GetOptions{})
+		gomega.Expect(err).To(gomega.Succeed())
+		return secret
+	}
+
+	ginkgo.It("should copy the certificate to the namespaces of the cluster", func() {
+		result, err := newCommand().Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(result.Output).To(gomega.ContainSubstring("synced to 2 namespaces, 0 up to date"))
+		for _, namespace := range []string{"nalej", "apps"} {
+			copied := getCopy(namespace)
+			gomega.Expect(copied.Type).To(gomega.Equal(v1.SecretTypeTLS))
+			gomega.Expect(copied.Data[v1.TLSCertKey]).To(gomega.Equal(certificate.Cert))
+			gomega.Expect(copied.Annotations).To(gomega.HaveKeyWithValue(CertificateFingerprintAnnotation, certificate.Fingerprint()))
+			gomega.Expect(copied.Annotations).To(gomega.HaveKeyWithValue(CertificateSourceAnnotation, "istio-system/ingress-cert"))
+		}
+	})
+
+	ginkgo.It("should only update the copies when the certificate is renewed", func() {
+		_, err := newCommand().Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		result, err := newCommand().Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Output).To(gomega.ContainSubstring("synced to 0 namespaces, 2 up to date"))
+
+		renewed := newTestCertificate(time.Now().Add(48*time.Hour), "*.nalej.tech")
+		_, uErr := management.Client.CoreV1().Secrets("istio-system").Update(newCertificateSecret(renewed))
+		gomega.Expect(uErr).To(gomega.Succeed())
+		result, err = newCommand().Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Output).To(gomega.ContainSubstring("synced to 2 namespaces, 0 up to date"))
+		gomega.Expect(getCopy("nalej").Data[v1.TLSCertKey]).To(gomega.Equal(renewed.Cert))
+	})
+
+	ginkgo.It("should copy the CA of a certificate read from files", func() {
+		dir, tErr := ioutil.TempDir("", "certificate")
+		gomega.Expect(tErr).To(gomega.Succeed())
+		defer os.RemoveAll(dir)
+		ca := newTestCertificate(time.Now().Add(24*time.Hour), "Nalej internal CA")
+		files := map[string][]byte{"tls.crt": certificate.Cert, "tls.key": certificate.Key, "ca.crt": ca.Cert}
+		for name, content := range files {
+			gomega.Expect(ioutil.WriteFile(filepath.Join(dir, name), content, 0600)).To(gomega.Succeed())
+		}
+		cmd := NewSyncCertificate(appCluster.KubeConfigPath, "", []string{"nalej"})
+		cmd.CertPath = filepath.Join(dir, "tls.crt")
+		cmd.PrivateKeyPath = filepath.Join(dir, "tls.key")
+		cmd.CAPath = filepath.Join(dir, "ca.crt")
+		cmd.SecretName = "ingress-cert"
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(getCopy("nalej").Data[CACertificateKey]).To(gomega.Equal(ca.Cert))
+	})
+
+	ginkgo.It("should reject certificates that do not cover the hosts of the cluster", func() {
+		cmd := newCommand()
+		cmd.Hosts = []string{"appcluster.other.tech"}
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+		_, gErr := appCluster.Client.CoreV1().Secrets("nalej").Get("ingress-cert", metaV1.GetOptions{})
+		gomega.Expect(gErr).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject expired certificates", func() {
+		expired := newTestCertificate(time.Now().Add(-time.Minute), "*.nalej.tech")
+		_, err := expired.Validate(nil)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		_, err = certificate.Validate([]string{"nalej.tech"})
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+})
@@ -24,7 +24,6 @@ import (
 	"k8s.io/api/core/v1"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 const KubeSystemNamespace = "kube-system"
@@ -44,7 +43,7 @@ func NewTestCleaner(kubeConfigPath string, namespaces ...string) *TestCleaner {
 
 func (tc *TestCleaner) Connect() derrors.Error {
 
-	config, err := clientcmd.BuildConfigFromFlags("", tc.KubeConfigPath)
+	config, err := buildConfig(tc.KubeConfigPath, "")
 	if err != nil {
 		log.Error().Err(err).Msg("error building configuration from kubeconfig")
 		return derrors.AsError(err, "error building configuration from kubeconfig")
@@ -61,42 +60,16 @@ func (tc *TestCleaner) Connect() derrors.Error {
 	return nil
 }
 
+// DeleteAll purges the namespaces of the cleaner and the objects labeled with a cluster, such as those created on
+// kube-system.
 func (tc *TestCleaner) DeleteAll() derrors.Error {
-	err := tc.DeleteDeployments()
-	if err != nil {
-		return err
-	}
-	err = tc.DeleteServices()
-	if err != nil {
-		return err
-	}
-	err = tc.DeleteServiceAccounts()
-	if err != nil {
-		return err
-	}
-	err = tc.DeleteClusterRoles()
-	if err != nil {
-		return err
-	}
-	err = tc.DeleteRoles()
-	if err != nil {
-		return err
-	}
-	err = tc.DeleteRoleBindings()
-	if err != nil {
-		return err
-	}
-	err = tc.DeleteClusterRoleBindings()
-	if err != nil {
-		return err
-	}
-	err = tc.DeleteConfigMaps()
-	if err != nil {
+	if _, err := NewPurgeByLabel(tc.KubeConfigPath, "cluster").Report(); err != nil {
 		return err
 	}
-	err = tc.DeleteNamespaces()
-	if err != nil {
-		return err
+	if len(tc.Namespaces) > 0 {
+		if _, err := NewPurgeNamespace(tc.KubeConfigPath, tc.Namespaces...).Report(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -467,7 +440,7 @@ func NewTestK8sUtils(kubeConfigPath string) *TestK8sUtils {
 
 func (tu *TestK8sUtils) Connect() derrors.Error {
 
-	config, err := clientcmd.BuildConfigFromFlags("", tu.KubeConfigPath)
+	config, err := buildConfig(tu.KubeConfigPath, "")
 	if err != nil {
 		log.Error().Err(err).Msg("error building configuration from kubeconfig")
 		return derrors.AsError(err, "error building configuration from kubeconfig")
@@ -484,37 +457,10 @@ func (tu *TestK8sUtils) Connect() derrors.Error {
 	return nil
 }
 
+// CreateNamespace creates a namespace if it does not exist.
 func (tu *TestK8sUtils) CreateNamespace(name string) derrors.Error {
-	namespaceClient := tu.Client.CoreV1().Namespaces()
-	opts := metaV1.ListOptions{}
-	list, err := namespaceClient.List(opts)
-	if err != nil {
-		return derrors.AsError(err, "cannot obtain the namespace list")
-	}
-	found := false
-	for _, n := range list.Items {
-		log.Debug().Interface("n", n).Msg("A namespace")
-		if n.Name == name {
-			found = true
-			break
-		}
-	}
-
-	if !found {
-		toCreate := v1.Namespace{
-			ObjectMeta: metaV1.ObjectMeta{
-				Name: name,
-			},
-		}
-		created, err := namespaceClient.Create(&toCreate)
-		if err != nil {
-			return derrors.AsError(err, "cannot create namespace")
-		}
-		log.Debug().Interface("created", created).Msg("namespaces has been created")
-	} else {
-		log.Debug().Str("namespace", name).Msg("namespace already exists")
-	}
-	return nil
+	k := &Kubernetes{Client: tu.Client}
+	return k.EnsureNamespace(name, NamespaceOptions{})
 }
 
 type TestChecker struct {
@@ -530,7 +476,7 @@ func NewTestChecker(kubeConfigPath string) *TestChecker {
 
 func (tc *TestChecker) Connect() derrors.Error {
 
-	config, err := clientcmd.BuildConfigFromFlags("", tc.KubeConfigPath)
+	config, err := buildConfig(tc.KubeConfigPath, "")
 	if err != nil {
 		log.Error().Err(err).Msg("error building configuration from kubeconfig")
 		return derrors.AsError(err, "error building configuration from kubeconfig")
@@ -0,0 +1,483 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the resize of the persistent volume claims whose size is increased by a new version of the
+// components. The claims are expanded when their storage class allows it, or migrated to a new claim otherwise.
+
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/rs/zerolog/log"
+	batchV1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// DefaultVolumeMigrationImage is the image of the Jobs copying the data of the migrated claims.
+const DefaultVolumeMigrationImage = "busybox:1.31"
+
+// DefaultVolumeMigrationTimeout is the maximum time to migrate a claim if no timeout is specified.
+const DefaultVolumeMigrationTimeout = 30 * time.Minute
+
+// VolumeMigrationSuffix is the suffix of the temporary claim holding the data of a claim being migrated.
+const VolumeMigrationSuffix = "-migration"
+
+// VolumeMigrationReplicasAnnotation is the annotation of the temporary claim with the replicas of the workloads
+// scaled down by the migration, so an interrupted migration restores them once resumed.
+const VolumeMigrationReplicasAnnotation = "installer.nalej.com/migration-replicas"
+
+// claimSize returns the storage requested by a claim.
+func claimSize(claim *v1.PersistentVolumeClaim) resource.Quantity {
+	return claim.Spec.Resources.Requests[v1.ResourceStorage]
+}
+
+// StorageClassExpands checks if the volume of a claim can be expanded, as its storage class allows it.
+func (k *Kubernetes) StorageClassExpands(claim *v1.PersistentVolumeClaim) (bool, derrors.Error) {
+	if claim.Spec.StorageClassName == nil || *claim.Spec.StorageClassName == "" {
+		return false, nil
+	}
+	class, err := k.Client.StorageV1().StorageClasses().Get(*claim.Spec.StorageClassName, metaV1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, AsQueryError(err, "cannot retrieve storage class", *claim.Spec.StorageClassName)
+	}
+	return class.AllowVolumeExpansion != nil && *class.AllowVolumeExpansion, nil
+}
+
+// migrationTimeout returns the maximum time to migrate a claim.
+func (lc *LaunchComponents) migrationTimeout() time.Duration {
+	if lc.VolumeMigrationTimeout <= 0 {
+		return DefaultVolumeMigrationTimeout
+	}
+	return time.Duration(lc.VolumeMigrationTimeout) * time.Second
+}
+
+// migrationImage returns the image of the Jobs copying the data of the migrated claims.
+func (lc *LaunchComponents) migrationImage() string {
+	if lc.VolumeMigrationImage == "" {
+		return DefaultVolumeMigrationImage
+	}
+	return lc.VolumeMigrationImage
+}
+
+// resizeVolumes compares the size of the claims of the components with the existing ones. Increased claims are
+// expanded by the launch if their storage class allows it, and migrated if enabled otherwise. Claims cannot shrink,
+// so decreased claims keep their current size. Migrations interrupted by a previous launch are resumed first.
+func (lc *LaunchComponents) resizeVolumes(objects map[string]runtime.Object, options ApplyOptions) derrors.Error {
+	fileNames := make([]string, 0, len(objects))
+	for fileName := range objects {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	for _, fileName := range fileNames {
+		desired, ok := objects[fileName].(*v1.PersistentVolumeClaim)
+		if !ok {
+			continue
+		}
+		temporary, err := lc.Client.CoreV1().PersistentVolumeClaims(desired.Namespace).Get(desired.Name+VolumeMigrationSuffix, metaV1.GetOptions{})
+		if err == nil {
+			if !lc.MigrateVolumes {
+				return derrors.NewFailedPreconditionError(errors.Coded(errors.VolumeMigrationInterrupted,
+					"persistent volume claim migration must be resumed")).WithParams(desired.Namespace, desired.Name, temporary.Name)
+			}
+			if err := lc.ResumeVolumeMigration(temporary, desired, lc.migrationImage(), options, lc.migrationTimeout()); err != nil {
+				return err
+			}
+			continue
+		}
+		if !k8sErrors.IsNotFound(err) {
+			return AsQueryError(err, "cannot retrieve persistent volume claim", desired.Namespace, desired.Name+VolumeMigrationSuffix)
+		}
+		existing, err := lc.Client.CoreV1().PersistentVolumeClaims(desired.Namespace).Get(desired.Name, metaV1.GetOptions{})
+		if err != nil {
+			if k8sErrors.IsNotFound(err) {
+				continue
+			}
+			return AsQueryError(err, "cannot retrieve persistent volume claim", desired.Namespace, desired.Name)
+		}
+		current := claimSize(existing)
+		requested := claimSize(desired)
+		switch requested.Cmp(current) {
+		case 0:
+			continue
+		case -1:
+			log.Warn().Str("namespace", desired.Namespace).Str("name", desired.Name).Str("current", current.String()).
+				Str("requested", requested.String()).Msg("persistent volume claims cannot shrink, keeping the current size")
+			if desired.Spec.Resources.Requests == nil {
+				desired.Spec.Resources.Requests = v1.ResourceList{}
+			}
+			desired.Spec.Resources.Requests[v1.ResourceStorage] = current
+			continue
+		}
+		expands, eErr := lc.StorageClassExpands(existing)
+		if eErr != nil {
+			return eErr
+		}
+		if expands {
+			log.Info().Str("namespace", desired.Namespace).Str("name", desired.Name).Str("current", current.String()).
+				Str("requested", requested.String()).Msg("expanding persistent volume claim")
+			continue
+		}
+		if !lc.MigrateVolumes {
+			return derrors.NewFailedPreconditionError(errors.Coded(errors.VolumeNotExpandable,
+				"persistent volume claim cannot be expanded")).WithParams(desired.Namespace, desired.Name, current.String(), requested.String())
+		}
+		if err := lc.MigrateVolume(existing, desired, lc.migrationImage(), options, lc.migrationTimeout()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateVolume replaces a claim by a new one, copying its data. The Deployments and StatefulSets using the claim are
+// scaled to zero during the migration. The data is copied to a temporary claim, the claim is recreated with the
+// desired spec, and the data is copied back.
+//   params:
+//     existing The claim to be migrated.
+//     desired The new claim, with the same name.
+//     image The image of the Jobs copying the data.
+//     options The options of the apply of the new claim.
+//     timeout The maximum time of the migration.
+//   returns:
+//     An error if any of the steps fails. The temporary claim is kept so the data can be recovered. If the claim was
+//     already deleted, the workloads are kept at zero replicas so the migration can be resumed.
+func (k *Kubernetes) MigrateVolume(existing *v1.PersistentVolumeClaim, desired *v1.PersistentVolumeClaim, image string, options ApplyOptions, timeout time.Duration) derrors.Error {
+	log.Info().Str("namespace", existing.Namespace).Str("name", existing.Name).Msg("migrating persistent volume claim")
+	scaled, err := k.scaleDownClaimUsers(existing.Namespace, existing.Name)
+	if err != nil {
+		return err
+	}
+	return k.completeMigration(existing, desired, scaled, image, options, time.Now().Add(timeout))
+}
+
+// ResumeVolumeMigration completes the migration of a claim interrupted by a previous launch. If the claim still has
+// its previous size, its data was not deleted and the migration starts over. Otherwise the data is copied back from
+// the temporary claim.
+//   params:
+//     temporary The temporary claim of the migration.
+//     desired The new claim.
+//     image The image of the Jobs copying the data.
+//     options The options of the apply of the new claim.
+//     timeout The maximum time of the migration.
+//   returns:
+//     An error if any of the steps fails.
+func (k *Kubernetes) ResumeVolumeMigration(temporary *v1.PersistentVolumeClaim, desired *v1.PersistentVolumeClaim, image string, options ApplyOptions, timeout time.Duration) derrors.Error {
+	namespace := desired.Namespace
+	log.Info().Str("namespace", namespace).Str("name", desired.Name).Str("temporary", temporary.Name).
+		Msg("resuming persistent volume claim migration")
+	scaled := make(map[string]int32, 0)
+	if recorded, found := temporary.Annotations[VolumeMigrationReplicasAnnotation]; found {
+		if err := json.Unmarshal([]byte(recorded), &scaled); err != nil {
+			return derrors.NewInternalError("cannot read the replicas of the migration", err).WithParams(namespace, temporary.Name)
+		}
+	}
+	running, err := k.scaleDownClaimUsers(namespace, desired.Name)
+	if err != nil {
+		return err
+	}
+	for workload, replicas := range running {
+		scaled[workload] = replicas
+	}
+	existing, gErr := k.Client.CoreV1().PersistentVolumeClaims(namespace).Get(desired.Name, metaV1.GetOptions{})
+	if gErr != nil {
+		if !k8sErrors.IsNotFound(gErr) {
+			return AsQueryError(gErr, "cannot retrieve persistent volume claim", namespace, desired.Name)
+		}
+		existing = nil
+	} else if requested, current := claimSize(desired), claimSize(existing); requested.Cmp(current) == 0 {
+		// The claim was already recreated, so its data is only kept in the temporary claim.
+		existing = nil
+	}
+	return k.completeMigration(existing, desired, scaled, image, options, time.Now().Add(timeout))
+}
+
+// completeMigration runs the steps of a migration and restores the replicas of the workloads, unless the claim was
+// deleted and its data is only kept in the temporary claim.
+//   params:
+//     existing The claim to be migrated, nil if it was already deleted.
+//     desired The new claim.
+//     scaled The replicas of the workloads scaled down by the migration.
+//     image The image of the Jobs copying the data.
+//     options The options of the apply of the new claim.
+//     deadline The maximum time of the migration.
+//   returns:
+//     An error if any of the steps fails.
+func (k *Kubernetes) completeMigration(existing *v1.PersistentVolumeClaim, desired *v1.PersistentVolumeClaim, scaled map[string]int32, image string, options ApplyOptions, deadline time.Time) derrors.Error {
+	namespace := desired.Namespace
+	temporaryName := desired.Name + VolumeMigrationSuffix
+	deleted, migrateErr := k.migrateClaim(existing, desired, scaled, image, options, deadline)
+	if migrateErr != nil && deleted {
+		log.Error().Str("namespace", namespace).Str("name", desired.Name).Str("temporary", temporaryName).
+			Interface("scaled", scaled).Msg("persistent volume claim migration interrupted, the workloads are kept stopped")
+		return derrors.NewInternalError(errors.Coded(errors.VolumeMigrationInterrupted,
+			"persistent volume claim migration interrupted, the data is kept in the temporary claim"), migrateErr).
+			WithParams(namespace, desired.Name, temporaryName)
+	}
+	if restoreErr := k.restoreReplicas(namespace, scaled); restoreErr != nil {
+		if migrateErr != nil {
+			log.Warn().Str("trace", restoreErr.DebugReport()).Msg("cannot restore the replicas of the workloads")
+			return migrateErr
+		}
+		return restoreErr
+	}
+	return migrateErr
+}
+
+// migrateClaim copies the data of a claim to a temporary one, recreates the claim and copies the data back. The
+// first copy is skipped if the claim was already deleted.
+//   returns:
+//     Whether the claim was deleted, so its data is only kept in the temporary claim.
+//     An error if any of the steps fails.
+func (k *Kubernetes) migrateClaim(existing *v1.PersistentVolumeClaim, desired *v1.PersistentVolumeClaim, scaled map[string]int32, image string, options ApplyOptions, deadline time.Time) (bool, derrors.Error) {
+	namespace := desired.Namespace
+	temporaryName := desired.Name + VolumeMigrationSuffix
+	claims := k.Client.CoreV1().PersistentVolumeClaims(namespace)
+	summary := &ApplySummary{}
+	if existing != nil {
+		if err := k.waitClaimUnused(namespace, existing.Name, deadline); err != nil {
+			return false, err
+		}
+		recorded, mErr := json.Marshal(scaled)
+		if mErr != nil {
+			return false, derrors.NewInternalError("cannot record the replicas of the migration", mErr)
+		}
+		temporary := desired.DeepCopy()
+		temporary.ObjectMeta = metaV1.ObjectMeta{Name: temporaryName, Namespace: namespace,
+			Annotations: map[string]string{VolumeMigrationReplicasAnnotation: string(recorded)}}
+		temporary.Spec.VolumeName = ""
+		if err := k.Apply(temporary, ApplyOptions{}, summary); err != nil {
+			return false, err
+		}
+		if err := k.copyVolume(namespace, existing.Name, temporaryName, image, deadline); err != nil {
+			return false, err
+		}
+		if err := claims.Delete(existing.Name, &metaV1.DeleteOptions{}); err != nil && !k8sErrors.IsNotFound(err) {
+			return false, derrors.NewInternalError("cannot delete persistent volume claim", err).WithParams(namespace, existing.Name)
+		}
+		if err := k.waitClaimDeleted(namespace, existing.Name, deadline); err != nil {
+			return true, err
+		}
+	}
+	recreated := desired.DeepCopy()
+	recreated.Spec.VolumeName = ""
+	if err := k.Apply(recreated, options, summary); err != nil {
+		return true, err
+	}
+	if err := k.copyVolume(namespace, temporaryName, desired.Name, image, deadline); err != nil {
+		return true, err
+	}
+	if err := claims.Delete(temporaryName, &metaV1.DeleteOptions{}); err != nil && !k8sErrors.IsNotFound(err) {
+		return true, derrors.NewInternalError("cannot delete temporary persistent volume claim", err).WithParams(namespace, temporaryName)
+	}
+	log.Info().Str("namespace", namespace).Str("name", desired.Name).Msg("persistent volume claim migrated")
+	return true, nil
+}
+
+// volumeCopyJob returns the Job copying the content of a claim to another one.
+func volumeCopyJob(namespace string, source string, target string, image string) *batchV1.Job {
+	backoffLimit := int32(2)
+	return &batchV1.Job{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      fmt.Sprintf("copy-%s-to-%s", source, target),
+			Namespace: namespace,
+		},
+		Spec: batchV1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					RestartPolicy: v1.RestartPolicyNever,
+					Containers: []v1.Container{{
+						Name:    "copy",
+						Image:   image,
+						Command: []string{"/bin/sh", "-c", "cp -a /source/. /target/"},
+						VolumeMounts: []v1.VolumeMount{
+							{Name: "source", MountPath: "/source", ReadOnly: true},
+							{Name: "target", MountPath: "/target"},
+						},
+					}},
+					Volumes: []v1.Volume{
+						{Name: "source", VolumeSource: v1.VolumeSource{
+							PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: source, ReadOnly: true}}},
+						{Name: "target", VolumeSource: v1.VolumeSource{
+							PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: target}}},
+					},
+				},
+			},
+		},
+	}
+}
+
+// copyVolume runs a Job copying the content of a claim to another one, and removes it once finished. Failed Jobs are
+// also removed, so a resumed migration runs the copy again.
+func (k *Kubernetes) copyVolume(namespace string, source string, target string, image string, deadline time.Time) derrors.Error {
+	job := volumeCopyJob(namespace, source, target, image)
+	if err := k.Apply(job, ApplyOptions{}, &ApplySummary{}); err != nil {
+		return err
+	}
+	logs, err := k.WaitJob(job, time.Until(deadline), DefaultWaitInterval, DefaultJobLogLines)
+	propagation := metaV1.DeletePropagationBackground
+	if dErr := k.Client.BatchV1().Jobs(namespace).Delete(job.Name, &metaV1.DeleteOptions{PropagationPolicy: &propagation}); dErr != nil && !k8sErrors.IsNotFound(dErr) {
+		if err != nil {
+			log.Warn().Err(dErr).Str("namespace", namespace).Str("name", job.Name).Msg("cannot delete copy job")
+		} else {
+			return derrors.NewInternalError("cannot delete copy job", dErr).WithParams(namespace, job.Name)
+		}
+	}
+	if err != nil {
+		return derrors.NewInternalError("cannot copy the persistent volume claim", err).WithParams(namespace, source, target, logs)
+	}
+	return nil
+}
+
+// usesClaim checks if the pods of a template mount a claim.
+func usesClaim(spec v1.PodSpec, claim string) bool {
+	for _, volume := range spec.Volumes {
+		if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == claim {
+			return true
+		}
+	}
+	return false
+}
+
+// scaleDownClaimUsers scales to zero the Deployments and StatefulSets mounting a claim.
+//   returns:
+//     The replicas of the scaled workloads, indexed by kind and name.
+//     An error if the workloads cannot be listed or scaled.
+func (k *Kubernetes) scaleDownClaimUsers(namespace string, claim string) (map[string]int32, derrors.Error) {
+	scaled := make(map[string]int32, 0)
+	deployments, err := k.Client.AppsV1().Deployments(namespace).List(metaV1.ListOptions{})
+	if err != nil {
+		return nil, derrors.NewInternalError("cannot list deployments", err).WithParams(namespace)
+	}
+	for _, deployment := range deployments.Items {
+		if usesClaim(deployment.Spec.Template.Spec, claim) && (deployment.Spec.Replicas == nil || *deployment.Spec.Replicas > 0) {
+			replicas := int32(1)
+			if deployment.Spec.Replicas != nil {
+				replicas = *deployment.Spec.Replicas
+			}
+			scaled["Deployment/"+deployment.Name] = replicas
+		}
+	}
+	statefulSets, err := k.Client.AppsV1().StatefulSets(namespace).List(metaV1.ListOptions{})
+	if err != nil {
+		return nil, derrors.NewInternalError("cannot list statefulsets", err).WithParams(namespace)
+	}
+	for _, statefulSet := range statefulSets.Items {
+		if usesClaim(statefulSet.Spec.Template.Spec, claim) && (statefulSet.Spec.Replicas == nil || *statefulSet.Spec.Replicas > 0) {
+			replicas := int32(1)
+			if statefulSet.Spec.Replicas != nil {
+				replicas = *statefulSet.Spec.Replicas
+			}
+			scaled["StatefulSet/"+statefulSet.Name] = replicas
+		}
+	}
+	for workload := range scaled {
+		if err := k.scaleWorkload(namespace, workload, 0); err != nil {
+			return nil, err
+		}
+	}
+	return scaled, nil
+}
+
+// restoreReplicas sets back the replicas of the workloads scaled down during a migration.
+func (k *Kubernetes) restoreReplicas(namespace string, scaled map[string]int32) derrors.Error {
+	for workload, replicas := range scaled {
+		if err := k.scaleWorkload(namespace, workload, replicas); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scaleWorkload sets the replicas of a Deployment or StatefulSet identified by kind and name.
+func (k *Kubernetes) scaleWorkload(namespace string, workload string, replicas int32) derrors.Error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas))
+	parts := strings.SplitN(workload, "/", 2)
+	kind, name := parts[0], parts[1]
+	var err error
+	if kind == "Deployment" {
+		_, err = k.Client.AppsV1().Deployments(namespace).Patch(name, types.MergePatchType, patch)
+	} else {
+		_, err = k.Client.AppsV1().StatefulSets(namespace).Patch(name, types.MergePatchType, patch)
+	}
+	if err != nil {
+		return derrors.NewInternalError("cannot scale workload", err).WithParams(kind, namespace, name, replicas)
+	}
+	log.Info().Str("kind", kind).Str("namespace", namespace).Str("name", name).Int32("replicas", replicas).Msg("scaled")
+	return nil
+}
+
+// waitClaimUnused waits until no running pod mounts a claim.
+func (k *Kubernetes) waitClaimUnused(namespace string, claim string, deadline time.Time) derrors.Error {
+	for {
+		pods, err := k.Client.CoreV1().Pods(namespace).List(metaV1.ListOptions{})
+		if err != nil {
+			return derrors.NewInternalError("cannot list pods", err).WithParams(namespace)
+		}
+		users := make([]string, 0)
+		for _, pod := range pods.Items {
+			if pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed && usesClaim(pod.Spec, claim) {
+				users = append(users, pod.Name)
+			}
+		}
+		if len(users) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return derrors.NewUnavailableError(errors.Coded(errors.WaitTimeout,
+				"timeout waiting for the pods using the claim to stop")).WithParams(namespace, claim, users)
+		}
+		log.Debug().Str("namespace", namespace).Str("claim", claim).Strs("pods", users).Msg("waiting for pods to stop")
+		time.Sleep(DefaultWaitInterval)
+	}
+}
+
+// waitClaimDeleted waits until a claim is removed, which happens once its volume is released.
+func (k *Kubernetes) waitClaimDeleted(namespace string, claim string, deadline time.Time) derrors.Error {
+	for {
+		_, err := k.Client.CoreV1().PersistentVolumeClaims(namespace).Get(claim, metaV1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return AsQueryError(err, "cannot retrieve persistent volume claim", namespace, claim)
+		}
+		if time.Now().After(deadline) {
+			return derrors.NewUnavailableError(errors.Coded(errors.WaitTimeout,
+				"timeout waiting for the claim to be deleted")).WithParams(namespace, claim)
+		}
+		time.Sleep(DefaultWaitInterval)
+	}
+}
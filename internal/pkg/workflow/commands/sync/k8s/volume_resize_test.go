@@ -0,0 +1,201 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/grpc-installer-go"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	storageV1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testResizedClaim = `apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+  namespace: nalej
+spec:
+  storageClassName: standard
+  accessModes: ["ReadWriteOnce"]
+  resources:
+    requests:
+      storage: 2Gi
+`
+
+var _ = ginkgo.Describe("The resize of the volumes", func() {
+
+	var cluster *k8stest.FakeCluster
+	var componentsDir string
+
+	ginkgo.BeforeEach(func() {
+		cluster = newFakeCluster()
+		var err error
+		componentsDir, err = ioutil.TempDir("", "volumes")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(ioutil.WriteFile(filepath.Join(componentsDir, "data.yaml"), []byte(testResizedClaim), 0644)).To(gomega.Succeed())
+		className := "standard"
+		existing := &v1.PersistentVolumeClaim{
+			ObjectMeta: metaV1.ObjectMeta{Name: "data", Namespace: "nalej", Labels: map[string]string{ManagedByLabel: ManagedByInstaller}},
+			Spec: v1.PersistentVolumeClaimSpec{
+				StorageClassName: &className,
+				VolumeName:       "pv-data",
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+				},
+			},
+		}
+		gomega.Expect(cluster.Tracker.Add(existing)).To(gomega.Succeed())
+		cluster.SetVersion("1.15")
+	})
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+		gomega.Expect(os.RemoveAll(componentsDir)).To(gomega.Succeed())
+	})
+
+	addClass := func(expands bool) {
+		class := &storageV1.StorageClass{ObjectMeta: metaV1.ObjectMeta{Name: "standard"}, AllowVolumeExpansion: &expands}
+		gomega.Expect(cluster.Tracker.Add(class)).To(gomega.Succeed())
+	}
+
+	launch := func() *LaunchComponents {
+		cmd := NewLaunchComponents(cluster.KubeConfigPath, []string{"nalej"}, componentsDir, grpc_installer_go.Platform_MINIKUBE.String())
+		cmd.Environment = "PRODUCTION"
+		return cmd
+	}
+
+	addDeployment := func() {
+		replicas := int32(3)
+		deployment := &appsV1.Deployment{
+			ObjectMeta: metaV1.ObjectMeta{Name: "database", Namespace: "nalej"},
+			Spec: appsV1.DeploymentSpec{
+				Replicas: &replicas,
+				Template: v1.PodTemplateSpec{Spec: v1.PodSpec{Volumes: []v1.Volume{{Name: "data", VolumeSource: v1.VolumeSource{
+					PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}}}}},
+			},
+		}
+		gomega.Expect(cluster.Tracker.Add(deployment)).To(gomega.Succeed())
+	}
+
+	// finishCopies completes the copy Jobs as they are created, failing the ones in failed.
+	finishCopies := func(failed map[string]bool) *[]string {
+		copies := make([]string, 0)
+		cluster.Dynamic.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			obj := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+			copies = append(copies, obj.GetName())
+			condition := "Complete"
+			if failed[obj.GetName()] {
+				condition = "Failed"
+			}
+			conditions := []interface{}{map[string]interface{}{"type": condition, "status": "True"}}
+			gomega.Expect(unstructured.SetNestedSlice(obj.Object, conditions, "status", "conditions")).To(gomega.Succeed())
+			return false, nil, nil
+		})
+		return &copies
+	}
+
+	replicas := func() int64 {
+		current, _, _ := unstructured.NestedInt64(cluster.ExpectObject("apps/v1", "Deployment", "nalej", "database").Object, "spec", "replicas")
+		return current
+	}
+
+	requestedSize := func(name string) string {
+		obj := cluster.ExpectObject("v1", "PersistentVolumeClaim", "nalej", name)
+		size, _, _ := unstructured.NestedString(obj.Object, "spec", "resources", "requests", "storage")
+		return size
+	}
+
+	ginkgo.It("should expand the claims whose storage class allows it", func() {
+		addClass(true)
+		result, err := launch().Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(requestedSize("data")).To(gomega.Equal("2Gi"))
+	})
+
+	ginkgo.It("should fail if the claim cannot be expanded and the migration is not enabled", func() {
+		addClass(false)
+		result, err := launch().Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+		code, found := errors.ErrorCode(result.Error)
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(code).To(gomega.Equal(errors.VolumeNotExpandable))
+		gomega.Expect(requestedSize("data")).To(gomega.Equal("1Gi"))
+	})
+
+	ginkgo.It("should migrate the claim and restore the workloads using it", func() {
+		addClass(false)
+		addDeployment()
+		copies := finishCopies(nil)
+
+		cmd := launch()
+		cmd.MigrateVolumes = true
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(requestedSize("data")).To(gomega.Equal("2Gi"))
+		gomega.Expect(*copies).To(gomega.Equal([]string{"copy-data-to-data-migration", "copy-data-migration-to-data"}))
+		cluster.ExpectNoObject("v1", "PersistentVolumeClaim", "nalej", "data"+VolumeMigrationSuffix)
+		cluster.ExpectNoObject("batch/v1", "Job", "nalej", "copy-data-to-data-migration")
+		gomega.Expect(replicas()).To(gomega.Equal(int64(3)))
+	})
+
+	ginkgo.It("should keep the workloads stopped if the migration fails once the claim is deleted, and resume it", func() {
+		addClass(false)
+		addDeployment()
+		failed := map[string]bool{"copy-data-migration-to-data": true}
+		copies := finishCopies(failed)
+
+		cmd := launch()
+		cmd.MigrateVolumes = true
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+		code, found := errors.ErrorCode(result.Error)
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(code).To(gomega.Equal(errors.VolumeMigrationInterrupted))
+		gomega.Expect(result.Error.DebugReport()).To(gomega.ContainSubstring("data" + VolumeMigrationSuffix))
+		gomega.Expect(replicas()).To(gomega.BeZero())
+		temporary := cluster.ExpectObject("v1", "PersistentVolumeClaim", "nalej", "data"+VolumeMigrationSuffix)
+		gomega.Expect(temporary.GetAnnotations()).To(gomega.HaveKeyWithValue(VolumeMigrationReplicasAnnotation, `{"Deployment/database":3}`))
+		gomega.Expect(requestedSize("data")).To(gomega.Equal("2Gi"))
+
+		delete(failed, "copy-data-migration-to-data")
+		*copies = (*copies)[:0]
+		result, err = cmd.Run("w2")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(*copies).To(gomega.Equal([]string{"copy-data-migration-to-data"}))
+		cluster.ExpectNoObject("v1", "PersistentVolumeClaim", "nalej", "data"+VolumeMigrationSuffix)
+		gomega.Expect(replicas()).To(gomega.Equal(int64(3)))
+	})
+})
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	appsV1 "k8s.io/api/apps/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultDeploymentTimeout is the time to wait for a deployment to become ready if no timeout is specified.
+const DefaultDeploymentTimeout = 5 * time.Minute
+
+// DeploymentCheckInterval is the time between checks of the status of a deployment.
+const DeploymentCheckInterval = 5 * time.Second
+
+// WaitDeploymentReady structure with the attributes required to wait for the pods of a deployment to be ready.
+type WaitDeploymentReady struct {
+	// Kubernetes embedded object
+	Kubernetes
+	// Namespace of the deployment.
+	Namespace string `json:"namespace"`
+	// DeploymentName with the name of the deployment.
+	DeploymentName string `json:"deployment_name"`
+	// TimeoutSeconds with the maximum time to wait. If not set, DefaultDeploymentTimeout is used.
+	TimeoutSeconds int `json:"timeout"`
+}
+
+// NewWaitDeploymentReady creates a new WaitDeploymentReady command.
+func NewWaitDeploymentReady(kubeConfigPath string, namespace string, deploymentName string, timeoutSeconds int) *WaitDeploymentReady {
+	return &WaitDeploymentReady{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.WaitDeploymentReady),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Namespace:      namespace,
+		DeploymentName: deploymentName,
+		TimeoutSeconds: timeoutSeconds,
+	}
+}
+
+// NewWaitDeploymentReadyFromJSON creates a new WaitDeploymentReady command from a raw JSON representation.
+func NewWaitDeploymentReadyFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	wdr := &WaitDeploymentReady{}
+	if err := json.Unmarshal(raw, &wdr); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	wdr.CommandID = entities.GenerateCommandID(wdr.Name())
+	var r entities.Command = wdr
+	return &r, nil
+}
+
+// timeout returns the maximum time to wait for the deployment.
+func (wdr *WaitDeploymentReady) timeout() time.Duration {
+	if wdr.TimeoutSeconds <= 0 {
+		return DefaultDeploymentTimeout
+	}
+	return time.Duration(wdr.TimeoutSeconds) * time.Second
+}
+
+// Run the current command returning the result or an error.
+func (wdr *WaitDeploymentReady) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := wdr.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	client := wdr.Client.AppsV1().Deployments(wdr.Namespace)
+	deadline := time.Now().Add(wdr.timeout())
+	for {
+		deployment, err := client.Get(wdr.DeploymentName, metaV1.GetOptions{})
+		if err != nil {
+			return entities.NewCommandResult(false, "cannot retrieve deployment", derrors.AsError(err, "cannot retrieve deployment")), nil
+		}
+		if DeploymentReady(deployment) {
+			msg := fmt.Sprintf("deployment %s is ready", wdr.DeploymentName)
+			return entities.NewSuccessCommand([]byte(msg)), nil
+		}
+		if time.Now().After(deadline) {
+			return entities.NewCommandResult(false, "deployment is not ready",
+				derrors.NewUnavailableError(errors.Coded(errors.WaitTimeout, "timeout waiting for deployment")).WithParams(wdr.Namespace, wdr.DeploymentName)), nil
+		}
+		log.Debug().Str("namespace", wdr.Namespace).Str("deployment", wdr.DeploymentName).
+			Int32("ready", deployment.Status.ReadyReplicas).Msg("waiting for deployment")
+		time.Sleep(DeploymentCheckInterval)
+	}
+}
+
+// DeploymentReady checks if the latest version of a deployment has all its replicas ready.
+func DeploymentReady(deployment *appsV1.Deployment) bool {
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return false
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.UpdatedReplicas >= replicas && deployment.Status.ReadyReplicas >= replicas
+}
+
+// String returns a string representation
+func (wdr *WaitDeploymentReady) String() string {
+	return fmt.Sprintf("SYNC WaitDeploymentReady %s/%s", wdr.Namespace, wdr.DeploymentName)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (wdr *WaitDeploymentReady) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + wdr.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (wdr *WaitDeploymentReady) UserString() string {
+	return fmt.Sprintf("Waiting for deployment %s to be ready", wdr.DeploymentName)
+}
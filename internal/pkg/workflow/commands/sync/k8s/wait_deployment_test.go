@@ -0,0 +1,46 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	appsV1 "k8s.io/api/apps/v1"
+)
+
+var _ = ginkgo.Describe("Wait deployment ready", func() {
+
+	ginkgo.It("should wait for the latest generation", func() {
+		replicas := int32(2)
+		deployment := &appsV1.Deployment{}
+		deployment.Generation = 2
+		deployment.Spec.Replicas = &replicas
+		deployment.Status = appsV1.DeploymentStatus{ObservedGeneration: 1, UpdatedReplicas: 2, ReadyReplicas: 2}
+		gomega.Expect(DeploymentReady(deployment)).To(gomega.BeFalse())
+		deployment.Status.ObservedGeneration = 2
+		gomega.Expect(DeploymentReady(deployment)).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("should wait for all the replicas", func() {
+		deployment := &appsV1.Deployment{}
+		deployment.Status = appsV1.DeploymentStatus{UpdatedReplicas: 1}
+		gomega.Expect(DeploymentReady(deployment)).To(gomega.BeFalse())
+		deployment.Status.ReadyReplicas = 1
+		gomega.Expect(DeploymentReady(deployment)).To(gomega.BeTrue())
+	})
+})
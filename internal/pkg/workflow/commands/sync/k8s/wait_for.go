@@ -0,0 +1,216 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// DefaultWaitTimeout is the time to wait for a condition if no timeout is specified.
+const DefaultWaitTimeout = 5 * time.Minute
+
+// DefaultWaitInterval is the time between checks of a condition if no interval is specified.
+const DefaultWaitInterval = 5 * time.Second
+
+// WaitFor structure with the attributes required to wait for a field of any Kubernetes object to reach a value.
+//
+// {"type":"sync", "name":"waitFor", "kubeConfigPath":"...", "version":"v1", "resource":"services",
+//  "namespace":"istio-system", "resource_name":"istio-ingressgateway",
+//  "jsonpath":"{.status.loadBalancer.ingress[0].ip}", "output":"istio.gatewayIP"}
+type WaitFor struct {
+	// Kubernetes embedded object
+	Kubernetes
+	// Group of the resource, empty for the core group.
+	Group string `json:"group"`
+	// Version of the resource.
+	Version string `json:"version"`
+	// Resource with the plural name of the resource.
+	Resource string `json:"resource"`
+	// Namespace of the object, empty for cluster scoped resources.
+	Namespace string `json:"namespace"`
+	// ResourceName with the name of the object.
+	ResourceName string `json:"resource_name"`
+	// JSONPath with the field to be checked. If empty, the command waits for the object to exist.
+	JSONPath string `json:"jsonpath"`
+	// Value expected for the field. If empty, the command waits for the field to have any value.
+	Value string `json:"value"`
+	// TimeoutSeconds with the maximum time to wait. If not set, DefaultWaitTimeout is used.
+	TimeoutSeconds int `json:"timeout"`
+	// IntervalSeconds with the time between checks. If not set, DefaultWaitInterval is used.
+	IntervalSeconds int `json:"interval"`
+	// Output with the name of the output set to the value of the field, if any.
+	Output string `json:"output"`
+}
+
+// NewWaitFor creates a new WaitFor command.
+func NewWaitFor(kubeConfigPath string, gvr schema.GroupVersionResource, namespace string, resourceName string,
+	jsonPath string, value string, timeoutSeconds int) *WaitFor {
+	return &WaitFor{
+		Kubernetes: Kubernetes{
+			GenericSyncCommand: *entities.NewSyncCommand(entities.WaitFor),
+			KubeConfigPath:     kubeConfigPath,
+		},
+		Group:          gvr.Group,
+		Version:        gvr.Version,
+		Resource:       gvr.Resource,
+		Namespace:      namespace,
+		ResourceName:   resourceName,
+		JSONPath:       jsonPath,
+		Value:          value,
+		TimeoutSeconds: timeoutSeconds,
+	}
+}
+
+// NewWaitForFromJSON creates a new WaitFor command from a raw JSON representation.
+func NewWaitForFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	wf := &WaitFor{}
+	if err := json.Unmarshal(raw, &wf); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	if wf.JSONPath != "" {
+		if _, err := ParseJSONPath(wf.JSONPath); err != nil {
+			return nil, err
+		}
+	}
+	wf.CommandID = entities.GenerateCommandID(wf.Name())
+	var r entities.Command = wf
+	return &r, nil
+}
+
+// RequiredAccess returns the accesses to the Kubernetes API performed by the command.
+func (wf *WaitFor) RequiredAccess() ([]ObjectAccess, derrors.Error) {
+	return []ObjectAccess{Access(wf.Group, wf.Resource, ReadVerbs)}, nil
+}
+
+// timeout returns the maximum time to wait for the condition.
+func (wf *WaitFor) timeout() time.Duration {
+	if wf.TimeoutSeconds <= 0 {
+		return DefaultWaitTimeout
+	}
+	return time.Duration(wf.TimeoutSeconds) * time.Second
+}
+
+// interval returns the time between checks of the condition.
+func (wf *WaitFor) interval() time.Duration {
+	if wf.IntervalSeconds <= 0 {
+		return DefaultWaitInterval
+	}
+	return time.Duration(wf.IntervalSeconds) * time.Second
+}
+
+// timeoutCode returns the error code reported when the condition is not met in time.
+func (wf *WaitFor) timeoutCode() errors.Code {
+	if wf.Resource == "certificates" {
+		return errors.CertTimeout
+	}
+	return errors.WaitTimeout
+}
+
+// check retrieves the object and evaluates the condition.
+//   returns:
+//     The current value of the field.
+//     Whether the condition is met.
+//     An error if the object cannot be retrieved or the field cannot be evaluated.
+func (wf *WaitFor) check(client dynamic.ResourceInterface, parser *jsonpath.JSONPath) (string, bool, derrors.Error) {
+	obj, err := client.Get(wf.ResourceName, metaV1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, AsQueryError(err, "cannot retrieve object", wf.Resource, wf.Namespace, wf.ResourceName)
+	}
+	if parser == nil {
+		return "", true, nil
+	}
+	current, eErr := ExtractField(obj, parser)
+	if eErr != nil {
+		return "", false, eErr
+	}
+	if wf.Value == "" {
+		return current, current != "", nil
+	}
+	return current, current == wf.Value, nil
+}
+
+// Run the current command returning the result or an error.
+func (wf *WaitFor) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	connectErr := wf.Connect()
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	var parser *jsonpath.JSONPath
+	if wf.JSONPath != "" {
+		var pErr derrors.Error
+		parser, pErr = ParseJSONPath(wf.JSONPath)
+		if pErr != nil {
+			return nil, pErr
+		}
+	}
+	gvr := schema.GroupVersionResource{Group: wf.Group, Version: wf.Version, Resource: wf.Resource}
+	client := wf.DynamicResource(wf.Namespace, gvr)
+	deadline := time.Now().Add(wf.timeout())
+	for {
+		current, ready, err := wf.check(client, parser)
+		if err != nil {
+			return entities.NewCommandResult(false, "cannot check condition", err), nil
+		}
+		if ready {
+			result := entities.NewSuccessCommand([]byte(fmt.Sprintf("%s %s is ready", wf.Resource, wf.ResourceName)))
+			if wf.Output != "" {
+				result = result.WithOutputs(map[string]string{wf.Output: current})
+			}
+			return result, nil
+		}
+		if time.Now().After(deadline) {
+			return entities.NewCommandResult(false, "condition not met",
+				derrors.NewUnavailableError(errors.Coded(wf.timeoutCode(), "timeout waiting for condition")).
+					WithParams(wf.Resource, wf.Namespace, wf.ResourceName, wf.JSONPath, wf.Value, current)), nil
+		}
+		log.Debug().Str("resource", wf.Resource).Str("namespace", wf.Namespace).Str("name", wf.ResourceName).
+			Str("jsonpath", wf.JSONPath).Str("current", current).Msg("waiting for condition")
+		time.Sleep(wf.interval())
+	}
+}
+
+// String returns a string representation
+func (wf *WaitFor) String() string {
+	return fmt.Sprintf("SYNC WaitFor %s %s/%s %s=%s", wf.Resource, wf.Namespace, wf.ResourceName, wf.JSONPath, wf.Value)
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (wf *WaitFor) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + wf.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (wf *WaitFor) UserString() string {
+	return fmt.Sprintf("Waiting for %s %s", wf.Resource, wf.ResourceName)
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s/k8stest"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = ginkgo.Describe("A WaitFor command", func() {
+
+	var cluster *k8stest.FakeCluster
+	services := schema.GroupVersionResource{Version: "v1", Resource: "services"}
+	gatewayIP := "{.status.loadBalancer.ingress[0].ip}"
+
+	gateway := func(ip string) *v1.Service {
+		svc := &v1.Service{ObjectMeta: metaV1.ObjectMeta{Name: "gateway", Namespace: "istio-system"}}
+		if ip != "" {
+			svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: ip}}
+		}
+		return svc
+	}
+
+	ginkgo.AfterEach(func() {
+		UnregisterClients(cluster.KubeConfigPath)
+	})
+
+	ginkgo.It("should wait for a field to have a value and set it as output", func() {
+		cluster = newFakeCluster(gateway("10.0.0.1"))
+		cmd := NewWaitFor(cluster.KubeConfigPath, services, "istio-system", "gateway", gatewayIP, "", 1)
+		cmd.Output = "istio.gatewayIP"
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(result.Outputs).To(gomega.HaveKeyWithValue("istio.gatewayIP", "10.0.0.1"))
+	})
+
+	ginkgo.It("should compare the field with the expected value", func() {
+		cluster = newFakeCluster(gateway("10.0.0.1"))
+		cmd := NewWaitFor(cluster.KubeConfigPath, services, "istio-system", "gateway", gatewayIP, "10.0.0.2", 1)
+		cmd.IntervalSeconds = 1
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should time out if the field is missing", func() {
+		cluster = newFakeCluster(gateway(""))
+		cmd := NewWaitFor(cluster.KubeConfigPath, services, "istio-system", "gateway", gatewayIP, "", 1)
+		cmd.IntervalSeconds = 1
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should wait for the object to exist if no jsonpath is set", func() {
+		cluster = newFakeCluster(gateway(""))
+		cmd := NewWaitFor(cluster.KubeConfigPath, services, "istio-system", "gateway", "", "", 1)
+		result, err := cmd.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+
+		missing := NewWaitFor(cluster.KubeConfigPath, services, "istio-system", "missing", "", "", 1)
+		missing.IntervalSeconds = 1
+		result, err = missing.Run("w1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("should be parsed from JSON", func() {
+		cluster = newFakeCluster()
+		raw := fmt.Sprintf(`{"type":"sync", "name":"waitFor", "kubeConfigPath":%q, "version":"v1",
+			"resource":"services", "namespace":"istio-system", "resource_name":"gateway", "jsonpath":%q,
+			"timeout":10, "interval":2}`, cluster.KubeConfigPath, gatewayIP)
+		cmd, err := NewWaitForFromJSON([]byte(raw))
+		gomega.Expect(err).To(gomega.Succeed())
+		wf := (*cmd).(*WaitFor)
+		gomega.Expect(wf.interval().Seconds()).To(gomega.Equal(2.0))
+		gomega.Expect(wf.timeout().Seconds()).To(gomega.Equal(10.0))
+		access, aErr := wf.RequiredAccess()
+		gomega.Expect(aErr).To(gomega.Succeed())
+		gomega.Expect(access).To(gomega.HaveLen(1))
+
+		_, err = NewWaitForFromJSON([]byte(`{"type":"sync", "name":"waitFor", "jsonpath":"{.status"}`))
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	})
+})
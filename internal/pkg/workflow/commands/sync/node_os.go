@@ -0,0 +1,136 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Detection of the distribution of the target nodes through SSH, so the prerequisites of Kubernetes are installed
+// with the package manager of each node.
+
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/connection"
+)
+
+// Families of the distributions supported by the installer.
+const (
+	DebianFamily = "debian"
+	RedHatFamily = "rhel"
+)
+
+// OSReleaseCommand is the command printing the distribution of a node.
+const OSReleaseCommand = "cat /etc/os-release"
+
+// SupportedDistributions contains the family of the distributions of the nodes where clusters can be installed.
+var SupportedDistributions = map[string]string{
+	"ubuntu":    DebianFamily,
+	"debian":    DebianFamily,
+	"centos":    RedHatFamily,
+	"rhel":      RedHatFamily,
+	"rocky":     RedHatFamily,
+	"almalinux": RedHatFamily,
+}
+
+// NodeOS with the distribution of a node.
+type NodeOS struct {
+	// ID of the distribution, such as ubuntu or centos.
+	ID string
+	// VersionID of the distribution, such as 18.04 or 7.
+	VersionID string
+	// Family of the distribution, that determines the package manager.
+	Family string
+}
+
+// String returns the distribution and its version.
+func (n NodeOS) String() string {
+	if n.VersionID == "" {
+		return n.ID
+	}
+	return fmt.Sprintf("%s %s", n.ID, n.VersionID)
+}
+
+// MajorVersion returns the major version of the distribution, such as 8 for 8.4, or 0 if it is not a number.
+func (n NodeOS) MajorVersion() int {
+	major, err := strconv.Atoi(strings.SplitN(n.VersionID, ".", 2)[0])
+	if err != nil {
+		return 0
+	}
+	return major
+}
+
+// ParseOSRelease obtains the distribution of a node from the content of its /etc/os-release file. Derived
+// distributions not listed in SupportedDistributions take the family of the first supported one in ID_LIKE.
+func ParseOSRelease(content string) NodeOS {
+	fields := make(map[string]string, 0)
+	for _, line := range strings.Split(content, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) == 2 {
+			fields[parts[0]] = strings.Trim(parts[1], `"'`)
+		}
+	}
+	result := NodeOS{ID: strings.ToLower(fields["ID"]), VersionID: fields["VERSION_ID"]}
+	if family, found := SupportedDistributions[result.ID]; found {
+		result.Family = family
+		return result
+	}
+	for _, like := range strings.Fields(strings.ToLower(fields["ID_LIKE"])) {
+		if family, found := SupportedDistributions[like]; found {
+			result.Family = family
+			return result
+		}
+	}
+	return result
+}
+
+// DetectOS obtains the distribution of a node.
+//   params:
+//     conn The connection to the node.
+//     node The address of the node.
+//   returns:
+//     The distribution of the node.
+//     An error if it cannot be obtained or it is not supported.
+func DetectOS(conn connection.Connection, node string) (*NodeOS, derrors.Error) {
+	output, err := conn.Execute(OSReleaseCommand)
+	if err != nil {
+		return nil, derrors.NewInternalError(errors.SSHConnectionError, err).WithParams(node)
+	}
+	nodeOS := ParseOSRelease(string(output))
+	if nodeOS.Family == "" {
+		return nil, derrors.NewFailedPreconditionError("unsupported node distribution").
+			WithParams(node, nodeOS.String())
+	}
+	return &nodeOS, nil
+}
+
+// SortedDistributions returns the different distributions of a set of nodes in alphabetical order.
+func SortedDistributions(distributions map[string]NodeOS) []string {
+	unique := make(map[string]bool, 0)
+	for _, nodeOS := range distributions {
+		unique[nodeOS.String()] = true
+	}
+	result := make([]string, 0, len(unique))
+	for distribution := range unique {
+		result = append(result, distribution)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package sync
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const ubuntuOSRelease = `NAME="Ubuntu"
+VERSION="18.04.3 LTS (Bionic Beaver)"
+ID=ubuntu
+ID_LIKE=debian
+VERSION_ID="18.04"`
+
+const centosOSRelease = `NAME="CentOS Linux"
+VERSION="7 (Core)"
+ID="centos"
+ID_LIKE="rhel fedora"
+VERSION_ID="7"`
+
+const oracleOSRelease = `NAME="Oracle Linux Server"
+ID="ol"
+ID_LIKE="fedora"
+VERSION_ID="7.7"`
+
+var _ = ginkgo.Describe("The node distribution detection", func() {
+
+	ginkgo.It("should detect the supported distributions", func() {
+		nodeOS, err := DetectOS(&machineConnection{ubuntuOSRelease}, "10.0.0.1")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(*nodeOS).To(gomega.Equal(NodeOS{ID: "ubuntu", VersionID: "18.04", Family: DebianFamily}))
+		nodeOS, err = DetectOS(&machineConnection{centosOSRelease}, "10.0.0.2")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(*nodeOS).To(gomega.Equal(NodeOS{ID: "centos", VersionID: "7", Family: RedHatFamily}))
+		gomega.Expect(SortedDistributions(map[string]NodeOS{"a": *nodeOS, "b": ParseOSRelease(ubuntuOSRelease),
+			"c": *nodeOS})).To(gomega.Equal([]string{"centos 7", "ubuntu 18.04"}))
+	})
+
+	ginkgo.It("should take the family of derived distributions from ID_LIKE", func() {
+		nodeOS := ParseOSRelease("ID=linuxmint\nID_LIKE=\"ubuntu debian\"\nVERSION_ID=19.3")
+		gomega.Expect(nodeOS.Family).To(gomega.Equal(DebianFamily))
+	})
+
+	ginkgo.It("should reject unsupported distributions", func() {
+		_, err := DetectOS(&machineConnection{oracleOSRelease}, "10.0.0.3")
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		gomega.Expect(err.DebugReport()).To(gomega.ContainSubstring("ol 7.7"))
+	})
+})
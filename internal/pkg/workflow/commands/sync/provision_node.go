@@ -0,0 +1,366 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Provision node command
+// Prepares a set of nodes to run Kubernetes before launching RKE. On each node it installs docker with a pinned
+// version, applies a set of sysctls, disables swap and enables ntp. Debian and RedHat based distributions are
+// supported, on amd64 and arm64 nodes. The distribution of each node is detected through SSH, and RedHat based nodes
+// also get SELinux configured and the ports used by RKE opened if firewalld is running.
+//
+// {"type":"sync", "name": "provisionNode", "nodes": ["10.0.0.1", "10.0.0.2"], "targetPort": "22",
+// "credentials":{"username": "username", "privateKey":"..."},
+// "dockerVersion":"18.09", "sysctls":{"net.ipv4.ip_forward":"1"}, "ntpServers":["pool.ntp.org"],
+// "selinux":"permissive"}
+
+package sync
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/connection"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultDockerVersion is the docker version installed if none is set.
+const DefaultDockerVersion = "18.09"
+
+// DockerInstallURL is the location of the scripts installing a given docker version.
+const DockerInstallURL = "https://releases.rancher.com/install-docker"
+
+// DockerYumRepository is the docker repository used to install docker on RedHat based nodes.
+const DockerYumRepository = "https://download.docker.com/linux/centos/docker-ce.repo"
+
+// SELinux modes of the RedHat based nodes.
+const (
+	// SELinuxPermissive disables the enforcement of the SELinux policies.
+	SELinuxPermissive = "permissive"
+	// SELinuxEnforcing keeps the policies enforced, installing the ones required by the containers.
+	SELinuxEnforcing = "enforcing"
+)
+
+// RKEFirewallPorts contains the ports used by RKE, opened on the nodes running firewalld.
+var RKEFirewallPorts = []string{"22/tcp", "80/tcp", "443/tcp", "2376/tcp", "2379-2380/tcp", "6443/tcp",
+	"8472/udp", "9099/tcp", "10250/tcp", "10254/tcp", "30000-32767/tcp", "30000-32767/udp"}
+
+// ChronyMajorVersion is the first major version of the RedHat based distributions that ships chrony instead of ntp.
+const ChronyMajorVersion = 8
+
+// SysctlFile is the file on the nodes with the sysctls applied by the command.
+const SysctlFile = "/etc/sysctl.d/90-nalej.conf"
+
+// DefaultSysctls contains the sysctls required by Kubernetes, applied if none are set.
+var DefaultSysctls = map[string]string{
+	"net.bridge.bridge-nf-call-iptables":  "1",
+	"net.bridge.bridge-nf-call-ip6tables": "1",
+	"net.ipv4.ip_forward":                 "1",
+}
+
+var dockerVersionRegex = regexp.MustCompile(`^[0-9]+\.[0-9]+(\.[0-9]+)?$`)
+var sysctlKeyRegex = regexp.MustCompile(`^[a-z0-9_]+([./-][a-z0-9_]+)*$`)
+var sysctlValueRegex = regexp.MustCompile(`^[A-Za-z0-9_. -]+$`)
+var ntpServerRegex = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+
+// ProvisionNode command structure with supported parameters.
+type ProvisionNode struct {
+	entities.GenericSyncCommand
+	// Nodes to be provisioned.
+	Nodes []string `json:"nodes"`
+	// Target port
+	TargetPort string `json:"targetPort"`
+	// Credentials for SSH.
+	Credentials entities.Credentials `json:"credentials"`
+	// DockerVersion is the docker version to be installed, such as 18.09.
+	DockerVersion string `json:"dockerVersion"`
+	// Sysctls to be applied on the nodes.
+	Sysctls map[string]string `json:"sysctls"`
+	// NTPServers used by the nodes, the ones of the distribution are used if empty.
+	NTPServers []string `json:"ntpServers"`
+	// SELinux mode of the RedHat based nodes, permissive by default.
+	SELinux string `json:"selinux"`
+}
+
+// NewProvisionNode creates a ProvisionNode command from a set of parameters.
+func NewProvisionNode(nodes []string, targetPort string, credentials entities.Credentials, dockerVersion string,
+	sysctls map[string]string, ntpServers []string, selinux string) *ProvisionNode {
+	return &ProvisionNode{*entities.NewSyncCommand(entities.ProvisionNode),
+		nodes,
+		targetPort,
+		credentials,
+		dockerVersion,
+		sysctls,
+		ntpServers,
+		selinux}
+}
+
+// NewProvisionNodeFromJSON creates a ProvisionNode command from a JSON object.
+func NewProvisionNodeFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	pn := &ProvisionNode{}
+	if err := json.Unmarshal(raw, &pn); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	pn.CommandID = entities.GenerateCommandID(pn.Name())
+	var r entities.Command = pn
+	return &r, nil
+}
+
+func (pn *ProvisionNode) getTargetPort() string {
+	if pn.TargetPort != "" {
+		return pn.TargetPort
+	}
+	return DefaultSSHPort
+}
+
+func (pn *ProvisionNode) getDockerVersion() string {
+	if pn.DockerVersion != "" {
+		return pn.DockerVersion
+	}
+	return DefaultDockerVersion
+}
+
+func (pn *ProvisionNode) getSysctls() map[string]string {
+	if len(pn.Sysctls) > 0 {
+		return pn.Sysctls
+	}
+	return DefaultSysctls
+}
+
+func (pn *ProvisionNode) getSELinux() string {
+	if pn.SELinux != "" {
+		return pn.SELinux
+	}
+	return SELinuxPermissive
+}
+
+// validate checks the parameters that are written into the provisioning script.
+func (pn *ProvisionNode) validate() derrors.Error {
+	if len(pn.Nodes) == 0 {
+		return derrors.NewInvalidArgumentError("no nodes to provision")
+	}
+	if !dockerVersionRegex.MatchString(pn.getDockerVersion()) {
+		return derrors.NewInvalidArgumentError("invalid docker version").WithParams(pn.DockerVersion)
+	}
+	for key, value := range pn.getSysctls() {
+		if !sysctlKeyRegex.MatchString(key) || !sysctlValueRegex.MatchString(value) {
+			return derrors.NewInvalidArgumentError("invalid sysctl").WithParams(key, value)
+		}
+	}
+	for _, server := range pn.NTPServers {
+		if !ntpServerRegex.MatchString(server) {
+			return derrors.NewInvalidArgumentError("invalid ntp server").WithParams(server)
+		}
+	}
+	if selinux := pn.getSELinux(); selinux != SELinuxPermissive && selinux != SELinuxEnforcing {
+		return derrors.NewInvalidArgumentError("invalid selinux mode").WithParams(pn.SELinux)
+	}
+	return nil
+}
+
+// script builds the shell script provisioning a node.
+//   params:
+//     nodeOS The distribution of the node.
+//   returns:
+//     The script with the steps of the family of the distribution.
+func (pn *ProvisionNode) script(nodeOS NodeOS) string {
+	var b strings.Builder
+	b.WriteString("set -e\n")
+	if nodeOS.Family == RedHatFamily {
+		pn.writeSELinux(&b)
+		pn.writeFirewall(&b)
+	}
+	pn.writeDocker(&b, nodeOS)
+	// Sysctls
+	sysctls := pn.getSysctls()
+	keys := make([]string, 0, len(sysctls))
+	for key := range sysctls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	b.WriteString("modprobe br_netfilter || true\n")
+	fmt.Fprintf(&b, "cat > %s <<'EOF'\n", SysctlFile)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s = %s\n", key, sysctls[key])
+	}
+	b.WriteString("EOF\nsysctl --system\n")
+	// Swap
+	b.WriteString("swapoff -a\nsed -i '/\\sswap\\s/ s/^[^#]/#&/' /etc/fstab\n")
+	pn.writeNTP(&b, nodeOS)
+	return b.String()
+}
+
+// writeSELinux writes the steps applying the SELinux mode of the command if SELinux is enabled on the node.
+func (pn *ProvisionNode) writeSELinux(b *strings.Builder) {
+	b.WriteString("if command -v getenforce >/dev/null 2>&1 && [ \"$(getenforce)\" != \"Disabled\" ]; then\n")
+	if pn.getSELinux() == SELinuxEnforcing {
+		b.WriteString("  yum install -y -q container-selinux\n")
+	} else {
+		b.WriteString("  setenforce 0\n")
+		b.WriteString("  sed -i 's/^SELINUX=enforcing$/SELINUX=permissive/' /etc/selinux/config\n")
+	}
+	b.WriteString("fi\n")
+}
+
+// writeFirewall writes the steps opening the ports used by RKE if firewalld is running on the node.
+func (pn *ProvisionNode) writeFirewall(b *strings.Builder) {
+	b.WriteString("if systemctl is-active --quiet firewalld; then\n")
+	for _, port := range RKEFirewallPorts {
+		fmt.Fprintf(b, "  firewall-cmd --permanent --add-port=%s\n", port)
+	}
+	b.WriteString("  firewall-cmd --reload\n")
+	b.WriteString("fi\n")
+}
+
+// writeDocker writes the steps installing the docker version of the command with the package manager of the node.
+func (pn *ProvisionNode) writeDocker(b *strings.Builder, nodeOS NodeOS) {
+	version := pn.getDockerVersion()
+	fmt.Fprintf(b, "if ! docker version --format '{{.Server.Version}}' 2>/dev/null | grep -q '^%s'; then\n", version)
+	if nodeOS.Family == RedHatFamily {
+		b.WriteString("  yum install -y -q yum-utils\n")
+		fmt.Fprintf(b, "  yum-config-manager --add-repo %s\n", DockerYumRepository)
+		fmt.Fprintf(b, "  yum install -y -q 'docker-ce-%s*' 'docker-ce-cli-%s*' containerd.io\n", version, version)
+	} else {
+		fmt.Fprintf(b, "  curl -fsSL %s/%s.sh | sh\n", DockerInstallURL, version)
+	}
+	b.WriteString("fi\n")
+	b.WriteString("systemctl enable docker\nsystemctl start docker\n")
+}
+
+// writeNTP writes the steps installing and enabling ntp with the package manager of the node. RedHat based nodes
+// use chrony from version 8, as ntp is no longer shipped.
+func (pn *ProvisionNode) writeNTP(b *strings.Builder, nodeOS NodeOS) {
+	service := "ntp"
+	conf := "/etc/ntp.conf"
+	switch {
+	case nodeOS.Family == RedHatFamily && nodeOS.MajorVersion() >= ChronyMajorVersion:
+		b.WriteString("yum install -y -q chrony\n")
+		service = "chronyd"
+		conf = "/etc/chrony.conf"
+	case nodeOS.Family == RedHatFamily:
+		b.WriteString("yum install -y -q ntp\n")
+		service = "ntpd"
+	default:
+		b.WriteString("DEBIAN_FRONTEND=noninteractive apt-get update -q\n")
+		b.WriteString("DEBIAN_FRONTEND=noninteractive apt-get install -y -q ntp\n")
+	}
+	if len(pn.NTPServers) > 0 {
+		fmt.Fprintf(b, "sed -i '/^\\(server\\|pool\\) /d' %s\n", conf)
+		for _, server := range pn.NTPServers {
+			fmt.Fprintf(b, "echo 'server %s iburst' >> %s\n", server, conf)
+		}
+	}
+	fmt.Fprintf(b, "systemctl enable %s\nsystemctl restart %s\n", service, service)
+}
+
+// prerequisites returns the steps of the script of a family of distributions, shown in the explain plan.
+func (pn *ProvisionNode) prerequisites(family string) []string {
+	result := make([]string, 0)
+	if family == RedHatFamily {
+		result = append(result, fmt.Sprintf("SELinux %s", pn.getSELinux()),
+			fmt.Sprintf("open %s if firewalld is running", strings.Join(RKEFirewallPorts, ",")),
+			fmt.Sprintf("docker %s from %s", pn.getDockerVersion(), DockerYumRepository))
+	} else {
+		result = append(result, fmt.Sprintf("docker %s from %s/%s.sh", pn.getDockerVersion(), DockerInstallURL,
+			pn.getDockerVersion()))
+	}
+	result = append(result, fmt.Sprintf("sysctls in %s", SysctlFile), "swap disabled")
+	if family == RedHatFamily {
+		return append(result, fmt.Sprintf("ntpd with yum, or chronyd from version %d", ChronyMajorVersion))
+	}
+	return append(result, "ntp with apt-get")
+}
+
+// remoteCommand returns the command that runs the provisioning script on a node. The script is encoded to avoid
+// quoting issues, and executed with sudo unless connecting as root.
+func (pn *ProvisionNode) remoteCommand(nodeOS NodeOS) string {
+	encoded := base64.StdEncoding.EncodeToString([]byte(pn.script(nodeOS)))
+	shell := "sh"
+	if pn.Credentials.Username != "root" {
+		shell = "sudo -n sh"
+	}
+	return fmt.Sprintf("echo %s | base64 -d | %s", encoded, shell)
+}
+
+// Run the current command.
+//   returns:
+//     The CommandResult
+//     An error if the command execution fails
+func (pn *ProvisionNode) Run(_ string) (*entities.CommandResult, derrors.Error) {
+	if err := pn.validate(); err != nil {
+		return nil, err
+	}
+	archs := make(map[string]string, len(pn.Nodes))
+	distributions := make(map[string]NodeOS, len(pn.Nodes))
+	for _, node := range pn.Nodes {
+		conn, err := connection.NewSSHConnection(
+			node, pn.getTargetPort(),
+			pn.Credentials.Username, pn.Credentials.Password, "", pn.Credentials.PrivateKey)
+		if err != nil {
+			log.Warn().Str("targetHost", node).Err(err).Msg("Cannot establish connection")
+			return nil, derrors.NewInternalError(errors.SSHConnectionError, err).WithParams(node)
+		}
+		arch, archErr := DetectArchitecture(conn, node)
+		if archErr != nil {
+			log.Warn().Str("targetHost", node).Str("trace", archErr.DebugReport()).Msg("Cannot provision node")
+			return entities.NewCommandResult(false, fmt.Sprintf("cannot provision node %s", node), archErr), nil
+		}
+		archs[node] = arch
+		nodeOS, osErr := DetectOS(conn, node)
+		if osErr != nil {
+			log.Warn().Str("targetHost", node).Str("trace", osErr.DebugReport()).Msg("Cannot provision node")
+			return entities.NewCommandResult(false, fmt.Sprintf("cannot provision node %s", node), osErr), nil
+		}
+		distributions[node] = *nodeOS
+		log.Debug().Str("targetHost", node).Str("arch", arch).Str("os", nodeOS.String()).Msg("provisioning node")
+		output, err := conn.Execute(pn.remoteCommand(*nodeOS))
+		if err != nil {
+			log.Warn().Str("targetHost", node).Err(err).Str("output", string(output)).Msg("Cannot provision node")
+			return entities.NewCommandResult(false, fmt.Sprintf("cannot provision node %s", node),
+				derrors.NewInternalError(errors.SSHConnectionError, err).WithParams(node)), nil
+		}
+	}
+	return entities.NewSuccessCommand([]byte(fmt.Sprintf("%d nodes provisioned (%s; %s)", len(pn.Nodes),
+		strings.Join(SortedArchitectures(archs), ", "), strings.Join(SortedDistributions(distributions), ", ")))), nil
+}
+
+// Obtain a string representation
+func (pn *ProvisionNode) String() string {
+	return fmt.Sprintf("SYNC ProvisionNode %s docker %s", strings.Join(pn.Nodes, ","), pn.getDockerVersion())
+}
+
+// PrettyPrint returns a simple space indexed string.
+// The prerequisites of each family of distributions are listed, as the distributions of the nodes are only detected
+// when the command runs.
+func (pn *ProvisionNode) PrettyPrint(indentation int) string {
+	simpleIden := strings.Repeat(" ", indentation)
+	result := simpleIden + pn.String()
+	for _, family := range []string{DebianFamily, RedHatFamily} {
+		result = result + "\n" + simpleIden + "  " + family + ": " + strings.Join(pn.prerequisites(family), ", ")
+	}
+	return result
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (pn *ProvisionNode) UserString() string {
+	return fmt.Sprintf("Provisioning nodes %s with docker %s", strings.Join(pn.Nodes, ","), pn.getDockerVersion())
+}
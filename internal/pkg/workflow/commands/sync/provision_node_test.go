@@ -0,0 +1,139 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package sync
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("A ProvisionNode command", func() {
+
+	credentials := entities.Credentials{Username: "root"}
+	ubuntu := NodeOS{ID: "ubuntu", VersionID: "18.04", Family: DebianFamily}
+	centos := NodeOS{ID: "centos", VersionID: "7", Family: RedHatFamily}
+
+	ginkgo.It("should build the provisioning script with the defaults", func() {
+		pn := NewProvisionNode([]string{"10.0.0.1"}, "", credentials, "", nil, nil, "")
+		gomega.Expect(pn.validate()).To(gomega.Succeed())
+		script := pn.script(ubuntu)
+		gomega.Expect(script).To(gomega.ContainSubstring(DockerInstallURL + "/" + DefaultDockerVersion + ".sh"))
+		gomega.Expect(script).To(gomega.ContainSubstring("net.ipv4.ip_forward = 1"))
+		gomega.Expect(script).To(gomega.ContainSubstring("swapoff -a"))
+		gomega.Expect(script).NotTo(gomega.ContainSubstring("iburst"))
+	})
+
+	ginkgo.It("should apply the given parameters", func() {
+		pn := NewProvisionNode([]string{"10.0.0.1"}, "", credentials, "19.03.5",
+			map[string]string{"vm.max_map_count": "262144"}, []string{"ntp.nalej.com"}, "")
+		gomega.Expect(pn.validate()).To(gomega.Succeed())
+		script := pn.script(ubuntu)
+		gomega.Expect(script).To(gomega.ContainSubstring("19.03.5.sh"))
+		gomega.Expect(script).To(gomega.ContainSubstring("vm.max_map_count = 262144"))
+		gomega.Expect(script).NotTo(gomega.ContainSubstring("net.ipv4.ip_forward"))
+		gomega.Expect(script).To(gomega.ContainSubstring("server ntp.nalej.com iburst"))
+	})
+
+	ginkgo.It("should build the provisioning script of the RedHat based nodes", func() {
+		pn := NewProvisionNode([]string{"10.0.0.1"}, "", credentials, "", nil, []string{"ntp.nalej.com"}, "")
+		gomega.Expect(pn.validate()).To(gomega.Succeed())
+		script := pn.script(centos)
+		gomega.Expect(script).To(gomega.ContainSubstring("yum-config-manager --add-repo " + DockerYumRepository))
+		gomega.Expect(script).To(gomega.ContainSubstring("'docker-ce-" + DefaultDockerVersion + "*'"))
+		gomega.Expect(script).NotTo(gomega.ContainSubstring(DockerInstallURL))
+		gomega.Expect(script).To(gomega.ContainSubstring("setenforce 0"))
+		gomega.Expect(script).To(gomega.ContainSubstring("firewall-cmd --permanent --add-port=6443/tcp"))
+		gomega.Expect(script).To(gomega.ContainSubstring("firewall-cmd --permanent --add-port=8472/udp"))
+		gomega.Expect(script).To(gomega.ContainSubstring("systemctl restart ntpd"))
+		gomega.Expect(script).NotTo(gomega.ContainSubstring("apt-get"))
+
+		debian := pn.script(ubuntu)
+		gomega.Expect(debian).NotTo(gomega.ContainSubstring("selinux"))
+		gomega.Expect(debian).NotTo(gomega.ContainSubstring("firewall-cmd"))
+		gomega.Expect(debian).NotTo(gomega.ContainSubstring("yum"))
+
+		pn.SELinux = SELinuxEnforcing
+		gomega.Expect(pn.validate()).To(gomega.Succeed())
+		enforcing := pn.script(centos)
+		gomega.Expect(enforcing).To(gomega.ContainSubstring("yum install -y -q container-selinux"))
+		gomega.Expect(enforcing).NotTo(gomega.ContainSubstring("setenforce 0"))
+	})
+
+	ginkgo.It("should use chrony on the RedHat based nodes from version 8", func() {
+		pn := NewProvisionNode([]string{"10.0.0.1"}, "", credentials, "", nil, []string{"ntp.nalej.com"}, "")
+		gomega.Expect(pn.validate()).To(gomega.Succeed())
+		for _, nodeOS := range []NodeOS{{ID: "rocky", VersionID: "8.4", Family: RedHatFamily},
+			{ID: "almalinux", VersionID: "8", Family: RedHatFamily}} {
+			script := pn.script(nodeOS)
+			gomega.Expect(script).To(gomega.ContainSubstring("yum install -y -q chrony"))
+			gomega.Expect(script).To(gomega.ContainSubstring("echo 'server ntp.nalej.com iburst' >> /etc/chrony.conf"))
+			gomega.Expect(script).To(gomega.ContainSubstring("systemctl restart chronyd"))
+			gomega.Expect(script).NotTo(gomega.ContainSubstring("ntp.conf"))
+			gomega.Expect(script).NotTo(gomega.ContainSubstring("ntpd"))
+		}
+		gomega.Expect(pn.script(centos)).NotTo(gomega.ContainSubstring("chrony"))
+	})
+
+	ginkgo.It("should explain the prerequisites of each distribution family", func() {
+		pn := NewProvisionNode([]string{"10.0.0.1"}, "", credentials, "", nil, nil, "")
+		explained := pn.PrettyPrint(0)
+		gomega.Expect(explained).To(gomega.ContainSubstring("  debian: docker " + DefaultDockerVersion))
+		gomega.Expect(explained).To(gomega.ContainSubstring("  rhel: SELinux permissive"))
+		gomega.Expect(explained).To(gomega.ContainSubstring("ntpd with yum, or chronyd from version 8"))
+	})
+
+	ginkgo.It("should run the script with sudo if not connecting as root", func() {
+		pn := NewProvisionNode([]string{"10.0.0.1"}, "", entities.Credentials{Username: "nalej"}, "", nil, nil, "")
+		cmd := pn.remoteCommand(ubuntu)
+		gomega.Expect(cmd).To(gomega.HaveSuffix("| sudo -n sh"))
+		encoded := strings.Fields(cmd)[1]
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(string(decoded)).To(gomega.Equal(pn.script(ubuntu)))
+
+		pn.Credentials = credentials
+		gomega.Expect(pn.remoteCommand(ubuntu)).To(gomega.HaveSuffix("| sh"))
+	})
+
+	ginkgo.It("should reject parameters that could alter the script", func() {
+		gomega.Expect(NewProvisionNode(nil, "", credentials, "", nil, nil, "").validate()).NotTo(gomega.Succeed())
+		gomega.Expect(NewProvisionNode([]string{"n"}, "", credentials, "18.09; rm -rf /", nil, nil, "").validate()).
+			NotTo(gomega.Succeed())
+		gomega.Expect(NewProvisionNode([]string{"n"}, "", credentials, "",
+			map[string]string{"net.ipv4.ip_forward": "1\nEOF"}, nil, "").validate()).NotTo(gomega.Succeed())
+		gomega.Expect(NewProvisionNode([]string{"n"}, "", credentials, "", nil,
+			[]string{"pool.ntp.org' >> /etc/passwd"}, "").validate()).NotTo(gomega.Succeed())
+		gomega.Expect(NewProvisionNode([]string{"n"}, "", credentials, "", nil, nil, "disabled").validate()).
+			NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should be parsed from JSON", func() {
+		raw := `{"type":"sync", "name":"provisionNode", "nodes":["10.0.0.1","10.0.0.2"],
+			"credentials":{"username":"root"}, "dockerVersion":"18.09", "ntpServers":["pool.ntp.org"]}`
+		cmd, err := NewProvisionNodeFromJSON([]byte(raw))
+		gomega.Expect(err).To(gomega.Succeed())
+		pn := (*cmd).(*ProvisionNode)
+		gomega.Expect(pn.Nodes).To(gomega.HaveLen(2))
+		gomega.Expect(pn.getTargetPort()).To(gomega.Equal(DefaultSSHPort))
+		gomega.Expect(pn.validate()).To(gomega.Succeed())
+	})
+})
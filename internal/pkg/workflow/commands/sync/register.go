@@ -0,0 +1,45 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file registers the commands of the package.
+
+package sync
+
+import "github.com/nalej/installer/internal/pkg/workflow/entities"
+
+func init() {
+	entities.RegisterSyncCommand(entities.Exec, NewExecFromJSON,
+		func() interface{} { return &Exec{} }, "cmd")
+	entities.RegisterSyncCommand(entities.SCP, NewSCPFromJSON,
+		func() interface{} { return &SCP{} }, "targetHost", "source", "destination")
+	entities.RegisterSyncCommand(entities.SSH, NewSSHFromJSON,
+		func() interface{} { return &SSH{} }, "targetHost", "cmd")
+	entities.RegisterSyncCommand(entities.Logger, NewLoggerFromJSON,
+		func() interface{} { return &Logger{} }, "msg")
+	entities.RegisterSyncCommand(entities.Sleep, NewSleepFromJSON,
+		func() interface{} { return &Sleep{} }, "time")
+	entities.RegisterSyncCommand(entities.Fail, NewFailFromJSON,
+		func() interface{} { return &Fail{} })
+	entities.RegisterSyncCommand(entities.ProcessCheck, NewProcessCheckFromJSON,
+		func() interface{} { return &ProcessCheck{} }, "targetHost", "process")
+	entities.RegisterSyncCommand(entities.ProvisionNode, NewProvisionNodeFromJSON,
+		func() interface{} { return &ProvisionNode{} }, "nodes")
+	entities.RegisterSyncCommand(entities.CheckAsset, NewCheckAssetFromJSON,
+		func() interface{} { return &CheckAsset{} }, "path")
+	entities.RegisterSyncCommand(entities.CheckBinaries, NewCheckBinariesFromJSON,
+		func() interface{} { return &CheckBinaries{} }, "binary_path")
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Execution of the rke binary on the host or in a container
+
+package rke
+
+import (
+	"os/exec"
+
+	"github.com/nalej/derrors"
+	syncCmd "github.com/nalej/installer/internal/pkg/workflow/commands/sync"
+)
+
+// RKEBinary is the name of the rke binary executed in the containers.
+const RKEBinary = "rke"
+
+// rkeCommand creates the execution of rke with a set of arguments. If an image is set, rke runs in a container of that
+// image with access to the private key of the cluster, and with the binary of the host otherwise.
+func rkeCommand(binaryPath string, image string, config ClusterConfig, args ...string) (*exec.Cmd, derrors.Error) {
+	if image == "" {
+		if binaryPath == "" {
+			return nil, derrors.NewInvalidArgumentError("either the rke binary or image is required")
+		}
+		return exec.Command(binaryPath, args...), nil
+	}
+	if err := syncCmd.ValidatePinnedImage(image); err != nil {
+		return nil, err
+	}
+	binary, containerArgs := syncCmd.ContainerCommand(image, RKEBinary, []string{config.PrivateKeyPath}, args)
+	return exec.Command(binary, containerArgs...), nil
+}
@@ -19,12 +19,25 @@
 
 package rke
 
+import (
+	"net"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	syncCmd "github.com/nalej/installer/internal/pkg/workflow/commands/sync"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/connection"
+	"github.com/rs/zerolog/log"
+)
+
 // ClusterConfig defines the options required to generate an RKE config file.
 type ClusterConfig struct {
 	ClusterName    string   `json:"clusterName"`
 	TargetNodes    []string `json:"targetNodes"`
 	NodeUsername   string   `json:"nodeUsername"`
 	PrivateKeyPath string   `json:"privateKeyPath"`
+	// Architectures of the target nodes, detected through SSH if not set.
+	Architectures []string `json:"architectures"`
 }
 
 // NewClusterConfig creates a new set of config parameters for creating the RKE definition file
@@ -37,5 +50,66 @@ func NewClusterConfig(
 		clusterName,
 		targetNodes,
 		nodeUsername,
-		privateKeyPath}
+		privateKeyPath,
+		nil}
+}
+
+// IPv6Only checks if all the target nodes are addressed by IPv6 addresses, in which case the pods and services of the
+// cluster are assigned IPv6 addresses.
+func (c ClusterConfig) IPv6Only() bool {
+	if len(c.TargetNodes) == 0 {
+		return false
+	}
+	for _, node := range c.TargetNodes {
+		ip := net.ParseIP(node)
+		if ip == nil || ip.To4() != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ARM64 checks if any of the target nodes is an arm64 node. RKE only supports the flannel network plugin on them.
+func (c ClusterConfig) ARM64() bool {
+	for _, arch := range c.Architectures {
+		if arch == syncCmd.ARM64Architecture {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectArchitectures obtains the architectures of the target nodes through SSH unless they are already set.
+//   returns:
+//     An error if the architecture of a node cannot be obtained or it is not supported.
+func (c *ClusterConfig) DetectArchitectures() derrors.Error {
+	if len(c.Architectures) > 0 {
+		for _, arch := range c.Architectures {
+			if !syncCmd.IsSupportedArchitecture(arch) {
+				return derrors.NewInvalidArgumentError("unsupported node architecture").WithParams(arch)
+			}
+		}
+		return nil
+	}
+	archs := make(map[string]string, len(c.TargetNodes))
+	for _, node := range c.TargetNodes {
+		conn, err := connection.NewSSHConnection(node, syncCmd.DefaultSSHPort, c.NodeUsername, "", c.PrivateKeyPath, "")
+		if err != nil {
+			return derrors.NewInternalError(errors.SSHConnectionError, err).WithParams(node)
+		}
+		arch, archErr := syncCmd.DetectArchitecture(conn, node)
+		if archErr != nil {
+			return archErr
+		}
+		archs[node] = arch
+	}
+	c.Architectures = syncCmd.SortedArchitectures(archs)
+	log.Debug().Strs("architectures", c.Architectures).Msg("architectures of the target nodes")
+	return nil
+}
+
+// NodeFileName returns a representation of a node address that can be used in a file name, as IPv6 addresses
+// contain colons.
+func NodeFileName(node string) string {
+	return strings.Replace(node, ":", "-", -1)
 }
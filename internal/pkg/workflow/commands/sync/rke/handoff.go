@@ -0,0 +1,179 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Kubeconfig handoff
+// rkeInstall and rke2Install set the path of the kubeconfig of the new cluster as a workflow output, so the commands
+// installing the platform on it reference it with {{output "rke.kubeConfigPath"}}. The kubeconfig can also be stored
+// in a secret of the management cluster, encrypted with AES-GCM using the key of keyPath, which is generated if it
+// does not exist.
+//
+// "output":"rke.kubeConfigPath", "kubeConfigSecret":{"kubeConfigPath":"/path/management.yaml",
+// "namespace":"nalej", "name":"cluster-kubeconfig", "keyPath":"/path/kubeconfig.key"}
+
+package rke
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/backup"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/k8s"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultKubeConfigOutput is the workflow output set with the path of the kubeconfig if none is set.
+const DefaultKubeConfigOutput = "rke.kubeConfigPath"
+
+// DefaultKubeConfigSecretNamespace is the namespace of the management cluster storing the kubeconfig if none is set.
+const DefaultKubeConfigSecretNamespace = "nalej"
+
+// KubeConfigSecretKey is the key of the secret data with the encrypted kubeconfig.
+const KubeConfigSecretKey = "kubeconfig.enc"
+
+// KubeConfigClusterAnnotation is the annotation of the secret with the name of the cluster.
+const KubeConfigClusterAnnotation = "installer.nalej.com/cluster"
+
+// KubeConfigSecret with the secret of the management cluster storing the kubeconfig of a new cluster.
+type KubeConfigSecret struct {
+	// KubeConfigPath with the kubeconfig of the management cluster.
+	KubeConfigPath string `json:"kubeConfigPath"`
+	// Namespace of the secret, nalej by default.
+	Namespace string `json:"namespace"`
+	// Name of the secret, <clusterName>-kubeconfig by default.
+	Name string `json:"name"`
+	// KeyPath with the base64 encoded key encrypting the kubeconfig.
+	KeyPath string `json:"keyPath"`
+}
+
+// KubeConfigHandoff with the parameters handing the kubeconfig of a new cluster to the following commands.
+type KubeConfigHandoff struct {
+	// Output is the name of the workflow output set with the path of the kubeconfig.
+	Output string `json:"output"`
+	// KubeConfigSecret stores the encrypted kubeconfig in the management cluster if set.
+	KubeConfigSecret *KubeConfigSecret `json:"kubeConfigSecret"`
+}
+
+func (s *KubeConfigSecret) getNamespace() string {
+	if s.Namespace != "" {
+		return s.Namespace
+	}
+	return DefaultKubeConfigSecretNamespace
+}
+
+func (s *KubeConfigSecret) getName(clusterName string) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return fmt.Sprintf("%s-kubeconfig", clusterName)
+}
+
+// Secret builds the secret storing the encrypted kubeconfig of a cluster.
+//   params:
+//     clusterName The name of the cluster.
+//     kubeConfig The content of the kubeconfig.
+//   returns:
+//     The secret.
+//     An error if the key cannot be loaded or the kubeconfig cannot be encrypted.
+func (s *KubeConfigSecret) Secret(clusterName string, kubeConfig []byte) (*v1.Secret, derrors.Error) {
+	if s.KeyPath == "" {
+		return nil, derrors.NewInvalidArgumentError(errors.InvalidCommandParameters).WithParams("kubeConfigSecret.keyPath")
+	}
+	key, err := backup.LoadKey(s.KeyPath, true)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := backup.Encrypt(key, kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Secret{
+		TypeMeta: metaV1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		Type: v1.SecretTypeOpaque,
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        s.getName(clusterName),
+			Namespace:   s.getNamespace(),
+			Annotations: map[string]string{KubeConfigClusterAnnotation: clusterName},
+		},
+		Data: map[string][]byte{
+			KubeConfigSecretKey: sealed,
+		},
+	}, nil
+}
+
+// Store creates or updates the secret of the management cluster with the encrypted kubeconfig of a cluster.
+func (s *KubeConfigSecret) Store(clusterName string, kubeConfig []byte) derrors.Error {
+	secret, err := s.Secret(clusterName, kubeConfig)
+	if err != nil {
+		return err
+	}
+	management := &k8s.Kubernetes{KubeConfigPath: s.KubeConfigPath}
+	if err := management.Connect(); err != nil {
+		return err
+	}
+	return management.Apply(secret, k8s.ApplyOptions{}, &k8s.ApplySummary{})
+}
+
+func (h *KubeConfigHandoff) getOutput() string {
+	if h.Output != "" {
+		return h.Output
+	}
+	return DefaultKubeConfigOutput
+}
+
+// handoff stores the kubeconfig of a new cluster if requested, and returns the successful result of the command with
+// the output referencing it.
+//   params:
+//     clusterName The name of the new cluster.
+//     kubeConfigPath The path of the kubeconfig of the new cluster.
+//     msg The message of the result.
+//   returns:
+//     The result of the command.
+//     An error if the kubeconfig cannot be read.
+func (h *KubeConfigHandoff) handoff(clusterName string, kubeConfigPath string, msg string) (*entities.CommandResult, derrors.Error) {
+	if h.KubeConfigSecret != nil {
+		kubeConfig, err := ioutil.ReadFile(kubeConfigPath)
+		if err != nil {
+			return nil, derrors.AsError(err, errors.IOError)
+		}
+		if err := h.KubeConfigSecret.Store(clusterName, kubeConfig); err != nil {
+			log.Warn().Str("trace", err.DebugReport()).Msg("cannot store the kubeconfig in the management cluster")
+			return entities.NewCommandResult(false, "cannot store the kubeconfig in the management cluster", err), nil
+		}
+		log.Info().Str("namespace", h.KubeConfigSecret.getNamespace()).
+			Str("secret", h.KubeConfigSecret.getName(clusterName)).Msg("KubeConfig stored")
+	}
+	return entities.NewCommandResult(true, msg, nil).
+		WithOutputs(map[string]string{h.getOutput(): kubeConfigPath}), nil
+}
+
+// explainHandoff returns the output and the secret receiving the kubeconfig for the explain plan.
+func (h *KubeConfigHandoff) explainHandoff(clusterName string, header string) string {
+	result := fmt.Sprintf("%sOutput: %s", header, h.getOutput())
+	if h.KubeConfigSecret != nil {
+		result = result + fmt.Sprintf("\n%sKubeConfig secret: %s/%s", header, h.KubeConfigSecret.getNamespace(),
+			h.KubeConfigSecret.getName(clusterName))
+	}
+	return result
+}
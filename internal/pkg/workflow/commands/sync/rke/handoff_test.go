@@ -0,0 +1,91 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package rke
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nalej/installer/internal/pkg/backup"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Kubeconfig handoff", func() {
+
+	var dir string
+	var kubeConfigPath string
+	kubeConfig := []byte("apiVersion: v1\nkind: Config\nusers:\n- name: kube-admin-nalej\n")
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "handoff")
+		gomega.Expect(err).To(gomega.Succeed())
+		kubeConfigPath = filepath.Join(dir, "kube_config_nalej.yml")
+		gomega.Expect(ioutil.WriteFile(kubeConfigPath, kubeConfig, 0600)).To(gomega.Succeed())
+	})
+
+	ginkgo.AfterEach(func() {
+		gomega.Expect(os.RemoveAll(dir)).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should set the path of the kubeconfig as a workflow output", func() {
+		handoff := &KubeConfigHandoff{}
+		result, err := handoff.handoff("nalej", kubeConfigPath, "rke finished successfully")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Success).To(gomega.BeTrue())
+		gomega.Expect(result.Outputs).To(gomega.Equal(map[string]string{DefaultKubeConfigOutput: kubeConfigPath}))
+
+		handoff.Output = "app.kubeConfigPath"
+		result, err = handoff.handoff("nalej", kubeConfigPath, "rke finished successfully")
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(result.Outputs).To(gomega.HaveKeyWithValue("app.kubeConfigPath", kubeConfigPath))
+	})
+
+	ginkgo.It("should encrypt the kubeconfig stored in the secret", func() {
+		keyPath := filepath.Join(dir, "kubeconfig.key")
+		secretConfig := &KubeConfigSecret{KeyPath: keyPath}
+		secret, err := secretConfig.Secret("nalej", kubeConfig)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(secret.Namespace).To(gomega.Equal(DefaultKubeConfigSecretNamespace))
+		gomega.Expect(secret.Name).To(gomega.Equal("nalej-kubeconfig"))
+		gomega.Expect(secret.Annotations).To(gomega.HaveKeyWithValue(KubeConfigClusterAnnotation, "nalej"))
+		sealed := secret.Data[KubeConfigSecretKey]
+		gomega.Expect(string(sealed)).NotTo(gomega.ContainSubstring("kube-admin-nalej"))
+
+		key, err := backup.LoadKey(keyPath, false)
+		gomega.Expect(err).To(gomega.Succeed())
+		opened, err := backup.Decrypt(key, sealed)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(opened).To(gomega.Equal(kubeConfig))
+	})
+
+	ginkgo.It("should require the key encrypting the kubeconfig", func() {
+		_, err := (&KubeConfigSecret{Name: "app-kubeconfig"}).Secret("nalej", kubeConfig)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should explain where the kubeconfig is handed", func() {
+		install := NewRKEInstall("/bin/rke", *NewClusterConfig("nalej", []string{"172.1.1.0"}, "root", "/key"), "/tmp", "")
+		install.KubeConfigSecret = &KubeConfigSecret{Namespace: "clusters", KeyPath: "/kubeconfig.key"}
+		explained := install.PrettyPrint(0)
+		gomega.Expect(explained).To(gomega.ContainSubstring("Output: " + DefaultKubeConfigOutput))
+		gomega.Expect(explained).To(gomega.ContainSubstring("KubeConfig secret: clusters/nalej-kubeconfig"))
+	})
+})
@@ -0,0 +1,229 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// RKE2
+// RKE2 replaces RKE, which is approaching its end of life. Instead of running a binary that connects to the nodes,
+// RKE2 is installed on each node through SSH with its install script and runs as a systemd service. The first three
+// nodes run the server, which embeds etcd and the control plane, and the rest run the agent. The nodes join the first
+// one on the supervisor port with a token shared by the cluster.
+
+package rke
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	syncCmd "github.com/nalej/installer/internal/pkg/workflow/commands/sync"
+	"github.com/nalej/installer/internal/pkg/workflow/commands/sync/connection"
+	"gopkg.in/yaml.v2"
+)
+
+// RKE2InstallURL is the location of the install script of RKE2.
+const RKE2InstallURL = "https://get.rke2.io"
+
+// DefaultRKE2Version is the version of RKE2 installed if none is set.
+const DefaultRKE2Version = "v1.28.10+rke2r1"
+
+// RKE2ConfigDir is the directory of the configuration of RKE2 on the nodes.
+const RKE2ConfigDir = "/etc/rancher/rke2"
+
+// RKE2ConfigFile is the configuration file of RKE2 on the nodes.
+const RKE2ConfigFile = RKE2ConfigDir + "/config.yaml"
+
+// RKE2KubeConfigFile is the kubeconfig written by the servers of RKE2.
+const RKE2KubeConfigFile = RKE2ConfigDir + "/rke2.yaml"
+
+// RKE2SupervisorPort is the port of the servers joined by the rest of the nodes.
+const RKE2SupervisorPort = "9345"
+
+// RKE2APIServerPort is the port of the API server of the servers.
+const RKE2APIServerPort = "6443"
+
+// RKE2ServerNodes is the number of nodes running the server, the first ones of the cluster. Smaller clusters run a
+// single server, as etcd needs an odd number of members to tolerate a failure.
+const RKE2ServerNodes = 3
+
+// RKE2UninstallScripts contains the locations of the uninstall script of RKE2, which depend on the install method.
+var RKE2UninstallScripts = []string{"/usr/local/bin/rke2-uninstall.sh", "/usr/bin/rke2-uninstall.sh",
+	"/opt/rke2/bin/rke2-uninstall.sh"}
+
+var rke2VersionRegex = regexp.MustCompile(`^v[0-9]+\.[0-9]+\.[0-9]+\+rke2r[0-9]+$`)
+var rke2TokenRegex = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// RKE2Config defines the options required to install RKE2 on a set of nodes.
+type RKE2Config struct {
+	ClusterConfig
+	// Version of RKE2, such as v1.28.10+rke2r1. If not set, DefaultRKE2Version is used.
+	Version string `json:"rke2Version"`
+	// Token shared by the nodes to join the cluster, generated on install if not set.
+	Token string `json:"token"`
+}
+
+// getVersion returns the version of RKE2 to be installed.
+func (c RKE2Config) getVersion() string {
+	if c.Version != "" {
+		return c.Version
+	}
+	return DefaultRKE2Version
+}
+
+// Validate checks the options that are written into the install script.
+func (c RKE2Config) Validate() derrors.Error {
+	if len(c.TargetNodes) == 0 {
+		return derrors.NewInvalidArgumentError("no target nodes")
+	}
+	if !rke2VersionRegex.MatchString(c.getVersion()) {
+		return derrors.NewInvalidArgumentError("invalid RKE2 version").WithParams(c.Version)
+	}
+	if c.Token != "" && !rke2TokenRegex.MatchString(c.Token) {
+		return derrors.NewInvalidArgumentError("the RKE2 token must be alphanumeric")
+	}
+	return nil
+}
+
+// ensureToken generates the token of the cluster if none is set.
+func (c *RKE2Config) ensureToken() derrors.Error {
+	if c.Token != "" {
+		return nil
+	}
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return derrors.NewInternalError("cannot generate the RKE2 token", err)
+	}
+	c.Token = hex.EncodeToString(token)
+	return nil
+}
+
+// Servers returns the number of nodes running the server of RKE2.
+func (c RKE2Config) Servers() int {
+	if len(c.TargetNodes) < RKE2ServerNodes {
+		return 1
+	}
+	return RKE2ServerNodes
+}
+
+// IsServer checks if a node runs the server of RKE2.
+//   params:
+//     index The index of the node in the target nodes.
+func (c RKE2Config) IsServer(index int) bool {
+	return index < c.Servers()
+}
+
+// ServerURL returns the URL of a port of the first server, joined by the rest of the nodes.
+func (c RKE2Config) ServerURL(port string) string {
+	return fmt.Sprintf("https://%s", net.JoinHostPort(c.TargetNodes[0], port))
+}
+
+// NodeConfig returns the content of the configuration file of RKE2 on a node. The nodes are labeled with their
+// role in the platform as with RKE.
+//   params:
+//     index The index of the node in the target nodes.
+//   returns:
+//     The configuration in YAML.
+//     An error if it cannot be marshalled.
+func (c RKE2Config) NodeConfig(index int) (string, derrors.Error) {
+	role := "management"
+	if !c.IsServer(index) {
+		role = "compute"
+	}
+	config := map[string]interface{}{
+		"token":      c.Token,
+		"node-label": []string{fmt.Sprintf("nalej.com/role=%s", role)},
+	}
+	if index > 0 {
+		config["server"] = c.ServerURL(RKE2SupervisorPort)
+	}
+	if c.IsServer(index) {
+		config["tls-san"] = []string{c.TargetNodes[index]}
+		config["write-kubeconfig-mode"] = "0600"
+		if c.IPv6Only() {
+			// Unique local IPv6 ranges of the pods and services as the nodes only have IPv6 addresses.
+			config["cluster-cidr"] = "fd01::/48"
+			config["service-cidr"] = "fd98::/108"
+			config["cluster-dns"] = "fd98::a"
+		}
+	}
+	content, err := yaml.Marshal(config)
+	if err != nil {
+		return "", derrors.NewInternalError("cannot marshal RKE2 config", err)
+	}
+	return string(content), nil
+}
+
+// installScript builds the shell script installing RKE2 on a node with its configuration.
+func (c RKE2Config) installScript(index int, config string) string {
+	installType := "agent"
+	if c.IsServer(index) {
+		installType = "server"
+	}
+	var b strings.Builder
+	b.WriteString("set -e\n")
+	fmt.Fprintf(&b, "mkdir -p %s\n", RKE2ConfigDir)
+	fmt.Fprintf(&b, "cat > %s <<'EOF'\n%sEOF\n", RKE2ConfigFile, config)
+	fmt.Fprintf(&b, "chmod 600 %s\n", RKE2ConfigFile)
+	fmt.Fprintf(&b, "curl -sfL %s | INSTALL_RKE2_VERSION=%s INSTALL_RKE2_TYPE=%s sh -\n",
+		RKE2InstallURL, c.getVersion(), installType)
+	fmt.Fprintf(&b, "systemctl enable rke2-%s\nsystemctl restart rke2-%s\n", installType, installType)
+	return b.String()
+}
+
+// removeScript builds the shell script removing RKE2 from a node.
+func removeScript() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "for script in %s; do\n", strings.Join(RKE2UninstallScripts, " "))
+	b.WriteString("  if [ -x \"$script\" ]; then \"$script\"; exit 0; fi\n")
+	b.WriteString("done\n")
+	return b.String()
+}
+
+// remoteScript returns the command that runs a script on a node. The script is encoded to avoid quoting issues, and
+// executed with sudo unless connecting as root.
+func (c RKE2Config) remoteScript(script string) string {
+	encoded := base64.StdEncoding.EncodeToString([]byte(script))
+	return fmt.Sprintf("echo %s | base64 -d | %ssh", encoded, c.sudo())
+}
+
+// sudo returns the prefix of the commands requiring root privileges on the nodes.
+func (c RKE2Config) sudo() string {
+	if c.NodeUsername == "root" {
+		return ""
+	}
+	return "sudo -n "
+}
+
+// connect opens an SSH connection to a node.
+func (c RKE2Config) connect(node string) (*connection.SSHConnection, derrors.Error) {
+	conn, err := connection.NewSSHConnection(node, syncCmd.DefaultSSHPort, c.NodeUsername, "", c.PrivateKeyPath, "")
+	if err != nil {
+		return nil, derrors.NewInternalError(errors.SSHConnectionError, err).WithParams(node)
+	}
+	return conn, nil
+}
+
+// ClusterKubeConfig returns the kubeconfig written by the first server with the address of the node instead of the
+// local one, so it can be used from outside the node.
+func (c RKE2Config) ClusterKubeConfig(raw []byte) []byte {
+	local := fmt.Sprintf("https://%s", net.JoinHostPort("127.0.0.1", RKE2APIServerPort))
+	return []byte(strings.Replace(string(raw), local, c.ServerURL(RKE2APIServerPort), -1))
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package rke
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+)
+
+var _ = ginkgo.Describe("RKE2", func() {
+
+	nodeConfig := func(config RKE2Config, index int) map[string]interface{} {
+		content, err := config.NodeConfig(index)
+		gomega.Expect(err).To(gomega.Succeed())
+		result := make(map[string]interface{}, 0)
+		gomega.Expect(yaml.Unmarshal([]byte(content), &result)).To(gomega.Succeed())
+		return result
+	}
+
+	ginkgo.It("should join the servers and agents to the first server", func() {
+		config := RKE2Config{ClusterConfig: *getClusterConfig(4), Token: "secret"}
+		gomega.Expect(config.Validate()).To(gomega.Succeed())
+
+		first := nodeConfig(config, 0)
+		gomega.Expect(first).NotTo(gomega.HaveKey("server"))
+		gomega.Expect(first["token"]).To(gomega.Equal("secret"))
+		gomega.Expect(first["tls-san"]).To(gomega.Equal([]interface{}{"172.1.1.0"}))
+
+		second := nodeConfig(config, 2)
+		gomega.Expect(second["server"]).To(gomega.Equal("https://172.1.1.0:9345"))
+		gomega.Expect(second["node-label"]).To(gomega.Equal([]interface{}{"nalej.com/role=management"}))
+
+		agent := nodeConfig(config, 3)
+		gomega.Expect(agent).NotTo(gomega.HaveKey("tls-san"))
+		gomega.Expect(agent["node-label"]).To(gomega.Equal([]interface{}{"nalej.com/role=compute"}))
+		content, _ := config.NodeConfig(3)
+		gomega.Expect(config.installScript(3, content)).To(gomega.ContainSubstring(
+			"INSTALL_RKE2_VERSION=" + DefaultRKE2Version + " INSTALL_RKE2_TYPE=agent sh -"))
+	})
+
+	ginkgo.It("should run a single server on clusters with less than three nodes", func() {
+		config := RKE2Config{ClusterConfig: *getClusterConfig(2), Token: "secret"}
+		gomega.Expect(config.Validate()).To(gomega.Succeed())
+		gomega.Expect(config.Servers()).To(gomega.Equal(1))
+		gomega.Expect(config.IsServer(0)).To(gomega.BeTrue())
+		gomega.Expect(config.IsServer(1)).To(gomega.BeFalse())
+
+		agent := nodeConfig(config, 1)
+		gomega.Expect(agent["server"]).To(gomega.Equal("https://172.1.1.0:9345"))
+		gomega.Expect(agent).NotTo(gomega.HaveKey("tls-san"))
+		gomega.Expect(agent["node-label"]).To(gomega.Equal([]interface{}{"nalej.com/role=compute"}))
+		content, _ := config.NodeConfig(1)
+		gomega.Expect(config.installScript(1, content)).To(gomega.ContainSubstring("INSTALL_RKE2_TYPE=agent"))
+
+		gomega.Expect(RKE2Config{ClusterConfig: *getClusterConfig(3)}.Servers()).To(gomega.Equal(3))
+	})
+
+	ginkgo.It("should assign IPv6 ranges when the nodes only have IPv6 addresses", func() {
+		config := RKE2Config{ClusterConfig: *NewClusterConfig("nalej", []string{"fd00::1", "fd00::2"}, "root", "key")}
+		gomega.Expect(config.ensureToken()).To(gomega.Succeed())
+		gomega.Expect(config.Token).To(gomega.HaveLen(64))
+		gomega.Expect(config.Validate()).To(gomega.Succeed())
+		gomega.Expect(nodeConfig(config, 0)["cluster-cidr"]).To(gomega.Equal("fd01::/48"))
+		gomega.Expect(nodeConfig(config, 1)["server"]).To(gomega.Equal("https://[fd00::1]:9345"))
+		kubeConfig := config.ClusterKubeConfig([]byte("    server: https://127.0.0.1:6443\n"))
+		gomega.Expect(string(kubeConfig)).To(gomega.Equal("    server: https://[fd00::1]:6443\n"))
+		gomega.Expect(config.remoteScript("true")).NotTo(gomega.ContainSubstring("sudo"))
+	})
+
+	ginkgo.It("should reject invalid versions and tokens", func() {
+		config := RKE2Config{ClusterConfig: *getClusterConfig(1), Version: "1.28; rm -rf /"}
+		gomega.Expect(config.Validate()).NotTo(gomega.Succeed())
+		config = RKE2Config{ClusterConfig: *getClusterConfig(1), Token: "a'b"}
+		gomega.Expect(config.Validate()).NotTo(gomega.Succeed())
+		config = RKE2Config{ClusterConfig: *getClusterConfig(1), Version: "v1.27.3+rke2r1"}
+		gomega.Expect(config.Validate()).To(gomega.Succeed())
+	})
+})
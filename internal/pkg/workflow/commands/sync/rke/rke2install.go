@@ -0,0 +1,147 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// RKE2 install command
+// Installs RKE2 on the target nodes, starting with the servers, and stores the kubeconfig of the cluster as RKE does,
+// handing it to the following commands through the same output.
+//
+// {"type":"sync", "name":"rke2Install", "clusterName":"nalej", "targetNodes":["10.0.0.1", "10.0.0.2"],
+// "nodeUsername":"username", "privateKeyPath":"/path/key", "rke2Version":"v1.28.10+rke2r1",
+// "kubeConfigOutputPath":"/path", "output":"rke.kubeConfigPath"}
+
+package rke
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/nalej/installer/internal/pkg/workflow/handler"
+	"github.com/rs/zerolog/log"
+)
+
+// RKE2Install structure defining the fields required to install a cluster using RKE2.
+type RKE2Install struct {
+	entities.GenericSyncCommand
+	RKE2Config
+	KubeConfigOutputPath string `json:"kubeConfigOutputPath"`
+	KubeConfigHandoff
+}
+
+// NewRKE2Install create a new command with all parameters.
+func NewRKE2Install(config RKE2Config, kubeConfigOutputPath string) *RKE2Install {
+	return &RKE2Install{
+		*entities.NewSyncCommand(entities.RKE2Install),
+		config, kubeConfigOutputPath, KubeConfigHandoff{}}
+}
+
+// NewRKE2InstallFromJSON creates a RKE2 Install command from a JSON object.
+func NewRKE2InstallFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	f := &RKE2Install{}
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	f.CommandID = entities.GenerateCommandID(f.Name())
+	var r entities.Command = f
+	return &r, nil
+}
+
+// installNode installs RKE2 on a node, waiting for its service to start.
+func (cmd *RKE2Install) installNode(index int) derrors.Error {
+	node := cmd.TargetNodes[index]
+	config, err := cmd.NodeConfig(index)
+	if err != nil {
+		return err
+	}
+	conn, err := cmd.connect(node)
+	if err != nil {
+		return err
+	}
+	output, execErr := conn.Execute(cmd.remoteScript(cmd.installScript(index, config)))
+	if execErr != nil {
+		log.Warn().Str("targetHost", node).Err(execErr).Str("output", string(output)).Msg("cannot install RKE2")
+		return derrors.NewInternalError(errors.SSHConnectionError, execErr).WithParams(node)
+	}
+	return nil
+}
+
+// copyKubeConfig retrieves the kubeconfig of the cluster from the first server and stores it on the output path
+// with the name used by RKEInstall.
+func (cmd *RKE2Install) copyKubeConfig() (*entities.CommandResult, derrors.Error) {
+	conn, err := cmd.connect(cmd.TargetNodes[0])
+	if err != nil {
+		return nil, err
+	}
+	raw, execErr := conn.Execute(fmt.Sprintf("%scat %s", cmd.sudo(), RKE2KubeConfigFile))
+	if execErr != nil {
+		return entities.NewCommandResult(false, "cannot retrieve the kubeconfig of RKE2",
+			derrors.NewInternalError(errors.SSHConnectionError, execErr).WithParams(cmd.TargetNodes[0])), nil
+	}
+	kubeToFile := fmt.Sprintf("%s/kube_config_%s_%s.yml", cmd.KubeConfigOutputPath, cmd.ClusterName, NodeFileName(cmd.TargetNodes[0]))
+	if err := ioutil.WriteFile(kubeToFile, cmd.ClusterKubeConfig(raw), 0600); err != nil {
+		return nil, derrors.AsError(err, errors.IOError)
+	}
+	log.Info().Str("NewKubeConfig", kubeToFile).Msg("KubeConfig available")
+	return cmd.handoff(cmd.ClusterName, kubeToFile, "rke2 finished successfully")
+}
+
+// Run triggers the execution of the command.
+func (cmd *RKE2Install) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	if err := cmd.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cmd.DetectArchitectures(); err != nil {
+		return entities.NewCommandResult(false, "cannot detect the architecture of the nodes", err), nil
+	}
+	if err := cmd.ensureToken(); err != nil {
+		return nil, err
+	}
+	commandHandler := handler.GetCommandHandler()
+	// The servers are installed first, as the rest of the nodes join the first one.
+	for index, node := range cmd.TargetNodes {
+		role := "agent"
+		if cmd.IsServer(index) {
+			role = "server"
+		}
+		commandHandler.AddLogEntry(cmd.CommandID, fmt.Sprintf("installing RKE2 %s on %s", role, node))
+		if err := cmd.installNode(index); err != nil {
+			return entities.NewCommandResult(false, fmt.Sprintf("cannot install RKE2 on %s", node), err), nil
+		}
+	}
+	return cmd.copyKubeConfig()
+}
+
+// Obtain a string representation
+func (cmd *RKE2Install) String() string {
+	return fmt.Sprintf("SYNC RKE2 Install %s on %s", cmd.getVersion(), strings.Join(cmd.TargetNodes, ", "))
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (cmd *RKE2Install) PrettyPrint(indentation int) string {
+	outputPath := strings.Repeat("  ", indentation) + fmt.Sprintf("  OutputPath: %s", cmd.KubeConfigOutputPath)
+	handoff := cmd.explainHandoff(cmd.ClusterName, strings.Repeat("  ", indentation)+"  ")
+	return strings.Repeat(" ", indentation) + fmt.Sprintf("%s\n%s\n%s", cmd.String(), outputPath, handoff)
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (cmd *RKE2Install) UserString() string {
+	return fmt.Sprintf("Installing Kubernetes with RKE2 on %s ", strings.Join(cmd.TargetNodes, ", "))
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// RKE2 remove command
+// Removes RKE2 from the target nodes with its uninstall script, starting with the agents.
+//
+// {"type":"sync", "name":"rke2Remove", "clusterName":"nalej", "targetNodes":["10.0.0.1", "10.0.0.2"],
+// "nodeUsername":"username", "privateKeyPath":"/path/key"}
+
+package rke
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/nalej/installer/internal/pkg/workflow/handler"
+	"github.com/rs/zerolog/log"
+)
+
+// RKE2Remove structure defining the fields required to uninstall a cluster using RKE2.
+type RKE2Remove struct {
+	entities.GenericSyncCommand
+	RKE2Config
+}
+
+// NewRKE2Remove create a new command with all parameters.
+func NewRKE2Remove(config RKE2Config) *RKE2Remove {
+	return &RKE2Remove{
+		*entities.NewSyncCommand(entities.RKE2Remove),
+		config}
+}
+
+// NewRKE2RemoveFromJSON creates a RKE2 Remove command from a JSON object.
+func NewRKE2RemoveFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	f := &RKE2Remove{}
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	f.CommandID = entities.GenerateCommandID(f.Name())
+	var r entities.Command = f
+	return &r, nil
+}
+
+// Run triggers the execution of the command.
+func (cmd *RKE2Remove) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	if len(cmd.TargetNodes) == 0 {
+		return nil, derrors.NewInvalidArgumentError("no target nodes")
+	}
+	commandHandler := handler.GetCommandHandler()
+	toExecute := cmd.remoteScript(removeScript())
+	// The agents are removed first, so the servers remain available while they leave the cluster.
+	for index := len(cmd.TargetNodes) - 1; index >= 0; index-- {
+		node := cmd.TargetNodes[index]
+		commandHandler.AddLogEntry(cmd.CommandID, fmt.Sprintf("removing RKE2 from %s", node))
+		conn, err := cmd.connect(node)
+		if err != nil {
+			return entities.NewCommandResult(false, fmt.Sprintf("cannot remove RKE2 from %s", node), err), nil
+		}
+		output, execErr := conn.Execute(toExecute)
+		if execErr != nil {
+			log.Warn().Str("targetHost", node).Err(execErr).Str("output", string(output)).Msg("cannot remove RKE2")
+			return entities.NewCommandResult(false, fmt.Sprintf("cannot remove RKE2 from %s", node),
+				derrors.NewInternalError(errors.SSHConnectionError, execErr).WithParams(node)), nil
+		}
+	}
+	return entities.NewCommandResult(true, "rke2 removed successfully", nil), nil
+}
+
+// Obtain a string representation
+func (cmd *RKE2Remove) String() string {
+	return fmt.Sprintf("SYNC RKE2 Remove on %s", strings.Join(cmd.TargetNodes, ", "))
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (cmd *RKE2Remove) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + cmd.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (cmd *RKE2Remove) UserString() string {
+	return fmt.Sprintf("Removing Kubernetes with RKE2 on %s ", strings.Join(cmd.TargetNodes, ", "))
+}
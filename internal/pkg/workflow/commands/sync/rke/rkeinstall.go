@@ -26,7 +26,6 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path"
 	"strings"
 	"sync"
@@ -40,9 +39,12 @@ import (
 type RKEInstall struct {
 	entities.GenericSyncCommand
 	RkeBinaryPath string `json:"rkeBinaryPath"`
+	// RkeImage with the pinned image running rke in a container instead of the binary.
+	RkeImage string `json:"rkeImage"`
 	ClusterConfig
 	KubeConfigOutputPath string `json:"kubeConfigOutputPath"`
-	installTemplate      string
+	KubeConfigHandoff
+	installTemplate string
 }
 
 // NewRKEInstall create a new command with all parameters.
@@ -53,8 +55,8 @@ func NewRKEInstall(
 	installTemplate string) *RKEInstall {
 	return &RKEInstall{
 		*entities.NewSyncCommand(entities.RKEInstall),
-		rkeBinaryPath,
-		clusterConfig, kubeConfigOutputPath, installTemplate}
+		rkeBinaryPath, "",
+		clusterConfig, kubeConfigOutputPath, KubeConfigHandoff{}, installTemplate}
 }
 
 // NewRKEInstallFromJSON creates a RKE Install command from a JSON object.
@@ -84,6 +86,9 @@ func (cmd *RKEInstall) CreateClusterConfig() (string, derrors.Error) {
 	if err != nil {
 		return "", err
 	}
+	if err := template.ValidateSchema(yamlString); err != nil {
+		return "", err
+	}
 	clusterFile, createErr := ioutil.TempFile("", "cluster.yaml")
 	if createErr != nil {
 		return "", derrors.AsError(createErr, errors.IOError)
@@ -120,7 +125,7 @@ func (cmd *RKEInstall) copyKubeConfig(clusterConfigFile string) (*entities.Comma
 	}
 	defer from.Close()
 
-	kubeToFile := fmt.Sprintf("%s/kube_config_%s_%s.yml", cmd.KubeConfigOutputPath, cmd.ClusterName, cmd.TargetNodes[0])
+	kubeToFile := fmt.Sprintf("%s/kube_config_%s_%s.yml", cmd.KubeConfigOutputPath, cmd.ClusterName, NodeFileName(cmd.TargetNodes[0]))
 	to, err := os.OpenFile(kubeToFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return nil, derrors.AsError(err, errors.IOError)
@@ -132,19 +137,25 @@ func (cmd *RKEInstall) copyKubeConfig(clusterConfigFile string) (*entities.Comma
 		return nil, derrors.AsError(err, errors.IOError)
 	}
 	log.Info().Str("NewKubeConfig", kubeToFile).Msg("KubeConfig available")
-	return entities.NewCommandResult(true, "rke finished successfully", nil), nil
+	return cmd.handoff(cmd.ClusterName, kubeToFile, "rke finished successfully")
 }
 
 // Run triggers the execution of the command.
 func (cmd *RKEInstall) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	if err := cmd.DetectArchitectures(); err != nil {
+		return entities.NewCommandResult(false, "cannot detect the architecture of the nodes", err), nil
+	}
 	clusterConfigPath, err := cmd.CreateClusterConfig()
 	if err != nil {
 		log.Warn().Err(err).Msg("unable to create cluster config")
 		return nil, err
 	}
 
-	log.Debug().Str("path", cmd.RkeBinaryPath).Msg("RKE binary")
-	rke := exec.Command(cmd.RkeBinaryPath, "up", "--config", clusterConfigPath)
+	log.Debug().Str("path", cmd.RkeBinaryPath).Str("image", cmd.RkeImage).Msg("RKE binary")
+	rke, err := rkeCommand(cmd.RkeBinaryPath, cmd.RkeImage, cmd.ClusterConfig, "up", "--config", clusterConfigPath)
+	if err != nil {
+		return nil, err
+	}
 	rkeOut, pipeErr := rke.StdoutPipe()
 	if pipeErr != nil {
 		return nil, derrors.AsError(pipeErr, errors.IOError)
@@ -190,8 +201,10 @@ func (cmd *RKEInstall) String() string {
 func (cmd *RKEInstall) PrettyPrint(indentation int) string {
 	outputPath := strings.Repeat("  ", indentation) + fmt.Sprintf("  OutputPath: %s", cmd.KubeConfigOutputPath)
 	binaryPath := strings.Repeat("  ", indentation) + fmt.Sprintf("  RKE binary: %s", cmd.RkeBinaryPath)
-	return strings.Repeat(" ", indentation) + fmt.Sprintf("SYNC RKE Install on %s\n%s\n%s",
-		strings.Join(cmd.TargetNodes, ", "), binaryPath, outputPath)
+	handoff := cmd.explainHandoff(cmd.ClusterName, strings.Repeat("  ", indentation)+"  ")
+	return strings.Repeat(" ", indentation) + fmt.Sprintf("SYNC RKE Install on %s\n%s\n%s\n%s\n%s",
+		strings.Join(cmd.TargetNodes, ", "), binaryPath, outputPath, handoff,
+		explainClusterFile(cmd.getTemplate(), cmd.ClusterConfig, indentation))
 }
 
 // UserString returns a simple string representation of the command for the user.
@@ -25,7 +25,6 @@ import (
 	"github.com/rs/zerolog/log"
 	"io"
 	"io/ioutil"
-	"os/exec"
 	"strings"
 	"sync"
 
@@ -39,6 +38,8 @@ import (
 type RKERemove struct {
 	entities.GenericSyncCommand
 	RkeBinaryPath string `json:"rkeBinaryPath"`
+	// RkeImage with the pinned image running rke in a container instead of the binary.
+	RkeImage string `json:"rkeImage"`
 	ClusterConfig
 	installTemplate string
 }
@@ -50,7 +51,7 @@ func NewRKERemove(
 	installTemplate string) *RKERemove {
 	return &RKERemove{
 		*entities.NewSyncCommand(entities.RKERemove),
-		rkeBinaryPath,
+		rkeBinaryPath, "",
 		clusterConfig, installTemplate}
 }
 
@@ -81,6 +82,9 @@ func (cmd *RKERemove) CreateClusterConfig() (string, derrors.Error) {
 	if err != nil {
 		return "", err
 	}
+	if err := template.ValidateSchema(yamlString); err != nil {
+		return "", err
+	}
 	clusterFile, createErr := ioutil.TempFile("", "cluster.yaml")
 	if createErr != nil {
 		return "", derrors.AsError(createErr, errors.IOError)
@@ -112,8 +116,11 @@ func (cmd *RKERemove) Run(workflowID string) (*entities.CommandResult, derrors.E
 		return nil, err
 	}
 
-	log.Debug().Str("path", cmd.RkeBinaryPath).Msg("RKE binary")
-	rke := exec.Command(cmd.RkeBinaryPath, "remove", "--config", clusterConfigPath, "--force")
+	log.Debug().Str("path", cmd.RkeBinaryPath).Str("image", cmd.RkeImage).Msg("RKE binary")
+	rke, err := rkeCommand(cmd.RkeBinaryPath, cmd.RkeImage, cmd.ClusterConfig, "remove", "--config", clusterConfigPath, "--force")
+	if err != nil {
+		return nil, err
+	}
 	rkeOut, pipeErr := rke.StdoutPipe()
 	if pipeErr != nil {
 		return nil, derrors.AsError(pipeErr, errors.IOError)
@@ -158,8 +165,9 @@ func (cmd *RKERemove) String() string {
 // PrettyPrint returns a simple space indexed string.
 func (cmd *RKERemove) PrettyPrint(indentation int) string {
 	binaryPath := strings.Repeat("  ", indentation) + fmt.Sprintf("  RKE binary: %s", cmd.RkeBinaryPath)
-	return strings.Repeat(" ", indentation) + fmt.Sprintf("SYNC RKE Remove on %s\n%s",
-		strings.Join(cmd.TargetNodes, ", "), binaryPath)
+	return strings.Repeat(" ", indentation) + fmt.Sprintf("SYNC RKE Remove on %s\n%s\n%s",
+		strings.Join(cmd.TargetNodes, ", "), binaryPath,
+		explainClusterFile(cmd.getTemplate(), cmd.ClusterConfig, indentation))
 }
 
 // UserString returns a simple string representation of the command for the user.
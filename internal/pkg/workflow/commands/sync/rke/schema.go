@@ -0,0 +1,218 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// RKE cluster file schema
+// The rendered cluster.yml is checked against the fields used by RKE before running it, so a custom template with
+// missing fields, nodes without a valid role, duplicated addresses or a private key that cannot be read fails before
+// connecting to the nodes. The rendering shown in the explain plan is redacted, as custom templates may embed keys.
+
+package rke
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/logging"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// RKE roles of the nodes.
+const (
+	EtcdRole         = "etcd"
+	ControlPlaneRole = "controlplane"
+	WorkerRole       = "worker"
+)
+
+// rkeSecretRegex matches the fields of the cluster file whose values are secrets.
+var rkeSecretRegex = regexp.MustCompile(`(?m)^(\s*(?:-\s+)?(?:ssh_key|ssh_cert|password|token|secret)\s*:\s*).+$`)
+
+// rkePrivateKeyRegex matches the PEM private keys written as block scalars.
+var rkePrivateKeyRegex = regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`)
+
+// rkeNode with the fields of a node of the cluster file.
+type rkeNode struct {
+	Address    string   `yaml:"address"`
+	User       string   `yaml:"user"`
+	Role       []string `yaml:"role"`
+	SSHKeyPath string   `yaml:"ssh_key_path"`
+	SSHKey     string   `yaml:"ssh_key"`
+}
+
+// rkeClusterFile with the fields of the cluster file checked before running RKE.
+type rkeClusterFile struct {
+	Nodes       []rkeNode `yaml:"nodes"`
+	SSHKeyPath  string    `yaml:"ssh_key_path"`
+	ClusterName string    `yaml:"cluster_name"`
+}
+
+// validAddress checks that the address of a node is an IP address or a host name.
+func validAddress(address string) bool {
+	return net.ParseIP(address) != nil || len(validation.IsDNS1123Subdomain(strings.ToLower(address))) == 0
+}
+
+// readableFile checks that a file exists and can be read.
+func readableFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// ValidateSchema checks that a rendered cluster file contains the fields required by RKE.
+//   params:
+//     content The rendered cluster file.
+//   returns:
+//     An error with the issues found, if any.
+func (t *RKETemplate) ValidateSchema(content string) derrors.Error {
+	issues, err := clusterFileIssues(content)
+	if err != nil {
+		return derrors.NewInvalidArgumentError(errors.InvalidRKEClusterFile, err)
+	}
+	if len(issues) > 0 {
+		params := make([]interface{}, 0, len(issues))
+		for _, issue := range issues {
+			params = append(params, issue)
+		}
+		return derrors.NewInvalidArgumentError(errors.InvalidRKEClusterFile).WithParams(params...)
+	}
+	return nil
+}
+
+// clusterFileIssues returns the issues found validating a rendered cluster file, or an error if it cannot be parsed.
+func clusterFileIssues(content string) ([]string, error) {
+	var cluster rkeClusterFile
+	if err := yaml.Unmarshal([]byte(content), &cluster); err != nil {
+		return nil, err
+	}
+	issues := make([]string, 0)
+	addIssue := func(format string, args ...interface{}) {
+		issues = append(issues, fmt.Sprintf(format, args...))
+	}
+	if cluster.ClusterName == "" {
+		addIssue("missing cluster_name")
+	}
+	if len(cluster.Nodes) == 0 {
+		addIssue("missing nodes")
+	}
+	addresses := make(map[string]int, len(cluster.Nodes))
+	roles := make(map[string]int, 0)
+	keyPaths := make(map[string]bool, 0)
+	if cluster.SSHKeyPath != "" {
+		keyPaths[cluster.SSHKeyPath] = true
+	}
+	for index, node := range cluster.Nodes {
+		if node.Address == "" {
+			addIssue("node %d: missing address", index)
+		} else if !validAddress(node.Address) {
+			addIssue("node %d: invalid address %s", index, node.Address)
+		} else if previous, found := addresses[node.Address]; found {
+			addIssue("node %d: address %s already used by node %d", index, node.Address, previous)
+		} else {
+			addresses[node.Address] = index
+		}
+		if node.User == "" {
+			addIssue("node %d: missing user", index)
+		}
+		if len(node.Role) == 0 {
+			addIssue("node %d: missing role", index)
+		}
+		for _, role := range node.Role {
+			switch role {
+			case EtcdRole, ControlPlaneRole, WorkerRole:
+				roles[role]++
+			default:
+				addIssue("node %d: unknown role %s", index, role)
+			}
+		}
+		if node.SSHKeyPath != "" {
+			keyPaths[node.SSHKeyPath] = true
+		} else if node.SSHKey == "" && cluster.SSHKeyPath == "" {
+			addIssue("node %d: missing ssh_key_path", index)
+		}
+	}
+	if len(cluster.Nodes) > 0 {
+		for _, role := range []string{EtcdRole, ControlPlaneRole, WorkerRole} {
+			if roles[role] == 0 {
+				addIssue("no node with the %s role", role)
+			}
+		}
+	}
+	for keyPath := range keyPaths {
+		if err := readableFile(keyPath); err != nil {
+			addIssue("cannot read ssh_key_path %s: %s", keyPath, err.Error())
+		}
+	}
+	if len(issues) == 0 && roles[EtcdRole]%2 == 0 {
+		// An even number of etcd members tolerates the same failures as one member less.
+		log.Warn().Int("etcd", roles[EtcdRole]).Msg("even number of etcd nodes in the RKE cluster")
+	}
+	return issues, nil
+}
+
+// RedactClusterFile removes the secrets embedded in a rendered cluster file.
+func RedactClusterFile(content string) string {
+	result := rkePrivateKeyRegex.ReplaceAllString(content, logging.Redacted)
+	result = rkeSecretRegex.ReplaceAllString(result, "${1}"+logging.Redacted)
+	return logging.Redact(result)
+}
+
+// explainClusterFile returns the redacted rendering of the cluster file of a command for the explain plan, followed
+// by the issues found validating it. The architectures of the nodes are not detected, so the rendering assumes the
+// ones set in the command.
+//   params:
+//     content The template of the cluster file.
+//     config The configuration of the cluster.
+//     indentation The indentation of the command in the plan.
+//   returns:
+//     The indented rendering.
+func explainClusterFile(content string, config ClusterConfig, indentation int) string {
+	header := strings.Repeat("  ", indentation) + "  "
+	rendered, err := NewRKETemplate(content).ParseTemplate(&config)
+	if err != nil {
+		return header + "Invalid cluster.yml: " + err.Error()
+	}
+	var b strings.Builder
+	b.WriteString(header + "cluster.yml:")
+	for _, line := range strings.Split(strings.TrimSpace(RedactClusterFile(rendered)), "\n") {
+		if strings.TrimSpace(line) != "" {
+			b.WriteString("\n" + header + "  " + line)
+		}
+	}
+	issues, parseErr := clusterFileIssues(rendered)
+	if parseErr != nil {
+		issues = []string{parseErr.Error()}
+	}
+	for _, issue := range issues {
+		b.WriteString("\n" + header + "Invalid cluster.yml: " + issue)
+	}
+	return b.String()
+}
@@ -19,15 +19,19 @@ package rke
 
 import (
 	"bytes"
+	"encoding/json"
 	"gopkg.in/yaml.v2"
-	"html/template"
+	"strings"
+	"text/template"
 
 	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
 )
 
 // ClusterTemplate contains the YAML template for the cluster configuration required by RKE.
 // Notice that the version of kubernetes and their associated images has been extracted from:
 // https://github.com/rancher/types/blob/master/apis/management.cattle.io/v3/k8s_defaults.go#L14
+// The values set by the users are written with the quote function, as the template is rendered with text/template.
 // TODO Check roles depending on number of nodes: 1, 2, 3, 3+ with ssh_key on nodes or at cluster level.
 const ClusterTemplate string = `
 # Autogenerated by Inframgr installer.
@@ -36,8 +40,8 @@ const ClusterTemplate string = `
 # Target nodes
 nodes:
 {{ range $index, $targetNode := .TargetNodes }}
-- address: "{{$targetNode}}"
-  user: "{{$.NodeUsername}}"
+- address: {{quote $targetNode}}
+  user: {{quote $.NodeUsername}}
 {{if lt $index 3 }}  role: ["etcd", "controlplane", "worker"]
   labels:
     nalej.com/role: "management"
@@ -47,13 +51,29 @@ nodes:
 {{end}}
 
 # Cluster level SSH private key
-ssh_key_path: "{{$.PrivateKeyPath}}"
+ssh_key_path: {{quote $.PrivateKeyPath}}
 
 # Set the name of the Kubernetes cluster  
-cluster_name: "{{$.ClusterName}}"
+cluster_name: {{quote $.ClusterName}}
 
 # Kubernetes version to be installed
 kubernetes_version: v1.9.7-rancher2-1
+{{if .IPv6Only}}
+# Unique local IPv6 ranges of the pods and services as the nodes only have IPv6 addresses
+services:
+  kube-api:
+    service_cluster_ip_range: fd98::/108
+  kube-controller:
+    cluster_cidr: fd01::/48
+    service_cluster_ip_range: fd98::/108
+  kubelet:
+    cluster_dns_server: fd98::a
+{{end}}
+{{if .ARM64}}
+# Canal has no arm64 images, so the arm64 nodes use flannel
+network:
+  plugin: flannel
+{{end}}
 
 # TODO:
 # Provisioner needs un-escalated RunAsUser (what user id?)
@@ -76,18 +96,31 @@ func NewRKETemplate(content string) *RKETemplate {
 	return &RKETemplate{content}
 }
 
+// quote returns a value as a YAML double-quoted string. JSON strings are valid YAML, and escape the quotes,
+// backslashes and control characters of the value.
+func quote(value string) (string, error) {
+	buf := new(bytes.Buffer)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
 // ParseTemplate processes the golang templating on the RKE template and
-// returns a string with the content of the file.
+// returns a string with the content of the file. The template is rendered with text/template, as the HTML escaping
+// of html/template modifies the paths and names containing characters such as & or quotes.
 func (t *RKETemplate) ParseTemplate(config *ClusterConfig) (string, derrors.Error) {
-	ft := template.New("RKE cluster.yaml")
+	ft := template.New("RKE cluster.yaml").Funcs(template.FuncMap{"quote": quote})
 	ft, err := ft.Parse(t.content)
 	if err != nil {
-		return "", derrors.NewInternalError("cannot parse workflow template file", err)
+		return "", derrors.NewInternalError(errors.CannotParseTemplate, err)
 	}
 	buf := new(bytes.Buffer)
 	err = ft.Execute(buf, *config)
 	if err != nil {
-		return "", derrors.NewInternalError("cannot parse RKE cluster template file", err)
+		return "", derrors.NewInternalError(errors.CannotParseRKETemplate, err)
 	}
 	return buf.String(), nil
 }
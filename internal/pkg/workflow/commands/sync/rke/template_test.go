@@ -22,6 +22,7 @@ import (
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
 	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
 )
 
 func getClusterConfig(numNodes int) *ClusterConfig {
@@ -57,6 +58,68 @@ var _ = ginkgo.Describe("Template", func() {
 
 	})
 
+	ginkgo.It("Should assign IPv6 ranges when the nodes only have IPv6 addresses", func() {
+		config := NewClusterConfig("testClusterName", []string{"fd00::1", "fd00::2"}, "nodeUsername", "privateKeyPath")
+		gomega.Expect(config.IPv6Only()).To(gomega.BeTrue())
+		template := NewRKETemplate(ClusterTemplate)
+		yamlString, err := template.ParseTemplate(config)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(yamlString).To(gomega.ContainSubstring(`address: "fd00::1"`))
+		gomega.Expect(yamlString).To(gomega.ContainSubstring("cluster_cidr: fd01::/48"))
+		gomega.Expect(template.ValidateYAML(yamlString)).To(gomega.BeNil())
+		gomega.Expect(NodeFileName("fd00::1")).To(gomega.Equal("fd00--1"))
+
+		mixed := NewClusterConfig("testClusterName", []string{"fd00::1", "172.1.1.1"}, "nodeUsername", "privateKeyPath")
+		gomega.Expect(mixed.IPv6Only()).To(gomega.BeFalse())
+		yamlString, err = template.ParseTemplate(mixed)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(yamlString).ToNot(gomega.ContainSubstring("cluster_cidr"))
+	})
+
+	ginkgo.It("Should use flannel when there are arm64 nodes", func() {
+		config := getClusterConfig(2)
+		template := NewRKETemplate(ClusterTemplate)
+		yamlString, err := template.ParseTemplate(config)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(yamlString).ToNot(gomega.ContainSubstring("plugin: flannel"))
+
+		config.Architectures = []string{"amd64", "arm64"}
+		gomega.Expect(config.ARM64()).To(gomega.BeTrue())
+		gomega.Expect(config.DetectArchitectures()).To(gomega.BeNil())
+		yamlString, err = template.ParseTemplate(config)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(yamlString).To(gomega.ContainSubstring("plugin: flannel"))
+		gomega.Expect(template.ValidateYAML(yamlString)).To(gomega.BeNil())
+
+		config.Architectures = []string{"ppc64le"}
+		gomega.Expect(config.DetectArchitectures()).NotTo(gomega.BeNil())
+	})
+
+	ginkgo.It("Should keep the special characters of the paths and names", func() {
+		config := NewClusterConfig(`cluster "a&b"`, []string{"172.1.1.0"}, "node user", `/home/node user/keys/a&b "rke".pem`)
+		template := NewRKETemplate(ClusterTemplate)
+		yamlString, err := template.ParseTemplate(config)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(yamlString).NotTo(gomega.ContainSubstring("&amp;"))
+		gomega.Expect(yamlString).NotTo(gomega.ContainSubstring("&#34;"))
+		gomega.Expect(template.ValidateYAML(yamlString)).To(gomega.BeNil())
+
+		parsed := struct {
+			Nodes []struct {
+				Address string `yaml:"address"`
+				User    string `yaml:"user"`
+			} `yaml:"nodes"`
+			SSHKeyPath  string `yaml:"ssh_key_path"`
+			ClusterName string `yaml:"cluster_name"`
+		}{}
+		gomega.Expect(yaml.Unmarshal([]byte(yamlString), &parsed)).To(gomega.Succeed())
+		gomega.Expect(parsed.SSHKeyPath).To(gomega.Equal(`/home/node user/keys/a&b "rke".pem`))
+		gomega.Expect(parsed.ClusterName).To(gomega.Equal(`cluster "a&b"`))
+		gomega.Expect(parsed.Nodes).To(gomega.HaveLen(1))
+		gomega.Expect(parsed.Nodes[0].Address).To(gomega.Equal("172.1.1.0"))
+		gomega.Expect(parsed.Nodes[0].User).To(gomega.Equal("node user"))
+	})
+
 	ginkgo.It("Should work with 10 nodes", func() {
 		config := getClusterConfig(10)
 		template := NewRKETemplate(ClusterTemplate)
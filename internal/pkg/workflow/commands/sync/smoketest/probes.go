@@ -0,0 +1,199 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package smoketest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/cryptopolicy"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// maxBodySize is the maximum number of bytes of the body read by the http probes.
+const maxBodySize = 1024 * 1024
+
+// ProbeResult with the outcome of a probe.
+type ProbeResult struct {
+	// Name of the probe.
+	Name string `json:"name"`
+	// Type of the probe.
+	Type string `json:"type"`
+	// Critical indicates if the failure of the probe fails the workflow.
+	Critical bool `json:"critical"`
+	// Passed indicates if the probe succeeded.
+	Passed bool `json:"passed"`
+	// Attempts performed.
+	Attempts int `json:"attempts"`
+	// Error of the last attempt if the probe failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Prober executes the probes.
+type Prober struct {
+	// Interval between the attempts of a probe.
+	Interval time.Duration
+}
+
+// NewProber creates a prober with the default interval between attempts.
+func NewProber() *Prober {
+	return &Prober{Interval: AttemptInterval}
+}
+
+// Run executes a probe until it succeeds or the attempts are exhausted.
+func (p *Prober) Run(probe Probe) ProbeResult {
+	attempts := probe.Attempts
+	if attempts <= 0 {
+		attempts = DefaultAttempts
+	}
+	result := ProbeResult{Name: probe.Name, Type: probe.Type, Critical: probe.Critical}
+	for result.Attempts < attempts {
+		if result.Attempts > 0 {
+			time.Sleep(p.Interval)
+		}
+		result.Attempts++
+		err := p.attempt(probe)
+		if err == nil {
+			result.Passed = true
+			result.Error = ""
+			return result
+		}
+		result.Error = err.Error()
+		log.Debug().Str("probe", probe.Name).Int("attempt", result.Attempts).Str("error", result.Error).Msg("probe failed")
+	}
+	return result
+}
+
+// attempt executes a probe once.
+func (p *Prober) attempt(probe Probe) derrors.Error {
+	ctx, cancel := context.WithTimeout(context.Background(), probe.Timeout())
+	defer cancel()
+	switch probe.Type {
+	case HTTPProbe:
+		return checkHTTP(ctx, probe)
+	case GRPCProbe:
+		return checkGRPC(ctx, probe)
+	case DNSProbe:
+		return checkDNS(ctx, probe)
+	}
+	return derrors.NewInvalidArgumentError("unsupported probe type").WithParams(probe.Type)
+}
+
+// checkHTTP requests the URL of the probe checking the status and the content of the response.
+func checkHTTP(ctx context.Context, probe Probe) derrors.Error {
+	request, err := http.NewRequest(http.MethodGet, probe.URL, nil)
+	if err != nil {
+		return derrors.NewInvalidArgumentError("invalid probe url", err).WithParams(probe.URL)
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: cryptopolicy.RestrictTLS(&tls.Config{InsecureSkipVerify: probe.InsecureSkipVerify}),
+		},
+	}
+	response, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return derrors.NewUnavailableError("cannot request url", err).WithParams(probe.URL)
+	}
+	defer response.Body.Close()
+	expected := probe.ExpectedStatus
+	if expected == 0 {
+		expected = http.StatusOK
+	}
+	if response.StatusCode != expected {
+		return derrors.NewUnavailableError(fmt.Sprintf("unexpected status %d, expecting %d", response.StatusCode, expected)).WithParams(probe.URL)
+	}
+	if probe.Contains != "" {
+		body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxBodySize))
+		if err != nil {
+			return derrors.NewUnavailableError("cannot read response", err).WithParams(probe.URL)
+		}
+		if !strings.Contains(string(body), probe.Contains) {
+			return derrors.NewUnavailableError("response does not contain the expected text").WithParams(probe.URL, probe.Contains)
+		}
+	}
+	return nil
+}
+
+// checkGRPC checks the status reported by the health service of a gRPC server.
+func checkGRPC(ctx context.Context, probe Probe) derrors.Error {
+	options := []grpc.DialOption{grpc.WithBlock()}
+	if probe.TLS {
+		options = append(options, grpc.WithTransportCredentials(credentials.NewTLS(cryptopolicy.RestrictTLS(&tls.Config{InsecureSkipVerify: probe.InsecureSkipVerify}))))
+	} else {
+		options = append(options, grpc.WithInsecure())
+	}
+	conn, err := grpc.DialContext(ctx, probe.Address, options...)
+	if err != nil {
+		return derrors.NewUnavailableError("cannot connect to gRPC server", err).WithParams(probe.Address)
+	}
+	defer conn.Close()
+	response, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: probe.Service})
+	if err != nil {
+		return derrors.NewUnavailableError("cannot check gRPC health", err).WithParams(probe.Address, probe.Service)
+	}
+	if response.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		return derrors.NewUnavailableError(fmt.Sprintf("service is %s", response.Status.String())).WithParams(probe.Address, probe.Service)
+	}
+	return nil
+}
+
+// checkDNS resolves the host of the probe checking the returned addresses.
+func checkDNS(ctx context.Context, probe Probe) derrors.Error {
+	resolver := net.DefaultResolver
+	if probe.Server != "" {
+		server := probe.Server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+				dialer := net.Dialer{}
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+	addresses, err := resolver.LookupHost(ctx, probe.Host)
+	if err != nil {
+		return derrors.NewUnavailableError("cannot resolve host", err).WithParams(probe.Host, probe.Server)
+	}
+	for _, expected := range probe.ExpectedAddresses {
+		found := false
+		for _, address := range addresses {
+			if address == expected {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return derrors.NewUnavailableError("expected address not resolved").WithParams(probe.Host, expected, addresses)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+// RunSmokeTests command
+// Executes the probes of the tests file of the components directory.
+//
+// {"type":"sync", "name": "runSmokeTests", "componentsDir":"/assets/mngtcluster",
+//  "variables":{"management_host":"nalej.example.com"}}
+
+package smoketest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"github.com/rs/zerolog/log"
+)
+
+// RunSmokeTests structure with the location of the tests and the values of their variables.
+type RunSmokeTests struct {
+	entities.GenericSyncCommand
+	// ComponentsDir with the components being installed.
+	ComponentsDir string `json:"componentsDir"`
+	// TestsFile with the path of the tests. If not set, the TestsFile of the components directory is used.
+	TestsFile string `json:"tests_file"`
+	// Variables referenced by the probes as ${name}.
+	Variables map[string]string `json:"variables"`
+	// Parallelism is the maximum number of probes executed at the same time. If not set, all the probes are executed
+	// at once.
+	Parallelism int `json:"parallelism"`
+}
+
+// NewRunSmokeTests creates a new RunSmokeTests command.
+func NewRunSmokeTests(componentsDir string, variables map[string]string) *RunSmokeTests {
+	return &RunSmokeTests{
+		GenericSyncCommand: *entities.NewSyncCommand(entities.RunSmokeTests),
+		ComponentsDir:      componentsDir,
+		Variables:          variables,
+	}
+}
+
+// NewRunSmokeTestsFromJSON creates a RunSmokeTests command from a JSON object.
+func NewRunSmokeTestsFromJSON(raw []byte) (*entities.Command, derrors.Error) {
+	rst := &RunSmokeTests{}
+	if err := json.Unmarshal(raw, &rst); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	rst.CommandID = entities.GenerateCommandID(rst.Name())
+	var r entities.Command = rst
+	return &r, nil
+}
+
+// testsPath returns the path of the tests file.
+func (rst *RunSmokeTests) testsPath() string {
+	if rst.TestsFile != "" {
+		return rst.TestsFile
+	}
+	return filepath.Join(rst.ComponentsDir, TestsFile)
+}
+
+// Run the probes of the tests file. The command fails if any critical probe fails; the components directories
+// without tests file are not checked.
+func (rst *RunSmokeTests) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
+	path := rst.testsPath()
+	if _, err := os.Stat(path); os.IsNotExist(err) && rst.TestsFile == "" {
+		return entities.NewCommandResult(true, "no smoke tests defined", nil), nil
+	}
+	suite, err := LoadSuite(path, rst.Variables)
+	if err != nil {
+		return entities.NewCommandResult(false, "cannot load smoke tests", err), nil
+	}
+	results := RunSuite(NewProber(), suite, rst.Parallelism)
+
+	passed := 0
+	criticalFailures := make([]string, 0)
+	for _, result := range results {
+		if result.Passed {
+			passed++
+			log.Info().Str("probe", result.Name).Str("type", result.Type).Msg("smoke test passed")
+			continue
+		}
+		log.Warn().Str("probe", result.Name).Str("type", result.Type).Bool("critical", result.Critical).
+			Str("error", result.Error).Msg("smoke test failed")
+		if result.Critical {
+			criticalFailures = append(criticalFailures, result.Name)
+		}
+	}
+	msg := fmt.Sprintf("%d smoke tests passed, %d failed", passed, len(results)-passed)
+	if len(criticalFailures) > 0 {
+		return entities.NewCommandResult(false, msg,
+			derrors.NewUnavailableError("critical smoke tests failed").WithParams(criticalFailures)), nil
+	}
+	return entities.NewCommandResult(true, msg, nil), nil
+}
+
+// RunSuite executes the probes of a suite.
+//   params:
+//     prober The prober executing each probe.
+//     suite The suite of probes.
+//     parallelism The maximum number of probes executed at the same time, all of them if zero.
+//   returns:
+//     The results in the same order as the probes.
+func RunSuite(prober *Prober, suite *Suite, parallelism int) []ProbeResult {
+	if parallelism <= 0 || parallelism > len(suite.Probes) {
+		parallelism = len(suite.Probes)
+	}
+	results := make([]ProbeResult, len(suite.Probes))
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, probe := range suite.Probes {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, probe Probe) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = prober.Run(probe)
+		}(i, probe)
+	}
+	wg.Wait()
+	return results
+}
+
+// String obtains a string representation
+func (rst *RunSmokeTests) String() string {
+	return fmt.Sprintf("SYNC RunSmokeTests %s", rst.testsPath())
+}
+
+// PrettyPrint returns a simple space indexed string.
+func (rst *RunSmokeTests) PrettyPrint(indentation int) string {
+	return strings.Repeat(" ", indentation) + rst.String()
+}
+
+// UserString returns a simple string representation of the command for the user.
+func (rst *RunSmokeTests) UserString() string {
+	return "Running smoke tests"
+}
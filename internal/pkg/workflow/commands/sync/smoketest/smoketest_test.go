@@ -0,0 +1,156 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+package smoketest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Smoke tests", func() {
+
+	var componentsDir string
+	var server *httptest.Server
+
+	ginkgo.BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "smoketest")
+		gomega.Expect(err).To(gomega.Succeed())
+		componentsDir = dir
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/health" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, "status: ok")
+		}))
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Close()
+		os.RemoveAll(componentsDir)
+	})
+
+	writeTests := func(content string) {
+		err := ioutil.WriteFile(filepath.Join(componentsDir, TestsFile), []byte(content), 0644)
+		gomega.Expect(err).To(gomega.Succeed())
+	}
+
+	ginkgo.Context("loading the tests file", func() {
+		ginkgo.It("should expand the variables of the probes", func() {
+			writeTests(`
+probes:
+  - name: web
+    type: http
+    url: https://web.${management_host}/
+  - name: dns
+    type: dns
+    host: web.${management_host}
+    server: ${dns_host}:53
+`)
+			suite, err := LoadSuite(filepath.Join(componentsDir, TestsFile),
+				map[string]string{"management_host": "nalej.example.com", "dns_host": "10.0.0.1"})
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(suite.Probes).To(gomega.HaveLen(2))
+			gomega.Expect(suite.Probes[0].URL).To(gomega.Equal("https://web.nalej.example.com/"))
+			gomega.Expect(suite.Probes[1].Host).To(gomega.Equal("web.nalej.example.com"))
+			gomega.Expect(suite.Probes[1].Server).To(gomega.Equal("10.0.0.1:53"))
+		})
+		ginkgo.It("should reject probes without the fields of their type", func() {
+			writeTests(`
+probes:
+  - name: system-model
+    type: grpc
+`)
+			_, err := LoadSuite(filepath.Join(componentsDir, TestsFile), nil)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+		ginkgo.It("should reject unknown probe types", func() {
+			writeTests(`
+probes:
+  - name: ping
+    type: icmp
+`)
+			_, err := LoadSuite(filepath.Join(componentsDir, TestsFile), nil)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("running http probes", func() {
+		prober := &Prober{}
+		ginkgo.It("should pass when the expected status and content are returned", func() {
+			result := prober.Run(Probe{Name: "health", Type: HTTPProbe, URL: server.URL + "/health", Contains: "ok"})
+			gomega.Expect(result.Passed).To(gomega.BeTrue())
+			gomega.Expect(result.Attempts).To(gomega.Equal(1))
+		})
+		ginkgo.It("should retry and fail on unexpected status", func() {
+			result := prober.Run(Probe{Name: "missing", Type: HTTPProbe, URL: server.URL + "/missing", Attempts: 2})
+			gomega.Expect(result.Passed).To(gomega.BeFalse())
+			gomega.Expect(result.Attempts).To(gomega.Equal(2))
+			gomega.Expect(result.Error).NotTo(gomega.BeEmpty())
+		})
+		ginkgo.It("should fail when the content is not found", func() {
+			result := prober.Run(Probe{Name: "health", Type: HTTPProbe, URL: server.URL + "/health", Contains: "ready", Attempts: 1})
+			gomega.Expect(result.Passed).To(gomega.BeFalse())
+		})
+	})
+
+	ginkgo.Context("running the command", func() {
+		ginkgo.It("should succeed if there is no tests file", func() {
+			cmd := NewRunSmokeTests(componentsDir, nil)
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+		})
+		ginkgo.It("should only fail on critical probes", func() {
+			writeTests(`
+probes:
+  - name: health
+    type: http
+    url: ${base}/health
+    critical: true
+  - name: optional
+    type: http
+    url: ${base}/optional
+    attempts: 1
+`)
+			cmd := NewRunSmokeTests(componentsDir, map[string]string{"base": server.URL})
+			result, err := cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeTrue())
+			gomega.Expect(result.Output).To(gomega.ContainSubstring("1 smoke tests passed, 1 failed"))
+
+			writeTests(`
+probes:
+  - name: missing
+    type: http
+    url: ${base}/missing
+    critical: true
+    attempts: 1
+`)
+			result, err = cmd.Run("w1")
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(result.Success).To(gomega.BeFalse())
+		})
+	})
+})
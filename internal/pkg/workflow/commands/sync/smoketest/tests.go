@@ -0,0 +1,173 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+// Smoke tests
+// The smoke tests are a set of declarative probes checking that the platform answers once installed. They are
+// defined in a tests.yaml file found in the components directory:
+//
+// probes:
+//   - name: web
+//     type: http
+//     url: https://web.${management_host}/
+//     critical: true
+//   - name: system-model
+//     type: grpc
+//     address: system-model.nalej:8800
+//   - name: dns
+//     type: dns
+//     host: web.${management_host}
+//     server: ${dns_host}:53
+
+package smoketest
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/nalej/derrors"
+	"sigs.k8s.io/yaml"
+)
+
+// TestsFile is the name of the file with the smoke tests inside the components directory.
+const TestsFile = "tests.yaml"
+
+// Types of probes.
+const (
+	HTTPProbe = "http"
+	GRPCProbe = "grpc"
+	DNSProbe  = "dns"
+)
+
+// DefaultTimeout of each attempt of a probe.
+const DefaultTimeout = 10 * time.Second
+
+// DefaultAttempts is the number of attempts of a probe before considering it failed.
+const DefaultAttempts = 3
+
+// AttemptInterval is the time waited between the attempts of a probe.
+const AttemptInterval = 10 * time.Second
+
+// Probe defines a check of the platform.
+type Probe struct {
+	// Name of the probe.
+	Name string `json:"name"`
+	// Type of the probe: http, grpc or dns.
+	Type string `json:"type"`
+	// Critical probes fail the workflow, the failure of the rest is only reported.
+	Critical bool `json:"critical"`
+	// TimeoutSeconds of each attempt. If not set, DefaultTimeout is used.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+	// Attempts before considering the probe failed. If not set, DefaultAttempts is used.
+	Attempts int `json:"attempts,omitempty"`
+	// URL requested by the http probes.
+	URL string `json:"url,omitempty"`
+	// ExpectedStatus of the http probes. If not set, 200 is expected.
+	ExpectedStatus int `json:"expected_status,omitempty"`
+	// Contains is a text expected in the body returned to the http probes.
+	Contains string `json:"contains,omitempty"`
+	// Address with the host and port of the gRPC server of the grpc probes.
+	Address string `json:"address,omitempty"`
+	// Service checked by the grpc probes. The overall health of the server is checked if not set.
+	Service string `json:"service,omitempty"`
+	// TLS indicates that the gRPC server uses transport security.
+	TLS bool `json:"tls,omitempty"`
+	// InsecureSkipVerify disables the verification of the certificates of the http and grpc probes.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+	// Host resolved by the dns probes.
+	Host string `json:"host,omitempty"`
+	// Server with the address of the DNS server used by the dns probes. The system resolver is used if not set.
+	Server string `json:"server,omitempty"`
+	// ExpectedAddresses that must be returned by the dns probes.
+	ExpectedAddresses []string `json:"expected_addresses,omitempty"`
+}
+
+// Timeout returns the timeout of each attempt of the probe.
+func (p *Probe) Timeout() time.Duration {
+	if p.TimeoutSeconds > 0 {
+		return time.Duration(p.TimeoutSeconds) * time.Second
+	}
+	return DefaultTimeout
+}
+
+// Validate checks that the probe defines the fields required by its type.
+func (p *Probe) Validate() derrors.Error {
+	if p.Name == "" {
+		return derrors.NewInvalidArgumentError("probe name cannot be empty")
+	}
+	switch p.Type {
+	case HTTPProbe:
+		if p.URL == "" {
+			return derrors.NewInvalidArgumentError("http probes require an url").WithParams(p.Name)
+		}
+	case GRPCProbe:
+		if p.Address == "" {
+			return derrors.NewInvalidArgumentError("grpc probes require an address").WithParams(p.Name)
+		}
+	case DNSProbe:
+		if p.Host == "" {
+			return derrors.NewInvalidArgumentError("dns probes require a host").WithParams(p.Name)
+		}
+	default:
+		return derrors.NewInvalidArgumentError("unsupported probe type, expecting http, grpc or dns").WithParams(p.Name, p.Type)
+	}
+	return nil
+}
+
+// expand replaces the ${variable} references of the probe fields.
+func (p *Probe) expand(variables map[string]string) {
+	mapping := func(name string) string {
+		return variables[name]
+	}
+	p.URL = os.Expand(p.URL, mapping)
+	p.Address = os.Expand(p.Address, mapping)
+	p.Service = os.Expand(p.Service, mapping)
+	p.Host = os.Expand(p.Host, mapping)
+	p.Server = os.Expand(p.Server, mapping)
+	for i, address := range p.ExpectedAddresses {
+		p.ExpectedAddresses[i] = os.Expand(address, mapping)
+	}
+}
+
+// Suite with the probes of a tests file.
+type Suite struct {
+	Probes []Probe `json:"probes"`
+}
+
+// LoadSuite reads and validates a tests file replacing the ${variable} references of its probes.
+//   params:
+//     path The path of the tests file.
+//     variables The values of the variables.
+//   returns:
+//     The suite.
+//     An error if the file cannot be read or a probe is not valid.
+func LoadSuite(path string, variables map[string]string) (*Suite, derrors.Error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, derrors.NewNotFoundError("cannot read smoke tests file", err).WithParams(path)
+	}
+	suite := &Suite{}
+	if err := yaml.Unmarshal(content, suite); err != nil {
+		return nil, derrors.NewInvalidArgumentError("cannot parse smoke tests file", err).WithParams(path)
+	}
+	for i := range suite.Probes {
+		suite.Probes[i].expand(variables)
+		if err := suite.Probes[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return suite, nil
+}
@@ -292,7 +292,20 @@ func (cmd *CreateZTPlanetFiles) createKubernetesSecrets() derrors.Error {
 func (cmd *CreateZTPlanetFiles) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
 	log.Debug().Str("path", cmd.ZtIdToolBinaryPath).Msg("ZT ID Tool binary")
 
-	dErr := cmd.generateZTIdentityFiles()
+	// The identity of the planet must be kept on new installs so existing members can still reach it.
+	dErr := cmd.Connect()
+	if dErr != nil {
+		return nil, dErr
+	}
+	exists, dErr := cmd.ExistsEntity("nalej", "", "v1", "secrets", "zt-planet")
+	if dErr != nil {
+		return nil, dErr
+	}
+	if exists {
+		return entities.NewSuccessCommand([]byte("ZT Planet secrets already exist.")), nil
+	}
+
+	dErr = cmd.generateZTIdentityFiles()
 	if dErr != nil {
 		return nil, dErr
 	}
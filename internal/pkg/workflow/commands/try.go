@@ -44,6 +44,8 @@ type Try struct {
 	executionError     derrors.Error
 	asyncFinishChannel chan string
 	asyncCmdID         string
+	// parameters contains the workflow parameters available to the commands.
+	parameters map[string]string
 }
 
 // NewTry creates a new Try command with all parameters.
@@ -51,7 +53,12 @@ func NewTry(description string, tryCommand entities.Command, onFailCommand entit
 	return &Try{*entities.NewSyncCommand(entities.TryCmd),
 		description, tryCommand, onFailCommand,
 		handler.GetCommandHandler(), nil, nil,
-		make(chan string), ""}
+		make(chan string), "", make(map[string]string, 0)}
+}
+
+// SetParameters provides the workflow parameters available when the command is launched.
+func (t *Try) SetParameters(params map[string]string) {
+	t.parameters = params
 }
 
 // TryFromJSON structure required to be able to parse individual commands.
@@ -96,15 +103,17 @@ func NewTryFromJSON(raw []byte) (*entities.Command, derrors.Error) {
 //     An error if the command execution fails
 func (t *Try) Run(workflowID string) (*entities.CommandResult, derrors.Error) {
 	t.commandHandler.AddLogEntry(t.CommandID, fmt.Sprintf("Try %s", t.TryCommand.Name()))
+	setParameters(t.TryCommand, copyParameters(t.parameters))
 	result, err := t.executeCommand(workflowID, t.TryCommand)
 	if err != nil {
 		log.Debug().Str("err", err.Error()).Msg("retry on cmd error")
 	}
 	if err != nil || !result.Success {
+		setParameters(t.OnFailCommand, copyParameters(t.parameters))
 		result, err = t.executeCommand(workflowID, t.OnFailCommand)
 	}
 	if result.Success {
-		return entities.NewCommandResultNoShow(true, result.Output, nil), nil
+		return entities.NewCommandResultNoShow(true, result.Output, nil).WithOutputs(result.Outputs), nil
 	}
 	return result, nil
 }
@@ -136,6 +145,8 @@ func (t *Try) executeCommand(workflowID string, cmd entities.Command) (*entities
 	if err != nil {
 		log.Warn().Str("cmd", t.CommandID).Str("cmdID", cmd.ID()).Str("err", err.DebugReport()).
 			Msg("error executing async command on sequential group: ")
+		// The command will not finish asynchronously, so the callback must not wait for it.
+		t.asyncCmdID = ""
 		//If the execution return errors, the executor call to the commandHandler with the error.
 		err = t.commandHandler.FinishCommand(cmd.ID(), nil, err)
 		if err != nil {
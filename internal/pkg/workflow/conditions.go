@@ -0,0 +1,113 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Conditional commands
+// Commands may define a "when" field with a template pipeline that is evaluated against the workflow parameters
+// once the template has been rendered. Commands whose condition is false are removed from the workflow, including
+// those found in the commands array of group and parallel commands.
+//
+// {"type":"sync", "name": "logger", "msg": "Installing Istio", "when": "eq .NetworkConfig.NetworkingMode \"istio\""}
+
+package workflow
+
+import (
+	"bytes"
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"strconv"
+	"text/template"
+)
+
+// WhenField is the optional command field with the condition to include the command.
+const WhenField = "when"
+
+// CommandsField is the field that contains the list of commands in workflows, groups and parallel commands.
+const CommandsField = "commands"
+
+// EvaluateCondition evaluates a template pipeline such as `.AppCluster` or `eq .NetworkConfig.NetworkingMode "istio"`
+// with the given parameters.
+func EvaluateCondition(condition string, params Parameters) (bool, derrors.Error) {
+	t, err := template.New("condition").Parse("{{if " + condition + "}}true{{else}}false{{end}}")
+	if err != nil {
+		return false, derrors.NewInvalidArgumentError(errors.InvalidCondition, err).WithParams(condition)
+	}
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, params); err != nil {
+		return false, derrors.NewInvalidArgumentError(errors.InvalidCondition, err).WithParams(condition)
+	}
+	result, err := strconv.ParseBool(buf.String())
+	if err != nil {
+		return false, derrors.NewInternalError(errors.InvalidCondition, err).WithParams(condition)
+	}
+	return result, nil
+}
+
+// evaluateWhen checks the condition of a decoded command removing the when field. Commands without condition
+// are always included.
+func evaluateWhen(cmd map[string]interface{}, params Parameters) (bool, derrors.Error) {
+	condition, found := cmd[WhenField]
+	if !found {
+		return true, nil
+	}
+	conditionStr, ok := condition.(string)
+	if !ok {
+		return false, derrors.NewInvalidArgumentError(errors.InvalidCondition).WithParams(condition)
+	}
+	include, err := EvaluateCondition(conditionStr, params)
+	if err != nil {
+		return false, err
+	}
+	delete(cmd, WhenField)
+	return include, nil
+}
+
+// removeTrailingCommas removes the commas left before a closing bracket or brace, which are commonly produced
+// when the last element of a list is inside a conditional template block.
+func removeTrailingCommas(jsonPayload string) string {
+	result := []byte(jsonPayload)
+	inString := false
+	escaped := false
+	pendingComma := -1
+	for i, c := range result {
+		if inString {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case ',':
+			pendingComma = i
+		case ' ', '\t', '\r', '\n':
+		case ']', '}':
+			if pendingComma >= 0 {
+				result[pendingComma] = ' '
+			}
+			pendingComma = -1
+		case '"':
+			inString = true
+			pendingComma = -1
+		default:
+			pendingComma = -1
+		}
+	}
+	return string(result)
+}
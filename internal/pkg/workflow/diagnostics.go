@@ -0,0 +1,244 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Rendering diagnostics
+// The errors rendering a template include the offending line of the template and the values of the parameters it
+// references, and the errors parsing the rendered workflow include the lines around the invalid JSON. Secrets are
+// redacted from both, so the diagnostics can be logged and returned to the users.
+
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nalej/installer/internal/pkg/logging"
+)
+
+// DiagnosticContextLines is the number of lines shown before and after the offending line.
+const DiagnosticContextLines = 2
+
+// maxDiagnosticValueLength is the maximum length of the values of the parameters shown in the diagnostics.
+const maxDiagnosticValueLength = 64
+
+// templateLocationRegex matches the line and column of the errors of text/template once the name is removed.
+var templateLocationRegex = regexp.MustCompile(`^:(\d+)(?::(\d+))?:`)
+
+// templateReferenceRegex matches the references to the parameters in a line of a template.
+var templateReferenceRegex = regexp.MustCompile(`\$?((?:\.[A-Z][A-Za-z0-9_]*)+)`)
+
+// secretParameterRegex matches the names of the parameters whose values are secrets.
+var secretParameterRegex = regexp.MustCompile(`(?i)secret|password|passwd|token|privatekey|private_key|kubeconfigraw`)
+
+// secretParameters contains the parameters whose values are secrets, redacted wherever they appear in a snippet.
+var secretParameters = []string{"AuthSecret", "InstallRequest.PrivateKey", "InstallRequest.KubeConfigRaw",
+	"UninstallRequest.KubeConfigRaw", "RotateSecretsRequest.KubeConfigRaw"}
+
+// templateLocation obtains the line and column of an error of text/template.
+//   params:
+//     err The error parsing or applying the template.
+//     templateName The name of the template.
+//   returns:
+//     The line and column, starting at 1. The column is 0 if unknown, and the line is 0 if the error has no location.
+func templateLocation(err error, templateName string) (int, int) {
+	message := strings.TrimPrefix(err.Error(), "template: ")
+	if !strings.HasPrefix(message, templateName) {
+		return 0, 0
+	}
+	match := templateLocationRegex.FindStringSubmatch(strings.TrimPrefix(message, templateName))
+	if match == nil {
+		return 0, 0
+	}
+	line, _ := strconv.Atoi(match[1])
+	column, _ := strconv.Atoi(match[2])
+	return line, column
+}
+
+// snippet returns the lines around a location with their numbers, pointing to the column if known.
+func snippet(content string, line int, column int) string {
+	lines := strings.Split(content, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	from := line - DiagnosticContextLines
+	if from < 1 {
+		from = 1
+	}
+	to := line + DiagnosticContextLines
+	if to > len(lines) {
+		to = len(lines)
+	}
+	width := len(strconv.Itoa(to))
+	var b strings.Builder
+	for current := from; current <= to; current++ {
+		marker := " "
+		if current == line {
+			marker = ">"
+		}
+		text := strings.Replace(lines[current-1], "\t", " ", -1)
+		fmt.Fprintf(&b, "%s %*d | %s\n", marker, width, current, text)
+		if current == line && column > 0 {
+			fmt.Fprintf(&b, "  %s | %s^\n", strings.Repeat(" ", width), strings.Repeat(" ", column-1))
+		}
+	}
+	return b.String()
+}
+
+// redactParameter returns the value of a parameter to be shown in a diagnostic.
+func redactParameter(path string, value interface{}) string {
+	if secretParameterRegex.MatchString(path[strings.LastIndex(path, ".")+1:]) {
+		return logging.Redacted
+	}
+	result := fmt.Sprintf("%v", value)
+	if len(result) > maxDiagnosticValueLength {
+		result = result[:maxDiagnosticValueLength] + "..."
+	}
+	return strconv.Quote(result)
+}
+
+// redactSnippet removes the secrets of the parameters from a rendered snippet.
+func redactSnippet(content string, params Parameters) string {
+	result := logging.Redact(content)
+	secrets := make([]string, 0)
+	for _, path := range secretParameters {
+		if value, found := parameterValue(params, strings.Split(path, ".")); found {
+			secrets = append(secrets, fmt.Sprintf("%v", value.Interface()))
+		}
+	}
+	for key, value := range params.Bindings {
+		if secretParameterRegex.MatchString(key) {
+			secrets = append(secrets, value)
+		}
+	}
+	for _, secret := range secrets {
+		// Short values would redact unrelated content.
+		if len(secret) >= 4 {
+			result = strings.Replace(result, secret, logging.Redacted, -1)
+		}
+	}
+	return result
+}
+
+// referencedParameters returns the values of the parameters referenced by a line of a template.
+func referencedParameters(line string, params Parameters) string {
+	values := make(map[string]string, 0)
+	for _, match := range templateReferenceRegex.FindAllStringSubmatch(line, -1) {
+		path := strings.TrimPrefix(match[1], ".")
+		fields := strings.Split(path, ".")
+		if resolved, _ := parameterType(fields); resolved < len(fields) {
+			continue
+		}
+		value, found := parameterValue(params, fields)
+		switch {
+		case !found:
+			values[path] = "<not set>"
+		case value.Kind() == reflect.Ptr || value.Kind() == reflect.Struct || value.Kind() == reflect.Map:
+			// The content of the requests and the bindings may contain secrets.
+			values[path] = "{...}"
+		default:
+			values[path] = redactParameter(path, value.Interface())
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	paths := make([]string, 0, len(values))
+	for path := range values {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	result := make([]string, 0, len(paths))
+	for _, path := range paths {
+		result = append(result, fmt.Sprintf("%s=%s", path, values[path]))
+	}
+	return strings.Join(result, ", ")
+}
+
+// templateDiagnostic builds the diagnostic of an error parsing or applying a template.
+//   params:
+//     err The error of text/template.
+//     templateName The name of the template.
+//     content The content of the template.
+//     params The parameters applied to the template.
+//   returns:
+//     The offending line of the template and the parameters it references, or an empty string if the error has
+//     no location.
+func templateDiagnostic(err error, templateName string, content string, params Parameters) string {
+	line, column := templateLocation(err, templateName)
+	lines := strings.Split(content, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	result := fmt.Sprintf("template line %d:\n%s", line, logging.Redact(snippet(content, line, column)))
+	if referenced := referencedParameters(lines[line-1], params); referenced != "" {
+		result = result + "parameters: " + referenced
+	}
+	return result
+}
+
+// jsonErrorOffset returns the offset of a JSON syntax error, or -1 if the error has no location.
+func jsonErrorOffset(err error) int {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		return int(e.Offset)
+	case *json.UnmarshalTypeError:
+		return int(e.Offset)
+	}
+	return -1
+}
+
+// renderedDiagnostic builds the diagnostic of an error found in a rendered workflow.
+//   params:
+//     jsonPayload The rendered workflow.
+//     line The line of the error, starting at 1.
+//     column The column of the error, starting at 1.
+//     params The parameters applied to the template.
+//   returns:
+//     The redacted lines of the rendered workflow around the error.
+func renderedDiagnostic(jsonPayload string, line int, column int, params Parameters) string {
+	found := snippet(jsonPayload, line, column)
+	if found == "" {
+		return ""
+	}
+	return fmt.Sprintf("rendered line %d:\n%s", line, redactSnippet(found, params))
+}
+
+// diagnosticParams returns the parameters of an error followed by a diagnostic, if any.
+func diagnosticParams(diagnostic string, params ...interface{}) []interface{} {
+	if diagnostic != "" {
+		params = append(params, diagnostic)
+	}
+	return params
+}
+
+// offsetDiagnostic builds the diagnostic of an error found at an offset of a rendered workflow.
+func offsetDiagnostic(jsonPayload string, offset int, params Parameters) string {
+	if offset < 0 {
+		return ""
+	}
+	if offset > len(jsonPayload) {
+		offset = len(jsonPayload)
+	}
+	line := strings.Count(jsonPayload[:offset], "\n") + 1
+	column := offset - strings.LastIndex(jsonPayload[:offset], "\n")
+	return renderedDiagnostic(jsonPayload, line, column, params)
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package workflow
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const undefinedFunctionTemplate = `{
+ "description": "undefinedFunctionTemplate",
+ "commands": [
+  {"type":"sync", "name": "exec", "cmd": "{{$.InstallRequest.ClusterId | upper}}"}
+ ]
+}`
+
+const failedExecutionTemplate = `{
+ "description": "failedExecutionTemplate",
+ "commands": [
+  {"type":"sync", "name": "exec", "cmd": "{{$.AuthSecret}}", "args":["{{index $.InstallRequest.Nodes 5}}"]}
+ ]
+}`
+
+const invalidJSONTemplate = `{
+ "description": "invalidJSONTemplate",
+ "commands": [
+  {"type":"sync", "name": "exec", "cmd": "{{$.AuthSecret}}" "args":["{{$.InstallRequest.ClusterId}}"]}
+ ]
+}`
+
+var _ = ginkgo.Describe("Rendering diagnostics", func() {
+
+	ginkgo.It("should point to the line of the template that cannot be parsed", func() {
+		_, err := NewParser().render(undefinedFunctionTemplate, "undefinedFunctionTemplate", *GetTestInstallParameters(1, false))
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		gomega.Expect(err.DebugReport()).To(gomega.ContainSubstring("template line 4"))
+		gomega.Expect(err.DebugReport()).To(gomega.ContainSubstring("InstallRequest.ClusterId | upper"))
+	})
+
+	ginkgo.It("should show the redacted parameters of the line that cannot be applied", func() {
+		_, err := NewParser().render(failedExecutionTemplate, "failedExecutionTemplate", *GetTestInstallParameters(1, false))
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		report := err.DebugReport()
+		gomega.Expect(report).To(gomega.ContainSubstring("template line 4"))
+		gomega.Expect(report).To(gomega.ContainSubstring("AuthSecret=REDACTED"))
+		gomega.Expect(report).To(gomega.ContainSubstring("InstallRequest.Nodes="))
+		gomega.Expect(report).NotTo(gomega.ContainSubstring("authxSecret"))
+	})
+
+	ginkgo.It("should show the redacted snippet of the rendered workflow with invalid JSON", func() {
+		_, err := NewParser().ParseWorkflow("w1", invalidJSONTemplate, "invalidJSONTemplate", *GetTestInstallParameters(1, false))
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		report := err.DebugReport()
+		gomega.Expect(report).To(gomega.ContainSubstring("rendered line 4"))
+		gomega.Expect(report).To(gomega.ContainSubstring("TestCluster"))
+		gomega.Expect(report).NotTo(gomega.ContainSubstring("authxSecret"))
+	})
+
+	ginkgo.It("should point to the column of the error", func() {
+		result := snippet("a\nb\nc\nd\ne\nf", 4, 1)
+		gomega.Expect(result).To(gomega.Equal("  2 | b\n  3 | c\n> 4 | d\n    | ^\n  5 | e\n  6 | f\n"))
+	})
+})
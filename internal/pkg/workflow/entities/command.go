@@ -108,10 +108,22 @@ type CommandResult struct {
 	// Output returns the command output in case of success, "" otherwise.
 	Output string `json:"output"`
 	// Error returns a DaishoError in case of command failure.
-	Error      derrors.Error `json:"error"`
+	Error derrors.Error `json:"error"`
+	// Outputs contains the workflow parameters set by the command, if any.
+	Outputs map[string]string `json:"outputs,omitempty"`
+	// Objects contains the references of the Kubernetes objects applied by the command, if any.
+	Objects    []AppliedObject `json:"objects,omitempty"`
 	showResult bool
 }
 
+// AppliedObject identifies a Kubernetes object applied by a command.
+type AppliedObject struct {
+	APIVersion string `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string `json:"kind" yaml:"kind"`
+	Namespace  string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Name       string `json:"name" yaml:"name"`
+}
+
 // UserString provides a string to be reported to the final user.
 func (cr *CommandResult) UserString() string {
 	if cr.Error != nil {
@@ -134,35 +146,37 @@ type CommandResultFromJSON struct {
 	Success bool                  `json:"success"`
 	Output  string                `json:"output"`
 	Error   *derrors.GenericError `json:"error"`
+	Outputs map[string]string     `json:"outputs,omitempty"`
+	Objects []AppliedObject       `json:"objects,omitempty"`
 }
 
 // ToCommandResult generates a CommandResult from the current structure.
 func (crfj *CommandResultFromJSON) ToCommandResult() *CommandResult {
 	if crfj.Error != nil {
 		var daishoError derrors.Error = crfj.Error
-		return &CommandResult{crfj.Success, crfj.Output, daishoError, true}
+		return &CommandResult{crfj.Success, crfj.Output, daishoError, crfj.Outputs, crfj.Objects, true}
 	}
-	return &CommandResult{crfj.Success, crfj.Output, nil, true}
+	return &CommandResult{crfj.Success, crfj.Output, nil, crfj.Outputs, crfj.Objects, true}
 }
 
 // NewCommandResult creates a new CommandResult.
 func NewCommandResult(success bool, output string, err derrors.Error) *CommandResult {
-	return &CommandResult{success, output, err, true}
+	return &CommandResult{success, output, err, nil, nil, true}
 }
 
 // NewCommandResultNoShow creates a new CommandResult whose result will not be reported.
 func NewCommandResultNoShow(success bool, output string, err derrors.Error) *CommandResult {
-	return &CommandResult{success, output, err, false}
+	return &CommandResult{success, output, err, nil, nil, false}
 }
 
 // NewSuccessCommand creates a successful command result.
 func NewSuccessCommand(output []byte) *CommandResult {
-	return &CommandResult{true, string(output), nil, true}
+	return &CommandResult{true, string(output), nil, nil, nil, true}
 }
 
 // NewErrCommand creates a failed command result.
 func NewErrCommand(output string, err derrors.Error) *CommandResult {
-	return &CommandResult{false, output, err, true}
+	return &CommandResult{false, output, err, nil, nil, true}
 }
 
 // HasOutput checks if the command result has output attached to it.
@@ -175,12 +189,30 @@ func (cr *CommandResult) ShowResult() bool {
 	return cr.showResult
 }
 
+// WithOutputs attaches the workflow parameters set by the command to the result.
+func (cr *CommandResult) WithOutputs(outputs map[string]string) *CommandResult {
+	cr.Outputs = outputs
+	return cr
+}
+
+// WithObjects attaches the references of the objects applied by the command to the result.
+func (cr *CommandResult) WithObjects(objects []AppliedObject) *CommandResult {
+	cr.Objects = objects
+	return cr
+}
+
 // SyncCommand interface defines the functions synchronous commands need to implement.
 type SyncCommand interface {
 	// Run the current command returning the result or an error.
 	Run(workflowID string) (*CommandResult, derrors.Error)
 }
 
+// ParameterReader interface implemented by the commands that read the workflow parameters set by previous commands.
+type ParameterReader interface {
+	// SetParameters provides the workflow parameters available when the command is launched.
+	SetParameters(params map[string]string)
+}
+
 // GenericSyncCommand is a basic synchronous command.
 type GenericSyncCommand struct {
 	GenericCommand
@@ -53,4 +53,13 @@ var _ = ginkgo.Describe("Command structure", func() {
 		gomega.Expect(toCR.Output).To(gomega.Equal("output"))
 		gomega.Expect(toCR.Error).To(gomega.BeNil())
 	})
+	ginkgo.It("must keep the outputs of a result", func() {
+		received := `{"success":true, "output":"output", "outputs":{"key":"value"}}`
+		retrieved := &CommandResultFromJSON{}
+		err := json.Unmarshal([]byte(received), retrieved)
+		gomega.Expect(err).To(gomega.BeNil())
+		toCR := retrieved.ToCommandResult()
+		gomega.Expect(toCR.Outputs).To(gomega.Equal(map[string]string{"key": "value"}))
+		gomega.Expect(NewCommandResult(true, "", nil).WithOutputs(toCR.Outputs).Outputs).To(gomega.HaveKeyWithValue("key", "value"))
+	})
 })
@@ -49,27 +49,51 @@ const TryCmd = "try"
 // ProcessCheck command to determine if a process is running on a given machine.
 const ProcessCheck = "processCheck"
 
+// ProvisionNode command to install and configure the prerequisites of Kubernetes on a set of nodes.
+const ProvisionNode = "provisionNode"
+
 // CheckAsset command to determine if a given asset file exists.
 const CheckAsset = "checkAsset"
 
+// CheckBinaries command to verify the staged binaries against the versions and checksums of their manifest.
+const CheckBinaries = "checkBinaries"
+
 // RKEInstall command to launch the installation of a new cluster with RKE.
 const RKEInstall = "rkeInstall"
 
 // RKERemove command to remove a kubernetes installed with RKE
 const RKERemove = "rkeRemove"
 
+// RKE2Install command to launch the installation of a new cluster with RKE2.
+const RKE2Install = "rke2Install"
+
+// RKE2Remove command to remove a kubernetes installed with RKE2.
+const RKE2Remove = "rke2Remove"
+
 // LaunchComponents command to install a set of YAML Kubernetes files
 const LaunchComponents = "launchComponents"
 
+// CreateCRDs command to create a set of custom resource definitions and wait for them to be established.
+const CreateCRDs = "createCRDs"
+
+// CreateJob command to create a Job and optionally wait for it to complete.
+const CreateJob = "createJob"
+
 // CheckRequirements checks the requirements of the installer against the installed Kubernetes.
 const CheckRequirements = "checkRequirements"
 
+// CheckCompatibility checks the installer, platform, Kubernetes and Istio versions against the compatibility matrix.
+const CheckCompatibility = "checkCompatibility"
+
 // CreateClusterConfig command to create the configmap of the cluster.
 const CreateClusterConfig = "createClusterConfig"
 
 // CreateCACert command to create the Nalej CA certificate.
 const CreateCACert = "createCACert"
 
+// CreateInternalCA command to create the CA issuing the ingress certificates without Let's Encrypt.
+const CreateInternalCA = "createInternalCA"
+
 // CreateManagementConfig command to create the configmap with the configuration of the system in the management cluster.
 const CreateManagementConfig = "createManagementConfig"
 
@@ -85,12 +109,18 @@ const UpdateKubeDNS = "updateKubeDNS"
 // AddClusterUser command to create a user for an application cluster.
 const AddClusterUser = "addClusterUser"
 
+// RegisterAppCluster command to register an application cluster in the management cluster.
+const RegisterAppCluster = "registerAppCluster"
+
 // InstallIngress command to create a set of Ingresses for the platform services.
 const InstallIngress = "installIngress"
 
 // InstallMngtDNS command to install the Consul DNS load balancer
 const InstallMngtDNS = "installMngtDNS"
 
+// InstallPlatformDNS command to install the CoreDNS service serving the zone of the management domain.
+const InstallPlatformDNS = "installPlatformDNS"
+
 // InstallExtDNS command to install the external DNS
 const InstallExtDNS = "installExtDNS"
 
@@ -112,9 +142,21 @@ const CreateTLSSecret = "createTLSSecret"
 // CreateDockerSecret creates a docker secret in Kubernetes.
 const CreateDockerSecret = "createDockerSecret"
 
+// RotateSecret command to replace the value of an opaque secret.
+const RotateSecret = "rotateSecret"
+
+// RestartDeployments command to restart the deployments that read a set of secrets.
+const RestartDeployments = "restartDeployments"
+
 // DeleteNamespace command to delete a namespace in Kubernetes.
 const DeleteNamespace = "deleteNamespace"
 
+// PurgeNamespace command to remove every object of a set of namespaces, including the custom resources.
+const PurgeNamespace = "purgeNamespace"
+
+// PurgeByLabel command to remove every object matching a label selector, including the custom resources.
+const PurgeByLabel = "purgeByLabel"
+
 // DeleteServiceAccount command to delete a Kubernetes service account entity.
 const DeleteServiceAccount = "deleteServiceAccount"
 
@@ -145,5 +187,68 @@ const DeleteDeployment = "deleteDeployment"
 // DeletePodSecurityPolicy command to delete a Kubernetes pod security policy.
 const DeletePodSecurityPolicy = "deletePodSecurityPolicy"
 
+// InstallNetworkPolicies command to restrict the traffic into the platform namespaces.
+const InstallNetworkPolicies = "installNetworkPolicies"
+
+// ProbeCluster command to check the connectivity, latency and access to the API server of the target cluster.
+const ProbeCluster = "probeCluster"
+
+// ConfigureNamespaces command to set the metadata, limits and quotas of the platform namespaces.
+const ConfigureNamespaces = "configureNamespaces"
+
+// WaitDeploymentReady command to wait for the pods of a deployment to be ready.
+const WaitDeploymentReady = "waitDeploymentReady"
+
+// CreateVPNServerConfig command to create the configuration and identity keys of the VPN server.
+const CreateVPNServerConfig = "createVpnServerConfig"
+
+// InstallVPNServer command to deploy the VPN server used by the edge controllers.
+const InstallVPNServer = "installVpnServer"
+
+// InstallZTPlanet command to deploy a standalone ZeroTier planet.
+const InstallZTPlanet = "installZtPlanet"
+
+// ExposeService command to create a service whose type and annotations come from the configuration.
+const ExposeService = "exposeService"
+
+// InstallExternalDNS command to install external-dns publishing the platform records on the DNS provider.
+const InstallExternalDNS = "installExternalDNS"
+
+// InstallObservability command to install the monitoring and tracing stack of the platform.
+const InstallObservability = "installObservability"
+
+// InstallLoggingStack command to install the stack collecting the logs of the platform namespaces.
+const InstallLoggingStack = "installLoggingStack"
+
+// InstallStorageProvisioner command to install a dynamic provisioner of persistent volumes on the platforms without one.
+const InstallStorageProvisioner = "installStorageProvisioner"
+
+// SyncCertificate command to copy a TLS certificate to the namespaces of a cluster.
+const SyncCertificate = "syncCertificate"
+
+// CheckCertificates command to report and renew the certificates about to expire.
+const CheckCertificates = "checkCertificates"
+
+// WaitFor command to wait for a field of a Kubernetes object to reach a value.
+const WaitFor = "waitFor"
+
+// RunSmokeTests command to execute the probes checking that the installed platform answers.
+const RunSmokeTests = "runSmokeTests"
+
 // InstallIstio command to run the istio installation process.
 const InstallIstio = "installIstio"
+
+// ConfigureSidecarInjection command to label the namespaces with or without Istio sidecar injection.
+const ConfigureSidecarInjection = "configureSidecarInjection"
+
+// UpgradeIstio command to upgrade the Istio control plane with a canary revision.
+const UpgradeIstio = "upgradeIstio"
+
+// VerifyIstio command to check that the Istio control plane works once installed.
+const VerifyIstio = "verifyIstio"
+
+// PluginExec command to execute an external binary implementing the plugin protocol.
+const PluginExec = "plugin-exec"
+
+// IncludeWorkflow command to execute the commands of another workflow template inline.
+const IncludeWorkflow = "includeWorkflow"
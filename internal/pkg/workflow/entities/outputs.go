@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the references to the outputs of previous commands. Templates reference an output with
+// {{output "name"}}, which is rendered as a placeholder resolved with the workflow parameters when the command
+// is launched.
+
+package entities
+
+import (
+	"encoding/json"
+	"regexp"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+)
+
+// outputReferenceRegex matches the placeholders of the output references.
+var outputReferenceRegex = regexp.MustCompile(`\$\(output:([A-Za-z0-9_.\-]+)\)`)
+
+// OutputReference returns the placeholder referencing the output of a previous command.
+//   params:
+//     name The name of the output.
+//   returns:
+//     The placeholder to be resolved on execution.
+func OutputReference(name string) string {
+	return "$(output:" + name + ")"
+}
+
+// HasOutputReferences checks if a command definition references the outputs of previous commands.
+//   params:
+//     raw The JSON definition of the command.
+//   returns:
+//     Whether the definition contains output references.
+func HasOutputReferences(raw []byte) bool {
+	return outputReferenceRegex.Match(raw)
+}
+
+// ResolveOutputs replaces the output references of a command definition. References must appear inside JSON
+// strings, so the values are escaped accordingly.
+//   params:
+//     raw The JSON definition of the command.
+//     outputs The outputs set by the previous commands.
+//   returns:
+//     The resolved definition.
+//     An error if an output has not been set.
+func ResolveOutputs(raw []byte, outputs map[string]string) ([]byte, derrors.Error) {
+	missing := make([]interface{}, 0)
+	resolved := outputReferenceRegex.ReplaceAllFunc(raw, func(reference []byte) []byte {
+		name := string(outputReferenceRegex.FindSubmatch(reference)[1])
+		value, found := outputs[name]
+		if !found {
+			missing = append(missing, name)
+			return reference
+		}
+		escaped, _ := json.Marshal(value)
+		return escaped[1 : len(escaped)-1]
+	})
+	if len(missing) > 0 {
+		return nil, derrors.NewNotFoundError(errors.OutputNotFound).WithParams(missing...)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package entities
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Output references", func() {
+
+	ginkgo.It("must detect the references of a command", func() {
+		raw := []byte(`{"type":"sync", "name":"logger", "msg":"` + OutputReference("istio.gatewayIP") + `"}`)
+		gomega.Expect(HasOutputReferences(raw)).To(gomega.BeTrue())
+		gomega.Expect(HasOutputReferences([]byte(`{"type":"sync", "name":"logger", "msg":"$(date)"}`))).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("must resolve the references escaping the values", func() {
+		raw := []byte(`{"msg":"ip $(output:istio.gatewayIP), note $(output:note)"}`)
+		resolved, err := ResolveOutputs(raw, map[string]string{"istio.gatewayIP": "10.0.0.1", "note": `say "hi"`})
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(string(resolved)).To(gomega.Equal(`{"msg":"ip 10.0.0.1, note say \"hi\""}`))
+	})
+
+	ginkgo.It("must report the missing outputs", func() {
+		_, err := ResolveOutputs([]byte(`{"msg":"$(output:a) $(output:b)"}`), map[string]string{"a": "1"})
+		gomega.Expect(err).ToNot(gomega.BeNil())
+	})
+})
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// This file contains the registry of the commands supported by the workflows. Each command package registers its
+// commands on initialization so the parser does not need to know them in advance.
+
+package entities
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+)
+
+// CommandFactory creates a command from its raw JSON definition.
+type CommandFactory func(raw []byte) (*Command, derrors.Error)
+
+// CommandRegistration structure with the information required to parse and validate a command.
+type CommandRegistration struct {
+	// Type of the command.
+	Type CommandType
+	// Name of the command.
+	Name string
+	// Factory creating the command from its JSON definition.
+	Factory CommandFactory
+	// Prototype returns an empty instance of the structure the command is unmarshalled into. Commands whose
+	// fields are not known in advance, such as external plugins, leave it empty.
+	Prototype func() interface{}
+	// Required contains the fields that must be present in the command definition.
+	Required []string
+}
+
+// registryKey identifies a command in the registry.
+type registryKey struct {
+	commandType CommandType
+	name        string
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = make(map[registryKey]CommandRegistration, 0)
+)
+
+// AddCommand adds a new command to the registry.
+//   params:
+//     registration The command registration.
+//   returns:
+//     An error if the registration is not valid or the command is already registered.
+func AddCommand(registration CommandRegistration) derrors.Error {
+	if !ValidCommandType(registration.Type) || registration.Name == "" || registration.Factory == nil {
+		return derrors.NewInvalidArgumentError(errors.InvalidEntity).WithParams(registration.Type, registration.Name)
+	}
+	key := registryKey{registration.Type, registration.Name}
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, exists := registry[key]; exists {
+		return derrors.NewAlreadyExistsError(errors.CommandAlreadyRegistered).WithParams(registration.Type, registration.Name)
+	}
+	registry[key] = registration
+	return nil
+}
+
+// RemoveCommand removes a command from the registry.
+//   params:
+//     commandType The type of the command.
+//     name The name of the command.
+func RemoveCommand(commandType CommandType, name string) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	delete(registry, registryKey{commandType, name})
+}
+
+// RegisterSyncCommand registers a built-in synchronous command. It is intended to be called from the init
+// function of the command packages, and panics if the command is already registered.
+//   params:
+//     name The name of the command.
+//     factory The function creating the command from its JSON definition.
+//     prototype The function returning an empty instance of the command structure.
+//     required The fields that must be present in the command definition.
+func RegisterSyncCommand(name string, factory CommandFactory, prototype func() interface{}, required ...string) {
+	mustAddCommand(CommandRegistration{SyncCommandType, name, factory, prototype, required})
+}
+
+// RegisterAsyncCommand registers a built-in asynchronous command. It is intended to be called from the init
+// function of the command packages, and panics if the command is already registered.
+//   params:
+//     name The name of the command.
+//     factory The function creating the command from its JSON definition.
+//     prototype The function returning an empty instance of the command structure.
+//     required The fields that must be present in the command definition.
+func RegisterAsyncCommand(name string, factory CommandFactory, prototype func() interface{}, required ...string) {
+	mustAddCommand(CommandRegistration{AsyncCommandType, name, factory, prototype, required})
+}
+
+// mustAddCommand adds a command to the registry panicking on error.
+func mustAddCommand(registration CommandRegistration) {
+	if err := AddCommand(registration); err != nil {
+		panic(err.Error())
+	}
+}
+
+// LookupCommand returns the registration of a command.
+//   params:
+//     commandType The type of the command.
+//     name The name of the command.
+//   returns:
+//     The command registration and whether the command is registered.
+func LookupCommand(commandType CommandType, name string) (CommandRegistration, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	registration, found := registry[registryKey{commandType, name}]
+	return registration, found
+}
+
+// RegisteredCommands returns the names of the registered commands of a given type.
+//   params:
+//     commandType The type of the commands.
+//   returns:
+//     The sorted list of command names.
+func RegisteredCommands(commandType CommandType) []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	result := make([]string, 0)
+	for key := range registry {
+		if key.commandType == commandType {
+			result = append(result, key.name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
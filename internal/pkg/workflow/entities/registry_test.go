@@ -0,0 +1,61 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package entities
+
+import (
+	"github.com/nalej/derrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Command registry", func() {
+
+	var factory = func(raw []byte) (*Command, derrors.Error) {
+		return nil, nil
+	}
+
+	ginkgo.AfterEach(func() {
+		RemoveCommand(SyncCommandType, "registryTest")
+		RemoveCommand(AsyncCommandType, "registryTest")
+	})
+
+	ginkgo.It("must register and look up commands", func() {
+		err := AddCommand(CommandRegistration{Type: SyncCommandType, Name: "registryTest", Factory: factory, Required: []string{"path"}})
+		gomega.Expect(err).To(gomega.BeNil())
+		registration, found := LookupCommand(SyncCommandType, "registryTest")
+		gomega.Expect(found).To(gomega.BeTrue())
+		gomega.Expect(registration.Required).To(gomega.Equal([]string{"path"}))
+		_, found = LookupCommand(AsyncCommandType, "registryTest")
+		gomega.Expect(found).To(gomega.BeFalse())
+		gomega.Expect(RegisteredCommands(SyncCommandType)).To(gomega.ContainElement("registryTest"))
+	})
+
+	ginkgo.It("must reject duplicated commands", func() {
+		gomega.Expect(AddCommand(CommandRegistration{Type: SyncCommandType, Name: "registryTest", Factory: factory})).To(gomega.BeNil())
+		err := AddCommand(CommandRegistration{Type: SyncCommandType, Name: "registryTest", Factory: factory})
+		gomega.Expect(err).ToNot(gomega.BeNil())
+		gomega.Expect(func() { RegisterSyncCommand("registryTest", factory, nil) }).To(gomega.Panic())
+		gomega.Expect(AddCommand(CommandRegistration{Type: AsyncCommandType, Name: "registryTest", Factory: factory})).To(gomega.BeNil())
+	})
+
+	ginkgo.It("must reject invalid registrations", func() {
+		gomega.Expect(AddCommand(CommandRegistration{Type: SyncCommandType, Name: "registryTest"})).ToNot(gomega.BeNil())
+		gomega.Expect(AddCommand(CommandRegistration{Type: "other", Name: "registryTest", Factory: factory})).ToNot(gomega.BeNil())
+		gomega.Expect(AddCommand(CommandRegistration{Type: SyncCommandType, Factory: factory})).ToNot(gomega.BeNil())
+	})
+})
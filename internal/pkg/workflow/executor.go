@@ -22,6 +22,8 @@ import (
 	"github.com/nalej/installer/internal/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/nalej/installer/internal/pkg/workflow/entities"
 	"github.com/nalej/installer/internal/pkg/workflow/handler"
@@ -49,6 +51,34 @@ type Executor struct {
 	State            WorkflowState `json:"state"`
 	workflowCallback func(workflowID string, error derrors.Error, state WorkflowState)
 	Parameters       map[string]string `json:"parameters"`
+	// CommandResults contains the status of the commands that have finished their execution.
+	CommandResults []CommandStatus `json:"commandResults"`
+	// commandStart with the time the current command was launched.
+	commandStart time.Time
+	// resultsLock protects the command results read while the workflow is running.
+	resultsLock sync.Mutex
+}
+
+// CommandStatus structure with the result of the execution of a command.
+type CommandStatus struct {
+	// Index of the command in the workflow.
+	Index int `json:"index" yaml:"index"`
+	// CommandID with the identifier of the command.
+	CommandID string `json:"command_id" yaml:"command_id"`
+	// Name of the command.
+	Name string `json:"name" yaml:"name"`
+	// Description with the user representation of the command.
+	Description string `json:"description" yaml:"description"`
+	// Success indicates if the command succeeded.
+	Success bool `json:"success" yaml:"success"`
+	// Output of the command, if any.
+	Output string `json:"output,omitempty" yaml:"output,omitempty"`
+	// Error with the reason of the failure, if any.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Objects with the references of the Kubernetes objects applied by the command, if any.
+	Objects []entities.AppliedObject `json:"objects,omitempty" yaml:"objects,omitempty"`
+	// Duration of the execution of the command.
+	Duration string `json:"duration" yaml:"duration"`
 }
 
 // NewWorkflowExecutor creates a new executor
@@ -59,7 +89,8 @@ func NewWorkflowExecutor(workflow *Workflow,
 	workflowCallback func(workflowID string, error derrors.Error, state WorkflowState)) *Executor {
 	return &Executor{workflow, handler.GetCommandHandler(),
 		0, make([]string, 0), nil,
-		InitState, workflowCallback, make(map[string]string, 0)}
+		InitState, workflowCallback, make(map[string]string, 0),
+		make([]CommandStatus, 0), time.Time{}, sync.Mutex{}}
 }
 
 // SetLogListener attaches a given function as the log listener for input log entries.
@@ -72,6 +103,7 @@ func (e *Executor) executeCommand(index int) derrors.Error {
 		return derrors.NewInternalError(errors.InvalidCommandIndex).WithParams(index, e.Workflow)
 	}
 	e.currentCommand = index
+	e.commandStart = time.Now()
 	go func() {
 		toExecuted := e.Workflow.Commands[index]
 		e.execOnBackground(index, toExecuted)
@@ -93,6 +125,9 @@ func (e *Executor) execOnBackground(index int, cmd entities.Command) {
 	}
 	if cmd.Type() == entities.SyncCommandType {
 		executorLogger.Debug().Str("cmd", cmd.String()).Msg("Executing sync command")
+		if reader, ok := cmd.(entities.ParameterReader); ok {
+			reader.SetParameters(e.parametersCopy())
+		}
 		result, err := cmd.(entities.SyncCommand).Run(e.Workflow.WorkflowID)
 
 		err = e.handler.FinishCommand(cmd.ID(), result, err)
@@ -116,9 +151,10 @@ func (e *Executor) commandCallback(cmdID string, result *entities.CommandResult,
 	// To support parallel execution of commands, we can implement a barrier command that will make commandCallback
 	// not to launch more commands until all pending commands have finished.
 
+	e.addCommandStatus(result, error)
 	if error != nil {
 		// Stop workflow execution
-		e.failed(derrors.NewInternalError(errors.WorkflowExecutionFailed).CausedBy(error))
+		e.failed(derrors.NewInternalError(failureMessage(error, "")).CausedBy(error))
 		return
 	}
 
@@ -133,6 +169,9 @@ func (e *Executor) commandCallback(cmdID string, result *entities.CommandResult,
 		}
 
 		if (*result).Success {
+			for key, value := range (*result).Outputs {
+				e.ParameterSet(key, value)
+			}
 			if e.currentCommand == len(e.Workflow.Commands)-1 {
 				executorLogger.Debug().Interface("workflowState", e.State).Msg("all commands have been executed")
 				e.AddLogEntry("All commands have been executed")
@@ -147,7 +186,7 @@ func (e *Executor) commandCallback(cmdID string, result *entities.CommandResult,
 			}
 		} else {
 			log.Warn().Str("workflowID", e.WorkflowID).Msg(result.String())
-			e.failed(derrors.NewInternalError(errors.WorkflowExecutionFailed).WithParams(result.String()))
+			e.failed(derrors.NewInternalError(failureMessage(result.Error, result.Output)).WithParams(result.String()))
 		}
 	} else {
 		e.failed(derrors.NewInternalError(errors.InvalidWorkflowState))
@@ -155,6 +194,58 @@ func (e *Executor) commandCallback(cmdID string, result *entities.CommandResult,
 
 }
 
+// failureMessage returns the message of a failed workflow with the error code of the failed command, if any, so it
+// is reported with the operation.
+func failureMessage(err derrors.Error, output string) string {
+	code, found := errors.ErrorCode(err)
+	if !found {
+		code, found = errors.CodeOf(output)
+	}
+	if !found {
+		return errors.WorkflowExecutionFailed
+	}
+	return errors.Coded(code, errors.WorkflowExecutionFailed)
+}
+
+// addCommandStatus registers the result of the current command.
+func (e *Executor) addCommandStatus(result *entities.CommandResult, err derrors.Error) {
+	status := CommandStatus{
+		Index:    e.currentCommand,
+		Duration: time.Since(e.commandStart).String(),
+	}
+	if e.currentCommand < len(e.Workflow.Commands) {
+		cmd := e.Workflow.Commands[e.currentCommand]
+		status.CommandID = cmd.ID()
+		status.Name = cmd.Name()
+		status.Description = cmd.UserString()
+	}
+	if result != nil {
+		status.Success = result.Success
+		status.Output = result.Output
+		status.Objects = result.Objects
+		if result.Error != nil {
+			status.Error = result.Error.Error()
+		}
+	}
+	if err != nil {
+		status.Success = false
+		status.Error = err.Error()
+	}
+	e.resultsLock.Lock()
+	e.CommandResults = append(e.CommandResults, status)
+	e.resultsLock.Unlock()
+}
+
+// Results retrieves a copy of the status of the commands that have finished their execution, which can be called
+// while the workflow is running.
+func (e *Executor) Results() []CommandStatus {
+	e.resultsLock.Lock()
+	defer e.resultsLock.Unlock()
+	results := make([]CommandStatus, len(e.CommandResults))
+	copy(results, e.CommandResults)
+	return results
+}
+
 func (e *Executor) logCallback(id string, logEntry string) {
 	e.AddLogEntry(logEntry)
 }
@@ -214,6 +305,15 @@ func (e *Executor) ParameterSet(key string, value string) {
 	e.Parameters[key] = value
 }
 
+// parametersCopy returns a copy of the workflow parameters.
+func (e *Executor) parametersCopy() map[string]string {
+	result := make(map[string]string, len(e.Parameters))
+	for key, value := range e.Parameters {
+		result[key] = value
+	}
+	return result
+}
+
 // ParameterGet retrieves the value of a given key.
 func (e *Executor) ParameterGet(key string) (*WorkflowParameter, derrors.Error) {
 	value, exists := e.Parameters[key]
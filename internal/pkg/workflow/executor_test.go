@@ -18,6 +18,8 @@
 package workflow
 
 import (
+	"github.com/nalej/installer/internal/pkg/workflow/commands"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
 	"time"
@@ -37,6 +39,18 @@ const basicWorkflow = `
 }
 `
 
+const tryWorkflow = `
+{
+ "description": "tryWorkflow",
+ "commands": [
+  {"type":"sync", "name": "try", "description":"Sleep or log",
+    "cmd": {"type":"sync", "name": "sleep", "time": "0"},
+    "onFail": {"type":"sync", "name": "logger", "msg": "Recovered from the failure"}},
+  {"type":"sync", "name": "logger", "msg": "Ending tryWorkflow execution"}
+ ]
+}
+`
+
 const basicParallelWorkflow = `
 {
  "description": "basicParallelWorkflow",
@@ -115,6 +129,13 @@ var _ = ginkgo.Describe("Executor", func() {
 			time.Sleep(time.Second * 1)
 		}
 		expectSuccess(wr)
+		ginkgo.It("must register the status of each command", func() {
+			gomega.Expect(len(exec.CommandResults)).To(gomega.Equal(len(w.Commands)))
+			for index, status := range exec.CommandResults {
+				gomega.Expect(status.Index).To(gomega.Equal(index))
+				gomega.Expect(status.Success).To(gomega.BeTrue())
+			}
+		})
 	})
 
 	ginkgo.Context("with a parallel construct", func() {
@@ -146,6 +167,28 @@ var _ = ginkgo.Describe("Executor", func() {
 		})
 	})
 
+	ginkgo.Context("with injected failures", func() {
+		commands.SetFaultInjector(commands.NewFaultInjector(commands.FaultRule{CommandName: entities.Sleep, Failures: 1}))
+		recovered := getWorkflow("TestRecoveredFailure", tryWorkflow)
+		commands.SetFaultInjector(commands.NewFaultInjector(commands.FaultRule{CommandName: entities.Logger}))
+		failed := getWorkflow("TestInjectedFailure", tryWorkflow)
+		commands.SetFaultInjector(nil)
+
+		recoveredResult := &WorkflowResult{}
+		NewWorkflowExecutor(recovered, recoveredResult.Callback).Exec()
+		failedResult := &WorkflowResult{}
+		NewWorkflowExecutor(failed, failedResult.Callback).Exec()
+		// Wait for the workflows to finish
+		for i := 0; i < maxWait && !(recoveredResult.Finished() && failedResult.Finished()); i++ {
+			time.Sleep(time.Second * 1)
+		}
+		expectSuccess(recoveredResult)
+		ginkgo.It("must fail if the failures are not handled", func() {
+			gomega.Expect(failedResult.Called).To(gomega.BeTrue())
+			gomega.Expect(failedResult.Error).ToNot(gomega.BeNil())
+		})
+	})
+
 	ginkgo.Context("with a max parallelism spec", func() {
 		w := getWorkflow("TestMaxParallel", parallelMaxParallelismWorkflow)
 		wr := &WorkflowResult{}
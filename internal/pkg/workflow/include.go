@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Include workflow command
+// Includes the commands of another named template. The included template is rendered with the parameters of the
+// parent workflow plus the bindings defined in the command, that are available as .Bindings.<key>. The include is
+// replaced by a group command with the resulting commands so they are executed inline.
+//
+// {"type":"sync", "name": "includeWorkflow", "template": "registry-secrets", "version": "1.0.0",
+//  "params": {"namespace": "nalej"}}
+
+package workflow
+
+import (
+	"encoding/json"
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"strings"
+)
+
+// MaxIncludeDepth is the maximum number of nested includes to avoid include cycles.
+const MaxIncludeDepth = 10
+
+// TemplateProvider retrieves the content of the templates referenced by include commands.
+type TemplateProvider interface {
+	// GetContent returns the content of a template. If the version is empty, the latest one is returned.
+	GetContent(name string, version string) (string, derrors.Error)
+}
+
+// isInclude checks if a decoded command is an include command.
+func isInclude(cmd map[string]interface{}) bool {
+	name, ok := cmd["name"].(string)
+	return ok && name == entities.IncludeWorkflow
+}
+
+// expandInclude renders the referenced template and returns a group command with its commands.
+func (p *Parser) expandInclude(cmd map[string]interface{}, params Parameters, depth int) (map[string]interface{}, derrors.Error) {
+	if p.templates == nil {
+		return nil, derrors.NewInternalError(errors.IncludeWithoutTemplates)
+	}
+	if depth >= MaxIncludeDepth {
+		return nil, derrors.NewInvalidArgumentError(errors.MaxIncludeDepthReached).WithParams(MaxIncludeDepth)
+	}
+	raw, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, derrors.NewInternalError(errors.MarshalError, err)
+	}
+	var include commands.IncludeWorkflow
+	if err := json.Unmarshal(raw, &include); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err)
+	}
+	if include.Template == "" {
+		return nil, derrors.NewInvalidArgumentError(errors.InvalidCommandParameters).WithParams("template")
+	}
+	content, dErr := p.templates.GetContent(include.Template, include.Version)
+	if dErr != nil {
+		return nil, dErr
+	}
+
+	// Included templates inherit the bindings of the parent one.
+	bindings := make(map[string]string, len(params.Bindings)+len(include.Params))
+	for key, value := range params.Bindings {
+		bindings[key] = value
+	}
+	for key, value := range include.Params {
+		bindings[key] = value
+	}
+	includeParams := params
+	includeParams.Bindings = bindings
+
+	rendered, dErr := p.render(content, include.Template, includeParams)
+	if dErr != nil {
+		return nil, dErr
+	}
+	if dErr := validate(rendered, include.Template, includeParams); dErr != nil {
+		return nil, dErr
+	}
+	decoder := json.NewDecoder(strings.NewReader(rendered))
+	decoder.UseNumber()
+	var included map[string]interface{}
+	if err := decoder.Decode(&included); err != nil {
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err).WithParams(
+			diagnosticParams(offsetDiagnostic(rendered, jsonErrorOffset(err), includeParams), include.Template)...)
+	}
+	if dErr := p.processCommandList(included, includeParams, depth+1); dErr != nil {
+		return nil, dErr
+	}
+	commands, ok := included[CommandsField]
+	if !ok {
+		commands = make([]interface{}, 0)
+	}
+	return map[string]interface{}{
+		"type":        string(entities.SyncCommandType),
+		"name":        entities.GroupCmd,
+		"description": "include " + include.Template,
+		CommandsField: commands,
+	}, nil
+}
@@ -0,0 +1,329 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Workflow linting
+// Rendered workflows are validated against the schema of the supported commands before being parsed, so
+// unknown commands, unknown fields, type mismatches and missing required fields are reported with the line
+// where they appear instead of failing during the execution.
+
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands"
+	"github.com/nalej/installer/internal/pkg/workflow/entities"
+	"reflect"
+	"strings"
+)
+
+// LintIssue structure with a problem found validating a workflow.
+type LintIssue struct {
+	// Line where the issue was found, starting at 1.
+	Line int
+	// Column where the issue was found, starting at 1.
+	Column int
+	// Command with the name of the affected command, if any.
+	Command string
+	// Message describing the issue.
+	Message string
+}
+
+// String returns the string representation of the issue.
+func (li LintIssue) String() string {
+	if li.Command == "" {
+		return fmt.Sprintf("line %d, column %d: %s", li.Line, li.Column, li.Message)
+	}
+	return fmt.Sprintf("line %d, column %d: [%s] %s", li.Line, li.Column, li.Command, li.Message)
+}
+
+// jsonMember structure with the position of a member of a JSON object.
+type jsonMember struct {
+	key   string
+	start int
+	end   int
+}
+
+// linter structure with the payload being validated and the issues found.
+type linter struct {
+	data   []byte
+	issues []LintIssue
+}
+
+// Lint validates a rendered workflow against the schema of the supported commands.
+//   params:
+//     jsonPayload The rendered workflow.
+//   returns:
+//     The list of issues found, empty if the workflow is valid.
+func Lint(jsonPayload string) []LintIssue {
+	l := &linter{data: []byte(jsonPayload), issues: make([]LintIssue, 0)}
+	var aux interface{}
+	if err := json.Unmarshal(l.data, &aux); err != nil {
+		offset := 0
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			offset = int(syntaxErr.Offset)
+		}
+		l.addIssue(offset, "", err.Error())
+		return l.issues
+	}
+	start := skipSpaces(l.data, 0)
+	if l.data[start] != '{' {
+		l.addIssue(start, "", "workflow must be a JSON object")
+		return l.issues
+	}
+	members := l.objectMembers(start)
+	for _, member := range members {
+		if member.key == CommandsField {
+			l.lintCommandList(member)
+			return l.issues
+		}
+	}
+	l.addIssue(start, "", "missing commands field")
+	return l.issues
+}
+
+// validate lints a rendered workflow returning an error with the issues found and the lines around the first one.
+func validate(jsonPayload string, name string, templateParams Parameters) derrors.Error {
+	issues := Lint(jsonPayload)
+	if len(issues) == 0 {
+		return nil
+	}
+	params := make([]interface{}, 0, len(issues)+1)
+	params = append(params, name)
+	for _, issue := range issues {
+		params = append(params, issue.String())
+	}
+	if diagnostic := renderedDiagnostic(jsonPayload, issues[0].Line, issues[0].Column, templateParams); diagnostic != "" {
+		params = append(params, diagnostic)
+	}
+	return derrors.NewInvalidArgumentError(errors.InvalidWorkflowSchema).WithParams(params...)
+}
+
+// addIssue registers a new issue at the given offset of the payload.
+func (l *linter) addIssue(offset int, command string, message string) {
+	if offset > len(l.data) {
+		offset = len(l.data)
+	}
+	line := strings.Count(string(l.data[:offset]), "\n") + 1
+	column := offset - strings.LastIndex(string(l.data[:offset]), "\n")
+	l.issues = append(l.issues, LintIssue{Line: line, Column: column, Command: command, Message: message})
+}
+
+// lintCommandList validates the commands contained in an array.
+func (l *linter) lintCommandList(list jsonMember) {
+	if l.data[list.start] != '[' {
+		l.addIssue(list.start, "", fmt.Sprintf("%s must be an array", list.key))
+		return
+	}
+	for _, element := range l.arrayElements(list.start) {
+		l.lintCommand(element)
+	}
+}
+
+// lintCommand validates a single command against its schema.
+func (l *linter) lintCommand(cmd jsonMember) {
+	if l.data[cmd.start] != '{' {
+		l.addIssue(cmd.start, "", "command must be a JSON object")
+		return
+	}
+	members := l.objectMembers(cmd.start)
+	var generic entities.GenericCommand
+	if err := json.Unmarshal(l.data[cmd.start:cmd.end], &generic); err != nil {
+		l.addIssue(cmd.start, "", err.Error())
+		return
+	}
+	if generic.CommandName == "" {
+		l.addIssue(cmd.start, "", "missing command name")
+		return
+	}
+	schema, found := commands.GetSchema(generic.CommandType, generic.CommandName)
+	if !found {
+		l.addIssue(cmd.start, generic.CommandName,
+			fmt.Sprintf("unknown command %q of type %q", generic.CommandName, generic.CommandType))
+		return
+	}
+
+	present := make(map[string]bool, len(members))
+	for _, member := range members {
+		present[member.key] = true
+	}
+	if schema.Prototype != nil {
+		l.lintFields(generic.CommandName, schema, members)
+	}
+	for _, required := range schema.Required {
+		if !present[required] {
+			l.addIssue(cmd.start, generic.CommandName, fmt.Sprintf("missing required field %q", required))
+		}
+	}
+
+	// Validate nested commands.
+	for _, member := range members {
+		switch {
+		case member.key == CommandsField && (generic.CommandName == entities.GroupCmd || generic.CommandName == entities.ParallelCmd):
+			l.lintCommandList(member)
+		case (member.key == "cmd" || member.key == "onFail") && generic.CommandName == entities.TryCmd:
+			l.lintCommand(member)
+		}
+	}
+}
+
+// lintFields validates the fields of a command against the structure described by its schema.
+func (l *linter) lintFields(commandName string, schema commands.CommandSchema, members []jsonMember) {
+	fields := jsonFields(reflect.TypeOf(schema.Prototype()))
+	for _, member := range members {
+		if member.key == WhenField {
+			if l.data[member.start] != '"' {
+				l.addIssue(member.start, commandName, "when must be a string")
+			}
+			continue
+		}
+		if !fields[member.key] {
+			l.addIssue(member.start, commandName, fmt.Sprintf("unknown field %q", member.key))
+			continue
+		}
+		single := fmt.Sprintf("{%q:%s}", member.key, l.data[member.start:member.end])
+		if err := json.Unmarshal([]byte(single), schema.Prototype()); err != nil {
+			if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+				l.addIssue(member.start, commandName,
+					fmt.Sprintf("field %q expects %s, found %s", member.key, typeErr.Type.String(), typeErr.Value))
+			} else {
+				l.addIssue(member.start, commandName, err.Error())
+			}
+		}
+	}
+}
+
+// jsonFields returns the set of JSON fields accepted by a structure, including those of embedded structures.
+func jsonFields(t reflect.Type) map[string]bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	result := make(map[string]bool, 0)
+	if t.Kind() != reflect.Struct {
+		return result
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			for embedded := range jsonFields(field.Type) {
+				result[embedded] = true
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			// Unexported field.
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		result[name] = true
+	}
+	return result
+}
+
+// skipSpaces returns the position of the next non whitespace character.
+func skipSpaces(data []byte, pos int) int {
+	for pos < len(data) && (data[pos] == ' ' || data[pos] == '\t' || data[pos] == '\r' || data[pos] == '\n') {
+		pos++
+	}
+	return pos
+}
+
+// scanValue returns the position after the JSON value starting at pos. The payload is expected to be valid.
+func scanValue(data []byte, pos int) int {
+	depth := 0
+	inString := false
+	escaped := false
+	for i := pos; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+				if depth == 0 {
+					return i + 1
+				}
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case ',', ' ', '\t', '\r', '\n':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(data)
+}
+
+// objectMembers returns the members of the JSON object starting at pos.
+func (l *linter) objectMembers(pos int) []jsonMember {
+	result := make([]jsonMember, 0)
+	pos = skipSpaces(l.data, pos+1)
+	for pos < len(l.data) && l.data[pos] != '}' {
+		keyEnd := scanValue(l.data, pos)
+		var key string
+		_ = json.Unmarshal(l.data[pos:keyEnd], &key)
+		// Skip the colon separating the key and the value.
+		pos = skipSpaces(l.data, skipSpaces(l.data, keyEnd)+1)
+		end := scanValue(l.data, pos)
+		result = append(result, jsonMember{key: key, start: pos, end: end})
+		pos = skipSpaces(l.data, end)
+		if pos < len(l.data) && l.data[pos] == ',' {
+			pos = skipSpaces(l.data, pos+1)
+		}
+	}
+	return result
+}
+
+// arrayElements returns the elements of the JSON array starting at pos.
+func (l *linter) arrayElements(pos int) []jsonMember {
+	result := make([]jsonMember, 0)
+	pos = skipSpaces(l.data, pos+1)
+	for pos < len(l.data) && l.data[pos] != ']' {
+		end := scanValue(l.data, pos)
+		result = append(result, jsonMember{start: pos, end: end})
+		pos = skipSpaces(l.data, end)
+		if pos < len(l.data) && l.data[pos] == ',' {
+			pos = skipSpaces(l.data, pos+1)
+		}
+	}
+	return result
+}
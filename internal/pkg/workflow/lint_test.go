@@ -0,0 +1,75 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package workflow
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const invalidSchemaWorkflow = `{
+ "description": "invalidSchemaWorkflow",
+ "commands": [
+  {"type":"sync", "name": "exec", "cmd": "cmd1"},
+  {"type":"sync", "name": "unknown"},
+  {"type":"sync", "name": "exec", "cmd": "cmd2", "arguments": ["arg1"]},
+  {"type":"sync", "name": "exec", "cmd": 3},
+  {"type":"sync", "name": "group", "commands": [
+   {"type":"sync", "name": "logger"}
+  ]}
+ ]
+}`
+
+var _ = ginkgo.Describe("Lint", func() {
+
+	ginkgo.It("should accept a valid workflow", func() {
+		issues := Lint(basicDefinitionTwoCommands)
+		gomega.Expect(issues).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should accept conditional commands", func() {
+		rendered, err := NewParser().render(conditionalTemplate, "conditionalTemplate", *GetTestInstallParameters(1, false))
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(Lint(rendered)).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should report the issues with their location", func() {
+		issues := Lint(invalidSchemaWorkflow)
+		gomega.Expect(len(issues)).Should(gomega.Equal(4))
+		gomega.Expect(issues[0].Line).Should(gomega.Equal(5))
+		gomega.Expect(issues[0].Message).Should(gomega.ContainSubstring("unknown command"))
+		gomega.Expect(issues[1].Line).Should(gomega.Equal(6))
+		gomega.Expect(issues[1].Command).Should(gomega.Equal("exec"))
+		gomega.Expect(issues[1].Message).Should(gomega.ContainSubstring("arguments"))
+		gomega.Expect(issues[2].Line).Should(gomega.Equal(7))
+		gomega.Expect(issues[2].Message).Should(gomega.ContainSubstring("expects string"))
+		gomega.Expect(issues[3].Line).Should(gomega.Equal(9))
+		gomega.Expect(issues[3].Command).Should(gomega.Equal("logger"))
+		gomega.Expect(issues[3].Message).Should(gomega.ContainSubstring("msg"))
+	})
+
+	ginkgo.It("should report syntax errors", func() {
+		issues := Lint("{\"commands\": [}")
+		gomega.Expect(len(issues)).Should(gomega.Equal(1))
+	})
+
+	ginkgo.It("should fail to parse an invalid workflow", func() {
+		_, err := NewParser().ParseWorkflow("lint", invalidSchemaWorkflow, "invalid", *GetTestInstallParameters(1, false))
+		gomega.Expect(err).ShouldNot(gomega.BeNil())
+	})
+})
@@ -32,10 +32,14 @@ const DefaultManagementPort = "443"
 
 // Parameters required to transform a template into a workflow.
 type Parameters struct {
+	// SchemaVersion with the version of the schema of the parameters, see ParametersSchemaVersion.
+	SchemaVersion int `json:"schema_version"`
 	// InstallRequest with the details of the installation to be performed.
 	InstallRequest *grpc_installer_go.InstallRequest
 	// UninstallRequest with the details of the uninstall to be performed.
 	UninstallRequest *grpc_installer_go.UninstallClusterRequest
+	// RotateSecretsRequest with the details of the secret rotation to be performed.
+	RotateSecretsRequest *RotateSecretsRequest
 	// Credentials required for the installation of the cluster.
 	Credentials InstallCredentials `json:"credentials"`
 	// Assets to be installed
@@ -58,8 +62,55 @@ type Parameters struct {
 	NetworkConfig NetworkConfig `json:"network_config"`
 	// AuthSecret contains the secret required to validate JWT tokens.
 	AuthSecret string `json:"auth_secret"`
+	// AuthSecretLength with the number of random bytes of the generated authx secret, 32 if not set.
+	AuthSecretLength int `json:"auth_secret_length"`
+	// AuthSecretEncoding with the encoding of the generated authx secret: base64 or hex, base64 if empty.
+	AuthSecretEncoding string `json:"auth_secret_encoding"`
+	// ForceRotate indicates if the existing authx secret is replaced when the secrets are rotated.
+	ForceRotate bool `json:"force_rotate"`
 	// CACertPath contains the path to the certificate of a TLS secret
 	CACertPath string `json:"ca_cert_path"`
+	// Bindings contains the parameters defined by the include command that rendered the current template.
+	Bindings map[string]string `json:"bindings,omitempty"`
+	// HardenNetwork indicates if the network policies restricting the traffic into the platform namespaces must be installed.
+	HardenNetwork bool `json:"harden_network"`
+	// WithObservability indicates if the monitoring and tracing stack must be installed.
+	WithObservability bool `json:"with_observability"`
+	// LoggingStack with the name of the stack collecting the logs of the platform namespaces, none if empty.
+	LoggingStack string `json:"logging_stack"`
+	// StorageProvisioner with the name of the provisioner of persistent volumes installed on the platforms without
+	// one, none if empty.
+	StorageProvisioner string `json:"storage_provisioner"`
+	// NFSShare with the share used by the NFS provisioner with the server:/path format.
+	NFSShare string `json:"nfs_share"`
+	// LogRetention with the duration the logs are kept by the logging stack.
+	LogRetention string `json:"log_retention"`
+	// LogStorageSize with the size of the volume storing the logs.
+	LogStorageSize string `json:"log_storage_size"`
+	// IngressCertificate with the namespace/name of the secret of the management cluster with the wildcard
+	// certificate copied to the application clusters, none if empty.
+	IngressCertificate string `json:"ingress_certificate"`
+	// CertificateIssuer with the mode issuing the ingress certificates: letsencrypt or internal, letsencrypt if empty.
+	CertificateIssuer string `json:"certificate_issuer"`
+	// Prune indicates if the components of previous installs that are no longer part of the components directory
+	// must be removed.
+	Prune bool `json:"prune"`
+	// AdoptExisting indicates if the existing components not created by the installer are labeled as managed by it
+	// and updated, instead of failing the install.
+	AdoptExisting bool `json:"adopt_existing"`
+	// MigrateVolumes indicates if the existing claims whose size is increased and whose volumes cannot be expanded
+	// are migrated to new claims, instead of failing the install.
+	MigrateVolumes bool `json:"migrate_volumes"`
+	// FeatureFlags with the feature flags of the install exposed to the components that request them.
+	FeatureFlags map[string]string `json:"feature_flags,omitempty"`
+	// AllowUnsupportedVersions indicates if the install continues when the versions are not part of the
+	// compatibility matrix.
+	AllowUnsupportedVersions bool `json:"allow_unsupported_versions"`
+	// Platform of the cluster when it is not one of the platforms of the requests, such as OPENSHIFT.
+	Platform string `json:"platform"`
+	// StrictIdentifiers indicates if the identifiers of the requests must follow the UUID format, as the ones
+	// received by the service.
+	StrictIdentifiers bool `json:"strict_identifiers"`
 }
 
 var EmptyNetworkConfig = &NetworkConfig{}
@@ -69,6 +120,26 @@ type NetworkConfig struct {
 	NetworkingMode string `json: "networking_mode"`
 	// IstioPath where the Istio project can be found locally
 	IstioPath string `json: "istio_path"`
+	// IstioctlImage with the image running istioctl if IstioPath has no binary for the host platform.
+	IstioctlImage string `json:"istioctl_image"`
+	// IstioRevision with the revision of the control plane whose sidecar injector is used, empty for the default one.
+	IstioRevision string `json:"istio_revision"`
+	// IstioTrustDomain with the SPIFFE trust domain of the mesh, cluster.local if empty.
+	IstioTrustDomain string `json:"istio_trust_domain"`
+	// IstioNamespace with the namespace where Istio is installed, istio-system if empty.
+	IstioNamespace string `json:"istio_namespace"`
+	// IstioIngressGateway with the name of the service of the Istio ingress gateway, istio-ingressgateway if empty.
+	IstioIngressGateway string `json:"istio_ingress_gateway"`
+	// IstioCASecret with the name of the secret with the CAs of Istio, cacerts if empty.
+	IstioCASecret string `json:"istio_ca_secret"`
+	// IstioGatewayIP with the IP of the Istio ingress gateway of the management cluster used by the application
+	// clusters. If empty, it is looked up in the management cluster.
+	IstioGatewayIP string `json:"istio_gateway_ip"`
+	// IngressController serving the ingresses: nginx, traefik or istio. If empty, the Istio gateway is used with the
+	// istio networking mode and NGINX otherwise.
+	IngressController string `json:"ingress_controller"`
+	// ClusterDomain with the DNS domain of the services of the cluster, cluster.local if empty.
+	ClusterDomain string `json:"cluster_domain"`
 	// Deprecated: ZT Planet Secret
 	ZTPlanetSecretPath string `json:"zt_planet_secret_path"`
 }
@@ -100,10 +171,42 @@ type Paths struct {
 	BinaryPath string `json:"binaryPath"`
 	// TempPath contains the path of the temporal files used for the installs.
 	TempPath string `json:"tempPath"`
+	// ComponentsPublicKeyPath contains the key used to verify the signature of the components. If empty, the
+	// signature is not verified.
+	ComponentsPublicKeyPath string `json:"componentsPublicKeyPath"`
+	// RegistriesPath contains the registries used to pull the images of the components and the rules mapping the
+	// images to their pull secrets. If empty, the pull secrets of the components are not modified.
+	RegistriesPath string `json:"registriesPath"`
+	// SecretStorePath contains the external secret store whose values back the secrets created by the installer.
+	// If empty, the secrets are created with their values.
+	SecretStorePath string `json:"secretStorePath"`
+	// NamespaceGovernancePath contains the labels, limits and quotas of the platform namespaces by environment. If
+	// empty, the defaults of the target environment are used.
+	NamespaceGovernancePath string `json:"namespaceGovernancePath"`
+	// CRDsPath contains the custom resource definitions created and established before launching the components. If
+	// empty, the definitions are launched along with the components.
+	CRDsPath string `json:"crdsPath"`
+	// StorageClassesPath contains the storage classes of the persistent volumes and claims of the components by
+	// platform and by name. If empty, the defaults of the platform are used.
+	StorageClassesPath string `json:"storageClassesPath"`
+	// ManagementKubeConfigPath contains the kubeconfig of the management cluster where the ingress certificate is
+	// read. If empty, the cluster where the installer runs is used.
+	ManagementKubeConfigPath string `json:"managementKubeConfigPath"`
+	// IngressCertPath and IngressKeyPath contain the ingress certificate received by the application clusters
+	// joining the management cluster, used instead of reading the certificate from the management cluster.
+	IngressCertPath string `json:"ingressCertPath"`
+	IngressKeyPath  string `json:"ingressKeyPath"`
+	// IngressCAPath contains the CA that issued the ingress certificate received by the application clusters, kept
+	// with the certificate so the clients of the cluster can trust it.
+	IngressCAPath string `json:"ingressCAPath"`
+	// InternalCACertPath and InternalCAKeyPath contain the CA issuing the ingress certificates with the internal
+	// certificate issuer. If empty, the CA of a previous install is kept or a new one is generated.
+	InternalCACertPath string `json:"internalCACertPath"`
+	InternalCAKeyPath  string `json:"internalCAKeyPath"`
 }
 
 func NewPaths(componentsPath string, binaryPath string, tempPath string) *Paths {
-	return &Paths{componentsPath, binaryPath, tempPath}
+	return &Paths{ComponentsPath: componentsPath, BinaryPath: binaryPath, TempPath: tempPath}
 }
 
 type InstallCredentials struct {
@@ -136,6 +239,7 @@ func NewInstallParameters(
 	caCertPath string,
 ) *Parameters {
 	return &Parameters{
+		SchemaVersion:         ParametersSchemaVersion,
 		InstallRequest:        installRequest,
 		Credentials:           InstallCredentials{},
 		Assets:                assets,
@@ -155,12 +259,39 @@ func NewInstallParameters(
 // NewUninstallParameters creates a Parameters structure for uninstalling operations.
 func NewUninstallParameters(request *grpc_installer_go.UninstallClusterRequest, appCluster bool) *Parameters {
 	return &Parameters{
+		SchemaVersion:    ParametersSchemaVersion,
 		UninstallRequest: request,
 		Credentials:      InstallCredentials{},
 		AppCluster:       appCluster,
 	}
 }
 
+// RotateSecretsRequest with the cluster whose secrets are rotated.
+type RotateSecretsRequest struct {
+	RequestId string `json:"request_id"`
+	// KubeConfigRaw with the contents of the kubeconfig file of the cluster.
+	KubeConfigRaw string `json:"kube_config_raw"`
+}
+
+// NewRotateSecretsParameters creates a Parameters structure for secret rotations.
+//   params:
+//     request The rotation request.
+//     paths The paths with the registries file, if the registry credentials are rotated.
+//     authxSecret The new authx secret, a random one is generated if empty.
+//     appCluster Whether the cluster is an application cluster.
+//   returns:
+//     The parameters of the rotation workflow.
+func NewRotateSecretsParameters(request *RotateSecretsRequest, paths Paths, authxSecret string, appCluster bool) *Parameters {
+	return &Parameters{
+		SchemaVersion:        ParametersSchemaVersion,
+		RotateSecretsRequest: request,
+		Credentials:          InstallCredentials{},
+		Paths:                paths,
+		AuthSecret:           authxSecret,
+		AppCluster:           appCluster,
+	}
+}
+
 // NewParametersFromFile extract a parameters object from a file.
 func NewParametersFromFile(filePath string) (*Parameters, derrors.Error) {
 	content, err := ioutil.ReadFile(filePath)
@@ -172,14 +303,39 @@ func NewParametersFromFile(filePath string) (*Parameters, derrors.Error) {
 	if err != nil {
 		return nil, derrors.NewInternalError(errors.CannotParseParameters, err)
 	}
+	if parameters.SchemaVersion > ParametersSchemaVersion {
+		return nil, derrors.NewFailedPreconditionError(errors.UnsupportedParametersVersion).WithParams(
+			filePath, parameters.SchemaVersion, ParametersSchemaVersion)
+	}
 	return parameters, nil
 }
 
+// PlatformType returns the platform of the cluster passed to the commands: the Platform if set, or the target
+// platform of the request.
+func (p Parameters) PlatformType() string {
+	if p.Platform != "" {
+		return p.Platform
+	}
+	if p.InstallRequest != nil {
+		return p.InstallRequest.TargetPlatform.String()
+	}
+	if p.UninstallRequest != nil {
+		return p.UninstallRequest.TargetPlatform.String()
+	}
+	return ""
+}
+
 // Validate checks the parameters to determine if the workflow can be executed.
 func (p *Parameters) Validate() derrors.Error {
 	if p.Credentials.Username == "" && p.Credentials.PrivateKeyPath == "" && p.Credentials.KubeConfigPath == "" {
 		return derrors.NewInternalError("credentials have not been loaded. Call LoadCredentials() before Validate()")
 	}
+	if err := entities.ValidPlatform(p.Platform); err != nil {
+		return err
+	}
+	if err := p.ValidateSchema(); err != nil {
+		return err
+	}
 
 	if p.InstallRequest != nil && p.Credentials.KubeConfigPath == "" && len(p.InstallRequest.Nodes) == 0 {
 		return derrors.NewInternalError(errors.InvalidNumMaster)
@@ -224,6 +380,8 @@ func (p *Parameters) LoadCredentials() derrors.Error {
 		kubeConfigRaw = p.InstallRequest.KubeConfigRaw
 	} else if p.UninstallRequest != nil {
 		kubeConfigRaw = p.UninstallRequest.KubeConfigRaw
+	} else if p.RotateSecretsRequest != nil {
+		kubeConfigRaw = p.RotateSecretsRequest.KubeConfigRaw
 	}
 
 	// Load its contents in credentials if required as some cases in the install process do not require it.
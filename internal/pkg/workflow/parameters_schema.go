@@ -0,0 +1,455 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Parameters schema
+// The schema of the parameters is the Parameters structure. Its version is stored with the parameters, so the
+// parameters files written for a newer installer are rejected instead of rendering the templates with missing values.
+// The format of the hosts, ports, IP addresses and identifiers is checked before rendering a template, and the
+// parameters referenced by the templates are checked against the structure so a typo is reported with its location
+// instead of failing when the template is applied. A template declares the parameters that must be set with a
+// comment such as:
+//
+// // requires: InstallRequest.Hostname, ManagementClusterHost
+
+package workflow
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/satori/go.uuid"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ParametersSchemaVersion is the version of the schema of the parameters created by this installer. The parameters
+// without a version are created by previous installers and follow the first version.
+const ParametersSchemaVersion = 1
+
+// ParameterFormat with the format of the value of a parameter.
+type ParameterFormat string
+
+const (
+	// HostFormat for IPv4 or IPv6 addresses or DNS names.
+	HostFormat ParameterFormat = "host"
+	// IPFormat for IPv4 or IPv6 addresses.
+	IPFormat ParameterFormat = "ip"
+	// PortFormat for TCP or UDP ports.
+	PortFormat ParameterFormat = "port"
+	// UUIDFormat for the identifiers generated by the platform.
+	UUIDFormat ParameterFormat = "uuid"
+)
+
+// ParameterRule defines the format of a parameter.
+type ParameterRule struct {
+	// Path of the parameter as referenced by the templates, such as InstallRequest.Hostname.
+	Path string
+	// Format of the parameter. Each element is checked if the parameter is a list.
+	Format ParameterFormat
+	// Identifier indicates if the rule only applies when the parameters require strict identifiers.
+	Identifier bool
+}
+
+// ParameterRules contains the format of the parameters checked before rendering the templates. The parameters
+// that are not set are not checked, as they are only required by some templates.
+var ParameterRules = []ParameterRule{
+	{Path: "ManagementClusterHost", Format: HostFormat},
+	{Path: "ManagementClusterPort", Format: PortFormat},
+	{Path: "DNSClusterHost", Format: HostFormat},
+	{Path: "DNSClusterPort", Format: PortFormat},
+	{Path: "NetworkConfig.IstioGatewayIP", Format: IPFormat},
+	{Path: "InstallRequest.Hostname", Format: HostFormat},
+	{Path: "InstallRequest.Nodes", Format: HostFormat},
+	{Path: "InstallRequest.RequestId", Format: UUIDFormat, Identifier: true},
+	{Path: "InstallRequest.OrganizationId", Format: UUIDFormat, Identifier: true},
+	{Path: "InstallRequest.ClusterId", Format: UUIDFormat, Identifier: true},
+	{Path: "UninstallRequest.RequestId", Format: UUIDFormat, Identifier: true},
+	{Path: "UninstallRequest.OrganizationId", Format: UUIDFormat, Identifier: true},
+	{Path: "UninstallRequest.ClusterId", Format: UUIDFormat, Identifier: true},
+}
+
+// requiresRegex matches the comments of the templates declaring the parameters they require.
+var requiresRegex = regexp.MustCompile(`(?m)^[[:blank:]]*//[[:blank:]]*requires:(.*)$`)
+
+// nilParameterRegex matches the errors of the templates referencing a parameter inside one that is not set.
+var nilParameterRegex = regexp.MustCompile(`at <([^>]+)>: nil pointer evaluating`)
+
+// validFormat checks that a value follows a format.
+func validFormat(format ParameterFormat, value string) bool {
+	switch format {
+	case HostFormat:
+		return net.ParseIP(value) != nil || len(validation.IsDNS1123Subdomain(strings.ToLower(value))) == 0
+	case IPFormat:
+		return net.ParseIP(value) != nil
+	case PortFormat:
+		port, err := strconv.Atoi(value)
+		return err == nil && port > 0 && port <= 65535
+	case UUIDFormat:
+		_, err := uuid.FromString(value)
+		return err == nil
+	}
+	return false
+}
+
+// ValidateSchema checks the version of the parameters and the format of the parameters that are set.
+//   returns:
+//     An error if the version is not supported or a parameter does not follow its format.
+func (p *Parameters) ValidateSchema() derrors.Error {
+	if p.SchemaVersion > ParametersSchemaVersion {
+		return derrors.NewFailedPreconditionError(errors.UnsupportedParametersVersion).WithParams(
+			p.SchemaVersion, ParametersSchemaVersion)
+	}
+	for _, rule := range ParameterRules {
+		if rule.Identifier && !p.StrictIdentifiers {
+			continue
+		}
+		value, found := parameterValue(*p, strings.Split(rule.Path, "."))
+		if !found {
+			continue
+		}
+		values := make([]string, 0)
+		switch value.Kind() {
+		case reflect.String:
+			values = append(values, value.String())
+		case reflect.Slice:
+			for i := 0; i < value.Len(); i++ {
+				values = append(values, value.Index(i).String())
+			}
+		}
+		for _, v := range values {
+			if v != "" && !validFormat(rule.Format, v) {
+				return derrors.NewInvalidArgumentError(errors.InvalidParameterFormat).WithParams(
+					rule.Path, v, fmt.Sprintf("expecting %s", rule.Format))
+			}
+		}
+	}
+	return nil
+}
+
+// parameterValue obtains the value of a parameter.
+//   params:
+//     params The parameters.
+//     path The fields leading to the parameter.
+//   returns:
+//     The value of the parameter.
+//     Whether the parameter and the ones containing it are set.
+func parameterValue(params Parameters, path []string) (reflect.Value, bool) {
+	value := reflect.ValueOf(params)
+	for _, name := range path {
+		for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+			if value.IsNil() {
+				return reflect.Value{}, false
+			}
+			value = value.Elem()
+		}
+		switch value.Kind() {
+		case reflect.Struct:
+			if method := value.MethodByName(name); method.IsValid() && method.Type().NumIn() == 0 {
+				value = method.Call(nil)[0]
+				continue
+			}
+			value = value.FieldByName(name)
+			if !value.IsValid() {
+				return reflect.Value{}, false
+			}
+		case reflect.Map:
+			value = value.MapIndex(reflect.ValueOf(name))
+			if !value.IsValid() {
+				return reflect.Value{}, false
+			}
+		default:
+			return reflect.Value{}, false
+		}
+	}
+	if (value.Kind() == reflect.Ptr || value.Kind() == reflect.Map || value.Kind() == reflect.Slice) && value.IsNil() {
+		return reflect.Value{}, false
+	}
+	return value, true
+}
+
+// parameterFields returns the fields and methods that can be referenced on a type by a template, or nil if any
+// name can be referenced, as with maps.
+func parameterFields(t reflect.Type) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	names := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			names = append(names, t.Field(i).Name)
+		}
+	}
+	methods := reflect.PtrTo(t)
+	for i := 0; i < methods.NumMethod(); i++ {
+		names = append(names, methods.Method(i).Name)
+	}
+	return names
+}
+
+// parameterType resolves the type of a parameter referenced by a template.
+//   params:
+//     path The fields leading to the parameter.
+//   returns:
+//     The number of fields resolved, len(path) if the parameter is defined by the schema.
+//     The type of the last field resolved.
+func parameterType(path []string) (int, reflect.Type) {
+	t := reflect.TypeOf(Parameters{})
+	for index, name := range path {
+		if method, found := t.MethodByName(name); found && t.Kind() != reflect.Interface && method.Type.NumOut() > 0 {
+			t = method.Type.Out(0)
+			continue
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Map, reflect.Interface:
+			return len(path), t
+		case reflect.Struct:
+			field, found := t.FieldByName(name)
+			if !found || field.PkgPath != "" {
+				return index, t
+			}
+			t = field.Type
+		default:
+			return index, t
+		}
+	}
+	return len(path), t
+}
+
+// suggestParameter returns the field or method of a type whose name is closest to an unknown one.
+func suggestParameter(t reflect.Type, name string) string {
+	best := ""
+	bestDistance := 3
+	for _, candidate := range parameterFields(t) {
+		if strings.EqualFold(candidate, name) {
+			return candidate
+		}
+		if distance := editDistance(strings.ToLower(candidate), strings.ToLower(name)); distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between two strings.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func min3(a int, b int, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// unknownParameter returns the error of a template referencing a parameter not defined by the schema.
+func unknownParameter(tree *parse.Tree, node parse.Node, path []string) derrors.Error {
+	resolved, t := parameterType(path)
+	location, _ := tree.ErrorContext(node)
+	params := []interface{}{strings.Join(path, "."), location}
+	if suggestion := suggestParameter(t, path[resolved]); suggestion != "" {
+		fixed := append(append(append([]string{}, path[:resolved]...), suggestion), path[resolved+1:]...)
+		params = append(params, fmt.Sprintf("did you mean %s?", strings.Join(fixed, ".")))
+	}
+	return derrors.NewInvalidArgumentError(errors.UnknownTemplateParameter).WithParams(params...)
+}
+
+// referenceChecker checks the parameters referenced by a template.
+type referenceChecker struct {
+	tree *parse.Tree
+}
+
+// checkPath checks that a parameter referenced by a template is defined by the schema.
+func (c *referenceChecker) checkPath(node parse.Node, path []string) derrors.Error {
+	if len(path) == 0 {
+		return nil
+	}
+	if resolved, _ := parameterType(path); resolved < len(path) {
+		return unknownParameter(c.tree, node, path)
+	}
+	return nil
+}
+
+// checkNode checks the parameters referenced by a node.
+//   params:
+//     node The node of the template.
+//     rootDot Whether the dot of the node is the parameters, instead of the element of a range or with.
+func (c *referenceChecker) checkNode(node parse.Node, rootDot bool) derrors.Error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := c.checkNode(child, rootDot); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return c.checkNode(n.Pipe, rootDot)
+	case *parse.IfNode:
+		return c.checkBranch(&n.BranchNode, rootDot, rootDot)
+	case *parse.RangeNode:
+		return c.checkBranch(&n.BranchNode, rootDot, false)
+	case *parse.WithNode:
+		return c.checkBranch(&n.BranchNode, rootDot, false)
+	case *parse.TemplateNode:
+		return c.checkNode(n.Pipe, rootDot)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				if err := c.checkNode(arg, rootDot); err != nil {
+					return err
+				}
+			}
+		}
+	case *parse.FieldNode:
+		if rootDot {
+			return c.checkPath(n, n.Ident)
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 0 && n.Ident[0] == "$" {
+			return c.checkPath(n, n.Ident[1:])
+		}
+	case *parse.ChainNode:
+		return c.checkNode(n.Node, rootDot)
+	}
+	return nil
+}
+
+// checkBranch checks the parameters referenced by an if, range or with node.
+func (c *referenceChecker) checkBranch(n *parse.BranchNode, rootDot bool, listRootDot bool) derrors.Error {
+	if err := c.checkNode(n.Pipe, rootDot); err != nil {
+		return err
+	}
+	if err := c.checkNode(n.List, listRootDot); err != nil {
+		return err
+	}
+	return c.checkNode(n.ElseList, rootDot)
+}
+
+// checkReferences checks that the parameters referenced by a parsed template are defined by the schema.
+//   params:
+//     ft The parsed template.
+//   returns:
+//     An error with the location of the first unknown parameter, if any.
+func checkReferences(ft *template.Template) derrors.Error {
+	for _, t := range ft.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		checker := &referenceChecker{tree: t.Tree}
+		// The templates defined inside the workflow are executed with the dot passed by the template action.
+		if err := checker.checkNode(t.Tree.Root, t.Name() == ft.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requiredParameters returns the parameters declared as required by the comments of a template.
+func requiredParameters(content string) []string {
+	result := make([]string, 0)
+	for _, match := range requiresRegex.FindAllStringSubmatch(content, -1) {
+		for _, path := range strings.Split(match[1], ",") {
+			path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+			path = strings.TrimPrefix(path, ".")
+			if path != "" {
+				result = append(result, path)
+			}
+		}
+	}
+	return result
+}
+
+// checkRequired checks that the parameters required by a template are set.
+//   params:
+//     content The content of the template.
+//     name The name of the template.
+//     params The parameters.
+//   returns:
+//     An error if a required parameter is unknown or not set.
+func checkRequired(content string, name string, params Parameters) derrors.Error {
+	for _, path := range requiredParameters(content) {
+		fields := strings.Split(path, ".")
+		if resolved, _ := parameterType(fields); resolved < len(fields) {
+			return derrors.NewInvalidArgumentError(errors.UnknownTemplateParameter).WithParams(path, name)
+		}
+		value, found := parameterValue(params, fields)
+		if !found || isZero(value) {
+			return derrors.NewInvalidArgumentError(errors.MissingTemplateParameter).WithParams(path, name)
+		}
+	}
+	return nil
+}
+
+// isZero checks if a value is the zero value of its type, or an empty list or map.
+func isZero(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	}
+	return reflect.DeepEqual(value.Interface(), reflect.Zero(value.Type()).Interface())
+}
+
+// missingParameter converts the errors applying a template that references a parameter inside one that is not set,
+// such as the install request of an uninstall, into an error with the missing parameter.
+func missingParameter(err error, diagnostic string) derrors.Error {
+	match := nilParameterRegex.FindStringSubmatch(err.Error())
+	if match == nil {
+		return derrors.NewInternalError(errors.CannotApplyTemplate, err).WithParams(diagnosticParams(diagnostic)...)
+	}
+	path := strings.TrimPrefix(strings.TrimPrefix(match[1], "$"), ".")
+	return derrors.NewInvalidArgumentError(errors.MissingTemplateParameter, err).WithParams(
+		diagnosticParams(diagnostic, path)...)
+}
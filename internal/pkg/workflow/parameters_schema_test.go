@@ -0,0 +1,125 @@
+/*
+ * Copyright 2019 Nalej
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package workflow
+
+import (
+	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+const unknownParameterTemplate = `{
+ "description": "unknownParameterTemplate",
+ "commands": [
+  {"type":"sync", "name": "exec", "cmd": "cmd1", "args":["{{$.InstallRequest.ClusterID}}"]}
+ ]
+}`
+
+const requiredParameterTemplate = `{
+ "description": "requiredParameterTemplate",
+ // requires: InstallRequest.ClusterId, AuthSecret
+ "commands": [
+  {"type":"sync", "name": "exec", "cmd": "cmd1"}
+ ]
+}`
+
+const rangeParameterTemplate = `{
+ "description": "rangeParameterTemplate",
+ "commands": [
+  {"type":"sync", "name": "exec", "cmd": "{{$.PlatformType}}", "args":["{{index $.Bindings "target"}}"]}
+  {{range $node := .InstallRequest.Nodes }}
+  ,{"type":"sync", "name": "exec", "cmd": "{{$node}}", "args":["{{$.InstallRequest.GetClusterId}}"]}
+  {{end}}
+ ]
+}`
+
+var _ = ginkgo.Describe("Parameters schema", func() {
+
+	ginkgo.It("should accept the test parameters", func() {
+		params := GetTestInstallParameters(2, false)
+		gomega.Expect(params.SchemaVersion).To(gomega.Equal(ParametersSchemaVersion))
+		gomega.Expect(params.ValidateSchema()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject parameters with an invalid format", func() {
+		params := GetTestInstallParameters(1, false)
+		params.ManagementClusterHost = "mngt host"
+		gomega.Expect(params.ValidateSchema()).NotTo(gomega.Succeed())
+		params = GetTestInstallParameters(1, false)
+		params.DNSClusterPort = "70000"
+		gomega.Expect(params.ValidateSchema()).NotTo(gomega.Succeed())
+		params = GetTestInstallParameters(1, false)
+		params.InstallRequest.Nodes = append(params.InstallRequest.Nodes, "node_1")
+		err := params.ValidateSchema()
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		gomega.Expect(err.DebugReport()).To(gomega.ContainSubstring("InstallRequest.Nodes"))
+		params = GetTestInstallParameters(1, false)
+		params.NetworkConfig.IstioGatewayIP = "gateway"
+		gomega.Expect(params.ValidateSchema()).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should check the identifiers only when they are strict", func() {
+		params := GetTestUninstallParameters(false)
+		gomega.Expect(params.ValidateSchema()).To(gomega.Succeed())
+		params.StrictIdentifiers = true
+		gomega.Expect(params.ValidateSchema()).NotTo(gomega.Succeed())
+		params.UninstallRequest.RequestId = "5b3a4d4e-4b5c-4f2a-9c1e-7d6f8a9b0c1d"
+		params.UninstallRequest.OrganizationId = "0f1e2d3c-4b5a-4968-8776-a5b4c3d2e1f0"
+		params.UninstallRequest.ClusterId = "a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d"
+		gomega.Expect(params.ValidateSchema()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject parameters of a newer schema", func() {
+		params := GetTestInstallParameters(1, false)
+		params.SchemaVersion = ParametersSchemaVersion + 1
+		gomega.Expect(params.ValidateSchema()).NotTo(gomega.Succeed())
+	})
+
+	ginkgo.It("should suggest the parameter when a template references an unknown one", func() {
+		_, err := NewParser().render(unknownParameterTemplate, "unknownParameterTemplate", *GetTestInstallParameters(1, false))
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring(errors.UnknownTemplateParameter))
+		gomega.Expect(err.DebugReport()).To(gomega.ContainSubstring("did you mean InstallRequest.ClusterId?"))
+	})
+
+	ginkgo.It("should accept the references to methods, maps and range variables", func() {
+		params := GetTestInstallParameters(2, false)
+		params.Bindings = map[string]string{"target": "value"}
+		rendered, err := NewParser().render(rangeParameterTemplate, "rangeParameterTemplate", *params)
+		gomega.Expect(err).To(gomega.Succeed())
+		gomega.Expect(rendered).To(gomega.ContainSubstring("10.1.1.1"))
+	})
+
+	ginkgo.It("should report the parameters required by a template", func() {
+		params := GetTestInstallParameters(1, false)
+		_, err := NewParser().render(requiredParameterTemplate, "requiredParameterTemplate", *params)
+		gomega.Expect(err).To(gomega.Succeed())
+		params.AuthSecret = ""
+		_, err = NewParser().render(requiredParameterTemplate, "requiredParameterTemplate", *params)
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring(errors.MissingTemplateParameter))
+		gomega.Expect(err.DebugReport()).To(gomega.ContainSubstring("AuthSecret"))
+	})
+
+	ginkgo.It("should report the parameters missing when a template is applied", func() {
+		_, err := NewParser().render(basicTemplateIteration, "basicTemplateIteration", *GetTestUninstallParameters(false))
+		gomega.Expect(err).NotTo(gomega.Succeed())
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring(errors.MissingTemplateParameter))
+		gomega.Expect(err.DebugReport()).To(gomega.ContainSubstring("InstallRequest.RequestId"))
+	})
+})
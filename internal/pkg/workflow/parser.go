@@ -21,6 +21,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"github.com/nalej/installer/internal/pkg/errors"
+	"github.com/nalej/installer/internal/pkg/logging"
 	"github.com/rs/zerolog/log"
 	"io/ioutil"
 	"regexp"
@@ -40,11 +41,19 @@ type rawWorkflow struct {
 // Parser structure with the required parameters.
 type Parser struct {
 	cmdParser commands.CmdParser
+	// templates used to resolve include commands.
+	templates TemplateProvider
 }
 
 // NewParser creates a new parser.
 func NewParser() *Parser {
-	return &Parser{*commands.NewCmdParser()}
+	return &Parser{cmdParser: *commands.NewCmdParser()}
+}
+
+// WithTemplates sets the provider used to resolve the templates referenced by include commands.
+func (p *Parser) WithTemplates(provider TemplateProvider) *Parser {
+	p.templates = provider
+	return p
 }
 
 // ReadWorkflow reads a workflow from a file, parsing the data and applying the template.
@@ -72,27 +81,133 @@ func (p *Parser) ReadWorkflow(workflowID string, filePath string, name string, p
 //     A Workflow structure.
 //     An error if the workflow cannot be generated.
 func (p *Parser) ParseWorkflow(workflowID string, content string, name string, params Parameters) (*Workflow, derrors.Error) {
-	ft := template.New("Workflow: " + name).Funcs(template.FuncMap{
+	rendered, err := p.render(content, name, params)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(rendered, name, params); err != nil {
+		return nil, err
+	}
+	jsonPayload, err := p.preprocess(rendered, params)
+	if err != nil {
+		return nil, err
+	}
+	return p.ParseJSON(workflowID, jsonPayload, name)
+}
+
+// LintWorkflow renders a workflow template and validates it against the schema of the supported commands.
+//   params:
+//     content The template content with the workflow.
+//     name The name of the workflow.
+//     params The template parameters.
+//   returns:
+//     The list of issues found, empty if the workflow is valid.
+//     An error if the template cannot be rendered.
+func (p *Parser) LintWorkflow(content string, name string, params Parameters) ([]LintIssue, derrors.Error) {
+	rendered, err := p.render(content, name, params)
+	if err != nil {
+		return nil, err
+	}
+	return Lint(rendered), nil
+}
+
+// render applies the parameters to a workflow template.
+func (p *Parser) render(content string, name string, params Parameters) (string, derrors.Error) {
+	templateName := "Workflow: " + name
+	ft := template.New(templateName).Funcs(template.FuncMap{
 		"joinStringArray": func(elements []string) string {
 			return "\"" + strings.Join(elements, "\",\"") + "\""
 		},
+		// toJSON renders a value such as a map as JSON.
+		"toJSON": func(value interface{}) (string, error) {
+			raw, err := json.Marshal(value)
+			return string(raw), err
+		},
+		// output references a value set by a previous command, resolved when the command is launched.
+		"output": entities.OutputReference,
 	})
+	if err := checkRequired(content, name, params); err != nil {
+		return "", err
+	}
 	commentsRegex := regexp.MustCompile("(?m)[\r\n]+^[[:blank:]]*//.*$")
-	// remove comments stating with //
-	templateToParse := commentsRegex.ReplaceAllString(content, "")
+	// remove comments stating with // keeping the line breaks so lint issues point to the template lines
+	templateToParse := commentsRegex.ReplaceAllStringFunc(content, func(comment string) string {
+		return strings.Repeat("\n", strings.Count(comment, "\n"))
+	})
 	ft, err := ft.Parse(templateToParse)
 	if err != nil {
-		return nil, derrors.NewInternalError(errors.CannotParseTemplate, err)
+		return "", derrors.NewInternalError(errors.CannotParseTemplate, err).WithParams(
+			diagnosticParams(templateDiagnostic(err, templateName, content, params))...)
+	}
+	if err := checkReferences(ft); err != nil {
+		return "", err
 	}
 	log.Debug().Str("template", ft.Name()).Msg("Executing template")
 	// output buffer for the JSON content
 	buf := new(bytes.Buffer)
 	err = ft.Execute(buf, params)
 	if err != nil {
-		return nil, derrors.NewInternalError(errors.CannotApplyTemplate, err)
+		return "", missingParameter(err, templateDiagnostic(err, templateName, content, params))
 	}
-	jsonPayload := buf.String()
-	return p.ParseJSON(workflowID, jsonPayload, name)
+	return removeTrailingCommas(buf.String()), nil
+}
+
+// preprocess evaluates the conditions and resolves the includes of a rendered workflow.
+func (p *Parser) preprocess(jsonPayload string, params Parameters) (string, derrors.Error) {
+	if !strings.Contains(jsonPayload, "\""+WhenField+"\"") && !strings.Contains(jsonPayload, entities.IncludeWorkflow) {
+		return jsonPayload, nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(jsonPayload))
+	// Numbers are preserved as they were written.
+	decoder.UseNumber()
+	var content map[string]interface{}
+	if err := decoder.Decode(&content); err != nil {
+		return "", derrors.NewInvalidArgumentError(errors.UnmarshalError, err).WithParams(
+			diagnosticParams(offsetDiagnostic(jsonPayload, jsonErrorOffset(err), params))...)
+	}
+	if err := p.processCommandList(content, params, 0); err != nil {
+		return "", err
+	}
+	result, err := json.Marshal(content)
+	if err != nil {
+		return "", derrors.NewInternalError(errors.MarshalError, err)
+	}
+	return string(result), nil
+}
+
+// processCommandList evaluates the conditions and resolves the includes of the commands contained in the
+// given element.
+func (p *Parser) processCommandList(element map[string]interface{}, params Parameters, depth int) derrors.Error {
+	list, ok := element[CommandsField].([]interface{})
+	if !ok {
+		return nil
+	}
+	processed := make([]interface{}, 0, len(list))
+	for _, entry := range list {
+		cmd, ok := entry.(map[string]interface{})
+		if !ok {
+			processed = append(processed, entry)
+			continue
+		}
+		include, err := evaluateWhen(cmd, params)
+		if err != nil {
+			return err
+		}
+		if !include {
+			continue
+		}
+		if isInclude(cmd) {
+			cmd, err = p.expandInclude(cmd, params, depth)
+		} else {
+			err = p.processCommandList(cmd, params, depth)
+		}
+		if err != nil {
+			return err
+		}
+		processed = append(processed, cmd)
+	}
+	element[CommandsField] = processed
+	return nil
 }
 
 // ParseJSON reads a workflow from a JSON string, parsing the data and applying the template.
@@ -103,25 +218,20 @@ func (p *Parser) ParseWorkflow(workflowID string, content string, name string, p
 //     A Workflow structure.
 //     An error if the workflow cannot be generated.
 func (p *Parser) ParseJSON(workflowID string, jsonPayload string, name string) (*Workflow, derrors.Error) {
-	passwordRegex := regexp.MustCompile("\"password\":\".*\",")
-	privateKeyRegex := regexp.MustCompile("\"privateKey\":\".*\"")
-	redactedJSON := passwordRegex.ReplaceAllString(jsonPayload, "\"password\":\"REDACTED\",")
-	redactedJSON = privateKeyRegex.ReplaceAllString(redactedJSON, "\"privateKey\":\"REDACTED\"")
+	redactedJSON := logging.Redact(jsonPayload)
 	redactedJSON = strings.Replace(redactedJSON, "\n", "", -1)
 	redactedJSON = strings.Replace(redactedJSON, "\t", "", -1)
 	log.Debug().Str("redactedJSON", redactedJSON).Msg("Workflow to be parsed")
 
 	var aux rawWorkflow
 	if err := json.Unmarshal([]byte(jsonPayload), &aux); err != nil {
-		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err).WithParams(jsonPayload)
+		return nil, derrors.NewInvalidArgumentError(errors.UnmarshalError, err).WithParams(
+			diagnosticParams(offsetDiagnostic(jsonPayload, jsonErrorOffset(err), EmptyParameters), name)...)
 	}
 
 	result := make([]entities.Command, 0)
 	for index, raw := range aux.Commands {
-		toShow := string(raw)
-		toShow = passwordRegex.ReplaceAllString(toShow, "\"password\":\"REDACTED\",")
-		toShow = privateKeyRegex.ReplaceAllString(toShow, "\"privateKey\":\"REDACTED\"")
-		log.Debug().Int("index", index).Str("cmd", toShow).Msg("processing cmd")
+		log.Debug().Int("index", index).Str("cmd", logging.Redact(string(raw))).Msg("processing cmd")
 		cmd, err := p.cmdParser.ParseCommand(raw)
 		if err != nil {
 			return nil, err
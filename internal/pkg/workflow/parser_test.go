@@ -19,6 +19,8 @@ package workflow
 
 import (
 	"fmt"
+	"github.com/nalej/derrors"
+	"github.com/nalej/installer/internal/pkg/workflow/commands"
 	"github.com/nalej/installer/internal/pkg/workflow/commands/sync"
 	"github.com/nalej/installer/internal/pkg/workflow/entities"
 	"github.com/onsi/ginkgo"
@@ -58,6 +60,61 @@ const basicTemplateIteration = `
 }
 `
 
+const conditionalTemplate = `
+{
+ "description": "conditionalTemplate",
+ "commands": [
+  {"type":"sync", "name": "exec", "cmd": "always"},
+  {"type":"sync", "name": "exec", "cmd": "appCluster", "when": ".AppCluster"},
+  {"type":"sync", "name": "exec", "cmd": "istio", "when": "eq .NetworkConfig.NetworkingMode \"istio\""},
+  {"type":"sync", "name": "group", "commands": [
+   {"type":"sync", "name": "exec", "cmd": "nested", "when": "not .AppCluster"}
+  ]},
+  {{if .InstallRequest.InstallBaseSystem}}
+  {"type":"sync", "name": "exec", "cmd": "baseSystem"},
+  {{end}}
+ ]
+}
+`
+
+const includedTemplate = `
+{
+ "description": "includedTemplate",
+ "commands": [
+  {"type":"sync", "name": "exec", "cmd": "included", "args": ["{{.Bindings.namespace}}", "{{.InstallRequest.ClusterId}}"]}
+ ]
+}
+`
+
+const singleIncludeTemplate = `
+{
+ "description": "singleIncludeTemplate",
+ "commands": [
+  {"type":"sync", "name": "includeWorkflow", "template": "included", "params": {"namespace": "nalej"}}
+ ]
+}
+`
+
+const includeTemplate = `
+{
+ "description": "includeTemplate",
+ "commands": [
+  {"type":"sync", "name": "includeWorkflow", "template": "included", "params": {"namespace": "nalej"}},
+  {"type":"sync", "name": "includeWorkflow", "template": "self"}
+ ]
+}
+`
+
+type testTemplateProvider map[string]string
+
+func (tp testTemplateProvider) GetContent(name string, version string) (string, derrors.Error) {
+	content, found := tp[name]
+	if !found {
+		return "", derrors.NewNotFoundError("template not found").WithParams(name)
+	}
+	return content, nil
+}
+
 var _ = ginkgo.Describe("Parser", func() {
 	var parser = NewParser()
 
@@ -92,6 +149,43 @@ var _ = ginkgo.Describe("Parser", func() {
 
 	})
 
+	ginkgo.Context("parses a workflow with conditional commands", func() {
+		params := GetTestInstallParameters(1, false)
+		params.NetworkConfig.NetworkingMode = "zt"
+		workflow, err := parser.ParseWorkflow("test", conditionalTemplate, "TestParseWorkflow_Conditional", *params)
+		ginkgo.It("must only contain the commands whose condition is satisfied", func() {
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(len(workflow.Commands)).To(gomega.Equal(2))
+			gomega.Expect(workflow.Commands[0].(*sync.Exec).Cmd).To(gomega.Equal("always"))
+			gomega.Expect(workflow.Commands[1].Name()).To(gomega.Equal(entities.GroupCmd))
+		})
+		ginkgo.It("must reject invalid conditions", func() {
+			_, err := EvaluateCondition(".NotAField", *params)
+			gomega.Expect(err).ShouldNot(gomega.BeNil())
+		})
+	})
+
+	ginkgo.Context("parses a workflow including other templates", func() {
+		params := GetTestInstallParameters(1, false)
+		ginkgo.It("must execute the included commands inline", func() {
+			provider := testTemplateProvider{"included": includedTemplate}
+			includeParser := NewParser().WithTemplates(provider)
+			workflow, err := includeParser.ParseWorkflow("test", singleIncludeTemplate, "TestParseWorkflow_Include", *params)
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(len(workflow.Commands)).To(gomega.Equal(1))
+			group := workflow.Commands[0].(*commands.Group)
+			gomega.Expect(len(group.Commands)).To(gomega.Equal(1))
+			included := group.Commands[0].(*sync.Exec)
+			gomega.Expect(included.Args).To(gomega.Equal([]string{"nalej", params.InstallRequest.ClusterId}))
+		})
+		ginkgo.It("must detect include cycles", func() {
+			provider := testTemplateProvider{"included": includedTemplate, "self": includeTemplate}
+			includeParser := NewParser().WithTemplates(provider)
+			_, err := includeParser.ParseWorkflow("test", includeTemplate, "TestParseWorkflow_IncludeCycle", *params)
+			gomega.Expect(err).ShouldNot(gomega.BeNil())
+		})
+	})
+
 	ginkgo.Context("parses a simple workflow with two different commands", func() {
 		workflow, err := parser.ParseWorkflow("test", basicDefinitionTwoCommands, "TestParseWorkflow_TwoCommands", EmptyParameters)
 		ginkgo.It("must be returned and contain the Exec and SCP commands", func() {
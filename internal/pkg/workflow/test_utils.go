@@ -76,7 +76,7 @@ func GetTestInstallParameters(numNodes int, appCluster bool) *Parameters {
 		ClusterType:       grpc_infrastructure_go.ClusterType_KUBERNETES,
 		InstallBaseSystem: false,
 		KubeConfigRaw:     "KubeConfigContent",
-		Hostname:          "mngt_hostname",
+		Hostname:          "mngt.hostname",
 		Nodes:             nodes,
 		TargetPlatform:    grpc_installer_go.Platform_AZURE,
 	}
@@ -90,8 +90,8 @@ func GetTestInstallParameters(numNodes int, appCluster bool) *Parameters {
 		request,
 		*assets,
 		*paths,
-		"mngtcluster_host", "80",
-		"dns_host", "53",
+		"mngtcluster.host", "80",
+		"dns.host", "53",
 		entities.Production,
 		appCluster,
 		*networkParameters,